@@ -0,0 +1,23 @@
+// apigen regenerates the typed API client without starting the server
+// package, which needs the full runtime environment to initialise.
+package main
+
+import (
+	"backend/internal/apispec"
+	"log"
+	"os"
+)
+
+func main() {
+	out := "client_gen.go"
+	if len(os.Args) > 1 {
+		out = os.Args[1]
+	}
+	src, err := apispec.GenerateClient()
+	if err != nil {
+		log.Fatalf("error generating client: %v", err)
+	}
+	if err := os.WriteFile(out, src, 0o644); err != nil {
+		log.Fatalf("error writing %s: %v", out, err)
+	}
+}
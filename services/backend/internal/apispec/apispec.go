@@ -0,0 +1,333 @@
+// Package apispec defines the published part of the private API. The same
+// definitions validate requests, produce the OpenAPI document and generate
+// the typed client in internal/client.
+package apispec
+
+import (
+	"backend/internal/app/agent"
+	"backend/internal/app/alerts"
+	"backend/internal/app/dependencies"
+	"backend/internal/app/helpers"
+	"backend/internal/app/limits"
+	"backend/internal/app/onboarding"
+	"backend/internal/app/reports"
+	"backend/internal/app/screener"
+	"backend/internal/app/search"
+	"backend/internal/app/strategy"
+	"backend/internal/app/userdata"
+	"backend/internal/app/watchlist"
+	"backend/internal/app/workspaces"
+	"backend/internal/apperr"
+	"backend/internal/budget"
+	"backend/internal/queue"
+	alertsvc "backend/internal/services/alerts"
+	"backend/internal/services/sessions"
+	"backend/internal/services/twofactor"
+	"sort"
+)
+
+// Func describes a published private function. Tool names the agent tool that
+// shares its handler and whose declaration matches what the handler accepts;
+// that declaration is the function's argument schema. Budget is its latency
+// budget, budget.Read when unset. Args and Result are zero values of the
+// handler's argument and result types, which the client's methods are typed
+// from; a function without Args takes none and one without Result answers
+// null.
+type Func struct {
+	Tag     string
+	Summary string
+	Tool    string
+	Budget  budget.Class
+	Args    interface{}
+	Result  interface{}
+}
+
+// Funcs is the published part of the /private API
+var Funcs = map[string]Func{
+	// strategy
+	"getStrategies":               {Tag: "strategy", Summary: "List the user's strategies, optionally those with one tag", Tool: "getStrategies", Args: strategy.GetStrategiesArgs{}, Result: []queue.Strategy{}},
+	"explainStrategy":             {Tag: "strategy", Summary: "Describe a strategy's conditions, universe and alert in plain English", Tool: "explainStrategy", Args: strategy.ExplainStrategyArgs{}, Result: strategy.StrategyExplanation{}},
+	"createStrategyFromPrompt":    {Tag: "strategy", Summary: "Create or edit a strategy from a natural-language prompt", Budget: budget.Long, Args: strategy.CreateStrategyFromPromptArgs{}, Result: strategy.CreateStrategyFromPromptResult{}},
+	"deleteStrategy":              {Tag: "strategy", Summary: "Delete a strategy", Tool: "deleteStrategy", Args: strategy.DeleteStrategyArgs{}, Result: map[string]interface{}{}},
+	"setAlert":                    {Tag: "strategy", Summary: "Enable or disable alerts for a strategy", Tool: "configureStrategyAlert", Args: strategy.SetAlertArgs{}, Result: map[string]interface{}{}},
+	"getAlertThresholdSuggestion": {Tag: "strategy", Summary: "Suggest an alert threshold from past signals", Tool: "getAlertThresholdSuggestion", Args: strategy.GetAlertThresholdSuggestionArgs{}, Result: strategy.ThresholdSuggestion{}},
+	"getStrategySignals":          {Tag: "strategy", Summary: "List recent signals of a strategy", Budget: budget.Compute, Args: strategy.GetStrategySignalsArgs{}, Result: strategy.StrategySignalsResponse{}},
+	"createStrategyShareLink":     {Tag: "strategy", Summary: "Create a public link to a strategy report", Args: strategy.CreateShareLinkArgs{}, Result: strategy.ShareLink{}},
+	"getStrategyShareLinks":       {Tag: "strategy", Summary: "List a strategy's share links", Args: strategy.GetShareLinksArgs{}, Result: []strategy.ShareLink{}},
+	"revokeStrategyShareLink":     {Tag: "strategy", Summary: "Revoke a share link", Args: strategy.RevokeShareLinkArgs{}},
+	"getStrategyTemplates":        {Tag: "strategy", Summary: "Browse the strategy template gallery by category or tag, with popularity", Args: strategy.GetStrategyTemplatesArgs{}, Result: strategy.GetStrategyTemplatesResult{}},
+	"instantiateStrategyTemplate": {Tag: "strategy", Summary: "Create a strategy, and optionally its alert, from a template", Args: strategy.InstantiateStrategyTemplateArgs{}, Result: strategy.InstantiateStrategyTemplateResult{}},
+	"getDependencyImpact":         {Tag: "strategy", Summary: "List what depends on a strategy, watchlist or computed column before deleting or editing it", Args: dependencies.GetDependencyImpactArgs{}, Result: dependencies.Impact{}},
+
+	// backtests
+	"run_backtest":           {Tag: "backtest", Summary: "Backtest a strategy", Budget: budget.Backtest, Args: strategy.RunBacktestArgs{}, Result: strategy.BacktestResponse{}}, // the tool requires a date range, the frontend relies on the default
+	"estimateStrategyCost":   {Tag: "backtest", Summary: "Estimate the worker time of a backtest or strategy alert against the plan's thresholds", Args: strategy.EstimateStrategyCostArgs{}, Result: strategy.CostEstimate{}},
+	"run_optimization_sweep": {Tag: "backtest", Summary: "Backtest a strategy over a grid of parameters", Tool: "runOptimizationSweep", Budget: budget.Long, Args: strategy.RunOptimizationSweepArgs{}, Result: strategy.SweepResponse{}},
+	"run_screening":          {Tag: "backtest", Summary: "Run a strategy against the current market", Tool: "runStrategyScreener", Budget: budget.Backtest, Args: strategy.ScreeningArgs{}, Result: strategy.ScreeningResponse{}},
+
+	// market data
+	"getSnapshotsForTickers": {Tag: "market", Summary: "Get daily snapshots for a list of tickers", Tool: "getSnapshotsForTickers", Args: helpers.GetSnapshotsForTickersArgs{}, Result: helpers.GetSnapshotsForTickersResults{}},
+
+	// alerts
+	"getAlerts":    {Tag: "alerts", Summary: "List the user's alerts", Tool: "getAlerts", Result: []alerts.Alert{}},
+	"getAlertLogs": {Tag: "alerts", Summary: "List triggered alerts", Tool: "getAlertLogs", Args: alerts.GetAlertLogsArgs{}, Result: []alerts.GetAlertLogsResult{}},
+	"newAlert":     {Tag: "alerts", Summary: "Create a price alert", Args: alerts.NewAlertArgs{}, Result: alerts.Alert{}},
+	"updateAlert":  {Tag: "alerts", Summary: "Update a price alert", Args: alerts.UpdateAlertArgs{}, Result: alerts.Alert{}},
+	"deleteAlert":  {Tag: "alerts", Summary: "Delete an alert", Args: alerts.DeleteAlertArgs{}},
+
+	"simulateAlert": {Tag: "alerts", Summary: "List when a price or strategy alert would have triggered over past days", Tool: "simulateAlert", Budget: budget.Long, Args: alerts.SimulateAlertArgs{}, Result: alerts.AlertSimulation{}},
+
+	"createChartAlert": {Tag: "alerts", Summary: "Create a price alert at a level clicked on a chart, with a distance and trigger likelihood preview", Args: alerts.CreateChartAlertArgs{}, Result: alerts.ChartAlert{}},
+	"updateChartAlert": {Tag: "alerts", Summary: "Move a price alert to a level dragged to on a chart, with a new preview", Args: alerts.UpdateChartAlertArgs{}, Result: alerts.ChartAlert{}},
+
+	"getEscalationPolicies":  {Tag: "alerts", Summary: "List the user's alert escalation policies", Result: []alerts.EscalationPolicy{}},
+	"setEscalationPolicy":    {Tag: "alerts", Summary: "Set the escalation policy of the user, an alert or a strategy", Args: alerts.SetEscalationPolicyArgs{}, Result: alerts.EscalationPolicy{}},
+	"deleteEscalationPolicy": {Tag: "alerts", Summary: "Delete an alert escalation policy", Args: alerts.DeleteEscalationPolicyArgs{}},
+
+	"getTelegramChat":    {Tag: "alerts", Summary: "Report whether the user has linked a Telegram chat", Result: alerts.TelegramChatStatus{}},
+	"createTelegramLink": {Tag: "alerts", Summary: "Get a one-time link that links the Telegram chat it's opened in", Result: alertsvc.TelegramLink{}},
+	"unlinkTelegramChat": {Tag: "alerts", Summary: "Unlink the user's Telegram chat", Result: alerts.TelegramChatStatus{}},
+
+	"getNotificationRateLimits":   {Tag: "alerts", Summary: "List the user's alert notification rate limit on each channel", Result: []alerts.NotificationRateLimit{}},
+	"setNotificationRateLimit":    {Tag: "alerts", Summary: "Limit the alerts sent over a channel per window, collapsing the rest into a summary", Args: alertsvc.NotificationRateLimit{}, Result: alerts.NotificationRateLimit{}},
+	"deleteNotificationRateLimit": {Tag: "alerts", Summary: "Put a channel back on the default notification rate limit", Args: alerts.DeleteNotificationRateLimitArgs{}, Result: alerts.NotificationRateLimit{}},
+
+	"rateAlert":                   {Tag: "alerts", Summary: "Say whether a triggered alert was useful", Args: alerts.RateAlertArgs{}, Result: map[string]interface{}{}},
+	"getStrategyAlertFeedback":    {Tag: "alerts", Summary: "Summarise the user's feedback on each strategy's alerts", Args: alerts.GetStrategyAlertFeedbackArgs{}, Result: []alerts.StrategyFeedback{}},
+	"getStrategyAlertEvaluations": {Tag: "alerts", Summary: "Show why a strategy alert did or didn't run in recent cycles", Args: alerts.GetStrategyAlertEvaluationsArgs{}, Result: alerts.EvaluationHistory{}},
+
+	"getAlertWebhooks":       {Tag: "alerts", Summary: "List the user's alert webhooks with their last delivery", Result: []alerts.AlertWebhook{}},
+	"createAlertWebhook":     {Tag: "alerts", Summary: "Register a webhook that receives alert triggers as signed JSON events of a chosen schema", Args: alerts.CreateAlertWebhookArgs{}, Result: alerts.AlertWebhook{}},
+	"updateAlertWebhook":     {Tag: "alerts", Summary: "Change or reactivate an alert webhook", Args: alerts.UpdateAlertWebhookArgs{}, Result: alerts.AlertWebhook{}},
+	"deleteAlertWebhook":     {Tag: "alerts", Summary: "Delete an alert webhook", Args: alerts.AlertWebhookArgs{}},
+	"testAlertWebhook":       {Tag: "alerts", Summary: "Send an alert webhook the example event", Args: alerts.AlertWebhookArgs{}, Result: alerts.AlertWebhookTest{}},
+	"getAlertWebhookSchemas": {Tag: "alerts", Summary: "Document the alert webhook event schemas and signature, with examples", Result: alerts.AlertWebhookSchemas{}},
+
+	// watchlists
+	"getWatchlists":       {Tag: "watchlists", Summary: "List the user's watchlists", Tool: "getWatchlists", Result: []watchlist.GetWatchlistsResult{}},
+	"newWatchlist":        {Tag: "watchlists", Summary: "Create a watchlist", Args: watchlist.NewWatchlistArgs{}, Result: 0},
+	"deleteWatchlist":     {Tag: "watchlists", Summary: "Delete a watchlist", Args: watchlist.DeleteWatchlistArgs{}, Result: 0},
+	"getWatchlistItems":   {Tag: "watchlists", Summary: "List the securities in a watchlist", Args: watchlist.GetWatchlistEntriesArgs{}, Result: []watchlist.GetWatchlistEntriesResult{}},
+	"newWatchlistItem":    {Tag: "watchlists", Summary: "Add a security to a watchlist", Args: watchlist.NewWatchlistItemArgs{}, Result: 0},
+	"deleteWatchlistItem": {Tag: "watchlists", Summary: "Remove a security from a watchlist", Args: watchlist.DeleteWatchlistItemArgs{}},
+	"moveWatchlistItem":   {Tag: "watchlists", Summary: "Move a security within or between watchlists", Args: watchlist.MoveWatchlistItemArgs{}, Result: map[string]interface{}{}},
+	"setWatchlistOrder":   {Tag: "watchlists", Summary: "Reorder the user's watchlists", Args: watchlist.SetWatchlistOrderArgs{}, Result: map[string]interface{}{}},
+	"importWatchlist":     {Tag: "watchlists", Summary: "Create or extend a watchlist from a CSV or plain ticker list, reporting unknown and duplicate tickers", Tool: "importWatchlist", Args: watchlist.ImportWatchlistArgs{}, Result: watchlist.ImportWatchlistResult{}},
+	"exportWatchlist":     {Tag: "watchlists", Summary: "Export a watchlist as CSV", Args: watchlist.ExportWatchlistArgs{}, Result: watchlist.ExportWatchlistResult{}},
+
+	// screener
+	"getComputedColumns":   {Tag: "screener", Summary: "List the user's computed screener columns", Tool: "getComputedColumns", Result: []screener.ComputedColumn{}},
+	"createComputedColumn": {Tag: "screener", Summary: "Create a computed screener column", Tool: "createComputedColumn", Args: screener.CreateComputedColumnArgs{}, Result: screener.ComputedColumn{}},
+	"deleteComputedColumn": {Tag: "screener", Summary: "Delete a computed screener column", Args: screener.DeleteComputedColumnArgs{}, Result: map[string]interface{}{}},
+
+	// account
+	"requestDataExport":          {Tag: "account", Summary: "Start building an archive of all of the user's data", Result: userdata.DataExport{}},
+	"getDataExports":             {Tag: "account", Summary: "List the user's data exports with download links", Result: []userdata.DataExport{}},
+	"getSessions":                {Tag: "account", Summary: "List the devices signed in to the user's account", Result: []sessions.Session{}},
+	"revokeSession":              {Tag: "account", Summary: "Sign one device out", Args: sessions.RevokeSessionArgs{}, Result: map[string]bool{}},
+	"revokeAllSessions":          {Tag: "account", Summary: "Sign every device out, optionally keeping the current one", Args: sessions.RevokeAllSessionsArgs{}, Result: map[string]int{}},
+	"getTwoFactorStatus":         {Tag: "account", Summary: "Report whether two-factor authentication is enabled", Result: twofactor.Status{}},
+	"beginTwoFactorEnrollment":   {Tag: "account", Summary: "Generate an authenticator app secret", Result: twofactor.Enrollment{}},
+	"confirmTwoFactorEnrollment": {Tag: "account", Summary: "Enable two-factor authentication with a code from the new secret", Args: twofactor.CodeArgs{}, Result: map[string]interface{}{}},
+	"disableTwoFactor":           {Tag: "account", Summary: "Disable two-factor authentication", Args: twofactor.CodeArgs{}, Result: map[string]bool{}},
+	"getAgentPermissions":        {Tag: "account", Summary: "List what the assistant may change on the user's behalf", Result: []agent.AgentPermission{}},
+	"setAgentPermissions":        {Tag: "account", Summary: "Set what the assistant may change on the user's behalf", Args: agent.SetAgentPermissionsArgs{}, Result: []agent.AgentPermission{}},
+	"getOnboardingStatus":        {Tag: "account", Summary: "Report how far provisioning of a new account has got", Result: onboarding.Status{}},
+
+	// usage
+	"getLimitForecast": {Tag: "usage", Summary: "Project when the user will reach their alert and strategy alert limits", Result: limits.LimitForecastResult{}},
+
+	// reports
+	"getReports":      {Tag: "reports", Summary: "List the user's scheduled weekly reports", Result: []reports.Report{}},
+	"saveReport":      {Tag: "reports", Summary: "Create or update a weekly report of strategies, watchlist movers and trades", Args: reports.Report{}, Result: reports.Report{}},
+	"deleteReport":    {Tag: "reports", Summary: "Delete a scheduled report and its run history", Args: reports.DeleteReportArgs{}, Result: map[string]bool{}},
+	"runReportNow":    {Tag: "reports", Summary: "Build and deliver a report over the last week right away", Args: reports.RunReportNowArgs{}, Result: reports.ReportRun{}},
+	"getReportRuns":   {Tag: "reports", Summary: "List recent report runs and how each was delivered", Args: reports.GetReportRunsArgs{}, Result: []reports.ReportRun{}},
+	"getReportRunPdf": {Tag: "reports", Summary: "Download the PDF a report run generated", Args: reports.GetReportRunPDFArgs{}, Result: reports.GetReportRunPDFResult{}},
+
+	// search
+	"globalSearch":          {Tag: "search", Summary: "Search securities and the user's strategies, watchlists and studies, or list recent and frequent picks", Tool: "searchEntities", Args: search.Args{}, Result: search.Response{}},
+	"recordSearchSelection": {Tag: "search", Summary: "Record that the user opened a search result", Args: search.SelectionArgs{}, Result: map[string]bool{}},
+	"resolveTickers":        {Tag: "search", Summary: "Resolve a list of tickers to securities, optionally as of a date, with how each matched and candidates for the rest", Tool: "resolveTickers", Args: helpers.ResolveTickersArgs{}, Result: helpers.ResolveTickersResult{}},
+
+	// workspaces
+	"getWorkspaces":         {Tag: "workspaces", Summary: "List the user's team workspaces with their members and what is shared to them", Result: []workspaces.Workspace{}},
+	"createWorkspace":       {Tag: "workspaces", Summary: "Create a team workspace with the user as its admin", Args: workspaces.CreateWorkspaceArgs{}, Result: map[string]interface{}{}},
+	"deleteWorkspace":       {Tag: "workspaces", Summary: "Delete a workspace, making what was shared to it private again", Args: workspaces.WorkspaceArgs{}, Result: map[string]interface{}{}},
+	"addWorkspaceMember":    {Tag: "workspaces", Summary: "Add a user to a workspace as viewer, editor or admin, or change their role", Args: workspaces.AddWorkspaceMemberArgs{}, Result: map[string]interface{}{}},
+	"removeWorkspaceMember": {Tag: "workspaces", Summary: "Remove a member from a workspace, or leave it", Args: workspaces.RemoveWorkspaceMemberArgs{}, Result: map[string]interface{}{}},
+	"shareToWorkspace":      {Tag: "workspaces", Summary: "Share a strategy or watchlist to a workspace, or make it private again", Args: workspaces.ShareArgs{}, Result: map[string]interface{}{}},
+	"transferOwnership":     {Tag: "workspaces", Summary: "Hand a strategy or watchlist, with its alert, to another workspace member", Args: workspaces.TransferArgs{}, Result: map[string]interface{}{}},
+
+	// chat
+	"confirmPendingAction": {Tag: "chat", Summary: "Run or cancel an action the assistant is waiting on the user to confirm", Args: agent.ConfirmPendingActionArgs{}, Result: map[string]interface{}{}},
+	"searchConversations":  {Tag: "chat", Summary: "Full-text search over the user's past conversations, with highlighted snippets", Args: agent.SearchConversationsArgs{}, Result: []agent.ConversationSearchHit{}},
+}
+
+// Budgets are the latency budgets of the /public functions and unpublished
+// /private functions that aren't budget.Read
+var Budgets = map[string]budget.Class{
+	"getCurrentSecurityID":    budget.Snapshot,
+	"getCurrentTicker":        budget.Snapshot,
+	"getIcons":                budget.Snapshot,
+	"getPrevClose":            budget.Snapshot,
+	"getSecuritiesFromTicker": budget.Snapshot,
+	"getTickerMenuDetails":    budget.Snapshot,
+	"getMarketStatus":         budget.Snapshot,
+	"getSessionVWAP":          budget.Snapshot,
+
+	"getChartImage":         budget.Compute,
+	"getEarningsText":       budget.Compute,
+	"getFilingText":         budget.Compute,
+	"getStockEdgarFilings":  budget.Compute,
+	"getLatestEdgarFilings": budget.Compute,
+	"getSimilarInstances":   budget.Compute,
+
+	"getQuery": budget.Chat,
+}
+
+// Budget returns the latency budget of a /public or /private function
+func Budget(function string) budget.Class {
+	if fn, ok := Funcs[function]; ok && fn.Budget.Name != "" {
+		return fn.Budget
+	}
+	if c, ok := Budgets[function]; ok {
+		return c
+	}
+	return budget.Read
+}
+
+// Names returns the published function names in sorted order
+func Names() []string {
+	names := make([]string, 0, len(Funcs))
+	for name := range Funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ArgsTool returns the tool whose declaration describes the function's
+// arguments, or "" when they are not declared
+func ArgsTool(function string) string {
+	return Funcs[function].Tool
+}
+
+// OpenAPI describes the published functions as an OpenAPI 3.0
+// document. Every function is a POST to /private with a {func, args} body, so
+// the request body is a oneOf discriminated by func.
+func OpenAPI() map[string]interface{} {
+	var variants []interface{}
+	mapping := map[string]interface{}{}
+	schemas := map[string]interface{}{}
+	for _, name := range Names() {
+		fn := Funcs[name]
+		args := map[string]interface{}{"type": "object"}
+		if fn.Tool != "" {
+			if s := agent.ToolArgs(fn.Tool); s != nil {
+				args = agent.JSONSchema(s)
+			}
+		}
+		ref := "#/components/schemas/" + name
+		schemas[name] = map[string]interface{}{
+			"type":        "object",
+			"description": fn.Summary,
+			"x-tag":       fn.Tag,
+			"required":    []string{"func"},
+			"properties": map[string]interface{}{
+				"func": map[string]interface{}{"type": "string", "enum": []string{name}},
+				"args": args,
+			},
+		}
+		variants = append(variants, map[string]interface{}{"$ref": ref})
+		mapping[name] = ref
+	}
+
+	errorCodes := []string{
+		string(apperr.CodeValidation),
+		string(apperr.CodeNotFound),
+		string(apperr.CodeForbidden),
+		string(apperr.CodeLimitExceeded),
+		string(apperr.CodeUpstreamTimeout),
+		string(apperr.CodeStepUpRequired),
+		string(apperr.CodeConfirmRequired),
+		string(apperr.CodeInternal),
+	}
+	errorResponse := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": description,
+			"headers": map[string]interface{}{
+				"X-Error-Code": map[string]interface{}{
+					"schema": map[string]interface{}{"type": "string", "enum": errorCodes},
+				},
+			},
+			"content": map[string]interface{}{
+				"text/plain": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Peripheral API",
+			"version": "1",
+		},
+		"paths": map[string]interface{}{
+			"/private": map[string]interface{}{
+				"post": map[string]interface{}{
+					"operationId": "private",
+					"summary":     "Call a private function",
+					"security":    []interface{}{map[string]interface{}{"token": []string{}}},
+					"parameters": []interface{}{
+						map[string]interface{}{
+							"name":        "Idempotency-Key",
+							"in":          "header",
+							"description": "Makes retries of newAlert, createChartAlert, setAlert, createStrategyFromPrompt and run_backtest safe",
+							"schema":      map[string]interface{}{"type": "string", "maxLength": 255},
+						},
+						map[string]interface{}{
+							"name":        "X-Dry-Run",
+							"in":          "header",
+							"description": "Admins only: simulate the worker tasks and notifications of the call and answer with {dryRun, result, error, actions}",
+							"schema":      map[string]interface{}{"type": "boolean"},
+						},
+					},
+					"requestBody": map[string]interface{}{
+						"required": true,
+						"content": map[string]interface{}{
+							"application/json": map[string]interface{}{
+								"schema": map[string]interface{}{
+									"oneOf":         variants,
+									"discriminator": map[string]interface{}{"propertyName": "func", "mapping": mapping},
+								},
+							},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "The function's result",
+							"content": map[string]interface{}{
+								"application/json": map[string]interface{}{"schema": map[string]interface{}{}},
+							},
+						},
+						"400": errorResponse("Invalid arguments"),
+						"401": errorResponse("Missing or invalid token"),
+						"403": errorResponse("Forbidden, or a two-factor code is required"),
+						"404": errorResponse("Not found"),
+						"409": errorResponse("Costly request that must be repeated confirmed"),
+						"429": errorResponse("Plan limit exceeded"),
+						"500": errorResponse("Internal error"),
+						"504": errorResponse("Upstream timeout"),
+					},
+				},
+			},
+		},
+		"components": map[string]interface{}{
+			"securitySchemes": map[string]interface{}{
+				"token": map[string]interface{}{"type": "apiKey", "in": "header", "name": "Authorization"},
+			},
+			"schemas": schemas,
+		},
+	}
+}
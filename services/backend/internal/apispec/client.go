@@ -0,0 +1,281 @@
+package apispec
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// clientReserved are the names client.go already declares
+var clientReserved = map[string]bool{"Client": true, "New": true, "DefaultBaseURL": true}
+
+// GenerateClient renders internal/client/client_gen.go: a method for each
+// published function taking and returning copies of its handler's argument
+// and result types. The copies keep the handlers' JSON tags so the client
+// doesn't import the server's packages.
+func GenerateClient() ([]byte, error) {
+	g := &clientGen{names: map[reflect.Type]string{}}
+	for _, name := range Names() {
+		fn := Funcs[name]
+		for _, v := range []interface{}{fn.Args, fn.Result} {
+			if v != nil {
+				g.collect(reflect.TypeOf(v))
+			}
+		}
+	}
+	g.nameTypes()
+
+	var methods bytes.Buffer
+	for _, name := range Names() {
+		fn := Funcs[name]
+		method := exportedName(name)
+		params := "ctx context.Context"
+		args := "nil"
+		if fn.Args != nil {
+			params += ", args " + g.goType(deref(reflect.TypeOf(fn.Args)))
+			args = "args"
+		}
+		fmt.Fprintf(&methods, "\n// %s calls %s: %s\n", method, name, fn.Summary)
+		if fn.Result == nil {
+			fmt.Fprintf(&methods, "func (c *Client) %s(%s) error {\n", method, params)
+			fmt.Fprintf(&methods, "\t_, err := c.Call(ctx, %q, %s)\n\treturn err\n}\n", name, args)
+			continue
+		}
+		result := g.goType(deref(reflect.TypeOf(fn.Result)))
+		fmt.Fprintf(&methods, "func (c *Client) %s(%s) (%s, error) {\n", method, params, result)
+		fmt.Fprintf(&methods, "\tvar out %s\n\terr := c.decode(ctx, %q, %s, &out)\n\treturn out, err\n}\n", result, name, args)
+	}
+
+	var types bytes.Buffer
+	for _, t := range g.sortedTypes() {
+		g.structType(&types, t)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by apigen; DO NOT EDIT.\n\npackage client\n\nimport (\n\t\"context\"\n")
+	if g.usesJSON {
+		out.WriteString("\t\"encoding/json\"\n")
+	}
+	if g.usesTime {
+		out.WriteString("\t\"time\"\n")
+	}
+	out.WriteString(")\n")
+	out.Write(methods.Bytes())
+	out.Write(types.Bytes())
+	return format.Source(out.Bytes())
+}
+
+type clientGen struct {
+	// names are the client's names for the named structs it declares
+	names    map[reflect.Type]string
+	usesJSON bool
+	usesTime bool
+}
+
+// collect records the named structs t refers to
+func (g *clientGen) collect(t reflect.Type) {
+	switch {
+	case opaque(t) != "":
+		return
+	case t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		g.collect(t.Elem())
+	case t.Kind() == reflect.Map:
+		g.collect(t.Elem())
+	case t.Kind() == reflect.Struct:
+		if t.Name() != "" {
+			if _, ok := g.names[t]; ok {
+				return
+			}
+			g.names[t] = ""
+		}
+		for _, f := range fields(t) {
+			g.collect(f.Type)
+		}
+	}
+}
+
+// nameTypes names each struct after its Go type, prefixing as much of its
+// package path as it takes to tell apart structs with the same name
+func (g *clientGen) nameTypes() {
+	byName := map[string][]reflect.Type{}
+	for t := range g.names {
+		byName[t.Name()] = append(byName[t.Name()], t)
+	}
+	for name, types := range byName {
+		if len(types) == 1 && !clientReserved[name] {
+			g.names[types[0]] = name
+			continue
+		}
+		for depth := 1; ; depth++ {
+			seen := map[string]bool{}
+			unique := true
+			for _, t := range types {
+				n := pathPrefix(t.PkgPath(), depth) + name
+				unique = unique && !seen[n] && byName[n] == nil
+				seen[n] = true
+				g.names[t] = n
+			}
+			if unique {
+				break
+			}
+		}
+	}
+}
+
+func (g *clientGen) sortedTypes() []reflect.Type {
+	types := make([]reflect.Type, 0, len(g.names))
+	for t := range g.names {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return g.names[types[i]] < g.names[types[j]] })
+	return types
+}
+
+func (g *clientGen) structType(w *bytes.Buffer, t reflect.Type) {
+	fmt.Fprintf(w, "\ntype %s %s\n", g.names[t], g.structBody(t))
+}
+
+func (g *clientGen) structBody(t reflect.Type) string {
+	var b strings.Builder
+	b.WriteString("struct {\n")
+	for _, f := range fields(t) {
+		tag := ""
+		if name, ok := f.Tag.Lookup("json"); ok {
+			tag = fmt.Sprintf(" `json:%q`", name)
+		}
+		fmt.Fprintf(&b, "\t%s %s%s\n", f.Name, g.goType(f.Type), tag)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// goType is how the client spells t
+func (g *clientGen) goType(t reflect.Type) string {
+	switch o := opaque(t); o {
+	case "json.RawMessage":
+		g.usesJSON = true
+		return o
+	case "time.Time":
+		g.usesTime = true
+		return o
+	case "string":
+		return o
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + g.goType(t.Elem())
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "[]byte"
+		}
+		return "[]" + g.goType(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), g.goType(t.Elem()))
+	case reflect.Map:
+		return fmt.Sprintf("map[%s]%s", g.goType(t.Key()), g.goType(t.Elem()))
+	case reflect.Interface:
+		return "interface{}"
+	case reflect.Struct:
+		if name, ok := g.names[t]; ok {
+			return name
+		}
+		return g.structBody(t)
+	}
+	// Named basic types encode as what they're built on
+	return t.Kind().String()
+}
+
+// opaque is the client type of types that encode themselves, or "" for
+// types the client copies
+func opaque(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		return "time.Time"
+	case t == rawMessageType:
+		return "json.RawMessage"
+	case t.Kind() == reflect.Interface || t.Kind() == reflect.Ptr:
+		return ""
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		return "json.RawMessage"
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return "string"
+	}
+	return ""
+}
+
+// fields are the fields of t as encoding/json sees them, with embedded
+// structs without a JSON name flattened into their parent
+func fields(t reflect.Type) []reflect.StructField {
+	var out []reflect.StructField
+	seen := map[string]bool{}
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		var embedded []reflect.Type
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			ft := deref(f.Type)
+			if f.Anonymous && ft.Kind() == reflect.Struct && strings.Split(tag, ",")[0] == "" && opaque(ft) == "" {
+				embedded = append(embedded, ft)
+				continue
+			}
+			if !f.IsExported() || seen[f.Name] {
+				continue
+			}
+			seen[f.Name] = true
+			out = append(out, f)
+		}
+		// Outer fields win over those of embedded structs
+		for _, e := range embedded {
+			walk(e)
+		}
+	}
+	walk(t)
+	return out
+}
+
+func deref(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// pathPrefix turns the last depth elements of a package path into a name
+// prefix: backend/internal/services/alerts is Alerts at depth 1 and
+// ServicesAlerts at depth 2
+func pathPrefix(path string, depth int) string {
+	parts := strings.Split(path, "/")
+	if depth > len(parts) {
+		depth = len(parts)
+	}
+	return exportedName(strings.Join(parts[len(parts)-depth:], "_"))
+}
+
+// exportedName turns getAlerts and run_backtest into GetAlerts and RunBacktest
+func exportedName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
@@ -0,0 +1,212 @@
+package account
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// The P&L calendar covers any range of days, not just a month, with every day
+// of the range present whether it had trades or not. A closed trade counts on
+// its trade date and, in the intraday breakdown, in the hour (Eastern) of its
+// last exit. Calendars are cached per user and range until the user's trades
+// change.
+const (
+	pnlCalendarMaxDays  = 366
+	pnlCalendarCacheTTL = 10 * time.Minute
+	// under user:%d:* so purging the user's keys covers it
+	pnlCalendarCacheKey = "user:%d:pnl_calendar:%s:%s:%t"
+)
+
+// GetPnLCalendarArgs selects the days of a P&L calendar
+type GetPnLCalendarArgs struct {
+	From string `json:"from"` // YYYY-MM-DD
+	To   string `json:"to"`   // YYYY-MM-DD, inclusive
+	// Intraday adds each day's hourly breakdown
+	Intraday bool `json:"intraday,omitempty"`
+}
+
+// PnLCalendarStat is realized P&L and trade outcomes over a day or an hour
+type PnLCalendarStat struct {
+	PnL        float64 `json:"pnl"`
+	TradeCount int     `json:"trade_count"`
+	Wins       int     `json:"wins"`
+	Losses     int     `json:"losses"`
+	// WinRate is the share of trades that made money, unset without trades
+	WinRate *float64 `json:"win_rate"`
+}
+
+// PnLCalendarHour is one hour of a day's breakdown
+type PnLCalendarHour struct {
+	Hour int `json:"hour"` // 0-23, Eastern
+	PnLCalendarStat
+}
+
+// PnLCalendarDay is one day of a P&L calendar
+type PnLCalendarDay struct {
+	Date string `json:"date"` // YYYY-MM-DD
+	PnLCalendarStat
+	// Hours lists the hours with trades, when the breakdown was asked for
+	Hours []PnLCalendarHour `json:"hours,omitempty"`
+}
+
+// PnLCalendar is a user's daily realized P&L over a range of days
+type PnLCalendar struct {
+	From string           `json:"from"`
+	To   string           `json:"to"`
+	Days []PnLCalendarDay `json:"days"`
+	PnLCalendarStat
+	GreenDays int `json:"green_days"`
+	RedDays   int `json:"red_days"`
+}
+
+const pnlCalendarQuery = `
+	WITH closed AS (
+		SELECT date AS day,
+		       CASE WHEN $4 THEN EXTRACT(HOUR FROM exit_times[array_upper(exit_times, 1)])::int END AS hour,
+		       closedPnL::float8 AS pnl
+		FROM trades
+		WHERE userId = $1
+		  AND status = 'Closed'
+		  AND closedPnL IS NOT NULL
+		  AND date BETWEEN $2 AND $3
+	), agg AS (
+		SELECT day, hour, GROUPING(hour) AS whole_day,
+		       SUM(pnl) AS pnl,
+		       COUNT(*) AS trades,
+		       COUNT(*) FILTER (WHERE pnl > 0) AS wins,
+		       COUNT(*) FILTER (WHERE pnl < 0) AS losses
+		FROM closed
+		GROUP BY GROUPING SETS ((day), (day, hour))
+	)
+	SELECT to_char(d.day, 'YYYY-MM-DD'), a.hour, COALESCE(a.whole_day, 1),
+	       COALESCE(a.pnl, 0), COALESCE(a.trades, 0), COALESCE(a.wins, 0), COALESCE(a.losses, 0)
+	FROM generate_series($2::date, $3::date, interval '1 day') AS d(day)
+	LEFT JOIN agg a ON a.day = d.day::date AND (a.whole_day = 1 OR $4)
+	ORDER BY d.day, 3 DESC, a.hour`
+
+// GetPnLCalendar returns the user's daily realized P&L, trade counts and win
+// rate for a range of days, optionally broken down by hour
+func GetPnLCalendar(ctx context.Context, conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetPnLCalendarArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	from, err := time.Parse("2006-01-02", args.From)
+	if err != nil {
+		return nil, apperr.Validation("from must be a date like 2024-01-31")
+	}
+	to, err := time.Parse("2006-01-02", args.To)
+	if err != nil {
+		return nil, apperr.Validation("to must be a date like 2024-01-31")
+	}
+	if to.Before(from) {
+		return nil, apperr.Validation("to must not be before from")
+	}
+	if days := int(to.Sub(from).Hours()/24) + 1; days > pnlCalendarMaxDays {
+		return nil, apperr.Validation("a calendar covers at most %d days, not %d", pnlCalendarMaxDays, days)
+	}
+
+	key := fmt.Sprintf(pnlCalendarCacheKey, userID, args.From, args.To, args.Intraday)
+	if raw, err := conn.Cache.Get(ctx, key).Bytes(); err == nil {
+		var calendar PnLCalendar
+		if err := json.Unmarshal(raw, &calendar); err == nil {
+			return calendar, nil
+		}
+	}
+
+	calendar, err := pnlCalendar(ctx, conn, userID, from, to, args.Intraday)
+	if err != nil {
+		return nil, err
+	}
+	if raw, err := json.Marshal(calendar); err == nil {
+		if err := conn.Cache.Set(ctx, key, raw, pnlCalendarCacheTTL).Err(); err != nil {
+			log.Printf("⚠️ Caching P&L calendar for user %d failed: %v", userID, err)
+		}
+	}
+	return calendar, nil
+}
+
+func pnlCalendar(ctx context.Context, conn *data.Conn, userID int, from, to time.Time, intraday bool) (PnLCalendar, error) {
+	calendar := PnLCalendar{
+		From: from.Format("2006-01-02"),
+		To:   to.Format("2006-01-02"),
+		Days: []PnLCalendarDay{},
+	}
+	rows, err := conn.DB.Query(ctx, pnlCalendarQuery, userID, from, to, intraday)
+	if err != nil {
+		return calendar, fmt.Errorf("error querying P&L calendar: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var date string
+		var hour *int
+		var wholeDay int
+		var stat PnLCalendarStat
+		if err := rows.Scan(&date, &hour, &wholeDay, &stat.PnL, &stat.TradeCount, &stat.Wins, &stat.Losses); err != nil {
+			return calendar, fmt.Errorf("error scanning P&L calendar row: %v", err)
+		}
+		stat.finish()
+		if wholeDay == 1 {
+			calendar.Days = append(calendar.Days, PnLCalendarDay{Date: date, PnLCalendarStat: stat})
+			calendar.PnL += stat.PnL
+			calendar.TradeCount += stat.TradeCount
+			calendar.Wins += stat.Wins
+			calendar.Losses += stat.Losses
+			if stat.PnL > 0 {
+				calendar.GreenDays++
+			} else if stat.PnL < 0 {
+				calendar.RedDays++
+			}
+			continue
+		}
+		// Whole days come first, so the hour belongs to the last one.
+		// Trades without exit times have no hour to go in.
+		if hour != nil && len(calendar.Days) > 0 {
+			day := &calendar.Days[len(calendar.Days)-1]
+			day.Hours = append(day.Hours, PnLCalendarHour{Hour: *hour, PnLCalendarStat: stat})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return calendar, fmt.Errorf("error iterating P&L calendar rows: %v", err)
+	}
+	calendar.finish()
+	return calendar, nil
+}
+
+// finish rounds the P&L and works out the win rate
+func (s *PnLCalendarStat) finish() {
+	s.PnL = math.Round(s.PnL*100) / 100
+	s.WinRate = nil
+	if s.TradeCount > 0 {
+		rate := math.Round(float64(s.Wins)/float64(s.TradeCount)*1000) / 1000
+		s.WinRate = &rate
+	}
+}
+
+// dropPnLCalendarCache drops the user's cached calendars once their trades
+// change
+func dropPnLCalendarCache(conn *data.Conn, userID int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	iter := conn.Cache.Scan(ctx, 0, fmt.Sprintf("user:%d:pnl_calendar:*", userID), 500).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		log.Printf("⚠️ Scanning cached P&L calendars for user %d failed: %v", userID, err)
+		return
+	}
+	if len(keys) == 0 {
+		return
+	}
+	if err := conn.Cache.Del(ctx, keys...).Err(); err != nil {
+		log.Printf("⚠️ Dropping cached P&L calendars for user %d failed: %v", userID, err)
+	}
+}
@@ -561,6 +561,7 @@ func ProcessTradesWithinConn(conn *data.Conn, userID int) (interface{}, error) {
 		return nil, fmt.Errorf("error committing transaction: %v", err)
 	}
 	txClosed = true
+	dropPnLCalendarCache(conn, userID)
 
 	return map[string]string{
 		"status":  "success",
@@ -3,7 +3,9 @@
 package account
 
 import (
+	"backend/internal/apperr"
 	"backend/internal/data"
+	"backend/internal/services/twofactor"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -1085,8 +1087,26 @@ func GetDailyTradeStats(conn *data.Conn, userID int, rawArgs json.RawMessage) (i
 	return response, nil
 }
 
-// DeleteAllUserTrades deletes all trades for a user
-func DeleteAllUserTrades(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+// DeleteAllUserTradesArgs represents the arguments for DeleteAllUserTrades
+type DeleteAllUserTradesArgs struct {
+	TwoFactorCode string `json:"twoFactorCode,omitempty"`
+}
+
+// DeleteAllUserTrades deletes all trades for a user. Users with two-factor
+// enabled must confirm with a code.
+func DeleteAllUserTrades(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args DeleteAllUserTradesArgs
+	if len(rawArgs) > 0 {
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			return nil, apperr.InvalidArgs(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := twofactor.RequireStepUp(ctx, conn, userID, args.TwoFactorCode); err != nil {
+		return nil, err
+	}
+
 	// Delete all trade executions for the user first
 	execTag, err := conn.DB.Exec(context.Background(),
 		"DELETE FROM trade_executions WHERE userId = $1",
@@ -1110,6 +1130,7 @@ func DeleteAllUserTrades(conn *data.Conn, userID int, _ json.RawMessage) (interf
 		}, nil
 	}
 	tradesDeleted := tradeTag.RowsAffected()
+	dropPnLCalendarCache(conn, userID)
 
 	return map[string]string{
 		"status":  "success",
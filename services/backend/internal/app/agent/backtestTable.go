@@ -0,0 +1,751 @@
+package agent
+
+import (
+	"backend/internal/app/strategy"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// A backtest_table chunk is an instruction rather than data: the model names
+// a cached backtest and how to shape it (columns, derived columns, grouping,
+// sorting, paging) and the table is built here, so the instances never pass
+// through the model.
+
+// Bounds on a table instruction
+const (
+	maxDerivedColumns   = 10
+	maxExpressionLength = 200
+	maxSortKeys         = 5
+	maxGroupByColumns   = 5
+	maxAggregates       = 10
+	maxRowsPerPage      = 100
+)
+
+// TableSort orders rows by one column
+type TableSort struct {
+	Column string `json:"column"`
+	Desc   bool   `json:"desc,omitempty"`
+}
+
+// TableAggregate summarizes a column over each group
+type TableAggregate struct {
+	Func   string `json:"func"`             // count, sum, avg, min, max or median
+	Column string `json:"column,omitempty"` // optional for count
+	As     string `json:"as,omitempty"`     // defaults to func_column
+}
+
+// DerivedColumn adds a column computed per row from an arithmetic expression
+// over other columns, e.g. "(exit_price - entry_price) / entry_price * 100"
+type DerivedColumn struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+}
+
+var tableAggregateFuncs = map[string]bool{"count": true, "sum": true, "avg": true, "min": true, "max": true, "median": true}
+
+func (a TableAggregate) name() string {
+	if a.As != "" {
+		return a.As
+	}
+	if a.Column == "" {
+		return a.Func
+	}
+	return a.Func + "_" + a.Column
+}
+
+// validateInstruction checks the shape of the instruction; column names are
+// checked against the backtest when the table is built
+func (b BacktestTableChunkData) validateInstruction() error {
+	if len(b.DerivedColumns) > maxDerivedColumns {
+		return fmt.Errorf("at most %d derived columns are allowed", maxDerivedColumns)
+	}
+	for _, d := range b.DerivedColumns {
+		if d.Name == "" {
+			return fmt.Errorf("derived columns need a name")
+		}
+		if _, _, err := compileExpression(d.Expression); err != nil {
+			return fmt.Errorf("derived column %q: %v", d.Name, err)
+		}
+	}
+	if len(b.SortBy) > maxSortKeys {
+		return fmt.Errorf("at most %d sort columns are allowed", maxSortKeys)
+	}
+	if len(b.GroupBy) > maxGroupByColumns {
+		return fmt.Errorf("at most %d groupBy columns are allowed", maxGroupByColumns)
+	}
+	if len(b.Aggregates) > maxAggregates {
+		return fmt.Errorf("at most %d aggregates are allowed", maxAggregates)
+	}
+	if len(b.Aggregates) > 0 && len(b.GroupBy) == 0 {
+		return fmt.Errorf("aggregates need groupBy")
+	}
+	for _, a := range b.Aggregates {
+		if !tableAggregateFuncs[a.Func] {
+			return fmt.Errorf("unknown aggregate %q", a.Func)
+		}
+		if a.Column == "" && a.Func != "count" {
+			return fmt.Errorf("aggregate %q needs a column", a.Func)
+		}
+	}
+	if b.Limit < 0 || b.Offset < 0 {
+		return fmt.Errorf("limit and offset cannot be negative")
+	}
+	if b.RowsPerPage < 0 || b.RowsPerPage > maxRowsPerPage {
+		return fmt.Errorf("rowsPerPage must be between 1 and %d", maxRowsPerPage)
+	}
+	return nil
+}
+
+// buildBacktestTable turns a backtest_table instruction into table chunk content
+func buildBacktestTable(b BacktestTableChunkData, bt *strategy.BacktestResponse) (map[string]any, error) {
+	available := map[string]bool{}
+	for _, c := range bt.Summary.Columns {
+		available[c] = true
+	}
+	columns := selectedColumns(b.Columns, bt.Summary.Columns)
+	meta := map[string]ColumnMeta{}
+	for _, c := range bt.Summary.Columns {
+		if m, ok := inferColumnMeta(c); ok {
+			meta[c] = m
+		}
+	}
+
+	rows := make([]map[string]any, 0, len(bt.Instances))
+	for _, instance := range bt.Instances {
+		row := make(map[string]any, len(instance.Instance))
+		for k, v := range instance.Instance {
+			row[k] = v
+		}
+		rows = append(rows, row)
+	}
+
+	for _, d := range b.DerivedColumns {
+		if available[d.Name] {
+			return nil, fmt.Errorf("derived column %q already exists", d.Name)
+		}
+		eval, refs, err := compileExpression(d.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("derived column %q: %v", d.Name, err)
+		}
+		if err := checkColumns(refs, available); err != nil {
+			return nil, fmt.Errorf("derived column %q: %v", d.Name, err)
+		}
+		for _, row := range rows {
+			if v, ok := eval(row); ok {
+				row[d.Name] = v
+			} else {
+				row[d.Name] = nil
+			}
+		}
+		available[d.Name] = true
+		if m, ok := inferColumnMeta(d.Name); ok {
+			meta[d.Name] = m
+		} else {
+			meta[d.Name] = ColumnMeta{Type: "number", Precision: precision(2)}
+		}
+		if !containsString(columns, d.Name) {
+			columns = append(columns, d.Name)
+		}
+	}
+
+	if len(b.GroupBy) > 0 {
+		if err := checkColumns(b.GroupBy, available); err != nil {
+			return nil, fmt.Errorf("groupBy: %v", err)
+		}
+		var aggColumns []string
+		for _, a := range b.Aggregates {
+			if a.Column != "" {
+				aggColumns = append(aggColumns, a.Column)
+			}
+		}
+		if err := checkColumns(aggColumns, available); err != nil {
+			return nil, fmt.Errorf("aggregates: %v", err)
+		}
+		rows = groupRows(rows, b.GroupBy, b.Aggregates)
+		columns = append([]string{}, b.GroupBy...)
+		available = map[string]bool{}
+		for _, c := range b.GroupBy {
+			available[c] = true
+		}
+		for _, a := range b.Aggregates {
+			columns = append(columns, a.name())
+			available[a.name()] = true
+			if a.Func == "count" {
+				meta[a.name()] = ColumnMeta{Type: "integer", Precision: precision(0)}
+			} else if m, ok := meta[a.Column]; ok {
+				meta[a.name()] = m
+			}
+		}
+	}
+
+	sortColumns := make([]string, len(b.SortBy))
+	for i, s := range b.SortBy {
+		sortColumns[i] = s.Column
+	}
+	if err := checkColumns(sortColumns, available); err != nil {
+		return nil, fmt.Errorf("sortBy: %v", err)
+	}
+	sortRows(rows, b.SortBy)
+
+	totalRows := len(rows)
+	if b.Offset >= len(rows) {
+		rows = rows[:0]
+	} else {
+		rows = rows[b.Offset:]
+	}
+	if b.Limit > 0 && b.Limit < len(rows) {
+		rows = rows[:b.Limit]
+	}
+
+	keys, headers, values := formatTableRows(columns, rows)
+	content := map[string]any{
+		"strategyID": b.StrategyID,
+		"caption":    b.Caption,
+		"headers":    headers,
+		"rows":       values,
+	}
+	columnMeta := make([]ColumnMeta, len(keys))
+	for i, k := range keys {
+		columnMeta[i] = meta[k]
+		if k == "ticker" {
+			// the ticker cell may carry its instance link, never a number
+			columnMeta[i] = ColumnMeta{Type: "string"}
+		}
+	}
+	content["columnMeta"] = columnMeta
+	if len(values) < totalRows {
+		content["totalRows"] = totalRows
+	}
+	if b.RowsPerPage > 0 {
+		content["rowsPerPage"] = b.RowsPerPage
+	}
+	return content, nil
+}
+
+// selectedColumns is the requested column list, or every column for "all"
+// or when none of the requested columns exist
+func selectedColumns(requested interface{}, all []string) []string {
+	list, ok := requested.([]interface{})
+	if !ok {
+		return append([]string{}, all...)
+	}
+	var columns []string
+	for _, c := range list {
+		if name, ok := c.(string); ok && containsString(all, name) && !containsString(columns, name) {
+			columns = append(columns, name)
+		}
+	}
+	if len(columns) == 0 {
+		return append([]string{}, all...)
+	}
+	return columns
+}
+
+func checkColumns(names []string, available map[string]bool) error {
+	for _, n := range names {
+		if !available[n] {
+			known := make([]string, 0, len(available))
+			for k := range available {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("unknown column %q (columns: %s)", n, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// groupRows collapses rows sharing the groupBy values into one row per group,
+// in order of first appearance
+func groupRows(rows []map[string]any, groupBy []string, aggregates []TableAggregate) []map[string]any {
+	var order []string
+	groups := map[string][]map[string]any{}
+	for _, row := range rows {
+		parts := make([]string, len(groupBy))
+		for i, c := range groupBy {
+			parts[i] = fmt.Sprint(row[c])
+		}
+		key := strings.Join(parts, "\x00")
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], row)
+	}
+	out := make([]map[string]any, 0, len(order))
+	for _, key := range order {
+		members := groups[key]
+		row := make(map[string]any, len(groupBy)+len(aggregates))
+		for _, c := range groupBy {
+			row[c] = members[0][c]
+		}
+		for _, a := range aggregates {
+			row[a.name()] = aggregate(a, members)
+		}
+		out = append(out, row)
+	}
+	return out
+}
+
+func aggregate(a TableAggregate, rows []map[string]any) any {
+	if a.Func == "count" && a.Column == "" {
+		return len(rows)
+	}
+	var values []float64
+	count := 0
+	for _, row := range rows {
+		if row[a.Column] == nil {
+			continue
+		}
+		count++
+		if v, ok := toFloat(row[a.Column]); ok {
+			values = append(values, v)
+		}
+	}
+	if a.Func == "count" {
+		return count
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	switch a.Func {
+	case "sum", "avg":
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		if a.Func == "avg" {
+			return roundTo(sum/float64(len(values)), 4)
+		}
+		return roundTo(sum, 4)
+	case "min", "max":
+		best := values[0]
+		for _, v := range values[1:] {
+			if (a.Func == "min") == (v < best) {
+				best = v
+			}
+		}
+		return best
+	case "median":
+		sort.Float64s(values)
+		mid := len(values) / 2
+		if len(values)%2 == 0 {
+			return roundTo((values[mid-1]+values[mid])/2, 4)
+		}
+		return values[mid]
+	}
+	return nil
+}
+
+// sortRows orders rows by the sort keys in turn; numbers compare as numbers
+// and empty cells always go last
+func sortRows(rows []map[string]any, keys []TableSort) {
+	if len(keys) == 0 {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, k := range keys {
+			a, b := rows[i][k.Column], rows[j][k.Column]
+			if a == nil || b == nil {
+				if (a == nil) == (b == nil) {
+					continue
+				}
+				return b == nil
+			}
+			c := compareCells(a, b)
+			if c == 0 {
+				continue
+			}
+			if k.Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+func compareCells(a, b any) int {
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	if okA && okB {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func roundTo(v float64, digits int) float64 {
+	p := math.Pow(10, float64(digits))
+	return math.Round(v*p) / p
+}
+
+// formatTableRows puts ticker first, folds timestamp into a ticker link when
+// both are shown and title-cases the headers. It returns the column behind
+// each header alongside the headers.
+func formatTableRows(columns []string, rows []map[string]any) ([]string, []string, [][]any) {
+	merge := containsString(columns, "ticker") && containsString(columns, "timestamp")
+	var out []string
+	if containsString(columns, "ticker") {
+		out = append(out, "ticker")
+	}
+	for _, c := range columns {
+		if c == "ticker" || (merge && c == "timestamp") {
+			continue
+		}
+		out = append(out, c)
+	}
+
+	titler := cases.Title(language.Und)
+	headers := make([]string, len(out))
+	for i, c := range out {
+		words := strings.Split(c, "_")
+		for j, w := range words {
+			words[j] = titler.String(strings.TrimSpace(w))
+		}
+		headers[i] = strings.Join(words, " ")
+	}
+
+	values := make([][]any, len(rows))
+	for i, row := range rows {
+		v := make([]any, len(out))
+		for j, c := range out {
+			if c == "ticker" {
+				v[j] = tickerCell(row["ticker"], row["timestamp"], merge)
+			} else {
+				v[j] = row[c]
+			}
+		}
+		values[i] = v
+	}
+	return out, headers, values
+}
+
+// tickerCell links a ticker to its instance as $$TICKER-TIMESTAMPMS$$ when the
+// timestamp is shown; otherwise the ticker is left as is
+func tickerCell(ticker, timestamp any, withTimestamp bool) any {
+	t, ok := ticker.(string)
+	if !ok {
+		return ticker
+	}
+	if !withTimestamp {
+		return t
+	}
+	var ms string
+	switch v := timestamp.(type) {
+	case int64:
+		ms = fmt.Sprintf("%d", v*1000)
+	case int:
+		ms = fmt.Sprintf("%d", v*1000)
+	case float64:
+		ms = fmt.Sprintf("%d", int64(v*1000))
+	case float32:
+		ms = fmt.Sprintf("%d", int64(v*1000))
+	case string:
+		var ts int64
+		if _, err := fmt.Sscanf(v, "%d", &ts); err == nil {
+			ms = fmt.Sprintf("%d", ts*1000)
+		} else {
+			ms = v
+		}
+	}
+	if ms == "" {
+		return "$$" + t + "$$"
+	}
+	return "$$" + t + "-" + ms + "$$"
+}
+
+// Derived column expressions are plain arithmetic: numbers, column names,
+// + - * / %, parentheses and the functions abs, sqrt, log, round, min and max.
+// Nothing else can be evaluated. A row whose inputs are missing or not numeric,
+// or that divides by zero, gets an empty cell.
+
+type exprFunc func(row map[string]any) (float64, bool)
+
+type exprParser struct {
+	tokens []string
+	pos    int
+	refs   []string
+}
+
+var exprFuncArity = map[string][2]int{ // min and max arguments; -1 is unbounded
+	"abs": {1, 1}, "sqrt": {1, 1}, "log": {1, 1}, "round": {1, 2}, "min": {1, -1}, "max": {1, -1},
+}
+
+// compileExpression parses an expression and returns its evaluator and the
+// columns it reads
+func compileExpression(src string) (exprFunc, []string, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, nil, fmt.Errorf("expression is empty")
+	}
+	if len(src) > maxExpressionLength {
+		return nil, nil, fmt.Errorf("expression is longer than %d characters", maxExpressionLength)
+	}
+	tokens, err := tokenizeExpression(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	fn, err := p.parseSum()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return fn, p.refs, nil
+}
+
+func tokenizeExpression(src string) ([]string, error) {
+	var tokens []string
+	r := []rune(src)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case strings.ContainsRune("+-*/%(),", c):
+			tokens = append(tokens, string(c))
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			j := i
+			for j < len(r) && (unicode.IsDigit(r[j]) || r[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, string(r[i:j]))
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(r) && (unicode.IsLetter(r[j]) || unicode.IsDigit(r[j]) || r[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, string(r[i:j]))
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *exprParser) parseSum() (exprFunc, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "+" || p.peek() == "-" {
+		op := p.next()
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr(op, left, right)
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseProduct() (exprFunc, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "*" || p.peek() == "/" || p.peek() == "%" {
+		op := p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr(op, left, right)
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprFunc, error) {
+	if p.peek() == "-" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(row map[string]any) (float64, bool) {
+			v, ok := operand(row)
+			return -v, ok
+		}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprFunc, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("expression ends early")
+	case tok == "(":
+		inner, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return inner, nil
+	case unicode.IsDigit(rune(tok[0])) || tok[0] == '.':
+		v, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q", tok)
+		}
+		return func(map[string]any) (float64, bool) { return v, true }, nil
+	case unicode.IsLetter(rune(tok[0])) || tok[0] == '_':
+		if p.peek() == "(" {
+			return p.parseCall(tok)
+		}
+		p.refs = append(p.refs, tok)
+		return func(row map[string]any) (float64, bool) {
+			if row[tok] == nil {
+				return 0, false
+			}
+			return toFloat(row[tok])
+		}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", tok)
+}
+
+func (p *exprParser) parseCall(name string) (exprFunc, error) {
+	arity, ok := exprFuncArity[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q", name)
+	}
+	p.next() // (
+	var args []exprFunc
+	if p.peek() != ")" {
+		for {
+			arg, err := p.parseSum()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+	}
+	if p.next() != ")" {
+		return nil, fmt.Errorf("missing ) after %s arguments", name)
+	}
+	if len(args) < arity[0] || (arity[1] >= 0 && len(args) > arity[1]) {
+		return nil, fmt.Errorf("wrong number of arguments to %s", name)
+	}
+	return func(row map[string]any) (float64, bool) {
+		vals := make([]float64, len(args))
+		for i, a := range args {
+			v, ok := a(row)
+			if !ok {
+				return 0, false
+			}
+			vals[i] = v
+		}
+		var out float64
+		switch name {
+		case "abs":
+			out = math.Abs(vals[0])
+		case "sqrt":
+			out = math.Sqrt(vals[0])
+		case "log":
+			out = math.Log(vals[0])
+		case "round":
+			digits := 0
+			if len(vals) == 2 {
+				digits = int(vals[1])
+			}
+			out = roundTo(vals[0], digits)
+		case "min", "max":
+			out = vals[0]
+			for _, v := range vals[1:] {
+				if (name == "min") == (v < out) {
+					out = v
+				}
+			}
+		}
+		return out, !math.IsNaN(out) && !math.IsInf(out, 0)
+	}, nil
+}
+
+func binaryExpr(op string, left, right exprFunc) exprFunc {
+	return func(row map[string]any) (float64, bool) {
+		a, ok := left(row)
+		if !ok {
+			return 0, false
+		}
+		b, ok := right(row)
+		if !ok {
+			return 0, false
+		}
+		var out float64
+		switch op {
+		case "+":
+			out = a + b
+		case "-":
+			out = a - b
+		case "*":
+			out = a * b
+		case "/":
+			if b == 0 {
+				return 0, false
+			}
+			out = a / b
+		case "%":
+			if b == 0 {
+				return 0, false
+			}
+			out = math.Mod(a, b)
+		}
+		return out, !math.IsNaN(out) && !math.IsInf(out, 0)
+	}
+}
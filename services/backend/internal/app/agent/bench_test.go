@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Benchmarks of conversation serialization, which runs on every chat turn
+// and every cache read
+
+// benchConversation is a full cached conversation: maxCachedMessages turns,
+// each with text and table chunks, a tool call and its result
+func benchConversation() *ActiveConversationCache {
+	now := time.Now()
+	text := strings.Repeat("NVDA gapped up 4% on volume twice its 20 day average. ", 20)
+	table := map[string]interface{}{
+		"headers": []string{"Ticker", "Change", "Volume"},
+		"rows":    [][]interface{}{{"NVDA", 4.1, 51_000_000}, {"AMD", 2.3, 38_000_000}, {"AVGO", 1.7, 9_000_000}},
+	}
+	conv := &ActiveConversationCache{ConversationID: "bench", Title: "Benchmark", UpdatedAt: now}
+	for i := 0; i < maxCachedMessages; i++ {
+		conv.Messages = append(conv.Messages, ChatMessage{
+			MessageID:     fmt.Sprintf("m%d", i),
+			Query:         "Which semis are moving on volume today?",
+			ContentChunks: []ContentChunk{{Type: ChunkTypeText, Content: text}, {Type: "table", Content: table}},
+			FunctionCalls: []FunctionCall{{Name: "runScreener", Args: json.RawMessage(`{"sector":"Technology","limit":25}`)}},
+			ToolResults:   []ExecuteResult{{FunctionID: int64(i), FunctionName: "runScreener", Result: table}},
+			Timestamp:     now,
+			CompletedAt:   now,
+			TokenCount:    1800,
+			Status:        "completed",
+		})
+	}
+	conv.MessageCount = len(conv.Messages)
+	return conv
+}
+
+func BenchmarkConversationCacheMarshal(b *testing.B) {
+	conv := benchConversation()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(conv); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkConversationCacheUnmarshal(b *testing.B) {
+	raw, err := json.Marshal(benchConversation())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(raw)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var conv ActiveConversationCache
+		if err := json.Unmarshal(raw, &conv); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkConversationHistoryBuild converts stored messages into the
+// planner's model input
+func BenchmarkConversationHistoryBuild(b *testing.B) {
+	conv := benchConversation()
+	history := make([]DBConversationMessage, len(conv.Messages))
+	for i, m := range conv.Messages {
+		history[i] = DBConversationMessage{
+			MessageID:     m.MessageID,
+			Query:         m.Query,
+			ContentChunks: m.ContentChunks,
+			FunctionCalls: m.FunctionCalls,
+			ToolResults:   m.ToolResults,
+			CreatedAt:     m.Timestamp,
+			Status:        m.Status,
+			MessageOrder:  i,
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := buildOpenAIConversationHistory("And what about software?", history); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -5,11 +5,15 @@ import (
 	"backend/internal/app/helpers"
 	"backend/internal/app/limits"
 	"backend/internal/app/strategy"
+	"backend/internal/breaker"
+	"backend/internal/clock"
 	"backend/internal/data"
+	"backend/internal/services/chartimage"
 	"backend/internal/services/plotly"
 	"backend/internal/services/socket"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -17,8 +21,6 @@ import (
 	"time"
 
 	"go.uber.org/zap"
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
 
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/responses"
@@ -31,10 +33,9 @@ var (
 )
 
 const (
-	conversationIDKey                     contextKey = "conversationID"
-	messageIDKey                          contextKey = "messageID"
-	peripheralLatestModelThoughtsKey      contextKey = "peripheralLatestModelThoughts"
-	peripheralAlreadyUsedModelThoughtsKey contextKey = "peripheralAlreadyUsedModelThoughts"
+	conversationIDKey                contextKey = "conversationID"
+	messageIDKey                     contextKey = "messageID"
+	peripheralLatestModelThoughtsKey contextKey = "peripheralLatestModelThoughts"
 )
 
 const (
@@ -128,7 +129,8 @@ func getUserChatSuggestionsEnabled(ctx context.Context, conn *data.Conn, userID
 }
 
 // GetChatRequest is the main context-aware chat request handler
-func GetChatRequest(ctx context.Context, conn *data.Conn, userID int, args json.RawMessage) (interface{}, error) {
+func GetChatRequest(ctx context.Context, conn *data.Conn, userID int, args json.RawMessage) (_ interface{}, chatErr error) {
+	started := time.Now()
 	// Check if context is already cancelled
 	if ctx.Err() != nil {
 		return nil, ctx.Err()
@@ -138,6 +140,10 @@ func GetChatRequest(ctx context.Context, conn *data.Conn, userID int, args json.
 	if !success {
 		return nil, fmt.Errorf("%s", message)
 	}
+	// Refuse new chats quickly while the model provider is failing
+	if !breaker.LLM.Allow() {
+		return nil, breaker.LLM.Unavailable()
+	}
 
 	var query ChatRequest
 	if err := json.Unmarshal(args, &query); err != nil {
@@ -171,8 +177,19 @@ func GetChatRequest(ctx context.Context, conn *data.Conn, userID int, args json.
 	ctx = context.WithValue(ctx, messageIDKey, messageID)
 	go socket.SendChatInitializationUpdate(userID, messageID, conversationID)
 
+	// Run under the user's variant of the running prompt/model experiment, if any
+	if assignment := assignExperiment(ctx, userID); assignment != nil {
+		ctx = context.WithValue(ctx, experimentAssignmentKey, assignment)
+		defer func() {
+			recordExperimentOutcome(conn, assignment, userID, conversationID, messageID, started, chatErr)
+		}()
+	}
+
 	// Read user preference for suggestions once per chat request
 	includeSuggestions := getUserChatSuggestionsEnabled(ctx, conn, userID)
+	// Record model and tool traffic for offline replay when AGENT_RECORD_TRACES is set
+	ctx, trace := withTraceRecorder(ctx, userID, conversationID, messageID, query.Query, includeSuggestions)
+	defer trace.save(conn)
 
 	// replaced with activeChatMu
 	if userID != 0 {
@@ -191,377 +208,209 @@ func GetChatRequest(ctx context.Context, conn *data.Conn, userID int, args json.
 	registerChatCancel(userID, cancel)
 	defer clearChatCancel(userID) // guarantees cleanup
 
-	var executor *Executor
-	var activeResults []ExecuteResult
-	var discardedResults []ExecuteResult
-	var accumulatedThoughts []string
-	planningPrompt := ""
-	maxTurns := 15
-	var totalTokenCounts TokenCounts
-	totalTokenCounts.InputTokenCount = 0
-	totalTokenCounts.OutputTokenCount = 0
-	totalTokenCounts.ThoughtsTokenCount = 0
-	totalTokenCounts.TotalTokenCount = 0
+	model := &chatModel{conn: conn, userID: userID, conversationID: conversationID, messageID: messageID, query: query, includeSuggestions: includeSuggestions}
+	logger, _ := zap.NewProduction()
+	tools := &chatTools{
+		executor: NewExecutor(conn, userID, 5, logger, conversationID, messageID),
+		status:   &chatStatus{conn: conn, userID: userID},
+	}
+	model.status = tools.status
+	failed := QueryResponse{
+		ContentChunks:  []ContentChunk{},
+		Suggestions:    []string{},
+		ConversationID: conversationID,
+		MessageID:      messageID,
+	}
 
-	for {
-		// Check if context is cancelled during the planning loop
-		if ctx.Err() != nil {
-			return nil, ctx.Err()
-		}
-		var result interface{}
-		var err error
-		if planningPrompt == "" {
-			planningPrompt, err = BuildPlanningPromptWithConversationID(conn, userID, conversationID, query.Query, query.Context, query.ActiveChartContext)
-			if err != nil {
-				// Mark as error instead of deleting for debugging
-				if markErr := MarkPendingMessageAsError(ctx, conn, userID, conversationID, messageID, fmt.Sprintf("Planner error: %v", err)); markErr != nil {
-					fmt.Printf("Warning: failed to mark pending message as error: %v\n", markErr)
-				}
-				return QueryResponse{
-					ContentChunks:  []ContentChunk{},
-					Suggestions:    []string{},
-					ConversationID: conversationID,
-					MessageID:      messageID,
-					Timestamp:      time.Now(),
-				}, fmt.Errorf("error building planning prompt: %w", err)
-			}
-			// Compose prompt from base + optional suggestions appendix
-			systemPrompt, bErr := buildSystemPrompt("defaultSystemPromptBase", includeSuggestions, suggestionsGuidelinesPlanner)
-			if bErr != nil {
-				return QueryResponse{ContentChunks: []ContentChunk{}, Suggestions: []string{}, ConversationID: conversationID, MessageID: messageID, Timestamp: time.Now()}, fmt.Errorf("error building system prompt: %w", bErr)
-			}
-			result, err = RunPlannerWithSystemPrompt(ctx, conn, conversationID, userID, planningPrompt, systemPrompt, activeResults, accumulatedThoughts)
-		} else {
-			result, err = RunPlanner(ctx, conn, conversationID, userID, planningPrompt, "IntermediateSystemPrompt", activeResults, accumulatedThoughts)
+	out, err := newAgentLoop(model, tools, clock.Real).run(ctx)
+	if err != nil {
+		var loopErr *loopError
+		if !errors.As(err, &loopErr) {
+			return nil, err // cancelled between turns
 		}
-		if err != nil {
-			// Mark as error instead of deleting for debugging
-			if markErr := MarkPendingMessageAsError(ctx, conn, userID, conversationID, messageID, fmt.Sprintf("Planner error: %v", err)); markErr != nil {
-				fmt.Printf("Warning: failed to mark pending message as error: %v\n", markErr)
-			}
-			return QueryResponse{
-				ContentChunks:  []ContentChunk{},
-				Suggestions:    []string{},
-				ConversationID: conversationID,
-				MessageID:      messageID,
-				Timestamp:      time.Now(),
-			}, fmt.Errorf("error fetching response from model: %w", err)
+		// Mark as error instead of deleting for debugging
+		if markErr := MarkPendingMessageAsError(ctx, conn, userID, conversationID, messageID, capitalize(loopErr.Error())); markErr != nil {
+			fmt.Printf("Warning: failed to mark pending message as error: %v\n", markErr)
 		}
-		switch v := result.(type) {
-		case DirectAnswer:
-			totalTokenCounts.OutputTokenCount += int64(v.TokenCounts.OutputTokenCount)
-			totalTokenCounts.InputTokenCount += int64(v.TokenCounts.InputTokenCount)
-			totalTokenCounts.ThoughtsTokenCount += int64(v.TokenCounts.ThoughtsTokenCount)
-			totalTokenCounts.TotalTokenCount += int64(v.TokenCounts.TotalTokenCount)
-
-			// For DirectAnswer, combine all results for storage
-			allResults := append(activeResults, discardedResults...)
-			// process content chunks for storing in db
-
-			chunksForDB := processContentChunksForDB(ctx, conn, userID, v.ContentChunks)
-
-			// Respect user setting: drop suggestions if disabled
-			var directSuggestions []string
-			if includeSuggestions {
-				directSuggestions = v.Suggestions
-			} else {
-				directSuggestions = nil
-			}
-			// Update pending message to completed and get message data with timestamps
-			messageData, err := UpdatePendingMessageToCompletedInConversation(ctx, conn, userID, conversationID, query.Query, chunksForDB, []FunctionCall{}, allResults, directSuggestions, totalTokenCounts)
-
-			if err != nil {
-				return QueryResponse{
-					ContentChunks:  v.ContentChunks,
-					Suggestions:    v.Suggestions,
-					ConversationID: conversationID,
-					MessageID:      messageID,
-					Timestamp:      time.Now(),
-				}, fmt.Errorf("error updating pending message to completed: %w", err)
-			}
-			// Process any table instructions in the content chunks for frontend viewing for backtest table and backtest plot chunks
-			processedChunks := processContentChunksForFrontend(ctx, conn, userID, v.ContentChunks)
-			go func() {
-				// Record usage and deduct 1 credit now that chat completed successfully
-				metadata := map[string]interface{}{
-					"query":           query.Query,
-					"conversation_id": conversationID,
-					"message_id":      messageID,
-					"token_count":     totalTokenCounts.TotalTokenCount,
-					"result_type":     "direct_answer",
-				}
-				if err := limits.RecordUsage(conn, userID, limits.UsageTypeCredits, 1, metadata); err != nil {
-					fmt.Printf("Warning: Failed to record usage for user %d: %v\n", userID, err)
-				}
-				// Update conversation plot if there is none yet
-				ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-				defer cancel()
-				hasPlot, err := HasConversationPlot(ctx, conn, conversationID)
-				fmt.Printf("\n\n\nHas plot: %v\n", hasPlot)
-				if err != nil {
-					fmt.Printf("Warning: failed to check if conversation has plot: %v\n", err)
-				}
-				if !hasPlot {
-					for _, chunk := range v.ContentChunks {
-						if chunk.Type == "plot" {
-							plotBase64, err := plotly.RenderTwitterPlotToBase64(conn, chunk.Content, false)
-							if err != nil {
-								fmt.Printf("Warning: failed to render plot: %v\n", err)
-								continue
-							}
-							err = UpdateConversationPlot(ctx, conn, conversationID, plotBase64)
-							fmt.Printf("\n\n\nUpdated conversation plot")
-							if err != nil {
-								fmt.Printf("Warning: failed to update conversation plot: %v\n", err)
-								continue
-							}
-							break
-						}
-					}
-				}
-			}()
-
-			return QueryResponse{
-				ContentChunks:  processedChunks,
-				Suggestions:    directSuggestions,
-				ConversationID: conversationID,
-				MessageID:      messageID,
-				Timestamp:      messageData.CreatedAt,
-				CompletedAt:    messageData.CompletedAt,
-			}, nil
-		case Plan:
-			// Capture thoughts from this planning iteration
-			if v.Thoughts != "" {
-				accumulatedThoughts = append(accumulatedThoughts, v.Thoughts)
-				ctx = context.WithValue(ctx, peripheralLatestModelThoughtsKey, v.Thoughts)
-			}
-
-			// Handle result discarding if specified in the plan
-			if len(v.DiscardResults) > 0 && v.Stage != StageFinishedExecuting {
-				// Create a map for quick lookup of IDs to discard
-				discardMap := make(map[int64]bool)
-				for _, id := range v.DiscardResults {
-					discardMap[id] = true
-				}
-
-				// Separate active results into kept and discarded
-				var newActiveResults []ExecuteResult
-				for _, result := range activeResults {
-					if discardMap[result.FunctionID] {
-						// Move to discarded
-						discardedResults = append(discardedResults, result)
-					} else {
-						// Keep active
-						newActiveResults = append(newActiveResults, result)
-					}
-				}
-				activeResults = newActiveResults
-			}
-
-			switch v.Stage {
-			case StageExecute:
-				// Create an executor to handle function calls
-				logger, _ := zap.NewProduction()
-				if executor == nil {
-					executor = NewExecutor(conn, userID, 5, logger, conversationID, messageID)
-				}
-				// Safely extract data before goroutine to prevent race conditions and panics
-				if len(v.Rounds) > 0 && len(v.Rounds[0].Calls) > 0 {
-					firstCall := v.Rounds[0].Calls[0]
-					callName := firstCall.Name
-					callArgs := firstCall.Args
+		failed.Timestamp = time.Now()
+		return failed, err
+	}
 
-					go func() {
-						var cleanedModelThoughts string
-						if thoughtsValue := ctx.Value(peripheralLatestModelThoughtsKey); thoughtsValue != nil && thoughtsValue != ctx.Value(peripheralAlreadyUsedModelThoughtsKey) {
-							ctx = context.WithValue(ctx, peripheralAlreadyUsedModelThoughtsKey, thoughtsValue)
-							if thoughtsStr, ok := thoughtsValue.(string); ok {
-								cleanedModelThoughts = cleanStatusMessage(conn, thoughtsStr)
-							}
-						}
+	allResults := out.allResults()
+	chunks := out.answer()
+	// process content chunks for storing in db
+	chunksForDB := processContentChunksForDB(ctx, conn, userID, chunks)
+	// Respect user setting: drop suggestions if disabled
+	var suggestions []string
+	if includeSuggestions {
+		suggestions = out.Suggestions
+	}
+	// Update pending message to completed and get message data with timestamps
+	messageData, err := UpdatePendingMessageToCompletedInConversation(ctx, conn, userID, conversationID, query.Query, chunksForDB, []FunctionCall{}, allResults, suggestions, out.Tokens)
+	if err != nil {
+		return QueryResponse{
+			ContentChunks:  validateContentChunks(chunksForDB),
+			Suggestions:    suggestions,
+			ConversationID: conversationID,
+			MessageID:      messageID,
+			Timestamp:      time.Now(),
+		}, fmt.Errorf("error updating pending message to completed: %w", err)
+	}
+	resultType := "final_response"
+	if out.Direct {
+		resultType = "direct_answer"
+	}
+	go func() {
+		// Record usage and deduct 1 credit now that chat completed successfully
+		metadata := map[string]interface{}{
+			"query":           query.Query,
+			"conversation_id": conversationID,
+			"message_id":      messageID,
+			"token_count":     out.Tokens.TotalTokenCount,
+			"result_type":     resultType,
+			"function_count":  len(allResults),
+		}
+		if err := limits.RecordUsage(conn, userID, limits.UsageTypeCredits, 1, metadata); err != nil {
+			fmt.Printf("Warning: Failed to record usage for user %d: %v\n", userID, err)
+		}
+		updateConversationPlotFromChunks(conn, conversationID, chunks)
+	}()
+
+	// Process any table instructions in the content chunks for frontend viewing for backtest table and backtest plot chunks
+	return QueryResponse{
+		ContentChunks:  processContentChunksForFrontend(ctx, conn, userID, chunks),
+		Suggestions:    suggestions,
+		ConversationID: conversationID,
+		MessageID:      messageID,
+		Timestamp:      messageData.CreatedAt,
+		CompletedAt:    messageData.CompletedAt,
+	}, nil
+}
 
-						var argsMap map[string]interface{}
-						_ = json.Unmarshal(callArgs, &argsMap)
+// chatModel plans and answers a chat request with the live models, building
+// the planning prompt from the stored conversation on the first turn
+type chatModel struct {
+	conn               *data.Conn
+	userID             int
+	conversationID     string
+	messageID          string
+	query              ChatRequest
+	includeSuggestions bool
+	planningPrompt     string
+	status             *chatStatus
+}
 
-						// Safely check if the tool exists before accessing its properties
-						if tool, exists := Tools[callName]; exists && tool.StatusMessage != "" {
-							data := map[string]interface{}{
-								"message":  cleanedModelThoughts,
-								"headline": formatStatusMessage(tool.StatusMessage, argsMap),
-							}
-							socket.SendAgentStatusUpdate(userID, "FunctionUpdate", data)
-						}
-					}()
-				}
-				for _, round := range v.Rounds {
-					// Execute all function calls in this round with context
-					results, err := executor.Execute(ctx, round.Calls, round.Parallel)
-					if err != nil {
-						// Mark as error instead of deleting for debugging
-						if markErr := MarkPendingMessageAsError(ctx, conn, userID, conversationID, messageID, fmt.Sprintf("Execution error: %v", err)); markErr != nil {
-							fmt.Printf("Warning: failed to mark pending message as error: %v\n", markErr)
-						}
-						return QueryResponse{
-							ContentChunks:  []ContentChunk{},
-							Suggestions:    []string{},
-							ConversationID: conversationID,
-							MessageID:      messageID,
-							Timestamp:      time.Now(),
-						}, fmt.Errorf("error executing function calls: %w", err)
-					}
-					activeResults = append(activeResults, results...)
-				}
-				// Update query with active results for next planning iteration
-				// Only pass active results to avoid context bloat
-				//planningPrompt, err = BuildPlanningPromptWithResultsAndConversationID(conn, userID, conversationID, query.Query, query.Context, query.ActiveChartContext, activeResults, accumulatedThoughts)
-				/*if err != nil {
-					// Mark as error instead of deleting for debugging
-					if markErr := MarkPendingMessageAsError(ctx, conn, userID, conversationID, messageID, fmt.Sprintf("Failed to build prompt with results: %v", err)); markErr != nil {
-						fmt.Printf("Warning: failed to mark pending message as error: %v\n", markErr)
-					}
-					return QueryResponse{
-						ContentChunks:  []ContentChunk{},
-						Suggestions:    []string{},
-						ConversationID: conversationID,
-						MessageID:      messageID,
-						Timestamp:      time.Now(),
-					}, err
-				}*/
-			case StageFinishedExecuting:
-				go func() {
-					var cleanedModelThoughts string
-					if thoughtsValue := ctx.Value(peripheralLatestModelThoughtsKey); thoughtsValue != nil && thoughtsValue != ctx.Value(peripheralAlreadyUsedModelThoughtsKey) {
-						ctx = context.WithValue(ctx, peripheralAlreadyUsedModelThoughtsKey, thoughtsValue)
-						if thoughtsStr, ok := thoughtsValue.(string); ok {
-							cleanedModelThoughts = cleanStatusMessage(conn, thoughtsStr)
-						}
-					}
-					data := map[string]interface{}{
-						"message":  cleanedModelThoughts,
-						"headline": "Tying things together",
-					}
-					socket.SendAgentStatusUpdate(userID, "FunctionUpdate", data)
-				}()
+func (m *chatModel) plan(ctx context.Context, _ int, results []ExecuteResult, thoughts []string) (interface{}, error) {
+	if m.planningPrompt != "" {
+		return RunPlanner(ctx, m.conn, m.conversationID, m.userID, m.planningPrompt, "IntermediateSystemPrompt", results, thoughts)
+	}
+	prompt, err := BuildPlanningPromptWithConversationID(m.conn, m.userID, m.conversationID, m.query.Query, m.query.Context, m.query.ActiveChartContext)
+	if err != nil {
+		return nil, fmt.Errorf("error building planning prompt: %w", err)
+	}
+	// Compose prompt from base + optional suggestions appendix
+	systemPrompt, err := buildSystemPrompt(ctx, "defaultSystemPromptBase", m.includeSuggestions, suggestionsGuidelinesPlanner)
+	if err != nil {
+		return nil, fmt.Errorf("error building system prompt: %w", err)
+	}
+	m.planningPrompt = prompt
+	return RunPlannerWithSystemPrompt(ctx, m.conn, m.conversationID, m.userID, prompt, systemPrompt, results, thoughts)
+}
 
-				// Generate final response based on active execution results
-				var finalResponse *FinalResponse
+func (m *chatModel) final(ctx context.Context, results []ExecuteResult, thoughts []string) (*FinalResponse, error) {
+	m.status.send(ctx, "Tying things together")
+	// Compose final response prompt from base + optional suggestions appendix
+	systemPrompt, err := buildSystemPrompt(ctx, "finalResponseSystemPromptBase", m.includeSuggestions, suggestionsGuidelinesFinal)
+	if err != nil {
+		return nil, fmt.Errorf("error building final system prompt: %w", err)
+	}
+	return GetFinalResponse(ctx, m.conn, m.userID, m.query.Query, m.conversationID, m.messageID, results, thoughts, systemPrompt, m.includeSuggestions)
+}
 
-				// Get the final response from the model with or without suggestions per user setting
-				// Compose final response prompt from base + optional suggestions appendix
-				systemPromptFinal, bErr := buildSystemPrompt("finalResponseSystemPromptBase", includeSuggestions, suggestionsGuidelinesFinal)
-				if bErr != nil {
-					return QueryResponse{ContentChunks: []ContentChunk{}, Suggestions: []string{}, ConversationID: conversationID, MessageID: messageID, Timestamp: time.Now()}, fmt.Errorf("error building final system prompt: %w", bErr)
-				}
-				finalResponse, err = GetFinalResponse(ctx, conn, userID, query.Query, conversationID, messageID, activeResults, accumulatedThoughts, systemPromptFinal, includeSuggestions)
-				if err != nil {
-					// Mark as error instead of deleting for debugging
-					if markErr := MarkPendingMessageAsError(ctx, conn, userID, conversationID, messageID, fmt.Sprintf("Final response error: %v", err)); markErr != nil {
-						fmt.Printf("Warning: failed to mark pending message as error: %v\n", markErr)
-					}
-					return QueryResponse{
-						ContentChunks:  []ContentChunk{},
-						Suggestions:    []string{},
-						ConversationID: conversationID,
-						MessageID:      messageID,
-						Timestamp:      time.Now(),
-					}, err
-				}
+// chatTools runs a chat request's function calls, telling the user what
+// each round is doing
+type chatTools struct {
+	executor *Executor
+	status   *chatStatus
+}
 
-				totalTokenCounts.OutputTokenCount += int64(finalResponse.TokenCounts.OutputTokenCount)
-				totalTokenCounts.InputTokenCount += int64(finalResponse.TokenCounts.InputTokenCount)
-				totalTokenCounts.ThoughtsTokenCount += int64(finalResponse.TokenCounts.ThoughtsTokenCount)
-				totalTokenCounts.TotalTokenCount += int64(finalResponse.TokenCounts.TotalTokenCount)
+func (t *chatTools) execute(ctx context.Context, round Round) ([]ExecuteResult, error) {
+	if len(round.Calls) > 0 {
+		call := round.Calls[0]
+		if tool, exists := Tools[call.Name]; exists && tool.StatusMessage != "" {
+			var argsMap map[string]interface{}
+			_ = json.Unmarshal(call.Args, &argsMap)
+			t.status.send(ctx, formatStatusMessage(tool.StatusMessage, argsMap))
+		}
+	}
+	return t.executor.Execute(ctx, round.Calls, round.Parallel)
+}
 
-				// For final response, combine all results for storage
-				allResults := append(activeResults, discardedResults...)
-				// process content chunks for storing in db
-				chunksForDB := processContentChunksForDB(ctx, conn, userID, finalResponse.ContentChunks)
-				// Update pending message to completed and get message data with timestamps
-				messageData, err := UpdatePendingMessageToCompletedInConversation(ctx, conn, userID, conversationID, query.Query, chunksForDB, []FunctionCall{}, allResults, finalResponse.Suggestions, totalTokenCounts)
-				if err != nil {
-					return QueryResponse{
-						ContentChunks:  chunksForDB,
-						Suggestions:    finalResponse.Suggestions,
-						ConversationID: conversationID,
-						MessageID:      messageID,
-						Timestamp:      time.Now(),
-					}, fmt.Errorf("error updating pending message to completed: %w", err)
-				}
-				go func() {
-					// Record usage and deduct 1 credit now that chat completed successfully
-					usageMetadata := map[string]interface{}{
-						"query":           query.Query,
-						"conversation_id": conversationID,
-						"message_id":      messageID,
-						"token_count":     totalTokenCounts.TotalTokenCount,
-						"result_type":     "final_response",
-						"function_count":  len(allResults),
-					}
-					if err := limits.RecordUsage(conn, userID, limits.UsageTypeCredits, 1, usageMetadata); err != nil {
-						fmt.Printf("Warning: Failed to record usage for user %d: %v\n", userID, err)
-					}
+// chatStatus sends the user status updates, each with the model's latest
+// thoughts the first time they come up
+type chatStatus struct {
+	conn         *data.Conn
+	userID       int
+	mu           sync.Mutex
+	usedThoughts string
+}
 
-				}()
+func (s *chatStatus) send(ctx context.Context, headline string) {
+	thoughts, _ := ctx.Value(peripheralLatestModelThoughtsKey).(string)
+	s.mu.Lock()
+	if thoughts == s.usedThoughts {
+		thoughts = ""
+	} else {
+		s.usedThoughts = thoughts
+	}
+	s.mu.Unlock()
+	go func() {
+		var cleanedModelThoughts string
+		if thoughts != "" {
+			cleanedModelThoughts = cleanStatusMessage(s.conn, thoughts)
+		}
+		socket.SendAgentStatusUpdate(s.userID, "FunctionUpdate", map[string]interface{}{
+			"message":  cleanedModelThoughts,
+			"headline": headline,
+		})
+	}()
+}
 
-				// Process any table instructions in the content chunks for frontend viewing for backtest table and backtest plot chunks
-				processedChunks := processContentChunksForFrontend(ctx, conn, userID, finalResponse.ContentChunks)
-				go func() {
-					ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-					defer cancel()
-					hasPlot, err := HasConversationPlot(ctx, conn, conversationID)
-					fmt.Printf("\n\n\nHas plot: %v\n", hasPlot)
-					if err != nil {
-						fmt.Printf("Warning: failed to check if conversation has plot: %v\n", err)
-					}
-					if !hasPlot {
-						for _, chunk := range processedChunks {
-							if chunk.Type == "plot" {
-								plotBase64, err := plotly.RenderTwitterPlotToBase64(conn, chunk.Content, false)
-								if err != nil {
-									fmt.Printf("Warning: failed to render plot: %v\n", err)
-									continue
-								}
-								err = UpdateConversationPlot(ctx, conn, conversationID, plotBase64)
-								fmt.Printf("\n\n\nUpdated conversation plot")
-								if err != nil {
-									fmt.Printf("Warning: failed to update conversation plot: %v\n", err)
-									continue
-								}
-								break
-							}
-						}
-					}
-				}()
-				return QueryResponse{
-					ContentChunks: processedChunks,
-					Suggestions: func() []string {
-						if includeSuggestions {
-							return finalResponse.Suggestions
-						}
-						return nil
-					}(),
-					ConversationID: conversationID,
-					MessageID:      messageID,
-					Timestamp:      messageData.CreatedAt,
-					CompletedAt:    messageData.CompletedAt,
-				}, nil
-			}
+// updateConversationPlotFromChunks renders the first plot of an answer as the
+// conversation's plot, if it has none yet
+func updateConversationPlotFromChunks(conn *data.Conn, conversationID string, chunks []ContentChunk) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	hasPlot, err := HasConversationPlot(ctx, conn, conversationID)
+	if err != nil {
+		fmt.Printf("Warning: failed to check if conversation has plot: %v\n", err)
+	}
+	if hasPlot {
+		return
+	}
+	for _, chunk := range chunks {
+		if chunk.Type != "plot" {
+			continue
 		}
-		maxTurns--
-		if maxTurns <= 0 {
-			// Mark as error instead of deleting for debugging
-			if markErr := MarkPendingMessageAsError(ctx, conn, userID, conversationID, messageID, "Model took too many turns to run"); markErr != nil {
-				fmt.Printf("Warning: failed to mark pending message as error: %v\n", markErr)
-			}
-			return QueryResponse{
-				ContentChunks:  []ContentChunk{},
-				Suggestions:    []string{},
-				ConversationID: conversationID,
-				MessageID:      messageID,
-				Timestamp:      time.Now(),
-			}, fmt.Errorf("model took too many turns to run")
+		plotBase64, err := plotly.RenderTwitterPlotToBase64(conn, chunk.Content, false)
+		if err != nil {
+			fmt.Printf("Warning: failed to render plot: %v\n", err)
+			continue
 		}
+		if err := UpdateConversationPlot(ctx, conn, conversationID, plotBase64); err != nil {
+			fmt.Printf("Warning: failed to update conversation plot: %v\n", err)
+			continue
+		}
+		return
+	}
+}
+
+// capitalize upper-cases the first letter of an error message
+func capitalize(s string) string {
+	if s == "" {
+		return s
 	}
+	return strings.ToUpper(s[:1]) + s[1:]
 }
 
 // StopChatRequest cancels the active chat for this user if any
@@ -591,13 +440,21 @@ func StopChatRequest(ctx context.Context, conn *data.Conn, userID int, args json
 	}, nil
 }
 
-// TableInstructionData holds the parameters for generating a table from cached data
+// BacktestTableChunkData is the instruction for building a table from a cached backtest
 type BacktestTableChunkData struct {
 	StrategyID int         `json:"strategyID"`        // strategyId
 	Version    int         `json:"version"`           // version
 	Columns    interface{} `json:"columns"`           // Internal column names as either []string or string
 	Caption    string      `json:"caption"`           // Table title
 	NumRows    int         `json:"numRows,omitempty"` // Number of rows in the table
+
+	DerivedColumns []DerivedColumn  `json:"derivedColumns,omitempty"`
+	GroupBy        []string         `json:"groupBy,omitempty"`
+	Aggregates     []TableAggregate `json:"aggregates,omitempty"` // per group; needs GroupBy
+	SortBy         []TableSort      `json:"sortBy,omitempty"`
+	Offset         int              `json:"offset,omitempty"`
+	Limit          int              `json:"limit,omitempty"`       // 0 = all rows
+	RowsPerPage    int              `json:"rowsPerPage,omitempty"` // hint for the frontend's pager
 }
 type BacktestPlotChunkData struct {
 	StrategyID int    `json:"strategyID"`
@@ -618,6 +475,11 @@ type AgentPlotChunkData struct {
 	XAxisTitle  string `json:"xAxisTitle,omitempty"`
 	YAxisTitle  string `json:"yAxisTitle,omitempty"`
 }
+type ChartImageChunkData struct {
+	ImageID  string `json:"imageId"`
+	MimeType string `json:"mimeType,omitempty"`
+	Data     string `json:"data,omitempty"` // base64, filled in for the frontend only
+}
 
 // getBacktestKey creates a composite key for the backtest results map using strategy ID and version
 func getBacktestKey(strategyID, version int) string {
@@ -629,21 +491,23 @@ func processContentChunksForDB(ctx context.Context, conn *data.Conn, userID int,
 	var backtestResultsMap = make(map[string]*strategy.BacktestResponse)
 	var agentResultsMap = make(map[string]*RunPythonAgentResponse)
 	for _, chunk := range inputChunks {
+		// Chunks that fail validation are stored as written, with the error
+		if chunk.Type != ChunkTypeError {
+			if cerr := validateChunk(chunk); cerr != nil {
+				chunk.Error = cerr
+				processedChunks = append(processedChunks, chunk)
+				continue
+			}
+		}
 		if chunk.Type == "backtest_table" {
 			var backtestTableChunkContent BacktestTableChunkData
 			contentBytes, err := json.Marshal(chunk.Content)
 			if err != nil {
-				processedChunks = append(processedChunks, ContentChunk{
-					Type:    "text",
-					Content: "[Internal Error: Could not marshal backtest table chunk content]",
-				})
+				processedChunks = append(processedChunks, withChunkError(chunk, ChunkErrInvalidContent, "could not marshal backtest table chunk content"))
 				continue
 			}
 			if err := json.Unmarshal(contentBytes, &backtestTableChunkContent); err != nil {
-				processedChunks = append(processedChunks, ContentChunk{
-					Type:    "text",
-					Content: "[Internal Error: Invalid backtest table chunk format]",
-				})
+				processedChunks = append(processedChunks, withChunkError(chunk, ChunkErrInvalidContent, "invalid backtest table chunk format"))
 				continue
 			}
 			// Get backtest results for this strategy
@@ -651,6 +515,7 @@ func processContentChunksForDB(ctx context.Context, conn *data.Conn, userID int,
 			if backtestResultsMap[backtestKey] == nil {
 				backtestResultsMap[backtestKey], err = strategy.GetBacktestFromCache(ctx, conn, userID, backtestTableChunkContent.StrategyID, backtestTableChunkContent.Version)
 				if err != nil {
+					processedChunks = append(processedChunks, withChunkError(chunk, ChunkErrUnresolved, "could not get backtest results: %v", err))
 					continue
 				}
 			}
@@ -664,28 +529,26 @@ func processContentChunksForDB(ctx context.Context, conn *data.Conn, userID int,
 			}
 			backtestTableChunkContent.NumRows = len(backtestResultsMap[backtestKey].Instances)
 
+			processedChunks = append(processedChunks, chunk)
+		} else if chunk.Type == ChunkTypeTable {
+			chunk.Content = withTableColumnMeta(chunk.Content)
 			processedChunks = append(processedChunks, chunk)
 		} else if chunk.Type == "backtest_plot" {
 			var backtestPlotChunkContent BacktestPlotChunkData
 			contentBytes, err := json.Marshal(chunk.Content)
 			if err != nil {
-				processedChunks = append(processedChunks, ContentChunk{
-					Type:    "text",
-					Content: "[Internal Error: Could not marshal backtest plot chunk content]",
-				})
+				processedChunks = append(processedChunks, withChunkError(chunk, ChunkErrInvalidContent, "could not marshal backtest plot chunk content"))
 				continue
 			}
 			if err := json.Unmarshal(contentBytes, &backtestPlotChunkContent); err != nil {
-				processedChunks = append(processedChunks, ContentChunk{
-					Type:    "text",
-					Content: "[Internal Error: Invalid backtest plot chunk format]",
-				})
+				processedChunks = append(processedChunks, withChunkError(chunk, ChunkErrInvalidContent, "invalid backtest plot chunk format"))
 				continue
 			}
 			backtestKey := getBacktestKey(backtestPlotChunkContent.StrategyID, backtestPlotChunkContent.Version)
 			if backtestResultsMap[backtestKey] == nil {
 				backtestResultsMap[backtestKey], err = strategy.GetBacktestFromCache(ctx, conn, userID, backtestPlotChunkContent.StrategyID, backtestPlotChunkContent.Version)
 				if err != nil {
+					processedChunks = append(processedChunks, withChunkError(chunk, ChunkErrUnresolved, "could not get backtest results: %v", err))
 					continue
 				}
 			}
@@ -723,22 +586,17 @@ func processContentChunksForDB(ctx context.Context, conn *data.Conn, userID int,
 			var agentPlotChunkContent AgentPlotChunkData
 			contentBytes, err := json.Marshal(chunk.Content)
 			if err != nil {
-				processedChunks = append(processedChunks, ContentChunk{
-					Type:    "text",
-					Content: "[Internal Error: Could not marshal agent plot chunk content]",
-				})
+				processedChunks = append(processedChunks, withChunkError(chunk, ChunkErrInvalidContent, "could not marshal agent plot chunk content"))
 				continue
 			}
 			if err := json.Unmarshal(contentBytes, &agentPlotChunkContent); err != nil {
-				processedChunks = append(processedChunks, ContentChunk{
-					Type:    "text",
-					Content: "[Internal Error: Invalid agent plot chunk format]",
-				})
+				processedChunks = append(processedChunks, withChunkError(chunk, ChunkErrInvalidContent, "invalid agent plot chunk format"))
 				continue
 			}
 			if agentResultsMap[agentPlotChunkContent.ExecutionID] == nil {
 				agentResultsMap[agentPlotChunkContent.ExecutionID], err = GetPythonAgentResultFromCache(ctx, conn, agentPlotChunkContent.ExecutionID)
 				if err != nil {
+					processedChunks = append(processedChunks, withChunkError(chunk, ChunkErrUnresolved, "could not get agent results: %v", err))
 					continue
 				}
 			}
@@ -773,190 +631,57 @@ func processContentChunksForDB(ctx context.Context, conn *data.Conn, userID int,
 			processedChunks = append(processedChunks, chunk)
 		}
 	}
+	for i := range processedChunks {
+		processedChunks[i].Version = ContentChunkVersion
+	}
 	return processedChunks
 }
 
-// processContentChunksForFrontend iterates through chunks and generates tables for "backtest_table" type.
+// processContentChunksForFrontend validates chunks against the chunk registry and
+// resolves referenced data (backtest tables and plots, agent plots, chart images)
+// for the frontend.
 func processContentChunksForFrontend(ctx context.Context, conn *data.Conn, userID int, inputChunks []ContentChunk) []ContentChunk {
 	processedChunks := make([]ContentChunk, 0, len(inputChunks))
 	var backtestResultsMap = make(map[string]*strategy.BacktestResponse)
 	var agentResultsMap = make(map[string]*RunPythonAgentResponse)
-	for _, chunk := range inputChunks {
+	for _, chunk := range validateContentChunks(inputChunks) {
 		// Check for the type "backtest_table"
 		if chunk.Type == "backtest_table" {
 			var chunkContent BacktestTableChunkData
 			contentBytes, err := json.Marshal(chunk.Content)
 			if err != nil {
-				processedChunks = append(processedChunks, ContentChunk{
-					Type:    "text",
-					Content: "[Internal Error: Could not marshal backtest table chunk content]",
-				})
+				processedChunks = append(processedChunks, newChunkError(ChunkTypeBacktestTable, ChunkErrInvalidContent, "could not marshal backtest table chunk content"))
 				continue
 			}
 			if err := json.Unmarshal(contentBytes, &chunkContent); err != nil {
-				processedChunks = append(processedChunks, ContentChunk{
-					Type:    "text",
-					Content: "[Internal Error: Invalid backtest table chunk format]",
-				})
+				processedChunks = append(processedChunks, newChunkError(ChunkTypeBacktestTable, ChunkErrInvalidContent, "invalid backtest table chunk format"))
 				continue
 			}
 			backtestKey := getBacktestKey(chunkContent.StrategyID, chunkContent.Version)
 			if backtestResultsMap[backtestKey] == nil {
 				backtestResultsMap[backtestKey], err = strategy.GetBacktestFromCache(ctx, conn, userID, chunkContent.StrategyID, chunkContent.Version)
 				if err != nil {
-					processedChunks = append(processedChunks, ContentChunk{
-						Type:    "text",
-						Content: fmt.Sprintf("[Internal Error: Could not get backtest results: %v]", err),
-					})
+					processedChunks = append(processedChunks, newChunkError(chunk.Type, ChunkErrUnresolved, "could not get backtest results: %v", err))
 					continue
 				}
 			}
-			backtestInstances := backtestResultsMap[backtestKey].Instances
-			backtestColumns := backtestResultsMap[backtestKey].Summary.Columns
-			// Ensure "ticker" is the first column
-			tickerIdx := -1
-			timestampIdx := -1
-			for i, col := range backtestColumns {
-				if col == "ticker" {
-					tickerIdx = i
-				}
-				if col == "timestamp" {
-					timestampIdx = i
-				}
-			}
-			// If both ticker and timestamp exist, merge them into ticker and remove timestamp
-			if tickerIdx >= 0 && timestampIdx >= 0 {
-				// Remove timestamp from columns
-				newColumns := make([]string, 0, len(backtestColumns)-1)
-				for _, col := range backtestColumns {
-					if col != "timestamp" {
-						newColumns = append(newColumns, col)
-					}
-				}
-				backtestColumns = newColumns
-			}
-			// Recompute tickerIdx after possible column change
-			tickerIdx = -1
-			for i, col := range backtestColumns {
-				if col == "ticker" {
-					tickerIdx = i
-					break
-				}
-			}
-			if tickerIdx > 0 {
-				// Move "ticker" to the front
-				backtestColumns = append([]string{"ticker"}, append(backtestColumns[:tickerIdx], backtestColumns[tickerIdx+1:]...)...)
-			}
-			// Get first 100 instances, or all if less than 100
-			instances := backtestInstances
-			/*if len(backtestInstances) > 100 {
-				instances = backtestInstances[:100]
-			}*/
-			// flatten instances into rows using original columns
-			rows := make([]map[string]any, 0, len(instances))
-			for _, instance := range instances {
-				row := make(map[string]any)
-				// If both ticker and timestamp exist, merge them
-				if tickerIdx >= 0 && timestampIdx >= 0 {
-					tickerVal, okTicker := instance.Instance["ticker"].(string)
-					timestampVal, okTimestamp := instance.Instance["timestamp"]
-					var timestampMs string
-					if okTimestamp {
-						switch v := timestampVal.(type) {
-						case int64:
-							timestampMs = fmt.Sprintf("%d", v*1000)
-						case int:
-							timestampMs = fmt.Sprintf("%d", v*1000)
-						case float64:
-							timestampMs = fmt.Sprintf("%d", int64(v*1000))
-						case float32:
-							timestampMs = fmt.Sprintf("%d", int64(v*1000))
-						case string:
-							// Try to parse string to int
-							var tsInt int64
-							_, err := fmt.Sscanf(v, "%d", &tsInt)
-							if err == nil {
-								timestampMs = fmt.Sprintf("%d", tsInt*1000)
-							} else {
-								timestampMs = v
-							}
-						default:
-							timestampMs = ""
-						}
-					}
-					if okTicker && timestampMs != "" {
-						row["ticker"] = "$$" + tickerVal + "-" + timestampMs + "$$"
-					} else if okTicker {
-						row["ticker"] = "$$" + tickerVal + "$$"
-					}
-					// Copy other columns except timestamp
-					for _, column := range backtestColumns {
-						if column == "ticker" {
-							continue
-						}
-						if column == "timestamp" {
-							continue
-						}
-						row[column] = instance.Instance[column]
-					}
-				} else {
-					for _, column := range backtestColumns {
-						row[column] = instance.Instance[column]
-					}
-				}
-				rows = append(rows, row)
-			}
-			// Now, create display columns for headers and output
-			displayColumns := make([]string, len(backtestColumns))
-			c := cases.Title(language.Und)
-			for i, column := range backtestColumns {
-				words := strings.Split(column, "_")
-				for j, word := range words {
-					words[j] = c.String(strings.TrimSpace(word))
-				}
-				displayColumns[i] = strings.Join(words, " ")
-			}
-			// Remap row keys to display columns
-			for i, row := range rows {
-				newRow := make(map[string]any)
-				for j, column := range backtestColumns {
-					displayCol := displayColumns[j]
-					newRow[displayCol] = row[column]
-				}
-				rows[i] = newRow
-			}
-			// Convert rows to [][]any for table output
-			finalRows := make([][]any, len(rows))
-			for i, row := range rows {
-				valueRow := make([]any, len(displayColumns))
-				for j, displayCol := range displayColumns {
-					valueRow[j] = row[displayCol]
-				}
-				finalRows[i] = valueRow
+			table, err := buildBacktestTable(chunkContent, backtestResultsMap[backtestKey])
+			if err != nil {
+				processedChunks = append(processedChunks, newChunkError(ChunkTypeBacktestTable, ChunkErrInvalidContent, "could not build backtest table: %v", err))
+				continue
 			}
 			chunk.Type = "table"
-			chunk.Content = map[string]any{
-				"strategyID": chunkContent.StrategyID,
-				"caption":    chunkContent.Caption,
-				"headers":    displayColumns,
-				"rows":       finalRows,
-			}
+			chunk.Content = table
 			processedChunks = append(processedChunks, chunk)
 		} else if chunk.Type == "backtest_plot" {
 			var chunkContent BacktestPlotChunkData
 			contentBytes, err := json.Marshal(chunk.Content)
 			if err != nil {
-				processedChunks = append(processedChunks, ContentChunk{
-					Type:    "text",
-					Content: "[Internal Error: Could not marshal backtest plot chunk content]",
-				})
+				processedChunks = append(processedChunks, newChunkError(ChunkTypeBacktestPlot, ChunkErrInvalidContent, "could not marshal backtest plot chunk content"))
 				continue
 			}
 			if err := json.Unmarshal(contentBytes, &chunkContent); err != nil {
-				processedChunks = append(processedChunks, ContentChunk{
-					Type:    "text",
-					Content: "[Internal Error: Invalid backtest plot chunk format]",
-				})
+				processedChunks = append(processedChunks, newChunkError(ChunkTypeBacktestPlot, ChunkErrInvalidContent, "invalid backtest plot chunk format"))
 				continue
 			}
 			strategyID := chunkContent.StrategyID
@@ -965,10 +690,7 @@ func processContentChunksForFrontend(ctx context.Context, conn *data.Conn, userI
 			if backtestResultsMap[backtestKey] == nil {
 				backtestResultsMap[backtestKey], err = strategy.GetBacktestFromCache(ctx, conn, userID, strategyID, chunkContent.Version)
 				if err != nil {
-					processedChunks = append(processedChunks, ContentChunk{
-						Type:    "text",
-						Content: fmt.Sprintf("[Internal Error: Could not get backtest results: %v]", err),
-					})
+					processedChunks = append(processedChunks, newChunkError(chunk.Type, ChunkErrUnresolved, "could not get backtest results: %v", err))
 					continue
 				}
 			}
@@ -996,17 +718,11 @@ func processContentChunksForFrontend(ctx context.Context, conn *data.Conn, userI
 			var chunkContent AgentPlotChunkData
 			contentBytes, err := json.Marshal(chunk.Content)
 			if err != nil {
-				processedChunks = append(processedChunks, ContentChunk{
-					Type:    "text",
-					Content: "[Internal Error: Could not marshal agent plot chunk content]",
-				})
+				processedChunks = append(processedChunks, newChunkError(ChunkTypeAgentPlot, ChunkErrInvalidContent, "could not marshal agent plot chunk content"))
 				continue
 			}
 			if err := json.Unmarshal(contentBytes, &chunkContent); err != nil {
-				processedChunks = append(processedChunks, ContentChunk{
-					Type:    "text",
-					Content: "[Internal Error: Invalid agent plot chunk format]",
-				})
+				processedChunks = append(processedChunks, newChunkError(ChunkTypeAgentPlot, ChunkErrInvalidContent, "invalid agent plot chunk format"))
 				continue
 			}
 			executionID := chunkContent.ExecutionID
@@ -1014,10 +730,7 @@ func processContentChunksForFrontend(ctx context.Context, conn *data.Conn, userI
 			if agentResultsMap[executionID] == nil {
 				agentResultsMap[executionID], err = GetPythonAgentResultFromCache(ctx, conn, executionID)
 				if err != nil {
-					processedChunks = append(processedChunks, ContentChunk{
-						Type:    "text",
-						Content: fmt.Sprintf("[Internal Error: Could not get agent results: %v]", err),
-					})
+					processedChunks = append(processedChunks, newChunkError(ChunkTypeAgentPlot, ChunkErrUnresolved, "could not get agent results: %v", err))
 					continue
 				}
 			}
@@ -1041,6 +754,29 @@ func processContentChunksForFrontend(ctx context.Context, conn *data.Conn, userI
 					break
 				}
 			}
+		} else if chunk.Type == "chart_image" {
+			var chunkContent ChartImageChunkData
+			contentBytes, err := json.Marshal(chunk.Content)
+			if err == nil {
+				err = json.Unmarshal(contentBytes, &chunkContent)
+			}
+			if err != nil {
+				processedChunks = append(processedChunks, newChunkError(ChunkTypeChartImage, ChunkErrInvalidContent, "invalid chart image chunk format"))
+				continue
+			}
+			img, err := chartimage.Load(ctx, conn, userID, chunkContent.ImageID)
+			if err != nil {
+				processedChunks = append(processedChunks, newChunkError(ChunkTypeChartImage, ChunkErrUnresolved, "could not load chart image: %v", err))
+				continue
+			}
+			processedChunks = append(processedChunks, ContentChunk{
+				Type: "chart_image",
+				Content: ChartImageChunkData{
+					ImageID:  img.ImageID,
+					MimeType: img.MimeType,
+					Data:     img.Base64(),
+				},
+			})
 		} else if chunk.Type == "plot" {
 			// Handle titleTicker for plot chunks
 			if contentMap, ok := chunk.Content.(map[string]any); ok {
@@ -1069,6 +805,9 @@ func processContentChunksForFrontend(ctx context.Context, conn *data.Conn, userI
 			processedChunks = append(processedChunks, chunk)
 		}
 	}
+	for i := range processedChunks {
+		processedChunks[i].Version = ContentChunkVersion
+	}
 	return processedChunks
 }
 
@@ -0,0 +1,321 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ContentChunkVersion is bumped whenever a chunk payload changes shape in a way
+// the frontend has to know about. It is stamped on every chunk sent out, and
+// the frontend shows an error in place of chunks newer than it renders
+// (CONTENT_CHUNK_VERSION).
+const ContentChunkVersion = 2
+
+// Content chunk types. The model may emit any registered type except
+// ChunkTypeError, ChunkTypeProvenance and ChunkTypePendingAction, which are
+// only produced by the backend.
+const (
+	ChunkTypeText          = "text"
+	ChunkTypeTable         = "table"
+	ChunkTypePlot          = "plot"
+	ChunkTypeBacktestTable = "backtest_table"
+	ChunkTypeBacktestPlot  = "backtest_plot"
+	ChunkTypeAgentPlot     = "agent_plot"
+	ChunkTypeChartImage    = "chart_image"
+	ChunkTypeChart         = "chart"
+	ChunkTypeMetricCard    = "metric_card"
+	ChunkTypeList          = "list"
+	ChunkTypeError         = "error"
+	ChunkTypeProvenance    = "provenance"
+	ChunkTypePendingAction = "pending_action"
+)
+
+// Chunk error codes
+const (
+	ChunkErrUnknownType    = "unknown_type"
+	ChunkErrInvalidContent = "invalid_content"
+	ChunkErrUnresolved     = "unresolved_reference"
+)
+
+// ChunkError is the content of an error chunk, sent in place of a chunk that
+// failed validation or whose referenced data could not be loaded
+type ChunkError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	ChunkType string `json:"chunkType,omitempty"`
+}
+
+// ChartChunkData asks the frontend to embed its interactive chart for a ticker
+type ChartChunkData struct {
+	Ticker    string `json:"ticker"`
+	Timestamp int64  `json:"timestamp,omitempty"` // ms; 0 = latest
+	Timeframe string `json:"timeframe,omitempty"`
+	Caption   string `json:"caption,omitempty"`
+}
+
+// MetricCardChunkData is a small grid of headline numbers
+type MetricCardChunkData struct {
+	Title   string   `json:"title,omitempty"`
+	Metrics []Metric `json:"metrics"`
+}
+
+// Metric is one value on a metric card
+type Metric struct {
+	Label  string `json:"label"`
+	Value  string `json:"value"`
+	Change string `json:"change,omitempty"` // e.g. "+2.4%"
+	// Sentiment colors the change: "positive", "negative" or "neutral"
+	Sentiment string `json:"sentiment,omitempty"`
+}
+
+// ListChunkData is a bulleted or numbered list of markdown items
+type ListChunkData struct {
+	Title   string   `json:"title,omitempty"`
+	Ordered bool     `json:"ordered,omitempty"`
+	Items   []string `json:"items"`
+}
+
+// chunkTypeSpec describes one chunk type in the registry
+type chunkTypeSpec struct {
+	Description string
+	// validate checks the decoded content; nil means any content is accepted
+	validate func(content json.RawMessage) error
+}
+
+var chunkRegistry = map[string]chunkTypeSpec{
+	ChunkTypeText: {
+		Description: "Markdown text.",
+		validate: func(c json.RawMessage) error {
+			var s string
+			if err := json.Unmarshal(c, &s); err != nil {
+				return fmt.Errorf("content must be a string")
+			}
+			if strings.TrimSpace(s) == "" {
+				return fmt.Errorf("content is empty")
+			}
+			return nil
+		},
+	},
+	ChunkTypeTable: {
+		Description: "A table with headers and rows, and optional columnMeta giving each column's type, unit and precision.",
+		validate: func(c json.RawMessage) error {
+			var t struct {
+				Headers    []interface{}   `json:"headers"`
+				Rows       [][]interface{} `json:"rows"`
+				ColumnMeta []ColumnMeta    `json:"columnMeta"`
+			}
+			if err := json.Unmarshal(c, &t); err != nil {
+				return fmt.Errorf("content must be {headers, rows}: %v", err)
+			}
+			if len(t.Headers) == 0 {
+				return fmt.Errorf("headers are required")
+			}
+			return validateColumnMeta(t.ColumnMeta, len(t.Headers))
+		},
+	},
+	ChunkTypePlot: {
+		Description: "A Plotly chart.",
+		validate: func(c json.RawMessage) error {
+			var p struct {
+				Data []json.RawMessage `json:"data"`
+			}
+			if err := json.Unmarshal(c, &p); err != nil {
+				return fmt.Errorf("content must be a plot object: %v", err)
+			}
+			if len(p.Data) == 0 {
+				return fmt.Errorf("plot has no data traces")
+			}
+			return nil
+		},
+	},
+	ChunkTypeBacktestTable: {
+		Description: "A table of backtest instances referenced by strategy and version, optionally with derived columns, grouping, sorting and paging.",
+		validate: func(c json.RawMessage) error {
+			var b BacktestTableChunkData
+			if err := json.Unmarshal(c, &b); err != nil {
+				return err
+			}
+			if b.StrategyID == 0 {
+				return fmt.Errorf("strategyID is required")
+			}
+			return b.validateInstruction()
+		},
+	},
+	ChunkTypeBacktestPlot: {
+		Description: "A plot produced by a backtest, referenced by strategy, version and plot ID.",
+		validate: func(c json.RawMessage) error {
+			var b BacktestPlotChunkData
+			if err := json.Unmarshal(c, &b); err != nil {
+				return err
+			}
+			if b.StrategyID == 0 {
+				return fmt.Errorf("strategyID is required")
+			}
+			return nil
+		},
+	},
+	ChunkTypeAgentPlot: {
+		Description: "A plot produced by a python agent run, referenced by execution and plot ID.",
+		validate: func(c json.RawMessage) error {
+			var a AgentPlotChunkData
+			if err := json.Unmarshal(c, &a); err != nil {
+				return err
+			}
+			if a.ExecutionID == "" {
+				return fmt.Errorf("executionID is required")
+			}
+			return nil
+		},
+	},
+	ChunkTypeChartImage: {
+		Description: "A rendered chart image, referenced by imageId from generateChartImage.",
+		validate: func(c json.RawMessage) error {
+			var img ChartImageChunkData
+			if err := json.Unmarshal(c, &img); err != nil {
+				return err
+			}
+			if img.ImageID == "" {
+				return fmt.Errorf("imageId is required")
+			}
+			return nil
+		},
+	},
+	ChunkTypeChart: {
+		Description: "An interactive price chart of a ticker: {ticker, timestamp?, timeframe?, caption?}.",
+		validate: func(c json.RawMessage) error {
+			var ch ChartChunkData
+			if err := json.Unmarshal(c, &ch); err != nil {
+				return err
+			}
+			if ch.Ticker == "" {
+				return fmt.Errorf("ticker is required")
+			}
+			return nil
+		},
+	},
+	ChunkTypeMetricCard: {
+		Description: "Headline numbers: {title?, metrics: [{label, value, change?, sentiment?}]}.",
+		validate: func(c json.RawMessage) error {
+			var m MetricCardChunkData
+			if err := json.Unmarshal(c, &m); err != nil {
+				return err
+			}
+			if len(m.Metrics) == 0 {
+				return fmt.Errorf("at least one metric is required")
+			}
+			for i, metric := range m.Metrics {
+				if metric.Label == "" || metric.Value == "" {
+					return fmt.Errorf("metric %d needs a label and value", i)
+				}
+				switch metric.Sentiment {
+				case "", "positive", "negative", "neutral":
+				default:
+					return fmt.Errorf("metric %d has invalid sentiment %q", i, metric.Sentiment)
+				}
+			}
+			return nil
+		},
+	},
+	ChunkTypeList: {
+		Description: "A list of markdown items: {title?, ordered?, items}.",
+		validate: func(c json.RawMessage) error {
+			var l ListChunkData
+			if err := json.Unmarshal(c, &l); err != nil {
+				return err
+			}
+			if len(l.Items) == 0 {
+				return fmt.Errorf("items are required")
+			}
+			return nil
+		},
+	},
+	ChunkTypeProvenance: {
+		Description: "Footer listing the tool calls, data as-of times and row counts behind an answer. Backend only.",
+		validate: func(c json.RawMessage) error {
+			var p ProvenanceChunkData
+			return json.Unmarshal(c, &p)
+		},
+	},
+	ChunkTypePendingAction: {
+		Description: "An action the assistant staged, with Confirm and Cancel buttons: {pendingActionId, tool, summary, expiresAt}. Backend only.",
+		validate: func(c json.RawMessage) error {
+			var p PendingAction
+			if err := json.Unmarshal(c, &p); err != nil {
+				return err
+			}
+			if p.ID == "" {
+				return fmt.Errorf("pendingActionId is required")
+			}
+			return nil
+		},
+	},
+}
+
+// newChunkError builds an error chunk
+func newChunkError(chunkType, code, format string, args ...interface{}) ContentChunk {
+	return ContentChunk{
+		Type:    ChunkTypeError,
+		Version: ContentChunkVersion,
+		Content: ChunkError{Code: code, Message: fmt.Sprintf(format, args...), ChunkType: chunkType},
+	}
+}
+
+// withChunkError keeps a chunk as it was written, marked with why it can't be
+// shown, so it is stored intact and shown as an error
+func withChunkError(chunk ContentChunk, code, format string, args ...interface{}) ContentChunk {
+	chunk.Error = &ChunkError{Code: code, Message: fmt.Sprintf(format, args...), ChunkType: chunk.Type}
+	return chunk
+}
+
+// validateChunk checks a chunk against its registered type. A chunk stored
+// with an error fails with it.
+func validateChunk(chunk ContentChunk) *ChunkError {
+	if chunk.Error != nil {
+		return chunk.Error
+	}
+	spec, ok := chunkRegistry[chunk.Type]
+	if !ok {
+		return &ChunkError{Code: ChunkErrUnknownType, Message: fmt.Sprintf("unknown chunk type %q", chunk.Type), ChunkType: chunk.Type}
+	}
+	if spec.validate == nil {
+		return nil
+	}
+	raw, err := json.Marshal(chunk.Content)
+	if err != nil || string(raw) == "null" {
+		return &ChunkError{Code: ChunkErrInvalidContent, Message: "content is missing", ChunkType: chunk.Type}
+	}
+	if err := spec.validate(raw); err != nil {
+		return &ChunkError{Code: ChunkErrInvalidContent, Message: err.Error(), ChunkType: chunk.Type}
+	}
+	return nil
+}
+
+// validateContentChunks stamps the current version on every chunk and
+// replaces invalid chunks with error chunks
+func validateContentChunks(chunks []ContentChunk) []ContentChunk {
+	out := make([]ContentChunk, len(chunks))
+	for i, chunk := range chunks {
+		if chunk.Type == ChunkTypeError {
+			out[i] = chunk
+			continue
+		}
+		if cerr := validateChunk(chunk); cerr != nil {
+			out[i] = ContentChunk{Type: ChunkTypeError, Version: ContentChunkVersion, Content: *cerr}
+			continue
+		}
+		chunk.Version = ContentChunkVersion
+		out[i] = chunk
+	}
+	return out
+}
+
+// hasRenderableChunk reports whether at least one chunk passes validation
+func hasRenderableChunk(chunks []ContentChunk) bool {
+	for _, chunk := range chunks {
+		if validateChunk(chunk) == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"backend/internal/app/screener"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ColumnMeta tells the frontend, and the model reading the conversation back,
+// how a table column's values are meant to be read. Percentages are in
+// percentage points: 2.5 is 2.5%.
+type ColumnMeta struct {
+	Type         string `json:"type,omitempty"`      // number, integer, string, boolean or timestamp
+	Unit         string `json:"unit,omitempty"`      // e.g. "USD", "%", "shares", "x"; "s" or "ms" for timestamps
+	Precision    *int   `json:"precision,omitempty"` // decimal places to show
+	IsPercentage bool   `json:"isPercentage,omitempty"`
+	IsCurrency   bool   `json:"isCurrency,omitempty"`
+}
+
+var columnMetaTypes = map[string]bool{"": true, "number": true, "integer": true, "string": true, "boolean": true, "timestamp": true}
+
+func precision(p int) *int { return &p }
+
+// Column families the screener defines whose units its types don't say
+var (
+	priceColumns = map[string]bool{
+		"open": true, "high": true, "low": true, "close": true, "price": true, "vwap": true,
+		"wk52_low": true, "wk52_high": true, "dma_50": true, "dma_200": true,
+		"pre_market_open": true, "pre_market_high": true, "pre_market_low": true, "pre_market_close": true,
+		"change_from_open": true, "pre_market_change": true, "extended_hours_change": true,
+		"previous_close": true, "prev_close": true, "last_trade_price": true,
+	}
+	dollarColumns = map[string]bool{
+		"market_cap": true, "dollar_volume": true, "avg_dollar_volume_1m": true, "pre_market_dollar_volume": true,
+	}
+	shareColumns = map[string]bool{
+		"volume": true, "avg_volume_1m": true, "pre_market_volume": true,
+	}
+	ratioColumns = map[string]bool{
+		"relative_volume_14": true, "pre_market_vol_over_14d_vol": true,
+	}
+)
+
+// normalizeColumnName maps a column name or display header ("Change 1d Pct")
+// to the snake_case form column definitions use
+func normalizeColumnName(name string) string {
+	n := strings.ToLower(strings.TrimSpace(name))
+	n = strings.NewReplacer(" ", "_", "-", "_", "%", "pct").Replace(n)
+	return n
+}
+
+// inferColumnMeta returns the metadata of a known screener or backtest column
+func inferColumnMeta(name string) (ColumnMeta, bool) {
+	n := normalizeColumnName(name)
+	switch {
+	case n == "timestamp":
+		return ColumnMeta{Type: "timestamp", Unit: "s"}, true
+	case strings.HasSuffix(n, "_pct") || strings.HasSuffix(n, "_percent") || n == "pct" || n == "percent":
+		return ColumnMeta{Type: "number", Unit: "%", Precision: precision(2), IsPercentage: true}, true
+	case priceColumns[n] || strings.HasSuffix(n, "_price"):
+		return ColumnMeta{Type: "number", Unit: "USD", Precision: precision(2), IsCurrency: true}, true
+	case dollarColumns[n]:
+		return ColumnMeta{Type: "number", Unit: "USD", Precision: precision(0), IsCurrency: true}, true
+	case shareColumns[n]:
+		return ColumnMeta{Type: "integer", Unit: "shares", Precision: precision(0)}, true
+	case ratioColumns[n]:
+		return ColumnMeta{Type: "number", Unit: "x", Precision: precision(2)}, true
+	case n == "rsi":
+		return ColumnMeta{Type: "number", Precision: precision(1)}, true
+	}
+	info, ok := screener.GetAvailableColumns()[n]
+	if !ok {
+		return ColumnMeta{}, false
+	}
+	switch info.Type {
+	case screener.TypeInteger:
+		return ColumnMeta{Type: "integer", Precision: precision(0)}, true
+	case screener.TypeString:
+		return ColumnMeta{Type: "string"}, true
+	case screener.TypeBoolean:
+		return ColumnMeta{Type: "boolean"}, true
+	}
+	return ColumnMeta{Type: "number", Precision: precision(2)}, true
+}
+
+// columnMetaFor returns metadata for each column, or nil when none is known
+func columnMetaFor(columns []string) []ColumnMeta {
+	meta := make([]ColumnMeta, len(columns))
+	known := false
+	for i, c := range columns {
+		if m, ok := inferColumnMeta(c); ok {
+			meta[i] = m
+			known = true
+		}
+	}
+	if !known {
+		return nil
+	}
+	return meta
+}
+
+// validateColumnMeta checks metadata the model wrote into a table chunk
+func validateColumnMeta(meta []ColumnMeta, headers int) error {
+	if len(meta) > headers {
+		return fmt.Errorf("columnMeta has %d entries for %d headers", len(meta), headers)
+	}
+	for i, m := range meta {
+		if !columnMetaTypes[m.Type] {
+			return fmt.Errorf("columnMeta[%d]: unknown type %q", i, m.Type)
+		}
+		if m.Precision != nil && (*m.Precision < 0 || *m.Precision > 10) {
+			return fmt.Errorf("columnMeta[%d]: precision must be between 0 and 10", i)
+		}
+	}
+	return nil
+}
+
+// withTableColumnMeta fills in the metadata of a table chunk the model wrote
+// from its headers. Metadata the model gave is kept.
+func withTableColumnMeta(content interface{}) interface{} {
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return content
+	}
+	var table map[string]interface{}
+	if err := json.Unmarshal(raw, &table); err != nil {
+		return content
+	}
+	if _, ok := table["columnMeta"]; ok {
+		return content
+	}
+	headers, _ := table["headers"].([]interface{})
+	names := make([]string, len(headers))
+	for i, h := range headers {
+		names[i] = fmt.Sprint(h)
+	}
+	meta := columnMetaFor(names)
+	if meta == nil {
+		return content
+	}
+	table["columnMeta"] = meta
+	return table
+}
@@ -25,6 +25,8 @@ type ChatMessage struct {
 	Timestamp        time.Time                `json:"timestamp"`
 	Citations        []Citation               `json:"citations,omitempty"`
 	TokenCount       int                      `json:"token_count"`
-	CompletedAt      time.Time                `json:"completed_at,omitempty"` // When the response was completed
-	Status           string                   `json:"status,omitempty"`       // "pending", "completed", "error"
+	CompletedAt      time.Time                `json:"completed_at,omitempty"`   // When the response was completed
+	Status           string                   `json:"status,omitempty"`         // "pending", "completed", "error"
+	Rating           int                      `json:"rating,omitempty"`         // 1 thumbs up, -1 thumbs down
+	RatingComment    string                   `json:"rating_comment,omitempty"` // free text left with the rating
 }
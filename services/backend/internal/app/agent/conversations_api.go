@@ -2,6 +2,7 @@ package agent
 
 import (
 	"backend/internal/data"
+	"backend/internal/services/socket"
 	"context"
 	"database/sql"
 	"encoding/json"
@@ -158,6 +159,12 @@ func convertDBMessagesToConversationData(conn *data.Conn, userID int, dbMessages
 		if dbMsg.CompletedAt != nil {
 			chatMsg.CompletedAt = *dbMsg.CompletedAt
 		}
+		if dbMsg.Rating != nil {
+			chatMsg.Rating = *dbMsg.Rating
+		}
+		if dbMsg.RatingComment != nil {
+			chatMsg.RatingComment = *dbMsg.RatingComment
+		}
 
 		chatMessages = append(chatMessages, chatMsg)
 		totalTokenCount += chatMsg.TokenCount
@@ -307,9 +314,103 @@ func EditMessage(conn *data.Conn, userID int, args json.RawMessage) (interface{}
 	}, nil
 }
 
-// GetUserConversation gets the active conversation
-func GetUserConversation(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
-	return GetActiveConversationWithCache(context.Background(), conn, userID)
+// GetUserConversation gets a conversation by ID, or the active conversation
+// when none is given. Reading a conversation doesn't make it the active one;
+// switchConversation does.
+func GetUserConversation(conn *data.Conn, userID int, args json.RawMessage) (interface{}, error) {
+	var req ConversationSwitchRequest
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &req); err != nil {
+			return nil, fmt.Errorf("error parsing request: %w", err)
+		}
+	}
+	if req.ConversationID == "" {
+		return GetActiveConversationWithCache(context.Background(), conn, userID)
+	}
+	return loadConversation(context.Background(), conn, userID, req.ConversationID)
+}
+
+// ConversationCreateRequest represents the request for creating a conversation
+type ConversationCreateRequest struct {
+	Title string `json:"title,omitempty"`
+}
+
+// ConversationRenameRequest represents the request for renaming a conversation
+type ConversationRenameRequest struct {
+	ConversationID string `json:"conversation_id"`
+	Title          string `json:"title"`
+}
+
+const maxConversationTitleLength = 100
+
+// CreateConversation frontend endpoint to start a new, empty conversation and make it active
+func CreateConversation(conn *data.Conn, userID int, args json.RawMessage) (interface{}, error) {
+	var req ConversationCreateRequest
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &req); err != nil {
+			return nil, fmt.Errorf("error parsing request: %w", err)
+		}
+	}
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = "New Chat"
+	}
+	if len(title) > maxConversationTitleLength {
+		return nil, fmt.Errorf("title must be at most %d characters", maxConversationTitleLength)
+	}
+
+	ctx := context.Background()
+	conversationID, err := CreateConversationInDB(ctx, conn, userID, title)
+	if err != nil {
+		return nil, err
+	}
+	if err := SetActiveConversationID(ctx, conn, userID, conversationID); err != nil {
+		return nil, fmt.Errorf("failed to set active conversation: %w", err)
+	}
+	now := time.Now()
+	return ConversationInfo{
+		ConversationID: conversationID,
+		Title:          title,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}, nil
+}
+
+// RenameConversation frontend endpoint to set a conversation's title
+func RenameConversation(conn *data.Conn, userID int, args json.RawMessage) (interface{}, error) {
+	var req ConversationRenameRequest
+	if err := json.Unmarshal(args, &req); err != nil {
+		return nil, fmt.Errorf("error parsing request: %w", err)
+	}
+	title := strings.TrimSpace(req.Title)
+	if req.ConversationID == "" || title == "" {
+		return nil, fmt.Errorf("conversation_id and title are required")
+	}
+	if len(title) > maxConversationTitleLength {
+		return nil, fmt.Errorf("title must be at most %d characters", maxConversationTitleLength)
+	}
+
+	ctx := context.Background()
+	tag, err := conn.DB.Exec(ctx,
+		"UPDATE conversations SET title = $1 WHERE conversation_id = $2 AND userId = $3",
+		title, req.ConversationID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rename conversation: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, fmt.Errorf("conversation not found")
+	}
+	if err := InvalidateConversationCache(ctx, conn, userID, req.ConversationID); err != nil {
+		log.Printf("Warning: failed to invalidate conversation cache after rename: %v", err)
+	}
+	// Keep other open tabs in sync
+	socket.SendTitleUpdate(userID, req.ConversationID, title)
+
+	return map[string]interface{}{
+		"success":         true,
+		"conversation_id": req.ConversationID,
+		"title":           title,
+	}, nil
 }
 
 func checkIfConversationIsPublic(conn *data.Conn, conversationID string) (bool, int, string, error) {
@@ -631,6 +732,7 @@ func RetryMessage(conn *data.Conn, userID int, args json.RawMessage) (interface{
 	if err = tx.Commit(context.Background()); err != nil {
 		return nil, fmt.Errorf("failed to commit retry transaction: %w", err)
 	}
+	markExperimentRetried(conn, req.ConversationID, req.MessageID)
 
 	// Return success response with original query and context items for frontend to use in regeneration
 	return map[string]interface{}{
@@ -640,3 +742,61 @@ func RetryMessage(conn *data.Conn, userID int, args json.RawMessage) (interface{
 		"context_items":   contextItems,
 	}, nil
 }
+
+// RateMessageRequest represents the request for rating an agent response
+type RateMessageRequest struct {
+	ConversationID string `json:"conversation_id"`
+	MessageID      string `json:"message_id"`
+	Rating         int    `json:"rating"` // 1 thumbs up, -1 thumbs down, 0 clears the rating
+	// Comment is optional free text kept with the rating: omitted keeps any
+	// earlier comment, empty removes it, and clearing the rating clears it too
+	Comment *string `json:"comment,omitempty"`
+}
+
+const maxRatingComment = 2000
+
+// RateMessage frontend endpoint to give an agent response a thumbs up or down
+func RateMessage(conn *data.Conn, userID int, args json.RawMessage) (interface{}, error) {
+	var req RateMessageRequest
+	if err := json.Unmarshal(args, &req); err != nil {
+		return nil, fmt.Errorf("error parsing request: %w", err)
+	}
+	if req.ConversationID == "" || req.MessageID == "" {
+		return nil, fmt.Errorf("conversation_id and message_id are required")
+	}
+	if req.Rating < -1 || req.Rating > 1 {
+		return nil, fmt.Errorf("rating must be 1, -1 or 0")
+	}
+	var comment *string
+	if req.Comment != nil {
+		trimmed := strings.TrimSpace(*req.Comment)
+		if len(trimmed) > maxRatingComment {
+			return nil, fmt.Errorf("comment must be at most %d characters", maxRatingComment)
+		}
+		comment = &trimmed
+	}
+	if err := VerifyConversationOwnership(conn, req.ConversationID, userID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tag, err := conn.DB.Exec(ctx, `
+		UPDATE conversation_messages SET
+			rating = NULLIF($3, 0),
+			rating_comment = CASE WHEN $3 = 0 THEN NULL WHEN $4::text IS NULL THEN rating_comment ELSE NULLIF($4::text, '') END,
+			rated_at = CASE WHEN $3 = 0 THEN NULL ELSE NOW() END
+		WHERE conversation_id = $1 AND message_id = $2 AND archived = FALSE AND status = 'completed'`,
+		req.ConversationID, req.MessageID, req.Rating, comment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rate message: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, fmt.Errorf("message not found or not completed")
+	}
+	rateExperimentOutcome(ctx, conn, req.ConversationID, req.MessageID, req.Rating)
+	if err := InvalidateConversationCache(ctx, conn, userID, req.ConversationID); err != nil {
+		log.Printf("Warning: failed to invalidate conversation cache: %v", err)
+	}
+	return map[string]interface{}{"success": true, "rating": req.Rating, "comment": comment}, nil
+}
@@ -3,7 +3,6 @@ package agent
 import (
 	"backend/internal/data"
 	"context"
-	"encoding/json"
 	"fmt"
 	"time"
 
@@ -37,7 +36,7 @@ const (
 func GetActiveConversationFromCache(ctx context.Context, conn *data.Conn, userID int) (*ActiveConversationCache, error) {
 	cacheKey := fmt.Sprintf(activeConversationDataKey, userID)
 
-	data, err := conn.Cache.Get(ctx, cacheKey).Result()
+	blob, err := conn.Cache.Get(ctx, cacheKey).Bytes()
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil // Cache miss, not an error
@@ -45,17 +44,17 @@ func GetActiveConversationFromCache(ctx context.Context, conn *data.Conn, userID
 		return nil, fmt.Errorf("failed to get conversation from cache: %w", err)
 	}
 
-	var conversation ActiveConversationCache
-	if err := json.Unmarshal([]byte(data), &conversation); err != nil {
-		// Cache corruption, delete the invalid entry
+	conversation, err := decodeConversation(ctx, conn, blob)
+	if err != nil {
+		// Cache corruption or an expired offloaded result, delete the entry
 		conn.Cache.Del(ctx, cacheKey)
-		return nil, fmt.Errorf("failed to unmarshal cached conversation: %w", err)
+		return nil, fmt.Errorf("failed to decode cached conversation: %w", err)
 	}
 
 	// Update last accessed time
 	conversation.LastAccessed = time.Now()
 
-	return &conversation, nil
+	return conversation, nil
 }
 
 // SetActiveConversationCache stores the active conversation in Redis cache
@@ -73,12 +72,19 @@ func SetActiveConversationCache(ctx context.Context, conn *data.Conn, userID int
 
 	cacheKey := fmt.Sprintf(activeConversationDataKey, userID)
 
-	data, err := json.Marshal(conversation)
+	// Offloaded results and the blob go out in one round trip
+	pipe := conn.Cache.TxPipeline()
+	blob, write, err := encodeConversation(ctx, pipe, userID, conversation)
+	recordConversationWrite(conn, write)
 	if err != nil {
-		return fmt.Errorf("failed to marshal conversation for cache: %w", err)
+		// Too large even trimmed to one message; serve it from the database
+		pipe.Discard()
+		conn.Cache.Del(ctx, cacheKey)
+		return fmt.Errorf("failed to encode conversation for cache: %w", err)
 	}
-
-	return conn.Cache.Set(ctx, cacheKey, data, activeConversationTTL).Err()
+	pipe.Set(ctx, cacheKey, blob, activeConversationTTL)
+	_, err = pipe.Exec(ctx)
+	return err
 }
 
 // InvalidateActiveConversationCache removes the active conversation from cache
@@ -231,8 +237,9 @@ func UpdateMessageInActiveConversationCache(ctx context.Context, conn *data.Conn
 	return SetActiveConversationCache(ctx, conn, userID, cachedConv)
 }
 
-// SwitchActiveConversationWithCache switches to a different conversation and updates cache
-func SwitchActiveConversationWithCache(ctx context.Context, conn *data.Conn, userID int, conversationID string) (*ConversationData, error) {
+// loadConversation loads one of the user's conversations with its title,
+// leaving the active conversation as it is
+func loadConversation(ctx context.Context, conn *data.Conn, userID int, conversationID string) (*ConversationData, error) {
 	// Verify the conversation exists and belongs to the user
 	messagesInterface, err := GetConversationMessagesRaw(ctx, conn, conversationID, userID)
 	if err != nil {
@@ -245,16 +252,6 @@ func SwitchActiveConversationWithCache(ctx context.Context, conn *data.Conn, use
 		return nil, fmt.Errorf("unexpected type returned from GetConversationMessagesRaw")
 	}
 
-	// Clear old cached conversation
-	if err := InvalidateActiveConversationCache(ctx, conn, userID); err != nil {
-		fmt.Printf("Warning: failed to invalidate old conversation cache: %v\n", err)
-	}
-
-	// Set as active conversation
-	if err := SetActiveConversationIDCached(ctx, conn, userID, conversationID); err != nil {
-		return nil, fmt.Errorf("failed to set active conversation: %w", err)
-	}
-
 	// Convert DB messages to the format expected by frontend
 	conversationData := convertDBMessagesToConversationData(conn, userID, messages)
 
@@ -267,6 +264,25 @@ func SwitchActiveConversationWithCache(ctx context.Context, conn *data.Conn, use
 	if err == nil {
 		conversationData.Title = title
 	}
+	return conversationData, nil
+}
+
+// SwitchActiveConversationWithCache switches to a different conversation and updates cache
+func SwitchActiveConversationWithCache(ctx context.Context, conn *data.Conn, userID int, conversationID string) (*ConversationData, error) {
+	conversationData, err := loadConversation(ctx, conn, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clear old cached conversation
+	if err := InvalidateActiveConversationCache(ctx, conn, userID); err != nil {
+		fmt.Printf("Warning: failed to invalidate old conversation cache: %v\n", err)
+	}
+
+	// Set as active conversation
+	if err := SetActiveConversationIDCached(ctx, conn, userID, conversationID); err != nil {
+		return nil, fmt.Errorf("failed to set active conversation: %w", err)
+	}
 
 	// Cache the new active conversation
 	cachedConv := &ActiveConversationCache{
@@ -275,7 +291,7 @@ func SwitchActiveConversationWithCache(ctx context.Context, conn *data.Conn, use
 		MessageCount:   len(conversationData.Messages),
 		UpdatedAt:      conversationData.Timestamp,
 		LastAccessed:   time.Now(),
-		Title:          title,
+		Title:          conversationData.Title,
 	}
 
 	// Ensure MessageCount is consistent with actual cached messages
@@ -75,6 +75,8 @@ type DBConversationMessage struct {
 	Status           string                   `json:"status"`
 	TokenCount       int                      `json:"token_count"`
 	MessageOrder     int                      `json:"message_order"`
+	Rating           *int                     `json:"rating"`
+	RatingComment    *string                  `json:"rating_comment"`
 }
 
 // MessageCompletionData represents the data returned when completing a message
@@ -140,7 +142,9 @@ func GetConversationMessagesRaw(ctx context.Context, conn *data.Conn, conversati
 			completed_at,
 			status,
 			token_count,
-			message_order
+			message_order,
+			rating,
+			rating_comment
 		FROM conversation_messages
 		WHERE conversation_id = $1 AND archived = FALSE
 		ORDER BY message_order ASC`
@@ -174,6 +178,8 @@ func GetConversationMessagesRaw(ctx context.Context, conn *data.Conn, conversati
 			&msg.Status,
 			&msg.TokenCount,
 			&msg.MessageOrder,
+			&msg.Rating,
+			&msg.RatingComment,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan message row: %w", err)
@@ -399,6 +405,12 @@ func SavePendingMessageToConversation(ctx context.Context, conn *data.Conn, user
 	if err != nil {
 		return "", "", fmt.Errorf("failed to save message to database: %w", err)
 	}
+	// A query for another thread (e.g. from a second tab) makes that thread active
+	if activeID, err := GetActiveConversationIDCached(ctx, conn, userID); err == nil && activeID != conversationID {
+		if err := SetActiveConversationID(ctx, conn, userID, conversationID); err != nil {
+			log.Printf("Warning: failed to set active conversation: %v", err)
+		}
+	}
 	go func() {
 		var email string
 		err := conn.DB.QueryRow(ctx, "SELECT email from users where userid = $1", userID).Scan(&email)
@@ -511,13 +523,15 @@ func UpdatePendingMessageToCompletedInConversation(ctx context.Context, conn *da
 	functionCallsJSON, _ := json.Marshal(functionCalls)
 	toolResultsJSON, _ := json.Marshal(toolResults)
 	suggestedQueriesJSON, _ := json.Marshal(suggestedQueries)
+	promptVersionsJSON, _ := json.Marshal(promptVersionsFor(ctx))
 
 	// Update the database and get the timestamps in a single operation
 	now := time.Now()
 	querySQL := `
 		UPDATE conversation_messages 
 		SET content_chunks = $1, function_calls = $2, tool_results = $3, 
-			suggested_queries = $4, token_count = $5, completed_at = $6, status = $7
+			suggested_queries = $4, token_count = $5, completed_at = $6, status = $7,
+			prompt_versions = $10
 		WHERE conversation_id = $8 AND query = $9 AND status = 'pending'
 		RETURNING message_id, created_at, completed_at`
 
@@ -532,6 +546,7 @@ func UpdatePendingMessageToCompletedInConversation(ctx context.Context, conn *da
 		"completed",
 		conversationID,
 		query,
+		promptVersionsJSON,
 	).Scan(&messageData.MessageID, &messageData.CreatedAt, &messageData.CompletedAt)
 
 	if err != nil {
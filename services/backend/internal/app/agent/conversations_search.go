@@ -0,0 +1,316 @@
+package agent
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Conversations are searched by full text over the user's questions and the
+// text of the answers (conversation_messages.search_vector). Search backs the
+// conversation list's search box; recall is its agent side, returning whole
+// threads so the agent can answer "what did we conclude about NVDA last
+// month?" and cite the messages it used.
+const (
+	defaultConversationSearchResults = 20
+	maxConversationSearchResults     = 50
+	defaultRecallThreads             = 3
+	maxRecallThreads                 = 5
+	recallMatchesPerThread           = 4
+	recallThreadMessages             = 12 // of a thread recalled by ID
+	recallAnswerChars                = 1500
+)
+
+// answerTextSQL is the text chunks of a message's answer, for a message
+// aliased cm
+const answerTextSQL = `COALESCE((
+	SELECT string_agg(chunk->>'content', ' ')
+	FROM jsonb_array_elements(cm.content_chunks) chunk
+	WHERE chunk->>'type' = 'text'), '')`
+
+type SearchConversationsArgs struct {
+	Query string `json:"query"`
+	// Since and Until bound the message dates, YYYY-MM-DD, both inclusive
+	Since string `json:"since,omitempty"`
+	Until string `json:"until,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+// ConversationSearchHit is a message matching a search
+type ConversationSearchHit struct {
+	MessageID         string    `json:"message_id"`
+	ConversationID    string    `json:"conversation_id"`
+	ConversationTitle string    `json:"conversation_title"`
+	IsPublic          bool      `json:"is_public"`
+	Query             string    `json:"query"`
+	Snippet           string    `json:"snippet"` // the matched words in **
+	CreatedAt         time.Time `json:"created_at"`
+	Rank              float64   `json:"rank"`
+}
+
+// SearchConversations finds the user's messages matching a web-search style
+// query ("nvda earnings", "\"gap up\" -spy"), best first
+func SearchConversations(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args SearchConversationsArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return searchConversationMessages(ctx, conn, userID, args)
+}
+
+func searchConversationMessages(ctx context.Context, conn *data.Conn, userID int, args SearchConversationsArgs) ([]ConversationSearchHit, error) {
+	args.Query = strings.TrimSpace(args.Query)
+	if args.Query == "" {
+		return nil, apperr.Validation("query is required")
+	}
+	since, until, err := parseSearchDates(args.Since, args.Until)
+	if err != nil {
+		return nil, err
+	}
+	if args.Limit <= 0 {
+		args.Limit = defaultConversationSearchResults
+	} else if args.Limit > maxConversationSearchResults {
+		args.Limit = maxConversationSearchResults
+	}
+
+	// Ranked in the inner query so only the returned rows get a headline
+	rows, err := conn.DB.Query(ctx, `
+		SELECT hit.message_id, hit.conversation_id, hit.title, hit.is_public, hit.query, hit.created_at, hit.rank,
+		       ts_headline('english', hit.query || ' … ' || hit.answer, hit.tsq,
+		                   'StartSel=**, StopSel=**, MaxWords=35, MinWords=12, MaxFragments=2, FragmentDelimiter=" … "')
+		FROM (
+			SELECT cm.message_id::text AS message_id, cm.conversation_id, c.title, c.is_public, cm.query,
+			       cm.created_at, ts_rank_cd(cm.search_vector, q.tsq) AS rank, q.tsq,
+			       `+answerTextSQL+` AS answer
+			FROM conversation_messages cm
+			JOIN conversations c ON c.conversation_id = cm.conversation_id
+			CROSS JOIN (SELECT websearch_to_tsquery('english', $2) AS tsq) q
+			WHERE c.userId = $1 AND cm.archived = FALSE AND cm.status = 'completed'
+			  AND cm.search_vector @@ q.tsq
+			  AND ($3::timestamptz IS NULL OR cm.created_at >= $3)
+			  AND ($4::timestamptz IS NULL OR cm.created_at < $4)
+			ORDER BY rank DESC, cm.created_at DESC
+			LIMIT $5
+		) hit
+		ORDER BY hit.rank DESC, hit.created_at DESC`,
+		userID, args.Query, since, until, args.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search conversations: %w", err)
+	}
+	defer rows.Close()
+
+	hits := []ConversationSearchHit{}
+	for rows.Next() {
+		var h ConversationSearchHit
+		if err := rows.Scan(&h.MessageID, &h.ConversationID, &h.ConversationTitle, &h.IsPublic, &h.Query,
+			&h.CreatedAt, &h.Rank, &h.Snippet); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation search hit: %w", err)
+		}
+		hits = append(hits, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating conversation search hits: %w", err)
+	}
+	return hits, nil
+}
+
+// parseSearchDates turns inclusive YYYY-MM-DD bounds into a half-open range
+func parseSearchDates(sinceStr, untilStr string) (*time.Time, *time.Time, error) {
+	var since, until *time.Time
+	if sinceStr != "" {
+		t, err := time.Parse("2006-01-02", sinceStr)
+		if err != nil {
+			return nil, nil, apperr.Validation("since must be a YYYY-MM-DD date")
+		}
+		since = &t
+	}
+	if untilStr != "" {
+		t, err := time.Parse("2006-01-02", untilStr)
+		if err != nil {
+			return nil, nil, apperr.Validation("until must be a YYYY-MM-DD date")
+		}
+		t = t.AddDate(0, 0, 1)
+		until = &t
+	}
+	if since != nil && until != nil && !since.Before(*until) {
+		return nil, nil, apperr.Validation("since must not be after until")
+	}
+	return since, until, nil
+}
+
+type RecallConversationArgs struct {
+	Query string `json:"query"`
+	Since string `json:"since,omitempty"`
+	Until string `json:"until,omitempty"`
+	// ConversationID recalls that thread's latest messages instead of
+	// searching
+	ConversationID string `json:"conversationId,omitempty"`
+	MaxThreads     int    `json:"maxThreads,omitempty"`
+}
+
+// RecalledMessage is one question and answer of a past thread
+type RecalledMessage struct {
+	MessageID string `json:"messageId"`
+	CreatedAt string `json:"createdAt"` // RFC 3339
+	Question  string `json:"question"`
+	Answer    string `json:"answer"` // text only, truncated
+	// Matched is false for the thread's last message, included for how the
+	// thread ended
+	Matched bool `json:"matched"`
+	order   int
+}
+
+// RecalledThread is a past conversation with its relevant messages, oldest
+// first
+type RecalledThread struct {
+	ConversationID string            `json:"conversationId"`
+	Title          string            `json:"title"`
+	Messages       []RecalledMessage `json:"messages"`
+}
+
+type RecallResult struct {
+	Threads []RecalledThread `json:"threads"`
+	Note    string           `json:"note,omitempty"`
+}
+
+// RecallConversation is the recallConversation tool: the user's past threads
+// best matching a query, each with its matching messages and its last one
+func RecallConversation(ctx context.Context, conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args RecallConversationArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.ConversationID != "" {
+		return recallThread(ctx, conn, userID, args.ConversationID)
+	}
+	if args.MaxThreads <= 0 {
+		args.MaxThreads = defaultRecallThreads
+	} else if args.MaxThreads > maxRecallThreads {
+		args.MaxThreads = maxRecallThreads
+	}
+
+	hits, err := searchConversationMessages(ctx, conn, userID, SearchConversationsArgs{
+		Query: args.Query, Since: args.Since, Until: args.Until, Limit: maxConversationSearchResults,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(hits) == 0 {
+		return RecallResult{Threads: []RecalledThread{}, Note: "No past conversation matches the query."}, nil
+	}
+
+	// Threads in order of their best match, each with its best matches
+	var threadIDs []string
+	matched := map[string][]string{}
+	titles := map[string]string{}
+	for _, h := range hits {
+		if _, seen := matched[h.ConversationID]; !seen {
+			if len(threadIDs) == args.MaxThreads {
+				continue
+			}
+			threadIDs = append(threadIDs, h.ConversationID)
+			titles[h.ConversationID] = h.ConversationTitle
+		}
+		if len(matched[h.ConversationID]) < recallMatchesPerThread {
+			matched[h.ConversationID] = append(matched[h.ConversationID], h.MessageID)
+		}
+	}
+
+	var ids []string
+	isMatch := map[string]bool{}
+	for _, id := range threadIDs {
+		for _, m := range matched[id] {
+			ids = append(ids, m)
+			isMatch[m] = true
+		}
+	}
+	rows, err := conn.DB.Query(ctx, `
+		SELECT cm.message_id::text, cm.conversation_id, cm.created_at, cm.query, `+answerTextSQL+`, cm.message_order
+		FROM conversation_messages cm
+		WHERE cm.message_id::text = ANY($1)
+		   OR cm.message_id::text IN (
+			SELECT DISTINCT ON (last.conversation_id) last.message_id::text
+			FROM conversation_messages last
+			WHERE last.conversation_id = ANY($2) AND last.archived = FALSE AND last.status = 'completed'
+			ORDER BY last.conversation_id, last.message_order DESC)`, ids, threadIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load recalled messages: %w", err)
+	}
+	defer rows.Close()
+	byThread := map[string][]RecalledMessage{}
+	for rows.Next() {
+		var m RecalledMessage
+		var conversationID string
+		var createdAt time.Time
+		if err := rows.Scan(&m.MessageID, &conversationID, &createdAt, &m.Question, &m.Answer, &m.order); err != nil {
+			return nil, fmt.Errorf("failed to scan recalled message: %w", err)
+		}
+		m.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+		m.Answer = truncateRecall(m.Answer)
+		m.Matched = isMatch[m.MessageID]
+		byThread[conversationID] = append(byThread[conversationID], m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating recalled messages: %w", err)
+	}
+
+	result := RecallResult{Threads: make([]RecalledThread, 0, len(threadIDs))}
+	for _, id := range threadIDs {
+		messages := byThread[id]
+		sort.Slice(messages, func(i, j int) bool { return messages[i].order < messages[j].order })
+		result.Threads = append(result.Threads, RecalledThread{ConversationID: id, Title: titles[id], Messages: messages})
+	}
+	return result, nil
+}
+
+// recallThread returns the latest messages of one of the user's threads
+func recallThread(ctx context.Context, conn *data.Conn, userID int, conversationID string) (interface{}, error) {
+	var title string
+	err := conn.DB.QueryRow(ctx, `
+		SELECT title FROM conversations WHERE conversation_id = $1 AND userId = $2`,
+		conversationID, userID).Scan(&title)
+	if err != nil {
+		return nil, apperr.NotFound("conversation not found")
+	}
+	rows, err := conn.DB.Query(ctx, `
+		SELECT cm.message_id::text, cm.created_at, cm.query, `+answerTextSQL+`, cm.message_order
+		FROM conversation_messages cm
+		WHERE cm.conversation_id = $1 AND cm.archived = FALSE AND cm.status = 'completed'
+		ORDER BY cm.message_order DESC
+		LIMIT $2`, conversationID, recallThreadMessages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversation messages: %w", err)
+	}
+	defer rows.Close()
+	thread := RecalledThread{ConversationID: conversationID, Title: title, Messages: []RecalledMessage{}}
+	for rows.Next() {
+		m := RecalledMessage{Matched: true}
+		var createdAt time.Time
+		if err := rows.Scan(&m.MessageID, &createdAt, &m.Question, &m.Answer, &m.order); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation message: %w", err)
+		}
+		m.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+		m.Answer = truncateRecall(m.Answer)
+		thread.Messages = append([]RecalledMessage{m}, thread.Messages...)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating conversation messages: %w", err)
+	}
+	return RecallResult{Threads: []RecalledThread{thread}}, nil
+}
+
+func truncateRecall(answer string) string {
+	answer = strings.TrimSpace(answer)
+	runes := []rune(answer)
+	if len(runes) <= recallAnswerChars {
+		return answer
+	}
+	return string(runes[:recallAnswerChars]) + "…"
+}
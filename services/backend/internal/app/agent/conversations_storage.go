@@ -0,0 +1,246 @@
+package agent
+
+import (
+	"backend/internal/data"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// The cached conversation is written to Redis as one gzipped JSON blob.
+// Tool results over maxInlineResultBytes (backtest tables, screener dumps) are
+// stored under their own key and replaced by a stub that is resolved on read.
+// If the compressed blob still exceeds maxCachedConversationBytes the oldest
+// messages are dropped, so the turns the user is looking at survive.
+const (
+	maxInlineResultBytes       = 32 << 10
+	maxCachedConversationBytes = 256 << 10
+
+	// conversationResultKey holds one offloaded tool result, by user,
+	// conversation, message and function id
+	conversationResultKey = "user:%d:conversation_result:%s:%s:%d"
+	offloadedField        = "$offloaded"
+
+	conversationSizesKeyPrefix = "conversation_cache:sizes:"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// conversationWrite describes one cache write, for the size metrics
+type conversationWrite struct {
+	rawBytes       int
+	storedBytes    int
+	offloaded      int
+	offloadedBytes int
+	dropped        int // oldest messages left out to fit the cap
+	tooLarge       bool
+}
+
+// encodeConversation prepares a conversation for the cache. It offloads large
+// tool results (written through pipe), compresses the blob and trims the
+// oldest messages to fit. The caller's conversation is not modified except
+// for Messages and MessageCount reflecting any trimming.
+func encodeConversation(ctx context.Context, pipe redis.Pipeliner, userID int, conv *ActiveConversationCache) ([]byte, conversationWrite, error) {
+	var w conversationWrite
+	messages := make([]ChatMessage, len(conv.Messages))
+	copy(messages, conv.Messages)
+	for i := range messages {
+		results := messages[i].ToolResults
+		copied := false
+		for j := range results {
+			raw, err := json.Marshal(results[j].Result)
+			if err != nil || len(raw) <= maxInlineResultBytes {
+				continue
+			}
+			if !copied {
+				// Copy on first write so the caller keeps the full results
+				results = append([]ExecuteResult(nil), results...)
+				messages[i].ToolResults = results
+				copied = true
+			}
+			key := fmt.Sprintf(conversationResultKey, userID, conv.ConversationID, messages[i].MessageID, results[j].FunctionID)
+			gz, err := gzipBytes(raw)
+			if err != nil {
+				return nil, w, err
+			}
+			pipe.Set(ctx, key, gz, activeConversationTTL)
+			results[j].Result = map[string]interface{}{offloadedField: key, "bytes": len(raw)}
+			w.offloaded++
+			w.offloadedBytes += len(raw)
+		}
+	}
+
+	stored := *conv
+	for {
+		stored.Messages = messages
+		stored.MessageCount = len(messages)
+		raw, err := json.Marshal(&stored)
+		if err != nil {
+			return nil, w, err
+		}
+		if w.rawBytes == 0 {
+			w.rawBytes = len(raw) + w.offloadedBytes
+		}
+		gz, err := gzipBytes(raw)
+		if err != nil {
+			return nil, w, err
+		}
+		if len(gz) <= maxCachedConversationBytes {
+			w.storedBytes = len(gz)
+			conv.Messages = conv.Messages[len(conv.Messages)-len(messages):]
+			conv.MessageCount = len(conv.Messages)
+			return gz, w, nil
+		}
+		if len(messages) <= 1 {
+			w.tooLarge = true
+			return nil, w, fmt.Errorf("conversation %s is %d bytes compressed, over the %d byte cache cap", conv.ConversationID, len(gz), maxCachedConversationBytes)
+		}
+		messages = messages[1:]
+		w.dropped++
+	}
+}
+
+// decodeConversation reads a cached blob, gzipped or (from before
+// compression) plain JSON, and resolves offloaded tool results
+func decodeConversation(ctx context.Context, conn *data.Conn, blob []byte) (*ActiveConversationCache, error) {
+	if bytes.HasPrefix(blob, gzipMagic) {
+		raw, err := gunzipBytes(blob)
+		if err != nil {
+			return nil, err
+		}
+		blob = raw
+	}
+	var conv ActiveConversationCache
+	if err := json.Unmarshal(blob, &conv); err != nil {
+		return nil, err
+	}
+
+	type ref struct{ msg, result int }
+	var keys []string
+	var refs []ref
+	for i := range conv.Messages {
+		for j, r := range conv.Messages[i].ToolResults {
+			if stub, ok := r.Result.(map[string]interface{}); ok {
+				if key, ok := stub[offloadedField].(string); ok {
+					keys = append(keys, key)
+					refs = append(refs, ref{i, j})
+				}
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return &conv, nil
+	}
+	values, err := conn.Cache.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load offloaded tool results: %w", err)
+	}
+	for n, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			// Expired separately from the conversation; the cache is stale
+			return nil, fmt.Errorf("offloaded tool result %s is missing", keys[n])
+		}
+		raw, err := gunzipBytes([]byte(s))
+		if err != nil {
+			return nil, fmt.Errorf("offloaded tool result %s: %w", keys[n], err)
+		}
+		conv.Messages[refs[n].msg].ToolResults[refs[n].result].Result = json.RawMessage(raw)
+	}
+	return &conv, nil
+}
+
+func gzipBytes(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipBytes(b []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// conversationSizeBucket is the histogram field of an uncompressed size
+func conversationSizeBucket(n int) string {
+	switch {
+	case n < 16<<10:
+		return "size_lt_16k"
+	case n < 64<<10:
+		return "size_lt_64k"
+	case n < 256<<10:
+		return "size_lt_256k"
+	case n < 1<<20:
+		return "size_lt_1m"
+	}
+	return "size_ge_1m"
+}
+
+// recordConversationWrite adds a cache write to the day's size counters
+func recordConversationWrite(conn *data.Conn, w conversationWrite) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	key := conversationSizesKeyPrefix + time.Now().UTC().Format("2006-01-02")
+	pipe := conn.Cache.Pipeline()
+	pipe.HIncrBy(ctx, key, "writes", 1)
+	pipe.HIncrBy(ctx, key, "raw_bytes", int64(w.rawBytes))
+	pipe.HIncrBy(ctx, key, "stored_bytes", int64(w.storedBytes))
+	pipe.HIncrBy(ctx, key, "offloaded_results", int64(w.offloaded))
+	pipe.HIncrBy(ctx, key, "offloaded_bytes", int64(w.offloadedBytes))
+	pipe.HIncrBy(ctx, key, "dropped_messages", int64(w.dropped))
+	pipe.HIncrBy(ctx, key, conversationSizeBucket(w.rawBytes), 1)
+	if w.tooLarge {
+		pipe.HIncrBy(ctx, key, "too_large", 1)
+	}
+	pipe.Expire(ctx, key, 30*24*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ Recording conversation cache size failed: %v", err)
+	}
+}
+
+// ConversationSizes is one day of conversation cache size counters
+type ConversationSizes struct {
+	Day      string
+	Counters map[string]int64
+}
+
+// ConversationCacheSizes returns the size counters of the last days days,
+// newest first
+func ConversationCacheSizes(ctx context.Context, conn *data.Conn, days int) ([]ConversationSizes, error) {
+	var out []ConversationSizes
+	now := time.Now().UTC()
+	for i := 0; i < days; i++ {
+		day := now.AddDate(0, 0, -i).Format("2006-01-02")
+		fields, err := conn.Cache.HGetAll(ctx, conversationSizesKeyPrefix+day).Result()
+		if err != nil {
+			return nil, fmt.Errorf("error reading conversation sizes: %v", err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		counters := make(map[string]int64, len(fields))
+		for k, v := range fields {
+			counters[k], _ = strconv.ParseInt(v, 10, 64)
+		}
+		out = append(out, ConversationSizes{Day: day, Counters: counters})
+	}
+	return out, nil
+}
@@ -0,0 +1,396 @@
+package agent
+
+import (
+	"backend/internal/clock"
+	"backend/internal/data"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// EvalCase is one recorded user query together with the tool results the
+// mocked tool layer returns and what we expect the agent to do with them
+type EvalCase struct {
+	ID      string                   `json:"id"`
+	Query   string                   `json:"query"`
+	Context []map[string]interface{} `json:"context,omitempty"`
+	// Mocks answer tool calls; the first mock whose tool matches and whose args
+	// are a subset of the call's args is used
+	Mocks []EvalToolMock `json:"mocks,omitempty"`
+	// ExpectedCalls is the tool-call sequence we expect, matched by tool name
+	// and an args subset
+	ExpectedCalls []EvalExpectedCall `json:"expectedCalls"`
+	// Ordered requires ExpectedCalls to appear in order
+	Ordered bool `json:"ordered,omitempty"`
+	// AllowExtraCalls tolerates calls beyond ExpectedCalls
+	AllowExtraCalls bool                  `json:"allowExtraCalls,omitempty"`
+	Answer          EvalAnswerExpectation `json:"answer,omitempty"`
+}
+
+// EvalToolMock is a canned tool result
+type EvalToolMock struct {
+	Tool   string                 `json:"tool"`
+	Args   map[string]interface{} `json:"args,omitempty"`
+	Result json.RawMessage        `json:"result,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// EvalExpectedCall is a tool call the agent should make
+type EvalExpectedCall struct {
+	Tool string                 `json:"tool"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// EvalAnswerExpectation checks the final answer; text matching is case-insensitive
+type EvalAnswerExpectation struct {
+	Contains    []string `json:"contains,omitempty"`
+	NotContains []string `json:"notContains,omitempty"`
+	ChunkTypes  []string `json:"chunkTypes,omitempty"` // chunk types that must be present
+}
+
+// EvalCall is a tool call the agent actually made
+type EvalCall struct {
+	Tool string      `json:"tool"`
+	Args interface{} `json:"args,omitempty"`
+}
+
+// EvalCaseResult is the outcome of running one case
+type EvalCaseResult struct {
+	ID         string         `json:"id"`
+	Passed     bool           `json:"passed"`
+	Diffs      []string       `json:"diffs,omitempty"`
+	Calls      []EvalCall     `json:"calls"`
+	Unmocked   []EvalCall     `json:"unmocked,omitempty"`
+	Answer     []ContentChunk `json:"answer,omitempty"`
+	Turns      int            `json:"turns"`
+	Tokens     int64          `json:"tokens"`
+	DurationMs int64          `json:"durationMs"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// EvalReport is the outcome of a corpus run
+type EvalReport struct {
+	StartedAt      time.Time         `json:"startedAt"`
+	DurationMs     int64             `json:"durationMs"`
+	PromptVersions map[string]string `json:"promptVersions"`
+	Passed         int               `json:"passed"`
+	Failed         int               `json:"failed"`
+	Cases          []EvalCaseResult  `json:"cases"`
+}
+
+//go:embed evals/*.json
+var evalCorpus embed.FS
+
+// LoadEvalCorpus reads every *.json case file in dir, sorted by file name; an
+// empty dir loads the corpus compiled into the binary
+func LoadEvalCorpus(dir string) ([]EvalCase, error) {
+	var corpus iofs.FS
+	if dir == "" {
+		sub, err := iofs.Sub(evalCorpus, "evals")
+		if err != nil {
+			return nil, fmt.Errorf("error opening embedded eval corpus: %v", err)
+		}
+		corpus = sub
+	} else {
+		corpus = os.DirFS(dir)
+	}
+	paths, err := iofs.Glob(corpus, "*.json")
+	if err != nil {
+		return nil, fmt.Errorf("error listing eval corpus: %v", err)
+	}
+	sort.Strings(paths)
+	cases := make([]EvalCase, 0, len(paths))
+	for _, path := range paths {
+		raw, err := iofs.ReadFile(corpus, path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", path, err)
+		}
+		var c EvalCase
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %v", path, err)
+		}
+		if c.ID == "" {
+			c.ID = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+		if c.Query == "" {
+			return nil, fmt.Errorf("%s: query is required", path)
+		}
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+// RunEval runs every case against the live planner with mocked tools
+func RunEval(ctx context.Context, conn *data.Conn, cases []EvalCase) *EvalReport {
+	report := &EvalReport{StartedAt: time.Now(), PromptVersions: PromptVersions()}
+	for _, c := range cases {
+		res := RunEvalCase(ctx, conn, c)
+		if res.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Cases = append(report.Cases, res)
+	}
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	return report
+}
+
+// RunEvalCase runs the agent loop GetChatRequest runs, without a stored
+// conversation and with every tool mocked
+func RunEvalCase(ctx context.Context, conn *data.Conn, c EvalCase) EvalCaseResult {
+	start := time.Now()
+	res := EvalCaseResult{ID: c.ID}
+	mocks := newEvalMocks(c.Mocks)
+
+	var answer []ContentChunk
+	runner, err := newEvalRunner(conn, c, mocks)
+	if err == nil {
+		var out *loopOutcome
+		out, err = newAgentLoop(runner, runner, clock.Real).run(ctx)
+		answer = validateContentChunks(out.Chunks)
+		res.Turns = out.Turns
+		res.Tokens = out.Tokens.TotalTokenCount
+	}
+	res.Calls = mocks.calls
+	res.Unmocked = mocks.unmocked
+	res.Answer = answer
+	res.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		res.Error = err.Error()
+		res.Diffs = append(res.Diffs, "run failed: "+err.Error())
+	}
+	res.Diffs = append(res.Diffs, diffEvalCalls(c, res.Calls)...)
+	res.Diffs = append(res.Diffs, diffEvalAnswer(c.Answer, answer)...)
+	for _, call := range res.Unmocked {
+		res.Diffs = append(res.Diffs, fmt.Sprintf("no mock for %s(%s)", call.Tool, compactJSON(call.Args)))
+	}
+	res.Passed = len(res.Diffs) == 0
+	return res
+}
+
+// evalRunner calls the live models with a mocked tool layer
+type evalRunner struct {
+	conn               *data.Conn
+	query              string
+	planningPrompt     string
+	basePrompt         string
+	intermediatePrompt string
+	finalPrompt        string
+	executor           *Executor
+}
+
+func newEvalRunner(conn *data.Conn, c EvalCase, mocks *evalMocks) (*evalRunner, error) {
+	r := &evalRunner{conn: conn, query: c.Query}
+	var err error
+	if r.planningPrompt, err = BuildPlanningPromptWithConversationID(conn, 0, "", c.Query, c.Context, nil); err != nil {
+		return nil, fmt.Errorf("error building planning prompt: %w", err)
+	}
+	if r.basePrompt, err = buildSystemPrompt(context.Background(), "defaultSystemPromptBase", false, ""); err != nil {
+		return nil, err
+	}
+	if r.intermediatePrompt, err = GetSystemInstruction("IntermediateSystemPrompt"); err != nil {
+		return nil, err
+	}
+	if r.finalPrompt, err = buildSystemPrompt(context.Background(), "finalResponseSystemPromptBase", false, ""); err != nil {
+		return nil, err
+	}
+	r.executor = NewExecutor(conn, 0, 5, zap.NewNop(), "", "")
+	r.executor.tools = mocks.tools()
+	return r, nil
+}
+
+func (r *evalRunner) plan(ctx context.Context, turn int, results []ExecuteResult, thoughts []string) (interface{}, error) {
+	systemPrompt := r.intermediatePrompt
+	if turn == 1 {
+		systemPrompt = r.basePrompt
+	}
+	return generatePlan(ctx, r.conn, 0, systemPrompt, r.planningPrompt, nil, results, thoughts)
+}
+
+func (r *evalRunner) execute(ctx context.Context, round Round) ([]ExecuteResult, error) {
+	return r.executor.Execute(ctx, round.Calls, round.Parallel)
+}
+
+func (r *evalRunner) final(ctx context.Context, results []ExecuteResult, thoughts []string) (*FinalResponse, error) {
+	return generateFinalResponse(ctx, r.conn, 0, r.query, "", "", nil, results, thoughts, r.finalPrompt, false)
+}
+
+// evalMocks replaces every tool with a lookup into the case's mocks and
+// records the calls made
+type evalMocks struct {
+	mocks    []EvalToolMock
+	mu       sync.Mutex
+	calls    []EvalCall
+	unmocked []EvalCall
+}
+
+func newEvalMocks(mocks []EvalToolMock) *evalMocks {
+	return &evalMocks{mocks: mocks}
+}
+
+func (m *evalMocks) tools() map[string]Tool {
+	tools := make(map[string]Tool, len(Tools))
+	for name, tool := range Tools {
+		name := name
+		tool.Function = func(_ context.Context, _ *data.Conn, _ int, raw json.RawMessage) (interface{}, error) {
+			return m.call(name, raw)
+		}
+		tool.Scope = "" // mocks change nothing, so there is no consent to check
+		tools[name] = tool
+	}
+	return tools
+}
+
+func (m *evalMocks) call(tool string, raw json.RawMessage) (interface{}, error) {
+	var args map[string]interface{}
+	_ = json.Unmarshal(raw, &args)
+	call := EvalCall{Tool: tool, Args: args}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, call)
+	for _, mock := range m.mocks {
+		if mock.Tool != tool || !argsSubset(mock.Args, args) {
+			continue
+		}
+		if mock.Error != "" {
+			return nil, fmt.Errorf("%s", mock.Error)
+		}
+		var result interface{}
+		if len(mock.Result) > 0 {
+			if err := json.Unmarshal(mock.Result, &result); err != nil {
+				return nil, fmt.Errorf("invalid mock result for %s: %v", tool, err)
+			}
+		}
+		return result, nil
+	}
+	m.unmocked = append(m.unmocked, call)
+	return nil, fmt.Errorf("no data available")
+}
+
+// argsSubset reports whether every expected arg is present in actual with an
+// equal value; strings compare case-insensitively and numbers by value
+func argsSubset(expected, actual map[string]interface{}) bool {
+	for key, want := range expected {
+		got, ok := actual[key]
+		if !ok || !evalValuesEqual(want, got) {
+			return false
+		}
+	}
+	return true
+}
+
+func evalValuesEqual(want, got interface{}) bool {
+	if ws, ok := want.(string); ok {
+		gs, ok := got.(string)
+		return ok && strings.EqualFold(ws, gs)
+	}
+	return reflect.DeepEqual(want, got)
+}
+
+// diffEvalCalls compares the calls made with the expected sequence
+func diffEvalCalls(c EvalCase, calls []EvalCall) []string {
+	var diffs []string
+	used := make([]bool, len(calls))
+	next := 0
+	for _, want := range c.ExpectedCalls {
+		found := -1
+		start := 0
+		if c.Ordered {
+			start = next
+		}
+		for i := start; i < len(calls); i++ {
+			if used[i] || calls[i].Tool != want.Tool {
+				continue
+			}
+			args, _ := calls[i].Args.(map[string]interface{})
+			if argsSubset(want.Args, args) {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			diffs = append(diffs, fmt.Sprintf("- expected %s(%s)", want.Tool, compactJSON(want.Args)))
+			continue
+		}
+		used[found] = true
+		next = found + 1
+	}
+	if !c.AllowExtraCalls {
+		for i, call := range calls {
+			if !used[i] {
+				diffs = append(diffs, fmt.Sprintf("+ unexpected %s(%s)", call.Tool, compactJSON(call.Args)))
+			}
+		}
+	}
+	return diffs
+}
+
+// diffEvalAnswer checks the final answer against the case expectations
+func diffEvalAnswer(want EvalAnswerExpectation, chunks []ContentChunk) []string {
+	var diffs []string
+	text := strings.ToLower(answerText(chunks))
+	for _, s := range want.Contains {
+		if !strings.Contains(text, strings.ToLower(s)) {
+			diffs = append(diffs, fmt.Sprintf("answer missing %q", s))
+		}
+	}
+	for _, s := range want.NotContains {
+		if strings.Contains(text, strings.ToLower(s)) {
+			diffs = append(diffs, fmt.Sprintf("answer contains %q", s))
+		}
+	}
+	types := make(map[string]bool)
+	for _, chunk := range chunks {
+		types[chunk.Type] = true
+	}
+	for _, t := range want.ChunkTypes {
+		if !types[t] {
+			diffs = append(diffs, fmt.Sprintf("answer has no %s chunk", t))
+		}
+	}
+	for _, chunk := range chunks {
+		if chunk.Type == ChunkTypeError {
+			diffs = append(diffs, fmt.Sprintf("answer has an error chunk: %s", compactJSON(chunk.Content)))
+		}
+	}
+	return diffs
+}
+
+// answerText flattens chunks into searchable text; non-text chunks contribute
+// their JSON so tables and metric cards can be matched too
+func answerText(chunks []ContentChunk) string {
+	var sb strings.Builder
+	for _, chunk := range chunks {
+		if s, ok := chunk.Content.(string); ok {
+			sb.WriteString(s)
+		} else {
+			sb.WriteString(compactJSON(chunk.Content))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func compactJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
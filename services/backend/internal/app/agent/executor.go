@@ -2,6 +2,8 @@
 package agent
 
 import (
+	"backend/internal/apperr"
+	"backend/internal/budget"
 	"backend/internal/data"
 	"context"
 
@@ -9,6 +11,7 @@ import (
 	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -23,7 +26,10 @@ type ExecuteResult struct {
 	FunctionName string      `json:"fn"`
 	Result       interface{} `json:"res"`
 	Error        *string     `json:"err,omitempty"`
+	ErrorCode    apperr.Code `json:"err_code,omitempty"` // validation, not_found, forbidden, limit_exceeded, upstream_timeout, step_up_required, unavailable or internal
 	Args         interface{} `json:"args,omitempty"`
+	ExecutedAt   time.Time   `json:"-"`
+	DurationMs   int64       `json:"-"`
 }
 
 // Executor manages the execution of tasks in a queue
@@ -39,6 +45,14 @@ type Executor struct {
 	resultPool      sync.Pool // Pool for ExecuteResult slices
 	conversationID  string
 	messageID       string
+
+	// Scopes the user granted, loaded on the first tool that needs consent
+	grantsOnce sync.Once
+	grants     map[Scope]bool
+	grantsErr  error
+	// confirmed runs tools that require confirmation directly; set when
+	// running a pending action the user confirmed
+	confirmed bool
 }
 
 // NewExecutor creates a new Executor
@@ -235,6 +249,7 @@ func (e *Executor) executeFunction(ctx context.Context, fc FunctionCall) (Execut
 			FunctionID:   functionID,
 			FunctionName: fc.Name,
 			Error:        &errorStr,
+			ErrorCode:    apperr.CodeValidation,
 			Args:         fc.Args,
 		}, nil
 	}
@@ -252,26 +267,62 @@ func (e *Executor) executeFunction(ctx context.Context, fc FunctionCall) (Execut
 
 	var argsMap map[string]interface{}
 	_ = json.Unmarshal(fc.Args, &argsMap)
+	if err := e.authorize(ctx, fc.Name, tool); err != nil {
+		e.log.Info("Tool call not permitted", zap.String("function", fc.Name), zap.Error(err))
+		errorStr := err.Error()
+		res := ExecuteResult{
+			FunctionID:   functionID,
+			FunctionName: fc.Name,
+			Error:        &errorStr,
+			ErrorCode:    apperr.CodeOf(err),
+			Args:         argsMap,
+			ExecutedAt:   time.Now(),
+		}
+		recordToolCall(ctx, res)
+		return res, nil
+	}
 	_, span := e.tracer.Start(ctx, fc.Name, trace.WithAttributes(attribute.String("agent.tool", fc.Name)))
 	defer span.End()
-	result, err := tool.Function(ctx, e.conn, e.userID, fc.Args)
+	start := time.Now()
+	var result interface{}
+	err := validateArgs(tool.FunctionDeclaration.Parameters, fc.Args)
+	if err == nil && tool.RequiresConfirmation && !e.confirmed {
+		var pending PendingActionResult
+		if pending, err = e.stagePendingAction(ctx, fc, tool); err == nil {
+			result = pending
+		}
+	} else if err == nil {
+		result, err = budget.Call(ctx, e.conn, budget.KindTool, fc.Name, budget.ForTool(fc.Name), func(ctx context.Context) (interface{}, error) {
+			return tool.Function(ctx, e.conn, e.userID, fc.Args)
+		}, nil)
+	}
+	elapsed := time.Since(start).Milliseconds()
 	if err != nil {
 		span.RecordError(err)
 		e.log.Warn("Error executing function", zap.String("function", fc.Name), zap.Error(err))
 		errorStr := err.Error()
-		return ExecuteResult{
+		res := ExecuteResult{
 			FunctionID:   functionID,
 			FunctionName: fc.Name,
 			Error:        &errorStr,
+			ErrorCode:    apperr.CodeOf(err),
 			Args:         argsMap,
-		}, nil
+			ExecutedAt:   start,
+			DurationMs:   elapsed,
+		}
+		recordToolCall(ctx, res)
+		return res, nil
 	}
-	return ExecuteResult{
+	res := ExecuteResult{
 		FunctionID:   functionID,
 		FunctionName: fc.Name,
 		Result:       result,
 		Args:         argsMap,
-	}, nil
+		ExecutedAt:   start,
+		DurationMs:   elapsed,
+	}
+	recordToolCall(ctx, res)
+	return res, nil
 }
 
 // </executor.go>
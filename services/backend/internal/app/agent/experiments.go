@@ -0,0 +1,556 @@
+package agent
+
+import (
+	"backend/internal/data"
+	"backend/internal/services/flags"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// An experiment splits users between variants of the agent, each of which can
+// swap the planner or final response model and any prompt for a stored
+// version. Users in the agent_experiments flag are assigned deterministically
+// by hashing the experiment key with their ID, so a user sees one variant for
+// the whole experiment. Every response given under an experiment records its
+// latency and status, and later whether the user retried or rated it.
+const (
+	experimentAssignmentKey contextKey = "agentExperimentAssignment"
+
+	maxExperimentVariants = 5
+)
+
+// Stages a variant can choose the model for
+const (
+	stagePlanner = "planner"
+	stageFinal   = "final"
+)
+
+// experimentModels are the models a variant may choose; both stages call the
+// OpenAI Responses API with structured output
+var experimentModels = map[string]bool{
+	"gpt-5":        true,
+	"gpt-5-mini":   true,
+	"gpt-5-nano":   true,
+	"gpt-4.1":      true,
+	"gpt-4.1-mini": true,
+}
+
+var experimentKeyPattern = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+// ExperimentVariant is one arm of an experiment. A variant with no models or
+// prompts set is the control.
+type ExperimentVariant struct {
+	Name         string         `json:"name"`
+	Weight       int            `json:"weight"`
+	PlannerModel string         `json:"plannerModel,omitempty"`
+	FinalModel   string         `json:"finalModel,omitempty"`
+	Prompts      map[string]int `json:"prompts,omitempty"` // prompt name -> agent_prompts version
+}
+
+// Experiment is a stored experiment
+type Experiment struct {
+	ExperimentID int                 `json:"experimentId"`
+	Key          string              `json:"key"`
+	Description  string              `json:"description"`
+	Status       string              `json:"status"`
+	Variants     []ExperimentVariant `json:"variants"`
+	CreatedAt    time.Time           `json:"createdAt"`
+	EndedAt      *time.Time          `json:"endedAt,omitempty"`
+}
+
+// loadedVariant is a variant of the running experiment with its prompts read
+type loadedVariant struct {
+	ExperimentVariant
+	prompts map[string]promptOverride
+}
+
+type runningExperiment struct {
+	Experiment
+	variants    []loadedVariant
+	totalWeight int
+}
+
+// experimentAssignment is the variant a chat request runs under
+type experimentAssignment struct {
+	experimentID int
+	key          string
+	variant      *loadedVariant
+}
+
+var (
+	activeExperiment      *runningExperiment
+	activeExperimentMutex sync.RWMutex
+)
+
+// Validate checks an admin-submitted experiment
+func (e *Experiment) Validate() error {
+	if !experimentKeyPattern.MatchString(e.Key) {
+		return fmt.Errorf("key must be 1-64 lowercase letters, digits or underscores")
+	}
+	if len(e.Variants) < 2 || len(e.Variants) > maxExperimentVariants {
+		return fmt.Errorf("an experiment needs 2 to %d variants", maxExperimentVariants)
+	}
+	seen := map[string]bool{}
+	for i := range e.Variants {
+		v := &e.Variants[i]
+		if !experimentKeyPattern.MatchString(v.Name) {
+			return fmt.Errorf("variant names must be 1-64 lowercase letters, digits or underscores")
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("variant %q is listed twice", v.Name)
+		}
+		seen[v.Name] = true
+		if v.Weight == 0 {
+			v.Weight = 1
+		}
+		if v.Weight < 0 || v.Weight > 100 {
+			return fmt.Errorf("variant %q: weight must be between 1 and 100", v.Name)
+		}
+		for _, m := range []string{v.PlannerModel, v.FinalModel} {
+			if m != "" && !experimentModels[m] {
+				return fmt.Errorf("variant %q: unsupported model %q", v.Name, m)
+			}
+		}
+		for name, version := range v.Prompts {
+			if !isKnownPrompt(name) {
+				return fmt.Errorf("variant %q: unknown prompt %q", v.Name, name)
+			}
+			if version <= 0 {
+				return fmt.Errorf("variant %q: invalid version %d of %s", v.Name, version, name)
+			}
+		}
+	}
+	return nil
+}
+
+// loadActiveExperiment reads the running experiment and the prompt versions
+// its variants use
+func loadActiveExperiment(ctx context.Context, conn *data.Conn) error {
+	var exp Experiment
+	var variantsJSON []byte
+	err := conn.DB.QueryRow(ctx, `
+		SELECT experiment_id, key, description, status, variants, created_at
+		FROM agent_experiments WHERE status = 'running'`).Scan(
+		&exp.ExperimentID, &exp.Key, &exp.Description, &exp.Status, &variantsJSON, &exp.CreatedAt)
+	if err == pgx.ErrNoRows {
+		setActiveExperiment(nil)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error loading running experiment: %v", err)
+	}
+	if err := json.Unmarshal(variantsJSON, &exp.Variants); err != nil {
+		return fmt.Errorf("error parsing variants of experiment %s: %v", exp.Key, err)
+	}
+	running := &runningExperiment{Experiment: exp}
+	for _, v := range exp.Variants {
+		lv := loadedVariant{ExperimentVariant: v, prompts: map[string]promptOverride{}}
+		for name, version := range v.Prompts {
+			content, err := loadPromptVersionContent(ctx, conn, name, version)
+			if err != nil {
+				return fmt.Errorf("experiment %s, variant %s: %v", exp.Key, v.Name, err)
+			}
+			lv.prompts[name] = promptOverride{
+				content: content,
+				label:   fmt.Sprintf("experiment:%s/%s:v%d", exp.Key, v.Name, version),
+			}
+		}
+		running.variants = append(running.variants, lv)
+		running.totalWeight += v.Weight
+	}
+	setActiveExperiment(running)
+	return nil
+}
+
+func setActiveExperiment(e *runningExperiment) {
+	activeExperimentMutex.Lock()
+	changed := (activeExperiment == nil) != (e == nil) ||
+		(e != nil && activeExperiment.ExperimentID != e.ExperimentID)
+	activeExperiment = e
+	activeExperimentMutex.Unlock()
+	if changed {
+		if e == nil {
+			log.Printf("🧪 No agent experiment running")
+		} else {
+			log.Printf("🧪 Agent experiment %s running with %d variants", e.Key, len(e.variants))
+		}
+	}
+}
+
+// loadPromptVersionContent reads a stored prompt version, preferring the one
+// saved for this environment over one saved for every environment
+func loadPromptVersionContent(ctx context.Context, conn *data.Conn, name string, version int) (string, error) {
+	var content string
+	err := conn.DB.QueryRow(ctx, `
+		SELECT content FROM agent_prompts
+		WHERE name = $1 AND version = $2 AND environment IN ('', $3)
+		ORDER BY environment DESC LIMIT 1`, name, version, PromptEnvironment()).Scan(&content)
+	if err == pgx.ErrNoRows {
+		return "", fmt.Errorf("version %d of prompt %s does not exist", version, name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error loading version %d of prompt %s: %v", version, name, err)
+	}
+	return content, nil
+}
+
+// assignExperiment places a user in a variant of the running experiment, if
+// there is one and the user is enrolled in experiments
+func assignExperiment(ctx context.Context, userID int) *experimentAssignment {
+	if userID == 0 {
+		return nil
+	}
+	activeExperimentMutex.RLock()
+	exp := activeExperiment
+	activeExperimentMutex.RUnlock()
+	if exp == nil || exp.totalWeight == 0 || !flags.IsEnabled(ctx, flags.AgentExperiments, userID) {
+		return nil
+	}
+	b := flags.Bucket(exp.Key, userID, exp.totalWeight)
+	for i := range exp.variants {
+		if b < exp.variants[i].Weight {
+			return &experimentAssignment{experimentID: exp.ExperimentID, key: exp.Key, variant: &exp.variants[i]}
+		}
+		b -= exp.variants[i].Weight
+	}
+	return nil
+}
+
+func experimentFromContext(ctx context.Context) *experimentAssignment {
+	if ctx == nil {
+		return nil
+	}
+	a, _ := ctx.Value(experimentAssignmentKey).(*experimentAssignment)
+	return a
+}
+
+// experimentPrompt returns the variant's version of a prompt, if it has one
+func experimentPrompt(ctx context.Context, name string) (promptOverride, bool) {
+	a := experimentFromContext(ctx)
+	if a == nil {
+		return promptOverride{}, false
+	}
+	o, ok := a.variant.prompts[name]
+	return o, ok
+}
+
+// experimentModel returns the model a stage runs on: the variant's choice, or
+// fallback
+func experimentModel(ctx context.Context, stage, fallback string) string {
+	a := experimentFromContext(ctx)
+	if a == nil {
+		return fallback
+	}
+	switch {
+	case stage == stagePlanner && a.variant.PlannerModel != "":
+		return a.variant.PlannerModel
+	case stage == stageFinal && a.variant.FinalModel != "":
+		return a.variant.FinalModel
+	}
+	return fallback
+}
+
+// promptVersionsFor is PromptVersions with the labels of the prompts the
+// request's variant replaces, plus the experiment and variant themselves
+func promptVersionsFor(ctx context.Context) map[string]string {
+	versions := PromptVersions()
+	if a := experimentFromContext(ctx); a != nil {
+		for name, o := range a.variant.prompts {
+			versions[name] = o.label
+		}
+		versions["experiment"] = a.key + "/" + a.variant.Name
+	}
+	return versions
+}
+
+// recordExperimentOutcome stores how a response given under an experiment went
+func recordExperimentOutcome(conn *data.Conn, a *experimentAssignment, userID int, conversationID, messageID string, started time.Time, chatErr error) {
+	if a == nil || conversationID == "" || messageID == "" {
+		return
+	}
+	status := "completed"
+	switch {
+	case errors.Is(chatErr, context.Canceled):
+		status = "cancelled"
+	case chatErr != nil:
+		status = "error"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := conn.DB.Exec(ctx, `
+		INSERT INTO agent_experiment_outcomes
+			(experiment_id, variant, user_id, conversation_id, message_id, status, latency_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		a.experimentID, a.variant.Name, userID, conversationID, messageID, status, time.Since(started).Milliseconds())
+	if err != nil {
+		log.Printf("⚠️ Error recording outcome of experiment %s for message %s: %v", a.key, messageID, err)
+	}
+}
+
+// markExperimentRetried notes that the user retried a response given under an
+// experiment
+func markExperimentRetried(conn *data.Conn, conversationID, messageID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := conn.DB.Exec(ctx, `
+		UPDATE agent_experiment_outcomes SET retried = TRUE
+		WHERE message_id = $1 AND conversation_id = $2`, messageID, conversationID)
+	if err != nil {
+		log.Printf("⚠️ Error marking experiment outcome of message %s retried: %v", messageID, err)
+	}
+}
+
+// rateExperimentOutcome copies a user's rating of a response to its
+// experiment outcome, if it was given under one
+func rateExperimentOutcome(ctx context.Context, conn *data.Conn, conversationID, messageID string, rating int) {
+	_, err := conn.DB.Exec(ctx, `
+		UPDATE agent_experiment_outcomes SET rating = NULLIF($3, 0)
+		WHERE message_id = $1 AND conversation_id = $2`, messageID, conversationID, rating)
+	if err != nil {
+		log.Printf("⚠️ Error rating experiment outcome of message %s: %v", messageID, err)
+	}
+}
+
+// ListExperiments returns every experiment, newest first
+func ListExperiments(ctx context.Context, conn *data.Conn) ([]Experiment, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT experiment_id, key, description, status, variants, created_at, ended_at
+		FROM agent_experiments ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing experiments: %v", err)
+	}
+	defer rows.Close()
+	out := []Experiment{}
+	for rows.Next() {
+		var e Experiment
+		var variantsJSON []byte
+		if err := rows.Scan(&e.ExperimentID, &e.Key, &e.Description, &e.Status, &variantsJSON, &e.CreatedAt, &e.EndedAt); err != nil {
+			return nil, fmt.Errorf("error scanning experiment: %v", err)
+		}
+		if err := json.Unmarshal(variantsJSON, &e.Variants); err != nil {
+			return nil, fmt.Errorf("error parsing variants of experiment %s: %v", e.Key, err)
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// StartExperiment stores and starts an experiment. Only one runs at a time.
+func StartExperiment(ctx context.Context, conn *data.Conn, e Experiment, adminID int) (*Experiment, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	for _, v := range e.Variants {
+		for name, version := range v.Prompts {
+			if _, err := loadPromptVersionContent(ctx, conn, name, version); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var running bool
+	if err := conn.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM agent_experiments WHERE status = 'running')`).Scan(&running); err != nil {
+		return nil, fmt.Errorf("error checking running experiments: %v", err)
+	}
+	if running {
+		return nil, fmt.Errorf("another experiment is running; stop it first")
+	}
+	variantsJSON, err := json.Marshal(e.Variants)
+	if err != nil {
+		return nil, err
+	}
+	e.Status = "running"
+	err = conn.DB.QueryRow(ctx, `
+		INSERT INTO agent_experiments (key, description, variants, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING experiment_id, created_at`,
+		e.Key, e.Description, variantsJSON, adminID).Scan(&e.ExperimentID, &e.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error storing experiment (keys cannot be reused): %v", err)
+	}
+	log.Printf("🧪 Experiment %s started by user %d", e.Key, adminID)
+	reloadExperimentEverywhere(ctx, conn)
+	return &e, nil
+}
+
+// StopExperiment ends a running experiment; its results stay available
+func StopExperiment(ctx context.Context, conn *data.Conn, key string, adminID int) error {
+	tag, err := conn.DB.Exec(ctx, `
+		UPDATE agent_experiments SET status = 'stopped', ended_at = NOW()
+		WHERE key = $1 AND status = 'running'`, key)
+	if err != nil {
+		return fmt.Errorf("error stopping experiment: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("experiment %q is not running", key)
+	}
+	log.Printf("🧪 Experiment %s stopped by user %d", key, adminID)
+	reloadExperimentEverywhere(ctx, conn)
+	return nil
+}
+
+// reloadExperimentEverywhere picks up an experiment change here at once and
+// on other servers through the prompt reload they already listen for
+func reloadExperimentEverywhere(ctx context.Context, conn *data.Conn) {
+	if err := loadActiveExperiment(ctx, conn); err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+	if err := NotifyPromptReload(ctx, conn); err != nil {
+		log.Printf("⚠️ Error announcing experiment change: %v", err)
+	}
+}
+
+// VariantResult summarises the responses given under one variant
+type VariantResult struct {
+	Variant      string        `json:"variant"`
+	Users        int           `json:"users"`
+	Responses    int           `json:"responses"`
+	Completed    int           `json:"completed"`
+	Errors       int           `json:"errors"`
+	Cancelled    int           `json:"cancelled"`
+	ErrorRate    float64       `json:"errorRate"`
+	AvgLatencyMs *float64      `json:"avgLatencyMs"`
+	P50LatencyMs *float64      `json:"p50LatencyMs"`
+	P90LatencyMs *float64      `json:"p90LatencyMs"`
+	Retried      int           `json:"retried"`
+	RetryRate    float64       `json:"retryRate"`
+	ThumbsUp     int           `json:"thumbsUp"`
+	ThumbsDown   int           `json:"thumbsDown"`
+	ThumbsUpRate *float64      `json:"thumbsUpRate"` // of rated responses
+	VsControl    *VariantDelta `json:"vsControl,omitempty"`
+}
+
+// VariantDelta compares a variant to the control (the first variant). Z scores are
+// two-proportion z-tests; |z| above 1.96 is significant at the 5% level.
+type VariantDelta struct {
+	ThumbsUpRateDiff *float64 `json:"thumbsUpRateDiff"`
+	ThumbsUpZ        *float64 `json:"thumbsUpZ"`
+	RetryRateDiff    float64  `json:"retryRateDiff"`
+	RetryZ           *float64 `json:"retryZ"`
+	ErrorRateDiff    float64  `json:"errorRateDiff"`
+	P50LatencyDiffMs *float64 `json:"p50LatencyDiffMs"`
+}
+
+// ExperimentResults is an experiment with its per-variant results
+type ExperimentResults struct {
+	Experiment Experiment      `json:"experiment"`
+	Variants   []VariantResult `json:"variants"`
+}
+
+// GetExperimentResults returns per-variant outcome metrics of an experiment
+func GetExperimentResults(ctx context.Context, conn *data.Conn, key string) (*ExperimentResults, error) {
+	var res ExperimentResults
+	var variantsJSON []byte
+	e := &res.Experiment
+	err := conn.DB.QueryRow(ctx, `
+		SELECT experiment_id, key, description, status, variants, created_at, ended_at
+		FROM agent_experiments WHERE key = $1`, key).Scan(
+		&e.ExperimentID, &e.Key, &e.Description, &e.Status, &variantsJSON, &e.CreatedAt, &e.EndedAt)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("experiment %q does not exist", key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading experiment: %v", err)
+	}
+	if err := json.Unmarshal(variantsJSON, &e.Variants); err != nil {
+		return nil, fmt.Errorf("error parsing variants of experiment %s: %v", key, err)
+	}
+
+	rows, err := conn.DB.Query(ctx, `
+		SELECT variant,
+			COUNT(DISTINCT user_id),
+			COUNT(*),
+			COUNT(*) FILTER (WHERE status = 'completed'),
+			COUNT(*) FILTER (WHERE status = 'error'),
+			COUNT(*) FILTER (WHERE status = 'cancelled'),
+			AVG(latency_ms) FILTER (WHERE status = 'completed'),
+			PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY latency_ms) FILTER (WHERE status = 'completed'),
+			PERCENTILE_CONT(0.9) WITHIN GROUP (ORDER BY latency_ms) FILTER (WHERE status = 'completed'),
+			COUNT(*) FILTER (WHERE retried),
+			COUNT(*) FILTER (WHERE rating = 1),
+			COUNT(*) FILTER (WHERE rating = -1)
+		FROM agent_experiment_outcomes
+		WHERE experiment_id = $1
+		GROUP BY variant`, e.ExperimentID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading experiment outcomes: %v", err)
+	}
+	defer rows.Close()
+	byVariant := map[string]VariantResult{}
+	for rows.Next() {
+		var r VariantResult
+		if err := rows.Scan(&r.Variant, &r.Users, &r.Responses, &r.Completed, &r.Errors, &r.Cancelled,
+			&r.AvgLatencyMs, &r.P50LatencyMs, &r.P90LatencyMs, &r.Retried, &r.ThumbsUp, &r.ThumbsDown); err != nil {
+			return nil, fmt.Errorf("error scanning experiment outcome: %v", err)
+		}
+		byVariant[r.Variant] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating experiment outcomes: %v", err)
+	}
+
+	// Variants in the order they were defined, including ones with no responses yet
+	for _, v := range e.Variants {
+		r := byVariant[v.Name]
+		r.Variant = v.Name
+		if r.Responses > 0 {
+			r.ErrorRate = float64(r.Errors) / float64(r.Responses)
+			r.RetryRate = float64(r.Retried) / float64(r.Responses)
+		}
+		if rated := r.ThumbsUp + r.ThumbsDown; rated > 0 {
+			rate := float64(r.ThumbsUp) / float64(rated)
+			r.ThumbsUpRate = &rate
+		}
+		res.Variants = append(res.Variants, r)
+	}
+	if len(res.Variants) > 0 {
+		control := res.Variants[0]
+		for i := 1; i < len(res.Variants); i++ {
+			res.Variants[i].VsControl = compareToControl(res.Variants[i], control)
+		}
+	}
+	return &res, nil
+}
+
+func compareToControl(v, control VariantResult) *VariantDelta {
+	d := &VariantDelta{
+		RetryRateDiff: v.RetryRate - control.RetryRate,
+		ErrorRateDiff: v.ErrorRate - control.ErrorRate,
+		RetryZ:        twoProportionZ(v.Retried, v.Responses, control.Retried, control.Responses),
+	}
+	if v.ThumbsUpRate != nil && control.ThumbsUpRate != nil {
+		diff := *v.ThumbsUpRate - *control.ThumbsUpRate
+		d.ThumbsUpRateDiff = &diff
+		d.ThumbsUpZ = twoProportionZ(v.ThumbsUp, v.ThumbsUp+v.ThumbsDown,
+			control.ThumbsUp, control.ThumbsUp+control.ThumbsDown)
+	}
+	if v.P50LatencyMs != nil && control.P50LatencyMs != nil {
+		diff := *v.P50LatencyMs - *control.P50LatencyMs
+		d.P50LatencyDiffMs = &diff
+	}
+	return d
+}
+
+// twoProportionZ tests whether successes a/n differ from b/m; nil when either
+// sample is empty or the pooled rate leaves no variance
+func twoProportionZ(a, n, b, m int) *float64 {
+	if n == 0 || m == 0 {
+		return nil
+	}
+	p1, p2 := float64(a)/float64(n), float64(b)/float64(m)
+	pooled := float64(a+b) / float64(n+m)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(n) + 1/float64(m)))
+	if se == 0 {
+		return nil
+	}
+	z := (p1 - p2) / se
+	return &z
+}
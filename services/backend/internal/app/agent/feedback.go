@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultFeedbackDays = 30
+	maxFeedbackDays     = 365
+	maxFeedbackComments = 200
+)
+
+// PromptFeedback is how the responses given under one prompt version were
+// rated. The experiment arm a response ran under is reported as the prompt
+// "experiment" with the version "<key>/<variant>".
+type PromptFeedback struct {
+	Prompt    string   `json:"prompt"`
+	Version   string   `json:"version"`
+	Responses int      `json:"responses"`
+	Rated     int      `json:"rated"`
+	Up        int      `json:"up"`
+	Down      int      `json:"down"`
+	Comments  int      `json:"comments"`
+	UpRate    *float64 `json:"upRate,omitempty"` // of rated responses; nil until one is rated
+}
+
+// PromptFeedbackSummary aggregates response ratings per prompt version over
+// the last days (clamped to 1..365, 30 when 0)
+func PromptFeedbackSummary(ctx context.Context, conn *data.Conn, days int) ([]PromptFeedback, error) {
+	days = clampFeedbackDays(days)
+	rows, err := conn.DB.Query(ctx, `
+		SELECT pv.key, pv.value,
+		       COUNT(*),
+		       COUNT(m.rating),
+		       COUNT(*) FILTER (WHERE m.rating = 1),
+		       COUNT(*) FILTER (WHERE m.rating = -1),
+		       COUNT(m.rating_comment)
+		FROM conversation_messages m
+		CROSS JOIN LATERAL jsonb_each_text(m.prompt_versions) pv
+		WHERE m.status = 'completed'
+		  AND m.prompt_versions IS NOT NULL
+		  AND m.completed_at >= NOW() - make_interval(days => $1)
+		GROUP BY pv.key, pv.value
+		ORDER BY pv.key, COUNT(*) DESC`, days)
+	if err != nil {
+		return nil, fmt.Errorf("error querying prompt feedback: %v", err)
+	}
+	defer rows.Close()
+
+	out := []PromptFeedback{}
+	for rows.Next() {
+		var f PromptFeedback
+		if err := rows.Scan(&f.Prompt, &f.Version, &f.Responses, &f.Rated, &f.Up, &f.Down, &f.Comments); err != nil {
+			return nil, fmt.Errorf("error scanning prompt feedback: %v", err)
+		}
+		if f.Rated > 0 {
+			rate := float64(f.Up) / float64(f.Rated)
+			f.UpRate = &rate
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// RatingComment is a rated response the user also commented on
+type RatingComment struct {
+	ConversationID string            `json:"conversationId"`
+	MessageID      string            `json:"messageId"`
+	Rating         int               `json:"rating"`
+	Comment        string            `json:"comment"`
+	Query          string            `json:"query"`
+	PromptVersions map[string]string `json:"promptVersions,omitempty"`
+	RatedAt        time.Time         `json:"ratedAt"`
+}
+
+// RecentRatingComments lists the latest commented ratings over the last days,
+// optionally only thumbs down, for reading alongside PromptFeedbackSummary
+func RecentRatingComments(ctx context.Context, conn *data.Conn, days int, downOnly bool) ([]RatingComment, error) {
+	days = clampFeedbackDays(days)
+	rows, err := conn.DB.Query(ctx, `
+		SELECT conversation_id, message_id::text, rating, rating_comment, query, prompt_versions, rated_at
+		FROM conversation_messages
+		WHERE rating_comment IS NOT NULL
+		  AND rated_at >= NOW() - make_interval(days => $1)
+		  AND (NOT $2 OR rating = -1)
+		ORDER BY rated_at DESC
+		LIMIT $3`, days, downOnly, maxFeedbackComments)
+	if err != nil {
+		return nil, fmt.Errorf("error querying rating comments: %v", err)
+	}
+	defer rows.Close()
+
+	out := []RatingComment{}
+	for rows.Next() {
+		var c RatingComment
+		if err := rows.Scan(&c.ConversationID, &c.MessageID, &c.Rating, &c.Comment, &c.Query,
+			&c.PromptVersions, &c.RatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning rating comment: %v", err)
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func clampFeedbackDays(days int) int {
+	if days <= 0 {
+		return defaultFeedbackDays
+	}
+	if days > maxFeedbackDays {
+		return maxFeedbackDays
+	}
+	return days
+}
@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"backend/internal/clock"
+	"context"
+	"fmt"
+	"time"
+)
+
+// The plan/execute/final-response loop is shared by chat requests, offline
+// evals and trace replays. What differs between them is behind the loop's
+// parameters: the model that plans and answers (live, or recorded outputs),
+// the tools that run each round (the executor, mocks, or recorded results)
+// and the clock the run is timed by.
+
+// agentMaxTurns is how many planner turns a run may take
+const agentMaxTurns = 15
+
+// Loop stages, for telling callers where a run failed
+const (
+	loopStagePlan    = "planner"
+	loopStageExecute = "execution"
+	loopStageFinal   = "final response"
+)
+
+// agentModel plans each turn and writes the final response
+type agentModel interface {
+	plan(ctx context.Context, turn int, results []ExecuteResult, thoughts []string) (interface{}, error)
+	final(ctx context.Context, results []ExecuteResult, thoughts []string) (*FinalResponse, error)
+}
+
+// agentTools runs one round of a plan's function calls
+type agentTools interface {
+	execute(ctx context.Context, round Round) ([]ExecuteResult, error)
+}
+
+// agentLoop is one run of the loop
+type agentLoop struct {
+	model    agentModel
+	tools    agentTools
+	clock    clock.Clock
+	maxTurns int
+}
+
+func newAgentLoop(model agentModel, tools agentTools, clk clock.Clock) *agentLoop {
+	if clk == nil {
+		clk = clock.Real
+	}
+	return &agentLoop{model: model, tools: tools, clock: clk, maxTurns: agentMaxTurns}
+}
+
+// loopOutcome is how a run ended. Chunks are the answer as the model wrote
+// it; answer adds what the user is shown with it.
+type loopOutcome struct {
+	Chunks      []ContentChunk
+	Suggestions []string
+	// Active are the results the model kept, Discarded those it dropped
+	Active    []ExecuteResult
+	Discarded []ExecuteResult
+	// Direct is set when the planner answered without a final response
+	Direct  bool
+	Tokens  TokenCounts
+	Turns   int
+	Elapsed time.Duration
+}
+
+// allResults is every result of the run, kept or discarded
+func (o *loopOutcome) allResults() []ExecuteResult {
+	all := make([]ExecuteResult, 0, len(o.Active)+len(o.Discarded))
+	return append(append(all, o.Active...), o.Discarded...)
+}
+
+// answer is the answer as the user gets it: the model's chunks, then where
+// its numbers came from and any actions awaiting confirmation
+func (o *loopOutcome) answer() []ContentChunk {
+	chunks := append([]ContentChunk{}, o.Chunks...)
+	if chunk, ok := provenanceChunk(o.Active, o.Discarded); ok {
+		chunks = append(chunks, chunk)
+	}
+	return append(chunks, pendingActionChunks(o.allResults())...)
+}
+
+// loopError is a run failure and the stage it failed in
+type loopError struct {
+	Stage string
+	Err   error
+}
+
+func (e *loopError) Error() string { return fmt.Sprintf("%s error: %v", e.Stage, e.Err) }
+func (e *loopError) Unwrap() error { return e.Err }
+
+// run plans, executes and answers until the model gives an answer or runs
+// out of turns. The outcome is returned with the turns and tokens used so
+// far even when the run fails.
+func (l *agentLoop) run(ctx context.Context) (*loopOutcome, error) {
+	started := l.clock.Now()
+	out := &loopOutcome{}
+	var thoughts []string
+	done := func(err error) (*loopOutcome, error) {
+		out.Elapsed = l.clock.Since(started)
+		return out, err
+	}
+
+	for turn := 1; turn <= l.maxTurns; turn++ {
+		out.Turns = turn
+		if ctx.Err() != nil {
+			return done(ctx.Err())
+		}
+		result, err := l.model.plan(ctx, turn, out.Active, thoughts)
+		if err != nil {
+			return done(&loopError{Stage: loopStagePlan, Err: err})
+		}
+		switch v := result.(type) {
+		case DirectAnswer:
+			out.Tokens.add(v.TokenCounts)
+			out.Chunks, out.Suggestions, out.Direct = v.ContentChunks, v.Suggestions, true
+			return done(nil)
+		case Plan:
+			out.Tokens.add(v.TokenCounts)
+			if v.Thoughts != "" {
+				thoughts = append(thoughts, v.Thoughts)
+				ctx = context.WithValue(ctx, peripheralLatestModelThoughtsKey, v.Thoughts)
+			}
+			if len(v.DiscardResults) > 0 && v.Stage != StageFinishedExecuting {
+				out.discard(v.DiscardResults)
+			}
+			switch v.Stage {
+			case StageExecute:
+				for _, round := range v.Rounds {
+					results, err := l.tools.execute(ctx, round)
+					if err != nil {
+						return done(&loopError{Stage: loopStageExecute, Err: fmt.Errorf("error executing function calls: %w", err)})
+					}
+					out.Active = append(out.Active, results...)
+				}
+			case StageFinishedExecuting:
+				final, err := l.model.final(ctx, out.Active, thoughts)
+				if err != nil {
+					return done(&loopError{Stage: loopStageFinal, Err: err})
+				}
+				out.Tokens.add(final.TokenCounts)
+				out.Chunks, out.Suggestions = final.ContentChunks, final.Suggestions
+				return done(nil)
+			}
+		}
+	}
+	return done(&loopError{Stage: loopStagePlan, Err: fmt.Errorf("model took too many turns to run")})
+}
+
+// discard moves the results with the given function IDs out of Active
+func (o *loopOutcome) discard(ids []int64) {
+	drop := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		drop[id] = true
+	}
+	kept := make([]ExecuteResult, 0, len(o.Active))
+	for _, res := range o.Active {
+		if drop[res.FunctionID] {
+			o.Discarded = append(o.Discarded, res)
+		} else {
+			kept = append(kept, res)
+		}
+	}
+	o.Active = kept
+}
+
+func (t *TokenCounts) add(u TokenCounts) {
+	t.InputTokenCount += u.InputTokenCount
+	t.OutputTokenCount += u.OutputTokenCount
+	t.ThoughtsTokenCount += u.ThoughtsTokenCount
+	t.TotalTokenCount += u.TotalTokenCount
+}
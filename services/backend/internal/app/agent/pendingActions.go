@@ -0,0 +1,217 @@
+package agent
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// Tools marked RequiresConfirmation are not run when the model calls them.
+// The executor stages the call as a pending action and answers the model with
+// its ID; the answer carries a pending_action chunk, and the call only runs
+// once the user confirms it with confirmPendingAction before it expires.
+
+const (
+	pendingActionKeyFmt = "agent:pending_action:%s"
+	pendingActionTTL    = 10 * time.Minute
+)
+
+// PendingAction is a tool call waiting for the user's confirmation
+type PendingAction struct {
+	ID             string          `json:"pendingActionId"`
+	Tool           string          `json:"tool"`
+	Args           json.RawMessage `json:"args,omitempty"`
+	Summary        string          `json:"summary"`
+	ConversationID string          `json:"conversationId,omitempty"`
+	MessageID      string          `json:"messageId,omitempty"`
+	ExpiresAt      int64           `json:"expiresAt"` // ms since epoch
+}
+
+// storedPendingAction keeps the owner, which the chunk sent to the browser leaves out
+type storedPendingAction struct {
+	PendingAction
+	UserID int `json:"userId"`
+}
+
+// PendingActionResult is what the model sees in place of the tool's result
+type PendingActionResult struct {
+	Status          string `json:"status"` // always "awaiting_confirmation"
+	PendingActionID string `json:"pendingActionId"`
+	Summary         string `json:"summary"`
+	ExpiresAt       int64  `json:"expiresAt"`
+	Note            string `json:"note"`
+}
+
+const pendingActionNote = "Not done yet. The user has been shown this action with Confirm and Cancel buttons and it " +
+	"only runs if they confirm within 10 minutes. Tell them what will happen once they confirm; " +
+	"do not call the tool again."
+
+func pendingActionKey(id string) string { return fmt.Sprintf(pendingActionKeyFmt, id) }
+
+// stagePendingAction saves the call for confirmation in place of running it
+func (e *Executor) stagePendingAction(ctx context.Context, fc FunctionCall, tool Tool) (PendingActionResult, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return PendingActionResult{}, fmt.Errorf("error generating pending action ID: %v", err)
+	}
+	expiresAt := time.Now().Add(pendingActionTTL)
+	action := storedPendingAction{
+		PendingAction: PendingAction{
+			ID:             hex.EncodeToString(b),
+			Tool:           fc.Name,
+			Args:           fc.Args,
+			Summary:        summarizeCall(tool, fc.Args),
+			ConversationID: e.conversationID,
+			MessageID:      e.messageID,
+			ExpiresAt:      expiresAt.UnixMilli(),
+		},
+		UserID: e.userID,
+	}
+	raw, err := json.Marshal(action)
+	if err != nil {
+		return PendingActionResult{}, err
+	}
+	if err := e.conn.Cache.Set(ctx, pendingActionKey(action.ID), raw, pendingActionTTL).Err(); err != nil {
+		return PendingActionResult{}, fmt.Errorf("error saving pending action: %v", err)
+	}
+	return PendingActionResult{
+		Status:          "awaiting_confirmation",
+		PendingActionID: action.ID,
+		Summary:         action.Summary,
+		ExpiresAt:       action.ExpiresAt,
+		Note:            pendingActionNote,
+	}, nil
+}
+
+// summarizeCall describes a call for the confirmation prompt, e.g.
+// "Deleting watchlist (watchlistId: 12)"
+func summarizeCall(tool Tool, rawArgs json.RawMessage) string {
+	summary := tool.StatusMessage
+	if summary == "" {
+		summary = tool.FunctionDeclaration.Name
+	}
+	var args map[string]interface{}
+	if err := json.Unmarshal(rawArgs, &args); err != nil || len(args) == 0 {
+		return summary
+	}
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v, _ := json.Marshal(args[k])
+		parts = append(parts, fmt.Sprintf("%s: %s", k, strings.Trim(string(v), `"`)))
+	}
+	return summary + " (" + strings.Join(parts, ", ") + ")"
+}
+
+// pendingActionChunks turns the actions staged during a request into chunks
+// the frontend renders with Confirm and Cancel buttons
+func pendingActionChunks(results []ExecuteResult) []ContentChunk {
+	var chunks []ContentChunk
+	for _, r := range results {
+		p, ok := r.Result.(PendingActionResult)
+		if !ok {
+			continue
+		}
+		chunks = append(chunks, ContentChunk{Type: ChunkTypePendingAction, Content: PendingAction{
+			ID:        p.PendingActionID,
+			Tool:      r.FunctionName,
+			Summary:   p.Summary,
+			ExpiresAt: p.ExpiresAt,
+		}})
+	}
+	return chunks
+}
+
+// ConfirmPendingActionArgs represents the arguments for ConfirmPendingAction
+type ConfirmPendingActionArgs struct {
+	PendingActionID string `json:"pendingActionId"`
+	// Confirm runs the action; false cancels it
+	Confirm bool `json:"confirm"`
+	// TwoFactorCode is passed on to tools that ask for step-up verification
+	TwoFactorCode string `json:"twoFactorCode,omitempty"`
+}
+
+// ConfirmPendingAction runs or cancels an action the agent staged. Either way
+// the action is used up, so it can't run twice.
+func ConfirmPendingAction(ctx context.Context, conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args ConfirmPendingActionArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.PendingActionID == "" {
+		return nil, apperr.Validation("pendingActionId is required")
+	}
+
+	key := pendingActionKey(args.PendingActionID)
+	raw, err := conn.Cache.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, apperr.NotFound("this action has expired or was already handled")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading pending action: %v", err)
+	}
+	var action storedPendingAction
+	if err := json.Unmarshal(raw, &action); err != nil {
+		return nil, fmt.Errorf("error decoding pending action: %v", err)
+	}
+	if action.UserID != userID {
+		return nil, apperr.NotFound("this action has expired or was already handled")
+	}
+	// Whoever deletes the key owns the action; a concurrent confirm gets nothing
+	if n, err := conn.Cache.Del(ctx, key).Result(); err != nil {
+		return nil, fmt.Errorf("error claiming pending action: %v", err)
+	} else if n == 0 {
+		return nil, apperr.NotFound("this action has expired or was already handled")
+	}
+
+	if !args.Confirm {
+		log.Printf("Agent action %s (%s) cancelled by user %d", action.ID, action.Tool, userID)
+		return map[string]interface{}{"status": "cancelled", "summary": action.Summary}, nil
+	}
+
+	callArgs := action.Args
+	if args.TwoFactorCode != "" {
+		var m map[string]interface{}
+		if err := json.Unmarshal(callArgs, &m); err == nil && m != nil {
+			m["twoFactorCode"] = args.TwoFactorCode
+			if withCode, err := json.Marshal(m); err == nil {
+				callArgs = withCode
+			}
+		}
+	}
+
+	// Scopes are checked again: the user may have withdrawn consent meanwhile
+	e := NewExecutor(conn, userID, 1, zap.NewNop(), action.ConversationID, action.MessageID)
+	e.confirmed = true
+	result, _ := e.executeFunction(ctx, FunctionCall{Name: action.Tool, Args: callArgs})
+	if result.Error != nil {
+		code := result.ErrorCode
+		if code == "" {
+			code = apperr.CodeInternal
+		}
+		// Put the action back so the user can confirm again with a code
+		if code == apperr.CodeStepUpRequired {
+			if ttl := time.Until(time.UnixMilli(action.ExpiresAt)); ttl > 0 {
+				conn.Cache.Set(ctx, key, raw, ttl)
+			}
+		}
+		return nil, apperr.New(code, "%s", *result.Error)
+	}
+	log.Printf("Agent action %s (%s) confirmed by user %d", action.ID, action.Tool, userID)
+	return map[string]interface{}{"status": "executed", "summary": action.Summary, "result": result.Result}, nil
+}
@@ -16,7 +16,6 @@ import (
 	"strconv"
 
 	"github.com/openai/openai-go"
-	"github.com/openai/openai-go/option"
 	"github.com/openai/openai-go/responses"
 	"github.com/openai/openai-go/shared"
 )
@@ -32,8 +31,12 @@ type DirectAnswer struct {
 
 // ContentChunk represents a piece of content in the response sequence
 type ContentChunk struct {
-	Type    string      `json:"type"`    // "text", "table", "backtest_table", "plot" (or others later, e.g., "image")
-	Content interface{} `json:"content"` // string for "text", TableData for "table", PlotData for "plot"
+	Type    string      `json:"type"`              // one of the ChunkType* constants, see chunkRegistry
+	Content interface{} `json:"content"`           // string for "text", TableData for "table", PlotData for "plot"
+	Version int         `json:"version,omitempty"` // ContentChunkVersion when sent to the frontend
+	// Error is set on a stored chunk that failed validation or whose data
+	// couldn't be loaded; the frontend gets an error chunk in its place
+	Error *ChunkError `json:"error,omitempty"`
 }
 
 type Round struct {
@@ -117,6 +120,19 @@ type ResponseImage struct {
 								Items: scalar,
 							},
 						},
+						"columnMeta": {
+							Type: genai.TypeArray,
+							Items: &genai.Schema{
+								Type: genai.TypeObject,
+								Properties: map[string]*genai.Schema{
+									"type":         {Type: genai.TypeString, Enum: []string{"number", "integer", "string", "boolean", "timestamp"}},
+									"unit":         {Type: genai.TypeString},
+									"precision":    {Type: genai.TypeInteger},
+									"isPercentage": {Type: genai.TypeBoolean},
+									"isCurrency":   {Type: genai.TypeBoolean},
+								},
+							},
+						},
 					},
 				},
 			},
@@ -152,6 +168,44 @@ type ResponseImage struct {
 							Type:  genai.TypeArray,
 							Items: keyValSchema,
 						},
+						"derivedColumns": {
+							Type: genai.TypeArray,
+							Items: &genai.Schema{
+								Type:     genai.TypeObject,
+								Required: []string{"name", "expression"},
+								Properties: map[string]*genai.Schema{
+									"name":       {Type: genai.TypeString},
+									"expression": {Type: genai.TypeString},
+								},
+							},
+						},
+						"groupBy": {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+						"aggregates": {
+							Type: genai.TypeArray,
+							Items: &genai.Schema{
+								Type:     genai.TypeObject,
+								Required: []string{"func"},
+								Properties: map[string]*genai.Schema{
+									"func":   {Type: genai.TypeString, Enum: []string{"count", "sum", "avg", "min", "max", "median"}},
+									"column": {Type: genai.TypeString},
+									"as":     {Type: genai.TypeString},
+								},
+							},
+						},
+						"sortBy": {
+							Type: genai.TypeArray,
+							Items: &genai.Schema{
+								Type:     genai.TypeObject,
+								Required: []string{"column"},
+								Properties: map[string]*genai.Schema{
+									"column": {Type: genai.TypeString},
+									"desc":   {Type: genai.TypeBoolean},
+								},
+							},
+						},
+						"limit":       {Type: genai.TypeInteger},
+						"offset":      {Type: genai.TypeInteger},
+						"rowsPerPage": {Type: genai.TypeInteger},
 					},
 				},
 			},
@@ -226,7 +280,7 @@ func RunPlanner(ctx context.Context, conn *data.Conn, conversationID string, use
 	if systemPromptFile == "" {
 		systemPromptFile = "defaultSystemPrompt"
 	}
-	systemPrompt, err = GetSystemInstruction(systemPromptFile)
+	systemPrompt, err = getSystemInstruction(ctx, systemPromptFile)
 	if err != nil {
 		return nil, fmt.Errorf("error getting system instruction: %w", err)
 	}
@@ -249,12 +303,17 @@ func RunPlannerWithSystemPrompt(ctx context.Context, conn *data.Conn, conversati
 
 // GetFinalResponseGPTWithPrompt mirrors GetFinalResponseGPT but uses a provided systemPrompt instead of loading from file
 func GetFinalResponse(ctx context.Context, conn *data.Conn, userID int, userQuery string, conversationID string, messageID string, executionResults []ExecuteResult, thoughts []string, systemPrompt string, includeSuggestions bool) (*FinalResponse, error) {
-	client := conn.OpenAIClient
 	conversationHistory, err := GetConversationMessagesRaw(ctx, conn, conversationID, userID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting conversation history: %w", err)
 	}
-	messages, err := buildOpenAIFinalResponseMessages(userQuery, conversationHistory.([]DBConversationMessage), executionResults, thoughts)
+	return generateFinalResponse(ctx, conn, userID, userQuery, conversationID, messageID, conversationHistory.([]DBConversationMessage), executionResults, thoughts, systemPrompt, includeSuggestions)
+}
+
+// generateFinalResponse asks the model for the final answer given an already loaded conversation history
+func generateFinalResponse(ctx context.Context, conn *data.Conn, userID int, userQuery string, conversationID string, messageID string, conversationHistory []DBConversationMessage, executionResults []ExecuteResult, thoughts []string, systemPrompt string, includeSuggestions bool) (*FinalResponse, error) {
+	client := conn.OpenAIClient
+	messages, err := buildOpenAIFinalResponseMessages(userQuery, conversationHistory, executionResults, thoughts)
 	if err != nil {
 		return nil, fmt.Errorf("error building OpenAI messages: %w", err)
 	}
@@ -263,7 +322,7 @@ func GetFinalResponse(ctx context.Context, conn *data.Conn, userID int, userQuer
 		AllowAdditionalProperties: false,
 		DoNotReference:            true,
 	}
-	model := "gpt-5"
+	model := experimentModel(ctx, stageFinal, "gpt-5")
 
 	rawSchema := ref.Reflect(AtlantisFinalResponse{})
 	b, _ := json.Marshal(rawSchema)
@@ -279,6 +338,7 @@ func GetFinalResponse(ctx context.Context, conn *data.Conn, userID int, userQuer
 			},
 		},
 	}
+	started := time.Now()
 	res, err := client.Responses.New(context.Background(), responses.ResponseNewParams{
 		Input: responses.ResponseNewParamsInputUnion{
 			OfInputItemList: messages,
@@ -293,29 +353,37 @@ func GetFinalResponse(ctx context.Context, conn *data.Conn, userID int, userQuer
 		Metadata:     shared.Metadata{"userID": strconv.Itoa(userID), "env": conn.ExecutionEnvironment, "convID": conversationID, "msgID": messageID},
 	})
 	if err != nil {
+		recordLLMCall(ctx, TraceKindFinal, model, systemPrompt, messages, "", nil, started, err)
 		return nil, fmt.Errorf("error generating final response: %w", err)
 	}
 	raw := res.OutputText()
+	usage := TokenCounts{
+		InputTokenCount:    res.Usage.InputTokens,
+		OutputTokenCount:   res.Usage.OutputTokens,
+		ThoughtsTokenCount: res.Usage.OutputTokensDetails.ReasoningTokens,
+		TotalTokenCount:    res.Usage.TotalTokens,
+	}
+	recordLLMCall(ctx, TraceKindFinal, model, systemPrompt, messages, raw, &usage, started, nil)
+	return parseFinalResponseOutput(raw, usage, includeSuggestions), nil
+}
 
+// parseFinalResponseOutput turns the final response model's raw output into a
+// FinalResponse, falling back to a single text chunk if it is not valid JSON
+func parseFinalResponseOutput(raw string, usage TokenCounts, includeSuggestions bool) *FinalResponse {
 	var finalResp FinalResponse
 	if err := json.Unmarshal([]byte(raw), &finalResp); err != nil {
 		return &FinalResponse{
 			ContentChunks: []ContentChunk{{Type: "text", Content: raw}},
 			TokenCounts:   TokenCounts{},
-		}, nil
+		}
 	}
 	if includeSuggestions {
 		finalResp.Suggestions = cleanTickerFormattingFromSuggestions(finalResp.Suggestions)
 	} else {
 		finalResp.Suggestions = nil
 	}
-	finalResp.TokenCounts = TokenCounts{
-		InputTokenCount:    res.Usage.InputTokens,
-		OutputTokenCount:   res.Usage.OutputTokens,
-		ThoughtsTokenCount: res.Usage.OutputTokensDetails.ReasoningTokens,
-		TotalTokenCount:    res.Usage.TotalTokens,
-	}
-	return &finalResp, nil
+	finalResp.TokenCounts = usage
+	return &finalResp
 }
 
 /*func _geminiGeneratePlan(ctx context.Context, conn *data.Conn, systemPrompt string, prompt string) (interface{}, error) {
@@ -386,14 +454,7 @@ func GetFinalResponse(ctx context.Context, conn *data.Conn, userID int, userQuer
 		var directAns DirectAnswer
 		directParseErr := json.Unmarshal([]byte(resultText), &directAns)
 		if directParseErr == nil && len(directAns.ContentChunks) > 0 {
-			hasValidContent := false
-			for _, chunk := range directAns.ContentChunks {
-				if chunk.Content != nil && fmt.Sprintf("%v", chunk.Content) != "" {
-					hasValidContent = true
-					break
-				}
-			}
-			if hasValidContent {
+			if hasRenderableChunk(directAns.ContentChunks) {
 				directAns.Suggestions = cleanTickerFormattingFromSuggestions(directAns.Suggestions)
 				directAns.TokenCounts = TokenCounts{
 					InputTokenCount:    int64(result.UsageMetadata.PromptTokenCount),
@@ -465,14 +526,18 @@ func GetFinalResponse(ctx context.Context, conn *data.Conn, userID int, userQuer
 }*/
 
 func _gptGeneratePlan(ctx context.Context, conn *data.Conn, conversationID string, userID int, systemPrompt string, prompt string, executionResults []ExecuteResult, thoughts []string) (interface{}, error) {
-	apiKey := conn.OpenAIKey
-	client := openai.NewClient(option.WithAPIKey(apiKey))
-	enhancedSystemPrompt := enhanceSystemPromptWithTools(systemPrompt, true)
 	conversationHistory, err := GetConversationMessagesRaw(ctx, conn, conversationID, userID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting conversation history: %w", err)
 	}
-	messages, err := buildOpenAIFinalResponseMessages(prompt, conversationHistory.([]DBConversationMessage), executionResults, thoughts)
+	return generatePlan(ctx, conn, userID, systemPrompt, prompt, conversationHistory.([]DBConversationMessage), executionResults, thoughts)
+}
+
+// generatePlan asks the planning model for the next step given an already loaded conversation history
+func generatePlan(ctx context.Context, conn *data.Conn, userID int, systemPrompt string, prompt string, conversationHistory []DBConversationMessage, executionResults []ExecuteResult, thoughts []string) (interface{}, error) {
+	client := conn.OpenAIClient
+	enhancedSystemPrompt := enhanceSystemPromptWithTools(systemPrompt, true)
+	messages, err := buildOpenAIFinalResponseMessages(prompt, conversationHistory, executionResults, thoughts)
 	if err != nil {
 		return nil, fmt.Errorf("error building OpenAI conversation history: %w", err)
 	}
@@ -494,11 +559,13 @@ func _gptGeneratePlan(ctx context.Context, conn *data.Conn, conversationID strin
 		},
 	}
 
+	model := experimentModel(ctx, stagePlanner, "gpt-5-mini")
+	started := time.Now()
 	res, err := client.Responses.New(context.Background(), responses.ResponseNewParams{
 		Input: responses.ResponseNewParamsInputUnion{
 			OfInputItemList: messages,
 		},
-		Model: "gpt-5-mini",
+		Model: model,
 		Reasoning: shared.ReasoningParam{
 			Effort: "low",
 		},
@@ -507,30 +574,30 @@ func _gptGeneratePlan(ctx context.Context, conn *data.Conn, conversationID strin
 		Text:         textConfig,
 	})
 	if err != nil {
+		recordLLMCall(ctx, TraceKindPlan, model, enhancedSystemPrompt, messages, "", nil, started, err)
 		return nil, fmt.Errorf("error generating plan: %w", err)
 	}
 	fmt.Println("\n\nreasoning summary: ", res.Reasoning.Summary)
 	resultText := res.OutputText()
 	fmt.Println("\n GPT resultText: ", resultText)
+	usage := TokenCounts{
+		InputTokenCount:    int64(res.Usage.InputTokens),
+		OutputTokenCount:   int64(res.Usage.OutputTokens),
+		ThoughtsTokenCount: int64(res.Usage.OutputTokensDetails.ReasoningTokens),
+		TotalTokenCount:    int64(res.Usage.TotalTokens),
+	}
+	recordLLMCall(ctx, TraceKindPlan, model, enhancedSystemPrompt, messages, resultText, &usage, started, nil)
+	return parsePlannerOutput(resultText, usage)
+}
 
+// parsePlannerOutput turns the planning model's raw output into a DirectAnswer or a Plan
+func parsePlannerOutput(resultText string, usage TokenCounts) (interface{}, error) {
 	var directAns DirectAnswer
 	directParseErr := json.Unmarshal([]byte(resultText), &directAns)
 	if directParseErr == nil && len(directAns.ContentChunks) > 0 {
-		hasValidContent := false
-		for _, chunk := range directAns.ContentChunks {
-			if chunk.Content != nil && fmt.Sprintf("%v", chunk.Content) != "" {
-				hasValidContent = true
-				break
-			}
-		}
-		if hasValidContent {
+		if hasRenderableChunk(directAns.ContentChunks) {
 			directAns.Suggestions = cleanTickerFormattingFromSuggestions(directAns.Suggestions)
-			directAns.TokenCounts = TokenCounts{
-				InputTokenCount:    int64(res.Usage.InputTokens),
-				OutputTokenCount:   int64(res.Usage.OutputTokens),
-				ThoughtsTokenCount: int64(res.Usage.OutputTokensDetails.ReasoningTokens),
-				TotalTokenCount:    int64(res.Usage.TotalTokens),
-			}
+			directAns.TokenCounts = usage
 			return directAns, nil
 		}
 	}
@@ -538,12 +605,7 @@ func _gptGeneratePlan(ctx context.Context, conn *data.Conn, conversationID strin
 	var plan Plan
 	planParseErr := json.Unmarshal([]byte(resultText), &plan)
 	if planParseErr == nil && plan.Stage != "" {
-		plan.TokenCounts = TokenCounts{
-			InputTokenCount:    int64(res.Usage.InputTokens),
-			OutputTokenCount:   int64(res.Usage.OutputTokens),
-			ThoughtsTokenCount: int64(res.Usage.OutputTokensDetails.ReasoningTokens),
-			TotalTokenCount:    int64(res.Usage.TotalTokens),
-		}
+		plan.TokenCounts = usage
 		return plan, nil
 	}
 
@@ -579,12 +641,7 @@ func _gptGeneratePlan(ctx context.Context, conn *data.Conn, conversationID strin
 	if jsonBlock != "" {
 		blockPlanParseErr := json.Unmarshal([]byte(jsonBlock), &plan)
 		if blockPlanParseErr == nil && plan.Stage != "" {
-			plan.TokenCounts = TokenCounts{
-				InputTokenCount:    int64(res.Usage.InputTokens),
-				OutputTokenCount:   int64(res.Usage.OutputTokens),
-				ThoughtsTokenCount: int64(res.Usage.OutputTokensDetails.ReasoningTokens),
-				TotalTokenCount:    int64(res.Usage.TotalTokens),
-			}
+			plan.TokenCounts = usage
 			return plan, nil
 		}
 	}
@@ -644,6 +701,13 @@ func buildOpenAIConversationHistory(userQuery string, conversationHistory []DBCo
 					assistantContent += fmt.Sprintf("%v", v)
 				}
 
+			case "chart_image":
+				jsonData, err := json.Marshal(chunk.Content)
+				if err == nil {
+					assistantContent += fmt.Sprintf("[Chart image: %s]", string(jsonData))
+				} else {
+					assistantContent += "[Chart image issue]"
+				}
 			case "backtest_plot", "plot":
 				switch v := chunk.Content.(type) {
 				case map[string]interface{}:
@@ -656,6 +720,8 @@ func buildOpenAIConversationHistory(userQuery string, conversationHistory []DBCo
 				default:
 					assistantContent += fmt.Sprintf("%v", v)
 				}
+			case ChunkTypeProvenance, ChunkTypePendingAction:
+				// Audit metadata for the user, not part of the answer
 			case "text":
 				switch v := chunk.Content.(type) {
 				case string:
@@ -199,6 +199,8 @@ func _buildConversationContext(messages []ChatMessage) string {
 					default:
 						context.WriteString(fmt.Sprintf("%v", v))
 					}
+				case ChunkTypeProvenance, ChunkTypePendingAction:
+					// Audit metadata for the user, not part of the answer
 				case "text":
 					switch v := chunk.Content.(type) {
 					case string:
@@ -438,6 +440,7 @@ func cleanExecuteResultsForPrompt(results []ExecuteResult) []ExecuteResult {
 				FunctionName: result.FunctionName,
 				Args:         result.Args,
 				Error:        result.Error,
+				ErrorCode:    result.ErrorCode,
 				Result:       cleanResultOfResponseImages(result.Result),
 			}
 		} else {
@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
 	"fmt"
@@ -22,7 +23,13 @@ var (
 
 // GetSystemInstruction returns the processed prompt named <name>.txt
 func GetSystemInstruction(name string) (string, error) {
-	raw, err := fs.ReadFile("prompts/" + name + ".txt") // 3️⃣ no paths, no os.ReadFile
+	return getSystemInstruction(context.Background(), name)
+}
+
+// getSystemInstruction is GetSystemInstruction with the prompts of the
+// experiment variant in ctx, if any, taking precedence
+func getSystemInstruction(ctx context.Context, name string) (string, error) {
+	raw, err := readPromptFor(ctx, name) // embedded unless overridden, see promptStore.go
 	if err != nil {
 		return "", fmt.Errorf("reading prompt: %w", err)
 	}
@@ -42,14 +49,14 @@ func GetSystemInstruction(name string) (string, error) {
 		estTime.Format("01-02-2006"))
 	// Fast check if we need to process any constraints
 	if strings.Contains(s, "{{COMMON_CONSTRAINTS}}") {
-		constraints, err := fs.ReadFile("prompts/commonConstraints.txt")
+		constraints, err := readPromptFor(ctx, "commonConstraints")
 		if err != nil {
 			return "", fmt.Errorf("reading common constraints: %w", err)
 		}
 		s = strings.ReplaceAll(s, "{{COMMON_CONSTRAINTS}}", string(constraints))
 	}
 	if strings.Contains(s, "{{EXECUTION_CONSTRAINTS}}") {
-		executionConstraints, err := fs.ReadFile("prompts/executionConstraints.txt")
+		executionConstraints, err := readPromptFor(ctx, "executionConstraints")
 		if err != nil {
 			return "", fmt.Errorf("reading execution constraints: %w", err)
 		}
@@ -59,8 +66,8 @@ func GetSystemInstruction(name string) (string, error) {
 }
 
 // buildSystemPrompt loads a base prompt and conditionally appends a suggestions appendix
-func buildSystemPrompt(baseName string, includeSuggestions bool, suggestionsAppendix string) (string, error) {
-	base, err := GetSystemInstruction(baseName)
+func buildSystemPrompt(ctx context.Context, baseName string, includeSuggestions bool, suggestionsAppendix string) (string, error) {
+	base, err := getSystemInstruction(ctx, baseName)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,337 @@
+package agent
+
+import (
+	"backend/internal/data"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prompts are embedded in the binary but can be overridden without a deploy,
+// either by versions stored in agent_prompts or by files in AGENT_PROMPTS_DIR.
+// Overrides for the current ENVIRONMENT take precedence over ones that apply
+// everywhere, and within the same scope the database wins over files.
+const (
+	promptReloadChannel  = "agent_prompt_reload"
+	promptReloadInterval = time.Minute
+)
+
+// PromptVersion is one stored version of a prompt
+type PromptVersion struct {
+	Name        string    `json:"name"`
+	Environment string    `json:"environment"`
+	Version     int       `json:"version"`
+	Content     string    `json:"content,omitempty"`
+	Active      bool      `json:"active"`
+	Notes       string    `json:"notes,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type promptOverride struct {
+	content string
+	label   string // e.g. "db:prod:v3" or "file:/etc/prompts/prod/x.txt"
+}
+
+var (
+	promptOverrides      = make(map[string]promptOverride)
+	promptOverridesMutex sync.RWMutex
+
+	embeddedPromptLabels     map[string]string
+	embeddedPromptLabelsOnce sync.Once
+)
+
+// PromptEnvironment returns the normalized environment prompt overrides are scoped to
+func PromptEnvironment() string {
+	switch env := strings.ToLower(os.Getenv("ENVIRONMENT")); env {
+	case "", "development":
+		return "dev"
+	case "production":
+		return "prod"
+	default:
+		return env
+	}
+}
+
+// readPrompt returns the active content of prompts/<name>.txt
+func readPrompt(name string) ([]byte, error) {
+	promptOverridesMutex.RLock()
+	o, ok := promptOverrides[name]
+	promptOverridesMutex.RUnlock()
+	if ok {
+		return []byte(o.content), nil
+	}
+	return fs.ReadFile("prompts/" + name + ".txt")
+}
+
+// readPromptFor is readPrompt with the experiment variant in ctx, if any,
+// replacing the prompts it has versions of
+func readPromptFor(ctx context.Context, name string) ([]byte, error) {
+	if o, ok := experimentPrompt(ctx, name); ok {
+		return []byte(o.content), nil
+	}
+	return readPrompt(name)
+}
+
+// isKnownPrompt reports whether name is one of the embedded prompts; overrides
+// can only replace prompts the code actually loads
+func isKnownPrompt(name string) bool {
+	_, err := fs.ReadFile("prompts/" + name + ".txt")
+	return err == nil
+}
+
+func embeddedLabels() map[string]string {
+	embeddedPromptLabelsOnce.Do(func() {
+		embeddedPromptLabels = make(map[string]string)
+		entries, err := fs.ReadDir("prompts")
+		if err != nil {
+			return
+		}
+		for _, e := range entries {
+			raw, err := fs.ReadFile("prompts/" + e.Name())
+			if err != nil {
+				continue
+			}
+			sum := sha256.Sum256(raw)
+			name := strings.TrimSuffix(e.Name(), ".txt")
+			embeddedPromptLabels[name] = "embedded:" + hex.EncodeToString(sum[:4])
+		}
+	})
+	return embeddedPromptLabels
+}
+
+// PromptVersions returns the version label of every prompt currently in use,
+// recorded alongside each agent response
+func PromptVersions() map[string]string {
+	versions := make(map[string]string)
+	for name, label := range embeddedLabels() {
+		versions[name] = label
+	}
+	promptOverridesMutex.RLock()
+	for name, o := range promptOverrides {
+		versions[name] = o.label
+	}
+	promptOverridesMutex.RUnlock()
+	return versions
+}
+
+// ReloadPrompts rebuilds the override set from files and the database
+func ReloadPrompts(ctx context.Context, conn *data.Conn) error {
+	env := PromptEnvironment()
+	overrides := make(map[string]promptOverride)
+
+	// On a database error keep the current overrides rather than silently
+	// falling back to the embedded prompts
+	dbRows, err := loadActivePrompts(ctx, conn, env)
+	if err != nil {
+		return err
+	}
+	dir := os.Getenv("AGENT_PROMPTS_DIR")
+	// Lowest precedence first; later layers overwrite earlier ones
+	if dir != "" {
+		loadPromptFiles(dir, overrides)
+	}
+	for _, p := range dbRows {
+		if p.Environment == "" {
+			overrides[p.Name] = promptOverride{content: p.Content, label: fmt.Sprintf("db:v%d", p.Version)}
+		}
+	}
+	if dir != "" {
+		loadPromptFiles(filepath.Join(dir, env), overrides)
+	}
+	for _, p := range dbRows {
+		if p.Environment != "" {
+			overrides[p.Name] = promptOverride{content: p.Content, label: fmt.Sprintf("db:%s:v%d", p.Environment, p.Version)}
+		}
+	}
+
+	// Variants read their prompt versions from the same table
+	if err := loadActiveExperiment(ctx, conn); err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+
+	promptOverridesMutex.Lock()
+	changed := !sameOverrides(promptOverrides, overrides)
+	promptOverrides = overrides
+	promptOverridesMutex.Unlock()
+
+	if changed {
+		ClearSystemPromptCache()
+		names := make([]string, 0, len(overrides))
+		for name, o := range overrides {
+			names = append(names, name+"="+o.label)
+		}
+		sort.Strings(names)
+		log.Printf("✅ Agent prompts reloaded (%s): %s", env, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+func sameOverrides(a, b map[string]promptOverride) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, o := range a {
+		if b[name] != o {
+			return false
+		}
+	}
+	return true
+}
+
+// loadPromptFiles reads <dir>/<name>.txt for every embedded prompt name
+func loadPromptFiles(dir string, overrides map[string]promptOverride) {
+	for name := range embeddedLabels() {
+		path := filepath.Join(dir, name+".txt")
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("⚠️ Error reading prompt override %s: %v", path, err)
+			}
+			continue
+		}
+		overrides[name] = promptOverride{content: string(raw), label: "file:" + path}
+	}
+}
+
+func loadActivePrompts(ctx context.Context, conn *data.Conn, env string) ([]PromptVersion, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT name, environment, version, content
+		FROM agent_prompts
+		WHERE active AND environment IN ('', $1)`, env)
+	if err != nil {
+		return nil, fmt.Errorf("error loading agent prompts: %v", err)
+	}
+	defer rows.Close()
+	var out []PromptVersion
+	for rows.Next() {
+		p := PromptVersion{Active: true}
+		if err := rows.Scan(&p.Name, &p.Environment, &p.Version, &p.Content); err != nil {
+			return nil, fmt.Errorf("error scanning agent prompt: %v", err)
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// StartPromptReloader loads prompt overrides and keeps them current, reloading
+// on a timer and immediately whenever NotifyPromptReload is called
+func StartPromptReloader(conn *data.Conn) {
+	ctx := context.Background()
+	if err := ReloadPrompts(ctx, conn); err != nil {
+		log.Printf("⚠️ Initial prompt load: %v", err)
+	}
+	go func() {
+		pubsub := conn.Cache.Subscribe(ctx, promptReloadChannel)
+		defer pubsub.Close()
+		reload := pubsub.Channel()
+		ticker := time.NewTicker(promptReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-reload:
+			case <-ticker.C:
+			}
+			if err := ReloadPrompts(ctx, conn); err != nil {
+				log.Printf("⚠️ Prompt reload: %v", err)
+			}
+		}
+	}()
+}
+
+// NotifyPromptReload tells every running server to reload its prompts
+func NotifyPromptReload(ctx context.Context, conn *data.Conn) error {
+	return conn.Cache.Publish(ctx, promptReloadChannel, PromptEnvironment()).Err()
+}
+
+// SavePromptVersion stores content as the next version of a prompt for an
+// environment ("" for all), optionally making it the active one
+func SavePromptVersion(ctx context.Context, conn *data.Conn, name, env, content, notes string, activate bool) (*PromptVersion, error) {
+	if !isKnownPrompt(name) {
+		return nil, fmt.Errorf("unknown prompt %q", name)
+	}
+	if strings.TrimSpace(content) == "" {
+		return nil, fmt.Errorf("prompt content is empty")
+	}
+	tx, err := conn.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if activate {
+		if _, err := tx.Exec(ctx, `UPDATE agent_prompts SET active = FALSE WHERE name = $1 AND environment = $2 AND active`, name, env); err != nil {
+			return nil, fmt.Errorf("error deactivating prompt versions: %v", err)
+		}
+	}
+	p := &PromptVersion{Name: name, Environment: env, Content: content, Active: activate, Notes: notes}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO agent_prompts (name, environment, version, content, active, notes)
+		SELECT $1, $2, COALESCE(MAX(version), 0) + 1, $3, $4, NULLIF($5, '')
+		FROM agent_prompts WHERE name = $1 AND environment = $2
+		RETURNING version, created_at`, name, env, content, activate, notes).Scan(&p.Version, &p.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error saving prompt version: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing prompt version: %v", err)
+	}
+	return p, nil
+}
+
+// ActivatePromptVersion makes a stored version the active one for its
+// environment; version 0 deactivates all versions, reverting to the next
+// lower-precedence source
+func ActivatePromptVersion(ctx context.Context, conn *data.Conn, name, env string, version int) error {
+	tx, err := conn.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `UPDATE agent_prompts SET active = FALSE WHERE name = $1 AND environment = $2 AND active`, name, env); err != nil {
+		return fmt.Errorf("error deactivating prompt versions: %v", err)
+	}
+	if version > 0 {
+		tag, err := tx.Exec(ctx, `UPDATE agent_prompts SET active = TRUE WHERE name = $1 AND environment = $2 AND version = $3`, name, env, version)
+		if err != nil {
+			return fmt.Errorf("error activating prompt version: %v", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("prompt %q has no version %d for environment %q", name, version, env)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing prompt activation: %v", err)
+	}
+	return nil
+}
+
+// ListPromptVersions returns stored versions, newest first; an empty name lists every prompt
+func ListPromptVersions(ctx context.Context, conn *data.Conn, name string) ([]PromptVersion, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT name, environment, version, active, COALESCE(notes, ''), created_at
+		FROM agent_prompts
+		WHERE $1 = '' OR name = $1
+		ORDER BY name, environment, version DESC`, name)
+	if err != nil {
+		return nil, fmt.Errorf("error listing prompt versions: %v", err)
+	}
+	defer rows.Close()
+	var out []PromptVersion
+	for rows.Next() {
+		var p PromptVersion
+		if err := rows.Scan(&p.Name, &p.Environment, &p.Version, &p.Active, &p.Notes, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning prompt version: %v", err)
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ProvenanceEntry records one tool call that fed an agent answer
+type ProvenanceEntry struct {
+	FunctionID int64       `json:"fnId"`
+	Tool       string      `json:"tool"`
+	Args       interface{} `json:"args,omitempty"`
+	ExecutedAt int64       `json:"executedAt,omitempty"` // ms
+	DurationMs int64       `json:"durationMs,omitempty"`
+	AsOf       *int64      `json:"asOf,omitempty"`     // ms; latest data timestamp found in the result
+	RowCount   *int        `json:"rowCount,omitempty"` // rows/items returned, when the result is a list
+	Error      string      `json:"error,omitempty"`
+	// Discarded results were fetched but dropped by the planner before answering
+	Discarded bool `json:"discarded,omitempty"`
+}
+
+// ProvenanceChunkData is the content of the provenance footer chunk
+type ProvenanceChunkData struct {
+	GeneratedAt int64             `json:"generatedAt"` // ms
+	Entries     []ProvenanceEntry `json:"entries"`
+}
+
+// asOfKeys are result fields that carry the time the data describes, in
+// order of preference
+var asOfKeys = []string{"asOf", "as_of", "timestamp", "lastBar", "end", "updatedAt", "date"}
+
+// listKeys are result fields that hold the rows of an object-shaped result
+var listKeys = []string{"rows", "instances", "results", "data", "items", "series"}
+
+// buildProvenance summarizes the tool calls behind an answer; active results
+// come first, followed by those the planner discarded
+func buildProvenance(active, discarded []ExecuteResult) *ProvenanceChunkData {
+	if len(active)+len(discarded) == 0 {
+		return nil
+	}
+	p := &ProvenanceChunkData{GeneratedAt: time.Now().UnixMilli()}
+	add := func(results []ExecuteResult, discarded bool) {
+		for _, r := range results {
+			entry := ProvenanceEntry{
+				FunctionID: r.FunctionID,
+				Tool:       r.FunctionName,
+				Args:       r.Args,
+				DurationMs: r.DurationMs,
+				Discarded:  discarded,
+			}
+			if !r.ExecutedAt.IsZero() {
+				entry.ExecutedAt = r.ExecutedAt.UnixMilli()
+			}
+			if r.Error != nil {
+				entry.Error = *r.Error
+			} else {
+				entry.AsOf, entry.RowCount = inspectResult(r.Result)
+			}
+			p.Entries = append(p.Entries, entry)
+		}
+	}
+	add(active, false)
+	add(discarded, true)
+	return p
+}
+
+// provenanceChunk wraps the provenance of an answer as a content chunk
+func provenanceChunk(active, discarded []ExecuteResult) (ContentChunk, bool) {
+	p := buildProvenance(active, discarded)
+	if p == nil {
+		return ContentChunk{}, false
+	}
+	return ContentChunk{Type: ChunkTypeProvenance, Content: p}, true
+}
+
+// inspectResult looks for a data timestamp and a row count in a tool result
+func inspectResult(result interface{}) (*int64, *int) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return nil, nil
+	}
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return nil, nil
+	}
+	switch v := generic.(type) {
+	case []interface{}:
+		n := len(v)
+		return latestTimestamp(v), &n
+	case map[string]interface{}:
+		asOf := timestampField(v)
+		for _, key := range listKeys {
+			if rows, ok := v[key].([]interface{}); ok {
+				n := len(rows)
+				if asOf == nil {
+					asOf = latestTimestamp(rows)
+				}
+				return asOf, &n
+			}
+		}
+		return asOf, nil
+	}
+	return nil, nil
+}
+
+// latestTimestamp returns the largest timestamp field across list items
+func latestTimestamp(items []interface{}) *int64 {
+	var latest *int64
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if ts := timestampField(m); ts != nil && (latest == nil || *ts > *latest) {
+			latest = ts
+		}
+	}
+	return latest
+}
+
+// timestampField reads the first as-of field of an object as epoch ms; numeric
+// values in seconds are scaled up and RFC 3339 / date strings are parsed
+func timestampField(m map[string]interface{}) *int64 {
+	for _, key := range asOfKeys {
+		switch v := m[key].(type) {
+		case float64:
+			if v <= 0 {
+				continue
+			}
+			ms := int64(v)
+			if ms < 1e11 {
+				ms *= 1000
+			}
+			return &ms
+		case string:
+			for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+				if t, err := time.Parse(layout, v); err == nil {
+					ms := t.UnixMilli()
+					return &ms
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package agent
+
+import (
+	"backend/internal/clock"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ReplayStep is what one recorded model output made the orchestration do
+type ReplayStep struct {
+	Turn      int      `json:"turn"`
+	Kind      string   `json:"kind"` // direct_answer, plan or final
+	Stage     Stage    `json:"stage,omitempty"`
+	Calls     []string `json:"calls,omitempty"`
+	Discarded []int64  `json:"discarded,omitempty"`
+	Thoughts  string   `json:"thoughts,omitempty"`
+}
+
+// ReplayResult is the outcome of replaying a recorded trace
+type ReplayResult struct {
+	MessageID string         `json:"messageId"`
+	Query     string         `json:"query"`
+	Steps     []ReplayStep   `json:"steps"`
+	Answer    []ContentChunk `json:"answer,omitempty"`
+	// Suggestions are the follow-ups the user was offered
+	Suggestions []string `json:"suggestions,omitempty"`
+	Turns       int      `json:"turns"`
+	Tokens      int64    `json:"tokens"`
+	Mismatches  []string `json:"mismatches,omitempty"`
+	Error       string   `json:"error,omitempty"`
+	// Stage is the part of the loop the replay failed in
+	Stage string `json:"stage,omitempty"`
+}
+
+// ReplayAgentTrace re-runs the orchestration of a recorded message using the
+// recorded model outputs and tool results, without calling either. It runs
+// the agent loop chat requests run, on a clock frozen at when the message was
+// recorded, and finishes the answer the way the chat request did.
+func ReplayAgentTrace(ctx context.Context, t *AgentTrace) *ReplayResult {
+	r := newReplayRunner(t)
+	out, err := newAgentLoop(r, r, clock.Frozen(t.CreatedAt)).run(ctx)
+	res := &ReplayResult{
+		MessageID:  t.MessageID,
+		Query:      t.Query,
+		Steps:      r.steps,
+		Turns:      out.Turns,
+		Tokens:     out.Tokens.TotalTokenCount,
+		Mismatches: r.mismatches,
+	}
+	if err != nil {
+		res.Error = err.Error()
+		var loopErr *loopError
+		if errors.As(err, &loopErr) {
+			res.Stage = loopErr.Stage
+		}
+	} else {
+		res.Answer = validateContentChunks(out.answer())
+		if t.IncludeSuggestions {
+			res.Suggestions = out.Suggestions
+		}
+	}
+	if n := len(r.llm) - r.next; n > 0 {
+		res.Mismatches = append(res.Mismatches, fmt.Sprintf("%d recorded model calls were not replayed", n))
+	}
+	unused := 0
+	for _, used := range r.usedTools {
+		if !used {
+			unused++
+		}
+	}
+	if unused > 0 {
+		res.Mismatches = append(res.Mismatches, fmt.Sprintf("%d recorded tool results were not used", unused))
+	}
+	return res
+}
+
+type replayRunner struct {
+	trace      *AgentTrace
+	llm        []TraceEvent
+	next       int
+	tools      []TraceEvent
+	usedTools  []bool
+	nextFnID   int64
+	steps      []ReplayStep
+	mismatches []string
+}
+
+func newReplayRunner(t *AgentTrace) *replayRunner {
+	r := &replayRunner{trace: t}
+	for _, e := range t.Events {
+		switch e.Kind {
+		case TraceKindPlan, TraceKindFinal:
+			r.llm = append(r.llm, e)
+		case TraceKindTool:
+			r.tools = append(r.tools, e)
+			if e.FunctionID > r.nextFnID {
+				r.nextFnID = e.FunctionID
+			}
+		}
+	}
+	r.usedTools = make([]bool, len(r.tools))
+	return r
+}
+
+// nextLLM pops the next recorded model call, which must be of the given kind
+func (r *replayRunner) nextLLM(kind string) (*TraceEvent, error) {
+	if r.next >= len(r.llm) {
+		return nil, fmt.Errorf("trace has no more recorded model calls (wanted %s)", kind)
+	}
+	e := r.llm[r.next]
+	r.next++
+	if e.Kind != kind {
+		return nil, fmt.Errorf("replay diverged: wanted a %s call but trace event %d is %s", kind, e.Seq, e.Kind)
+	}
+	if e.Error != "" {
+		return nil, fmt.Errorf("recorded %s call failed: %s", kind, e.Error)
+	}
+	return &e, nil
+}
+
+func (r *replayRunner) plan(_ context.Context, turn int, _ []ExecuteResult, _ []string) (interface{}, error) {
+	e, err := r.nextLLM(TraceKindPlan)
+	if err != nil {
+		return nil, err
+	}
+	var usage TokenCounts
+	if e.Usage != nil {
+		usage = *e.Usage
+	}
+	result, err := parsePlannerOutput(e.Output, usage)
+	if err != nil {
+		return nil, fmt.Errorf("trace event %d: %w", e.Seq, err)
+	}
+	step := ReplayStep{Turn: turn}
+	switch v := result.(type) {
+	case DirectAnswer:
+		step.Kind = "direct_answer"
+	case Plan:
+		step.Kind = "plan"
+		step.Stage = v.Stage
+		step.Discarded = v.DiscardResults
+		step.Thoughts = v.Thoughts
+		for _, round := range v.Rounds {
+			for _, call := range round.Calls {
+				step.Calls = append(step.Calls, call.Name)
+			}
+		}
+	}
+	r.steps = append(r.steps, step)
+	return result, nil
+}
+
+// execute answers each call with the first unused recorded result of the same
+// tool and args, keeping the recorded function IDs so discards line up
+func (r *replayRunner) execute(_ context.Context, round Round) ([]ExecuteResult, error) {
+	results := make([]ExecuteResult, len(round.Calls))
+	for i, call := range round.Calls {
+		var args map[string]interface{}
+		_ = json.Unmarshal(call.Args, &args)
+		idx := r.findTool(call.Name, args)
+		if idx < 0 {
+			r.nextFnID++
+			errStr := fmt.Sprintf("function '%s' not found", call.Name)
+			if _, exists := Tools[call.Name]; exists {
+				errStr = "no recorded result"
+				r.mismatches = append(r.mismatches, fmt.Sprintf("no recorded result for %s(%s)", call.Name, compactJSON(args)))
+			}
+			results[i] = ExecuteResult{FunctionID: r.nextFnID, FunctionName: call.Name, Error: &errStr, Args: args}
+			continue
+		}
+		r.usedTools[idx] = true
+		e := r.tools[idx]
+		res := ExecuteResult{FunctionID: e.FunctionID, FunctionName: e.Tool, Args: args}
+		if e.Error != "" {
+			errStr := e.Error
+			res.Error = &errStr
+		} else if len(e.Result) > 0 {
+			var decoded interface{}
+			if err := json.Unmarshal(e.Result, &decoded); err != nil {
+				return nil, fmt.Errorf("trace event %d: invalid tool result: %v", e.Seq, err)
+			}
+			res.Result = decoded
+		}
+		results[i] = res
+	}
+	return results, nil
+}
+
+func (r *replayRunner) findTool(name string, args map[string]interface{}) int {
+	for i, e := range r.tools {
+		if r.usedTools[i] || e.Tool != name {
+			continue
+		}
+		var recorded map[string]interface{}
+		_ = json.Unmarshal(e.Args, &recorded)
+		if (len(recorded) == 0 && len(args) == 0) || reflect.DeepEqual(recorded, args) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *replayRunner) final(_ context.Context, _ []ExecuteResult, _ []string) (*FinalResponse, error) {
+	e, err := r.nextLLM(TraceKindFinal)
+	if err != nil {
+		return nil, err
+	}
+	var usage TokenCounts
+	if e.Usage != nil {
+		usage = *e.Usage
+	}
+	turn := 0
+	if len(r.steps) > 0 {
+		turn = r.steps[len(r.steps)-1].Turn
+	}
+	r.steps = append(r.steps, ReplayStep{Turn: turn, Kind: "final"})
+	return parseFinalResponseOutput(e.Output, usage, r.trace.IncludeSuggestions), nil
+}
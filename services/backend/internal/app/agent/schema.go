@@ -0,0 +1,85 @@
+package agent
+
+import "google.golang.org/genai"
+
+// ToolArgs returns the declared argument schema of the named tool, or nil
+// when the tool does not exist or takes no arguments
+func ToolArgs(name string) *genai.Schema {
+	tool, ok := Tools[name]
+	if !ok || tool.FunctionDeclaration == nil {
+		return nil
+	}
+	return tool.FunctionDeclaration.Parameters
+}
+
+// JSONSchema converts a tool argument schema to an OpenAPI 3.0 schema object
+func JSONSchema(s *genai.Schema) map[string]interface{} {
+	out := map[string]interface{}{}
+	if s == nil {
+		return out
+	}
+	if len(s.AnyOf) > 0 {
+		anyOf := make([]interface{}, 0, len(s.AnyOf))
+		for _, option := range s.AnyOf {
+			anyOf = append(anyOf, JSONSchema(option))
+		}
+		out["anyOf"] = anyOf
+	}
+	switch s.Type {
+	case genai.TypeObject:
+		out["type"] = "object"
+		props := map[string]interface{}{}
+		for name, prop := range s.Properties {
+			props[name] = JSONSchema(prop)
+		}
+		out["properties"] = props
+		if len(s.Required) > 0 {
+			out["required"] = s.Required
+		}
+	case genai.TypeArray:
+		out["type"] = "array"
+		out["items"] = JSONSchema(s.Items)
+	case genai.TypeString:
+		out["type"] = "string"
+	case genai.TypeInteger:
+		out["type"] = "integer"
+	case genai.TypeNumber:
+		out["type"] = "number"
+	case genai.TypeBoolean:
+		out["type"] = "boolean"
+	}
+	if s.Description != "" {
+		out["description"] = s.Description
+	}
+	if len(s.Enum) > 0 {
+		out["enum"] = s.Enum
+	}
+	if s.Format != "" {
+		out["format"] = s.Format
+	}
+	if s.Pattern != "" {
+		out["pattern"] = s.Pattern
+	}
+	if s.Nullable != nil && *s.Nullable {
+		out["nullable"] = true
+	}
+	if s.Minimum != nil {
+		out["minimum"] = *s.Minimum
+	}
+	if s.Maximum != nil {
+		out["maximum"] = *s.Maximum
+	}
+	if s.MinItems != nil {
+		out["minItems"] = *s.MinItems
+	}
+	if s.MaxItems != nil {
+		out["maxItems"] = *s.MaxItems
+	}
+	if s.MinLength != nil {
+		out["minLength"] = *s.MinLength
+	}
+	if s.MaxLength != nil {
+		out["maxLength"] = *s.MaxLength
+	}
+	return out
+}
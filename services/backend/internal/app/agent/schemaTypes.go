@@ -49,7 +49,7 @@ type ChunkPlot struct {
 
 // Generic chunk: only two required keys
 type AtlantisContentChunk struct {
-	Type    string      `json:"type"    jsonschema:"enum=text,enum=table,enum=plot,enum=backtest_table,enum=backtest_plot,enum=agent_plot,required"`
+	Type    string      `json:"type"    jsonschema:"enum=text,enum=table,enum=plot,enum=backtest_table,enum=backtest_plot,enum=agent_plot,enum=chart_image,enum=chart,enum=metric_card,enum=list,required"`
 	Content interface{} `json:"content" jsonschema:"required"`
 }
 
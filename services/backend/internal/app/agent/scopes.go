@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Scope is what a tool does on the user's behalf. Reading market data,
+// research and the user's own records is always allowed; every other scope
+// changes the user's data and needs their consent.
+type Scope string
+
+const (
+	ScopeReadMarketData   Scope = "read_market_data"
+	ScopeManageAlerts     Scope = "manage_alerts"
+	ScopeManageStrategies Scope = "manage_strategies"
+	ScopeManageWatchlists Scope = "manage_watchlists"
+	ScopeManageWorkspace  Scope = "manage_workspace" // chart drawings, price lines and screener columns
+	ScopeManageTrades     Scope = "manage_trades"
+)
+
+// ScopeInfo describes a consentable scope to the user
+type ScopeInfo struct {
+	Scope       Scope  `json:"scope"`
+	Label       string `json:"label"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"` // granted until the user changes their permissions
+}
+
+// MutatingScopes lists the scopes the user can grant or withhold, in the
+// order settings shows them
+var MutatingScopes = []ScopeInfo{
+	{ScopeManageAlerts, "Manage alerts", "Create, change and delete price and strategy alerts", true},
+	{ScopeManageStrategies, "Manage strategies", "Create, edit and delete strategies", true},
+	{ScopeManageWatchlists, "Manage watchlists", "Create and delete watchlists and change their tickers", true},
+	{ScopeManageWorkspace, "Manage chart and screener", "Draw on charts, edit price lines and add screener columns", true},
+	{ScopeManageTrades, "Manage trades", "Change or delete trades in your journal", false},
+}
+
+func scopeInfo(s Scope) (ScopeInfo, bool) {
+	for _, info := range MutatingScopes {
+		if info.Scope == s {
+			return info, true
+		}
+	}
+	return ScopeInfo{}, false
+}
+
+// scope is the tool's scope; tools that don't declare one only read
+func (t Tool) scope() Scope {
+	if t.Scope == "" {
+		return ScopeReadMarketData
+	}
+	return t.Scope
+}
+
+// loadGrantedScopes returns the mutating scopes the user lets the agent use.
+// Anonymous callers get none.
+func loadGrantedScopes(ctx context.Context, conn *data.Conn, userID int) (map[Scope]bool, error) {
+	granted := map[Scope]bool{}
+	if userID == 0 {
+		return granted, nil
+	}
+	var stored []string
+	err := conn.DB.QueryRow(ctx, `SELECT agent_scopes FROM users WHERE userId = $1`, userID).Scan(&stored)
+	if err != nil {
+		return nil, fmt.Errorf("error loading agent permissions: %v", err)
+	}
+	if stored == nil {
+		for _, info := range MutatingScopes {
+			if info.Default {
+				granted[info.Scope] = true
+			}
+		}
+		return granted, nil
+	}
+	for _, s := range stored {
+		granted[Scope(s)] = true
+	}
+	return granted, nil
+}
+
+// authorize checks the tool's scope against what the user granted. The
+// denial is worded for the model to pass on to the user.
+func (e *Executor) authorize(ctx context.Context, name string, tool Tool) error {
+	scope := tool.scope()
+	if scope == ScopeReadMarketData {
+		return nil
+	}
+	e.grantsOnce.Do(func() {
+		lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		e.grants, e.grantsErr = loadGrantedScopes(lookupCtx, e.conn, e.userID)
+	})
+	if e.grantsErr != nil {
+		return e.grantsErr
+	}
+	if e.grants[scope] {
+		return nil
+	}
+	label := string(scope)
+	if info, ok := scopeInfo(scope); ok {
+		label = info.Label
+	}
+	return apperr.Forbidden("%s was not run: the user has not allowed the assistant to %q. "+
+		"Tell the user they can allow it under Settings > Account > Assistant Permissions, or make the change themselves.",
+		name, label)
+}
+
+// AgentPermission is one scope with whether the user granted it
+type AgentPermission struct {
+	ScopeInfo
+	Granted bool `json:"granted"`
+}
+
+// GetAgentPermissions lists what the user lets the agent change
+func GetAgentPermissions(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	granted, err := loadGrantedScopes(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]AgentPermission, 0, len(MutatingScopes))
+	for _, info := range MutatingScopes {
+		out = append(out, AgentPermission{ScopeInfo: info, Granted: granted[info.Scope]})
+	}
+	return out, nil
+}
+
+// SetAgentPermissionsArgs represents the arguments for SetAgentPermissions
+type SetAgentPermissionsArgs struct {
+	// Granted is the complete set of scopes to allow; the rest are withheld
+	Granted []Scope `json:"granted"`
+}
+
+// SetAgentPermissions replaces the scopes the user lets the agent use. The
+// next chat request picks them up.
+func SetAgentPermissions(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args SetAgentPermissionsArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	scopes := []string{} // non-nil, so an empty grant is not read back as the defaults
+	seen := map[Scope]bool{}
+	for _, s := range args.Granted {
+		if _, ok := scopeInfo(s); !ok {
+			return nil, apperr.Validation("unknown permission %q", s)
+		}
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, string(s))
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := conn.DB.Exec(ctx, `UPDATE users SET agent_scopes = $2 WHERE userId = $1`, userID, scopes); err != nil {
+		return nil, fmt.Errorf("error saving agent permissions: %v", err)
+	}
+	return GetAgentPermissions(conn, userID, nil)
+}
@@ -39,7 +39,15 @@ type GetSuggestedQueriesResponse struct {
 	Suggestions []string `json:"suggestions"`
 }
 
-func GetSuggestedQueries(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+// GetSuggestedQueries suggests follow-ups for the conversation given by
+// conversation_id, or for the active conversation when none is given
+func GetSuggestedQueries(conn *data.Conn, userID int, args json.RawMessage) (interface{}, error) {
+	var req ConversationSwitchRequest
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &req); err != nil {
+			return nil, fmt.Errorf("error parsing request: %w", err)
+		}
+	}
 
 	// Use the standardized Redis connectivity test
 	ctx := context.Background()
@@ -54,8 +62,11 @@ func GetSuggestedQueries(conn *data.Conn, userID int, _ json.RawMessage) (interf
 
 	// Get the active conversation using the new system
 	var conversationHistory string
-	activeConversationID, err := GetActiveConversationIDCached(ctx, conn, userID)
-	if err == nil && activeConversationID != "" {
+	activeConversationID := req.ConversationID
+	if activeConversationID == "" {
+		activeConversationID, _ = GetActiveConversationIDCached(ctx, conn, userID)
+	}
+	if activeConversationID != "" {
 		// Load conversation messages from database
 		messagesInterface, err := GetConversationMessagesRaw(ctx, conn, activeConversationID, userID)
 		if err == nil && messagesInterface != nil {
@@ -5,9 +5,12 @@ import (
 	"backend/internal/app/chart"
 	"backend/internal/app/helpers"
 	"backend/internal/app/screener"
+	"backend/internal/app/search"
 	"backend/internal/app/strategy"
 	"backend/internal/app/watchlist"
 	"backend/internal/data"
+	"backend/internal/services/chartimage"
+	"backend/internal/services/marketstatus"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -20,6 +23,10 @@ type Tool struct {
 	Function            func(context.Context, *data.Conn, int, json.RawMessage) (interface{}, error)
 	StatusMessage       string
 	UserSpecificTool    bool
+	// Scope is what the tool changes on the user's behalf; empty for tools that only read
+	Scope Scope
+	// RequiresConfirmation stages calls as pending actions the user has to confirm
+	RequiresConfirmation bool
 }
 
 // Wrapper function to adapt existing functions to context-aware signatures
@@ -64,6 +71,30 @@ var (
 			StatusMessage:    "Looking up {ticker}",
 			UserSpecificTool: false,
 		},
+		"resolveTickers": {
+			FunctionDeclaration: &genai.FunctionDeclaration{
+				Name:        "resolveTickers",
+				Description: "Resolve a list of tickers to security IDs in one call. Handles share-class spellings (BRK.B / BRK-B), exchange prefixes and former tickers of renamed or delisted companies. Each ticker comes back with a status: exact, normalized, renamed, delisted, ambiguous (see candidates), unknown (candidates are close matches) or invalid. Ask the user about ambiguous and unknown tickers instead of guessing.",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"tickers": {
+							Type:        genai.TypeArray,
+							Items:       &genai.Schema{Type: genai.TypeString},
+							Description: "The tickers to resolve",
+						},
+						"asOf": {
+							Type:        genai.TypeString,
+							Description: "(Optional) Resolve the tickers as of this date (YYYY-MM-DD), for historical questions",
+						},
+					},
+					Required: []string{"tickers"},
+				},
+			},
+			Function:         wrapWithContext(helpers.GetTickerResolutions),
+			StatusMessage:    "Looking up tickers",
+			UserSpecificTool: false,
+		},
 		"getStockDetails": {
 			FunctionDeclaration: &genai.FunctionDeclaration{
 				Name:        "getStockDetails",
@@ -120,6 +151,35 @@ var (
 			Function:         wrapWithContext(watchlist.AgentNewWatchlist),
 			StatusMessage:    "Creating new watchlist",
 			UserSpecificTool: true,
+			Scope:            ScopeManageWatchlists,
+		},
+		"importWatchlist": {
+			FunctionDeclaration: &genai.FunctionDeclaration{
+				Name:        "importWatchlist",
+				Description: "Create a watchlist from a list of tickers the user pasted, as-is: plain lists, CSV with a Symbol column and TradingView lists (NASDAQ:AAPL) all work. Tickers are de-duplicated, and unknown or invalid ones are reported back rather than failing the import. Pass watchlistId instead of watchlistName to add to an existing watchlist.",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"content": {
+							Type:        genai.TypeString,
+							Description: "The pasted list, unchanged",
+						},
+						"watchlistName": {
+							Type:        genai.TypeString,
+							Description: "The name of the watchlist to create",
+						},
+						"watchlistId": {
+							Type:        genai.TypeInteger,
+							Description: "(Optional) The ID of an existing watchlist to add the tickers to",
+						},
+					},
+					Required: []string{"content"},
+				},
+			},
+			Function:         wrapWithContext(watchlist.AgentImportWatchlist),
+			StatusMessage:    "Importing watchlist",
+			UserSpecificTool: true,
+			Scope:            ScopeManageWatchlists,
 		},
 		"getWatchlistTickers": {
 			FunctionDeclaration: &genai.FunctionDeclaration{
@@ -155,9 +215,11 @@ var (
 					Required: []string{"watchlistItemId"},
 				},
 			},
-			Function:         wrapWithContext(watchlist.AgentDeleteWatchlistItem),
-			StatusMessage:    "Removing item from watchlist",
-			UserSpecificTool: true,
+			Function:             wrapWithContext(watchlist.AgentDeleteWatchlistItem),
+			StatusMessage:        "Removing item from watchlist",
+			UserSpecificTool:     true,
+			Scope:                ScopeManageWatchlists,
+			RequiresConfirmation: true,
 		},
 		"addTickersToWatchlist": {
 			FunctionDeclaration: &genai.FunctionDeclaration{
@@ -175,6 +237,7 @@ var (
 			Function:         wrapWithContext(watchlist.AgentAddTickersToWatchlist),
 			StatusMessage:    "Adding tickers to watchlist",
 			UserSpecificTool: true,
+			Scope:            ScopeManageWatchlists,
 		},
 
 		"deleteWatchlist": {
@@ -192,9 +255,11 @@ var (
 					Required: []string{"watchlistId"},
 				},
 			},
-			Function:         wrapWithContext(watchlist.AgentDeleteWatchlist),
-			StatusMessage:    "Deleting watchlist",
-			UserSpecificTool: true,
+			Function:             wrapWithContext(watchlist.AgentDeleteWatchlist),
+			StatusMessage:        "Deleting watchlist",
+			UserSpecificTool:     true,
+			Scope:                ScopeManageWatchlists,
+			RequiresConfirmation: true,
 		},
 		//singles
 
@@ -228,6 +293,75 @@ var (
 			Function:         wrapWithContext(chart.AgentSetHorizontalLine),
 			StatusMessage:    "Adding horizontal line",
 			UserSpecificTool: true,
+			Scope:            ScopeManageWorkspace,
+		},
+		"setChartDrawing": {
+			FunctionDeclaration: &genai.FunctionDeclaration{
+				Name:        "setChartDrawing",
+				Description: "Draw a trendline, rectangle/zone, fib retracement, or text note on the chart of a security. Trendlines, rectangles (opposite corners) and fib retracements (swing start, swing end) take 2 points; text notes take 1 point and text. For flat price levels use setHorizontalLine instead.",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"securityId": {
+							Type:        genai.TypeInteger,
+							Description: "The ID of the security to draw on.",
+						},
+						"drawingType": {
+							Type:        genai.TypeString,
+							Description: "One of trendline, rectangle, fib_retracement, text.",
+							Enum:        []string{"trendline", "rectangle", "fib_retracement", "text"},
+						},
+						"points": {
+							Type:        genai.TypeArray,
+							Description: "Anchor points of the drawing.",
+							Items: &genai.Schema{
+								Type: genai.TypeObject,
+								Properties: map[string]*genai.Schema{
+									"timestamp": {Type: genai.TypeInteger, Description: "Time in milliseconds since epoch."},
+									"price":     {Type: genai.TypeNumber, Description: "Price level."},
+								},
+								Required: []string{"timestamp", "price"},
+							},
+						},
+						"timeframe": {
+							Type:        genai.TypeString,
+							Description: "(Optional) Only show on this chart timeframe (e.g. 1d, 5m). Omit to show on every timeframe.",
+						},
+						"text": {
+							Type:        genai.TypeString,
+							Description: "Note text, required for text drawings.",
+						},
+					},
+					Required: []string{"securityId", "drawingType", "points"},
+				},
+			},
+			Function:         wrapWithContext(chart.SetChartDrawing),
+			StatusMessage:    "Drawing on chart",
+			UserSpecificTool: true,
+			Scope:            ScopeManageWorkspace,
+		},
+		"getChartDrawings": {
+			FunctionDeclaration: &genai.FunctionDeclaration{
+				Name:        "getChartDrawings",
+				Description: "Retrieves all horizontal lines and drawings (trendlines, rectangles, fib retracements, text notes) on a security's chart.",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"securityId": {
+							Type:        genai.TypeInteger,
+							Description: "The ID of the security.",
+						},
+						"timeframe": {
+							Type:        genai.TypeString,
+							Description: "(Optional) Limit to drawings shown on this timeframe.",
+						},
+					},
+					Required: []string{"securityId"},
+				},
+			},
+			Function:         wrapWithContext(chart.GetChartDrawings),
+			StatusMessage:    "Fetching chart drawings",
+			UserSpecificTool: true,
 		},
 		"getHorizontalLines": {
 			FunctionDeclaration: &genai.FunctionDeclaration{
@@ -263,9 +397,11 @@ var (
 					Required: []string{"id"},
 				},
 			},
-			Function:         wrapWithContext(chart.AgentDeleteHorizontalLine),
-			StatusMessage:    "Deleting horizontal line",
-			UserSpecificTool: true,
+			Function:             wrapWithContext(chart.AgentDeleteHorizontalLine),
+			StatusMessage:        "Deleting horizontal line",
+			UserSpecificTool:     true,
+			Scope:                ScopeManageWorkspace,
+			RequiresConfirmation: true,
 		},
 		"updateHorizontalLine": {
 			FunctionDeclaration: &genai.FunctionDeclaration{
@@ -301,6 +437,7 @@ var (
 			Function:         wrapWithContext(chart.AgentUpdateHorizontalLine),
 			StatusMessage:    "Updating horizontal line",
 			UserSpecificTool: true,
+			Scope:            ScopeManageWorkspace,
 		},
 		"getStockEvents": {
 			FunctionDeclaration: &genai.FunctionDeclaration{
@@ -352,6 +489,28 @@ var (
 			StatusMessage:    "Getting market data",
 			UserSpecificTool: false,
 		},
+		"getSnapshotsForTickers": {
+			FunctionDeclaration: &genai.FunctionDeclaration{
+				Name:        "getSnapshotsForTickers",
+				Description: "Get the current price, change, volume, OHLC and previous close for up to 100 stocks in one call. Use this instead of repeated getDailySnapshot calls when comparing or tabulating several tickers. Tickers that could not be fetched are listed in errors.",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"tickers": {
+							Type:        genai.TypeArray,
+							Description: "The ticker symbols of the stocks.",
+							Items: &genai.Schema{
+								Type: genai.TypeString,
+							},
+						},
+					},
+					Required: []string{"tickers"},
+				},
+			},
+			Function:         wrapWithContext(helpers.GetSnapshotsForTickers),
+			StatusMessage:    "Getting market data",
+			UserSpecificTool: false,
+		},
 		"getLastPrice": {
 			FunctionDeclaration: &genai.FunctionDeclaration{
 				Name:        "getLastPrice",
@@ -374,6 +533,107 @@ var (
 			StatusMessage:    "Getting current price of {ticker}",
 			UserSpecificTool: false,
 		},
+		"getSessionVWAP": {
+			FunctionDeclaration: &genai.FunctionDeclaration{
+				Name:        "getSessionVWAP",
+				Description: "Computes the session VWAP for a ticker from 1-minute bars (typical price weighted by volume), from the session open up to the given time or now.",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"ticker":        {Type: genai.TypeString, Description: "The ticker symbol."},
+						"timestamp":     {Type: genai.TypeInteger, Description: "(Optional) Time within the session in milliseconds since epoch; defaults to now."},
+						"extendedHours": {Type: genai.TypeBoolean, Description: "(Optional) Anchor at the 4:00 AM ET pre-market open instead of the 9:30 AM regular open."},
+					},
+					Required: []string{"ticker"},
+				},
+			},
+			Function:         wrapWithContext(chart.GetSessionVWAP),
+			StatusMessage:    "Calculating {ticker} VWAP",
+			UserSpecificTool: false,
+		},
+		"getAnchoredVWAP": {
+			FunctionDeclaration: &genai.FunctionDeclaration{
+				Name:        "getAnchoredVWAP",
+				Description: "Computes an anchored VWAP for a ticker from 1-minute bars starting at a chosen anchor time (e.g. an earnings gap or swing low) up to an end time or now. To alert when price crosses it, use createPriceAlert with vwapAnchor.",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"ticker": {Type: genai.TypeString, Description: "The ticker symbol."},
+						"anchor": {Type: genai.TypeInteger, Description: "Anchor time in milliseconds since epoch."},
+						"end":    {Type: genai.TypeInteger, Description: "(Optional) End time in milliseconds since epoch; defaults to now."},
+					},
+					Required: []string{"ticker", "anchor"},
+				},
+			},
+			Function:         wrapWithContext(chart.GetAnchoredVWAP),
+			StatusMessage:    "Calculating {ticker} anchored VWAP",
+			UserSpecificTool: false,
+		},
+		"generateChartImage": {
+			FunctionDeclaration: &genai.FunctionDeclaration{
+				Name:        "generateChartImage",
+				Description: "Renders a candlestick chart image of a ticker with volume, optional indicator lines, markers and horizontal price levels. Returns an imageId; show the image to the user with a chart_image content chunk whose content is {\"imageId\": \"<imageId>\"}.",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"ticker":    {Type: genai.TypeString, Description: "The ticker symbol."},
+						"timeframe": {Type: genai.TypeString, Description: "(Optional) Bar timeframe: 1m, 5m, 15m, 1h, 1d or 1w. Defaults to 1d."},
+						"bars":      {Type: genai.TypeInteger, Description: "(Optional) Number of bars to show, up to 500. Defaults to 120."},
+						"end":       {Type: genai.TypeInteger, Description: "(Optional) Time of the last bar in milliseconds since epoch; defaults to now."},
+						"indicators": {
+							Type:        genai.TypeArray,
+							Description: "(Optional) Indicator lines to overlay: \"sma:<period>\", \"ema:<period>\" or \"vwap\".",
+							Items:       &genai.Schema{Type: genai.TypeString},
+						},
+						"markers": {
+							Type:        genai.TypeArray,
+							Description: "(Optional) Markers drawn above the bar containing each timestamp, e.g. entries, exits or events.",
+							Items: &genai.Schema{
+								Type: genai.TypeObject,
+								Properties: map[string]*genai.Schema{
+									"timestamp": {Type: genai.TypeInteger, Description: "Time in milliseconds since epoch."},
+									"price":     {Type: genai.TypeNumber, Description: "(Optional) Price to place the marker at; defaults to the bar high."},
+									"label":     {Type: genai.TypeString, Description: "(Optional) Short label."},
+								},
+								Required: []string{"timestamp"},
+							},
+						},
+						"levels": {
+							Type:        genai.TypeArray,
+							Description: "(Optional) Horizontal price levels such as support, resistance or alert prices.",
+							Items: &genai.Schema{
+								Type: genai.TypeObject,
+								Properties: map[string]*genai.Schema{
+									"price": {Type: genai.TypeNumber, Description: "Price level."},
+									"label": {Type: genai.TypeString, Description: "(Optional) Short label."},
+								},
+								Required: []string{"price"},
+							},
+						},
+						"title":  {Type: genai.TypeString, Description: "(Optional) Chart title; defaults to ticker and timeframe."},
+						"format": {Type: genai.TypeString, Description: "(Optional) png (default) or svg."},
+					},
+					Required: []string{"ticker"},
+				},
+			},
+			Function:         wrapWithContext(chartimage.GenerateChartImage),
+			StatusMessage:    "Drawing {ticker} chart",
+			UserSpecificTool: true,
+		},
+		"getMarketStatus": {
+			FunctionDeclaration: &genai.FunctionDeclaration{
+				Name:        "getMarketStatus",
+				Description: "Retrieves the current US equity market session (pre_market, open, after_hours, closed, holiday), whether today is an early close and its close time, and upcoming market holidays.",
+				Parameters: &genai.Schema{
+					Type:       genai.TypeObject,
+					Properties: map[string]*genai.Schema{},
+					Required:   []string{},
+				},
+			},
+			Function:         wrapWithContext(marketstatus.AgentGetMarketStatus),
+			StatusMessage:    "Checking market status",
+			UserSpecificTool: false,
+		},
 		// SEC Filing Tools
 		/*"getStockEdgarFilings": {
 			FunctionDeclaration: &genai.FunctionDeclaration{
@@ -520,6 +780,27 @@ var (
 							Type:        genai.TypeString,
 							Description: "REQUIRED. Non-empty. The end date of the backtest in strict YYYY-MM-DD format. Ensure endDate >= startDate. If the user did not provide a date, ask them for it before calling.",
 						},
+						"universeFilters": {
+							Type:        genai.TypeArray,
+							Description: "Optional. Screener filters (same format as runScreener filters) that define the universe. They are evaluated against the historical screener snapshot as of universeAsOf, avoiding survivorship and lookahead bias.",
+							Items: &genai.Schema{
+								Type: genai.TypeObject,
+								Properties: map[string]*genai.Schema{
+									"column":   {Type: genai.TypeString, Description: "Screener column name."},
+									"operator": {Type: genai.TypeString, Description: "Comparison operator."},
+									"value":    {Type: genai.TypeUnspecified, Description: "Value to compare against."},
+								},
+								Required: []string{"column", "operator", "value"},
+							},
+						},
+						"universeAsOf": {
+							Type:        genai.TypeString,
+							Description: "Optional. YYYY-MM-DD date the universe filters are evaluated on. Defaults to startDate.",
+						},
+						"confirmCost": {
+							Type:        genai.TypeBoolean,
+							Description: "Optional. Backtests estimated to take long are refused with their projected runtime until repeated with confirmCost true. Set it only after the user accepts the estimated cost.",
+						},
 					},
 					Required: []string{"strategyId", "startDate", "endDate"},
 				},
@@ -528,6 +809,56 @@ var (
 			StatusMessage:    "Running backtest",
 			UserSpecificTool: false,
 		},
+		"runOptimizationSweep": {
+			FunctionDeclaration: &genai.FunctionDeclaration{
+				Name:        "runOptimizationSweep",
+				Description: "Run a parameter sweep of a strategy: one backtest per combination of parameter values. Strategies read sweep parameters with PARAMS.get(name, default). Each combination is ranked on the first part of the date range (train) and checked on the held-out remainder (test); the response is a ranked grid with overfitting warnings. The number of combinations is limited by the user's plan.",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"strategyId": {
+							Type:        genai.TypeInteger,
+							Description: "id of the strategy to sweep",
+						},
+						"startDate": {
+							Type:        genai.TypeString,
+							Description: "REQUIRED. Start date of the sweep in YYYY-MM-DD format.",
+						},
+						"endDate": {
+							Type:        genai.TypeString,
+							Description: "REQUIRED. End date of the sweep in YYYY-MM-DD format.",
+						},
+						"parameters": {
+							Type:        genai.TypeArray,
+							Description: "Parameters to sweep. Give either explicit values or a min/max/step range for each.",
+							Items: &genai.Schema{
+								Type: genai.TypeObject,
+								Properties: map[string]*genai.Schema{
+									"name":   {Type: genai.TypeString, Description: "Name the strategy reads from PARAMS."},
+									"values": {Type: genai.TypeArray, Description: "Explicit values to try.", Items: &genai.Schema{Type: genai.TypeNumber}},
+									"min":    {Type: genai.TypeNumber, Description: "Range start (inclusive)."},
+									"max":    {Type: genai.TypeNumber, Description: "Range end (inclusive)."},
+									"step":   {Type: genai.TypeNumber, Description: "Range step."},
+								},
+								Required: []string{"name"},
+							},
+						},
+						"metric": {
+							Type:        genai.TypeString,
+							Description: "Numeric instance field to rank on. Defaults to score.",
+						},
+						"trainFraction": {
+							Type:        genai.TypeNumber,
+							Description: "Share of the date range used for ranking (0-1, default 0.7).",
+						},
+					},
+					Required: []string{"strategyId", "startDate", "endDate", "parameters"},
+				},
+			},
+			Function:         strategy.RunOptimizationSweep,
+			StatusMessage:    "Running optimization sweep",
+			UserSpecificTool: false,
+		},
 		"getBacktestInstances": {
 			FunctionDeclaration: &genai.FunctionDeclaration{
 				Name:        "getBacktestInstances",
@@ -671,17 +1002,79 @@ var (
 		"getStrategies": {
 			FunctionDeclaration: &genai.FunctionDeclaration{
 				Name:        "getStrategies",
-				Description: "Retrieves all strategies for the current user, including strategy names, ids, and alert configuration (AlertActive, alertThreshold, alertUniverse). Use this to fetch unknown strategy ids or to get strategy alert information.",
+				Description: "Retrieves all strategies for the current user, including strategy names, ids, tags, and alert configuration (AlertActive, alertThreshold, alertUniverse). Use this to fetch unknown strategy ids or to get strategy alert information. Pass tag to list only one kind of strategy (e.g. the user's breakout strategies).",
 				Parameters: &genai.Schema{
-					Type:       genai.TypeObject,
-					Properties: map[string]*genai.Schema{},
-					Required:   []string{},
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"tag": {
+							Type:        genai.TypeString,
+							Description: "Optional. Only strategies with this tag; tags are assigned automatically from each strategy's code and description.",
+							Enum:        strategy.StrategyTags,
+						},
+					},
+					Required: []string{},
 				},
 			},
 			Function:         wrapWithContext(strategy.GetStrategies),
 			StatusMessage:    "Fetching strategies",
 			UserSpecificTool: true,
 		},
+		"explainStrategy": {
+			FunctionDeclaration: &genai.FunctionDeclaration{
+				Name:        "explainStrategy",
+				Description: "Describes a strategy in plain English, read deterministically from its code: its entry conditions, exit rules, universe, timeframe and alert settings, plus a one-sentence summary. Use this to tell the user what a strategy actually does, or to restate it before they confirm a backtest or alert, instead of paraphrasing the code yourself.",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"strategyId": {Type: genai.TypeInteger, Description: "The id of the strategy to explain."},
+					},
+					Required: []string{"strategyId"},
+				},
+			},
+			Function:         strategy.ExplainStrategy,
+			StatusMessage:    "Reading the strategy",
+			UserSpecificTool: true,
+		},
+		"searchEntities": {
+			FunctionDeclaration: &genai.FunctionDeclaration{
+				Name:        "searchEntities",
+				Description: "Searches securities and the user's own strategies, watchlists and studies by name in one call, ranked by how well they match and how often the user opens them. Use this to resolve an ambiguous or partial reference (e.g. 'my momentum strategy', 'the tech list', 'apple') to a type and id before acting on it; if several results match about equally, ask the user which they meant. An empty query returns the user's recently and frequently opened items.",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"query": {Type: genai.TypeString, Description: "The name, ticker or words the user used to refer to the item."},
+						"types": {
+							Type:        genai.TypeArray,
+							Description: "Optional. Only return these types; defaults to all of them.",
+							Items:       &genai.Schema{Type: genai.TypeString, Enum: []string{"security", "strategy", "watchlist", "study"}},
+						},
+						"limit": {Type: genai.TypeInteger, Description: "Optional. Maximum number of results, 1-50 (default 10)."},
+					},
+					Required: []string{"query"},
+				},
+			},
+			Function:         search.GlobalSearch,
+			StatusMessage:    "Searching",
+			UserSpecificTool: true,
+		},
+		"getAlertThresholdSuggestion": {
+			FunctionDeclaration: &genai.FunctionDeclaration{
+				Name:        "getAlertThresholdSuggestion",
+				Description: "Suggests an alert threshold (score cutoff) for a strategy alert based on its trigger history versus the returns that followed each trigger. Returns the current and suggested thresholds with supporting stats: baseline precision (share of triggers followed by a positive return), precision and trigger count at the current and suggested cutoffs, and mean return. Present these stats when recommending a change; use configureStrategyAlert to apply it if the user agrees.",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"strategyId":      {Type: genai.TypeInteger, Description: "Strategy ID"},
+						"targetPrecision": {Type: genai.TypeNumber, Description: "Desired share of triggers followed by a positive return (0-1, default 0.6)."},
+						"horizonDays":     {Type: genai.TypeInteger, Description: "Forward return horizon in calendar days (default 5)."},
+					},
+					Required: []string{"strategyId"},
+				},
+			},
+			Function:         wrapWithContext(strategy.GetAlertThresholdSuggestion),
+			StatusMessage:    "Analyzing alert threshold",
+			UserSpecificTool: true,
+		},
 		"deleteStrategy": {
 			FunctionDeclaration: &genai.FunctionDeclaration{
 				Name:        "deleteStrategy",
@@ -689,14 +1082,17 @@ var (
 				Parameters: &genai.Schema{
 					Type: genai.TypeObject,
 					Properties: map[string]*genai.Schema{
-						"strategyId": {Type: genai.TypeInteger, Description: "Strategy ID"},
+						"strategyId":    {Type: genai.TypeInteger, Description: "Strategy ID"},
+						"twoFactorCode": {Type: genai.TypeString, Description: "Code from the user's authenticator app. Only needed when deleting a strategy with active alerts fails asking for one; ask the user for it, never guess."},
 					},
 					Required: []string{"strategyId"},
 				},
 			},
-			Function:         wrapWithContext(strategy.DeleteStrategy),
-			StatusMessage:    "Deleting strategy",
-			UserSpecificTool: true,
+			Function:             wrapWithContext(strategy.DeleteStrategy),
+			StatusMessage:        "Deleting strategy",
+			UserSpecificTool:     true,
+			Scope:                ScopeManageStrategies,
+			RequiresConfirmation: true,
 		},
 		"runStrategyAgent": {
 			FunctionDeclaration: &genai.FunctionDeclaration{
@@ -714,6 +1110,7 @@ var (
 			Function:         strategy.AgentCreateStrategyFromPrompt,
 			StatusMessage:    "Building strategy",
 			UserSpecificTool: false,
+			Scope:            ScopeManageStrategies,
 		},
 		// [SEARCH TOOLS]
 		"runWebSearch": {
@@ -770,7 +1167,7 @@ var (
 		"createPriceAlert": {
 			FunctionDeclaration: &genai.FunctionDeclaration{
 				Name:        "createPriceAlert",
-				Description: "Create a new price alert for a specific security. The alert will trigger when the price reaches the specified level.",
+				Description: "Create a new price alert for a specific security. The alert will trigger when the price reaches the specified level, or, when vwapAnchor is given, when price crosses the VWAP anchored at that time, or, when drawingId is given, when price crosses that trendline drawing (see getChartDrawings).",
 				Parameters: &genai.Schema{
 					Type: genai.TypeObject,
 					Properties: map[string]*genai.Schema{
@@ -786,13 +1183,23 @@ var (
 							Type:        genai.TypeString,
 							Description: "The ticker symbol of the stock (e.g., 'AAPL', 'NVDA').",
 						},
+						"vwapAnchor": {
+							Type:        genai.TypeInteger,
+							Description: "(Optional) Anchor time in milliseconds since epoch. When set, the alert triggers on price crossing the VWAP anchored here and price is ignored.",
+						},
+						"drawingId": {
+							Type:        genai.TypeInteger,
+							Description: "(Optional) ID of a trendline drawing on this security. When set, the alert triggers on price crossing the line's projected value and price is ignored.",
+						},
 					},
-					Required: []string{"price", "securityId", "ticker"},
+					Required: []string{"securityId", "ticker"},
 				},
 			},
-			Function:         wrapWithContext(alerts.AgentNewAlert),
-			StatusMessage:    "Creating price alert",
-			UserSpecificTool: true,
+			Function:             wrapWithContext(alerts.AgentNewAlert),
+			StatusMessage:        "Creating price alert",
+			UserSpecificTool:     true,
+			Scope:                ScopeManageAlerts,
+			RequiresConfirmation: true,
 		},
 		"getAlerts": {
 			FunctionDeclaration: &genai.FunctionDeclaration{
@@ -827,6 +1234,32 @@ var (
 			StatusMessage:    "Fetching alert history",
 			UserSpecificTool: true,
 		},
+		"simulateAlert": {
+			FunctionDeclaration: &genai.FunctionDeclaration{
+				Name:        "simulateAlert",
+				Description: "Replays a price alert or strategy alert over the last N days of data and returns when it would have triggered, with the ticker and price of each trigger. Nothing is created or sent. Use it to check a price level or a strategy alert threshold before the user turns the alert on, e.g. 'how often would an alert at $200 on NVDA have fired?'. Give exactly one of: alertId (a saved price alert), securityId and price (an unsaved price alert), or strategyId (a strategy alert, optionally with threshold and universe to try values other than its saved ones).",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"alertId":    {Type: genai.TypeInteger, Description: "A saved fixed-price alert to replay."},
+						"securityId": {Type: genai.TypeInteger, Description: "Security of an unsaved price alert; requires price."},
+						"price":      {Type: genai.TypeNumber, Description: "Level of an unsaved price alert; requires securityId."},
+						"strategyId": {Type: genai.TypeInteger, Description: "Strategy whose alert to replay."},
+						"threshold":  {Type: genai.TypeNumber, Description: "Optional. Score cutoff to try instead of the strategy's saved alert threshold."},
+						"universe": {
+							Type:        genai.TypeArray,
+							Description: "Optional. Tickers to try instead of the strategy's saved alert universe.",
+							Items:       &genai.Schema{Type: genai.TypeString},
+						},
+						"days": {Type: genai.TypeInteger, Description: "Optional. How many days back to replay, 1-365 (default 30)."},
+					},
+					Required: []string{},
+				},
+			},
+			Function:         alerts.SimulateAlert,
+			StatusMessage:    "Simulating alert",
+			UserSpecificTool: true,
+		},
 		"deleteAlert": {
 			FunctionDeclaration: &genai.FunctionDeclaration{
 				Name:        "deleteAlert",
@@ -842,9 +1275,11 @@ var (
 					Required: []string{"alertId"},
 				},
 			},
-			Function:         wrapWithContext(alerts.AgentDeleteAlert),
-			StatusMessage:    "Deleting alert",
-			UserSpecificTool: true,
+			Function:             wrapWithContext(alerts.AgentDeleteAlert),
+			StatusMessage:        "Deleting alert",
+			UserSpecificTool:     true,
+			Scope:                ScopeManageAlerts,
+			RequiresConfirmation: true,
 		},
 		"configureStrategyAlert": {
 			FunctionDeclaration: &genai.FunctionDeclaration{
@@ -872,13 +1307,40 @@ var (
 								Type: genai.TypeString,
 							},
 						},
+						"universeFilters": {
+							Type:        genai.TypeArray,
+							Description: "Optional. Screener filters (same format as runScreener filters, including the user's computed columns) that define the universe to monitor. The screen is rerun each time the alert is checked, so the universe follows the market. Overrides universe when provided.",
+							Items: &genai.Schema{
+								Type: genai.TypeObject,
+								Properties: map[string]*genai.Schema{
+									"column":   {Type: genai.TypeString, Description: "Screener column name."},
+									"operator": {Type: genai.TypeString, Description: "Comparison operator."},
+									"value":    {Type: genai.TypeUnspecified, Description: "Value to compare against."},
+								},
+								Required: []string{"column", "operator", "value"},
+							},
+						},
+						"intervalSeconds": {
+							Type:        genai.TypeInteger,
+							Description: "Optional. How often to evaluate the strategy, in seconds, from 10 up to 86400 (daily). The user's plan sets the shortest interval allowed. Omit to keep the current interval; 0 resets it to the default.",
+						},
+						"sectorTopN": {
+							Type:        genai.TypeInteger,
+							Description: "Optional. Only notify the N highest-scoring matches in each sector (1-100), to cut noise on broad-universe strategies. Omit to keep the current setting; 0 notifies every match.",
+						},
+						"confirmCost": {
+							Type:        genai.TypeBoolean,
+							Description: "Optional. Alerts estimated to use a lot of worker time per day are refused with the estimate until repeated with confirmCost true. Set it only after the user accepts the estimated cost.",
+						},
 					},
 					Required: []string{"strategyId", "active"},
 				},
 			},
-			Function:         wrapWithContext(strategy.SetAlert),
-			StatusMessage:    "Configuring strategy alert",
-			UserSpecificTool: true,
+			Function:             wrapWithContext(strategy.SetAlert),
+			StatusMessage:        "Configuring strategy alert",
+			UserSpecificTool:     true,
+			Scope:                ScopeManageAlerts,
+			RequiresConfirmation: true,
 		},
 		// [END ALERT TOOLS]
 		// [SCREENER TOOLS]
@@ -891,7 +1353,7 @@ var (
 					Properties: map[string]*genai.Schema{
 						"returnColumns": {
 							Type:        genai.TypeArray,
-							Description: "Array of column names to return in results. Available columns: ticker, calc_time, security_id, open, high, low, close, wk52_low, wk52_high, pre_market_open, pre_market_high, pre_market_low, pre_market_close, market_cap, sector, industry, pre_market_change, pre_market_change_pct, extended_hours_change, extended_hours_change_pct, change_1_pct, change_15_pct, change_1h_pct, change_4h_pct, change_1d_pct, change_1w_pct, change_1m_pct, change_3m_pct, change_6m_pct, change_ytd_pct, change_1y_pct, change_5y_pct, change_10y_pct, change_all_time_pct, change_from_open, change_from_open_pct, price_over_52wk_high, price_over_52wk_low, rsi, dma_200, dma_50, price_over_50dma, price_over_200dma, beta_1y_vs_spy, beta_1m_vs_spy, volume, avg_volume_1m, dollar_volume, avg_dollar_volume_1m, pre_market_volume, pre_market_dollar_volume, relative_volume_14, pre_market_vol_over_14d_vol, range_1m_pct, range_15m_pct, range_1h_pct, day_range_pct, volatility_1w_pct, volatility_1m_pct, pre_market_range_pct. At least one column is required.",
+							Description: "Array of column names to return in results. Available columns: ticker, calc_time, security_id, open, high, low, close, wk52_low, wk52_high, pre_market_open, pre_market_high, pre_market_low, pre_market_close, market_cap, sector, industry, pre_market_change, pre_market_change_pct, extended_hours_change, extended_hours_change_pct, change_1_pct, change_15_pct, change_1h_pct, change_4h_pct, change_1d_pct, change_1w_pct, change_1m_pct, change_3m_pct, change_6m_pct, change_ytd_pct, change_1y_pct, change_5y_pct, change_10y_pct, change_all_time_pct, change_from_open, change_from_open_pct, price_over_52wk_high, price_over_52wk_low, rsi, dma_200, dma_50, price_over_50dma, price_over_200dma, beta_1y_vs_spy, beta_1m_vs_spy, volume, avg_volume_1m, dollar_volume, avg_dollar_volume_1m, pre_market_volume, pre_market_dollar_volume, relative_volume_14, pre_market_vol_over_14d_vol, range_1m_pct, range_15m_pct, range_1h_pct, day_range_pct, volatility_1w_pct, volatility_1m_pct, pre_market_range_pct. The user's computed columns (see getComputedColumns) may also be used here, in filters and in orderBy. At least one column is required.",
 							Items: &genai.Schema{
 								Type: genai.TypeString,
 							},
@@ -908,6 +1370,10 @@ var (
 							Type:        genai.TypeInteger,
 							Description: "Maximum number of results to return. Must be between 1 and 10,000. Defaults to 100 if not specified.",
 						},
+						"asOf": {
+							Type:        genai.TypeString,
+							Description: "Optional. Date in YYYY-MM-DD format. Runs the screen against the daily screener snapshot taken on or before that date (what the screen would have returned then). Only a subset of columns is snapshotted and computed columns are not available.",
+						},
 						"filters": {
 							Type:        genai.TypeArray,
 							Description: "Array of filter objects to apply to the screener query. Each filter specifies a column, operator, and value.",
@@ -916,7 +1382,7 @@ var (
 								Properties: map[string]*genai.Schema{
 									"column": {
 										Type:        genai.TypeString,
-										Description: "Column name to filter on. Must be one of the available screener columns.",
+										Description: "Column name to filter on. Must be one of the available screener columns, or 'index_member' (filter only, operators '=' or 'IN', values like 'SPX', 'NDX', 'SPY', 'QQQ') to keep members of an index as of the screen date.",
 									},
 									"operator": {
 										Type:        genai.TypeString,
@@ -937,6 +1403,38 @@ var (
 			Function:      wrapWithContext(screener.GetScreenerData),
 			StatusMessage: "Screening stocks",
 		},
+		"getComputedColumns": {
+			FunctionDeclaration: &genai.FunctionDeclaration{
+				Name:        "getComputedColumns",
+				Description: "List the user's computed screener columns (custom formulas over built-in columns such as \"(high - low) / close\"). Their names can be used in runScreener return columns, filters and ordering.",
+				Parameters: &genai.Schema{
+					Type:       genai.TypeObject,
+					Properties: map[string]*genai.Schema{},
+					Required:   []string{},
+				},
+			},
+			Function:         wrapWithContext(screener.GetComputedColumns),
+			StatusMessage:    "Fetching computed screener columns",
+			UserSpecificTool: true,
+		},
+		"createComputedColumn": {
+			FunctionDeclaration: &genai.FunctionDeclaration{
+				Name:        "createComputedColumn",
+				Description: "Create (or replace) a computed screener column defined as a formula over numeric screener columns. Supports + - * /, parentheses, numbers and the functions abs, sqrt, least and greatest.",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"name":    {Type: genai.TypeString, Description: "Column name: lowercase letters, digits and underscores, starting with a letter."},
+						"formula": {Type: genai.TypeString, Description: "Formula over numeric screener columns, e.g. \"(high - low) / close\"."},
+					},
+					Required: []string{"name", "formula"},
+				},
+			},
+			Function:         wrapWithContext(screener.CreateComputedColumn),
+			StatusMessage:    "Creating computed screener column",
+			UserSpecificTool: true,
+			Scope:            ScopeManageWorkspace,
+		},
 		"getFredSeries": {
 			FunctionDeclaration: &genai.FunctionDeclaration{
 				Name:        "getFredSeries",
@@ -1004,5 +1502,41 @@ var (
 			StatusMessage:    "Converting dates to timestamps",
 			UserSpecificTool: false,
 		},
+		// [MEMORY]
+		"recallConversation": {
+			FunctionDeclaration: &genai.FunctionDeclaration{
+				Name:        "recallConversation",
+				Description: "Search the user's past conversations with you and return the best matching threads, each with its matching messages (question and the text of your answer) and its last message. Use when the user refers to an earlier discussion, e.g. \"what did we conclude about NVDA last month?\". Summarize what the threads concluded rather than repeating them, and cite the messageId of every message the summary relies on, e.g. [message 4f1c…]. Say so when nothing matches instead of guessing.",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"query": {
+							Type:        genai.TypeString,
+							Description: "Words to search for, web-search style: tickers, topics, strategy names. Quote phrases; prefix a word with - to exclude it.",
+						},
+						"since": {
+							Type:        genai.TypeString,
+							Description: "Optional. Only messages on or after this YYYY-MM-DD date, e.g. the start of \"last month\".",
+						},
+						"until": {
+							Type:        genai.TypeString,
+							Description: "Optional. Only messages on or before this YYYY-MM-DD date.",
+						},
+						"conversationId": {
+							Type:        genai.TypeString,
+							Description: "Optional. Recall the latest messages of this thread instead of searching, e.g. to read more of a thread an earlier recall returned.",
+						},
+						"maxThreads": {
+							Type:        genai.TypeInteger,
+							Description: "Optional. Threads to return, 1-5. Defaults to 3.",
+						},
+					},
+					Required: []string{"query"},
+				},
+			},
+			Function:         RecallConversation,
+			StatusMessage:    "Recalling past conversations",
+			UserSpecificTool: true,
+		},
 	}
 )
@@ -0,0 +1,224 @@
+package agent
+
+import (
+	"backend/internal/breaker"
+	"backend/internal/data"
+	"backend/internal/services/flags"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/openai/openai-go"
+)
+
+// Agent traces record the raw model inputs/outputs and tool results behind a
+// message so it can be replayed offline without calling the model or any
+// live tool. Recording is off unless AGENT_RECORD_TRACES is set.
+const (
+	TraceKindPlan  = "plan"
+	TraceKindFinal = "final"
+	TraceKindTool  = "tool"
+)
+
+const traceRecorderKey contextKey = "agentTraceRecorder"
+
+// TraceEvent is one model call or tool result, in the order it completed
+type TraceEvent struct {
+	Seq        int       `json:"seq"`
+	Kind       string    `json:"kind"`
+	At         time.Time `json:"at"`
+	DurationMs int64     `json:"durationMs"`
+	Model      string    `json:"model,omitempty"`
+	// Instructions keys into AgentTrace.Instructions
+	Instructions string          `json:"instructions,omitempty"`
+	Input        json.RawMessage `json:"input,omitempty"`
+	Output       string          `json:"output,omitempty"`
+	Usage        *TokenCounts    `json:"usage,omitempty"`
+	FunctionID   int64           `json:"fnId,omitempty"`
+	Tool         string          `json:"tool,omitempty"`
+	Args         json.RawMessage `json:"args,omitempty"`
+	Result       json.RawMessage `json:"result,omitempty"`
+	Error        string          `json:"error,omitempty"`
+}
+
+// AgentTrace is everything recorded for one message
+type AgentTrace struct {
+	MessageID          string            `json:"messageId"`
+	ConversationID     string            `json:"conversationId"`
+	UserID             int               `json:"userId"`
+	Query              string            `json:"query"`
+	IncludeSuggestions bool              `json:"includeSuggestions"`
+	Instructions       map[string]string `json:"instructions,omitempty"` // system prompts by content hash, stored once
+	PromptVersions     map[string]string `json:"promptVersions,omitempty"`
+	Events             []TraceEvent      `json:"events"`
+	CreatedAt          time.Time         `json:"createdAt"`
+}
+
+type traceRecorder struct {
+	mu    sync.Mutex
+	trace AgentTrace
+}
+
+// traceRecordingEnabled reports whether traces should be recorded for a user:
+// for everyone with AGENT_RECORD_TRACES, otherwise per the agent_record_traces flag
+func traceRecordingEnabled(ctx context.Context, userID int) bool {
+	switch strings.ToLower(os.Getenv("AGENT_RECORD_TRACES")) {
+	case "1", "true", "yes":
+		return true
+	}
+	return flags.IsEnabled(ctx, flags.AgentRecordTraces, userID)
+}
+
+// withTraceRecorder starts a trace for a message if recording is enabled
+func withTraceRecorder(ctx context.Context, userID int, conversationID, messageID, query string, includeSuggestions bool) (context.Context, *traceRecorder) {
+	if !traceRecordingEnabled(ctx, userID) {
+		return ctx, nil
+	}
+	rec := &traceRecorder{trace: AgentTrace{
+		MessageID:          messageID,
+		ConversationID:     conversationID,
+		UserID:             userID,
+		Query:              query,
+		IncludeSuggestions: includeSuggestions,
+		Instructions:       make(map[string]string),
+		PromptVersions:     promptVersionsFor(ctx),
+		CreatedAt:          time.Now(),
+	}}
+	return context.WithValue(ctx, traceRecorderKey, rec), rec
+}
+
+func traceRecorderFrom(ctx context.Context) *traceRecorder {
+	if ctx == nil {
+		return nil
+	}
+	rec, _ := ctx.Value(traceRecorderKey).(*traceRecorder)
+	return rec
+}
+
+func (r *traceRecorder) add(e TraceEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.Seq = len(r.trace.Events) + 1
+	r.trace.Events = append(r.trace.Events, e)
+}
+
+// recordLLMCall records a planner or final response model call
+func recordLLMCall(ctx context.Context, kind, model, instructions string, input interface{}, output string, usage *TokenCounts, started time.Time, callErr error) {
+	// Every model call passes through here, so it also feeds the LLM breaker
+	breaker.LLM.Record(llmOutage(callErr))
+	rec := traceRecorderFrom(ctx)
+	if rec == nil {
+		return
+	}
+	inputJSON, _ := json.Marshal(input)
+	sum := sha256.Sum256([]byte(instructions))
+	ref := hex.EncodeToString(sum[:6])
+	e := TraceEvent{
+		Kind:         kind,
+		At:           started,
+		DurationMs:   time.Since(started).Milliseconds(),
+		Model:        model,
+		Instructions: ref,
+		Input:        inputJSON,
+		Output:       output,
+		Usage:        usage,
+	}
+	if callErr != nil {
+		e.Error = callErr.Error()
+	}
+	rec.mu.Lock()
+	rec.trace.Instructions[ref] = instructions
+	rec.mu.Unlock()
+	rec.add(e)
+}
+
+// recordToolCall records the result of one executed tool call
+func recordToolCall(ctx context.Context, r ExecuteResult) {
+	rec := traceRecorderFrom(ctx)
+	if rec == nil {
+		return
+	}
+	args, _ := json.Marshal(r.Args)
+	result, _ := json.Marshal(r.Result)
+	e := TraceEvent{
+		Kind:       TraceKindTool,
+		At:         r.ExecutedAt,
+		DurationMs: r.DurationMs,
+		FunctionID: r.FunctionID,
+		Tool:       r.FunctionName,
+		Args:       args,
+		Result:     result,
+	}
+	if r.Error != nil {
+		e.Error = *r.Error
+	}
+	rec.add(e)
+}
+
+// llmOutage returns err if it means the provider is failing rather than
+// rejecting this particular request
+func llmOutage(err error) error {
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode < 500 && apiErr.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// save stores the trace; it runs after the request so it uses its own context
+func (r *traceRecorder) save(conn *data.Conn) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	t := r.trace
+	r.mu.Unlock()
+	if len(t.Events) == 0 {
+		return
+	}
+	traceJSON, err := json.Marshal(t)
+	if err != nil {
+		log.Printf("⚠️ Error encoding agent trace for message %s: %v", t.MessageID, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = conn.DB.Exec(ctx, `
+		INSERT INTO agent_traces (message_id, user_id, trace)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (message_id) DO UPDATE SET trace = EXCLUDED.trace, created_at = NOW()`,
+		t.MessageID, t.UserID, traceJSON)
+	if err != nil {
+		log.Printf("⚠️ Error saving agent trace for message %s: %v", t.MessageID, err)
+	}
+}
+
+// LoadAgentTrace returns the recorded trace of a message
+func LoadAgentTrace(ctx context.Context, conn *data.Conn, messageID string) (*AgentTrace, error) {
+	var raw []byte
+	err := conn.DB.QueryRow(ctx, `SELECT trace FROM agent_traces WHERE message_id::text = $1`, messageID).Scan(&raw)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("no trace recorded for message %s", messageID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading agent trace: %v", err)
+	}
+	var t AgentTrace
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return nil, fmt.Errorf("error decoding agent trace: %v", err)
+	}
+	return &t, nil
+}
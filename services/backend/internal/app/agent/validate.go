@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"backend/internal/apperr"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// Tool declarations are the definitions of tool arguments; validateArgs
+// checks a call against them before the handler runs, so a malformed call
+// fails with a validation error naming the field instead of whatever the
+// handler's json.Unmarshal or query makes of it. Properties the declaration
+// does not mention are allowed.
+
+// ValidateToolArgs checks raw arguments against the declaration of the named
+// tool. Unknown tools and tools without parameters are not checked.
+func ValidateToolArgs(name string, raw json.RawMessage) error {
+	return validateArgs(ToolArgs(name), raw)
+}
+
+func validateArgs(schema *genai.Schema, raw json.RawMessage) error {
+	if schema == nil {
+		return nil
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		raw = json.RawMessage("{}")
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return apperr.InvalidArgs(err)
+	}
+	if value == nil && schema.Type == genai.TypeObject {
+		value = map[string]interface{}{}
+	}
+	var problems []string
+	validateValue(schema, value, "", &problems)
+	if len(problems) == 0 {
+		return nil
+	}
+	return apperr.Validation("invalid args: %s", strings.Join(problems, "; "))
+}
+
+func validateValue(schema *genai.Schema, value interface{}, path string, problems *[]string) {
+	if schema == nil {
+		return
+	}
+	field := path
+	if field == "" {
+		field = "arguments"
+	}
+	fail := func(format string, args ...interface{}) {
+		*problems = append(*problems, field+" "+fmt.Sprintf(format, args...))
+	}
+	if value == nil {
+		if path != "" && (schema.Nullable == nil || !*schema.Nullable) {
+			fail("must not be null")
+		}
+		return
+	}
+	if len(schema.AnyOf) > 0 {
+		for _, option := range schema.AnyOf {
+			var sub []string
+			validateValue(option, value, path, &sub)
+			if len(sub) == 0 {
+				return
+			}
+		}
+		fail("matches none of the allowed forms")
+		return
+	}
+
+	switch schema.Type {
+	case genai.TypeObject:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			fail("must be an object")
+			return
+		}
+		for _, name := range schema.Required {
+			if v, present := obj[name]; !present || v == nil {
+				*problems = append(*problems, joinPath(path, name)+" is required")
+			}
+		}
+		names := make([]string, 0, len(schema.Properties))
+		for name := range schema.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if v, present := obj[name]; present && v != nil {
+				validateValue(schema.Properties[name], v, joinPath(path, name), problems)
+			}
+		}
+	case genai.TypeArray:
+		arr, ok := value.([]interface{})
+		if !ok {
+			fail("must be an array")
+			return
+		}
+		if schema.MinItems != nil && int64(len(arr)) < *schema.MinItems {
+			fail("must have at least %d items", *schema.MinItems)
+		}
+		if schema.MaxItems != nil && int64(len(arr)) > *schema.MaxItems {
+			fail("must have at most %d items", *schema.MaxItems)
+		}
+		for i, item := range arr {
+			validateValue(schema.Items, item, fmt.Sprintf("%s[%d]", field, i), problems)
+		}
+	case genai.TypeString:
+		s, ok := value.(string)
+		if !ok {
+			fail("must be a string")
+			return
+		}
+		if len(schema.Enum) > 0 && !containsString(schema.Enum, s) {
+			fail("must be one of %s", strings.Join(schema.Enum, ", "))
+		}
+		if schema.MinLength != nil && int64(len(s)) < *schema.MinLength {
+			fail("must be at least %d characters", *schema.MinLength)
+		}
+		if schema.MaxLength != nil && int64(len(s)) > *schema.MaxLength {
+			fail("must be at most %d characters", *schema.MaxLength)
+		}
+		if schema.Pattern != "" {
+			if re, err := regexp.Compile(schema.Pattern); err == nil && !re.MatchString(s) {
+				fail("has an invalid format")
+			}
+		}
+	case genai.TypeInteger, genai.TypeNumber:
+		n, ok := value.(json.Number)
+		if !ok {
+			fail("must be a number")
+			return
+		}
+		f, err := n.Float64()
+		if err != nil {
+			fail("must be a number")
+			return
+		}
+		if schema.Type == genai.TypeInteger && f != math.Trunc(f) {
+			fail("must be an integer")
+		}
+		if schema.Minimum != nil && f < *schema.Minimum {
+			fail("must be at least %v", *schema.Minimum)
+		}
+		if schema.Maximum != nil && f > *schema.Maximum {
+			fail("must be at most %v", *schema.Maximum)
+		}
+	case genai.TypeBoolean:
+		if _, ok := value.(bool); !ok {
+			fail("must be a boolean")
+		}
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,16 +1,23 @@
+// Package alerts is the API for price and strategy alerts. Alert is only the
+// wire shape; evaluation, throttling and the in-memory PriceAlert and
+// StrategyAlert types belong to services/alerts, which handlers hand a saved
+// row to through LoadPriceAlert rather than building its types themselves.
 package alerts
 
 import (
 	"backend/internal/app/limits"
+	"backend/internal/apperr"
 	"backend/internal/data"
-	"backend/internal/data/polygon"
 	"backend/internal/services/alerts"
+	"backend/internal/services/lastprice"
+	"backend/internal/services/marketdata"
 	"backend/internal/services/socket"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
+	"time"
 )
 
 /*
@@ -30,6 +37,8 @@ type Alert struct {
 	Active             bool     `json:"active"`
 	Direction          *bool    `json:"direction,omitempty"`          // true = above, false = below
 	TriggeredTimestamp *int64   `json:"triggeredTimestamp,omitempty"` // ms since epoch, nil until fired
+	VWAPAnchor         *int64   `json:"vwapAnchor,omitempty"`         // ms since epoch; set for anchored VWAP cross alerts
+	DrawingID          *int     `json:"drawingId,omitempty"`          // set for trendline cross alerts
 }
 
 // GetAlertLogsResult now derives directly from the alerts table.  When an alert
@@ -44,6 +53,7 @@ type GetAlertLogsResult struct {
 	Ticker       *string  `json:"ticker,omitempty"`
 	AlertPrice   *float64 `json:"alertPrice,omitempty"`
 	StrategyName *string  `json:"strategyName,omitempty"`
+	Useful       *bool    `json:"useful,omitempty"` // the user's "was this alert useful?" answer
 }
 
 /*
@@ -63,7 +73,9 @@ func GetAlerts(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{
 			       a.securityId,
 			       s.ticker,
 			       a.active,
-			       a.direction
+			       a.direction,
+			       (EXTRACT(EPOCH FROM a.vwap_anchor) * 1000)::bigint,
+			       a.drawing_id
 			FROM alerts a
 			LEFT JOIN securities s USING (securityId)
 			WHERE a.userId = $1
@@ -76,7 +88,7 @@ func GetAlerts(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{
 	for priceRows.Next() {
 		var r Alert
 		if err := priceRows.Scan(&r.AlertID, &r.AlertType, &r.Price, &r.SecurityID,
-			&r.Ticker, &r.Active, &r.Direction); err != nil {
+			&r.Ticker, &r.Active, &r.Direction, &r.VWAPAnchor, &r.DrawingID); err != nil {
 			return nil, fmt.Errorf("scanning price alert: %w", err)
 		}
 		results = append(results, r)
@@ -136,11 +148,13 @@ func GetAlertLogs(conn *data.Conn, userID int, rawArgs json.RawMessage) (interfa
 				CASE 
 					WHEN al.alert_type = 'strategy' THEN st.name
 					ELSE NULL
-				END AS strategyName
+				END AS strategyName,
+				af.useful
 			FROM alert_logs al
 			LEFT JOIN alerts a ON al.alert_type = 'price' AND a.alertId = al.related_id
 			LEFT JOIN securities s ON a.securityId = s.securityId
 			LEFT JOIN strategies st ON al.alert_type = 'strategy' AND st.strategyId = al.related_id
+			LEFT JOIN alert_feedback af ON af.log_id = al.log_id AND af.user_id = al.user_id
 			WHERE al.user_id = $1 AND al.alert_type = $2
 			ORDER BY al.timestamp DESC
 		`
@@ -166,11 +180,13 @@ func GetAlertLogs(conn *data.Conn, userID int, rawArgs json.RawMessage) (interfa
 				CASE 
 					WHEN al.alert_type = 'strategy' THEN st.name
 					ELSE NULL
-				END AS strategyName
+				END AS strategyName,
+				af.useful
 			FROM alert_logs al
 			LEFT JOIN alerts a ON al.alert_type = 'price' AND a.alertId = al.related_id
 			LEFT JOIN securities s ON a.securityId = s.securityId
 			LEFT JOIN strategies st ON al.alert_type = 'strategy' AND st.strategyId = al.related_id
+			LEFT JOIN alert_feedback af ON af.log_id = al.log_id AND af.user_id = al.user_id
 			WHERE al.user_id = $1
 			ORDER BY al.timestamp DESC
 		`
@@ -199,6 +215,7 @@ func GetAlertLogs(conn *data.Conn, userID int, rawArgs json.RawMessage) (interfa
 			&ticker,
 			&alertPrice,
 			&strategyName,
+			&result.Useful,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("scanning alert log row: %w", err)
@@ -231,12 +248,20 @@ func GetAlertLogs(conn *data.Conn, userID int, rawArgs json.RawMessage) (interfa
    ────────────────────────────────────────────────────────────────────────────────
 */
 
+// alertDirectionMaxAge is how old a cached price can be when deciding whether
+// an alert waits for the price to rise or fall to its level
+const alertDirectionMaxAge = 5 * time.Second
+
 type NewAlertArgs struct {
 	// AlertType kept for backward compatibility but ignored (always "price").
 	AlertType  string   `json:"alertType,omitempty"`
 	Price      *float64 `json:"price,omitempty"`
 	SecurityID *int     `json:"securityId,omitempty"`
 	Ticker     *string  `json:"ticker,omitempty"`
+	// VWAPAnchor (ms) makes this an anchored VWAP cross alert; Price is then ignored
+	VWAPAnchor *int64 `json:"vwapAnchor,omitempty"`
+	// DrawingID of a trendline makes this a trendline cross alert; Price is then ignored
+	DrawingID *int `json:"drawingId,omitempty"`
 }
 
 func AgentNewAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
@@ -265,6 +290,12 @@ func AgentNewAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (interf
 		if newAlert.Direction != nil {
 			alertData["direction"] = *newAlert.Direction
 		}
+		if newAlert.VWAPAnchor != nil {
+			alertData["vwapAnchor"] = *newAlert.VWAPAnchor
+		}
+		if newAlert.DrawingID != nil {
+			alertData["drawingId"] = *newAlert.DrawingID
+		}
 
 		socket.SendAlertUpdate(userID, "add", alertData)
 	}()
@@ -274,10 +305,38 @@ func AgentNewAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (interf
 func NewAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
 	var args NewAlertArgs
 	if err := json.Unmarshal(rawArgs, &args); err != nil {
-		return nil, fmt.Errorf("invalid args: %w", err)
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.SecurityID == nil || args.Ticker == nil {
+		return nil, apperr.Validation("securityId and ticker are required")
+	}
+	var vwapAnchor *time.Time
+	if args.VWAPAnchor != nil {
+		anchor := time.UnixMilli(*args.VWAPAnchor)
+		if !anchor.Before(time.Now()) {
+			return nil, apperr.Validation("vwapAnchor must be in the past")
+		}
+		vwapAnchor = &anchor
+	}
+	var trendline *alerts.Trendline
+	if args.DrawingID != nil {
+		var points []byte
+		err := conn.DB.QueryRow(context.Background(), `
+			SELECT points FROM chart_drawings
+			WHERE id = $1 AND user_id = $2 AND security_id = $3 AND drawing_type = 'trendline'`,
+			*args.DrawingID, userID, *args.SecurityID).Scan(&points)
+		if err != nil {
+			return nil, apperr.NotFound("trendline %d not found for this security", *args.DrawingID)
+		}
+		if trendline, err = alerts.ParseTrendline(*args.DrawingID, points); err != nil {
+			return nil, apperr.Wrap(apperr.CodeValidation, err, "trendline %d cannot be alerted on", *args.DrawingID)
+		}
 	}
-	if args.Price == nil || args.SecurityID == nil || args.Ticker == nil {
-		return nil, fmt.Errorf("price, securityId and ticker are required")
+	if vwapAnchor != nil && trendline != nil {
+		return nil, apperr.Validation("vwapAnchor and drawingId cannot be combined")
+	}
+	if vwapAnchor == nil && trendline == nil && args.Price == nil {
+		return nil, apperr.Validation("price is required")
 	}
 
 	// Check if user can create more alerts
@@ -286,22 +345,34 @@ func NewAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}
 		return nil, fmt.Errorf("checking alert limits: %w", err)
 	}
 	if !allowed {
-		return nil, fmt.Errorf("alert limit reached - you have %d alerts remaining", remaining)
+		return nil, apperr.LimitExceeded("alert limit reached - you have %d alerts remaining", remaining)
 	}
 
 	// Determine direction relative to the last trade
-	lastTrade, err := polygon.GetLastTrade(conn.Polygon, *args.Ticker, true)
+	lastTrade, err := lastprice.Lookup(context.Background(), conn, *args.Ticker, alertDirectionMaxAge)
 	if err != nil {
 		return nil, fmt.Errorf("fetching last trade: %w", err)
 	}
+	if vwapAnchor != nil {
+		// The stored price is the VWAP at creation; the live level is recomputed by the alert loop
+		vwap, err := marketdata.AnchoredVWAP(context.Background(), conn, *args.Ticker, *vwapAnchor, time.Now(), false)
+		if err != nil {
+			return nil, fmt.Errorf("computing anchored vwap: %w", err)
+		}
+		args.Price = &vwap.VWAP
+	} else if trendline != nil {
+		// The stored price is the line's level at creation; the alert loop keeps projecting it
+		level := trendline.ProjectedPrice(time.Now())
+		args.Price = &level
+	}
 	dir := *args.Price > lastTrade.Price // true = wait for price to rise up to alert
 
 	var alertID int
 	if err := conn.DB.QueryRow(context.Background(), `
-		INSERT INTO alerts (userId, active, price, direction, securityId)
-		VALUES ($1, true, $2, $3, $4)
+		INSERT INTO alerts (userId, active, price, direction, securityId, vwap_anchor, drawing_id)
+		VALUES ($1, true, $2, $3, $4, $5, $6)
 		RETURNING alertId`,
-		userID, *args.Price, dir, *args.SecurityID).Scan(&alertID); err != nil {
+		userID, *args.Price, dir, *args.SecurityID, vwapAnchor, args.DrawingID).Scan(&alertID); err != nil {
 		return nil, fmt.Errorf("inserting alert: %w", err)
 	}
 
@@ -325,16 +396,13 @@ func NewAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}
 		Ticker:     args.Ticker,
 		Active:     true,
 		Direction:  &dir,
+		VWAPAnchor: args.VWAPAnchor,
+		DrawingID:  args.DrawingID,
 	}
 	// Keep in-memory scheduler/store up-to-date
-	alerts.AddPriceAlert(conn, alerts.PriceAlert{
-		AlertID:    newAlert.AlertID,
-		UserID:     userID,
-		Price:      newAlert.Price,
-		SecurityID: newAlert.SecurityID,
-		Direction:  newAlert.Direction,
-		Ticker:     newAlert.Ticker,
-	})
+	if err := alerts.LoadPriceAlert(conn, alertID); err != nil {
+		log.Printf("Warning: failed to load new alert %d into the alert loop: %v", alertID, err)
+	}
 	return newAlert, nil
 }
 
@@ -385,17 +453,18 @@ func AgentUpdateAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (int
 func UpdateAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
 	var args UpdateAlertArgs
 	if err := json.Unmarshal(rawArgs, &args); err != nil {
-		return nil, fmt.Errorf("invalid args: %w", err)
+		return nil, apperr.InvalidArgs(err)
 	}
 	if args.Price == nil {
-		return nil, fmt.Errorf("price is required")
+		return nil, apperr.Validation("price is required")
 	}
 
 	// First, get the current alert to verify ownership and get the ticker/securityId
 	var currentAlert Alert
 	var ticker string
 	err := conn.DB.QueryRow(context.Background(), `
-		SELECT a.alertId, a.price, a.direction, a.securityId, a.active, s.ticker
+		SELECT a.alertId, a.price, a.direction, a.securityId, a.active, s.ticker,
+		       (EXTRACT(EPOCH FROM a.vwap_anchor) * 1000)::bigint, a.drawing_id
 		FROM alerts a
 		LEFT JOIN securities s USING (securityId)
 		WHERE a.alertId = $1 AND a.userId = $2`,
@@ -405,17 +474,26 @@ func UpdateAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (interfac
 		&currentAlert.Direction,
 		&currentAlert.SecurityID,
 		&currentAlert.Active,
-		&ticker)
+		&ticker,
+		&currentAlert.VWAPAnchor,
+		&currentAlert.DrawingID)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("alert not found or permission denied")
+			return nil, apperr.NotFound("alert not found or permission denied")
 		}
 		return nil, fmt.Errorf("fetching alert: %w", err)
 	}
 
+	if currentAlert.VWAPAnchor != nil {
+		return nil, apperr.Validation("anchored VWAP alerts track the VWAP and cannot be moved to a fixed price")
+	}
+	if currentAlert.DrawingID != nil {
+		return nil, apperr.Validation("trendline alerts follow their trendline; edit the drawing to move the alert")
+	}
+
 	// Determine new direction relative to the last trade
-	lastTrade, err := polygon.GetLastTrade(conn.Polygon, ticker, true)
+	lastTrade, err := lastprice.Lookup(context.Background(), conn, ticker, alertDirectionMaxAge)
 	if err != nil {
 		return nil, fmt.Errorf("fetching last trade: %w", err)
 	}
@@ -442,14 +520,9 @@ func UpdateAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (interfac
 	}
 
 	// Update the in-memory scheduler/store
-	alerts.AddPriceAlert(conn, alerts.PriceAlert{
-		AlertID:    updatedAlert.AlertID,
-		UserID:     userID,
-		Price:      updatedAlert.Price,
-		SecurityID: updatedAlert.SecurityID,
-		Direction:  updatedAlert.Direction,
-		Ticker:     updatedAlert.Ticker,
-	})
+	if err := alerts.LoadPriceAlert(conn, args.AlertID); err != nil {
+		log.Printf("Warning: failed to reload alert %d into the alert loop: %v", args.AlertID, err)
+	}
 
 	return updatedAlert, nil
 }
@@ -480,7 +553,7 @@ func AgentDeleteAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (int
 func DeleteAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
 	var args DeleteAlertArgs
 	if err := json.Unmarshal(rawArgs, &args); err != nil {
-		return nil, fmt.Errorf("invalid args: %w", err)
+		return nil, apperr.InvalidArgs(err)
 	}
 
 	// Check if the alert was active before deleting
@@ -490,7 +563,7 @@ func DeleteAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (interfac
 		args.AlertID, userID).Scan(&wasActive)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("alert not found or permission denied")
+			return nil, apperr.NotFound("alert not found or permission denied")
 		}
 		return nil, fmt.Errorf("checking alert status: %w", err)
 	}
@@ -502,7 +575,7 @@ func DeleteAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (interfac
 		return nil, fmt.Errorf("deleting alert: %w", err)
 	}
 	if tag.RowsAffected() == 0 {
-		return nil, fmt.Errorf("alert not found or permission denied")
+		return nil, apperr.NotFound("alert not found or permission denied")
 	}
 
 	// Only decrement the counter if the alert was active
@@ -0,0 +1,240 @@
+package alerts
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/services/lastprice"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Chart alerts are price alerts placed by clicking a level on a chart and
+// moved by dragging their line. Both calls answer with a preview of the level
+// against the last trade, so the chart can label the line as it's placed and
+// after every drag. Moving an alert to the price it already has changes
+// nothing, so a drag that ends where it started or a retried update is safe.
+const (
+	// daily closes the volatility of a preview is estimated from
+	previewVolatilityDays = 20
+	// fewer daily returns than this give no volatility or likelihood
+	previewMinReturns = 5
+)
+
+// previewHorizons are the trading days the trigger likelihood is given for
+var previewHorizons = []int{1, 5, 20}
+
+// AlertPreview describes an alert level against the market
+type AlertPreview struct {
+	LastPrice   float64 `json:"lastPrice"`
+	DistancePct float64 `json:"distancePct"` // signed, from the last price to the level
+	Direction   string  `json:"direction"`   // "above" or "below" the last price
+	// DailyVolatilityPct is the standard deviation of recent daily returns;
+	// nil without enough history, and then there is no likelihood either
+	DailyVolatilityPct *float64            `json:"dailyVolatilityPct,omitempty"`
+	TriggerLikelihood  []TriggerLikelihood `json:"triggerLikelihood,omitempty"`
+}
+
+// TriggerLikelihood is the estimated chance of the price touching the level
+// within a number of trading days, assuming a driftless random walk with the
+// recent volatility
+type TriggerLikelihood struct {
+	Days        int     `json:"days"`
+	Probability float64 `json:"probability"`
+}
+
+// ChartAlert is a created or moved alert with its preview
+type ChartAlert struct {
+	Alert   Alert        `json:"alert"`
+	Preview AlertPreview `json:"preview"`
+}
+
+type CreateChartAlertArgs struct {
+	SecurityID int     `json:"securityId"`
+	Price      float64 `json:"price"`
+}
+
+// CreateChartAlert creates a price alert at the level clicked on a chart and
+// returns it with its preview
+func CreateChartAlert(ctx context.Context, conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args CreateChartAlertArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.SecurityID <= 0 {
+		return nil, apperr.Validation("securityId is required")
+	}
+	if args.Price <= 0 {
+		return nil, apperr.Validation("price must be positive")
+	}
+
+	var ticker string
+	err := conn.DB.QueryRow(ctx, `
+		SELECT ticker FROM securities WHERE securityid = $1 ORDER BY maxdate DESC NULLS FIRST LIMIT 1`,
+		args.SecurityID).Scan(&ticker)
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("security %d not found", args.SecurityID)
+	} else if err != nil {
+		return nil, fmt.Errorf("error looking up security: %v", err)
+	}
+
+	newArgs, err := json.Marshal(NewAlertArgs{SecurityID: &args.SecurityID, Ticker: &ticker, Price: &args.Price})
+	if err != nil {
+		return nil, err
+	}
+	res, err := NewAlert(conn, userID, newArgs)
+	if err != nil {
+		return nil, err
+	}
+	alert := res.(Alert)
+	preview, err := previewAlert(ctx, conn, ticker, args.Price)
+	if err != nil {
+		return nil, err
+	}
+	return ChartAlert{Alert: alert, Preview: *preview}, nil
+}
+
+type UpdateChartAlertArgs struct {
+	AlertID int     `json:"alertId"`
+	Price   float64 `json:"price"`
+}
+
+// UpdateChartAlert moves an alert to the level its line was dragged to and
+// returns it with its new preview. The alert keeps its direction when the
+// price doesn't change.
+func UpdateChartAlert(ctx context.Context, conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args UpdateChartAlertArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.Price <= 0 {
+		return nil, apperr.Validation("price must be positive")
+	}
+
+	var alert Alert
+	var ticker string
+	err := conn.DB.QueryRow(ctx, `
+		SELECT a.alertId, a.price, a.direction, a.securityId, a.active, s.ticker,
+		       (EXTRACT(EPOCH FROM a.vwap_anchor) * 1000)::bigint, a.drawing_id
+		FROM alerts a
+		LEFT JOIN securities s USING (securityId)
+		WHERE a.alertId = $1 AND a.userId = $2`,
+		args.AlertID, userID).Scan(&alert.AlertID, &alert.Price, &alert.Direction, &alert.SecurityID,
+		&alert.Active, &ticker, &alert.VWAPAnchor, &alert.DrawingID)
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("alert not found or permission denied")
+	} else if err != nil {
+		return nil, fmt.Errorf("fetching alert: %w", err)
+	}
+	alert.AlertType = "price"
+	alert.Ticker = &ticker
+
+	// Re-deciding the direction for an unchanged level could flip it once the
+	// price has moved past the level, so a repeat is answered as is
+	if alert.Price == nil || *alert.Price != args.Price {
+		updateArgs, err := json.Marshal(UpdateAlertArgs{AlertID: args.AlertID, Price: &args.Price})
+		if err != nil {
+			return nil, err
+		}
+		res, err := UpdateAlert(conn, userID, updateArgs)
+		if err != nil {
+			return nil, err
+		}
+		alert = res.(Alert)
+	}
+	preview, err := previewAlert(ctx, conn, ticker, args.Price)
+	if err != nil {
+		return nil, err
+	}
+	return ChartAlert{Alert: alert, Preview: *preview}, nil
+}
+
+// previewAlert compares a level with the last trade and the recent daily
+// volatility of ticker
+func previewAlert(ctx context.Context, conn *data.Conn, ticker string, level float64) (*AlertPreview, error) {
+	last, err := lastprice.Lookup(ctx, conn, ticker, alertDirectionMaxAge)
+	if err != nil {
+		return nil, fmt.Errorf("fetching last trade: %w", err)
+	}
+	if last.Price <= 0 {
+		return nil, fmt.Errorf("no last trade for %s", ticker)
+	}
+	p := &AlertPreview{
+		LastPrice:   last.Price,
+		DistancePct: roundTo((level/last.Price-1)*100, 2),
+		Direction:   "below",
+	}
+	if level > last.Price {
+		p.Direction = "above"
+	}
+
+	vol, err := dailyVolatility(ctx, conn, ticker)
+	if err != nil {
+		return nil, err
+	}
+	if vol == nil {
+		return p, nil
+	}
+	volPct := roundTo(*vol*100, 2)
+	p.DailyVolatilityPct = &volPct
+	// Chance that a driftless random walk touches the level within the
+	// horizon: twice the chance of ending beyond it
+	dist := math.Abs(math.Log(level / last.Price))
+	for _, days := range previewHorizons {
+		prob := 1.0
+		if sd := *vol * math.Sqrt(float64(days)); sd > 0 {
+			prob = math.Erfc(dist / sd / math.Sqrt2)
+		}
+		p.TriggerLikelihood = append(p.TriggerLikelihood, TriggerLikelihood{Days: days, Probability: roundTo(math.Min(prob, 1), 3)})
+	}
+	return p, nil
+}
+
+// dailyVolatility is the standard deviation of ticker's recent daily log
+// returns, or nil without enough history
+func dailyVolatility(ctx context.Context, conn *data.Conn, ticker string) (*float64, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT close::float8 FROM ohlcv_1d
+		WHERE ticker = $1 AND close > 0
+		ORDER BY timestamp DESC LIMIT $2`, ticker, previewVolatilityDays+1)
+	if err != nil {
+		return nil, fmt.Errorf("error loading daily closes: %v", err)
+	}
+	defer rows.Close()
+	var closes []float64
+	for rows.Next() {
+		var c float64
+		if err := rows.Scan(&c); err != nil {
+			return nil, fmt.Errorf("error scanning daily close: %v", err)
+		}
+		closes = append(closes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error loading daily closes: %v", err)
+	}
+	if len(closes)-1 < previewMinReturns {
+		return nil, nil
+	}
+
+	returns := make([]float64, len(closes)-1)
+	mean := 0.0
+	for i := range returns {
+		returns[i] = math.Log(closes[i] / closes[i+1])
+		mean += returns[i]
+	}
+	mean /= float64(len(returns))
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	vol := math.Sqrt(variance / float64(len(returns)-1))
+	return &vol, nil
+}
+
+func roundTo(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
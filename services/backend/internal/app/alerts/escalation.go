@@ -0,0 +1,200 @@
+package alerts
+
+import (
+	"backend/internal/app/dependencies"
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/services/alerts"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+/*
+   ────────────────────────────────────────────────────────────────────────────────
+   Escalation Policies
+   ────────────────────────────────────────────────────────────────────────────────
+*/
+
+// EscalationPolicy is the user's default policy (no alertId or strategyId) or
+// the override for one price alert or strategy alert
+type EscalationPolicy struct {
+	AlertID    *int                    `json:"alertId,omitempty"`
+	StrategyID *int                    `json:"strategyId,omitempty"`
+	Steps      []alerts.EscalationStep `json:"steps"`
+	UpdatedAt  int64                   `json:"updatedAt"` // ms since epoch
+}
+
+func GetEscalationPolicies(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	rows, err := conn.DB.Query(context.Background(), `
+		SELECT alert_id, strategy_id, steps, updated_at
+		FROM alert_escalation_policies
+		WHERE user_id = $1
+		ORDER BY (alert_id IS NOT NULL OR strategy_id IS NOT NULL), policy_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("querying escalation policies: %w", err)
+	}
+	defer rows.Close()
+
+	policies := []EscalationPolicy{}
+	for rows.Next() {
+		var p EscalationPolicy
+		var steps []byte
+		var updatedAt time.Time
+		if err := rows.Scan(&p.AlertID, &p.StrategyID, &steps, &updatedAt); err != nil {
+			return nil, fmt.Errorf("scanning escalation policy: %w", err)
+		}
+		if err := json.Unmarshal(steps, &p.Steps); err != nil {
+			return nil, fmt.Errorf("parsing escalation policy: %w", err)
+		}
+		p.UpdatedAt = updatedAt.UnixMilli()
+		policies = append(policies, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating escalation policies: %w", err)
+	}
+	return policies, nil
+}
+
+// SetEscalationPolicyArgs sets the policy for an alert, a strategy, or (with
+// neither) the user's default. Empty steps turn escalation off for it.
+type SetEscalationPolicyArgs struct {
+	AlertID    *int                    `json:"alertId,omitempty"`
+	StrategyID *int                    `json:"strategyId,omitempty"`
+	Steps      []alerts.EscalationStep `json:"steps"`
+}
+
+func SetEscalationPolicy(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args SetEscalationPolicyArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.Steps == nil {
+		args.Steps = []alerts.EscalationStep{}
+	}
+	if err := alerts.ValidateEscalationSteps(args.Steps); err != nil {
+		return nil, apperr.Validation("%s", err.Error())
+	}
+	if err := checkEscalationTarget(conn, userID, args.AlertID, args.StrategyID); err != nil {
+		return nil, err
+	}
+	for _, step := range args.Steps {
+		if step.Channel != alerts.EscalationTelegram {
+			continue
+		}
+		_, err := alerts.UserTelegramChat(context.Background(), conn, userID)
+		if errors.Is(err, alerts.ErrNoTelegramChat) {
+			return nil, apperr.Validation("link a Telegram chat before adding a Telegram step")
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	steps, err := json.Marshal(args.Steps)
+	if err != nil {
+		return nil, fmt.Errorf("encoding escalation steps: %w", err)
+	}
+
+	// Each kind of policy has its own partial unique index to conflict on
+	conflict := "(user_id) WHERE alert_id IS NULL AND strategy_id IS NULL"
+	switch {
+	case args.AlertID != nil:
+		conflict = "(alert_id) WHERE alert_id IS NOT NULL"
+	case args.StrategyID != nil:
+		conflict = "(strategy_id) WHERE strategy_id IS NOT NULL"
+	}
+	var policyID int
+	var updatedAt time.Time
+	err = conn.DB.QueryRow(context.Background(), `
+		INSERT INTO alert_escalation_policies (user_id, alert_id, strategy_id, steps)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT `+conflict+`
+		DO UPDATE SET steps = EXCLUDED.steps, updated_at = NOW()
+		RETURNING policy_id, updated_at`,
+		userID, args.AlertID, args.StrategyID, string(steps)).Scan(&policyID, &updatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("saving escalation policy: %w", err)
+	}
+	if args.StrategyID != nil {
+		if err := dependencies.Set(context.Background(), conn.DB, userID, dependencies.TypeEscalationPolicy, policyID,
+			dependencies.RelationEscalation,
+			[]dependencies.Target{{Type: dependencies.TypeStrategy, ID: *args.StrategyID}}); err != nil {
+			log.Printf("⚠️ %v", err)
+		}
+	}
+	return EscalationPolicy{
+		AlertID:    args.AlertID,
+		StrategyID: args.StrategyID,
+		Steps:      args.Steps,
+		UpdatedAt:  updatedAt.UnixMilli(),
+	}, nil
+}
+
+type DeleteEscalationPolicyArgs struct {
+	AlertID    *int `json:"alertId,omitempty"`
+	StrategyID *int `json:"strategyId,omitempty"`
+}
+
+// DeleteEscalationPolicy removes a policy; an alert or strategy without one
+// falls back to the user's default
+func DeleteEscalationPolicy(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args DeleteEscalationPolicyArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.AlertID != nil && args.StrategyID != nil {
+		return nil, apperr.Validation("set either alertId or strategyId, not both")
+	}
+	var policyID int
+	err := conn.DB.QueryRow(context.Background(), `
+		DELETE FROM alert_escalation_policies
+		WHERE user_id = $1
+		  AND alert_id IS NOT DISTINCT FROM $2
+		  AND strategy_id IS NOT DISTINCT FROM $3
+		RETURNING policy_id`,
+		userID, args.AlertID, args.StrategyID).Scan(&policyID)
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("escalation policy not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("deleting escalation policy: %w", err)
+	}
+	if err := dependencies.Forget(context.Background(), conn.DB, dependencies.TypeEscalationPolicy, policyID); err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+	return nil, nil
+}
+
+// checkEscalationTarget verifies the user owns the alert or strategy a policy
+// is for
+func checkEscalationTarget(conn *data.Conn, userID int, alertID, strategyID *int) error {
+	var query string
+	var id int
+	switch {
+	case alertID != nil && strategyID != nil:
+		return apperr.Validation("set either alertId or strategyId, not both")
+	case alertID != nil:
+		query, id = `SELECT EXISTS(SELECT 1 FROM alerts WHERE alertId = $1 AND userId = $2)`, *alertID
+	case strategyID != nil:
+		query, id = `SELECT EXISTS(SELECT 1 FROM strategies WHERE strategyId = $1 AND userId = $2)`, *strategyID
+	default:
+		return nil
+	}
+	var ok bool
+	if err := conn.DB.QueryRow(context.Background(), query, id, userID).Scan(&ok); err != nil {
+		return fmt.Errorf("checking escalation target: %w", err)
+	}
+	if !ok {
+		if alertID != nil {
+			return apperr.NotFound("alert not found or permission denied")
+		}
+		return apperr.NotFound("strategy not found or permission denied")
+	}
+	return nil
+}
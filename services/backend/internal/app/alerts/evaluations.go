@@ -0,0 +1,126 @@
+package alerts
+
+import (
+	"backend/internal/app/workspaces"
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+/*
+   ────────────────────────────────────────────────────────────────────────────────
+   Strategy Alert Evaluations
+   ────────────────────────────────────────────────────────────────────────────────
+*/
+
+const (
+	defaultEvaluationLimit = 100
+	maxEvaluationLimit     = 2000
+	// evaluationWindow is how much history around a requested moment is returned
+	evaluationWindow = 15 * time.Minute
+)
+
+// EvaluationHistory is what the alert loop did with a strategy in each cycle,
+// newest first. With a requested moment, At is the entry covering it and
+// Evaluations only spans the window around it.
+type EvaluationHistory struct {
+	StrategyID  int                       `json:"strategyId"`
+	Name        string                    `json:"name"`
+	AlertActive bool                      `json:"alertActive"`
+	At          *data.StrategyEvaluation  `json:"at,omitempty"`
+	Evaluations []data.StrategyEvaluation `json:"evaluations"`
+	// Since is the oldest cycle still kept; nothing earlier can be explained
+	Since *time.Time `json:"since,omitempty"`
+}
+
+type GetStrategyAlertEvaluationsArgs struct {
+	StrategyID int    `json:"strategyId"`
+	At         *int64 `json:"at,omitempty"`    // ms; explains this moment
+	Limit      int    `json:"limit,omitempty"` // default 100
+}
+
+// GetStrategyAlertEvaluations returns the recent evaluation outcomes of one of
+// the user's strategy alerts, so they can see why it did or didn't fire
+func GetStrategyAlertEvaluations(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetStrategyAlertEvaluationsArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.StrategyID <= 0 {
+		return nil, apperr.Validation("strategyId is required")
+	}
+	var at *time.Time
+	if args.At != nil {
+		t := time.UnixMilli(*args.At)
+		at = &t
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return StrategyEvaluations(ctx, conn, userID, args.StrategyID, at, args.Limit)
+}
+
+// StrategyEvaluations loads a strategy's evaluation history, checking userID
+// owns it or can view it through a workspace unless userID is 0. limit is
+// clamped to 1..2000, 100 when 0.
+func StrategyEvaluations(ctx context.Context, conn *data.Conn, userID, strategyID int, at *time.Time, limit int) (*EvaluationHistory, error) {
+	if limit <= 0 {
+		limit = defaultEvaluationLimit
+	}
+	if limit > maxEvaluationLimit {
+		limit = maxEvaluationLimit
+	}
+
+	if userID != 0 {
+		ownerID, err := workspaces.Authorize(ctx, conn, userID, workspaces.TypeStrategy, strategyID, workspaces.RoleViewer)
+		if err != nil {
+			return nil, err
+		}
+		userID = ownerID
+	}
+
+	history := EvaluationHistory{StrategyID: strategyID}
+	err := conn.DB.QueryRow(ctx, `
+		SELECT name, COALESCE(alertactive, false) FROM strategies
+		WHERE strategyId = $1 AND ($2 = 0 OR userId = $2)`,
+		strategyID, userID).Scan(&history.Name, &history.AlertActive)
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("strategy not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading strategy: %w", err)
+	}
+
+	evals, err := data.GetStrategyEvaluations(conn, strategyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(evals) > 0 {
+		since := evals[len(evals)-1].First
+		history.Since = &since
+	}
+
+	history.Evaluations = make([]data.StrategyEvaluation, 0, limit)
+	for i := range evals {
+		e := evals[i]
+		if at != nil {
+			// An entry covers the moment if the moment falls between its first
+			// and last cycle, or before the next cycle after it
+			covers := !at.Before(e.First) && (!at.After(e.Last) || (i > 0 && at.Before(evals[i-1].First)))
+			if covers && history.At == nil {
+				history.At = &e
+			}
+			if e.Last.Before(at.Add(-evaluationWindow)) || e.First.After(at.Add(evaluationWindow)) {
+				continue
+			}
+		}
+		if len(history.Evaluations) < limit {
+			history.Evaluations = append(history.Evaluations, e)
+		}
+	}
+	return &history, nil
+}
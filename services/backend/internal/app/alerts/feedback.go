@@ -0,0 +1,165 @@
+package alerts
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+   ────────────────────────────────────────────────────────────────────────────────
+   Alert Feedback
+   ────────────────────────────────────────────────────────────────────────────────
+*/
+
+const (
+	maxFeedbackComment  = 2000
+	defaultFeedbackDays = 30
+	maxFeedbackDays     = 365
+)
+
+// RateAlertArgs answers "was this alert useful?" for a fired alert. A nil
+// useful clears the answer.
+type RateAlertArgs struct {
+	LogID   int     `json:"logId"`
+	Useful  *bool   `json:"useful"`
+	Comment *string `json:"comment,omitempty"`
+}
+
+func RateAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args RateAlertArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.LogID <= 0 {
+		return nil, apperr.Validation("logId is required")
+	}
+	var comment *string
+	if args.Comment != nil {
+		trimmed := strings.TrimSpace(*args.Comment)
+		if len(trimmed) > maxFeedbackComment {
+			return nil, apperr.Validation("comment must be at most %d characters", maxFeedbackComment)
+		}
+		if trimmed != "" {
+			comment = &trimmed
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if args.Useful == nil {
+		if _, err := conn.DB.Exec(ctx, `DELETE FROM alert_feedback WHERE log_id = $1 AND user_id = $2`,
+			args.LogID, userID); err != nil {
+			return nil, fmt.Errorf("clearing alert feedback: %w", err)
+		}
+		return map[string]interface{}{"logId": args.LogID, "useful": nil}, nil
+	}
+
+	// Inserting from the user's own log both checks ownership and stores the answer
+	tag, err := conn.DB.Exec(ctx, `
+		INSERT INTO alert_feedback (log_id, user_id, useful, comment)
+		SELECT log_id, user_id, $3, $4 FROM alert_logs WHERE log_id = $1 AND user_id = $2
+		ON CONFLICT (log_id, user_id) DO UPDATE SET
+			useful = EXCLUDED.useful,
+			comment = COALESCE(EXCLUDED.comment, alert_feedback.comment),
+			updated_at = NOW()`,
+		args.LogID, userID, *args.Useful, comment)
+	if err != nil {
+		return nil, fmt.Errorf("saving alert feedback: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, apperr.NotFound("alert log not found")
+	}
+	return map[string]interface{}{"logId": args.LogID, "useful": *args.Useful}, nil
+}
+
+// StrategyFeedback is how useful a strategy's alerts were judged over a period
+type StrategyFeedback struct {
+	StrategyID int      `json:"strategyId"`
+	Name       string   `json:"name"`
+	UserID     int      `json:"userId,omitempty"` // set in the admin view only
+	Alerts     int      `json:"alerts"`
+	Rated      int      `json:"rated"`
+	Useful     int      `json:"useful"`
+	NotUseful  int      `json:"notUseful"`
+	UsefulRate *float64 `json:"usefulRate,omitempty"` // of rated alerts; nil until one is rated
+	Comments   []string `json:"comments,omitempty"`   // latest few, newest first
+}
+
+type GetStrategyAlertFeedbackArgs struct {
+	Days int `json:"days,omitempty"` // default 30
+}
+
+// GetStrategyAlertFeedback summarises the user's feedback on each of their
+// strategies' alerts
+func GetStrategyAlertFeedback(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetStrategyAlertFeedbackArgs
+	if len(rawArgs) > 0 {
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			return nil, apperr.InvalidArgs(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := StrategyFeedbackSummary(ctx, conn, userID, args.Days)
+	if err != nil {
+		return nil, err
+	}
+	for i := range out {
+		out[i].UserID = 0
+	}
+	return out, nil
+}
+
+// StrategyFeedbackSummary aggregates alert feedback per strategy over the
+// last days (clamped to 1..365, 30 when 0), for one user or, with userID 0,
+// for everyone
+func StrategyFeedbackSummary(ctx context.Context, conn *data.Conn, userID, days int) ([]StrategyFeedback, error) {
+	if days <= 0 {
+		days = defaultFeedbackDays
+	}
+	if days > maxFeedbackDays {
+		days = maxFeedbackDays
+	}
+	rows, err := conn.DB.Query(ctx, `
+		SELECT st.strategyId, st.name, st.userId,
+		       COUNT(al.log_id),
+		       COUNT(af.id),
+		       COUNT(af.id) FILTER (WHERE af.useful),
+		       COUNT(af.id) FILTER (WHERE NOT af.useful),
+		       (ARRAY_AGG(af.comment ORDER BY af.updated_at DESC) FILTER (WHERE af.comment IS NOT NULL))[1:3]
+		FROM alert_logs al
+		JOIN strategies st ON st.strategyId = al.related_id
+		LEFT JOIN alert_feedback af ON af.log_id = al.log_id
+		WHERE al.alert_type = 'strategy'
+		  AND al.timestamp >= NOW() - make_interval(days => $1)
+		  AND ($2 = 0 OR al.user_id = $2)
+		GROUP BY st.strategyId, st.name, st.userId
+		ORDER BY COUNT(af.id) DESC, COUNT(al.log_id) DESC, st.strategyId`, days, userID)
+	if err != nil {
+		return nil, fmt.Errorf("querying strategy alert feedback: %w", err)
+	}
+	defer rows.Close()
+
+	out := []StrategyFeedback{}
+	for rows.Next() {
+		var f StrategyFeedback
+		if err := rows.Scan(&f.StrategyID, &f.Name, &f.UserID, &f.Alerts, &f.Rated,
+			&f.Useful, &f.NotUseful, &f.Comments); err != nil {
+			return nil, fmt.Errorf("scanning strategy alert feedback: %w", err)
+		}
+		if f.Rated > 0 {
+			rate := float64(f.Useful) / float64(f.Rated)
+			f.UsefulRate = &rate
+		}
+		out = append(out, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating strategy alert feedback: %w", err)
+	}
+	return out, nil
+}
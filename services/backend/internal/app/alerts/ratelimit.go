@@ -0,0 +1,110 @@
+package alerts
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/services/alerts"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+/*
+   ────────────────────────────────────────────────────────────────────────────────
+   Notification Rate Limits
+   ────────────────────────────────────────────────────────────────────────────────
+*/
+
+// NotificationRateLimit is the limit in effect on one channel; Custom is false
+// when it is the default
+type NotificationRateLimit struct {
+	alerts.NotificationRateLimit
+	Custom    bool  `json:"custom"`
+	UpdatedAt int64 `json:"updatedAt,omitempty"` // ms since epoch
+}
+
+// GetNotificationRateLimits returns the user's limit on every channel
+func GetNotificationRateLimits(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	rows, err := conn.DB.Query(context.Background(), `
+		SELECT channel, max_notifications, window_minutes, updated_at
+		FROM notification_rate_limits
+		WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("querying notification rate limits: %w", err)
+	}
+	defer rows.Close()
+
+	custom := map[string]NotificationRateLimit{}
+	for rows.Next() {
+		l := NotificationRateLimit{Custom: true}
+		var updatedAt time.Time
+		if err := rows.Scan(&l.Channel, &l.MaxNotifications, &l.WindowMinutes, &updatedAt); err != nil {
+			return nil, fmt.Errorf("scanning notification rate limit: %w", err)
+		}
+		l.UpdatedAt = updatedAt.UnixMilli()
+		custom[l.Channel] = l
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating notification rate limits: %w", err)
+	}
+
+	limits := make([]NotificationRateLimit, 0, len(alerts.NotificationChannels))
+	for _, channel := range alerts.NotificationChannels {
+		l, ok := custom[channel]
+		if !ok {
+			l = NotificationRateLimit{NotificationRateLimit: alerts.DefaultNotificationRateLimits[channel]}
+		}
+		limits = append(limits, l)
+	}
+	return limits, nil
+}
+
+// SetNotificationRateLimit sets how many alerts may go out over a channel per
+// window before the rest are collapsed into a summary. maxNotifications 0
+// turns the limit off.
+func SetNotificationRateLimit(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args alerts.NotificationRateLimit
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if err := alerts.ValidateNotificationRateLimit(args); err != nil {
+		return nil, apperr.Validation("%s", err.Error())
+	}
+	var updatedAt time.Time
+	err := conn.DB.QueryRow(context.Background(), `
+		INSERT INTO notification_rate_limits (user_id, channel, max_notifications, window_minutes)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, channel)
+		DO UPDATE SET max_notifications = EXCLUDED.max_notifications,
+		              window_minutes = EXCLUDED.window_minutes,
+		              updated_at = NOW()
+		RETURNING updated_at`,
+		userID, args.Channel, args.MaxNotifications, args.WindowMinutes).Scan(&updatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("saving notification rate limit: %w", err)
+	}
+	return NotificationRateLimit{NotificationRateLimit: args, Custom: true, UpdatedAt: updatedAt.UnixMilli()}, nil
+}
+
+type DeleteNotificationRateLimitArgs struct {
+	Channel string `json:"channel"`
+}
+
+// DeleteNotificationRateLimit puts a channel back on the default limit
+func DeleteNotificationRateLimit(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args DeleteNotificationRateLimitArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	def, ok := alerts.DefaultNotificationRateLimits[args.Channel]
+	if !ok {
+		return nil, apperr.Validation("unknown channel %q", args.Channel)
+	}
+	if _, err := conn.DB.Exec(context.Background(), `
+		DELETE FROM notification_rate_limits WHERE user_id = $1 AND channel = $2`,
+		userID, args.Channel); err != nil {
+		return nil, fmt.Errorf("deleting notification rate limit: %w", err)
+	}
+	return NotificationRateLimit{NotificationRateLimit: def}, nil
+}
@@ -0,0 +1,213 @@
+package alerts
+
+import (
+	"backend/internal/app/screener"
+	"backend/internal/app/workspaces"
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/queue"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Simulations replay an alert configuration over the last days of data on
+// the worker and list where it would have triggered, so a level or strategy
+// threshold can be checked before the alert goes live. Nothing is stored or
+// sent.
+const (
+	defaultSimulationDays = 30
+	maxSimulationDays     = 365
+)
+
+// SimulateAlertArgs name what to replay: a saved price alert, an unsaved one
+// (securityId and price), or a strategy alert, optionally with the threshold
+// and universe it would use instead of its saved ones.
+type SimulateAlertArgs struct {
+	AlertID    *int     `json:"alertId,omitempty"`
+	SecurityID *int     `json:"securityId,omitempty"`
+	Price      *float64 `json:"price,omitempty"`
+	StrategyID *int     `json:"strategyId,omitempty"`
+	Threshold  *float64 `json:"threshold,omitempty"`
+	Universe   []string `json:"universe,omitempty"`
+	Days       int      `json:"days,omitempty"`
+}
+
+// AlertSimulation lists the hypothetical triggers of an alert
+type AlertSimulation struct {
+	AlertType  string   `json:"alertType"` // "price" or "strategy"
+	AlertID    *int     `json:"alertId,omitempty"`
+	StrategyID *int     `json:"strategyId,omitempty"`
+	Ticker     string   `json:"ticker,omitempty"`
+	Price      *float64 `json:"price,omitempty"`
+	Direction  *bool    `json:"direction,omitempty"` // true = above
+	Threshold  *float64 `json:"threshold,omitempty"`
+	From       int64    `json:"from"` // ms
+	To         int64    `json:"to"`   // ms
+	Days       int      `json:"days"`
+	// Triggers holds at most the earliest 500; TotalTriggers counts them all
+	Triggers       []queue.SimulatedTrigger `json:"triggers"`
+	TotalTriggers  int                      `json:"totalTriggers"`
+	BelowThreshold int                      `json:"belowThreshold"` // strategy instances the threshold dropped
+	Truncated      bool                     `json:"truncated"`
+}
+
+// SimulateAlert replays a price or strategy alert over the last days of data
+// and returns the triggers it would have produced with their times and prices
+func SimulateAlert(ctx context.Context, conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args SimulateAlertArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	switch {
+	case args.Days == 0:
+		args.Days = defaultSimulationDays
+	case args.Days < 1 || args.Days > maxSimulationDays:
+		return nil, apperr.Validation("days must be between 1 and %d", maxSimulationDays)
+	}
+	kinds := 0
+	for _, set := range []bool{args.AlertID != nil, args.SecurityID != nil || args.Price != nil, args.StrategyID != nil} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return nil, apperr.Validation("give exactly one of alertId, securityId and price, or strategyId")
+	}
+
+	end := time.Now()
+	start := end.AddDate(0, 0, -args.Days)
+	sim := &AlertSimulation{From: start.UnixMilli(), To: end.UnixMilli(), Days: args.Days}
+	task := map[string]interface{}{
+		"user_id":    userID,
+		"start_date": start.Format("2006-01-02"),
+		"end_date":   end.Format("2006-01-02"),
+	}
+
+	var err error
+	if args.StrategyID != nil {
+		err = strategySimulationTask(ctx, conn, userID, args, sim, task)
+	} else {
+		err = priceSimulationTask(ctx, conn, userID, args, sim, task)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := queue.AlertSimulationTyped(ctx, conn, task)
+	if err != nil {
+		return nil, fmt.Errorf("error simulating alert: %v", err)
+	}
+	if !result.Success {
+		if result.Error != nil {
+			return nil, fmt.Errorf("alert simulation failed: %s", result.Error.Message)
+		}
+		return nil, fmt.Errorf("alert simulation failed: %s", result.ErrorMessage)
+	}
+	sim.Triggers = result.Triggers
+	if sim.Triggers == nil {
+		sim.Triggers = []queue.SimulatedTrigger{}
+	}
+	sim.TotalTriggers = result.TotalTriggers
+	sim.BelowThreshold = result.BelowThreshold
+	sim.Truncated = result.Truncated
+	return sim, nil
+}
+
+// priceSimulationTask fills in a price alert simulation from a saved alert or
+// a security and level. A saved alert keeps the direction it was created
+// with; an unsaved one takes it from the first bar of the range.
+func priceSimulationTask(ctx context.Context, conn *data.Conn, userID int, args SimulateAlertArgs, sim *AlertSimulation, task map[string]interface{}) error {
+	sim.AlertType = "price"
+	sim.AlertID = args.AlertID
+	securityID, price := args.SecurityID, args.Price
+	if args.AlertID != nil {
+		var vwapAnchor *time.Time
+		var drawingID *int
+		err := conn.DB.QueryRow(ctx, `
+			SELECT price, direction, securityId, vwap_anchor, drawing_id
+			FROM alerts WHERE alertId = $1 AND userId = $2`,
+			*args.AlertID, userID).Scan(&price, &sim.Direction, &securityID, &vwapAnchor, &drawingID)
+		if err == pgx.ErrNoRows {
+			return apperr.NotFound("alert not found or permission denied")
+		} else if err != nil {
+			return fmt.Errorf("fetching alert: %w", err)
+		}
+		if vwapAnchor != nil || drawingID != nil {
+			return apperr.Validation("only fixed-price alerts can be simulated; anchored VWAP and trendline alerts move with their level")
+		}
+	}
+	if securityID == nil || price == nil {
+		return apperr.Validation("securityId and price are required")
+	}
+	if *price <= 0 {
+		return apperr.Validation("price must be positive")
+	}
+
+	err := conn.DB.QueryRow(ctx, `
+		SELECT ticker FROM securities WHERE securityid = $1 ORDER BY maxdate DESC NULLS FIRST LIMIT 1`,
+		*securityID).Scan(&sim.Ticker)
+	if err == pgx.ErrNoRows {
+		return apperr.NotFound("security %d not found", *securityID)
+	} else if err != nil {
+		return fmt.Errorf("error looking up security: %v", err)
+	}
+	sim.Price = price
+	task["alert_type"] = "price"
+	task["ticker"] = sim.Ticker
+	task["price"] = *price
+	if sim.Direction != nil {
+		task["direction"] = *sim.Direction
+	}
+	return nil
+}
+
+// strategySimulationTask fills in a strategy alert simulation, taking the
+// threshold and universe from the strategy unless args override them
+func strategySimulationTask(ctx context.Context, conn *data.Conn, userID int, args SimulateAlertArgs, sim *AlertSimulation, task map[string]interface{}) error {
+	sim.AlertType = "strategy"
+	sim.StrategyID = args.StrategyID
+	ownerID, err := workspaces.Authorize(ctx, conn, userID, workspaces.TypeStrategy, *args.StrategyID, workspaces.RoleViewer)
+	if err != nil {
+		return err
+	}
+	var threshold *float64
+	var universe []string
+	var filters []byte
+	err = conn.DB.QueryRow(ctx, `
+		SELECT alert_threshold, alert_universe, alert_universe_filters FROM strategies WHERE strategyid = $1 AND userid = $2`,
+		*args.StrategyID, ownerID).Scan(&threshold, &universe, &filters)
+	if err == pgx.ErrNoRows {
+		return apperr.NotFound("strategy not found or access denied")
+	} else if err != nil {
+		return fmt.Errorf("error checking strategy: %v", err)
+	}
+	if args.Threshold != nil {
+		threshold = args.Threshold
+	}
+	if len(args.Universe) > 0 {
+		universe = args.Universe
+	} else if filters != nil {
+		// A screened universe is simulated over what the screen matches now
+		var screen []screener.Filter
+		if err := json.Unmarshal(filters, &screen); err != nil {
+			return fmt.Errorf("error reading universe filters: %v", err)
+		}
+		if universe, err = screener.ResolveUniverse(conn, ownerID, screen, 0, ""); err != nil {
+			return fmt.Errorf("resolving universe filters: %w", err)
+		}
+	}
+	sim.Threshold = threshold
+	task["alert_type"] = "strategy"
+	task["strategy_id"] = *args.StrategyID
+	if threshold != nil {
+		task["threshold"] = *threshold
+	}
+	if len(universe) > 0 {
+		task["symbols"] = universe
+	}
+	return nil
+}
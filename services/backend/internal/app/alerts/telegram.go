@@ -0,0 +1,62 @@
+package alerts
+
+import (
+	"backend/internal/data"
+	"backend/internal/services/alerts"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+/*
+   ────────────────────────────────────────────────────────────────────────────────
+   Telegram Chat Linking
+   ────────────────────────────────────────────────────────────────────────────────
+*/
+
+// TelegramChatStatus is whether the user has linked a Telegram chat
+type TelegramChatStatus struct {
+	Linked   bool  `json:"linked"`
+	LinkedAt int64 `json:"linkedAt,omitempty"` // ms since epoch
+}
+
+// GetTelegramChat reports whether the user has linked a Telegram chat
+func GetTelegramChat(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	var linkedAt *time.Time
+	err := conn.DB.QueryRow(context.Background(), `
+		SELECT telegram_linked_at FROM users
+		WHERE userId = $1 AND telegram_chat_id IS NOT NULL`, userID).Scan(&linkedAt)
+	if err == pgx.ErrNoRows {
+		return TelegramChatStatus{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading Telegram chat: %w", err)
+	}
+	status := TelegramChatStatus{Linked: true}
+	if linkedAt != nil {
+		status.LinkedAt = linkedAt.UnixMilli()
+	}
+	return status, nil
+}
+
+// CreateTelegramLink returns a one-time deep link to the bot; opening it in
+// Telegram links that chat to the user
+func CreateTelegramLink(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	link, err := alerts.NewTelegramLink(context.Background(), conn, userID)
+	if err != nil {
+		return nil, fmt.Errorf("creating Telegram link: %w", err)
+	}
+	return link, nil
+}
+
+// UnlinkTelegramChat forgets the user's linked chat. Telegram escalation
+// steps and reports are skipped until another is linked.
+func UnlinkTelegramChat(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	if err := alerts.UnlinkTelegramChat(context.Background(), conn, userID); err != nil {
+		return nil, err
+	}
+	return TelegramChatStatus{}, nil
+}
@@ -0,0 +1,329 @@
+package alerts
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/services/alerts"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+/*
+   ────────────────────────────────────────────────────────────────────────────────
+   Alert Webhooks
+   ────────────────────────────────────────────────────────────────────────────────
+*/
+
+// maxAlertWebhooks is how many webhooks a user can register
+const maxAlertWebhooks = 5
+
+var webhookAlertTypes = []string{"price", "strategy"}
+
+// AlertWebhook is a registered webhook. The secret events are signed with is
+// only returned when the webhook is created.
+type AlertWebhook struct {
+	WebhookID    int      `json:"webhookId"`
+	Name         string   `json:"name"`
+	URL          string   `json:"url"`
+	Schema       string   `json:"schema"`
+	AlertTypes   []string `json:"alertTypes"`
+	Active       bool     `json:"active"`
+	Secret       string   `json:"secret,omitempty"`
+	FailureCount int      `json:"failureCount"`
+	LastStatus   *string  `json:"lastStatus,omitempty"`
+	// LastDeliveryAt and CreatedAt are ms since epoch
+	LastDeliveryAt *int64 `json:"lastDeliveryAt,omitempty"`
+	CreatedAt      int64  `json:"createdAt"`
+}
+
+const alertWebhookColumns = `webhook_id, name, url, schema, alert_types, active, failure_count,
+	last_status, last_delivery_at, created_at`
+
+func scanAlertWebhook(row pgx.Row) (AlertWebhook, error) {
+	var w AlertWebhook
+	var lastDelivery *time.Time
+	var createdAt time.Time
+	err := row.Scan(&w.WebhookID, &w.Name, &w.URL, &w.Schema, &w.AlertTypes, &w.Active, &w.FailureCount,
+		&w.LastStatus, &lastDelivery, &createdAt)
+	if lastDelivery != nil {
+		ms := lastDelivery.UnixMilli()
+		w.LastDeliveryAt = &ms
+	}
+	w.CreatedAt = createdAt.UnixMilli()
+	return w, err
+}
+
+func GetAlertWebhooks(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	rows, err := conn.DB.Query(context.Background(), `
+		SELECT `+alertWebhookColumns+`
+		FROM alert_webhooks WHERE user_id = $1
+		ORDER BY webhook_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("querying alert webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []AlertWebhook{}
+	for rows.Next() {
+		w, err := scanAlertWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning alert webhook: %w", err)
+		}
+		webhooks = append(webhooks, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating alert webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// CreateAlertWebhookArgs registers a webhook. Schema defaults to
+// peripheral.alert.v1 and alertTypes to both price and strategy alerts.
+type CreateAlertWebhookArgs struct {
+	Name       string   `json:"name"`
+	URL        string   `json:"url"`
+	Schema     string   `json:"schema,omitempty"`
+	AlertTypes []string `json:"alertTypes,omitempty"`
+}
+
+// CreateAlertWebhook registers a webhook and returns it with its secret
+func CreateAlertWebhook(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args CreateAlertWebhookArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.Schema == "" {
+		args.Schema = alerts.WebhookSchemaV1
+	}
+	if args.AlertTypes == nil {
+		args.AlertTypes = webhookAlertTypes
+	}
+	if err := validateAlertWebhook(args.URL, args.Schema, args.AlertTypes); err != nil {
+		return nil, err
+	}
+
+	var count int
+	if err := conn.DB.QueryRow(context.Background(), `
+		SELECT COUNT(*) FROM alert_webhooks WHERE user_id = $1`, userID).Scan(&count); err != nil {
+		return nil, fmt.Errorf("counting alert webhooks: %w", err)
+	}
+	if count >= maxAlertWebhooks {
+		return nil, apperr.LimitExceeded("at most %d webhooks can be registered", maxAlertWebhooks)
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("generating webhook secret: %w", err)
+	}
+	secret := "whsec_" + hex.EncodeToString(buf)
+	w, err := scanAlertWebhook(conn.DB.QueryRow(context.Background(), `
+		INSERT INTO alert_webhooks (user_id, name, url, schema, alert_types, secret)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+alertWebhookColumns,
+		userID, strings.TrimSpace(args.Name), args.URL, args.Schema, args.AlertTypes, secret))
+	if err != nil {
+		return nil, fmt.Errorf("saving alert webhook: %w", err)
+	}
+	w.Secret = secret
+	return w, nil
+}
+
+// UpdateAlertWebhookArgs changes the fields given. Reactivating a webhook
+// that was deactivated for failing clears its failures.
+type UpdateAlertWebhookArgs struct {
+	WebhookID  int      `json:"webhookId"`
+	Name       *string  `json:"name,omitempty"`
+	URL        *string  `json:"url,omitempty"`
+	Schema     *string  `json:"schema,omitempty"`
+	AlertTypes []string `json:"alertTypes,omitempty"`
+	Active     *bool    `json:"active,omitempty"`
+}
+
+func UpdateAlertWebhook(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args UpdateAlertWebhookArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	ctx := context.Background()
+	current, err := scanAlertWebhook(conn.DB.QueryRow(ctx, `
+		SELECT `+alertWebhookColumns+`
+		FROM alert_webhooks WHERE webhook_id = $1 AND user_id = $2`, args.WebhookID, userID))
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("webhook not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("loading alert webhook: %w", err)
+	}
+
+	if args.Name != nil {
+		current.Name = strings.TrimSpace(*args.Name)
+	}
+	if args.URL != nil {
+		current.URL = *args.URL
+	}
+	if args.Schema != nil {
+		current.Schema = *args.Schema
+	}
+	if args.AlertTypes != nil {
+		current.AlertTypes = args.AlertTypes
+	}
+	if err := validateAlertWebhook(current.URL, current.Schema, current.AlertTypes); err != nil {
+		return nil, err
+	}
+	active := current.Active
+	if args.Active != nil {
+		active = *args.Active
+	}
+
+	w, err := scanAlertWebhook(conn.DB.QueryRow(ctx, `
+		UPDATE alert_webhooks
+		SET name = $3, url = $4, schema = $5, alert_types = $6, active = $7,
+		    failure_count = CASE WHEN $7 AND NOT active THEN 0 ELSE failure_count END
+		WHERE webhook_id = $1 AND user_id = $2
+		RETURNING `+alertWebhookColumns,
+		args.WebhookID, userID, current.Name, current.URL, current.Schema, current.AlertTypes, active))
+	if err != nil {
+		return nil, fmt.Errorf("updating alert webhook: %w", err)
+	}
+	return w, nil
+}
+
+type AlertWebhookArgs struct {
+	WebhookID int `json:"webhookId"`
+}
+
+func DeleteAlertWebhook(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args AlertWebhookArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	tag, err := conn.DB.Exec(context.Background(), `
+		DELETE FROM alert_webhooks WHERE webhook_id = $1 AND user_id = $2`, args.WebhookID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("deleting alert webhook: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, apperr.NotFound("webhook not found")
+	}
+	return nil, nil
+}
+
+// AlertWebhookTest is the outcome of sending a webhook the example event
+type AlertWebhookTest struct {
+	Delivered bool   `json:"delivered"`
+	Status    int    `json:"status,omitempty"` // HTTP status of the answer
+	Error     string `json:"error,omitempty"`
+}
+
+// TestAlertWebhook sends a webhook the example event, of type alert.test, in
+// its schema. A failed test counts against the webhook like a failed trigger.
+func TestAlertWebhook(ctx context.Context, conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args AlertWebhookArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	var url, schema, secret string
+	err := conn.DB.QueryRow(ctx, `
+		SELECT url, schema, secret FROM alert_webhooks WHERE webhook_id = $1 AND user_id = $2`,
+		args.WebhookID, userID).Scan(&url, &schema, &secret)
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("webhook not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("loading alert webhook: %w", err)
+	}
+
+	ev := alerts.ExampleWebhookEvent()
+	ev.ID = fmt.Sprintf("evt_test-%d-%d", args.WebhookID, time.Now().UnixMilli())
+	ev.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	body, err := alerts.EncodeWebhookEvent(ev, schema)
+	if err != nil {
+		return nil, err
+	}
+	status, err := alerts.PostWebhook(ctx, url, secret, ev.Type, body)
+	alerts.RecordWebhookDelivery(ctx, conn, args.WebhookID, status, err)
+	if err != nil {
+		return AlertWebhookTest{Status: status, Error: err.Error()}, nil
+	}
+	return AlertWebhookTest{Delivered: true, Status: status}, nil
+}
+
+// AlertWebhookSchema documents a schema with an example event in it
+type AlertWebhookSchema struct {
+	Schema      string          `json:"schema"`
+	Description string          `json:"description"`
+	Example     json.RawMessage `json:"example"`
+}
+
+// AlertWebhookSchemas is the reference for building on webhooks
+type AlertWebhookSchemas struct {
+	Schemas         []AlertWebhookSchema `json:"schemas"`
+	EventTypes      []string             `json:"eventTypes"`
+	SignatureHeader string               `json:"signatureHeader"`
+	Signature       string               `json:"signature"`
+}
+
+var webhookSchemaDescriptions = map[string]string{
+	alerts.WebhookSchemaV1: "The trigger as nested objects: alert holds what triggered, matches one entry per " +
+		"security with the strategy's output for it (data) and a link to its chart, links the first " +
+		"match's chart and the alert log.",
+	alerts.WebhookSchemaFlatV1: "The same trigger as one flat object of snake_case fields, for automation tools " +
+		"that map fields one level deep. Matches are joined into the comma separated tickers and " +
+		"chart_urls; ticker, security_id and score are the first match's.",
+}
+
+// GetAlertWebhookSchemas documents the webhook event schemas, with the example
+// event a test sends written in each
+func GetAlertWebhookSchemas(_ *data.Conn, _ int, _ json.RawMessage) (interface{}, error) {
+	ev := alerts.ExampleWebhookEvent()
+	out := AlertWebhookSchemas{
+		EventTypes:      []string{alerts.WebhookEventTriggered, alerts.WebhookEventTest},
+		SignatureHeader: "X-Peripheral-Signature",
+		Signature: "t=<unix seconds>,v1=<hex HMAC-SHA256 of \"<t>.<raw body>\" keyed by the webhook's secret>. " +
+			"Events of one trigger keep their id across retries.",
+	}
+	for _, schema := range alerts.WebhookSchemas {
+		body, err := alerts.EncodeWebhookEvent(ev, schema)
+		if err != nil {
+			return nil, err
+		}
+		out.Schemas = append(out.Schemas, AlertWebhookSchema{
+			Schema:      schema,
+			Description: webhookSchemaDescriptions[schema],
+			Example:     body,
+		})
+	}
+	return out, nil
+}
+
+func validateAlertWebhook(url, schema string, alertTypes []string) error {
+	if err := alerts.ValidateWebhookURL(url); err != nil {
+		return apperr.Validation("%s", err.Error())
+	}
+	if !containsString(alerts.WebhookSchemas, schema) {
+		return apperr.Validation("unknown schema %q, expected one of %s", schema, strings.Join(alerts.WebhookSchemas, ", "))
+	}
+	if len(alertTypes) == 0 {
+		return apperr.Validation("alertTypes must name at least one alert type")
+	}
+	for _, t := range alertTypes {
+		if !containsString(webhookAlertTypes, t) {
+			return apperr.Validation("unknown alert type %q, expected price or strategy", t)
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,10 @@
 package chart
 
 import (
+	"backend/internal/apperr"
 	"backend/internal/data"
 	"backend/internal/data/utils"
+	"backend/internal/services/marketdata"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -45,6 +47,8 @@ type GetChartDataResults struct {
 type GetChartDataResponse struct {
 	Bars           []GetChartDataResults `json:"bars"`
 	IsEarliestData bool                  `json:"isEarliestData"`
+	// Set for timeframes with a continuous aggregate; the chart warns when it is stale
+	Freshness *marketdata.AggregateFreshness `json:"freshness,omitempty"`
 }
 
 // MaxDivisorOf30 returns the largest integer k such that k divides n and k also divides 30.
@@ -57,13 +61,42 @@ func MaxDivisorOf30(n int) int {
 	return 1
 }
 
-// GetChartData performs operations related to GetChartData functionality.
+// GetChartData returns a page of bars, requested either from a timestamp in
+// a direction or over a from/to range (see normalizeChartDataArgs).
 func GetChartData(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
-	var args GetChartDataArgs
-	if err := json.Unmarshal(rawArgs, &args); err != nil {
-		return nil, fmt.Errorf("invalid args: %v", err)
+	args, window, err := normalizeChartDataArgs(rawArgs)
+	if err != nil {
+		return nil, err
 	}
+	res, err := getChartData(conn, userID, args)
+	if err != nil {
+		return nil, err
+	}
+	res = window.clip(res)
+	if resp, ok := res.(GetChartDataResponse); ok {
+		resp.Freshness = aggregateFreshness(conn, args.Timeframe)
+		res = resp
+	}
+	return res, nil
+}
+
+// aggregateFreshness returns the freshness of the continuous aggregate for
+// timeframe's bar length, if it has one
+func aggregateFreshness(conn *data.Conn, timeframe string) *marketdata.AggregateFreshness {
+	multiplier, timespan, _, _, err := GetTimeFrame(timeframe)
+	if err != nil {
+		return nil
+	}
+	bucket := time.Duration(GetTimeframeInSeconds(multiplier, timespan)) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if f, ok := marketdata.CachedAggregateFreshness(ctx, conn, bucket); ok {
+		return &f
+	}
+	return nil
+}
 
+func getChartData(conn *data.Conn, userID int, args GetChartDataArgs) (interface{}, error) {
 	// For public access (userID=0), disable premium features
 	if userID == 0 {
 		args.IncludeSECFilings = false
@@ -502,7 +535,7 @@ func GetChartData(conn *data.Conn, userID int, rawArgs json.RawMessage) (interfa
 	// Log chart query in goroutine (even for failed requests)
 	go logChartQuery(conn, userID, args)
 
-	return nil, fmt.Errorf("no data found for %d, %s", args.SecurityID, tickerForIncompleteAggregate)
+	return nil, apperr.NotFound("no chart data found for security %d (%s)", args.SecurityID, tickerForIncompleteAggregate)
 }
 
 func reverse(data []GetChartDataResults) {
@@ -0,0 +1,158 @@
+package chart
+
+import (
+	"backend/internal/apperr"
+	"encoding/json"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Chart data is requested in two shapes. The chart pages from a point in
+// time with timestamp, direction and bars; tools and scripts ask for a range
+// with from and to. normalizeChartDataArgs accepts either, turns a range into
+// a forward page from its start, and rejects what the fetch would otherwise
+// silently misread.
+const (
+	maxChartBars     = 10000
+	defaultChartBars = 300
+	// Range timestamps under this are taken as seconds rather than
+	// milliseconds; in milliseconds it is early 1973
+	secondsTimestampLimit = 1e11
+)
+
+// chartTimeframeLimits is the largest multiplier allowed per timeframe unit,
+// keyed by GetTimeFrame's unit suffix ("" is minutes, "m" is months)
+var chartTimeframeLimits = map[string]int{
+	"s": 60,
+	"":  1440,
+	"h": 24,
+	"d": 365,
+	"w": 52,
+	"m": 24,
+	"y": 10,
+}
+
+var chartTimeframePattern = regexp.MustCompile(`^([0-9]+)([shdwmy]?)$`)
+
+// chartDataRequest is either shape of a getChartData request
+type chartDataRequest struct {
+	GetChartDataArgs
+	From *int64 `json:"from"` // ms or seconds since epoch
+	To   *int64 `json:"to"`
+}
+
+// chartWindow is the end of a range request; bars after it are dropped
+type chartWindow struct {
+	to *time.Time
+}
+
+// clip drops the bars a forward page fetched past the range's end
+func (w chartWindow) clip(res interface{}) interface{} {
+	resp, ok := res.(GetChartDataResponse)
+	if !ok || w.to == nil {
+		return res
+	}
+	end := float64(w.to.Unix())
+	bars := resp.Bars[:0]
+	for _, bar := range resp.Bars {
+		if bar.Timestamp <= end {
+			bars = append(bars, bar)
+		}
+	}
+	resp.Bars = bars
+	return resp
+}
+
+// validateChartTimeframe checks a timeframe against the units and sizes the
+// chart can build
+func validateChartTimeframe(timeframe string) error {
+	m := chartTimeframePattern.FindStringSubmatch(timeframe)
+	if m == nil {
+		return apperr.Validation("unsupported timeframe %q; use a number of minutes (e.g. 5) or a number with s, h, d, w, m (months) or y", timeframe)
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n < 1 || n > chartTimeframeLimits[m[2]] {
+		return apperr.Validation("timeframe %q is out of range; at most %d%s", timeframe, chartTimeframeLimits[m[2]], m[2])
+	}
+	return nil
+}
+
+// rangeTime reads a range bound given in milliseconds or seconds
+func rangeTime(v int64) time.Time {
+	if v < secondsTimestampLimit {
+		return time.Unix(v, 0).UTC()
+	}
+	return time.UnixMilli(v).UTC()
+}
+
+// normalizeChartDataArgs validates a getChartData request of either shape and
+// returns it as a page request
+func normalizeChartDataArgs(rawArgs json.RawMessage) (GetChartDataArgs, chartWindow, error) {
+	var req chartDataRequest
+	if err := json.Unmarshal(rawArgs, &req); err != nil {
+		return GetChartDataArgs{}, chartWindow{}, apperr.InvalidArgs(err)
+	}
+	args := req.GetChartDataArgs
+	var window chartWindow
+
+	if args.SecurityID <= 0 {
+		return args, window, apperr.Validation("securityId is required")
+	}
+	if err := validateChartTimeframe(args.Timeframe); err != nil {
+		return args, window, err
+	}
+	if args.Bars < 0 || args.Bars > maxChartBars {
+		return args, window, apperr.Validation("bars must be between 1 and %d", maxChartBars)
+	}
+	args.Direction = strings.ToLower(args.Direction)
+
+	if req.From == nil && req.To == nil {
+		if args.Bars == 0 {
+			return args, window, apperr.Validation("bars must be between 1 and %d", maxChartBars)
+		}
+		if args.Timestamp != 0 && args.Direction != "forward" && args.Direction != "backward" {
+			return args, window, apperr.Validation("direction must be forward or backward, got %q", args.Direction)
+		}
+		return args, window, nil
+	}
+
+	if args.Timestamp != 0 || args.Direction != "" {
+		return args, window, apperr.Validation("use either from/to or timestamp/direction, not both")
+	}
+	if req.From == nil {
+		// Only an end: the bars leading up to it
+		to := rangeTime(*req.To)
+		args.Timestamp = to.UnixMilli()
+		args.Direction = "backward"
+		if args.Bars == 0 {
+			args.Bars = defaultChartBars
+		}
+		return args, window, nil
+	}
+
+	from := rangeTime(*req.From)
+	to := time.Now().UTC()
+	if req.To != nil {
+		to = rangeTime(*req.To)
+	}
+	if !from.Before(to) {
+		return args, window, apperr.Validation("from must be before to")
+	}
+	args.Timestamp = from.UnixMilli()
+	args.Direction = "forward"
+	if args.Bars == 0 {
+		// Enough bars to cover the range around the clock; trading hours
+		// only need fewer, and the page is clipped at to anyway
+		multiplier, timespan, _, _, _ := GetTimeFrame(args.Timeframe)
+		if perBar := GetTimeframeInSeconds(multiplier, timespan); perBar > 0 {
+			args.Bars = int(math.Min(math.Ceil(to.Sub(from).Seconds()/float64(perBar))+1, maxChartBars))
+		} else {
+			args.Bars = defaultChartBars
+		}
+	}
+	window.to = &to
+	return args, window, nil
+}
@@ -0,0 +1,30 @@
+package chart
+
+import (
+	"backend/internal/data"
+	"backend/internal/services/marketdata"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// GetDataHealthArgs represents a structure for handling GetDataHealthArgs data.
+type GetDataHealthArgs struct {
+	SecurityID int `json:"securityId"`
+}
+
+// GetDataHealth returns the open OHLCV data-quality findings of a security so
+// the chart can warn about gaps or bad bars.
+func GetDataHealth(conn *data.Conn, _ int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetDataHealthArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("invalid args: %v", err)
+	}
+	if args.SecurityID <= 0 {
+		return nil, fmt.Errorf("securityId is required")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return marketdata.GetDataHealth(ctx, conn, args.SecurityID)
+}
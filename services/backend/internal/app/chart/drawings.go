@@ -2,9 +2,12 @@ package chart
 
 import (
 	"backend/internal/data"
+	"backend/internal/services/socket"
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 )
 
 // HorizontalLine represents a structure for handling HorizontalLine data.
@@ -201,3 +204,212 @@ func UpdateHorizontalLine(conn *data.Conn, userID int, rawArgs json.RawMessage)
 
 	return nil, nil
 }
+
+// drawingPointCounts is the number of anchor points each drawing type takes
+var drawingPointCounts = map[string]int{
+	"trendline":       2,
+	"rectangle":       2, // opposite corners of the zone
+	"fib_retracement": 2, // swing start and end
+	"text":            1,
+}
+
+// DrawingPoint is a chart anchor in time/price space.
+type DrawingPoint struct {
+	Timestamp int64   `json:"timestamp"` // ms
+	Price     float64 `json:"price"`
+}
+
+// ChartDrawing represents a persisted non-horizontal-line chart drawing.
+type ChartDrawing struct {
+	ID          int                    `json:"id"`
+	SecurityID  int                    `json:"securityId"`
+	Timeframe   *string                `json:"timeframe,omitempty"` // nil = all timeframes
+	DrawingType string                 `json:"drawingType"`
+	Points      []DrawingPoint         `json:"points"`
+	Style       map[string]interface{} `json:"style,omitempty"` // color, lineWidth, fill, levels, ...
+	Text        *string                `json:"text,omitempty"`
+	UpdatedAt   int64                  `json:"updatedAt"` // ms
+}
+
+// ChartDrawings is every drawing shown on one chart.
+type ChartDrawings struct {
+	HorizontalLines []HorizontalLine `json:"horizontalLines"`
+	Drawings        []ChartDrawing   `json:"drawings"`
+}
+
+// GetChartDrawingsArgs represents a structure for handling GetChartDrawingsArgs data.
+type GetChartDrawingsArgs struct {
+	SecurityID int    `json:"securityId"`
+	Timeframe  string `json:"timeframe,omitempty"` // empty = every timeframe
+}
+
+// GetChartDrawings returns horizontal lines and drawings for a chart in one call.
+func GetChartDrawings(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetChartDrawingsArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("error parsing args: %v", err)
+	}
+
+	lines, err := GetHorizontalLines(conn, userID, rawArgs)
+	if err != nil {
+		return nil, err
+	}
+	result := ChartDrawings{HorizontalLines: []HorizontalLine{}, Drawings: []ChartDrawing{}}
+	if lines, ok := lines.([]HorizontalLine); ok && lines != nil {
+		result.HorizontalLines = lines
+	}
+
+	rows, err := conn.DB.Query(context.Background(), `
+		SELECT id, security_id, timeframe, drawing_type, points, style, text,
+		       (EXTRACT(EPOCH FROM updated_at) * 1000)::bigint
+		FROM chart_drawings
+		WHERE user_id = $1 AND security_id = $2
+		  AND ($3 = '' OR timeframe IS NULL OR timeframe = $3)
+		ORDER BY id`, userID, args.SecurityID, args.Timeframe)
+	if err != nil {
+		return nil, fmt.Errorf("error querying chart drawings: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d ChartDrawing
+		var points, style []byte
+		if err := rows.Scan(&d.ID, &d.SecurityID, &d.Timeframe, &d.DrawingType, &points, &style, &d.Text, &d.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning chart drawing: %v", err)
+		}
+		if err := json.Unmarshal(points, &d.Points); err != nil {
+			return nil, fmt.Errorf("error decoding drawing points: %v", err)
+		}
+		if err := json.Unmarshal(style, &d.Style); err != nil {
+			return nil, fmt.Errorf("error decoding drawing style: %v", err)
+		}
+		result.Drawings = append(result.Drawings, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating chart drawings: %v", err)
+	}
+	return result, nil
+}
+
+// validateChartDrawing checks the drawing type, anchor count and text note.
+func validateChartDrawing(d *ChartDrawing) error {
+	want, ok := drawingPointCounts[d.DrawingType]
+	if !ok {
+		return fmt.Errorf("unsupported drawing type %q (use trendline, rectangle, fib_retracement or text)", d.DrawingType)
+	}
+	if len(d.Points) != want {
+		return fmt.Errorf("%s drawings take %d points, got %d", d.DrawingType, want, len(d.Points))
+	}
+	for _, p := range d.Points {
+		if p.Timestamp <= 0 {
+			return fmt.Errorf("drawing points need a timestamp")
+		}
+	}
+	if d.DrawingType == "trendline" && d.Points[0].Timestamp == d.Points[1].Timestamp {
+		return fmt.Errorf("trendline points must be at different times")
+	}
+	if d.DrawingType == "text" && (d.Text == nil || strings.TrimSpace(*d.Text) == "") {
+		return fmt.Errorf("text notes need text")
+	}
+	if d.Timeframe != nil && (*d.Timeframe == "" || len(*d.Timeframe) > 10) {
+		d.Timeframe = nil
+	}
+	if d.Style == nil {
+		d.Style = map[string]interface{}{}
+	}
+	return nil
+}
+
+// SetChartDrawing creates a chart drawing and syncs it to the user's other sessions.
+func SetChartDrawing(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var d ChartDrawing
+	if err := json.Unmarshal(rawArgs, &d); err != nil {
+		return nil, fmt.Errorf("error parsing args: %v", err)
+	}
+	if d.SecurityID <= 0 {
+		return nil, fmt.Errorf("securityId is required")
+	}
+	if err := validateChartDrawing(&d); err != nil {
+		return nil, err
+	}
+	points, err := json.Marshal(d.Points)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding drawing points: %v", err)
+	}
+	style, err := json.Marshal(d.Style)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding drawing style: %v", err)
+	}
+
+	var updatedAt time.Time
+	err = conn.DB.QueryRow(context.Background(), `
+		INSERT INTO chart_drawings (user_id, security_id, timeframe, drawing_type, points, style, text)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, updated_at`,
+		userID, d.SecurityID, d.Timeframe, d.DrawingType, points, style, d.Text).Scan(&d.ID, &updatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting chart drawing: %v", err)
+	}
+	d.UpdatedAt = updatedAt.UnixMilli()
+
+	go socket.SendChartDrawingUpdate(userID, "add", d.SecurityID, d)
+	return d, nil
+}
+
+// UpdateChartDrawing replaces the points, style, text and timeframe of a drawing.
+func UpdateChartDrawing(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var d ChartDrawing
+	if err := json.Unmarshal(rawArgs, &d); err != nil {
+		return nil, fmt.Errorf("error parsing args: %v", err)
+	}
+	if err := validateChartDrawing(&d); err != nil {
+		return nil, err
+	}
+	points, err := json.Marshal(d.Points)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding drawing points: %v", err)
+	}
+	style, err := json.Marshal(d.Style)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding drawing style: %v", err)
+	}
+
+	var updatedAt time.Time
+	err = conn.DB.QueryRow(context.Background(), `
+		UPDATE chart_drawings
+		SET timeframe = $1, points = $2, style = $3, text = $4, updated_at = NOW()
+		WHERE id = $5 AND user_id = $6 AND drawing_type = $7
+		RETURNING security_id, updated_at`,
+		d.Timeframe, points, style, d.Text, d.ID, userID, d.DrawingType).Scan(&d.SecurityID, &updatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("no %s drawing found with id %d", d.DrawingType, d.ID)
+	}
+	d.UpdatedAt = updatedAt.UnixMilli()
+
+	go socket.SendChartDrawingUpdate(userID, "update", d.SecurityID, d)
+	return d, nil
+}
+
+// DeleteChartDrawingArgs represents a structure for handling DeleteChartDrawingArgs data.
+type DeleteChartDrawingArgs struct {
+	ID int `json:"id"`
+}
+
+// DeleteChartDrawing removes a drawing and syncs the removal.
+func DeleteChartDrawing(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args DeleteChartDrawingArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("error parsing args: %v", err)
+	}
+
+	var securityID int
+	err := conn.DB.QueryRow(context.Background(), `
+		DELETE FROM chart_drawings WHERE id = $1 AND user_id = $2
+		RETURNING security_id`, args.ID, userID).Scan(&securityID)
+	if err != nil {
+		return nil, fmt.Errorf("chart drawing not found: %v", err)
+	}
+
+	go socket.SendChartDrawingUpdate(userID, "remove", securityID, map[string]interface{}{"id": args.ID})
+	return nil, nil
+}
@@ -0,0 +1,85 @@
+package chart
+
+import (
+	"backend/internal/data"
+	"backend/internal/data/postgres"
+	"backend/internal/services/marketdata"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const vwapTimeout = 15 * time.Second
+
+// GetSessionVWAPArgs represents a structure for handling GetSessionVWAPArgs data.
+type GetSessionVWAPArgs struct {
+	SecurityID    int    `json:"securityId,omitempty"`
+	Ticker        string `json:"ticker,omitempty"`
+	Timestamp     int64  `json:"timestamp,omitempty"` // ms; defaults to now
+	ExtendedHours bool   `json:"extendedHours,omitempty"`
+	IncludeSeries bool   `json:"includeSeries,omitempty"`
+}
+
+// GetAnchoredVWAPArgs represents a structure for handling GetAnchoredVWAPArgs data.
+type GetAnchoredVWAPArgs struct {
+	SecurityID    int    `json:"securityId,omitempty"`
+	Ticker        string `json:"ticker,omitempty"`
+	Anchor        int64  `json:"anchor"`        // ms
+	End           int64  `json:"end,omitempty"` // ms; defaults to now
+	IncludeSeries bool   `json:"includeSeries,omitempty"`
+}
+
+// GetSessionVWAP returns the VWAP of the session containing timestamp from 1m bars.
+func GetSessionVWAP(conn *data.Conn, _ int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetSessionVWAPArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("invalid args: %v", err)
+	}
+	at := time.Now()
+	if args.Timestamp > 0 {
+		at = time.UnixMilli(args.Timestamp)
+	}
+	ticker, err := resolveVWAPTicker(conn, args.SecurityID, args.Ticker, at)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), vwapTimeout)
+	defer cancel()
+	return marketdata.SessionVWAP(ctx, conn, ticker, at, args.ExtendedHours, args.IncludeSeries)
+}
+
+// GetAnchoredVWAP returns the VWAP from a user-chosen anchor timestamp from 1m bars.
+func GetAnchoredVWAP(conn *data.Conn, _ int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetAnchoredVWAPArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("invalid args: %v", err)
+	}
+	if args.Anchor <= 0 {
+		return nil, fmt.Errorf("anchor timestamp is required")
+	}
+	end := time.Now()
+	if args.End > 0 {
+		end = time.UnixMilli(args.End)
+	}
+	anchor := time.UnixMilli(args.Anchor)
+	ticker, err := resolveVWAPTicker(conn, args.SecurityID, args.Ticker, anchor)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), vwapTimeout)
+	defer cancel()
+	return marketdata.AnchoredVWAP(ctx, conn, ticker, anchor, end, args.IncludeSeries)
+}
+
+// resolveVWAPTicker accepts either a security ID (frontend) or a ticker (agent)
+func resolveVWAPTicker(conn *data.Conn, securityID int, ticker string, at time.Time) (string, error) {
+	if ticker != "" {
+		return strings.ToUpper(ticker), nil
+	}
+	if securityID <= 0 {
+		return "", fmt.Errorf("securityId or ticker is required")
+	}
+	return postgres.GetTicker(conn, securityID, at)
+}
@@ -0,0 +1,414 @@
+// Package dependencies tracks which of a user's entities reference which
+// (a report covering a watchlist, a study tagged with a strategy, ...) so the
+// impact of deleting or editing one can be shown before it happens, and its
+// dependents unlinked or deleted along with it.
+package dependencies
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/services/twofactor"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Entity types
+const (
+	TypeStrategy         = "strategy"
+	TypeWatchlist        = "watchlist"
+	TypeScreenerColumn   = "screener_column"
+	TypeReport           = "report"
+	TypeStudy            = "study"
+	TypeEscalationPolicy = "escalation_policy"
+)
+
+// Relations, named for why the source references the target
+const (
+	RelationUniverse      = "universe"       // strategy → the watchlist its universe was taken from
+	RelationAlertUniverse = "alert_universe" // strategy → a computed column its alert universe was screened on
+	RelationReport        = "report"         // report → a strategy or watchlist it covers
+	RelationStudy         = "study"          // study → the strategy it is tagged with
+	RelationEscalation    = "escalation"     // escalation policy → the strategy alert it applies to
+)
+
+// What happens to dependents when their target is deleted
+const (
+	ActionDetach  = "detach"  // unlink them and keep them
+	ActionCascade = "cascade" // delete them too
+)
+
+// Querier is satisfied by both the pool and a transaction
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// Target is an entity referenced by a source
+type Target struct {
+	Type string
+	ID   int
+}
+
+// Set replaces the references of one relation from a source with targets
+func Set(ctx context.Context, q Querier, userID int, sourceType string, sourceID int, relation string, targets []Target) error {
+	if _, err := q.Exec(ctx, `
+		DELETE FROM entity_dependencies WHERE source_type = $1 AND source_id = $2 AND relation = $3`,
+		sourceType, sourceID, relation); err != nil {
+		return fmt.Errorf("error clearing %s %d dependencies: %v", sourceType, sourceID, err)
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	types := make([]string, len(targets))
+	ids := make([]int, len(targets))
+	for i, t := range targets {
+		types[i], ids[i] = t.Type, t.ID
+	}
+	if _, err := q.Exec(ctx, `
+		INSERT INTO entity_dependencies (user_id, source_type, source_id, target_type, target_id, relation)
+		SELECT $1, $2, $3, t.type, t.id, $4 FROM unnest($5::text[], $6::int[]) AS t(type, id)
+		ON CONFLICT DO NOTHING`,
+		userID, sourceType, sourceID, relation, types, ids); err != nil {
+		return fmt.Errorf("error recording %s %d dependencies: %v", sourceType, sourceID, err)
+	}
+	return nil
+}
+
+// Forget drops every reference from or to an entity that was deleted
+func Forget(ctx context.Context, q Querier, entityType string, id int) error {
+	if _, err := q.Exec(ctx, `
+		DELETE FROM entity_dependencies
+		WHERE (source_type = $1 AND source_id = $2) OR (target_type = $1 AND target_id = $2)`,
+		entityType, id); err != nil {
+		return fmt.Errorf("error dropping %s %d dependencies: %v", entityType, id, err)
+	}
+	return nil
+}
+
+// Dependent is an entity that references the one being analyzed
+type Dependent struct {
+	Type        string `json:"type"`
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Relation    string `json:"relation"`
+	AlertActive bool   `json:"alertActive,omitempty"` // strategies only
+	// OnDetach says what detaching does to this dependent
+	OnDetach string `json:"onDetach"`
+}
+
+// Impact is what depends on an entity
+type Impact struct {
+	Type       string      `json:"type"`
+	ID         int         `json:"id"`
+	Name       string      `json:"name"`
+	Dependents []Dependent `json:"dependents"`
+	Summary    string      `json:"summary"`           // "This watchlist is used by 3 strategy alerts and 1 report"
+	Options    []string    `json:"options,omitempty"` // actions for onDependents when deleting it
+	// CascadeNeedsTwoFactor is set when cascading would delete active strategy
+	// alerts, which asks for a two-factor code like deleting them one by one
+	CascadeNeedsTwoFactor bool `json:"cascadeNeedsTwoFactor,omitempty"`
+}
+
+// Analyze lists what depends on one of the user's entities. References to
+// entities that no longer exist are dropped on the way.
+func Analyze(ctx context.Context, q Querier, userID int, targetType string, targetID int) (*Impact, error) {
+	name, err := targetName(ctx, q, userID, targetType, targetID)
+	if err != nil {
+		return nil, err
+	}
+	dependents, err := loadDependents(ctx, q, userID, targetType, targetID)
+	if err != nil {
+		return nil, err
+	}
+	impact := &Impact{Type: targetType, ID: targetID, Name: name, Dependents: dependents}
+	impact.Summary = summarize(targetType, dependents)
+	if len(dependents) > 0 {
+		impact.Options = []string{ActionDetach, ActionCascade}
+	}
+	for _, d := range dependents {
+		if d.Type == TypeStrategy && d.AlertActive {
+			impact.CascadeNeedsTwoFactor = true
+		}
+	}
+	return impact, nil
+}
+
+type GetDependencyImpactArgs struct {
+	Type string `json:"type"`
+	ID   int    `json:"id"`
+}
+
+// GetDependencyImpact shows what deleting or editing a strategy, watchlist or
+// computed screener column would affect
+func GetDependencyImpact(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetDependencyImpactArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return Analyze(ctx, conn.DB, userID, args.Type, args.ID)
+}
+
+// Resolution is what Resolve did to the dependents
+type Resolution struct {
+	DeletedStrategies []int
+	// DeletedActiveAlerts is how many of the deleted strategies had their
+	// alert on; the caller releases them from the user's alert limit
+	DeletedActiveAlerts int
+}
+
+// Resolve detaches or deletes what depends on an entity, in the transaction
+// that deletes it. Deleting strategies detaches what depends on them in turn.
+// Cascading over active strategy alerts needs a two-factor code when the user
+// has two-factor enabled.
+func Resolve(ctx context.Context, conn *data.Conn, tx pgx.Tx, userID int, targetType string, targetID int, action, twoFactorCode string) (*Resolution, error) {
+	if action == "" {
+		action = ActionDetach
+	}
+	if action != ActionDetach && action != ActionCascade {
+		return nil, apperr.Validation("onDependents must be %q or %q", ActionDetach, ActionCascade)
+	}
+	dependents, err := loadDependents(ctx, tx, userID, targetType, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if action == ActionCascade {
+		for _, d := range dependents {
+			if d.Type == TypeStrategy && d.AlertActive {
+				if err := twofactor.RequireStepUp(ctx, conn, userID, twoFactorCode); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+	}
+
+	res := &Resolution{}
+	for _, d := range dependents {
+		if err := resolveDependent(ctx, tx, userID, targetType, targetID, d, action, res); err != nil {
+			return nil, err
+		}
+	}
+	if err := Forget(ctx, tx, targetType, targetID); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func resolveDependent(ctx context.Context, tx pgx.Tx, userID int, targetType string, targetID int, d Dependent, action string, res *Resolution) error {
+	var err error
+	switch d.Type {
+	case TypeReport:
+		if action == ActionCascade {
+			_, err = tx.Exec(ctx, `DELETE FROM scheduled_reports WHERE report_id = $1 AND user_id = $2`, d.ID, userID)
+			break
+		}
+		column := "strategy_ids"
+		if targetType == TypeWatchlist {
+			column = "watchlist_ids"
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE scheduled_reports SET `+column+` = array_remove(`+column+`, $3), updated_at = NOW()
+			WHERE report_id = $1 AND user_id = $2`, d.ID, userID, targetID)
+	case TypeStudy:
+		if action == ActionCascade {
+			_, err = tx.Exec(ctx, `DELETE FROM studies WHERE studyId = $1 AND userId = $2`, d.ID, userID)
+			break
+		}
+		_, err = tx.Exec(ctx, `UPDATE studies SET strategyId = NULL WHERE studyId = $1 AND userId = $2`, d.ID, userID)
+	case TypeEscalationPolicy:
+		// A policy only applies to its strategy, so it goes either way
+		_, err = tx.Exec(ctx, `DELETE FROM alert_escalation_policies WHERE policy_id = $1 AND user_id = $2`, d.ID, userID)
+	case TypeStrategy:
+		if action == ActionDetach {
+			// The strategy keeps the tickers it was given; only the link goes
+			return nil
+		}
+		nested, nerr := Resolve(ctx, nil, tx, userID, TypeStrategy, d.ID, ActionDetach, "")
+		if nerr != nil {
+			return nerr
+		}
+		res.DeletedStrategies = append(res.DeletedStrategies, nested.DeletedStrategies...)
+		var alertActive bool
+		err = tx.QueryRow(ctx, `
+			DELETE FROM strategies WHERE strategyId = $1 AND userId = $2
+			RETURNING COALESCE(alertactive, false)`, d.ID, userID).Scan(&alertActive)
+		if err == pgx.ErrNoRows {
+			err = nil
+			break
+		}
+		if err == nil {
+			res.DeletedStrategies = append(res.DeletedStrategies, d.ID)
+			if alertActive {
+				res.DeletedActiveAlerts++
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error resolving %s %d: %v", d.Type, d.ID, err)
+	}
+	if action == ActionCascade {
+		return Forget(ctx, tx, d.Type, d.ID)
+	}
+	return nil
+}
+
+// targetName checks the entity is the user's and returns its name
+func targetName(ctx context.Context, q Querier, userID int, targetType string, id int) (string, error) {
+	var query string
+	switch targetType {
+	case TypeStrategy:
+		query = `SELECT name FROM strategies WHERE strategyId = $1 AND userId = $2`
+	case TypeWatchlist:
+		query = `SELECT watchlistName FROM watchlists WHERE watchlistId = $1 AND userId = $2`
+	case TypeScreenerColumn:
+		query = `SELECT name FROM screener_computed_columns WHERE column_id = $1 AND user_id = $2`
+	default:
+		return "", apperr.Validation("type must be %q, %q or %q", TypeStrategy, TypeWatchlist, TypeScreenerColumn)
+	}
+	var name string
+	err := q.QueryRow(ctx, query, id, userID).Scan(&name)
+	if err == pgx.ErrNoRows {
+		return "", apperr.NotFound("%s not found", strings.ReplaceAll(targetType, "_", " "))
+	}
+	if err != nil {
+		return "", fmt.Errorf("error loading %s %d: %v", targetType, id, err)
+	}
+	return name, nil
+}
+
+// loadDependents returns the existing entities that reference a target, with
+// their names. References whose source is gone are deleted.
+func loadDependents(ctx context.Context, q Querier, userID int, targetType string, targetID int) ([]Dependent, error) {
+	rows, err := q.Query(ctx, `
+		SELECT d.source_type, d.source_id, d.relation,
+		       CASE d.source_type
+		           WHEN 'strategy' THEN (SELECT s.name FROM strategies s WHERE s.strategyId = d.source_id AND s.userId = d.user_id)
+		           WHEN 'report' THEN (SELECT r.name FROM scheduled_reports r WHERE r.report_id = d.source_id AND r.user_id = d.user_id)
+		           WHEN 'study' THEN (
+		               SELECT 'Study of ' || COALESCE(
+		                   (SELECT sec.ticker FROM securities sec WHERE sec.securityId = st.securityId ORDER BY sec.maxDate DESC NULLS FIRST LIMIT 1),
+		                   '#' || st.studyId)
+		               FROM studies st WHERE st.studyId = d.source_id AND st.userId = d.user_id)
+		           WHEN 'escalation_policy' THEN (
+		               SELECT 'Escalation policy' FROM alert_escalation_policies p
+		               WHERE p.policy_id = d.source_id AND p.user_id = d.user_id)
+		       END,
+		       d.source_type = 'strategy' AND COALESCE(
+		           (SELECT s.alertactive FROM strategies s WHERE s.strategyId = d.source_id), false)
+		FROM entity_dependencies d
+		WHERE d.target_type = $1 AND d.target_id = $2 AND d.user_id = $3
+		ORDER BY d.source_type, d.source_id`, targetType, targetID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading dependents of %s %d: %v", targetType, targetID, err)
+	}
+	defer rows.Close()
+
+	out := []Dependent{}
+	var stale []int
+	seen := make(map[Target]bool)
+	for rows.Next() {
+		var d Dependent
+		var name *string
+		if err := rows.Scan(&d.Type, &d.ID, &d.Relation, &name, &d.AlertActive); err != nil {
+			return nil, fmt.Errorf("error scanning dependent: %v", err)
+		}
+		if name == nil {
+			stale = append(stale, d.ID)
+			continue
+		}
+		key := Target{d.Type, d.ID}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		d.Name = *name
+		d.OnDetach = detachEffect(targetType, d)
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error loading dependents of %s %d: %v", targetType, targetID, err)
+	}
+	if len(stale) > 0 {
+		if _, err := q.Exec(ctx, `
+			DELETE FROM entity_dependencies d
+			WHERE d.target_type = $1 AND d.target_id = $2 AND d.source_id = ANY($3)
+			  AND NOT EXISTS (SELECT 1 FROM strategies WHERE d.source_type = 'strategy' AND strategyId = d.source_id)
+			  AND NOT EXISTS (SELECT 1 FROM scheduled_reports WHERE d.source_type = 'report' AND report_id = d.source_id)
+			  AND NOT EXISTS (SELECT 1 FROM studies WHERE d.source_type = 'study' AND studyId = d.source_id)
+			  AND NOT EXISTS (SELECT 1 FROM alert_escalation_policies WHERE d.source_type = 'escalation_policy' AND policy_id = d.source_id)`,
+			targetType, targetID, stale); err != nil {
+			return nil, fmt.Errorf("error dropping stale dependencies: %v", err)
+		}
+	}
+	return out, nil
+}
+
+func detachEffect(targetType string, d Dependent) string {
+	switch d.Type {
+	case TypeReport:
+		return "removed from the report"
+	case TypeStudy:
+		return "untagged from the strategy"
+	case TypeEscalationPolicy:
+		return "deleted, it only applies to this strategy"
+	case TypeStrategy:
+		if d.Relation == RelationAlertUniverse {
+			return "alert keeps its current tickers"
+		}
+		return "keeps its current tickers"
+	}
+	return "unlinked"
+}
+
+// summarize describes the dependents in one sentence, e.g. "This watchlist is
+// used by 3 strategy alerts and 1 report"
+func summarize(targetType string, dependents []Dependent) string {
+	subject := "This " + strings.ReplaceAll(targetType, "_", " ")
+	if targetType == TypeScreenerColumn {
+		subject = "This computed column"
+	}
+	if len(dependents) == 0 {
+		return fmt.Sprintf("Nothing depends on %s", strings.ToLower(subject[:1])+subject[1:])
+	}
+	var labels []string
+	counts := make(map[string]int)
+	for _, d := range dependents {
+		label := strings.ReplaceAll(d.Type, "_", " ")
+		if d.Type == TypeStrategy && d.AlertActive {
+			label = "strategy alert"
+		}
+		if counts[label] == 0 {
+			labels = append(labels, label)
+		}
+		counts[label]++
+	}
+	parts := make([]string, len(labels))
+	for i, label := range labels {
+		n := counts[label]
+		if n != 1 {
+			label = plural(label)
+		}
+		parts[i] = fmt.Sprintf("%d %s", n, label)
+	}
+	list := parts[0]
+	if len(parts) > 1 {
+		list = strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+	}
+	return fmt.Sprintf("%s is used by %s", subject, list)
+}
+
+func plural(label string) string {
+	if strings.HasSuffix(label, "y") {
+		return label[:len(label)-1] + "ies"
+	}
+	return label + "s"
+}
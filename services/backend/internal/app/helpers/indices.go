@@ -0,0 +1,87 @@
+package helpers
+
+import (
+	"backend/internal/data"
+	"backend/internal/data/postgres"
+	"backend/internal/services/securities"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// GetIndexMembersArgs represents a structure for handling GetIndexMembersArgs data.
+type GetIndexMembersArgs struct {
+	Index string `json:"index"`          // SPX, NDX or a tracking ETF such as SPY
+	Date  string `json:"date,omitempty"` // YYYY-MM-DD, defaults to today
+}
+
+// GetIndexMembersResults represents a structure for handling GetIndexMembersResults data.
+type GetIndexMembersResults struct {
+	Index   string   `json:"index"`
+	Date    string   `json:"date"`
+	Tickers []string `json:"tickers"`
+}
+
+// GetIndexMembers returns the constituents of an index on a date.
+func GetIndexMembers(conn *data.Conn, _ int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetIndexMembersArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("invalid args: %v", err)
+	}
+	index, ok := securities.NormalizeIndexSymbol(args.Index)
+	if !ok {
+		return nil, fmt.Errorf("unknown index %q", args.Index)
+	}
+	date, err := membershipDate(args.Date)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tickers, err := securities.IndexMembers(ctx, conn, index, date)
+	if err != nil {
+		return nil, err
+	}
+	if tickers == nil {
+		tickers = []string{}
+	}
+	return GetIndexMembersResults{Index: index, Date: date.Format("2006-01-02"), Tickers: tickers}, nil
+}
+
+// GetIndexMembershipsArgs represents a structure for handling GetIndexMembershipsArgs data.
+type GetIndexMembershipsArgs struct {
+	SecurityID int    `json:"securityId"`
+	Date       string `json:"date,omitempty"` // YYYY-MM-DD, defaults to today
+}
+
+// GetIndexMemberships returns the indices a security belonged to on a date,
+// using the ticker it traded under then.
+func GetIndexMemberships(conn *data.Conn, _ int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetIndexMembershipsArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("invalid args: %v", err)
+	}
+	date, err := membershipDate(args.Date)
+	if err != nil {
+		return nil, err
+	}
+	ticker, err := postgres.GetTicker(conn, args.SecurityID, date.Add(24*time.Hour-time.Second))
+	if err != nil {
+		return nil, fmt.Errorf("unknown security %d: %v", args.SecurityID, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return securities.IndexMemberships(ctx, conn, ticker, date)
+}
+
+func membershipDate(s string) (time.Time, error) {
+	if s == "" {
+		return securities.IndexDate(), nil
+	}
+	date, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date must be in YYYY-MM-DD format")
+	}
+	return date, nil
+}
@@ -1,9 +1,12 @@
 package helpers
 
 import (
+	"backend/internal/breaker"
 	"backend/internal/data"
 	"backend/internal/data/polygon"
 	"backend/internal/data/postgres"
+	"backend/internal/services/assets"
+	"backend/internal/services/lastprice"
 	"backend/internal/services/socket"
 	"context"
 	"database/sql"
@@ -205,7 +208,7 @@ func GetPopularTickers(conn *data.Conn, _ json.RawMessage) (interface{}, error)
 	SELECT 
 		s.securityid,
 		s.ticker,
-		COALESCE(s.icon, '') as icon,
+		COALESCE('/assets/' || s.icon_hash, s.icon, '') as icon,
 		COALESCE(s.name, '') as name
 	FROM popular_securities ps
 	JOIN securities s ON ps.securityid = s.securityid
@@ -226,6 +229,9 @@ func GetPopularTickers(conn *data.Conn, _ json.RawMessage) (interface{}, error)
 		}
 		// Set timestamp to 0 since we're filtering by timestamp = 0
 		result.Timestamp = 0
+		if assets.IsLegacy(result.Icon) {
+			assets.QueueSecurityMigration(conn, result.SecurityID)
+		}
 		results = append(results, result)
 	}
 
@@ -260,7 +266,7 @@ func GetUserLastTickers(conn *data.Conn, userID int, _ json.RawMessage) (interfa
 	SELECT 
 		s.securityid,
 		s.ticker,
-		COALESCE(s.icon, '') as icon,
+		COALESCE('/assets/' || s.icon_hash, s.icon, '') as icon,
 		COALESCE(s.name, '') as name
 	FROM recent_queries rq
 	JOIN securities s ON rq.securityid = s.securityid
@@ -283,6 +289,9 @@ func GetUserLastTickers(conn *data.Conn, userID int, _ json.RawMessage) (interfa
 		}
 		// Set timestamp to 0 since we're filtering by timestamp = 0
 		result.Timestamp = 0
+		if assets.IsLegacy(result.Icon) {
+			assets.QueueSecurityMigration(conn, result.SecurityID)
+		}
 		results = append(results, result)
 	}
 
@@ -312,62 +321,7 @@ func GetSecuritiesFromTicker(conn *data.Conn, rawArgs json.RawMessage) (interfac
 	if err := json.Unmarshal(rawArgs, &args); err != nil {
 		return nil, fmt.Errorf("getAnnotations invalid args: %v", err)
 	}
-
-	// Clean and prepare the search query
-	tickerQuery := strings.ToUpper(strings.TrimSpace(args.Ticker))
-	// Optimized query with improved indexing strategy and reduced similarity calculations
-	sqlQuery := `
-		SELECT  s.securityId,
-				s.ticker,
-				s.name,
-				s.icon,
-				s.maxDate
-		FROM    securities s
-		WHERE   s.maxDate IS NULL                      -- active symbols only
-		AND (                                         -- any match criteria
-				s.ticker_norm = $1
-			OR s.ticker_norm LIKE $1 || '%'
-			OR UPPER(s.name) LIKE $1 || '%'
-			OR UPPER(s.name) = $1
-			OR s.ticker_norm % $1
-			OR UPPER(s.name) % $1
-			)
-		ORDER BY
-				(s.ticker_norm = $1)                          DESC,
-				(UPPER(s.name) = $1)                          DESC,
-				(UPPER(s.name) LIKE $1 || '%')                DESC,
-				(s.ticker_norm LIKE $1 || '%')                DESC,
-				GREATEST(
-					similarity(s.ticker_norm, $1),
-					similarity(UPPER(s.name), $1)
-				)                                             DESC
-		LIMIT 10`
-
-	rows, err := conn.DB.Query(context.Background(), sqlQuery, tickerQuery)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var securities []GetSecurityFromTickerResults
-	for rows.Next() {
-		var security GetSecurityFromTickerResults
-		var timestamp sql.NullTime
-		var name, icon sql.NullString
-		if err := rows.Scan(&security.SecurityID, &security.Ticker, &name, &icon, &timestamp); err != nil {
-			return nil, err
-		}
-		if timestamp.Valid {
-			security.Timestamp = timestamp.Time.UnixMilli()
-		} else {
-			security.Timestamp = 0
-		}
-		// Properly assign name and icon from NullString
-		security.Name = name.String
-		security.Icon = icon.String
-		securities = append(securities, security)
-	}
-	return securities, nil
+	return SearchTickers(conn, args.Ticker)
 }
 func GetAgentTickerMenuDetails(conn *data.Conn, _ int, rawArgs json.RawMessage) (interface{}, error) {
 	var args GetTickerDetailsArgs
@@ -464,7 +418,8 @@ type GetTickerMenuDetailsResults struct {
 	WhyMovingContent            sql.NullString  `json:"why_moving_content,omitempty"`
 }
 
-// GetTickerMenuDetails performs operations related to GetTickerMenuDetails functionality.
+// GetTickerMenuDetails returns a security's details for the ticker menu,
+// cached per security (see tickerDetailsCache.go)
 func GetTickerMenuDetails(conn *data.Conn, rawArgs json.RawMessage) (interface{}, error) {
 	var args GetTickerDetailsArgs
 	if err := json.Unmarshal(rawArgs, &args); err != nil {
@@ -485,8 +440,8 @@ func GetTickerMenuDetails(conn *data.Conn, rawArgs json.RawMessage) (interface{}
 			END as active,
 			NULLIF(s.market_cap, 0),  -- This will convert 0 to NULL
 			NULLIF(s.description, '') as description,
-			NULLIF(s.logo, '') as logo,
-			NULLIF(s.icon, '') as icon,
+			COALESCE('/assets/' || s.logo_hash, NULLIF(s.logo, '')) as logo,
+			COALESCE('/assets/' || s.icon_hash, NULLIF(s.icon, '')) as icon,
 			s.share_class_shares_outstanding,
 			NULLIF(s.industry, '') as industry,
 			NULLIF(s.sector, '') as sector,
@@ -521,31 +476,37 @@ func GetTickerMenuDetails(conn *data.Conn, rawArgs json.RawMessage) (interface{}
 		ORDER BY s.maxDate IS NULL DESC, s.maxDate DESC NULLS FIRST
 		LIMIT 1`
 
-	var results GetTickerMenuDetailsResults
-	err := conn.DB.QueryRow(context.Background(), query, args.SecurityID).Scan(
-		&results.Ticker,
-		&results.Name,
-		&results.Market,
-		&results.Locale,
-		&results.PrimaryExchange,
-		&results.Active,
-		&results.MarketCap,
-		&results.Description,
-		&results.Logo,
-		&results.Icon,
-		&results.ShareClassSharesOutstanding,
-		&results.Industry,
-		&results.Sector,
-		&results.TotalShares,
-		&results.ShareClassFigi,
-		&results.SicCode,
-		&results.SicDescription,
-		&results.TotalEmployees,
-		&results.WeightedSharesOutstanding,
-		&results.WhyMovingContent,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get ticker details: %v", err)
+	results, cached := cachedTickerDetails(conn, args.SecurityID)
+	if !cached {
+		err := conn.DB.QueryRow(context.Background(), query, args.SecurityID).Scan(
+			&results.Ticker,
+			&results.Name,
+			&results.Market,
+			&results.Locale,
+			&results.PrimaryExchange,
+			&results.Active,
+			&results.MarketCap,
+			&results.Description,
+			&results.Logo,
+			&results.Icon,
+			&results.ShareClassSharesOutstanding,
+			&results.Industry,
+			&results.Sector,
+			&results.TotalShares,
+			&results.ShareClassFigi,
+			&results.SicCode,
+			&results.SicDescription,
+			&results.TotalEmployees,
+			&results.WeightedSharesOutstanding,
+			&results.WhyMovingContent,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ticker details: %v", err)
+		}
+		cacheTickerDetails(conn, args.SecurityID, results)
+	}
+	if assets.IsLegacy(results.Logo.String) || assets.IsLegacy(results.Icon.String) {
+		assets.QueueSecurityMigration(conn, args.SecurityID)
 	}
 
 	// Create a map to store the results and handle NULL values
@@ -761,8 +722,8 @@ func GetTickerDetails(conn *data.Conn, _ int, rawArgs json.RawMessage) (interfac
 		MarketCap:                   details.MarketCap,
 		Description:                 details.Description,
 		ShareClassSharesOutstanding: details.ShareClassSharesOutstanding,
-		Logo:                        logoBase64,
-		Icon:                        iconBase64,
+		Logo:                        assetURL(conn, logoBase64),
+		Icon:                        assetURL(conn, iconBase64),
 		Sector:                      sector,
 		Industry:                    industry,
 		ShareClassFigi:              details.ShareClassFIGI,
@@ -775,6 +736,20 @@ func GetTickerDetails(conn *data.Conn, _ int, rawArgs json.RawMessage) (interfac
 	return response, nil
 }
 
+// assetURL stores a fetched image and returns the URL it is served from,
+// falling back to the inline data URL if it cannot be stored
+func assetURL(conn *data.Conn, dataURL string) string {
+	if dataURL == "" {
+		return ""
+	}
+	hash, err := assets.StoreDataURL(context.Background(), conn, dataURL)
+	if err != nil {
+		log.Printf("Warning: failed to store image asset: %v", err)
+		return dataURL
+	}
+	return assets.URL(hash)
+}
+
 // GetSecurityClassificationsResults represents a structure for handling GetSecurityClassificationsResults data.
 type GetSecurityClassificationsResults struct {
 	Sectors    []string `json:"sectors"`
@@ -880,15 +855,12 @@ func GetIcons(conn *data.Conn, _ int, rawArgs json.RawMessage) (interface{}, err
 	// Prepare a query to fetch icons for the given tickers
 	query := `
 		WITH latest_securities AS (
-			SELECT DISTINCT ON (ticker) ticker, icon
+			SELECT DISTINCT ON (ticker) ticker, securityid, icon, icon_hash
 			FROM securities
 			WHERE ticker = ANY($1) AND ticker IS NOT NULL AND ticker != ''
 			ORDER BY ticker, maxDate DESC NULLS FIRST
 		)
-		SELECT ticker, CASE 
-			WHEN icon IS NULL OR icon = '' THEN ''
-			ELSE icon 
-		END as icon
+		SELECT ticker, securityid, COALESCE('/assets/' || icon_hash, NULLIF(icon, ''), '') as icon
 		FROM latest_securities
 	`
 
@@ -904,7 +876,8 @@ func GetIcons(conn *data.Conn, _ int, rawArgs json.RawMessage) (interface{}, err
 	// Scan results into the map
 	for rows.Next() {
 		var nullableTicker, nullableIcon sql.NullString
-		if err := rows.Scan(&nullableTicker, &nullableIcon); err != nil {
+		var securityID int
+		if err := rows.Scan(&nullableTicker, &securityID, &nullableIcon); err != nil {
 			return nil, fmt.Errorf("failed to scan icon: %v", err)
 		}
 
@@ -912,6 +885,9 @@ func GetIcons(conn *data.Conn, _ int, rawArgs json.RawMessage) (interface{}, err
 		if !nullableTicker.Valid || nullableTicker.String == "" {
 			continue
 		}
+		if assets.IsLegacy(nullableIcon.String) {
+			assets.QueueSecurityMigration(conn, securityID)
+		}
 
 		// Add to the found icons map
 		foundIcons[nullableTicker.String] = nullableIcon.String
@@ -940,19 +916,27 @@ func GetIcons(conn *data.Conn, _ int, rawArgs json.RawMessage) (interface{}, err
 	return results, nil
 }
 
-// GetIcon performs operations to get a single icon for a ticker.
+// GetIcon returns the icon of a ticker as a data URL, for plot renderers and
+// other consumers that cannot fetch assets from the backend.
 func GetIcon(conn *data.Conn, ticker string) (string, error) {
 	// Validate ticker input
 	if ticker == "" {
 		return "", nil // Return empty string for empty ticker
 	}
 
-	var icon string
-	err := conn.DB.QueryRow(context.Background(), "SELECT COALESCE(icon, '') from securities where ticker = $1 and maxDate is NULL", ticker).Scan(&icon)
+	var icon, iconHash string
+	err := conn.DB.QueryRow(context.Background(), "SELECT COALESCE(icon, ''), COALESCE(icon_hash, '') from securities where ticker = $1 and maxDate is NULL", ticker).Scan(&icon, &iconHash)
 	if err != nil {
 		return "", nil // Return empty string on error, don't propagate error
 	}
-	return icon, nil
+	if iconHash == "" {
+		return icon, nil
+	}
+	asset, err := assets.Load(context.Background(), conn, iconHash)
+	if err != nil {
+		return "", nil
+	}
+	return asset.DataURL(), nil
 }
 
 type GetCurrentSecurityIDArgs struct {
@@ -1070,6 +1054,58 @@ type GetTickerDailySnapshotResults struct {
 	Low                float64 `json:"low"`
 	Close              float64 `json:"close"`
 	PreviousClose      float64 `json:"previousClose"`
+	Stale              bool    `json:"stale,omitempty"` // served from cache while Polygon is unavailable
+}
+
+// snapshotCacheTTL is how long a ticker's last good snapshot is kept to stand
+// in for Polygon while its circuit breaker is open
+const snapshotCacheTTL = 24 * time.Hour
+
+func snapshotCacheKey(ticker string) string {
+	return "snapshot:" + strings.ToUpper(ticker)
+}
+
+func cacheSnapshot(conn *data.Conn, ticker string, snapshot GetTickerDailySnapshotResults) {
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := conn.Cache.Set(ctx, snapshotCacheKey(ticker), raw, snapshotCacheTTL).Err(); err != nil {
+		log.Printf("⚠️ Caching snapshot for %s failed: %v", ticker, err)
+	}
+}
+
+// DropCachedSnapshot forgets the last good snapshot of ticker
+func DropCachedSnapshot(ctx context.Context, conn *data.Conn, ticker string) error {
+	if err := conn.Cache.Del(ctx, snapshotCacheKey(ticker)).Err(); err != nil {
+		return fmt.Errorf("error dropping cached snapshot of %s: %v", ticker, err)
+	}
+	return nil
+}
+
+// cachedSnapshot returns the last good snapshot of ticker, marked stale
+func cachedSnapshot(conn *data.Conn, ticker string) (GetTickerDailySnapshotResults, bool) {
+	var snapshot GetTickerDailySnapshotResults
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	raw, err := conn.Cache.Get(ctx, snapshotCacheKey(ticker)).Bytes()
+	if err != nil || json.Unmarshal(raw, &snapshot) != nil {
+		return snapshot, false
+	}
+	snapshot.Stale = true
+	withLastPrice(ctx, conn, ticker, &snapshot)
+	return snapshot, true
+}
+
+// withLastPrice brings a cached snapshot's last trade price up to date from
+// the last-price cache when it holds a newer trade
+func withLastPrice(ctx context.Context, conn *data.Conn, ticker string, snapshot *GetTickerDailySnapshotResults) {
+	last, ok := lastprice.Get(ctx, conn, ticker)
+	if ok && last.TradeAt.Unix() > snapshot.Timestamp {
+		snapshot.LastTradePrice = last.Price
+	}
 }
 
 func GetTickerDailySnapshot(conn *data.Conn, _ int, rawArgs json.RawMessage) (interface{}, error) {
@@ -1080,12 +1116,24 @@ func GetTickerDailySnapshot(conn *data.Conn, _ int, rawArgs json.RawMessage) (in
 	}
 	ticker := args.Ticker
 
+	// While Polygon is down, answer from the last good snapshot
+	if !breaker.Polygon.Allow() {
+		if cached, ok := cachedSnapshot(conn, ticker); ok {
+			return cached, nil
+		}
+		return nil, breaker.Polygon.Unavailable()
+	}
 	res, err := polygon.GetPolygonTickerSnapshot(context.Background(), conn.Polygon, ticker)
+	breaker.Polygon.Record(polygon.Outage(err))
 	if err != nil {
+		if cached, ok := cachedSnapshot(conn, ticker); ok && polygon.Outage(err) != nil {
+			return cached, nil
+		}
 		return nil, fmt.Errorf("error getting ticker snapshot: %v", err)
 	}
 	snapshot := res.Snapshot
 	var results GetTickerDailySnapshotResults
+	results.Ticker = ticker
 	results.LastTradePrice = snapshot.LastTrade.Price
 	currPrice := snapshot.Day.Close
 	lastClose := snapshot.PrevDay.Close
@@ -1097,6 +1145,7 @@ func GetTickerDailySnapshot(conn *data.Conn, _ int, rawArgs json.RawMessage) (in
 	results.Low = snapshot.Day.Low
 	results.Close = snapshot.Day.Close
 	results.PreviousClose = lastClose
+	cacheSnapshot(conn, ticker, results)
 	return results, nil
 }
 
@@ -1144,8 +1193,13 @@ type GetLastPriceArgs struct {
 type GetLastPriceResults struct {
 	Ticker string  `json:"ticker"`
 	Price  float64 `json:"price"`
+	Stale  bool    `json:"stale,omitempty"`
 }
 
+// lastPriceMaxAge is how old a cached price GetLastPrice answers with before
+// asking Polygon
+const lastPriceMaxAge = 15 * time.Second
+
 func GetLastPrice(conn *data.Conn, _ int, rawArgs json.RawMessage) (interface{}, error) {
 	var args GetLastPriceArgs
 	if err := json.Unmarshal(rawArgs, &args); err != nil {
@@ -1154,13 +1208,18 @@ func GetLastPrice(conn *data.Conn, _ int, rawArgs json.RawMessage) (interface{},
 
 	trades := make([]GetLastPriceResults, len(args.Tickers))
 	for i, ticker := range args.Tickers {
-		trade, err := polygon.GetLastTrade(conn.Polygon, ticker, true)
+		last, err := lastprice.Lookup(context.Background(), conn, ticker, lastPriceMaxAge)
 		if err != nil {
-			return nil, fmt.Errorf("error getting last trade: %v", err)
+			if cached, ok := cachedSnapshot(conn, ticker); ok {
+				trades[i] = GetLastPriceResults{Ticker: ticker, Price: cached.LastTradePrice, Stale: true}
+				continue
+			}
+			return nil, fmt.Errorf("error getting last trade: %w", err)
 		}
 		trades[i] = GetLastPriceResults{
 			Ticker: ticker,
-			Price:  trade.Price,
+			Price:  last.Price,
+			Stale:  last.Stale,
 		}
 	}
 	return trades, nil
@@ -0,0 +1,205 @@
+package helpers
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/breaker"
+	"backend/internal/data"
+	"backend/internal/data/polygon"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/polygon-io/client-go/rest/models"
+)
+
+const (
+	// maxSnapshotTickers caps one getSnapshotsForTickers request; later tickers get an error
+	maxSnapshotTickers = 100
+	// maxSnapshotPayloadBytes caps the encoded snapshots returned in one response
+	maxSnapshotPayloadBytes = 64 << 10
+)
+
+// GetSnapshotsForTickersArgs represents the arguments for GetSnapshotsForTickers
+type GetSnapshotsForTickersArgs struct {
+	Tickers []string `json:"tickers"`
+}
+
+// TickerSnapshotError explains why a ticker has no snapshot in the response
+type TickerSnapshotError struct {
+	Ticker string `json:"ticker"`
+	Error  string `json:"error"`
+}
+
+// GetSnapshotsForTickersResults holds the snapshots found, in request order,
+// and an error for every ticker left out
+type GetSnapshotsForTickersResults struct {
+	Snapshots []GetTickerDailySnapshotResults `json:"snapshots"`
+	Errors    []TickerSnapshotError           `json:"errors,omitempty"`
+	// Truncated is set when tickers were dropped for the ticker or size cap
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// GetSnapshotsForTickers returns daily snapshots for a handful of tickers with
+// one Polygon request, falling back to the cached snapshots in one Redis
+// round trip for tickers Polygon can't answer
+func GetSnapshotsForTickers(conn *data.Conn, _ int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetSnapshotsForTickersArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	var results GetSnapshotsForTickersResults
+	tickers := make([]string, 0, len(args.Tickers))
+	seen := map[string]bool{}
+	for _, t := range args.Tickers {
+		t = strings.ToUpper(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		if len(tickers) == maxSnapshotTickers {
+			results.Errors = append(results.Errors, TickerSnapshotError{t, fmt.Sprintf("over the %d ticker limit", maxSnapshotTickers)})
+			results.Truncated = true
+			continue
+		}
+		tickers = append(tickers, t)
+	}
+	if len(tickers) == 0 {
+		return nil, apperr.Validation("tickers is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	found := make(map[string]GetTickerDailySnapshotResults, len(tickers))
+	var fetchErr error
+	if breaker.Polygon.Allow() {
+		res, err := polygon.GetPolygonTickerSnapshots(ctx, conn.Polygon, tickers)
+		breaker.Polygon.Record(polygon.Outage(err))
+		if err != nil {
+			fetchErr = err
+		} else {
+			for _, s := range res.Tickers {
+				if seen[s.Ticker] {
+					found[s.Ticker] = snapshotResult(s)
+				}
+			}
+			cacheSnapshots(ctx, conn, found)
+		}
+	} else {
+		fetchErr = breaker.Polygon.Unavailable()
+	}
+
+	var missing []string
+	for _, t := range tickers {
+		if _, ok := found[t]; !ok {
+			missing = append(missing, t)
+		}
+	}
+	for t, s := range cachedSnapshots(ctx, conn, missing) {
+		found[t] = s
+	}
+
+	size := 0
+	for _, t := range tickers {
+		s, ok := found[t]
+		if !ok {
+			msg := "no snapshot available"
+			if fetchErr != nil {
+				msg = "market data is unavailable and no cached snapshot exists"
+			}
+			results.Errors = append(results.Errors, TickerSnapshotError{t, msg})
+			continue
+		}
+		raw, _ := json.Marshal(s)
+		if size+len(raw) > maxSnapshotPayloadBytes {
+			results.Errors = append(results.Errors, TickerSnapshotError{t, "left out to keep the response small"})
+			results.Truncated = true
+			continue
+		}
+		size += len(raw)
+		results.Snapshots = append(results.Snapshots, s)
+	}
+	if len(results.Snapshots) == 0 && fetchErr != nil {
+		return nil, fmt.Errorf("error getting ticker snapshots: %v", fetchErr)
+	}
+	if results.Snapshots == nil {
+		results.Snapshots = []GetTickerDailySnapshotResults{}
+	}
+	return results, nil
+}
+
+// snapshotResult converts a Polygon snapshot the way GetTickerDailySnapshot does
+func snapshotResult(s models.TickerSnapshot) GetTickerDailySnapshotResults {
+	currPrice := s.Day.Close
+	lastClose := s.PrevDay.Close
+	r := GetTickerDailySnapshotResults{
+		Ticker:         s.Ticker,
+		LastTradePrice: s.LastTrade.Price,
+		Timestamp:      int64(time.Time(s.Updated).Unix()),
+		Volume:         s.Day.Volume,
+		Vwap:           s.Day.VolumeWeightedAverage,
+		Open:           s.Day.Open,
+		High:           s.Day.High,
+		Low:            s.Day.Low,
+		Close:          currPrice,
+		PreviousClose:  lastClose,
+		TodayChange:    float64(int((currPrice-lastClose)*1000)) / 1000,
+	}
+	if lastClose != 0 {
+		r.TodayChangePercent = float64(int(((currPrice-lastClose)/lastClose)*100*1000)) / 1000
+	}
+	return r
+}
+
+// cacheSnapshots stores fresh snapshots as fallbacks in one pipeline
+func cacheSnapshots(ctx context.Context, conn *data.Conn, snapshots map[string]GetTickerDailySnapshotResults) {
+	if len(snapshots) == 0 {
+		return
+	}
+	_, err := conn.Cache.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for t, s := range snapshots {
+			if raw, err := json.Marshal(s); err == nil {
+				pipe.Set(ctx, snapshotCacheKey(t), raw, snapshotCacheTTL)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("⚠️ Caching %d snapshots failed: %v", len(snapshots), err)
+	}
+}
+
+// cachedSnapshots looks up the last good snapshots of tickers in one
+// pipeline, marked stale; tickers without one are left out
+func cachedSnapshots(ctx context.Context, conn *data.Conn, tickers []string) map[string]GetTickerDailySnapshotResults {
+	out := map[string]GetTickerDailySnapshotResults{}
+	if len(tickers) == 0 {
+		return out
+	}
+	cmds := make([]*redis.StringCmd, len(tickers))
+	// redis.Nil for uncached tickers makes Exec report an error; each command is checked instead
+	_, _ = conn.Cache.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, t := range tickers {
+			cmds[i] = pipe.Get(ctx, snapshotCacheKey(t))
+		}
+		return nil
+	})
+	for i, t := range tickers {
+		raw, err := cmds[i].Bytes()
+		if err != nil {
+			continue
+		}
+		var s GetTickerDailySnapshotResults
+		if json.Unmarshal(raw, &s) != nil {
+			continue
+		}
+		s.Stale = true
+		withLastPrice(ctx, conn, t, &s)
+		out[t] = s
+	}
+	return out
+}
@@ -0,0 +1,83 @@
+package helpers
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// The ticker menu asks for a security's details every time it opens, and the
+// same handful of tickers get opened over and over, so the details are cached
+// per security. The why-moving summary in them is up to six hours old anyway;
+// the TTL bounds how stale the rest gets, and the security reconciliation
+// drops the cache once it has changed securities.
+const (
+	tickerDetailsCacheTTL    = 10 * time.Minute
+	tickerDetailsCachePrefix = "ticker_details:"
+)
+
+func tickerDetailsCacheKey(securityID int) string {
+	return fmt.Sprintf("%s%d", tickerDetailsCachePrefix, securityID)
+}
+
+func cachedTickerDetails(conn *data.Conn, securityID int) (GetTickerMenuDetailsResults, bool) {
+	var results GetTickerMenuDetailsResults
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	raw, err := conn.Cache.Get(ctx, tickerDetailsCacheKey(securityID)).Bytes()
+	if err != nil {
+		return results, false
+	}
+	if err := json.Unmarshal(raw, &results); err != nil {
+		return results, false
+	}
+	return results, true
+}
+
+func cacheTickerDetails(conn *data.Conn, securityID int, results GetTickerMenuDetailsResults) {
+	raw, err := json.Marshal(results)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := conn.Cache.Set(ctx, tickerDetailsCacheKey(securityID), raw, tickerDetailsCacheTTL).Err(); err != nil {
+		log.Printf("⚠️ Caching ticker details for security %d failed: %v", securityID, err)
+	}
+}
+
+// DropTickerDetailsCache drops every cached ticker menu details entry and
+// returns how many it dropped
+func DropTickerDetailsCache(conn *data.Conn) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	dropped, err := dropCached(ctx, conn, tickerDetailsCachePrefix)
+	if err != nil {
+		return dropped, fmt.Errorf("error dropping cached ticker details: %v", err)
+	}
+	return dropped, nil
+}
+
+// dropCached deletes the cache keys under prefix
+func dropCached(ctx context.Context, conn *data.Conn, prefix string) (int, error) {
+	var cursor uint64
+	dropped := 0
+	for {
+		keys, next, err := conn.Cache.Scan(ctx, cursor, prefix+"*", 500).Result()
+		if err != nil {
+			return dropped, err
+		}
+		if len(keys) > 0 {
+			if err := conn.Cache.Del(ctx, keys...).Err(); err != nil {
+				return dropped, err
+			}
+			dropped += len(keys)
+		}
+		if cursor = next; cursor == 0 {
+			return dropped, nil
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package helpers
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Bulk ticker resolution turns symbols from imports and chat into securities
+// and says how each one matched. Symbols are compared the way the securities
+// table normalizes them (ticker_norm), so BRK.B, BRK-B, BRK/B and
+// NYSE:BRK.B are the same symbol. Without an as-of date a current listing
+// wins; failing that, a symbol a security has since moved away from resolves
+// to that security (renamed) or to its last listing (delisted). With an as-of
+// date only the listings active that day count.
+const (
+	// Resolution statuses
+	TickerExact      = "exact"      // listed under exactly this ticker
+	TickerNormalized = "normalized" // listed under the same ticker written differently
+	TickerRenamed    = "renamed"    // a former ticker of a security that now trades under another
+	TickerDelisted   = "delisted"   // the last ticker of a security that no longer trades
+	TickerAmbiguous  = "ambiguous"  // several securities used it; see Candidates
+	TickerUnknown    = "unknown"    // no security used it; Candidates are near misses
+	TickerInvalid    = "invalid"    // can't be a ticker
+
+	maxResolveTickers = 1000
+	// unknown symbols beyond this many get no suggestions
+	maxTickerSuggestionLookups = 50
+	tickerSuggestionsPerSymbol = 3
+)
+
+var resolvableTicker = regexp.MustCompile(`^[A-Z][A-Z0-9.\-/]{0,11}$`)
+
+// TickerCandidate is a security a symbol may refer to
+type TickerCandidate struct {
+	SecurityID int        `json:"securityId"`
+	Ticker     string     `json:"ticker"`
+	Name       string     `json:"name,omitempty"`
+	ListedFrom *time.Time `json:"listedFrom,omitempty"`
+	ListedTo   *time.Time `json:"listedTo,omitempty"` // nil while listed
+}
+
+// TickerResolution is how one symbol resolved
+type TickerResolution struct {
+	Input      string `json:"input"`
+	Status     string `json:"status"`
+	SecurityID int    `json:"securityId,omitempty"`
+	// Ticker is the security's ticker on the as-of date, or its current
+	// ticker (its last one if delisted) without one
+	Ticker string `json:"ticker,omitempty"`
+	Name   string `json:"name,omitempty"`
+	// CurrentTicker is set when the security trades under another ticker today
+	CurrentTicker string            `json:"currentTicker,omitempty"`
+	DelistedAt    *time.Time        `json:"delistedAt,omitempty"`
+	Candidates    []TickerCandidate `json:"candidates,omitempty"`
+}
+
+// Resolved reports whether the symbol resolved to a single security
+func (r TickerResolution) Resolved() bool {
+	return r.SecurityID != 0
+}
+
+// NormalizeTicker reduces a symbol to the securities table's ticker_norm
+// form, so symbols that normalize alike are the same ticker
+func NormalizeTicker(symbol string) string {
+	return strings.NewReplacer(".", "", "-", "", "/", "", " ", "").Replace(CleanTicker(symbol))
+}
+
+// CleanTicker upper-cases a symbol and strips quoting, a cashtag and an
+// exchange prefix ("NASDAQ:AAPL")
+func CleanTicker(symbol string) string {
+	s := strings.Trim(strings.TrimSpace(symbol), `"'`)
+	s = strings.TrimPrefix(s, "$")
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.ToUpper(strings.TrimSpace(s))
+}
+
+type securityListing struct {
+	TickerCandidate
+	currentTicker string
+	delistedAt    *time.Time // when the security stopped trading, under whatever ticker
+}
+
+func (l securityListing) activeOn(t time.Time) bool {
+	return (l.ListedFrom == nil || !l.ListedFrom.After(t)) && (l.ListedTo == nil || !l.ListedTo.Before(t))
+}
+
+// ResolveTickers resolves symbols in bulk, one resolution per symbol in the
+// order given. asOf, if not nil, resolves them as of that time.
+func ResolveTickers(ctx context.Context, conn *data.Conn, symbols []string, asOf *time.Time) ([]TickerResolution, error) {
+	if len(symbols) > maxResolveTickers {
+		return nil, apperr.Validation("at most %d tickers can be resolved at once", maxResolveTickers)
+	}
+	keys := make([]string, len(symbols))
+	for i, symbol := range symbols {
+		keys[i] = NormalizeTicker(symbol)
+	}
+
+	rows, err := conn.DB.Query(ctx, `
+		SELECT s.ticker_norm, s.securityId, s.ticker, COALESCE(s.name, ''), s.minDate, s.maxDate,
+		       COALESCE(cur.ticker, ''),
+		       CASE WHEN cur.securityId IS NULL
+		            THEN (SELECT MAX(x.maxDate) FROM securities x WHERE x.securityId = s.securityId)
+		       END
+		FROM securities s
+		LEFT JOIN securities cur ON cur.securityId = s.securityId AND cur.maxDate IS NULL
+		WHERE s.ticker_norm = ANY($1::text[])`,
+		keys)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up tickers: %v", err)
+	}
+	defer rows.Close()
+	listings := map[string][]securityListing{}
+	for rows.Next() {
+		var key string
+		var l securityListing
+		if err := rows.Scan(&key, &l.SecurityID, &l.Ticker, &l.Name, &l.ListedFrom, &l.ListedTo, &l.currentTicker, &l.delistedAt); err != nil {
+			return nil, fmt.Errorf("error scanning securities: %v", err)
+		}
+		listings[key] = append(listings[key], l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error looking up tickers: %v", err)
+	}
+
+	resolutions := make([]TickerResolution, len(symbols))
+	var unknown []int
+	for i, symbol := range symbols {
+		resolutions[i] = resolveTicker(symbol, listings[keys[i]], asOf)
+		if resolutions[i].Status == TickerUnknown && len(resolutions[i].Candidates) == 0 {
+			unknown = append(unknown, i)
+		}
+	}
+	if len(unknown) > maxTickerSuggestionLookups {
+		unknown = unknown[:maxTickerSuggestionLookups]
+	}
+	if err := suggestTickers(ctx, conn, resolutions, keys, unknown); err != nil {
+		return nil, err
+	}
+	return resolutions, nil
+}
+
+func resolveTicker(symbol string, listings []securityListing, asOf *time.Time) TickerResolution {
+	res := TickerResolution{Input: symbol, Status: TickerUnknown}
+	cleaned := CleanTicker(symbol)
+	if !resolvableTicker.MatchString(cleaned) {
+		res.Status = TickerInvalid
+		return res
+	}
+
+	// Narrow to the listings that count, then to one listing per security
+	var matching []securityListing
+	for _, l := range listings {
+		if asOf == nil && l.ListedTo == nil || asOf != nil && l.activeOn(*asOf) {
+			matching = append(matching, l)
+		}
+	}
+	if len(matching) == 0 && asOf == nil {
+		matching = listings
+	}
+	if len(matching) == 0 {
+		// Listed, just not on that date
+		for _, l := range listings {
+			res.Candidates = append(res.Candidates, l.TickerCandidate)
+		}
+		sortCandidates(res.Candidates)
+		return res
+	}
+	latest := map[int]securityListing{}
+	for _, l := range matching {
+		if prev, ok := latest[l.SecurityID]; !ok || listedAfter(l, prev) {
+			latest[l.SecurityID] = l
+		}
+	}
+	if len(latest) > 1 {
+		res.Status = TickerAmbiguous
+		for _, l := range latest {
+			res.Candidates = append(res.Candidates, l.TickerCandidate)
+		}
+		sortCandidates(res.Candidates)
+		return res
+	}
+
+	var l securityListing
+	for _, only := range latest {
+		l = only
+	}
+	res.SecurityID, res.Ticker, res.Name = l.SecurityID, l.Ticker, l.Name
+	if l.currentTicker != "" && l.currentTicker != l.Ticker {
+		res.CurrentTicker = l.currentTicker
+	}
+	switch {
+	case asOf == nil && l.ListedTo != nil && l.currentTicker != "":
+		res.Status = TickerRenamed
+		res.Ticker, res.CurrentTicker = l.currentTicker, ""
+	case asOf == nil && l.ListedTo != nil:
+		res.Status = TickerDelisted
+	case l.Ticker == cleaned:
+		res.Status = TickerExact
+	default:
+		res.Status = TickerNormalized
+	}
+	res.DelistedAt = l.delistedAt
+	return res
+}
+
+// listedAfter reports whether a listing is more recent than another
+func listedAfter(a, b securityListing) bool {
+	if a.ListedTo == nil || b.ListedTo == nil {
+		return a.ListedTo == nil && b.ListedTo != nil
+	}
+	return a.ListedTo.After(*b.ListedTo)
+}
+
+// sortCandidates orders candidates current first, then most recently listed
+func sortCandidates(candidates []TickerCandidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i].ListedTo, candidates[j].ListedTo
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return a.After(*b)
+	})
+}
+
+// suggestTickers fills in the listed tickers closest to each unknown symbol
+func suggestTickers(ctx context.Context, conn *data.Conn, resolutions []TickerResolution, keys []string, unknown []int) error {
+	if len(unknown) == 0 {
+		return nil
+	}
+	queries := make([]string, len(unknown))
+	for i, idx := range unknown {
+		queries[i] = keys[idx]
+	}
+	rows, err := conn.DB.Query(ctx, `
+		SELECT q.n, t.securityid, t.ticker, COALESCE(s.name, ''), s.minDate
+		FROM unnest($1::text[]) WITH ORDINALITY AS q(query, n)
+		CROSS JOIN LATERAL (
+			SELECT securityid, ticker, similarity(ticker_norm, q.query) AS closeness, popularity
+			FROM ticker_search_index
+			WHERE ticker_norm % q.query
+			ORDER BY closeness DESC, popularity DESC
+			LIMIT $2
+		) t
+		JOIN securities s ON s.securityid = t.securityid AND s.maxDate IS NULL
+		ORDER BY q.n, t.closeness DESC, t.popularity DESC`,
+		queries, tickerSuggestionsPerSymbol)
+	if err != nil {
+		return fmt.Errorf("error looking up ticker suggestions: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var n int
+		var c TickerCandidate
+		if err := rows.Scan(&n, &c.SecurityID, &c.Ticker, &c.Name, &c.ListedFrom); err != nil {
+			return fmt.Errorf("error scanning ticker suggestions: %v", err)
+		}
+		idx := unknown[n-1]
+		resolutions[idx].Candidates = append(resolutions[idx].Candidates, c)
+	}
+	return rows.Err()
+}
+
+// ResolveTickersArgs represents a structure for handling ResolveTickersArgs data.
+type ResolveTickersArgs struct {
+	Tickers []string `json:"tickers"`
+	// AsOf is a date (2006-01-02) or timestamp (RFC 3339) to resolve the
+	// tickers as of; empty for today
+	AsOf string `json:"asOf,omitempty"`
+}
+
+// ResolveTickersResult is the resolution of each ticker, in the order given
+type ResolveTickersResult struct {
+	Resolutions []TickerResolution `json:"resolutions"`
+	Resolved    int                `json:"resolved"`
+	Unresolved  int                `json:"unresolved"`
+}
+
+// GetTickerResolutions resolves a list of tickers to securities, reporting
+// how each matched and the candidates of those that didn't
+func GetTickerResolutions(conn *data.Conn, _ int, rawArgs json.RawMessage) (interface{}, error) {
+	var args ResolveTickersArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if len(args.Tickers) == 0 {
+		return nil, apperr.Validation("tickers is required")
+	}
+	var asOf *time.Time
+	if args.AsOf != "" {
+		t, err := time.Parse(time.RFC3339, args.AsOf)
+		if err != nil {
+			// A date means the end of that day, so anything listed during it counts
+			t, err = time.Parse("2006-01-02", args.AsOf)
+			if err != nil {
+				return nil, apperr.Validation("asOf must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+			}
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		asOf = &t
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	resolutions, err := ResolveTickers(ctx, conn, args.Tickers, asOf)
+	if err != nil {
+		return nil, err
+	}
+	result := ResolveTickersResult{Resolutions: resolutions}
+	for _, r := range resolutions {
+		if r.Resolved() {
+			result.Resolved++
+		} else {
+			result.Unresolved++
+		}
+	}
+	return result, nil
+}
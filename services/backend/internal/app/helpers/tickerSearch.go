@@ -0,0 +1,176 @@
+package helpers
+
+import (
+	"backend/internal/data"
+	"backend/internal/services/assets"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Ticker search runs against ticker_search_index (migration 129), a
+// materialized view of listed securities with trigram, prefix and full-text
+// indexes and a popularity score from dollar volume and market cap. Matches
+// are tiered, exact ticker first, then ticker prefix, exact name, name prefix,
+// a prefix of any word in the name, and last fuzzy matches that tolerate
+// typos; within a tier the more liquid name wins. Short queries are mostly
+// the same few prefixes typed over and over, so their results are cached.
+const (
+	tickerSearchLimit = 10
+	// queries up to this many characters are cached
+	tickerSearchCacheMaxLen = 3
+	tickerSearchCacheTTL    = 10 * time.Minute
+	tickerSearchCachePrefix = "ticker_search:"
+)
+
+const tickerSearchQuery = `
+	SELECT s.securityId,
+	       s.ticker,
+	       s.name,
+	       COALESCE('/assets/' || s.icon_hash, s.icon),
+	       s.maxDate
+	FROM (
+		SELECT t.securityid,
+		       row_number() OVER (
+		           ORDER BY tier,
+		                    CASE WHEN tier = 5 THEN closeness END DESC NULLS LAST,
+		                    t.popularity DESC,
+		                    t.ticker_norm
+		       ) AS rank
+		FROM ticker_search_index t
+		CROSS JOIN LATERAL (
+			SELECT CASE
+			           WHEN t.ticker_norm = $1 THEN 0
+			           WHEN t.ticker_norm LIKE $1 || '%' THEN 1
+			           WHEN t.name_upper = $2 THEN 2
+			           WHEN t.name_upper LIKE $2 || '%' THEN 3
+			           WHEN $3 <> '' AND t.name_tsv @@ to_tsquery('simple', $3) THEN 4
+			           ELSE 5
+			       END AS tier,
+			       GREATEST(similarity(t.ticker_norm, $1), word_similarity($2, t.name_upper)) AS closeness
+		) m
+		WHERE t.ticker_norm LIKE $1 || '%'
+		   OR t.name_upper LIKE $2 || '%'
+		   OR ($3 <> '' AND t.name_tsv @@ to_tsquery('simple', $3))
+		   OR t.ticker_norm % $1
+		   OR $2 <% t.name_upper
+		ORDER BY rank
+		LIMIT $4
+	) r
+	JOIN securities s ON s.securityid = r.securityid AND s.maxDate IS NULL
+	ORDER BY r.rank`
+
+// nameTSQuery turns a query into a prefix match on every word, e.g.
+// "bank of am" into "bank:* & of:* & am:*". Words are reduced to letters
+// and digits so the result is always valid tsquery syntax.
+func nameTSQuery(query string) string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+func tickerSearchCacheKey(query string) string {
+	return tickerSearchCachePrefix + query
+}
+
+// SearchTickers returns the best matches for query, a ticker or company name
+// as the user typed it
+func SearchTickers(conn *data.Conn, query string) ([]GetSecurityFromTickerResults, error) {
+	nameQuery := strings.ToUpper(strings.Join(strings.Fields(query), " "))
+	tickerQuery := strings.ReplaceAll(strings.ReplaceAll(nameQuery, ".", ""), " ", "")
+
+	cacheable := len([]rune(nameQuery)) <= tickerSearchCacheMaxLen
+	if cacheable {
+		if cached, ok := cachedTickerSearch(conn, nameQuery); ok {
+			return cached, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), contextWithTimeout)
+	defer cancel()
+	rows, err := conn.DB.Query(ctx, tickerSearchQuery, tickerQuery, nameQuery, nameTSQuery(query), tickerSearchLimit)
+	if err != nil {
+		return nil, fmt.Errorf("error searching tickers: %v", err)
+	}
+	defer rows.Close()
+
+	securities := []GetSecurityFromTickerResults{}
+	for rows.Next() {
+		var security GetSecurityFromTickerResults
+		var timestamp sql.NullTime
+		var name, icon sql.NullString
+		if err := rows.Scan(&security.SecurityID, &security.Ticker, &name, &icon, &timestamp); err != nil {
+			return nil, fmt.Errorf("error scanning ticker search result: %v", err)
+		}
+		if timestamp.Valid {
+			security.Timestamp = timestamp.Time.UnixMilli()
+		}
+		security.Name = name.String
+		security.Icon = icon.String
+		if assets.IsLegacy(security.Icon) {
+			assets.QueueSecurityMigration(conn, security.SecurityID)
+		}
+		securities = append(securities, security)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading ticker search results: %v", err)
+	}
+
+	if cacheable {
+		cacheTickerSearch(conn, nameQuery, securities)
+	}
+	return securities, nil
+}
+
+func cachedTickerSearch(conn *data.Conn, query string) ([]GetSecurityFromTickerResults, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	raw, err := conn.Cache.Get(ctx, tickerSearchCacheKey(query)).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	var results []GetSecurityFromTickerResults
+	if err := json.Unmarshal(raw, &results); err != nil {
+		return nil, false
+	}
+	return results, true
+}
+
+func cacheTickerSearch(conn *data.Conn, query string, results []GetSecurityFromTickerResults) {
+	raw, err := json.Marshal(results)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := conn.Cache.Set(ctx, tickerSearchCacheKey(query), raw, tickerSearchCacheTTL).Err(); err != nil {
+		log.Printf("⚠️ Caching ticker search for %q failed: %v", query, err)
+	}
+}
+
+// RefreshTickerSearchIndex rebuilds ticker_search_index from the securities
+// table and drops the cached results built from the old one
+func RefreshTickerSearchIndex(conn *data.Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	start := time.Now()
+	if _, err := conn.DB.Exec(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY ticker_search_index`); err != nil {
+		return fmt.Errorf("error refreshing ticker search index: %v", err)
+	}
+
+	dropped, err := dropCached(ctx, conn, tickerSearchCachePrefix)
+	if err != nil {
+		return fmt.Errorf("error dropping cached ticker searches: %v", err)
+	}
+	log.Printf("✅ Ticker search index refreshed in %v, dropped %d cached searches", time.Since(start).Round(time.Millisecond), dropped)
+	return nil
+}
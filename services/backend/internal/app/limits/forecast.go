@@ -0,0 +1,241 @@
+package limits
+
+import (
+	"backend/internal/data"
+	email "backend/internal/services/email"
+	"backend/internal/services/socket"
+	"backend/internal/services/templates"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// Alert quotas warn before they run out. After an alert or strategy alert is
+// counted the user gets a socket notice and an email when usage crosses 80%
+// of their plan's limit, and again at 95%. A level is sent once and armed
+// again when usage drops back below it.
+
+// quotaWarningLevels are the warning thresholds in percent, highest first
+var quotaWarningLevels = []int{95, 80}
+
+const (
+	quotaWarningKeyFmt = "user:%d:quota_warning:%s" // last level warned about
+	quotaWarningTTL    = 30 * 24 * time.Hour
+	// forecastWindow is how far back creations are counted for the rate
+	forecastWindow = 14 * 24 * time.Hour
+	// upgradeHorizon is how soon a projected limit makes the forecast suggest upgrading
+	upgradeHorizon = 7 * 24 * time.Hour
+)
+
+// quotaStatus is a user's alert counters and limits
+type quotaStatus struct {
+	ActiveAlerts         int
+	AlertsLimit          int
+	ActiveStrategyAlerts int
+	StrategyAlertsLimit  int
+	PlanName             string
+	Email                string
+}
+
+func loadQuotaStatus(ctx context.Context, conn *data.Conn, userID int) (quotaStatus, error) {
+	var q quotaStatus
+	var plan sql.NullString
+	err := conn.DB.QueryRow(ctx, `
+		SELECT
+			COALESCE(u.active_alerts, 0),
+			COALESCE(sp.alerts_limit, 0),
+			COALESCE(u.active_strategy_alerts, 0),
+			COALESCE(sp.strategy_alerts_limit, 0),
+			u.subscription_plan,
+			COALESCE(u.email, '')
+		FROM users u
+		LEFT JOIN subscription_products sp ON sp.product_key = u.subscription_plan
+		WHERE u.userId = $1`, userID).Scan(
+		&q.ActiveAlerts, &q.AlertsLimit,
+		&q.ActiveStrategyAlerts, &q.StrategyAlertsLimit,
+		&plan, &q.Email,
+	)
+	if err != nil {
+		return q, fmt.Errorf("error loading alert quotas: %v", err)
+	}
+	q.PlanName = "Free"
+	if plan.Valid {
+		q.PlanName = plan.String
+	}
+	return q, nil
+}
+
+// usage returns the used and allowed amounts of a quota-limited usage type
+func (q quotaStatus) usage(usageType UsageType) (used, limit int) {
+	switch usageType {
+	case UsageTypeAlert:
+		return q.ActiveAlerts, q.AlertsLimit
+	case UsageTypeStrategyAlert:
+		return q.ActiveStrategyAlerts, q.StrategyAlertsLimit
+	}
+	return 0, 0
+}
+
+// warningLevel is the highest threshold usage has reached, or 0
+func warningLevel(used, limit int) int {
+	if limit <= 0 {
+		return 0
+	}
+	for _, level := range quotaWarningLevels {
+		if used*100 >= level*limit {
+			return level
+		}
+	}
+	return 0
+}
+
+// warnQuotaUsage tells the user when a quota crosses a warning level. It is
+// best effort; failures are only logged.
+func warnQuotaUsage(conn *data.Conn, userID int, usageType UsageType) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	q, err := loadQuotaStatus(ctx, conn, userID)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		return
+	}
+	used, limit := q.usage(usageType)
+	level := warningLevel(used, limit)
+	key := fmt.Sprintf(quotaWarningKeyFmt, userID, usageType)
+	if level == 0 {
+		conn.Cache.Del(ctx, key)
+		return
+	}
+	// GETSET so concurrent creations send a level once
+	prev, _ := conn.Cache.GetSet(ctx, key, level).Int()
+	conn.Cache.Expire(ctx, key, quotaWarningTTL)
+	if prev >= level {
+		return
+	}
+
+	warning := templates.New(templates.QuotaWarning, templates.Vars{
+		"Used":     used,
+		"Limit":    limit,
+		"Percent":  used * 100 / limit,
+		"Resource": string(usageType),
+		"Plan":     q.PlanName,
+	})
+	locale := templates.UserLocale(ctx, conn, userID)
+	socket.SendNoticeToUser(userID, "limit_warning", templates.Render(locale, templates.VariantText, warning))
+	if q.Email == "" || isDevEnvironment() {
+		return
+	}
+	subject, body := templates.RenderEmail(locale, warning, nil)
+	if err := email.SendEmail(q.Email, subject, body); err != nil {
+		log.Printf("Warning: failed to email %s quota warning to user %d: %v", usageType, userID, err)
+	}
+}
+
+func isDevEnvironment() bool {
+	env := strings.ToLower(os.Getenv("ENVIRONMENT"))
+	return env == "" || env == "dev" || env == "development"
+}
+
+// LimitForecast projects when a quota runs out at the recent creation rate
+type LimitForecast struct {
+	Resource      UsageType `json:"resource"`
+	Used          int       `json:"used"`
+	Limit         int       `json:"limit"`
+	PercentUsed   float64   `json:"percentUsed"`
+	WarningLevel  int       `json:"warningLevel"`  // 0, 80 or 95
+	CreatedPerDay float64   `json:"createdPerDay"` // averaged over the last 14 days
+	// DaysUntilLimit and ProjectedLimitAt are omitted while nothing is being created
+	DaysUntilLimit   *float64 `json:"daysUntilLimit,omitempty"`
+	ProjectedLimitAt *int64   `json:"projectedLimitAt,omitempty"` // ms since epoch
+	// SuggestUpgrade is set once a warning level is reached or the limit is projected within a week
+	SuggestUpgrade bool `json:"suggestUpgrade"`
+}
+
+// LimitForecastResult represents the result of GetLimitForecast
+type LimitForecastResult struct {
+	PlanName  string          `json:"planName"`
+	Forecasts []LimitForecast `json:"forecasts"`
+}
+
+// GetLimitForecast projects when the user will reach their alert and strategy
+// alert limits, so the UI can suggest upgrading before creation starts failing
+func GetLimitForecast(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	q, err := loadQuotaStatus(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	created := map[UsageType]int{}
+	rows, err := conn.DB.Query(ctx, `
+		SELECT usage_type, COALESCE(SUM(resource_consumed), 0)
+		FROM usage_logs
+		WHERE userId = $1 AND usage_type IN ($2, $3) AND created_at >= $4
+		GROUP BY usage_type`,
+		userID, string(UsageTypeAlert), string(UsageTypeStrategyAlert), time.Now().Add(-forecastWindow))
+	if err != nil {
+		return nil, fmt.Errorf("error loading recent alert usage: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var usageType string
+		var n int
+		if err := rows.Scan(&usageType, &n); err != nil {
+			return nil, fmt.Errorf("error scanning recent alert usage: %v", err)
+		}
+		created[UsageType(usageType)] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading recent alert usage: %v", err)
+	}
+
+	now := time.Now()
+	result := LimitForecastResult{PlanName: q.PlanName, Forecasts: []LimitForecast{}}
+	for _, usageType := range []UsageType{UsageTypeAlert, UsageTypeStrategyAlert} {
+		used, limit := q.usage(usageType)
+		f := LimitForecast{
+			Resource:      usageType,
+			Used:          used,
+			Limit:         limit,
+			WarningLevel:  warningLevel(used, limit),
+			CreatedPerDay: float64(created[usageType]) / forecastWindow.Hours() * 24,
+		}
+		if limit > 0 {
+			f.PercentUsed = math.Round(float64(used)*1000/float64(limit)) / 10
+		}
+		if days, ok := daysUntilLimit(used, limit, f.CreatedPerDay); ok {
+			at := now.Add(time.Duration(days * float64(24*time.Hour))).UnixMilli()
+			days = math.Round(days*10) / 10
+			f.DaysUntilLimit = &days
+			f.ProjectedLimitAt = &at
+		}
+		f.SuggestUpgrade = f.WarningLevel > 0 ||
+			(f.DaysUntilLimit != nil && *f.DaysUntilLimit <= upgradeHorizon.Hours()/24)
+		result.Forecasts = append(result.Forecasts, f)
+	}
+	return result, nil
+}
+
+// daysUntilLimit is how long the remaining quota lasts at the given rate; ok
+// is false when it isn't being used up
+func daysUntilLimit(used, limit int, perDay float64) (float64, bool) {
+	if limit <= 0 {
+		return 0, false
+	}
+	if used >= limit {
+		return 0, true
+	}
+	if perDay <= 0 {
+		return 0, false
+	}
+	return float64(limit-used) / perDay, true
+}
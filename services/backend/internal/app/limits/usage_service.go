@@ -238,6 +238,10 @@ func RecordUsage(conn *data.Conn, userID int, usageType UsageType, resourceConsu
 		return fmt.Errorf("error committing usage transaction: %v", err)
 	}
 
+	if usageType == UsageTypeAlert || usageType == UsageTypeStrategyAlert {
+		go warnQuotaUsage(conn, userID, usageType)
+	}
+
 	return nil
 }
 
@@ -474,3 +478,88 @@ func DecrementActiveStrategyAlerts(conn *data.Conn, userID int, alertsToRemove i
 
 	return nil
 }
+
+// GetSweepCombinationsLimit returns the maximum number of parameter combinations a
+// user's plan allows in a single strategy optimization sweep
+func GetSweepCombinationsLimit(conn *data.Conn, userID int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var limit int
+	err := conn.DB.QueryRow(ctx, `
+		SELECT COALESCE(
+			sp.sweep_combinations_limit,
+			(SELECT sweep_combinations_limit FROM subscription_products WHERE product_key = 'Free'),
+			0)
+		FROM users u
+		LEFT JOIN subscription_products sp ON sp.product_key = u.subscription_plan
+		WHERE u.userId = $1`, userID).Scan(&limit)
+	if err != nil {
+		return 0, fmt.Errorf("error getting sweep combinations limit: %v", err)
+	}
+	return limit, nil
+}
+
+// Bounds of a strategy alert's evaluation interval. The minimum is the alert
+// service's scan tick; a plan may raise it further.
+const (
+	MinStrategyAlertInterval = 10 * time.Second
+	MaxStrategyAlertInterval = 24 * time.Hour
+)
+
+// GetMinStrategyAlertInterval returns how often a user's plan allows a
+// strategy alert to be evaluated at most
+func GetMinStrategyAlertInterval(conn *data.Conn, userID int) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var seconds int
+	err := conn.DB.QueryRow(ctx, `
+		SELECT COALESCE(
+			sp.min_strategy_alert_interval_seconds,
+			(SELECT min_strategy_alert_interval_seconds FROM subscription_products WHERE product_key = 'Free'),
+			0)
+		FROM users u
+		LEFT JOIN subscription_products sp ON sp.product_key = u.subscription_plan
+		WHERE u.userId = $1`, userID).Scan(&seconds)
+	if err != nil {
+		return 0, fmt.Errorf("error getting minimum strategy alert interval: %v", err)
+	}
+	interval := time.Duration(seconds) * time.Second
+	if interval < MinStrategyAlertInterval {
+		interval = MinStrategyAlertInterval
+	}
+	return interval, nil
+}
+
+// TaskCostThresholds bound the estimated worker time of a backtest, or of a
+// strategy alert per trading day, on a plan: past Confirm it needs the user's
+// confirmation, past Limit it is refused
+type TaskCostThresholds struct {
+	Confirm time.Duration
+	Limit   time.Duration
+}
+
+// GetTaskCostThresholds returns the task cost thresholds of a user's plan
+func GetTaskCostThresholds(conn *data.Conn, userID int) (TaskCostThresholds, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var confirmSeconds, limitSeconds int
+	err := conn.DB.QueryRow(ctx, `
+		SELECT
+			COALESCE(sp.task_cost_confirm_seconds,
+				(SELECT task_cost_confirm_seconds FROM subscription_products WHERE product_key = 'Free'), 60),
+			COALESCE(sp.task_cost_limit_seconds,
+				(SELECT task_cost_limit_seconds FROM subscription_products WHERE product_key = 'Free'), 600)
+		FROM users u
+		LEFT JOIN subscription_products sp ON sp.product_key = u.subscription_plan
+		WHERE u.userId = $1`, userID).Scan(&confirmSeconds, &limitSeconds)
+	if err != nil {
+		return TaskCostThresholds{}, fmt.Errorf("error getting task cost thresholds: %v", err)
+	}
+	return TaskCostThresholds{
+		Confirm: time.Duration(confirmSeconds) * time.Second,
+		Limit:   time.Duration(limitSeconds) * time.Second,
+	}, nil
+}
@@ -0,0 +1,450 @@
+// Package onboarding provisions new accounts: default settings, starter
+// watchlists, a sample strategy and a welcome conversation. Signup queues
+// the account in user_onboarding and a background worker runs each step
+// that has not completed yet, so a failed or interrupted account is repaired
+// by queueing it again.
+package onboarding
+
+import (
+	"backend/internal/app/agent"
+	"backend/internal/app/strategy"
+	"backend/internal/app/watchlist"
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	pollInterval = 10 * time.Second
+	// a running account whose worker stopped updating it is claimed again
+	staleAfter  = 5 * time.Minute
+	maxAttempts = 5
+	retryDelay  = 30 * time.Second
+	stepTimeout = 30 * time.Second
+)
+
+// Onboarding statuses
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+const (
+	flagWatchlist    = "flag" // the frontend's flagged tickers list
+	starterWatchlist = "Mega Caps"
+	sampleTemplate   = "unusual_volume"
+	welcomeTitle     = "Welcome to Peripheral"
+)
+
+var starterTickers = []string{"AAPL", "MSFT", "NVDA", "AMZN", "GOOGL", "META", "TSLA"}
+
+// defaultSettings matches defaultSettings in the frontend stores
+var defaultSettings = map[string]interface{}{
+	"chartRows":              1,
+	"chartColumns":           1,
+	"dolvol":                 false,
+	"adrPeriod":              20,
+	"filterTaS":              true,
+	"divideTaS":              false,
+	"showFilings":            true,
+	"chatSuggestionsEnabled": true,
+	"emailAlertsOffline":     false,
+	"locale":                 "en",
+	"colorScheme":            "default",
+}
+
+// step is one provisioning step. Each checks what already exists, so running
+// it again after a partial failure never duplicates anything.
+type step struct {
+	name string
+	run  func(ctx context.Context, conn *data.Conn, userID int) error
+}
+
+var steps = []step{
+	{"settings", provisionSettings},
+	{"watchlists", provisionWatchlists},
+	{"sample_strategy", provisionSampleStrategy},
+	{"welcome_conversation", provisionWelcomeConversation},
+}
+
+// Status is an account's onboarding progress
+type Status struct {
+	UserID     int        `json:"userId"`
+	Status     string     `json:"status"`
+	StepsDone  []string   `json:"stepsDone"`
+	StepsTotal int        `json:"stepsTotal"`
+	Attempts   int        `json:"attempts"`
+	LastError  *string    `json:"lastError,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// EnqueueTx queues a new account for provisioning in the transaction that
+// creates it. An account that is already queued or provisioned is left alone.
+func EnqueueTx(ctx context.Context, tx pgx.Tx, userID int) error {
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO user_onboarding (user_id) VALUES ($1)
+		ON CONFLICT (user_id) DO NOTHING`, userID); err != nil {
+		return fmt.Errorf("error queueing onboarding for user %d: %v", userID, err)
+	}
+	return nil
+}
+
+// Requeue queues accounts again so their missing steps are run: one account,
+// or with userID 0 every failed account and every account that never got an
+// onboarding row. Completed steps are kept.
+func Requeue(ctx context.Context, conn *data.Conn, userID int) (int64, error) {
+	if userID != 0 {
+		tag, err := conn.DB.Exec(ctx, `
+			INSERT INTO user_onboarding (user_id) SELECT userId FROM users WHERE userId = $1
+			ON CONFLICT (user_id) DO UPDATE SET
+				status = 'queued', attempts = 0, last_error = NULL, finished_at = NULL, updated_at = NOW()
+			WHERE user_onboarding.status <> 'running'`, userID)
+		if err != nil {
+			return 0, fmt.Errorf("error requeueing onboarding for user %d: %v", userID, err)
+		}
+		return tag.RowsAffected(), nil
+	}
+	failed, err := conn.DB.Exec(ctx, `
+		UPDATE user_onboarding SET status = 'queued', attempts = 0, last_error = NULL, updated_at = NOW()
+		WHERE status = 'failed'`)
+	if err != nil {
+		return 0, fmt.Errorf("error requeueing failed onboarding: %v", err)
+	}
+	// userId 0 is the system user for public access
+	missing, err := conn.DB.Exec(ctx, `
+		INSERT INTO user_onboarding (user_id)
+		SELECT u.userId FROM users u
+		WHERE u.userId <> 0 AND NOT EXISTS (SELECT 1 FROM user_onboarding o WHERE o.user_id = u.userId)
+		ON CONFLICT (user_id) DO NOTHING`)
+	if err != nil {
+		return 0, fmt.Errorf("error queueing accounts without onboarding: %v", err)
+	}
+	return failed.RowsAffected() + missing.RowsAffected(), nil
+}
+
+// GetStatus returns an account's onboarding progress, or nil when it was
+// never queued
+func GetStatus(ctx context.Context, conn *data.Conn, userID int) (*Status, error) {
+	rows, err := listStatuses(ctx, conn, `WHERE user_id = $1`, userID)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return &rows[0], nil
+}
+
+// ListIncomplete returns accounts whose onboarding has not finished, failed
+// ones first
+func ListIncomplete(ctx context.Context, conn *data.Conn, limit int) ([]Status, error) {
+	return listStatuses(ctx, conn, `WHERE status <> 'done' ORDER BY (status = 'failed') DESC, created_at LIMIT $1`, limit)
+}
+
+// Counts returns the number of accounts per onboarding status
+func Counts(ctx context.Context, conn *data.Conn) (map[string]int, error) {
+	rows, err := conn.DB.Query(ctx, `SELECT status, count(*) FROM user_onboarding GROUP BY status`)
+	if err != nil {
+		return nil, fmt.Errorf("error counting onboarding: %v", err)
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, fmt.Errorf("error scanning onboarding count: %v", err)
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+func listStatuses(ctx context.Context, conn *data.Conn, where string, args ...interface{}) ([]Status, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT user_id, status, steps_done, attempts, last_error, created_at, updated_at, finished_at
+		FROM user_onboarding `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading onboarding status: %v", err)
+	}
+	defer rows.Close()
+	var out []Status
+	for rows.Next() {
+		var s Status
+		var done map[string]string
+		if err := rows.Scan(&s.UserID, &s.Status, &done, &s.Attempts, &s.LastError,
+			&s.CreatedAt, &s.UpdatedAt, &s.FinishedAt); err != nil {
+			return nil, fmt.Errorf("error scanning onboarding status: %v", err)
+		}
+		s.StepsDone = []string{}
+		for _, st := range steps {
+			if _, ok := done[st.name]; ok {
+				s.StepsDone = append(s.StepsDone, st.name)
+			}
+		}
+		s.StepsTotal = len(steps)
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// GetOnboardingStatus reports how far provisioning of the user's account has got
+func GetOnboardingStatus(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s, err := GetStatus(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		// Accounts from before onboarding existed have nothing to provision
+		return Status{UserID: userID, Status: StatusDone, StepsDone: []string{}, StepsTotal: len(steps)}, nil
+	}
+	return s, nil
+}
+
+var workerOnce sync.Once
+
+// StartWorker starts provisioning queued accounts in the background. It only
+// ever starts once per process, so it can be scheduled like any job.
+func StartWorker(conn *data.Conn) error {
+	workerOnce.Do(func() {
+		go func() {
+			log.Printf("🚀 Onboarding worker started")
+			for {
+				worked, err := RunNext(context.Background(), conn)
+				if err != nil {
+					log.Printf("⚠️ Onboarding worker: %v", err)
+				}
+				if !worked {
+					time.Sleep(pollInterval)
+				}
+			}
+		}()
+	})
+	return nil
+}
+
+// RunQueued provisions queued accounts until none are left or ctx is done
+func RunQueued(ctx context.Context, conn *data.Conn) error {
+	for ctx.Err() == nil {
+		worked, err := RunNext(ctx, conn)
+		if err != nil {
+			log.Printf("⚠️ Onboarding: %v", err)
+		}
+		if !worked {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// RunNext claims the oldest queued account and runs its remaining steps. It
+// reports false when there was nothing to claim.
+func RunNext(ctx context.Context, conn *data.Conn) (bool, error) {
+	userID, attempts, done, err := claim(ctx, conn)
+	if err != nil || userID == 0 {
+		return false, err
+	}
+
+	for _, st := range steps {
+		if _, ok := done[st.name]; ok {
+			continue
+		}
+		stepCtx, cancel := context.WithTimeout(ctx, stepTimeout)
+		err := st.run(stepCtx, conn, userID)
+		cancel()
+		if err != nil {
+			status := StatusQueued
+			if attempts >= maxAttempts {
+				status = StatusFailed
+			}
+			msg := fmt.Sprintf("%s: %v", st.name, err)
+			if _, uerr := conn.DB.Exec(context.Background(), `
+				UPDATE user_onboarding SET status = $2, last_error = $3, updated_at = NOW()
+				WHERE user_id = $1 AND status = 'running'`, userID, status, msg); uerr != nil {
+				log.Printf("⚠️ Onboarding user %d: error recording failure: %v", userID, uerr)
+			}
+			if status == StatusQueued {
+				time.Sleep(retryDelay)
+			}
+			return true, fmt.Errorf("user %d attempt %d: %s", userID, attempts, msg)
+		}
+		if _, err := conn.DB.Exec(ctx, `
+			UPDATE user_onboarding
+			SET steps_done = steps_done || jsonb_build_object($2::text, NOW()), updated_at = NOW()
+			WHERE user_id = $1`, userID, st.name); err != nil {
+			return true, fmt.Errorf("user %d: error recording step %s: %v", userID, st.name, err)
+		}
+	}
+
+	if _, err := conn.DB.Exec(ctx, `
+		UPDATE user_onboarding SET status = 'done', last_error = NULL, finished_at = NOW(), updated_at = NOW()
+		WHERE user_id = $1`, userID); err != nil {
+		return true, fmt.Errorf("user %d: error marking onboarding done: %v", userID, err)
+	}
+	log.Printf("👋 Onboarded user %d", userID)
+	return true, nil
+}
+
+// claim marks the oldest queued (or stale running) account as running
+func claim(ctx context.Context, conn *data.Conn) (int, int, map[string]string, error) {
+	var userID, attempts int
+	var done map[string]string
+	err := conn.DB.QueryRow(ctx, `
+		UPDATE user_onboarding SET
+			status = 'running',
+			attempts = attempts + 1,
+			started_at = COALESCE(started_at, NOW()),
+			updated_at = NOW()
+		WHERE user_id = (
+			SELECT user_id FROM user_onboarding
+			WHERE status = 'queued'
+			   OR (status = 'running' AND updated_at < NOW() - $1::interval)
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING user_id, attempts, steps_done`,
+		fmt.Sprintf("%d seconds", int(staleAfter.Seconds()))).Scan(&userID, &attempts, &done)
+	if err == pgx.ErrNoRows {
+		return 0, 0, nil, nil
+	}
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("error claiming onboarding: %v", err)
+	}
+	return userID, attempts, done, nil
+}
+
+// provisionSettings stores the default settings unless the user already saved some
+func provisionSettings(ctx context.Context, conn *data.Conn, userID int) error {
+	raw, err := json.Marshal(defaultSettings)
+	if err != nil {
+		return err
+	}
+	_, err = conn.DB.Exec(ctx, `UPDATE users SET settings = $2 WHERE userId = $1 AND settings IS NULL`, userID, raw)
+	return err
+}
+
+// provisionWatchlists creates the flag watchlist and a starter watchlist of
+// mega caps, keeping any the user already has
+func provisionWatchlists(ctx context.Context, conn *data.Conn, userID int) error {
+	if _, err := ensureWatchlist(ctx, conn, userID, flagWatchlist); err != nil {
+		return err
+	}
+	starterID, err := ensureWatchlist(ctx, conn, userID, starterWatchlist)
+	if err != nil {
+		return err
+	}
+	args, err := json.Marshal(watchlist.AddTickersToWatchlistArgs{WatchlistID: starterID, Tickers: starterTickers})
+	if err != nil {
+		return err
+	}
+	_, err = watchlist.AddTickersToWatchlist(conn, userID, args)
+	return err
+}
+
+func ensureWatchlist(ctx context.Context, conn *data.Conn, userID int, name string) (int, error) {
+	var id int
+	err := conn.DB.QueryRow(ctx, `
+		SELECT watchlistId FROM watchlists WHERE userId = $1 AND watchlistName = $2
+		ORDER BY watchlistId LIMIT 1`, userID, name).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != pgx.ErrNoRows {
+		return 0, fmt.Errorf("error looking up watchlist %q: %v", name, err)
+	}
+	if err := conn.DB.QueryRow(ctx, `
+		INSERT INTO watchlists (watchlistName, userId) VALUES ($1, $2) RETURNING watchlistId`,
+		name, userID).Scan(&id); err != nil {
+		return 0, fmt.Errorf("error creating watchlist %q: %v", name, err)
+	}
+	return id, nil
+}
+
+// provisionSampleStrategy creates an unusual volume strategy over the starter
+// watchlist, with its alert off, unless the user already has one from that template
+func provisionSampleStrategy(ctx context.Context, conn *data.Conn, userID int) error {
+	var exists bool
+	if err := conn.DB.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM strategy_template_uses u
+			JOIN strategy_templates t ON t.template_id = u.template_id
+			WHERE u.user_id = $1 AND t.key = $2)`, userID, sampleTemplate).Scan(&exists); err != nil {
+		return fmt.Errorf("error checking for the sample strategy: %v", err)
+	}
+	if exists {
+		return nil
+	}
+	args := strategy.InstantiateStrategyTemplateArgs{TemplateKey: sampleTemplate}
+	if id, err := ensureWatchlist(ctx, conn, userID, starterWatchlist); err == nil {
+		args.WatchlistID = &id
+	}
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	_, err = strategy.InstantiateStrategyTemplate(conn, userID, raw)
+	return err
+}
+
+const welcomeQuery = "What can you help me with?"
+
+const welcomeResponse = `Welcome to Peripheral! I can research stocks, chart them, build and backtest strategies from a plain-English description, and alert you when they match.
+
+To get you started your account has:
+- a **Mega Caps** watchlist of the largest US stocks
+- a sample **Unusual Volume** strategy that watches it; turn on its alert from the Strategies page
+- a **flag** watchlist for tickers you want to come back to
+
+Ask me anything below, or try one of the suggestions.`
+
+var welcomeSuggestions = []string{
+	"What moved the most in my Mega Caps watchlist today?",
+	"Backtest my Unusual Volume strategy over the last year",
+	"Find stocks gapping up on heavy volume",
+}
+
+// provisionWelcomeConversation seeds a conversation answering what the
+// assistant can do, so a new user's chat is not empty
+func provisionWelcomeConversation(ctx context.Context, conn *data.Conn, userID int) error {
+	var conversationID string
+	var messages int
+	err := conn.DB.QueryRow(ctx, `
+		SELECT conversation_id, message_count FROM conversations
+		WHERE userId = $1 AND title = $2
+		ORDER BY created_at LIMIT 1`, userID, welcomeTitle).Scan(&conversationID, &messages)
+	if err != nil && err != pgx.ErrNoRows {
+		return fmt.Errorf("error looking up the welcome conversation: %v", err)
+	}
+	if err == nil && messages > 0 {
+		return nil
+	}
+	if err == pgx.ErrNoRows {
+		conversationID, err = agent.CreateConversationInDB(ctx, conn, userID, welcomeTitle)
+		if err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	_, err = agent.SaveConversationMessage(ctx, conn, conversationID, userID, agent.ChatMessage{
+		Query:            welcomeQuery,
+		ContentChunks:    []agent.ContentChunk{{Type: agent.ChunkTypeText, Content: welcomeResponse}},
+		ResponseText:     welcomeResponse,
+		FunctionCalls:    []agent.FunctionCall{},
+		ToolResults:      []agent.ExecuteResult{},
+		SuggestedQueries: welcomeSuggestions,
+		Timestamp:        now,
+		CompletedAt:      now,
+		Status:           "completed",
+	})
+	return err
+}
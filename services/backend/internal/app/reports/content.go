@@ -0,0 +1,369 @@
+package reports
+
+import (
+	"backend/internal/app/strategy"
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4"
+)
+
+// maxMovers is how many gainers and losers a watchlist section lists
+const maxMovers = 5
+
+// reportContent is everything a report shows for one period
+type reportContent struct {
+	Name        string
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	GeneratedAt time.Time
+	Strategies  []strategySection
+	Watchlists  []watchlistSection
+	Trades      *tradeSection
+}
+
+// strategySection sums up a strategy's alert triggers in the period and the
+// close-to-close return of each triggered ticker since
+type strategySection struct {
+	Name        string
+	AlertActive bool
+	Triggers    int
+	Tickers     int
+	Evaluated   int      // triggers with a return since
+	WinRate     *float64 // % of evaluated triggers up since
+	AvgReturn   *float64 // mean % return since trigger
+	Best        *tickerReturn
+	Worst       *tickerReturn
+	Backtest    *strategy.BacktestSummary // last cached backtest, if any
+}
+
+type tickerReturn struct {
+	Ticker string
+	Return float64 // %
+}
+
+// watchlistSection lists a watchlist's biggest movers over the period
+type watchlistSection struct {
+	Name    string
+	Tickers int // with prices for the period
+	Gainers []tickerMove
+	Losers  []tickerMove
+}
+
+type tickerMove struct {
+	Ticker string
+	Close  float64
+	Change float64 // %
+}
+
+// tradeSection sums up the trades closed in the period
+type tradeSection struct {
+	Closed        int
+	Wins          int
+	Losses        int
+	WinRate       *float64
+	TotalPnL      float64
+	AvgWin        *float64
+	AvgLoss       *float64
+	Best          *tradeResult
+	Worst         *tradeResult
+	OpenPositions int
+}
+
+type tradeResult struct {
+	Ticker string
+	PnL    float64
+}
+
+// buildContent gathers what report shows for [start, end)
+func buildContent(ctx context.Context, conn *data.Conn, userID int, report *Report, start, end time.Time) (*reportContent, error) {
+	content := &reportContent{
+		Name:        report.Name,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		GeneratedAt: time.Now(),
+	}
+	for _, id := range report.StrategyIDs {
+		s, err := buildStrategySection(ctx, conn, userID, id, start, end)
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			content.Strategies = append(content.Strategies, *s)
+		}
+	}
+	for _, id := range report.WatchlistIDs {
+		w, err := buildWatchlistSection(ctx, conn, userID, id, start, end)
+		if err != nil {
+			return nil, err
+		}
+		if w != nil {
+			content.Watchlists = append(content.Watchlists, *w)
+		}
+	}
+	if report.IncludeTrades {
+		t, err := buildTradeSection(ctx, conn, userID, start, end)
+		if err != nil {
+			return nil, err
+		}
+		content.Trades = t
+	}
+	return content, nil
+}
+
+// buildStrategySection returns nil for a strategy deleted, or no longer
+// shared with the user, since the report was saved
+func buildStrategySection(ctx context.Context, conn *data.Conn, userID, strategyID int, start, end time.Time) (*strategySection, error) {
+	var s strategySection
+	var version, ownerID int
+	err := conn.DB.QueryRow(ctx, `
+		SELECT name, COALESCE(isAlertActive, false), COALESCE(version, 1), userId
+		FROM strategies
+		WHERE strategyId = $1
+		  AND (userId = $2 OR workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $2))`,
+		strategyID, userID).Scan(&s.Name, &s.AlertActive, &version, &ownerID)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading strategy %d: %v", strategyID, err)
+	}
+
+	// Each trigger is paired with the close on its day and the last close in
+	// the period; either is NULL when there are no daily bars for the ticker
+	rows, err := conn.DB.Query(ctx, `
+		WITH triggers AS (
+			SELECT al.timestamp AS triggered_at, t.ticker
+			FROM alert_logs al
+			CROSS JOIN LATERAL (
+				SELECT COALESCE(inst->>'ticker', inst->>'symbol') AS ticker
+				FROM jsonb_array_elements(
+					CASE WHEN jsonb_typeof(al.payload->'instances') = 'array'
+					     THEN al.payload->'instances' ELSE '[]'::jsonb END) inst
+				UNION ALL
+				SELECT al.ticker
+				WHERE jsonb_typeof(al.payload->'instances') IS DISTINCT FROM 'array'
+			) t
+			WHERE al.alert_type = 'strategy'
+			  AND al.related_id = $1
+			  AND al.user_id = $2
+			  AND al.timestamp >= $3 AND al.timestamp < $4
+			  AND COALESCE(t.ticker, '') <> ''
+		)
+		SELECT t.ticker, entry_bar.close::double precision, last_bar.close::double precision
+		FROM triggers t
+		LEFT JOIN LATERAL (
+			SELECT close FROM ohlcv_1d
+			WHERE ticker = t.ticker AND timestamp >= date_trunc('day', t.triggered_at) AND timestamp < $4
+			ORDER BY timestamp LIMIT 1
+		) entry_bar ON true
+		LEFT JOIN LATERAL (
+			SELECT close FROM ohlcv_1d
+			WHERE ticker = t.ticker AND timestamp < $4
+			ORDER BY timestamp DESC LIMIT 1
+		) last_bar ON true`,
+		strategyID, ownerID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("error loading triggers of strategy %d: %v", strategyID, err)
+	}
+	defer rows.Close()
+
+	tickers := map[string]bool{}
+	var returns []tickerReturn
+	for rows.Next() {
+		var ticker string
+		var entry, last *float64
+		if err := rows.Scan(&ticker, &entry, &last); err != nil {
+			return nil, fmt.Errorf("error scanning trigger: %v", err)
+		}
+		s.Triggers++
+		tickers[ticker] = true
+		if entry != nil && last != nil && *entry > 0 {
+			returns = append(returns, tickerReturn{ticker, (*last - *entry) / *entry * 100})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating triggers: %v", err)
+	}
+	s.Tickers = len(tickers)
+	s.Evaluated = len(returns)
+	if len(returns) > 0 {
+		wins, sum := 0, 0.0
+		best, worst := returns[0], returns[0]
+		for _, r := range returns {
+			sum += r.Return
+			if r.Return > 0 {
+				wins++
+			}
+			if r.Return > best.Return {
+				best = r
+			}
+			if r.Return < worst.Return {
+				worst = r
+			}
+		}
+		winRate := float64(wins) / float64(len(returns)) * 100
+		avg := sum / float64(len(returns))
+		s.WinRate, s.AvgReturn = &winRate, &avg
+		s.Best, s.Worst = &best, &worst
+	}
+
+	// Only a backtest already cached is shown; running one here could take minutes
+	raw, err := conn.Cache.Get(ctx, fmt.Sprintf(strategy.BacktestCacheKey, userID, strategyID, version)).Bytes()
+	if err == nil {
+		var bt struct {
+			Summary strategy.BacktestSummary `json:"summary"`
+		}
+		if json.Unmarshal(raw, &bt) == nil {
+			s.Backtest = &bt.Summary
+		}
+	} else if err != redis.Nil {
+		return nil, fmt.Errorf("error loading backtest of strategy %d: %v", strategyID, err)
+	}
+	return &s, nil
+}
+
+// buildWatchlistSection returns nil for a watchlist deleted, or no longer
+// shared with the user, since the report was saved
+func buildWatchlistSection(ctx context.Context, conn *data.Conn, userID, watchlistID int, start, end time.Time) (*watchlistSection, error) {
+	var w watchlistSection
+	err := conn.DB.QueryRow(ctx, `
+		SELECT watchlistName FROM watchlists
+		WHERE watchlistId = $1
+		  AND (userId = $2 OR workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $2))`,
+		watchlistID, userID).Scan(&w.Name)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading watchlist %d: %v", watchlistID, err)
+	}
+
+	rows, err := conn.DB.Query(ctx, `
+		SELECT s.ticker, cur.close::double precision, prev.close::double precision
+		FROM watchlistItems wi
+		JOIN securities s ON s.securityId = wi.securityId AND s.maxDate IS NULL
+		JOIN LATERAL (
+			SELECT close FROM ohlcv_1d
+			WHERE ticker = s.ticker AND timestamp < $2
+			ORDER BY timestamp DESC LIMIT 1
+		) cur ON true
+		JOIN LATERAL (
+			SELECT close FROM ohlcv_1d
+			WHERE ticker = s.ticker AND timestamp < $3
+			ORDER BY timestamp DESC LIMIT 1
+		) prev ON prev.close > 0
+		WHERE wi.watchlistId = $1`,
+		watchlistID, end, start)
+	if err != nil {
+		return nil, fmt.Errorf("error loading watchlist %d prices: %v", watchlistID, err)
+	}
+	defer rows.Close()
+
+	var moves []tickerMove
+	seen := map[string]bool{}
+	for rows.Next() {
+		var m tickerMove
+		var prev float64
+		if err := rows.Scan(&m.Ticker, &m.Close, &prev); err != nil {
+			return nil, fmt.Errorf("error scanning watchlist price: %v", err)
+		}
+		if seen[m.Ticker] {
+			continue
+		}
+		seen[m.Ticker] = true
+		m.Change = (m.Close - prev) / prev * 100
+		moves = append(moves, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating watchlist prices: %v", err)
+	}
+	w.Tickers = len(moves)
+
+	sort.Slice(moves, func(i, j int) bool { return moves[i].Change > moves[j].Change })
+	for _, m := range moves {
+		if m.Change <= 0 || len(w.Gainers) == maxMovers {
+			break
+		}
+		w.Gainers = append(w.Gainers, m)
+	}
+	for i := len(moves) - 1; i >= 0; i-- {
+		if moves[i].Change >= 0 || len(w.Losers) == maxMovers {
+			break
+		}
+		w.Losers = append(w.Losers, moves[i])
+	}
+	return &w, nil
+}
+
+// buildTradeSection counts a trade in the period when its last exit falls in
+// it. Trade times are stored as Eastern wall-clock times.
+func buildTradeSection(ctx context.Context, conn *data.Conn, userID int, start, end time.Time) (*tradeSection, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT ticker, closedPnL::double precision
+		FROM trades
+		WHERE userId = $1
+		  AND status = 'Closed'
+		  AND closedPnL IS NOT NULL
+		  AND exit_times[array_upper(exit_times, 1)] >= $2
+		  AND exit_times[array_upper(exit_times, 1)] < $3`,
+		userID, start.In(easternLocation()), end.In(easternLocation()))
+	if err != nil {
+		return nil, fmt.Errorf("error loading trades: %v", err)
+	}
+	defer rows.Close()
+
+	var t tradeSection
+	var winSum, lossSum float64
+	for rows.Next() {
+		var r tradeResult
+		if err := rows.Scan(&r.Ticker, &r.PnL); err != nil {
+			return nil, fmt.Errorf("error scanning trade: %v", err)
+		}
+		t.Closed++
+		t.TotalPnL += r.PnL
+		if r.PnL > 0 {
+			t.Wins++
+			winSum += r.PnL
+		} else {
+			t.Losses++
+			lossSum += r.PnL
+		}
+		if t.Best == nil || r.PnL > t.Best.PnL {
+			best := r
+			t.Best = &best
+		}
+		if t.Worst == nil || r.PnL < t.Worst.PnL {
+			worst := r
+			t.Worst = &worst
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating trades: %v", err)
+	}
+	if t.Closed > 0 {
+		winRate := float64(t.Wins) / float64(t.Closed) * 100
+		t.WinRate = &winRate
+	}
+	if t.Wins > 0 {
+		avg := math.Round(winSum/float64(t.Wins)*100) / 100
+		t.AvgWin = &avg
+	}
+	if t.Losses > 0 {
+		avg := math.Round(lossSum/float64(t.Losses)*100) / 100
+		t.AvgLoss = &avg
+	}
+
+	err = conn.DB.QueryRow(ctx, `
+		SELECT COUNT(*) FROM trades WHERE userId = $1 AND status = 'Open'`, userID).Scan(&t.OpenPositions)
+	if err != nil {
+		return nil, fmt.Errorf("error counting open trades: %v", err)
+	}
+	return &t, nil
+}
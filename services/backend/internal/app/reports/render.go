@@ -0,0 +1,99 @@
+package reports
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/services/plotly"
+)
+
+//go:embed report.html
+var reportHTML string
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"date": func(t time.Time) string { return t.In(easternLocation()).Format("Jan 2, 2006") },
+	"pct": func(v interface{}) string {
+		return strconv.FormatFloat(number(v), 'f', 1, 64) + "%"
+	},
+	"signedPct": func(v interface{}) string {
+		return strconv.FormatFloat(number(v), 'f', 2, 64) + "%"
+	},
+	"usd":       func(v interface{}) string { return formatUSD(number(v), false) },
+	"signedUSD": func(v interface{}) string { return formatUSD(number(v), true) },
+	"sign": func(v interface{}) string {
+		switch n := number(v); {
+		case n > 0:
+			return "up"
+		case n < 0:
+			return "down"
+		}
+		return ""
+	},
+}).Parse(reportHTML))
+
+// number reads a float or a pointer to one, as the report's stats are optional
+func number(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case *float64:
+		if n != nil {
+			return *n
+		}
+	case int:
+		return float64(n)
+	}
+	return 0
+}
+
+// formatUSD writes e.g. "$1,234.56", and with signed "+$1,234.56" or "-$12.00"
+func formatUSD(v float64, signed bool) string {
+	sign := ""
+	if v < 0 {
+		sign = "-"
+	} else if signed && v > 0 {
+		sign = "+"
+	}
+	s := strconv.FormatFloat(math.Abs(v), 'f', 2, 64)
+	whole, frac := s[:len(s)-3], s[len(s)-3:]
+	var b strings.Builder
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	return sign + "$" + b.String() + frac
+}
+
+// renderHTML fills the report template
+func renderHTML(content *reportContent) (string, error) {
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, content); err != nil {
+		return "", fmt.Errorf("error rendering report: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// renderPDF prints the report with renderer, or with a browser of its own when nil
+func renderPDF(ctx context.Context, renderer *plotly.Renderer, content *reportContent) ([]byte, error) {
+	html, err := renderHTML(content)
+	if err != nil {
+		return nil, err
+	}
+	if renderer == nil {
+		renderer, err = plotly.New()
+		if err != nil {
+			return nil, fmt.Errorf("error starting renderer: %v", err)
+		}
+		defer renderer.Close()
+	}
+	return renderer.RenderPDF(ctx, html)
+}
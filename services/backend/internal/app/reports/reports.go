@@ -0,0 +1,518 @@
+// Package reports builds scheduled performance reports: a weekly PDF combining
+// the user's strategy alert and backtest performance, watchlist movers and
+// trade stats, delivered over email or Telegram with a history of every run.
+package reports
+
+import (
+	"backend/internal/app/dependencies"
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/services/alerts"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	ChannelEmail    = "email"
+	ChannelTelegram = "telegram"
+
+	maxReportsPerUser     = 5
+	maxReportStrategies   = 10
+	maxReportWatchlists   = 10
+	maxReportNameLength   = 100
+	maxManualRunsPerDay   = 3
+	reportPeriod          = 7 * 24 * time.Hour
+	reportRunTimeout      = 5 * time.Minute
+	maxReportRunsReturned = 20
+)
+
+// Report is a user's configuration of a weekly report
+type Report struct {
+	ReportID      int      `json:"reportId"`
+	Name          string   `json:"name"`
+	StrategyIDs   []int    `json:"strategyIds"`
+	WatchlistIDs  []int    `json:"watchlistIds"`
+	IncludeTrades bool     `json:"includeTrades"`
+	Channels      []string `json:"channels"`  // email and/or telegram, to the user's linked chat
+	DayOfWeek     int      `json:"dayOfWeek"` // 0 = Sunday, ET
+	Enabled       bool     `json:"enabled"`
+	LastRunAt     *int64   `json:"lastRunAt,omitempty"` // ms since epoch
+	CreatedAt     int64    `json:"createdAt"`
+}
+
+// ReportRun is one generated report and how its delivery went
+type ReportRun struct {
+	RunID       int               `json:"runId"`
+	ReportID    int               `json:"reportId"`
+	ReportName  string            `json:"reportName"`
+	Status      string            `json:"status"` // running | sent | partial | failed
+	Manual      bool              `json:"manual"`
+	PeriodStart int64             `json:"periodStart"` // ms since epoch
+	PeriodEnd   int64             `json:"periodEnd"`
+	Error       string            `json:"error,omitempty"`
+	Deliveries  map[string]string `json:"deliveries"` // channel -> "sent", "skipped: ..." or the error
+	SizeBytes   int               `json:"sizeBytes,omitempty"`
+	CreatedAt   int64             `json:"createdAt"`
+	CompletedAt *int64            `json:"completedAt,omitempty"`
+}
+
+const reportColumns = `report_id, name, strategy_ids, watchlist_ids, include_trades, channels,
+	day_of_week, enabled, last_run_at, created_at`
+
+func scanReport(row pgx.Row) (*Report, error) {
+	var r Report
+	var lastRunAt *time.Time
+	var createdAt time.Time
+	err := row.Scan(&r.ReportID, &r.Name, &r.StrategyIDs, &r.WatchlistIDs, &r.IncludeTrades, &r.Channels,
+		&r.DayOfWeek, &r.Enabled, &lastRunAt, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastRunAt != nil {
+		ms := lastRunAt.UnixMilli()
+		r.LastRunAt = &ms
+	}
+	r.CreatedAt = createdAt.UnixMilli()
+	return &r, nil
+}
+
+func loadReport(ctx context.Context, conn *data.Conn, userID, reportID int) (*Report, error) {
+	r, err := scanReport(conn.DB.QueryRow(ctx, `
+		SELECT `+reportColumns+` FROM scheduled_reports
+		WHERE report_id = $1 AND user_id = $2`, reportID, userID))
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("report not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading report: %v", err)
+	}
+	return r, nil
+}
+
+// GetReports lists the user's report configurations
+func GetReports(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := conn.DB.Query(ctx, `
+		SELECT `+reportColumns+` FROM scheduled_reports
+		WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying reports: %v", err)
+	}
+	defer rows.Close()
+
+	reports := []Report{}
+	for rows.Next() {
+		r, err := scanReport(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning report: %v", err)
+		}
+		reports = append(reports, *r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reports: %v", err)
+	}
+	return reports, nil
+}
+
+// validate normalizes a report configuration and checks it describes
+// something that can be built and delivered
+func (r *Report) validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return apperr.Validation("name is required")
+	}
+	if len(r.Name) > maxReportNameLength {
+		return apperr.Validation("name must be at most %d characters", maxReportNameLength)
+	}
+	r.StrategyIDs = uniqueIDs(r.StrategyIDs)
+	r.WatchlistIDs = uniqueIDs(r.WatchlistIDs)
+	if len(r.StrategyIDs) > maxReportStrategies {
+		return apperr.Validation("a report can include at most %d strategies", maxReportStrategies)
+	}
+	if len(r.WatchlistIDs) > maxReportWatchlists {
+		return apperr.Validation("a report can include at most %d watchlists", maxReportWatchlists)
+	}
+	if len(r.StrategyIDs) == 0 && len(r.WatchlistIDs) == 0 && !r.IncludeTrades {
+		return apperr.Validation("select at least one strategy, watchlist or trade stats")
+	}
+	if r.DayOfWeek < 0 || r.DayOfWeek > 6 {
+		return apperr.Validation("dayOfWeek must be between 0 (Sunday) and 6 (Saturday)")
+	}
+	channels := []string{}
+	for _, c := range r.Channels {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c != ChannelEmail && c != ChannelTelegram {
+			return apperr.Validation("unknown channel %q, expected %q or %q", c, ChannelEmail, ChannelTelegram)
+		}
+		if !containsString(channels, c) {
+			channels = append(channels, c)
+		}
+	}
+	if len(channels) == 0 {
+		return apperr.Validation("select at least one delivery channel")
+	}
+	r.Channels = channels
+	return nil
+}
+
+// checkOwnership makes sure the user owns, or can view through a workspace,
+// every strategy and watchlist in the report
+func (r *Report) checkOwnership(ctx context.Context, conn *data.Conn, userID int) error {
+	if len(r.StrategyIDs) > 0 {
+		var owned int
+		err := conn.DB.QueryRow(ctx, `
+			SELECT COUNT(*) FROM strategies
+			WHERE strategyId = ANY($2)
+			  AND (userId = $1 OR workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1))`,
+			userID, r.StrategyIDs).Scan(&owned)
+		if err != nil {
+			return fmt.Errorf("error checking strategies: %v", err)
+		}
+		if owned != len(r.StrategyIDs) {
+			return apperr.NotFound("strategy not found or access denied")
+		}
+	}
+	if len(r.WatchlistIDs) > 0 {
+		var owned int
+		err := conn.DB.QueryRow(ctx, `
+			SELECT COUNT(*) FROM watchlists
+			WHERE watchlistId = ANY($2)
+			  AND (userId = $1 OR workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1))`,
+			userID, r.WatchlistIDs).Scan(&owned)
+		if err != nil {
+			return fmt.Errorf("error checking watchlists: %v", err)
+		}
+		if owned != len(r.WatchlistIDs) {
+			return apperr.NotFound("watchlist not found or access denied")
+		}
+	}
+	return nil
+}
+
+// SaveReport creates a report, or updates it when reportId is set
+func SaveReport(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args Report
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := args.checkOwnership(ctx, conn, userID); err != nil {
+		return nil, err
+	}
+	if containsString(args.Channels, ChannelTelegram) {
+		_, err := alerts.UserTelegramChat(ctx, conn, userID)
+		if errors.Is(err, alerts.ErrNoTelegramChat) {
+			return nil, apperr.Validation("link a Telegram chat before delivering over Telegram")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if args.ReportID == 0 {
+		var count int
+		if err := conn.DB.QueryRow(ctx, `SELECT COUNT(*) FROM scheduled_reports WHERE user_id = $1`, userID).Scan(&count); err != nil {
+			return nil, fmt.Errorf("error counting reports: %v", err)
+		}
+		if count >= maxReportsPerUser {
+			return nil, apperr.LimitExceeded("you can have up to %d reports", maxReportsPerUser)
+		}
+		r, err := scanReport(conn.DB.QueryRow(ctx, `
+			INSERT INTO scheduled_reports
+				(user_id, name, strategy_ids, watchlist_ids, include_trades, channels, day_of_week, enabled)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING `+reportColumns,
+			userID, args.Name, args.StrategyIDs, args.WatchlistIDs, args.IncludeTrades, args.Channels,
+			args.DayOfWeek, args.Enabled))
+		if err != nil {
+			return nil, fmt.Errorf("error creating report: %v", err)
+		}
+		recordDependencies(ctx, conn, userID, r)
+		return r, nil
+	}
+
+	r, err := scanReport(conn.DB.QueryRow(ctx, `
+		UPDATE scheduled_reports SET
+			name = $3, strategy_ids = $4, watchlist_ids = $5, include_trades = $6, channels = $7,
+			day_of_week = $8, enabled = $9, updated_at = NOW()
+		WHERE report_id = $1 AND user_id = $2
+		RETURNING `+reportColumns,
+		args.ReportID, userID, args.Name, args.StrategyIDs, args.WatchlistIDs, args.IncludeTrades, args.Channels,
+		args.DayOfWeek, args.Enabled))
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("report not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating report: %v", err)
+	}
+	recordDependencies(ctx, conn, userID, r)
+	return r, nil
+}
+
+// recordDependencies notes the strategies and watchlists a report covers, so
+// deleting one of them shows the report among what it affects
+func recordDependencies(ctx context.Context, conn *data.Conn, userID int, r *Report) {
+	var targets []dependencies.Target
+	for _, id := range r.StrategyIDs {
+		targets = append(targets, dependencies.Target{Type: dependencies.TypeStrategy, ID: id})
+	}
+	for _, id := range r.WatchlistIDs {
+		targets = append(targets, dependencies.Target{Type: dependencies.TypeWatchlist, ID: id})
+	}
+	if err := dependencies.Set(ctx, conn.DB, userID, dependencies.TypeReport, r.ReportID,
+		dependencies.RelationReport, targets); err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+}
+
+// DeleteReportArgs represents the arguments for DeleteReport
+type DeleteReportArgs struct {
+	ReportID int `json:"reportId"`
+}
+
+// DeleteReport removes a report and its run history
+func DeleteReport(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args DeleteReportArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tag, err := conn.DB.Exec(ctx, `DELETE FROM scheduled_reports WHERE report_id = $1 AND user_id = $2`, args.ReportID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting report: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, apperr.NotFound("report not found")
+	}
+	if err := dependencies.Forget(ctx, conn.DB, dependencies.TypeReport, args.ReportID); err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+	return map[string]bool{"success": true}, nil
+}
+
+// RunReportNowArgs represents the arguments for RunReportNow
+type RunReportNowArgs struct {
+	ReportID int `json:"reportId"`
+}
+
+// RunReportNow builds and delivers a report over the last week right away.
+// It runs in the background; poll GetReportRuns for its status.
+func RunReportNow(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args RunReportNowArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	report, err := loadReport(ctx, conn, userID, args.ReportID)
+	if err != nil {
+		return nil, err
+	}
+	var inProgress, recent int
+	err = conn.DB.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE status = 'running' AND created_at > NOW() - INTERVAL '1 hour'),
+		       COUNT(*) FILTER (WHERE manual AND created_at > NOW() - INTERVAL '1 day')
+		FROM report_runs WHERE user_id = $1`, userID).Scan(&inProgress, &recent)
+	if err != nil {
+		return nil, fmt.Errorf("error checking report runs: %v", err)
+	}
+	if inProgress > 0 {
+		return nil, apperr.Validation("a report is already being generated")
+	}
+	if recent >= maxManualRunsPerDay {
+		return nil, apperr.LimitExceeded("you can run reports manually up to %d times per day", maxManualRunsPerDay)
+	}
+
+	end := time.Now()
+	run, err := startRun(ctx, conn, userID, report, end.Add(-reportPeriod), end, true)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), reportRunTimeout)
+		defer cancel()
+		executeRun(ctx, conn, nil, userID, report, run)
+	}()
+	return run, nil
+}
+
+// startRun records a run of report over [start, end) before it is built
+func startRun(ctx context.Context, conn *data.Conn, userID int, report *Report, start, end time.Time, manual bool) (*ReportRun, error) {
+	run := &ReportRun{
+		ReportID:    report.ReportID,
+		ReportName:  report.Name,
+		Status:      "running",
+		Manual:      manual,
+		PeriodStart: start.UnixMilli(),
+		PeriodEnd:   end.UnixMilli(),
+		Deliveries:  map[string]string{},
+	}
+	var createdAt time.Time
+	err := conn.DB.QueryRow(ctx, `
+		INSERT INTO report_runs (report_id, user_id, manual, period_start, period_end)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING run_id, created_at`, report.ReportID, userID, manual, start, end).Scan(&run.RunID, &createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("error recording report run: %v", err)
+	}
+	run.CreatedAt = createdAt.UnixMilli()
+	return run, nil
+}
+
+// GetReportRunsArgs represents the arguments for GetReportRuns
+type GetReportRunsArgs struct {
+	ReportID int `json:"reportId,omitempty"` // all of the user's reports when 0
+}
+
+// GetReportRuns lists the most recent report runs, newest first
+func GetReportRuns(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetReportRunsArgs
+	if len(rawArgs) > 0 {
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			return nil, apperr.InvalidArgs(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := conn.DB.Query(ctx, `
+		SELECT rr.run_id, rr.report_id, sr.name, rr.status, rr.manual, rr.period_start, rr.period_end,
+		       COALESCE(rr.error, ''), rr.deliveries, COALESCE(rr.size_bytes, 0), rr.created_at, rr.completed_at
+		FROM report_runs rr
+		JOIN scheduled_reports sr ON sr.report_id = rr.report_id
+		WHERE rr.user_id = $1 AND ($2 = 0 OR rr.report_id = $2)
+		ORDER BY rr.created_at DESC
+		LIMIT $3`, userID, args.ReportID, maxReportRunsReturned)
+	if err != nil {
+		return nil, fmt.Errorf("error querying report runs: %v", err)
+	}
+	defer rows.Close()
+
+	runs := []ReportRun{}
+	for rows.Next() {
+		var r ReportRun
+		var deliveries []byte
+		var periodStart, periodEnd, createdAt time.Time
+		var completedAt *time.Time
+		if err := rows.Scan(&r.RunID, &r.ReportID, &r.ReportName, &r.Status, &r.Manual, &periodStart, &periodEnd,
+			&r.Error, &deliveries, &r.SizeBytes, &createdAt, &completedAt); err != nil {
+			return nil, fmt.Errorf("error scanning report run: %v", err)
+		}
+		if err := json.Unmarshal(deliveries, &r.Deliveries); err != nil {
+			return nil, fmt.Errorf("error parsing report run deliveries: %v", err)
+		}
+		r.PeriodStart = periodStart.UnixMilli()
+		r.PeriodEnd = periodEnd.UnixMilli()
+		r.CreatedAt = createdAt.UnixMilli()
+		if completedAt != nil {
+			ms := completedAt.UnixMilli()
+			r.CompletedAt = &ms
+		}
+		runs = append(runs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating report runs: %v", err)
+	}
+	return runs, nil
+}
+
+// GetReportRunPDFArgs represents the arguments for GetReportRunPDF
+type GetReportRunPDFArgs struct {
+	RunID int `json:"runId"`
+}
+
+// GetReportRunPDFResult is a generated report, base64 encoded for JSON transport
+type GetReportRunPDFResult struct {
+	FileName string `json:"fileName"`
+	PDF      string `json:"pdf"`
+}
+
+// GetReportRunPDF returns the PDF a run generated
+func GetReportRunPDF(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetReportRunPDFArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var pdf []byte
+	var name string
+	var periodEnd time.Time
+	err := conn.DB.QueryRow(ctx, `
+		SELECT rr.pdf, sr.name, rr.period_end
+		FROM report_runs rr
+		JOIN scheduled_reports sr ON sr.report_id = rr.report_id
+		WHERE rr.run_id = $1 AND rr.user_id = $2 AND rr.pdf IS NOT NULL`, args.RunID, userID).Scan(&pdf, &name, &periodEnd)
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("report PDF not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading report PDF: %v", err)
+	}
+	return GetReportRunPDFResult{
+		FileName: pdfFileName(name, periodEnd),
+		PDF:      base64.StdEncoding.EncodeToString(pdf),
+	}, nil
+}
+
+// pdfFileName is e.g. "weekly-review-2026-10-16.pdf"
+func pdfFileName(reportName string, periodEnd time.Time) string {
+	words := strings.FieldsFunc(strings.ToLower(reportName), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	slug := strings.Join(words, "-")
+	if slug == "" {
+		slug = "report"
+	}
+	return fmt.Sprintf("%s-%s.pdf", slug, periodEnd.In(easternLocation()).Format("2006-01-02"))
+}
+
+func uniqueIDs(ids []int) []int {
+	out := []int{}
+	seen := map[int]bool{}
+	for _, id := range ids {
+		if id > 0 && !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// easternLocation is the zone report schedules and dates are in
+func easternLocation() *time.Location {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		log.Printf("⚠️ Loading America/New_York failed, using UTC for reports: %v", err)
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,211 @@
+package reports
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/dryrun"
+	"backend/internal/services/alerts"
+	email "backend/internal/services/email"
+	"backend/internal/services/plotly"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// SendScheduledReports builds and delivers every enabled report due today
+// (ET). Each report is claimed by setting last_run_at before it is built, so
+// a retry or a second replica never sends it twice.
+func SendScheduledReports(conn *data.Conn) error {
+	loc := easternLocation()
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	rows, err := conn.DB.Query(ctx, `
+		SELECT report_id, user_id FROM scheduled_reports
+		WHERE enabled AND day_of_week = $1 AND (last_run_at IS NULL OR last_run_at < $2)
+		ORDER BY report_id`, int(now.Weekday()), today)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("error querying due reports: %v", err)
+	}
+	type dueReport struct{ reportID, userID int }
+	var due []dueReport
+	for rows.Next() {
+		var d dueReport
+		if err := rows.Scan(&d.reportID, &d.userID); err != nil {
+			rows.Close()
+			cancel()
+			return fmt.Errorf("error scanning due report: %v", err)
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+	cancel()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating due reports: %v", err)
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	// One browser prints every report of this run
+	renderer, err := plotly.New()
+	if err != nil {
+		return fmt.Errorf("error starting report renderer: %v", err)
+	}
+	defer renderer.Close()
+
+	sent, failed := 0, 0
+	for _, d := range due {
+		ctx, cancel := context.WithTimeout(context.Background(), reportRunTimeout)
+		tag, err := conn.DB.Exec(ctx, `
+			UPDATE scheduled_reports SET last_run_at = NOW()
+			WHERE report_id = $1 AND (last_run_at IS NULL OR last_run_at < $2)`, d.reportID, today)
+		if err != nil || tag.RowsAffected() == 0 {
+			cancel()
+			continue
+		}
+		report, err := loadReport(ctx, conn, d.userID, d.reportID)
+		var run *ReportRun
+		if err == nil {
+			run, err = startRun(ctx, conn, d.userID, report, now.Add(-reportPeriod), now, false)
+		}
+		if err != nil {
+			log.Printf("❌ Scheduled report %d for user %d could not start: %v", d.reportID, d.userID, err)
+			failed++
+			cancel()
+			continue
+		}
+		if executeRun(ctx, conn, renderer, d.userID, report, run) == "failed" {
+			failed++
+		} else {
+			sent++
+		}
+		cancel()
+	}
+	log.Printf("📰 Scheduled reports: %d sent, %d failed", sent, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d scheduled reports failed", failed, failed+sent)
+	}
+	return nil
+}
+
+// executeRun builds, stores and delivers a run, records how it went and
+// returns its final status
+func executeRun(ctx context.Context, conn *data.Conn, renderer *plotly.Renderer, userID int, report *Report, run *ReportRun) string {
+	start, end := time.UnixMilli(run.PeriodStart), time.UnixMilli(run.PeriodEnd)
+	content, err := buildContent(ctx, conn, userID, report, start, end)
+	var pdf []byte
+	if err == nil {
+		pdf, err = renderPDF(ctx, renderer, content)
+	}
+	if err == nil {
+		_, err = conn.DB.Exec(ctx, `
+			UPDATE report_runs SET pdf = $2, size_bytes = $3 WHERE run_id = $1`, run.RunID, pdf, len(pdf))
+		if err != nil {
+			err = fmt.Errorf("error storing report PDF: %v", err)
+		}
+	}
+	if err != nil {
+		log.Printf("❌ Report run %d (report %d, user %d) failed: %v", run.RunID, report.ReportID, userID, err)
+		finishRun(conn, run.RunID, "failed", map[string]string{}, apperr.Message(err))
+		return "failed"
+	}
+
+	deliveries := deliver(ctx, conn, userID, report, content, pdf)
+	failures := 0
+	for _, result := range deliveries {
+		if result != "sent" && !strings.HasPrefix(result, "skipped") {
+			failures++
+		}
+	}
+	status := "sent"
+	if failures == len(deliveries) && failures > 0 {
+		status = "failed"
+	} else if failures > 0 {
+		status = "partial"
+	}
+	finishRun(conn, run.RunID, status, deliveries, "")
+	log.Printf("📰 Report run %d (report %d, user %d) %s: %v", run.RunID, report.ReportID, userID, status, deliveries)
+	return status
+}
+
+func finishRun(conn *data.Conn, runID int, status string, deliveries map[string]string, errMsg string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	raw, _ := json.Marshal(deliveries)
+	_, err := conn.DB.Exec(ctx, `
+		UPDATE report_runs SET status = $2, deliveries = $3, error = NULLIF($4, ''), completed_at = NOW()
+		WHERE run_id = $1`, runID, status, raw, errMsg)
+	if err != nil {
+		log.Printf("Error recording report run %d: %v", runID, err)
+	}
+}
+
+// deliver sends the PDF over each of the report's channels and returns what
+// happened on each
+func deliver(ctx context.Context, conn *data.Conn, userID int, report *Report, content *reportContent, pdf []byte) map[string]string {
+	fileName := pdfFileName(report.Name, content.PeriodEnd)
+	period := fmt.Sprintf("%s – %s",
+		content.PeriodStart.In(easternLocation()).Format("Jan 2"),
+		content.PeriodEnd.In(easternLocation()).Format("Jan 2, 2006"))
+	out := map[string]string{}
+	for _, channel := range report.Channels {
+		if isDevEnvironment() {
+			out[channel] = "skipped: development environment"
+			continue
+		}
+		if dryrun.Notify(ctx, channel, fmt.Sprintf("sent report %d to user %d over %s", report.ReportID, userID, channel), nil) {
+			out[channel] = "skipped: dry run"
+			continue
+		}
+		var err error
+		switch channel {
+		case ChannelEmail:
+			err = emailReport(ctx, conn, userID, report.Name, period, fileName, pdf)
+		case ChannelTelegram:
+			var chat int64
+			if chat, err = alerts.UserTelegramChat(ctx, conn, userID); err == nil {
+				err = alerts.SendTelegramDocument(pdf, fileName, report.Name+" · "+period, chat)
+			}
+		default:
+			err = fmt.Errorf("unknown channel %q", channel)
+		}
+		if err != nil {
+			log.Printf("⚠️ Delivering report %d over %s failed: %v", report.ReportID, channel, err)
+			out[channel] = apperr.Message(err)
+		} else {
+			out[channel] = "sent"
+		}
+	}
+	return out
+}
+
+func emailReport(ctx context.Context, conn *data.Conn, userID int, name, period, fileName string, pdf []byte) error {
+	var to string
+	if err := conn.DB.QueryRow(ctx, `SELECT COALESCE(email, '') FROM users WHERE userId = $1`, userID).Scan(&to); err != nil {
+		return fmt.Errorf("error loading email address: %v", err)
+	}
+	if to == "" {
+		return fmt.Errorf("the account has no email address")
+	}
+	body := fmt.Sprintf("<p>Your report <b>%s</b> for %s is attached.</p>"+
+		"<p>You can change or turn off this report under Settings → Reports.</p>",
+		html.EscapeString(name), html.EscapeString(period))
+	return email.SendEmailWithAttachment(to, "Peripheral report: "+name, body, email.Attachment{
+		Name:     fileName,
+		MimeType: "application/pdf",
+		Data:     pdf,
+	})
+}
+
+func isDevEnvironment() bool {
+	env := strings.ToLower(os.Getenv("ENVIRONMENT"))
+	return env == "" || env == "dev" || env == "development"
+}
@@ -0,0 +1,524 @@
+package screener
+
+import (
+	"backend/internal/app/dependencies"
+	"backend/internal/app/limits"
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	maxFormulaLength     = 256 // characters accepted in a single formula
+	maxFormulaDepth      = 16  // nesting depth of parentheses / function calls
+	maxComputedPerUser   = 25  // user-defined columns allowed per user
+	computedRefreshLimit = 60 * time.Second
+)
+
+// computedNamePattern restricts computed column names to safe SQL-style identifiers
+var computedNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// formulaFunctions lists the functions a formula may call together with their
+// minimum and maximum argument counts (-1 = unbounded).
+var formulaFunctions = map[string][2]int{
+	"abs":      {1, 1},
+	"sqrt":     {1, 1},
+	"least":    {2, -1},
+	"greatest": {2, -1},
+}
+
+// ComputedColumn is a user-defined screener column expressed as a formula over
+// the built-in numeric screener columns, e.g. "(high - low) / close".
+type ComputedColumn struct {
+	ColumnID  int       `json:"columnId"`
+	Name      string    `json:"name"`
+	Formula   string    `json:"formula"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CompileFormula validates a formula and compiles it into a SQL expression that
+// references columns of the screener table through the alias "s". Only numeric
+// built-in columns, numeric literals, + - * /, parentheses and the functions in
+// formulaFunctions are accepted. Division is NULL-safe.
+func CompileFormula(formula string) (string, error) {
+	formula = strings.TrimSpace(formula)
+	if formula == "" {
+		return "", ValidationError{Field: "formula", Message: "formula cannot be empty"}
+	}
+	if len(formula) > maxFormulaLength {
+		return "", ValidationError{Field: "formula", Message: fmt.Sprintf("formula cannot exceed %d characters", maxFormulaLength)}
+	}
+
+	tokens, err := tokenizeFormula(formula)
+	if err != nil {
+		return "", err
+	}
+
+	p := &formulaParser{tokens: tokens}
+	expr, err := p.parseExpr(0)
+	if err != nil {
+		return "", err
+	}
+	if p.pos != len(p.tokens) {
+		return "", ValidationError{Field: "formula", Message: fmt.Sprintf("unexpected '%s'", p.tokens[p.pos].text)}
+	}
+
+	return fmt.Sprintf("(%s)::double precision", expr), nil
+}
+
+type formulaTokenKind int
+
+const (
+	tokenNumber formulaTokenKind = iota
+	tokenIdent
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type formulaToken struct {
+	kind formulaTokenKind
+	text string
+}
+
+// tokenizeFormula splits a formula into tokens, rejecting any character that is
+// not part of the grammar so nothing unexpected can reach the SQL compiler.
+func tokenizeFormula(formula string) ([]formulaToken, error) {
+	var tokens []formulaToken
+	runes := []rune(formula)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || r == '.':
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			text := string(runes[start:i])
+			if _, err := strconv.ParseFloat(text, 64); err != nil {
+				return nil, ValidationError{Field: "formula", Message: fmt.Sprintf("invalid number '%s'", text)}
+			}
+			tokens = append(tokens, formulaToken{kind: tokenNumber, text: text})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, formulaToken{kind: tokenIdent, text: strings.ToLower(string(runes[start:i]))})
+		case strings.ContainsRune("+-*/", r):
+			tokens = append(tokens, formulaToken{kind: tokenOperator, text: string(r)})
+			i++
+		case r == '(':
+			tokens = append(tokens, formulaToken{kind: tokenLParen, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, formulaToken{kind: tokenRParen, text: ")"})
+			i++
+		case r == ',':
+			tokens = append(tokens, formulaToken{kind: tokenComma, text: ","})
+			i++
+		default:
+			return nil, ValidationError{Field: "formula", Message: fmt.Sprintf("unexpected character '%c'", r)}
+		}
+	}
+	return tokens, nil
+}
+
+// formulaParser is a small recursive-descent parser that emits SQL directly.
+type formulaParser struct {
+	tokens []formulaToken
+	pos    int
+}
+
+func (p *formulaParser) peek() *formulaToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *formulaParser) parseExpr(depth int) (string, error) {
+	if depth > maxFormulaDepth {
+		return "", ValidationError{Field: "formula", Message: "formula is nested too deeply"}
+	}
+	left, err := p.parseTerm(depth)
+	if err != nil {
+		return "", err
+	}
+	for tok := p.peek(); tok != nil && tok.kind == tokenOperator && (tok.text == "+" || tok.text == "-"); tok = p.peek() {
+		p.pos++
+		right, err := p.parseTerm(depth)
+		if err != nil {
+			return "", err
+		}
+		left = fmt.Sprintf("(%s %s %s)", left, tok.text, right)
+	}
+	return left, nil
+}
+
+func (p *formulaParser) parseTerm(depth int) (string, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return "", err
+	}
+	for tok := p.peek(); tok != nil && tok.kind == tokenOperator && (tok.text == "*" || tok.text == "/"); tok = p.peek() {
+		p.pos++
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return "", err
+		}
+		if tok.text == "/" {
+			left = fmt.Sprintf("(%s / NULLIF(%s, 0))", left, right)
+		} else {
+			left = fmt.Sprintf("(%s * %s)", left, right)
+		}
+	}
+	return left, nil
+}
+
+func (p *formulaParser) parseUnary(depth int) (string, error) {
+	if tok := p.peek(); tok != nil && tok.kind == tokenOperator && tok.text == "-" {
+		p.pos++
+		operand, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(-%s)", operand), nil
+	}
+	return p.parsePrimary(depth)
+}
+
+func (p *formulaParser) parsePrimary(depth int) (string, error) {
+	tok := p.peek()
+	if tok == nil {
+		return "", ValidationError{Field: "formula", Message: "unexpected end of formula"}
+	}
+	p.pos++
+
+	switch tok.kind {
+	case tokenNumber:
+		return tok.text, nil
+
+	case tokenLParen:
+		inner, err := p.parseExpr(depth + 1)
+		if err != nil {
+			return "", err
+		}
+		if next := p.peek(); next == nil || next.kind != tokenRParen {
+			return "", ValidationError{Field: "formula", Message: "missing closing parenthesis"}
+		}
+		p.pos++
+		return inner, nil
+
+	case tokenIdent:
+		if next := p.peek(); next != nil && next.kind == tokenLParen {
+			return p.parseCall(tok.text, depth)
+		}
+		colInfo, exists := screenerColumns[tok.text]
+		if !exists {
+			return "", ValidationError{Field: "formula", Message: fmt.Sprintf("unknown column '%s'", tok.text)}
+		}
+		if colInfo.Type != TypeFloat && colInfo.Type != TypeInteger || colInfo.Name == "security_id" {
+			return "", ValidationError{Field: "formula", Message: fmt.Sprintf("column '%s' is not numeric", tok.text)}
+		}
+		return "s." + colInfo.Name, nil
+	}
+
+	return "", ValidationError{Field: "formula", Message: fmt.Sprintf("unexpected '%s'", tok.text)}
+}
+
+func (p *formulaParser) parseCall(name string, depth int) (string, error) {
+	arity, exists := formulaFunctions[name]
+	if !exists {
+		return "", ValidationError{Field: "formula", Message: fmt.Sprintf("unknown function '%s'", name)}
+	}
+	p.pos++ // consume "("
+
+	var args []string
+	for {
+		arg, err := p.parseExpr(depth + 1)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, arg)
+
+		next := p.peek()
+		if next == nil {
+			return "", ValidationError{Field: "formula", Message: fmt.Sprintf("missing closing parenthesis for '%s'", name)}
+		}
+		p.pos++
+		if next.kind == tokenRParen {
+			break
+		}
+		if next.kind != tokenComma {
+			return "", ValidationError{Field: "formula", Message: fmt.Sprintf("unexpected '%s' in call to '%s'", next.text, name)}
+		}
+	}
+
+	if len(args) < arity[0] || (arity[1] >= 0 && len(args) > arity[1]) {
+		return "", ValidationError{Field: "formula", Message: fmt.Sprintf("wrong number of arguments for '%s'", name)}
+	}
+
+	switch name {
+	case "sqrt":
+		// SQRT errors on negative input, return NULL instead
+		return fmt.Sprintf("(CASE WHEN %s >= 0 THEN SQRT(%s) END)", args[0], args[0]), nil
+	default:
+		return fmt.Sprintf("%s(%s)", strings.ToUpper(name), strings.Join(args, ", ")), nil
+	}
+}
+
+// loadComputedColumns returns the user's computed columns keyed by name.
+// Columns whose formula no longer compiles are skipped so a single bad row
+// cannot break the screener.
+func loadComputedColumns(ctx context.Context, conn *data.Conn, userID int) (map[string]ComputedColumn, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT column_id, name, formula, created_at
+		FROM screener_computed_columns
+		WHERE user_id = $1
+		ORDER BY name`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying computed columns: %w", err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]ComputedColumn)
+	for rows.Next() {
+		var col ComputedColumn
+		if err := rows.Scan(&col.ColumnID, &col.Name, &col.Formula, &col.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning computed column: %w", err)
+		}
+		if _, err := CompileFormula(col.Formula); err != nil {
+			log.Printf("⚠️ skipping computed column %d (%s): %v", col.ColumnID, col.Name, err)
+			continue
+		}
+		columns[col.Name] = col
+	}
+	return columns, rows.Err()
+}
+
+// CreateComputedColumnArgs contains the definition of a new computed column
+type CreateComputedColumnArgs struct {
+	Name    string `json:"name"`
+	Formula string `json:"formula"`
+}
+
+// CreateComputedColumn validates, compiles and stores a user-defined screener
+// column. Values are filled in by the next screener refresh.
+func CreateComputedColumn(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args CreateComputedColumnArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("invalid args: %v", err)
+	}
+
+	args.Name = strings.ToLower(strings.TrimSpace(args.Name))
+	if !computedNamePattern.MatchString(args.Name) {
+		return nil, ValidationError{Field: "name", Message: "name must start with a letter and contain only lowercase letters, digits and underscores (max 40 characters)"}
+	}
+	if _, exists := screenerColumns[args.Name]; exists {
+		return nil, ValidationError{Field: "name", Message: fmt.Sprintf("'%s' is a built-in screener column", args.Name)}
+	}
+	if _, err := CompileFormula(args.Formula); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	// Saving over an existing column doesn't add one, so only the others count
+	var count int
+	if err := conn.DB.QueryRow(ctx, `
+		SELECT COUNT(*) FROM screener_computed_columns WHERE user_id = $1 AND name <> $2`,
+		userID, args.Name).Scan(&count); err != nil {
+		return nil, fmt.Errorf("error counting computed columns: %w", err)
+	}
+	if count >= maxComputedPerUser {
+		return nil, ValidationError{Field: "name", Message: fmt.Sprintf("a maximum of %d computed columns is allowed", maxComputedPerUser)}
+	}
+
+	col := ComputedColumn{Name: args.Name, Formula: strings.TrimSpace(args.Formula)}
+	err := conn.DB.QueryRow(ctx, `
+		INSERT INTO screener_computed_columns (user_id, name, formula)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, name) DO UPDATE SET formula = EXCLUDED.formula, updated_at = NOW()
+		RETURNING column_id, created_at`,
+		userID, col.Name, col.Formula).Scan(&col.ColumnID, &col.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error saving computed column: %w", err)
+	}
+
+	// Populate values immediately so the column is usable without waiting for the next refresh
+	if err := refreshComputedColumn(ctx, conn, col.ColumnID, col.Formula); err != nil {
+		log.Printf("⚠️ initial refresh of computed column %d failed: %v", col.ColumnID, err)
+	}
+
+	return col, nil
+}
+
+// GetComputedColumns lists the user's computed screener columns
+func GetComputedColumns(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	columns, err := loadComputedColumns(context.Background(), conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]ComputedColumn, 0, len(columns))
+	for _, col := range columns {
+		result = append(result, col)
+	}
+	return result, nil
+}
+
+// DeleteComputedColumnArgs identifies the computed column to delete
+type DeleteComputedColumnArgs struct {
+	ColumnID int `json:"columnId"`
+	// OnDependents is what happens to strategy alerts whose universe was
+	// screened on the column: detach (the default) or cascade
+	OnDependents  string `json:"onDependents,omitempty"`
+	TwoFactorCode string `json:"twoFactorCode,omitempty"`
+}
+
+// DeleteComputedColumn removes a computed column and its materialized values
+func DeleteComputedColumn(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args DeleteComputedColumnArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("invalid args: %v", err)
+	}
+	ctx := context.Background()
+	tx, err := conn.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(context.Background()) }()
+	resolution, err := dependencies.Resolve(ctx, conn, tx, userID, dependencies.TypeScreenerColumn, args.ColumnID,
+		args.OnDependents, args.TwoFactorCode)
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.Exec(ctx, `
+		DELETE FROM screener_computed_columns WHERE column_id = $1 AND user_id = $2`,
+		args.ColumnID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting computed column: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return nil, fmt.Errorf("computed column not found")
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing computed column deletion: %w", err)
+	}
+	if resolution.DeletedActiveAlerts > 0 {
+		if err := limits.DecrementActiveStrategyAlerts(conn, userID, resolution.DeletedActiveAlerts); err != nil {
+			log.Printf("Warning: failed to decrement active strategy alerts counter for user %d: %v", userID, err)
+		}
+	}
+	return map[string]interface{}{"success": true}, nil
+}
+
+// RefreshComputedColumns recomputes every user-defined column against the
+// current screener table. It is called by the screener updater after each
+// successful refresh.
+func RefreshComputedColumns(conn *data.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), computedRefreshLimit)
+	defer cancel()
+
+	rows, err := conn.DB.Query(ctx, `SELECT column_id, formula FROM screener_computed_columns`)
+	if err != nil {
+		log.Printf("❌ RefreshComputedColumns: failed to load computed columns: %v", err)
+		return
+	}
+	type pending struct {
+		id      int
+		formula string
+	}
+	var columns []pending
+	for rows.Next() {
+		var c pending
+		if err := rows.Scan(&c.id, &c.formula); err != nil {
+			rows.Close()
+			log.Printf("❌ RefreshComputedColumns: failed to scan computed column: %v", err)
+			return
+		}
+		columns = append(columns, c)
+	}
+	rows.Close()
+
+	start := time.Now()
+	for _, c := range columns {
+		if err := refreshComputedColumn(ctx, conn, c.id, c.formula); err != nil {
+			log.Printf("⚠️ RefreshComputedColumns: column %d failed: %v", c.id, err)
+		}
+	}
+	if len(columns) > 0 {
+		log.Printf("✅ Refreshed %d computed screener columns in %v", len(columns), time.Since(start))
+	}
+}
+
+// refreshComputedColumn materializes a single computed column for every ticker
+func refreshComputedColumn(ctx context.Context, conn *data.Conn, columnID int, formula string) error {
+	expr, err := CompileFormula(formula)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`
+		INSERT INTO screener_computed_values (column_id, ticker, value, calc_time)
+		SELECT $1, s.ticker, %s, NOW()
+		FROM screener s
+		ON CONFLICT (column_id, ticker) DO UPDATE
+		SET value = EXCLUDED.value, calc_time = EXCLUDED.calc_time`, expr)
+	_, err = conn.DB.Exec(ctx, query, columnID)
+	return err
+}
+
+// ResolveUniverse runs the given screener filters for the user and returns the
+// matching tickers. It lets strategy alert universes be defined by a screen
+// (including computed columns) instead of a fixed ticker list. When asOf is
+// set the screen runs against the historical snapshot for that date, which
+// keeps backtest universes free of survivorship and lookahead bias.
+func ResolveUniverse(conn *data.Conn, userID int, filters []Filter, limit int, asOf string) ([]string, error) {
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
+	rawArgs, err := json.Marshal(Args{ReturnColumns: []string{"ticker"}, Limit: limit, Filters: filters, AsOf: asOf})
+	if err != nil {
+		return nil, err
+	}
+	res, err := GetScreenerData(conn, userID, rawArgs)
+	if err != nil {
+		return nil, err
+	}
+	response, _ := res.(map[string]interface{})
+	results, _ := response["results"].([]map[string]interface{})
+	tickers := make([]string, 0, len(results))
+	for _, row := range results {
+		if t, ok := row["ticker"].(string); ok && t != "" {
+			tickers = append(tickers, t)
+		}
+	}
+	return tickers, nil
+}
+
+// ComputedColumnIDs returns the ids of the user's computed columns that
+// filters refer to
+func ComputedColumnIDs(ctx context.Context, conn *data.Conn, userID int, filters []Filter) ([]int, error) {
+	computed, err := loadComputedColumns(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	seen := make(map[int]bool)
+	for _, f := range filters {
+		if col, ok := computed[f.Column]; ok && !seen[col.ColumnID] {
+			seen[col.ColumnID] = true
+			ids = append(ids, col.ColumnID)
+		}
+	}
+	return ids, nil
+}
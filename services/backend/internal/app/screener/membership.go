@@ -0,0 +1,93 @@
+package screener
+
+import (
+	"backend/internal/services/securities"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// IndexMemberColumn is a filter-only column matching securities that belong to
+// an index (SPX, NDX, or a tracking ETF like SPY or QQQ). It is point in time:
+// as-of screens check membership on the as-of date, live screens on today.
+// "=" takes one index, "IN" matches members of any of the listed ones.
+const IndexMemberColumn = "index_member"
+
+var indexMemberColumn = ColumnInfo{
+	Name:        IndexMemberColumn,
+	Type:        TypeString,
+	AllowedOps:  []string{"=", "IN"},
+	Description: "Member of an index on the screen date (SPX, NDX; ETFs like SPY or QQQ map to their index)",
+}
+
+// indexFilterSymbols validates the value of an index_member filter and returns
+// the index symbols it refers to
+func indexFilterSymbols(filter Filter) ([]string, error) {
+	var raw []interface{}
+	switch filter.Operator {
+	case "=":
+		raw = []interface{}{filter.Value}
+	case "IN":
+		rv := reflect.ValueOf(filter.Value)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return nil, fmt.Errorf("value for IN operator must be a slice or array, got %T", filter.Value)
+		}
+		for i := 0; i < rv.Len(); i++ {
+			raw = append(raw, rv.Index(i).Interface())
+		}
+	default:
+		return nil, fmt.Errorf("operator '%s' is not allowed for column '%s'. Allowed operators: %s",
+			filter.Operator, IndexMemberColumn, strings.Join(indexMemberColumn.AllowedOps, ", "))
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("at least one index is required")
+	}
+	symbols := make([]string, 0, len(raw))
+	for _, v := range raw {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("index must be a string, got %T", v)
+		}
+		symbol, ok := securities.NormalizeIndexSymbol(s)
+		if !ok {
+			tracked := make([]string, 0, len(securities.TrackedIndices))
+			for _, idx := range securities.TrackedIndices {
+				tracked = append(tracked, idx.Symbol)
+			}
+			return nil, fmt.Errorf("unknown index '%s'. Tracked indices: %s", s, strings.Join(tracked, ", "))
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols, nil
+}
+
+// membershipDate is the date index membership is checked on
+func (a Args) membershipDate() time.Time {
+	if a.AsOf != "" {
+		return a.asOfDate
+	}
+	return securities.IndexDate()
+}
+
+// indexMemberClause builds the WHERE clause of an index_member filter
+func (a Args) indexMemberClause(filter Filter, paramIndex int) (string, []interface{}, error) {
+	symbols, err := indexFilterSymbols(filter)
+	if err != nil {
+		return "", nil, err
+	}
+	clause := fmt.Sprintf(`s.ticker IN (
+		SELECT ic.ticker FROM index_constituents ic
+		WHERE ic.index_symbol = ANY($%d) AND ic.effective_from <= $%d::date
+		  AND (ic.effective_to IS NULL OR ic.effective_to > $%d::date))`,
+		paramIndex, paramIndex+1, paramIndex+1)
+	return clause, []interface{}{symbols, a.membershipDate().Format("2006-01-02")}, nil
+}
+
+// filterClause builds the WHERE clause of any standard (non-ranking) filter
+func (a Args) filterClause(filter Filter, paramIndex int) (string, []interface{}, error) {
+	if filter.Column == IndexMemberColumn {
+		return a.indexMemberClause(filter, paramIndex)
+	}
+	return buildFilterClause(a.columnRef(filter.Column), filter, paramIndex)
+}
@@ -5,6 +5,7 @@ package screener
 
 import (
 	"backend/internal/data"
+	"backend/internal/services/flags"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -436,6 +437,65 @@ type Args struct {
 	SortDirection string
 	Limit         int
 	Filters       []Filter
+	// AsOf (YYYY-MM-DD) runs the screen against the most recent daily snapshot
+	// taken on or before that date instead of the live screener table.
+	AsOf string
+
+	computed map[string]ComputedColumn // the requesting user's computed columns
+	asOfDate time.Time
+}
+
+// columns returns the built-in screener columns merged with the user's
+// computed columns, which behave like float columns.
+func (a Args) columns() map[string]ColumnInfo {
+	if a.AsOf != "" {
+		return snapshotColumnInfo()
+	}
+	if len(a.computed) == 0 {
+		return screenerColumns
+	}
+	merged := make(map[string]ColumnInfo, len(screenerColumns)+len(a.computed))
+	for name, info := range screenerColumns {
+		merged[name] = info
+	}
+	for name, col := range a.computed {
+		merged[name] = ColumnInfo{
+			Name:        name,
+			Type:        TypeFloat,
+			AllowedOps:  []string{">", "<", ">=", "<=", "topn", "bottomn", "topn_pct", "bottomn_pct"},
+			Description: "Computed: " + col.Formula,
+		}
+	}
+	return merged
+}
+
+// columnRef returns the SQL expression used to reference a column in queries
+func (a Args) columnRef(name string) string {
+	if col, ok := a.computed[name]; ok {
+		return fmt.Sprintf("cc%d.value", col.ColumnID)
+	}
+	return "s." + name
+}
+
+// referencedComputed returns the computed columns used anywhere in the query
+// (return columns, order by or filters), each listed once.
+func (a Args) referencedComputed() []ComputedColumn {
+	seen := make(map[string]bool)
+	var cols []ComputedColumn
+	add := func(name string) {
+		if col, ok := a.computed[name]; ok && !seen[name] {
+			seen[name] = true
+			cols = append(cols, col)
+		}
+	}
+	for _, col := range a.ReturnColumns {
+		add(col)
+	}
+	add(a.OrderBy)
+	for _, f := range a.Filters {
+		add(f.Column)
+	}
+	return cols
 }
 
 // ValidationError represents a validation error
@@ -454,10 +514,10 @@ func GetAvailableColumns() map[string]ColumnInfo {
 }
 
 // validateColumn checks if a column exists and is valid
-func validateColumn(columnName string) error {
-	if _, exists := screenerColumns[columnName]; !exists {
-		availableColumns := make([]string, 0, len(screenerColumns))
-		for col := range screenerColumns {
+func validateColumn(columns map[string]ColumnInfo, columnName string) error {
+	if _, exists := columns[columnName]; !exists {
+		availableColumns := make([]string, 0, len(columns))
+		for col := range columns {
 			availableColumns = append(availableColumns, col)
 		}
 		sort.Strings(availableColumns)
@@ -470,8 +530,8 @@ func validateColumn(columnName string) error {
 }
 
 // validateOperator checks if an operator is valid for a given column
-func validateOperator(columnName, operator string) error {
-	colInfo, exists := screenerColumns[columnName]
+func validateOperator(columns map[string]ColumnInfo, columnName, operator string) error {
+	colInfo, exists := columns[columnName]
 	if !exists {
 		return ValidationError{
 			Field:   "column",
@@ -493,8 +553,8 @@ func validateOperator(columnName, operator string) error {
 }
 
 // validateValue checks if a value is compatible with the column type and operator
-func validateValue(columnName, operator string, value interface{}) error {
-	colInfo := screenerColumns[columnName]
+func validateValue(columns map[string]ColumnInfo, columnName, operator string, value interface{}) error {
+	colInfo := columns[columnName]
 
 	// Special handling for ranking operators
 	if operator == "topn" || operator == "bottomn" || operator == "topn_pct" || operator == "bottomn_pct" {
@@ -658,6 +718,8 @@ func validateSingleValue(colType ColumnType, value interface{}) error {
 
 // validateArgs validates the entire Args struct
 func validateArgs(args Args) error {
+	columns := args.columns()
+
 	// Validate return columns
 	if len(args.ReturnColumns) == 0 {
 		return ValidationError{
@@ -667,14 +729,14 @@ func validateArgs(args Args) error {
 	}
 
 	for _, col := range args.ReturnColumns {
-		if err := validateColumn(col); err != nil {
+		if err := validateColumn(columns, col); err != nil {
 			return err
 		}
 	}
 
 	// Validate order by column
 	if args.OrderBy != "" {
-		if err := validateColumn(args.OrderBy); err != nil {
+		if err := validateColumn(columns, args.OrderBy); err != nil {
 			return ValidationError{
 				Field:   "order_by",
 				Message: fmt.Sprintf("order by column error: %s", err.Error()),
@@ -717,21 +779,30 @@ func validateArgs(args Args) error {
 
 	// Validate filters
 	for i, filter := range args.Filters {
-		if err := validateColumn(filter.Column); err != nil {
+		if filter.Column == IndexMemberColumn {
+			if _, err := indexFilterSymbols(filter); err != nil {
+				return ValidationError{
+					Field:   fmt.Sprintf("filters[%d].value", i),
+					Message: err.Error(),
+				}
+			}
+			continue
+		}
+		if err := validateColumn(columns, filter.Column); err != nil {
 			return ValidationError{
 				Field:   fmt.Sprintf("filters[%d].column", i),
 				Message: err.Error(),
 			}
 		}
 
-		if err := validateOperator(filter.Column, filter.Operator); err != nil {
+		if err := validateOperator(columns, filter.Column, filter.Operator); err != nil {
 			return ValidationError{
 				Field:   fmt.Sprintf("filters[%d].operator", i),
 				Message: err.Error(),
 			}
 		}
 
-		if err := validateValue(filter.Column, filter.Operator, filter.Value); err != nil {
+		if err := validateValue(columns, filter.Column, filter.Operator, filter.Value); err != nil {
 			return ValidationError{
 				Field:   fmt.Sprintf("filters[%d].value", i),
 				Message: err.Error(),
@@ -765,20 +836,36 @@ func buildQuery(args Args) (string, []interface{}, error) {
 	var selectColumns []string
 	selectColumns = append(selectColumns, "s.ticker")
 	for _, col := range args.ReturnColumns {
-		selectColumns = append(selectColumns, "s."+col)
+		if _, ok := args.computed[col]; ok {
+			selectColumns = append(selectColumns, args.columnRef(col)+" AS "+col)
+		} else {
+			selectColumns = append(selectColumns, "s."+col)
+		}
 	}
 	selectClause := "SELECT " + strings.Join(selectColumns, ", ")
 	queryParts = append(queryParts, selectClause)
 
 	// FROM clause - ticker is now directly in screener table
-	fromClause := "FROM screener s"
+	fromClause := "FROM " + args.sourceTable()
 	queryParts = append(queryParts, fromClause)
 
-	// WHERE clause for standard filters
+	// JOIN the materialized values of every computed column the query references
+	for _, col := range args.referencedComputed() {
+		queryParts = append(queryParts, fmt.Sprintf(
+			"LEFT JOIN screener_computed_values cc%d ON cc%d.column_id = %d AND cc%d.ticker = s.ticker",
+			col.ColumnID, col.ColumnID, col.ColumnID, col.ColumnID))
+	}
+
+	// WHERE clause for the as-of snapshot date and standard filters
+	var whereClauses []string
+	if args.AsOf != "" {
+		whereClauses = append(whereClauses, args.snapshotDateClause(paramIndex))
+		params = append(params, args.asOfDate)
+		paramIndex++
+	}
 	if len(standardFilters) > 0 {
-		var whereClauses []string
 		for _, filter := range standardFilters {
-			clause, filterParams, err := buildFilterClause(filter, paramIndex)
+			clause, filterParams, err := args.filterClause(filter, paramIndex)
 			if err != nil {
 				return "", nil, err
 			}
@@ -786,6 +873,8 @@ func buildQuery(args Args) (string, []interface{}, error) {
 			params = append(params, filterParams...)
 			paramIndex += len(filterParams)
 		}
+	}
+	if len(whereClauses) > 0 {
 		queryParts = append(queryParts, "WHERE "+strings.Join(whereClauses, " AND "))
 	}
 
@@ -819,7 +908,7 @@ func buildQuery(args Args) (string, []interface{}, error) {
 					countParams := []interface{}{}
 					countParamIndex := 1
 					for _, stdFilter := range standardFilters {
-						clause, filterParams, err := buildFilterClause(stdFilter, countParamIndex)
+						clause, filterParams, err := args.filterClause(stdFilter, countParamIndex)
 						if err != nil {
 							return "", nil, err
 						}
@@ -834,12 +923,12 @@ func buildQuery(args Args) (string, []interface{}, error) {
 				// The actual implementation would need to execute the count query first
 				// For now, we'll use a simplified approach
 				// Always sort NULLs last regardless of direction
-				baseQuery = fmt.Sprintf("SELECT * FROM (%s ORDER BY s.%s %s NULLS LAST LIMIT (SELECT CEIL(COUNT(*) * %d / 100.0) FROM screener s)) ranked_results",
-					baseQuery, filter.Column, orderDirection, limitValue)
+				baseQuery = fmt.Sprintf("SELECT * FROM (%s ORDER BY %s %s NULLS LAST LIMIT (SELECT CEIL(COUNT(*) * %d / 100.0) FROM %s)) ranked_results",
+					baseQuery, args.columnRef(filter.Column), orderDirection, limitValue, args.rankingUniverse())
 			} else {
 				// Always sort NULLs last regardless of direction
-				baseQuery = fmt.Sprintf("SELECT * FROM (%s ORDER BY s.%s %s NULLS LAST LIMIT %d) ranked_results",
-					baseQuery, filter.Column, orderDirection, limitValue)
+				baseQuery = fmt.Sprintf("SELECT * FROM (%s ORDER BY %s %s NULLS LAST LIMIT %d) ranked_results",
+					baseQuery, args.columnRef(filter.Column), orderDirection, limitValue)
 			}
 		}
 
@@ -848,7 +937,7 @@ func buildQuery(args Args) (string, []interface{}, error) {
 
 	// ORDER BY clause (if not already handled by ranking)
 	if args.OrderBy != "" && len(rankingFilters) == 0 {
-		orderClause := "ORDER BY s." + args.OrderBy
+		orderClause := "ORDER BY " + args.columnRef(args.OrderBy)
 		if args.SortDirection != "" {
 			orderClause += " " + strings.ToUpper(args.SortDirection)
 		}
@@ -867,13 +956,10 @@ func buildQuery(args Args) (string, []interface{}, error) {
 }
 
 // buildFilterClause builds a WHERE clause for a single filter
-func buildFilterClause(filter Filter, startParamIndex int) (string, []interface{}, error) {
+func buildFilterClause(columnWithAlias string, filter Filter, startParamIndex int) (string, []interface{}, error) {
 	var clause string
 	var params []interface{}
 
-	// Add table alias to column name
-	columnWithAlias := "s." + filter.Column
-
 	switch filter.Operator {
 	case "=", "!=", ">", "<", ">=", "<=":
 		clause = fmt.Sprintf("%s %s $%d", columnWithAlias, filter.Operator, startParamIndex)
@@ -954,6 +1040,22 @@ func GetScreenerData(conn *data.Conn, userID int, rawArgs json.RawMessage) (inte
 	if err := json.Unmarshal(rawArgs, &args); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal screener arguments: %w", err)
 	}
+	if args.AsOf != "" {
+		if !flags.IsEnabled(context.Background(), flags.ScreenerAsOf, userID) {
+			return nil, ValidationError{Field: "asOf", Message: "screening a past day is not available"}
+		}
+		asOfDate, err := time.Parse("2006-01-02", args.AsOf)
+		if err != nil {
+			return nil, ValidationError{Field: "asOf", Message: "asOf must be a date in YYYY-MM-DD format"}
+		}
+		args.asOfDate = asOfDate
+	} else {
+		computed, err := loadComputedColumns(context.Background(), conn, userID)
+		if err != nil {
+			return nil, err
+		}
+		args.computed = computed
+	}
 	if err := validateArgs(args); err != nil {
 		return nil, err
 	}
@@ -1014,9 +1116,13 @@ func GetScreenerData(conn *data.Conn, userID int, rawArgs json.RawMessage) (inte
 		"count":   len(results),
 		"columns": columnNames,
 	}
+	if args.AsOf != "" {
+		response["asOf"] = args.AsOf
+	}
 
-	// DEBUG: print the response for visibility during development
-	log.Printf("GetScreenerData response (user=%d): %+v", userID, response)
+	if flags.IsEnabled(context.Background(), flags.ScreenerDebugLogging, userID) {
+		log.Printf("GetScreenerData response (user=%d): %+v", userID, response)
+	}
 
 	return response, nil
 }
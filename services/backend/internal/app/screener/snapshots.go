@@ -0,0 +1,73 @@
+package screener
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SnapshotColumns lists the screener columns persisted in the daily
+// screener_snapshots table. As-of queries are limited to these columns.
+var SnapshotColumns = []string{
+	"security_id",
+	"open", "high", "low", "close",
+	"wk52_low", "wk52_high",
+	"market_cap", "sector", "industry",
+	"change_1d_pct", "change_1w_pct", "change_1m_pct", "change_3m_pct",
+	"change_6m_pct", "change_ytd_pct", "change_1y_pct",
+	"price_over_52wk_high", "price_over_52wk_low",
+	"rsi", "dma_50", "dma_200", "price_over_50dma", "price_over_200dma",
+	"beta_1y_vs_spy",
+	"volume", "avg_volume_1m", "dollar_volume", "avg_dollar_volume_1m", "relative_volume_14",
+	"day_range_pct", "volatility_1w_pct", "volatility_1m_pct",
+}
+
+// snapshotColumnInfo returns the metadata of the columns available in snapshots
+func snapshotColumnInfo() map[string]ColumnInfo {
+	columns := make(map[string]ColumnInfo, len(SnapshotColumns)+1)
+	columns["ticker"] = screenerColumns["ticker"]
+	for _, name := range SnapshotColumns {
+		if info, ok := screenerColumns[name]; ok {
+			columns[name] = info
+		}
+	}
+	return columns
+}
+
+// sourceTable returns the table (aliased as s) a query reads from
+func (a Args) sourceTable() string {
+	if a.AsOf != "" {
+		return "screener_snapshots s"
+	}
+	return "screener s"
+}
+
+// snapshotDateClause restricts an as-of query to the latest snapshot taken on
+// or before the requested date. The date is bound to the given parameter.
+func (a Args) snapshotDateClause(paramIndex int) string {
+	return fmt.Sprintf("s.snapshot_date = (SELECT MAX(snapshot_date) FROM screener_snapshots WHERE snapshot_date <= $%d)", paramIndex)
+}
+
+// rankingUniverse returns the row set percentage-based ranking filters are
+// computed against. As-of queries reuse the date parameter bound first ($1).
+func (a Args) rankingUniverse() string {
+	if a.AsOf != "" {
+		return "screener_snapshots s WHERE " + a.snapshotDateClause(1)
+	}
+	return "screener s"
+}
+
+// SnapshotInsertQuery builds the statement that copies the live screener table
+// into screener_snapshots for the date bound to $1.
+func SnapshotInsertQuery() string {
+	updates := make([]string, 0, len(SnapshotColumns))
+	for _, col := range SnapshotColumns {
+		updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", col, col))
+	}
+	columns := strings.Join(SnapshotColumns, ", ")
+	return fmt.Sprintf(`
+		INSERT INTO screener_snapshots (snapshot_date, ticker, %s)
+		SELECT $1, ticker, %s
+		FROM screener
+		ON CONFLICT (snapshot_date, ticker) DO UPDATE SET %s`,
+		columns, columns, strings.Join(updates, ", "))
+}
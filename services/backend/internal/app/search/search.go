@@ -0,0 +1,409 @@
+// Package search is the global search behind the command palette and the
+// agent's searchEntities tool. One query matches securities and the user's own
+// strategies, watchlists and studies; what the user picked before is offered
+// as shortcuts while nothing is typed and ranks above equally good matches.
+package search
+
+import (
+	"backend/internal/app/helpers"
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entity types
+const (
+	TypeSecurity  = "security"
+	TypeStrategy  = "strategy"
+	TypeWatchlist = "watchlist"
+	TypeStudy     = "study"
+)
+
+// AllTypes are searched when a request names none
+var AllTypes = []string{TypeSecurity, TypeStrategy, TypeWatchlist, TypeStudy}
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+	maxQueryLength     = 100
+	// shortcuts offered for an empty query, of each kind
+	shortcutLimit = 5
+	// history kept per user, oldest dropped first
+	maxHistoryPerUser = 200
+	// selections in this window count as recent for ranking
+	recentWindow = 7 * 24 * time.Hour
+	// weakest name similarity that still counts as a match
+	minSimilarity = 0.3
+)
+
+// Args are the arguments of globalSearch
+type Args struct {
+	Query string   `json:"query"`
+	Types []string `json:"types,omitempty"`
+	Limit int      `json:"limit,omitempty"`
+}
+
+// Result is one matching entity
+type Result struct {
+	Type     string  `json:"type"`
+	ID       int     `json:"id"`
+	Title    string  `json:"title"`
+	Subtitle string  `json:"subtitle,omitempty"`
+	Icon     string  `json:"icon,omitempty"`
+	Score    float64 `json:"score"`
+	// times the user picked it from search
+	Uses int `json:"uses,omitempty"`
+}
+
+// Response holds the matches of a query, or the user's shortcuts when the
+// query is empty
+type Response struct {
+	Results  []Result `json:"results"`
+	Recent   []Result `json:"recent,omitempty"`
+	Frequent []Result `json:"frequent,omitempty"`
+}
+
+// historyEntry is a search_history row
+type historyEntry struct {
+	uses     int
+	lastUsed time.Time
+}
+
+type entityKey struct {
+	Type string
+	ID   int
+}
+
+func parseArgs(raw json.RawMessage) (Args, error) {
+	var args Args
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return args, apperr.InvalidArgs(err)
+		}
+	}
+	args.Query = strings.Join(strings.Fields(args.Query), " ")
+	if len([]rune(args.Query)) > maxQueryLength {
+		return args, apperr.Validation("query must be at most %d characters", maxQueryLength)
+	}
+	switch {
+	case args.Limit == 0:
+		args.Limit = defaultSearchLimit
+	case args.Limit < 0 || args.Limit > maxSearchLimit:
+		return args, apperr.Validation("limit must be between 1 and %d", maxSearchLimit)
+	}
+	if len(args.Types) == 0 {
+		args.Types = AllTypes
+	}
+	for _, t := range args.Types {
+		if !validType(t) {
+			return args, apperr.Validation("unknown type %q, use %s", t, strings.Join(AllTypes, ", "))
+		}
+	}
+	return args, nil
+}
+
+func validType(t string) bool {
+	for _, known := range AllTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+func wants(types []string, t string) bool {
+	for _, want := range types {
+		if want == t {
+			return true
+		}
+	}
+	return false
+}
+
+// GlobalSearch searches securities and the user's strategies, watchlists and
+// studies. With an empty query it returns the user's recent and frequent
+// selections instead.
+func GlobalSearch(ctx context.Context, conn *data.Conn, userID int, raw json.RawMessage) (interface{}, error) {
+	args, err := parseArgs(raw)
+	if err != nil {
+		return nil, err
+	}
+	if args.Query == "" {
+		return shortcuts(ctx, conn, userID, args.Types)
+	}
+
+	history, err := loadHistory(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	results := []Result{}
+	if wants(args.Types, TypeSecurity) {
+		securities, err := searchSecurities(conn, args.Query)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, securities...)
+	}
+	owned, err := searchOwned(ctx, conn, userID, args.Query, args.Types, args.Limit)
+	if err != nil {
+		return nil, err
+	}
+	results = append(results, owned...)
+
+	now := time.Now()
+	for i := range results {
+		if h, ok := history[entityKey{results[i].Type, results[i].ID}]; ok {
+			results[i].Uses = h.uses
+			results[i].Score += historyBoost(h, now)
+		}
+		results[i].Score = math.Round(results[i].Score*1000) / 1000
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > args.Limit {
+		results = results[:args.Limit]
+	}
+	return Response{Results: results}, nil
+}
+
+// historyBoost lifts entities the user picked before: up to 0.2 for how often
+// and 0.1 for having picked it in the last week, less than the gap between
+// an exact and a partial match
+func historyBoost(h historyEntry, now time.Time) float64 {
+	boost := math.Min(0.2, 0.05*math.Log1p(float64(h.uses)))
+	if now.Sub(h.lastUsed) < recentWindow {
+		boost += 0.1
+	}
+	return boost
+}
+
+// searchSecurities scores the ticker search's ranked matches from 1 down
+func searchSecurities(conn *data.Conn, query string) ([]Result, error) {
+	matches, err := helpers.SearchTickers(conn, query)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, 0, len(matches))
+	for i, m := range matches {
+		results = append(results, Result{
+			Type:     TypeSecurity,
+			ID:       m.SecurityID,
+			Title:    m.Ticker,
+			Subtitle: m.Name,
+			Icon:     m.Icon,
+			Score:    math.Max(0.95-0.05*float64(i), 0.4),
+		})
+	}
+	if len(results) > 0 && strings.EqualFold(results[0].Title, strings.ReplaceAll(query, " ", "")) {
+		results[0].Score = 1
+	}
+	return results, nil
+}
+
+// ownedEntities lists the entities only their owner, and members of the
+// workspace they are shared to, may see as type, id, title, subtitle and the
+// text matched against the query
+const ownedEntities = `
+	SELECT 'strategy' AS type, s.strategyid AS id, s.name AS title,
+	       COALESCE(s.description, '') AS subtitle, lower(s.name) AS key
+	FROM strategies s
+	WHERE s.userid = $1 OR s.workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1)
+	UNION ALL
+	SELECT 'watchlist', w.watchlistId, w.watchlistName, '', lower(w.watchlistName)
+	FROM watchlists w
+	WHERE w.userId = $1 OR w.workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1)
+	UNION ALL
+	SELECT 'study', st.studyId,
+	       concat_ws(' · ', sec.ticker, str.name),
+	       COALESCE(to_char(st.timestamp, 'YYYY-MM-DD'), ''),
+	       lower(concat_ws(' ', sec.ticker, str.name))
+	FROM studies st
+	LEFT JOIN LATERAL (
+		SELECT ticker FROM securities
+		WHERE securityid = st.securityId
+		ORDER BY maxDate DESC NULLS FIRST LIMIT 1
+	) sec ON true
+	LEFT JOIN strategies str ON str.strategyid = st.strategyId
+	WHERE st.userId = $1`
+
+// searchOwned matches the user's strategies, watchlists and studies by name:
+// exact names score 1, prefixes 0.8, a prefix of any word 0.7, any substring
+// 0.6 and fuzzy matches up to 0.5
+func searchOwned(ctx context.Context, conn *data.Conn, userID int, query string, types []string, limit int) ([]Result, error) {
+	q := strings.ToLower(query)
+	like := escapeLike(q)
+	rows, err := conn.DB.Query(ctx, `
+		SELECT type, id, title, subtitle, score FROM (
+			SELECT e.type, e.id, e.title, e.subtitle,
+			       CASE
+			           WHEN e.key = $2 THEN 1.0
+			           WHEN e.key LIKE $3 || '%' THEN 0.8
+			           WHEN e.key LIKE '% ' || $3 || '%' THEN 0.7
+			           WHEN e.key LIKE '%' || $3 || '%' THEN 0.6
+			           ELSE 0.5 * word_similarity($2, e.key)
+			       END AS score
+			FROM (`+ownedEntities+`) e
+			WHERE e.type = ANY($4)
+			  AND (e.key LIKE '%' || $3 || '%' OR word_similarity($2, e.key) >= $5)
+		) m
+		ORDER BY score DESC, title
+		LIMIT $6`,
+		userID, q, like, types, minSimilarity, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error searching user entities: %v", err)
+	}
+	defer rows.Close()
+	results := []Result{}
+	for rows.Next() {
+		var r Result
+		if err := rows.Scan(&r.Type, &r.ID, &r.Title, &r.Subtitle, &r.Score); err != nil {
+			return nil, fmt.Errorf("error scanning search result: %v", err)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards in s; backslash is the default escape
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func loadHistory(ctx context.Context, conn *data.Conn, userID int) (map[entityKey]historyEntry, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT entity_type, entity_id, uses, last_used_at
+		FROM search_history WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading search history: %v", err)
+	}
+	defer rows.Close()
+	history := make(map[entityKey]historyEntry)
+	for rows.Next() {
+		var k entityKey
+		var h historyEntry
+		if err := rows.Scan(&k.Type, &k.ID, &h.uses, &h.lastUsed); err != nil {
+			return nil, fmt.Errorf("error scanning search history: %v", err)
+		}
+		history[k] = h
+	}
+	return history, rows.Err()
+}
+
+// shortcuts returns the user's most recent and most frequent selections that
+// still exist and are still theirs. Frequent leaves out the recent ones.
+func shortcuts(ctx context.Context, conn *data.Conn, userID int, types []string) (Response, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT h.entity_type, h.entity_id, e.title, e.subtitle, e.icon, h.uses, h.last_used_at
+		FROM search_history h
+		JOIN (
+			SELECT 'security' AS type, s.securityid AS id, s.ticker AS title,
+			       COALESCE(s.name, '') AS subtitle,
+			       COALESCE('/assets/' || s.icon_hash, s.icon, '') AS icon
+			FROM securities s WHERE s.maxDate IS NULL
+			UNION ALL
+			SELECT o.type, o.id, o.title, o.subtitle, '' FROM (`+ownedEntities+`) o
+		) e ON e.type = h.entity_type AND e.id = h.entity_id
+		WHERE h.user_id = $1 AND h.entity_type = ANY($2)
+		ORDER BY h.last_used_at DESC`, userID, types)
+	if err != nil {
+		return Response{}, fmt.Errorf("error loading search shortcuts: %v", err)
+	}
+	defer rows.Close()
+	var entries []Result
+	lastUsed := make(map[entityKey]time.Time)
+	for rows.Next() {
+		var r Result
+		var at time.Time
+		if err := rows.Scan(&r.Type, &r.ID, &r.Title, &r.Subtitle, &r.Icon, &r.Uses, &at); err != nil {
+			return Response{}, fmt.Errorf("error scanning search shortcut: %v", err)
+		}
+		lastUsed[entityKey{r.Type, r.ID}] = at
+		entries = append(entries, r)
+	}
+	if err := rows.Err(); err != nil {
+		return Response{}, err
+	}
+
+	resp := Response{Results: []Result{}, Recent: []Result{}, Frequent: []Result{}}
+	now := time.Now()
+	for i := range entries {
+		entries[i].Score = math.Round(historyBoost(historyEntry{entries[i].Uses, lastUsed[entityKey{entries[i].Type, entries[i].ID}]}, now)*1000) / 1000
+	}
+	// entries are newest first
+	recent := make(map[entityKey]bool)
+	for _, r := range entries {
+		if len(resp.Recent) == shortcutLimit {
+			break
+		}
+		resp.Recent = append(resp.Recent, r)
+		recent[entityKey{r.Type, r.ID}] = true
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Uses > entries[j].Uses })
+	for _, r := range entries {
+		if len(resp.Frequent) == shortcutLimit {
+			break
+		}
+		if !recent[entityKey{r.Type, r.ID}] {
+			resp.Frequent = append(resp.Frequent, r)
+		}
+	}
+	return resp, nil
+}
+
+// SelectionArgs name the entity the user picked from the search
+type SelectionArgs struct {
+	Type string `json:"type"`
+	ID   int    `json:"id"`
+}
+
+// RecordSearchSelection counts the user picking an entity from the search
+// towards their shortcuts and ranking. Only securities and the user's own
+// entities are recorded.
+func RecordSearchSelection(ctx context.Context, conn *data.Conn, userID int, raw json.RawMessage) (interface{}, error) {
+	var args SelectionArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if !validType(args.Type) {
+		return nil, apperr.Validation("unknown type %q, use %s", args.Type, strings.Join(AllTypes, ", "))
+	}
+
+	var visible bool
+	err := conn.DB.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM securities WHERE $2 = 'security' AND securityid = $3 AND maxDate IS NULL
+			UNION ALL
+			SELECT 1 FROM (`+ownedEntities+`) o WHERE o.type = $2 AND o.id = $3
+		)`, userID, args.Type, args.ID).Scan(&visible)
+	if err != nil {
+		return nil, fmt.Errorf("error checking search selection: %v", err)
+	}
+	if !visible {
+		return nil, apperr.NotFound("%s %d not found", args.Type, args.ID)
+	}
+
+	if _, err := conn.DB.Exec(ctx, `
+		INSERT INTO search_history (user_id, entity_type, entity_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, entity_type, entity_id)
+		DO UPDATE SET uses = search_history.uses + 1, last_used_at = NOW()`,
+		userID, args.Type, args.ID); err != nil {
+		return nil, fmt.Errorf("error recording search selection: %v", err)
+	}
+	if _, err := conn.DB.Exec(ctx, `
+		DELETE FROM search_history h
+		WHERE h.user_id = $1 AND (h.entity_type, h.entity_id) IN (
+			SELECT entity_type, entity_id FROM search_history
+			WHERE user_id = $1
+			ORDER BY last_used_at DESC
+			OFFSET $2
+		)`, userID, maxHistoryPerUser); err != nil {
+		return nil, fmt.Errorf("error trimming search history: %v", err)
+	}
+	return map[string]bool{"recorded": true}, nil
+}
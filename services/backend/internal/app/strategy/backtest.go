@@ -2,6 +2,9 @@ package strategy
 
 import (
 	"backend/internal/app/limits"
+	"backend/internal/app/screener"
+	"backend/internal/app/workspaces"
+	"backend/internal/apperr"
 	"backend/internal/data"
 	"backend/internal/queue"
 	"context"
@@ -18,6 +21,13 @@ type RunBacktestArgs struct {
 	EndDate     string `json:"endDate"`
 	Version     int    `json:"version"`
 	FullResults bool   `json:"fullResults"`
+	// UniverseFilters restricts the backtest to the tickers a screen returned
+	// on UniverseAsOf (defaults to StartDate), using historical snapshots.
+	UniverseFilters []screener.Filter `json:"universeFilters,omitempty"`
+	UniverseAsOf    string            `json:"universeAsOf,omitempty"`
+	// ConfirmCost runs a backtest whose estimated cost needs confirming
+	// (see cost.go)
+	ConfirmCost bool `json:"confirmCost,omitempty"`
 }
 
 // BacktestInstanceRow represents a single backtest instance (API compatibility)
@@ -75,15 +85,15 @@ type ResponseImage struct {
 
 // WorkerBacktestResult represents the result from the worker's run_backtest function
 type WorkerBacktestResult struct {
-	Success        bool               `json:"success"`
-	StrategyID     int                `json:"strategy_id"`
-	Version        int                `json:"version"`
-	Instances      []map[string]any   `json:"instances"`
-	Summary        WorkerSummary      `json:"summary"`
-	StrategyPrints string             `json:"strategy_prints,omitempty"`
-	StrategyPlots  []PlotData         `json:"strategy_plots,omitempty"`
-	ResponseImages []string           `json:"response_images,omitempty"`
-	ErrorMessage   string             `json:"error_message,omitempty"`
+	Success        bool             `json:"success"`
+	StrategyID     int              `json:"strategy_id"`
+	Version        int              `json:"version"`
+	Instances      []map[string]any `json:"instances"`
+	Summary        WorkerSummary    `json:"summary"`
+	StrategyPrints string           `json:"strategy_prints,omitempty"`
+	StrategyPlots  []PlotData       `json:"strategy_plots,omitempty"`
+	ResponseImages []string         `json:"response_images,omitempty"`
+	ErrorMessage   string           `json:"error_message,omitempty"`
 }
 
 // WorkerSummary represents worker summary statistics
@@ -118,7 +128,7 @@ func (d *DateRangeField) UnmarshalJSON(data []byte) error {
 		return nil
 	}
 
-	return fmt.Errorf("date_range must be either string or []string")
+	return apperr.Validation("date_range must be either string or []string")
 }
 
 // RunBacktest executes a complete strategy backtest using the new worker architecture
@@ -130,25 +140,44 @@ func RunBacktest(ctx context.Context, conn *data.Conn, userID int, rawArgs json.
 func RunBacktestWithProgress(ctx context.Context, conn *data.Conn, userID int, rawArgs json.RawMessage, progressCallback ProgressCallback) (any, error) {
 	var args RunBacktestArgs
 	if err := json.Unmarshal(rawArgs, &args); err != nil {
-		return nil, fmt.Errorf("invalid args: %v", err)
+		return nil, apperr.InvalidArgs(err)
 	}
 
 	log.Printf("Starting complete backtest for strategy %d using new worker architecture", args.StrategyID)
 
-	// Verify strategy exists and user has permission
-	var strategyExists bool
-	err := conn.DB.QueryRow(context.Background(), `
-		SELECT EXISTS(SELECT 1 FROM strategies WHERE strategyid = $1 AND userid = $2)`,
-		args.StrategyID, userID).Scan(&strategyExists)
+	// Verify the user can run the strategy; the worker loads it as its owner
+	ownerID, err := workspaces.Authorize(ctx, conn, userID, workspaces.TypeStrategy, args.StrategyID, workspaces.RoleViewer)
 	if err != nil {
-		return nil, fmt.Errorf("error checking strategy: %v", err)
+		return nil, err
 	}
-	if !strategyExists {
-		return nil, fmt.Errorf("strategy not found or access denied")
+
+	// Resolve a point-in-time universe from screener snapshots if requested
+	var symbols []string
+	if len(args.UniverseFilters) > 0 {
+		asOf := args.UniverseAsOf
+		if asOf == "" {
+			asOf = args.StartDate
+		}
+		symbols, err = screener.ResolveUniverse(conn, userID, args.UniverseFilters, 0, asOf)
+		if err != nil {
+			return nil, fmt.Errorf("resolving backtest universe: %w", err)
+		}
+		if len(symbols) == 0 {
+			return nil, apperr.Validation("universe filters matched no securities as of %s", asOf)
+		}
+	}
+
+	// Estimate the backtest before it takes up a worker
+	est, err := estimateBacktestCost(ctx, conn, userID, args.StrategyID, len(symbols), args.StartDate, args.EndDate)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCost(est, args.ConfirmCost); err != nil {
+		return nil, err
 	}
 
 	// Call the worker's run_backtest function
-	result, err := callWorkerBacktestWithProgress(ctx, conn, userID, args, progressCallback)
+	result, err := callWorkerBacktestWithProgress(ctx, conn, ownerID, args, symbols, progressCallback)
 	if err != nil {
 		return nil, fmt.Errorf("error executing worker backtest: %v", err)
 	}
@@ -225,7 +254,7 @@ func RunBacktestWithProgress(ctx context.Context, conn *data.Conn, userID int, r
 }
 
 // callWorkerBacktestWithProgress calls the worker's run_backtest function via the new queue system with progress callbacks
-func callWorkerBacktestWithProgress(ctx context.Context, conn *data.Conn, userID int, args RunBacktestArgs, progressCallback ProgressCallback) (*WorkerBacktestResult, error) {
+func callWorkerBacktestWithProgress(ctx context.Context, conn *data.Conn, userID int, args RunBacktestArgs, symbols []string, progressCallback ProgressCallback) (*WorkerBacktestResult, error) {
 	// Prepare backtest task arguments
 	taskArgs := map[string]interface{}{
 		"strategy_id": args.StrategyID, // Send as int, not string
@@ -234,6 +263,9 @@ func callWorkerBacktestWithProgress(ctx context.Context, conn *data.Conn, userID
 		"start_date":  args.StartDate,
 		"end_date":    args.EndDate,
 	}
+	if len(symbols) > 0 {
+		taskArgs["symbols"] = symbols
+	}
 
 	// Queue the task using the new queue system
 	handle, err := queue.Backtest(ctx, conn, taskArgs)
@@ -284,7 +316,7 @@ func callWorkerBacktestWithProgress(ctx context.Context, conn *data.Conn, userID
 	for {
 		select {
 		case <-timeoutCtx.Done():
-			return nil, fmt.Errorf("timeout waiting for backtest result")
+			return nil, apperr.UpstreamTimeout("timeout waiting for backtest result")
 		case msg := <-ch:
 			if msg == nil {
 				continue
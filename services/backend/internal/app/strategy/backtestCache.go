@@ -32,11 +32,16 @@ func GetBacktestFromCache(ctx context.Context, conn *data.Conn, userID int, stra
 	cacheData, err := conn.Cache.Get(ctx, cacheKey).Result()
 	if err != nil {
 		if err == redis.Nil {
-			// Cache miss - run backtest and cache result
-			rawArgs := json.RawMessage(fmt.Sprintf(`{"strategyId": %d, "version": %d}`, strategyID, version))
+			// Cache miss - run backtest and cache result. The result was asked
+			// for already (a chat message or share link refers to it), so only
+			// the plan's limit applies, not the confirm step.
+			rawArgs, err := json.Marshal(RunBacktestArgs{StrategyID: strategyID, Version: version, ConfirmCost: true})
+			if err != nil {
+				return nil, err
+			}
 			backtestResponse, err := RunBacktest(ctx, conn, userID, rawArgs)
 			if err != nil {
-				return nil, fmt.Errorf("error running backtest: %v", err)
+				return nil, fmt.Errorf("error running backtest: %w", err)
 			}
 
 			// Handle both pointer and value types conservatively.
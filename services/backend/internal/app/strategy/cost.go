@@ -0,0 +1,382 @@
+package strategy
+
+import (
+	"backend/internal/app/limits"
+	"backend/internal/app/screener"
+	"backend/internal/app/workspaces"
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Backtests and strategy alerts are estimated before they go to the workers,
+// so a 5000 symbol, 20 year backtest on minute bars can't clog the queue by
+// accident. The estimate is symbols × bars × the complexity of the strategy's
+// code, in bar evaluations, turned into worker time at a rough throughput. A
+// backtest is measured per run and an alert per trading day of evaluations,
+// against the thresholds of the plan it runs under: past the confirm
+// threshold the request has to be repeated with confirmCost, past the limit
+// it is refused.
+const (
+	CostKindBacktest = "backtest"
+	CostKindAlert    = "alert"
+
+	CostDecisionRun     = "run"
+	CostDecisionConfirm = "confirm"
+	CostDecisionRefuse  = "refuse"
+)
+
+const (
+	// barEvaluationsPerSecond is what one worker gets through on a strategy
+	// of complexity 1; the projections are only as good as this
+	barEvaluationsPerSecond = 2_000_000
+	tradingDaysPerYear      = 252
+	regularSessionMinutes   = 390
+	// defaultCostLookback is the alert lookback of strategies whose code
+	// doesn't ask for min_bars
+	defaultCostLookback = 100
+	maxCostComplexity   = 10
+	// defaultBacktestStart is where the worker starts a backtest without a
+	// start date
+	defaultBacktestStart = "2003-01-01"
+	// defaultCostAlertInterval is the alert service's base cadence
+	defaultCostAlertInterval = 10 * time.Second
+)
+
+// CostEstimate is the projected worker time of a backtest, or of a strategy
+// alert per trading day, and what the plan allows
+type CostEstimate struct {
+	Kind      string `json:"kind"`
+	Symbols   int    `json:"symbols"`
+	Timeframe string `json:"timeframe"`
+	// BarsPerSymbol is read per symbol in a backtest, or per symbol and
+	// evaluation of an alert
+	BarsPerSymbol     int64   `json:"barsPerSymbol"`
+	EvaluationsPerDay int     `json:"evaluationsPerDay,omitempty"` // alerts only
+	Complexity        float64 `json:"complexity"`
+	// BarEvaluations is symbols × bars × complexity, per run or per trading day
+	BarEvaluations   int64   `json:"barEvaluations"`
+	ProjectedSeconds float64 `json:"projectedSeconds"`
+	ConfirmSeconds   float64 `json:"confirmSeconds"`
+	LimitSeconds     float64 `json:"limitSeconds"`
+	// Decision is run, confirm (repeat the request with confirmCost) or refuse
+	Decision string `json:"decision"`
+}
+
+// strategyProfile is what the estimate needs to know of a strategy's code
+type strategyProfile struct {
+	timeframe  string  // finest timeframe it reads bars in
+	barsPerDay float64 // of that timeframe, in a regular session
+	lookback   int     // bars an alert evaluation reads
+	complexity float64
+}
+
+var (
+	minBarsPattern   = regexp.MustCompile(`min_bars\s*=\s*(\d+)`)
+	costTimeframeRe  = regexp.MustCompile(`^(\d+)([mhdwqy]?)$`)
+	complexityWeight = []struct {
+		pattern *regexp.Regexp
+		weight  float64
+	}{
+		{regexp.MustCompile(`get_bar_data\s*\(`), 0.5}, // beyond the first
+		{regexp.MustCompile(`get_(fundamentals|general)_data\s*\(`), 0.25},
+		{regexp.MustCompile(`\.(rolling|ewm|expanding)\s*\(`), 0.1},
+		{regexp.MustCompile(`\.groupby\s*\(`), 0.2},
+		{regexp.MustCompile(`\.(apply|iterrows|itertuples)\s*\(|\bfor\s+\w+\s+in\b`), 0.5}, // Python-speed loops
+	}
+)
+
+// loadStrategyProfile reads a strategy's code and profiles it
+func loadStrategyProfile(ctx context.Context, conn *data.Conn, strategyID int) (*strategyProfile, error) {
+	var code, minTimeframe string
+	err := conn.DB.QueryRow(ctx, `
+		SELECT COALESCE(pythoncode, ''), COALESCE(min_timeframe, '')
+		FROM strategies WHERE strategyid = $1`, strategyID).Scan(&code, &minTimeframe)
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("strategy not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading strategy %d: %v", strategyID, err)
+	}
+	return profileStrategyCode(code, minTimeframe), nil
+}
+
+func profileStrategyCode(code, minTimeframe string) *strategyProfile {
+	p := &strategyProfile{timeframe: "1d", barsPerDay: 1, lookback: defaultCostLookback, complexity: 1}
+	for _, tf := range append([]string{minTimeframe}, detectTimeframes(code)...) {
+		if bars, ok := barsPerTradingDay(tf); ok && bars > p.barsPerDay {
+			p.timeframe, p.barsPerDay = strings.ToLower(tf), bars
+		}
+	}
+	lookback := 0
+	for _, m := range minBarsPattern.FindAllStringSubmatch(code, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > lookback {
+			lookback = n
+		}
+	}
+	if lookback > 0 {
+		p.lookback = lookback
+	}
+	for i, w := range complexityWeight {
+		n := len(w.pattern.FindAllStringIndex(code, -1))
+		if i == 0 && n > 0 {
+			n--
+		}
+		p.complexity += float64(n) * w.weight
+	}
+	p.complexity = math.Min(math.Round(p.complexity*100)/100, maxCostComplexity)
+	return p
+}
+
+// barsPerTradingDay is how many bars of a timeframe a regular session has
+func barsPerTradingDay(tf string) (float64, bool) {
+	m := costTimeframeRe.FindStringSubmatch(strings.ToLower(strings.TrimSpace(tf)))
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	switch m[2] {
+	case "h":
+		return math.Max(regularSessionMinutes/float64(n*60), 1), true
+	case "d":
+		return 1 / float64(n), true
+	case "w":
+		return 1 / float64(5*n), true
+	case "q":
+		return 1 / float64(63*n), true
+	case "y":
+		return 1 / float64(tradingDaysPerYear*n), true
+	default: // minutes
+		return math.Max(regularSessionMinutes/float64(n), 1), true
+	}
+}
+
+// activeSecurityCount is the size of the universe "every security"
+func activeSecurityCount(ctx context.Context, conn *data.Conn) (int, error) {
+	var n int
+	if err := conn.DB.QueryRow(ctx, `SELECT COUNT(*) FROM securities WHERE maxdate IS NULL`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("error counting securities: %v", err)
+	}
+	return n, nil
+}
+
+// estimateBacktestCost estimates a backtest of the strategy over the dates,
+// on symbols or, with none, every security
+func estimateBacktestCost(ctx context.Context, conn *data.Conn, userID, strategyID int, symbols int, startDate, endDate string) (*CostEstimate, error) {
+	if startDate == "" {
+		startDate = defaultBacktestStart
+	}
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil {
+		return nil, apperr.Validation("invalid startDate %q", startDate)
+	}
+	end := time.Now()
+	if endDate != "" {
+		if end, err = time.Parse("2006-01-02", endDate); err != nil {
+			return nil, apperr.Validation("invalid endDate %q", endDate)
+		}
+	}
+	p, err := loadStrategyProfile(ctx, conn, strategyID)
+	if err != nil {
+		return nil, err
+	}
+	if symbols == 0 {
+		if symbols, err = activeSecurityCount(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+
+	tradingDays := math.Max(end.Sub(start).Hours()/24*tradingDaysPerYear/365, 1)
+	bars := int64(math.Ceil(tradingDays*p.barsPerDay)) + int64(p.lookback)
+	est := &CostEstimate{
+		Kind:           CostKindBacktest,
+		Symbols:        symbols,
+		Timeframe:      p.timeframe,
+		BarsPerSymbol:  bars,
+		Complexity:     p.complexity,
+		BarEvaluations: int64(float64(symbols) * float64(bars) * p.complexity),
+	}
+	if err := judgeCost(conn, userID, est); err != nil {
+		return nil, err
+	}
+	return est, nil
+}
+
+// estimateAlertCost estimates a trading day of a strategy alert on symbols
+// or, with none, every security, evaluated every interval (0 for the
+// default). Each symbol is evaluated at most once per bar.
+func estimateAlertCost(ctx context.Context, conn *data.Conn, ownerID, strategyID int, symbols int, interval time.Duration) (*CostEstimate, error) {
+	p, err := loadStrategyProfile(ctx, conn, strategyID)
+	if err != nil {
+		return nil, err
+	}
+	if symbols == 0 {
+		if symbols, err = activeSecurityCount(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+	if interval <= 0 {
+		interval = defaultCostAlertInterval
+	}
+	if planMin, err := limits.GetMinStrategyAlertInterval(conn, ownerID); err == nil && planMin > interval {
+		interval = planMin
+	}
+
+	evaluations := math.Min(regularSessionMinutes*60/interval.Seconds(), math.Max(p.barsPerDay, 1))
+	est := &CostEstimate{
+		Kind:              CostKindAlert,
+		Symbols:           symbols,
+		Timeframe:         p.timeframe,
+		BarsPerSymbol:     int64(p.lookback),
+		EvaluationsPerDay: int(math.Ceil(evaluations)),
+		Complexity:        p.complexity,
+	}
+	est.BarEvaluations = int64(float64(symbols) * float64(p.lookback) * float64(est.EvaluationsPerDay) * p.complexity)
+	if err := judgeCost(conn, ownerID, est); err != nil {
+		return nil, err
+	}
+	return est, nil
+}
+
+// judgeCost projects the estimate's worker time and decides on it by the
+// user's plan
+func judgeCost(conn *data.Conn, userID int, est *CostEstimate) error {
+	thresholds, err := limits.GetTaskCostThresholds(conn, userID)
+	if err != nil {
+		return err
+	}
+	est.ProjectedSeconds = math.Round(float64(est.BarEvaluations)/barEvaluationsPerSecond*10) / 10
+	est.ConfirmSeconds = thresholds.Confirm.Seconds()
+	est.LimitSeconds = thresholds.Limit.Seconds()
+	switch {
+	case est.ProjectedSeconds > est.LimitSeconds:
+		est.Decision = CostDecisionRefuse
+	case est.ProjectedSeconds > est.ConfirmSeconds:
+		est.Decision = CostDecisionConfirm
+	default:
+		est.Decision = CostDecisionRun
+	}
+	return nil
+}
+
+// checkCost refuses an estimate past the plan's limit, and one past its
+// confirm threshold unless the user confirmed it
+func checkCost(est *CostEstimate, confirmed bool) error {
+	what := "This backtest"
+	per := ""
+	if est.Kind == CostKindAlert {
+		what, per = "This alert", " per trading day"
+	}
+	projected := formatCostDuration(est.ProjectedSeconds)
+	switch est.Decision {
+	case CostDecisionRefuse:
+		return apperr.LimitExceeded("%s would take about %s of worker time%s (%d symbols × %d %s bars), more than your plan's %s. Narrow the universe, dates or timeframe.",
+			what, projected, per, est.Symbols, est.BarsPerSymbol, est.Timeframe, formatCostDuration(est.LimitSeconds))
+	case CostDecisionConfirm:
+		if !confirmed {
+			return apperr.ConfirmRequired("%s would take about %s of worker time%s (%d symbols × %d %s bars). Run it anyway?",
+				what, projected, per, est.Symbols, est.BarsPerSymbol, est.Timeframe)
+		}
+	}
+	return nil
+}
+
+func formatCostDuration(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second))
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%.1f hours", d.Hours())
+	case d >= time.Minute:
+		return fmt.Sprintf("%.0f minutes", d.Minutes())
+	}
+	return fmt.Sprintf("%.0f seconds", d.Seconds())
+}
+
+// EstimateStrategyCostArgs describes the backtest or alert to estimate, the
+// same way run_backtest and setAlert take it
+type EstimateStrategyCostArgs struct {
+	StrategyID      int               `json:"strategyId"`
+	Kind            string            `json:"kind,omitempty"` // backtest (default) or alert
+	StartDate       string            `json:"startDate,omitempty"`
+	EndDate         string            `json:"endDate,omitempty"`
+	Universe        []string          `json:"universe,omitempty"`
+	UniverseFilters []screener.Filter `json:"universeFilters,omitempty"`
+	UniverseAsOf    string            `json:"universeAsOf,omitempty"`
+	IntervalSeconds int               `json:"intervalSeconds,omitempty"`
+}
+
+// EstimateStrategyCost returns the projected worker time of a backtest or
+// strategy alert and whether the user's plan runs it, asks to confirm it or
+// refuses it, without queuing anything
+func EstimateStrategyCost(ctx context.Context, conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args EstimateStrategyCostArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.Kind == "" {
+		args.Kind = CostKindBacktest
+	}
+	if args.Kind != CostKindBacktest && args.Kind != CostKindAlert {
+		return nil, apperr.Validation("kind must be backtest or alert")
+	}
+	role := workspaces.RoleViewer
+	if args.Kind == CostKindAlert {
+		role = workspaces.RoleEditor
+	}
+	ownerID, err := workspaces.Authorize(ctx, conn, userID, workspaces.TypeStrategy, args.StrategyID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := len(args.Universe)
+	if len(args.UniverseFilters) > 0 {
+		asOf := args.UniverseAsOf
+		if args.Kind == CostKindBacktest && asOf == "" {
+			asOf = args.StartDate
+		}
+		tickers, err := screener.ResolveUniverse(conn, userID, args.UniverseFilters, 0, asOf)
+		if err != nil {
+			return nil, fmt.Errorf("resolving universe filters: %w", err)
+		}
+		if len(tickers) == 0 {
+			return nil, apperr.Validation("universe filters matched no securities")
+		}
+		symbols = len(tickers)
+	}
+	var est *CostEstimate
+	if args.Kind == CostKindAlert {
+		est, err = estimateAlertCost(ctx, conn, ownerID, args.StrategyID, symbols, time.Duration(args.IntervalSeconds)*time.Second)
+	} else {
+		est, err = estimateBacktestCost(ctx, conn, userID, args.StrategyID, symbols, args.StartDate, args.EndDate)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return est, nil
+}
+
+// effectiveAlertInterval is the interval a strategy alert will be evaluated
+// at: the requested one, else the one stored (0 for the default)
+func effectiveAlertInterval(ctx context.Context, conn *data.Conn, strategyID int, requestedSeconds *int) (time.Duration, error) {
+	if requestedSeconds != nil {
+		return time.Duration(*requestedSeconds) * time.Second, nil
+	}
+	var seconds int
+	err := conn.DB.QueryRow(ctx, `
+		SELECT COALESCE(alert_interval_seconds, 0) FROM strategies WHERE strategyid = $1`, strategyID).Scan(&seconds)
+	if err != nil {
+		return 0, fmt.Errorf("error loading alert interval of strategy %d: %v", strategyID, err)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
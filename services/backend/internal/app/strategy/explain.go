@@ -0,0 +1,605 @@
+package strategy
+
+import (
+	"backend/internal/app/workspaces"
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// A strategy is its Python code, so it is explained by reading the code the
+// way the templates and the generator write it: scalar parameters
+// (`level = 30`), derived columns (`df['x'] = ...`) and the boolean mask that
+// selects the matches (`hits = df[(...) & (...)]`). The explanation is built
+// from fixed phrases without calling a model, so the same code always reads
+// the same, cheaply enough for confirmation dialogs and alert notifications.
+// What the parser doesn't recognize is shown as the expression itself.
+
+// StrategyExplanation is a plain-English description of a strategy
+type StrategyExplanation struct {
+	StrategyID int    `json:"strategyId"`
+	Name       string `json:"name"`
+	// Summary is one sentence; Rule is just the entry conditions, as shown
+	// under alert notifications
+	Summary   string   `json:"summary"`
+	Rule      string   `json:"rule"`
+	Entry     []string `json:"entry"`
+	Exit      []string `json:"exit"`
+	Universe  string   `json:"universe"`
+	Timeframe string   `json:"timeframe"`
+	Alert     string   `json:"alert"`
+	// Text is the whole explanation, one line per part
+	Text string `json:"text"`
+}
+
+// ExplainStrategyArgs names the strategy to explain
+type ExplainStrategyArgs struct {
+	StrategyID int `json:"strategyId"`
+}
+
+// maxExplainedTickers is how many tickers of a universe are named before the
+// rest are counted
+const maxExplainedTickers = 10
+
+var (
+	scalarAssignPattern = regexp.MustCompile(`(?m)^\s*([A-Za-z_]\w*)\s*=\s*(-?\d+(?:\.\d+)?)\s*(?:#.*)?$`)
+	columnAssignPattern = regexp.MustCompile(`(?m)^\s*df\[['"](\w+)['"]\]\s*=\s*(.+?)\s*$`)
+	maskAssignPattern   = regexp.MustCompile(`(?m)^\s*(\w+)\s*=\s*df\[(.+)\]\s*$`)
+	dfColumnPattern     = regexp.MustCompile(`^df\[['"](\w+)['"]\]$`)
+	dfColumnRefPattern  = regexp.MustCompile(`df\[['"](\w+)['"]\]`)
+	numberPattern       = regexp.MustCompile(`^-?\d+(?:\.\d+)?$`)
+	rollingPattern      = regexp.MustCompile(`\[['"](\w+)['"]\]\.transform\(lambda (\w+): \w+(\.shift\(1\))?\.rolling\((\w+)\)\.(mean|max|min|sum|std)\(\)\)$`)
+	shiftPattern        = regexp.MustCompile(`\[['"](\w+)['"]\]\.shift\((\d+)\)$`)
+	pctChangePattern    = regexp.MustCompile(`^\(df\[['"](\w+)['"]\] / df\[['"](\w+)['"]\] - 1\) \* 100$`)
+	ratioPattern        = regexp.MustCompile(`^df\[['"](\w+)['"]\] / df\[['"](\w+)['"]\]$`)
+	universeTickers     = regexp.MustCompile(`['"]tickers['"]\s*:\s*\[([^\]]*)\]`)
+	universeField       = regexp.MustCompile(`['"](sector|industry)['"]\s*:\s*['"]([^'"]+)['"]`)
+	quotedPattern       = regexp.MustCompile(`['"]([^'"]+)['"]`)
+	identifierPattern   = regexp.MustCompile(`\b[A-Za-z_]\w*\b`)
+	exitReasonPattern   = regexp.MustCompile(`['"]?exit_reason['"]?\s*[:=]\s*['"](\w+)['"]`)
+	exitParamPattern    = regexp.MustCompile(`(?i)(stop|target|profit|hold|trail)`)
+)
+
+var comparisonPhrases = map[string]string{
+	">":  "is above",
+	">=": "is at least",
+	"<":  "is below",
+	"<=": "is at most",
+	"==": "equals",
+	"!=": "is not",
+}
+
+var rollingPhrases = map[string]string{
+	"mean": "the average %s of the %s %s bars",
+	"max":  "the highest %s of the %s %s bars",
+	"min":  "the lowest %s of the %s %s bars",
+	"sum":  "the total %s of the %s %s bars",
+	"std":  "the standard deviation of %s over the %s %s bars",
+}
+
+var columnNouns = map[string]string{
+	"open":   "open",
+	"high":   "high",
+	"low":    "low",
+	"close":  "close",
+	"volume": "volume",
+	"vwap":   "VWAP",
+}
+
+var acronyms = map[string]bool{"rsi": true, "sma": true, "ema": true, "macd": true, "atr": true, "vwap": true, "adx": true}
+
+// codeExplainer holds what was read from a strategy's code
+type codeExplainer struct {
+	scalars map[string]string
+	columns map[string]string // first definition of each derived column
+}
+
+type comparison struct {
+	lhs, op, rhs string
+	raw          string
+}
+
+// ExplainStrategy describes what a strategy trades, on which bars and over
+// which universe, and how its alert is set up
+func ExplainStrategy(ctx context.Context, conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args ExplainStrategyArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if _, err := workspaces.Authorize(ctx, conn, userID, workspaces.TypeStrategy, args.StrategyID, workspaces.RoleViewer); err != nil {
+		return nil, err
+	}
+	return loadStrategyExplanation(ctx, conn, args.StrategyID)
+}
+
+// ExplainStrategyRule is the entry rule of a strategy in one sentence, for
+// the footer of its alert notifications
+func ExplainStrategyRule(ctx context.Context, conn *data.Conn, strategyID int) (string, error) {
+	e, err := loadStrategyExplanation(ctx, conn, strategyID)
+	if err != nil {
+		return "", err
+	}
+	return e.Rule, nil
+}
+
+func loadStrategyExplanation(ctx context.Context, conn *data.Conn, strategyID int) (*StrategyExplanation, error) {
+	var name, description, code, minTimeframe string
+	var alertActive bool
+	var threshold *float64
+	var alertUniverse []string
+	var intervalSeconds *int
+	var screened bool
+	err := conn.DB.QueryRow(ctx, `
+		SELECT name, COALESCE(description, ''), COALESCE(pythoncode, ''), COALESCE(min_timeframe, ''),
+		       COALESCE(alertactive, false), alert_threshold, alert_universe, alert_interval_seconds,
+		       alert_universe_filters IS NOT NULL
+		FROM strategies WHERE strategyid = $1`, strategyID).
+		Scan(&name, &description, &code, &minTimeframe, &alertActive, &threshold, &alertUniverse, &intervalSeconds, &screened)
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("strategy not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading strategy %d: %v", strategyID, err)
+	}
+
+	e := explainStrategyCode(name, description, code, minTimeframe)
+	e.StrategyID = strategyID
+	e.Alert = explainAlert(alertActive, threshold, alertUniverse, screened, intervalSeconds)
+	e.Text = e.Text + "\nAlert: " + e.Alert
+	return e, nil
+}
+
+// explainStrategyCode explains everything but the alert, from the code alone
+func explainStrategyCode(name, description, code, minTimeframe string) *StrategyExplanation {
+	x := newCodeExplainer(code)
+	e := &StrategyExplanation{
+		Name:      name,
+		Entry:     x.entryConditions(code),
+		Exit:      x.exitRules(code),
+		Universe:  explainUniverse(code),
+		Timeframe: explainTimeframe(code, minTimeframe),
+	}
+
+	if len(e.Entry) > 0 {
+		conditions := make([]string, len(e.Entry))
+		for i, c := range e.Entry {
+			conditions[i] = lowerFirst(c)
+		}
+		e.Rule = "Matches when " + joinPhrases(conditions, "and") + "."
+	} else if description != "" {
+		e.Rule = strings.TrimSpace(description)
+		e.Entry = []string{"The conditions are computed in a way that can't be summarized: " + e.Rule}
+	} else {
+		e.Rule = "The conditions are computed in a way that can't be summarized."
+		e.Entry = []string{e.Rule}
+	}
+	e.Summary = fmt.Sprintf("%s scans %s on %s. %s", name, e.Universe, e.Timeframe, e.Rule)
+
+	var b strings.Builder
+	b.WriteString(e.Summary)
+	b.WriteString("\nEntry: " + strings.Join(e.Entry, "; "))
+	b.WriteString("\nExit: " + strings.Join(e.Exit, "; "))
+	b.WriteString("\nUniverse: " + e.Universe)
+	b.WriteString("\nTimeframe: " + e.Timeframe)
+	e.Text = b.String()
+	return e
+}
+
+func newCodeExplainer(code string) *codeExplainer {
+	x := &codeExplainer{scalars: map[string]string{}, columns: map[string]string{}}
+	for _, m := range scalarAssignPattern.FindAllStringSubmatch(code, -1) {
+		if _, ok := x.scalars[m[1]]; !ok {
+			x.scalars[m[1]] = m[2]
+		}
+	}
+	for _, m := range columnAssignPattern.FindAllStringSubmatch(code, -1) {
+		if _, ok := x.columns[m[1]]; !ok {
+			x.columns[m[1]] = m[2]
+		}
+	}
+	return x
+}
+
+// entryConditions reads the mask that selects the matches: the last one
+// assigned to something other than df, as df = df[...] only drops bad rows
+func (x *codeExplainer) entryConditions(code string) []string {
+	var mask string
+	for _, m := range maskAssignPattern.FindAllStringSubmatch(code, -1) {
+		if m[1] != "df" && strings.ContainsAny(m[2], "<>=&|") {
+			mask = m[2]
+		}
+	}
+	if mask == "" {
+		return nil
+	}
+	parts, joins := splitMask(mask)
+	comparisons := make([]*comparison, len(parts))
+	for i, p := range parts {
+		comparisons[i] = parseComparison(p)
+	}
+
+	var conditions []string
+	used := make([]bool, len(parts))
+	for i := range comparisons {
+		if used[i] {
+			continue
+		}
+		phrase := ""
+		for j := range comparisons {
+			if j == i || used[j] {
+				continue
+			}
+			if cross := x.crossing(comparisons[i], comparisons[j]); cross != "" {
+				phrase, used[j] = cross, true
+				break
+			}
+		}
+		if phrase == "" {
+			phrase = x.comparisonPhrase(comparisons[i], parts[i])
+		}
+		used[i] = true
+		if i > 0 && joins[i-1] == "|" && len(conditions) > 0 {
+			conditions[len(conditions)-1] += ", or " + lowerFirst(phrase)
+			continue
+		}
+		conditions = append(conditions, phrase)
+	}
+	return conditions
+}
+
+// splitMask splits a mask at its top-level & and |, returning the operands
+// and the operator after each but the last
+func splitMask(mask string) ([]string, []string) {
+	mask = stripParens(strings.TrimSpace(mask))
+	var parts, joins []string
+	depth, start := 0, 0
+	for i, r := range mask {
+		switch r {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case '&', '|':
+			if depth == 0 {
+				parts = append(parts, stripParens(strings.TrimSpace(mask[start:i])))
+				joins = append(joins, string(r))
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, stripParens(strings.TrimSpace(mask[start:]))), joins
+}
+
+// stripParens removes parentheses enclosing the whole expression
+func stripParens(s string) string {
+	for len(s) >= 2 && s[0] == '(' && s[len(s)-1] == ')' {
+		depth := 0
+		enclosing := true
+		for i, r := range s {
+			if r == '(' {
+				depth++
+			} else if r == ')' {
+				depth--
+			}
+			if depth == 0 && i < len(s)-1 {
+				enclosing = false
+				break
+			}
+		}
+		if !enclosing {
+			break
+		}
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	return s
+}
+
+func parseComparison(expr string) *comparison {
+	depth := 0
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case '>', '<', '=', '!':
+			if depth != 0 {
+				continue
+			}
+			op := string(expr[i])
+			if i+1 < len(expr) && expr[i+1] == '=' {
+				op += "="
+			}
+			if _, ok := comparisonPhrases[op]; !ok {
+				continue
+			}
+			return &comparison{
+				lhs: strings.TrimSpace(expr[:i]),
+				op:  op,
+				rhs: strings.TrimSpace(expr[i+len(op):]),
+				raw: expr,
+			}
+		}
+	}
+	return nil
+}
+
+// crossing merges a comparison on the previous bar with the opposite one on
+// the current bar: prev_fast <= prev_slow & fast > slow is fast crossing
+// above slow
+func (x *codeExplainer) crossing(prev, cur *comparison) string {
+	if prev == nil || cur == nil || !x.isPrevious(prev.lhs, cur.lhs) {
+		return ""
+	}
+	if prev.rhs != cur.rhs && !x.isPrevious(prev.rhs, cur.rhs) {
+		return ""
+	}
+	direction := ""
+	switch {
+	case strings.HasPrefix(prev.op, "<") && strings.HasPrefix(cur.op, ">"):
+		direction = "above"
+	case strings.HasPrefix(prev.op, ">") && strings.HasPrefix(cur.op, "<"):
+		direction = "below"
+	default:
+		return ""
+	}
+	return upperFirst(fmt.Sprintf("%s crosses %s %s", x.operandPhrase(cur.lhs, 0), direction, x.operandPhrase(cur.rhs, 0)))
+}
+
+// isPrevious reports whether operand prev is operand cur shifted one bar back
+func (x *codeExplainer) isPrevious(prev, cur string) bool {
+	p, c := dfColumnPattern.FindStringSubmatch(prev), dfColumnPattern.FindStringSubmatch(cur)
+	if p == nil || c == nil {
+		return false
+	}
+	m := shiftPattern.FindStringSubmatch(x.columns[p[1]])
+	return m != nil && m[1] == c[1] && m[2] == "1"
+}
+
+func (x *codeExplainer) comparisonPhrase(c *comparison, raw string) string {
+	if c == nil {
+		return "Condition: " + x.cleanExpression(raw)
+	}
+	return upperFirst(fmt.Sprintf("%s %s %s", x.operandPhrase(c.lhs, 0), comparisonPhrases[c.op], x.operandPhrase(c.rhs, 0)))
+}
+
+func (x *codeExplainer) operandPhrase(operand string, depth int) string {
+	operand = stripParens(operand)
+	if m := dfColumnPattern.FindStringSubmatch(operand); m != nil {
+		return x.columnPhrase(m[1], depth)
+	}
+	if numberPattern.MatchString(operand) {
+		return formatExplainNumber(operand)
+	}
+	if strings.HasPrefix(operand, "-") {
+		if v, ok := x.scalars[strings.TrimSpace(operand[1:])]; ok {
+			return formatExplainNumber("-" + strings.TrimPrefix(v, "-"))
+		}
+	}
+	if v, ok := x.scalars[operand]; ok {
+		return formatExplainNumber(v)
+	}
+	return x.cleanExpression(operand)
+}
+
+// columnPhrase describes a column by its definition when it has a known
+// shape, else by its name
+func (x *codeExplainer) columnPhrase(name string, depth int) string {
+	if noun, ok := columnNouns[name]; ok {
+		return "the " + noun
+	}
+	def, ok := x.columns[name]
+	if !ok || depth > 3 {
+		return "the " + humanizeColumn(name)
+	}
+	if m := rollingPattern.FindStringSubmatch(def); m != nil {
+		window := m[4]
+		if v, ok := x.scalars[window]; ok {
+			window = formatExplainNumber(v)
+		}
+		which := "last"
+		if m[3] != "" {
+			which = "prior"
+		}
+		base := strings.TrimPrefix(x.columnPhrase(m[1], depth+1), "the ")
+		return fmt.Sprintf(rollingPhrases[m[5]], base, which, window)
+	}
+	if m := shiftPattern.FindStringSubmatch(def); m != nil {
+		base := strings.TrimPrefix(x.columnPhrase(m[1], depth+1), "the ")
+		if m[2] == "1" {
+			return "the previous bar's " + base
+		}
+		return fmt.Sprintf("the %s %s bars earlier", base, m[2])
+	}
+	if m := pctChangePattern.FindStringSubmatch(def); m != nil {
+		return fmt.Sprintf("the %% change from %s to %s", x.columnPhrase(m[2], depth+1), x.columnPhrase(m[1], depth+1))
+	}
+	if m := ratioPattern.FindStringSubmatch(def); m != nil {
+		return fmt.Sprintf("%s relative to %s", x.columnPhrase(m[1], depth+1), x.columnPhrase(m[2], depth+1))
+	}
+	return "the " + humanizeColumn(name)
+}
+
+// cleanExpression is the fallback: the expression with df['x'] read as x
+// and known parameters filled in
+func (x *codeExplainer) cleanExpression(expr string) string {
+	expr = dfColumnRefPattern.ReplaceAllString(expr, "$1")
+	return identifierPattern.ReplaceAllStringFunc(expr, func(word string) string {
+		if v, ok := x.scalars[word]; ok {
+			return formatExplainNumber(v)
+		}
+		return word
+	})
+}
+
+// exitRules lists the exit reasons the code records and its exit
+// parameters; most strategies have neither, as a match is an entry signal
+func (x *codeExplainer) exitRules(code string) []string {
+	var rules []string
+	seen := map[string]bool{}
+	for _, m := range exitReasonPattern.FindAllStringSubmatch(code, -1) {
+		if reason := humanizeColumn(m[1]); !seen[reason] {
+			seen[reason] = true
+			rules = append(rules, upperFirst(reason))
+		}
+	}
+	var params []string
+	for name, value := range x.scalars {
+		if exitParamPattern.MatchString(name) {
+			params = append(params, humanizeColumn(name)+" "+formatExplainNumber(value))
+		}
+	}
+	if len(params) > 0 {
+		sort.Strings(params)
+		rules = append(rules, "Parameters: "+strings.Join(params, ", "))
+	}
+	if len(rules) == 0 {
+		return []string{"No exit rule: each match is an entry signal, and backtests measure the returns after it"}
+	}
+	return rules
+}
+
+func explainUniverse(code string) string {
+	if m := universeTickers.FindStringSubmatch(code); m != nil {
+		var tickers []string
+		for _, q := range quotedPattern.FindAllStringSubmatch(m[1], -1) {
+			tickers = append(tickers, q[1])
+		}
+		if len(tickers) > 0 {
+			return describeTickers(tickers)
+		}
+	}
+	var fields []string
+	for _, m := range universeField.FindAllStringSubmatch(code, -1) {
+		fields = append(fields, fmt.Sprintf("the %s %s", m[2], m[1]))
+	}
+	if len(fields) > 0 {
+		return "tickers in " + joinPhrases(fields, "or")
+	}
+	return "all tickers"
+}
+
+func describeTickers(tickers []string) string {
+	if len(tickers) <= maxExplainedTickers {
+		return joinPhrases(tickers, "and")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(tickers[:maxExplainedTickers], ", "), len(tickers)-maxExplainedTickers)
+}
+
+func explainTimeframe(code, minTimeframe string) string {
+	timeframes := detectTimeframes(code)
+	if len(timeframes) == 0 && minTimeframe != "" {
+		timeframes = []string{strings.ToLower(minTimeframe)}
+	}
+	if len(timeframes) == 0 {
+		timeframes = []string{"1d"}
+	}
+	phrases := make([]string, len(timeframes))
+	for i, tf := range timeframes {
+		phrases[i] = timeframePhrase(tf)
+	}
+	phrase := joinPhrases(phrases, "and")
+	lookback := 0
+	for _, m := range minBarsPattern.FindAllStringSubmatch(code, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > lookback {
+			lookback = n
+		}
+	}
+	if lookback > 1 {
+		phrase += fmt.Sprintf(", reading %d bars of history", lookback)
+	}
+	return phrase
+}
+
+func timeframePhrase(tf string) string {
+	m := costTimeframeRe.FindStringSubmatch(strings.ToLower(tf))
+	if m == nil {
+		return tf + " bars"
+	}
+	units := map[string]string{"": "minute", "m": "minute", "h": "hour", "d": "day", "w": "week", "q": "quarter", "y": "year"}
+	named := map[string]string{"h": "hourly", "d": "daily", "w": "weekly", "q": "quarterly", "y": "yearly"}
+	if m[1] == "1" && named[m[2]] != "" {
+		return named[m[2]] + " bars"
+	}
+	return fmt.Sprintf("%s-%s bars", m[1], units[m[2]])
+}
+
+func explainAlert(active bool, threshold *float64, universe []string, screened bool, intervalSeconds *int) string {
+	if !active {
+		return "off"
+	}
+	interval := defaultCostAlertInterval
+	if intervalSeconds != nil && *intervalSeconds > 0 {
+		interval = time.Duration(*intervalSeconds) * time.Second
+	}
+	phrase := "on, checked every " + formatCostDuration(interval.Seconds())
+	if len(universe) > 0 {
+		phrase += " over " + describeTickers(universe)
+	} else if screened {
+		phrase += " over what its universe screen matches at the time"
+	}
+	if threshold != nil && *threshold > 0 {
+		phrase += ", notifying matches scoring at least " + strconv.FormatFloat(*threshold, 'f', -1, 64)
+	}
+	return phrase
+}
+
+func humanizeColumn(name string) string {
+	words := strings.Fields(strings.ReplaceAll(name, "_", " "))
+	for i, w := range words {
+		switch {
+		case acronyms[strings.ToLower(w)]:
+			words[i] = strings.ToUpper(w)
+		case w == "pct":
+			words[i] = "percent"
+		case w == "prev":
+			words[i] = "previous"
+		case w == "avg":
+			words[i] = "average"
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func formatExplainNumber(s string) string {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return s
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// joinPhrases joins a, b and c with commas and the conjunction
+func joinPhrases(phrases []string, conjunction string) string {
+	switch len(phrases) {
+	case 0:
+		return ""
+	case 1:
+		return phrases[0]
+	case 2:
+		return phrases[0] + " " + conjunction + " " + phrases[1]
+	}
+	return strings.Join(phrases[:len(phrases)-1], ", ") + ", " + conjunction + " " + phrases[len(phrases)-1]
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func lowerFirst(s string) string {
+	if len(s) < 2 || strings.ToUpper(s[:2]) == s[:2] {
+		return s // keep acronyms like RSI
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
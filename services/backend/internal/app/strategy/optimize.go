@@ -0,0 +1,329 @@
+package strategy
+
+import (
+	"backend/internal/app/limits"
+	"backend/internal/app/workspaces"
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/queue"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// maxSweepInFlight bounds how many sweep backtests are queued at once so a
+	// single sweep cannot starve other users of workers
+	maxSweepInFlight      = 8
+	defaultTrainFraction  = 0.7
+	defaultSweepMetric    = "score"
+	minTestInstances      = 5
+	overfitDegradeRatio   = 0.5
+	maxRangeValuesPerAxis = 100
+)
+
+// SweepParameter describes the values to try for one strategy parameter. Either
+// Values or a Min/Max/Step range must be given.
+type SweepParameter struct {
+	Name   string        `json:"name"`
+	Values []interface{} `json:"values,omitempty"`
+	Min    *float64      `json:"min,omitempty"`
+	Max    *float64      `json:"max,omitempty"`
+	Step   *float64      `json:"step,omitempty"`
+}
+
+// RunOptimizationSweepArgs represents arguments for RunOptimizationSweep
+type RunOptimizationSweepArgs struct {
+	StrategyID int              `json:"strategyId"`
+	Version    int              `json:"version,omitempty"`
+	StartDate  string           `json:"startDate"`
+	EndDate    string           `json:"endDate"`
+	Parameters []SweepParameter `json:"parameters"`
+	// Metric is the numeric instance field ranked on (defaults to "score")
+	Metric string `json:"metric,omitempty"`
+	// TrainFraction is the share of the date range used for ranking; the rest is held out
+	TrainFraction float64 `json:"trainFraction,omitempty"`
+}
+
+// SweepMetrics summarizes the instances of one combination within a date segment
+type SweepMetrics struct {
+	Instances  int     `json:"instances"`
+	MeanMetric float64 `json:"meanMetric"`
+	HitRate    float64 `json:"hitRate"`
+}
+
+// SweepResult is one cell of the sweep grid
+type SweepResult struct {
+	Rank     int                    `json:"rank"`
+	Params   map[string]interface{} `json:"params"`
+	Train    SweepMetrics           `json:"train"`
+	Test     SweepMetrics           `json:"test"`
+	Warnings []string               `json:"warnings,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+}
+
+// SweepResponse is the ranked result grid of an optimization sweep
+type SweepResponse struct {
+	StrategyID   int           `json:"strategyId"`
+	Metric       string        `json:"metric"`
+	SplitDate    string        `json:"splitDate"`
+	Combinations int           `json:"combinations"`
+	Results      []SweepResult `json:"results"`
+	Warnings     []string      `json:"warnings,omitempty"`
+}
+
+// expandValues returns the concrete values to try for a parameter
+func (p SweepParameter) expandValues() ([]interface{}, error) {
+	if len(p.Values) > 0 {
+		return p.Values, nil
+	}
+	if p.Min == nil || p.Max == nil || p.Step == nil {
+		return nil, apperr.Validation("parameter %q needs values or min, max and step", p.Name)
+	}
+	if *p.Step <= 0 || *p.Max < *p.Min {
+		return nil, apperr.Validation("parameter %q has an invalid range", p.Name)
+	}
+	count := int(math.Floor((*p.Max-*p.Min)/(*p.Step)+1e-9)) + 1
+	if count > maxRangeValuesPerAxis {
+		return nil, apperr.Validation("parameter %q expands to %d values (max %d)", p.Name, count, maxRangeValuesPerAxis)
+	}
+	values := make([]interface{}, count)
+	for i := range values {
+		// Round to avoid float accumulation noise such as 0.30000000000000004
+		values[i] = math.Round((*p.Min+float64(i)*(*p.Step))*1e9) / 1e9
+	}
+	return values, nil
+}
+
+// expandSweepGrid returns the cartesian product of the parameter values, failing
+// once the grid grows past limit
+func expandSweepGrid(params []SweepParameter, limit int) ([]map[string]interface{}, error) {
+	grid := []map[string]interface{}{{}}
+	seen := make(map[string]bool, len(params))
+	for _, p := range params {
+		if p.Name == "" {
+			return nil, apperr.Validation("parameter name is required")
+		}
+		if seen[p.Name] {
+			return nil, apperr.Validation("duplicate parameter %q", p.Name)
+		}
+		seen[p.Name] = true
+
+		values, err := p.expandValues()
+		if err != nil {
+			return nil, err
+		}
+		if len(grid)*len(values) > limit {
+			return nil, apperr.LimitExceeded("sweep exceeds your plan's limit of %d parameter combinations", limit)
+		}
+		next := make([]map[string]interface{}, 0, len(grid)*len(values))
+		for _, combo := range grid {
+			for _, v := range values {
+				cell := make(map[string]interface{}, len(combo)+1)
+				for k, existing := range combo {
+					cell[k] = existing
+				}
+				cell[p.Name] = v
+				next = append(next, cell)
+			}
+		}
+		grid = next
+	}
+	return grid, nil
+}
+
+// RunOptimizationSweep fans out one backtest per parameter combination, scores
+// each on a train segment, and checks the ranking against a held-out test segment.
+func RunOptimizationSweep(ctx context.Context, conn *data.Conn, userID int, rawArgs json.RawMessage) (any, error) {
+	var args RunOptimizationSweepArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if len(args.Parameters) == 0 {
+		return nil, apperr.Validation("at least one parameter is required")
+	}
+	if args.Metric == "" {
+		args.Metric = defaultSweepMetric
+	}
+	if args.TrainFraction == 0 {
+		args.TrainFraction = defaultTrainFraction
+	}
+	if args.TrainFraction <= 0 || args.TrainFraction >= 1 {
+		return nil, apperr.Validation("trainFraction must be between 0 and 1")
+	}
+	start, err := time.Parse("2006-01-02", args.StartDate)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.CodeValidation, err, "invalid startDate")
+	}
+	end, err := time.Parse("2006-01-02", args.EndDate)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.CodeValidation, err, "invalid endDate")
+	}
+	if !end.After(start) {
+		return nil, apperr.Validation("endDate must be after startDate")
+	}
+	split := start.Add(time.Duration(float64(end.Sub(start)) * args.TrainFraction))
+
+	ownerID, err := workspaces.Authorize(ctx, conn, userID, workspaces.TypeStrategy, args.StrategyID, workspaces.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, err := limits.GetSweepCombinationsLimit(conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	grid, err := expandSweepGrid(args.Parameters, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Starting optimization sweep for strategy %d with %d combinations", args.StrategyID, len(grid))
+
+	results := make([]SweepResult, len(grid))
+	sem := make(chan struct{}, maxSweepInFlight)
+	var wg sync.WaitGroup
+	for i, params := range grid {
+		wg.Add(1)
+		go func(i int, params map[string]interface{}) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = runSweepCell(ctx, conn, ownerID, args, params, split)
+		}(i, params)
+	}
+	wg.Wait()
+
+	response := rankSweepResults(args, results, split)
+
+	metadata := map[string]interface{}{
+		"strategy_id":      args.StrategyID,
+		"combinations":     len(grid),
+		"operation_type":   "optimization_sweep",
+		"credits_consumed": 0,
+	}
+	if err := limits.RecordUsage(conn, userID, limits.UsageTypeBacktest, 0, metadata); err != nil {
+		log.Printf("Warning: Failed to log optimization sweep usage: %v", err)
+	}
+	return response, nil
+}
+
+// runSweepCell backtests one parameter combination and splits its instances into
+// train and test metrics
+func runSweepCell(ctx context.Context, conn *data.Conn, userID int, args RunOptimizationSweepArgs, params map[string]interface{}, split time.Time) SweepResult {
+	cell := SweepResult{Params: params}
+
+	handle, err := queue.Backtest(ctx, conn, map[string]interface{}{
+		"strategy_id": args.StrategyID,
+		"user_id":     userID,
+		"version":     args.Version,
+		"start_date":  args.StartDate,
+		"end_date":    args.EndDate,
+		"params":      params,
+	})
+	if err != nil {
+		cell.Error = fmt.Sprintf("error queuing backtest: %v", err)
+		return cell
+	}
+	result, err := queue.AwaitTypedResult[WorkerBacktestResult](ctx, handle, nil)
+	if err != nil {
+		cell.Error = fmt.Sprintf("error waiting for backtest: %v", err)
+		return cell
+	}
+	if !result.Success {
+		cell.Error = result.ErrorMessage
+		if cell.Error == "" {
+			cell.Error = "backtest failed"
+		}
+		return cell
+	}
+
+	var train, test []float64
+	splitUnix := split.Unix()
+	for _, instance := range result.Instances {
+		value, ok := instance[args.Metric].(float64)
+		if !ok {
+			continue
+		}
+		ts, _ := instance["timestamp"].(float64)
+		if int64(ts) < splitUnix {
+			train = append(train, value)
+		} else {
+			test = append(test, value)
+		}
+	}
+	cell.Train = summarizeSweepSegment(train)
+	cell.Test = summarizeSweepSegment(test)
+	return cell
+}
+
+// summarizeSweepSegment computes the metrics of one segment
+func summarizeSweepSegment(values []float64) SweepMetrics {
+	m := SweepMetrics{Instances: len(values)}
+	if len(values) == 0 {
+		return m
+	}
+	var sum float64
+	var hits int
+	for _, v := range values {
+		sum += v
+		if v > 0 {
+			hits++
+		}
+	}
+	m.MeanMetric = sum / float64(len(values))
+	m.HitRate = float64(hits) / float64(len(values))
+	return m
+}
+
+// rankSweepResults orders the grid by train performance and attaches overfitting warnings
+func rankSweepResults(args RunOptimizationSweepArgs, results []SweepResult, split time.Time) SweepResponse {
+	sort.SliceStable(results, func(i, j int) bool {
+		// Failed cells sink to the bottom
+		if (results[i].Error == "") != (results[j].Error == "") {
+			return results[i].Error == ""
+		}
+		return results[i].Train.MeanMetric > results[j].Train.MeanMetric
+	})
+
+	bestTestIdx := -1
+	for i := range results {
+		r := &results[i]
+		r.Rank = i + 1
+		if r.Error != "" {
+			continue
+		}
+		if r.Test.Instances < minTestInstances {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("only %d instances in the test period; results are not statistically meaningful", r.Test.Instances))
+		}
+		if r.Train.MeanMetric > 0 && r.Test.MeanMetric < r.Train.MeanMetric*overfitDegradeRatio {
+			r.Warnings = append(r.Warnings, "test performance is less than half of train performance; likely overfit")
+		}
+		if bestTestIdx < 0 || r.Test.MeanMetric > results[bestTestIdx].Test.MeanMetric {
+			bestTestIdx = i
+		}
+	}
+
+	response := SweepResponse{
+		StrategyID:   args.StrategyID,
+		Metric:       args.Metric,
+		SplitDate:    split.Format("2006-01-02"),
+		Combinations: len(results),
+		Results:      results,
+	}
+	if bestTestIdx > 0 {
+		response.Warnings = append(response.Warnings,
+			fmt.Sprintf("the best train combination ranks below combination #%d on the test period; the ranking does not hold out-of-sample", bestTestIdx+1))
+	}
+	if len(results) >= 20 {
+		response.Warnings = append(response.Warnings,
+			fmt.Sprintf("%d combinations were tested; the top result is inflated by multiple comparisons", len(results)))
+	}
+	return response
+}
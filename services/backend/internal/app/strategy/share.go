@@ -0,0 +1,373 @@
+package strategy
+
+import (
+	"backend/internal/app/workspaces"
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	defaultShareLinkTTL = 7 * 24 * time.Hour
+	maxShareLinkTTL     = 90 * 24 * time.Hour
+)
+
+// SharedStrategySummary is the user-free view of a strategy shown on a share link
+type SharedStrategySummary struct {
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Version      int    `json:"version"`
+	MinTimeframe string `json:"minTimeframe,omitempty"`
+	CreatedAt    string `json:"createdAt,omitempty"` // date only
+	PythonCode   string `json:"pythonCode,omitempty"`
+}
+
+// SharedReport is the snapshot rendered by the public share endpoint
+type SharedReport struct {
+	Kind     string                `json:"kind"` // "strategy" or "backtest"
+	Strategy SharedStrategySummary `json:"strategy"`
+	Backtest *BacktestResponse     `json:"backtest,omitempty"`
+}
+
+// ShareLink describes a share link to its owner
+type ShareLink struct {
+	ShareID      int     `json:"shareId"`
+	StrategyID   int     `json:"strategyId"`
+	Version      int     `json:"version"`
+	Kind         string  `json:"kind"`
+	Token        string  `json:"token"`
+	ExpiresAt    string  `json:"expiresAt"`
+	RevokedAt    *string `json:"revokedAt,omitempty"`
+	ViewCount    int     `json:"viewCount"`
+	LastViewedAt *string `json:"lastViewedAt,omitempty"`
+	CreatedAt    string  `json:"createdAt"`
+}
+
+// shareLinkSecret signs share tokens; SHARE_LINK_SECRET falls back to JWT_SECRET
+func shareLinkSecret() ([]byte, error) {
+	secret := os.Getenv("SHARE_LINK_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("share links are not configured")
+	}
+	return []byte(secret), nil
+}
+
+// signShareToken returns "<shareID>.<expiryUnix>.<signature>"
+func signShareToken(shareID int, expiresAt time.Time) (string, error) {
+	secret, err := shareLinkSecret()
+	if err != nil {
+		return "", err
+	}
+	payload := fmt.Sprintf("%d.%d", shareID, expiresAt.Unix())
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifyShareToken checks the signature and expiry and returns the share ID
+func verifyShareToken(token string) (int, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, apperr.Validation("invalid share link")
+	}
+	secret, err := shareLinkSecret()
+	if err != nil {
+		return 0, err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, mac.Sum(nil)) {
+		return 0, apperr.Validation("invalid share link")
+	}
+	shareID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, apperr.Validation("invalid share link")
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, apperr.Validation("invalid share link")
+	}
+	if time.Now().Unix() > expiry {
+		return 0, apperr.NotFound("this share link has expired")
+	}
+	return shareID, nil
+}
+
+// stripBacktestForShare drops everything in a backtest that can identify its
+// owner: free-form prints, internal security IDs and any instance field not
+// on the share whitelist (see sharedInstance)
+func stripBacktestForShare(bt BacktestResponse) *BacktestResponse {
+	bt.StrategyPrints = ""
+	columns := map[string]bool{}
+	instances := make([]BacktestInstanceRow, len(bt.Instances))
+	for i, row := range bt.Instances {
+		row.SecurityID = 0
+		row.Instance = sharedInstance(row.Instance)
+		for key := range row.Instance {
+			columns[key] = true
+		}
+		instances[i] = row
+	}
+	bt.Instances = instances
+	kept := make([]string, 0, len(columns))
+	for _, column := range bt.Summary.Columns {
+		if columns[column] {
+			kept = append(kept, column)
+		}
+	}
+	bt.Summary.Columns = kept
+	return &bt
+}
+
+// sharedInstance keeps the fields of a backtest instance a share link may
+// show: its ticker and timestamp, and the numbers and flags the strategy
+// computed. Strings, lists and objects can carry anything the strategy put in
+// them, and ID fields point at internal rows, so they are left out.
+func sharedInstance(instance map[string]any) map[string]any {
+	if instance == nil {
+		return nil
+	}
+	out := make(map[string]any, len(instance))
+	for key, value := range instance {
+		if key == "ticker" || key == "timestamp" {
+			out[key] = value
+			continue
+		}
+		if isIDField(key) {
+			continue
+		}
+		switch value.(type) {
+		case float64, float32, int, int64, bool:
+			out[key] = value
+		}
+	}
+	return out
+}
+
+// isIDField reports whether an instance field names an internal row
+func isIDField(key string) bool {
+	k := strings.ToLower(key)
+	return k == "id" || strings.HasSuffix(k, "_id") || strings.HasSuffix(k, "securityid") ||
+		strings.HasSuffix(k, "userid") || strings.HasSuffix(k, "strategyid")
+}
+
+// CreateShareLinkArgs contains arguments for creating a share link
+type CreateShareLinkArgs struct {
+	StrategyID     int    `json:"strategyId"`
+	Version        int    `json:"version,omitempty"` // defaults to the current version
+	Kind           string `json:"kind"`              // "strategy" or "backtest"
+	ExpiresInHours int    `json:"expiresInHours,omitempty"`
+	IncludeCode    bool   `json:"includeCode,omitempty"`
+}
+
+// CreateShareLink snapshots a strategy summary or backtest report and returns a
+// signed, expiring public link token for it
+func CreateShareLink(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args CreateShareLinkArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.Kind == "" {
+		args.Kind = "backtest"
+	}
+	if args.Kind != "strategy" && args.Kind != "backtest" {
+		return nil, apperr.Validation("kind must be strategy or backtest")
+	}
+	ttl := defaultShareLinkTTL
+	if args.ExpiresInHours > 0 {
+		ttl = time.Duration(args.ExpiresInHours) * time.Hour
+	}
+	if ttl > maxShareLinkTTL {
+		return nil, apperr.Validation("share links can last at most %d days", int(maxShareLinkTTL.Hours()/24))
+	}
+
+	ctx := context.Background()
+	ownerID, err := workspaces.Authorize(ctx, conn, userID, workspaces.TypeStrategy, args.StrategyID, workspaces.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	var summary SharedStrategySummary
+	var createdAt time.Time
+	var code string
+	err = conn.DB.QueryRow(ctx, `
+		SELECT name, COALESCE(description, ''), COALESCE(version, 1),
+		       COALESCE(min_timeframe, ''), COALESCE(createdat, NOW()), COALESCE(pythoncode, '')
+		FROM strategies WHERE strategyid = $1 AND userid = $2`,
+		args.StrategyID, ownerID).Scan(&summary.Name, &summary.Description, &summary.Version,
+		&summary.MinTimeframe, &createdAt, &code)
+	if err != nil {
+		return nil, apperr.NotFound("strategy not found")
+	}
+	summary.CreatedAt = createdAt.Format("2006-01-02")
+	if args.Version != 0 {
+		// Versions count up from 1; only the current one's code and
+		// description are kept, so a summary can't be of an older one
+		if args.Version < 1 || args.Version > summary.Version {
+			return nil, apperr.NotFound("strategy %d has no version %d", args.StrategyID, args.Version)
+		}
+		if args.Kind == "strategy" && args.Version != summary.Version {
+			return nil, apperr.Validation("only the current version (%d) of a strategy can be shared as a summary", summary.Version)
+		}
+		summary.Version = args.Version
+	}
+	if args.IncludeCode {
+		summary.PythonCode = code
+	}
+
+	report := SharedReport{Kind: args.Kind, Strategy: summary}
+	if args.Kind == "backtest" {
+		bt, err := GetBacktestFromCache(ctx, conn, ownerID, args.StrategyID, summary.Version)
+		if err != nil {
+			return nil, fmt.Errorf("error loading backtest: %v", err)
+		}
+		report.Backtest = stripBacktestForShare(*bt)
+	}
+	snapshot, err := json.Marshal(report)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding share snapshot: %v", err)
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	link := ShareLink{StrategyID: args.StrategyID, Version: summary.Version, Kind: args.Kind}
+	var created time.Time
+	err = conn.DB.QueryRow(ctx, `
+		INSERT INTO strategy_share_links (user_id, strategy_id, version, kind, snapshot, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING share_id, created_at`,
+		userID, args.StrategyID, summary.Version, args.Kind, snapshot, expiresAt).Scan(&link.ShareID, &created)
+	if err != nil {
+		return nil, fmt.Errorf("error creating share link: %v", err)
+	}
+	if link.Token, err = signShareToken(link.ShareID, expiresAt); err != nil {
+		return nil, err
+	}
+	link.ExpiresAt = expiresAt.Format(time.RFC3339)
+	link.CreatedAt = created.Format(time.RFC3339)
+	return link, nil
+}
+
+// GetShareLinksArgs contains arguments for listing share links
+type GetShareLinksArgs struct {
+	StrategyID int `json:"strategyId,omitempty"` // 0 = all strategies
+}
+
+// GetShareLinks lists the user's share links with view counts
+func GetShareLinks(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetShareLinksArgs
+	if len(rawArgs) > 0 {
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			return nil, apperr.InvalidArgs(err)
+		}
+	}
+	rows, err := conn.DB.Query(context.Background(), `
+		SELECT share_id, strategy_id, version, kind, expires_at, revoked_at,
+		       view_count, last_viewed_at, created_at
+		FROM strategy_share_links
+		WHERE user_id = $1 AND ($2 = 0 OR strategy_id = $2)
+		ORDER BY created_at DESC`, userID, args.StrategyID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying share links: %v", err)
+	}
+	defer rows.Close()
+
+	links := []ShareLink{}
+	for rows.Next() {
+		var link ShareLink
+		var expiresAt, createdAt time.Time
+		var revokedAt, lastViewedAt *time.Time
+		if err := rows.Scan(&link.ShareID, &link.StrategyID, &link.Version, &link.Kind, &expiresAt,
+			&revokedAt, &link.ViewCount, &lastViewedAt, &createdAt); err != nil {
+			return nil, fmt.Errorf("error scanning share link: %v", err)
+		}
+		if link.Token, err = signShareToken(link.ShareID, expiresAt); err != nil {
+			return nil, err
+		}
+		link.ExpiresAt = expiresAt.Format(time.RFC3339)
+		link.CreatedAt = createdAt.Format(time.RFC3339)
+		if revokedAt != nil {
+			s := revokedAt.Format(time.RFC3339)
+			link.RevokedAt = &s
+		}
+		if lastViewedAt != nil {
+			s := lastViewedAt.Format(time.RFC3339)
+			link.LastViewedAt = &s
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// RevokeShareLinkArgs contains arguments for revoking a share link
+type RevokeShareLinkArgs struct {
+	ShareID int `json:"shareId"`
+}
+
+// RevokeShareLink disables a share link before it expires
+func RevokeShareLink(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args RevokeShareLinkArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	tag, err := conn.DB.Exec(context.Background(), `
+		UPDATE strategy_share_links SET revoked_at = NOW()
+		WHERE share_id = $1 AND user_id = $2 AND revoked_at IS NULL`, args.ShareID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error revoking share link: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, apperr.NotFound("share link not found or already revoked")
+	}
+	return nil, nil
+}
+
+// GetSharedReportArgs contains arguments for the public share endpoint
+type GetSharedReportArgs struct {
+	Token string `json:"token"`
+}
+
+// GetSharedReport is the public, unauthenticated handler that renders a share
+// link's snapshot and counts the view
+func GetSharedReport(conn *data.Conn, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetSharedReportArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	shareID, err := verifyShareToken(args.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot []byte
+	err = conn.DB.QueryRow(context.Background(), `
+		UPDATE strategy_share_links
+		SET view_count = view_count + 1, last_viewed_at = NOW()
+		WHERE share_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		RETURNING snapshot`, shareID).Scan(&snapshot)
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("this share link is no longer available")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading shared report: %v", err)
+	}
+
+	var report SharedReport
+	if err := json.Unmarshal(snapshot, &report); err != nil {
+		return nil, fmt.Errorf("error decoding shared report: %v", err)
+	}
+	return report, nil
+}
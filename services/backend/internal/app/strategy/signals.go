@@ -0,0 +1,201 @@
+package strategy
+
+import (
+	"backend/internal/app/chart"
+	"backend/internal/app/workspaces"
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/queue"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4"
+)
+
+// StrategySignalsCacheKey is the Redis cache key format for storing strategy signals.
+// Entries are keyed by version, so editing a strategy never serves stale markers.
+const StrategySignalsCacheKey = "signals:strategyID:%d:version:%d:securityID:%d:timeframe:%s"
+
+const strategySignalsCacheTTL = 24 * time.Hour
+
+// GetStrategySignalsArgs represents arguments for GetStrategySignals
+type GetStrategySignalsArgs struct {
+	StrategyID int    `json:"strategyId"`
+	SecurityID int    `json:"securityId"`
+	Timeframe  string `json:"timeframe"`
+	// From and To optionally restrict the returned markers (Unix milliseconds)
+	From int64 `json:"from,omitempty"`
+	To   int64 `json:"to,omitempty"`
+}
+
+// StrategySignalsResponse contains the bar timestamps (Unix milliseconds) where
+// the strategy's conditions were met on the requested security.
+type StrategySignalsResponse struct {
+	StrategyID int     `json:"strategyId"`
+	Version    int     `json:"version"`
+	SecurityID int     `json:"securityId"`
+	Ticker     string  `json:"ticker"`
+	Timeframe  string  `json:"timeframe"`
+	Timestamps []int64 `json:"timestamps"`
+}
+
+// GetStrategySignals returns the historical signals of a strategy on a single
+// security so the chart can plot markers. Results are computed by the worker and
+// cached per strategy version, security and timeframe.
+func GetStrategySignals(ctx context.Context, conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetStrategySignalsArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.StrategyID <= 0 || args.SecurityID <= 0 {
+		return nil, apperr.Validation("strategyId and securityId are required")
+	}
+	if args.Timeframe == "" {
+		args.Timeframe = "1d"
+	}
+	multiplier, timespan, _, _, err := chart.GetTimeFrame(args.Timeframe)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.CodeValidation, err, "invalid timeframe %q", args.Timeframe)
+	}
+
+	ownerID, err := workspaces.Authorize(ctx, conn, userID, workspaces.TypeStrategy, args.StrategyID, workspaces.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	var version int
+	err = conn.DB.QueryRow(ctx, `
+		SELECT COALESCE(version, 1) FROM strategies WHERE strategyid = $1 AND userid = $2`,
+		args.StrategyID, ownerID).Scan(&version)
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("strategy not found or access denied")
+	} else if err != nil {
+		return nil, fmt.Errorf("error checking strategy: %v", err)
+	}
+
+	var ticker string
+	err = conn.DB.QueryRow(ctx, `
+		SELECT ticker FROM securities WHERE securityid = $1 ORDER BY maxdate DESC NULLS FIRST LIMIT 1`,
+		args.SecurityID).Scan(&ticker)
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("security %d not found", args.SecurityID)
+	} else if err != nil {
+		return nil, fmt.Errorf("error looking up security: %v", err)
+	}
+
+	cacheKey := fmt.Sprintf(StrategySignalsCacheKey, args.StrategyID, version, args.SecurityID, args.Timeframe)
+	response, err := getStrategySignalsFromCache(ctx, conn, cacheKey)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	if response == nil {
+		response, err = computeStrategySignals(ctx, conn, ownerID, args, version, ticker, multiplier, timespan)
+		if err != nil {
+			return nil, err
+		}
+		if cacheData, err := json.Marshal(response); err == nil {
+			if err := conn.Cache.Set(ctx, cacheKey, cacheData, strategySignalsCacheTTL).Err(); err != nil {
+				log.Printf("Warning: Failed to cache strategy signals: %v", err)
+			}
+		}
+	}
+
+	if args.From > 0 || args.To > 0 {
+		filtered := make([]int64, 0, len(response.Timestamps))
+		for _, ts := range response.Timestamps {
+			if (args.From > 0 && ts < args.From) || (args.To > 0 && ts > args.To) {
+				continue
+			}
+			filtered = append(filtered, ts)
+		}
+		response.Timestamps = filtered
+	}
+	return response, nil
+}
+
+// getStrategySignalsFromCache returns nil on a cache miss
+func getStrategySignalsFromCache(ctx context.Context, conn *data.Conn, cacheKey string) (*StrategySignalsResponse, error) {
+	cacheData, err := conn.Cache.Get(ctx, cacheKey).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting strategy signals cache: %v", err)
+	}
+
+	var response StrategySignalsResponse
+	if err := json.Unmarshal([]byte(cacheData), &response); err != nil {
+		conn.Cache.Del(ctx, cacheKey)
+		return nil, fmt.Errorf("error unmarshaling cached strategy signals: %v", err)
+	}
+	return &response, nil
+}
+
+// computeStrategySignals runs the strategy on the worker over a lookback window
+// sized to the timeframe and aligns the resulting timestamps to bar starts.
+func computeStrategySignals(ctx context.Context, conn *data.Conn, userID int, args GetStrategySignalsArgs, version int, ticker string, multiplier int, timespan string) (*StrategySignalsResponse, error) {
+	endDate := time.Now()
+	var startDate time.Time
+	switch timespan {
+	case "second", "minute":
+		startDate = endDate.AddDate(0, 0, -30)
+	case "hour":
+		startDate = endDate.AddDate(0, -6, 0)
+	default:
+		startDate = endDate.AddDate(-5, 0, 0)
+	}
+
+	result, err := queue.SignalsTyped(ctx, conn, map[string]interface{}{
+		"strategy_id": args.StrategyID,
+		"user_id":     userID,
+		"version":     version,
+		"ticker":      ticker,
+		"start_date":  startDate.Format("2006-01-02"),
+		"end_date":    endDate.Format("2006-01-02"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error computing strategy signals: %v", err)
+	}
+	if !result.Success {
+		if result.Error != nil {
+			return nil, fmt.Errorf("strategy signals failed: %s", result.Error.Message)
+		}
+		return nil, fmt.Errorf("strategy signals failed: %s", result.ErrorMessage)
+	}
+
+	// Daily and longer bars are plotted at the instance timestamp as returned
+	barSeconds := int64(0)
+	if timespan == "second" || timespan == "minute" || timespan == "hour" {
+		barSeconds = chart.GetTimeframeInSeconds(multiplier, timespan)
+	}
+	timestamps := make([]int64, 0, len(result.Timestamps))
+	var last int64 = -1
+	for _, ts := range result.Timestamps {
+		// Workers send seconds, though some strategies return milliseconds;
+		// anything past 1e12 is milliseconds (seconds would be past 33000 AD)
+		if ts > 1e12 {
+			ts /= 1000
+		}
+		if barSeconds > 0 {
+			ts -= ts % barSeconds
+		}
+		// The chart expects milliseconds
+		ms := ts * 1000
+		if ms == last {
+			continue
+		}
+		timestamps = append(timestamps, ms)
+		last = ms
+	}
+
+	return &StrategySignalsResponse{
+		StrategyID: args.StrategyID,
+		Version:    result.Version,
+		SecurityID: args.SecurityID,
+		Ticker:     ticker,
+		Timeframe:  args.Timeframe,
+		Timestamps: timestamps,
+	}, nil
+}
@@ -1,6 +1,8 @@
 package strategy
 
 import (
+	"backend/internal/app/workspaces"
+	"backend/internal/apperr"
 	"backend/internal/data"
 	"backend/internal/queue"
 	"context"
@@ -9,7 +11,12 @@ import (
 	"log"
 	"time"
 
+	"backend/internal/app/dependencies"
 	"backend/internal/app/limits"
+	"backend/internal/app/screener"
+	"backend/internal/services/twofactor"
+
+	"github.com/jackc/pgx/v4"
 )
 
 // CreateStrategyFromPromptArgs contains the user's natural language prompt
@@ -47,26 +54,20 @@ type ScreeningResult struct {
 func RunScreening(ctx context.Context, conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
 	var args ScreeningArgs
 	if err := json.Unmarshal(rawArgs, &args); err != nil {
-		return nil, fmt.Errorf("invalid args: %v", err)
+		return nil, apperr.InvalidArgs(err)
 	}
 
 	log.Printf("Starting complete screening for strategy %d using new worker architecture", args.StrategyID)
 
-	// Verify strategy exists and user has permission
-	var strategyExists bool
-	err := conn.DB.QueryRow(context.Background(), `
-		SELECT EXISTS(SELECT 1 FROM strategies WHERE strategyid = $1 AND userid = $2)`,
-		args.StrategyID, userID).Scan(&strategyExists)
+	// Verify strategy exists and user has permission; the worker loads it as its owner's
+	ownerID, err := workspaces.Authorize(ctx, conn, userID, workspaces.TypeStrategy, args.StrategyID, workspaces.RoleViewer)
 	if err != nil {
-		return nil, fmt.Errorf("error checking strategy: %v", err)
-	}
-	if !strategyExists {
-		return nil, fmt.Errorf("strategy not found or access denied")
+		return nil, err
 	}
 
 	// Build arguments for the new typed-queue screening task
 	qArgs := map[string]interface{}{
-		"user_id":      userID,
+		"user_id":      ownerID,
 		"strategy_ids": []string{fmt.Sprintf("%d", args.StrategyID)},
 	}
 	if len(args.Universe) > 0 {
@@ -186,7 +187,7 @@ func waitForScreeningResult(ctx context.Context, conn *data.Conn, taskID string,
 	for {
 		select {
 		case <-timeoutCtx.Done():
-			return nil, fmt.Errorf("timeout waiting for screening result")
+			return nil, apperr.UpstreamTimeout("timeout waiting for screening result")
 		case msg := <-ch:
 			if msg == nil {
 				continue
@@ -288,6 +289,7 @@ func AgentCreateStrategyFromPrompt(ctx context.Context, conn *data.Conn, userID
 	}()*/
 	return res, nil
 }
+
 // CreateStrategyFromPrompt creates a new strategy from a natural language prompt using the worker queue
 func CreateStrategyFromPrompt(ctx context.Context, conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
 	log.Printf("=== STRATEGY CREATION START (WORKER QUEUE) ===")
@@ -297,14 +299,24 @@ func CreateStrategyFromPrompt(ctx context.Context, conn *data.Conn, userID int,
 	var args CreateStrategyFromPromptArgs
 	if err := json.Unmarshal(rawArgs, &args); err != nil {
 		log.Printf("ERROR: Failed to unmarshal args: %v", err)
-		return nil, fmt.Errorf("invalid args: %v", err)
+		return nil, apperr.InvalidArgs(err)
 	}
 
 	log.Printf("Parsed args - Query: %q, StrategyID: %d", args.Query, args.StrategyID)
+
+	// Editors of a shared strategy can edit it; the new version stays its owner's
+	ownerID := userID
+	if args.StrategyID != 0 {
+		var err error
+		ownerID, err = workspaces.Authorize(ctx, conn, userID, workspaces.TypeStrategy, args.StrategyID, workspaces.RoleEditor)
+		if err != nil {
+			return nil, err
+		}
+	}
 	log.Printf("Delegating strategy creation to Python worker...")
 
 	// Call the worker to create the strategy
-	result, err := callWorkerCreateStrategy(ctx, conn, userID, args.Query, args.StrategyID)
+	result, err := callWorkerCreateStrategy(ctx, conn, ownerID, args.Query, args.StrategyID)
 	if err != nil {
 		log.Printf("ERROR: Worker strategy creation failed: %v", err)
 		return nil, fmt.Errorf("strategy creation failed: %v", err)
@@ -374,10 +386,32 @@ func callWorkerCreateStrategy(ctx context.Context, conn *data.Conn, userID int,
 	return result, nil
 }
 
-// GetStrategies retrieves all strategies for a given user from the database
-func GetStrategies(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+// GetStrategiesArgs optionally narrows the list to one tag (see tags.go)
+type GetStrategiesArgs struct {
+	Tag string `json:"tag,omitempty"`
+}
+
+// GetStrategies retrieves the user's strategies and those shared with them
+// through a workspace
+func GetStrategies(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetStrategiesArgs
+	if len(rawArgs) > 0 {
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			return nil, apperr.InvalidArgs(err)
+		}
+	}
+	tag, err := parseTagArg(args.Tag)
+	if err != nil {
+		return nil, err
+	}
+	// Versions the worker saved since the last tagging pass are tagged now,
+	// so the filter sees them
+	if _, err := tagStaleStrategies(context.Background(), conn, userID); err != nil {
+		log.Printf("⚠️ Failed to tag strategies of user %d: %v", userID, err)
+	}
+
 	rows, err := conn.DB.Query(context.Background(), `
-		SELECT strategyid, name, 
+		SELECT strategyid, userid, workspace_id, name, 
 		       COALESCE(description, '') as description,
 		       COALESCE(prompt, '') as prompt,
 		       COALESCE(pythoncode, '') as pythoncode,
@@ -388,8 +422,13 @@ func GetStrategies(conn *data.Conn, userID int, _ json.RawMessage) (interface{},
 		       alert_threshold,
 		       alert_universe,
 		       COALESCE(min_timeframe, '') as min_timeframe,
-		       alert_last_trigger_at
-		FROM strategies WHERE userid = $1 ORDER BY createdat DESC`, userID)
+		       alert_last_trigger_at,
+		       tags
+		FROM strategies
+		WHERE (userid = $1
+		   OR workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1))
+		  AND ($2 = '' OR $2 = ANY(tags))
+		ORDER BY createdat DESC`, userID, tag)
 	if err != nil {
 		return nil, err
 	}
@@ -403,6 +442,8 @@ func GetStrategies(conn *data.Conn, userID int, _ json.RawMessage) (interface{},
 
 		if err := rows.Scan(
 			&strategy.StrategyID,
+			&strategy.UserID,
+			&strategy.WorkspaceID,
 			&strategy.Name,
 			&strategy.Description,
 			&strategy.Prompt,
@@ -415,11 +456,11 @@ func GetStrategies(conn *data.Conn, userID int, _ json.RawMessage) (interface{},
 			&strategy.AlertUniverse,
 			&strategy.MinTimeframe,
 			&alertLastTriggerAt,
+			&strategy.Tags,
 		); err != nil {
 			return nil, fmt.Errorf("error scanning strategy: %v", err)
 		}
 
-		strategy.UserID = userID
 		strategy.CreatedAt = createdAt.Format(time.RFC3339)
 
 		// Convert alert_last_trigger_at to string if not null
@@ -440,45 +481,119 @@ type SetAlertArgs struct {
 	Active     bool     `json:"active"`
 	Threshold  *float64 `json:"threshold,omitempty"`
 	Universe   []string `json:"universe,omitempty"`
+	// UniverseFilters defines the universe as a screen (built-in or computed
+	// columns of the owner). The screen is stored and resolved to tickers at
+	// each evaluation, so the universe follows the market.
+	UniverseFilters []screener.Filter `json:"universeFilters,omitempty"`
+	// IntervalSeconds is how often the alert is evaluated, no more often than
+	// the plan allows. Omitted keeps the current interval; 0 resets it to the
+	// default.
+	IntervalSeconds *int `json:"intervalSeconds,omitempty"`
+	// SectorTopN notifies only each sector's N best-scoring matches. Omitted
+	// keeps the current setting; 0 notifies every match.
+	SectorTopN *int `json:"sectorTopN,omitempty"`
+	// ConfirmCost enables an alert whose estimated cost needs confirming
+	// (see cost.go)
+	ConfirmCost bool `json:"confirmCost,omitempty"`
 }
 
+// maxSectorTopN bounds SectorTopN; more than this per sector isn't a filter
+const maxSectorTopN = 100
+
 // SetAlert configures alert settings for a strategy including threshold and universe
 func SetAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
 	var args SetAlertArgs
 	if err := json.Unmarshal(rawArgs, &args); err != nil {
-		return nil, fmt.Errorf("invalid args: %v", err)
+		return nil, apperr.InvalidArgs(err)
+	}
+
+	// Editors of a shared strategy can configure its alert, which stays the
+	// owner's: it counts against and is limited by the owner's plan
+	ownerID, err := workspaces.Authorize(context.Background(), conn, userID, workspaces.TypeStrategy, args.StrategyID, workspaces.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	// A screen replaces a ticker list. It is resolved here only to check it
+	// matches something and to size the cost estimate; the alert loop
+	// resolves it again at each evaluation, as the owner.
+	universeSize := len(args.Universe)
+	var universeFilters []byte
+	if len(args.UniverseFilters) > 0 {
+		tickers, err := screener.ResolveUniverse(conn, ownerID, args.UniverseFilters, 0, "")
+		if err != nil {
+			return nil, fmt.Errorf("resolving universe filters: %w", err)
+		}
+		if len(tickers) == 0 {
+			return nil, apperr.Validation("universe filters matched no securities")
+		}
+		if universeFilters, err = json.Marshal(args.UniverseFilters); err != nil {
+			return nil, fmt.Errorf("encoding universe filters: %w", err)
+		}
+		args.Universe = nil
+		universeSize = len(tickers)
+	}
+
+	if args.IntervalSeconds != nil && *args.IntervalSeconds != 0 {
+		if err := checkAlertInterval(conn, ownerID, *args.IntervalSeconds); err != nil {
+			return nil, err
+		}
+	}
+	if args.SectorTopN != nil && (*args.SectorTopN < 0 || *args.SectorTopN > maxSectorTopN) {
+		return nil, apperr.Validation("sectorTopN must be between 0 and %d", maxSectorTopN)
 	}
 
 	// Get current alert status and configuration before doing anything
 	var currentActive bool
 	var currentThreshold *float64
 	var currentUniverse []string
-	err := conn.DB.QueryRow(context.Background(), `
-		SELECT COALESCE(alertactive, false), alert_threshold, alert_universe
+	var currentFilters []byte
+	err = conn.DB.QueryRow(context.Background(), `
+		SELECT COALESCE(alertactive, false), alert_threshold, alert_universe, alert_universe_filters
 		FROM strategies 
 		WHERE strategyid = $1 AND userid = $2`,
-		args.StrategyID, userID).Scan(&currentActive, &currentThreshold, &currentUniverse)
+		args.StrategyID, ownerID).Scan(&currentActive, &currentThreshold, &currentUniverse, &currentFilters)
 	if err != nil {
 		return nil, fmt.Errorf("error checking current alert status: %v", err)
 	}
 
+	// Estimate what the alert will cost the workers each day before it runs
+	if args.Active {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		interval, err := effectiveAlertInterval(ctx, conn, args.StrategyID, args.IntervalSeconds)
+		var est *CostEstimate
+		if err == nil {
+			est, err = estimateAlertCost(ctx, conn, ownerID, args.StrategyID, universeSize, interval)
+		}
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkCost(est, args.ConfirmCost); err != nil {
+			return nil, err
+		}
+	}
+
 	// If enabling the alert, check if user can create more strategy alerts
 	if args.Active && !currentActive {
-		allowed, remaining, err := limits.CheckUsageAllowed(conn, userID, limits.UsageTypeStrategyAlert, 0)
+		allowed, remaining, err := limits.CheckUsageAllowed(conn, ownerID, limits.UsageTypeStrategyAlert, 0)
 		if err != nil {
 			return nil, fmt.Errorf("checking strategy alert limits: %w", err)
 		}
 		if !allowed {
-			return nil, fmt.Errorf("strategy alert limit reached - you have %d strategy alerts remaining", remaining)
+			return nil, apperr.LimitExceeded("strategy alert limit reached - you have %d strategy alerts remaining", remaining)
 		}
 	}
 
-	// Update the alert status and configuration
+	// Update the alert status and configuration. The interval and sector
+	// limit are only written when given, with 0 stored as NULL for the default.
 	_, err = conn.DB.Exec(context.Background(), `
 		UPDATE strategies 
-		SET alertactive = $1, alert_threshold = $2, alert_universe = $3
+		SET alertactive = $1, alert_threshold = $2, alert_universe = $3, alert_universe_filters = $8,
+		    alert_interval_seconds = CASE WHEN $6::int IS NULL THEN alert_interval_seconds ELSE NULLIF($6::int, 0) END,
+		    alert_sector_top_n = CASE WHEN $7::int IS NULL THEN alert_sector_top_n ELSE NULLIF($7::int, 0) END
 		WHERE strategyid = $4 AND userid = $5`,
-		args.Active, args.Threshold, args.Universe, args.StrategyID, userID)
+		args.Active, args.Threshold, args.Universe, args.StrategyID, ownerID, args.IntervalSeconds, args.SectorTopN, universeFilters)
 
 	if err != nil {
 		return nil, fmt.Errorf("error updating alert configuration: %v", err)
@@ -487,30 +602,48 @@ func SetAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}
 	// Update the strategy alert counter based on the change
 	if args.Active && !currentActive {
 		// Enabling alert - increment counter
-		if err := limits.RecordUsage(conn, userID, limits.UsageTypeStrategyAlert, 1, map[string]interface{}{
+		if err := limits.RecordUsage(conn, ownerID, limits.UsageTypeStrategyAlert, 1, map[string]interface{}{
 			"strategyId": args.StrategyID,
 			"action":     "enabled",
 		}); err != nil {
 			// If we can't record usage, rollback the alert activation
 			if _, rollbackErr := conn.DB.Exec(context.Background(), `
 				UPDATE strategies 
-				SET alertactive = false, alert_threshold = $1, alert_universe = $2
+				SET alertactive = false, alert_threshold = $1, alert_universe = $2, alert_universe_filters = $5
 				WHERE strategyid = $3 AND userid = $4`,
-				currentThreshold, currentUniverse, args.StrategyID, userID); rollbackErr != nil {
+				currentThreshold, currentUniverse, args.StrategyID, ownerID, currentFilters); rollbackErr != nil {
 				log.Printf("Warning: failed to rollback strategy alert activation: %v", rollbackErr)
 			}
 			return nil, fmt.Errorf("recording strategy alert usage: %w", err)
 		}
 	} else if !args.Active && currentActive {
 		// Disabling alert - decrement counter
-		if err := limits.DecrementActiveStrategyAlerts(conn, userID, 1); err != nil {
+		if err := limits.DecrementActiveStrategyAlerts(conn, ownerID, 1); err != nil {
 			// Log the error but don't fail the operation since the alert is already disabled
-			log.Printf("Warning: failed to decrement active strategy alerts counter for user %d: %v", userID, err)
+			log.Printf("Warning: failed to decrement active strategy alerts counter for user %d: %v", ownerID, err)
 		}
 	}
 
-	log.Printf("Strategy %d alert configuration updated - active: %v, threshold: %v, universe: %v",
-		args.StrategyID, args.Active, args.Threshold, args.Universe)
+	log.Printf("Strategy %d alert configuration updated - active: %v, threshold: %v, universe: %v, universe filters: %v, interval: %v, sector top N: %v",
+		args.StrategyID, args.Active, args.Threshold, args.Universe, args.UniverseFilters, args.IntervalSeconds, args.SectorTopN)
+
+	// A new universe replaces the computed columns the previous one was screened on
+	if len(args.UniverseFilters) > 0 || len(args.Universe) > 0 {
+		var targets []dependencies.Target
+		if len(args.UniverseFilters) > 0 {
+			columnIDs, err := screener.ComputedColumnIDs(context.Background(), conn, ownerID, args.UniverseFilters)
+			if err != nil {
+				log.Printf("⚠️ Failed to find computed columns of strategy %d alert universe: %v", args.StrategyID, err)
+			}
+			for _, id := range columnIDs {
+				targets = append(targets, dependencies.Target{Type: dependencies.TypeScreenerColumn, ID: id})
+			}
+		}
+		if err := dependencies.Set(context.Background(), conn.DB, userID, dependencies.TypeStrategy, args.StrategyID,
+			dependencies.RelationAlertUniverse, targets); err != nil {
+			log.Printf("⚠️ %v", err)
+		}
+	}
 
 	// Sync strategy universe to Redis for per-ticker alert processing
 	// This happens after the database update to ensure consistency
@@ -520,14 +653,35 @@ func SetAlert(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}
 	}
 
 	return map[string]interface{}{
-		"success":        true,
-		"strategyId":     args.StrategyID,
-		"alertActive":    args.Active,
-		"alertThreshold": args.Threshold,
-		"alertUniverse":  args.Universe,
+		"success":              true,
+		"strategyId":           args.StrategyID,
+		"alertActive":          args.Active,
+		"alertThreshold":       args.Threshold,
+		"alertUniverse":        args.Universe,
+		"alertUniverseFilters": args.UniverseFilters,
+		"alertIntervalSeconds": args.IntervalSeconds,
+		"alertSectorTopN":      args.SectorTopN,
 	}, nil
 }
 
+// checkAlertInterval rejects an alert interval outside the supported range or
+// more frequent than the user's plan allows
+func checkAlertInterval(conn *data.Conn, userID int, seconds int) error {
+	interval := time.Duration(seconds) * time.Second
+	if interval < limits.MinStrategyAlertInterval || interval > limits.MaxStrategyAlertInterval {
+		return apperr.Validation("alert interval must be between %d and %d seconds",
+			int(limits.MinStrategyAlertInterval.Seconds()), int(limits.MaxStrategyAlertInterval.Seconds()))
+	}
+	planMin, err := limits.GetMinStrategyAlertInterval(conn, userID)
+	if err != nil {
+		return fmt.Errorf("checking strategy alert interval: %w", err)
+	}
+	if interval < planMin {
+		return apperr.LimitExceeded("your plan evaluates strategy alerts at most every %d seconds", int(planMin.Seconds()))
+	}
+	return nil
+}
+
 // syncStrategyUniverseToRedis syncs a strategy's universe from the database to Redis
 func syncStrategyUniverseToRedis(conn *data.Conn, strategyID int) error {
 	ctx := context.Background()
@@ -556,6 +710,12 @@ func syncStrategyUniverseToRedis(conn *data.Conn, strategyID int) error {
 // DeleteStrategyArgs contains arguments for deleting a strategy
 type DeleteStrategyArgs struct {
 	StrategyID int `json:"strategyId"`
+	// TwoFactorCode confirms deleting a strategy with active alerts when the
+	// user has two-factor enabled
+	TwoFactorCode string `json:"twoFactorCode,omitempty"`
+	// OnDependents is what happens to reports, studies and escalation
+	// policies that reference it: detach (the default) or cascade
+	OnDependents string `json:"onDependents,omitempty"`
 }
 
 // DeleteStrategy removes a strategy from the database and updates alert counters
@@ -565,20 +725,49 @@ func DeleteStrategy(conn *data.Conn, userID int, rawArgs json.RawMessage) (inter
 		return nil, err
 	}
 
+	// Admins of a shared strategy's workspace can delete it too, but only the
+	// owner can take what depends on it along
+	ownerID, err := workspaces.Authorize(context.Background(), conn, userID, workspaces.TypeStrategy, args.StrategyID, workspaces.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if ownerID != userID && args.OnDependents == dependencies.ActionCascade {
+		return nil, apperr.Forbidden("only the strategy's owner can delete what depends on it")
+	}
+
 	// Check if the strategy has an active alert before deleting
 	var isAlertActive bool
-	err := conn.DB.QueryRow(context.Background(), `
+	err = conn.DB.QueryRow(context.Background(), `
 		SELECT COALESCE(alertactive, false) 
 		FROM strategies 
 		WHERE strategyid = $1 AND userid = $2`,
-		args.StrategyID, userID).Scan(&isAlertActive)
+		args.StrategyID, ownerID).Scan(&isAlertActive)
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("strategy not found or you don't have permission to delete it")
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error checking strategy alert status: %v", err)
 	}
+	if isAlertActive {
+		if err := twofactor.RequireStepUp(context.Background(), conn, userID, args.TwoFactorCode); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := context.Background()
+	tx, err := conn.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback(context.Background()) }()
 
-	result, err := conn.DB.Exec(context.Background(), `
+	if _, err := dependencies.Resolve(ctx, conn, tx, ownerID, dependencies.TypeStrategy, args.StrategyID,
+		args.OnDependents, args.TwoFactorCode); err != nil {
+		return nil, err
+	}
+	result, err := tx.Exec(ctx, `
 		DELETE FROM strategies 
-		WHERE strategyid = $1 AND userid = $2`, args.StrategyID, userID)
+		WHERE strategyid = $1 AND userid = $2`, args.StrategyID, ownerID)
 
 	if err != nil {
 		return nil, fmt.Errorf("error deleting strategy: %v", err)
@@ -586,14 +775,17 @@ func DeleteStrategy(conn *data.Conn, userID int, rawArgs json.RawMessage) (inter
 
 	rowsAffected := result.RowsAffected()
 	if rowsAffected == 0 {
-		return nil, fmt.Errorf("strategy not found or you don't have permission to delete it")
+		return nil, apperr.NotFound("strategy not found or you don't have permission to delete it")
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing strategy deletion: %v", err)
 	}
 
 	// If the strategy had an active alert, decrement the counter
 	if isAlertActive {
-		if err := limits.DecrementActiveStrategyAlerts(conn, userID, 1); err != nil {
+		if err := limits.DecrementActiveStrategyAlerts(conn, ownerID, 1); err != nil {
 			// Log the error but don't fail the deletion since the strategy is already removed
-			log.Printf("Warning: failed to decrement active strategy alerts counter for user %d: %v", userID, err)
+			log.Printf("Warning: failed to decrement active strategy alerts counter for user %d: %v", ownerID, err)
 		}
 	}
 
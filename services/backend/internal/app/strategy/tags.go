@@ -0,0 +1,240 @@
+package strategy
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Strategies are tagged by category from their code and from the words of
+// their name, description and prompt, so they can be filtered and counted by
+// kind. A tag applies when any of its signals matches; a strategy can carry
+// several (a breakout confirmed by volume is both). The rules are versioned:
+// bumping strategyTagsVersion has the tagging pass redo every strategy.
+const (
+	TagMomentum      = "momentum"
+	TagMeanReversion = "mean-reversion"
+	TagBreakout      = "breakout"
+	TagEarnings      = "earnings"
+	TagGap           = "gap"
+	TagVolume        = "volume"
+)
+
+const (
+	strategyTagsVersion = 1
+	// tagBatchSize is how many strategies one round of the pass tags
+	tagBatchSize = 500
+)
+
+// StrategyTags lists the tags in display order
+var StrategyTags = []string{TagMomentum, TagMeanReversion, TagBreakout, TagEarnings, TagGap, TagVolume}
+
+// tagSignals match lowercased code and text
+var tagSignals = map[string][]*regexp.Regexp{
+	TagMomentum: {
+		regexp.MustCompile(`momentum|\btrend(s|ing)?\b|golden.?cross|death.?cross`),
+		regexp.MustCompile(`pct_change\s*\(|\broc\b|rate_of_change|\bmacd\b`),
+		regexp.MustCompile(`\b(sma|ema|ma)_(fast|short)\b|\bfast_(sma|ema|ma)\b`),
+	},
+	TagMeanReversion: {
+		regexp.MustCompile(`mean.?revers|revert|oversold|overbought|\bbounce|reversal`),
+		regexp.MustCompile(`bollinger|\bbb_(lower|upper)\b|(lower|upper)_band|z_?score`),
+	},
+	TagBreakout: {
+		regexp.MustCompile(`break.?out|breaks? (above|out)|resistance|donchian`),
+		regexp.MustCompile(`52.?w(ee)?k|new (high|low)s?\b|all.?time.?high|prior_high`),
+		regexp.MustCompile(`\.rolling\(\s*\w+\s*\)\.max\(\)`),
+	},
+	TagEarnings: {
+		regexp.MustCompile(`earnings|\beps\b|guidance|report_date|earnings_surprise`),
+	},
+	TagGap: {
+		regexp.MustCompile(`\bgap(s|ped|ping|_\w+)?\b`),
+	},
+	TagVolume: {
+		regexp.MustCompile(`volume_ratio|\brvol\b|relative.?volume|unusual.?volume|volume.?spike|avg_volume`),
+	},
+}
+
+// tagStrategy returns the tags of a strategy, in StrategyTags order
+func tagStrategy(name, description, prompt, code string) []string {
+	text := strings.ToLower(strings.Join([]string{name, description, prompt, code}, "\n"))
+	tags := []string{}
+	for _, tag := range StrategyTags {
+		for _, signal := range tagSignals[tag] {
+			if signal.MatchString(text) {
+				tags = append(tags, tag)
+				break
+			}
+		}
+	}
+	return tags
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func validTag(tag string) bool {
+	return containsTag(StrategyTags, tag)
+}
+
+// tagStaleStrategies tags strategies whose tags are behind the current rules,
+// only the user's own when userID is set, and returns how many it tagged
+func tagStaleStrategies(ctx context.Context, conn *data.Conn, userID int) (int, error) {
+	tagged := 0
+	for {
+		rows, err := conn.DB.Query(ctx, `
+			SELECT strategyid, COALESCE(name, ''), COALESCE(description, ''), COALESCE(prompt, ''), COALESCE(pythoncode, '')
+			FROM strategies
+			WHERE tags_version < $1 AND ($2 = 0 OR userid = $2)
+			ORDER BY strategyid
+			LIMIT $3`, strategyTagsVersion, userID, tagBatchSize)
+		if err != nil {
+			return tagged, fmt.Errorf("error loading strategies to tag: %v", err)
+		}
+		var ids []int
+		var tags [][]string
+		for rows.Next() {
+			var id int
+			var name, description, prompt, code string
+			if err := rows.Scan(&id, &name, &description, &prompt, &code); err != nil {
+				rows.Close()
+				return tagged, fmt.Errorf("error scanning strategy to tag: %v", err)
+			}
+			ids = append(ids, id)
+			tags = append(tags, tagStrategy(name, description, prompt, code))
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return tagged, fmt.Errorf("error iterating strategies to tag: %v", err)
+		}
+		if len(ids) == 0 {
+			return tagged, nil
+		}
+
+		// A text[][] can't hold rows of different lengths, so each row's tags
+		// travel as one comma-joined string
+		joined := make([]string, len(tags))
+		for i, t := range tags {
+			joined[i] = strings.Join(t, ",")
+		}
+		if _, err := conn.DB.Exec(ctx, `
+			UPDATE strategies s
+			SET tags = CASE WHEN v.tags = '' THEN '{}'::text[] ELSE string_to_array(v.tags, ',') END,
+			    tags_version = $3
+			FROM unnest($1::int[], $2::text[]) AS v(strategyid, tags)
+			WHERE s.strategyid = v.strategyid`, ids, joined, strategyTagsVersion); err != nil {
+			return tagged, fmt.Errorf("error saving strategy tags: %v", err)
+		}
+		tagged += len(ids)
+		if len(ids) < tagBatchSize {
+			return tagged, nil
+		}
+	}
+}
+
+// TagStrategies is the tagging pass over every strategy behind the current
+// rules. Strategies are also tagged when their user lists them, so this
+// mostly keeps the analytics and the versions written by the worker current.
+func TagStrategies(conn *data.Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	n, err := tagStaleStrategies(ctx, conn, 0)
+	if n > 0 {
+		log.Printf("🏷️ Tagged %d strategies", n)
+	}
+	return err
+}
+
+// TagStats is how a tag is used across all users, for the admin overview
+type TagStats struct {
+	Tag          string `json:"tag"`
+	Strategies   int    `json:"strategies"`
+	Users        int    `json:"users"`
+	ActiveAlerts int    `json:"activeAlerts"`
+	Templates    int    `json:"templates"`
+	TemplateUses int    `json:"templateUses"`
+}
+
+// StrategyTagStats counts strategies, their users and active alerts, and
+// template use per tag. Strategies not tagged yet aren't counted.
+func StrategyTagStats(ctx context.Context, conn *data.Conn) ([]TagStats, error) {
+	stats := make(map[string]*TagStats, len(StrategyTags))
+	result := make([]TagStats, 0, len(StrategyTags))
+	for _, tag := range StrategyTags {
+		stats[tag] = &TagStats{Tag: tag}
+	}
+
+	rows, err := conn.DB.Query(ctx, `
+		SELECT tag, COUNT(*), COUNT(DISTINCT userid), COUNT(*) FILTER (WHERE alertactive)
+		FROM strategies, unnest(tags) AS tag
+		GROUP BY tag`)
+	if err != nil {
+		return nil, fmt.Errorf("error counting strategies by tag: %v", err)
+	}
+	for rows.Next() {
+		var tag string
+		var s TagStats
+		if err := rows.Scan(&tag, &s.Strategies, &s.Users, &s.ActiveAlerts); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning strategy tag stats: %v", err)
+		}
+		if t, ok := stats[tag]; ok {
+			t.Strategies, t.Users, t.ActiveAlerts = s.Strategies, s.Users, s.ActiveAlerts
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating strategy tag stats: %v", err)
+	}
+
+	rows, err = conn.DB.Query(ctx, `
+		SELECT tag, COUNT(DISTINCT t.template_id), COUNT(u.id)
+		FROM strategy_templates t
+		CROSS JOIN unnest(t.tags) AS tag
+		LEFT JOIN strategy_template_uses u ON u.template_id = t.template_id
+		WHERE t.active
+		GROUP BY tag`)
+	if err != nil {
+		return nil, fmt.Errorf("error counting template use by tag: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tag string
+		var templates, uses int
+		if err := rows.Scan(&tag, &templates, &uses); err != nil {
+			return nil, fmt.Errorf("error scanning template tag stats: %v", err)
+		}
+		if t, ok := stats[tag]; ok {
+			t.Templates, t.TemplateUses = templates, uses
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating template tag stats: %v", err)
+	}
+
+	for _, tag := range StrategyTags {
+		result = append(result, *stats[tag])
+	}
+	return result, nil
+}
+
+// parseTagArg checks an optional tag filter
+func parseTagArg(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag != "" && !validTag(tag) {
+		return "", apperr.Validation("unknown tag %q; tags are %s", tag, strings.Join(StrategyTags, ", "))
+	}
+	return tag, nil
+}
@@ -0,0 +1,632 @@
+package strategy
+
+import (
+	"backend/internal/app/dependencies"
+	"backend/internal/app/workspaces"
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//go:embed templates/*.py
+var templateFiles embed.FS
+
+// TemplateParam is a number the user can set when creating a strategy from a
+// template; it replaces {{key}} in the template's code
+type TemplateParam struct {
+	Key     string  `json:"key"`
+	Label   string  `json:"label"`
+	Default float64 `json:"default"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Integer bool    `json:"integer,omitempty"`
+}
+
+// templateSeed is a catalog entry; its code is templates/<key>.py
+type templateSeed struct {
+	Key           string
+	Category      string
+	Name          string
+	Description   string
+	Params        []TemplateParam
+	MinBarsParam  string
+	MinBarsOffset int
+}
+
+// templateCatalog is the system's curated set, written to strategy_templates
+// by SeedTemplates. Entries dropped from here are deactivated, not deleted, so
+// their usage history stays.
+var templateCatalog = []templateSeed{
+	{
+		Key:         "breakout_52w_high",
+		Category:    "Breakouts",
+		Name:        "52-week-high breakout",
+		Description: "Closes above its highest high of the lookback period on above-average volume",
+		Params: []TemplateParam{
+			{Key: "lookback_days", Label: "Lookback (days)", Default: 252, Min: 20, Max: 504, Integer: true},
+			{Key: "volume_multiple", Label: "Volume vs 20-day average", Default: 1.5, Min: 1, Max: 10},
+		},
+		MinBarsParam:  "lookback_days",
+		MinBarsOffset: 1,
+	},
+	{
+		Key:         "gap_up_volume",
+		Category:    "Gaps",
+		Name:        "3% gap up with volume",
+		Description: "Opens at least the gap above the previous close with volume above its 20-day average",
+		Params: []TemplateParam{
+			{Key: "gap_pct", Label: "Gap (%)", Default: 3, Min: 0.5, Max: 50},
+			{Key: "volume_multiple", Label: "Volume vs 20-day average", Default: 2, Min: 1, Max: 20},
+		},
+		MinBarsOffset: 21,
+	},
+	{
+		Key:         "gap_down_reversal",
+		Category:    "Gaps",
+		Name:        "Gap down reversal",
+		Description: "Gaps down at least the given percent, then closes above its open",
+		Params: []TemplateParam{
+			{Key: "gap_pct", Label: "Gap (%)", Default: 3, Min: 0.5, Max: 50},
+		},
+		MinBarsOffset: 2,
+	},
+	{
+		Key:         "unusual_volume",
+		Category:    "Volume",
+		Name:        "Unusual volume spike",
+		Description: "Trades a multiple of its average daily volume",
+		Params: []TemplateParam{
+			{Key: "volume_multiple", Label: "Volume vs average", Default: 3, Min: 1.5, Max: 50},
+			{Key: "avg_days", Label: "Average over (days)", Default: 20, Min: 5, Max: 100, Integer: true},
+		},
+		MinBarsParam:  "avg_days",
+		MinBarsOffset: 1,
+	},
+	{
+		Key:         "rsi_oversold",
+		Category:    "Mean reversion",
+		Name:        "RSI oversold bounce",
+		Description: "RSI crosses back above the oversold level",
+		Params: []TemplateParam{
+			{Key: "rsi_period", Label: "RSI period", Default: 14, Min: 2, Max: 50, Integer: true},
+			{Key: "rsi_level", Label: "Oversold level", Default: 30, Min: 5, Max: 50},
+		},
+		MinBarsParam:  "rsi_period",
+		MinBarsOffset: 2,
+	},
+	{
+		Key:         "golden_cross",
+		Category:    "Trend",
+		Name:        "Golden cross",
+		Description: "The fast simple moving average crosses above the slow one",
+		Params: []TemplateParam{
+			{Key: "fast_days", Label: "Fast SMA (days)", Default: 50, Min: 5, Max: 100, Integer: true},
+			{Key: "slow_days", Label: "Slow SMA (days)", Default: 200, Min: 20, Max: 400, Integer: true},
+		},
+		MinBarsParam:  "slow_days",
+		MinBarsOffset: 1,
+	},
+}
+
+// SeedTemplates writes the built-in catalog to strategy_templates, so
+// templates ship and change with the backend
+func SeedTemplates(ctx context.Context, conn *data.Conn) error {
+	keys := make([]string, 0, len(templateCatalog))
+	for i, t := range templateCatalog {
+		code, err := templateFiles.ReadFile("templates/" + t.Key + ".py")
+		if err != nil {
+			return fmt.Errorf("error reading template %s: %v", t.Key, err)
+		}
+		params, err := json.Marshal(t.Params)
+		if err != nil {
+			return fmt.Errorf("error encoding template %s params: %v", t.Key, err)
+		}
+		_, err = conn.DB.Exec(ctx, `
+			INSERT INTO strategy_templates
+				(key, category, name, description, python_code, params, min_bars_param, min_bars_offset, sort_order, tags)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (key) DO UPDATE SET
+				category = EXCLUDED.category,
+				name = EXCLUDED.name,
+				description = EXCLUDED.description,
+				python_code = EXCLUDED.python_code,
+				params = EXCLUDED.params,
+				min_bars_param = EXCLUDED.min_bars_param,
+				min_bars_offset = EXCLUDED.min_bars_offset,
+				sort_order = EXCLUDED.sort_order,
+				tags = EXCLUDED.tags,
+				active = TRUE,
+				updated_at = NOW()`,
+			t.Key, t.Category, t.Name, t.Description, string(code), string(params), t.MinBarsParam, t.MinBarsOffset, i,
+			tagStrategy(t.Name, t.Description, "", string(code)))
+		if err != nil {
+			return fmt.Errorf("error seeding template %s: %v", t.Key, err)
+		}
+		keys = append(keys, t.Key)
+	}
+	if _, err := conn.DB.Exec(ctx, `
+		UPDATE strategy_templates SET active = FALSE, updated_at = NOW()
+		WHERE active AND key <> ALL($1)`, keys); err != nil {
+		return fmt.Errorf("error deactivating retired templates: %v", err)
+	}
+	return nil
+}
+
+// StrategyTemplate is a template as the gallery lists it
+type StrategyTemplate struct {
+	Key          string          `json:"key"`
+	Category     string          `json:"category"`
+	Name         string          `json:"name"`
+	Description  string          `json:"description"`
+	Params       []TemplateParam `json:"params"`
+	MinTimeframe string          `json:"minTimeframe"`
+	Tags         []string        `json:"tags"`
+	Users        int             `json:"users"` // distinct users who created a strategy from it
+	Uses         int             `json:"uses"`
+}
+
+// TemplateCategory is a gallery category with how many templates it holds
+type TemplateCategory struct {
+	Name      string `json:"name"`
+	Templates int    `json:"templates"`
+	Users     int    `json:"users"`
+}
+
+type GetStrategyTemplatesArgs struct {
+	Category string `json:"category,omitempty"`
+	// Tag narrows the templates to one strategy tag, across categories
+	Tag string `json:"tag,omitempty"`
+	// Sort is "popular" for most users first; otherwise catalog order
+	Sort string `json:"sort,omitempty"`
+}
+
+type GetStrategyTemplatesResult struct {
+	Categories []TemplateCategory `json:"categories"`
+	Templates  []StrategyTemplate `json:"templates"`
+}
+
+// GetStrategyTemplates lists the template gallery, optionally one category,
+// with popularity counts
+func GetStrategyTemplates(conn *data.Conn, _ int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetStrategyTemplatesArgs
+	if len(rawArgs) > 0 {
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			return nil, apperr.InvalidArgs(err)
+		}
+	}
+	tag, err := parseTagArg(args.Tag)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rows, err := conn.DB.Query(ctx, `
+		SELECT t.key, t.category, t.name, t.description, t.params, t.min_timeframe, t.tags,
+		       COUNT(DISTINCT u.user_id), COUNT(u.id)
+		FROM strategy_templates t
+		LEFT JOIN strategy_template_uses u ON u.template_id = t.template_id
+		WHERE t.active
+		GROUP BY t.template_id
+		ORDER BY t.sort_order, t.key`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying strategy templates: %v", err)
+	}
+	defer rows.Close()
+
+	result := GetStrategyTemplatesResult{Categories: []TemplateCategory{}, Templates: []StrategyTemplate{}}
+	categoryIndex := map[string]int{}
+	for rows.Next() {
+		var t StrategyTemplate
+		var params []byte
+		if err := rows.Scan(&t.Key, &t.Category, &t.Name, &t.Description, &params, &t.MinTimeframe, &t.Tags,
+			&t.Users, &t.Uses); err != nil {
+			return nil, fmt.Errorf("error scanning strategy template: %v", err)
+		}
+		if err := json.Unmarshal(params, &t.Params); err != nil {
+			return nil, fmt.Errorf("error parsing template %s params: %v", t.Key, err)
+		}
+		i, ok := categoryIndex[t.Category]
+		if !ok {
+			i = len(result.Categories)
+			categoryIndex[t.Category] = i
+			result.Categories = append(result.Categories, TemplateCategory{Name: t.Category})
+		}
+		result.Categories[i].Templates++
+		result.Categories[i].Users += t.Users
+		if (args.Category == "" || args.Category == t.Category) && (tag == "" || containsTag(t.Tags, tag)) {
+			result.Templates = append(result.Templates, t)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating strategy templates: %v", err)
+	}
+	if args.Sort == "popular" {
+		sort.SliceStable(result.Templates, func(i, j int) bool {
+			return result.Templates[i].Users > result.Templates[j].Users
+		})
+	}
+	return result, nil
+}
+
+const maxTemplateUniverse = 1000
+
+var tickerPattern = regexp.MustCompile(`^[A-Z][A-Z0-9.\-]{0,9}$`)
+
+// barTimeframePattern finds the timeframes a strategy's get_bar_data calls
+// use; it matches _TIMEFRAME_RE in services/worker/src/generator.py
+var barTimeframePattern = regexp.MustCompile(`get_bar_data\s*\([\s\S]*?timeframe\s*=\s*["']([^"']+)["']`)
+
+// detectTimeframes returns the distinct timeframes a strategy's code reads
+// bars in, which its alert conditions span
+func detectTimeframes(code string) []string {
+	var timeframes []string
+	seen := map[string]bool{}
+	for _, m := range barTimeframePattern.FindAllStringSubmatch(code, -1) {
+		tf := strings.ToLower(m[1])
+		if !seen[tf] {
+			seen[tf] = true
+			timeframes = append(timeframes, tf)
+		}
+	}
+	return timeframes
+}
+
+// InstantiateStrategyTemplateArgs creates a strategy from a template. The
+// universe is a watchlist, a ticker list, or (with neither) every ticker.
+type InstantiateStrategyTemplateArgs struct {
+	TemplateKey string             `json:"templateKey"`
+	Name        string             `json:"name,omitempty"`
+	Params      map[string]float64 `json:"params,omitempty"`
+	WatchlistID *int               `json:"watchlistId,omitempty"`
+	Tickers     []string           `json:"tickers,omitempty"`
+	// EnableAlert turns on the new strategy's alert over the same universe
+	EnableAlert bool     `json:"enableAlert,omitempty"`
+	Threshold   *float64 `json:"threshold,omitempty"`
+}
+
+type InstantiateStrategyTemplateResult struct {
+	StrategyID  int      `json:"strategyId"`
+	Name        string   `json:"name"`
+	Version     int      `json:"version"`
+	Universe    []string `json:"universe,omitempty"`
+	AlertActive bool     `json:"alertActive"`
+	// AlertError is set when the strategy was created but its alert could not be enabled
+	AlertError string `json:"alertError,omitempty"`
+}
+
+type storedTemplate struct {
+	id            int
+	name          string
+	description   string
+	code          string
+	params        []TemplateParam
+	minTimeframe  string
+	minBarsParam  string
+	minBarsOffset int
+}
+
+// InstantiateStrategyTemplate creates a strategy for the user from a template
+// in one step, without a round trip through the strategy generator
+func InstantiateStrategyTemplate(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args InstantiateStrategyTemplateArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.WatchlistID != nil && len(args.Tickers) > 0 {
+		return nil, apperr.Validation("set either watchlistId or tickers, not both")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tmpl, err := loadTemplate(ctx, conn, args.TemplateKey)
+	if err != nil {
+		return nil, err
+	}
+	values, err := resolveTemplateParams(tmpl.params, args.Params)
+	if err != nil {
+		return nil, err
+	}
+	universe, err := templateUniverse(ctx, conn, userID, args.WatchlistID, args.Tickers)
+	if err != nil {
+		return nil, err
+	}
+	code, err := renderTemplate(tmpl, values, universe)
+	if err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSpace(args.Name)
+	if base == "" {
+		base = tmpl.name
+	}
+	if len(base) > 100 {
+		return nil, apperr.Validation("name must be at most 100 characters")
+	}
+	name, err := uniqueStrategyName(ctx, conn, userID, base)
+	if err != nil {
+		return nil, err
+	}
+
+	var universeFull []string
+	if len(universe) > 0 {
+		universeFull = universe
+	}
+	tx, err := conn.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback(context.Background()) }()
+	prompt := describeTemplateUse(tmpl, values, universe, args.WatchlistID)
+	var strategyID int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO strategies (userid, name, description, prompt, pythoncode,
+		                        createdat, updated_at, alertactive, score, version, min_timeframe, alert_universe_full,
+		                        alert_timeframes, tags, tags_version)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW(), false, 0, 1, $6, $7, $8, $9, $10)
+		RETURNING strategyid`,
+		userID, name, tmpl.description, prompt, code, tmpl.minTimeframe, universeFull, detectTimeframes(code),
+		tagStrategy(name, tmpl.description, prompt, code), strategyTagsVersion).Scan(&strategyID)
+	if err != nil {
+		return nil, fmt.Errorf("error creating strategy from template: %v", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO strategy_template_uses (template_id, user_id, strategy_id) VALUES ($1, $2, $3)`,
+		tmpl.id, userID, strategyID); err != nil {
+		return nil, fmt.Errorf("error recording template use: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing strategy from template: %v", err)
+	}
+	log.Printf("🧩 User %d created strategy %d from template %s", userID, strategyID, args.TemplateKey)
+
+	if err := syncStrategyUniverseToRedis(conn, strategyID); err != nil {
+		log.Printf("⚠️ Failed to sync strategy %d universe to Redis: %v", strategyID, err)
+	}
+	if args.WatchlistID != nil {
+		if err := dependencies.Set(ctx, conn.DB, userID, dependencies.TypeStrategy, strategyID, dependencies.RelationUniverse,
+			[]dependencies.Target{{Type: dependencies.TypeWatchlist, ID: *args.WatchlistID}}); err != nil {
+			log.Printf("⚠️ %v", err)
+		}
+	}
+
+	result := InstantiateStrategyTemplateResult{StrategyID: strategyID, Name: name, Version: 1, Universe: universe}
+	if args.EnableAlert {
+		alertArgs, _ := json.Marshal(SetAlertArgs{
+			StrategyID: strategyID,
+			Active:     true,
+			Threshold:  args.Threshold,
+			Universe:   universe,
+		})
+		if _, err := SetAlert(conn, userID, alertArgs); err != nil {
+			result.AlertError = err.Error()
+		} else {
+			result.AlertActive = true
+		}
+	}
+	return result, nil
+}
+
+func loadTemplate(ctx context.Context, conn *data.Conn, key string) (*storedTemplate, error) {
+	if key == "" {
+		return nil, apperr.Validation("templateKey is required")
+	}
+	var t storedTemplate
+	var params []byte
+	err := conn.DB.QueryRow(ctx, `
+		SELECT template_id, name, description, python_code, params, min_timeframe, min_bars_param, min_bars_offset
+		FROM strategy_templates WHERE key = $1 AND active`, key).
+		Scan(&t.id, &t.name, &t.description, &t.code, &params, &t.minTimeframe, &t.minBarsParam, &t.minBarsOffset)
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("template %q not found", key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading template %s: %v", key, err)
+	}
+	if err := json.Unmarshal(params, &t.params); err != nil {
+		return nil, fmt.Errorf("error parsing template %s params: %v", key, err)
+	}
+	return &t, nil
+}
+
+// resolveTemplateParams fills in defaults and checks the user's values
+func resolveTemplateParams(params []TemplateParam, given map[string]float64) (map[string]float64, error) {
+	known := make(map[string]bool, len(params))
+	values := make(map[string]float64, len(params))
+	for _, p := range params {
+		known[p.Key] = true
+		v, ok := given[p.Key]
+		if !ok {
+			v = p.Default
+		}
+		if math.IsNaN(v) || v < p.Min || v > p.Max {
+			return nil, apperr.Validation("%s must be between %g and %g", p.Label, p.Min, p.Max)
+		}
+		if p.Integer && v != math.Trunc(v) {
+			return nil, apperr.Validation("%s must be a whole number", p.Label)
+		}
+		values[p.Key] = v
+	}
+	for k := range given {
+		if !known[k] {
+			return nil, apperr.Validation("unknown parameter %q", k)
+		}
+	}
+	return values, nil
+}
+
+// templateUniverse resolves the tickers a template runs over; none means
+// every ticker
+func templateUniverse(ctx context.Context, conn *data.Conn, userID int, watchlistID *int, tickers []string) ([]string, error) {
+	if watchlistID != nil {
+		if _, err := workspaces.Authorize(ctx, conn, userID, workspaces.TypeWatchlist, *watchlistID, workspaces.RoleViewer); err != nil {
+			return nil, err
+		}
+		universe, err := queryTickers(ctx, conn, `
+			SELECT DISTINCT s.ticker
+			FROM watchlistItems wi
+			JOIN securities s ON s.securityId = wi.securityId
+			WHERE wi.watchlistId = $1 AND s.maxDate IS NULL
+			ORDER BY s.ticker`, *watchlistID)
+		if err != nil {
+			return nil, fmt.Errorf("error loading watchlist tickers: %v", err)
+		}
+		if len(universe) == 0 {
+			return nil, apperr.Validation("the watchlist has no active securities")
+		}
+		if len(universe) > maxTemplateUniverse {
+			return nil, apperr.Validation("a template universe can hold at most %d tickers", maxTemplateUniverse)
+		}
+		return universe, nil
+	}
+	if len(tickers) == 0 {
+		return nil, nil
+	}
+
+	seen := map[string]bool{}
+	var requested []string
+	for _, t := range tickers {
+		t = strings.ToUpper(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		if !tickerPattern.MatchString(t) {
+			return nil, apperr.Validation("invalid ticker %q", t)
+		}
+		seen[t] = true
+		requested = append(requested, t)
+	}
+	if len(requested) > maxTemplateUniverse {
+		return nil, apperr.Validation("a template universe can hold at most %d tickers", maxTemplateUniverse)
+	}
+	universe, err := queryTickers(ctx, conn, `
+		SELECT DISTINCT ticker FROM securities
+		WHERE ticker = ANY($1) AND maxDate IS NULL
+		ORDER BY ticker`, requested)
+	if err != nil {
+		return nil, fmt.Errorf("error checking tickers: %v", err)
+	}
+	if len(universe) < len(requested) {
+		found := make(map[string]bool, len(universe))
+		for _, t := range universe {
+			found[t] = true
+		}
+		var unknown []string
+		for _, t := range requested {
+			if !found[t] {
+				unknown = append(unknown, t)
+			}
+		}
+		return nil, apperr.Validation("unknown tickers: %s", strings.Join(unknown, ", "))
+	}
+	return universe, nil
+}
+
+func queryTickers(ctx context.Context, conn *data.Conn, query string, arg interface{}) ([]string, error) {
+	rows, err := conn.DB.Query(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tickers []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		tickers = append(tickers, t)
+	}
+	return tickers, rows.Err()
+}
+
+// renderTemplate fills the template's placeholders. min_bars is written as a
+// literal because the worker reads it from the code to size data windows.
+func renderTemplate(t *storedTemplate, values map[string]float64, universe []string) (string, error) {
+	filters := "{}"
+	if len(universe) > 0 {
+		// A JSON object of ASCII strings is also a valid Python dict literal
+		b, err := json.Marshal(map[string][]string{"tickers": universe})
+		if err != nil {
+			return "", fmt.Errorf("error encoding template universe: %v", err)
+		}
+		filters = string(b)
+	}
+	minBars := t.minBarsOffset
+	if t.minBarsParam != "" {
+		minBars += int(values[t.minBarsParam])
+	}
+	pairs := []string{"{{universe}}", filters, "{{min_bars}}", strconv.Itoa(minBars)}
+	for key, v := range values {
+		pairs = append(pairs, "{{"+key+"}}", strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	code := strings.NewReplacer(pairs...).Replace(t.code)
+	if strings.Contains(code, "{{") {
+		return "", fmt.Errorf("template %s has an unfilled placeholder", t.name)
+	}
+	return code, nil
+}
+
+// describeTemplateUse is stored as the strategy's prompt, so editing the
+// strategy later through the generator starts from what the template did
+func describeTemplateUse(t *storedTemplate, values map[string]float64, universe []string, watchlistID *int) string {
+	parts := make([]string, 0, len(t.params))
+	for _, p := range t.params {
+		parts = append(parts, fmt.Sprintf("%s %s", p.Label, strconv.FormatFloat(values[p.Key], 'f', -1, 64)))
+	}
+	scope := "all tickers"
+	switch {
+	case watchlistID != nil:
+		scope = fmt.Sprintf("the %d tickers of a watchlist", len(universe))
+	case len(universe) > 0:
+		scope = strings.Join(universe, ", ")
+	}
+	return fmt.Sprintf("%s: %s (%s), over %s", t.name, t.description, strings.Join(parts, ", "), scope)
+}
+
+// uniqueStrategyName returns base, or base with the first free " (n)" suffix
+// when the user already has a strategy by that name
+func uniqueStrategyName(ctx context.Context, conn *data.Conn, userID int, base string) (string, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT DISTINCT name FROM strategies
+		WHERE userId = $1 AND (name = $2 OR name LIKE $3)`,
+		userID, base, likeEscape(base)+" (%)")
+	if err != nil {
+		return "", fmt.Errorf("error checking strategy names: %v", err)
+	}
+	defer rows.Close()
+	taken := map[string]bool{}
+	for rows.Next() {
+		var n string
+		if err := rows.Scan(&n); err != nil {
+			return "", fmt.Errorf("error scanning strategy name: %v", err)
+		}
+		taken[n] = true
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("error checking strategy names: %v", err)
+	}
+	if !taken[base] {
+		return base, nil
+	}
+	for i := 2; ; i++ {
+		name := fmt.Sprintf("%s (%d)", base, i)
+		if !taken[name] {
+			return name, nil
+		}
+	}
+}
+
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
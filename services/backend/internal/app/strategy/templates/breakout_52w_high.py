@@ -0,0 +1,37 @@
+def strategy():
+    instances = []
+    lookback = {{lookback_days}}
+
+    df = get_bar_data(
+        timeframe="1d",
+        columns=["ticker", "timestamp", "high", "close", "volume"],
+        min_bars={{min_bars}},
+        filters={{universe}}
+    )
+    if df is None or len(df) == 0:
+        return instances
+    df = df.sort_values(['ticker', 'timestamp']).reset_index(drop=True)
+
+    # Prior highest high and average volume, excluding the current bar
+    grouped = df.groupby('ticker')
+    df['prior_high'] = grouped['high'].transform(lambda s: s.shift(1).rolling(lookback).max())
+    df['avg_volume'] = grouped['volume'].transform(lambda s: s.shift(1).rolling(20).mean())
+    df = df.dropna(subset=['prior_high', 'avg_volume'])
+    df = df[(df['prior_high'] > 0) & (df['avg_volume'] > 0)]
+
+    df['breakout_pct'] = (df['close'] / df['prior_high'] - 1) * 100
+    df['volume_ratio'] = df['volume'] / df['avg_volume']
+    hits = df[(df['close'] > df['prior_high']) & (df['volume_ratio'] >= {{volume_multiple}})]
+
+    for _, row in hits.iterrows():
+        instances.append({
+            'ticker': row['ticker'],
+            'timestamp': int(row['timestamp']),
+            'entry_price': float(row['close']),
+            'prior_high': round(float(row['prior_high']), 2),
+            'breakout_pct': round(float(row['breakout_pct']), 3),
+            'volume_ratio': round(float(row['volume_ratio']), 2),
+            'score': round(min(1.0, float(row['breakout_pct']) / 5 + float(row['volume_ratio']) / 10), 3)
+        })
+
+    return instances
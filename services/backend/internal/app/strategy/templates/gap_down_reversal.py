@@ -0,0 +1,34 @@
+def strategy():
+    instances = []
+
+    df = get_bar_data(
+        timeframe="1d",
+        columns=["ticker", "timestamp", "open", "close"],
+        min_bars={{min_bars}},
+        filters={{universe}}
+    )
+    if df is None or len(df) == 0:
+        return instances
+    df = df.sort_values(['ticker', 'timestamp']).reset_index(drop=True)
+
+    df['prev_close'] = df.groupby('ticker')['close'].shift(1)
+    df = df.dropna(subset=['prev_close'])
+    df = df[(df['prev_close'] > 0) & (df['open'] > 0)]
+
+    # Gapped down, then closed above the open
+    df['gap_percent'] = (df['open'] / df['prev_close'] - 1) * 100
+    df['recovery_pct'] = (df['close'] / df['open'] - 1) * 100
+    hits = df[(df['gap_percent'] <= -{{gap_pct}}) & (df['close'] > df['open'])]
+
+    for _, row in hits.iterrows():
+        instances.append({
+            'ticker': row['ticker'],
+            'timestamp': int(row['timestamp']),
+            'entry_price': float(row['close']),
+            'prev_close': round(float(row['prev_close']), 2),
+            'gap_percent': round(float(row['gap_percent']), 3),
+            'recovery_pct': round(float(row['recovery_pct']), 3),
+            'score': round(min(1.0, float(row['recovery_pct']) / abs(float(row['gap_percent']))), 3)
+        })
+
+    return instances
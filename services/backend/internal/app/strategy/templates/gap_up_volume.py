@@ -0,0 +1,35 @@
+def strategy():
+    instances = []
+
+    df = get_bar_data(
+        timeframe="1d",
+        columns=["ticker", "timestamp", "open", "close", "volume"],
+        min_bars={{min_bars}},
+        filters={{universe}}
+    )
+    if df is None or len(df) == 0:
+        return instances
+    df = df.sort_values(['ticker', 'timestamp']).reset_index(drop=True)
+
+    grouped = df.groupby('ticker')
+    df['prev_close'] = grouped['close'].shift(1)
+    df['avg_volume'] = grouped['volume'].transform(lambda s: s.shift(1).rolling(20).mean())
+    df = df.dropna(subset=['prev_close', 'avg_volume'])
+    df = df[(df['prev_close'] > 0) & (df['avg_volume'] > 0)]
+
+    df['gap_percent'] = (df['open'] / df['prev_close'] - 1) * 100
+    df['volume_ratio'] = df['volume'] / df['avg_volume']
+    hits = df[(df['gap_percent'] >= {{gap_pct}}) & (df['volume_ratio'] >= {{volume_multiple}})]
+
+    for _, row in hits.iterrows():
+        instances.append({
+            'ticker': row['ticker'],
+            'timestamp': int(row['timestamp']),
+            'entry_price': float(row['open']),
+            'prev_close': round(float(row['prev_close']), 2),
+            'gap_percent': round(float(row['gap_percent']), 3),
+            'volume_ratio': round(float(row['volume_ratio']), 2),
+            'score': round(min(1.0, float(row['gap_percent']) / 10), 3)
+        })
+
+    return instances
@@ -0,0 +1,39 @@
+def strategy():
+    instances = []
+    fast = {{fast_days}}
+    slow = {{slow_days}}
+
+    df = get_bar_data(
+        timeframe="1d",
+        columns=["ticker", "timestamp", "close"],
+        min_bars={{min_bars}},
+        filters={{universe}}
+    )
+    if df is None or len(df) == 0:
+        return instances
+    df = df.sort_values(['ticker', 'timestamp']).reset_index(drop=True)
+
+    grouped = df.groupby('ticker')
+    df['sma_fast'] = grouped['close'].transform(lambda s: s.rolling(fast).mean())
+    df['sma_slow'] = grouped['close'].transform(lambda s: s.rolling(slow).mean())
+    df['prev_fast'] = df.groupby('ticker')['sma_fast'].shift(1)
+    df['prev_slow'] = df.groupby('ticker')['sma_slow'].shift(1)
+    df = df.dropna(subset=['sma_fast', 'sma_slow', 'prev_fast', 'prev_slow'])
+    df = df[df['sma_slow'] > 0]
+
+    # Fast average crossed above the slow one
+    hits = df[(df['prev_fast'] <= df['prev_slow']) & (df['sma_fast'] > df['sma_slow'])]
+
+    for _, row in hits.iterrows():
+        spread_pct = (float(row['sma_fast']) / float(row['sma_slow']) - 1) * 100
+        instances.append({
+            'ticker': row['ticker'],
+            'timestamp': int(row['timestamp']),
+            'entry_price': float(row['close']),
+            'sma_fast': round(float(row['sma_fast']), 2),
+            'sma_slow': round(float(row['sma_slow']), 2),
+            'spread_pct': round(spread_pct, 3),
+            'score': round(min(1.0, 0.5 + spread_pct), 3)
+        })
+
+    return instances
@@ -0,0 +1,41 @@
+def strategy():
+    instances = []
+    period = {{rsi_period}}
+
+    df = get_bar_data(
+        timeframe="1d",
+        columns=["ticker", "timestamp", "close"],
+        min_bars={{min_bars}},
+        filters={{universe}}
+    )
+    if df is None or len(df) == 0:
+        return instances
+    df = df.sort_values(['ticker', 'timestamp']).reset_index(drop=True)
+
+    def calculate_rsi(prices):
+        delta = prices.diff()
+        gain = delta.where(delta > 0, 0).rolling(window=period).mean()
+        loss = (-delta.where(delta < 0, 0)).rolling(window=period).mean()
+        rs = gain / loss
+        return 100 - (100 / (1 + rs))
+
+    df['rsi'] = df.groupby('ticker')['close'].transform(calculate_rsi)
+    df['rsi'] = pd.to_numeric(df['rsi'], errors='coerce')
+    df['prev_rsi'] = df.groupby('ticker')['rsi'].shift(1)
+    df = df.dropna(subset=['rsi', 'prev_rsi'])
+
+    # Crossed back up through the oversold level
+    level = {{rsi_level}}
+    hits = df[(df['prev_rsi'] < level) & (df['rsi'] >= level)]
+
+    for _, row in hits.iterrows():
+        instances.append({
+            'ticker': row['ticker'],
+            'timestamp': int(row['timestamp']),
+            'entry_price': float(row['close']),
+            'rsi': round(float(row['rsi']), 2),
+            'prev_rsi': round(float(row['prev_rsi']), 2),
+            'score': round(min(1.0, max(0.0, (level - float(row['prev_rsi'])) / 20 + 0.5)), 3)
+        })
+
+    return instances
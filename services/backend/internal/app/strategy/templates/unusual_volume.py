@@ -0,0 +1,36 @@
+def strategy():
+    instances = []
+    period = {{avg_days}}
+
+    df = get_bar_data(
+        timeframe="1d",
+        columns=["ticker", "timestamp", "close", "volume"],
+        min_bars={{min_bars}},
+        filters={{universe}}
+    )
+    if df is None or len(df) == 0:
+        return instances
+    df = df.sort_values(['ticker', 'timestamp']).reset_index(drop=True)
+
+    grouped = df.groupby('ticker')
+    df['avg_volume'] = grouped['volume'].transform(lambda s: s.shift(1).rolling(period).mean())
+    df['prev_close'] = grouped['close'].shift(1)
+    df = df.dropna(subset=['avg_volume', 'prev_close'])
+    df = df[(df['avg_volume'] > 0) & (df['prev_close'] > 0)]
+
+    df['volume_ratio'] = df['volume'] / df['avg_volume']
+    df['change_1d_pct'] = (df['close'] / df['prev_close'] - 1) * 100
+    hits = df[df['volume_ratio'] >= {{volume_multiple}}]
+
+    for _, row in hits.iterrows():
+        instances.append({
+            'ticker': row['ticker'],
+            'timestamp': int(row['timestamp']),
+            'entry_price': float(row['close']),
+            'volume_ratio': round(float(row['volume_ratio']), 2),
+            'avg_volume': int(row['avg_volume']),
+            'change_1d_pct': round(float(row['change_1d_pct']), 3),
+            'score': round(min(1.0, (float(row['volume_ratio']) - 1.0) / 4.0), 3)
+        })
+
+    return instances
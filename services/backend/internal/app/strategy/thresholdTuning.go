@@ -0,0 +1,270 @@
+package strategy
+
+import (
+	"backend/internal/app/workspaces"
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// DefaultTargetPrecision is the share of triggers that should be followed by a
+	// positive return over the horizon
+	DefaultTargetPrecision = 0.6
+	// DefaultThresholdHorizonDays is the forward return horizon in calendar days
+	DefaultThresholdHorizonDays = 5
+	// minThresholdSamples is the fewest triggers a suggested cutoff may keep
+	minThresholdSamples = 10
+	thresholdLookback   = 180 * 24 * time.Hour
+)
+
+// ThresholdStats are the supporting statistics of a threshold suggestion
+type ThresholdStats struct {
+	BaselinePrecision   float64  `json:"baselinePrecision"`
+	BaselineMeanReturn  float64  `json:"baselineMeanReturn"`
+	CurrentPrecision    *float64 `json:"currentPrecision,omitempty"`
+	CurrentTriggers     int      `json:"currentTriggers"`
+	SuggestedPrecision  *float64 `json:"suggestedPrecision,omitempty"`
+	SuggestedMeanReturn *float64 `json:"suggestedMeanReturn,omitempty"`
+	SuggestedTriggers   int      `json:"suggestedTriggers"`
+	ScoredTriggers      int      `json:"scoredTriggers"`
+	Reason              string   `json:"reason,omitempty"`
+}
+
+// ThresholdSuggestion is a suggested alert score cutoff for a strategy
+type ThresholdSuggestion struct {
+	StrategyID         int            `json:"strategyId"`
+	CurrentThreshold   *float64       `json:"currentThreshold"`
+	SuggestedThreshold *float64       `json:"suggestedThreshold"`
+	TargetPrecision    float64        `json:"targetPrecision"`
+	HorizonDays        int            `json:"horizonDays"`
+	SampleSize         int            `json:"sampleSize"`
+	Stats              ThresholdStats `json:"stats"`
+	ComputedAt         time.Time      `json:"computedAt"`
+}
+
+type thresholdSample struct {
+	score float64
+	ret   float64
+}
+
+// suggestThreshold returns the lowest score cutoff whose kept triggers reach the
+// target precision, keeping as many alerts as possible. It returns nil when no
+// cutoff keeps enough triggers at that precision.
+func suggestThreshold(samples []thresholdSample, current *float64, target float64) (*float64, ThresholdStats) {
+	stats := ThresholdStats{ScoredTriggers: len(samples)}
+	if len(samples) == 0 {
+		stats.Reason = "no scored triggers with a completed return horizon"
+		return nil, stats
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i].score > samples[j].score })
+
+	var wins int
+	var sumRet float64
+	var currentWins, currentKept int
+	var best *float64
+	var bestWins int
+	var bestSum float64
+	bestKept := 0
+	for i, s := range samples {
+		if s.ret > 0 {
+			wins++
+		}
+		sumRet += s.ret
+		if current != nil && s.score >= *current {
+			currentKept++
+			if s.ret > 0 {
+				currentWins++
+			}
+		}
+		kept := i + 1
+		// Only evaluate a cutoff at the last sample of a run of equal scores
+		if i+1 < len(samples) && samples[i+1].score == s.score {
+			continue
+		}
+		if kept >= minThresholdSamples && float64(wins)/float64(kept) >= target {
+			cutoff := s.score
+			best, bestWins, bestSum, bestKept = &cutoff, wins, sumRet, kept
+		}
+	}
+
+	stats.BaselinePrecision = float64(wins) / float64(len(samples))
+	stats.BaselineMeanReturn = sumRet / float64(len(samples))
+	stats.CurrentTriggers = currentKept
+	if currentKept > 0 {
+		p := float64(currentWins) / float64(currentKept)
+		stats.CurrentPrecision = &p
+	}
+	if best == nil {
+		stats.Reason = fmt.Sprintf("no cutoff keeps at least %d triggers at %.0f%% precision", minThresholdSamples, target*100)
+		return nil, stats
+	}
+	p := float64(bestWins) / float64(bestKept)
+	m := bestSum / float64(bestKept)
+	stats.SuggestedPrecision = &p
+	stats.SuggestedMeanReturn = &m
+	stats.SuggestedTriggers = bestKept
+	return best, stats
+}
+
+// loadThresholdSamples pairs each scored trigger of a strategy alert with the
+// close-to-close return over the horizon that followed it
+func loadThresholdSamples(ctx context.Context, conn *data.Conn, strategyID int, horizonDays int) ([]thresholdSample, error) {
+	rows, err := conn.DB.Query(ctx, `
+		WITH triggers AS (
+			SELECT al.timestamp AS triggered_at,
+			       COALESCE(inst->>'ticker', inst->>'symbol') AS ticker,
+			       (inst->>'score')::double precision AS score
+			FROM alert_logs al
+			CROSS JOIN LATERAL jsonb_array_elements(
+				CASE WHEN jsonb_typeof(al.payload->'instances') = 'array'
+				     THEN al.payload->'instances' ELSE '[]'::jsonb END) inst
+			WHERE al.alert_type = 'strategy'
+			  AND al.related_id = $1
+			  AND al.timestamp >= $2
+			  AND al.timestamp <= NOW() - make_interval(days => $3)
+			  AND jsonb_typeof(inst->'score') = 'number'
+		)
+		SELECT t.score, (exit_bar.close - entry_bar.close)::double precision / entry_bar.close
+		FROM triggers t
+		JOIN LATERAL (
+			SELECT close FROM ohlcv_1d
+			WHERE ticker = t.ticker AND timestamp >= date_trunc('day', t.triggered_at)
+			ORDER BY timestamp LIMIT 1
+		) entry_bar ON entry_bar.close > 0
+		JOIN LATERAL (
+			SELECT close FROM ohlcv_1d
+			WHERE ticker = t.ticker AND timestamp >= date_trunc('day', t.triggered_at) + make_interval(days => $3)
+			ORDER BY timestamp LIMIT 1
+		) exit_bar ON true`,
+		strategyID, time.Now().Add(-thresholdLookback), horizonDays)
+	if err != nil {
+		return nil, fmt.Errorf("error loading trigger history: %v", err)
+	}
+	defer rows.Close()
+
+	var samples []thresholdSample
+	for rows.Next() {
+		var s thresholdSample
+		if err := rows.Scan(&s.score, &s.ret); err != nil {
+			return nil, fmt.Errorf("error scanning trigger sample: %v", err)
+		}
+		samples = append(samples, s)
+	}
+	return samples, rows.Err()
+}
+
+// AnalyzeAlertThreshold reviews a strategy alert's trigger history against the
+// returns that followed and stores a threshold suggestion for the target precision.
+func AnalyzeAlertThreshold(ctx context.Context, conn *data.Conn, userID int, strategyID int, targetPrecision float64, horizonDays int) (*ThresholdSuggestion, error) {
+	ownerID, err := workspaces.Authorize(ctx, conn, userID, workspaces.TypeStrategy, strategyID, workspaces.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	var current *float64
+	err = conn.DB.QueryRow(ctx, `
+		SELECT alert_threshold FROM strategies WHERE strategyid = $1 AND userid = $2`,
+		strategyID, ownerID).Scan(&current)
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("strategy not found or access denied")
+	} else if err != nil {
+		return nil, fmt.Errorf("error checking strategy: %v", err)
+	}
+
+	samples, err := loadThresholdSamples(ctx, conn, strategyID, horizonDays)
+	if err != nil {
+		return nil, err
+	}
+	suggested, stats := suggestThreshold(samples, current, targetPrecision)
+
+	suggestion := &ThresholdSuggestion{
+		StrategyID:         strategyID,
+		CurrentThreshold:   current,
+		SuggestedThreshold: suggested,
+		TargetPrecision:    targetPrecision,
+		HorizonDays:        horizonDays,
+		SampleSize:         len(samples),
+		Stats:              stats,
+		ComputedAt:         time.Now(),
+	}
+	statsJSON, err := json.Marshal(stats)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling threshold stats: %v", err)
+	}
+	_, err = conn.DB.Exec(ctx, `
+		INSERT INTO strategy_threshold_suggestions
+			(strategy_id, user_id, current_threshold, suggested_threshold, target_precision, horizon_days, sample_size, stats, computed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (strategy_id) DO UPDATE SET
+			current_threshold = EXCLUDED.current_threshold,
+			suggested_threshold = EXCLUDED.suggested_threshold,
+			target_precision = EXCLUDED.target_precision,
+			horizon_days = EXCLUDED.horizon_days,
+			sample_size = EXCLUDED.sample_size,
+			stats = EXCLUDED.stats,
+			computed_at = EXCLUDED.computed_at`,
+		strategyID, userID, current, suggested, targetPrecision, horizonDays, len(samples), statsJSON, suggestion.ComputedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error storing threshold suggestion: %v", err)
+	}
+	return suggestion, nil
+}
+
+// GetAlertThresholdSuggestionArgs represents arguments for GetAlertThresholdSuggestion
+type GetAlertThresholdSuggestionArgs struct {
+	StrategyID int `json:"strategyId"`
+	// TargetPrecision and HorizonDays trigger a fresh analysis when they differ
+	// from the stored suggestion
+	TargetPrecision float64 `json:"targetPrecision,omitempty"`
+	HorizonDays     int     `json:"horizonDays,omitempty"`
+}
+
+// GetAlertThresholdSuggestion returns the stored threshold suggestion for a
+// strategy alert, recomputing it when missing or when other targets are requested.
+func GetAlertThresholdSuggestion(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetAlertThresholdSuggestionArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.TargetPrecision == 0 {
+		args.TargetPrecision = DefaultTargetPrecision
+	}
+	if args.TargetPrecision <= 0 || args.TargetPrecision >= 1 {
+		return nil, apperr.Validation("targetPrecision must be between 0 and 1")
+	}
+	if args.HorizonDays == 0 {
+		args.HorizonDays = DefaultThresholdHorizonDays
+	}
+	if args.HorizonDays < 1 || args.HorizonDays > 90 {
+		return nil, apperr.Validation("horizonDays must be between 1 and 90")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var s ThresholdSuggestion
+	var statsJSON []byte
+	err := conn.DB.QueryRow(ctx, `
+		SELECT strategy_id, current_threshold, suggested_threshold, target_precision, horizon_days, sample_size, stats, computed_at
+		FROM strategy_threshold_suggestions
+		WHERE strategy_id = $1 AND user_id = $2`,
+		args.StrategyID, userID).Scan(&s.StrategyID, &s.CurrentThreshold, &s.SuggestedThreshold,
+		&s.TargetPrecision, &s.HorizonDays, &s.SampleSize, &statsJSON, &s.ComputedAt)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, fmt.Errorf("error loading threshold suggestion: %v", err)
+	}
+	if err == nil && s.TargetPrecision == args.TargetPrecision && s.HorizonDays == args.HorizonDays {
+		if err := json.Unmarshal(statsJSON, &s.Stats); err != nil {
+			return nil, fmt.Errorf("error decoding threshold stats: %v", err)
+		}
+		return s, nil
+	}
+	return AnalyzeAlertThreshold(ctx, conn, userID, args.StrategyID, args.TargetPrecision, args.HorizonDays)
+}
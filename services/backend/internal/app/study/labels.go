@@ -0,0 +1,182 @@
+// Package study holds the labels users put on study instances ("good
+// setup", "failed breakout"), the labeled datasets exported from them, and
+// the similarity ranking that uses them as examples.
+package study
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const maxStudyLabelLength = 64
+
+// LabelStudiesArgs represents a structure for handling LabelStudiesArgs data.
+type LabelStudiesArgs struct {
+	StudyIDs []int  `json:"studyIds"`
+	Label    string `json:"label"`
+}
+
+// normalizeStudyLabel trims a label and checks its length.
+func normalizeStudyLabel(label string) (string, error) {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return "", apperr.Validation("label is required")
+	}
+	if len(label) > maxStudyLabelLength {
+		return "", apperr.Validation("label must be at most %d characters", maxStudyLabelLength)
+	}
+	return label, nil
+}
+
+// LabelStudies applies a label to a batch of the user's studies.
+func LabelStudies(conn *data.Conn, userId int, rawArgs json.RawMessage) (interface{}, error) {
+	var args LabelStudiesArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	label, err := normalizeStudyLabel(args.Label)
+	if err != nil {
+		return nil, err
+	}
+	if len(args.StudyIDs) == 0 {
+		return nil, apperr.Validation("studyIds is required")
+	}
+	// Only studies owned by the user are labeled; others are silently skipped
+	cmdTag, err := conn.DB.Exec(context.Background(), `
+		INSERT INTO study_labels (user_id, study_id, label)
+		SELECT $1, s.studyId, $3
+		FROM studies s
+		WHERE s.userId = $1 AND s.studyId = ANY($2)
+		ON CONFLICT (study_id, label) DO NOTHING`, userId, args.StudyIDs, label)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"labeled": cmdTag.RowsAffected()}, nil
+}
+
+// UnlabelStudies removes a label from a batch of the user's studies.
+func UnlabelStudies(conn *data.Conn, userId int, rawArgs json.RawMessage) (interface{}, error) {
+	var args LabelStudiesArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	label, err := normalizeStudyLabel(args.Label)
+	if err != nil {
+		return nil, err
+	}
+	cmdTag, err := conn.DB.Exec(context.Background(),
+		"DELETE FROM study_labels WHERE user_id = $1 AND study_id = ANY($2) AND label = $3",
+		userId, args.StudyIDs, label)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"unlabeled": cmdTag.RowsAffected()}, nil
+}
+
+// StudyLabelCount represents a structure for handling StudyLabelCount data.
+type StudyLabelCount struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// GetStudyLabels lists the user's labels with the number of studies carrying each.
+func GetStudyLabels(conn *data.Conn, userId int, _ json.RawMessage) (interface{}, error) {
+	rows, err := conn.DB.Query(context.Background(), `
+		SELECT label, COUNT(*) FROM study_labels
+		WHERE user_id = $1
+		GROUP BY label
+		ORDER BY label`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	labels := []StudyLabelCount{}
+	for rows.Next() {
+		var l StudyLabelCount
+		if err := rows.Scan(&l.Label, &l.Count); err != nil {
+			return nil, err
+		}
+		labels = append(labels, l)
+	}
+	return labels, rows.Err()
+}
+
+// ExportLabeledStudiesArgs represents a structure for handling ExportLabeledStudiesArgs data.
+type ExportLabeledStudiesArgs struct {
+	Labels []string `json:"labels"` // empty exports every label
+}
+
+// LabeledStudy is one labeled instance reference in an exported dataset.
+type LabeledStudy struct {
+	StudyID    int      `json:"studyId"`
+	SecurityID int      `json:"securityId"`
+	Ticker     string   `json:"ticker"`
+	Timestamp  int64    `json:"timestamp"`
+	StrategyID *int64   `json:"strategyId"`
+	Labels     []string `json:"labels"`
+}
+
+// ExportLabeledStudies returns the user's labeled instances, the dataset consumed
+// by the similarity engine and by strategy generation as examples.
+func ExportLabeledStudies(conn *data.Conn, userId int, rawArgs json.RawMessage) (interface{}, error) {
+	var args ExportLabeledStudiesArgs
+	if len(rawArgs) > 0 {
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			return nil, apperr.InvalidArgs(err)
+		}
+	}
+	if args.Labels == nil {
+		args.Labels = []string{}
+	}
+
+	return labeledStudies(context.Background(), conn, userId, args.Labels, 0)
+}
+
+// labeledStudies loads the user's labeled instances, those with any of labels
+// (all when empty), oldest first; limit > 0 keeps the most recent ones
+func labeledStudies(ctx context.Context, conn *data.Conn, userId int, labels []string, limit int) ([]LabeledStudy, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT * FROM (
+			SELECT s.studyId, s.securityId, s.strategyId, sec.ticker, s.timestamp,
+			       ARRAY_AGG(l.label ORDER BY l.label)
+			FROM study_labels l
+			JOIN studies s ON s.studyId = l.study_id
+			JOIN LATERAL (
+				SELECT ticker FROM securities
+				WHERE securityId = s.securityId
+				ORDER BY maxDate IS NULL DESC, maxDate DESC
+				LIMIT 1
+			) sec ON true
+			WHERE l.user_id = $1 AND (cardinality($2::text[]) = 0 OR l.label = ANY($2))
+			GROUP BY s.studyId, s.securityId, s.strategyId, sec.ticker, s.timestamp
+			ORDER BY s.timestamp DESC
+			LIMIT NULLIF($3, 0)
+		) recent
+		ORDER BY timestamp`, userId, labels, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dataset := []LabeledStudy{}
+	for rows.Next() {
+		var study LabeledStudy
+		var strategyID sql.NullInt64
+		var studyTime time.Time
+		if err := rows.Scan(&study.StudyID, &study.SecurityID, &strategyID, &study.Ticker, &studyTime, &study.Labels); err != nil {
+			return nil, err
+		}
+		if strategyID.Valid {
+			study.StrategyID = &strategyID.Int64
+		}
+		study.Timestamp = studyTime.Unix()
+		dataset = append(dataset, study)
+	}
+	return dataset, rows.Err()
+}
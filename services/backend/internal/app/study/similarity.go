@@ -0,0 +1,232 @@
+package study
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/services/chartimage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Instances are compared by the shape of the daily bars leading up to them:
+// the standardized log returns of the last similarityBars closes, plus how
+// unusual the last bar's volume was. The user's labeled instances are the
+// examples; the nearest ones are returned with their labels, and each label
+// is scored by how close the instances carrying it are, so an unlabeled
+// instance can be read as "looks like your good setups".
+const (
+	similarityBars        = 20
+	similarityMaxExamples = 200
+	similarityDefaultN    = 10
+	similarityMaxN        = 50
+	// volumeWeight scales the volume feature against the return path
+	volumeWeight = 2.0
+)
+
+// GetSimilarInstancesArgs is the instance to rank the labeled examples against
+type GetSimilarInstancesArgs struct {
+	SecurityID int   `json:"securityId"`
+	Timestamp  int64 `json:"timestamp"` // unix ms
+	// Labels restricts the examples to instances with any of these labels
+	Labels []string `json:"labels,omitempty"`
+	Limit  int      `json:"limit,omitempty"`
+}
+
+// SimilarInstance is a labeled example and how close it is to the instance
+type SimilarInstance struct {
+	LabeledStudy
+	Distance   float64 `json:"distance"`
+	Similarity float64 `json:"similarity"` // 1 / (1 + distance)
+}
+
+// LabelScore is a label's share of the similarity of the nearest examples
+type LabelScore struct {
+	Label   string  `json:"label"`
+	Score   float64 `json:"score"`
+	Matches int     `json:"matches"`
+}
+
+// SimilarInstancesResult ranks the labeled examples nearest an instance
+type SimilarInstancesResult struct {
+	Matches     []SimilarInstance `json:"matches"`
+	LabelScores []LabelScore      `json:"labelScores"`
+	// Compared is how many labeled examples had bars to compare
+	Compared int `json:"compared"`
+}
+
+// GetSimilarInstances ranks the user's labeled instances by how similar the
+// bars leading up to them are to those leading up to an instance
+func GetSimilarInstances(ctx context.Context, conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetSimilarInstancesArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.SecurityID <= 0 || args.Timestamp <= 0 {
+		return nil, apperr.Validation("securityId and timestamp are required")
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = similarityDefaultN
+	}
+	if limit > similarityMaxN {
+		limit = similarityMaxN
+	}
+
+	ticker, err := securityTicker(ctx, conn, args.SecurityID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := instanceFeatures(ctx, conn, ticker, time.UnixMilli(args.Timestamp))
+	if err != nil {
+		return nil, apperr.Validation("no bars to compare for %s at that time", ticker)
+	}
+
+	examples, err := labeledStudies(ctx, conn, userID, args.Labels, similarityMaxExamples)
+	if err != nil {
+		return nil, fmt.Errorf("error loading labeled instances: %v", err)
+	}
+	matches := make([]SimilarInstance, 0, len(examples))
+	for _, example := range examples {
+		if example.SecurityID == args.SecurityID && example.Timestamp == args.Timestamp/1000 {
+			continue // the instance itself
+		}
+		features, err := instanceFeatures(ctx, conn, example.Ticker, time.Unix(example.Timestamp, 0))
+		if err != nil {
+			log.Printf("⚠️ Study %d: skipped in similarity ranking: %v", example.StudyID, err)
+			continue
+		}
+		distance := featureDistance(target, features)
+		matches = append(matches, SimilarInstance{
+			LabeledStudy: example,
+			Distance:     math.Round(distance*10000) / 10000,
+			Similarity:   math.Round(1/(1+distance)*10000) / 10000,
+		})
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Distance < matches[j].Distance })
+
+	result := SimilarInstancesResult{Compared: len(matches), LabelScores: []LabelScore{}}
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	result.Matches = matches
+	result.LabelScores = scoreLabels(matches)
+	return result, nil
+}
+
+func securityTicker(ctx context.Context, conn *data.Conn, securityID int) (string, error) {
+	var ticker string
+	err := conn.DB.QueryRow(ctx, `
+		SELECT ticker FROM securities
+		WHERE securityId = $1
+		ORDER BY maxDate IS NULL DESC, maxDate DESC
+		LIMIT 1`, securityID).Scan(&ticker)
+	if err == pgx.ErrNoRows {
+		return "", apperr.NotFound("security %d not found", securityID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error loading security %d: %v", securityID, err)
+	}
+	return ticker, nil
+}
+
+// instanceFeatures is the standardized return path of the bars up to at,
+// followed by the weighted log ratio of the last bar's volume to the mean
+func instanceFeatures(ctx context.Context, conn *data.Conn, ticker string, at time.Time) ([]float64, error) {
+	bars, err := chartimage.LoadBars(ctx, conn, ticker, "1d", at, similarityBars)
+	if err != nil {
+		return nil, err
+	}
+	if len(bars) < similarityBars {
+		return nil, fmt.Errorf("only %d of %d bars for %s", len(bars), similarityBars, ticker)
+	}
+	returns := make([]float64, 0, len(bars)-1)
+	for i := 1; i < len(bars); i++ {
+		if bars[i-1].Close <= 0 || bars[i].Close <= 0 {
+			return nil, fmt.Errorf("non-positive close for %s", ticker)
+		}
+		returns = append(returns, math.Log(bars[i].Close/bars[i-1].Close))
+	}
+	mean, std := meanStd(returns)
+	features := make([]float64, 0, len(returns)+1)
+	for _, r := range returns {
+		if std == 0 {
+			features = append(features, 0)
+			continue
+		}
+		features = append(features, (r-mean)/std)
+	}
+
+	volumeMean := 0.0
+	for _, b := range bars[:len(bars)-1] {
+		volumeMean += b.Volume
+	}
+	volumeMean /= float64(len(bars) - 1)
+	volumeRatio := 0.0
+	if last := bars[len(bars)-1].Volume; volumeMean > 0 && last > 0 {
+		volumeRatio = math.Log(last / volumeMean)
+	}
+	return append(features, volumeWeight*volumeRatio), nil
+}
+
+func meanStd(values []float64) (float64, float64) {
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
+
+// featureDistance is the root mean squared difference of two feature vectors
+func featureDistance(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return math.Sqrt(sum / float64(len(a)))
+}
+
+// scoreLabels shares the matches' similarity out among their labels,
+// highest share first
+func scoreLabels(matches []SimilarInstance) []LabelScore {
+	total := 0.0
+	byLabel := map[string]*LabelScore{}
+	for _, m := range matches {
+		total += m.Similarity
+		for _, label := range m.Labels {
+			s, ok := byLabel[label]
+			if !ok {
+				s = &LabelScore{Label: label}
+				byLabel[label] = s
+			}
+			s.Score += m.Similarity
+			s.Matches++
+		}
+	}
+	scores := make([]LabelScore, 0, len(byLabel))
+	for _, s := range byLabel {
+		if total > 0 {
+			s.Score = math.Round(s.Score/total*1000) / 1000
+		}
+		scores = append(scores, *s)
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].Label < scores[j].Label
+	})
+	return scores
+}
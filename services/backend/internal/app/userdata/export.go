@@ -0,0 +1,283 @@
+// Package userdata handles a user's data as a whole: exporting everything we
+// store about them as a downloadable archive, and purging it when they delete
+// their account.
+package userdata
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/queue"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// DownloadPath serves a ready archive given a signed token
+	DownloadPath = "/export/download"
+
+	downloadLinkTTL   = 15 * time.Minute
+	exportTaskTimeout = 15 * time.Minute
+	maxExportsPerDay  = 3
+	// Exports still pending or running after this were lost with a backend
+	// restart; they no longer block a new request and the cleanup job fails them
+	staleExportAge = time.Hour
+)
+
+// DataExport describes an export request to its owner
+type DataExport struct {
+	ExportID     int            `json:"exportId"`
+	Status       string         `json:"status"` // pending | running | ready | failed | expired
+	Error        string         `json:"error,omitempty"`
+	SizeBytes    int            `json:"sizeBytes,omitempty"`
+	Files        map[string]int `json:"files,omitempty"` // rows per file in the archive
+	CreatedAt    int64          `json:"createdAt"`       // ms since epoch
+	CompletedAt  *int64         `json:"completedAt,omitempty"`
+	ExpiresAt    *int64         `json:"expiresAt,omitempty"`
+	DownloadPath string         `json:"downloadPath,omitempty"` // signed, short-lived; only when ready
+}
+
+// RequestDataExport queues an archive of all of the user's data. The worker
+// builds it in the background; poll GetDataExports for its status.
+func RequestDataExport(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var inProgress, recent int
+	err := conn.DB.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE status IN ('pending', 'running') AND created_at > $2),
+		       COUNT(*) FILTER (WHERE created_at > NOW() - INTERVAL '1 day')
+		FROM user_exports WHERE user_id = $1`, userID, time.Now().Add(-staleExportAge)).Scan(&inProgress, &recent)
+	if err != nil {
+		return nil, fmt.Errorf("error checking data exports: %v", err)
+	}
+	if inProgress > 0 {
+		return nil, apperr.Validation("an export is already in progress")
+	}
+	if recent >= maxExportsPerDay {
+		return nil, apperr.LimitExceeded("you can request up to %d exports per day", maxExportsPerDay)
+	}
+
+	export := DataExport{Status: "pending"}
+	var createdAt time.Time
+	err = conn.DB.QueryRow(ctx, `
+		INSERT INTO user_exports (user_id) VALUES ($1)
+		RETURNING export_id, created_at`, userID).Scan(&export.ExportID, &createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("error creating data export: %v", err)
+	}
+	export.CreatedAt = createdAt.UnixMilli()
+
+	go runExport(conn, userID, export.ExportID)
+	return export, nil
+}
+
+// runExport waits on the worker so the task keeps a subscriber, and records a
+// failure the worker could not record itself (e.g. it never picked the task up)
+func runExport(conn *data.Conn, userID, exportID int) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTaskTimeout)
+	defer cancel()
+
+	result, err := queue.ExportUserDataTyped(ctx, conn, map[string]interface{}{
+		"user_id":   userID,
+		"export_id": exportID,
+	})
+	if err == nil && result.Success {
+		log.Printf("📦 Data export %d for user %d ready (%d bytes)", exportID, userID, result.SizeBytes)
+		return
+	}
+	if err == nil {
+		err = fmt.Errorf("%s", result.ErrorMessage)
+	}
+	log.Printf("❌ Data export %d for user %d failed: %v", exportID, userID, err)
+	markExportFailed(conn, exportID, err)
+}
+
+func markExportFailed(conn *data.Conn, exportID int, cause error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := conn.DB.Exec(ctx, `
+		UPDATE user_exports SET status = 'failed', error = $2, completed_at = NOW()
+		WHERE export_id = $1 AND status IN ('pending', 'running')`,
+		exportID, apperr.Message(cause))
+	if err != nil {
+		log.Printf("Error marking data export %d failed: %v", exportID, err)
+	}
+}
+
+// GetDataExports lists the user's exports, newest first, with a fresh download
+// link on each ready one
+func GetDataExports(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := conn.DB.Query(ctx, `
+		SELECT export_id, status, COALESCE(error, ''), COALESCE(size_bytes, 0), file_counts,
+		       created_at, completed_at, expires_at
+		FROM user_exports
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT 20`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying data exports: %v", err)
+	}
+	defer rows.Close()
+
+	exports := []DataExport{}
+	for rows.Next() {
+		var e DataExport
+		var files []byte
+		var createdAt time.Time
+		var completedAt, expiresAt *time.Time
+		if err := rows.Scan(&e.ExportID, &e.Status, &e.Error, &e.SizeBytes, &files,
+			&createdAt, &completedAt, &expiresAt); err != nil {
+			return nil, fmt.Errorf("error scanning data export: %v", err)
+		}
+		if len(files) > 0 {
+			if err := json.Unmarshal(files, &e.Files); err != nil {
+				return nil, fmt.Errorf("error parsing data export files: %v", err)
+			}
+		}
+		e.CreatedAt = createdAt.UnixMilli()
+		if completedAt != nil {
+			ms := completedAt.UnixMilli()
+			e.CompletedAt = &ms
+		}
+		if expiresAt != nil {
+			ms := expiresAt.UnixMilli()
+			e.ExpiresAt = &ms
+		}
+		if e.Status == "ready" && expiresAt != nil && time.Now().After(*expiresAt) {
+			e.Status = "expired" // the cleanup job has not dropped the archive yet
+		}
+		if e.Status == "ready" {
+			token, err := signDownloadToken(e.ExportID, time.Now().Add(downloadLinkTTL))
+			if err != nil {
+				return nil, err
+			}
+			e.DownloadPath = DownloadPath + "?token=" + url.QueryEscape(token)
+		}
+		exports = append(exports, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating data exports: %v", err)
+	}
+	return exports, nil
+}
+
+// LoadExportArchive returns the archive a download token points at, and the
+// file name to serve it under
+func LoadExportArchive(ctx context.Context, conn *data.Conn, token string) ([]byte, string, error) {
+	exportID, err := verifyDownloadToken(token)
+	if err != nil {
+		return nil, "", err
+	}
+	var archive []byte
+	var createdAt time.Time
+	err = conn.DB.QueryRow(ctx, `
+		SELECT archive, created_at FROM user_exports
+		WHERE export_id = $1 AND status = 'ready' AND archive IS NOT NULL AND expires_at > NOW()`,
+		exportID).Scan(&archive, &createdAt)
+	if err == pgx.ErrNoRows {
+		return nil, "", apperr.NotFound("this export has expired")
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error loading data export %d: %v", exportID, err)
+	}
+	return archive, fmt.Sprintf("peripheral-export-%s.zip", createdAt.UTC().Format("2006-01-02")), nil
+}
+
+// ExpireDataExports drops archives past their expiry and fails exports that
+// never finished
+func ExpireDataExports(conn *data.Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	expired, err := conn.DB.Exec(ctx, `
+		UPDATE user_exports SET status = 'expired', archive = NULL
+		WHERE archive IS NOT NULL AND expires_at <= NOW()`)
+	if err != nil {
+		return fmt.Errorf("error expiring data exports: %v", err)
+	}
+	stale, err := conn.DB.Exec(ctx, `
+		UPDATE user_exports SET status = 'failed', error = 'export did not finish', completed_at = NOW()
+		WHERE status IN ('pending', 'running') AND created_at < $1`,
+		time.Now().Add(-staleExportAge))
+	if err != nil {
+		return fmt.Errorf("error failing stale data exports: %v", err)
+	}
+	if expired.RowsAffected() > 0 || stale.RowsAffected() > 0 {
+		log.Printf("📦 Expired %d data export archives, failed %d stale exports",
+			expired.RowsAffected(), stale.RowsAffected())
+	}
+	return nil
+}
+
+// downloadSecret signs download tokens; EXPORT_LINK_SECRET falls back to JWT_SECRET
+func downloadSecret() ([]byte, error) {
+	secret := os.Getenv("EXPORT_LINK_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("data export downloads are not configured")
+	}
+	return []byte(secret), nil
+}
+
+// downloadMAC is domain-separated so tokens signed with the same secret for
+// other purposes are never valid here
+func downloadMAC(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("export:" + payload))
+	return mac.Sum(nil)
+}
+
+// signDownloadToken returns "<exportID>.<expiryUnix>.<signature>"
+func signDownloadToken(exportID int, expiresAt time.Time) (string, error) {
+	secret, err := downloadSecret()
+	if err != nil {
+		return "", err
+	}
+	payload := fmt.Sprintf("%d.%d", exportID, expiresAt.Unix())
+	return payload + "." + base64.RawURLEncoding.EncodeToString(downloadMAC(secret, payload)), nil
+}
+
+// verifyDownloadToken checks the signature and expiry and returns the export ID
+func verifyDownloadToken(token string) (int, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, apperr.Validation("invalid download link")
+	}
+	secret, err := downloadSecret()
+	if err != nil {
+		return 0, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, downloadMAC(secret, parts[0]+"."+parts[1])) {
+		return 0, apperr.Validation("invalid download link")
+	}
+	exportID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, apperr.Validation("invalid download link")
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, apperr.Validation("invalid download link")
+	}
+	if time.Now().Unix() > expiry {
+		return 0, apperr.NotFound("this download link has expired; request a new one from settings")
+	}
+	return exportID, nil
+}
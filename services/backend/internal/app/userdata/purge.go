@@ -0,0 +1,173 @@
+package userdata
+
+import (
+	"backend/internal/data"
+	"backend/internal/services/alerts"
+	"backend/internal/services/sessions"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// purgeStatements delete everything keyed to a user, children before the
+// tables they reference. Several of these cascade from users already; deleting
+// them explicitly keeps the purge complete where a foreign key was never added
+// or is ON DELETE SET NULL. Keep in sync with EXPORT_QUERIES in the worker.
+var purgeStatements = []string{
+	`DELETE FROM entity_dependencies WHERE user_id = $1`,
+	`DELETE FROM alert_escalation_policies WHERE user_id = $1`,
+	`DELETE FROM alert_feedback WHERE user_id = $1`,
+	`DELETE FROM notification_outbox WHERE user_id = $1`,
+	`DELETE FROM notification_rate_limits WHERE user_id = $1`,
+	`DELETE FROM alert_logs WHERE user_id = $1`,
+	`DELETE FROM alerts WHERE userId = $1`,
+	`DELETE FROM strategy_share_links WHERE user_id = $1`,
+	`DELETE FROM strategy_threshold_suggestions WHERE user_id = $1`,
+	`DELETE FROM conversation_messages WHERE conversation_id IN
+		(SELECT conversation_id FROM conversations WHERE userId = $1)`,
+	`DELETE FROM conversations WHERE userId = $1`,
+	`DELETE FROM agent_traces WHERE user_id = $1`,
+	`DELETE FROM agent_experiment_outcomes WHERE user_id = $1`,
+	`DELETE FROM python_agent_execs WHERE userid = $1`,
+	`DELETE FROM python_executions WHERE user_id = $1`,
+	`DELETE FROM python_strategies WHERE user_id = $1`,
+	`DELETE FROM chart_queries WHERE userId = $1`,
+	`DELETE FROM chart_images WHERE user_id = $1`,
+	`DELETE FROM chart_drawings WHERE user_id = $1`,
+	`DELETE FROM query_logs WHERE userId = $1`,
+	`DELETE FROM usage_logs WHERE userId = $1`,
+	`DELETE FROM splash_screen_logs WHERE userId = $1`,
+	`DELETE FROM study_labels WHERE user_id = $1`,
+	`DELETE FROM studies WHERE userId = $1`,
+	`DELETE FROM screener_computed_columns WHERE user_id = $1`,
+	`DELETE FROM horizontal_lines WHERE userId = $1`,
+	`DELETE FROM trade_executions WHERE userId = $1`,
+	`DELETE FROM trades WHERE userId = $1`,
+	`DELETE FROM watchlistItems WHERE watchlistId IN
+		(SELECT watchlistId FROM watchlists WHERE userId = $1)`,
+	`DELETE FROM watchlists WHERE userId = $1`,
+	`DELETE FROM strategy_template_uses WHERE user_id = $1`,
+	`DELETE FROM strategies WHERE userId = $1`,
+	`DELETE FROM report_runs WHERE user_id = $1`,
+	`DELETE FROM scheduled_reports WHERE user_id = $1`,
+	`DELETE FROM user_exports WHERE user_id = $1`,
+	`DELETE FROM user_onboarding WHERE user_id = $1`,
+	`DELETE FROM search_history WHERE user_id = $1`,
+	`DELETE FROM workspace_members WHERE user_id = $1`,
+	`UPDATE feature_flags SET user_ids = array_remove(user_ids, $1) WHERE $1 = ANY(user_ids)`,
+	`DELETE FROM users WHERE userId = $1`,
+}
+
+// PurgeTimeout is how long callers should allow PurgeUserData to run
+const PurgeTimeout = 30 * time.Second
+
+// purgeKeyPatterns match the user's Redis keys: conversation cache and
+// persistent context, socket session, idempotency records and cached backtests
+var purgeKeyPatterns = []string{
+	"user:%d",
+	"user:%d:*",
+	"socket:user:%d",
+	"idempotency:%d:*",
+	"backtest:userID:%d:*",
+}
+
+// PurgeUserData deletes a user and everything stored for them, in Postgres in
+// one transaction and then in Redis and the alert service's memory
+func PurgeUserData(ctx context.Context, conn *data.Conn, userID int) error {
+	if userID <= 0 {
+		return fmt.Errorf("invalid user ID %d", userID)
+	}
+
+	alertIDs, strategyIDs, err := activeAlertIDs(ctx, conn, userID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback(context.Background()) }()
+
+	for _, stmt := range purgeStatements {
+		if _, err := tx.Exec(ctx, stmt, userID); err != nil {
+			return fmt.Errorf("error purging user %d (%s): %v", userID, stmt, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing purge of user %d: %v", userID, err)
+	}
+
+	// The rows are gone; what follows only drops caches, so log and carry on
+	for _, id := range alertIDs {
+		alerts.RemovePriceAlertFromMemory(id)
+	}
+	for _, id := range strategyIDs {
+		alerts.RemoveStrategyAlertFromMemory(id)
+	}
+	deleted, err := purgeUserKeys(ctx, conn, userID)
+	if err != nil {
+		log.Printf("⚠️ Error purging Redis keys for user %d: %v", userID, err)
+	}
+	// After the key purge, which would drop the revocation marker: every
+	// token issued so far stops working and open sockets close
+	if _, err := sessions.RevokeAll(ctx, conn, userID, ""); err != nil {
+		log.Printf("⚠️ Error revoking sessions of user %d: %v", userID, err)
+	}
+	log.Printf("🗑️ Purged user %d (%d Redis keys)", userID, deleted)
+	return nil
+}
+
+func activeAlertIDs(ctx context.Context, conn *data.Conn, userID int) ([]int, []int, error) {
+	alertIDs, err := queryIDs(ctx, conn, `SELECT alertId FROM alerts WHERE userId = $1`, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing alerts for user %d: %v", userID, err)
+	}
+	strategyIDs, err := queryIDs(ctx, conn, `SELECT strategyId FROM strategies WHERE userId = $1`, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing strategies for user %d: %v", userID, err)
+	}
+	return alertIDs, strategyIDs, nil
+}
+
+func queryIDs(ctx context.Context, conn *data.Conn, query string, userID int) ([]int, error) {
+	rows, err := conn.DB.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// purgeUserKeys SCANs rather than KEYS so a large keyspace never blocks Redis
+func purgeUserKeys(ctx context.Context, conn *data.Conn, userID int) (int, error) {
+	deleted := 0
+	for _, pattern := range purgeKeyPatterns {
+		iter := conn.Cache.Scan(ctx, 0, fmt.Sprintf(pattern, userID), 500).Iterator()
+		var batch []string
+		for iter.Next(ctx) {
+			batch = append(batch, iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			return deleted, err
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		n, err := conn.Cache.Del(ctx, batch...).Result()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int(n)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,412 @@
+package watchlist
+
+import (
+	"backend/internal/app/helpers"
+	"backend/internal/app/workspaces"
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/services/socket"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Watchlists can be imported from pasted or uploaded text in the formats
+// users tend to have on hand:
+//
+//   - plain lists, one ticker per line or separated by commas, spaces,
+//     semicolons or pipes ("AAPL, MSFT $NVDA")
+//   - CSV with a header, as exported by most brokers and screeners, where the
+//     tickers are in the Symbol or Ticker column
+//   - TradingView lists, whose tickers carry an exchange prefix
+//     ("NASDAQ:AAPL") and whose "###Section" lines are skipped
+//
+// Tickers are resolved with helpers.ResolveTickers, so BRK.B, BRK-B and BRK/B
+// are all the same security and a company's former ticker finds it.
+const (
+	maxImportTickers     = 500
+	maxImportBytes       = 256 * 1024
+	maxWatchlistNameLen  = 50
+	maxReportedRejects   = 50 // of each kind, so a pasted essay can't bloat the result
+	watchlistItemSpacing = 1000
+)
+
+var (
+	tickerSeparators = regexp.MustCompile(`[\s,;|]+`)
+	validTicker      = regexp.MustCompile(`^[A-Z][A-Z0-9.\-/]{0,9}$`)
+	tickerHeaders    = map[string]bool{"symbol": true, "symbols": true, "ticker": true, "tickers": true, "ticker symbol": true}
+)
+
+// ParsedTickers is the outcome of parsing a ticker list
+type ParsedTickers struct {
+	Tickers    []string `json:"tickers"`    // valid and unique, in the order given
+	Duplicates []string `json:"duplicates"` // repeats of an earlier ticker
+	Invalid    []string `json:"invalid"`    // entries that can't be tickers
+}
+
+// ParseTickerList reads the tickers out of a plain, CSV or TradingView list
+func ParseTickerList(content string) ParsedTickers {
+	content = strings.TrimPrefix(content, "\ufeff") // Excel saves CSV with a BOM
+	entries, ok := csvTickerColumn(content)
+	if !ok {
+		entries = plainTickerEntries(content)
+	}
+
+	parsed := ParsedTickers{Tickers: []string{}, Duplicates: []string{}, Invalid: []string{}}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		ticker := helpers.CleanTicker(entry)
+		if ticker == "" {
+			continue
+		}
+		if !validTicker.MatchString(ticker) {
+			parsed.Invalid = appendCapped(parsed.Invalid, strings.TrimSpace(entry))
+			continue
+		}
+		key := helpers.NormalizeTicker(ticker)
+		if seen[key] {
+			parsed.Duplicates = appendCapped(parsed.Duplicates, ticker)
+			continue
+		}
+		seen[key] = true
+		parsed.Tickers = append(parsed.Tickers, ticker)
+	}
+	return parsed
+}
+
+// csvTickerColumn returns the ticker column of CSV content whose first row
+// is a header naming one, or false if the content isn't such a CSV
+func csvTickerColumn(content string) ([]string, bool) {
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, false
+	}
+	column := -1
+	for i, name := range header {
+		if tickerHeaders[strings.ToLower(strings.TrimSpace(name))] {
+			column = i
+			break
+		}
+	}
+	if column < 0 {
+		return nil, false
+	}
+	var entries []string
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			break // io.EOF, or a malformed trailer such as a broker's totals line
+		}
+		if column < len(record) {
+			entries = append(entries, record[column])
+		}
+	}
+	return entries, true
+}
+
+func plainTickerEntries(content string) []string {
+	var entries []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			continue // TradingView section headers and comments
+		}
+		for _, entry := range tickerSeparators.Split(line, -1) {
+			if entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries
+}
+
+func appendCapped(list []string, entry string) []string {
+	if len(list) >= maxReportedRejects {
+		return list
+	}
+	return append(list, entry)
+}
+
+// ImportWatchlistArgs represents a structure for handling ImportWatchlistArgs data.
+type ImportWatchlistArgs struct {
+	// WatchlistID adds to an existing watchlist; without it a new one named
+	// WatchlistName is created
+	WatchlistID   int    `json:"watchlistId,omitempty"`
+	WatchlistName string `json:"watchlistName,omitempty"`
+	Content       string `json:"content"`
+}
+
+// ImportWatchlistResult reports what an import did with each ticker
+type ImportWatchlistResult struct {
+	WatchlistID    int      `json:"watchlistId"`
+	WatchlistName  string   `json:"watchlistName"`
+	Created        bool     `json:"created"`
+	Added          []string `json:"added"`
+	AlreadyPresent []string `json:"alreadyPresent"`
+	// Renamed maps tickers the list had to the current ticker imported
+	Renamed    map[string]string `json:"renamed"`
+	Delisted   []string          `json:"delisted"`
+	Unknown    []string          `json:"unknown"`
+	Duplicates []string          `json:"duplicates"`
+	Invalid    []string          `json:"invalid"`
+}
+
+// ImportWatchlist creates a watchlist from a ticker list, or adds the list to
+// one of the user's watchlists. Tickers that match no current security are
+// reported rather than failing the import, unless none match at all.
+func ImportWatchlist(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args ImportWatchlistArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	args.WatchlistName = strings.TrimSpace(args.WatchlistName)
+	if len(args.Content) > maxImportBytes {
+		return nil, apperr.Validation("the list must be at most %d KB", maxImportBytes/1024)
+	}
+	if args.WatchlistID == 0 {
+		if args.WatchlistName == "" {
+			return nil, apperr.Validation("watchlistName is required to create a watchlist")
+		}
+		if len(args.WatchlistName) > maxWatchlistNameLen {
+			return nil, apperr.Validation("watchlistName must be at most %d characters", maxWatchlistNameLen)
+		}
+	}
+
+	parsed := ParseTickerList(args.Content)
+	if len(parsed.Tickers) == 0 {
+		return nil, apperr.Validation("no tickers found in the list")
+	}
+	if len(parsed.Tickers) > maxImportTickers {
+		return nil, apperr.Validation("a list can have at most %d tickers, this one has %d", maxImportTickers, len(parsed.Tickers))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	resolutions, err := helpers.ResolveTickers(ctx, conn, parsed.Tickers, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := ImportWatchlistResult{
+		WatchlistID:    args.WatchlistID,
+		WatchlistName:  args.WatchlistName,
+		Added:          []string{},
+		AlreadyPresent: []string{},
+		Renamed:        map[string]string{},
+		Delisted:       []string{},
+		Unknown:        []string{},
+		Duplicates:     parsed.Duplicates,
+		Invalid:        parsed.Invalid,
+	}
+	// Renamed tickers are imported under their current ticker; delisted ones
+	// can't be watched
+	var known []helpers.TickerResolution
+	for _, r := range resolutions {
+		switch r.Status {
+		case helpers.TickerExact, helpers.TickerNormalized, helpers.TickerRenamed:
+			if r.Status == helpers.TickerRenamed {
+				result.Renamed[r.Input] = r.Ticker
+			}
+			known = append(known, r)
+		case helpers.TickerDelisted:
+			result.Delisted = append(result.Delisted, r.Input)
+		default:
+			result.Unknown = append(result.Unknown, r.Input)
+		}
+	}
+	if len(known) == 0 {
+		rejected := append(result.Unknown, result.Delisted...)
+		if len(rejected) > maxReportedRejects {
+			rejected = append(rejected[:maxReportedRejects], "...")
+		}
+		return nil, apperr.Validation("none of the tickers were recognized: %s", strings.Join(rejected, ", "))
+	}
+
+	tx, err := conn.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback(context.Background()) }()
+
+	existing := map[int]bool{}
+	if args.WatchlistID == 0 {
+		err = tx.QueryRow(ctx,
+			`INSERT INTO watchlists (watchlistName, userId) VALUES ($1, $2)
+			ON CONFLICT (watchlistName, userId) DO NOTHING
+			RETURNING watchlistId`,
+			args.WatchlistName, userID).Scan(&result.WatchlistID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, apperr.Validation("you already have a watchlist named %q", args.WatchlistName)
+			}
+			return nil, fmt.Errorf("error creating watchlist: %v", err)
+		}
+		result.Created = true
+	} else {
+		if _, err := workspaces.Authorize(ctx, conn, userID, workspaces.TypeWatchlist, args.WatchlistID, workspaces.RoleEditor); err != nil {
+			return nil, err
+		}
+		err = tx.QueryRow(ctx,
+			`SELECT watchlistName FROM watchlists WHERE watchlistId = $1`,
+			args.WatchlistID).Scan(&result.WatchlistName)
+		if err != nil {
+			return nil, apperr.NotFound("watchlist not found or you don't have permission to modify it")
+		}
+		rows, err := tx.Query(ctx, `SELECT securityId FROM watchlistItems WHERE watchlistId = $1`, args.WatchlistID)
+		if err != nil {
+			return nil, fmt.Errorf("error loading watchlist items: %v", err)
+		}
+		for rows.Next() {
+			var securityID int
+			if err := rows.Scan(&securityID); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error scanning watchlist items: %v", err)
+			}
+			existing[securityID] = true
+		}
+		rows.Close()
+	}
+
+	securityIDs := make([]int, 0, len(known))
+	for _, security := range known {
+		if existing[security.SecurityID] {
+			result.AlreadyPresent = append(result.AlreadyPresent, security.Ticker)
+			continue
+		}
+		existing[security.SecurityID] = true // BRKB and a renamed BRK.B are one item
+		securityIDs = append(securityIDs, security.SecurityID)
+		result.Added = append(result.Added, security.Ticker)
+	}
+	if len(securityIDs) > 0 {
+		// New items go after the existing ones, in the order they were listed
+		_, err = tx.Exec(ctx,
+			`INSERT INTO watchlistItems (securityId, watchlistId, sortOrder)
+			SELECT u.securityId, $1,
+			       (SELECT COALESCE(MAX(sortOrder), 0) FROM watchlistItems WHERE watchlistId = $1) + u.n * $3
+			FROM unnest($2::int[]) WITH ORDINALITY AS u(securityId, n)
+			ON CONFLICT (securityId, watchlistId) DO NOTHING`,
+			result.WatchlistID, securityIDs, watchlistItemSpacing)
+		if err != nil {
+			return nil, fmt.Errorf("error inserting watchlist items: %v", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing watchlist import: %v", err)
+	}
+	return result, nil
+}
+
+// AgentImportWatchlist imports a pasted ticker list and shows the new
+// watchlist in the chat
+func AgentImportWatchlist(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	res, err := ImportWatchlist(conn, userID, rawArgs)
+	if err != nil {
+		return nil, err
+	}
+	result := res.(ImportWatchlistResult)
+	if result.Created {
+		go socket.SendAgentStatusUpdate(userID, "newWatchlist", map[string]interface{}{
+			"watchlistName": result.WatchlistName,
+			"tickers":       result.Added,
+			"watchlistId":   result.WatchlistID,
+		})
+	}
+	return result, nil
+}
+
+// ExportWatchlistArgs represents a structure for handling ExportWatchlistArgs data.
+type ExportWatchlistArgs struct {
+	WatchlistID int `json:"watchlistId"`
+}
+
+// ExportWatchlistResult is a watchlist as a CSV file
+type ExportWatchlistResult struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Content     string `json:"content"`
+}
+
+// ExportWatchlist returns one of the user's watchlists as CSV, in its display
+// order, with a Symbol column that ImportWatchlist and most other tools read
+func ExportWatchlist(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args ExportWatchlistArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := workspaces.Authorize(ctx, conn, userID, workspaces.TypeWatchlist, args.WatchlistID, workspaces.RoleViewer); err != nil {
+		return nil, err
+	}
+	var name string
+	err := conn.DB.QueryRow(ctx,
+		`SELECT watchlistName FROM watchlists WHERE watchlistId = $1`,
+		args.WatchlistID).Scan(&name)
+	if err != nil {
+		return nil, apperr.NotFound("watchlist not found or you don't have permission to access it")
+	}
+
+	// Same order as GetWatchlistItems; a security's current row names it
+	rows, err := conn.DB.Query(ctx,
+		`SELECT ticker, name, exchange, sector, industry
+		FROM (
+			SELECT DISTINCT ON (wi.watchlistItemId) wi.watchlistItemId, wi.sortOrder, s.ticker,
+			       COALESCE(s.name, '') AS name, COALESCE(s.primary_exchange, '') AS exchange,
+			       COALESCE(s.sector, '') AS sector, COALESCE(s.industry, '') AS industry
+			FROM watchlistItems wi
+			JOIN securities s ON s.securityId = wi.securityId
+			WHERE wi.watchlistId = $1
+			ORDER BY wi.watchlistItemId, s.maxDate DESC NULLS FIRST
+		) items
+		ORDER BY sortOrder NULLS LAST, watchlistItemId`,
+		args.WatchlistID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying watchlist items: %v", err)
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"Symbol", "Name", "Exchange", "Sector", "Industry"})
+	for rows.Next() {
+		record := make([]string, 5)
+		if err := rows.Scan(&record[0], &record[1], &record[2], &record[3], &record[4]); err != nil {
+			return nil, fmt.Errorf("error scanning watchlist items: %v", err)
+		}
+		_ = w.Write(record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating watchlist items: %v", err)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("error writing watchlist csv: %v", err)
+	}
+	return ExportWatchlistResult{
+		Filename:    exportFilename(name),
+		ContentType: "text/csv",
+		Content:     buf.String(),
+	}, nil
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+func exportFilename(watchlistName string) string {
+	base := strings.Trim(unsafeFilenameChars.ReplaceAllString(watchlistName, "_"), "_")
+	if base == "" {
+		base = "watchlist"
+	}
+	return base + ".csv"
+}
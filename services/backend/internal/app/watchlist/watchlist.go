@@ -1,12 +1,17 @@
 package watchlist
 
 import (
+	"backend/internal/app/dependencies"
 	"backend/internal/app/helpers"
+	"backend/internal/app/limits"
+	"backend/internal/app/workspaces"
+	"backend/internal/apperr"
 	"backend/internal/data"
 	"backend/internal/services/socket"
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"time"
 )
 
@@ -14,14 +19,16 @@ import (
 type GetWatchlistsResult struct {
 	WatchlistID   int    `json:"watchlistId"`
 	WatchlistName string `json:"watchlistName"`
+	WorkspaceID   *int   `json:"workspaceId,omitempty"`
 }
 
 // GetWatchlists performs operations related to GetWatchlists functionality.
 func GetWatchlists(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
 	rows, err := conn.DB.Query(context.Background(),
-		`SELECT watchlistId, watchlistName
+		`SELECT watchlistId, watchlistName, workspace_id
 		FROM watchlists
-		WHERE userId = $1`, userID)
+		WHERE userId = $1
+		   OR workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1)`, userID)
 	if err != nil {
 		return nil, fmt.Errorf("[pvk %v", err)
 	}
@@ -29,7 +36,7 @@ func GetWatchlists(conn *data.Conn, userID int, _ json.RawMessage) (interface{},
 	var watchlists []GetWatchlistsResult
 	for rows.Next() {
 		var watchlist GetWatchlistsResult
-		err := rows.Scan(&watchlist.WatchlistID, &watchlist.WatchlistName)
+		err := rows.Scan(&watchlist.WatchlistID, &watchlist.WatchlistName, &watchlist.WorkspaceID)
 		if err != nil {
 			return nil, fmt.Errorf("1niv %v", err)
 		}
@@ -95,6 +102,11 @@ func NewWatchlist(conn *data.Conn, userID int, rawArgs json.RawMessage) (interfa
 // DeleteWatchlistArgs represents a structure for handling DeleteWatchlistArgs data.
 type DeleteWatchlistArgs struct {
 	ID int `json:"watchlistId"`
+	// OnDependents is what happens to strategies and reports that use the
+	// watchlist: detach (the default) or cascade
+	OnDependents string `json:"onDependents,omitempty"`
+	// TwoFactorCode confirms cascading over active strategy alerts
+	TwoFactorCode string `json:"twoFactorCode,omitempty"`
 }
 
 func AgentDeleteWatchlist(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
@@ -122,14 +134,42 @@ func DeleteWatchlist(conn *data.Conn, userID int, rawArgs json.RawMessage) (inte
 	if err != nil {
 		return nil, fmt.Errorf("GetCik invalid args: %v", err)
 	}
-	cmdTag, err := conn.DB.Exec(context.Background(), "DELETE FROM watchlists WHERE watchlistId = $1 AND userId = $2", args.ID, userID)
+	ctx := context.Background()
+	// Admins of a shared watchlist's workspace can delete it too, but only the
+	// owner can take what depends on it along
+	ownerID, err := workspaces.Authorize(ctx, conn, userID, workspaces.TypeWatchlist, args.ID, workspaces.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if ownerID != userID && args.OnDependents == dependencies.ActionCascade {
+		return nil, apperr.Forbidden("only the watchlist's owner can delete what depends on it")
+	}
+	tx, err := conn.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback(context.Background()) }()
+	resolution, err := dependencies.Resolve(ctx, conn, tx, ownerID, dependencies.TypeWatchlist, args.ID,
+		args.OnDependents, args.TwoFactorCode)
+	if err != nil {
+		return nil, err
+	}
+	cmdTag, err := tx.Exec(ctx, "DELETE FROM watchlists WHERE watchlistId = $1 AND userId = $2", args.ID, ownerID)
 	if err != nil {
 		return nil, err
 	}
 	if cmdTag.RowsAffected() == 0 {
 		return nil, fmt.Errorf("watchlist not found or you don't have permission to delete it")
 	}
-	return args.ID, err
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing watchlist deletion: %v", err)
+	}
+	if resolution.DeletedActiveAlerts > 0 {
+		if err := limits.DecrementActiveStrategyAlerts(conn, ownerID, resolution.DeletedActiveAlerts); err != nil {
+			log.Printf("Warning: failed to decrement active strategy alerts counter for user %d: %v", ownerID, err)
+		}
+	}
+	return args.ID, nil
 }
 
 // GetWatchlistEntriesArgs represents a structure for handling GetWatchlistEntriesArgs data.
@@ -153,16 +193,9 @@ func GetWatchlistItems(conn *data.Conn, userID int, rawArgs json.RawMessage) (in
 		return nil, fmt.Errorf("GetCik invalid args: %v", err)
 	}
 
-	// First verify that the watchlist belongs to the user
-	var watchlistExists bool
-	err = conn.DB.QueryRow(context.Background(),
-		`SELECT EXISTS(SELECT 1 FROM watchlists WHERE watchlistId = $1 AND userId = $2)`,
-		args.WatchlistID, userID).Scan(&watchlistExists)
-	if err != nil {
-		return nil, fmt.Errorf("error verifying watchlist ownership: %v", err)
-	}
-	if !watchlistExists {
-		return nil, fmt.Errorf("watchlist not found or you don't have permission to access it")
+	// First verify that the user can see the watchlist
+	if _, err := workspaces.Authorize(context.Background(), conn, userID, workspaces.TypeWatchlist, args.WatchlistID, workspaces.RoleViewer); err != nil {
+		return nil, err
 	}
 
 	rows, err := conn.DB.Query(context.Background(),
@@ -205,13 +238,9 @@ func AgentGetWatchlistItems(conn *data.Conn, userID int, rawArgs json.RawMessage
 	if err != nil {
 		return nil, fmt.Errorf("m0ivn0d [agentGetWatchlistItems]: %v", err)
 	}
-	owns, err := VerifyUserOwnsWatchlist(conn, userID, args.WatchlistID)
-	if err != nil {
+	if _, err := workspaces.Authorize(context.Background(), conn, userID, workspaces.TypeWatchlist, args.WatchlistID, workspaces.RoleViewer); err != nil {
 		return nil, err
 	}
-	if !owns {
-		return nil, fmt.Errorf("watchlist not found or you don't have permission to access it")
-	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -350,12 +379,15 @@ func DeleteWatchlistItem(conn *data.Conn, userID int, rawArgs json.RawMessage) (
 	if err != nil {
 		return nil, fmt.Errorf("watchlist item not found: %v", err)
 	}
+	if _, err := workspaces.Authorize(context.Background(), conn, userID, workspaces.TypeWatchlist, watchlistID, workspaces.RoleEditor); err != nil {
+		return nil, err
+	}
 
 	cmdTag, err := conn.DB.Exec(context.Background(), `
 		DELETE FROM watchlistItems 
 		WHERE watchlistItemId = $1 
-		AND watchlistId IN (SELECT watchlistId FROM watchlists WHERE userId = $2)`,
-		args.WatchlistItemID, userID)
+		AND watchlistId = $2`,
+		args.WatchlistItemID, watchlistID)
 	if err != nil {
 		return nil, fmt.Errorf("niv02 %v", err)
 	}
@@ -379,16 +411,9 @@ func NewWatchlistItem(conn *data.Conn, userID int, rawArgs json.RawMessage) (int
 		return nil, fmt.Errorf("m0ivn0d %v", err)
 	}
 
-	// Verify that the watchlist belongs to the user
-	var watchlistExists bool
-	err = conn.DB.QueryRow(context.Background(),
-		`SELECT EXISTS(SELECT 1 FROM watchlists WHERE watchlistId = $1 AND userId = $2)`,
-		args.WatchlistID, userID).Scan(&watchlistExists)
-	if err != nil {
-		return nil, fmt.Errorf("error verifying watchlist ownership: %v", err)
-	}
-	if !watchlistExists {
-		return nil, fmt.Errorf("watchlist not found or you don't have permission to modify it")
+	// Verify that the user can change the watchlist
+	if _, err := workspaces.Authorize(context.Background(), conn, userID, workspaces.TypeWatchlist, args.WatchlistID, workspaces.RoleEditor); err != nil {
+		return nil, err
 	}
 
 	var watchlistItemID int
@@ -422,17 +447,17 @@ func MoveWatchlistItem(conn *data.Conn, userID int, rawArgs json.RawMessage) (in
 		return nil, fmt.Errorf("watchlistItemId is required")
 	}
 
-	// Resolve watchlistId and verify ownership
+	// Resolve watchlistId and verify the user can change it
 	var watchlistID int
 	err := conn.DB.QueryRow(context.Background(),
-		`SELECT w.watchlistId
-         FROM watchlistItems wi
-         JOIN watchlists w ON w.watchlistId = wi.watchlistId
-         WHERE wi.watchlistItemId = $1 AND w.userId = $2`,
-		args.WatchlistItemID, userID).Scan(&watchlistID)
+		`SELECT watchlistId FROM watchlistItems WHERE watchlistItemId = $1`,
+		args.WatchlistItemID).Scan(&watchlistID)
 	if err != nil {
 		return nil, fmt.Errorf("watchlist item not found or no permission: %v", err)
 	}
+	if _, err := workspaces.Authorize(context.Background(), conn, userID, workspaces.TypeWatchlist, watchlistID, workspaces.RoleEditor); err != nil {
+		return nil, err
+	}
 
 	// Helper to fetch sortOrder for an item ID (nullable)
 	fetchSort := func(itemID *int) (*float64, error) {
@@ -510,13 +535,9 @@ func SetWatchlistOrder(conn *data.Conn, userID int, rawArgs json.RawMessage) (in
 		return nil, fmt.Errorf("watchlistId and orderedItemIds are required")
 	}
 
-	owns, err := VerifyUserOwnsWatchlist(conn, userID, args.WatchlistID)
-	if err != nil {
+	if _, err := workspaces.Authorize(context.Background(), conn, userID, workspaces.TypeWatchlist, args.WatchlistID, workspaces.RoleEditor); err != nil {
 		return nil, err
 	}
-	if !owns {
-		return nil, fmt.Errorf("watchlist not found or you don't have permission to modify it")
-	}
 
 	// Renumber with step 1000
 	step := 1000
@@ -533,13 +554,9 @@ func SetWatchlistOrder(conn *data.Conn, userID int, rawArgs json.RawMessage) (in
 
 // rebalanceSortOrder normalizes all sortOrder values to sequential gaps for a watchlist.
 func rebalanceSortOrder(conn *data.Conn, userID int, watchlistID int) error {
-	owns, err := VerifyUserOwnsWatchlist(conn, userID, watchlistID)
-	if err != nil {
+	if _, err := workspaces.Authorize(context.Background(), conn, userID, workspaces.TypeWatchlist, watchlistID, workspaces.RoleEditor); err != nil {
 		return err
 	}
-	if !owns {
-		return fmt.Errorf("watchlist not found or you don't have permission to modify it")
-	}
 
 	// Reassign sortOrder by current ascending sortOrder
 	rows, err := conn.DB.Query(context.Background(),
@@ -608,13 +625,9 @@ func AddTickersToWatchlist(conn *data.Conn, userID int, rawArgs json.RawMessage)
 		return nil, fmt.Errorf("m0ivn0d [addTickersToWatchlist]: %v", err)
 	}
 
-	owns, err := VerifyUserOwnsWatchlist(conn, userID, args.WatchlistID)
-	if err != nil {
+	if _, err := workspaces.Authorize(context.Background(), conn, userID, workspaces.TypeWatchlist, args.WatchlistID, workspaces.RoleEditor); err != nil {
 		return nil, err
 	}
-	if !owns {
-		return nil, fmt.Errorf("watchlist not found or you don't have permission to modify it")
-	}
 
 	rows, err := conn.DB.Query(context.Background(),
 		`INSERT INTO watchlistItems (securityId, watchlistId)
@@ -644,13 +657,3 @@ func AddTickersToWatchlist(conn *data.Conn, userID int, rawArgs json.RawMessage)
 
 	return watchlistItemIDs, nil
 }
-func VerifyUserOwnsWatchlist(conn *data.Conn, userID int, watchlistID int) (bool, error) {
-	var watchlistExists bool
-	err := conn.DB.QueryRow(context.Background(),
-		`SELECT EXISTS(SELECT 1 FROM watchlists WHERE watchlistId = $1 AND userId = $2)`,
-		watchlistID, userID).Scan(&watchlistExists)
-	if err != nil {
-		return false, fmt.Errorf("error verifying watchlist ownership: %v", err)
-	}
-	return watchlistExists, nil
-}
@@ -0,0 +1,512 @@
+// Package workspaces lets small teams share strategies and watchlists. An
+// entity keeps a single owner but can be placed in a workspace, whose members
+// use it with the access of their role (see Authorize), so a team can work on
+// one set of strategy alerts without sharing credentials.
+package workspaces
+
+import (
+	"backend/internal/app/limits"
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/services/twofactor"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	maxWorkspacesPerUser    = 10 // created by one user
+	maxWorkspaceMembers     = 25
+	maxWorkspaceNameLength  = 100
+	workspaceRequestTimeout = 10 * time.Second
+)
+
+// Workspace is a workspace the user belongs to
+type Workspace struct {
+	WorkspaceID int      `json:"workspaceId"`
+	Name        string   `json:"name"`
+	Role        Role     `json:"role"` // the user's
+	Members     []Member `json:"members"`
+	Strategies  int      `json:"strategies"` // strategies in it, counting each by name once
+	Watchlists  int      `json:"watchlists"`
+	CreatedAt   int64    `json:"createdAt"`
+}
+
+// Member is a user in a workspace
+type Member struct {
+	UserID   int    `json:"userId"`
+	Username string `json:"username"`
+	Role     Role   `json:"role"`
+	AddedAt  int64  `json:"addedAt"`
+}
+
+// GetWorkspaces lists the workspaces the user belongs to with their members
+func GetWorkspaces(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), workspaceRequestTimeout)
+	defer cancel()
+
+	rows, err := conn.DB.Query(ctx, `
+		SELECT w.workspace_id, w.name, m.role, w.created_at,
+		       (SELECT COUNT(DISTINCT (s.userid, s.name)) FROM strategies s WHERE s.workspace_id = w.workspace_id),
+		       (SELECT COUNT(*) FROM watchlists l WHERE l.workspace_id = w.workspace_id)
+		FROM workspaces w
+		JOIN workspace_members m ON m.workspace_id = w.workspace_id AND m.user_id = $1
+		ORDER BY w.created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying workspaces: %v", err)
+	}
+	workspaces := []Workspace{}
+	index := map[int]int{}
+	for rows.Next() {
+		var w Workspace
+		var createdAt time.Time
+		if err := rows.Scan(&w.WorkspaceID, &w.Name, &w.Role, &createdAt, &w.Strategies, &w.Watchlists); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning workspace: %v", err)
+		}
+		w.CreatedAt = createdAt.UnixMilli()
+		w.Members = []Member{}
+		index[w.WorkspaceID] = len(workspaces)
+		workspaces = append(workspaces, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating workspaces: %v", err)
+	}
+	if len(workspaces) == 0 {
+		return workspaces, nil
+	}
+
+	ids := make([]int, 0, len(workspaces))
+	for _, w := range workspaces {
+		ids = append(ids, w.WorkspaceID)
+	}
+	rows, err = conn.DB.Query(ctx, `
+		SELECT m.workspace_id, m.user_id, u.username, m.role, m.added_at
+		FROM workspace_members m
+		JOIN users u ON u.userId = m.user_id
+		WHERE m.workspace_id = ANY($1)
+		ORDER BY m.added_at`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error querying workspace members: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var workspaceID int
+		var m Member
+		var addedAt time.Time
+		if err := rows.Scan(&workspaceID, &m.UserID, &m.Username, &m.Role, &addedAt); err != nil {
+			return nil, fmt.Errorf("error scanning workspace member: %v", err)
+		}
+		m.AddedAt = addedAt.UnixMilli()
+		w := &workspaces[index[workspaceID]]
+		w.Members = append(w.Members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating workspace members: %v", err)
+	}
+	return workspaces, nil
+}
+
+// CreateWorkspaceArgs represents a structure for handling CreateWorkspaceArgs data.
+type CreateWorkspaceArgs struct {
+	Name string `json:"name"`
+}
+
+// CreateWorkspace creates a workspace with the user as its admin
+func CreateWorkspace(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args CreateWorkspaceArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	args.Name = strings.TrimSpace(args.Name)
+	if args.Name == "" {
+		return nil, apperr.Validation("name is required")
+	}
+	if len(args.Name) > maxWorkspaceNameLength {
+		return nil, apperr.Validation("name must be at most %d characters", maxWorkspaceNameLength)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), workspaceRequestTimeout)
+	defer cancel()
+	tx, err := conn.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback(context.Background()) }()
+
+	var created int
+	if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM workspaces WHERE created_by = $1`, userID).Scan(&created); err != nil {
+		return nil, fmt.Errorf("error counting workspaces: %v", err)
+	}
+	if created >= maxWorkspacesPerUser {
+		return nil, apperr.LimitExceeded("you can create at most %d workspaces", maxWorkspacesPerUser)
+	}
+	var workspaceID int
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO workspaces (name, created_by) VALUES ($1, $2) RETURNING workspace_id`,
+		args.Name, userID).Scan(&workspaceID); err != nil {
+		return nil, fmt.Errorf("error creating workspace: %v", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO workspace_members (workspace_id, user_id, role, added_by) VALUES ($1, $2, 'admin', $2)`,
+		workspaceID, userID); err != nil {
+		return nil, fmt.Errorf("error adding workspace admin: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing workspace: %v", err)
+	}
+	return map[string]interface{}{"workspaceId": workspaceID, "name": args.Name}, nil
+}
+
+// WorkspaceArgs names a workspace
+type WorkspaceArgs struct {
+	WorkspaceID int `json:"workspaceId"`
+}
+
+// DeleteWorkspace deletes a workspace. Its strategies and watchlists go back
+// to being private to their owners.
+func DeleteWorkspace(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args WorkspaceArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), workspaceRequestTimeout)
+	defer cancel()
+	if err := requireRole(ctx, conn.DB, args.WorkspaceID, userID, RoleAdmin); err != nil {
+		return nil, err
+	}
+	if _, err := conn.DB.Exec(ctx, `DELETE FROM workspaces WHERE workspace_id = $1`, args.WorkspaceID); err != nil {
+		return nil, fmt.Errorf("error deleting workspace: %v", err)
+	}
+	return map[string]interface{}{"success": true}, nil
+}
+
+// AddWorkspaceMemberArgs represents a structure for handling AddWorkspaceMemberArgs data.
+type AddWorkspaceMemberArgs struct {
+	WorkspaceID int `json:"workspaceId"`
+	// User is the username or email of the user to add
+	User string `json:"user"`
+	Role Role   `json:"role"`
+}
+
+// AddWorkspaceMember adds a user to a workspace, or changes the role of one
+// already in it. Only admins can manage members.
+func AddWorkspaceMember(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args AddWorkspaceMemberArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.Role == "" {
+		args.Role = RoleViewer
+	}
+	if !args.Role.Valid() {
+		return nil, apperr.Validation("role must be %s, %s or %s", RoleViewer, RoleEditor, RoleAdmin)
+	}
+	user := strings.TrimSpace(args.User)
+	if user == "" {
+		return nil, apperr.Validation("user is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), workspaceRequestTimeout)
+	defer cancel()
+	tx, err := conn.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback(context.Background()) }()
+	if err := requireRole(ctx, tx, args.WorkspaceID, userID, RoleAdmin); err != nil {
+		return nil, err
+	}
+
+	var memberID int
+	err = tx.QueryRow(ctx, `
+		SELECT userId FROM users
+		WHERE userId <> 0 AND (username = $1 OR lower(email) = lower($1))
+		ORDER BY (username = $1) DESC LIMIT 1`, user).Scan(&memberID)
+	if err == pgx.ErrNoRows {
+		return nil, apperr.NotFound("no user %q", user)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error looking up user: %v", err)
+	}
+	current, err := memberRole(ctx, tx, args.WorkspaceID, memberID)
+	if err != nil {
+		return nil, err
+	}
+	if current == "" {
+		var members int
+		if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM workspace_members WHERE workspace_id = $1`,
+			args.WorkspaceID).Scan(&members); err != nil {
+			return nil, fmt.Errorf("error counting workspace members: %v", err)
+		}
+		if members >= maxWorkspaceMembers {
+			return nil, apperr.LimitExceeded("a workspace can have at most %d members", maxWorkspaceMembers)
+		}
+	} else if current == RoleAdmin && args.Role != RoleAdmin {
+		if err := keepAnAdmin(ctx, tx, args.WorkspaceID, memberID); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO workspace_members (workspace_id, user_id, role, added_by) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = EXCLUDED.role`,
+		args.WorkspaceID, memberID, string(args.Role), userID); err != nil {
+		return nil, fmt.Errorf("error adding workspace member: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing workspace member: %v", err)
+	}
+	return map[string]interface{}{"workspaceId": args.WorkspaceID, "userId": memberID, "role": args.Role}, nil
+}
+
+// RemoveWorkspaceMemberArgs represents a structure for handling RemoveWorkspaceMemberArgs data.
+type RemoveWorkspaceMemberArgs struct {
+	WorkspaceID int `json:"workspaceId"`
+	UserID      int `json:"userId"`
+}
+
+// RemoveWorkspaceMember removes a member from a workspace; admins can remove
+// anyone and members can leave. The strategies and watchlists the member
+// owns in the workspace leave with them and become private again.
+func RemoveWorkspaceMember(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args RemoveWorkspaceMemberArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), workspaceRequestTimeout)
+	defer cancel()
+	tx, err := conn.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback(context.Background()) }()
+
+	need := RoleAdmin
+	if args.UserID == userID {
+		need = RoleViewer
+	}
+	if err := requireRole(ctx, tx, args.WorkspaceID, userID, need); err != nil {
+		return nil, err
+	}
+	role, err := memberRole(ctx, tx, args.WorkspaceID, args.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, apperr.NotFound("user %d is not a member of this workspace", args.UserID)
+	}
+	if role == RoleAdmin {
+		if err := keepAnAdmin(ctx, tx, args.WorkspaceID, args.UserID); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`,
+		args.WorkspaceID, args.UserID); err != nil {
+		return nil, fmt.Errorf("error removing workspace member: %v", err)
+	}
+	strategies, err := tx.Exec(ctx, `
+		UPDATE strategies SET workspace_id = NULL WHERE workspace_id = $1 AND userid = $2`,
+		args.WorkspaceID, args.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("error unsharing strategies: %v", err)
+	}
+	watchlists, err := tx.Exec(ctx, `
+		UPDATE watchlists SET workspace_id = NULL WHERE workspace_id = $1 AND userId = $2`,
+		args.WorkspaceID, args.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("error unsharing watchlists: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing workspace member removal: %v", err)
+	}
+	return map[string]interface{}{
+		"success":            true,
+		"unsharedStrategies": strategies.RowsAffected(),
+		"unsharedWatchlists": watchlists.RowsAffected(),
+	}, nil
+}
+
+// requireRole checks the user holds at least a role in a workspace
+func requireRole(ctx context.Context, q rowQuerier, workspaceID, userID int, need Role) error {
+	role, err := memberRole(ctx, q, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return apperr.NotFound("workspace not found or access denied")
+	}
+	if !role.Allows(need) {
+		return apperr.Forbidden("you are a workspace %s; %s access is needed", role, need)
+	}
+	return nil
+}
+
+// keepAnAdmin refuses to leave a workspace without an admin when one stops
+// being admin
+func keepAnAdmin(ctx context.Context, tx pgx.Tx, workspaceID, leavingID int) error {
+	var others int
+	if err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM workspace_members
+		WHERE workspace_id = $1 AND role = 'admin' AND user_id <> $2`,
+		workspaceID, leavingID).Scan(&others); err != nil {
+		return fmt.Errorf("error counting workspace admins: %v", err)
+	}
+	if others == 0 {
+		return apperr.Validation("a workspace needs an admin; make someone else admin first or delete the workspace")
+	}
+	return nil
+}
+
+// ShareArgs names an entity and the workspace to place it in
+type ShareArgs struct {
+	Type string `json:"type"` // strategy or watchlist
+	ID   int    `json:"id"`
+	// WorkspaceID is the workspace to share it with; 0 makes it private
+	WorkspaceID int `json:"workspaceId"`
+}
+
+// entityGroups select every row of an entity: all versions of a strategy
+var entityGroups = map[string]string{
+	TypeStrategy: `strategies SET %s
+		WHERE userid = $1 AND name = (SELECT name FROM strategies WHERE strategyid = $2)`,
+	TypeWatchlist: `watchlists SET %s WHERE userId = $1 AND watchlistId = $2`,
+}
+
+// ShareToWorkspace places an entity in a workspace, or makes it private. The
+// owner can share it with a workspace they can edit in; it can be made
+// private by its owner or an admin of its workspace.
+func ShareToWorkspace(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args ShareArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), workspaceRequestTimeout)
+	defer cancel()
+	access, err := Lookup(ctx, conn, userID, args.Type, args.ID)
+	if err != nil {
+		return nil, err
+	}
+	if args.WorkspaceID == 0 {
+		if !access.Role.Allows(RoleAdmin) {
+			return nil, apperr.Forbidden("only the owner or a workspace admin can make this %s private", args.Type)
+		}
+	} else {
+		if access.OwnerID != userID {
+			return nil, apperr.Forbidden("only the owner can share this %s with another workspace", args.Type)
+		}
+		if err := requireRole(ctx, conn.DB, args.WorkspaceID, userID, RoleEditor); err != nil {
+			return nil, err
+		}
+	}
+
+	var workspaceID *int
+	if args.WorkspaceID != 0 {
+		workspaceID = &args.WorkspaceID
+	}
+	if _, err := conn.DB.Exec(ctx, "UPDATE "+fmt.Sprintf(entityGroups[args.Type], "workspace_id = $3"),
+		access.OwnerID, args.ID, workspaceID); err != nil {
+		return nil, fmt.Errorf("error sharing %s: %v", args.Type, err)
+	}
+	return map[string]interface{}{"type": args.Type, "id": args.ID, "workspaceId": workspaceID}, nil
+}
+
+// TransferArgs names an entity and its new owner
+type TransferArgs struct {
+	Type string `json:"type"` // strategy or watchlist
+	ID   int    `json:"id"`
+	// ToUserID must be an editor or admin of the entity's workspace
+	ToUserID int `json:"toUserId"`
+	// TwoFactorCode confirms the transfer when the user has two-factor enabled
+	TwoFactorCode string `json:"twoFactorCode,omitempty"`
+}
+
+// TransferOwnership hands an entity in a workspace to another member, who
+// from then on is charged for its alerts and receives them. The owner or an
+// admin of its workspace can transfer it.
+func TransferOwnership(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args TransferArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), workspaceRequestTimeout)
+	defer cancel()
+	access, err := Lookup(ctx, conn, userID, args.Type, args.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !access.Role.Allows(RoleAdmin) {
+		return nil, apperr.Forbidden("only the owner or a workspace admin can transfer this %s", args.Type)
+	}
+	if access.WorkspaceID == nil {
+		return nil, apperr.Validation("share the %s with a workspace the new owner belongs to first", args.Type)
+	}
+	if args.ToUserID == access.OwnerID {
+		return nil, apperr.Validation("user %d already owns this %s", args.ToUserID, args.Type)
+	}
+	role, err := memberRole(ctx, conn.DB, *access.WorkspaceID, args.ToUserID)
+	if err != nil {
+		return nil, err
+	}
+	if !role.Allows(RoleEditor) {
+		return nil, apperr.Validation("the new owner must be an editor or admin of the %s's workspace", args.Type)
+	}
+	if err := twofactor.RequireStepUp(ctx, conn, userID, args.TwoFactorCode); err != nil {
+		return nil, err
+	}
+
+	// Active strategy alerts count against the new owner's plan from now on
+	activeAlerts := 0
+	if args.Type == TypeStrategy {
+		if err := conn.DB.QueryRow(ctx, `
+			SELECT COUNT(*) FROM strategies
+			WHERE userid = $1 AND name = (SELECT name FROM strategies WHERE strategyid = $2) AND alertactive`,
+			access.OwnerID, args.ID).Scan(&activeAlerts); err != nil {
+			return nil, fmt.Errorf("error counting strategy alerts: %v", err)
+		}
+		if activeAlerts > 0 {
+			allowed, remaining, err := limits.CheckUsageAllowed(conn, args.ToUserID, limits.UsageTypeStrategyAlert, 0)
+			if err != nil {
+				return nil, fmt.Errorf("checking strategy alert limits: %w", err)
+			}
+			if !allowed || remaining < activeAlerts {
+				return nil, apperr.LimitExceeded("the new owner has no strategy alerts left on their plan for this strategy's active alerts")
+			}
+		}
+	}
+
+	tag, err := conn.DB.Exec(ctx, "UPDATE "+fmt.Sprintf(entityGroups[args.Type], "userid = $3"),
+		access.OwnerID, args.ID, args.ToUserID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+			return nil, apperr.Validation("the new owner already has a %s with this name", args.Type)
+		}
+		return nil, fmt.Errorf("error transferring %s: %v", args.Type, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, apperr.NotFound("%s not found or access denied", args.Type)
+	}
+
+	if activeAlerts > 0 {
+		if err := limits.RecordUsage(conn, args.ToUserID, limits.UsageTypeStrategyAlert, activeAlerts, map[string]interface{}{
+			"strategyId": args.ID,
+			"action":     "transferred",
+		}); err != nil {
+			log.Printf("Warning: failed to record transferred strategy alerts for user %d: %v", args.ToUserID, err)
+		}
+		if err := limits.DecrementActiveStrategyAlerts(conn, access.OwnerID, activeAlerts); err != nil {
+			log.Printf("Warning: failed to decrement active strategy alerts counter for user %d: %v", access.OwnerID, err)
+		}
+	}
+	log.Printf("%s %d transferred from user %d to user %d by user %d", args.Type, args.ID, access.OwnerID, args.ToUserID, userID)
+	return map[string]interface{}{"type": args.Type, "id": args.ID, "ownerId": args.ToUserID}, nil
+}
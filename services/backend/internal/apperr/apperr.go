@@ -0,0 +1,186 @@
+// Package apperr is the error taxonomy shared by HTTP handlers and agent
+// tools. An *Error carries a Code the frontend and the agent can branch on,
+// and a message that is safe to show the user; the wrapped cause is only
+// logged. Errors without a code are treated as internal.
+package apperr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Code classifies an error
+type Code string
+
+const (
+	CodeValidation      Code = "validation"       // the request itself is wrong
+	CodeNotFound        Code = "not_found"        // the referenced resource does not exist or is not the caller's
+	CodeForbidden       Code = "forbidden"        // the caller is not allowed to do this
+	CodeLimitExceeded   Code = "limit_exceeded"   // plan, usage or rate limit
+	CodeUpstreamTimeout Code = "upstream_timeout" // a worker, data provider or model did not answer in time
+	CodeStepUpRequired  Code = "step_up_required" // the action needs a fresh two-factor code
+	CodeConfirmRequired Code = "confirm_required" // the action is costly; repeat it confirmed to go ahead
+	CodeUnavailable     Code = "unavailable"      // temporarily refused, e.g. the task queue is paused; retry later
+	CodeInternal        Code = "internal"         // anything else; the message is not shown
+)
+
+// Error is an error with a code and a user-facing message
+type Error struct {
+	Code    Code
+	Message string
+	Err     error // underlying cause, may be nil
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	if e.Message == "" {
+		return e.Err.Error()
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches another *Error with the same code, so errors.Is(err,
+// apperr.ErrNotFound) holds for any not-found error
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Message == "" && t.Err == nil && t.Code == e.Code
+}
+
+// Sentinels for errors.Is checks
+var (
+	ErrValidation      = &Error{Code: CodeValidation}
+	ErrNotFound        = &Error{Code: CodeNotFound}
+	ErrForbidden       = &Error{Code: CodeForbidden}
+	ErrLimitExceeded   = &Error{Code: CodeLimitExceeded}
+	ErrUpstreamTimeout = &Error{Code: CodeUpstreamTimeout}
+	ErrStepUpRequired  = &Error{Code: CodeStepUpRequired}
+	ErrConfirmRequired = &Error{Code: CodeConfirmRequired}
+	ErrUnavailable     = &Error{Code: CodeUnavailable}
+	ErrInternal        = &Error{Code: CodeInternal}
+)
+
+// New returns an error with code and a formatted message
+func New(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wrap attaches code and a message to err
+func Wrap(code Code, err error, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+// Validation returns a validation error
+func Validation(format string, args ...interface{}) *Error {
+	return New(CodeValidation, format, args...)
+}
+
+// NotFound returns a not-found error
+func NotFound(format string, args ...interface{}) *Error {
+	return New(CodeNotFound, format, args...)
+}
+
+// Forbidden returns a forbidden error
+func Forbidden(format string, args ...interface{}) *Error {
+	return New(CodeForbidden, format, args...)
+}
+
+// LimitExceeded returns a limit-exceeded error
+func LimitExceeded(format string, args ...interface{}) *Error {
+	return New(CodeLimitExceeded, format, args...)
+}
+
+// UpstreamTimeout returns an upstream-timeout error
+func UpstreamTimeout(format string, args ...interface{}) *Error {
+	return New(CodeUpstreamTimeout, format, args...)
+}
+
+// StepUpRequired returns an error asking the caller to repeat the request
+// with a two-factor code
+func StepUpRequired(format string, args ...interface{}) *Error {
+	return New(CodeStepUpRequired, format, args...)
+}
+
+// ConfirmRequired returns an error asking the caller to repeat the request
+// confirmed, after showing the user the message
+func ConfirmRequired(format string, args ...interface{}) *Error {
+	return New(CodeConfirmRequired, format, args...)
+}
+
+// Unavailable returns an error for work that is temporarily refused
+func Unavailable(format string, args ...interface{}) *Error {
+	return New(CodeUnavailable, format, args...)
+}
+
+// InvalidArgs wraps a JSON decoding error of handler arguments
+func InvalidArgs(err error) *Error {
+	return Wrap(CodeValidation, err, "invalid args")
+}
+
+// As returns the *Error in err's chain, if any
+func As(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// CodeOf classifies err. Deadline errors are upstream timeouts; uncoded
+// errors are internal.
+func CodeOf(err error) Code {
+	if err == nil {
+		return ""
+	}
+	if e, ok := As(err); ok {
+		return e.Code
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return CodeUpstreamTimeout
+	}
+	return CodeInternal
+}
+
+// Message is the text that may be shown to the user for err
+func Message(err error) string {
+	if e, ok := As(err); ok && e.Code != CodeInternal {
+		if e.Message != "" {
+			return e.Message
+		}
+		return e.Error()
+	}
+	if CodeOf(err) == CodeUpstreamTimeout {
+		return "The request timed out. Please try again."
+	}
+	return "Unexpected error"
+}
+
+// HTTPStatus maps a code to the status a handler responds with
+func HTTPStatus(code Code) int {
+	switch code {
+	case CodeValidation:
+		return http.StatusBadRequest
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeForbidden:
+		return http.StatusForbidden
+	case CodeLimitExceeded:
+		return http.StatusTooManyRequests
+	case CodeUpstreamTimeout:
+		return http.StatusGatewayTimeout
+	case CodeStepUpRequired:
+		return http.StatusForbidden
+	case CodeConfirmRequired:
+		return http.StatusConflict
+	case CodeUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
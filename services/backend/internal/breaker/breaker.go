@@ -0,0 +1,169 @@
+// Package breaker tracks the health of the services the backend depends on.
+// Each dependency has a circuit breaker. It opens after a run of consecutive
+// failures. While it is open, callers skip or shed work that needs the
+// dependency. After a cooldown one trial call is let through, and a success
+// closes the breaker again.
+package breaker
+
+import (
+	"backend/internal/apperr"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// State of a breaker
+type State string
+
+const (
+	Closed   State = "closed"    // healthy
+	Open     State = "open"      // failing; calls are refused until the cooldown ends
+	HalfOpen State = "half_open" // cooldown over; a trial call decides
+)
+
+// Breaker is the circuit breaker of one dependency
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	state     State
+	failures  int
+	openedAt  time.Time
+	changedAt time.Time
+	lastError string
+	trial     bool // a half-open trial call is in flight
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]*Breaker{}
+)
+
+// Dependencies with breakers
+var (
+	Postgres = New("postgres", 3, 15*time.Second)
+	Redis    = New("redis", 3, 15*time.Second)
+	Polygon  = New("polygon", 5, 30*time.Second)
+	LLM      = New("llm", 3, time.Minute)
+)
+
+// New registers a breaker that opens after threshold consecutive failures
+// and stays open for cooldown
+func New(name string, threshold int, cooldown time.Duration) *Breaker {
+	b := &Breaker{name: name, threshold: threshold, cooldown: cooldown, state: Closed, changedAt: time.Now()}
+	registryMu.Lock()
+	registry[name] = b
+	registryMu.Unlock()
+	return b
+}
+
+// Name of the dependency
+func (b *Breaker) Name() string { return b.name }
+
+// Allow reports whether a call to the dependency should be made now. Once
+// the cooldown of an open breaker has passed it allows a single trial call.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(HalfOpen)
+		b.trial = true
+		return true
+	case HalfOpen:
+		// A trial that never reported back doesn't hold the breaker forever
+		if b.trial && time.Since(b.changedAt) < b.cooldown {
+			return false
+		}
+		b.trial = true
+		return true
+	}
+	return true
+}
+
+// Healthy reports whether the breaker is closed. Use it to decide whether to
+// shed optional work; use Allow before a call that would itself probe.
+func (b *Breaker) Healthy() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == Closed
+}
+
+// Record feeds the outcome of a call to the dependency into the breaker
+func (b *Breaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if err == nil {
+		b.failures = 0
+		if b.state != Closed {
+			b.setState(Closed)
+		}
+		return
+	}
+	b.failures++
+	b.lastError = err.Error()
+	if b.state == HalfOpen || (b.state == Closed && b.failures >= b.threshold) {
+		b.openedAt = time.Now()
+		b.setState(Open)
+	}
+}
+
+// Unavailable is the error returned for work refused while the breaker is open
+func (b *Breaker) Unavailable() error {
+	return apperr.UpstreamTimeout("%s is unavailable, please try again shortly", b.name)
+}
+
+func (b *Breaker) setState(s State) {
+	if s == Open {
+		log.Printf("⚠️ Circuit breaker %s opened after %d failures: %s", b.name, b.failures, b.lastError)
+	} else if s == Closed {
+		log.Printf("✅ Circuit breaker %s closed", b.name)
+	}
+	b.state = s
+	b.changedAt = time.Now()
+}
+
+// Status is a breaker's state as shown on the status endpoint
+type Status struct {
+	Name      string    `json:"name"`
+	State     State     `json:"state"`
+	Failures  int       `json:"failures"`
+	Since     time.Time `json:"since"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// Status returns the breaker's current state
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return Status{Name: b.name, State: b.state, Failures: b.failures, Since: b.changedAt, LastError: b.lastError}
+}
+
+// All returns the state of every breaker, by name
+func All() []Status {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	out := make([]Status, 0, len(registry))
+	for _, b := range registry {
+		out = append(out, b.Status())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Degraded reports whether any breaker is not closed
+func Degraded() bool {
+	for _, s := range All() {
+		if s.State != Closed {
+			return true
+		}
+	}
+	return false
+}
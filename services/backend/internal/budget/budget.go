@@ -0,0 +1,224 @@
+// Package budget enforces latency budgets on HTTP functions and agent tools.
+// Each function belongs to a class with a deadline. Functions that take a
+// context run under Call: the deadline is set on their context, so database
+// queries and queue waits made with it stop with it, and it becomes the
+// statement_timeout of those queries. Callers that ignore the context are
+// abandoned at the deadline with a timeout error. Functions without a context
+// can't be stopped, so Measure only times them. Every overrun is counted in
+// Redis and on the latency_budget.violations metric.
+//
+// Tools are classed here; endpoints are classed where they are declared, in
+// apispec.
+package budget
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Class is a latency budget shared by similar functions
+type Class struct {
+	Name  string
+	Limit time.Duration
+}
+
+var (
+	Snapshot = Class{Name: "snapshot", Limit: 2 * time.Second}   // quotes and lookups served from cache or one query
+	Read     = Class{Name: "read", Limit: 30 * time.Second}      // everything not listed
+	Compute  = Class{Name: "compute", Limit: 60 * time.Second}   // renders, filings and strategy signals
+	Backtest = Class{Name: "backtest", Limit: 120 * time.Second} // backtest and screening submissions
+	Long     = Class{Name: "long", Limit: 5 * time.Minute}       // strategy generation, sweeps, alert simulations and agent runs
+	Chat     = Class{Name: "chat", Limit: 10 * time.Minute}      // a whole chat turn; matches the server's write timeout
+)
+
+// classes are every class, by name
+var classes = map[string]Class{}
+
+func init() {
+	for _, c := range []Class{Snapshot, Read, Compute, Backtest, Long, Chat} {
+		classes[c.Name] = c
+	}
+}
+
+// Kinds of budgeted calls
+const (
+	KindEndpoint = "endpoint"
+	KindTool     = "tool"
+)
+
+var toolClasses = map[string]Class{
+	"getSecurityID":    Snapshot,
+	"getLastPrice":     Snapshot,
+	"getDailySnapshot": Snapshot,
+	"getMarketStatus":  Snapshot,
+	"getSessionVWAP":   Snapshot,
+	"dateToSeconds":    Snapshot,
+
+	"generateChartImage":  Compute,
+	"getExhibitContent":   Compute,
+	"runWebSearch":        Compute,
+	"runScreener":         Compute,
+	"runStrategyScreener": Compute,
+
+	"runBacktest":          Backtest,
+	"getBacktestInstances": Backtest,
+
+	"runOptimizationSweep": Long,
+	"runPythonAgent":       Long,
+	"runStrategyAgent":     Long,
+	"simulateAlert":        Long,
+}
+
+// ForTool returns the budget of an agent tool
+func ForTool(name string) Class {
+	if c, ok := toolClasses[name]; ok {
+		return c
+	}
+	return Read
+}
+
+// Call runs fn with the class deadline on its context. If fn has not returned
+// by the deadline, or the caller's context ends first, Call returns at once
+// (an upstream_timeout error for the deadline) and fn keeps running in the
+// background; late, when set, receives its eventual result.
+func Call(ctx context.Context, conn *data.Conn, kind, name string, class Class, fn func(context.Context) (interface{}, error), late func(interface{}, error)) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(data.WithStatementBudget(ctx, class.Limit), class.Limit)
+	type outcome struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	start := time.Now()
+	go func() {
+		defer cancel()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("panic in %s %s: %v\n%s", kind, name, r, debug.Stack())
+				done <- outcome{err: fmt.Errorf("panic in %s: %v", name, r)}
+			}
+		}()
+		result, err := fn(ctx)
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case o := <-done:
+		if elapsed := time.Since(start); elapsed > class.Limit {
+			recordViolation(conn, kind, name, class, elapsed)
+		}
+		if o.err != nil && ctx.Err() == context.DeadlineExceeded {
+			return nil, timeoutError(name, class, o.err)
+		}
+		return o.result, o.err
+	case <-ctx.Done():
+		if late != nil {
+			go func() {
+				o := <-done
+				late(o.result, o.err)
+			}()
+		}
+		if ctx.Err() != context.DeadlineExceeded {
+			// The caller went away
+			return nil, ctx.Err()
+		}
+		recordViolation(conn, kind, name, class, time.Since(start))
+		return nil, timeoutError(name, class, ctx.Err())
+	}
+}
+
+// Measure runs fn, which takes no context and so can't be stopped, to
+// completion and counts it against class if it overruns. It sets no deadline.
+func Measure(conn *data.Conn, kind, name string, class Class, fn func() (interface{}, error)) (interface{}, error) {
+	start := time.Now()
+	defer func() {
+		if elapsed := time.Since(start); elapsed > class.Limit {
+			recordViolation(conn, kind, name, class, elapsed)
+		}
+	}()
+	return fn()
+}
+
+func timeoutError(name string, class Class, err error) error {
+	return apperr.Wrap(apperr.CodeUpstreamTimeout, err, "%s did not finish within its %s budget of %s", name, class.Name, class.Limit)
+}
+
+// violationKey holds one day of overrun counts, field "kind:class:name"
+func violationKey(day time.Time) string {
+	return "latency_budget:violations:" + day.UTC().Format("2006-01-02")
+}
+
+func recordViolation(conn *data.Conn, kind, name string, class Class, elapsed time.Duration) {
+	log.Printf("⚠️ %s %s took %s, over its %s budget of %s", kind, name, elapsed.Round(time.Millisecond), class.Name, class.Limit)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	violationCounter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("kind", kind),
+		attribute.String("name", name),
+		attribute.String("class", class.Name),
+	))
+	if conn == nil || conn.Cache == nil {
+		return
+	}
+	key := violationKey(time.Now())
+	pipe := conn.Cache.Pipeline()
+	pipe.HIncrBy(ctx, key, kind+":"+class.Name+":"+name, 1)
+	pipe.Expire(ctx, key, 8*24*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ Recording budget violation failed: %v", err)
+	}
+}
+
+// violationCounter exports overruns to whichever meter provider is installed
+var violationCounter, _ = otel.Meter("latency-budget").Int64Counter("latency_budget.violations",
+	metric.WithDescription("Calls that overran their latency budget"))
+
+// Violation is the number of overruns of one function on one day
+type Violation struct {
+	Day   string
+	Kind  string
+	Name  string
+	Class Class
+	Count int64
+}
+
+// Violations returns the recorded overruns of the last days days, newest first
+func Violations(ctx context.Context, conn *data.Conn, days int) ([]Violation, error) {
+	var out []Violation
+	now := time.Now()
+	for i := 0; i < days; i++ {
+		day := now.AddDate(0, 0, -i)
+		counts, err := conn.Cache.HGetAll(ctx, violationKey(day)).Result()
+		if err != nil {
+			return nil, fmt.Errorf("error reading budget violations: %v", err)
+		}
+		start := len(out)
+		for field, count := range counts {
+			parts := strings.SplitN(field, ":", 3)
+			if len(parts) != 3 {
+				continue
+			}
+			kind, name := parts[0], parts[2]
+			class, ok := classes[parts[1]]
+			if !ok {
+				class = Class{Name: parts[1]}
+			}
+			n, _ := strconv.ParseInt(count, 10, 64)
+			out = append(out, Violation{Day: day.UTC().Format("2006-01-02"), Kind: kind, Name: name, Class: class, Count: n})
+		}
+		dayViolations := out[start:]
+		sort.Slice(dayViolations, func(a, b int) bool { return dayViolations[a].Count > dayViolations[b].Count })
+	}
+	return out, nil
+}
@@ -0,0 +1,93 @@
+// Package client calls the backend's private API over HTTP. The typed methods
+// in client_gen.go are generated from the same definitions as the OpenAPI
+// document; regenerate them after changing a published function.
+package client
+
+//go:generate go run ../../cmd/apigen client_gen.go
+
+import (
+	"backend/internal/apperr"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the backend of a local development stack
+const DefaultBaseURL = "http://localhost:5058"
+
+// Client calls private functions as the user the token belongs to
+type Client struct {
+	BaseURL string
+	Token   string
+	HTTP    *http.Client
+}
+
+// New returns a client for the backend at baseURL
+func New(baseURL, token string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Token:   token,
+		HTTP:    &http.Client{Timeout: 10 * time.Minute},
+	}
+}
+
+type request struct {
+	Function  string      `json:"func"`
+	Arguments interface{} `json:"args"`
+}
+
+// Call invokes a private function by name and returns its raw JSON result.
+// Errors the server classified come back as *apperr.Error with the same code.
+func (c *Client) Call(ctx context.Context, function string, args interface{}) (json.RawMessage, error) {
+	if args == nil {
+		args = struct{}{}
+	}
+	body, err := json.Marshal(request{Function: function, Arguments: args})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding %s args: %v", function, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/private", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", c.Token)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling %s: %v", function, err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s response: %v", function, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		code := apperr.Code(resp.Header.Get("X-Error-Code"))
+		if code == "" {
+			code = apperr.CodeInternal
+		}
+		return nil, apperr.New(code, "%s: %s (%d)", function, strings.TrimSpace(string(raw)), resp.StatusCode)
+	}
+	return json.RawMessage(raw), nil
+}
+
+// decode calls a private function and decodes its result into out
+func (c *Client) decode(ctx context.Context, function string, args, out interface{}) error {
+	raw, err := c.Call(ctx, function, args)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("error decoding %s result: %v", function, err)
+	}
+	return nil
+}
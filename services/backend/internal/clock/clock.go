@@ -0,0 +1,100 @@
+// Package clock abstracts the wall clock so that scheduling and throttling
+// code can be driven by tests and replays. Real is the system clock. Fake
+// only moves when advanced, firing its timers and tickers as it passes their
+// deadlines. Frozen reports a fixed instant but lets its timers run in real
+// time, so loops keep ticking while every decision is made as of that
+// instant.
+package clock
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// Clock tells the time and makes timers
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) *Timer
+	NewTicker(d time.Duration) *Ticker
+}
+
+// Timer is a clock's time.Timer
+type Timer struct {
+	C     <-chan time.Time
+	stop  func() bool
+	reset func(time.Duration) bool
+}
+
+// Stop prevents the timer from firing and reports whether it was active
+func (t *Timer) Stop() bool { return t.stop() }
+
+// Reset reschedules the timer and reports whether it was active
+func (t *Timer) Reset(d time.Duration) bool { return t.reset(d) }
+
+// Ticker is a clock's time.Ticker
+type Ticker struct {
+	C     <-chan time.Time
+	stop  func()
+	reset func(time.Duration)
+}
+
+// Stop turns the ticker off
+func (t *Ticker) Stop() { t.stop() }
+
+// Reset changes the ticker's period
+func (t *Ticker) Reset(d time.Duration) { t.reset(d) }
+
+// Real is the system clock
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (realClock) NewTimer(d time.Duration) *Timer {
+	t := time.NewTimer(d)
+	return &Timer{C: t.C, stop: t.Stop, reset: t.Reset}
+}
+
+func (realClock) NewTicker(d time.Duration) *Ticker {
+	t := time.NewTicker(d)
+	return &Ticker{C: t.C, stop: t.Stop, reset: t.Reset}
+}
+
+// Frozen returns a clock that always reads at. Its timers and tickers run in
+// real time.
+func Frozen(at time.Time) Clock {
+	return frozenClock{realClock: realClock{}, at: at}
+}
+
+type frozenClock struct {
+	realClock
+	at time.Time
+}
+
+func (c frozenClock) Now() time.Time                  { return c.at }
+func (c frozenClock) Since(t time.Time) time.Duration { return c.at.Sub(t) }
+
+// FrozenEnv names an RFC 3339 instant at which Default freezes the clock
+const FrozenEnv = "CLOCK_FROZEN_AT"
+
+// Default is the clock services start with: Real, or Frozen at $CLOCK_FROZEN_AT
+// to replay a past session's alert and scheduling decisions
+func Default() Clock {
+	v := os.Getenv(FrozenEnv)
+	if v == "" {
+		return Real
+	}
+	at, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		log.Printf("⚠️ Ignoring %s=%q: %v", FrozenEnv, v, err)
+		return Real
+	}
+	log.Printf("🕰️ Clock frozen at %s", at.Format(time.RFC3339))
+	return Frozen(at)
+}
@@ -0,0 +1,145 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a clock that only moves when Advance or Set is called
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*waiter
+}
+
+// waiter is a pending timer, or a ticker when period is set
+type waiter struct {
+	at     time.Time
+	period time.Duration
+	ch     chan time.Time
+}
+
+// NewFake returns a fake clock reading start
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start}
+}
+
+// Now returns the fake time
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Since returns the fake time elapsed since t
+func (f *Fake) Since(t time.Time) time.Duration { return f.Now().Sub(t) }
+
+// After fires once the fake time has advanced by d
+func (f *Fake) After(d time.Duration) <-chan time.Time { return f.NewTimer(d).C }
+
+// NewTimer returns a timer that fires once the fake time has advanced by d
+func (f *Fake) NewTimer(d time.Duration) *Timer {
+	w := &waiter{ch: make(chan time.Time, 1)}
+	f.schedule(w, d)
+	return &Timer{
+		C:    w.ch,
+		stop: func() bool { return f.remove(w) },
+		reset: func(d time.Duration) bool {
+			active := f.remove(w)
+			f.schedule(w, d)
+			return active
+		},
+	}
+}
+
+// NewTicker returns a ticker that fires each time the fake time passes
+// another period. Like time.Ticker it drops ticks a slow reader misses.
+func (f *Fake) NewTicker(d time.Duration) *Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	w := &waiter{period: d, ch: make(chan time.Time, 1)}
+	f.schedule(w, d)
+	return &Ticker{
+		C:    w.ch,
+		stop: func() { f.remove(w) },
+		reset: func(d time.Duration) {
+			f.remove(w)
+			w.period = d
+			f.schedule(w, d)
+		},
+	}
+}
+
+// Advance moves the fake time forward by d
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the fake time to t, firing every timer and ticker due by then in
+// deadline order
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t.Before(f.now) {
+		f.now = t
+		return
+	}
+	for len(f.waiters) > 0 && !f.waiters[0].at.After(t) {
+		w := f.waiters[0]
+		f.now = w.at
+		select {
+		case w.ch <- w.at:
+		default:
+		}
+		f.waiters = f.waiters[1:]
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+			f.insert(w)
+		}
+	}
+	f.now = t
+}
+
+// Waiters returns the number of pending timers and tickers
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil waits until at least n timers and tickers are pending, so a
+// test can advance the clock only once the code under test is waiting on it
+func (f *Fake) BlockUntil(n int) {
+	for f.Waiters() < n {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (f *Fake) schedule(w *waiter, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.at = f.now.Add(d)
+	f.insert(w)
+}
+
+// insert keeps waiters sorted by deadline; callers hold mu
+func (f *Fake) insert(w *waiter) {
+	i := sort.Search(len(f.waiters), func(i int) bool { return f.waiters[i].at.After(w.at) })
+	f.waiters = append(f.waiters, nil)
+	copy(f.waiters[i+1:], f.waiters[i:])
+	f.waiters[i] = w
+}
+
+func (f *Fake) remove(w *waiter) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, x := range f.waiters {
+		if x == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -131,6 +131,7 @@ func InitConn(inContainer bool) (*Conn, func()) {
 				poolConfig.MaxConnIdleTime = 5 * time.Minute            // FIXED: Increased from 1 minute to reduce connection churn
 				poolConfig.HealthCheckPeriod = 30 * time.Second         // FIXED: Increased from 15 seconds for more frequent health checks
 				poolConfig.ConnConfig.ConnectTimeout = 10 * time.Second // FIXED: Increased from 5 seconds for slower connections
+				watchQueries(poolConfig)                                // Per-class statement timeouts, see querywatch.go
 				/*poolConfig.BeforeConnect = func(ctx context.Context, cc *pgx.ConnConfig) error {
 					// Validate connection before use
 					return nil
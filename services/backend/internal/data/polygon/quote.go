@@ -7,7 +7,10 @@ import (
 	"backend/internal/data/postgres"
 	"backend/internal/data/utils"
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 
 	//	"log"
 	"sync"
@@ -485,11 +488,22 @@ func GetPolygonTickerSnapshot(ctx context.Context, client *polygon.Client, ticke
 	}
 	res, err := client.GetTickerSnapshot(ctx, &params)
 	if err != nil {
-		return nil, fmt.Errorf("error getting ticker snapshot: %v", err)
+		return nil, fmt.Errorf("error getting ticker snapshot: %w", err)
 	}
 	return res, nil
 }
 
+// Outage returns err if it means Polygon itself is failing (a network error,
+// a 5xx or rate limiting) and nil for answers about the request, such as an
+// unknown ticker, so those don't count against the Polygon circuit breaker
+func Outage(err error) error {
+	var resp *models.ErrorResponse
+	if errors.As(err, &resp) && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+	return err
+}
+
 // GetPolygonAllTickerSnapshots returns real-time snapshots for all tickers.
 func GetPolygonAllTickerSnapshots(ctx context.Context, client *polygon.Client) (*models.GetAllTickersSnapshotResponse, error) {
 	params := models.GetAllTickersSnapshotParams{
@@ -503,6 +517,20 @@ func GetPolygonAllTickerSnapshots(ctx context.Context, client *polygon.Client) (
 	return res, nil
 }
 
+// GetPolygonTickerSnapshots returns real-time snapshots for the given tickers
+// in one request. Tickers Polygon doesn't know are left out of the response.
+func GetPolygonTickerSnapshots(ctx context.Context, client *polygon.Client, tickers []string) (*models.GetAllTickersSnapshotResponse, error) {
+	params := models.GetAllTickersSnapshotParams{
+		Locale:     "us",
+		MarketType: "stocks",
+	}.WithTickers(strings.Join(tickers, ","))
+	res, err := client.GetAllTickersSnapshot(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ticker snapshots: %w", err)
+	}
+	return res, nil
+}
+
 // GetDailyOHLCVForTickerResponse contains the open, high, low, close, and volume for a given day.
 type GetDailyOHLCVForTickerResponse struct {
 	Open   float64 `json:"open"`
@@ -0,0 +1,211 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Every query runs under a statement_timeout for its connection class.
+// Interactive queries, made on behalf of an HTTP request or agent tool, get
+// the request's latency budget; everything else is batch work with a long
+// budget. The pool sets the timeout when a connection is acquired for a
+// different budget than it last served, and a watchdog cancels queries that
+// outlive their budget anyway (a session that lifted its own timeout, or one
+// stuck where the timeout doesn't reach) and logs them with the request that
+// started them.
+const (
+	QueryClassInteractive = "interactive"
+	QueryClassBatch       = "batch"
+
+	queryWatchInterval = 5 * time.Second
+	// The watchdog leaves statement_timeout this long to act first
+	queryWatchGrace = 5 * time.Second
+	queryLogLength  = 500
+)
+
+// BatchStatementTimeout is the budget of queries not made for a request;
+// DB_BATCH_STATEMENT_TIMEOUT overrides it
+var BatchStatementTimeout = envDuration("DB_BATCH_STATEMENT_TIMEOUT", 30*time.Minute)
+
+// QueryTag is what the pool knows about the caller of a query
+type QueryTag struct {
+	RequestID string
+	Class     string
+	Timeout   time.Duration
+}
+
+type queryTagKey struct{}
+
+// QueryTagFrom returns the tag on ctx, batch class by default
+func QueryTagFrom(ctx context.Context) QueryTag {
+	if tag, ok := ctx.Value(queryTagKey{}).(QueryTag); ok {
+		return tag
+	}
+	return QueryTag{Class: QueryClassBatch, Timeout: BatchStatementTimeout}
+}
+
+// WithRequestID tags queries made with ctx with the request they serve
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	tag := QueryTagFrom(ctx)
+	tag.RequestID = requestID
+	return context.WithValue(ctx, queryTagKey{}, tag)
+}
+
+// WithStatementBudget makes queries made with ctx interactive, with timeout
+// as their statement_timeout
+func WithStatementBudget(ctx context.Context, timeout time.Duration) context.Context {
+	tag := QueryTagFrom(ctx)
+	tag.Class = QueryClassInteractive
+	tag.Timeout = timeout
+	return context.WithValue(ctx, queryTagKey{}, tag)
+}
+
+// pooledConn is what the watchdog tracks per backend
+type pooledConn struct {
+	conn    *pgx.Conn
+	timeout time.Duration // statement_timeout currently set on the session
+	active  *QueryTag     // the acquirer, while acquired
+}
+
+var (
+	pooledConnsMu sync.Mutex
+	pooledConns   = map[uint32]*pooledConn{} // by backend pid
+)
+
+// watchQueries installs the statement timeout hooks on a pool config. The
+// session default is the batch budget, so connections of pools copied from
+// this config (the bulk load pool) start out batch too.
+func watchQueries(cfg *pgxpool.Config) {
+	cfg.ConnConfig.RuntimeParams["statement_timeout"] = fmt.Sprint(BatchStatementTimeout.Milliseconds())
+	cfg.ConnConfig.RuntimeParams["application_name"] = "peripheral-backend"
+	cfg.BeforeAcquire = beforeAcquire
+	cfg.AfterRelease = afterRelease
+}
+
+func beforeAcquire(ctx context.Context, c *pgx.Conn) bool {
+	tag := QueryTagFrom(ctx)
+	pid := c.PgConn().PID()
+	pooledConnsMu.Lock()
+	pc := pooledConns[pid]
+	if pc == nil || pc.conn != c {
+		pc = &pooledConn{conn: c, timeout: BatchStatementTimeout}
+		pooledConns[pid] = pc
+	}
+	current := pc.timeout
+	pooledConnsMu.Unlock()
+
+	if current != tag.Timeout {
+		// Not tied to ctx: a cancelled acquire mustn't leave the setting unknown
+		setCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		_, err := c.Exec(setCtx, fmt.Sprintf("SET statement_timeout = %d", tag.Timeout.Milliseconds()))
+		cancel()
+		if err != nil {
+			log.Printf("⚠️ Setting statement_timeout on pid %d: %v", pid, err)
+			return false // drop the connection; the pool dials another
+		}
+	}
+
+	pooledConnsMu.Lock()
+	pc.timeout = tag.Timeout
+	pc.active = &tag
+	pooledConnsMu.Unlock()
+	return true
+}
+
+func afterRelease(c *pgx.Conn) bool {
+	pooledConnsMu.Lock()
+	if pc := pooledConns[c.PgConn().PID()]; pc != nil && pc.conn == c {
+		pc.active = nil
+	}
+	pooledConnsMu.Unlock()
+	return true
+}
+
+// StartQueryWatchdog cancels this process's queries that run past their
+// budget
+func StartQueryWatchdog(conn *Conn) {
+	go func() {
+		ticker := time.NewTicker(queryWatchInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := cancelOverdueQueries(conn); err != nil {
+				log.Printf("⚠️ Query watchdog: %v", err)
+			}
+		}
+	}()
+}
+
+func cancelOverdueQueries(conn *Conn) error {
+	var pids []int32
+	var budgets []float64
+	tags := map[int32]QueryTag{}
+	pooledConnsMu.Lock()
+	for pid, pc := range pooledConns {
+		if pc.conn.IsClosed() {
+			delete(pooledConns, pid)
+			continue
+		}
+		if pc.active == nil {
+			continue
+		}
+		pids = append(pids, int32(pid)) // #nosec G115 -- postgres pids fit in int32
+		budgets = append(budgets, (pc.active.Timeout + queryWatchGrace).Seconds())
+		tags[int32(pid)] = *pc.active // #nosec G115
+	}
+	pooledConnsMu.Unlock()
+	if len(pids) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryWatchInterval)
+	defer cancel()
+	rows, err := conn.DB.Query(ctx, `
+		SELECT a.pid, left(a.query, $3), EXTRACT(EPOCH FROM now() - a.query_start), pg_cancel_backend(a.pid)
+		FROM pg_stat_activity a
+		JOIN unnest($1::int[], $2::float8[]) AS w(pid, budget_seconds) ON w.pid = a.pid
+		WHERE a.state = 'active' AND a.query_start < now() - make_interval(secs => w.budget_seconds)`,
+		pids, budgets, queryLogLength)
+	if err != nil {
+		return fmt.Errorf("cancelling overdue queries: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pid int32
+		var query string
+		var seconds float64
+		var cancelled bool
+		if err := rows.Scan(&pid, &query, &seconds, &cancelled); err != nil {
+			return fmt.Errorf("scanning overdue query: %w", err)
+		}
+		tag := tags[pid]
+		requestID := tag.RequestID
+		if requestID == "" {
+			requestID = "none"
+		}
+		log.Printf("🛑 Killed %s query on pid %d after %s (budget %s, request %s, cancelled=%t): %s",
+			tag.Class, pid, time.Duration(seconds*float64(time.Second)).Round(time.Millisecond), tag.Timeout,
+			requestID, cancelled, strings.Join(strings.Fields(query), " "))
+	}
+	return rows.Err()
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("⚠️ Ignoring %s=%q: want a positive duration such as 30m", key, v)
+		return fallback
+	}
+	return d
+}
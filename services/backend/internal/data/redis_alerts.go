@@ -2,6 +2,7 @@ package data
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"strconv"
@@ -25,7 +26,8 @@ var (
 	universeDiscoveries int64
 )
 
-// GetAlertMetrics returns current Redis operation metrics
+// GetAlertMetrics returns Redis operation metrics counted since the last
+// rollup into alert_metric_buckets (see TakeAlertCounters)
 func GetAlertMetrics() map[string]int64 {
 	return map[string]int64{
 		"ticker_updates":     atomic.LoadInt64(&tickerUpdateCount),
@@ -188,6 +190,33 @@ func GetStrategyLastBuckets(conn *Conn, strategyID int, tickers []string) (map[s
 	return result, nil
 }
 
+// LatestTickerUpdate returns the newest update timestamp (ms) among tickers,
+// or across every tracked ticker when tickers is empty. It is 0 when none of
+// them has been updated.
+func LatestTickerUpdate(conn *Conn, tickers []string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if len(tickers) == 0 {
+		latest, err := conn.Cache.ZRevRangeWithScores(ctx, "TICK:UPD", 0, 0).Result()
+		if err != nil || len(latest) == 0 {
+			return 0, err
+		}
+		return int64(latest[0].Score), nil
+	}
+	scores, err := conn.Cache.ZMScore(ctx, "TICK:UPD", tickers...).Result()
+	if err != nil {
+		return 0, err
+	}
+	var newest float64
+	for _, score := range scores {
+		if score > newest {
+			newest = score
+		}
+	}
+	return int64(newest), nil
+}
+
 // SetStrategyLastBuckets updates the last trigger bucket timestamps for specific tickers in a strategy
 func SetStrategyLastBuckets(conn *Conn, strategyID int, tickerBuckets map[string]int64) error {
 	if len(tickerBuckets) == 0 {
@@ -319,6 +348,39 @@ func IntersectTickersServerSide(conn *Conn, strategyID int, sinceMs int64) ([]st
 	return tickers, nil
 }
 
+// alertCounters are the counters by the name they are reported under
+var alertCounters = map[string]*int64{
+	"ticker_updates":       &tickerUpdateCount,
+	"universe_updates":     &universeUpdateCount,
+	"strategy_runs":        &strategyRuns,
+	"skipped_no_update":    &skippedNoUpdate,
+	"skipped_bucket_dup":   &skippedBucketDup,
+	"cleanup_operations":   &cleanupOperations,
+	"lua_intersections":    &luaIntersections,
+	"universe_discoveries": &universeDiscoveries,
+}
+
+// TakeAlertCounters returns what each counter has counted since it was last
+// taken and resets it, so the counts can be stored as time buckets. The
+// counters read by GetAlertMetrics start over too.
+func TakeAlertCounters() map[string]int64 {
+	taken := make(map[string]int64, len(alertCounters))
+	for name, counter := range alertCounters {
+		taken[name] = atomic.SwapInt64(counter, 0)
+	}
+	return taken
+}
+
+// RestoreAlertCounters adds counts taken by TakeAlertCounters back, for when
+// they could not be stored
+func RestoreAlertCounters(taken map[string]int64) {
+	for name, n := range taken {
+		if counter, ok := alertCounters[name]; ok {
+			atomic.AddInt64(counter, n)
+		}
+	}
+}
+
 // IncrementCleanupOperations tracks cleanup operations
 func IncrementCleanupOperations() {
 	atomic.AddInt64(&cleanupOperations, 1)
@@ -351,3 +413,111 @@ func GetDetailedAlertMetrics(conn *Conn) map[string]interface{} {
 		"total_ticker_updates": tickerCount,
 	}
 }
+
+// Outcomes of evaluating a strategy alert in one processing cycle
+const (
+	EvalRun              = "run"
+	EvalSkippedNoUpdate  = "skipped_no_update"
+	EvalSkippedBucketDup = "skipped_bucket_dup"
+	EvalSkippedPaused    = "skipped_queue_paused"
+	EvalFailed           = "failed"
+)
+
+const (
+	// strategyEvalEntries caps each strategy's ring buffer. Consecutive cycles
+	// with the same outcome and reason share an entry, so this covers several
+	// sessions of a quiet strategy.
+	strategyEvalEntries = 2000
+	strategyEvalTTL     = 7 * 24 * time.Hour
+)
+
+// StrategyEvaluation records what the alert loop did with a strategy. First
+// and Last bound the cycles folded into the entry and Count is how many there
+// were.
+type StrategyEvaluation struct {
+	First   time.Time  `json:"first"`
+	Last    time.Time  `json:"last"`
+	Count   int        `json:"count"`
+	Outcome string     `json:"outcome"`
+	Reason  string     `json:"reason"`
+	Bucket  *time.Time `json:"bucket,omitempty"`
+	Tickers int        `json:"tickers,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+func strategyEvalKey(strategyID int) string {
+	return fmt.Sprintf("STRAT:%d:EVAL", strategyID)
+}
+
+// sameEvaluation reports whether two cycles can share a ring buffer entry
+func sameEvaluation(a, b StrategyEvaluation) bool {
+	if a.Outcome != b.Outcome || a.Reason != b.Reason || a.Error != b.Error || a.Tickers != b.Tickers {
+		return false
+	}
+	if a.Bucket == nil || b.Bucket == nil {
+		return a.Bucket == nil && b.Bucket == nil
+	}
+	return a.Bucket.Equal(*b.Bucket)
+}
+
+// RecordStrategyEvaluation appends one cycle's outcome to the strategy's
+// evaluation ring buffer, newest first. A cycle that repeats the newest entry
+// extends it instead of pushing a new one. Only the alert loop writes these
+// keys and it evaluates a strategy once per cycle, so the read-modify-write
+// doesn't race.
+func RecordStrategyEvaluation(conn *Conn, strategyID int, at time.Time, eval StrategyEvaluation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	key := strategyEvalKey(strategyID)
+	eval.First, eval.Last, eval.Count = at, at, 1
+
+	replace := false
+	if raw, err := conn.Cache.LIndex(ctx, key, 0).Bytes(); err == nil {
+		var head StrategyEvaluation
+		if json.Unmarshal(raw, &head) == nil && sameEvaluation(head, eval) {
+			eval.First, eval.Count = head.First, head.Count+1
+			replace = true
+		}
+	} else if err != redis.Nil {
+		return fmt.Errorf("reading strategy %d evaluations: %w", strategyID, err)
+	}
+
+	raw, err := json.Marshal(eval)
+	if err != nil {
+		return fmt.Errorf("encoding strategy evaluation: %w", err)
+	}
+	pipe := conn.Cache.Pipeline()
+	if replace {
+		pipe.LSet(ctx, key, 0, raw)
+	} else {
+		pipe.LPush(ctx, key, raw)
+		pipe.LTrim(ctx, key, 0, strategyEvalEntries-1)
+	}
+	pipe.Expire(ctx, key, strategyEvalTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("recording strategy %d evaluation: %w", strategyID, err)
+	}
+	return nil
+}
+
+// GetStrategyEvaluations returns a strategy's recorded evaluations, newest
+// first
+func GetStrategyEvaluations(conn *Conn, strategyID int) ([]StrategyEvaluation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	raws, err := conn.Cache.LRange(ctx, strategyEvalKey(strategyID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("reading strategy %d evaluations: %w", strategyID, err)
+	}
+	evals := make([]StrategyEvaluation, 0, len(raws))
+	for _, raw := range raws {
+		var eval StrategyEvaluation
+		if err := json.Unmarshal([]byte(raw), &eval); err != nil {
+			continue
+		}
+		evals = append(evals, eval)
+	}
+	return evals, nil
+}
@@ -0,0 +1,143 @@
+// Package dryrun simulates the mutations that leave the backend for the
+// workers and the users: queued worker tasks and notifications. In a dry run
+// they are logged as what would have been done instead of happening. A dry
+// run is either global, for staging environments (DRY_RUN=true or the
+// dry_run feature flag), or scoped to one request or job run, whose context
+// carries a Recorder collecting the actions so they can be returned.
+//
+// Database writes still happen. A dry run stops a flow at its first worker
+// task, whose result isn't known; notifications count as sent and the flow
+// goes on.
+package dryrun
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/services/flags"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of simulated actions
+const (
+	KindTask         = "task"
+	KindNotification = "notification"
+)
+
+// maxRecorded bounds the actions one recorder keeps
+const maxRecorded = 500
+
+// ErrSimulated is wrapped by the error a worker task submission returns in a
+// dry run
+var ErrSimulated = errors.New("dry run")
+
+// Action is a mutation a dry run skipped
+type Action struct {
+	Kind string `json:"kind"`
+	// Target is the task type, or the notification channel
+	Target  string                 `json:"target"`
+	Summary string                 `json:"summary"`
+	Detail  map[string]interface{} `json:"detail,omitempty"`
+	At      time.Time              `json:"at"`
+}
+
+// Recorder collects the actions of a scoped dry run
+type Recorder struct {
+	mu      sync.Mutex
+	actions []Action
+	dropped int
+}
+
+// Actions returns the recorded actions, oldest first
+func (r *Recorder) Actions() []Action {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Action(nil), r.actions...)
+}
+
+// Dropped is how many actions went past the recorder's limit
+func (r *Recorder) Dropped() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dropped
+}
+
+type recorderKey struct{}
+
+// WithRecorder returns a context under which worker tasks and notifications
+// are simulated and recorded on the returned Recorder
+func WithRecorder(ctx context.Context) (context.Context, *Recorder) {
+	r := &Recorder{}
+	return context.WithValue(ctx, recorderKey{}, r), r
+}
+
+func recorderFrom(ctx context.Context) *Recorder {
+	if ctx == nil {
+		return nil
+	}
+	r, _ := ctx.Value(recorderKey{}).(*Recorder)
+	return r
+}
+
+var envDryRun = parseEnv(os.Getenv("DRY_RUN"))
+
+func parseEnv(v string) bool {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// Global reports whether the whole backend runs dry
+func Global() bool {
+	return envDryRun || flags.IsEnabled(context.Background(), flags.DryRun, 0)
+}
+
+// Active reports whether mutations under ctx are simulated, by a global dry
+// run or one scoped to ctx. ctx may be nil where none is at hand.
+func Active(ctx context.Context) bool {
+	return recorderFrom(ctx) != nil || Global()
+}
+
+// Record logs a simulated action and adds it to ctx's recorder, if any
+func Record(ctx context.Context, kind, target, summary string, detail map[string]interface{}) {
+	log.Printf("🧪 Dry run: would have %s", summary)
+	r := recorderFrom(ctx)
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.actions) >= maxRecorded {
+		r.dropped++
+		return
+	}
+	r.actions = append(r.actions, Action{Kind: kind, Target: target, Summary: summary, Detail: detail, At: time.Now()})
+}
+
+// Task records a worker task that was not queued and returns the error its
+// submission fails with
+func Task(ctx context.Context, taskType string, args map[string]interface{}, priority bool) error {
+	Record(ctx, KindTask, taskType, fmt.Sprintf("queued a %s task", taskType), map[string]interface{}{
+		"args":     args,
+		"priority": priority,
+	})
+	return apperr.Wrap(apperr.CodeUnavailable, fmt.Errorf("%w: the %s task was not queued", ErrSimulated, taskType),
+		"Background tasks are simulated in this dry run and did not run.")
+}
+
+// Notify records a notification over channel instead of sending it when
+// mutations under ctx are simulated, and reports whether it did
+func Notify(ctx context.Context, channel, summary string, detail map[string]interface{}) bool {
+	if !Active(ctx) {
+		return false
+	}
+	Record(ctx, KindNotification, channel, summary, detail)
+	return true
+}
@@ -0,0 +1,160 @@
+package queue
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Queue consumption can be paused or drained for deploys and incidents. The
+// state lives in Redis so every backend and worker sees the same one:
+//
+//   - running: tasks are accepted and workers pull them
+//   - paused: new tasks are refused and workers stop pulling; queued tasks
+//     wait for resume
+//   - draining: new tasks are refused but workers keep pulling until the
+//     queues are empty and nothing is in flight
+//
+// Keep the key and states in sync with services/worker/src/utils/queue_control.py.
+const (
+	QueueRunning  = "running"
+	QueuePaused   = "paused"
+	QueueDraining = "draining"
+
+	controlKey = "queue:control"
+	// inFlightKey is a hash of worker id -> the task it is running, kept by
+	// the workers
+	inFlightKey = "queue:inflight"
+)
+
+// ErrQueuePaused is wrapped by the error Task returns while the queue is
+// paused or draining
+var ErrQueuePaused = errors.New("task queue is not accepting tasks")
+
+// ControlState is the queue's current mode
+type ControlState struct {
+	State  string    `json:"state"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since,omitempty"`
+}
+
+// InFlightTask is a task a worker has pulled and not finished
+type InFlightTask struct {
+	WorkerID  string    `json:"workerId"`
+	TaskID    string    `json:"taskId"`
+	TaskType  string    `json:"taskType"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// ControlStatus is the queue's mode plus what is still waiting or running
+type ControlStatus struct {
+	ControlState
+	Queued         int64          `json:"queued"`
+	PriorityQueued int64          `json:"priorityQueued"`
+	InFlight       []InFlightTask `json:"inFlight"`
+	// Drained is set once a draining queue has nothing left to finish
+	Drained bool `json:"drained"`
+}
+
+// GetControlState reads the queue's mode; no state stored means running
+func GetControlState(ctx context.Context, conn *data.Conn) (ControlState, error) {
+	fields, err := conn.Cache.HGetAll(ctx, controlKey).Result()
+	if err != nil {
+		return ControlState{}, fmt.Errorf("reading queue state: %w", err)
+	}
+	state := ControlState{State: fields["state"], Reason: fields["reason"]}
+	if state.State == "" {
+		state.State = QueueRunning
+	}
+	if ms, err := strconv.ParseInt(fields["since"], 10, 64); err == nil {
+		state.Since = time.UnixMilli(ms)
+	}
+	return state, nil
+}
+
+// SetControlState switches the queue to state. Resuming clears the stored
+// state entirely.
+func SetControlState(ctx context.Context, conn *data.Conn, state, reason string) (ControlState, error) {
+	switch state {
+	case QueueRunning:
+		if err := conn.Cache.Del(ctx, controlKey).Err(); err != nil {
+			return ControlState{}, fmt.Errorf("resuming queue: %w", err)
+		}
+		return ControlState{State: QueueRunning}, nil
+	case QueuePaused, QueueDraining:
+	default:
+		return ControlState{}, apperr.Validation("unknown queue state %q; use %s, %s or %s", state, QueueRunning, QueuePaused, QueueDraining)
+	}
+	now := Clock.Now()
+	err := conn.Cache.HSet(ctx, controlKey,
+		"state", state,
+		"reason", reason,
+		"since", strconv.FormatInt(now.UnixMilli(), 10)).Err()
+	if err != nil {
+		return ControlState{}, fmt.Errorf("setting queue state: %w", err)
+	}
+	return ControlState{State: state, Reason: reason, Since: now}, nil
+}
+
+// GetControlStatus reports the queue's mode, queue lengths and the tasks
+// workers are still running
+func GetControlStatus(ctx context.Context, conn *data.Conn) (*ControlStatus, error) {
+	state, err := GetControlState(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	status := &ControlStatus{ControlState: state, InFlight: []InFlightTask{}}
+	if status.Queued, err = conn.Cache.LLen(ctx, "task_queue").Result(); err != nil {
+		return nil, fmt.Errorf("reading queue length: %w", err)
+	}
+	if status.PriorityQueued, err = conn.Cache.LLen(ctx, "priority_task_queue").Result(); err != nil {
+		return nil, fmt.Errorf("reading priority queue length: %w", err)
+	}
+	running, err := conn.Cache.HGetAll(ctx, inFlightKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("reading in-flight tasks: %w", err)
+	}
+	for workerID, raw := range running {
+		var task struct {
+			TaskID    string  `json:"task_id"`
+			TaskType  string  `json:"task_type"`
+			StartedAt float64 `json:"started_at"` // unix seconds
+		}
+		if err := json.Unmarshal([]byte(raw), &task); err != nil {
+			continue
+		}
+		status.InFlight = append(status.InFlight, InFlightTask{
+			WorkerID:  workerID,
+			TaskID:    task.TaskID,
+			TaskType:  task.TaskType,
+			StartedAt: time.UnixMilli(int64(task.StartedAt * 1000)),
+		})
+	}
+	sort.Slice(status.InFlight, func(i, j int) bool {
+		return status.InFlight[i].StartedAt.Before(status.InFlight[j].StartedAt)
+	})
+	status.Drained = state.State == QueueDraining && status.Queued == 0 && status.PriorityQueued == 0 && len(status.InFlight) == 0
+	return status, nil
+}
+
+// checkAccepting refuses new tasks while the queue is paused or draining. If
+// the state can't be read the task is let through; pushing it will surface
+// the Redis error.
+func checkAccepting(ctx context.Context, conn *data.Conn) error {
+	state, err := conn.Cache.HGet(ctx, controlKey, "state").Result()
+	if err != nil && err != redis.Nil {
+		return nil
+	}
+	if state == QueuePaused || state == QueueDraining {
+		return apperr.Wrap(apperr.CodeUnavailable, ErrQueuePaused, "Background tasks are paused for maintenance. Please try again shortly.")
+	}
+	return nil
+}
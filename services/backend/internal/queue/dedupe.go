@@ -0,0 +1,333 @@
+package queue
+
+import (
+	"backend/internal/data"
+	"backend/internal/dryrun"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Identical tasks submitted while one is in flight (the same alert evaluated
+// by two replicas, or a retry racing the first attempt) share one worker run
+// instead of each doing the work. The first submitter claims a short-lived
+// key derived from the task's type and arguments and queues the task; later
+// submitters find the key and await that task instead. The submitter that
+// queued it stores the final update under the task for a little while and
+// announces it, so those who join just as it finishes still get it. Within a
+// process, submitters of the same task share one wait.
+const (
+	dedupeKey     = "task_dedupe:%s"  // dedupeRecord, by task hash
+	outcomeKey    = "task_outcome:%s" // final ResultUpdate, by task ID
+	outcomeChan   = "task_done:%s"    // announces the final ResultUpdate, by task ID
+	outcomeTTL    = 2 * time.Minute
+	claimAttempts = 3
+)
+
+// dedupeRecord is what a claim holds: the task to await instead
+type dedupeRecord struct {
+	TaskID string `json:"task_id"`
+	// Deadline (wall clock) is when the submitter stops waiting on the task
+	Deadline time.Time `json:"deadline"`
+}
+
+// flight is one in-flight task as this process sees it, whether it queued
+// the task or awaits one another replica queued
+type flight struct {
+	key      string
+	taskType string
+	taskID   string
+	deadline time.Time
+	record   string // the claim's value, when this process holds it
+
+	ready     chan struct{} // closed once taskID and deadline are known, or err
+	readyOnce sync.Once
+	err       error
+	done      chan struct{} // closed once result is set
+	doneOnce  sync.Once
+	result    ResultUpdate
+}
+
+var (
+	flightsMu sync.Mutex
+	flights   = map[string]*flight{}
+)
+
+// DedupedTask is Task for tasks that are safe to share: if an identical task
+// (same type and arguments, symbols in any order) is already in flight, here
+// or on another replica, it returns a handle on that one instead of queuing
+// another. Handles on a shared task only get its final update, and
+// cancelling one only stops that caller waiting: the run is watched to its
+// end even when the submitter that queued it gives up.
+func DedupedTask(ctx context.Context, conn *data.Conn, taskType string, args map[string]interface{}, priority bool, maxRetries int, timeout time.Duration) (*Handle, error) {
+	if dryrun.Active(ctx) {
+		return Task(ctx, conn, taskType, args, priority, maxRetries, timeout)
+	}
+	hash, err := taskHash(taskType, args)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf(dedupeKey, hash)
+
+	// A flight that fails to get going is dropped, so the next pass leads one
+	for pass := 0; ; pass++ {
+		flightsMu.Lock()
+		f, joined := flights[key]
+		if !joined {
+			f = &flight{key: key, taskType: taskType, ready: make(chan struct{}), done: make(chan struct{})}
+			flights[key] = f
+		}
+		flightsMu.Unlock()
+
+		if !joined {
+			return enqueue(ctx, conn, taskType, args, priority, maxRetries, timeout, f)
+		}
+		select {
+		case <-f.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if f.err == nil {
+			log.Printf("♻️ Joining in-flight %s task %s", taskType, f.taskID)
+			return f.handle(conn), nil
+		}
+		if pass > 0 {
+			return nil, f.err
+		}
+	}
+}
+
+// taskHash identifies a task by its type and arguments. Symbol lists are
+// sets to the worker, so their order doesn't count.
+func taskHash(taskType string, args map[string]interface{}) (string, error) {
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal task args: %w", err)
+	}
+	var canonical interface{}
+	if err := json.Unmarshal(raw, &canonical); err != nil {
+		return "", fmt.Errorf("failed to canonicalize task args: %w", err)
+	}
+	sortSymbols(canonical)
+	// Maps marshal with sorted keys
+	raw, err = json.Marshal(canonical)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal task args: %w", err)
+	}
+	sum := sha256.Sum256(append([]byte(taskType+"\x00"), raw...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func sortSymbols(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if symbols, ok := child.([]interface{}); ok && k == "symbols" {
+				sort.SliceStable(symbols, func(i, j int) bool {
+					return fmt.Sprint(symbols[i]) < fmt.Sprint(symbols[j])
+				})
+				continue
+			}
+			sortSymbols(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			sortSymbols(child)
+		}
+	}
+}
+
+// claim makes this process the one to queue taskID, unless another submitter
+// already holds the task, in which case the flight takes on theirs
+func (f *flight) claim(ctx context.Context, conn *data.Conn, taskID string, deadline time.Time) (bool, error) {
+	raw, err := json.Marshal(dedupeRecord{TaskID: taskID, Deadline: wallClock(deadline)})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal task claim: %w", err)
+	}
+	ttl := deadline.Sub(Clock.Now()) + awaitGrace
+	for attempt := 0; attempt < claimAttempts; attempt++ {
+		claimed, err := conn.Cache.SetNX(ctx, f.key, raw, ttl).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to claim %s task: %w", f.taskType, err)
+		}
+		if claimed {
+			f.taskID, f.deadline, f.record = taskID, deadline, string(raw)
+			return true, nil
+		}
+		held, err := conn.Cache.Get(ctx, f.key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue // it finished in between
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s task claim: %w", f.taskType, err)
+		}
+		var record dedupeRecord
+		if err := json.Unmarshal(held, &record); err != nil {
+			return false, fmt.Errorf("failed to parse %s task claim: %w", f.taskType, err)
+		}
+		f.taskID = record.TaskID
+		f.deadline = Clock.Now().Add(time.Until(record.Deadline))
+		return false, nil
+	}
+	return false, fmt.Errorf("%s task claim kept changing hands", f.taskType)
+}
+
+// follow awaits the final update of a task another replica queued. It waits
+// on its own past the caller's context, since other callers here may join it.
+func (f *flight) follow(ctx context.Context, conn *data.Conn) (*Handle, error) {
+	channel := fmt.Sprintf(outcomeChan, f.taskID)
+	outcome, err := statusDispatcherFor(conn.Cache).subscribe(ctx, channel)
+	if err != nil {
+		return nil, err
+	}
+	// Subscribed first, so an outcome stored after this read is announced to us
+	if raw, err := conn.Cache.Get(ctx, fmt.Sprintf(outcomeKey, f.taskID)).Bytes(); err == nil {
+		statusDispatcherFor(conn.Cache).unsubscribe(outcome)
+		f.settleRaw(raw)
+	} else {
+		go f.awaitOutcome(conn, outcome)
+	}
+	f.markReady(nil)
+	log.Printf("♻️ Awaiting %s task %s queued elsewhere", f.taskType, f.taskID)
+	return f.handle(conn), nil
+}
+
+func (f *flight) awaitOutcome(conn *data.Conn, outcome *statusWaiter) {
+	defer statusDispatcherFor(conn.Cache).unsubscribe(outcome)
+	deadline := Clock.NewTimer(f.deadline.Sub(Clock.Now()) + awaitGrace)
+	defer deadline.Stop()
+	for {
+		select {
+		case msg := <-outcome.messages:
+			if msg != nil && f.settleRaw([]byte(msg.Payload)) {
+				return
+			}
+		case <-deadline.C:
+			f.settle(ResultUpdate{
+				TaskID:    f.taskID,
+				Status:    "error",
+				Error:     fmt.Sprintf("no outcome by its deadline of %s", f.deadline.Format(time.RFC3339)),
+				Data:      map[string]interface{}{"failure_type": "watchdog_failure"},
+				UpdatedAt: Clock.Now(),
+			})
+			return
+		}
+	}
+}
+
+func (f *flight) settleRaw(raw []byte) bool {
+	var update ResultUpdate
+	if err := json.Unmarshal(raw, &update); err != nil {
+		log.Printf("❌ Failed to unmarshal outcome of task %s: %v", f.taskID, err)
+		return false
+	}
+	f.settle(update)
+	return true
+}
+
+// settle hands the final update to everyone here awaiting the task
+func (f *flight) settle(update ResultUpdate) {
+	f.doneOnce.Do(func() {
+		flightsMu.Lock()
+		if flights[f.key] == f {
+			delete(flights, f.key)
+		}
+		flightsMu.Unlock()
+		f.result = update
+		close(f.done)
+	})
+}
+
+// finish settles a task this process queued, and stores and announces the
+// final update for the other replicas awaiting it before giving up the claim
+func (f *flight) finish(conn *data.Conn, update ResultUpdate) {
+	f.settle(update)
+	ctx, cancel := context.WithTimeout(context.Background(), statusSubscribeTimeout)
+	defer cancel()
+	raw, err := json.Marshal(update)
+	if err != nil {
+		log.Printf("❌ Failed to marshal outcome of task %s: %v", f.taskID, err)
+		return
+	}
+	if err := conn.Cache.Set(ctx, fmt.Sprintf(outcomeKey, f.taskID), raw, outcomeTTL).Err(); err != nil {
+		log.Printf("⚠️ Failed to store outcome of task %s: %v", f.taskID, err)
+	}
+	if err := conn.Cache.Publish(ctx, fmt.Sprintf(outcomeChan, f.taskID), raw).Err(); err != nil {
+		log.Printf("⚠️ Failed to announce outcome of task %s: %v", f.taskID, err)
+	}
+	f.release(ctx, conn)
+}
+
+var releaseClaim = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+
+// release drops the claim if it's still this process's
+func (f *flight) release(ctx context.Context, conn *data.Conn) {
+	if f.record == "" {
+		return
+	}
+	if err := releaseClaim.Run(ctx, conn.Cache, []string{f.key}, f.record).Err(); err != nil && !errors.Is(err, redis.Nil) {
+		log.Printf("⚠️ Failed to release claim on task %s: %v", f.taskID, err)
+	}
+}
+
+// fail drops a flight that never got its task going
+func (f *flight) fail(err error) {
+	flightsMu.Lock()
+	if flights[f.key] == f {
+		delete(flights, f.key)
+	}
+	flightsMu.Unlock()
+	f.markReady(err)
+}
+
+func (f *flight) markReady(err error) {
+	f.readyOnce.Do(func() {
+		f.err = err
+		close(f.ready)
+	})
+}
+
+// handle returns a handle that only gets the flight's final update
+func (f *flight) handle(conn *data.Conn) *Handle {
+	updatesCh := make(chan ResultUpdate, 1)
+	cancelCh := make(chan struct{})
+	h := &Handle{
+		Updates:   updatesCh,
+		taskID:    f.taskID,
+		taskType:  f.taskType,
+		deadline:  f.deadline,
+		conn:      conn,
+		updatesCh: updatesCh,
+		cancelCh:  cancelCh,
+	}
+	h.Cancel = func() error {
+		h.cancelOnce.Do(func() {
+			h.mu.Lock()
+			h.cancelled = true
+			h.mu.Unlock()
+			close(cancelCh)
+		})
+		return nil
+	}
+	go func() {
+		select {
+		case <-f.done:
+			updatesCh <- f.result
+		case <-cancelCh:
+		}
+	}()
+	return h
+}
@@ -0,0 +1,182 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Status updates for every task this process waits on arrive over one shared
+// Redis subscription, which subscribes and unsubscribes task status channels
+// as waiters come and go, and hands each message to the waiter of its
+// channel. Subscribing per channel rather than to a pattern keeps the
+// subscriber count workers see per task, so a task nobody waits on anymore
+// is still noticed (see NoSubscribersException in the worker).
+const (
+	// statusSubscribeTimeout bounds waiting for Redis to confirm a
+	// subscription
+	statusSubscribeTimeout = 5 * time.Second
+	// statusBuffer is how many updates a waiter can fall behind by before
+	// they are dropped. A final update is never dropped: it takes the place
+	// of the oldest one instead.
+	statusBuffer = 32
+)
+
+type statusDispatcher struct {
+	pubsub  *redis.PubSub
+	mu      sync.Mutex
+	waiters map[string]*statusWaiter // by channel
+}
+
+type statusWaiter struct {
+	channel  string
+	messages chan *redis.Message
+	ready    chan struct{}
+	once     sync.Once
+}
+
+var (
+	dispatchersMu sync.Mutex
+	dispatchers   = map[*redis.Client]*statusDispatcher{}
+)
+
+// statusDispatcherFor returns the shared status subscription of a Redis
+// client, starting it on first use
+func statusDispatcherFor(client *redis.Client) *statusDispatcher {
+	dispatchersMu.Lock()
+	defer dispatchersMu.Unlock()
+	if d, ok := dispatchers[client]; ok {
+		return d
+	}
+	d := &statusDispatcher{
+		pubsub:  client.Subscribe(context.Background()),
+		waiters: map[string]*statusWaiter{},
+	}
+	dispatchers[client] = d
+	go d.run(client)
+	return d
+}
+
+// run hands each message to the waiter of its channel, until the client is
+// closed. It never blocks on a waiter, so one slow waiter can't hold up the
+// others.
+func (d *statusDispatcher) run(client *redis.Client) {
+	defer func() {
+		dispatchersMu.Lock()
+		delete(dispatchers, client)
+		dispatchersMu.Unlock()
+	}()
+	for msg := range d.pubsub.ChannelWithSubscriptions(context.Background(), 1000) {
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			// Also seen again for every channel after a reconnect
+			if m.Kind != "subscribe" {
+				continue
+			}
+			if w := d.waiter(m.Channel); w != nil {
+				w.once.Do(func() { close(w.ready) })
+			}
+		case *redis.Message:
+			if w := d.waiter(m.Channel); w != nil {
+				w.deliver(m)
+			}
+		}
+	}
+}
+
+// deliver hands a message to the waiter without blocking. When the waiter
+// is too far behind, a final update replaces its oldest pending one, since
+// the waiter would otherwise wait out the task's deadline; anything else is
+// dropped.
+func (w *statusWaiter) deliver(m *redis.Message) {
+	select {
+	case w.messages <- m:
+		return
+	default:
+	}
+	if !isFinalStatus(m.Payload) {
+		log.Printf("❌ Status updates for %s backed up, dropping one", m.Channel)
+		return
+	}
+	// The dispatcher is the only sender, so the slot freed here stays free
+	select {
+	case <-w.messages:
+	default:
+	}
+	w.messages <- m
+	log.Printf("⚠️ Status updates for %s backed up, dropped the oldest for the final one", m.Channel)
+}
+
+// isFinalStatus reports whether a status message ends its task
+func isFinalStatus(payload string) bool {
+	var msg struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		return false
+	}
+	switch msg.Status {
+	case "completed", "error", "cancelled":
+		return true
+	}
+	return false
+}
+
+func (d *statusDispatcher) waiter(channel string) *statusWaiter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.waiters[channel]
+}
+
+// subscribe registers a waiter for a status channel and returns once Redis
+// has confirmed the subscription, so no update published after it is missed
+func (d *statusDispatcher) subscribe(ctx context.Context, channel string) (*statusWaiter, error) {
+	w := &statusWaiter{
+		channel:  channel,
+		messages: make(chan *redis.Message, statusBuffer),
+		ready:    make(chan struct{}),
+	}
+	d.mu.Lock()
+	if _, taken := d.waiters[channel]; taken {
+		d.mu.Unlock()
+		return nil, fmt.Errorf("%s already has a waiter", channel)
+	}
+	d.waiters[channel] = w
+	d.mu.Unlock()
+
+	if err := d.pubsub.Subscribe(ctx, channel); err != nil {
+		d.unsubscribe(w)
+		return nil, fmt.Errorf("subscribing to %s: %w", channel, err)
+	}
+	timer := time.NewTimer(statusSubscribeTimeout)
+	defer timer.Stop()
+	select {
+	case <-w.ready:
+		return w, nil
+	case <-timer.C:
+		d.unsubscribe(w)
+		return nil, fmt.Errorf("timeout waiting for subscription to %s", channel)
+	case <-ctx.Done():
+		d.unsubscribe(w)
+		return nil, ctx.Err()
+	}
+}
+
+// unsubscribe drops a waiter; updates for its channel are ignored from then on
+func (d *statusDispatcher) unsubscribe(w *statusWaiter) {
+	d.mu.Lock()
+	if d.waiters[w.channel] == w {
+		delete(d.waiters, w.channel)
+	}
+	d.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), statusSubscribeTimeout)
+	defer cancel()
+	if err := d.pubsub.Unsubscribe(ctx, w.channel); err != nil {
+		log.Printf("⚠️ Error unsubscribing from %s: %v", w.channel, err)
+	}
+}
@@ -0,0 +1,158 @@
+package queue
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// A scheduled job run that queues worker tasks records each of them under the
+// run as it is submitted, so the run's tasks can be listed afterwards along
+// with how they went. The run travels in the context the tasks are queued
+// with (see WithJobRun); tasks queued outside a job run record nothing.
+const (
+	jobRunTasksKey = "job_run:tasks:%s" // hash of task ID to JobRunTask, by run ID
+	jobRunTasksTTL = 7 * 24 * time.Hour
+)
+
+// JobRunRef identifies a run of a scheduled job
+type JobRunRef struct {
+	Job   string `json:"job"`
+	RunID string `json:"runId"`
+}
+
+type jobRunKey struct{}
+
+// WithJobRun returns a context that records the tasks queued with it under
+// the given run of job
+func WithJobRun(ctx context.Context, job, runID string) context.Context {
+	return context.WithValue(ctx, jobRunKey{}, JobRunRef{Job: job, RunID: runID})
+}
+
+// JobRunFrom returns the job run ctx carries, if any
+func JobRunFrom(ctx context.Context) (JobRunRef, bool) {
+	ref, ok := ctx.Value(jobRunKey{}).(JobRunRef)
+	return ref, ok && ref.RunID != ""
+}
+
+// JobRunTask is a task a job run queued, as of its latest status
+type JobRunTask struct {
+	TaskID   string `json:"taskId"`
+	TaskType string `json:"taskType"`
+	Job      string `json:"job"`
+	// Status is queued, running, retrying, completed, error or cancelled
+	Status    string    `json:"status"`
+	Attempt   int       `json:"attempt"`
+	Error     string    `json:"error,omitempty"`
+	QueuedAt  time.Time `json:"queuedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Deadline is when the task's submitter stops waiting on it
+	Deadline time.Time `json:"deadline"`
+}
+
+// Done reports whether the task has reached a final status
+func (t JobRunTask) Done() bool {
+	return t.Status == "completed" || t.Status == "error" || t.Status == "cancelled"
+}
+
+// JobRunTasks returns the tasks a job run queued, in the order they were
+// queued
+func JobRunTasks(ctx context.Context, conn *data.Conn, runID string) ([]JobRunTask, error) {
+	raw, err := conn.Cache.HGetAll(ctx, fmt.Sprintf(jobRunTasksKey, runID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("loading tasks of job run %s: %w", runID, err)
+	}
+	tasks := make([]JobRunTask, 0, len(raw))
+	for _, r := range raw {
+		var task JobRunTask
+		if err := json.Unmarshal([]byte(r), &task); err != nil {
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].QueuedAt.Before(tasks[j].QueuedAt) })
+	return tasks, nil
+}
+
+// trackLineage starts recording the handle's task under the job run ctx
+// carries, if any. It is called before the task is pushed, so no status the
+// worker reports can be overwritten by the queued one.
+func (h *Handle) trackLineage(ctx context.Context) {
+	ref, ok := JobRunFrom(ctx)
+	if !ok {
+		return
+	}
+	now := Clock.Now()
+	h.mu.Lock()
+	h.lineage = &JobRunTask{
+		TaskID:    h.taskID,
+		TaskType:  h.taskType,
+		Job:       ref.Job,
+		Status:    "queued",
+		Attempt:   1,
+		QueuedAt:  now,
+		UpdatedAt: now,
+		Deadline:  h.deadline,
+	}
+	h.lineageKey = fmt.Sprintf(jobRunTasksKey, ref.RunID)
+	h.mu.Unlock()
+	h.saveLineage()
+}
+
+// updateLineage records a new status for a task queued by a job run. Lineage
+// is best effort: failing to save it never fails the task.
+func (h *Handle) updateLineage(status string, attempt int, errText string) {
+	h.mu.Lock()
+	if h.lineage == nil {
+		h.mu.Unlock()
+		return
+	}
+	h.lineage.Status = status
+	if attempt > 0 {
+		h.lineage.Attempt = attempt
+	}
+	h.lineage.Error = errText
+	h.lineage.UpdatedAt = Clock.Now()
+	h.mu.Unlock()
+	h.saveLineage()
+}
+
+// dropLineage forgets a task that never made it onto the queue
+func (h *Handle) dropLineage() {
+	h.mu.Lock()
+	key, tracked := h.lineageKey, h.lineage != nil
+	h.lineage = nil
+	h.mu.Unlock()
+	if !tracked {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.conn.Cache.HDel(ctx, key, h.taskID).Err(); err != nil {
+		log.Printf("⚠️ Error removing task %s from its job run: %v", h.taskID, err)
+	}
+}
+
+func (h *Handle) saveLineage() {
+	h.mu.RLock()
+	key := h.lineageKey
+	encoded, err := json.Marshal(h.lineage)
+	h.mu.RUnlock()
+	if err != nil {
+		log.Printf("⚠️ Error encoding lineage of task %s: %v", h.taskID, err)
+		return
+	}
+	// The submitter's context may already be done by the time a task finishes
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pipe := h.conn.Cache.TxPipeline()
+	pipe.HSet(ctx, key, h.taskID, encoded)
+	pipe.Expire(ctx, key, jobRunTasksTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ Error saving lineage of task %s: %v", h.taskID, err)
+	}
+}
@@ -0,0 +1,159 @@
+package queue
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The task protocol is the shape of task payloads and results exchanged with
+// the Python workers, versioned MAJOR.MINOR. Tasks carry the version the
+// backend speaks and results report the version the worker wrote them in. A
+// newer minor only adds fields. Results from an older major are translated by
+// resultAdapters; any other major is refused, so a field the backend no
+// longer understands fails the task instead of silently decoding to zero.
+// Keep in sync with PROTOCOL_VERSION in services/worker/src/utils/protocol.py.
+const (
+	ProtocolMajor = 2
+	ProtocolMinor = 3
+)
+
+// ProtocolVersion is the version stamped on every task
+var ProtocolVersion = fmt.Sprintf("%d.%d", ProtocolMajor, ProtocolMinor)
+
+// protocolMismatch is the error type reported when a result can't be read
+const protocolMismatch = "ProtocolMismatch"
+
+type protocolVersion struct {
+	Major, Minor int
+}
+
+func (v protocolVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// parseProtocolVersion reads MAJOR.MINOR. Workers from before versioning send
+// nothing, which is 1.0.
+func parseProtocolVersion(s string) (protocolVersion, error) {
+	if s == "" {
+		return protocolVersion{Major: 1}, nil
+	}
+	majorStr, minorStr, _ := strings.Cut(s, ".")
+	major, err := strconv.Atoi(majorStr)
+	if err != nil || major < 1 {
+		return protocolVersion{}, fmt.Errorf("invalid task protocol version %q", s)
+	}
+	minor := 0
+	if minorStr != "" {
+		if minor, err = strconv.Atoi(minorStr); err != nil || minor < 0 {
+			return protocolVersion{}, fmt.Errorf("invalid task protocol version %q", s)
+		}
+	}
+	return protocolVersion{Major: major, Minor: minor}, nil
+}
+
+// resultAdapter rewrites one task type's result from an older major into the
+// shape of the next
+type resultAdapter func(data map[string]interface{}) map[string]interface{}
+
+// resultAdapters are keyed by the major they translate from, then task type.
+// A task type without an adapter needs no translation for that major.
+var resultAdapters = map[int]map[string]resultAdapter{
+	1: {
+		"alert":            adaptAlertV1,
+		"backtest":         legacyErrorMessageV1,
+		"signals":          legacyErrorMessageV1,
+		"export_user_data": legacyErrorMessageV1,
+		"screen":           structuredErrorDetailsV1,
+		"create_strategy":  structuredErrorDetailsV1,
+		"python_agent":     structuredErrorDetailsV1,
+	},
+}
+
+// adaptAlertV1 turns the "alerts" match list of early alert workers into
+// "instances", which is all the backend reads
+func adaptAlertV1(data map[string]interface{}) map[string]interface{} {
+	if matches, ok := data["alerts"].([]interface{}); ok {
+		if _, has := data["instances"]; !has {
+			instances := make([]interface{}, 0, len(matches))
+			for _, m := range matches {
+				match, ok := m.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				instance := map[string]interface{}{}
+				if extra, ok := match["data"].(map[string]interface{}); ok {
+					for k, v := range extra {
+						instance[k] = v
+					}
+				}
+				for k, v := range match {
+					if k != "data" {
+						instance[k] = v
+					}
+				}
+				instances = append(instances, instance)
+			}
+			data["instances"] = instances
+		}
+		delete(data, "alerts")
+	}
+	return legacyErrorMessageV1(data)
+}
+
+// legacyErrorMessageV1 moves a plain string "error" into "error_message" for
+// results whose "error" field is structured
+func legacyErrorMessageV1(data map[string]interface{}) map[string]interface{} {
+	if msg, ok := data["error"].(string); ok {
+		if _, has := data["error_message"]; !has {
+			data["error_message"] = msg
+		}
+		delete(data, "error")
+	}
+	return data
+}
+
+// structuredErrorDetailsV1 moves a structured "error" into "error_details" for
+// results whose "error" field is a string
+func structuredErrorDetailsV1(data map[string]interface{}) map[string]interface{} {
+	if details, ok := data["error"].(map[string]interface{}); ok {
+		if _, has := data["error_details"]; !has {
+			data["error_details"] = details
+		}
+		msg, _ := details["message"].(string)
+		data["error"] = msg
+	}
+	return data
+}
+
+// newerMinorWarned remembers the versions already warned about
+var newerMinorWarned sync.Map
+
+// negotiateResult checks the version a worker wrote a result in and
+// translates it to the current protocol
+func negotiateResult(taskType, version string, data map[string]interface{}) (map[string]interface{}, error) {
+	v, err := parseProtocolVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	if v.Major > ProtocolMajor {
+		return nil, fmt.Errorf("%s worker replied with task protocol %s but the backend speaks %s; deploy a backend that supports it", taskType, v, ProtocolVersion)
+	}
+	if v.Major == ProtocolMajor && v.Minor > ProtocolMinor {
+		if _, warned := newerMinorWarned.LoadOrStore(v, true); !warned {
+			log.Printf("⚠️ Workers speak task protocol %s, newer than the backend's %s; fields added since are ignored", v, ProtocolVersion)
+		}
+	}
+	for major := v.Major; major < ProtocolMajor; major++ {
+		adapters, ok := resultAdapters[major]
+		if !ok {
+			return nil, fmt.Errorf("%s worker replied with task protocol %s, which the backend (%s) can no longer translate; upgrade the worker", taskType, v, ProtocolVersion)
+		}
+		if adapt := adapters[taskType]; adapt != nil && data != nil {
+			data = adapt(data)
+		}
+	}
+	return data, nil
+}
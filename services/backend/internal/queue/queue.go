@@ -3,9 +3,13 @@
 package queue
 
 import (
+	"backend/internal/apperr"
+	"backend/internal/clock"
 	"backend/internal/data"
+	"backend/internal/dryrun"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
@@ -14,6 +18,10 @@ import (
 	"github.com/google/uuid"
 )
 
+// Clock times task heartbeats, start and run timeouts and retries. Tests swap
+// in a clock.Fake to step through them.
+var Clock clock.Clock = clock.Default()
+
 // parseError extracts structured error information from various error sources
 func parseError(errorSource interface{}) (*ErrorDetails, string) {
 	if errorSource == nil {
@@ -144,6 +152,47 @@ type AlertResult struct {
 	Error        *ErrorDetails            `json:"error,omitempty"`         // New structured error
 }
 
+// SignalsResult represents the result of a strategy signals task
+// AlertBatchResult is the result of an alert_batch task: one AlertResult per
+// strategy, keyed by strategy id. The batch only fails as a whole when the
+// task itself does.
+type AlertBatchResult struct {
+	Success bool                   `json:"success"`
+	Results map[string]AlertResult `json:"results"`
+	Error   *ErrorDetails          `json:"error,omitempty"`
+}
+
+type SignalsResult struct {
+	Success      bool          `json:"success"`
+	StrategyID   int           `json:"strategy_id"`
+	Version      int           `json:"version"`
+	Ticker       string        `json:"ticker"`
+	Timestamps   []int64       `json:"timestamps"`
+	ErrorMessage string        `json:"error_message,omitempty"` // Legacy field
+	Error        *ErrorDetails `json:"error,omitempty"`         // New structured error
+}
+
+// SimulatedTrigger is one point where a simulated alert would have fired.
+// Price is nil when no bar was found to price a strategy trigger at.
+type SimulatedTrigger struct {
+	Timestamp int64    `json:"timestamp"` // ms
+	Ticker    string   `json:"ticker"`
+	Price     *float64 `json:"price"`
+	Score     *float64 `json:"score,omitempty"`
+}
+
+// AlertSimulationResult is the result of an alert_simulation task
+type AlertSimulationResult struct {
+	Success        bool               `json:"success"`
+	AlertType      string             `json:"alert_type"`
+	Triggers       []SimulatedTrigger `json:"triggers"`
+	TotalTriggers  int                `json:"total_triggers"`
+	BelowThreshold int                `json:"below_threshold"`
+	Truncated      bool               `json:"truncated"`
+	ErrorMessage   string             `json:"error_message,omitempty"` // Legacy field
+	Error          *ErrorDetails      `json:"error,omitempty"`         // New structured error
+}
+
 // CreateStrategyResult represents the result of a strategy creation task
 type CreateStrategyResult struct {
 	Success      bool          `json:"success"`
@@ -156,6 +205,7 @@ type CreateStrategyResult struct {
 type Strategy struct {
 	StrategyID         int      `json:"strategyId"`
 	UserID             int      `json:"userId"`
+	WorkspaceID        *int     `json:"workspaceId,omitempty"` // shared through this workspace
 	Name               string   `json:"name"`
 	Description        string   `json:"description"`
 	Prompt             string   `json:"prompt"`
@@ -168,6 +218,7 @@ type Strategy struct {
 	AlertUniverse      []string `json:"alertUniverse,omitempty"`
 	MinTimeframe       string   `json:"minTimeframe,omitempty"`
 	AlertLastTriggerAt *string  `json:"alertLastTriggerAt,omitempty"`
+	Tags               []string `json:"tags,omitempty"`
 }
 
 // PythonAgentResult represents the result of a general python agent task
@@ -182,6 +233,16 @@ type PythonAgentResult struct {
 	ErrorDetails   *ErrorDetails      `json:"error_details,omitempty"` // New structured error
 }
 
+// ExportUserDataResult represents the result of a user data export task
+type ExportUserDataResult struct {
+	Success      bool           `json:"success"`
+	ExportID     int            `json:"export_id"`
+	SizeBytes    int            `json:"size_bytes"`
+	Files        map[string]int `json:"files"`
+	ErrorMessage string         `json:"error_message,omitempty"` // Legacy field
+	Error        *ErrorDetails  `json:"error,omitempty"`         // New structured error
+}
+
 // UnifiedMessage represents the new format from worker context system
 type UnifiedMessage struct {
 	TaskID      string                 `json:"task_id"`
@@ -189,6 +250,9 @@ type UnifiedMessage struct {
 	Status      string                 `json:"status"`       // running | completed | error | cancelled | heartbeat
 	Data        map[string]interface{} `json:"data,omitempty"`
 	Error       interface{}            `json:"error,omitempty"` // Can be string or structured error object
+	// ProtocolVersion is the task protocol the worker wrote the message in;
+	// empty from workers that predate versioning (see protocol.go)
+	ProtocolVersion string `json:"protocol_version,omitempty"`
 }
 
 // Handle provides control over a queued task
@@ -200,12 +264,32 @@ type Handle struct {
 	taskID     string
 	taskType   string
 	statusID   string
+	timeout    time.Duration
+	deadline   time.Time
 	conn       *data.Conn
 	updatesCh  chan ResultUpdate
 	cancelCh   chan struct{}
 	cancelOnce sync.Once
 	mu         sync.RWMutex
 	cancelled  bool
+	// lineage is the task's record under the job run that queued it, if any
+	lineage    *JobRunTask
+	lineageKey string
+	// flight shares the task's final update when it was queued deduped
+	flight *flight
+}
+
+// workerErrorCode classifies a Python exception raised by a worker task.
+// Errors in user strategy code are validation errors; the rest are internal.
+func workerErrorCode(exceptionType string) apperr.Code {
+	switch exceptionType {
+	case "ValidationError", "StrategyValidationError", "StrategyComplianceError", "SecurityError",
+		"PythonCodeError", "SyntaxError", "ValueError":
+		return apperr.CodeValidation
+	case "TimeoutError":
+		return apperr.CodeUpstreamTimeout
+	}
+	return apperr.CodeInternal
 }
 
 // ProgressCallback is a function type for receiving progress updates
@@ -213,10 +297,19 @@ type ProgressCallback func(update ResultUpdate)
 
 // Await waits for task completion and returns the typed result with optional progress callback
 func (h *Handle) Await(ctx context.Context, resultType interface{}, progressCallback ProgressCallback) (interface{}, error) {
+	// The watchdog fails the task at its deadline; the grace covers a failure
+	// update that never arrives
+	deadline := Clock.NewTimer(h.deadline.Sub(Clock.Now()) + awaitGrace)
+	defer deadline.Stop()
 	for {
 		select {
 		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, apperr.UpstreamTimeout("%s task %s did not finish in time", h.taskType, h.taskID)
+			}
 			return nil, ctx.Err()
+		case <-deadline.C:
+			return nil, apperr.UpstreamTimeout("%s task %s did not finish by its deadline", h.taskType, h.taskID)
 		case <-h.cancelCh:
 			return nil, fmt.Errorf("task was cancelled")
 		case update := <-h.updatesCh:
@@ -234,7 +327,11 @@ func (h *Handle) Await(ctx context.Context, resultType interface{}, progressCall
 
 					// Return appropriate error message
 					if update.ErrorDetails != nil {
-						return nil, fmt.Errorf("task failed with %s: %s", update.ErrorDetails.Type, update.ErrorDetails.Message)
+						return nil, apperr.Wrap(workerErrorCode(update.ErrorDetails.Type),
+							fmt.Errorf("task failed with %s", update.ErrorDetails.Type), "%s", update.ErrorDetails.Message)
+					}
+					if failureType, _ := update.Data["failure_type"].(string); failureType == "watchdog_failure" {
+						return nil, apperr.Wrap(apperr.CodeUpstreamTimeout, fmt.Errorf("%s", update.Error), "the worker did not finish the task")
 					}
 					return nil, fmt.Errorf("task failed: %s", update.Error)
 				}
@@ -278,6 +375,11 @@ type TaskData struct {
 	Priority          string `json:"priority"`
 	StatusID          string `json:"status_id"`          // Unique ID for status updates
 	HeartbeatInterval int    `json:"heartbeat_interval"` // Heartbeat interval in seconds
+	ProtocolVersion   string `json:"protocol_version"`   // Task protocol the backend speaks
+	// TimeoutSeconds bounds one attempt, and past Deadline (RFC3339) nobody
+	// waits on the task anymore (see timeouts.go)
+	TimeoutSeconds int    `json:"timeout_seconds"`
+	Deadline       string `json:"deadline"`
 }
 
 // WorkerHeartbeat represents a worker's heartbeat data
@@ -290,11 +392,48 @@ type WorkerHeartbeat struct {
 	QueueStats    map[string]interface{} `json:"queue_stats"`
 }
 
-// Task enqueues a task and returns a handle for monitoring and control
+// Task enqueues a task and returns a handle for monitoring and control. A
+// timeout of 0 runs the task under the one configured for its type. In a dry
+// run the task is only recorded and Task fails (see dryrun).
 func Task(ctx context.Context, conn *data.Conn, taskType string, args map[string]interface{}, priority bool, maxRetries int, timeout time.Duration) (*Handle, error) {
+	return enqueue(ctx, conn, taskType, args, priority, maxRetries, timeout, nil)
+}
+
+// enqueue queues a task, or with a flight, joins the identical one in flight
+// if another submitter claimed it first (see dedupe.go)
+func enqueue(ctx context.Context, conn *data.Conn, taskType string, args map[string]interface{}, priority bool, maxRetries int, timeout time.Duration, f *flight) (handle *Handle, err error) {
+	if f != nil {
+		defer func() {
+			if err == nil {
+				return
+			}
+			f.fail(err)
+			// Others may have joined since the claim
+			if f.record != "" {
+				f.finish(conn, ResultUpdate{TaskID: f.taskID, Status: "error", Error: err.Error(), UpdatedAt: Clock.Now()})
+			}
+		}()
+	}
+	if dryrun.Active(ctx) {
+		return nil, dryrun.Task(ctx, taskType, args, priority)
+	}
+	if err := checkAccepting(ctx, conn); err != nil {
+		return nil, err
+	}
+	timeout, deadline := taskTimeouts(ctx, taskType, timeout, maxRetries)
+
 	// Generate unique task ID and status ID
 	taskID := uuid.New().String()
 	statusID := uuid.New().String()
+	if f != nil {
+		claimed, err := f.claim(ctx, conn, taskID, deadline)
+		if err != nil {
+			return nil, err
+		}
+		if !claimed {
+			return f.follow(ctx, conn)
+		}
+	}
 
 	// Create task data
 	priorityStr := "normal"
@@ -312,10 +451,13 @@ func Task(ctx context.Context, conn *data.Conn, taskType string, args map[string
 		TaskID:            taskID,
 		TaskType:          taskType,
 		Kwargs:            string(kwargsJSON),
-		CreatedAt:         time.Now().Format(time.RFC3339),
+		CreatedAt:         Clock.Now().Format(time.RFC3339),
 		Priority:          priorityStr,
 		StatusID:          statusID,
 		HeartbeatInterval: 5, // 5 second heartbeat interval
+		ProtocolVersion:   ProtocolVersion,
+		TimeoutSeconds:    int(timeout.Seconds()),
+		Deadline:          wallClock(deadline).Format(time.RFC3339),
 	}
 
 	// Marshal task data
@@ -328,14 +470,17 @@ func Task(ctx context.Context, conn *data.Conn, taskType string, args map[string
 	updatesCh := make(chan ResultUpdate, 10) // Buffered channel for updates
 	cancelCh := make(chan struct{})
 
-	handle := &Handle{
+	handle = &Handle{
 		Updates:   updatesCh,
 		taskID:    taskID,
 		taskType:  taskType,
 		statusID:  statusID,
+		timeout:   timeout,
+		deadline:  deadline,
 		conn:      conn,
 		updatesCh: updatesCh,
 		cancelCh:  cancelCh,
+		flight:    f,
 	}
 
 	// Set up cancel function
@@ -350,21 +495,20 @@ func Task(ctx context.Context, conn *data.Conn, taskType string, args map[string
 		return nil
 	}
 
-	// Create a channel to signal when subscription is ready
-	subscriptionReady := make(chan struct{})
-
-	// Start unified event loop BEFORE pushing to queue to ensure subscription is active
-	go handle.eventLoop(ctx, maxRetries, timeout, priority, statusID, 5, subscriptionReady) // Pass heartbeat interval and ready signal
-
-	// Wait for subscription to be established
-	select {
-	case <-subscriptionReady:
-		// Subscription is ready
-	case <-time.After(5 * time.Second):
-		return nil, fmt.Errorf("timeout waiting for subscription to be established")
-	case <-ctx.Done():
-		return nil, ctx.Err()
+	// Subscribe to the task's status channel BEFORE pushing to queue, so no
+	// update is missed, then start the unified event loop on it
+	statusChannel := fmt.Sprintf("task_status:%s", statusID)
+	status, err := statusDispatcherFor(conn.Cache).subscribe(ctx, statusChannel)
+	if err != nil {
+		return nil, err
 	}
+	// A deduped task is watched until it finishes even if its submitter stops
+	// waiting, since others may be awaiting the same run
+	loopCtx := ctx
+	if f != nil {
+		loopCtx = context.WithoutCancel(ctx)
+	}
+	go handle.eventLoop(loopCtx, status, maxRetries, timeout, priority, statusID, 5) // Pass heartbeat interval
 
 	// Determine queue name
 	queueName := "task_queue"
@@ -372,9 +516,12 @@ func Task(ctx context.Context, conn *data.Conn, taskType string, args map[string
 		queueName = "priority_task_queue"
 	}
 
-	// Push task to queue AFTER subscription is established
+	// Record the task under its job run, then push it to the queue AFTER
+	// subscription is established
+	handle.trackLineage(ctx)
 	err = conn.Cache.RPush(ctx, queueName, string(taskJSON)).Err()
 	if err != nil {
+		handle.dropLineage()
 		return nil, fmt.Errorf("failed to push task to queue %s: %w", queueName, err)
 	}
 
@@ -383,7 +530,7 @@ func Task(ctx context.Context, conn *data.Conn, taskType string, args map[string
 		TaskID:    taskID,
 		Status:    "queued",
 		Data:      map[string]interface{}{},
-		UpdatedAt: time.Now(),
+		UpdatedAt: Clock.Now(),
 	}
 
 	select {
@@ -392,6 +539,9 @@ func Task(ctx context.Context, conn *data.Conn, taskType string, args map[string
 		// Channel full, skip initial update
 	}
 
+	if f != nil {
+		f.markReady(nil)
+	}
 	log.Printf("✅ Task %s queued successfully to %s with status_id %s", taskID, queueName, statusID)
 	return handle, nil
 }
@@ -407,37 +557,25 @@ func AwaitTypedResult[T any](ctx context.Context, handle *Handle, progressCallba
 }
 
 // eventLoop combines subscription and watchdog functionality in a single goroutine
-func (h *Handle) eventLoop(ctx context.Context, maxRetries int, timeout time.Duration, priority bool, statusID string, heartbeatInterval int, subscriptionReady chan struct{}) {
-	// Subscribe to unified task status channel
-	statusChannel := fmt.Sprintf("task_status:%s", statusID)
-	pubsub := h.conn.Cache.Subscribe(ctx, statusChannel)
-	defer func() {
-		if err := pubsub.Close(); err != nil {
-			log.Printf("error closing pubsub: %v", err)
-		}
-	}()
-
-	ch := pubsub.Channel()
-	log.Printf("🔔 Subscribed to status channel: %s", statusChannel)
-
-	// Signal that subscription is ready
-	if subscriptionReady != nil {
-		close(subscriptionReady)
-	}
+func (h *Handle) eventLoop(ctx context.Context, status *statusWaiter, maxRetries int, timeout time.Duration, priority bool, statusID string, heartbeatInterval int) {
+	// Updates arrive from the task's unified status channel
+	defer statusDispatcherFor(h.conn.Cache).unsubscribe(status)
+	ch := status.messages
+	log.Printf("🔔 Subscribed to status channel: %s", status.channel)
 
+	cancelCh := h.cancelCh
 	retryCount := 0
-	lastHeartbeat := time.Now()
+	lastHeartbeat := Clock.Now()
 	taskStarted := false
 	var startTime time.Time
 
 	checkInterval := time.Duration(heartbeatInterval) * time.Second
 	heartbeatTimeout := time.Duration(heartbeatInterval*3) * time.Second
-	ticker := time.NewTicker(checkInterval)
+	ticker := Clock.NewTicker(checkInterval)
 	defer ticker.Stop()
 
 	// Timer for waiting for the first message (assignment indicator)
-	const firstMsgTimeout = 60 * time.Second
-	startTimer := time.NewTimer(firstMsgTimeout)
+	startTimer := Clock.NewTimer(startTimeout)
 	defer startTimer.Stop()
 
 retryLoop:
@@ -445,7 +583,14 @@ retryLoop:
 		select {
 		case <-ctx.Done():
 			return
-		case <-h.cancelCh:
+		case <-cancelCh:
+			if h.flight != nil {
+				// Only this submitter stops waiting; the run goes on for the
+				// others sharing it
+				cancelCh = nil
+				continue
+			}
+			h.updateLineage("cancelled", 0, "")
 			return
 		case <-startTimer.C:
 			if !taskStarted {
@@ -472,7 +617,7 @@ retryLoop:
 			switch unifiedMsg.MessageType {
 			case "heartbeat":
 				// Update heartbeat timestamp
-				lastHeartbeat = time.Now()
+				lastHeartbeat = Clock.Now()
 				log.Printf("💓 Heartbeat received for task %s", h.taskID)
 				continue
 
@@ -485,22 +630,23 @@ retryLoop:
 						if parsedTime, err := time.Parse(time.RFC3339, ts); err == nil {
 							startTime = parsedTime
 						} else {
-							startTime = time.Now()
+							startTime = Clock.Now()
 						}
 					} else {
-						startTime = time.Now()
+						startTime = Clock.Now()
 					}
 					log.Printf("✅ Task %s started", h.taskID)
+					h.updateLineage("running", retryCount+1, "")
 					// Stop the first message timer since we've received the start signal
 					startTimer.Stop()
 				}
-				lastHeartbeat = time.Now()
+				lastHeartbeat = Clock.Now()
 
 				resultUpdate := ResultUpdate{
 					TaskID:    h.taskID,
 					Status:    unifiedMsg.Status,
 					Data:      unifiedMsg.Data,
-					UpdatedAt: time.Now(),
+					UpdatedAt: Clock.Now(),
 				}
 				select {
 				case h.updatesCh <- resultUpdate:
@@ -515,7 +661,7 @@ retryLoop:
 					TaskID:    h.taskID,
 					Status:    unifiedMsg.Status,
 					Data:      unifiedMsg.Data,
-					UpdatedAt: time.Now(),
+					UpdatedAt: Clock.Now(),
 				}
 
 				// Handle structured error information
@@ -537,9 +683,22 @@ retryLoop:
 				resultUpdate.ErrorDetails = errorDetails
 				resultUpdate.Error = errorStr
 
+				// Translate the result to the protocol the backend speaks, or
+				// fail the task if it can't be
+				if unifiedMsg.Status == "completed" {
+					translated, err := negotiateResult(h.taskType, unifiedMsg.ProtocolVersion, unifiedMsg.Data)
+					if err != nil {
+						resultUpdate.Status = "error"
+						resultUpdate.ErrorDetails = &ErrorDetails{Type: protocolMismatch, Message: err.Error()}
+						resultUpdate.Error = fmt.Sprintf("%s: %s", protocolMismatch, err)
+					} else {
+						resultUpdate.Data = translated
+					}
+				}
+
 				// Log error details if this is an error status
-				if unifiedMsg.Status == "error" {
-					logError(h.taskID, errorDetails, errorStr)
+				if resultUpdate.Status == "error" {
+					logError(h.taskID, resultUpdate.ErrorDetails, resultUpdate.Error)
 				}
 
 				// Send final update to channel (non-blocking)
@@ -551,12 +710,23 @@ retryLoop:
 
 				// Task completed successfully
 				if unifiedMsg.Status == "completed" || unifiedMsg.Status == "error" || unifiedMsg.Status == "cancelled" {
+					h.updateLineage(resultUpdate.Status, 0, resultUpdate.Error)
+					if h.flight != nil {
+						h.flight.finish(h.conn, resultUpdate)
+					}
 					return
 				}
 			}
 
 		case <-ticker.C:
-			now := time.Now()
+			now := Clock.Now()
+
+			// Nobody waits on the task past its deadline, so don't retry it
+			if now.After(h.deadline) {
+				log.Printf("⏰ Task %s passed its deadline", h.taskID)
+				h.markTaskAsFailed(fmt.Sprintf("did not finish by its deadline of %s", h.deadline.Format(time.RFC3339)))
+				return
+			}
 
 			// Only perform timeout checks if task has started
 			if taskStarted {
@@ -573,7 +743,7 @@ retryLoop:
 				}
 			} else {
 				// If task hasn't started after reasonable time, consider it failed
-				if now.Sub(time.Now().Add(-firstMsgTimeout)) > 2*time.Minute {
+				if now.Sub(Clock.Now().Add(-startTimeout)) > 2*time.Minute {
 					log.Printf("⚠️ Task %s never started after 2 minutes", h.taskID)
 					break retryLoop // Break to retry logic
 				}
@@ -598,10 +768,11 @@ retryLoop:
 		h.markTaskAsFailed(fmt.Sprintf("failed to requeue: %v", err))
 		return
 	}
+	h.updateLineage("retrying", retryCount+1, "")
 
 	// Reset task state for retry
 	taskStarted = false
-	startTimer.Reset(firstMsgTimeout)
+	startTimer.Reset(startTimeout)
 }
 
 // requeueTask requeues the task with updated retry information
@@ -627,10 +798,13 @@ func (h *Handle) requeueTask(ctx context.Context, retryCount int, reason string,
 		TaskID:            h.taskID,
 		TaskType:          h.taskType, // Use the original task type
 		Kwargs:            string(kwargsJSON),
-		CreatedAt:         time.Now().Format(time.RFC3339),
+		CreatedAt:         Clock.Now().Format(time.RFC3339),
 		Priority:          priorityStr,
 		StatusID:          statusID, // Use the same statusID for requeue
 		HeartbeatInterval: heartbeatInterval,
+		ProtocolVersion:   ProtocolVersion,
+		TimeoutSeconds:    int(h.timeout.Seconds()),
+		Deadline:          wallClock(h.deadline).Format(time.RFC3339),
 	}
 
 	// Determine queue name
@@ -662,7 +836,7 @@ func (h *Handle) markTaskAsFailed(reason string) {
 		Status:    "error",
 		Error:     reason,
 		Data:      map[string]interface{}{"failure_type": "watchdog_failure"},
-		UpdatedAt: time.Now(),
+		UpdatedAt: Clock.Now(),
 	}
 
 	select {
@@ -671,6 +845,11 @@ func (h *Handle) markTaskAsFailed(reason string) {
 		// Channel full or closed
 	}
 
+	h.updateLineage("error", 0, reason)
+	if h.flight != nil {
+		h.flight.finish(h.conn, errorUpdate)
+	}
+
 	// Log the watchdog failure
 	log.Printf("❌ Task %s marked as failed by watchdog: %s", h.taskID, reason)
 }
@@ -679,12 +858,12 @@ func (h *Handle) markTaskAsFailed(reason string) {
 
 // Backtest queues a backtest task with default settings
 func Backtest(ctx context.Context, conn *data.Conn, args map[string]interface{}) (*Handle, error) {
-	return Task(ctx, conn, "backtest", args, false, 3, 10*time.Minute)
+	return Task(ctx, conn, "backtest", args, false, 3, 0)
 }
 
 // BacktestTyped queues a backtest task and returns a typed result
 func BacktestTyped(ctx context.Context, conn *data.Conn, args map[string]interface{}) (*BacktestResult, error) {
-	handle, err := Task(ctx, conn, "backtest", args, false, 3, 10*time.Minute)
+	handle, err := Task(ctx, conn, "backtest", args, false, 3, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -694,12 +873,12 @@ func BacktestTyped(ctx context.Context, conn *data.Conn, args map[string]interfa
 
 // Screening queues a screening task with default settings
 func Screening(ctx context.Context, conn *data.Conn, args map[string]interface{}) (*Handle, error) {
-	return Task(ctx, conn, "screen", args, false, 3, 5*time.Minute)
+	return Task(ctx, conn, "screen", args, false, 3, 0)
 }
 
 // ScreeningTyped queues a screening task and returns a typed result
 func ScreeningTyped(ctx context.Context, conn *data.Conn, args map[string]interface{}) (*ScreeningResult, error) {
-	handle, err := Task(ctx, conn, "screen", args, false, 3, 5*time.Minute)
+	handle, err := Task(ctx, conn, "screen", args, false, 3, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -709,12 +888,13 @@ func ScreeningTyped(ctx context.Context, conn *data.Conn, args map[string]interf
 
 // Alert queues an alert task with default settings
 func Alert(ctx context.Context, conn *data.Conn, args map[string]interface{}) (*Handle, error) {
-	return Task(ctx, conn, "alert", args, false, 3, 2*time.Minute)
+	return Task(ctx, conn, "alert", args, false, 3, 0)
 }
 
-// AlertTyped queues an alert task and returns a typed result
+// AlertTyped queues an alert task and returns a typed result, sharing an
+// identical one already in flight
 func AlertTyped(ctx context.Context, conn *data.Conn, args map[string]interface{}) (*AlertResult, error) {
-	handle, err := Task(ctx, conn, "alert", args, false, 3, 2*time.Minute)
+	handle, err := DedupedTask(ctx, conn, "alert", args, false, 3, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -722,14 +902,55 @@ func AlertTyped(ctx context.Context, conn *data.Conn, args map[string]interface{
 	return AwaitTypedResult[AlertResult](ctx, handle, nil)
 }
 
+// AlertBatchTyped runs several strategy alerts in one worker task, sharing
+// an identical batch already in flight
+func AlertBatchTyped(ctx context.Context, conn *data.Conn, args map[string]interface{}) (*AlertBatchResult, error) {
+	handle, err := DedupedTask(ctx, conn, "alert_batch", args, false, 3, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return AwaitTypedResult[AlertBatchResult](ctx, handle, nil)
+}
+
+// Signals queues a task computing the historical signals of a strategy on one security
+func Signals(ctx context.Context, conn *data.Conn, args map[string]interface{}) (*Handle, error) {
+	return Task(ctx, conn, "signals", args, false, 2, 0)
+}
+
+// SignalsTyped queues a strategy signals task and returns a typed result
+func SignalsTyped(ctx context.Context, conn *data.Conn, args map[string]interface{}) (*SignalsResult, error) {
+	handle, err := Signals(ctx, conn, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return AwaitTypedResult[SignalsResult](ctx, handle, nil)
+}
+
+// AlertSimulation queues a task replaying a price or strategy alert over past data
+func AlertSimulation(ctx context.Context, conn *data.Conn, args map[string]interface{}) (*Handle, error) {
+	return Task(ctx, conn, "alert_simulation", args, false, 1, 0)
+}
+
+// AlertSimulationTyped queues an alert simulation task and returns a typed result
+func AlertSimulationTyped(ctx context.Context, conn *data.Conn, args map[string]interface{}) (*AlertSimulationResult, error) {
+	handle, err := AlertSimulation(ctx, conn, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return AwaitTypedResult[AlertSimulationResult](ctx, handle, nil)
+}
+
 // CreateStrategy queues a strategy creation task with high priority
 func CreateStrategy(ctx context.Context, conn *data.Conn, args map[string]interface{}) (*Handle, error) {
-	return Task(ctx, conn, "create_strategy", args, true, 2, 15*time.Minute)
+	return Task(ctx, conn, "create_strategy", args, true, 2, 0)
 }
 
 // CreateStrategyTyped queues a strategy creation task and returns a typed result
 func CreateStrategyTyped(ctx context.Context, conn *data.Conn, args map[string]interface{}) (*CreateStrategyResult, error) {
-	handle, err := Task(ctx, conn, "create_strategy", args, true, 2, 15*time.Minute)
+	handle, err := Task(ctx, conn, "create_strategy", args, true, 2, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -739,15 +960,31 @@ func CreateStrategyTyped(ctx context.Context, conn *data.Conn, args map[string]i
 
 // PythonAgent queues a general python agent task with default settings
 func PythonAgent(ctx context.Context, conn *data.Conn, args map[string]interface{}) (*Handle, error) {
-	return Task(ctx, conn, "python_agent", args, false, 3, 8*time.Minute)
+	return Task(ctx, conn, "python_agent", args, false, 3, 0)
 }
 
 // PythonAgentTyped queues a general python agent task and returns a typed result
 func PythonAgentTyped(ctx context.Context, conn *data.Conn, args map[string]interface{}) (*PythonAgentResult, error) {
-	handle, err := Task(ctx, conn, "python_agent", args, false, 3, 8*time.Minute)
+	handle, err := Task(ctx, conn, "python_agent", args, false, 3, 0)
 	if err != nil {
 		return nil, err
 	}
 
 	return AwaitTypedResult[PythonAgentResult](ctx, handle, nil)
 }
+
+// ExportUserData queues a task that builds a user's data export archive. The
+// worker only picks up pending exports, so the task is never retried.
+func ExportUserData(ctx context.Context, conn *data.Conn, args map[string]interface{}) (*Handle, error) {
+	return Task(ctx, conn, "export_user_data", args, false, 0, 0)
+}
+
+// ExportUserDataTyped queues a user data export task and returns a typed result
+func ExportUserDataTyped(ctx context.Context, conn *data.Conn, args map[string]interface{}) (*ExportUserDataResult, error) {
+	handle, err := ExportUserData(ctx, conn, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return AwaitTypedResult[ExportUserDataResult](ctx, handle, nil)
+}
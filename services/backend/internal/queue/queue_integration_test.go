@@ -0,0 +1,185 @@
+package queue_test
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/queue"
+	"backend/internal/testharness"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func awaitMap(ctx context.Context, h *queue.Handle) (map[string]interface{}, error) {
+	var out map[string]interface{}
+	if _, err := h.Await(ctx, &out, nil); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func TestTaskRoundTrip(t *testing.T) {
+	env := testharness.New(t)
+	worker := env.StartWorker(t)
+	worker.Handle("backtest", func(_ queue.TaskData, args map[string]interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{"strategy_id": args["strategy_id"], "instances": 3}, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	h, err := queue.Task(ctx, env.Conn, "backtest", map[string]interface{}{"strategy_id": 7}, false, 0, 0)
+	if err != nil {
+		t.Fatalf("queuing: %v", err)
+	}
+	out, err := awaitMap(ctx, h)
+	if err != nil {
+		t.Fatalf("awaiting: %v", err)
+	}
+	if out["strategy_id"] != float64(7) || out["instances"] != float64(3) {
+		t.Fatalf("unexpected result %v", out)
+	}
+	tasks := worker.Tasks()
+	if len(tasks) != 1 || tasks[0].ProtocolVersion != queue.ProtocolVersion || tasks[0].Deadline == "" {
+		t.Fatalf("unexpected tasks %+v", tasks)
+	}
+}
+
+func TestTaskWorkerError(t *testing.T) {
+	env := testharness.New(t)
+	worker := env.StartWorker(t)
+	worker.Handle("backtest", func(queue.TaskData, map[string]interface{}) (map[string]interface{}, error) {
+		return nil, errors.New("strategy raised ZeroDivisionError")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	h, err := queue.Task(ctx, env.Conn, "backtest", map[string]interface{}{"strategy_id": 1}, false, 0, 0)
+	if err != nil {
+		t.Fatalf("queuing: %v", err)
+	}
+	if _, err := awaitMap(ctx, h); err == nil || !strings.Contains(err.Error(), "ZeroDivisionError") {
+		t.Fatalf("expected the worker's error, got %v", err)
+	}
+}
+
+func TestDedupedTaskSharesOneRun(t *testing.T) {
+	env := testharness.New(t)
+	worker := env.StartWorker(t)
+	release := make(chan struct{})
+	worker.Handle("alert", func(queue.TaskData, map[string]interface{}) (map[string]interface{}, error) {
+		<-release
+		return map[string]interface{}{"hits": 1}, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	const submitters = 3
+	var wg sync.WaitGroup
+	results := make([]map[string]interface{}, submitters)
+	errs := make([]error, submitters)
+	for i := 0; i < submitters; i++ {
+		// Symbols in any order are the same task
+		symbols := []string{"AAPL", "MSFT"}
+		if i%2 == 1 {
+			symbols = []string{"MSFT", "AAPL"}
+		}
+		h, err := queue.DedupedTask(ctx, env.Conn, "alert", map[string]interface{}{"strategy_id": 4, "symbols": symbols}, false, 0, 0)
+		if err != nil {
+			t.Fatalf("queuing %d: %v", i, err)
+		}
+		wg.Add(1)
+		go func(i int, h *queue.Handle) {
+			defer wg.Done()
+			results[i], errs[i] = awaitMap(ctx, h)
+		}(i, h)
+	}
+	close(release)
+	wg.Wait()
+	for i := range results {
+		if errs[i] != nil || results[i]["hits"] != float64(1) {
+			t.Fatalf("submitter %d got %v, %v", i, results[i], errs[i])
+		}
+	}
+	if n := len(worker.Tasks()); n != 1 {
+		t.Fatalf("worker ran %d tasks, want 1", n)
+	}
+}
+
+func TestDedupedTaskOutlivesItsSubmitter(t *testing.T) {
+	env := testharness.New(t)
+	worker := env.StartWorker(t)
+	release := make(chan struct{})
+	worker.Handle("alert", func(queue.TaskData, map[string]interface{}) (map[string]interface{}, error) {
+		<-release
+		return map[string]interface{}{"hits": 2}, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	args := map[string]interface{}{"strategy_id": 5, "symbols": []string{"AAPL"}}
+	leaderCtx, leaderCancel := context.WithCancel(ctx)
+	leader, err := queue.DedupedTask(leaderCtx, env.Conn, "alert", args, false, 0, 0)
+	if err != nil {
+		t.Fatalf("queuing the first: %v", err)
+	}
+	joiner, err := queue.DedupedTask(ctx, env.Conn, "alert", args, false, 0, 0)
+	if err != nil {
+		t.Fatalf("joining: %v", err)
+	}
+
+	// The submitter that queued the task gives up both ways
+	_ = leader.Cancel()
+	leaderCancel()
+	if _, err := awaitMap(ctx, leader); err == nil {
+		t.Fatalf("the cancelled submitter still got a result")
+	}
+	close(release)
+
+	out, err := awaitMap(ctx, joiner)
+	if err != nil || out["hits"] != float64(2) {
+		t.Fatalf("joiner got %v, %v; want the run's result", out, err)
+	}
+	if n := len(worker.Tasks()); n != 1 {
+		t.Fatalf("worker ran %d tasks, want 1", n)
+	}
+}
+
+func TestSilentWorkerFailsAtDeadline(t *testing.T) {
+	env := testharness.New(t, testharness.WithFakeClock(time.Date(2025, 3, 3, 15, 0, 0, 0, time.UTC)))
+	worker := env.StartWorker(t)
+	worker.Silent(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	h, err := queue.Task(ctx, env.Conn, "backtest", map[string]interface{}{"strategy_id": 2}, false, 0, 30*time.Second)
+	if err != nil {
+		t.Fatalf("queuing: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := awaitMap(ctx, h)
+		done <- err
+	}()
+	for len(worker.Tasks()) == 0 {
+		if ctx.Err() != nil {
+			t.Fatal("the worker never took the task")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Step well past the deadline, giving the loops a moment at each step
+	for i := 0; i < 30; i++ {
+		select {
+		case err := <-done:
+			if apperr.CodeOf(err) != apperr.CodeUpstreamTimeout {
+				t.Fatalf("expected a timeout, got %v", err)
+			}
+			return
+		default:
+		}
+		env.Clock.Advance(5 * time.Second)
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("awaiting a silent worker never failed")
+}
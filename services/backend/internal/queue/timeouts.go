@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Each task type has a run timeout: how long a worker may spend on one
+// attempt before the watchdog gives up on it and retries. The defaults below
+// can be changed per deployment with $TASK_TIMEOUT_<TYPE> (a Go duration,
+// e.g. TASK_TIMEOUT_BACKTEST=20m) and per submission with WithTaskTimeout.
+//
+// A task also has a deadline, after which its submitter stops waiting: one
+// run timeout plus the time allowed to start, for every attempt, cut short by
+// the submitter's own context deadline. Both travel in the task payload so
+// the worker can stop on its own instead of working for nobody.
+var defaultTaskTimeouts = map[string]time.Duration{
+	"backtest":         10 * time.Minute,
+	"screen":           5 * time.Minute,
+	"alert":            2 * time.Minute,
+	"alert_batch":      2 * time.Minute,
+	"signals":          5 * time.Minute,
+	"alert_simulation": 5 * time.Minute,
+	"create_strategy":  15 * time.Minute,
+	"python_agent":     8 * time.Minute,
+	"export_user_data": 10 * time.Minute,
+}
+
+// fallbackTaskTimeout is the run timeout of task types without a default
+const fallbackTaskTimeout = 5 * time.Minute
+
+// awaitGrace is how long Await waits past a task's deadline for the watchdog
+// to report it failed
+const awaitGrace = 10 * time.Second
+
+// startTimeout is how long a queued task may go without a worker reporting
+// it started before it is requeued
+const startTimeout = 60 * time.Second
+
+// TaskTimeout returns the configured run timeout of a task type
+func TaskTimeout(taskType string) time.Duration {
+	env := "TASK_TIMEOUT_" + strings.ToUpper(taskType)
+	if s := os.Getenv(env); s != "" {
+		d, err := time.ParseDuration(s)
+		if err == nil && d > 0 {
+			return d
+		}
+		log.Printf("⚠️ Ignoring invalid $%s %q", env, s)
+	}
+	if d, ok := defaultTaskTimeouts[taskType]; ok {
+		return d
+	}
+	return fallbackTaskTimeout
+}
+
+type taskTimeoutKey struct{}
+
+// WithTaskTimeout returns a context whose tasks run under timeout instead of
+// the one configured for their type
+func WithTaskTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, taskTimeoutKey{}, timeout)
+}
+
+// taskTimeouts resolves a submission's run timeout and deadline. An override
+// in ctx wins over the requested timeout, which wins over the configured one.
+func taskTimeouts(ctx context.Context, taskType string, requested time.Duration, maxRetries int) (time.Duration, time.Time) {
+	timeout := requested
+	if override, ok := ctx.Value(taskTimeoutKey{}).(time.Duration); ok && override > 0 {
+		timeout = override
+	}
+	if timeout <= 0 {
+		timeout = TaskTimeout(taskType)
+	}
+
+	now := Clock.Now()
+	deadline := now.Add(time.Duration(maxRetries+1) * (startTimeout + timeout))
+	if ctxDeadline, ok := ctx.Deadline(); ok {
+		// Context deadlines are on the wall clock
+		if remaining := time.Until(ctxDeadline); now.Add(remaining).Before(deadline) {
+			deadline = now.Add(remaining)
+			if remaining < timeout {
+				timeout = remaining
+			}
+		}
+	}
+	return timeout, deadline
+}
+
+// wallClock translates a time on Clock to the wall clock workers go by,
+// which a frozen or fake Clock isn't
+func wallClock(t time.Time) time.Time {
+	return time.Now().Add(t.Sub(Clock.Now()))
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"backend/internal/data"
+	"net/http"
+)
+
+// registerAdminHandlers mounts the admin API. Every route is limited to the
+// users in ADMIN_USER_IDS (see adminOnly); each handler documents its methods.
+func registerAdminHandlers(mux *http.ServeMux, conn *data.Conn) {
+	// The system notice broadcast to every connected user
+	mux.Handle("/admin/notice", withPanicRecovery(adminOnly(conn, adminNoticeHandler(conn))))
+	// Feature flags and their rollouts
+	mux.Handle("/admin/flags", withPanicRecovery(adminOnly(conn, adminFlagsHandler(conn))))
+	// Agent experiments and their per-variant results
+	mux.Handle("/admin/experiments", withPanicRecovery(adminOnly(conn, adminExperimentsHandler(conn))))
+	// Quality dashboards built from user feedback
+	mux.Handle("/admin/feedback", withPanicRecovery(adminOnly(conn, adminFeedbackHandler(conn))))
+	// Alert delivery latency per type and channel
+	mux.Handle("/admin/alert-latency", withPanicRecovery(adminOnly(conn, adminAlertLatencyHandler(conn))))
+	// Alert loop metrics as time series
+	mux.Handle("/admin/alert-metrics", withPanicRecovery(adminOnly(conn, adminAlertMetricsHandler(conn))))
+	// Pausing, draining and resuming the task queue
+	mux.Handle("/admin/queue-control", withPanicRecovery(adminOnly(conn, adminQueueControlHandler(conn))))
+	// System health for the ops dashboard
+	mux.Handle("/admin/overview", withPanicRecovery(adminOnly(conn, adminOverviewHandler(conn))))
+	// The worker tasks scheduled job runs queued
+	mux.Handle("/admin/job-runs", withPanicRecovery(adminOnly(conn, adminJobRunsHandler(conn))))
+	// Reprocessing a single security
+	mux.Handle("/admin/reprocess", withPanicRecovery(adminOnly(conn, adminReprocessHandler(conn))))
+}
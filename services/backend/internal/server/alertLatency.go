@@ -0,0 +1,57 @@
+package server
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	alertsvc "backend/internal/services/alerts"
+	"net/http"
+	"strconv"
+)
+
+// adminAlertLatencyHandler serves alert delivery latency:
+//
+//	GET /admin/alert-latency?days=1     end-to-end latency per alert type and
+//	                                    channel, against its objective, and the
+//	                                    time spent between pipeline stages
+//	GET /admin/alert-latency?logId=123  how long one logged alert took to
+//	                                    reach each stage and channel
+func adminAlertLatencyHandler(conn *data.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		ctx := r.Context()
+		q := r.URL.Query()
+		if s := q.Get("logId"); s != "" {
+			logID, err := strconv.Atoi(s)
+			if err != nil || logID <= 0 {
+				handleError(w, apperr.Validation("logId must be a positive number"), "admin alert latency")
+				return
+			}
+			detail, err := alertsvc.DeliveryLatency(ctx, conn, logID)
+			if err == nil && detail == nil {
+				err = apperr.NotFound("no delivery trace kept for alert log %d", logID)
+			}
+			if handleError(w, err, "admin alert latency") {
+				return
+			}
+			writeAdminJSON(w, detail)
+			return
+		}
+		days := 1
+		if s := q.Get("days"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				handleError(w, apperr.Validation("days must be a number"), "admin alert latency")
+				return
+			}
+			days = n
+		}
+		report, err := alertsvc.DeliveryLatencyReport(ctx, conn, days)
+		if handleError(w, err, "admin alert latency") {
+			return
+		}
+		writeAdminJSON(w, report)
+	}
+}
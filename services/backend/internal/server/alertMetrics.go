@@ -0,0 +1,60 @@
+package server
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	alertsvc "backend/internal/services/alerts"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adminAlertMetricsHandler serves the alert loop's metrics as time series,
+// for dashboards and SLO tracking:
+//
+//	GET /admin/alert-metrics?granularity=hour&days=2&metric=strategy_runs,...
+//
+// granularity is hour (default, kept 14 days) or day (kept 400 days, the
+// last point being today so far). days defaults to 2 for hours and 30 for
+// days; without metric every metric is returned.
+func adminAlertMetricsHandler(conn *data.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		granularity := q.Get("granularity")
+		if granularity == "" {
+			granularity = alertsvc.MetricsHourly
+		}
+		days := 2
+		if granularity == alertsvc.MetricsDaily {
+			days = 30
+		}
+		if s := q.Get("days"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				handleError(w, apperr.Validation("days must be a positive number"), "admin alert metrics")
+				return
+			}
+			days = n
+		}
+		var metrics []string
+		if s := q.Get("metric"); s != "" {
+			metrics = strings.Split(s, ",")
+		}
+
+		since := time.Now().UTC().Truncate(time.Hour).AddDate(0, 0, -days)
+		series, err := alertsvc.AlertMetricSeries(r.Context(), conn, granularity, since, metrics)
+		if handleError(w, err, "admin alert metrics") {
+			return
+		}
+		writeAdminJSON(w, map[string]interface{}{
+			"granularity": granularity,
+			"since":       since,
+			"series":      series,
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"backend/internal/apperr"
 	"backend/internal/data"
 	"context"
 	"crypto/rand"
@@ -11,17 +12,23 @@ import (
 	"fmt"
 	"log"
 	"math/big"
+	"net/http"
 	"net/smtp"
 	"strconv"
 	"strings"
+	"sync"
 
 	//"log"
 	"os"
 	"time"
 
 	"backend/internal/app/limits"
+	"backend/internal/app/onboarding"
 	"backend/internal/app/pricing"
+	"backend/internal/app/userdata"
+	"backend/internal/services/sessions"
 	"backend/internal/services/telegram"
+	"backend/internal/services/twofactor"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/jackc/pgconn"
@@ -31,8 +38,20 @@ import (
 	"golang.org/x/oauth2/google"
 )
 
-// JWT secret is mandatory – crash early if it is missing so that bad tokens are never issued.
-var privateKey = []byte(mustGetEnv("JWT_SECRET"))
+// JWT secret is mandatory – StartServer checks it up front so that bad tokens
+// are never issued. It is read on first use, not at init, so the package's
+// tests don't need it.
+var (
+	privateKeyOnce  sync.Once
+	privateKeyBytes []byte
+)
+
+func privateKey() []byte {
+	privateKeyOnce.Do(func() {
+		privateKeyBytes = []byte(mustGetEnv("JWT_SECRET"))
+	})
+	return privateKeyBytes
+}
 
 // mustGetEnv behaves like os.Getenv but terminates the process if the variable is empty.
 func mustGetEnv(key string) string {
@@ -71,6 +90,10 @@ func getEnvOrDefault(key, defaultValue string) string {
 const (
 	jwtIssuer   = "peripheral.io"
 	jwtAudience = "peripheral-web-app"
+	// Challenge tokens only let the holder finish a two-factor login; their
+	// audience keeps them from ever passing as a session token
+	twoFactorAudience     = "peripheral-2fa"
+	twoFactorChallengeTTL = 5 * time.Minute
 )
 
 // Claims represents a structure for handling Claims data.
@@ -85,6 +108,10 @@ type LoginResponse struct {
 	Settings   string          `json:"settings"`
 	Setups     [][]interface{} `json:"setups"`
 	ProfilePic string          `json:"profilePic"`
+	// Set instead of Token when the account has two-factor enabled; finish
+	// with verifyTwoFactorLogin
+	TwoFactorRequired  bool   `json:"twoFactorRequired,omitempty"`
+	TwoFactorChallenge string `json:"twoFactorChallenge,omitempty"`
 }
 
 // SignupArgs represents a structure for handling SignupArgs data.
@@ -177,6 +204,10 @@ func Signup(conn *data.Conn, rawArgs json.RawMessage) (interface{}, error) {
 		log.Printf("ERROR: Failed to create user: %v", err)
 		return nil, fmt.Errorf("error creating user: %v", err)
 	}
+	if err := onboarding.EnqueueTx(ctx, tx, userID); err != nil {
+		log.Printf("ERROR: Failed to queue onboarding: %v", err)
+		return nil, err
+	}
 
 	// Note: Invite will be marked as used later in VerifyOTP() after email verification
 	// This ensures the invite is only consumed when the user proves mailbox ownership
@@ -269,7 +300,16 @@ func Login(conn *data.Conn, rawArgs json.RawMessage) (interface{}, error) {
 		// The error is logged for investigation but doesn't block authentication
 	}
 
-	token, err := createToken(userID)
+	challenge, err := twoFactorChallengeIfEnabled(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != "" {
+		log.Printf("Login for user ID %d awaiting two-factor code", userID)
+		return LoginResponse{TwoFactorRequired: true, TwoFactorChallenge: challenge}, nil
+	}
+
+	token, err := createToken(conn, userID)
 	if err != nil {
 		log.Printf("ERROR: Token creation failed for user ID %d: %v", userID, err)
 		return nil, err
@@ -579,12 +619,20 @@ func createOTP() (OTP, error) {
 	return OTP{otp: otp, otpExpiresAt: otpExpiresAt}, nil
 }
 
-func createToken(userID int) (string, error) {
+// createToken issues a token for a new login session
+func createToken(conn *data.Conn, userID int) (string, error) {
 	now := time.Now().UTC()
-	expirationTime := now.Add(6 * time.Hour)
+	expirationTime := now.Add(sessions.MaxTokenLifetime)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	sessionID, err := sessions.Create(ctx, conn, userID, expirationTime)
+	if err != nil {
+		return "", err
+	}
 	claims := &Claims{
 		UserID: userID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
 			Issuer:    jwtIssuer,
 			Audience:  jwt.ClaimStrings{jwtAudience},
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -592,35 +640,133 @@ func createToken(userID int) (string, error) {
 		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(privateKey)
+	return token.SignedString(privateKey())
 }
 
-func validateToken(tokenString string) (int, error) {
-	claims := &Claims{} // Initialize an instance of your Claims struct
+// twoFactorChallengeIfEnabled returns a challenge token for users with
+// two-factor enabled, and "" for everyone else
+func twoFactorChallengeIfEnabled(ctx context.Context, conn *data.Conn, userID int) (string, error) {
+	enabled, err := twofactor.Enabled(ctx, conn, userID)
+	if err != nil || !enabled {
+		return "", err
+	}
+	now := time.Now().UTC()
+	claims := &Claims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    jwtIssuer,
+			Audience:  jwt.ClaimStrings{twoFactorAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(twoFactorChallengeTTL)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(privateKey())
+}
+
+// VerifyTwoFactorLoginArgs represents the arguments for VerifyTwoFactorLogin
+type VerifyTwoFactorLoginArgs struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
 
-	// Default profile pic is empty (frontend will generate initial)
+// VerifyTwoFactorLogin finishes a login that returned a two-factor challenge
+func VerifyTwoFactorLogin(conn *data.Conn, rawArgs json.RawMessage) (interface{}, error) {
+	var args VerifyTwoFactorLoginArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(args.Challenge, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return privateKey(), nil
+	})
+	if err != nil || !claims.VerifyIssuer(jwtIssuer, true) || !claims.VerifyAudience(twoFactorAudience, true) {
+		return nil, apperr.Validation("this sign-in has expired; sign in again")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := twofactor.Verify(ctx, conn, claims.UserID, args.Code); err != nil {
+		return nil, err
+	}
+
+	var email string
+	var profilePicture sql.NullString
+	err = conn.DB.QueryRow(ctx, `SELECT email, profile_picture FROM users WHERE userId = $1`,
+		claims.UserID).Scan(&email, &profilePicture)
+	if err != nil {
+		return nil, fmt.Errorf("error loading user: %v", err)
+	}
+	token, err := createToken(conn, claims.UserID)
+	if err != nil {
+		log.Printf("ERROR: Token creation failed for user ID %d: %v", claims.UserID, err)
+		return nil, err
+	}
+	if err := telegram.SendTelegramUserUsageMessage(fmt.Sprintf("%s logged in to the website [2fa]", email)); err != nil {
+		log.Printf("Warning: failed to send telegram notification: %v", err)
+	}
+	return LoginResponse{Token: token, ProfilePic: profilePicture.String}, nil
+}
+
+// validateToken checks a token and that its session has not been revoked, and
+// records the request as the session's latest activity. Redis errors let the
+// token through so an outage doesn't sign everyone out.
+func validateToken(conn *data.Conn, r *http.Request, tokenString string) (*Claims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+	revoked, err := sessions.IsRevoked(ctx, conn, claims.UserID, claims.ID, issuedAt)
+	if err != nil {
+		log.Printf("⚠️ %v", err)
+	} else if revoked {
+		return nil, fmt.Errorf("session revoked")
+	}
+	sessions.Touch(conn, claims.ID, clientIP(r), r.UserAgent())
+	return claims, nil
+}
+
+// parseToken verifies a token's signature and standard claims
+func parseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{} // Initialize an instance of your Claims struct
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
 		// Enforce expected signing method
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 		}
-		return privateKey, nil
+		return privateKey(), nil
 	})
 	if err != nil {
-		return -1, fmt.Errorf("cannot parse token: %w", err)
+		return nil, fmt.Errorf("cannot parse token: %w", err)
 	}
 	if !token.Valid {
-		return -1, fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
 	}
 	// Validate issuer and audience
 	if !claims.VerifyIssuer(jwtIssuer, true) {
-		return -1, fmt.Errorf("token issuer mismatch")
+		return nil, fmt.Errorf("token issuer mismatch")
 	}
 	if !claims.VerifyAudience(jwtAudience, true) {
-		return -1, fmt.Errorf("token audience mismatch")
+		return nil, fmt.Errorf("token audience mismatch")
 	}
-	return claims.UserID, nil
+	return claims, nil
+}
+
+// clientIP is the caller's address as seen by the load balancer
+func clientIP(r *http.Request) string {
+	if ip := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-For"), ",")[0]); ip != "" {
+		return ip
+	}
+	return r.RemoteAddr
 }
 
 // redeemInviteIfProvided handles invite redemption logic for existing users
@@ -750,8 +896,10 @@ type GoogleUser struct {
 
 // GoogleLoginResponse represents a structure for handling GoogleLoginResponse data.
 type GoogleLoginResponse struct {
-	Token      string `json:"token"`
-	ProfilePic string `json:"profilePic"`
+	Token              string `json:"token"`
+	ProfilePic         string `json:"profilePic"`
+	TwoFactorRequired  bool   `json:"twoFactorRequired,omitempty"`
+	TwoFactorChallenge string `json:"twoFactorChallenge,omitempty"`
 }
 
 // GoogleLogin performs operations related to GoogleLogin functionality.
@@ -897,6 +1045,11 @@ func GoogleCallback(conn *data.Conn, rawArgs json.RawMessage) (interface{}, erro
 			return nil, fmt.Errorf("failed to create user: %v", err)
 		}
 
+		if err := onboarding.EnqueueTx(ctx, tx, userID); err != nil {
+			log.Printf("ERROR: Failed to queue onboarding for Google user: %v", err)
+			return nil, err
+		}
+
 		// Handle invite marking within the transaction before committing
 		if invite != nil {
 			// Mark invite as used within the transaction
@@ -1012,8 +1165,19 @@ func GoogleCallback(conn *data.Conn, rawArgs json.RawMessage) (interface{}, erro
 		}
 	}
 
+	twoFactorCtx, twoFactorCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer twoFactorCancel()
+	challenge, err := twoFactorChallengeIfEnabled(twoFactorCtx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != "" {
+		log.Printf("Google login for user ID %d awaiting two-factor code", userID)
+		return GoogleLoginResponse{TwoFactorRequired: true, TwoFactorChallenge: challenge}, nil
+	}
+
 	// Create JWT token
-	jwtToken, err := createToken(userID)
+	jwtToken, err := createToken(conn, userID)
 	if err != nil {
 		log.Printf("ERROR: Failed to create token for Google user ID %d: %v", userID, err)
 		return nil, fmt.Errorf("failed to create token: %v", err)
@@ -1105,7 +1269,8 @@ func DeleteAccount(conn *data.Conn, userID int, rawArgs json.RawMessage) (interf
 
 	// Parse arguments to get confirmation
 	var args struct {
-		Confirmation string `json:"confirmation,omitempty"` // Required for both public and private calls
+		Confirmation  string `json:"confirmation,omitempty"` // Required for both public and private calls
+		TwoFactorCode string `json:"twoFactorCode,omitempty"`
 	}
 
 	if err := json.Unmarshal(rawArgs, &args); err != nil {
@@ -1118,28 +1283,16 @@ func DeleteAccount(conn *data.Conn, userID int, rawArgs json.RawMessage) (interf
 	}
 
 	// Create a timeout context to prevent hanging
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), userdata.PurgeTimeout)
 	defer cancel()
 
-	// Start a transaction
-	tx, err := conn.DB.Begin(ctx)
-	if err != nil {
-		log.Printf("ERROR: Failed to start delete account transaction: %v", err)
-		return nil, fmt.Errorf("error starting transaction: %v", err)
+	if err := twofactor.RequireStepUp(ctx, conn, userID, args.TwoFactorCode); err != nil {
+		return nil, err
 	}
 
-	// Ensure transaction is either committed or rolled back
-	var txClosed bool
-	defer func() {
-		if !txClosed && tx != nil {
-			log.Println("Rolling back delete account transaction due to error")
-			_ = tx.Rollback(context.Background())
-		}
-	}()
-
 	// Get auth type for logging purposes
 	var authType string
-	err = tx.QueryRow(ctx, "SELECT auth_type FROM users WHERE userId = $1", userID).Scan(&authType)
+	err := conn.DB.QueryRow(ctx, "SELECT auth_type FROM users WHERE userId = $1", userID).Scan(&authType)
 	if err != nil {
 		log.Printf("ERROR: Failed to get user account type for deletion: %v", err)
 		return nil, fmt.Errorf("failed to get user account: %v", err)
@@ -1147,76 +1300,12 @@ func DeleteAccount(conn *data.Conn, userID int, rawArgs json.RawMessage) (interf
 
 	log.Printf("Deleting account with ID: %d, type: %s", userID, authType)
 
-	// Delete watchlists
-	_, err = tx.Exec(ctx, "DELETE FROM watchlists WHERE userId = $1", userID)
-	if err != nil {
-		log.Printf("ERROR: Failed to delete watchlists for user %d: %v", userID, err)
-		return nil, err
-	}
-
-	// Delete studies
-	_, err = tx.Exec(ctx, "DELETE FROM studies WHERE userId = $1", userID)
-	if err != nil {
-		log.Printf("ERROR: Failed to delete studies for user %d: %v", userID, err)
-		return nil, err
-	}
-
-	// Delete strategies
-	_, err = tx.Exec(ctx, "DELETE FROM strategies WHERE userId = $1", userID)
-	if err != nil {
-		log.Printf("ERROR: Failed to delete strategies for user %d: %v", userID, err)
-		return nil, err
-	}
-
-	// Delete horizontal lines
-	_, err = tx.Exec(ctx, "DELETE FROM horizontal_lines WHERE userId = $1", userID)
-	if err != nil {
-		log.Printf("ERROR: Failed to delete horizontal lines for user %d: %v", userID, err)
-		return nil, err
-	}
-
-	// Delete trades
-	_, err = tx.Exec(ctx, "DELETE FROM trades WHERE userId = $1", userID)
-	if err != nil {
-		log.Printf("ERROR: Failed to delete trades for user %d: %v", userID, err)
-		return nil, err
-	}
-
-	// Delete trade executions
-	_, err = tx.Exec(ctx, "DELETE FROM trade_executions WHERE userId = $1", userID)
-	if err != nil {
-		log.Printf("ERROR: Failed to delete trade executions for user %d: %v", userID, err)
-		return nil, err
-	}
-
-	// Delete alerts
-	_, err = tx.Exec(ctx, "DELETE FROM alerts WHERE userId = $1", userID)
-	if err != nil {
-		log.Printf("ERROR: Failed to delete alerts for user %d: %v", userID, err)
-		return nil, err
-	}
-
-	// Delete conversations
-	_, err = tx.Exec(ctx, "DELETE FROM conversations WHERE userId = $1", userID)
-	if err != nil {
-		log.Printf("ERROR: Failed to delete conversations for user %d: %v", userID, err)
-		return nil, err
-	}
-
-	// Delete the user
-	_, err = tx.Exec(ctx, "DELETE FROM users WHERE userId = $1", userID)
-	if err != nil {
-		log.Printf("ERROR: Failed to delete user %d: %v", userID, err)
+	// Delete the user and everything stored for them across Postgres and Redis
+	if err := userdata.PurgeUserData(ctx, conn, userID); err != nil {
+		log.Printf("ERROR: Failed to delete account %d: %v", userID, err)
 		return nil, fmt.Errorf("failed to delete user: %v", err)
 	}
 
-	// Commit the transaction
-	if err := tx.Commit(ctx); err != nil {
-		log.Printf("ERROR: Failed to commit delete account transaction: %v", err)
-		return nil, fmt.Errorf("error committing transaction: %v", err)
-	}
-	txClosed = true
-
 	log.Printf("Successfully deleted account with ID: %d", userID)
 	return map[string]string{"status": "success"}, nil
 }
@@ -2,6 +2,8 @@ package server
 
 import (
 	"backend/internal/data"
+	"backend/internal/dryrun"
+	"backend/internal/queue"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -10,6 +12,8 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 type QueueArgs struct {
@@ -125,7 +129,7 @@ func listJobs() {
 
 	// Create a table for output
 	table := NewTableWriter(os.Stdout)
-	table.SetHeader([]string{"Name", "Schedule", "Skip Weekends", "Run On Init"})
+	table.SetHeader([]string{"Name", "Schedule", "Skip Weekends", "Run On Init", "Resources"})
 
 	// Sort jobs by name for consistent output
 	sortedJobs := make([]*Job, len(scheduler.Jobs))
@@ -141,6 +145,7 @@ func listJobs() {
 			scheduleStr,
 			fmt.Sprintf("%t", job.SkipOnWeekends),
 			fmt.Sprintf("%t", job.RunOnInit),
+			joinClasses(job.Resources),
 		})
 	}
 
@@ -264,7 +269,7 @@ func getAllJobsStatus() {
 	table.Render()
 }
 
-func runJob(jobName string) error {
+func runJob(jobName string, dryRun bool) error {
 	// Create a new scheduler to get the job list
 	inContainer := os.Getenv("IN_CONTAINER") == "true"
 	conn, cleanup := data.InitConn(inContainer)
@@ -294,15 +299,24 @@ func runJob(jobName string) error {
 	////fmt.Printf("Running job '%s'...\n", job.Name)
 	//startTime := time.Now()
 
-	// Get initial queue length to compare after job execution
-	initialQueueLen, err := conn.Cache.LLen(context.Background(), "queue").Result()
-	if err != nil {
-		////fmt.Printf("Warning: Could not get initial queue length: %v\n", err)
-		initialQueueLen = 0
+	// Run it under its own run ID, so the worker tasks it queues are
+	// recorded against the run
+	runID := uuid.New().String()
+	ctx := queue.WithJobRun(context.Background(), job.Name, runID)
+	if dryRun {
+		// Simulate its worker tasks and notifications and leave its run
+		// times alone
+		var rec *dryrun.Recorder
+		ctx, rec = dryrun.WithRecorder(ctx)
+		fmt.Printf("Dry running job %s (run %s)\n", job.Name, runID)
+		err = job.run(ctx, conn)
+		printDryRunActions(rec)
+		return err
 	}
+	fmt.Printf("Running job %s (run %s)\n", job.Name, runID)
 
 	// Execute the job function
-	err = job.Function(conn)
+	err = job.run(ctx, conn)
 
 	//duration := time.Since(startTime).Round(time.Millisecond)
 	if err != nil {
@@ -320,198 +334,87 @@ func runJob(jobName string) error {
 		return err
 	}
 
-	// Check if the job added items to the queue
-	currentQueueLen, err := conn.Cache.LLen(context.Background(), "queue").Result()
+	// Wait on the tasks the run queued, if any; the completion time is only
+	// updated once all of them succeed
+	tasks, err := queue.JobRunTasks(context.Background(), conn, runID)
 	if err != nil {
-		////fmt.Printf("Warning: Could not get current queue length: %v\n", err)
 		return err
 	}
+	if len(tasks) > 0 && !waitForJobRunTasks(conn, job.Name, runID) {
+		return nil
+	}
+	completionTime := time.Now()
+	lastCompletionStr := completionTime.Format(time.RFC3339)
+	return conn.Cache.Set(context.Background(), getJobLastCompletionKey(job.Name), lastCompletionStr, 0).Err()
+}
 
-	// If new items were added to the queue, monitor them
-	if currentQueueLen > initialQueueLen {
-		////fmt.Printf("\nDetected %d new task(s) in the queue. Monitoring worker logs...\n", currentQueueLen-initialQueueLen)
-
-		// Get the queued items
-		queueItems, err := conn.Cache.LRange(context.Background(), "queue", 0, currentQueueLen-1).Result()
-		if err != nil {
-			////fmt.Printf("Error getting queue items: %v\n", err)
-			return err
-		}
-
-		// Extract task IDs for monitoring
-		var taskIDs []string
-		var taskFuncs []string
-		for _, item := range queueItems {
-			var queueArgs QueueArgs
-			if err := json.Unmarshal([]byte(item), &queueArgs); err != nil {
-				////fmt.Printf("Error parsing queue item: %v\n", err)
-				continue
-			}
-			taskIDs = append(taskIDs, queueArgs.ID)
-			_ = append(taskFuncs, queueArgs.Func)
-		}
-
-		// Print task information
-		////fmt.Println("\nQueued tasks:")
-		//for i, id := range taskIDs {
-		////fmt.Printf("  %d: %s (ID: %s)\n", i+1, taskFuncs[i], id)
-		//}
-
-		// Monitor task status and wait for completion
-		////fmt.Println("\nWaiting for worker to process tasks...")
-		allTasksSucceeded := monitorTasksAndWait(conn, taskIDs)
-
-		// Only update the last completion time if all tasks succeeded
-		if allTasksSucceeded {
-			completionTime := time.Now()
-			// Update last completion time
-			lastCompletionStr := completionTime.Format(time.RFC3339)
-			err = conn.Cache.Set(context.Background(), getJobLastCompletionKey(job.Name), lastCompletionStr, 0).Err()
-			if err != nil {
-				return err
-			}
-		}
-	} else {
-		// For directly executed jobs with no queued tasks, update completion time immediately
-		completionTime := time.Now()
-		lastCompletionStr := completionTime.Format(time.RFC3339)
-		err = conn.Cache.Set(context.Background(), getJobLastCompletionKey(job.Name), lastCompletionStr, 0).Err()
-		if err != nil {
-			return err
-		}
+// printDryRunActions lists what a dry run would have done
+func printDryRunActions(rec *dryrun.Recorder) {
+	actions := rec.Actions()
+	if len(actions) == 0 {
+		fmt.Println("Nothing would have been queued or sent")
+		return
+	}
+	tw := NewTableWriter(os.Stdout)
+	tw.SetHeader([]string{"AT", "KIND", "TARGET", "WOULD HAVE"})
+	for _, a := range actions {
+		tw.Append([]string{a.At.Format("15:04:05"), a.Kind, a.Target, a.Summary})
+	}
+	tw.Render()
+	if n := rec.Dropped(); n > 0 {
+		fmt.Printf("... and %d more\n", n)
 	}
-	return nil
 }
 
-// monitorTasksAndWait polls the status of tasks, displays their progress, and returns whether all tasks completed successfully
-func monitorTasksAndWait(conn *data.Conn, taskIDs []string) bool {
+// jobRunTaskGrace is how long a task past its deadline is waited on for the
+// watchdog to report it failed
+const jobRunTaskGrace = 30 * time.Second
+
+// waitForJobRunTasks polls the tasks a job run queued, printing the run's
+// task tree whenever a status changes, and returns whether all of them
+// completed successfully. It gives up once every unfinished task is past its
+// deadline, and the watchdog has had a little while to report it.
+func waitForJobRunTasks(conn *data.Conn, jobName, runID string) bool {
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
 
-	completedTasks := make(map[string]bool)
-	failedTasks := make(map[string]bool)
-	startTime := time.Now()
-	timeout := 5 * time.Minute
-
-	// Store previous statuses to avoid printing duplicates
-	previousStatuses := make(map[string]string)
-
-	// Print header
-	////fmt.Println("\n=== TASK MONITORING ===")
-	////fmt.Printf("Started at: %s\n", startTime.Format("2006-01-02 15:04:05"))
-	////fmt.Printf("Monitoring %d task(s)\n", len(taskIDs))
-	////fmt.Println("-------------------------")
-
+	previous := ""
 	for range ticker.C {
-		for _, taskID := range taskIDs {
-			if completedTasks[taskID] || failedTasks[taskID] {
-				continue
-			}
-
-			// Get task status
-			statusJSON, err := conn.Cache.Get(context.Background(), taskID).Result()
-			if err != nil {
-				newStatus := fmt.Sprintf("Error: %v", err)
-				if previousStatuses[taskID] != newStatus {
-					////fmt.Printf("[%s] Task %s: %s\n", time.Now().Format("15:04:05"), taskID, newStatus)
-					previousStatuses[taskID] = newStatus
-				}
-				continue
+		tasks, err := queue.JobRunTasks(context.Background(), conn, runID)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		done, succeeded := 0, 0
+		var deadline time.Time
+		var states strings.Builder
+		for _, task := range tasks {
+			fmt.Fprintf(&states, "%s=%s/%d;", task.TaskID, task.Status, task.Attempt)
+			if task.Done() {
+				done++
+			} else if task.Deadline.After(deadline) {
+				deadline = task.Deadline
 			}
-
-			// Parse status
-			var status string
-			var result map[string]interface{}
-
-			// First try to parse as simple string (for "queued" or "running" status)
-			err = json.Unmarshal([]byte(statusJSON), &status)
-			if err == nil {
-				// It's a string status
-				if previousStatuses[taskID] != status {
-					////fmt.Printf("[%s] Task %s: %s\n", time.Now().Format("15:04:05"), taskID, status)
-					previousStatuses[taskID] = status
-				}
-			} else {
-				// Try to parse as result object
-				err = json.Unmarshal([]byte(statusJSON), &result)
-				if err != nil {
-					newStatus := fmt.Sprintf("Error parsing status: %v", err)
-					if previousStatuses[taskID] != newStatus {
-						////fmt.Printf("[%s] Task %s: %s\n", time.Now().Format("15:04:05"), taskID, newStatus)
-						previousStatuses[taskID] = newStatus
-					}
-					continue
-				}
-
-				// DEBUG: Print the structure of the result
-				////fmt.Printf("\nDEBUG: Task data structure keys: %v\n", getKeys(result))
-				//if resultObj, ok := result["result"].(map[string]interface{}); ok {
-				////fmt.Printf("DEBUG: Result field keys: %v\n", getKeys(resultObj))
-				//}
-
-				// Check if it has an error field
-				if errMsg, ok := result["error"]; ok && errMsg != nil {
-					newStatus := fmt.Sprintf("Failed: %v", errMsg)
-					if previousStatuses[taskID] != newStatus {
-						////fmt.Printf("[%s] Task %s: %s\n", time.Now().Format("15:04:05"), taskID, newStatus)
-						previousStatuses[taskID] = newStatus
-					}
-					failedTasks[taskID] = true
-				} else {
-					// Task completed successfully
-					newStatus := "Completed successfully"
-					if previousStatuses[taskID] != newStatus {
-						////fmt.Printf("[%s] Task %s: %s\n", time.Now().Format("15:04:05"), taskID, newStatus)
-						previousStatuses[taskID] = newStatus
-					}
-					completedTasks[taskID] = true
-				}
+			if task.Status == "completed" {
+				succeeded++
 			}
 		}
-
-		// Check if all tasks are completed or failed
-		if len(completedTasks)+len(failedTasks) == len(taskIDs) {
-			////fmt.Printf("\n=== MONITORING COMPLETE ===\n")
-			////fmt.Printf("Duration: %v\n", time.Since(startTime).Round(time.Millisecond))
-			////fmt.Printf("%d/%d tasks completed successfully.\n", len(completedTasks), len(taskIDs))
-
-			// List failed tasks if any
-			/*
-				if len(failedTasks) > 0 {
-					////fmt.Println("\nFailed tasks:")
-					//for _, taskID := range taskIDs {
-					//	if failedTasks[taskID] {
-					//		// Debug output would go here
-					//	}
-					//}
-				}*/
-
-			// Return true only if all tasks completed successfully
-			return len(completedTasks) == len(taskIDs)
+		if states.String() != previous {
+			previous = states.String()
+			fmt.Println()
+			printJobRunTree(jobName, JobRunTasks{RunID: runID, Tasks: tasks})
 		}
 
-		if time.Since(startTime) > timeout {
-			////fmt.Printf("\n=== MONITORING TIMEOUT ===\n")
-			////fmt.Printf("Timeout after %v waiting for tasks to complete.\n", timeout)
-			////fmt.Printf("%d/%d tasks completed successfully.\n", len(completedTasks), len(taskIDs))
-
-			// List incomplete and failed tasks
-			/*
-				if len(completedTasks) < len(taskIDs) {
-					////fmt.Println("\nIncomplete or failed tasks:")
-					//for _, taskID := range taskIDs {
-					//	if !completedTasks[taskID] {
-					//		// Debug output would go here
-					//	}
-					//}
-				}
-			*/
-
+		if done == len(tasks) {
+			fmt.Printf("\n%d/%d tasks completed successfully\n", succeeded, len(tasks))
+			return succeeded == len(tasks)
+		}
+		if time.Now().After(deadline.Add(jobRunTaskGrace)) {
+			fmt.Printf("\nTimed out with %d/%d tasks finished\n", done, len(tasks))
 			return false
 		}
 	}
-	// This line should be unreachable due to the loop condition, but Go requires a return statement.
-	return false // Added default return
+	return false
 }
 
 // monitorTasks polls the status of tasks and displays their progress
@@ -845,15 +748,15 @@ func printUsage() {
 			execute:     func(_ []string) { listJobs() },
 		},
 		"run": {
-			usage:       "run [job_name]",
-			description: "Run a specific job",
+			usage:       "run [job_name] [--dry-run]",
+			description: "Run a specific job; --dry-run simulates its worker tasks and notifications",
 			execute: func(args []string) {
 				if len(args) < 1 {
 					////fmt.Println("Error: job name is required")
 					printUsage()
 					return
 				}
-				err := runJob(args[0])
+				err := runJob(args[0], len(args) > 1 && args[1] == "--dry-run")
 				if err != nil {
 					fmt.Printf("Error running job: %v\n", err)
 				}
@@ -883,6 +786,86 @@ func printUsage() {
 				createInvite(planName, trialDays)
 			},
 		},
+		"prompts": {
+			usage:       "prompts [list|push|activate|reload] ...",
+			description: "Manage versioned agent prompt overrides",
+			execute:     promptsCommand,
+		},
+		"agent-eval": {
+			usage:       "agent-eval [--corpus dir] [--run substring] [--out report.json]",
+			description: "Run the agent tool-calling eval corpus with mocked tools",
+			execute:     agentEvalCommand,
+		},
+		"agent-replay": {
+			usage:       "agent-replay [message_id] [--out replay.json]",
+			description: "Replay a recorded agent message without calling the model or tools",
+			execute:     agentReplayCommand,
+		},
+		"notice": {
+			usage:       "notice [--warning] [message...]",
+			description: "Broadcast a service notice to all connected users",
+			execute:     noticeCommand,
+		},
+		"replay-record": {
+			usage:       "replay-record list|add|remove [ticker...]",
+			description: "Manage the tickers whose 1-second bars are recorded for replay",
+			execute:     replayRecordCommand,
+		},
+		"backfill": {
+			usage:       "backfill enqueue|status|pause|resume|run [options]",
+			description: "Queue and manage historical OHLCV backfills from Polygon",
+			execute:     backfillCommand,
+		},
+		"aggregates": {
+			usage:       "aggregates ensure|status|refresh [options]",
+			description: "Create, inspect and refresh the chart's OHLCV continuous aggregates",
+			execute:     aggregatesCommand,
+		},
+		"screener-shards": {
+			usage:       "screener-shards",
+			description: "Show the per-shard progress of the current or last screener refresh",
+			execute:     screenerShardsCommand,
+		},
+		"onboarding": {
+			usage:       "onboarding status|repair|run [options]",
+			description: "Show, repair or run the provisioning of new accounts",
+			execute:     onboardingCommand,
+		},
+		"index-constituents": {
+			usage:       "index-constituents sync|import|list [options]",
+			description: "Sync, import or list point-in-time index constituents",
+			execute:     indexConstituentsCommand,
+		},
+		"securities-reconcile": {
+			usage:       "securities-reconcile run|report [options]",
+			description: "Reconcile securities with Polygon reference data or show a run's changes",
+			execute:     securitiesReconcileCommand,
+		},
+		"reprocess": {
+			usage:       "reprocess <ticker> [--days N] | status <ticker>",
+			description: "Reprocess one security end to end: details, bar gaps, aggregates, screener row and caches",
+			execute:     reprocessCommand,
+		},
+		"openapi": {
+			usage:       "openapi spec|client|call [options]",
+			description: "Print the OpenAPI document, generate the Go client or call a function through it",
+			execute:     openapiCommand,
+		},
+		"alert-evaluations": {
+			usage:       "alert-evaluations <strategy_id> [time] [limit]",
+			description: "Show why a strategy alert ran, was skipped or failed in recent cycles",
+			execute:     alertEvaluationsCommand,
+		},
+		"budgets": {
+			usage:       "budgets [days]",
+			description: "Show endpoints and agent tools that overran their latency budget",
+			execute:     budgetsCommand,
+		},
+		"conversation-sizes": {
+			usage:       "conversation-sizes [days]",
+			description: "Show conversation cache sizes, offloaded results and trimming",
+			execute:     conversationSizesCommand,
+		},
 		"hash-passwords": {
 			usage:       "CAN ONLY BE USED ONCE HASHES ALL PASSWORDS",
 			description: "THIS SHOULD ONLY EVER BE USED ONCE AND THEN REMOVED",
@@ -901,11 +884,26 @@ func printUsage() {
 				}
 			},
 		},
+		"job-history": {
+			usage:       "job-history JOB_NAME [LIMIT]",
+			description: "Show a job's recent runs and flag unusually slow ones",
+			execute:     jobHistoryCommand,
+		},
+		"job-tasks": {
+			usage:       "job-tasks RUN_ID | JOB_NAME [LIMIT]",
+			description: "Show the worker tasks job runs queued and their statuses",
+			execute:     jobTasksCommand,
+		},
 		"queue": {
 			usage:       "queue",
 			description: "Get status of the job queue",
 			execute:     func(_ []string) { getQueueStatus() },
 		},
+		"queue-control": {
+			usage:       "queue-control status|pause|drain|resume [reason...]",
+			description: "Pause, drain or resume task queue consumption",
+			execute:     queueControlCommand,
+		},
 		"monitor": {
 			usage:       "monitor [task_id]",
 			description: "Monitor a specific task by ID",
@@ -963,15 +961,15 @@ func StartCLI() {
 			execute:     func(_ []string) { listJobs() },
 		},
 		"run": {
-			usage:       "run [job_name]",
-			description: "Run a specific job",
+			usage:       "run [job_name] [--dry-run]",
+			description: "Run a specific job; --dry-run simulates its worker tasks and notifications",
 			execute: func(args []string) {
 				if len(args) < 1 {
 					////fmt.Println("Error: job name is required")a
 					printUsage()
 					return
 				}
-				err := runJob(args[0])
+				err := runJob(args[0], len(args) > 1 && args[1] == "--dry-run")
 				if err != nil {
 					fmt.Printf("Error running job: %v\n", err)
 				}
@@ -1001,6 +999,86 @@ func StartCLI() {
 				createInvite(planName, trialDays)
 			},
 		},
+		"prompts": {
+			usage:       "prompts [list|push|activate|reload] ...",
+			description: "Manage versioned agent prompt overrides",
+			execute:     promptsCommand,
+		},
+		"agent-eval": {
+			usage:       "agent-eval [--corpus dir] [--run substring] [--out report.json]",
+			description: "Run the agent tool-calling eval corpus with mocked tools",
+			execute:     agentEvalCommand,
+		},
+		"agent-replay": {
+			usage:       "agent-replay [message_id] [--out replay.json]",
+			description: "Replay a recorded agent message without calling the model or tools",
+			execute:     agentReplayCommand,
+		},
+		"notice": {
+			usage:       "notice [--warning] [message...]",
+			description: "Broadcast a service notice to all connected users",
+			execute:     noticeCommand,
+		},
+		"replay-record": {
+			usage:       "replay-record list|add|remove [ticker...]",
+			description: "Manage the tickers whose 1-second bars are recorded for replay",
+			execute:     replayRecordCommand,
+		},
+		"backfill": {
+			usage:       "backfill enqueue|status|pause|resume|run [options]",
+			description: "Queue and manage historical OHLCV backfills from Polygon",
+			execute:     backfillCommand,
+		},
+		"aggregates": {
+			usage:       "aggregates ensure|status|refresh [options]",
+			description: "Create, inspect and refresh the chart's OHLCV continuous aggregates",
+			execute:     aggregatesCommand,
+		},
+		"screener-shards": {
+			usage:       "screener-shards",
+			description: "Show the per-shard progress of the current or last screener refresh",
+			execute:     screenerShardsCommand,
+		},
+		"onboarding": {
+			usage:       "onboarding status|repair|run [options]",
+			description: "Show, repair or run the provisioning of new accounts",
+			execute:     onboardingCommand,
+		},
+		"index-constituents": {
+			usage:       "index-constituents sync|import|list [options]",
+			description: "Sync, import or list point-in-time index constituents",
+			execute:     indexConstituentsCommand,
+		},
+		"securities-reconcile": {
+			usage:       "securities-reconcile run|report [options]",
+			description: "Reconcile securities with Polygon reference data or show a run's changes",
+			execute:     securitiesReconcileCommand,
+		},
+		"reprocess": {
+			usage:       "reprocess <ticker> [--days N] | status <ticker>",
+			description: "Reprocess one security end to end: details, bar gaps, aggregates, screener row and caches",
+			execute:     reprocessCommand,
+		},
+		"openapi": {
+			usage:       "openapi spec|client|call [options]",
+			description: "Print the OpenAPI document, generate the Go client or call a function through it",
+			execute:     openapiCommand,
+		},
+		"alert-evaluations": {
+			usage:       "alert-evaluations <strategy_id> [time] [limit]",
+			description: "Show why a strategy alert ran, was skipped or failed in recent cycles",
+			execute:     alertEvaluationsCommand,
+		},
+		"budgets": {
+			usage:       "budgets [days]",
+			description: "Show endpoints and agent tools that overran their latency budget",
+			execute:     budgetsCommand,
+		},
+		"conversation-sizes": {
+			usage:       "conversation-sizes [days]",
+			description: "Show conversation cache sizes, offloaded results and trimming",
+			execute:     conversationSizesCommand,
+		},
 		"hash-passwords": {
 			usage:       "CAN ONLY BE USED ONCE HASHES ALL PASSWORDS",
 			description: "THIS SHOULD ONLY EVER BE USED ONCE AND THEN REMOVED",
@@ -1019,11 +1097,26 @@ func StartCLI() {
 				}
 			},
 		},
+		"job-history": {
+			usage:       "job-history JOB_NAME [LIMIT]",
+			description: "Show a job's recent runs and flag unusually slow ones",
+			execute:     jobHistoryCommand,
+		},
+		"job-tasks": {
+			usage:       "job-tasks RUN_ID | JOB_NAME [LIMIT]",
+			description: "Show the worker tasks job runs queued and their statuses",
+			execute:     jobTasksCommand,
+		},
 		"queue": {
 			usage:       "queue",
 			description: "Get status of the job queue",
 			execute:     func(_ []string) { getQueueStatus() },
 		},
+		"queue-control": {
+			usage:       "queue-control status|pause|drain|resume [reason...]",
+			description: "Pause, drain or resume task queue consumption",
+			execute:     queueControlCommand,
+		},
 		"monitor": {
 			usage:       "monitor [task_id]",
 			description: "Monitor a specific task by ID",
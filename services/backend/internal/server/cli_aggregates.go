@@ -0,0 +1,128 @@
+package server
+
+import (
+	"backend/internal/data"
+	"backend/internal/services/marketdata"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const aggregatesUsage = `Usage:
+  jobctl aggregates ensure
+  jobctl aggregates status
+  jobctl aggregates refresh [--timeframe 1m|1d] [--ticker T] --from YYYY-MM-DD [--to YYYY-MM-DD]
+  ensure creates missing chart aggregates and their refresh policies. refresh
+  materializes a date range of the aggregates built on the 1m (default) or 1d
+  bars, e.g. after loading history; --ticker narrows the range to the span of
+  that ticker's bars, though the refresh covers every ticker in it.`
+
+func aggregatesCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Println(aggregatesUsage)
+		return
+	}
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+
+	switch args[0] {
+	case "ensure":
+		if err := marketdata.EnsureChartAggregates(conn); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("%d chart aggregates in place\n", len(marketdata.ChartAggregates))
+	case "status":
+		aggregatesStatus(conn)
+	case "refresh":
+		aggregatesRefresh(conn, args[1:])
+	default:
+		fmt.Println(aggregatesUsage)
+	}
+}
+
+func aggregatesStatus(conn *data.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	freshness, err := marketdata.ChartAggregateFreshness(ctx, conn)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Aggregate", "TF", "Exists", "Last Refresh", "Last Status", "Stale"})
+	for _, f := range freshness {
+		last := "never"
+		if f.LastRefreshed != nil {
+			last = f.LastRefreshed.Local().Format("2006-01-02 15:04") + fmt.Sprintf(" (%s ago)", time.Since(*f.LastRefreshed).Round(time.Second))
+		}
+		table.Append([]string{f.Name, f.Timeframe, fmt.Sprint(f.Exists), last, f.LastStatus, fmt.Sprint(f.Stale)})
+	}
+	table.Render()
+}
+
+func aggregatesRefresh(conn *data.Conn, args []string) {
+	timeframe, ticker := "1m", ""
+	var from, to time.Time
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() string {
+			if i+1 < len(args) {
+				i++
+				return args[i]
+			}
+			return ""
+		}
+		switch arg {
+		case "--timeframe":
+			timeframe = value()
+		case "--ticker":
+			ticker = strings.ToUpper(value())
+		case "--from", "--to":
+			t, err := time.Parse("2006-01-02", value())
+			if err != nil {
+				fmt.Printf("Invalid %s date, use YYYY-MM-DD\n", arg)
+				return
+			}
+			if arg == "--from" {
+				from = t
+			} else {
+				to = t
+			}
+		default:
+			fmt.Println(aggregatesUsage)
+			return
+		}
+	}
+	if from.IsZero() || (timeframe != "1m" && timeframe != "1d") {
+		fmt.Println(aggregatesUsage)
+		return
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		fmt.Printf("Error loading timezone: %v\n", err)
+		return
+	}
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+	defer cancel()
+	refreshed, err := marketdata.RefreshChartAggregates(ctx, conn, "ohlcv_"+timeframe, ticker, start, end)
+	if len(refreshed) > 0 {
+		fmt.Printf("Refreshed %s for %s → %s\n", strings.Join(refreshed, ", "), from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if len(refreshed) == 0 {
+		fmt.Printf("No %s bars for %s in that range, nothing to refresh\n", timeframe, ticker)
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"backend/internal/app/alerts"
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const alertEvaluationsUsage = `Usage:
+  jobctl alert-evaluations STRATEGY_ID [TIME] [LIMIT]
+  Shows what the alert loop did with a strategy in recent cycles: whether it
+  ran, was skipped (no ticker updates, already triggered in the bucket, task
+  queue paused) or failed, and why. TIME (HH:MM in New York today, or RFC 3339) narrows the
+  output to the cycles around that moment. LIMIT defaults to 100.`
+
+func alertEvaluationsCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Println(alertEvaluationsUsage)
+		return
+	}
+	strategyID, err := strconv.Atoi(args[0])
+	if err != nil || strategyID <= 0 {
+		fmt.Printf("Invalid strategy id: %s\n", args[0])
+		return
+	}
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		fmt.Printf("Error loading New York time zone: %v\n", err)
+		return
+	}
+
+	var at *time.Time
+	limit := 0
+	for _, arg := range args[1:] {
+		if n, err := strconv.Atoi(arg); err == nil {
+			limit = n
+			continue
+		}
+		t, err := parseEvaluationTime(arg, loc)
+		if err != nil {
+			fmt.Printf("Invalid time %q: use HH:MM or RFC 3339\n", arg)
+			return
+		}
+		at = &t
+	}
+
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	history, err := alerts.StrategyEvaluations(ctx, conn, 0, strategyID, at, limit)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Strategy %d (%s), alert active: %t\n", history.StrategyID, history.Name, history.AlertActive)
+	if history.Since == nil {
+		fmt.Println("No evaluations recorded")
+		return
+	}
+	fmt.Printf("History kept since %s\n", history.Since.In(loc).Format("2006-01-02 15:04:05 MST"))
+	if at != nil {
+		if history.At == nil {
+			fmt.Printf("No cycle covers %s\n", at.In(loc).Format("2006-01-02 15:04:05 MST"))
+		} else {
+			fmt.Printf("At %s: %s, %s\n", at.In(loc).Format("15:04:05 MST"), history.At.Outcome, history.At.Reason)
+		}
+	}
+	fmt.Println()
+
+	tw := NewTableWriter(os.Stdout)
+	tw.SetHeader([]string{"FROM", "TO", "CYCLES", "OUTCOME", "REASON", "BUCKET", "TICKERS", "ERROR"})
+	for _, e := range history.Evaluations {
+		bucket := ""
+		if e.Bucket != nil {
+			bucket = e.Bucket.In(loc).Format("01-02 15:04")
+		}
+		tickers := ""
+		if e.Tickers > 0 {
+			tickers = strconv.Itoa(e.Tickers)
+		}
+		errText := e.Error
+		if len(errText) > 60 {
+			errText = errText[:57] + "..."
+		}
+		tw.Append([]string{
+			e.First.In(loc).Format("01-02 15:04:05"),
+			e.Last.In(loc).Format("01-02 15:04:05"),
+			strconv.Itoa(e.Count),
+			e.Outcome,
+			e.Reason,
+			bucket,
+			tickers,
+			errText,
+		})
+	}
+	tw.Render()
+}
+
+// parseEvaluationTime reads HH:MM as that time today in loc, or an RFC 3339
+// timestamp
+func parseEvaluationTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.ParseInLocation("15:04", s, loc); err == nil {
+		now := time.Now().In(loc)
+		return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, loc), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"backend/internal/data"
+	"backend/internal/services/marketdata"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const backfillUsage = `Usage:
+  jobctl backfill enqueue [--timeframe 1d|1m] [--priority N] --from YYYY-MM-DD [--to YYYY-MM-DD] (ticker... | --all-active)
+  jobctl backfill status [--all]
+  jobctl backfill pause (id | --all)
+  jobctl backfill resume (id | --all)
+  jobctl backfill run
+  Servers process the queue in the background; run works through it in the
+  foreground until it's empty. Polygon requests are capped by BACKFILL_POLYGON_RPM.`
+
+func backfillCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Println(backfillUsage)
+		return
+	}
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+
+	switch args[0] {
+	case "enqueue":
+		backfillEnqueue(conn, args[1:])
+	case "status":
+		backfillStatus(conn, len(args) > 1 && args[1] == "--all")
+	case "pause", "resume":
+		if len(args) < 2 {
+			fmt.Println(backfillUsage)
+			return
+		}
+		id := 0
+		if args[1] != "--all" {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				fmt.Printf("Invalid backfill id: %s\n", args[1])
+				return
+			}
+			id = n
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		n, err := marketdata.SetBackfillsPaused(ctx, conn, id, args[0] == "pause")
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if args[0] == "pause" {
+			fmt.Printf("Paused %d backfills (running ones stop after their current chunk)\n", n)
+		} else {
+			fmt.Printf("Resumed %d backfills\n", n)
+		}
+	case "run":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		fmt.Println("Running queued backfills, Ctrl-C stops after the current chunk is checkpointed")
+		if err := marketdata.RunBackfills(ctx, conn); err != nil && ctx.Err() == nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Println("Backfill queue is empty")
+	default:
+		fmt.Println(backfillUsage)
+	}
+}
+
+func backfillEnqueue(conn *data.Conn, args []string) {
+	timeframe, priority := "1d", 0
+	var from, to time.Time
+	var tickers []string
+	allActive := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() string {
+			if i+1 < len(args) {
+				i++
+				return args[i]
+			}
+			return ""
+		}
+		switch arg {
+		case "--timeframe":
+			timeframe = value()
+		case "--priority":
+			n, err := strconv.Atoi(value())
+			if err != nil {
+				fmt.Println("Invalid --priority")
+				return
+			}
+			priority = n
+		case "--from", "--to":
+			t, err := time.Parse("2006-01-02", value())
+			if err != nil {
+				fmt.Printf("Invalid %s date, use YYYY-MM-DD\n", arg)
+				return
+			}
+			if arg == "--from" {
+				from = t
+			} else {
+				to = t
+			}
+		case "--all-active":
+			allActive = true
+		default:
+			tickers = append(tickers, strings.ToUpper(arg))
+		}
+	}
+	if from.IsZero() || (len(tickers) == 0 && !allActive) {
+		fmt.Println(backfillUsage)
+		return
+	}
+	if to.IsZero() {
+		to = time.Now().AddDate(0, 0, -1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	if allActive {
+		active, err := marketdata.ActiveTickers(ctx, conn)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		tickers = append(tickers, active...)
+	}
+	queued := 0
+	for _, ticker := range tickers {
+		id, err := marketdata.EnqueueBackfill(ctx, conn, ticker, timeframe, from, to, priority)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		queued++
+		if len(tickers) <= 20 {
+			fmt.Printf("Queued backfill %d: %s %s %s → %s\n", id, ticker, timeframe, from.Format("2006-01-02"), to.Format("2006-01-02"))
+		}
+	}
+	fmt.Printf("Queued %d of %d backfills\n", queued, len(tickers))
+}
+
+func backfillStatus(conn *data.Conn, all bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	counts, err := marketdata.BackfillCounts(ctx, conn)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("queued %d, running %d, paused %d, failed %d, done %d\n\n",
+		counts[marketdata.BackfillQueued], counts[marketdata.BackfillRunning], counts[marketdata.BackfillPaused],
+		counts[marketdata.BackfillFailed], counts[marketdata.BackfillDone])
+
+	backfills, err := marketdata.ListBackfills(ctx, conn, all, 50)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"ID", "Ticker", "TF", "Range", "Progress", "Bars", "Requests", "Priority", "Status", "Updated", "Error"})
+	for _, b := range backfills {
+		errText := ""
+		if b.LastError != nil {
+			errText = *b.LastError
+			if len(errText) > 60 {
+				errText = errText[:57] + "..."
+			}
+		}
+		table.Append([]string{
+			strconv.Itoa(b.ID),
+			b.Ticker,
+			b.Timeframe,
+			b.RangeStart.Format("2006-01-02") + " → " + b.RangeEnd.Format("2006-01-02"),
+			fmt.Sprintf("%.0f%%", b.Progress()*100),
+			strconv.FormatInt(b.BarsWritten, 10),
+			strconv.Itoa(b.Requests),
+			strconv.Itoa(b.Priority),
+			b.Status,
+			b.UpdatedAt.Format("2006-01-02 15:04"),
+			errText,
+		})
+	}
+	table.Render()
+}
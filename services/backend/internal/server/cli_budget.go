@@ -0,0 +1,50 @@
+package server
+
+import (
+	"backend/internal/budget"
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const budgetsUsage = `Usage:
+  jobctl budgets [DAYS]
+  Shows how often each endpoint and agent tool overran its latency budget
+  over the last DAYS days (default 1, at most 7).`
+
+func budgetsCommand(args []string) {
+	days := 1
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > 7 {
+			fmt.Println(budgetsUsage)
+			return
+		}
+		days = n
+	}
+
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	violations, err := budget.Violations(ctx, conn, days)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if len(violations) == 0 {
+		fmt.Println("No budget violations recorded")
+		return
+	}
+	tw := NewTableWriter(os.Stdout)
+	tw.SetHeader([]string{"DAY", "KIND", "NAME", "BUDGET", "OVERRUNS"})
+	for _, v := range violations {
+		tw.Append([]string{v.Day, v.Kind, v.Name, fmt.Sprintf("%s (%s)", v.Class.Name, v.Class.Limit), strconv.FormatInt(v.Count, 10)})
+	}
+	tw.Render()
+}
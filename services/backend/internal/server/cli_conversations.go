@@ -0,0 +1,72 @@
+package server
+
+import (
+	"backend/internal/app/agent"
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const conversationSizesUsage = `Usage:
+  jobctl conversation-sizes [DAYS]
+  Shows the size of conversation cache writes over the last DAYS days
+  (default 1, at most 30): raw and stored bytes, tool results offloaded to
+  their own keys, old messages trimmed to fit the cap, and the size histogram.`
+
+func conversationSizesCommand(args []string) {
+	days := 1
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > 30 {
+			fmt.Println(conversationSizesUsage)
+			return
+		}
+		days = n
+	}
+
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	sizes, err := agent.ConversationCacheSizes(ctx, conn, days)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if len(sizes) == 0 {
+		fmt.Println("No conversation cache writes recorded")
+		return
+	}
+	tw := NewTableWriter(os.Stdout)
+	tw.SetHeader([]string{"DAY", "WRITES", "AVG RAW", "AVG STORED", "OFFLOADED", "TRIMMED", "TOO LARGE", "<16K", "<64K", "<256K", "<1M", ">=1M"})
+	for _, s := range sizes {
+		c := s.Counters
+		avg := func(field string) string {
+			if c["writes"] == 0 {
+				return "-"
+			}
+			return formatBytes(c[field] / c["writes"])
+		}
+		n := func(field string) string { return strconv.FormatInt(c[field], 10) }
+		tw.Append([]string{s.Day, n("writes"), avg("raw_bytes"), avg("stored_bytes"),
+			fmt.Sprintf("%s (%s)", n("offloaded_results"), formatBytes(c["offloaded_bytes"])),
+			n("dropped_messages"), n("too_large"),
+			n("size_lt_16k"), n("size_lt_64k"), n("size_lt_256k"), n("size_lt_1m"), n("size_ge_1m")})
+	}
+	tw.Render()
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fM", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fK", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"backend/internal/app/agent"
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const agentEvalUsage = `Usage: jobctl agent-eval [--corpus dir] [--run substring] [--out report.json]
+  Runs the agent tool-calling eval corpus against the live planner with mocked tools.
+  Without --corpus the corpus compiled into the binary is used. Exits 1 if any case fails.`
+
+func agentEvalCommand(args []string) {
+	var corpusDir, filter, out string
+	for i := 0; i < len(args); i++ {
+		if i+1 >= len(args) {
+			fmt.Println(agentEvalUsage)
+			return
+		}
+		switch args[i] {
+		case "--corpus":
+			corpusDir = args[i+1]
+		case "--run":
+			filter = args[i+1]
+		case "--out":
+			out = args[i+1]
+		default:
+			fmt.Println(agentEvalUsage)
+			return
+		}
+		i++
+	}
+
+	cases, err := agent.LoadEvalCorpus(corpusDir)
+	if err != nil {
+		fmt.Printf("Error loading eval corpus: %v\n", err)
+		os.Exit(1)
+	}
+	if filter != "" {
+		filtered := cases[:0]
+		for _, c := range cases {
+			if strings.Contains(c.ID, filter) {
+				filtered = append(filtered, c)
+			}
+		}
+		cases = filtered
+	}
+	if len(cases) == 0 {
+		fmt.Println("No eval cases to run")
+		return
+	}
+
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+
+	ctx := context.Background()
+	// Evaluate the prompts this environment would actually serve
+	if err := agent.ReloadPrompts(ctx, conn); err != nil {
+		fmt.Printf("Warning: failed to load prompt overrides, using embedded prompts: %v\n", err)
+	}
+
+	fmt.Printf("Running %d eval cases...\n", len(cases))
+	report := agent.RunEval(ctx, conn, cases)
+
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Case", "Result", "Calls", "Turns", "Tokens", "Duration"})
+	for _, c := range report.Cases {
+		result := "PASS"
+		if !c.Passed {
+			result = "FAIL"
+		}
+		tools := make([]string, len(c.Calls))
+		for i, call := range c.Calls {
+			tools[i] = call.Tool
+		}
+		table.Append([]string{c.ID, result, strings.Join(tools, " > "), strconv.Itoa(c.Turns), strconv.FormatInt(c.Tokens, 10), fmt.Sprintf("%.1fs", float64(c.DurationMs)/1000)})
+	}
+	table.Render()
+
+	for _, c := range report.Cases {
+		if c.Passed {
+			continue
+		}
+		fmt.Printf("\n--- FAIL: %s\n", c.ID)
+		for _, d := range c.Diffs {
+			fmt.Printf("    %s\n", d)
+		}
+	}
+	fmt.Printf("\n%d passed, %d failed in %.1fs\n", report.Passed, report.Failed, float64(report.DurationMs)/1000)
+
+	if out != "" {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(out, b, 0o644)
+		}
+		if err != nil {
+			fmt.Printf("Error writing report: %v\n", err)
+		} else {
+			fmt.Printf("Report written to %s\n", out)
+		}
+	}
+	if report.Failed > 0 {
+		cleanup()
+		os.Exit(1)
+	}
+}
+
+const agentReplayUsage = `Usage: jobctl agent-replay [message_id] [--out replay.json]
+  Replays a message recorded with AGENT_RECORD_TRACES=true from its recorded
+  model outputs and tool results, without calling the model or any tool.`
+
+func agentReplayCommand(args []string) {
+	if len(args) < 1 || (len(args) != 1 && (len(args) != 3 || args[1] != "--out")) {
+		fmt.Println(agentReplayUsage)
+		return
+	}
+	messageID := args[0]
+
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+
+	ctx := context.Background()
+	trace, err := agent.LoadAgentTrace(ctx, conn, messageID)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	res := agent.ReplayAgentTrace(ctx, trace)
+
+	fmt.Printf("Message %s: %q\n", res.MessageID, res.Query)
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Turn", "Output", "Stage", "Calls", "Discarded"})
+	for _, step := range res.Steps {
+		discarded := make([]string, len(step.Discarded))
+		for i, id := range step.Discarded {
+			discarded[i] = strconv.FormatInt(id, 10)
+		}
+		table.Append([]string{strconv.Itoa(step.Turn), step.Kind, string(step.Stage), strings.Join(step.Calls, ", "), strings.Join(discarded, ", ")})
+	}
+	table.Render()
+
+	for _, m := range res.Mismatches {
+		fmt.Printf("MISMATCH: %s\n", m)
+	}
+	if res.Error != "" {
+		fmt.Printf("ERROR: %s\n", res.Error)
+	}
+	if b, err := json.MarshalIndent(res.Answer, "", "  "); err == nil && len(res.Answer) > 0 {
+		fmt.Printf("\nAnswer chunks:\n%s\n", b)
+	}
+
+	if len(args) == 3 {
+		b, err := json.MarshalIndent(res, "", "  ")
+		if err == nil {
+			err = os.WriteFile(args[2], b, 0o644)
+		}
+		if err != nil {
+			fmt.Printf("Error writing replay: %v\n", err)
+		} else {
+			fmt.Printf("Replay written to %s\n", args[2])
+		}
+	}
+}
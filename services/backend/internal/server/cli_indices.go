@@ -0,0 +1,110 @@
+package server
+
+import (
+	"backend/internal/data"
+	"backend/internal/services/securities"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const indexConstituentsUsage = `Usage:
+  jobctl index-constituents sync
+  jobctl index-constituents import INDEX FILE.csv [--as-of YYYY-MM-DD] [--force]
+  jobctl index-constituents list INDEX [--as-of YYYY-MM-DD]
+  INDEX is SPX or NDX (or a tracking ETF such as SPY or QQQ). import makes the
+  file the index's membership from --as-of (default today); load older lists
+  first, changes can't be backdated before the latest one.`
+
+func indexConstituentsCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Println(indexConstituentsUsage)
+		return
+	}
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+
+	asOf := securities.IndexDate()
+	force := false
+	var positional []string
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--as-of":
+			if i+1 >= len(args) {
+				fmt.Println(indexConstituentsUsage)
+				return
+			}
+			i++
+			t, err := time.Parse("2006-01-02", args[i])
+			if err != nil {
+				fmt.Println("Invalid --as-of date, use YYYY-MM-DD")
+				return
+			}
+			asOf = t
+		case "--force":
+			force = true
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	switch args[0] {
+	case "sync":
+		if err := securities.UpdateIndexConstituents(conn); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Println("Index constituents synced")
+	case "import":
+		if len(positional) != 2 {
+			fmt.Println(indexConstituentsUsage)
+			return
+		}
+		index, ok := securities.NormalizeIndexSymbol(positional[0])
+		if !ok {
+			fmt.Printf("Unknown index %s\n", positional[0])
+			return
+		}
+		f, err := os.Open(positional[1])
+		if err != nil {
+			fmt.Printf("Error opening %s: %v\n", positional[1], err)
+			return
+		}
+		defer f.Close()
+		constituents, err := securities.ParseConstituentsCSV(f)
+		if err != nil {
+			fmt.Printf("Error reading %s: %v\n", positional[1], err)
+			return
+		}
+		added, removed, err := securities.ApplyIndexConstituents(ctx, conn, index, constituents, asOf, "file:"+positional[1], force)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("%s as of %s: %d members (+%d, -%d)\n", index, asOf.Format("2006-01-02"), len(constituents), added, removed)
+	case "list":
+		if len(positional) != 1 {
+			fmt.Println(indexConstituentsUsage)
+			return
+		}
+		index, ok := securities.NormalizeIndexSymbol(positional[0])
+		if !ok {
+			fmt.Printf("Unknown index %s\n", positional[0])
+			return
+		}
+		tickers, err := securities.IndexMembers(ctx, conn, index, asOf)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("%s as of %s: %d members\n%s\n", index, asOf.Format("2006-01-02"), len(tickers), strings.Join(tickers, " "))
+	default:
+		fmt.Println(indexConstituentsUsage)
+	}
+}
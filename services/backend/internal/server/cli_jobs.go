@@ -0,0 +1,190 @@
+package server
+
+import (
+	"backend/internal/data"
+	"backend/internal/queue"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const jobHistoryUsage = `Usage:
+  jobctl job-history JOB_NAME [LIMIT]
+  Shows a scheduled job's recent runs, newest first, with how long each took.
+  Runs that took 5x the median of recent successful runs or more are flagged.
+  WAITED is how long a run waited for its resources before it started.
+  LIMIT defaults to 30.`
+
+const jobTasksUsage = `Usage:
+  jobctl job-tasks RUN_ID
+  jobctl job-tasks JOB_NAME [LIMIT]
+  Shows the worker tasks a job run queued and how each went. Given a job name,
+  shows its last LIMIT runs (default 5) with their tasks. Run IDs are listed by
+  job-history and printed by run.`
+
+func jobHistoryCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Println(jobHistoryUsage)
+		return
+	}
+	limit := 30
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			fmt.Printf("Invalid limit: %s\n", args[1])
+			return
+		}
+		limit = n
+	}
+
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	runs, err := loadJobHistory(ctx, conn, args[0], jobHistoryEntries)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if len(runs) == 0 {
+		fmt.Printf("No runs recorded for job %s\n", args[0])
+		return
+	}
+	median, samples := medianJobDuration(runs)
+	fmt.Printf("Job %s: median %v over the last %d successful runs\n\n", args[0], median, samples)
+
+	if len(runs) > limit {
+		runs = runs[:limit]
+	}
+	tw := NewTableWriter(os.Stdout)
+	tw.SetHeader([]string{"START", "RUN ID", "WAITED", "DURATION", "STATUS", "ANOMALY", "ERROR"})
+	for _, run := range runs {
+		status := "ok"
+		if run.Failed {
+			status = "failed"
+		}
+		anomaly := ""
+		if run.Anomaly != nil {
+			anomaly = fmt.Sprintf("%.1fx median %v", run.Anomaly.Ratio, time.Duration(run.Anomaly.MedianMs)*time.Millisecond)
+		}
+		errText := run.Error
+		if len(errText) > 60 {
+			errText = errText[:57] + "..."
+		}
+		tw.Append([]string{
+			run.Start.Local().Format("2006-01-02 15:04:05"),
+			run.RunID,
+			(time.Duration(run.WaitMs) * time.Millisecond).String(),
+			(time.Duration(run.DurationMs) * time.Millisecond).String(),
+			status,
+			anomaly,
+			errText,
+		})
+	}
+	tw.Render()
+}
+
+func jobTasksCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Println(jobTasksUsage)
+		return
+	}
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if isJob(args[0]) {
+		limit := 5
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				fmt.Printf("Invalid limit: %s\n", args[1])
+				return
+			}
+			limit = n
+		}
+		runs, err := recentJobRunTasks(ctx, conn, args[0], limit)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if len(runs) == 0 {
+			fmt.Printf("No runs recorded for job %s\n", args[0])
+			return
+		}
+		for _, run := range runs {
+			printJobRunTree(args[0], run)
+			fmt.Println()
+		}
+		return
+	}
+
+	tasks, err := queue.JobRunTasks(ctx, conn, args[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if len(tasks) == 0 {
+		fmt.Printf("No tasks recorded for job run %s\n", args[0])
+		return
+	}
+	printJobRunTree(tasks[0].Job, JobRunTasks{RunID: args[0], Tasks: tasks})
+}
+
+// isJob reports whether name is a scheduled job's name
+func isJob(name string) bool {
+	for _, job := range JobList {
+		if job.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// printJobRunTree prints a job run with the tasks it queued beneath it
+func printJobRunTree(job string, run JobRunTasks) {
+	header := fmt.Sprintf("%s run %s", job, run.RunID)
+	if run.Run != nil {
+		status := "ok"
+		if run.Run.Failed {
+			status = "failed"
+		}
+		header += fmt.Sprintf(", started %s, took %v, %s", run.Run.Start.Local().Format("2006-01-02 15:04:05"),
+			time.Duration(run.Run.DurationMs)*time.Millisecond, status)
+	}
+	fmt.Println(header)
+	if len(run.Tasks) == 0 {
+		fmt.Println("└─ (no tasks queued)")
+		return
+	}
+	now := time.Now()
+	for i, task := range run.Tasks {
+		branch := "├─"
+		if i == len(run.Tasks)-1 {
+			branch = "└─"
+		}
+		took := now.Sub(task.QueuedAt)
+		if task.Done() {
+			took = task.UpdatedAt.Sub(task.QueuedAt)
+		}
+		line := fmt.Sprintf("%s %s  %-12s %-10s %8v", branch, task.TaskID, task.TaskType, task.Status, took.Round(time.Second))
+		if task.Attempt > 1 {
+			line += fmt.Sprintf("  attempt %d", task.Attempt)
+		}
+		if task.Error != "" {
+			errText := strings.ReplaceAll(task.Error, "\n", " ")
+			if len(errText) > 60 {
+				errText = errText[:57] + "..."
+			}
+			line += "  " + errText
+		}
+		fmt.Println(line)
+	}
+}
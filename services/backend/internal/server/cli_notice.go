@@ -0,0 +1,39 @@
+package server
+
+import (
+	"backend/internal/data"
+	"backend/internal/services/socket"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const noticeUsage = `Usage: jobctl notice [--warning] [message...]
+  Shows a service notice to every user connected to any running server.`
+
+func noticeCommand(args []string) {
+	noticeType := "info"
+	if len(args) > 0 && args[0] == "--warning" {
+		noticeType = "warning"
+		args = args[1:]
+	}
+	message := strings.TrimSpace(strings.Join(args, " "))
+	if message == "" {
+		fmt.Println(noticeUsage)
+		return
+	}
+
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := socket.PublishServiceNotice(ctx, conn, noticeType, message); err != nil {
+		fmt.Printf("Error publishing notice: %v\n", err)
+		return
+	}
+	fmt.Printf("Published %s notice: %s\n", noticeType, message)
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"backend/internal/app/onboarding"
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const onboardingUsage = `Usage:
+  jobctl onboarding status [user_id]
+  jobctl onboarding repair (user_id | --all)
+  jobctl onboarding run
+  Servers provision queued accounts in the background. repair queues an
+  account again so its missing steps run; --all requeues every failed account
+  and queues accounts that were never provisioned. run works through the queue
+  in the foreground until it's empty.`
+
+func onboardingCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Println(onboardingUsage)
+		return
+	}
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+
+	switch args[0] {
+	case "status":
+		if len(args) > 1 {
+			userID, err := strconv.Atoi(args[1])
+			if err != nil || userID <= 0 {
+				fmt.Printf("Invalid user id: %s\n", args[1])
+				return
+			}
+			onboardingUserStatus(conn, userID)
+			return
+		}
+		onboardingStatus(conn)
+	case "repair":
+		if len(args) < 2 {
+			fmt.Println(onboardingUsage)
+			return
+		}
+		userID := 0
+		if args[1] != "--all" {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				fmt.Printf("Invalid user id: %s\n", args[1])
+				return
+			}
+			userID = n
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		n, err := onboarding.Requeue(ctx, conn, userID)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("Queued %d accounts for onboarding (accounts being provisioned right now are left alone)\n", n)
+	case "run":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		fmt.Println("Provisioning queued accounts, Ctrl-C stops after the current account")
+		if err := onboarding.RunQueued(ctx, conn); err != nil && ctx.Err() == nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Println("Onboarding queue is empty")
+	default:
+		fmt.Println(onboardingUsage)
+	}
+}
+
+func onboardingStatus(conn *data.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	counts, err := onboarding.Counts(ctx, conn)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("queued %d, running %d, failed %d, done %d\n\n",
+		counts[onboarding.StatusQueued], counts[onboarding.StatusRunning],
+		counts[onboarding.StatusFailed], counts[onboarding.StatusDone])
+
+	incomplete, err := onboarding.ListIncomplete(ctx, conn, 50)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if len(incomplete) == 0 {
+		fmt.Println("Every queued account has been provisioned")
+		return
+	}
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"User", "Status", "Steps", "Attempts", "Queued", "Updated", "Error"})
+	for _, s := range incomplete {
+		errText := ""
+		if s.LastError != nil {
+			errText = *s.LastError
+			if len(errText) > 60 {
+				errText = errText[:57] + "..."
+			}
+		}
+		table.Append([]string{
+			strconv.Itoa(s.UserID),
+			s.Status,
+			fmt.Sprintf("%d/%d", len(s.StepsDone), s.StepsTotal),
+			strconv.Itoa(s.Attempts),
+			s.CreatedAt.Format("2006-01-02 15:04"),
+			s.UpdatedAt.Format("2006-01-02 15:04"),
+			errText,
+		})
+	}
+	table.Render()
+}
+
+func onboardingUserStatus(conn *data.Conn, userID int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s, err := onboarding.GetStatus(ctx, conn, userID)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if s == nil {
+		fmt.Printf("User %d was never queued for onboarding; repair %d queues it\n", userID, userID)
+		return
+	}
+	fmt.Printf("User %d: %s after %d attempts\n", s.UserID, s.Status, s.Attempts)
+	fmt.Printf("Steps done (%d/%d): %s\n", len(s.StepsDone), s.StepsTotal, strings.Join(s.StepsDone, ", "))
+	if s.LastError != nil {
+		fmt.Printf("Last error: %s\n", *s.LastError)
+	}
+}
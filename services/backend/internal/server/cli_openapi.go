@@ -0,0 +1,104 @@
+package server
+
+import (
+	"backend/internal/apispec"
+	"backend/internal/client"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const openapiUsage = `Usage:
+  jobctl openapi spec [--out FILE]
+  jobctl openapi client [--out FILE]
+  jobctl openapi call FUNC [ARGS_JSON] [--url URL]
+  spec prints the OpenAPI document of the published API and client generates
+  the typed Go client (internal/client/client_gen.go). call invokes a function
+  through that client as the user of $PERIPHERAL_TOKEN.`
+
+func openapiCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Println(openapiUsage)
+		return
+	}
+	var out, baseURL string
+	var rest []string
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--out", "--url":
+			if i+1 >= len(args) {
+				fmt.Println(openapiUsage)
+				return
+			}
+			if args[i] == "--out" {
+				out = args[i+1]
+			} else {
+				baseURL = args[i+1]
+			}
+			i++
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+
+	var content []byte
+	switch args[0] {
+	case "spec":
+		b, err := json.MarshalIndent(apispec.OpenAPI(), "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding spec: %v\n", err)
+			return
+		}
+		content = append(b, '\n')
+	case "client":
+		b, err := apispec.GenerateClient()
+		if err != nil {
+			fmt.Printf("Error generating client: %v\n", err)
+			return
+		}
+		content = b
+	case "call":
+		if len(rest) < 1 {
+			fmt.Println(openapiUsage)
+			return
+		}
+		var callArgs interface{}
+		if len(rest) > 1 {
+			callArgs = json.RawMessage(rest[1])
+		}
+		if baseURL == "" {
+			baseURL = os.Getenv("PERIPHERAL_API_URL")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		result, err := client.New(baseURL, os.Getenv("PERIPHERAL_TOKEN")).Call(ctx, rest[0], callArgs)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, result, "", "  ") != nil {
+			pretty.Reset()
+			pretty.Write(result)
+		}
+		fmt.Println(strings.TrimSpace(pretty.String()))
+		return
+	default:
+		fmt.Println(openapiUsage)
+		return
+	}
+
+	if out == "" {
+		fmt.Print(string(content))
+		return
+	}
+	if err := os.WriteFile(out, content, 0o644); err != nil {
+		fmt.Printf("Error writing %s: %v\n", out, err)
+		return
+	}
+	fmt.Printf("Wrote %s\n", out)
+}
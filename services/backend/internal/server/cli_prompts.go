@@ -0,0 +1,114 @@
+package server
+
+import (
+	"backend/internal/app/agent"
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const promptsUsage = `Usage:
+  jobctl prompts list [name]
+  jobctl prompts push [name] [file] [environment|all] [--activate]
+  jobctl prompts activate [name] [version] [environment|all]   (version 0 reverts to the embedded prompt)
+  jobctl prompts reload`
+
+// promptEnvArg maps the CLI environment argument to an agent_prompts environment;
+// "all" (or nothing) means the override applies everywhere
+func promptEnvArg(args []string, i int) string {
+	if len(args) <= i || args[i] == "all" || args[i] == "--activate" {
+		return ""
+	}
+	return args[i]
+}
+
+func promptsCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Println(promptsUsage)
+		return
+	}
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	switch args[0] {
+	case "list":
+		name := ""
+		if len(args) > 1 {
+			name = args[1]
+		}
+		versions, err := agent.ListPromptVersions(ctx, conn, name)
+		if err != nil {
+			fmt.Printf("Error listing prompts: %v\n", err)
+			return
+		}
+		table := NewTableWriter(os.Stdout)
+		table.SetHeader([]string{"Name", "Environment", "Version", "Active", "Created", "Notes"})
+		for _, v := range versions {
+			env := v.Environment
+			if env == "" {
+				env = "all"
+			}
+			table.Append([]string{v.Name, env, strconv.Itoa(v.Version), fmt.Sprintf("%t", v.Active), v.CreatedAt.Format(time.RFC3339), v.Notes})
+		}
+		table.Render()
+
+	case "push":
+		if len(args) < 3 {
+			fmt.Println(promptsUsage)
+			return
+		}
+		content, err := os.ReadFile(args[2])
+		if err != nil {
+			fmt.Printf("Error reading %s: %v\n", args[2], err)
+			return
+		}
+		activate := args[len(args)-1] == "--activate"
+		v, err := agent.SavePromptVersion(ctx, conn, args[1], promptEnvArg(args, 3), string(content), "pushed from "+args[2], activate)
+		if err != nil {
+			fmt.Printf("Error saving prompt: %v\n", err)
+			return
+		}
+		fmt.Printf("Saved %s version %d (active: %t)\n", v.Name, v.Version, v.Active)
+		if activate {
+			notifyPromptReload(ctx, conn)
+		}
+
+	case "activate":
+		if len(args) < 3 {
+			fmt.Println(promptsUsage)
+			return
+		}
+		version, err := strconv.Atoi(args[2])
+		if err != nil {
+			fmt.Printf("Error: invalid version '%s'\n", args[2])
+			return
+		}
+		if err := agent.ActivatePromptVersion(ctx, conn, args[1], promptEnvArg(args, 3), version); err != nil {
+			fmt.Printf("Error activating prompt: %v\n", err)
+			return
+		}
+		fmt.Printf("Activated %s version %d\n", args[1], version)
+		notifyPromptReload(ctx, conn)
+
+	case "reload":
+		notifyPromptReload(ctx, conn)
+
+	default:
+		fmt.Println(promptsUsage)
+	}
+}
+
+func notifyPromptReload(ctx context.Context, conn *data.Conn) {
+	if err := agent.NotifyPromptReload(ctx, conn); err != nil {
+		fmt.Printf("Warning: failed to notify servers, they will pick up the change within a minute: %v\n", err)
+		return
+	}
+	fmt.Println("Servers notified to reload prompts")
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"backend/internal/data"
+	"backend/internal/queue"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const queueControlUsage = `Usage:
+  jobctl queue-control status
+  jobctl queue-control pause [reason...]
+  jobctl queue-control drain [reason...] [--wait]
+  jobctl queue-control resume
+  pause stops workers from pulling tasks; queued tasks wait for resume. drain
+  lets workers finish what is queued and running. Both make the backend refuse
+  new tasks with an unavailable error. --wait blocks until a drain is done.`
+
+func queueControlCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Println(queueControlUsage)
+		return
+	}
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+	ctx := context.Background()
+
+	var reasonWords []string
+	wait := false
+	for _, arg := range args[1:] {
+		if arg == "--wait" {
+			wait = true
+			continue
+		}
+		reasonWords = append(reasonWords, arg)
+	}
+	reason := strings.Join(reasonWords, " ")
+
+	switch args[0] {
+	case "status":
+	case "pause":
+		if _, err := queue.SetControlState(ctx, conn, queue.QueuePaused, reason); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	case "drain":
+		if _, err := queue.SetControlState(ctx, conn, queue.QueueDraining, reason); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if wait {
+			waitForDrain(ctx, conn)
+		}
+	case "resume":
+		if _, err := queue.SetControlState(ctx, conn, queue.QueueRunning, ""); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	default:
+		fmt.Println(queueControlUsage)
+		return
+	}
+	printQueueControlStatus(ctx, conn)
+}
+
+// waitForDrain polls until a draining queue has nothing queued or running
+func waitForDrain(ctx context.Context, conn *data.Conn) {
+	for {
+		status, err := queue.GetControlStatus(ctx, conn)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if status.State != queue.QueueDraining {
+			fmt.Printf("Queue is now %s; stopped waiting\n", status.State)
+			return
+		}
+		if status.Drained {
+			fmt.Println("Drained")
+			return
+		}
+		fmt.Printf("Waiting: %d queued, %d priority, %d running\n", status.Queued, status.PriorityQueued, len(status.InFlight))
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func printQueueControlStatus(ctx context.Context, conn *data.Conn) {
+	status, err := queue.GetControlStatus(ctx, conn)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("State: %s", status.State)
+	if !status.Since.IsZero() {
+		fmt.Printf(" since %s", status.Since.Local().Format("2006-01-02 15:04:05 MST"))
+	}
+	if status.Reason != "" {
+		fmt.Printf(" (%s)", status.Reason)
+	}
+	fmt.Println()
+	fmt.Printf("Queued: %d, priority: %d, running: %d\n", status.Queued, status.PriorityQueued, len(status.InFlight))
+	if status.State == queue.QueueDraining && status.Drained {
+		fmt.Println("Drained: nothing queued or running")
+	}
+	if len(status.InFlight) == 0 {
+		return
+	}
+	fmt.Println()
+	tw := NewTableWriter(os.Stdout)
+	tw.SetHeader([]string{"WORKER", "TASK", "TYPE", "RUNNING FOR"})
+	for _, t := range status.InFlight {
+		tw.Append([]string{t.WorkerID, t.TaskID, t.TaskType, time.Since(t.StartedAt).Round(time.Second).String()})
+	}
+	tw.Render()
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"backend/internal/data"
+	"backend/internal/services/securities"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const securitiesReconcileUsage = `Usage:
+  jobctl securities-reconcile run [--dry-run] [--no-shares]
+  jobctl securities-reconcile report [RUN] [--unapplied]
+  run compares active securities with Polygon reference data, applies
+  attribute updates and records everything it found. report shows the changes
+  of a run (default the latest).`
+
+func securitiesReconcileCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Println(securitiesReconcileUsage)
+		return
+	}
+	var opts securities.ReconcileOptions
+	unapplied := false
+	runID := 0
+	for _, arg := range args[1:] {
+		switch arg {
+		case "--dry-run":
+			opts.DryRun = true
+		case "--no-shares":
+			opts.SkipShares = true
+		case "--unapplied":
+			unapplied = true
+		default:
+			id, err := strconv.Atoi(arg)
+			if err != nil {
+				fmt.Println(securitiesReconcileUsage)
+				return
+			}
+			runID = id
+		}
+	}
+
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+
+	switch args[0] {
+	case "run":
+		summary, err := securities.RunSecurityReconciliation(conn, opts)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		dropReconciledTickerDetails(conn, summary)
+		fmt.Println(summary.AlertText())
+	case "report":
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		id, changes, err := securities.ListSecurityChanges(ctx, conn, runID, unapplied)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if id == 0 {
+			fmt.Println("No reconciliation runs yet")
+			return
+		}
+		fmt.Printf("Run %d: %d changes\n", id, len(changes))
+		tw := NewTableWriter(os.Stdout)
+		tw.SetHeader([]string{"TICKER", "KIND", "OLD", "NEW", "APPLIED"})
+		for _, c := range changes {
+			tw.Append([]string{c.Ticker, c.Kind, c.Old, c.New, strconv.FormatBool(c.Applied)})
+		}
+		tw.Render()
+	default:
+		fmt.Println(securitiesReconcileUsage)
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const replayRecordUsage = `Usage:
+  jobctl replay-record list
+  jobctl replay-record add [ticker...]
+  jobctl replay-record remove [ticker...]
+  Running servers pick up changes within a minute. REPLAY_RECORD_ALL=true records every ticker.`
+
+func replayRecordCommand(args []string) {
+	if len(args) < 1 || (args[0] != "list" && len(args) < 2) {
+		fmt.Println(replayRecordUsage)
+		return
+	}
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	switch args[0] {
+	case "list":
+		rows, err := conn.DB.Query(ctx, `SELECT ticker, added_at FROM replay_recorded_tickers ORDER BY ticker`)
+		if err != nil {
+			fmt.Printf("Error listing recorded tickers: %v\n", err)
+			return
+		}
+		defer rows.Close()
+		table := NewTableWriter(os.Stdout)
+		table.SetHeader([]string{"Ticker", "Added"})
+		for rows.Next() {
+			var ticker string
+			var added time.Time
+			if err := rows.Scan(&ticker, &added); err != nil {
+				fmt.Printf("Error reading recorded tickers: %v\n", err)
+				return
+			}
+			table.Append([]string{ticker, added.Format("2006-01-02 15:04")})
+		}
+		table.Render()
+	case "add":
+		for _, t := range args[1:] {
+			ticker := strings.ToUpper(t)
+			if _, err := conn.DB.Exec(ctx, `INSERT INTO replay_recorded_tickers (ticker) VALUES ($1) ON CONFLICT DO NOTHING`, ticker); err != nil {
+				fmt.Printf("Error adding %s: %v\n", ticker, err)
+				return
+			}
+			fmt.Printf("Recording 1s bars for %s\n", ticker)
+		}
+	case "remove":
+		for _, t := range args[1:] {
+			ticker := strings.ToUpper(t)
+			if _, err := conn.DB.Exec(ctx, `DELETE FROM replay_recorded_tickers WHERE ticker = $1`, ticker); err != nil {
+				fmt.Printf("Error removing %s: %v\n", ticker, err)
+				return
+			}
+			fmt.Printf("Stopped recording %s\n", ticker)
+		}
+	default:
+		fmt.Println(replayRecordUsage)
+	}
+}
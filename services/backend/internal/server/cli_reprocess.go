@@ -0,0 +1,101 @@
+package server
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+)
+
+const reprocessUsage = `Usage:
+  jobctl reprocess <ticker> [--days N]
+  jobctl reprocess status <ticker>
+  Reprocesses one listed security end to end: refetches its reference details,
+  backfills the daily bars missing in the last N days (default 365), refreshes
+  the chart aggregates, recomputes its screener row and drops the caches built
+  from them. status shows the latest report, also of one started through
+  POST /admin/reprocess.`
+
+func reprocessCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Println(reprocessUsage)
+		return
+	}
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+
+	if args[0] == "status" {
+		if len(args) < 2 {
+			fmt.Println(reprocessUsage)
+			return
+		}
+		conn, cleanup := data.InitConn(inContainer)
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		report, err := lastReprocess(ctx, conn, args[1])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if report == nil {
+			fmt.Printf("No recent reprocess of %s\n", args[1])
+			return
+		}
+		printReprocessReport(report)
+		return
+	}
+
+	ticker, days := args[0], 0
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--days":
+			if i+1 >= len(args) {
+				fmt.Println(reprocessUsage)
+				return
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				fmt.Println("Invalid --days")
+				return
+			}
+			days = n
+			i++
+		default:
+			fmt.Println(reprocessUsage)
+			return
+		}
+	}
+
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, reprocessTimeout)
+	defer cancel()
+
+	report, err := newReprocessReport(ctx, conn, ticker, days)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Reprocessing %s (security %d), gaps since %s\n", report.Ticker, report.SecurityID, report.Since)
+	runReprocess(ctx, conn, report, func(s ReprocessStep) {
+		fmt.Printf("  %-10s %-7s %s\n", s.Name, s.Status, s.Detail)
+	})
+	fmt.Println()
+	printReprocessReport(report)
+}
+
+func printReprocessReport(r *ReprocessReport) {
+	fmt.Printf("%s (security %d): %s, started %s\n", r.Ticker, r.SecurityID, r.Status, r.StartedAt.Format(time.RFC3339))
+	tw := NewTableWriter(os.Stdout)
+	tw.SetHeader([]string{"STEP", "STATUS", "TOOK", "DETAIL"})
+	for _, s := range r.Steps {
+		took := (time.Duration(s.DurationMs) * time.Millisecond).Round(time.Millisecond)
+		tw.Append([]string{s.Name, s.Status, took.String(), s.Detail})
+	}
+	tw.Render()
+}
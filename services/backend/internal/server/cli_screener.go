@@ -0,0 +1,48 @@
+package server
+
+import (
+	"backend/internal/data"
+	"backend/internal/services/screener"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// screenerShardsCommand shows the progress of the current or last sharded
+// screener refresh
+func screenerShardsCommand(_ []string) {
+	inContainer := os.Getenv("IN_CONTAINER") == "true"
+	conn, cleanup := data.InitConn(inContainer)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	run, err := screener.LastShardedRefresh(ctx, conn)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if run == nil {
+		fmt.Println("No sharded screener refresh in the last day")
+		return
+	}
+	elapsed := time.Since(run.StartedAt)
+	if run.FinishedAt != nil {
+		elapsed = run.FinishedAt.Sub(run.StartedAt)
+	}
+	fmt.Printf("Refresh started %s: %s, %d tickers in %d shards, %s\n\n",
+		run.StartedAt.Local().Format("2006-01-02 15:04:05"), run.Status, run.Tickers, run.Shards, elapsed.Round(time.Millisecond))
+
+	table := NewTableWriter(os.Stdout)
+	table.SetHeader([]string{"Shard", "Status", "Attempts", "Tickers", "Last Attempt", "Error"})
+	for _, p := range run.Progress {
+		errText := p.Error
+		if len(errText) > 60 {
+			errText = errText[:57] + "..."
+		}
+		table.Append([]string{strconv.Itoa(p.Shard), p.Status, strconv.Itoa(p.Attempts), strconv.Itoa(p.Tickers), p.Duration, errText})
+	}
+	table.Render()
+}
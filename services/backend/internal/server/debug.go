@@ -0,0 +1,54 @@
+package server
+
+import (
+	"backend/internal/data"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// adminUserIDs lists the users allowed on the debug endpoints ($ADMIN_USER_IDS,
+// comma separated). With none configured the endpoints refuse everyone.
+func adminUserIDs() map[int]bool {
+	ids := map[int]bool{}
+	for _, s := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if id, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// adminOnly requires a token of a user in ADMIN_USER_IDS
+func adminOnly(conn *data.Conn, h http.HandlerFunc) http.HandlerFunc {
+	admins := adminUserIDs()
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := validateToken(conn, r, r.Header.Get("Authorization"))
+		if handleError(w, err, "auth") {
+			return
+		}
+		userID := claims.UserID
+		if !admins[userID] {
+			log.Printf("⚠️ User %d refused on %s", userID, r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// registerDebugHandlers mounts the pprof profiles under /debug/pprof/ for
+// admins. The server runs on its own mux, so the unauthenticated routes that
+// net/http/pprof adds to http.DefaultServeMux are never served.
+//
+//	go tool pprof -http=: -H "Authorization: $TOKEN" https://host/debug/pprof/profile?seconds=30
+func registerDebugHandlers(mux *http.ServeMux, conn *data.Conn) {
+	mux.Handle("/debug/pprof/", withPanicRecovery(adminOnly(conn, pprof.Index)))
+	mux.Handle("/debug/pprof/cmdline", withPanicRecovery(adminOnly(conn, pprof.Cmdline)))
+	mux.Handle("/debug/pprof/profile", withPanicRecovery(adminOnly(conn, pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", withPanicRecovery(adminOnly(conn, pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", withPanicRecovery(adminOnly(conn, pprof.Trace)))
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"backend/internal/breaker"
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const (
+	dependencyProbeInterval = 15 * time.Second
+	dependencyProbeTimeout  = 3 * time.Second
+)
+
+// startDependencyProbes checks Postgres, Redis and Polygon on an interval and
+// feeds the results into their circuit breakers. The LLM breaker is fed by
+// the model calls themselves.
+func startDependencyProbes(conn *data.Conn) {
+	probes := map[*breaker.Breaker]func(context.Context) error{
+		breaker.Postgres: func(ctx context.Context) error { return conn.DB.Ping(ctx) },
+		breaker.Redis:    func(ctx context.Context) error { return conn.Cache.Ping(ctx).Err() },
+		breaker.Polygon: func(ctx context.Context) error {
+			_, err := conn.Polygon.GetMarketStatus(ctx)
+			return err
+		},
+	}
+	go func() {
+		ticker := time.NewTicker(dependencyProbeInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			for b, probe := range probes {
+				ctx, cancel := context.WithTimeout(context.Background(), dependencyProbeTimeout)
+				b.Record(probe(ctx))
+				cancel()
+			}
+		}
+	}()
+}
+
+// sheddingStatus lists the work being shed for the current breaker states
+func sheddingStatus() []string {
+	var shed []string
+	if !breaker.Postgres.Healthy() {
+		shed = append(shed, "screener refresh paused")
+	}
+	if !breaker.Postgres.Healthy() || !breaker.Redis.Healthy() {
+		shed = append(shed, "strategy alert scans deferred")
+	}
+	if !breaker.Polygon.Healthy() {
+		shed = append(shed, "snapshots served from cache")
+	}
+	if !breaker.LLM.Healthy() {
+		shed = append(shed, "new chats refused")
+	}
+	return shed
+}
+
+// statusHandler reports the circuit breaker states and the work being shed
+func statusHandler() http.HandlerFunc {
+	type status struct {
+		Degraded bool             `json:"degraded"`
+		Breakers []breaker.Status `json:"breakers"`
+		Shedding []string         `json:"shedding,omitempty"`
+	}
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		res := status{Degraded: breaker.Degraded(), Breakers: breaker.All(), Shedding: sheddingStatus()}
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, "Error encoding status response", http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"backend/internal/data"
+	"backend/internal/dryrun"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Admins can make a private API call dry by sending X-Dry-Run: true. The
+// worker tasks and notifications it would have queued or sent are simulated
+// (see dryrun) and the response lists them next to the call's result or
+// error, with status 200 either way. Dry calls skip idempotency keys.
+const dryRunHeader = "X-Dry-Run"
+
+type dryRunResponse struct {
+	DryRun         bool            `json:"dryRun"`
+	Result         interface{}     `json:"result,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	Actions        []dryrun.Action `json:"actions"`
+	DroppedActions int             `json:"droppedActions,omitempty"`
+}
+
+func dryRunRequested(r *http.Request) bool {
+	switch strings.ToLower(r.Header.Get(dryRunHeader)) {
+	case "1", "true":
+		return true
+	}
+	return false
+}
+
+// serveDryRun runs a private function with its worker tasks and
+// notifications simulated and writes what it would have done
+func serveDryRun(w http.ResponseWriter, r *http.Request, conn *data.Conn, userID int, function string, args json.RawMessage) {
+	if !adminUserIDs()[userID] {
+		log.Printf("⚠️ User %d refused a dry run of %s", userID, function)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	ctx, rec := dryrun.WithRecorder(r.Context())
+	var call func(context.Context) (interface{}, error)
+	if contextFunc, exists := privateFuncWithContext[function]; exists {
+		call = func(ctx context.Context) (interface{}, error) {
+			return contextFunc(ctx, conn, userID, args)
+		}
+	} else if regularFunc, exists := privateFunc[function]; exists {
+		// Without a context only a global dry run reaches what it queues or sends
+		call = func(context.Context) (interface{}, error) {
+			return regularFunc(conn, userID, args)
+		}
+	} else {
+		http.Error(w, "Unknown function", http.StatusBadRequest)
+		return
+	}
+
+	result, err := call(ctx)
+	resp := dryRunResponse{DryRun: true, Result: result, Actions: rec.Actions(), DroppedActions: rec.Dropped()}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	log.Printf("🧪 Dry run of %s by user %d: %d actions, error: %v", function, userID, len(resp.Actions), err)
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(true)
+	if err := encoder.Encode(resp); err != nil {
+		log.Printf("Error writing dry run response for %s: %v", function, err)
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"backend/internal/app/agent"
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// adminExperimentsHandler serves /admin/experiments:
+//
+//	GET    /admin/experiments            every experiment
+//	GET    /admin/experiments?key=...    an experiment's per-variant results
+//	POST   /admin/experiments            {"key", "description", "variants"} starts one
+//	DELETE /admin/experiments?key=...    stops a running experiment
+func adminExperimentsHandler(conn *data.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		// adminOnly already checked the token
+		adminID := 0
+		if claims, err := parseToken(r.Header.Get("Authorization")); err == nil {
+			adminID = claims.UserID
+		}
+		key := r.URL.Query().Get("key")
+		switch r.Method {
+		case http.MethodGet:
+			if key == "" {
+				list, err := agent.ListExperiments(ctx, conn)
+				if handleError(w, err, "admin experiments") {
+					return
+				}
+				writeAdminJSON(w, list)
+				return
+			}
+			results, err := agent.GetExperimentResults(ctx, conn, key)
+			if handleError(w, err, "admin experiments") {
+				return
+			}
+			writeAdminJSON(w, results)
+		case http.MethodPost:
+			body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+			if handleError(w, err, "admin experiments") {
+				return
+			}
+			var e agent.Experiment
+			if err := json.Unmarshal(body, &e); err != nil {
+				handleError(w, apperr.InvalidArgs(err), "admin experiments")
+				return
+			}
+			if err := e.Validate(); err != nil {
+				handleError(w, apperr.Validation("%s", err.Error()), "admin experiments")
+				return
+			}
+			started, err := agent.StartExperiment(ctx, conn, e, adminID)
+			if handleError(w, err, "admin experiments") {
+				return
+			}
+			writeAdminJSON(w, started)
+		case http.MethodDelete:
+			if handleError(w, agent.StopExperiment(ctx, conn, key, adminID), "admin experiments") {
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
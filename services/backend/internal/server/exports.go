@@ -0,0 +1,32 @@
+package server
+
+import (
+	"backend/internal/app/userdata"
+	"backend/internal/data"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// exportDownloadHandler serves a data export archive to whoever holds a signed
+// download link; GetDataExports hands those out only to the export's owner
+func exportDownloadHandler(conn *data.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		archive, filename, err := userdata.LoadExportArchive(r.Context(), conn, r.URL.Query().Get("token"))
+		if handleError(w, err, "export download") {
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if _, err := w.Write(archive); err != nil {
+			log.Printf("Error writing data export: %v", err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"backend/internal/app/agent"
+	"backend/internal/app/alerts"
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"net/http"
+	"strconv"
+)
+
+// adminFeedbackHandler serves the quality dashboards built from user feedback:
+//
+//	GET /admin/feedback?by=prompt&days=30            response ratings per prompt version
+//	GET /admin/feedback?by=strategy&days=30          alert usefulness per strategy
+//	GET /admin/feedback?by=comments&days=30&down=1   latest commented ratings
+func adminFeedbackHandler(conn *data.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		ctx := r.Context()
+		q := r.URL.Query()
+		days := 0
+		if s := q.Get("days"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				handleError(w, apperr.Validation("days must be a number"), "admin feedback")
+				return
+			}
+			days = n
+		}
+		var out interface{}
+		var err error
+		switch q.Get("by") {
+		case "", "prompt":
+			out, err = agent.PromptFeedbackSummary(ctx, conn, days)
+		case "strategy":
+			out, err = alerts.StrategyFeedbackSummary(ctx, conn, 0, days)
+		case "comments":
+			out, err = agent.RecentRatingComments(ctx, conn, days, q.Get("down") == "1")
+		default:
+			err = apperr.Validation("by must be prompt, strategy or comments")
+		}
+		if handleError(w, err, "admin feedback") {
+			return
+		}
+		writeAdminJSON(w, out)
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/services/flags"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// adminFlagsHandler serves /admin/flags:
+//
+//	GET    /admin/flags           every known flag, its default and stored settings
+//	POST   /admin/flags           {"key", "enabled", "rolloutPercent", "userIds"}
+//	                              stores a flag; every server picks it up at once
+//	DELETE /admin/flags?key=...   returns a flag to its default
+func adminFlagsHandler(conn *data.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		// adminOnly already checked the token
+		adminID := 0
+		if claims, err := parseToken(r.Header.Get("Authorization")); err == nil {
+			adminID = claims.UserID
+		}
+		switch r.Method {
+		case http.MethodGet:
+			list, err := flags.List(ctx, conn)
+			if handleError(w, err, "admin flags") {
+				return
+			}
+			writeAdminJSON(w, list)
+		case http.MethodPost:
+			body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+			if handleError(w, err, "admin flags") {
+				return
+			}
+			f := flags.Flag{RolloutPercent: 100}
+			if err := json.Unmarshal(body, &f); err != nil {
+				handleError(w, apperr.InvalidArgs(err), "admin flags")
+				return
+			}
+			if err := f.Validate(); err != nil {
+				handleError(w, apperr.Validation("%s", err.Error()), "admin flags")
+				return
+			}
+			stored, err := flags.Set(ctx, conn, f, adminID)
+			if handleError(w, err, "admin flags") {
+				return
+			}
+			writeAdminJSON(w, stored)
+		case http.MethodDelete:
+			key := r.URL.Query().Get("key")
+			if _, ok := flags.Known[key]; !ok {
+				handleError(w, apperr.Validation("unknown flag %q", key), "admin flags")
+				return
+			}
+			if handleError(w, flags.Delete(ctx, conn, key, adminID), "admin flags") {
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func writeAdminJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
@@ -2,8 +2,13 @@
 package server
 
 import (
+	"backend/internal/apperr"
+	"backend/internal/budget"
 	"backend/internal/data"
+	"backend/internal/services/sessions"
 	"backend/internal/services/socket"
+	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -11,22 +16,39 @@ import (
 	"log"
 	"net/http"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
 
+	"backend/internal/apispec"
 	"backend/internal/app/account"
 	"backend/internal/app/agent"
 	"backend/internal/app/alerts"
 	"backend/internal/app/chart"
+	"backend/internal/app/dependencies"
 	"backend/internal/app/filings"
 	"backend/internal/app/helpers"
 	"backend/internal/app/limits"
+	"backend/internal/app/onboarding"
+	"backend/internal/app/reports"
+	"backend/internal/app/screener"
 	"backend/internal/app/screensaver"
+	"backend/internal/app/search"
 	"backend/internal/app/settings"
 	"backend/internal/app/strategy"
+	"backend/internal/app/study"
+	"backend/internal/app/userdata"
 	"backend/internal/app/watchlist"
+	"backend/internal/app/workspaces"
 	alertsvc "backend/internal/services/alerts"
+	"backend/internal/services/assets"
+	"backend/internal/services/chartimage"
+	"backend/internal/services/flags"
+	"backend/internal/services/marketstatus"
+	"backend/internal/services/notices"
+	"backend/internal/services/twofactor"
 	"context"
 	"crypto/rand"
 	"encoding/hex"
@@ -37,6 +59,7 @@ var publicFunc = map[string]func(*data.Conn, json.RawMessage) (interface{}, erro
 	"login":                            Login,
 	"googleLogin":                      GoogleLogin,
 	"googleCallback":                   GoogleCallback,
+	"verifyTwoFactorLogin":             VerifyTwoFactorLogin,
 	"getPublicConversation":            agent.GetPublicConversation,
 	"getSecuritiesFromTicker":          helpers.GetSecuritiesFromTicker,
 	"getPopularTickers":                helpers.GetPopularTickers,
@@ -45,6 +68,9 @@ var publicFunc = map[string]func(*data.Conn, json.RawMessage) (interface{}, erro
 	"getSecurityIDFromTickerTimestamp": helpers.GetSecurityIDFromTickerTimestamp,
 	"getTickerMenuDetails":             helpers.GetTickerMenuDetails,
 	"getSecurityClassifications":       helpers.GetSecurityClassifications,
+	"getMarketStatus":                  marketstatus.GetMarketStatus,
+	"getSystemNotice":                  notices.GetSystemNotice,
+	"getSharedStrategyReport":          strategy.GetSharedReport,
 	"getPublicPricingConfiguration":    GetPublicPricingConfiguration,
 	"validateInvite":                   ValidateInvite,
 	"verifyOTP":                        VerifyOTP,
@@ -69,14 +95,18 @@ var frontendServerFunc = map[string]func(*data.Conn, json.RawMessage) (interface
 var privateFunc = map[string]func(*data.Conn, int, json.RawMessage) (interface{}, error){
 
 	// --- chat / conversation --------------------------------------------------
-	//"getSimilarInstances": helpers.GetSimilarInstances,
 	"getInstancesByTickers": screensaver.GetInstancesByTickers,
 	"getCurrentSecurityID":  helpers.GetCurrentSecurityID,
 	"getCurrentTicker":      helpers.GetCurrentTicker,
+	"resolveTickers":        helpers.GetTickerResolutions,
 	"getIcons":              helpers.GetIcons,
 	"getUserLastTickers":    helpers.GetUserLastTickers,
 	"getPrevClose":          helpers.GetPrevClose,
 	"getExchanges":          helpers.GetExchanges,
+	"getIndexMembers":       helpers.GetIndexMembers,
+	"getIndexMemberships":   helpers.GetIndexMemberships,
+
+	"getSnapshotsForTickers": helpers.GetSnapshotsForTickers,
 
 	"getLatestEdgarFilings": filings.GetLatestEdgarFilings,
 	"getStockEdgarFilings":  filings.GetStockEdgarFilings,
@@ -88,6 +118,20 @@ var privateFunc = map[string]func(*data.Conn, int, json.RawMessage) (interface{}
 	"getHorizontalLines":    chart.GetHorizontalLines,
 	"deleteHorizontalLine":  chart.DeleteHorizontalLine,
 	"updateHorizontalLine":  chart.UpdateHorizontalLine,
+	"getChartDrawings":      chart.GetChartDrawings,
+	"setChartDrawing":       chart.SetChartDrawing,
+	"updateChartDrawing":    chart.UpdateChartDrawing,
+	"deleteChartDrawing":    chart.DeleteChartDrawing,
+	"getSessionVWAP":        chart.GetSessionVWAP,
+	"getAnchoredVWAP":       chart.GetAnchoredVWAP,
+	"getDataHealth":         chart.GetDataHealth,
+	"getChartImage":         chartimage.GetChartImage,
+	"getReplayBars":         socket.GetReplayBars,
+
+	// --- screener -------------------------------------------------------------
+	"getComputedColumns":   screener.GetComputedColumns,
+	"createComputedColumn": screener.CreateComputedColumn,
+	"deleteComputedColumn": screener.DeleteComputedColumn,
 
 	// --- screensavers ---------------------------------------------------------
 	"getScreensavers": screensaver.GetScreensavers,
@@ -101,11 +145,14 @@ var privateFunc = map[string]func(*data.Conn, int, json.RawMessage) (interface{}
 	"newWatchlistItem":    watchlist.NewWatchlistItem,
 	"moveWatchlistItem":   watchlist.MoveWatchlistItem,
 	"setWatchlistOrder":   watchlist.SetWatchlistOrder,
+	"importWatchlist":     watchlist.ImportWatchlist,
+	"exportWatchlist":     watchlist.ExportWatchlist,
 
 	// --- user settings / profile ---------------------------------------------
 	"getSettings":          settings.GetSettings,
 	"setSettings":          settings.SetSettings,
 	"updateProfilePicture": settings.UpdateProfilePicture,
+	"getOnboardingStatus":  onboarding.GetOnboardingStatus,
 
 	// --- alerts ---------------------------------------------------------------
 	"getAlerts":    alerts.GetAlerts,
@@ -114,6 +161,33 @@ var privateFunc = map[string]func(*data.Conn, int, json.RawMessage) (interface{}
 	"updateAlert":  alerts.UpdateAlert,
 	"deleteAlert":  alerts.DeleteAlert,
 
+	"getEscalationPolicies":  alerts.GetEscalationPolicies,
+	"setEscalationPolicy":    alerts.SetEscalationPolicy,
+	"deleteEscalationPolicy": alerts.DeleteEscalationPolicy,
+
+	"getTelegramChat":    alerts.GetTelegramChat,
+	"createTelegramLink": alerts.CreateTelegramLink,
+	"unlinkTelegramChat": alerts.UnlinkTelegramChat,
+
+	"getNotificationRateLimits":   alerts.GetNotificationRateLimits,
+	"setNotificationRateLimit":    alerts.SetNotificationRateLimit,
+	"deleteNotificationRateLimit": alerts.DeleteNotificationRateLimit,
+
+	"rateAlert":                alerts.RateAlert,
+	"getStrategyAlertFeedback": alerts.GetStrategyAlertFeedback,
+
+	"getStrategyAlertEvaluations": alerts.GetStrategyAlertEvaluations,
+
+	"getAlertWebhooks":       alerts.GetAlertWebhooks,
+	"createAlertWebhook":     alerts.CreateAlertWebhook,
+	"updateAlertWebhook":     alerts.UpdateAlertWebhook,
+	"deleteAlertWebhook":     alerts.DeleteAlertWebhook,
+	"getAlertWebhookSchemas": alerts.GetAlertWebhookSchemas,
+
+	// --- socket sessions ------------------------------------------------------
+	"getConnections":       socket.GetConnections,
+	"disconnectConnection": socket.DisconnectConnection,
+
 	// --- trades / statistics --------------------------------------------------
 	"grab_user_trades":       account.GrabUserTrades,
 	"get_trade_statistics":   account.GetTradeStatistics,
@@ -123,20 +197,42 @@ var privateFunc = map[string]func(*data.Conn, int, json.RawMessage) (interface{}
 	"get_daily_trade_stats":  account.GetDailyTradeStats,
 
 	// --- strategy / back-testing ---------------------------------------------
-	"run_backtest":  wrapContextFunc(strategy.RunBacktest),
-	"run_screening": wrapContextFunc(strategy.RunScreening),
-
-	"getStrategies":            strategy.GetStrategies,
-	"createStrategyFromPrompt": wrapContextFunc(strategy.CreateStrategyFromPrompt),
-	"setAlert":                 strategy.SetAlert,
-	"deleteStrategy":           strategy.DeleteStrategy,
+	"getStrategies":               strategy.GetStrategies,
+	"setAlert":                    strategy.SetAlert,
+	"getAlertThresholdSuggestion": strategy.GetAlertThresholdSuggestion,
+	"deleteStrategy":              strategy.DeleteStrategy,
+	"createStrategyShareLink":     strategy.CreateShareLink,
+	"getStrategyShareLinks":       strategy.GetShareLinks,
+	"revokeStrategyShareLink":     strategy.RevokeShareLink,
+
+	"getStrategyTemplates":        strategy.GetStrategyTemplates,
+	"instantiateStrategyTemplate": strategy.InstantiateStrategyTemplate,
+
+	// what deleting a strategy, watchlist or computed column would affect
+	"getDependencyImpact": dependencies.GetDependencyImpact,
+
+	// --- study labels ---------------------------------------------------------
+	"labelStudies":         study.LabelStudies,
+	"unlabelStudies":       study.UnlabelStudies,
+	"getStudyLabels":       study.GetStudyLabels,
+	"exportLabeledStudies": study.ExportLabeledStudies,
 
 	// --- misc / auth helpers --------------------------------------------------
 	"verifyAuth": func(*data.Conn, int, json.RawMessage) (interface{}, error) {
 		// TODO: replace with real auth logic
 		return nil, nil
 	},
-	"deleteAccount": DeleteAccount,
+	"deleteAccount":     DeleteAccount,
+	"requestDataExport": userdata.RequestDataExport,
+	"getDataExports":    userdata.GetDataExports,
+
+	"getTwoFactorStatus":         twofactor.GetTwoFactorStatus,
+	"beginTwoFactorEnrollment":   twofactor.BeginTwoFactorEnrollment,
+	"confirmTwoFactorEnrollment": twofactor.ConfirmTwoFactorEnrollment,
+	"disableTwoFactor":           twofactor.DisableTwoFactor,
+
+	"getAgentPermissions": agent.GetAgentPermissions,
+	"setAgentPermissions": agent.SetAgentPermissions,
 
 	// --- pricing / billing ----------------------------------------------------
 	"getUserConversation":        agent.GetUserConversation,
@@ -146,13 +242,17 @@ var privateFunc = map[string]func(*data.Conn, int, json.RawMessage) (interface{}
 
 	// Multiple conversations management
 	"getUserConversations":      agent.GetUserConversations,
+	"createConversation":        agent.CreateConversation,
+	"renameConversation":        agent.RenameConversation,
 	"switchConversation":        agent.SwitchConversation,
 	"deleteConversation":        agent.DeleteConversation,
 	"cancelPendingMessage":      agent.CancelPendingMessage,
 	"editMessage":               agent.EditMessage,
 	"retryMessage":              agent.RetryMessage,
+	"rateMessage":               agent.RateMessage,
 	"getWhyMoving":              agent.GetWhyMoving,
 	"setConversationVisibility": agent.SetConversationVisibility,
+	"searchConversations":       agent.SearchConversations,
 
 	// --- billing / stripe -----------------------------------------------------
 	"createCheckoutSession":           CreateCheckoutSession,
@@ -168,12 +268,59 @@ var privateFunc = map[string]func(*data.Conn, int, json.RawMessage) (interface{}
 	"getUserUsageStats": func(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
 		return limits.GetUserUsageStats(conn, userID, rawArgs)
 	},
+	"getLimitForecast": limits.GetLimitForecast,
+
+	// --- scheduled reports ----------------------------------------------------
+	"getReports":      reports.GetReports,
+	"saveReport":      reports.SaveReport,
+	"deleteReport":    reports.DeleteReport,
+	"runReportNow":    reports.RunReportNow,
+	"getReportRuns":   reports.GetReportRuns,
+	"getReportRunPdf": reports.GetReportRunPDF,
+
+	// --- team workspaces ------------------------------------------------------
+	"getWorkspaces":         workspaces.GetWorkspaces,
+	"createWorkspace":       workspaces.CreateWorkspace,
+	"deleteWorkspace":       workspaces.DeleteWorkspace,
+	"addWorkspaceMember":    workspaces.AddWorkspaceMember,
+	"removeWorkspaceMember": workspaces.RemoveWorkspaceMember,
+	"shareToWorkspace":      workspaces.ShareToWorkspace,
+	"transferOwnership":     workspaces.TransferOwnership,
 }
 
 // Private functions that support context cancellation
 var privateFuncWithContext = map[string]func(context.Context, *data.Conn, int, json.RawMessage) (interface{}, error){
 	"getQuery": agent.GetChatRequest,
 	"stopChat": agent.StopChatRequest,
+
+	"get_pnl_calendar":    account.GetPnLCalendar,
+	"getSimilarInstances": study.GetSimilarInstances,
+
+	"run_backtest":             strategy.RunBacktest,
+	"estimateStrategyCost":     strategy.EstimateStrategyCost,
+	"explainStrategy":          strategy.ExplainStrategy,
+	"run_screening":            strategy.RunScreening,
+	"getStrategySignals":       strategy.GetStrategySignals,
+	"run_optimization_sweep":   strategy.RunOptimizationSweep,
+	"createStrategyFromPrompt": strategy.CreateStrategyFromPrompt,
+
+	// Login sessions; the request context carries the caller's session
+	"getSessions":       sessions.GetSessions,
+	"revokeSession":     sessions.RevokeSession,
+	"revokeAllSessions": sessions.RevokeAllSessions,
+
+	"confirmPendingAction": agent.ConfirmPendingAction,
+
+	"simulateAlert": alerts.SimulateAlert,
+
+	// Price alerts placed and dragged on a chart, answered with a preview
+	"createChartAlert": alerts.CreateChartAlert,
+	"updateChartAlert": alerts.UpdateChartAlert,
+	"testAlertWebhook": alerts.TestAlertWebhook,
+
+	// Command palette search
+	"globalSearch":          search.GlobalSearch,
+	"recordSearchSelection": search.RecordSearchSelection,
 }
 
 // Request represents a structure for handling Request data.
@@ -219,10 +366,27 @@ func withPanicRecovery(h http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// withRequestID gives every request an ID, the caller's X-Request-ID when it
+// sends a usable one, echoed in the response and attached to the database
+// queries the request makes so a killed query can be traced back to it
+func withRequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if len(id) == 0 || len(id) > 64 || strings.ContainsAny(id, " \t\r\n") {
+			id = generateStreamID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		h.ServeHTTP(w, r.WithContext(data.WithRequestID(r.Context(), id)))
+	})
+}
+
+const requestIDHeader = "X-Request-ID"
+
 func addCORSHeaders(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, "+idempotencyHeader+", "+requestIDHeader+", "+dryRunHeader+", If-None-Match")
+	w.Header().Set("Access-Control-Expose-Headers", errorCodeHeader+", "+idempotencyReplayed+", "+requestIDHeader+", ETag")
 }
 
 func handleError(w http.ResponseWriter, err error, context string) bool {
@@ -230,20 +394,18 @@ func handleError(w http.ResponseWriter, err error, context string) bool {
 		logMessage := fmt.Sprintf("%s: %v", context, err)
 		log.Println(logMessage)
 
-		// Only log a critical alert for non-auth related errors. Authentication
-		// failures (e.g. invalid or expired JWTs) are expected client errors and
-		// should not trigger pager duty alerts.
-		if context != "auth" {
+		// Only log a critical alert for unexpected errors. Authentication
+		// failures (e.g. invalid or expired JWTs) and coded client errors
+		// (validation, not found, limits) should not trigger pager duty alerts.
+		if context != "auth" && apperr.CodeOf(err) == apperr.CodeInternal {
 			_ = alertsvc.LogCriticalAlert(err)
 		}
 
-		// Decide public-facing message
-		status, msg := resolveAppError(err)
 		if context == "auth" {
-			status = http.StatusUnauthorized
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return true
 		}
-
-		http.Error(w, msg, status)
+		writeAppError(w, err)
 		return true
 	}
 	return false
@@ -289,27 +451,65 @@ func publicHandler(conn *data.Conn) http.HandlerFunc {
 			return
 		}
 
-		// Execute the requested function with sanitized input
-		result, err := publicFunc[req.Function](conn, req.Arguments)
+		// Execute the requested function with sanitized input within its latency budget
+		fn := publicFunc[req.Function]
+		result, err := budget.Measure(conn, budget.KindEndpoint, req.Function, apispec.Budget(req.Function),
+			func() (interface{}, error) { return fn(conn, req.Arguments) })
 		if err != nil {
 			// Log the detailed error on the server
 			log.Printf("Public handler error [%s]: %v", req.Function, err)
 			// Map to safe client message
-			status, msg := resolveAppError(err)
-			log.Printf("%d %s", status, msg)
-			http.Error(w, msg, status)
+			writeAppError(w, err)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		encoder := json.NewEncoder(w)
+		var body bytes.Buffer
+		encoder := json.NewEncoder(&body)
 		encoder.SetEscapeHTML(true) // Escape HTML in JSON responses
 		if err := encoder.Encode(result); err != nil {
 			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			return
+		}
+		if etagFuncs[req.Function] {
+			etag := responseETag(body.Bytes())
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", "no-cache")
+			if etagMatches(r.Header.Get("If-None-Match"), etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(body.Bytes()); err != nil {
+			log.Printf("Error writing response for %s: %v", req.Function, err)
 		}
 	}
 }
 
+// Public functions whose responses carry an ETag. A client that sends it back
+// in If-None-Match gets 304 Not Modified instead of the same body again.
+var etagFuncs = map[string]bool{
+	"getTickerMenuDetails": true,
+}
+
+// responseETag is a strong ETag for a response body
+func responseETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, weakly as
+// the header calls for
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
 func privateUploadHandler(conn *data.Conn) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		addCORSHeaders(w)
@@ -324,10 +524,11 @@ func privateUploadHandler(conn *data.Conn) http.HandlerFunc {
 			return
 		}
 		tokenString := r.Header.Get("Authorization")
-		userID, err := validateToken(tokenString)
+		claims, err := validateToken(conn, r, tokenString)
 		if handleError(w, err, "auth") {
 			return
 		}
+		userID := claims.UserID
 
 		if err := r.ParseMultipartForm(32 << 20); err != nil {
 			handleError(w, err, "parsing multipart form")
@@ -370,28 +571,43 @@ func privateUploadHandler(conn *data.Conn) http.HandlerFunc {
 
 		// Handle trade upload directly in Go instead of queueing it
 		if funcName == "handle_trade_upload" {
+			idem, done := beginIdempotent(w, r, conn, userID, funcName, []byte(funcName), fileContent, []byte(r.FormValue("args")))
+			if done {
+				return
+			}
+
 			// Create args directly for HandleTradeUpload
 			argsBytes, err := json.Marshal(map[string]interface{}{
 				"file_content": encodedContent,
 				"extra":        additionalArgs,
 			})
 			if err != nil {
+				idem.release()
 				handleError(w, err, "marshaling arguments")
 				return
 			}
 
 			// Call the Go implementation directly
 			result, err := account.HandleTradeUpload(conn, userID, argsBytes)
+			if err != nil {
+				idem.release()
+			}
 			if handleError(w, err, "processing trade upload") {
 				return
 			}
 
 			// Return the result directly
-			w.Header().Set("Content-Type", "application/json")
-			if err := json.NewEncoder(w).Encode(result); err != nil {
+			body, err := json.Marshal(result)
+			if err != nil {
+				idem.release()
 				handleError(w, err, "encoding response")
 				return
 			}
+			idem.complete(body)
+			w.Header().Set("Content-Type", "application/json")
+			if _, err := w.Write(body); err != nil {
+				log.Printf("Error writing trade upload response: %v", err)
+			}
 			return
 		}
 	}
@@ -405,10 +621,12 @@ func privateHandler(conn *data.Conn) http.HandlerFunc {
 		}
 
 		tokenString := r.Header.Get("Authorization")
-		userID, err := validateToken(tokenString)
+		claims, err := validateToken(conn, r, tokenString)
 		if handleError(w, err, "auth") {
 			return
 		}
+		userID := claims.UserID
+		r = r.WithContext(sessions.WithID(r.Context(), claims.ID))
 
 		// Validate content type to prevent content-type sniffing attacks
 		contentType := r.Header.Get("Content-Type")
@@ -447,46 +665,80 @@ func privateHandler(conn *data.Conn) http.HandlerFunc {
 			http.Error(w, "Unknown function", http.StatusBadRequest)
 			return
 		}
+		if tool := apispec.ArgsTool(req.Function); tool != "" {
+			if handleError(w, agent.ValidateToolArgs(tool, req.Arguments), req.Function) {
+				return
+			}
+		}
+
+		if dryRunRequested(r) {
+			serveDryRun(w, r, conn, userID, req.Function, req.Arguments)
+			return
+		}
 
-		// Execute the requested function with sanitized input and request context
-		var result interface{}
+		// Retries carrying an Idempotency-Key get the original response
+		idem, done := beginIdempotent(w, r, conn, userID, req.Function, []byte(req.Function), req.Arguments)
+		if done {
+			return
+		}
 
-		// Try context-aware function first
+		// Execute the requested function with sanitized input and request
+		// context, within the function's latency budget. Functions without a
+		// context can't be stopped at the deadline, so they are only timed.
+		var result interface{}
+		class := apispec.Budget(req.Function)
 		if contextFunc, exists := privateFuncWithContext[req.Function]; exists {
-			result, err = contextFunc(r.Context(), conn, userID, req.Arguments)
-
-			// Handle context cancellation gracefully
-			if err != nil && r.Context().Err() == context.Canceled {
-				// Return a structured cancellation response instead of an error
-				cancelResponse := map[string]interface{}{
-					"type":    "cancelled",
-					"message": "Request was cancelled by user",
-				}
-				w.Header().Set("Content-Type", "application/json")
-				encoder := json.NewEncoder(w)
-				encoder.SetEscapeHTML(true)
-				if err := encoder.Encode(cancelResponse); err != nil {
-					http.Error(w, fmt.Sprintf("Error encoding cancellation response: %v", err), http.StatusInternalServerError)
-				}
-				return
-			}
+			result, err = budget.Call(r.Context(), conn, budget.KindEndpoint, req.Function, class, func(ctx context.Context) (interface{}, error) {
+				return contextFunc(ctx, conn, userID, req.Arguments)
+			}, idem.finishLate)
 		} else if regularFunc, exists := privateFunc[req.Function]; exists {
 			// Fallback to regular function for functions not yet updated
-			result, err = regularFunc(conn, userID, req.Arguments)
+			result, err = budget.Measure(conn, budget.KindEndpoint, req.Function, class, func() (interface{}, error) {
+				return regularFunc(conn, userID, req.Arguments)
+			})
 		} else {
+			idem.release()
 			http.Error(w, "Unknown function", http.StatusBadRequest)
 			return
 		}
 
+		// Handle context cancellation gracefully
+		if err != nil && r.Context().Err() == context.Canceled {
+			idem.release()
+			// Return a structured cancellation response instead of an error
+			cancelResponse := map[string]interface{}{
+				"type":    "cancelled",
+				"message": "Request was cancelled by user",
+			}
+			w.Header().Set("Content-Type", "application/json")
+			encoder := json.NewEncoder(w)
+			encoder.SetEscapeHTML(true)
+			if err := encoder.Encode(cancelResponse); err != nil {
+				http.Error(w, fmt.Sprintf("Error encoding cancellation response: %v", err), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if err != nil && apperr.CodeOf(err) != apperr.CodeUpstreamTimeout {
+			// A function past its budget may still finish; finishLate settles the key then
+			idem.release()
+		}
 		if handleError(w, err, fmt.Sprintf("private_handler: %s", req.Function)) {
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		encoder := json.NewEncoder(w)
+		var body bytes.Buffer
+		encoder := json.NewEncoder(&body)
 		encoder.SetEscapeHTML(true) // Escape HTML in JSON responses
 		if err := encoder.Encode(result); err != nil {
+			idem.release()
 			http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		idem.complete(body.Bytes())
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(body.Bytes()); err != nil {
+			log.Printf("Error writing response for %s: %v", req.Function, err)
 		}
 	}
 }
@@ -607,7 +859,7 @@ func WSHandler(conn *data.Conn) http.HandlerFunc {
 		}
 
 		// Validate the token and extract the user ID
-		userID, err := validateToken(token)
+		claims, err := validateToken(conn, r, token)
 		if err != nil {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
@@ -621,7 +873,7 @@ func WSHandler(conn *data.Conn) http.HandlerFunc {
 		}
 
 		// Call the slimmed-down version of WsHandler in socket.go
-		socket.HandleWebSocket(conn, ws, userID)
+		socket.HandleWebSocket(conn, ws, claims.UserID, claims.ID, clientIP(r), r.UserAgent())
 	}
 }
 
@@ -639,6 +891,64 @@ func HealthCheck() http.HandlerFunc {
 	}
 }
 
+// openAPIHandler serves the OpenAPI document of the published API
+func openAPIHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		addCORSHeaders(w)
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(apispec.OpenAPI()); err != nil {
+			http.Error(w, "Error encoding OpenAPI document", http.StatusInternalServerError)
+		}
+	}
+}
+
+// assetHandler serves stored images by content hash. Assets never change, so
+// the hash is the ETag and a matching If-None-Match is answered without a lookup.
+func assetHandler(conn *data.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hash := strings.TrimPrefix(r.URL.Path, assets.PathPrefix)
+		if !assets.ValidHash(hash) {
+			http.NotFound(w, r)
+			return
+		}
+		etag := `"` + hash + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		if match := r.Header.Get("If-None-Match"); match == etag || match == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		asset, err := assets.Load(r.Context(), conn, hash)
+		if err == assets.ErrNotFound {
+			w.Header().Del("Cache-Control")
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Printf("Error serving asset %s: %v", hash, err)
+			http.Error(w, "Error loading asset", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", asset.ContentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(asset.Data)))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		// SVG logos are third-party markup; never let them run script
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+		if r.Method == http.MethodHead {
+			return
+		}
+		if _, err := w.Write(asset.Data); err != nil {
+			log.Printf("Error writing asset %s: %v", hash, err)
+		}
+	}
+}
+
 // Add new streaming endpoint handler
 func streamingChatHandler(conn *data.Conn) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -649,11 +959,12 @@ func streamingChatHandler(conn *data.Conn) http.HandlerFunc {
 
 		// Validate JWT token
 		tokenString := r.Header.Get("Authorization")
-		userID, err := validateToken(tokenString)
+		claims, err := validateToken(conn, r, tokenString)
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		userID := claims.UserID
 
 		// Set headers for SSE
 		w.Header().Set("Content-Type", "text/event-stream")
@@ -891,8 +1202,7 @@ func frontendServerHandler(conn *data.Conn) http.HandlerFunc {
 		result, err := frontendServerFunc[req.Function](conn, req.Arguments)
 		if err != nil {
 			log.Printf("Frontend server handler error [%s]: %v", req.Function, err)
-			status, msg := resolveAppError(err)
-			http.Error(w, msg, status)
+			writeAppError(w, err)
 			return
 		}
 
@@ -907,23 +1217,52 @@ func frontendServerHandler(conn *data.Conn) http.HandlerFunc {
 
 // StartServer performs operations related to StartServer functionality.
 func StartServer(conn *data.Conn) {
+	// Refuse to start without the secrets tokens and webhooks are checked with
+	privateKey()
+	checkStripeConfig()
 	// Initialize chat handler for WebSocket
 	socket.SetChatHandler(agent.GetChatRequest)
-
-	// Replace direct registrations with panic-recovered handlers
-	http.Handle("/public", withPanicRecovery(publicHandler(conn)))
-	http.Handle("/private", withPanicRecovery(privateHandler(conn)))
-	http.Handle("/frontend/server", withPanicRecovery(frontendServerHandler(conn)))
-	http.Handle("/streaming-chat", withPanicRecovery(streamingChatHandler(conn)))
-	http.Handle("/ws", withPanicRecovery(WSHandler(conn)))
-	http.Handle("/upload", withPanicRecovery(privateUploadHandler(conn)))
-	http.Handle("/healthz", withPanicRecovery(HealthCheck()))
-	http.Handle("/billing/webhook", withPanicRecovery(stripeWebhookHandler(conn)))
-	http.Handle("/webhook/twitterapi/v1", withPanicRecovery(twitterWebhookHandler(conn)))
+	// Load prompt overrides and pick up new versions without a redeploy
+	agent.StartPromptReloader(conn)
+	// Load feature flags and pick up changes made on any server
+	flags.StartReloader(conn)
+	// Route per-user socket messages to whichever instance holds the connection
+	socket.StartSocketBus(conn)
+	// Broadcast service notices published from jobctl
+	socket.StartNoticeListener(conn)
+	// Track dependency health so degraded services shed load
+	startDependencyProbes(conn)
+	// Cancel queries that outlive their statement budget
+	data.StartQueryWatchdog(conn)
+	// Bring the strategy template gallery up to date with this build's catalog
+	seedCtx, cancelSeed := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := strategy.SeedTemplates(seedCtx, conn); err != nil {
+		log.Printf("⚠️ Seeding strategy templates: %v", err)
+	}
+	cancelSeed()
+
+	// Replace direct registrations with panic-recovered handlers. The server has
+	// its own mux so nothing registered on http.DefaultServeMux is exposed.
+	mux := http.NewServeMux()
+	mux.Handle("/public", withPanicRecovery(publicHandler(conn)))
+	mux.Handle("/private", withPanicRecovery(privateHandler(conn)))
+	mux.Handle("/frontend/server", withPanicRecovery(frontendServerHandler(conn)))
+	mux.Handle("/streaming-chat", withPanicRecovery(streamingChatHandler(conn)))
+	mux.Handle("/ws", withPanicRecovery(WSHandler(conn)))
+	mux.Handle("/upload", withPanicRecovery(privateUploadHandler(conn)))
+	mux.Handle("/healthz", withPanicRecovery(HealthCheck()))
+	mux.Handle("/status", withPanicRecovery(statusHandler()))
+	mux.Handle("/openapi.json", withPanicRecovery(openAPIHandler()))
+	mux.Handle(assets.PathPrefix, withPanicRecovery(assetHandler(conn)))
+	mux.Handle("/billing/webhook", withPanicRecovery(stripeWebhookHandler(conn)))
+	mux.Handle("/webhook/twitterapi/v1", withPanicRecovery(twitterWebhookHandler(conn)))
+	registerDebugHandlers(mux, conn)
+	registerAdminHandlers(mux, conn)
+	mux.Handle(userdata.DownloadPath, withPanicRecovery(exportDownloadHandler(conn)))
 
 	server := &http.Server{
 		Addr:         ":5058",
-		Handler:      http.DefaultServeMux,
+		Handler:      withRequestStats(withRequestID(mux)),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 10 * time.Minute, // Increased for streaming
 		IdleTimeout:  240 * time.Second,
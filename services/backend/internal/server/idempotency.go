@@ -0,0 +1,172 @@
+package server
+
+import (
+	"backend/internal/data"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Mutating endpoints accept an Idempotency-Key header. The first request with
+// a key runs and its response is kept for idempotencyTTL; a retry with the
+// same key and body gets that response back instead of creating a second
+// alert, strategy or upload. Failed requests are forgotten so they can be
+// retried.
+const (
+	idempotencyHeader    = "Idempotency-Key"
+	idempotencyReplayed  = "Idempotent-Replayed"
+	idempotencyTTL       = 24 * time.Hour
+	idempotencyLockTTL   = 15 * time.Minute // how long an unfinished request holds its key
+	idempotencyKeyMaxLen = 255
+)
+
+// idempotentFuncs are the private functions (and upload functions) that honour
+// Idempotency-Key
+var idempotentFuncs = map[string]bool{
+	"newAlert":                 true,
+	"createChartAlert":         true,
+	"setAlert":                 true,
+	"createStrategyFromPrompt": true,
+	"run_backtest":             true,
+	"handle_trade_upload":      true,
+}
+
+type idempotencyRecord struct {
+	RequestHash string          `json:"requestHash"`
+	Done        bool            `json:"done"`
+	Body        json.RawMessage `json:"body,omitempty"`
+}
+
+// idempotentRequest tracks one request made with an Idempotency-Key
+type idempotentRequest struct {
+	conn        *data.Conn
+	redisKey    string
+	requestHash string
+}
+
+func idempotencyRedisKey(userID int, function, key string) string {
+	return fmt.Sprintf("idempotency:%d:%s:%s", userID, function, key)
+}
+
+// hashRequest fingerprints a request body so a reused key with different
+// content is rejected rather than answered with the wrong response
+func hashRequest(parts ...[]byte) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write(p)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// beginIdempotent claims the request's Idempotency-Key. It returns nil when
+// the request should run normally (no key, or a function without idempotency
+// support) and done=true when the response has already been written: a
+// replay of a finished request, or a conflict.
+func beginIdempotent(w http.ResponseWriter, r *http.Request, conn *data.Conn, userID int, function string, parts ...[]byte) (req *idempotentRequest, done bool) {
+	key := r.Header.Get(idempotencyHeader)
+	if key == "" || !idempotentFuncs[function] {
+		return nil, false
+	}
+	if len(key) > idempotencyKeyMaxLen {
+		http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+		return nil, true
+	}
+	req = &idempotentRequest{
+		conn:        conn,
+		redisKey:    idempotencyRedisKey(userID, function, key),
+		requestHash: hashRequest(parts...),
+	}
+	pending, err := json.Marshal(idempotencyRecord{RequestHash: req.requestHash})
+	if err != nil {
+		return nil, false
+	}
+	ctx := r.Context()
+	claimed, err := conn.Cache.SetNX(ctx, req.redisKey, pending, idempotencyLockTTL).Result()
+	if err != nil {
+		// Without Redis the request still runs, just without protection
+		log.Printf("⚠️ Idempotency check for %s failed: %v", function, err)
+		return nil, false
+	}
+	if claimed {
+		return req, false
+	}
+
+	raw, err := conn.Cache.Get(ctx, req.redisKey).Bytes()
+	if err == redis.Nil {
+		// The earlier request failed and released the key between our calls
+		return beginIdempotent(w, r, conn, userID, function, parts...)
+	}
+	var rec idempotencyRecord
+	if err == nil {
+		err = json.Unmarshal(raw, &rec)
+	}
+	if err != nil {
+		log.Printf("⚠️ Reading idempotency record for %s failed: %v", function, err)
+		return nil, false
+	}
+	switch {
+	case rec.RequestHash != req.requestHash:
+		http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+	case !rec.Done:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(idempotencyReplayed, "true")
+		if _, err := w.Write(rec.Body); err != nil {
+			log.Printf("Error writing replayed response: %v", err)
+		}
+	}
+	return nil, true
+}
+
+// complete stores the response of a successful request for replay
+func (req *idempotentRequest) complete(body []byte) {
+	if req == nil {
+		return
+	}
+	rec, err := json.Marshal(idempotencyRecord{RequestHash: req.requestHash, Done: true, Body: body})
+	if err != nil {
+		req.release()
+		return
+	}
+	if err := req.conn.Cache.Set(context.Background(), req.redisKey, rec, idempotencyTTL).Err(); err != nil {
+		log.Printf("⚠️ Storing idempotent response failed: %v", err)
+	}
+}
+
+// finishLate settles the key of a request whose function outlived its
+// latency budget, once the function finally returns
+func (req *idempotentRequest) finishLate(result interface{}, err error) {
+	if req == nil {
+		return
+	}
+	if err != nil {
+		req.release()
+		return
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		req.release()
+		return
+	}
+	req.complete(append(body, '\n'))
+}
+
+// release forgets a failed request so the client can retry with the same key
+func (req *idempotentRequest) release() {
+	if req == nil {
+		return
+	}
+	if err := req.conn.Cache.Del(context.Background(), req.redisKey).Err(); err != nil {
+		log.Printf("⚠️ Releasing idempotency key failed: %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"backend/internal/breaker"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Heavy jobs declare the resources they lean on, and the scheduler runs at
+// most a class's slots of them at once. Jobs wait for a slot in the order
+// they asked, so jobs scheduled together run one after another instead of
+// colliding. A job also waits while the resource looks overloaded, but only
+// up to budgetMaxLoadWait so a busy evening can't starve the nightly jobs.
+
+// ResourceClass is a shared resource heavy jobs contend for
+type ResourceClass string
+
+const (
+	ResourcePolygon ResourceClass = "polygon-heavy" // many Polygon requests, sharing the plan's rate limit
+	ResourceDB      ResourceClass = "db-heavy"      // long scans, bulk writes or refreshes
+)
+
+// resourceSlots is how many jobs of each class may run at once
+var resourceSlots = map[ResourceClass]int{
+	ResourcePolygon: 1,
+	ResourceDB:      2,
+}
+
+const (
+	// budgetPollInterval is how often a waiting job looks again when no
+	// job finishes
+	budgetPollInterval = 30 * time.Second
+	// budgetMaxLoadWait bounds how long observed load can delay a job; slots
+	// are always respected
+	budgetMaxLoadWait = 30 * time.Minute
+	// dbPoolBusyRatio of the pool's connections in use counts as busy
+	dbPoolBusyRatio = 0.8
+	// dbActiveQueriesBusy queries running in Postgres, from every service,
+	// counts as busy
+	dbActiveQueriesBusy = 40
+)
+
+// resourceBudget hands out the slots of each class to the scheduler's jobs
+type resourceBudget struct {
+	mu      sync.Mutex
+	holders map[ResourceClass][]string // jobs holding a slot, by class
+	waiting []*Job                     // jobs waiting for slots, oldest first
+	changed chan struct{}              // closed when the holders or the queue change
+}
+
+func newResourceBudget() *resourceBudget {
+	return &resourceBudget{holders: map[ResourceClass][]string{}, changed: make(chan struct{})}
+}
+
+// acquire waits until the job can take a slot of each class it uses and the
+// resources aren't overloaded, and reports how long it waited. It gives up
+// when the scheduler stops, reporting false.
+func (s *JobScheduler) acquire(job *Job) (time.Duration, bool) {
+	if len(job.Resources) == 0 {
+		return 0, true
+	}
+	b := s.budget
+	start := s.Clock.Now()
+	b.mu.Lock()
+	b.waiting = append(b.waiting, job)
+	b.mu.Unlock()
+
+	lastReason := ""
+	for {
+		loadReason := s.resourceLoad(job.Resources)
+		if loadReason != "" && s.Clock.Since(start) >= budgetMaxLoadWait {
+			log.Printf("⚠️ Job %s has waited %v on load (%s), running anyway", job.Name, budgetMaxLoadWait, loadReason)
+			loadReason = ""
+		}
+
+		b.mu.Lock()
+		reason := b.blocker(job)
+		if reason == "" {
+			reason = loadReason
+		}
+		if reason == "" {
+			b.remove(job)
+			for _, class := range job.Resources {
+				b.holders[class] = append(b.holders[class], job.Name)
+			}
+			b.notify()
+			b.mu.Unlock()
+			waited := s.Clock.Since(start)
+			if waited >= time.Second {
+				log.Printf("▶️ Job %s got its %s slot after %v", job.Name, joinClasses(job.Resources), waited.Round(time.Second))
+			}
+			return waited, true
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		if reason != lastReason {
+			log.Printf("⏳ Job %s waiting: %s", job.Name, reason)
+			lastReason = reason
+		}
+		select {
+		case <-changed:
+		case <-s.Clock.After(budgetPollInterval):
+		case <-s.StopChan:
+			b.mu.Lock()
+			b.remove(job)
+			b.notify()
+			b.mu.Unlock()
+			return s.Clock.Since(start), false
+		}
+	}
+}
+
+// release gives back the job's slots
+func (s *JobScheduler) release(job *Job) {
+	if len(job.Resources) == 0 {
+		return
+	}
+	b := s.budget
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, class := range job.Resources {
+		holders := b.holders[class]
+		for i, name := range holders {
+			if name == job.Name {
+				b.holders[class] = append(holders[:i:i], holders[i+1:]...)
+				break
+			}
+		}
+	}
+	b.notify()
+}
+
+// blocker says why the job can't take its slots yet, or "" if it can. The
+// slots older waiters will need are kept for them, so a job can't jump the
+// queue.
+func (b *resourceBudget) blocker(job *Job) string {
+	for _, class := range job.Resources {
+		holders := b.holders[class]
+		if len(holders) >= resourceSlots[class] {
+			return fmt.Sprintf("%s slots held by %s", class, strings.Join(holders, ", "))
+		}
+		var ahead []string
+		for _, w := range b.waiting {
+			if w == job {
+				break
+			}
+			if w.uses(class) {
+				ahead = append(ahead, w.Name)
+			}
+		}
+		if len(holders)+len(ahead) >= resourceSlots[class] {
+			return fmt.Sprintf("%s queued behind %s", class, strings.Join(ahead, ", "))
+		}
+	}
+	return ""
+}
+
+// notify wakes the waiting jobs to look again; b.mu must be held
+func (b *resourceBudget) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *resourceBudget) remove(job *Job) {
+	for i, w := range b.waiting {
+		if w == job {
+			b.waiting = append(b.waiting[:i:i], b.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+// busy reports whether a job holds or is waiting for a slot of the class
+func (b *resourceBudget) busy(class ResourceClass) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.holders[class]) > 0 {
+		return true
+	}
+	for _, w := range b.waiting {
+		if w.uses(class) {
+			return true
+		}
+	}
+	return false
+}
+
+// resourceLoad says which of the classes looks overloaded right now, or ""
+func (s *JobScheduler) resourceLoad(classes []ResourceClass) string {
+	for _, class := range classes {
+		switch class {
+		case ResourcePolygon:
+			// Live callers trip the breaker on outages and rate limiting alike
+			if !breaker.Polygon.Healthy() {
+				return "Polygon breaker is open"
+			}
+		case ResourceDB:
+			if reason := s.dbLoad(); reason != "" {
+				return reason
+			}
+		}
+	}
+	return ""
+}
+
+// dbLoad says why the database looks busy, or ""
+func (s *JobScheduler) dbLoad() string {
+	stat := s.Conn.DB.Stat()
+	if maxConns := stat.MaxConns(); maxConns > 0 && float64(stat.AcquiredConns()) >= dbPoolBusyRatio*float64(maxConns) {
+		return fmt.Sprintf("%d of %d pool connections in use", stat.AcquiredConns(), maxConns)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var active int
+	if err := s.Conn.DB.QueryRow(ctx, `
+		SELECT COUNT(*) FROM pg_stat_activity
+		WHERE state = 'active' AND backend_type = 'client backend' AND pid <> pg_backend_pid()`).Scan(&active); err != nil {
+		// Can't tell; let the job go rather than stall on a failing check
+		log.Printf("⚠️ Error checking database load: %v", err)
+		return ""
+	}
+	if active >= dbActiveQueriesBusy {
+		return fmt.Sprintf("%d queries running in Postgres", active)
+	}
+	return ""
+}
+
+// uses reports whether the job needs a slot of the class
+func (job *Job) uses(class ResourceClass) bool {
+	for _, c := range job.Resources {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func joinClasses(classes []ResourceClass) string {
+	names := make([]string, len(classes))
+	for i, c := range classes {
+		names[i] = string(c)
+	}
+	return strings.Join(names, "+")
+}
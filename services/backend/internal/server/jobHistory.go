@@ -0,0 +1,142 @@
+package server
+
+import (
+	"backend/internal/data"
+	"backend/internal/services/alerts"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// Every job run is kept in a per-job history so a run that takes much longer
+// than usual is caught even when it succeeds; a slow data pipeline otherwise
+// only shows up as stale screeners.
+const (
+	jobHistoryKeyPrefix = "job:history:"
+	jobHistoryEntries   = 200
+	// jobBaselineRuns is how many recent successful runs the median is taken over
+	jobBaselineRuns = 20
+	// jobAnomalyMinRuns successful runs are needed before a run is judged
+	jobAnomalyMinRuns = 5
+	// jobAnomalyRatio is how many times its median a run must take to be anomalous
+	jobAnomalyRatio = 5.0
+	// jobAnomalyMinDuration keeps jobs that usually take milliseconds from
+	// alerting on noise
+	jobAnomalyMinDuration = 30 * time.Second
+)
+
+// JobRun is one execution of a scheduled job
+type JobRun struct {
+	// RunID keys the worker tasks the run queued (see queue.JobRunTasks)
+	RunID      string    `json:"runId,omitempty"`
+	Start      time.Time `json:"start"`
+	DurationMs int64     `json:"durationMs"`
+	WaitMs     int64     `json:"waitMs,omitempty"` // for its resources, before Start
+	Failed     bool      `json:"failed,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	// Anomaly is set when the run took jobAnomalyRatio times its median or more
+	Anomaly *JobDurationAnomaly `json:"anomaly,omitempty"`
+}
+
+// JobDurationAnomaly compares a run with the job's recent median
+type JobDurationAnomaly struct {
+	MedianMs int64   `json:"medianMs"`
+	Ratio    float64 `json:"ratio"`
+}
+
+func getJobHistoryKey(jobName string) string {
+	return jobHistoryKeyPrefix + jobName
+}
+
+// loadJobHistory returns up to limit of a job's runs, newest first
+func loadJobHistory(ctx context.Context, conn *data.Conn, jobName string, limit int) ([]JobRun, error) {
+	raw, err := conn.Cache.LRange(ctx, getJobHistoryKey(jobName), 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("loading history of job %s: %w", jobName, err)
+	}
+	runs := make([]JobRun, 0, len(raw))
+	for _, r := range raw {
+		var run JobRun
+		if err := json.Unmarshal([]byte(r), &run); err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// medianJobDuration is the median of the most recent successful runs, and how
+// many runs it was taken over
+func medianJobDuration(runs []JobRun) (time.Duration, int) {
+	durations := make([]int64, 0, jobBaselineRuns)
+	for _, run := range runs {
+		if run.Failed {
+			continue
+		}
+		durations = append(durations, run.DurationMs)
+		if len(durations) == jobBaselineRuns {
+			break
+		}
+	}
+	if len(durations) == 0 {
+		return 0, 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	mid := len(durations) / 2
+	median := durations[mid]
+	if len(durations)%2 == 0 {
+		median = (durations[mid-1] + durations[mid]) / 2
+	}
+	return time.Duration(median) * time.Millisecond, len(durations)
+}
+
+// recordJobRun appends a run to the job's history, annotating it if it took
+// far longer than usual. The first anomalous run in a row raises a critical
+// alert; the ones after it are only annotated.
+func (s *JobScheduler) recordJobRun(job *Job, runID string, start time.Time, wait, duration time.Duration, runErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	history, err := loadJobHistory(ctx, s.Conn, job.Name, jobHistoryEntries)
+	if err != nil {
+		log.Printf("⚠️ %v", err)
+		return
+	}
+
+	run := JobRun{RunID: runID, Start: start, DurationMs: duration.Milliseconds(), WaitMs: wait.Milliseconds()}
+	if runErr != nil {
+		run.Failed = true
+		run.Error = runErr.Error()
+	}
+	median, samples := medianJobDuration(history)
+	if samples >= jobAnomalyMinRuns && median > 0 && duration >= jobAnomalyMinDuration {
+		if ratio := float64(duration) / float64(median); ratio >= jobAnomalyRatio {
+			run.Anomaly = &JobDurationAnomaly{MedianMs: median.Milliseconds(), Ratio: ratio}
+		}
+	}
+
+	encoded, err := json.Marshal(run)
+	if err != nil {
+		log.Printf("⚠️ Error encoding run of job %s: %v", job.Name, err)
+		return
+	}
+	pipe := s.Conn.Cache.TxPipeline()
+	pipe.LPush(ctx, getJobHistoryKey(job.Name), encoded)
+	pipe.LTrim(ctx, getJobHistoryKey(job.Name), 0, jobHistoryEntries-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ Error saving run of job %s: %v", job.Name, err)
+	}
+
+	if run.Anomaly == nil {
+		return
+	}
+	log.Printf("🐢 Job %s took %v, %.1f× its median of %v", job.Name, duration, run.Anomaly.Ratio, median)
+	if len(history) > 0 && history[0].Anomaly != nil {
+		return
+	}
+	_ = alerts.LogCriticalAlert(fmt.Errorf("job %s took %v, %.1f× its median of %v over the last %d successful runs",
+		job.Name, duration, run.Anomaly.Ratio, median, samples), job.Name)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/queue"
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// jobRunsDefaultLimit is how many recent runs of a job are listed by default
+const jobRunsDefaultLimit = 10
+
+// JobRunTasks is a job run and the worker tasks it queued
+type JobRunTasks struct {
+	RunID string             `json:"runId"`
+	Run   *JobRun            `json:"run,omitempty"` // nil for runs outside the scheduler
+	Tasks []queue.JobRunTask `json:"tasks"`
+}
+
+// adminJobRunsHandler serves the tasks scheduled job runs queued:
+//
+//	GET /admin/job-runs?runId=...           one run's tasks
+//	GET /admin/job-runs?job=...&limit=10    a job's recent runs, newest first,
+//	                                        each with its tasks
+func adminJobRunsHandler(conn *data.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		ctx := r.Context()
+		q := r.URL.Query()
+		if runID := q.Get("runId"); runID != "" {
+			tasks, err := queue.JobRunTasks(ctx, conn, runID)
+			if err == nil && len(tasks) == 0 {
+				err = apperr.NotFound("no tasks recorded for job run %s", runID)
+			}
+			if handleError(w, err, "admin job runs") {
+				return
+			}
+			writeAdminJSON(w, JobRunTasks{RunID: runID, Tasks: tasks})
+			return
+		}
+
+		job := q.Get("job")
+		if job == "" {
+			handleError(w, apperr.Validation("runId or job is required"), "admin job runs")
+			return
+		}
+		limit := jobRunsDefaultLimit
+		if s := q.Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				handleError(w, apperr.Validation("limit must be a positive number"), "admin job runs")
+				return
+			}
+			limit = n
+		}
+		runs, err := recentJobRunTasks(ctx, conn, job, limit)
+		if handleError(w, err, "admin job runs") {
+			return
+		}
+		writeAdminJSON(w, runs)
+	}
+}
+
+// recentJobRunTasks returns up to limit of a job's runs, newest first, with
+// the tasks each queued. Runs recorded before runs had IDs are left out.
+func recentJobRunTasks(ctx context.Context, conn *data.Conn, job string, limit int) ([]JobRunTasks, error) {
+	runs, err := loadJobHistory(ctx, conn, job, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]JobRunTasks, 0, len(runs))
+	for i := range runs {
+		if runs[i].RunID == "" {
+			continue
+		}
+		tasks, err := queue.JobRunTasks(ctx, conn, runs[i].RunID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, JobRunTasks{RunID: runs[i].RunID, Run: &runs[i], Tasks: tasks})
+	}
+	return result, nil
+}
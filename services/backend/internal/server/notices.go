@@ -0,0 +1,71 @@
+package server
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/services/notices"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// adminNoticeHandler serves the system notice:
+//
+//	GET    /admin/notice  the current notice, or null
+//	POST   /admin/notice  {"kind", "message", "maintenance", "startsAt", "endsAt"}
+//	                      replaces it and broadcasts it to every connected user
+//	DELETE /admin/notice  clears it
+func adminNoticeHandler(conn *data.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		switch r.Method {
+		case http.MethodGet:
+			n, err := notices.Current(ctx, conn)
+			if handleError(w, err, "admin notice") {
+				return
+			}
+			writeNoticeJSON(w, n)
+		case http.MethodPost:
+			body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+			if handleError(w, err, "admin notice") {
+				return
+			}
+			var n notices.Notice
+			if err := json.Unmarshal(body, &n); err != nil {
+				handleError(w, apperr.InvalidArgs(err), "admin notice")
+				return
+			}
+			if err := n.Validate(); err != nil {
+				handleError(w, apperr.Validation("%s", err.Error()), "admin notice")
+				return
+			}
+			// adminOnly already checked the token
+			if claims, err := parseToken(r.Header.Get("Authorization")); err == nil {
+				n.CreatedBy = claims.UserID
+			}
+			n.ID = uuid.NewString()
+			n.CreatedAt = time.Now().UnixMilli()
+			if handleError(w, notices.Broadcast(ctx, conn, n), "admin notice") {
+				return
+			}
+			writeNoticeJSON(w, &n)
+		case http.MethodDelete:
+			if handleError(w, notices.Clear(ctx, conn), "admin notice") {
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func writeNoticeJSON(w http.ResponseWriter, n *notices.Notice) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(n); err != nil {
+		http.Error(w, "Error encoding notice", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"backend/internal/app/strategy"
+	"backend/internal/breaker"
+	"backend/internal/data"
+	"backend/internal/queue"
+	alertsvc "backend/internal/services/alerts"
+	workermonitor "backend/internal/services/worker_monitor"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// overviewSectionTimeout bounds each section of the admin overview, so one
+// slow dependency only blanks its own section
+const overviewSectionTimeout = 3 * time.Second
+
+// overviewErrorWindows are the windows, in minutes, error rates are given over
+var overviewErrorWindows = []int{1, 5, 15, 60}
+
+// adminOverviewHandler serves the ops dashboard:
+//
+//	GET /admin/overview  scheduler, queue, workers, alertLoops, database,
+//	                     redis, canaries, errorRates and strategyTags in one
+//	                     payload
+//
+// Sections are gathered concurrently, each under its own timeout. A section
+// that fails or times out is null, with the reason under sectionErrors.
+func adminOverviewHandler(conn *data.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeAdminJSON(w, systemOverview(r.Context(), conn))
+	}
+}
+
+type overviewSection struct {
+	name string
+	load func(ctx context.Context) (interface{}, error)
+}
+
+func systemOverview(ctx context.Context, conn *data.Conn) map[string]interface{} {
+	sections := []overviewSection{
+		{"scheduler", func(ctx context.Context) (interface{}, error) { return schedulerStatus(ctx, conn) }},
+		{"queue", func(ctx context.Context) (interface{}, error) { return queue.GetControlStatus(ctx, conn) }},
+		{"workers", func(ctx context.Context) (interface{}, error) {
+			return workermonitor.NewWorkerMonitor(conn).Fleet(ctx)
+		}},
+		{"alertLoops", func(context.Context) (interface{}, error) {
+			return alertLoopStatus{Running: alertsvc.GetAlertService().IsRunning(), Loops: alertsvc.LoopLatencies()}, nil
+		}},
+		{"database", func(ctx context.Context) (interface{}, error) { return postgresHealth(ctx, conn), nil }},
+		{"redis", func(ctx context.Context) (interface{}, error) { return redisHealth(ctx, conn), nil }},
+		{"canaries", func(ctx context.Context) (interface{}, error) { return alertsvc.CanaryStatus(ctx, conn) }},
+		{"errorRates", func(context.Context) (interface{}, error) {
+			return recentErrorRates(time.Now(), overviewErrorWindows...), nil
+		}},
+		{"strategyTags", func(ctx context.Context) (interface{}, error) { return strategy.StrategyTagStats(ctx, conn) }},
+	}
+
+	type result struct {
+		name  string
+		value interface{}
+		err   error
+	}
+	results := make(chan result, len(sections))
+	for _, s := range sections {
+		go func(s overviewSection) {
+			sctx, cancel := context.WithTimeout(ctx, overviewSectionTimeout)
+			defer cancel()
+			// The load runs on its own so a section that ignores its context
+			// still can't hold up the response
+			done := make(chan result, 1)
+			go func() {
+				v, err := s.load(sctx)
+				done <- result{name: s.name, value: v, err: err}
+			}()
+			select {
+			case r := <-done:
+				results <- r
+			case <-sctx.Done():
+				results <- result{name: s.name, err: sctx.Err()}
+			}
+		}(s)
+	}
+
+	overview := map[string]interface{}{"generatedAt": time.Now()}
+	sectionErrors := map[string]string{}
+	for range sections {
+		r := <-results
+		if r.err != nil {
+			overview[r.name] = nil
+			sectionErrors[r.name] = r.err.Error()
+			continue
+		}
+		overview[r.name] = r.value
+	}
+	overview["sectionErrors"] = sectionErrors
+	overview["degraded"] = breaker.Degraded()
+	return overview
+}
+
+// JobStatus is a scheduled job's state as of its last run
+type JobStatus struct {
+	Name           string     `json:"name"`
+	Running        bool       `json:"running"` // on this replica
+	LastRun        *time.Time `json:"lastRun,omitempty"`
+	LastCompletion *time.Time `json:"lastCompletion,omitempty"`
+	PendingRetries int        `json:"pendingRetries,omitempty"`
+	LastResult     *JobRun    `json:"lastResult,omitempty"`
+	// MedianMs is over the recent successful runs, and RecentFailures counts
+	// the failed ones among the last jobBaselineRuns runs
+	MedianMs       int64 `json:"medianMs,omitempty"`
+	RecentFailures int   `json:"recentFailures"`
+}
+
+// schedulerStatus reads every job's last run times and recent history in one
+// round trip
+func schedulerStatus(ctx context.Context, conn *data.Conn) ([]JobStatus, error) {
+	type jobReads struct {
+		lastRun, lastCompletion, retries *redis.StringCmd
+		history                          *redis.StringSliceCmd
+	}
+	pipe := conn.Cache.Pipeline()
+	reads := make([]jobReads, len(JobList))
+	for i, job := range JobList {
+		reads[i] = jobReads{
+			lastRun:        pipe.Get(ctx, getJobLastRunKey(job.Name)),
+			lastCompletion: pipe.Get(ctx, getJobLastCompletionKey(job.Name)),
+			retries:        pipe.Get(ctx, getJobRetryCountKey(job.Name)),
+			history:        pipe.LRange(ctx, getJobHistoryKey(job.Name), 0, jobBaselineRuns-1),
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	statuses := make([]JobStatus, 0, len(JobList))
+	for i, job := range JobList {
+		job.ExecutionMutex.Lock()
+		s := JobStatus{Name: job.Name, Running: job.IsRunning}
+		job.ExecutionMutex.Unlock()
+		if t, err := time.Parse(time.RFC3339, reads[i].lastRun.Val()); err == nil {
+			s.LastRun = &t
+		}
+		if t, err := time.Parse(time.RFC3339, reads[i].lastCompletion.Val()); err == nil {
+			s.LastCompletion = &t
+		}
+		if n, err := reads[i].retries.Int(); err == nil && n > 0 {
+			s.PendingRetries = n
+		}
+		var runs []JobRun
+		for _, raw := range reads[i].history.Val() {
+			var run JobRun
+			if err := json.Unmarshal([]byte(raw), &run); err != nil {
+				continue
+			}
+			runs = append(runs, run)
+			if run.Failed {
+				s.RecentFailures++
+			}
+		}
+		if len(runs) > 0 {
+			s.LastResult = &runs[0]
+		}
+		median, _ := medianJobDuration(runs)
+		s.MedianMs = median.Milliseconds()
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+type alertLoopStatus struct {
+	Running bool                   `json:"running"` // on this replica
+	Loops   []alertsvc.LoopLatency `json:"loops"`
+}
+
+// PoolStats is a connection pool's usage
+type PoolStats struct {
+	Total int64 `json:"total"`
+	InUse int64 `json:"inUse"`
+	Idle  int64 `json:"idle"`
+	Max   int64 `json:"max,omitempty"`
+	// Waits counts acquisitions that had to wait for a connection (Postgres)
+	// or timed out waiting for one (Redis)
+	Waits int64 `json:"waits"`
+}
+
+// DependencyHealth is the result of pinging a dependency, next to its circuit
+// breaker and connection pool
+type DependencyHealth struct {
+	Healthy   bool           `json:"healthy"`
+	LatencyMs float64        `json:"latencyMs"`
+	Error     string         `json:"error,omitempty"`
+	Breaker   breaker.Status `json:"breaker"`
+	Pool      PoolStats      `json:"pool"`
+}
+
+func postgresHealth(ctx context.Context, conn *data.Conn) DependencyHealth {
+	start := time.Now()
+	err := conn.DB.Ping(ctx)
+	h := DependencyHealth{
+		Healthy:   err == nil,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		Breaker:   breaker.Postgres.Status(),
+	}
+	if err != nil {
+		h.Error = err.Error()
+	}
+	stat := conn.DB.Stat()
+	h.Pool = PoolStats{
+		Total: int64(stat.TotalConns()),
+		InUse: int64(stat.AcquiredConns()),
+		Idle:  int64(stat.IdleConns()),
+		Max:   int64(stat.MaxConns()),
+		Waits: stat.EmptyAcquireCount(),
+	}
+	return h
+}
+
+func redisHealth(ctx context.Context, conn *data.Conn) DependencyHealth {
+	start := time.Now()
+	err := conn.Cache.Ping(ctx).Err()
+	h := DependencyHealth{
+		Healthy:   err == nil,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		Breaker:   breaker.Redis.Status(),
+	}
+	if err != nil {
+		h.Error = err.Error()
+	}
+	stat := conn.Cache.PoolStats()
+	h.Pool = PoolStats{
+		Total: int64(stat.TotalConns),
+		InUse: int64(stat.TotalConns - stat.IdleConns),
+		Idle:  int64(stat.IdleConns),
+		Max:   int64(conn.Cache.Options().PoolSize),
+		Waits: int64(stat.Timeouts),
+	}
+	return h
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/queue"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+)
+
+// adminQueueControlHandler pauses, drains and resumes the task queue:
+//
+//	GET  /admin/queue-control  state, queue lengths and in-flight tasks
+//	POST /admin/queue-control  {"state": "paused", "reason": "deploy"}; state is
+//	                           running, paused or draining
+func adminQueueControlHandler(conn *data.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+			if handleError(w, err, "admin queue control") {
+				return
+			}
+			var req struct {
+				State  string `json:"state"`
+				Reason string `json:"reason"`
+			}
+			if err := json.Unmarshal(body, &req); err != nil {
+				handleError(w, apperr.InvalidArgs(err), "admin queue control")
+				return
+			}
+			state, err := queue.SetControlState(ctx, conn, req.State, req.Reason)
+			if handleError(w, err, "admin queue control") {
+				return
+			}
+			log.Printf("⏯️ Task queue set to %s: %s", state.State, state.Reason)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		status, err := queue.GetControlStatus(ctx, conn)
+		if handleError(w, err, "admin queue control") {
+			return
+		}
+		writeAdminJSON(w, status)
+	}
+}
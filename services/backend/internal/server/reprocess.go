@@ -0,0 +1,327 @@
+package server
+
+import (
+	"backend/internal/app/helpers"
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/services/marketdata"
+	"backend/internal/services/screener"
+	"backend/internal/services/securities"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4"
+)
+
+// Reprocessing runs a single security through the data pipeline again:
+// reference details, daily bar gaps, chart aggregates, its screener row and
+// the caches built from them. Every step reports how it went and a failed
+// step doesn't stop the ones after it. The report is kept in Redis while it
+// runs so the admin API can follow a reprocess it started.
+const (
+	reprocessDefaultDays = 365
+	reprocessMaxDays     = 3650
+	// minute aggregates are refreshed over the last few days only
+	reprocessMinuteDays       = 5
+	reprocessBackfillPriority = 100
+	reprocessTimeout          = time.Hour
+	reprocessKeyPrefix        = "reprocess:"
+	reprocessTTL              = 24 * time.Hour
+)
+
+// Reprocess step and report statuses
+const (
+	ReprocessRunning = "running"
+	ReprocessOK      = "ok"
+	ReprocessSkipped = "skipped"
+	ReprocessFailed  = "failed"
+)
+
+// ReprocessStep is how one step of a reprocess went
+type ReprocessStep struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// ReprocessReport is one reprocess of a security, step by step
+type ReprocessReport struct {
+	Ticker     string          `json:"ticker"`
+	SecurityID int             `json:"securityId"`
+	Since      string          `json:"since"` // start of the window checked for gaps
+	Status     string          `json:"status"`
+	Steps      []ReprocessStep `json:"steps"`
+	StartedAt  time.Time       `json:"startedAt"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// reprocessStepFunc runs one step, returning its status and detail
+type reprocessStepFunc func(ctx context.Context, conn *data.Conn, r *ReprocessReport, since time.Time) (string, string, error)
+
+var reprocessSteps = []struct {
+	name string
+	run  reprocessStepFunc
+}{
+	{"details", reprocessDetails},
+	{"backfill", reprocessBackfill},
+	{"aggregates", reprocessAggregates},
+	{"screener", reprocessScreener},
+	{"caches", reprocessCaches},
+}
+
+// newReprocessReport resolves the listed security of ticker and starts its
+// report
+func newReprocessReport(ctx context.Context, conn *data.Conn, ticker string, days int) (*ReprocessReport, error) {
+	ticker = strings.ToUpper(strings.TrimSpace(ticker))
+	if ticker == "" {
+		return nil, apperr.Validation("ticker is required")
+	}
+	if days <= 0 {
+		days = reprocessDefaultDays
+	}
+	if days > reprocessMaxDays {
+		return nil, apperr.Validation("days must be at most %d", reprocessMaxDays)
+	}
+	r := &ReprocessReport{Ticker: ticker, Status: ReprocessRunning, StartedAt: time.Now()}
+	err := conn.DB.QueryRow(ctx, `
+		SELECT securityid FROM securities WHERE ticker = $1 AND maxdate IS NULL LIMIT 1`, ticker).Scan(&r.SecurityID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperr.NotFound("no listed security with ticker %s", ticker)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %v", ticker, err)
+	}
+	r.Since = r.StartedAt.AddDate(0, 0, -days).Format("2006-01-02")
+	return r, nil
+}
+
+// runReprocess runs every step of a reprocess, publishing the report after
+// each one and calling progress, when set, with the step that finished
+func runReprocess(ctx context.Context, conn *data.Conn, r *ReprocessReport, progress func(ReprocessStep)) {
+	since, _ := time.Parse("2006-01-02", r.Since)
+	publishReprocess(conn, r)
+	failed := 0
+	for _, step := range reprocessSteps {
+		start := time.Now()
+		status, detail, err := step.run(ctx, conn, r, since)
+		if err != nil {
+			status, detail = ReprocessFailed, err.Error()
+			failed++
+		}
+		s := ReprocessStep{Name: step.name, Status: status, Detail: detail, DurationMs: time.Since(start).Milliseconds()}
+		r.Steps = append(r.Steps, s)
+		publishReprocess(conn, r)
+		if progress != nil {
+			progress(s)
+		}
+	}
+	now := time.Now()
+	r.FinishedAt = &now
+	r.Status = ReprocessOK
+	if failed > 0 {
+		r.Status = ReprocessFailed
+	}
+	publishReprocess(conn, r)
+	log.Printf("🔁 Reprocessed %s: %s, %d of %d steps failed in %v", r.Ticker, r.Status, failed, len(reprocessSteps),
+		now.Sub(r.StartedAt).Round(time.Second))
+}
+
+func reprocessDetails(_ context.Context, conn *data.Conn, r *ReprocessReport, _ time.Time) (string, string, error) {
+	if err := securities.UpdateSecurityDetail(conn, r.SecurityID, r.Ticker); err != nil {
+		return "", "", err
+	}
+	return ReprocessOK, "reference details, logo and icon refetched", nil
+}
+
+// reprocessBackfill fetches every run of missing daily bars in the window
+// right away, then reports the days Polygon had nothing for
+func reprocessBackfill(ctx context.Context, conn *data.Conn, r *ReprocessReport, since time.Time) (string, string, error) {
+	gaps, err := marketdata.DailyGaps(ctx, conn, r.Ticker, since)
+	if err != nil {
+		return "", "", err
+	}
+	if len(gaps) == 0 {
+		return ReprocessSkipped, "no daily gaps since " + r.Since, nil
+	}
+	var done []string
+	for _, g := range gaps {
+		id, err := marketdata.EnqueueBackfill(ctx, conn, r.Ticker, "1d", g.From, g.To, reprocessBackfillPriority)
+		if err != nil {
+			return "", "", err
+		}
+		span := fmt.Sprintf("#%d %s → %s", id, g.From.Format("2006-01-02"), g.To.Format("2006-01-02"))
+		err = marketdata.RunBackfill(ctx, conn, id)
+		if errors.Is(err, marketdata.ErrBackfillNotQueued) {
+			// The backfill worker got to it first
+			span += " (running in the backfill worker)"
+		} else if err != nil {
+			return "", "", fmt.Errorf("backfilled %d of %d gaps, then %v", len(done), len(gaps), err)
+		}
+		done = append(done, span)
+	}
+	detail := fmt.Sprintf("%d gaps backfilled: %s", len(gaps), strings.Join(done, ", "))
+
+	left, err := marketdata.DailyGaps(ctx, conn, r.Ticker, since)
+	if err != nil {
+		return "", "", err
+	}
+	if missing := gapDays(left); missing > 0 {
+		detail += fmt.Sprintf("; %d trading days still have no bar", missing)
+	}
+	return ReprocessOK, detail, nil
+}
+
+func gapDays(gaps []marketdata.GapRange) int {
+	n := 0
+	for _, g := range gaps {
+		n += g.Days
+	}
+	return n
+}
+
+// reprocessAggregates refreshes the daily aggregates over the window and the
+// minute ones over the last few days
+func reprocessAggregates(ctx context.Context, conn *data.Conn, r *ReprocessReport, since time.Time) (string, string, error) {
+	now := time.Now()
+	daily, err := marketdata.RefreshChartAggregates(ctx, conn, "ohlcv_1d", r.Ticker, since, now)
+	if err != nil {
+		return "", "", err
+	}
+	minute, err := marketdata.RefreshChartAggregates(ctx, conn, "ohlcv_1m", r.Ticker, now.AddDate(0, 0, -reprocessMinuteDays), now)
+	if err != nil {
+		return "", "", err
+	}
+	refreshed := append(daily, minute...)
+	if len(refreshed) == 0 {
+		return ReprocessSkipped, "no bars in the window", nil
+	}
+	return ReprocessOK, "refreshed " + strings.Join(refreshed, ", "), nil
+}
+
+func reprocessScreener(ctx context.Context, conn *data.Conn, r *ReprocessReport, _ time.Time) (string, string, error) {
+	refreshed, err := screener.RefreshTicker(ctx, conn, r.Ticker)
+	if err != nil {
+		return "", "", err
+	}
+	if !refreshed {
+		return ReprocessSkipped, "a screener refresh in progress holds the row; the next cycle recomputes it", nil
+	}
+	return ReprocessOK, "screener row recomputed", nil
+}
+
+// reprocessCaches drops the cached snapshot and rebuilds the ticker search
+// index, which also drops the cached searches built from the old details
+func reprocessCaches(ctx context.Context, conn *data.Conn, r *ReprocessReport, _ time.Time) (string, string, error) {
+	if err := helpers.DropCachedSnapshot(ctx, conn, r.Ticker); err != nil {
+		return "", "", err
+	}
+	if err := helpers.RefreshTickerSearchIndex(conn); err != nil {
+		return "", "", err
+	}
+	return ReprocessOK, "snapshot dropped, ticker search index rebuilt", nil
+}
+
+func publishReprocess(conn *data.Conn, r *ReprocessReport) {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := conn.Cache.Set(ctx, reprocessKeyPrefix+r.Ticker, raw, reprocessTTL).Err(); err != nil {
+		log.Printf("⚠️ Publishing reprocess report of %s: %v", r.Ticker, err)
+	}
+}
+
+// lastReprocess returns the latest reprocess report of ticker, or nil
+func lastReprocess(ctx context.Context, conn *data.Conn, ticker string) (*ReprocessReport, error) {
+	raw, err := conn.Cache.Get(ctx, reprocessKeyPrefix+strings.ToUpper(strings.TrimSpace(ticker))).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading reprocess report: %v", err)
+	}
+	var r ReprocessReport
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return nil, fmt.Errorf("error decoding reprocess report: %v", err)
+	}
+	return &r, nil
+}
+
+// adminReprocessHandler reprocesses a single security:
+//
+//	POST /admin/reprocess  {"ticker", "days"}  starts reprocessing it in the
+//	                                           background and returns the report
+//	GET  /admin/reprocess?ticker=...           its latest report, step by step
+func adminReprocessHandler(conn *data.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		switch r.Method {
+		case http.MethodGet:
+			ticker := r.URL.Query().Get("ticker")
+			if ticker == "" {
+				handleError(w, apperr.Validation("ticker is required"), "admin reprocess")
+				return
+			}
+			report, err := lastReprocess(ctx, conn, ticker)
+			if err == nil && report == nil {
+				err = apperr.NotFound("no recent reprocess of %s", strings.ToUpper(ticker))
+			}
+			if handleError(w, err, "admin reprocess") {
+				return
+			}
+			writeAdminJSON(w, report)
+		case http.MethodPost:
+			body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+			if handleError(w, err, "admin reprocess") {
+				return
+			}
+			var args struct {
+				Ticker string `json:"ticker"`
+				Days   int    `json:"days"`
+			}
+			if err := json.Unmarshal(body, &args); err != nil {
+				handleError(w, apperr.InvalidArgs(err), "admin reprocess")
+				return
+			}
+			report, err := newReprocessReport(ctx, conn, args.Ticker, args.Days)
+			if handleError(w, err, "admin reprocess") {
+				return
+			}
+			last, err := lastReprocess(ctx, conn, report.Ticker)
+			if err == nil && last != nil && last.Status == ReprocessRunning && time.Since(last.StartedAt) < reprocessTimeout {
+				err = apperr.Validation("%s is already being reprocessed", report.Ticker)
+			}
+			if handleError(w, err, "admin reprocess") {
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			writeAdminJSON(w, report)
+
+			// The reprocess outlives the request; follow it with GET
+			go func() {
+				defer func() {
+					if rec := recover(); rec != nil {
+						log.Printf("❌ Reprocess of %s panicked: %v", report.Ticker, rec)
+					}
+				}()
+				runCtx, cancel := context.WithTimeout(context.Background(), reprocessTimeout)
+				defer cancel()
+				runReprocess(runCtx, conn, report, nil)
+			}()
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
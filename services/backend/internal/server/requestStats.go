@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Requests and their error responses are counted per minute over the last
+// hour, for the error rates on the admin overview. Counts are this replica's.
+const requestStatsMinutes = 60
+
+type requestMinute struct {
+	minute       int64 // unix minute the counts are for
+	requests     int64
+	clientErrors int64 // 4xx
+	serverErrors int64 // 5xx
+}
+
+var requestStats struct {
+	sync.Mutex
+	minutes [requestStatsMinutes]requestMinute
+}
+
+func recordRequest(at time.Time, status int) {
+	minute := at.Unix() / 60
+	requestStats.Lock()
+	defer requestStats.Unlock()
+	m := &requestStats.minutes[minute%requestStatsMinutes]
+	if m.minute != minute {
+		*m = requestMinute{minute: minute}
+	}
+	m.requests++
+	switch {
+	case status >= 500:
+		m.serverErrors++
+	case status >= 400:
+		m.clientErrors++
+	}
+}
+
+// ErrorRate is the share of requests that failed over a window
+type ErrorRate struct {
+	WindowMinutes   int     `json:"windowMinutes"`
+	Requests        int64   `json:"requests"`
+	ClientErrors    int64   `json:"clientErrors"`
+	ServerErrors    int64   `json:"serverErrors"`
+	ServerErrorRate float64 `json:"serverErrorRate"` // 0..1; 0 without requests
+}
+
+// recentErrorRates sums the counts over each window ending at now
+func recentErrorRates(now time.Time, windows ...int) []ErrorRate {
+	current := now.Unix() / 60
+	requestStats.Lock()
+	defer requestStats.Unlock()
+	rates := make([]ErrorRate, 0, len(windows))
+	for _, window := range windows {
+		r := ErrorRate{WindowMinutes: window}
+		for _, m := range requestStats.minutes {
+			if m.minute > current-int64(window) && m.minute <= current {
+				r.Requests += m.requests
+				r.ClientErrors += m.clientErrors
+				r.ServerErrors += m.serverErrors
+			}
+		}
+		if r.Requests > 0 {
+			r.ServerErrorRate = float64(r.ServerErrors) / float64(r.Requests)
+		}
+		rates = append(rates, r)
+	}
+	return rates
+}
+
+// statusRecorder keeps the status a handler responded with. It passes
+// flushes and hijacks through for the streaming and WebSocket handlers.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// withRequestStats counts every request and the status it was answered with
+func withRequestStats(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			recordRequest(start, status)
+		}()
+		h.ServeHTTP(rec, r)
+	})
+}
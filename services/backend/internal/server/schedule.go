@@ -1,9 +1,19 @@
 package server
 
 import (
+	"backend/internal/app/helpers"
+	"backend/internal/app/onboarding"
+	"backend/internal/app/reports"
+	"backend/internal/app/strategy"
+	"backend/internal/app/userdata"
+	"backend/internal/clock"
 	"backend/internal/data"
+	"backend/internal/queue"
 	"backend/internal/services/alerts"
+	"backend/internal/services/assets"
+	"backend/internal/services/chartimage"
 	"backend/internal/services/marketdata"
+	"backend/internal/services/marketstatus"
 	"backend/internal/services/screener"
 	"backend/internal/services/securities"
 	"backend/internal/services/socket"
@@ -16,6 +26,8 @@ import (
 	"strconv"
 	"sync"
 	"time"
+
+	"github.com/google/uuid"
 	//"github.com/go-redis/redis/v8"
 )
 
@@ -24,6 +36,10 @@ var useBS = false //alerts, securityUpdate, marketMetrics, sectorUpdate
 // JobFunc represents a function that can be executed as a job
 type JobFunc func(conn *data.Conn) error
 
+// JobContextFunc is a job that takes its run's context. Worker tasks queued
+// with that context are recorded under the run (see queue.WithJobRun).
+type JobContextFunc func(ctx context.Context, conn *data.Conn) error
+
 // TimeOfDay represents a specific time during the day (hour and minute)
 type TimeOfDay struct {
 	Hour   int
@@ -34,6 +50,7 @@ type TimeOfDay struct {
 type Job struct {
 	Name               string
 	Function           JobFunc
+	ContextFunction    JobContextFunc // Used instead of Function when set
 	Schedule           []TimeOfDay
 	LastRun            time.Time // This will be loaded from Redis but kept in memory for quick access
 	LastCompletionTime time.Time // Tracks when the job was verified to have completed successfully
@@ -41,9 +58,13 @@ type Job struct {
 	ExecutionMutex     sync.Mutex
 	IsRunning          bool
 	SkipOnWeekends     bool
+	SkipOnHolidays     bool          // Skip full market-closure days reported by the market status service
 	RetryOnFailure     bool          // Whether to retry the job on failure
 	MaxRetries         int           // Maximum number of retry attempts
 	RetryDelay         time.Duration // Delay between retry attempts
+	// Resources are the shared resources the job leans on; jobs using the
+	// same class are staggered (see resourceSlots)
+	Resources []ResourceClass
 }
 
 // JobScheduler manages and executes jobs
@@ -51,9 +72,11 @@ type JobScheduler struct {
 	Jobs      []*Job
 	Conn      *data.Conn
 	Location  *time.Location
+	Clock     clock.Clock // when the scheduler checks, runs and retries jobs
 	StopChan  chan struct{}
 	IsRunning bool
 	mutex     sync.Mutex
+	budget    *resourceBudget
 }
 
 // Redis key prefix for job last run times
@@ -207,10 +230,55 @@ func updateShortDataJob(conn *data.Conn) error {
 	return marketdata.UpdateShortData(conn)
 }
 
+// Wrapper for the OHLCV data-quality checks; new findings raise an internal alert
+func dataQualityJob(conn *data.Conn) error {
+	summary, err := marketdata.RunDataQualityChecks(conn)
+	if err != nil {
+		return err
+	}
+	if len(summary.New) == 0 {
+		return nil
+	}
+	if err := alerts.LogCriticalAlert(fmt.Errorf("%s", summary.AlertText()), "DataQualityChecks"); err != nil {
+		log.Printf("⚠️ Failed to send data quality alert: %v", err)
+	}
+	return nil
+}
+
+// Wrapper for the security master reconciliation; the cached ticker details
+// it may have changed are dropped, and discrepancies left for review raise an
+// internal alert
+func securityReconciliationJob(conn *data.Conn) error {
+	summary, err := securities.RunSecurityReconciliation(conn, securities.ReconcileOptions{})
+	if err != nil {
+		return err
+	}
+	dropReconciledTickerDetails(conn, summary)
+	if len(summary.Discrepancies) == 0 {
+		return nil
+	}
+	if err := alerts.LogCriticalAlert(fmt.Errorf("%s", summary.AlertText()), "SecurityReconciliation"); err != nil {
+		log.Printf("⚠️ Failed to send security reconciliation alert: %v", err)
+	}
+	return nil
+}
+
+// dropReconciledTickerDetails drops the cached ticker details once a
+// reconciliation has changed securities
+func dropReconciledTickerDetails(conn *data.Conn, summary *securities.ReconcileSummary) {
+	if len(summary.Applied) == 0 {
+		return
+	}
+	if dropped, err := helpers.DropTickerDetailsCache(conn); err != nil {
+		log.Printf("⚠️ Failed to drop cached ticker details after reconciliation: %v", err)
+	} else {
+		log.Printf("🧹 Dropped %d cached ticker details after reconciliation", dropped)
+	}
+}
+
 // Wrapper for alert loop start with market-hours gating
 func startAlertLoopJob(conn *data.Conn) error {
-	now := time.Now().In(time.FixedZone("ET", -5*3600))
-	if !isMarketHours(now) {
+	if !inServiceHours(conn, time.Now()) {
 		log.Printf("⏰ Alert loop not started - outside market hours")
 		return nil
 	}
@@ -220,8 +288,7 @@ func startAlertLoopJob(conn *data.Conn) error {
 // startPolygonWebSocketInternal is the internal implementation for starting polygon websocket
 func startPolygonWebSocketInternal(conn *data.Conn) error {
 	// Gate: Only start Polygon WebSocket during market hours
-	now := time.Now().In(time.FixedZone("ET", -5*3600))
-	if !isMarketHours(now) {
+	if !inServiceHours(conn, time.Now()) {
 		log.Printf("⏰ Skipping Polygon WebSocket start - outside market hours")
 		return nil
 	}
@@ -252,6 +319,7 @@ var (
 		{
 			Name:           "UpdateSecurityTables",
 			Function:       simpleSecuritiesUpdateJob,
+			Resources:      []ResourceClass{ResourcePolygon},
 			Schedule:       []TimeOfDay{{Hour: 21, Minute: 45}}, // Run at 9:45 PM - update ecurities table with currently listed tickers
 			RunOnInit:      true,
 			SkipOnWeekends: true,
@@ -262,6 +330,7 @@ var (
 		{ // enable this before PR
 			Name:           "UpdateAllOHLCV",
 			Function:       marketdata.UpdateAllOHLCV,
+			Resources:      []ResourceClass{ResourcePolygon, ResourceDB},
 			Schedule:       []TimeOfDay{{Hour: 21, Minute: 45}}, // Run at 9:45 PM - consolidates all OHLCV updates
 			RunOnInit:      true,
 			SkipOnWeekends: true,
@@ -285,6 +354,7 @@ var (
 			Schedule:       []TimeOfDay{{Hour: 3, Minute: 45}}, // Run before market open
 			RunOnInit:      true,
 			SkipOnWeekends: true,
+			SkipOnHolidays: true,
 			RetryOnFailure: true,
 			MaxRetries:     100,             // Retry until partial coverage is achieved
 			RetryDelay:     5 * time.Minute, // Retry every 5 minutes
@@ -295,6 +365,7 @@ var (
 			Schedule:       []TimeOfDay{{Hour: 3, Minute: 57}}, // Run before market open
 			RunOnInit:      true,
 			SkipOnWeekends: true,
+			SkipOnHolidays: true,
 		},
 		{
 			Name:           "StartMarketHourServices",
@@ -302,13 +373,26 @@ var (
 			Schedule:       []TimeOfDay{{Hour: 3, Minute: 59}}, // Run before market open
 			RunOnInit:      true,
 			SkipOnWeekends: true,
+			SkipOnHolidays: true,
 			RetryOnFailure: true,
 			MaxRetries:     100,             // Retry until partial coverage is achieved
 			RetryDelay:     5 * time.Minute, // Retry every 5 minutes
 		},
+		{
+			Name:           "RefreshTickerSearchIndex",
+			Function:       helpers.RefreshTickerSearchIndex,
+			Resources:      []ResourceClass{ResourceDB},
+			Schedule:       []TimeOfDay{{Hour: 22, Minute: 30}, {Hour: 9, Minute: 0}}, // after the securities update and before the open
+			RunOnInit:      true,
+			SkipOnWeekends: true,
+			RetryOnFailure: true,
+			MaxRetries:     2,
+			RetryDelay:     5 * time.Minute,
+		},
 		{
 			Name:           "UpdateSecurityDetails",
 			Function:       securityDetailUpdateJob,
+			Resources:      []ResourceClass{ResourcePolygon},
 			Schedule:       []TimeOfDay{{Hour: 21, Minute: 0}}, // Run at 9:00 PM
 			RunOnInit:      true,
 			SkipOnWeekends: true,
@@ -316,10 +400,90 @@ var (
 			MaxRetries:     2,
 			RetryDelay:     1 * time.Minute,
 		},
+		{
+			Name:           "MigrateSecurityImages",
+			Function:       assets.MigrateSecurityImages,
+			Schedule:       []TimeOfDay{{Hour: 3, Minute: 30}}, // 3:30 AM ET, moves legacy base64 logos into assets
+			RunOnInit:      true,
+			SkipOnWeekends: false,
+			RetryOnFailure: false,
+		},
+		{
+			Name:           "SnapshotScreener",
+			Function:       screener.TakeScreenerSnapshot,
+			Resources:      []ResourceClass{ResourceDB},
+			Schedule:       []TimeOfDay{{Hour: 16, Minute: 30}}, // 4:30 PM ET, after the close settles
+			RunOnInit:      false,
+			SkipOnWeekends: true,
+			SkipOnHolidays: true,
+			RetryOnFailure: true,
+			MaxRetries:     3,
+			RetryDelay:     5 * time.Minute,
+		},
+		{
+			Name:           "AnalyzeAlertThresholds",
+			Function:       alerts.AnalyzeStrategyAlertThresholds,
+			Resources:      []ResourceClass{ResourceDB},
+			Schedule:       []TimeOfDay{{Hour: 18, Minute: 0}}, // 6:00 PM ET, after daily bars are in
+			RunOnInit:      false,
+			SkipOnWeekends: true,
+			SkipOnHolidays: true,
+			RetryOnFailure: true,
+			MaxRetries:     2,
+			RetryDelay:     10 * time.Minute,
+		},
+		{
+			Name:           "TagStrategies",
+			Function:       strategy.TagStrategies,
+			Resources:      []ResourceClass{ResourceDB},
+			Schedule:       []TimeOfDay{{Hour: 2, Minute: 45}}, // 2:45 AM ET, tags strategies the rules haven't seen
+			RunOnInit:      true,                               // applies new tagging rules on deploy
+			SkipOnWeekends: false,
+			RetryOnFailure: true,
+			MaxRetries:     2,
+			RetryDelay:     10 * time.Minute,
+		},
+		{
+			Name:           "StartBackfillWorker",
+			Function:       marketdata.StartBackfillWorker, // idempotent, works the ohlcv_backfills queue
+			Schedule:       []TimeOfDay{{Hour: 0, Minute: 5}},
+			RunOnInit:      true,
+			SkipOnWeekends: false,
+		},
+		{
+			Name:           "StartOnboardingWorker",
+			Function:       onboarding.StartWorker, // idempotent, works the user_onboarding queue
+			Schedule:       []TimeOfDay{{Hour: 0, Minute: 5}},
+			RunOnInit:      true,
+			SkipOnWeekends: false,
+		},
+		{
+			Name:           "DataQualityChecks",
+			Function:       dataQualityJob,
+			Resources:      []ResourceClass{ResourceDB},
+			Schedule:       []TimeOfDay{{Hour: 23, Minute: 30}}, // 11:30 PM ET, after the nightly OHLCV update
+			RunOnInit:      false,
+			SkipOnWeekends: true,
+			SkipOnHolidays: true,
+			RetryOnFailure: true,
+			MaxRetries:     2,
+			RetryDelay:     15 * time.Minute,
+		},
+		{
+			Name:           "EnsureChartAggregates",
+			Function:       marketdata.EnsureChartAggregates, // idempotent, creates missing aggregates and policies
+			Resources:      []ResourceClass{ResourceDB},
+			Schedule:       []TimeOfDay{{Hour: 3, Minute: 30}},
+			RunOnInit:      true,
+			SkipOnWeekends: false,
+			RetryOnFailure: true,
+			MaxRetries:     3,
+			RetryDelay:     10 * time.Minute,
+		},
 		{
 			Name:           "StopMarketHourServices",
 			Function:       stopServicesJob,
-			Schedule:       []TimeOfDay{{Hour: 20, Minute: 0}}, // Stop services at 8:00 PM
+			Schedule:       []TimeOfDay{{Hour: 17, Minute: 0}, {Hour: 20, Minute: 0}}, // 5:00 PM after an early close, 8:00 PM otherwise
 			RunOnInit:      false,
 			SkipOnWeekends: true,
 			RetryOnFailure: false, // Don't retry stop services
@@ -334,6 +498,27 @@ var (
 			MaxRetries:     2,
 			RetryDelay:     1 * time.Minute,
 		},
+		{
+			Name:           "UpdateIndexConstituents",
+			Function:       securities.UpdateIndexConstituents,
+			Schedule:       []TimeOfDay{{Hour: 20, Minute: 30}}, // 8:30 PM ET, after index providers publish changes
+			RunOnInit:      true,
+			SkipOnWeekends: true,
+			RetryOnFailure: true,
+			MaxRetries:     3,
+			RetryDelay:     30 * time.Minute,
+		},
+		{
+			Name:           "SecurityReconciliation",
+			Function:       securityReconciliationJob,
+			Resources:      []ResourceClass{ResourcePolygon, ResourceDB},
+			Schedule:       []TimeOfDay{{Hour: 22, Minute: 0}}, // 10 PM ET, after the evening securities update
+			RunOnInit:      false,
+			SkipOnWeekends: true,
+			RetryOnFailure: true,
+			MaxRetries:     1,
+			RetryDelay:     30 * time.Minute,
+		},
 		{
 			Name:           "UpdateSecurityCik",
 			Function:       securityCikUpdateJob,
@@ -396,6 +581,7 @@ var (
 		{
 			Name:           "UpdateFundamentals",
 			Function:       marketdata.UpdateAllFundamentals,
+			Resources:      []ResourceClass{ResourcePolygon, ResourceDB},
 			Schedule:       []TimeOfDay{{Hour: 22, Minute: 30}}, // 10:30 PM ET nightly
 			RunOnInit:      true,
 			SkipOnWeekends: false,
@@ -406,6 +592,7 @@ var (
 		{
 			Name:           "UpdateShortData",
 			Function:       updateShortDataJob,
+			Resources:      []ResourceClass{ResourcePolygon, ResourceDB},
 			Schedule:       []TimeOfDay{{Hour: 22, Minute: 45}}, // 10:45 PM ET nightly
 			RunOnInit:      true,
 			SkipOnWeekends: false,
@@ -413,6 +600,47 @@ var (
 			MaxRetries:     100,
 			RetryDelay:     5 * time.Minute,
 		},
+		{
+			Name:           "SendScheduledReports",
+			Function:       reports.SendScheduledReports,
+			Schedule:       []TimeOfDay{{Hour: 18, Minute: 30}}, // 6:30 PM ET, after daily bars and alert analysis
+			RunOnInit:      false,
+			SkipOnWeekends: false, // reports can be scheduled for any day
+			RetryOnFailure: true,
+			MaxRetries:     2,
+			RetryDelay:     15 * time.Minute,
+		},
+		{
+			Name:           "RollupAlertMetrics",
+			Function:       alerts.RollupAlertMetrics,
+			Resources:      []ResourceClass{ResourceDB},
+			Schedule:       []TimeOfDay{{Hour: 20, Minute: 30}}, // 8:30 PM ET, after midnight UTC closes the day
+			RunOnInit:      true,                                // idempotent, recomputes days still held hourly
+			SkipOnWeekends: false,
+			RetryOnFailure: true,
+			MaxRetries:     3,
+			RetryDelay:     10 * time.Minute,
+		},
+		{
+			Name:           "ExpireDataExports",
+			Function:       userdata.ExpireDataExports,
+			Schedule:       []TimeOfDay{{Hour: 3, Minute: 30}}, // Daily at 3:30 AM ET
+			RunOnInit:      true,
+			SkipOnWeekends: false,
+			RetryOnFailure: true,
+			MaxRetries:     2,
+			RetryDelay:     5 * time.Minute,
+		},
+		{
+			Name:           "PruneChartImages",
+			Function:       chartimage.PruneChartImages,
+			Schedule:       []TimeOfDay{{Hour: 3, Minute: 45}}, // Daily at 3:45 AM ET
+			RunOnInit:      false,
+			SkipOnWeekends: false,
+			RetryOnFailure: true,
+			MaxRetries:     2,
+			RetryDelay:     5 * time.Minute,
+		},
 	}
 )
 
@@ -422,16 +650,10 @@ func isWeekend(now time.Time) bool {
 	return weekday == time.Saturday || weekday == time.Sunday
 }
 
-// isMarketHours checks if the given time is within market service hours (3:00 AM - 8:00 PM ET, weekdays)
-func isMarketHours(now time.Time) bool {
-	// Skip weekends
-	if isWeekend(now) {
-		return false
-	}
-
-	hour := now.Hour()
-	// Market service hours: 4:00 AM to 8:00 PM ET with 1 minute buffer
-	return (hour >= 4 || (hour == 3 && now.Minute() >= 59)) && hour < 20
+// inServiceHours checks if the given time is within market service hours on a
+// trading day, with a 1 minute buffer so the 3:59 AM start jobs pass
+func inServiceHours(conn *data.Conn, now time.Time) bool {
+	return marketstatus.InServiceHours(conn, now) || marketstatus.InServiceHours(conn, now.Add(time.Minute))
 }
 
 // NewScheduler creates a new job scheduler
@@ -447,7 +669,9 @@ func NewScheduler(conn *data.Conn) (*JobScheduler, error) {
 		Jobs:     JobList,
 		Conn:     conn,
 		Location: loc,
+		Clock:    clock.Default(),
 		StopChan: make(chan struct{}),
+		budget:   newResourceBudget(),
 	}
 
 	// Load job last run times from Redis
@@ -530,13 +754,16 @@ func (s *JobScheduler) Start() chan struct{} {
 	// Reload job last run times from Redis
 	s.loadJobLastRunTimes()
 
+	// Backfills pause while the nightly Polygon jobs have the rate limit
+	marketdata.SetBackfillYield(func() bool { return s.budget.busy(ResourcePolygon) })
+
 	// Add 10-minute delay before starting scheduler operations
 	log.Printf("⏰ Scheduler initialized - 5 seconds before starting job execution...")
 
 	go func() {
 		// Wait 5 seconds before starting scheduler operations
 		select {
-		case <-time.After(5 * time.Second):
+		case <-s.Clock.After(5 * time.Second):
 			log.Printf("🚀 Starting scheduler operations after 5-second delay")
 		case <-s.StopChan:
 			log.Printf("⏹️ Scheduler stopped during startup delay")
@@ -551,19 +778,20 @@ func (s *JobScheduler) Start() chan struct{} {
 		go func() {
 			for filing := range marketdata.NewFilingsChannel {
 				socket.BroadcastGlobalSECFiling(filing)
+				socket.BroadcastSecurityFiling(filing)
 			}
 		}()
 
 		// Start the ticker for regular job execution
-		ticker := time.NewTicker(1 * time.Minute)
+		ticker := s.Clock.NewTicker(1 * time.Minute)
 
 		// Create a separate ticker for queue status updates (every 5 minutes)
-		queueStatusTicker := time.NewTicker(5 * time.Minute)
+		queueStatusTicker := s.Clock.NewTicker(5 * time.Minute)
 
 		for {
 			select {
 			case <-ticker.C:
-				now := time.Now().In(s.Location)
+				now := s.Clock.Now().In(s.Location)
 				s.checkAndRunJobs(now)
 			case <-s.StopChan:
 				ticker.Stop()
@@ -584,17 +812,28 @@ func (s *JobScheduler) Start() chan struct{} {
 func (s *JobScheduler) runInitJobs() {
 	for _, job := range s.Jobs {
 		if job.RunOnInit {
-			go s.executeJob(job, time.Now().In(s.Location))
+			go s.executeJob(job, s.Clock.Now().In(s.Location))
 		}
 	}
 }
 
 // checkAndRunJobs examines all jobs and runs those that are scheduled for the current time
 func (s *JobScheduler) checkAndRunJobs(now time.Time) {
+	// Resolved lazily so the holiday calendar is only consulted when a job needs it
+	var holiday *bool
 	for _, job := range s.Jobs {
 		if job.SkipOnWeekends && isWeekend(now) {
 			continue
 		}
+		if job.SkipOnHolidays {
+			if holiday == nil {
+				isHoliday := marketstatus.IsHoliday(s.Conn, now)
+				holiday = &isHoliday
+			}
+			if *holiday {
+				continue
+			}
+		}
 
 		// Check if the job should run at this time
 		shouldRun := s.shouldRunJob(job, now)
@@ -708,6 +947,14 @@ func (s *JobScheduler) getNextScheduledTime(job *Job, now time.Time) *TimeOfDay
 	}
 }
 
+// run executes the job's function
+func (job *Job) run(ctx context.Context, conn *data.Conn) error {
+	if job.ContextFunction != nil {
+		return job.ContextFunction(ctx, conn)
+	}
+	return job.Function(conn)
+}
+
 // executeJob runs a job and updates its last run time
 func (s *JobScheduler) executeJob(job *Job, now time.Time) {
 	// Prevent concurrent execution of the same job
@@ -733,7 +980,17 @@ func (s *JobScheduler) executeJob(job *Job, now time.Time) {
 
 	// Job execution variables
 	jobName := job.Name
-	startTime := time.Now()
+
+	// Wait for the job's resources; the wait isn't counted in its duration
+	wait, ok := s.acquire(job)
+	if !ok {
+		job.ExecutionMutex.Lock()
+		job.IsRunning = false
+		job.ExecutionMutex.Unlock()
+		log.Printf("⏹️ Scheduler stopped while job %s waited for its resources", jobName)
+		return
+	}
+	startTime := s.Clock.Now()
 
 	// Recover from panics to avoid scheduler crash
 	defer func() {
@@ -745,6 +1002,7 @@ func (s *JobScheduler) executeJob(job *Job, now time.Time) {
 			default:
 				err = fmt.Errorf("panic: %v", x)
 			}
+			s.release(job)
 			_ = alerts.LogCriticalAlert(err, jobName)
 			log.Printf("❌ Job %s panicked: %v", jobName, err)
 		}
@@ -753,11 +1011,15 @@ func (s *JobScheduler) executeJob(job *Job, now time.Time) {
 	// Log job start
 	log.Printf("🚀 Starting job: %s at %s", jobName, startTime.Format("2006-01-02 15:04:05"))
 
-	// Execute job with retry logic
-	err := s.executeJobWithRetry(job, startTime)
+	// Execute job with retry logic, under a run ID the tasks it queues are
+	// recorded against
+	runID := uuid.New().String()
+	ctx := queue.WithJobRun(context.Background(), jobName, runID)
+	err := s.executeJobWithRetry(ctx, job, startTime)
+	s.release(job)
 
 	// Calculate execution duration
-	duration := time.Since(startTime).Round(time.Millisecond)
+	duration := s.Clock.Since(startTime).Round(time.Millisecond)
 
 	// Update job status
 	job.ExecutionMutex.Lock()
@@ -768,6 +1030,7 @@ func (s *JobScheduler) executeJob(job *Job, now time.Time) {
 	if err := s.saveJobLastRunTime(job); err != nil {
 		log.Printf("❌ Error saving job last run time for %s: %v", job.Name, err)
 	}
+	s.recordJobRun(job, runID, startTime, wait, duration, err)
 
 	// Handle completion logging based on execution result
 	if err != nil {
@@ -787,7 +1050,7 @@ func (s *JobScheduler) executeJob(job *Job, now time.Time) {
 	}
 
 	// Update completion time
-	completionTime := time.Now()
+	completionTime := s.Clock.Now()
 	job.ExecutionMutex.Lock()
 	job.LastCompletionTime = completionTime
 	job.ExecutionMutex.Unlock()
@@ -797,12 +1060,12 @@ func (s *JobScheduler) executeJob(job *Job, now time.Time) {
 }
 
 // executeJobWithRetry executes a job with retry logic if configured
-func (s *JobScheduler) executeJobWithRetry(job *Job, startTime time.Time) error {
+func (s *JobScheduler) executeJobWithRetry(ctx context.Context, job *Job, startTime time.Time) error {
 	jobName := job.Name
 	currentRetryCount := s.loadJobRetryCount(job)
 
 	// Execute the job
-	err := job.Function(s.Conn)
+	err := job.run(ctx, s.Conn)
 
 	// If job succeeded or retry is not enabled, return immediately
 	if err == nil || !job.RetryOnFailure {
@@ -830,7 +1093,7 @@ func (s *JobScheduler) executeJobWithRetry(job *Job, startTime time.Time) error
 	// Schedule retry after delay
 	go func() {
 		select {
-		case <-time.After(job.RetryDelay):
+		case <-s.Clock.After(job.RetryDelay):
 			// Check if scheduler is still running
 			s.mutex.Lock()
 			if !s.IsRunning {
@@ -840,9 +1103,14 @@ func (s *JobScheduler) executeJobWithRetry(job *Job, startTime time.Time) error
 			}
 			s.mutex.Unlock()
 
-			// Execute retry
+			// Execute retry, taking the job's resources again
+			if _, ok := s.acquire(job); !ok {
+				log.Printf("⚠️ Scheduler stopped, cancelling retry for job %s", jobName)
+				return
+			}
 			log.Printf("🔄 Retrying job %s (attempt %d/%d)", jobName, currentRetryCount, job.MaxRetries)
-			retryErr := s.executeJobWithRetry(job, startTime)
+			retryErr := s.executeJobWithRetry(ctx, job, startTime)
+			s.release(job)
 			if retryErr != nil {
 				log.Printf("❌ Job %s retry failed (attempt %d/%d): %v", jobName, currentRetryCount, job.MaxRetries, retryErr)
 			}
@@ -870,9 +1138,8 @@ func initAggregates(conn *data.Conn) error {
 // startMarketHourServices starts alert loop, screener updater, and polygon websocket during market hours
 // First checks if current time is within market hours, then checks OHLCV coverage before starting services
 func startMarketHourServices(conn *data.Conn) error {
-	now := time.Now().In(time.FixedZone("ET", -5*3600)) // Convert to ET for market hours check
-	if !isMarketHours(now) {
-		log.Printf("⏰ Market hour services not started - outside market hours (3:00 AM - 8:00 PM ET, weekdays)")
+	if !inServiceHours(conn, time.Now()) {
+		log.Printf("⏰ Market hour services not started - outside market hours (4:00 AM - 8:00 PM ET on trading days)")
 		return nil // Return nil to indicate this is expected behavior, not an error
 	}
 
@@ -947,7 +1214,12 @@ func startMarketHourServices(conn *data.Conn) error {
 }
 
 // stopServicesJob stops alert loop, polygon websocket, and screener updater as a scheduled job
-func stopServicesJob(_ *data.Conn) error {
+// once the day's service hours are over, which is earlier on early-close days
+func stopServicesJob(conn *data.Conn) error {
+	if inServiceHours(conn, time.Now()) {
+		log.Printf("⏰ Market hour services left running - service hours not over yet")
+		return nil
+	}
 	alerts.StopAlertLoop()
 	_ = socket.StopPolygonWS()
 	_ = screener.StopScreenerUpdaterLoop()
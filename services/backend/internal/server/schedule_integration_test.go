@@ -0,0 +1,135 @@
+package server
+
+import (
+	"backend/internal/data"
+	"backend/internal/testharness"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestScheduler runs jobs on env's Redis and fake clock
+func newTestScheduler(t *testing.T, env *testharness.Env, jobs ...*Job) *JobScheduler {
+	t.Helper()
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("loading timezone: %v", err)
+	}
+	s := &JobScheduler{
+		Jobs:      jobs,
+		Conn:      env.Conn,
+		Location:  loc,
+		Clock:     env.Clock,
+		StopChan:  make(chan struct{}),
+		IsRunning: true,
+		budget:    newResourceBudget(),
+	}
+	t.Cleanup(func() { close(s.StopChan) })
+	return s
+}
+
+// waitFor polls until done holds
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// idle reports whether the job has finished running
+func idle(job *Job) func() bool {
+	return func() bool {
+		job.ExecutionMutex.Lock()
+		defer job.ExecutionMutex.Unlock()
+		return !job.IsRunning && !job.LastRun.IsZero()
+	}
+}
+
+func TestScheduledJobRunsOncePerSlot(t *testing.T) {
+	start := time.Date(2025, 3, 3, 14, 30, 0, 0, time.UTC) // 9:30 ET
+	env := testharness.New(t, testharness.WithFakeClock(start))
+	var runs int32
+	job := &Job{
+		Name:     "TestOpen",
+		Function: func(*data.Conn) error { atomic.AddInt32(&runs, 1); return nil },
+		Schedule: []TimeOfDay{{Hour: 9, Minute: 30}},
+	}
+	s := newTestScheduler(t, env, job)
+
+	s.checkAndRunJobs(env.Clock.Now().In(s.Location))
+	waitFor(t, "the job to finish", idle(job))
+	env.Clock.Advance(time.Minute)
+	s.checkAndRunJobs(env.Clock.Now().In(s.Location))
+	time.Sleep(50 * time.Millisecond)
+
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Fatalf("job ran %d times, want 1", n)
+	}
+	ctx := context.Background()
+	for _, key := range []string{getJobLastRunKey(job.Name), getJobLastCompletionKey(job.Name)} {
+		if v, err := env.Conn.Cache.Get(ctx, key).Result(); err != nil || v == "" {
+			t.Fatalf("%s not saved: %q, %v", key, v, err)
+		}
+	}
+}
+
+func TestMissedJobCatchesUpNextDay(t *testing.T) {
+	start := time.Date(2025, 3, 4, 15, 0, 0, 0, time.UTC) // 10:00 ET, past the 9:30 slot
+	env := testharness.New(t, testharness.WithFakeClock(start))
+	var runs int32
+	job := &Job{
+		Name:               "TestCatchUp",
+		Function:           func(*data.Conn) error { atomic.AddInt32(&runs, 1); return nil },
+		Schedule:           []TimeOfDay{{Hour: 9, Minute: 30}},
+		LastCompletionTime: start.Add(-24 * time.Hour),
+	}
+	s := newTestScheduler(t, env, job)
+
+	s.checkAndRunJobs(env.Clock.Now().In(s.Location))
+	waitFor(t, "the missed run", idle(job))
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Fatalf("job ran %d times, want 1", n)
+	}
+}
+
+func TestFailedJobRetriesAfterDelay(t *testing.T) {
+	start := time.Date(2025, 3, 3, 14, 30, 0, 0, time.UTC)
+	env := testharness.New(t, testharness.WithFakeClock(start))
+	var runs int32
+	job := &Job{
+		Name: "TestRetry",
+		Function: func(*data.Conn) error {
+			if atomic.AddInt32(&runs, 1) == 1 {
+				return errors.New("upstream unavailable")
+			}
+			return nil
+		},
+		Schedule:       []TimeOfDay{{Hour: 9, Minute: 30}},
+		RetryOnFailure: true,
+		MaxRetries:     2,
+		RetryDelay:     5 * time.Minute,
+	}
+	s := newTestScheduler(t, env, job)
+
+	s.checkAndRunJobs(env.Clock.Now().In(s.Location))
+	waitFor(t, "the first attempt", idle(job))
+	if got := s.loadJobRetryCount(job); got != 1 {
+		t.Fatalf("retry count %d after a failure, want 1", got)
+	}
+
+	// The retry waits on the clock, not on the next scheduler tick
+	env.Clock.BlockUntil(1)
+	env.Clock.Advance(4 * time.Minute)
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Fatalf("retried before the delay: %d runs", n)
+	}
+	env.Clock.Advance(time.Minute)
+	waitFor(t, "the retry", func() bool { return atomic.LoadInt32(&runs) == 2 })
+}
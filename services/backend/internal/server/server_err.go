@@ -1,6 +1,7 @@
 package server
 
 import (
+	"backend/internal/apperr"
 	"backend/internal/services/alerts"
 	"errors"
 	"fmt"
@@ -29,43 +30,63 @@ var (
 type appErrorInfo struct {
 	statusCode int
 	publicMsg  string
+	code       apperr.Code // empty for auth errors, which sit outside the taxonomy
 }
 
 // Mapping table from sentinel to HTTP metadata.
 var appErrorTable = map[error]appErrorInfo{
-	ErrInvalidInput:       {http.StatusBadRequest, "Invalid input"},
-	ErrUnauthorized:       {http.StatusUnauthorized, "Unauthorized"},
-	ErrNotFound:           {http.StatusNotFound, "Not found"},
-	ErrConflict:           {http.StatusConflict, "Conflict"},
-	ErrEmailExists:        {http.StatusBadRequest, "Email already registered"},
-	ErrIncorrectEmail:     {http.StatusUnauthorized, "Incorrect email"},
-	ErrIncorrectPassword:  {http.StatusUnauthorized, "Incorrect password"},
-	ErrGoogleAuthRequired: {http.StatusUnauthorized, "This account uses Google Sign-In. Please login with Google."},
-	ErrInvalidCredentials: {http.StatusUnauthorized, "Invalid credentials"},
-	ErrInsufficientFunds:  {http.StatusPaymentRequired, "Insufficient credits or funds"},
-	ErrUsageExceeded:      {http.StatusTooManyRequests, "Usage limit exceeded"},
+	ErrInvalidInput:       {http.StatusBadRequest, "Invalid input", apperr.CodeValidation},
+	ErrUnauthorized:       {http.StatusUnauthorized, "Unauthorized", ""},
+	ErrNotFound:           {http.StatusNotFound, "Not found", apperr.CodeNotFound},
+	ErrConflict:           {http.StatusConflict, "Conflict", apperr.CodeValidation},
+	ErrEmailExists:        {http.StatusBadRequest, "Email already registered", apperr.CodeValidation},
+	ErrIncorrectEmail:     {http.StatusUnauthorized, "Incorrect email", ""},
+	ErrIncorrectPassword:  {http.StatusUnauthorized, "Incorrect password", ""},
+	ErrGoogleAuthRequired: {http.StatusUnauthorized, "This account uses Google Sign-In. Please login with Google.", ""},
+	ErrInvalidCredentials: {http.StatusUnauthorized, "Invalid credentials", ""},
+	ErrInsufficientFunds:  {http.StatusPaymentRequired, "Insufficient credits or funds", apperr.CodeLimitExceeded},
+	ErrUsageExceeded:      {http.StatusTooManyRequests, "Usage limit exceeded", apperr.CodeLimitExceeded},
 }
 
-// resolveAppError converts an error (possibly wrapped) to an HTTP status code
-// and a public-facing message. If the error does not match any sentinel, a
-// generic 500 response is returned.
-func resolveAppError(err error) (int, string) {
+// errorCodeHeader carries the apperr code of a failed request, so clients can
+// branch on it while the body stays a plain message
+const errorCodeHeader = "X-Error-Code"
+
+// resolveAppError converts an error (possibly wrapped) to an HTTP status code,
+// a public-facing message and an error code. Coded apperr errors map through
+// the taxonomy; if the error matches nothing, a generic 500 is returned.
+func resolveAppError(err error) (int, string, apperr.Code) {
+	if e, ok := apperr.As(err); ok {
+		return apperr.HTTPStatus(e.Code), apperr.Message(err), e.Code
+	}
 	// Handle database connection errors gracefully with clean message
 	if strings.Contains(err.Error(), "connection refused") || strings.Contains(err.Error(), "connection is closed") {
-		return http.StatusServiceUnavailable, "Database connection error. Please try again later."
+		return http.StatusServiceUnavailable, "Database connection error. Please try again later.", apperr.CodeInternal
 	}
 	if strings.Contains(err.Error(), "email not verified") {
-		return http.StatusForbidden, "Email address not verified"
+		return http.StatusForbidden, "Email address not verified", ""
 	}
 	for sentinel, info := range appErrorTable {
 		if errors.Is(err, sentinel) {
-			return info.statusCode, info.publicMsg
+			return info.statusCode, info.publicMsg, info.code
 		}
 	}
+	if apperr.CodeOf(err) == apperr.CodeUpstreamTimeout {
+		return http.StatusGatewayTimeout, apperr.Message(err), apperr.CodeUpstreamTimeout
+	}
 
 	// Log critical alert for unexpected errors that don't match any known patterns
 	genericErr := fmt.Errorf("error had to be handled generically, here is the raw error message: %v", err)
 	_ = alerts.LogCriticalAlert(genericErr, "resolveAppError")
 
-	return http.StatusInternalServerError, "Unexpected error"
+	return http.StatusInternalServerError, "Unexpected error", apperr.CodeInternal
+}
+
+// writeAppError responds with the public form of err
+func writeAppError(w http.ResponseWriter, err error) {
+	status, msg, code := resolveAppError(err)
+	if code != "" {
+		w.Header().Set(errorCodeHeader, string(code))
+	}
+	http.Error(w, msg, status)
 }
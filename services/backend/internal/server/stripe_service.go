@@ -30,7 +30,9 @@ import (
 
 const DBContextTimeout = 1 * time.Minute
 
-func init() {
+// checkStripeConfig sets the Stripe API key; StartServer calls it before
+// serving anything
+func checkStripeConfig() {
 	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
 	if stripe.Key == "" {
 		log.Println("Warning: STRIPE_SECRET_KEY not set")
@@ -0,0 +1,155 @@
+package alerts
+
+import (
+	"backend/internal/data"
+	"backend/internal/queue"
+	"backend/internal/services/flags"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// With batching on, the strategy runs submitted during a cycle are collected
+// for a short window and sent as one alert_batch task per timeframe and
+// universe, instead of one alert task each. Every run still waits on its own
+// result, so caching, logging and notification stay per strategy.
+const (
+	// strategyBatchWindow is how long the first run of a batch waits for others
+	strategyBatchWindow = 250 * time.Millisecond
+	// strategyBatchMax caps how many strategies go to one worker task
+	strategyBatchMax = 25
+)
+
+func isStrategyBatchingEnabled() bool {
+	return flags.IsEnabled(context.Background(), flags.StrategyAlertBatch, 0)
+}
+
+type batchedRun struct {
+	strategy StrategyAlert
+	symbols  []string
+	now      time.Time
+	reply    chan batchedReply
+}
+
+type batchedReply struct {
+	result *queue.AlertResult
+	err    error
+}
+
+type pendingBatch struct {
+	runs  []batchedRun
+	timer *time.Timer
+}
+
+// strategyBatcher groups strategy runs into batches
+type strategyBatcher struct {
+	mu      sync.Mutex
+	pending map[string]*pendingBatch
+}
+
+var batcher = &strategyBatcher{pending: map[string]*pendingBatch{}}
+
+// batchKey groups strategies that share a timeframe and symbol set
+func batchKey(strategy StrategyAlert, symbols []string) string {
+	universe := "all"
+	if len(symbols) > 0 {
+		sorted := append([]string(nil), symbols...)
+		sort.Strings(sorted)
+		universe = strings.Join(sorted, ",")
+	}
+	return strategy.MinTimeframe + "|" + universe
+}
+
+// run submits a strategy's evaluation as part of a batch and waits for its
+// own result
+func (b *strategyBatcher) run(ctx context.Context, conn *data.Conn, strategy StrategyAlert, symbols []string, now time.Time) (*queue.AlertResult, error) {
+	run := batchedRun{strategy: strategy, symbols: symbols, now: now, reply: make(chan batchedReply, 1)}
+	key := batchKey(strategy, symbols)
+
+	b.mu.Lock()
+	batch, ok := b.pending[key]
+	if !ok {
+		batch = &pendingBatch{}
+		b.pending[key] = batch
+		batch.timer = time.AfterFunc(strategyBatchWindow, func() { b.flush(conn, key, batch) })
+	}
+	batch.runs = append(batch.runs, run)
+	full := len(batch.runs) >= strategyBatchMax
+	b.mu.Unlock()
+	if full {
+		go b.flush(conn, key, batch)
+	}
+
+	select {
+	case reply := <-run.reply:
+		return reply.result, reply.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// flush sends a batch once, whichever of its timer or filling up comes first
+func (b *strategyBatcher) flush(conn *data.Conn, key string, batch *pendingBatch) {
+	b.mu.Lock()
+	if b.pending[key] != batch {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.pending, key)
+	batch.timer.Stop()
+	runs := batch.runs
+	b.mu.Unlock()
+
+	ctx := context.Background()
+	if len(runs) == 1 {
+		result, err := queue.AlertTyped(ctx, conn, alertTaskArgs(runs[0].strategy, runs[0].symbols, runs[0].now))
+		runs[0].reply <- batchedReply{result: result, err: err}
+		return
+	}
+
+	strategies := make([]map[string]interface{}, 0, len(runs))
+	for _, r := range runs {
+		strategies = append(strategies, alertTaskArgs(r.strategy, r.symbols, r.now))
+	}
+	log.Printf("📦 Submitting %d strategies in one alert batch (%s)", len(runs), key)
+	result, err := queue.AlertBatchTyped(ctx, conn, map[string]interface{}{"strategies": strategies})
+	if err == nil && !result.Success {
+		err = fmt.Errorf("alert batch failed")
+		if result.Error != nil {
+			err = fmt.Errorf("alert batch failed: %s: %s", result.Error.Type, result.Error.Message)
+		}
+	}
+	for _, r := range runs {
+		if err != nil {
+			r.reply <- batchedReply{err: err}
+			continue
+		}
+		sub, ok := result.Results[strconv.Itoa(r.strategy.StrategyID)]
+		if !ok {
+			r.reply <- batchedReply{err: fmt.Errorf("alert batch returned no result for strategy %d", r.strategy.StrategyID)}
+			continue
+		}
+		r.reply <- batchedReply{result: &sub}
+	}
+}
+
+// alertTaskArgs are the arguments of one strategy's alert task, or its entry
+// in an alert batch
+func alertTaskArgs(strategy StrategyAlert, symbols []string, now time.Time) map[string]interface{} {
+	args := map[string]interface{}{
+		"strategy_id": strategy.StrategyID,
+		"user_id":     strategy.UserID,
+	}
+	if len(symbols) > 0 {
+		args["symbols"] = symbols
+	}
+	if timeframes, err := timeframeTaskArgs(strategy, now); err == nil && timeframes != nil {
+		args["timeframes"] = timeframes
+	}
+	return args
+}
@@ -0,0 +1,90 @@
+package alerts
+
+import (
+	"backend/internal/data"
+	"backend/internal/services/lastprice"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// Benchmarks of the alert loop's hot paths. Those reading Redis run with
+// BENCH_LIVE=true against the Postgres and Redis of the usual environment.
+
+// liveConn connects to Postgres and Redis, skipping the benchmark unless
+// BENCH_LIVE=true
+func liveConn(b *testing.B) *data.Conn {
+	if os.Getenv("BENCH_LIVE") != "true" {
+		b.Skip("set BENCH_LIVE=true to run against Postgres and Redis")
+	}
+	conn, cleanup := data.InitConn(os.Getenv("IN_CONTAINER") == "true")
+	b.Cleanup(cleanup)
+	return conn
+}
+
+// BenchmarkPriceAlertEvaluation evaluates 1,000 price alerts against cached
+// prices, none of which trigger, as one pass of the price alert loop does
+func BenchmarkPriceAlertEvaluation(b *testing.B) {
+	conn := &data.Conn{}
+	const n = 1000
+	alerts := make([]PriceAlert, n)
+	for i := range alerts {
+		securityID, price, up := 9_000_000+i, 100.0+float64(i), i%2 == 0
+		ticker := fmt.Sprintf("BENCH%d", i)
+		lastprice.RecordTrade(securityID, ticker, price, time.Now())
+		level := price + 50
+		if !up {
+			level = price - 50
+		}
+		alerts[i] = PriceAlert{AlertID: -i - 1, SecurityID: &securityID, Price: &level, Direction: &up, Ticker: &ticker}
+	}
+	now := time.Now()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, alert := range alerts {
+			if err := processPriceAlert(conn, alert, now); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkBucketStart(b *testing.B) {
+	timeframes := []string{"1", "5", "15", "60", "240", "1d", "1w"}
+	now := time.Now()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := bucketStart(now, timeframes[i%len(timeframes)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkThrottleIntersection intersects a minute's updated tickers with a
+// strategy universe, as per-ticker throttling does for every strategy
+func BenchmarkThrottleIntersection(b *testing.B) {
+	updated := make([]string, 8000)
+	for i := range updated {
+		updated[i] = fmt.Sprintf("T%d", i)
+	}
+	universe := make([]string, 500)
+	for i := range universe {
+		universe[i] = fmt.Sprintf("T%d", i*20)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		intersectClientSide(updated, universe)
+	}
+}
+
+func BenchmarkTickersUpdatedSince(b *testing.B) {
+	conn := liveConn(b)
+	since := time.Now().Add(-time.Minute).UnixMilli()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := data.GetTickersUpdatedSince(conn, since); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
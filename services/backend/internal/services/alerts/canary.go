@@ -0,0 +1,322 @@
+package alerts
+
+import (
+	"backend/internal/data"
+	"backend/internal/data/postgres"
+	"backend/internal/queue"
+	"backend/internal/services/lastprice"
+	"backend/internal/services/marketstatus"
+	"backend/internal/services/notices"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Canaries are synthetic probes sent through the real pipelines so breakage
+// shows up before users report it. The price canary places an alert on a
+// liquid ticker that triggers on its next evaluation, and the backtest canary
+// queues a tiny backtest of a designated strategy. Each run's end-to-end time
+// is kept; a run that fails or takes longer than its budget raises a critical
+// alert, once until the probe recovers.
+const (
+	CanaryPrice    = "price_alert"
+	CanaryBacktest = "backtest"
+
+	canaryInterval       = 5 * time.Minute
+	canaryHistoryKey     = "canary:history:%s" // by probe, newest first
+	canaryHistoryEntries = 100
+	// canaryStatusRuns is how many recent runs CanaryStatus summarizes
+	canaryStatusRuns = 20
+
+	// canaryAlertID is the price canary's alert; real alert IDs are positive
+	canaryAlertID       = -1
+	canaryPriceBudget   = 15 * time.Second
+	canaryPriceTimeout  = time.Minute
+	canaryDefaultTicker = "SPY"
+
+	canaryBacktestBudget  = 2 * time.Minute
+	canaryBacktestTimeout = 10 * time.Minute
+	canaryBacktestDays    = 5
+)
+
+// CanaryRun is one run of a probe
+type CanaryRun struct {
+	Probe      string    `json:"probe"`
+	Start      time.Time `json:"start"`
+	DurationMs int64     `json:"durationMs"`
+	Failed     bool      `json:"failed,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	OverBudget bool      `json:"overBudget,omitempty"`
+	BudgetMs   int64     `json:"budgetMs"`
+	// Detail describes what the run saw, such as the price and its source
+	Detail string `json:"detail,omitempty"`
+}
+
+func (r CanaryRun) healthy() bool {
+	return !r.Failed && !r.OverBudget
+}
+
+// canaryTicker is the liquid ticker the probes use ($CANARY_TICKER)
+func canaryTicker() string {
+	if t := os.Getenv("CANARY_TICKER"); t != "" {
+		return t
+	}
+	return canaryDefaultTicker
+}
+
+// canaryBacktestTarget is the strategy the backtest canary runs and its
+// owner ($CANARY_BACKTEST_STRATEGY_ID, $CANARY_BACKTEST_USER_ID); the probe
+// is off until both are set
+func canaryBacktestTarget() (strategyID, userID int, ok bool) {
+	strategyID, err1 := strconv.Atoi(os.Getenv("CANARY_BACKTEST_STRATEGY_ID"))
+	userID, err2 := strconv.Atoi(os.Getenv("CANARY_BACKTEST_USER_ID"))
+	return strategyID, userID, err1 == nil && err2 == nil && strategyID > 0 && userID > 0
+}
+
+// canaryLoop runs the probes every canaryInterval. A backtest canary still
+// running when the next is due is not doubled up.
+func (a *AlertService) canaryLoop() {
+	defer a.wg.Done()
+	ticker := a.clock.NewTicker(canaryInterval)
+	defer ticker.Stop()
+	var backtestRunning atomic.Bool
+	for {
+		select {
+		case <-a.stopChan:
+			log.Printf("📡 Canary loop stopped by stop signal")
+			return
+		case <-ticker.C:
+			// Breakage is expected during maintenance
+			if notices.InMaintenance(a.conn) {
+				continue
+			}
+			go a.runPriceCanary()
+			if backtestRunning.CompareAndSwap(false, true) {
+				go func() {
+					defer backtestRunning.Store(false)
+					a.runBacktestCanary()
+				}()
+			}
+		}
+	}
+}
+
+// priceCanary is the pending price canary run, if any
+var priceCanary struct {
+	sync.Mutex
+	fired chan lastprice.Price
+}
+
+// priceCanaryFired reports that the price canary triggered, at price
+func priceCanaryFired(price lastprice.Price) {
+	priceCanary.Lock()
+	defer priceCanary.Unlock()
+	if priceCanary.fired == nil {
+		return
+	}
+	select {
+	case priceCanary.fired <- price:
+	default: // already reported; the alert is being removed
+	}
+}
+
+// runPriceCanary places an alert that triggers at any price and times how
+// long the price feed and evaluation loop take to trigger it. The canary
+// only runs while the market trades, when the feed is live.
+func (a *AlertService) runPriceCanary() {
+	status, err := marketstatus.Get(a.conn)
+	if err == nil && (status.Session == marketstatus.SessionClosed || status.Session == marketstatus.SessionHoliday) {
+		return
+	}
+	ticker := canaryTicker()
+	run := CanaryRun{Probe: CanaryPrice, Start: time.Now(), BudgetMs: canaryPriceBudget.Milliseconds()}
+	securityID, err := postgres.GetCurrentSecurityID(a.conn, ticker)
+	if err != nil {
+		run.Failed = true
+		run.Error = fmt.Sprintf("looking up %s: %v", ticker, err)
+		a.recordCanaryRun(run)
+		return
+	}
+
+	fired := make(chan lastprice.Price, 1)
+	priceCanary.Lock()
+	priceCanary.fired = fired
+	priceCanary.Unlock()
+	threshold, above := 0.0, true
+	a.priceAlerts.Store(canaryAlertID, PriceAlert{
+		AlertID:    canaryAlertID,
+		Price:      &threshold,
+		Direction:  &above,
+		SecurityID: &securityID,
+		Ticker:     &ticker,
+		Canary:     true,
+	})
+	defer func() {
+		a.priceAlerts.Delete(canaryAlertID)
+		priceCanary.Lock()
+		priceCanary.fired = nil
+		priceCanary.Unlock()
+	}()
+
+	select {
+	case price := <-fired:
+		took := time.Since(run.Start)
+		run.DurationMs = took.Milliseconds()
+		run.OverBudget = took > canaryPriceBudget
+		run.Detail = fmt.Sprintf("%s %.2f from %s, %v old", ticker, price.Price, price.Source, price.Age(time.Now()).Round(time.Second))
+	case <-time.After(canaryPriceTimeout):
+		run.DurationMs = canaryPriceTimeout.Milliseconds()
+		run.Failed = true
+		run.Error = fmt.Sprintf("alert on %s did not trigger within %v", ticker, canaryPriceTimeout)
+	case <-a.stopChan:
+		return
+	}
+	a.recordCanaryRun(run)
+}
+
+// runBacktestCanary backtests the designated strategy on the canary ticker
+// over the last few days, through the task queue and a worker
+func (a *AlertService) runBacktestCanary() {
+	strategyID, userID, ok := canaryBacktestTarget()
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), canaryBacktestTimeout)
+	defer cancel()
+	// A paused queue refuses the task by design
+	if state, err := queue.GetControlState(ctx, a.conn); err == nil && state.State != queue.QueueRunning {
+		return
+	}
+
+	ticker := canaryTicker()
+	run := CanaryRun{Probe: CanaryBacktest, Start: time.Now(), BudgetMs: canaryBacktestBudget.Milliseconds()}
+	result, err := queue.BacktestTyped(ctx, a.conn, map[string]interface{}{
+		"strategy_id": strategyID,
+		"user_id":     userID,
+		"symbols":     []string{ticker},
+		"start_date":  run.Start.AddDate(0, 0, -canaryBacktestDays).Format("2006-01-02"),
+		"end_date":    run.Start.Format("2006-01-02"),
+	})
+	took := time.Since(run.Start)
+	run.DurationMs = took.Milliseconds()
+	switch {
+	case err != nil:
+		run.Failed = true
+		run.Error = err.Error()
+	case !result.Success:
+		run.Failed = true
+		run.Error = "backtest reported failure"
+		if result.Error != nil {
+			run.Error = result.Error.Message
+		}
+	default:
+		run.OverBudget = took > canaryBacktestBudget
+		run.Detail = fmt.Sprintf("strategy %d on %s: %d instances", strategyID, ticker, result.TotalInstances)
+	}
+	a.recordCanaryRun(run)
+}
+
+// recordCanaryRun appends a run to its probe's history. The first unhealthy
+// run in a row raises a critical alert; the ones after it are only kept.
+func (a *AlertService) recordCanaryRun(run CanaryRun) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	key := fmt.Sprintf(canaryHistoryKey, run.Probe)
+	previous, err := loadCanaryHistory(ctx, a.conn, run.Probe, 1)
+	if err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+	encoded, err := json.Marshal(run)
+	if err != nil {
+		log.Printf("⚠️ Error encoding %s canary run: %v", run.Probe, err)
+		return
+	}
+	pipe := a.conn.Cache.TxPipeline()
+	pipe.LPush(ctx, key, encoded)
+	pipe.LTrim(ctx, key, 0, canaryHistoryEntries-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ Error saving %s canary run: %v", run.Probe, err)
+	}
+
+	wasHealthy := len(previous) == 0 || previous[0].healthy()
+	switch {
+	case run.healthy() && !wasHealthy:
+		log.Printf("✅ %s canary recovered in %v", run.Probe, time.Duration(run.DurationMs)*time.Millisecond)
+	case run.healthy():
+	case run.Failed:
+		log.Printf("🐤 %s canary failed: %s", run.Probe, run.Error)
+		if wasHealthy {
+			_ = LogCriticalAlert(fmt.Errorf("%s canary failed: %s", run.Probe, run.Error), "canary")
+		}
+	default:
+		took := time.Duration(run.DurationMs) * time.Millisecond
+		log.Printf("🐤 %s canary took %v, over its %v budget", run.Probe, took, time.Duration(run.BudgetMs)*time.Millisecond)
+		if wasHealthy {
+			_ = LogCriticalAlert(fmt.Errorf("%s canary took %v, over its %v budget",
+				run.Probe, took, time.Duration(run.BudgetMs)*time.Millisecond), "canary")
+		}
+	}
+}
+
+// loadCanaryHistory returns up to limit of a probe's runs, newest first
+func loadCanaryHistory(ctx context.Context, conn *data.Conn, probe string, limit int) ([]CanaryRun, error) {
+	raw, err := conn.Cache.LRange(ctx, fmt.Sprintf(canaryHistoryKey, probe), 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("loading %s canary history: %w", probe, err)
+	}
+	runs := make([]CanaryRun, 0, len(raw))
+	for _, r := range raw {
+		var run CanaryRun
+		if err := json.Unmarshal([]byte(r), &run); err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// CanaryProbeStatus summarizes a probe's recent runs
+type CanaryProbeStatus struct {
+	Probe    string     `json:"probe"`
+	Last     *CanaryRun `json:"last,omitempty"`
+	Runs     int        `json:"runs"`     // of the last 20
+	Failures int        `json:"failures"` // failed or over budget
+	MedianMs int64      `json:"medianMs"` // of the successful runs
+}
+
+// CanaryStatus reports each probe's last run and how its recent runs went
+func CanaryStatus(ctx context.Context, conn *data.Conn) ([]CanaryProbeStatus, error) {
+	statuses := make([]CanaryProbeStatus, 0, 2)
+	for _, probe := range []string{CanaryPrice, CanaryBacktest} {
+		runs, err := loadCanaryHistory(ctx, conn, probe, canaryStatusRuns)
+		if err != nil {
+			return nil, err
+		}
+		s := CanaryProbeStatus{Probe: probe, Runs: len(runs)}
+		var durations []int64
+		for i := range runs {
+			if !runs[i].healthy() {
+				s.Failures++
+			}
+			if !runs[i].Failed {
+				durations = append(durations, runs[i].DurationMs)
+			}
+		}
+		if len(runs) > 0 {
+			s.Last = &runs[0]
+		}
+		if len(durations) > 0 {
+			sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+			s.MedianMs = durations[len(durations)/2]
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
@@ -72,7 +72,7 @@ func LogCriticalAlert(err error, functionName ...string) error {
 	}
 
 	// Ensure the bot is initialised. We defer to the existing helper in
-	// dispatch.go so that we reuse the same global bot/chatID variables.
+	// dispatch.go so that we reuse the same global bot/opsChatID variables.
 	if bot == nil {
 		if initErr := InitTelegramBot(); initErr != nil {
 			// If bot initialisation itself fails, log it locally and surface the error.
@@ -101,7 +101,7 @@ func LogCriticalAlert(err error, functionName ...string) error {
 	msg := fmt.Sprintf("\u26A0\uFE0F *Critical Alert*\nEnvironment: %s\nTime: %s UTC\nFunction: %s\nError: %v", env, timestamp, callerFn, err)
 
 	// Send the message.
-	if sendErr := SendTelegramMessage(msg, chatID); sendErr != nil {
+	if sendErr := SendTelegramMessage(msg, opsChatID); sendErr != nil {
 		log.Printf("LogCriticalAlert: failed to send telegram message: %v", sendErr)
 		return fmt.Errorf("failed to send telegram message: %w", sendErr)
 	}
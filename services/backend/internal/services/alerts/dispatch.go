@@ -4,8 +4,15 @@ package alerts
 
 import (
 	"backend/internal/data"
+	"backend/internal/dryrun"
+	"backend/internal/services/chartimage"
+	email "backend/internal/services/email"
+	"backend/internal/services/notices"
 	"backend/internal/services/socket"
+	"backend/internal/services/templates"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -17,8 +24,10 @@ import (
 )
 
 var (
-	bot    *telebot.Bot
-	chatID int64
+	bot *telebot.Bot
+	// opsChatID is the ops chat, for critical errors; user alerts go to the
+	// chat each user linked
+	opsChatID int64
 	// devEnv indicates whether the application is running in a local development
 	// environment. When true, Telegram integration is skipped entirely so that
 	// developers are not required to provide bot credentials.
@@ -47,7 +56,7 @@ func InitTelegramBot() error {
 	}
 
 	var err error
-	chatID, err = strconv.ParseInt(chatIDStr, 10, 64)
+	opsChatID, err = strconv.ParseInt(chatIDStr, 10, 64)
 	if err != nil {
 		log.Fatalf("Error: Invalid TELEGRAM_CHAT_ID format: %v", err)
 	}
@@ -69,6 +78,9 @@ func SendTelegramMessage(msg string, chatID int64) error {
 	if devEnv || bot == nil {
 		return nil
 	}
+	if dryrun.Notify(context.Background(), "telegram", fmt.Sprintf("sent Telegram chat %d: %s", chatID, msg), nil) {
+		return nil
+	}
 	recipient := telebot.ChatID(chatID)
 	_, err := bot.Send(recipient, msg)
 	return err
@@ -78,28 +90,287 @@ func SendTelegramMessage(msg string, chatID int64) error {
 	// }
 }
 
-func writePriceAlertMessage(alert PriceAlert) string {
+// SendTelegramPhoto sends a PNG image with a caption.
+func SendTelegramPhoto(png []byte, caption string, chatID int64) error {
+	if devEnv || bot == nil {
+		return nil
+	}
+	if dryrun.Notify(context.Background(), "telegram", fmt.Sprintf("sent Telegram chat %d a chart: %s", chatID, caption), nil) {
+		return nil
+	}
+	photo := &telebot.Photo{File: telebot.FromReader(bytes.NewReader(png)), Caption: caption}
+	_, err := bot.Send(telebot.ChatID(chatID), photo)
+	return err
+}
+
+// SendTelegramDocument sends a file with a caption. Unlike the other senders
+// it reports a bot that was never initialised, so callers can record that the
+// file did not go out.
+func SendTelegramDocument(file []byte, fileName, caption string, chatID int64) error {
+	if devEnv {
+		return nil
+	}
+	if bot == nil {
+		return fmt.Errorf("telegram bot is not initialised")
+	}
+	if dryrun.Notify(context.Background(), "telegram", fmt.Sprintf("sent Telegram chat %d %s: %s", chatID, fileName, caption), nil) {
+		return nil
+	}
+	doc := &telebot.Document{File: telebot.FromReader(bytes.NewReader(file)), FileName: fileName, Caption: caption}
+	_, err := bot.Send(telebot.ChatID(chatID), doc)
+	return err
+}
+
+// telegramEnabled reports whether Telegram messages actually go out; in
+// development or without a bot the senders are no-ops
+func telegramEnabled() bool {
+	return !devEnv && bot != nil
+}
+
+// sendTelegramWithSnapshot sends msg to chat as the caption of a chart snapshot,
+// falling back to a plain text message when the chart cannot be rendered.
+// Rendering launches a headless browser, so callers run this off the alert loop.
+// It returns an error only if neither message went out.
+func sendTelegramWithSnapshot(conn *data.Conn, msg string, snap chartimage.SnapshotArgs, chat int64) error {
+	if !telegramEnabled() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	png, _, err := chartimage.Snapshot(ctx, conn, snap)
+	if err == nil {
+		if err = SendTelegramPhoto(png, msg, chat); err == nil {
+			return nil
+		}
+	}
+	log.Printf("⚠️ chart snapshot for alert failed, sending text only: %v", err)
+	return SendTelegramMessage(msg, chat)
+}
+
+// sentChannels records the channels that have handled a notification, so a
+// retry of the same notification skips them
+type sentChannels map[string]bool
+
+// sentEscalation marks, in sentChannels, a notification whose escalation
+// policy has taken over from the fallback channels
+const sentEscalation = "escalation"
+
+// heldError is what notifyUser returns during a maintenance window: the
+// channels it didn't try are due again once the window ends
+type heldError struct {
+	until time.Time
+}
+
+func (e *heldError) Error() string {
+	return fmt.Sprintf("held for maintenance until %s", e.until.Format(time.RFC3339))
+}
+
+// notifyUser delivers an alert over the user's WebSocket. When the alert or
+// user has an escalation policy, its steps go out later unless the client acks
+// the delivery first. Otherwise, when the user has no open connection the
+// alert is still queued for replay, and it also goes out through the fallback
+// channels: the user's linked Telegram chat, if any, and, if the user opted
+// in, email. Alerts never go to the ops chat. Each channel that
+// delivers the alert records its latency on trace, which may be nil, and is
+// added to sent; channels already in sent are skipped. Each channel is subject
+// to the user's rate limit on it, and an alert past the limit counts as sent:
+// it goes out with the channel's summary at the end of the window. Telegram
+// and email are written from content, in the user's locale; nil content sends
+// the alert's message as is.
+//
+// The alert also goes to the user's webhooks, online or not, each recorded in
+// sent as "webhook:<id>" once it took the event.
+//
+// During a declared maintenance window, when the data behind the alert may be
+// unreliable, only the WebSocket leg goes out and the escalation is scheduled
+// (its steps are held by the escalation loop). The webhooks and fallback
+// channels are left for later with a *heldError carrying the window's end; the
+// outbox tries the notification again then, and whether the user is online is
+// judged at that point.
+//
+// It blocks while the fallbacks send, so it runs off the alert loop, and
+// returns an error when Telegram or a webhook failed. Email is best-effort
+// and tried once.
+// Alerts should go through enqueueNotification, which retries on error.
+func notifyUser(conn *data.Conn, userID int, alert socket.AlertMessage, content *templates.Message, snap *chartimage.SnapshotArgs, trace *deliveryTrace, sent sentChannels) error {
+	trace.dispatching(conn, alert.LogID)
+	online := socket.IsUserOnline(userID)
+	var deliveryID string
+	if !sent[ChannelWebSocket] && admitNotification(conn, userID, ChannelWebSocket, alert.Message) {
+		deliveryID = socket.SendAlertToUser(userID, alert)
+		if online && deliveryID != "" {
+			trace.delivered(conn, ChannelWebSocket)
+		}
+	}
+	sent[ChannelWebSocket] = true
+	var held error
+	if until := notices.MaintenanceEnd(conn); !until.IsZero() {
+		log.Printf("🔧 Maintenance in effect, holding the other channels of alert %d for user %d until %s", alert.AlertID, userID, until.Format(time.RFC3339))
+		held = &heldError{until: until}
+	}
+	var webhookErr error
+	if held == nil {
+		webhookErr = deliverAlertWebhooks(conn, userID, alert, sent)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !sent[sentEscalation] {
+		steps, found, err := loadEscalationPolicy(ctx, conn, userID, alert.Type, alert.AlertID)
+		if err != nil {
+			log.Printf("⚠️ %v; using the default fallback channels", err)
+		}
+		if found && deliveryID != "" {
+			if len(steps) == 0 {
+				sent[sentEscalation] = true
+			} else {
+				now := GetAlertService().now()
+				p := &pendingEscalation{UserID: userID, Message: alert.Message, Content: content, Steps: steps, TriggeredAt: now.UnixMilli()}
+				if err := scheduleEscalation(ctx, conn, deliveryID, p, now, false); err != nil {
+					log.Printf("⚠️ Failed to schedule escalation for user %d: %v; using the default fallback channels", userID, err)
+				} else {
+					sent[sentEscalation] = true
+				}
+			}
+		}
+	}
+	if held != nil {
+		return held
+	}
+	if online || sent[sentEscalation] {
+		return webhookErr
+	}
+	if content == nil {
+		text := templates.Text(alert.Message)
+		content = &text
+	}
+	locale := templates.UserLocale(ctx, conn, userID)
+	var telegramErr error
+	if telegramEnabled() && !sent[ChannelTelegram] {
+		telegramErr = sendTelegramFallback(conn, userID, locale, *content, snap, trace)
+		if telegramErr == nil {
+			sent[ChannelTelegram] = true
+		}
+	}
+	if !sent[ChannelEmail] {
+		if emailAlert(conn, userID, locale, *content, true) {
+			trace.delivered(conn, ChannelEmail)
+		}
+		sent[ChannelEmail] = true
+	}
+	if telegramErr != nil {
+		return errors.Join(fmt.Errorf("failed to send Telegram message: %w", telegramErr), webhookErr)
+	}
+	return webhookErr
+}
+
+// sendTelegramFallback sends an alert to the user's linked Telegram chat,
+// with a chart snapshot when there is one. Users without a linked chat get
+// nothing here.
+func sendTelegramFallback(conn *data.Conn, userID int, locale string, content templates.Message, snap *chartimage.SnapshotArgs, trace *deliveryTrace) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	userChat, err := UserTelegramChat(ctx, conn, userID)
+	if errors.Is(err, ErrNoTelegramChat) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	msg := templates.Render(locale, templates.VariantTelegram, content)
+	if !admitNotification(conn, userID, ChannelTelegram, msg) {
+		return nil // held back for the window's summary
+	}
+	if snap != nil {
+		err = sendTelegramWithSnapshot(conn, msg, *snap, userChat)
+	} else {
+		err = SendTelegramMessage(msg, userChat)
+	}
+	if err == nil {
+		trace.delivered(conn, ChannelTelegram)
+	}
+	return err
+}
+
+// emailAlert emails an alert to the user in the locale, subject to their email
+// rate limit.
+// Offline fallbacks (offline set) only go to users who enabled
+// emailAlertsOffline; escalation steps the user configured always go out. It
+// reports whether the email was sent.
+func emailAlert(conn *data.Conn, userID int, locale string, content templates.Message, offline bool) bool {
+	if devEnv {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	to, ok := alertEmailRecipient(ctx, conn, userID, offline)
+	if !ok || !admitNotification(conn, userID, ChannelEmail, templates.Render(locale, templates.VariantText, content)) {
+		return false
+	}
+	subject, body := templates.RenderEmail(locale, content, templates.Vars{"Offline": offline, "LogURL": alertLogURL()})
+	if err := email.SendEmail(to, subject, body); err != nil {
+		log.Printf("⚠️ Failed to email alert to user %d: %v", userID, err)
+		return false
+	}
+	return true
+}
+
+// alertEmailRecipient returns the address alert emails for the user go to,
+// and false when there is none or, for offline fallbacks, the user hasn't
+// enabled emailAlertsOffline
+func alertEmailRecipient(ctx context.Context, conn *data.Conn, userID int, offline bool) (string, bool) {
+	if devEnv {
+		return "", false
+	}
+	var to string
+	var enabled bool
+	err := conn.DB.QueryRow(ctx, `
+		SELECT COALESCE(email, ''), COALESCE((settings->>'emailAlertsOffline')::boolean, false)
+		FROM users WHERE userId = $1`, userID).Scan(&to, &enabled)
+	if err != nil {
+		log.Printf("⚠️ Error loading email settings for user %d: %v", userID, err)
+		return "", false
+	}
+	if to == "" || (offline && !enabled) {
+		return "", false
+	}
+	return to, true
+}
+
+// priceAlertContent returns the notification for a triggered price alert
+func priceAlertContent(alert PriceAlert) templates.Message {
 	if alert.SecurityID == nil {
-		return "SecurityID is missing"
+		return templates.Text("SecurityID is missing")
 	}
 	if alert.Price == nil || alert.Direction == nil {
-		return "Price or Direction is missing for price alert"
+		return templates.Text("Price or Direction is missing for price alert")
+	}
+	vars := templates.Vars{"Ticker": *alert.Ticker, "Price": *alert.Price, "Above": *alert.Direction}
+	if alert.VWAPAnchor != nil {
+		vars["Anchor"] = alert.VWAPAnchor.Format("2006-01-02 15:04")
+		return templates.New(templates.VWAPCross, vars)
+	}
+	if alert.Trendline != nil {
+		return templates.New(templates.TrendlineCross, vars)
 	}
 	if *alert.Direction {
-		return fmt.Sprintf("%s price above %f", *alert.Ticker, *alert.Price)
+		return templates.New(templates.PriceAbove, vars)
 	}
-	return fmt.Sprintf("%s price below %f", *alert.Ticker, *alert.Price)
+	return templates.New(templates.PriceBelow, vars)
 }
 
-func dispatchPriceAlert(conn *data.Conn, alert PriceAlert) error {
+func dispatchPriceAlert(conn *data.Conn, alert PriceAlert, trace *deliveryTrace) error {
 	//log.Printf("DEBUG: Dispatching price alert: %+v", alert)
-	alertMessage := writePriceAlertMessage(alert)
+	content := priceAlertContent(alert)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	locale := templates.UserLocale(ctx, conn, alert.UserID)
+	cancel()
+	alertMessage := templates.Render(locale, templates.VariantText, content)
 	timestamp := time.Now()
-	err := SendTelegramMessage(alertMessage, chatID)
-	if err != nil {
-		return err
-	}
-	socket.SendAlertToUser(alert.UserID, socket.AlertMessage{
+	// Log before notifying so the notification carries the log ID; the user is
+	// notified either way
+	logID, logErr := LogPriceAlert(conn, alert.UserID, alert.AlertID, *alert.Ticker, *alert.SecurityID, alertMessage)
+	enqueueNotification(conn, alert.UserID, socket.AlertMessage{
 		AlertID:    alert.AlertID,
 		Timestamp:  timestamp.Unix() * 1000,
 		SecurityID: *alert.SecurityID,
@@ -107,12 +378,18 @@ func dispatchPriceAlert(conn *data.Conn, alert PriceAlert) error {
 		Channel:    "alert",
 		Type:       "price",
 		Tickers:    []string{*alert.Ticker},
-	})
-	// Log the alert using the new centralized logging system
-	err = LogPriceAlert(conn, alert.UserID, alert.AlertID, *alert.Ticker, *alert.SecurityID, alertMessage)
-	if err != nil {
-		//log.Printf("Failed to log alert to database: %v", err)
-		return fmt.Errorf("failed to log alert: %v", err)
+		LogID:      logID,
+	}, &content, &chartimage.SnapshotArgs{
+		Ticker:    *alert.Ticker,
+		Timeframe: "5m",
+		At:        timestamp,
+		Bars:      78,
+		Markers:   []chartimage.Marker{{Timestamp: timestamp.UnixMilli(), Label: "alert"}},
+		Levels:    []chartimage.Level{{Price: *alert.Price, Label: "alert"}},
+	}, trace)
+
+	if logErr != nil {
+		return fmt.Errorf("failed to log alert: %v", logErr)
 	}
 
 	// Disable the alert by setting its active status to false
@@ -121,7 +398,7 @@ func dispatchPriceAlert(conn *data.Conn, alert PriceAlert) error {
         SET active = false
         WHERE alertId = $1
     `
-	_, err = data.ExecWithRetry(context.Background(), conn.DB, updateQuery, alert.AlertID)
+	_, err := data.ExecWithRetry(context.Background(), conn.DB, updateQuery, alert.AlertID)
 	if err != nil {
 		//log.Printf("Failed to disable alert with ID %d: %v", alert.AlertID, err)
 		return fmt.Errorf("failed to disable alert: %v", err)
@@ -0,0 +1,248 @@
+package alerts
+
+import (
+	"backend/internal/data"
+	"backend/internal/services/notices"
+	"backend/internal/services/socket"
+	"backend/internal/services/templates"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4"
+)
+
+// Escalation sends an alert trigger the client has not acknowledged over
+// further channels. Each pending escalation is a JSON state key plus an entry
+// in a sorted set scored by when its next step is due. Whichever replica
+// removes the entry from the set sends that step, and an ack deletes both.
+const (
+	escalationDueKey   = "alert_escalations:due"
+	escalationStateKey = "alert_escalation:%s" // by delivery ID
+	escalationInterval = 5 * time.Second
+	escalationBatch    = 100
+
+	// Escalation channels; the WebSocket is always the first leg
+	EscalationTelegram = "telegram"
+	EscalationEmail    = "email"
+
+	maxEscalationSteps   = 5
+	maxEscalationMinutes = 24 * 60
+)
+
+// EscalationStep sends the alert over Channel AfterMinutes after the trigger
+type EscalationStep struct {
+	Channel      string `json:"channel"`
+	AfterMinutes int    `json:"afterMinutes"`
+}
+
+// ValidateEscalationSteps checks a policy's steps are known channels in
+// increasing order of delay
+func ValidateEscalationSteps(steps []EscalationStep) error {
+	if len(steps) > maxEscalationSteps {
+		return fmt.Errorf("at most %d escalation steps are allowed", maxEscalationSteps)
+	}
+	prev := 0
+	for i, s := range steps {
+		if s.Channel != EscalationTelegram && s.Channel != EscalationEmail {
+			return fmt.Errorf("step %d: unknown channel %q, expected %q or %q", i+1, s.Channel, EscalationTelegram, EscalationEmail)
+		}
+		if s.AfterMinutes < 1 || s.AfterMinutes > maxEscalationMinutes {
+			return fmt.Errorf("step %d: afterMinutes must be between 1 and %d", i+1, maxEscalationMinutes)
+		}
+		if s.AfterMinutes <= prev {
+			return fmt.Errorf("step %d: afterMinutes must be greater than the previous step's", i+1)
+		}
+		prev = s.AfterMinutes
+	}
+	return nil
+}
+
+// loadEscalationPolicy returns the steps that apply to an alert: its own
+// policy, else the user's default. found is false when neither exists.
+func loadEscalationPolicy(ctx context.Context, conn *data.Conn, userID int, alertType string, relatedID int) (steps []EscalationStep, found bool, err error) {
+	var raw []byte
+	err = conn.DB.QueryRow(ctx, `
+		SELECT steps FROM alert_escalation_policies
+		WHERE user_id = $1 AND (
+			(alert_id IS NULL AND strategy_id IS NULL)
+			OR ($2 = 'price' AND alert_id = $3)
+			OR ($2 = 'strategy' AND strategy_id = $3))
+		ORDER BY (alert_id IS NULL AND strategy_id IS NULL)
+		LIMIT 1`, userID, alertType, relatedID).Scan(&raw)
+	if err == pgx.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("loading escalation policy: %w", err)
+	}
+	if err := json.Unmarshal(raw, &steps); err != nil {
+		return nil, false, fmt.Errorf("parsing escalation policy: %w", err)
+	}
+	return steps, true, nil
+}
+
+// pendingEscalation is the state of one escalating trigger
+type pendingEscalation struct {
+	UserID      int                `json:"userId"`
+	Message     string             `json:"message"`
+	Content     *templates.Message `json:"content,omitempty"` // nil for states stored before templates
+	Steps       []EscalationStep   `json:"steps"`
+	Next        int                `json:"next"`        // index of the next step to send
+	TriggeredAt int64              `json:"triggeredAt"` // ms since epoch
+}
+
+func (p *pendingEscalation) due() time.Time {
+	return time.UnixMilli(p.TriggeredAt).Add(time.Duration(p.Steps[p.Next].AfterMinutes) * time.Minute)
+}
+
+// ttl keeps the state until well after its last step is due
+func (p *pendingEscalation) ttl(now time.Time) time.Duration {
+	last := time.UnixMilli(p.TriggeredAt).Add(time.Duration(p.Steps[len(p.Steps)-1].AfterMinutes) * time.Minute)
+	return last.Sub(now) + time.Hour
+}
+
+// scheduleEscalation stores the state of a trigger delivered as deliveryID and
+// queues its next step. With pending set the state is only replaced if it
+// still exists, so an ack that lands while a step is being sent sticks.
+func scheduleEscalation(ctx context.Context, conn *data.Conn, deliveryID string, p *pendingEscalation, now time.Time, pending bool) error {
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf(escalationStateKey, deliveryID)
+	pipe := conn.Cache.TxPipeline()
+	if pending {
+		pipe.SetXX(ctx, key, raw, p.ttl(now))
+	} else {
+		pipe.Set(ctx, key, raw, p.ttl(now))
+	}
+	pipe.ZAdd(ctx, escalationDueKey, &redis.Z{Score: float64(p.due().UnixMilli()), Member: deliveryID})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// CancelEscalation drops the pending steps of an acknowledged delivery
+func CancelEscalation(conn *data.Conn, deliveryID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	pipe := conn.Cache.TxPipeline()
+	del := pipe.Del(ctx, fmt.Sprintf(escalationStateKey, deliveryID))
+	pipe.ZRem(ctx, escalationDueKey, deliveryID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ Failed to cancel escalation %s: %v", deliveryID, err)
+		return
+	}
+	if del.Val() > 0 {
+		log.Printf("✅ Escalation %s cancelled by acknowledgement", deliveryID)
+	}
+}
+
+// escalationLoop sends escalation steps as they come due
+func (a *AlertService) escalationLoop() {
+	defer a.wg.Done()
+	ticker := a.clock.NewTicker(escalationInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.stopChan:
+			log.Printf("📡 Escalation loop stopped by stop signal")
+			return
+		case <-ticker.C:
+			timeLoop("escalation", escalationInterval, a.processDueEscalations)
+		}
+	}
+}
+
+// processDueEscalations claims and sends every step due by now. Steps are
+// held, not dropped, during a maintenance window.
+func (a *AlertService) processDueEscalations() {
+	if notices.InMaintenance(a.conn) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	now := a.now()
+	ids, err := a.conn.Cache.ZRangeByScore(ctx, escalationDueKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: escalationBatch,
+	}).Result()
+	if err != nil {
+		log.Printf("⚠️ Failed to read due escalations: %v", err)
+		return
+	}
+	for _, id := range ids {
+		// Removing the entry claims the step; another replica that read the
+		// same id gets 0 and skips it
+		claimed, err := a.conn.Cache.ZRem(ctx, escalationDueKey, id).Result()
+		if err != nil || claimed == 0 {
+			continue
+		}
+		a.sendEscalationStep(ctx, id, now)
+	}
+}
+
+func (a *AlertService) sendEscalationStep(ctx context.Context, deliveryID string, now time.Time) {
+	key := fmt.Sprintf(escalationStateKey, deliveryID)
+	raw, err := a.conn.Cache.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return // acknowledged or expired
+	}
+	if err != nil {
+		log.Printf("⚠️ Failed to load escalation %s: %v", deliveryID, err)
+		return
+	}
+	var p pendingEscalation
+	if err := json.Unmarshal(raw, &p); err != nil || p.Next >= len(p.Steps) {
+		a.conn.Cache.Del(ctx, key)
+		return
+	}
+
+	content := templates.Text(p.Message)
+	if p.Content != nil {
+		content = *p.Content
+	}
+	locale := templates.UserLocale(ctx, a.conn, p.UserID)
+	step := p.Steps[p.Next]
+	log.Printf("📣 Escalating unacknowledged alert %s for user %d to %s", deliveryID, p.UserID, step.Channel)
+	switch step.Channel {
+	case EscalationTelegram:
+		userChat, err := UserTelegramChat(ctx, a.conn, p.UserID)
+		if err != nil {
+			// Unlinked since the policy was set
+			log.Printf("⚠️ Skipping Telegram escalation for user %d: %v", p.UserID, err)
+			break
+		}
+		msg := templates.Render(locale, templates.VariantTelegram, content)
+		if !admitNotification(a.conn, p.UserID, ChannelTelegram, msg) {
+			break
+		}
+		if err := SendTelegramMessage(msg, userChat); err != nil {
+			log.Printf("Warning: failed to send Telegram message: %v", err)
+		}
+	case EscalationEmail:
+		go emailAlert(a.conn, p.UserID, locale, content, false)
+	}
+
+	p.Next++
+	if p.Next >= len(p.Steps) {
+		a.conn.Cache.Del(ctx, key)
+		return
+	}
+	if err := scheduleEscalation(ctx, a.conn, deliveryID, &p, now, true); err != nil {
+		log.Printf("⚠️ Failed to schedule next escalation step for %s: %v", deliveryID, err)
+	}
+}
+
+// initEscalations cancels escalations when clients acknowledge alerts
+func (a *AlertService) initEscalations() {
+	conn := a.conn
+	socket.SetAckCallback(func(_ int, deliveryID string) {
+		CancelEscalation(conn, deliveryID)
+	})
+}
@@ -0,0 +1,393 @@
+package alerts
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Alert delivery latency. Each trigger carries a trace of when it passed the
+// pipeline stages, and every channel that delivers it adds its end-to-end
+// latency, from the tick that was evaluated to the hand-off to the channel, to
+// a per-day histogram in Redis. Escalation steps are delayed on purpose and
+// are not measured. The trace of each logged alert is kept as well, so a
+// single delivery can be explained.
+const (
+	latencyKeyPrefix  = "alert_latency:"  // + day, histogram counts
+	deliveryKeyPrefix = "alert_delivery:" // + log ID, one alert's trace
+	latencyKeyTTL     = 8 * 24 * time.Hour
+
+	// Delivery channels
+	ChannelWebSocket = "websocket"
+	ChannelTelegram  = "telegram"
+	ChannelEmail     = "email"
+
+	// Pipeline stages, in order
+	StageTick       = "tick_received"
+	StageEvaluation = "evaluation_start"
+	StageSubmit     = "worker_submit"
+	StageResult     = "result_received"
+	StageDispatch   = "dispatched"
+)
+
+var pipelineStages = []string{StageTick, StageEvaluation, StageSubmit, StageResult, StageDispatch}
+
+// latencyBuckets are the histogram upper bounds in ms; a final bucket holds
+// everything slower
+var latencyBuckets = []int64{100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000, 300000}
+
+// LatencyObjectives are the end-to-end delivery targets per alert type.
+// Strategy alerts wait for the next 10s scan and a worker evaluation.
+var LatencyObjectives = map[string]time.Duration{
+	"price":    5 * time.Second,
+	"strategy": 30 * time.Second,
+}
+
+// deliveryTrace follows one alert trigger through the pipeline. Stages an
+// alert doesn't pass through stay zero: price alerts never reach the worker
+// and reused strategy results skip it.
+type deliveryTrace struct {
+	AlertType       string
+	LogID           int
+	TickReceived    time.Time
+	EvaluationStart time.Time
+	WorkerSubmit    time.Time
+	ResultReceived  time.Time
+	Dispatched      time.Time
+}
+
+func (t *deliveryTrace) stages() map[string]time.Time {
+	return map[string]time.Time{
+		StageTick:       t.TickReceived,
+		StageEvaluation: t.EvaluationStart,
+		StageSubmit:     t.WorkerSubmit,
+		StageResult:     t.ResultReceived,
+		StageDispatch:   t.Dispatched,
+	}
+}
+
+// start is when the trigger entered the pipeline
+func (t *deliveryTrace) start() time.Time {
+	if !t.TickReceived.IsZero() && t.TickReceived.Before(t.EvaluationStart) {
+		return t.TickReceived
+	}
+	return t.EvaluationStart
+}
+
+func latencyKey(day time.Time) string {
+	return latencyKeyPrefix + day.UTC().Format("2006-01-02")
+}
+
+func deliveryKey(logID int) string {
+	return deliveryKeyPrefix + strconv.Itoa(logID)
+}
+
+// bucketField names the histogram bucket a latency falls in
+func bucketField(prefix string, ms int64) string {
+	for _, le := range latencyBuckets {
+		if ms <= le {
+			return prefix + ":" + strconv.FormatInt(le, 10)
+		}
+	}
+	return prefix + ":inf"
+}
+
+// dispatching marks the trace as handed to the channels and records the time
+// spent between its stages. A nil trace records nothing.
+func (t *deliveryTrace) dispatching(conn *data.Conn, logID int) {
+	if t == nil {
+		return
+	}
+	t.LogID = logID
+	t.Dispatched = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	key := latencyKey(t.Dispatched)
+	stages := t.stages()
+	pipe := conn.Cache.Pipeline()
+	var prev string
+	for _, stage := range pipelineStages {
+		if stages[stage].IsZero() {
+			continue
+		}
+		if prev != "" {
+			ms := stages[stage].Sub(stages[prev]).Milliseconds()
+			if ms < 0 {
+				ms = 0
+			}
+			prefix := "stage:" + t.AlertType + ":" + prev + " to " + stage
+			pipe.HIncrBy(ctx, key, bucketField(prefix, ms), 1)
+			pipe.HIncrBy(ctx, key, prefix+":count", 1)
+			pipe.HIncrBy(ctx, key, prefix+":sum", ms)
+		}
+		prev = stage
+	}
+	pipe.Expire(ctx, key, latencyKeyTTL)
+	if logID > 0 {
+		fields := map[string]interface{}{"type": t.AlertType}
+		for stage, at := range stages {
+			if !at.IsZero() {
+				fields[stage] = at.UnixMilli()
+			}
+		}
+		pipe.HSet(ctx, deliveryKey(logID), fields)
+		pipe.Expire(ctx, deliveryKey(logID), latencyKeyTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ Recording alert pipeline latency failed: %v", err)
+	}
+}
+
+// delivered records that channel handed the alert on, and how long that took
+// from the start of the trace
+func (t *deliveryTrace) delivered(conn *data.Conn, channel string) {
+	if t == nil {
+		return
+	}
+	at := time.Now()
+	ms := at.Sub(t.start()).Milliseconds()
+	if ms < 0 {
+		ms = 0
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	key := latencyKey(at)
+	prefix := "e2e:" + t.AlertType + ":" + channel
+	pipe := conn.Cache.Pipeline()
+	pipe.HIncrBy(ctx, key, bucketField(prefix, ms), 1)
+	pipe.HIncrBy(ctx, key, prefix+":count", 1)
+	pipe.HIncrBy(ctx, key, prefix+":sum", ms)
+	if objective, ok := LatencyObjectives[t.AlertType]; ok && ms <= objective.Milliseconds() {
+		pipe.HIncrBy(ctx, key, prefix+":ok", 1)
+	}
+	pipe.Expire(ctx, key, latencyKeyTTL)
+	if t.LogID > 0 {
+		pipe.HSet(ctx, deliveryKey(t.LogID), "channel:"+channel, at.UnixMilli())
+		pipe.Expire(ctx, deliveryKey(t.LogID), latencyKeyTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ Recording alert delivery latency failed: %v", err)
+	}
+}
+
+// LatencyBucket counts the deliveries at most LeMs slow; LeMs is 0 for the
+// overflow bucket
+type LatencyBucket struct {
+	LeMs  int64 `json:"leMs"`
+	Count int64 `json:"count"`
+}
+
+// LatencyDistribution is the latency of one alert type over one channel, or
+// between two pipeline stages. Percentiles are bucket upper bounds.
+type LatencyDistribution struct {
+	AlertType string          `json:"alertType"`
+	Channel   string          `json:"channel,omitempty"`
+	Span      string          `json:"span,omitempty"`
+	Count     int64           `json:"count"`
+	MeanMs    int64           `json:"meanMs"`
+	P50Ms     int64           `json:"p50Ms"`
+	P90Ms     int64           `json:"p90Ms"`
+	P99Ms     int64           `json:"p99Ms"`
+	Buckets   []LatencyBucket `json:"buckets"`
+	// ObjectiveMs and WithinObjective are only set for end-to-end delivery
+	ObjectiveMs     int64    `json:"objectiveMs,omitempty"`
+	WithinObjective *float64 `json:"withinObjective,omitempty"`
+}
+
+// LatencyReport is the delivery latency over the last Days days
+type LatencyReport struct {
+	Days     int                   `json:"days"`
+	Delivery []LatencyDistribution `json:"delivery"`
+	Stages   []LatencyDistribution `json:"stages"`
+}
+
+// DeliveryLatencyReport sums the latency histograms of the last days days
+// (clamped to 1..7)
+func DeliveryLatencyReport(ctx context.Context, conn *data.Conn, days int) (*LatencyReport, error) {
+	if days < 1 {
+		days = 1
+	}
+	if days > 7 {
+		days = 7
+	}
+	totals := map[string]int64{}
+	now := time.Now()
+	for i := 0; i < days; i++ {
+		counts, err := conn.Cache.HGetAll(ctx, latencyKey(now.AddDate(0, 0, -i))).Result()
+		if err != nil {
+			return nil, fmt.Errorf("reading alert latency: %w", err)
+		}
+		for field, count := range counts {
+			n, _ := strconv.ParseInt(count, 10, 64)
+			totals[field] += n
+		}
+	}
+
+	report := &LatencyReport{Days: days, Delivery: []LatencyDistribution{}, Stages: []LatencyDistribution{}}
+	for field, count := range totals {
+		prefix, ok := strings.CutSuffix(field, ":count")
+		if !ok {
+			continue
+		}
+		dist := distribution(totals, prefix, count)
+		parts := strings.SplitN(prefix, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		dist.AlertType = parts[1]
+		if parts[0] == "e2e" {
+			dist.Channel = parts[2]
+			if objective, ok := LatencyObjectives[dist.AlertType]; ok {
+				share := float64(totals[prefix+":ok"]) / float64(count)
+				dist.ObjectiveMs = objective.Milliseconds()
+				dist.WithinObjective = &share
+			}
+			report.Delivery = append(report.Delivery, dist)
+		} else {
+			dist.Span = parts[2]
+			report.Stages = append(report.Stages, dist)
+		}
+	}
+	sortDistributions(report.Delivery)
+	sortDistributions(report.Stages)
+	return report, nil
+}
+
+func distribution(totals map[string]int64, prefix string, count int64) LatencyDistribution {
+	dist := LatencyDistribution{Count: count, MeanMs: totals[prefix+":sum"] / count}
+	percentiles := []struct {
+		share float64
+		dst   *int64
+	}{{0.5, &dist.P50Ms}, {0.9, &dist.P90Ms}, {0.99, &dist.P99Ms}}
+
+	var seen int64
+	next := 0
+	for _, le := range append(append([]int64{}, latencyBuckets...), 0) {
+		field, bound := prefix+":inf", latencyBuckets[len(latencyBuckets)-1]
+		if le > 0 {
+			field, bound = prefix+":"+strconv.FormatInt(le, 10), le
+		}
+		seen += totals[field]
+		dist.Buckets = append(dist.Buckets, LatencyBucket{LeMs: le, Count: totals[field]})
+		// Deliveries past the last bound report it as their percentile
+		for next < len(percentiles) && float64(seen) >= percentiles[next].share*float64(count) {
+			*percentiles[next].dst = bound
+			next++
+		}
+	}
+	return dist
+}
+
+func sortDistributions(dists []LatencyDistribution) {
+	sort.Slice(dists, func(i, j int) bool {
+		if dists[i].AlertType != dists[j].AlertType {
+			return dists[i].AlertType < dists[j].AlertType
+		}
+		if dists[i].Channel != dists[j].Channel {
+			return dists[i].Channel < dists[j].Channel
+		}
+		return stageOrder(dists[i].Span) < stageOrder(dists[j].Span)
+	})
+}
+
+// stageOrder sorts a span ("<from> to <to>") by where it starts in the pipeline
+func stageOrder(span string) int {
+	from, _, _ := strings.Cut(span, " to ")
+	for i, stage := range pipelineStages {
+		if stage == from {
+			return i
+		}
+	}
+	return len(pipelineStages)
+}
+
+// StageTime is when a delivery passed a pipeline stage
+type StageTime struct {
+	Stage           string    `json:"stage"`
+	At              time.Time `json:"at"`
+	SincePreviousMs int64     `json:"sincePreviousMs"`
+}
+
+// ChannelDelivery is when a channel handed an alert on
+type ChannelDelivery struct {
+	Channel       string    `json:"channel"`
+	At            time.Time `json:"at"`
+	DeliveredInMs int64     `json:"deliveredInMs"`
+}
+
+// DeliveryDetail explains how long one logged alert took to deliver
+type DeliveryDetail struct {
+	LogID     int               `json:"logId"`
+	AlertType string            `json:"alertType"`
+	Stages    []StageTime       `json:"stages"`
+	Channels  []ChannelDelivery `json:"channels"`
+}
+
+// DeliveryLatency returns the trace of a logged alert, or nil when none was
+// kept (older than a week or logged before traces were recorded)
+func DeliveryLatency(ctx context.Context, conn *data.Conn, logID int) (*DeliveryDetail, error) {
+	fields, err := conn.Cache.HGetAll(ctx, deliveryKey(logID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("reading alert delivery trace: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	detail := &DeliveryDetail{LogID: logID, AlertType: fields["type"], Stages: []StageTime{}, Channels: []ChannelDelivery{}}
+	var start, prev time.Time
+	for _, stage := range pipelineStages {
+		ms, err := strconv.ParseInt(fields[stage], 10, 64)
+		if err != nil {
+			continue
+		}
+		at := time.UnixMilli(ms)
+		st := StageTime{Stage: stage, At: at}
+		if prev.IsZero() {
+			start = at
+		} else {
+			st.SincePreviousMs = at.Sub(prev).Milliseconds()
+		}
+		detail.Stages = append(detail.Stages, st)
+		prev = at
+	}
+	for field, value := range fields {
+		channel, ok := strings.CutPrefix(field, "channel:")
+		if !ok {
+			continue
+		}
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		at := time.UnixMilli(ms)
+		detail.Channels = append(detail.Channels, ChannelDelivery{Channel: channel, At: at, DeliveredInMs: at.Sub(start).Milliseconds()})
+	}
+	sort.Slice(detail.Channels, func(i, j int) bool { return detail.Channels[i].At.Before(detail.Channels[j].At) })
+	return detail, nil
+}
+
+// logLatencyMetrics logs today's end-to-end delivery latency per channel
+func logLatencyMetrics(conn *data.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	report, err := DeliveryLatencyReport(ctx, conn, 1)
+	if err != nil {
+		log.Printf("⚠️ Alert latency metrics unavailable: %v", err)
+		return
+	}
+	for _, d := range report.Delivery {
+		within := ""
+		if d.WithinObjective != nil {
+			within = fmt.Sprintf(", %.1f%% within %s", *d.WithinObjective*100, time.Duration(d.ObjectiveMs)*time.Millisecond)
+		}
+		log.Printf("📊 Alert latency %s via %s - %d deliveries, p50 ≤%dms, p90 ≤%dms, p99 ≤%dms%s",
+			d.AlertType, d.Channel, d.Count, d.P50Ms, d.P90Ms, d.P99Ms, within)
+	}
+}
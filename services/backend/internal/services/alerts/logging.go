@@ -21,16 +21,17 @@ type AlertLogEntry struct {
 	Payload   map[string]interface{} `json:"payload"`
 }
 
-// LogAlert logs an alert event to the unified alert_logs table
-func LogAlert(conn *data.Conn, userID int, alertType string, relatedID int, message string, payload map[string]interface{}) error {
+// LogAlert logs an alert event to the unified alert_logs table and returns the
+// log ID, which notifications carry so the user can say whether it was useful
+func LogAlert(conn *data.Conn, userID int, alertType string, relatedID int, message string, payload map[string]interface{}) (int, error) {
 	if alertType != "price" && alertType != "strategy" {
-		return fmt.Errorf("invalid alert type: %s, must be 'price' or 'strategy'", alertType)
+		return 0, fmt.Errorf("invalid alert type: %s, must be 'price' or 'strategy'", alertType)
 	}
 
 	// Convert payload to JSON
 	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+		return 0, fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
 	// Determine ticker value for column
@@ -43,14 +44,18 @@ func LogAlert(conn *data.Conn, userID int, alertType string, relatedID int, mess
 	query := `
 		INSERT INTO alert_logs (user_id, alert_type, related_id, ticker, message, payload)
 		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING log_id
 	`
 
-	_, err = data.ExecWithRetry(context.Background(), conn.DB, query, userID, alertType, relatedID, tickerValue, message, string(payloadJSON))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var logID int
+	err = conn.DB.QueryRow(ctx, query, userID, alertType, relatedID, tickerValue, message, string(payloadJSON)).Scan(&logID)
 	if err != nil {
-		return fmt.Errorf("failed to log alert: %w", err)
+		return 0, fmt.Errorf("failed to log alert: %w", err)
 	}
 
-	return nil
+	return logID, nil
 }
 
 // GetAlertLogs retrieves alert logs for a user from the unified alert_logs table
@@ -111,7 +116,7 @@ func GetAlertLogs(conn *data.Conn, userID int, alertType string) ([]AlertLogEntr
 }
 
 // LogPriceAlert is a convenience function for logging price alerts
-func LogPriceAlert(conn *data.Conn, userID, alertID int, ticker string, securityID int, message string) error {
+func LogPriceAlert(conn *data.Conn, userID, alertID int, ticker string, securityID int, message string) (int, error) {
 	payload := map[string]interface{}{
 		"ticker":     ticker,
 		"securityId": securityID,
@@ -120,7 +125,7 @@ func LogPriceAlert(conn *data.Conn, userID, alertID int, ticker string, security
 }
 
 // LogStrategyAlert is a convenience function for logging strategy alerts
-func LogStrategyAlert(conn *data.Conn, userID, strategyID int, strategyName string, message string, additionalData map[string]interface{}) error {
+func LogStrategyAlert(conn *data.Conn, userID, strategyID int, strategyName string, message string, additionalData map[string]interface{}) (int, error) {
 	payload := map[string]interface{}{
 		"strategyName": strategyName,
 	}
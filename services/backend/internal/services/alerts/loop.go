@@ -3,20 +3,33 @@
 package alerts
 
 import (
+	"backend/internal/breaker"
+	"backend/internal/clock"
 	"backend/internal/data"
 	"backend/internal/data/postgres"
 	"backend/internal/queue"
 	"strings"
 
 	"backend/internal/app/limits"
+	"backend/internal/app/screener"
+	"backend/internal/app/strategy"
+	"backend/internal/services/chartimage"
+	"backend/internal/services/flags"
+	"backend/internal/services/marketstatus"
 	"backend/internal/services/socket"
+	"backend/internal/services/templates"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"regexp"
 	"strconv"
 	"sync"
 	"time"
+
+	"github.com/jackc/pgx/v4"
 )
 
 // bucketStart calculates the start time of the bucket that contains the given time
@@ -126,8 +139,13 @@ func bucketStart(t time.Time, tf string) (time.Time, error) {
 
 // isPerTickerThrottleEnabled checks if the per-ticker throttling feature is enabled
 func isPerTickerThrottleEnabled() bool {
-	return true
-	//return strings.ToLower(os.Getenv("PER_TICKER_THROTTLE")) == "true"
+	return flags.IsEnabled(context.Background(), flags.PerTickerThrottle, 0)
+}
+
+// scanStrategiesWhenMarketClosed reports whether strategy alerts keep scanning while
+// the market is closed or on a holiday (STRATEGY_ALERTS_WHEN_CLOSED=true)
+func scanStrategiesWhenMarketClosed() bool {
+	return strings.ToLower(os.Getenv("STRATEGY_ALERTS_WHEN_CLOSED")) == "true"
 }
 
 // AlertService encapsulates the alert system and its state
@@ -137,9 +155,11 @@ type AlertService struct {
 	stopChan       chan struct{}
 	mutex          sync.RWMutex
 	wg             sync.WaitGroup
-	priceAlerts    sync.Map // key: alertID, value: PriceAlert
-	strategyAlerts sync.Map // key: strategyID, value: StrategyAlert
+	priceAlerts    sync.Map       // key: alertID, value: PriceAlert
+	strategyAlerts sync.Map       // key: strategyID, value: StrategyAlert
+	strategyWheel  *strategyWheel // which strategy alerts are due on each scan tick
 	alertsMutex    sync.Mutex
+	clock          clock.Clock // drives the loops, bucket throttling and trigger times
 }
 
 // Global instance of the service
@@ -153,12 +173,29 @@ func GetAlertService() *AlertService {
 
 	if alertService == nil {
 		alertService = &AlertService{
-			stopChan: make(chan struct{}),
+			stopChan:      make(chan struct{}),
+			strategyWheel: newStrategyWheel(),
+			clock:         clock.Default(),
 		}
 	}
 	return alertService
 }
 
+// SetClock replaces the service's clock; call it before Start
+func (a *AlertService) SetClock(c clock.Clock) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.clock = c
+}
+
+// now reads the service's clock
+func (a *AlertService) now() time.Time {
+	if a.clock == nil {
+		return time.Now()
+	}
+	return a.clock.Now()
+}
+
 // Start initializes and starts the alert service (idempotent)
 func (a *AlertService) Start(conn *data.Conn) error {
 	a.mutex.Lock()
@@ -179,6 +216,7 @@ func (a *AlertService) Start(conn *data.Conn) error {
 		return fmt.Errorf("failed to initialize Telegram bot: %w", err)
 
 	}
+	startTelegramUpdates(conn)
 
 	// Initialize price and strategy alerts
 	log.Printf("🚀 Initializing price alerts")
@@ -197,12 +235,17 @@ func (a *AlertService) Start(conn *data.Conn) error {
 	a.isRunning = true
 
 	// Start the alert processing goroutines
-	a.wg.Add(4) // Adding one more for cleanup scheduling
+	a.initEscalations()
+	a.wg.Add(8) // Adding one more for cleanup scheduling
 	log.Printf("🚀 Starting price alert loop")
 	go a.priceAlertLoop()
 	go a.strategyAlertLoop()
-	go a.metricsLoop() // Metrics logging goroutine
-	go a.cleanupLoop() // New cleanup scheduling goroutine
+	go a.metricsLoop()    // Metrics logging goroutine
+	go a.cleanupLoop()    // New cleanup scheduling goroutine
+	go a.escalationLoop() // Sends unacknowledged alerts over further channels
+	go a.outboxLoop()     // Retries notifications a failed or interrupted dispatch left undelivered
+	go a.summaryLoop()    // Sends notifications held back by rate limits as one summary per window
+	go a.canaryLoop()     // Probes the price alert and backtest pipelines end to end
 
 	log.Printf("✅ Alert service started")
 	return nil
@@ -239,24 +282,6 @@ func (a *AlertService) IsRunning() bool {
 	return a.isRunning
 }
 
-// WorkerStrategyAlertResult represents the result from a strategy alert execution
-type WorkerStrategyAlertResult struct {
-	Success         bool               `json:"success"`
-	StrategyID      int                `json:"strategy_id"`
-	ExecutionMode   string             `json:"execution_mode"`
-	Matches         []WorkerAlertMatch `json:"alerts"`
-	ExecutionTimeMs int                `json:"execution_time_ms"`
-	ErrorMessage    string             `json:"error,omitempty"`
-}
-
-type WorkerAlertMatch struct {
-	Symbol       string                 `json:"symbol"`
-	Score        float64                `json:"score,omitempty"`
-	CurrentPrice float64                `json:"current_price,omitempty"`
-	Sector       string                 `json:"sector,omitempty"`
-	Data         map[string]interface{} `json:"data,omitempty"`
-}
-
 // PriceAlert represents a price-based alert for a single security.
 type PriceAlert struct {
 	AlertID    int
@@ -265,6 +290,9 @@ type PriceAlert struct {
 	Direction  *bool
 	SecurityID *int
 	Ticker     *string
+	VWAPAnchor *time.Time // set for anchored VWAP cross alerts; Price then tracks the VWAP
+	Trendline  *Trendline // set for trendline cross alerts; Price then tracks the projected line
+	Canary     bool       // the synthetic price canary; its trigger is timed, not dispatched
 }
 
 // StrategyAlert represents an alert condition for a user-defined strategy.
@@ -275,8 +303,15 @@ type StrategyAlert struct {
 	Threshold    float64
 	Universe     string
 	Active       bool
-	MinTimeframe string
+	MinTimeframe string   // the trigger timeframe, Timeframes[0]
+	Timeframes   []string // every timeframe its conditions use, finest first
 	LastTrigger  time.Time
+	Interval     time.Duration // how often it is evaluated, at least its plan's minimum
+	SectorTopN   int           // notify only each sector's best N matches; 0 notifies all
+
+	// UniverseFilters is the screen the universe is resolved from at each
+	// evaluation, when it was defined as one
+	UniverseFilters []screener.Filter
 }
 
 var (
@@ -320,10 +355,69 @@ func AddPriceAlert(conn *data.Conn, alert PriceAlert) {
 	priceAlerts.Store(alert.AlertID, alert)
 }
 
+// priceAlertQuery selects the columns scanPriceAlert reads. Every PriceAlert
+// in memory comes from a row read through it, so the API layer never builds
+// one itself.
+const priceAlertQuery = `
+        SELECT a.alertId, a.userId, a.price, a.direction, a.securityId, a.vwap_anchor,
+               a.drawing_id, d.points
+        FROM alerts a
+        LEFT JOIN chart_drawings d ON d.id = a.drawing_id`
+
+// errBadTrendline marks an alert whose drawing no longer describes a line
+var errBadTrendline = errors.New("unusable trendline")
+
+// scanPriceAlert reads a row selected by priceAlertQuery. The ticker is left
+// for the caller to resolve.
+func scanPriceAlert(row pgx.Row) (PriceAlert, error) {
+	var alert PriceAlert
+	var drawingID *int
+	var drawingPoints []byte
+	if err := row.Scan(
+		&alert.AlertID,
+		&alert.UserID,
+		&alert.Price,
+		&alert.Direction,
+		&alert.SecurityID,
+		&alert.VWAPAnchor,
+		&drawingID,
+		&drawingPoints,
+	); err != nil {
+		return alert, fmt.Errorf("scanning price alert row: %w", err)
+	}
+	if drawingID != nil {
+		line, err := ParseTrendline(*drawingID, drawingPoints)
+		if err != nil {
+			return alert, fmt.Errorf("%w: %v", errBadTrendline, err)
+		}
+		alert.Trendline = line
+	}
+	return alert, nil
+}
+
+// LoadPriceAlert brings the in-memory copy of a price alert in line with its
+// row after the row was written: an active alert is (re)stored, anything else
+// is dropped from memory
+func LoadPriceAlert(conn *data.Conn, alertID int) error {
+	row := conn.DB.QueryRow(context.Background(), priceAlertQuery+` WHERE a.alertId = $1 AND a.active = true`, alertID)
+	alert, err := scanPriceAlert(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		RemovePriceAlertFromMemory(alertID)
+		return nil
+	}
+	if err != nil {
+		RemovePriceAlertFromMemory(alertID)
+		return fmt.Errorf("loading price alert %d: %w", alertID, err)
+	}
+	AddPriceAlert(conn, alert)
+	return nil
+}
+
 // AddStrategyAlert adds a strategy alert to the service's in-memory store
 func AddStrategyAlert(alert StrategyAlert) {
 	service := GetAlertService()
 	service.strategyAlerts.Store(alert.StrategyID, alert)
+	service.strategyWheel.schedule(alert.StrategyID, alert.Interval)
 
 	// Also update legacy global map for backward compatibility
 	strategyAlerts.Store(alert.StrategyID, alert)
@@ -349,6 +443,8 @@ func RemovePriceAlert(conn *data.Conn, alertID int) error {
 	}
 
 	service.priceAlerts.Delete(alertID)
+	vwapLevels.Delete(alertID)
+	trendlineRefreshedAt.Delete(alertID)
 
 	// Also remove from legacy global map for backward compatibility
 	priceAlerts.Delete(alertID)
@@ -375,6 +471,7 @@ func RemoveStrategyAlert(conn *data.Conn, strategyID int) error {
 	}
 
 	service.strategyAlerts.Delete(strategyID)
+	service.strategyWheel.remove(strategyID)
 
 	// Also remove from legacy global map for backward compatibility
 	strategyAlerts.Delete(strategyID)
@@ -388,6 +485,8 @@ func RemovePriceAlertFromMemory(alertID int) {
 	service.alertsMutex.Lock()
 	defer service.alertsMutex.Unlock()
 	service.priceAlerts.Delete(alertID)
+	vwapLevels.Delete(alertID)
+	trendlineRefreshedAt.Delete(alertID)
 
 	// Also remove from legacy global map for backward compatibility
 	priceAlerts.Delete(alertID)
@@ -400,6 +499,7 @@ func RemoveStrategyAlertFromMemory(strategyID int) {
 	service.alertsMutex.Lock()
 	defer service.alertsMutex.Unlock()
 	service.strategyAlerts.Delete(strategyID)
+	service.strategyWheel.remove(strategyID)
 
 	// Also remove from legacy global map for backward compatibility
 	strategyAlerts.Delete(strategyID)
@@ -409,7 +509,7 @@ func RemoveStrategyAlertFromMemory(strategyID int) {
 func (a *AlertService) priceAlertLoop() {
 	defer a.wg.Done()
 
-	ticker := time.NewTicker(priceAlertFrequency)
+	ticker := a.clock.NewTicker(priceAlertFrequency)
 	defer ticker.Stop()
 
 	for {
@@ -418,7 +518,7 @@ func (a *AlertService) priceAlertLoop() {
 			log.Printf("📡 Price alert loop stopped by stop signal")
 			return
 		case <-ticker.C:
-			a.processPriceAlerts()
+			timeLoop("price", priceAlertFrequency, a.processPriceAlerts)
 		}
 	}
 }
@@ -427,9 +527,10 @@ func (a *AlertService) priceAlertLoop() {
 func (a *AlertService) strategyAlertLoop() {
 	defer a.wg.Done()
 
-	ticker := time.NewTicker(strategyAlertFrequency)
+	ticker := a.clock.NewTicker(strategyAlertFrequency)
 	defer ticker.Stop()
 	log.Printf("Starting strategy alert loop with frequency: %v", strategyAlertFrequency)
+	lastRefresh := a.clock.Now()
 
 	for {
 		select {
@@ -437,20 +538,60 @@ func (a *AlertService) strategyAlertLoop() {
 			log.Printf("📡 Strategy alert loop stopped by stop signal")
 			return
 		case <-ticker.C:
-			log.Printf("Processing strategy alerts - checking %d active alerts", a.getStrategyAlertCount())
-			startTime := time.Now()
-			a.processStrategyAlerts()
-			duration := time.Since(startTime)
+			// Strategy scans are deferred while their dependencies are failing;
+			// price alerts keep running. The wheel isn't advanced, so the
+			// strategies due meanwhile run once the scan resumes.
+			if !breaker.Postgres.Healthy() || !breaker.Redis.Healthy() {
+				log.Printf("⚠️ Deferring strategy alert scan: postgres or redis is degraded")
+				continue
+			}
+			if a.clock.Since(lastRefresh) >= strategyAlertRefreshInterval {
+				if err := a.refreshStrategyAlerts(); err != nil {
+					log.Printf("⚠️ Failed to refresh strategy alerts: %v", err)
+				}
+				lastRefresh = a.clock.Now()
+			}
+			due := a.dueStrategyAlerts()
+			if len(due) == 0 {
+				continue
+			}
+			log.Printf("Processing strategy alerts - %d of %d active alerts due", len(due), a.getStrategyAlertCount())
+			startTime := a.clock.Now()
+			timeLoop("strategy", strategyAlertFrequency, func() { a.processStrategyAlerts(due) })
+			duration := a.clock.Since(startTime)
 			log.Printf("Strategy alert processing completed in %v", duration)
 		}
 	}
 }
 
-// metricsLoop logs Redis operation metrics periodically
+// dueStrategyAlerts advances the strategy wheel and returns the alerts due on
+// this tick
+func (a *AlertService) dueStrategyAlerts() []StrategyAlert {
+	ids := a.strategyWheel.advance()
+	due := make([]StrategyAlert, 0, len(ids))
+	for _, id := range ids {
+		if value, ok := a.strategyAlerts.Load(id); ok {
+			due = append(due, value.(StrategyAlert))
+		}
+	}
+	return due
+}
+
+// retryStrategyAlerts reschedules alerts whose run was skipped for the next tick
+func (a *AlertService) retryStrategyAlerts(alerts []StrategyAlert) {
+	ids := make([]int, 0, len(alerts))
+	for _, alert := range alerts {
+		ids = append(ids, alert.StrategyID)
+	}
+	a.strategyWheel.retry(ids)
+}
+
+// metricsLoop logs Redis operation metrics periodically, then flushes them
+// into the hour's metric buckets
 func (a *AlertService) metricsLoop() {
 	defer a.wg.Done()
 
-	ticker := time.NewTicker(5 * time.Minute) // Log every 5 minutes
+	ticker := a.clock.NewTicker(5 * time.Minute) // Log every 5 minutes
 	defer ticker.Stop()
 
 	for {
@@ -459,6 +600,7 @@ func (a *AlertService) metricsLoop() {
 			log.Printf("📡 Metrics loop stopped by stop signal")
 			return
 		case <-ticker.C:
+			logLatencyMetrics(a.conn)
 			// Use enhanced metrics if per-ticker throttling is enabled
 			if isPerTickerThrottleEnabled() {
 				detailedMetrics := data.GetDetailedAlertMetrics(a.conn)
@@ -479,6 +621,7 @@ func (a *AlertService) metricsLoop() {
 				log.Printf("📊 Per-ticker throttling - Strategy runs: %d, Skipped (no update): %d, Skipped (bucket dup): %d",
 					metrics["strategy_runs"], metrics["skipped_no_update"], metrics["skipped_bucket_dup"])
 			}
+			a.flushAlertMetrics()
 		}
 	}
 }
@@ -488,11 +631,11 @@ func (a *AlertService) cleanupLoop() {
 	defer a.wg.Done()
 
 	// Run cleanup daily at 2 AM
-	ticker := time.NewTicker(24 * time.Hour)
+	ticker := a.clock.NewTicker(24 * time.Hour)
 	defer ticker.Stop()
 
 	// Run initial cleanup after 1 hour to avoid startup congestion
-	initialDelay := time.NewTimer(1 * time.Hour)
+	initialDelay := a.clock.NewTimer(1 * time.Hour)
 	defer initialDelay.Stop()
 
 	for {
@@ -520,6 +663,9 @@ func (a *AlertService) performCleanup() {
 		log.Printf("⚠️ Failed to cleanup ticker updates: %v", err)
 	}
 
+	// Finished notifications only matter for a few days of debugging
+	pruneOutbox(a.conn)
+
 	// Log current Redis data sizes for monitoring
 	if tickerCount, err := data.GetTickerUpdateCount(a.conn); err == nil {
 		log.Printf("📊 Post-cleanup: %d ticker updates tracked in Redis", tickerCount)
@@ -569,7 +715,7 @@ func (a *AlertService) processPriceAlerts() {
 		wg.Add(1)
 		go func(alert PriceAlert) {
 			defer wg.Done()
-			if err := processPriceAlert(a.conn, alert); err != nil {
+			if err := processPriceAlert(a.conn, alert, a.now()); err != nil {
 				log.Printf("Error processing price alert %d: %v", alert.AlertID, err)
 			}
 		}(alert)
@@ -578,43 +724,115 @@ func (a *AlertService) processPriceAlerts() {
 	wg.Wait()
 }
 
-// processStrategyAlerts processes all active strategy alerts
-func (a *AlertService) processStrategyAlerts() {
-	// Log currently active strategy alerts
-	var activeAlerts []string
-	a.strategyAlerts.Range(func(_, value interface{}) bool {
-		alert := value.(StrategyAlert)
-		activeAlerts = append(activeAlerts, fmt.Sprintf("ID:%d(%s)", alert.StrategyID, alert.Name))
-		return true
-	})
-	log.Printf("📊 Processing %d active strategy alerts: [%s]", len(activeAlerts), strings.Join(activeAlerts, ", "))
+// processStrategyAlerts processes the strategy alerts due on this tick
+func (a *AlertService) processStrategyAlerts(due []StrategyAlert) {
+	if !scanStrategiesWhenMarketClosed() {
+		status, err := marketstatus.Get(a.conn)
+		if err != nil {
+			log.Printf("⚠️ Market status unavailable, processing strategy alerts anyway: %v", err)
+		} else if status.Session == marketstatus.SessionClosed || status.Session == marketstatus.SessionHoliday {
+			log.Printf("⏩ Market %s, skipping strategy alert scan", status.Session)
+			now := a.now()
+			for _, alert := range due {
+				a.recordEvaluation(alert, now, data.StrategyEvaluation{
+					Outcome: data.EvalSkippedNoUpdate,
+					Reason:  fmt.Sprintf("market %s", status.Session),
+				})
+			}
+			a.retryStrategyAlerts(due)
+			return
+		}
+	}
+
+	// Strategy runs go through the task queue, which refuses them while paused
+	// or draining
+	if state, err := queue.GetControlState(context.Background(), a.conn); err == nil && state.State != queue.QueueRunning {
+		log.Printf("⏩ Task queue %s, skipping strategy alert scan", state.State)
+		now := a.now()
+		for _, alert := range due {
+			a.recordEvaluation(alert, now, data.StrategyEvaluation{
+				Outcome: data.EvalSkippedPaused,
+				Reason:  fmt.Sprintf("task queue %s", state.State),
+			})
+		}
+		a.retryStrategyAlerts(due)
+		return
+	}
+
+	// Log the strategy alerts due this tick
+	var dueAlerts []string
+	for _, alert := range due {
+		dueAlerts = append(dueAlerts, fmt.Sprintf("ID:%d(%s)", alert.StrategyID, alert.Name))
+	}
+	log.Printf("📊 Processing %d due strategy alerts: [%s]", len(dueAlerts), strings.Join(dueAlerts, ", "))
+
+	// Both throttling modes run screened alerts over what the screen matches now
+	due = a.resolveScreenedUniverses(due)
 
 	// Check if per-ticker throttling is enabled
 	usePerTickerThrottle := isPerTickerThrottleEnabled()
 	if usePerTickerThrottle {
 		log.Printf("🎯 Using per-ticker throttling mode")
-		a.processStrategyAlertsPerTicker()
+		a.processStrategyAlertsPerTicker(due)
 	} else {
 		log.Printf("🎯 Using legacy throttling mode")
-		a.processStrategyAlertsLegacy()
+		a.processStrategyAlertsLegacy(due)
 	}
 }
 
+// resolveScreenedUniverses sets the universe of each alert with a universe
+// screen to the tickers the screen matches now, and records the alert's
+// evaluation in place of running it when the screen fails or matches nothing.
+// It returns the alerts left to run.
+func (a *AlertService) resolveScreenedUniverses(due []StrategyAlert) []StrategyAlert {
+	now := a.now()
+	kept := make([]StrategyAlert, 0, len(due))
+	for _, alert := range due {
+		if len(alert.UniverseFilters) == 0 {
+			kept = append(kept, alert)
+			continue
+		}
+		tickers, err := screener.ResolveUniverse(a.conn, alert.UserID, alert.UniverseFilters, 0, "")
+		if err == nil && len(tickers) > 0 {
+			err = data.SetStrategyUniverse(a.conn, alert.StrategyID, tickers)
+		}
+		if err == nil && len(tickers) > 0 {
+			alert.Universe = fmt.Sprintf("%v", tickers)
+			kept = append(kept, alert)
+			continue
+		}
+		eval := data.StrategyEvaluation{
+			Outcome: data.EvalSkippedNoUpdate,
+			Reason:  "universe screen matched no securities",
+		}
+		if err != nil {
+			log.Printf("⚠️ Strategy %d (%s): failed to resolve its universe screen: %v",
+				alert.StrategyID, alert.Name, err)
+			eval.Outcome, eval.Reason, eval.Error = data.EvalFailed, "couldn't resolve the universe screen", err.Error()
+		}
+		a.recordEvaluation(alert, now, eval)
+		data.IncrementSkippedNoUpdate()
+	}
+	return kept
+}
+
 // processStrategyAlertsLegacy implements the original strategy-level throttling
-func (a *AlertService) processStrategyAlertsLegacy() {
+func (a *AlertService) processStrategyAlertsLegacy(due []StrategyAlert) {
+	now := a.now()
+
 	var wg sync.WaitGroup
 	var processed, succeeded, failed, skipped int
 	var mu sync.Mutex
 
-	a.strategyAlerts.Range(func(_, value interface{}) bool {
-		alert := value.(StrategyAlert)
+	for _, alert := range due {
 		wg.Add(1)
 		go func(alert StrategyAlert) {
 			defer wg.Done()
+			evaluationStart := time.Now()
 
 			// Check if we should skip this alert based on timeframe throttling
 			if !alert.LastTrigger.IsZero() && alert.MinTimeframe != "" {
-				currBucket, err := bucketStart(time.Now(), alert.MinTimeframe)
+				currBucket, err := bucketStart(now, alert.MinTimeframe)
 				if err != nil {
 					log.Printf("⚠️ Strategy %d (%s): invalid timeframe '%s', skipping throttling: %v",
 						alert.StrategyID, alert.Name, alert.MinTimeframe, err)
@@ -627,6 +845,11 @@ func (a *AlertService) processStrategyAlertsLegacy() {
 						log.Printf("⏩ Strategy %d (%s) skipped - same bucket (current: %v, last trigger: %v)",
 							alert.StrategyID, alert.Name, currBucket.Format("2006-01-02 15:04:05 MST"),
 							alert.LastTrigger.Format("2006-01-02 15:04:05 MST"))
+						a.recordEvaluation(alert, now, data.StrategyEvaluation{
+							Outcome: data.EvalSkippedBucketDup,
+							Reason:  "already triggered in this bucket",
+							Bucket:  &currBucket,
+						})
 						mu.Lock()
 						processed++
 						skipped++
@@ -637,22 +860,34 @@ func (a *AlertService) processStrategyAlertsLegacy() {
 			}
 
 			log.Printf("Processing strategy alert %d: %s (threshold: %.2f)", alert.StrategyID, alert.Name, alert.Threshold)
-			if err := executeStrategyAlert(context.Background(), a.conn, alert, nil); err != nil {
+			if err := executeStrategyAlert(context.Background(), a.conn, alert, nil, evaluationStart); err != nil {
 				log.Printf("Error processing strategy alert %d: %v", alert.StrategyID, err)
+				a.recordEvaluation(alert, now, data.StrategyEvaluation{
+					Outcome: data.EvalFailed,
+					Reason:  "strategy run failed",
+					Error:   err.Error(),
+				})
 				mu.Lock()
 				processed++
 				failed++
 				mu.Unlock()
 			} else {
 				log.Printf("Successfully processed strategy alert %d: %s", alert.StrategyID, alert.Name)
+				reason := "ran over the full universe"
+				if alert.Universe != "" && alert.Universe != "all" {
+					reason = "ran over its universe"
+				}
+				a.recordEvaluation(alert, now, data.StrategyEvaluation{
+					Outcome: data.EvalRun,
+					Reason:  reason,
+				})
 				mu.Lock()
 				processed++
 				succeeded++
 				mu.Unlock()
 			}
 		}(alert)
-		return true
-	})
+	}
 	wg.Wait()
 	log.Printf("Strategy alert processing summary: %d total, %d succeeded, %d failed, %d skipped", processed, succeeded, failed, skipped)
 }
@@ -673,19 +908,27 @@ func intersectClientSide(updatedTickers, strategyUniverse []string) []string {
 	return result
 }
 
+// recordEvaluation adds a strategy's outcome for this cycle to its evaluation
+// history, which answers why an alert did or didn't fire at a given time
+func (a *AlertService) recordEvaluation(alert StrategyAlert, now time.Time, eval data.StrategyEvaluation) {
+	if err := data.RecordStrategyEvaluation(a.conn, alert.StrategyID, now, eval); err != nil {
+		log.Printf("⚠️ Strategy %d: failed to record evaluation: %v", alert.StrategyID, err)
+	}
+}
+
 // processStrategyAlertsPerTicker implements per-ticker throttling using Redis data
-func (a *AlertService) processStrategyAlertsPerTicker() {
-	now := time.Now()
+func (a *AlertService) processStrategyAlertsPerTicker(due []StrategyAlert) {
+	now := a.now()
 
 	var wg sync.WaitGroup
 	var processed, succeeded, failed, skippedNoUpdate, skippedBucketDup int
 	var mu sync.Mutex
 
-	a.strategyAlerts.Range(func(_, value interface{}) bool {
-		alert := value.(StrategyAlert)
+	for _, alert := range due {
 		wg.Add(1)
 		go func(alert StrategyAlert) {
 			defer wg.Done()
+			evaluationStart := time.Now()
 			// DEBUG: start evaluation
 			log.Printf("🔎 Evaluating strategy %d '%s': universe='%s', lastTrigger=%v, minTimeframe='%s'",
 				alert.StrategyID, alert.Name, alert.Universe, alert.LastTrigger, alert.MinTimeframe)
@@ -694,6 +937,10 @@ func (a *AlertService) processStrategyAlertsPerTicker() {
 			if alert.MinTimeframe == "" {
 				log.Printf("⚠️ Strategy %d (%s): no min_timeframe set, skipping per-ticker throttling",
 					alert.StrategyID, alert.Name)
+				a.recordEvaluation(alert, now, data.StrategyEvaluation{
+					Outcome: data.EvalSkippedNoUpdate,
+					Reason:  "strategy has no minimum timeframe",
+				})
 				mu.Lock()
 				processed++
 				skippedNoUpdate++
@@ -707,6 +954,11 @@ func (a *AlertService) processStrategyAlertsPerTicker() {
 			if err != nil {
 				log.Printf("⚠️ Strategy %d (%s): invalid timeframe '%s', skipping: %v",
 					alert.StrategyID, alert.Name, alert.MinTimeframe, err)
+				a.recordEvaluation(alert, now, data.StrategyEvaluation{
+					Outcome: data.EvalSkippedNoUpdate,
+					Reason:  fmt.Sprintf("invalid timeframe %q", alert.MinTimeframe),
+					Error:   err.Error(),
+				})
 				mu.Lock()
 				processed++
 				skippedNoUpdate++
@@ -721,6 +973,12 @@ func (a *AlertService) processStrategyAlertsPerTicker() {
 			if err != nil {
 				log.Printf("⚠️ Strategy %d (%s): failed GetTickersUpdatedSince: %v",
 					alert.StrategyID, alert.Name, err)
+				a.recordEvaluation(alert, now, data.StrategyEvaluation{
+					Outcome: data.EvalFailed,
+					Reason:  "couldn't read updated tickers",
+					Bucket:  &currBucket,
+					Error:   err.Error(),
+				})
 				mu.Lock()
 				processed++
 				skippedNoUpdate++
@@ -738,6 +996,11 @@ func (a *AlertService) processStrategyAlertsPerTicker() {
 					if err == nil && currBucket.Equal(lastBucket) {
 						log.Printf("⏩ Global strategy %d (%s) skipped - same bucket",
 							alert.StrategyID, alert.Name)
+						a.recordEvaluation(alert, now, data.StrategyEvaluation{
+							Outcome: data.EvalSkippedBucketDup,
+							Reason:  "already triggered in this bucket",
+							Bucket:  &currBucket,
+						})
 						mu.Lock()
 						processed++
 						skippedBucketDup++
@@ -750,14 +1013,25 @@ func (a *AlertService) processStrategyAlertsPerTicker() {
 				// Run global strategy without ticker filtering
 				log.Printf("🌍 Processing global strategy %d: %s", alert.StrategyID, alert.Name)
 				data.IncrementStrategyRuns()
-				if err := executeStrategyAlert(context.Background(), a.conn, alert, nil); err != nil {
+				if err := executeStrategyAlert(context.Background(), a.conn, alert, nil, evaluationStart); err != nil {
 					log.Printf("Error processing global strategy %d: %v", alert.StrategyID, err)
+					a.recordEvaluation(alert, now, data.StrategyEvaluation{
+						Outcome: data.EvalFailed,
+						Reason:  "strategy run failed",
+						Bucket:  &currBucket,
+						Error:   err.Error(),
+					})
 					mu.Lock()
 					processed++
 					failed++
 					mu.Unlock()
 				} else {
 					log.Printf("Successfully processed global strategy %d: %s", alert.StrategyID, alert.Name)
+					a.recordEvaluation(alert, now, data.StrategyEvaluation{
+						Outcome: data.EvalRun,
+						Reason:  "ran over the full universe",
+						Bucket:  &currBucket,
+					})
 					mu.Lock()
 					processed++
 					succeeded++
@@ -771,6 +1045,12 @@ func (a *AlertService) processStrategyAlertsPerTicker() {
 			if err != nil {
 				log.Printf("⚠️ Strategy %d (%s): Redis SMEMBERS failed: %v",
 					alert.StrategyID, alert.Name, err)
+				a.recordEvaluation(alert, now, data.StrategyEvaluation{
+					Outcome: data.EvalFailed,
+					Reason:  "couldn't read the strategy universe",
+					Bucket:  &currBucket,
+					Error:   err.Error(),
+				})
 				mu.Lock()
 				processed++
 				skippedNoUpdate++
@@ -783,6 +1063,11 @@ func (a *AlertService) processStrategyAlertsPerTicker() {
 			if len(strategyUniverse) == 0 {
 				log.Printf("⚠️ Strategy %d (%s): empty universe in Redis, skipping",
 					alert.StrategyID, alert.Name)
+				a.recordEvaluation(alert, now, data.StrategyEvaluation{
+					Outcome: data.EvalSkippedNoUpdate,
+					Reason:  "strategy universe is empty",
+					Bucket:  &currBucket,
+				})
 				mu.Lock()
 				processed++
 				skippedNoUpdate++
@@ -818,6 +1103,11 @@ func (a *AlertService) processStrategyAlertsPerTicker() {
 			if len(changedTickers) == 0 {
 				log.Printf("⏩ Strategy %d (%s) skipped - no universe tickers updated (%d universe, %d updated)",
 					alert.StrategyID, alert.Name, len(strategyUniverse), len(updatedTickers))
+				a.recordEvaluation(alert, now, data.StrategyEvaluation{
+					Outcome: data.EvalSkippedNoUpdate,
+					Reason:  "no universe tickers updated since the bucket started",
+					Bucket:  &currBucket,
+				})
 				mu.Lock()
 				processed++
 				skippedNoUpdate++
@@ -847,6 +1137,11 @@ func (a *AlertService) processStrategyAlertsPerTicker() {
 			if len(finalTickers) == 0 {
 				log.Printf("⏩ Strategy %d (%s) skipped - all changed tickers already triggered in bucket (%d changed, 0 final)",
 					alert.StrategyID, alert.Name, len(changedTickers))
+				a.recordEvaluation(alert, now, data.StrategyEvaluation{
+					Outcome: data.EvalSkippedBucketDup,
+					Reason:  "every updated ticker already triggered in this bucket",
+					Bucket:  &currBucket,
+				})
 				mu.Lock()
 				processed++
 				skippedBucketDup++
@@ -856,14 +1151,27 @@ func (a *AlertService) processStrategyAlertsPerTicker() {
 			}
 
 			data.IncrementStrategyRuns()
-			if err := executeStrategyAlert(context.Background(), a.conn, alert, finalTickers); err != nil {
+			if err := executeStrategyAlert(context.Background(), a.conn, alert, finalTickers, evaluationStart); err != nil {
 				log.Printf("Error processing strategy %d: %v", alert.StrategyID, err)
+				a.recordEvaluation(alert, now, data.StrategyEvaluation{
+					Outcome: data.EvalFailed,
+					Reason:  "strategy run failed",
+					Bucket:  &currBucket,
+					Tickers: len(finalTickers),
+					Error:   err.Error(),
+				})
 				mu.Lock()
 				processed++
 				failed++
 				mu.Unlock()
 			} else {
 				log.Printf("Successfully processed strategy %d: %s", alert.StrategyID, alert.Name)
+				a.recordEvaluation(alert, now, data.StrategyEvaluation{
+					Outcome: data.EvalRun,
+					Reason:  "ran over the updated tickers",
+					Bucket:  &currBucket,
+					Tickers: len(finalTickers),
+				})
 
 				// Update last trigger buckets for successful execution
 				tickerBuckets := make(map[string]int64)
@@ -880,8 +1188,7 @@ func (a *AlertService) processStrategyAlertsPerTicker() {
 				mu.Unlock()
 			}
 		}(alert)
-		return true
-	})
+	}
 	wg.Wait()
 	log.Printf("Per-ticker strategy alert summary: %d total, %d succeeded, %d failed, %d skipped (no update), %d skipped (bucket dup)",
 		processed, succeeded, failed, skippedNoUpdate, skippedBucketDup)
@@ -891,13 +1198,7 @@ func (a *AlertService) processStrategyAlertsPerTicker() {
 func (a *AlertService) initPriceAlerts() error {
 	ctx := context.Background()
 
-	// Load active price alerts
-	query := `
-        SELECT alertId, userId, price, direction, securityId
-        FROM alerts
-        WHERE active = true
-    `
-	rows, err := a.conn.DB.Query(ctx, query)
+	rows, err := a.conn.DB.Query(ctx, priceAlertQuery+` WHERE a.active = true`)
 	if err != nil {
 		return fmt.Errorf("querying active price alerts: %w", err)
 	}
@@ -905,16 +1206,13 @@ func (a *AlertService) initPriceAlerts() error {
 
 	a.priceAlerts = sync.Map{}
 	for rows.Next() {
-		var alert PriceAlert
-		err := rows.Scan(
-			&alert.AlertID,
-			&alert.UserID,
-			&alert.Price,
-			&alert.Direction,
-			&alert.SecurityID,
-		)
+		alert, err := scanPriceAlert(rows)
+		if errors.Is(err, errBadTrendline) {
+			log.Printf("⚠️ Skipping trendline alert %d: %v", alert.AlertID, err)
+			continue
+		}
 		if err != nil {
-			return fmt.Errorf("scanning price alert row: %w", err)
+			return err
 		}
 
 		ticker, err := postgres.GetTicker(a.conn, *alert.SecurityID, time.Now())
@@ -937,56 +1235,104 @@ func (a *AlertService) initPriceAlerts() error {
 	return nil
 }
 
-// initStrategyAlerts initializes strategy alerts from the database
-func (a *AlertService) initStrategyAlerts() error {
-	ctx := context.Background()
-	log.Printf("🚀 Initializing strategy alerts")
+// strategyAlertQuery selects active strategy alerts with what they run on
+// and how often; scanStrategyAlert reads its rows
+const strategyAlertQuery = `
+	SELECT s.strategyId, s.userId, s.name,
+	       COALESCE(s.alert_threshold, 0.0) as alert_threshold,
+	       COALESCE(s.alert_universe, ARRAY[]::TEXT[]) as alert_universe,
+	       COALESCE(s.min_timeframe, '1d') as min_timeframe,
+	       COALESCE(s.alert_timeframes, ARRAY[]::TEXT[]) as alert_timeframes,
+	       s.alert_last_trigger_at,
+	       s.alert_interval_seconds,
+	       sp.min_strategy_alert_interval_seconds,
+	       COALESCE(s.alert_sector_top_n, 0) as alert_sector_top_n,
+	       s.alert_universe_filters
+	FROM strategies s
+	LEFT JOIN users u ON u.userId = s.userId
+	LEFT JOIN subscription_products sp ON sp.product_key = u.subscription_plan
+	WHERE s.alertActive = true
+	ORDER BY s.strategyId
+`
+
+func scanStrategyAlert(row pgx.Row) (StrategyAlert, error) {
+	var alert StrategyAlert
+	var alertUniverse, timeframes []string
+	var lastTrigger *time.Time
+	var intervalSeconds, planMinSeconds *int
+	var universeFilters []byte
+	err := row.Scan(&alert.StrategyID, &alert.UserID, &alert.Name, &alert.Threshold, &alertUniverse, &alert.MinTimeframe,
+		&timeframes, &lastTrigger, &intervalSeconds, &planMinSeconds, &alert.SectorTopN, &universeFilters)
+	if err != nil {
+		return alert, fmt.Errorf("scanning strategy alert row: %w", err)
+	}
+	if universeFilters != nil {
+		if err := json.Unmarshal(universeFilters, &alert.UniverseFilters); err != nil {
+			return alert, fmt.Errorf("reading strategy %d universe filters: %w", alert.StrategyID, err)
+		}
+	}
+	alert.Active = true
+	alert.Interval = strategyAlertInterval(intervalSeconds, planMinSeconds)
+	// The finest timeframe triggers the alert, whichever was saved as minimum
+	alert.Timeframes = alertTimeframes(timeframes, alert.MinTimeframe)
+	if len(alert.Timeframes) > 0 {
+		alert.MinTimeframe = alert.Timeframes[0]
+	}
 
-	// Load active strategy alerts with configuration
-	query := `
-		SELECT strategyId, userId, name, 
-		       COALESCE(alert_threshold, 0.0) as alert_threshold,
-		       COALESCE(alert_universe, ARRAY[]::TEXT[]) as alert_universe,
-		       COALESCE(min_timeframe, '1d') as min_timeframe,
-		       alert_last_trigger_at
-		FROM strategies 
-		WHERE alertActive = true 
-		ORDER BY strategyId
-	`
-	rows, err := a.conn.DB.Query(ctx, query)
-	log.Printf("🚀 Querying active strategy alerts")
+	// Handle nullable last trigger time
+	if lastTrigger != nil {
+		alert.LastTrigger = *lastTrigger
+	}
+
+	// Convert universe array to string representation
+	if len(alertUniverse) == 0 {
+		alert.Universe = "all"
+	} else {
+		// For now, store as comma-separated string; could be enhanced later
+		alert.Universe = fmt.Sprintf("%v", alertUniverse)
+	}
+	return alert, nil
+}
+
+// loadStrategyAlerts reads every active strategy alert
+func (a *AlertService) loadStrategyAlerts(ctx context.Context) ([]StrategyAlert, error) {
+	rows, err := a.conn.DB.Query(ctx, strategyAlertQuery)
 	if err != nil {
-		log.Printf("🚀 Error querying active strategy alerts: %v", err)
-		return fmt.Errorf("querying active strategy alerts: %w", err)
+		return nil, fmt.Errorf("querying active strategy alerts: %w", err)
 	}
 	defer rows.Close()
 
-	a.strategyAlerts = sync.Map{}
-	log.Printf("🚀 Iterating strategy alert rows")
+	var alerts []StrategyAlert
 	for rows.Next() {
-		var alert StrategyAlert
-		var alertUniverse []string
-		var lastTrigger *time.Time
-		err := rows.Scan(&alert.StrategyID, &alert.UserID, &alert.Name, &alert.Threshold, &alertUniverse, &alert.MinTimeframe, &lastTrigger)
+		alert, err := scanStrategyAlert(rows)
 		if err != nil {
-			return fmt.Errorf("scanning strategy alert row: %w", err)
+			return nil, err
 		}
-		alert.Active = true
+		alerts = append(alerts, alert)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating strategy alert rows: %w", err)
+	}
+	return alerts, nil
+}
 
-		// Handle nullable last trigger time
-		if lastTrigger != nil {
-			alert.LastTrigger = *lastTrigger
-		}
+// initStrategyAlerts initializes strategy alerts from the database
+func (a *AlertService) initStrategyAlerts() error {
+	ctx := context.Background()
+	log.Printf("🚀 Initializing strategy alerts")
 
-		// Convert universe array to string representation
-		if len(alertUniverse) == 0 {
-			alert.Universe = "all"
-		} else {
-			// For now, store as comma-separated string; could be enhanced later
-			alert.Universe = fmt.Sprintf("%v", alertUniverse)
-		}
+	log.Printf("🚀 Querying active strategy alerts")
+	alerts, err := a.loadStrategyAlerts(ctx)
+	if err != nil {
+		log.Printf("🚀 Error querying active strategy alerts: %v", err)
+		return err
+	}
 
+	a.strategyAlerts = sync.Map{}
+	a.strategyWheel.reset()
+	for _, alert := range alerts {
 		a.strategyAlerts.Store(alert.StrategyID, alert)
+		a.strategyWheel.schedule(alert.StrategyID, alert.Interval)
 
 		// Also store in legacy global map for backward compatibility
 		strategyAlerts.Store(alert.StrategyID, alert)
@@ -998,11 +1344,51 @@ func (a *AlertService) initStrategyAlerts() error {
 		}
 	}
 
-	if err = rows.Err(); err != nil {
-		return fmt.Errorf("iterating strategy alert rows: %w", err)
+	log.Printf("Finished initializing %d strategy alerts", a.getStrategyAlertCount())
+	return nil
+}
+
+// refreshStrategyAlerts brings the in-memory strategy alerts in line with the
+// database. Alerts that are new or whose interval changed are scheduled from
+// the next tick; the others keep their place on the wheel.
+func (a *AlertService) refreshStrategyAlerts() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	alerts, err := a.loadStrategyAlerts(ctx)
+	if err != nil {
+		return err
 	}
 
-	log.Printf("Finished initializing %d strategy alerts", a.getStrategyAlertCount())
+	a.alertsMutex.Lock()
+	defer a.alertsMutex.Unlock()
+	active := make(map[int]bool, len(alerts))
+	var added, rescheduled, removed int
+	for _, alert := range alerts {
+		active[alert.StrategyID] = true
+		ticks, scheduled := a.strategyWheel.interval(alert.StrategyID)
+		a.strategyAlerts.Store(alert.StrategyID, alert)
+		strategyAlerts.Store(alert.StrategyID, alert)
+		switch {
+		case !scheduled:
+			added++
+			a.strategyWheel.schedule(alert.StrategyID, alert.Interval)
+		case ticks != intervalTicks(alert.Interval):
+			rescheduled++
+			a.strategyWheel.schedule(alert.StrategyID, alert.Interval)
+		}
+	}
+	a.strategyAlerts.Range(func(key, _ interface{}) bool {
+		if id := key.(int); !active[id] {
+			removed++
+			a.strategyAlerts.Delete(id)
+			a.strategyWheel.remove(id)
+			strategyAlerts.Delete(id)
+		}
+		return true
+	})
+	if added+rescheduled+removed > 0 {
+		log.Printf("🔄 Refreshed strategy alerts: %d added, %d rescheduled, %d removed", added, rescheduled, removed)
+	}
 	return nil
 }
 
@@ -1124,13 +1510,32 @@ func (a *AlertService) syncStrategyUniverseToRedis(strategyID int) error {
 	}
 }*/
 
-// executeStrategyAlert submits a strategy alert task and waits for results
-func executeStrategyAlert(ctx context.Context, conn *data.Conn, strategy StrategyAlert, tickers []string) error {
+// strategyRuleFooter is the strategy's entry rule in plain English, shown
+// under its notifications so a match can be read without opening the code. A
+// rule that can't be loaded is left out rather than holding up the alert.
+func strategyRuleFooter(ctx context.Context, conn *data.Conn, strategyID int) string {
+	rule, err := strategy.ExplainStrategyRule(ctx, conn, strategyID)
+	if err != nil {
+		log.Printf("⚠️ Strategy %d: notifying without its rule: %v", strategyID, err)
+		return ""
+	}
+	return rule
+}
+
+// executeStrategyAlert submits a strategy alert task and waits for results.
+// evaluationStart is when the loop began evaluating the strategy this cycle.
+func executeStrategyAlert(ctx context.Context, conn *data.Conn, strategy StrategyAlert, tickers []string, evaluationStart time.Time) error {
 	// Prepare arguments expected by the Python worker (see services/worker/src/alert.py)
+	now := GetAlertService().now()
 	args := map[string]interface{}{
 		"strategy_id": strategy.StrategyID,
 		"user_id":     strategy.UserID,
 	}
+	if timeframes, err := timeframeTaskArgs(strategy, now); err != nil {
+		log.Printf("⚠️ Strategy %d (%s): evaluating without timeframe buckets: %v", strategy.StrategyID, strategy.Name, err)
+	} else if timeframes != nil {
+		args["timeframes"] = timeframes
+	}
 
 	// Use provided tickers if available (per-ticker throttling mode), otherwise parse universe
 	if len(tickers) > 0 {
@@ -1167,12 +1572,44 @@ func executeStrategyAlert(ctx context.Context, conn *data.Conn, strategy Strateg
 		}
 	}
 
-	log.Printf("🚀 Strategy %d (%s): queuing alert task with args: %+v", strategy.StrategyID, strategy.Name, args)
-	// Submit the alert task through the unified queue system and wait for the typed result.
-	result, err := queue.AlertTyped(ctx, conn, args)
+	// Reuse an evaluation of the same strategy version, bucket and symbols if
+	// another replica or an earlier attempt already ran it
+	symbols, _ := args["symbols"].([]string)
+	// Latency is measured from the newest tick evaluated. A tick older than a
+	// couple of scans didn't prompt this run, so the run itself starts the trace.
+	trace := &deliveryTrace{AlertType: "strategy", EvaluationStart: evaluationStart}
+	if tickMs, err := data.LatestTickerUpdate(conn, symbols); err != nil {
+		log.Printf("⚠️ Strategy %d: latest tick unavailable for latency tracking: %v", strategy.StrategyID, err)
+	} else if tick := time.UnixMilli(tickMs); evaluationStart.Sub(tick) <= 2*strategyAlertFrequency {
+		trace.TickReceived = tick
+	}
+	cacheKey, err := strategyResultCacheKey(ctx, conn, strategy, symbols, now)
 	if err != nil {
-		log.Printf("❌ Strategy %d (%s): queue submission failed: %v", strategy.StrategyID, strategy.Name, err)
-		return fmt.Errorf("queue alert error: %w", err)
+		log.Printf("⚠️ Strategy %d (%s): evaluating without result cache: %v", strategy.StrategyID, strategy.Name, err)
+	}
+	var result *queue.AlertResult
+	if cacheKey != "" {
+		result = getCachedStrategyResult(ctx, conn, cacheKey)
+	}
+	if result != nil {
+		log.Printf("♻️ Strategy %d (%s): reusing cached evaluation %s", strategy.StrategyID, strategy.Name, cacheKey)
+	} else {
+		log.Printf("🚀 Strategy %d (%s): queuing alert task with args: %+v", strategy.StrategyID, strategy.Name, args)
+		// Submit the alert task through the unified queue system and wait for the typed result.
+		trace.WorkerSubmit = time.Now()
+		if isStrategyBatchingEnabled() {
+			result, err = batcher.run(ctx, conn, strategy, symbols, now)
+		} else {
+			result, err = queue.AlertTyped(ctx, conn, args)
+		}
+		trace.ResultReceived = time.Now()
+		if err != nil {
+			log.Printf("❌ Strategy %d (%s): queue submission failed: %v", strategy.StrategyID, strategy.Name, err)
+			return fmt.Errorf("queue alert error: %w", err)
+		}
+		if cacheKey != "" {
+			setCachedStrategyResult(ctx, conn, cacheKey, result)
+		}
 	}
 
 	log.Printf("📥 Strategy %d (%s): received result - Success: %t, Instances: %d", strategy.StrategyID, strategy.Name, result.Success, len(result.Instances))
@@ -1220,18 +1657,33 @@ func executeStrategyAlert(ctx context.Context, conn *data.Conn, strategy Strateg
 		return fmt.Errorf("alert task reported unsuccessful status without details")
 	}
 
-	numInstances := len(result.Instances)
-	if numInstances == 0 {
+	if len(result.Instances) == 0 {
 		// Nothing matched – nothing to notify
 		log.Printf("📭 Strategy %d (%s): no instances matched, no notifications sent", strategy.StrategyID, strategy.Name)
 		return nil
 	}
 
+	// Rank matches within their sectors, keeping only each sector's best if
+	// the strategy asks for it
+	instances, dropped := rankBySector(ctx, conn, result.Instances, strategy.SectorTopN)
+	numInstances := len(instances)
+
 	// Build notification message & extract tickers for logging / payload
-	message := fmt.Sprintf("Strategy '%s' triggered with %d matching securities", strategy.Name, numInstances)
+	vars := templates.Vars{"Strategy": strategy.Name, "Count": numInstances}
+	if dropped > 0 {
+		vars["TopPerSector"] = strategy.SectorTopN
+		vars["Total"] = len(result.Instances)
+		log.Printf("🏷️ Strategy %d (%s): kept the top %d matches per sector, dropped %d",
+			strategy.StrategyID, strategy.Name, strategy.SectorTopN, dropped)
+	}
+	if rule := strategyRuleFooter(ctx, conn, strategy.StrategyID); rule != "" {
+		vars["Rule"] = rule
+	}
+	content := templates.New(templates.StrategyTriggered, vars)
+	message := templates.Render(templates.UserLocale(ctx, conn, strategy.UserID), templates.VariantText, content)
 
 	var hitTickers []string
-	for _, inst := range result.Instances {
+	for _, inst := range instances {
 		if symRaw, ok := inst["symbol"]; ok {
 			if sym, ok := symRaw.(string); ok && sym != "" {
 				hitTickers = append(hitTickers, sym)
@@ -1252,51 +1704,61 @@ func executeStrategyAlert(ctx context.Context, conn *data.Conn, strategy Strateg
 		"num_matches": numInstances,
 		"ticker":      tickerCSV,
 	}
+	if dropped > 0 {
+		additionalData["sector_top_n"] = strategy.SectorTopN
+		additionalData["num_dropped"] = dropped
+	}
 
 	// Include full instances payload if the size is reasonable
 	if numInstances <= 50 {
-		additionalData["instances"] = result.Instances
+		additionalData["instances"] = instances
 		log.Printf("📊 Strategy %d (%s): including full instances in log payload (%d instances)", strategy.StrategyID, strategy.Name, numInstances)
 	} else {
 		log.Printf("📊 Strategy %d (%s): too many instances (%d) to include in log payload", strategy.StrategyID, strategy.Name, numInstances)
 	}
 
-	if err := LogStrategyAlert(conn, strategy.UserID, strategy.StrategyID, strategy.Name, message, additionalData); err != nil {
+	logID, err := LogStrategyAlert(conn, strategy.UserID, strategy.StrategyID, strategy.Name, message, additionalData)
+	if err != nil {
 		log.Printf("Warning: failed to log strategy alert for strategy %d: %v", strategy.StrategyID, err)
 	} else {
 		log.Printf("📝 Strategy %d (%s): successfully logged alert to database", strategy.StrategyID, strategy.Name)
 	}
 
 	// Update last trigger time in database and in-memory
+	service := GetAlertService()
+	triggeredAt := service.now()
 	_, err = conn.DB.Exec(ctx,
-		`UPDATE strategies SET alert_last_trigger_at = NOW() WHERE strategyid = $1`,
-		strategy.StrategyID)
+		`UPDATE strategies SET alert_last_trigger_at = $2 WHERE strategyid = $1`,
+		strategy.StrategyID, triggeredAt)
 	if err != nil {
 		log.Printf("Warning: failed to update last trigger time for strategy %d: %v", strategy.StrategyID, err)
 	} else {
 		// Update in-memory copy as well
-		service := GetAlertService()
-		strategy.LastTrigger = time.Now()
+		strategy.LastTrigger = triggeredAt
 		service.strategyAlerts.Store(strategy.StrategyID, strategy)
 		log.Printf("⏰ Strategy %d (%s): updated last trigger time", strategy.StrategyID, strategy.Name)
 	}
 
-	// Dispatch Telegram and WebSocket notifications (best-effort)
-	if err := SendTelegramMessage(message, chatID); err != nil {
-		log.Printf("Warning: failed to send Telegram message for strategy %d: %v", strategy.StrategyID, err)
-	} else {
-		log.Printf("📱 Strategy %d (%s): successfully sent Telegram notification", strategy.StrategyID, strategy.Name)
+	// Notify over WebSocket, falling back to Telegram/email when the user is
+	// offline; the chart snapshot shows the first matching ticker
+	var snap *chartimage.SnapshotArgs
+	if len(hitTickers) > 0 {
+		snap = &chartimage.SnapshotArgs{
+			Ticker:  hitTickers[0],
+			At:      triggeredAt,
+			Markers: []chartimage.Marker{{Timestamp: triggeredAt.UnixMilli(), Label: strategy.Name}},
+		}
 	}
-
-	socket.SendAlertToUser(strategy.UserID, socket.AlertMessage{
+	enqueueNotification(conn, strategy.UserID, socket.AlertMessage{
 		AlertID:   strategy.StrategyID,
-		Timestamp: time.Now().Unix() * 1000,
+		Timestamp: triggeredAt.Unix() * 1000,
 		Message:   message,
 		Channel:   "alert",
 		Type:      "strategy",
 		Tickers:   hitTickers,
-	})
-	log.Printf("🔔 Strategy %d (%s): sent WebSocket notification to user %d", strategy.StrategyID, strategy.Name, strategy.UserID)
+		LogID:     logID,
+	}, &content, snap, trace)
+	log.Printf("🔔 Strategy %d (%s): notified user %d", strategy.StrategyID, strategy.Name, strategy.UserID)
 
 	return nil
 }
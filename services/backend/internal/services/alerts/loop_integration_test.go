@@ -0,0 +1,180 @@
+package alerts_test
+
+import (
+	"backend/internal/app/screener"
+	"backend/internal/data"
+	"backend/internal/queue"
+	"backend/internal/services/alerts"
+	"backend/internal/services/flags"
+	"backend/internal/testharness"
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A Monday morning with the market open
+var loopStart = time.Date(2025, 3, 3, 15, 0, 0, 0, time.UTC)
+
+// startAlertLoop starts the alert service on env, stopping it when the test ends
+func startAlertLoop(t *testing.T, env *testharness.Env) {
+	t.Helper()
+	// The scan would otherwise ask Polygon whether the market is open
+	t.Setenv("STRATEGY_ALERTS_WHEN_CLOSED", "true")
+	service := alerts.GetAlertService()
+	if err := service.Start(env.Conn); err != nil {
+		t.Fatalf("starting the alert service: %v", err)
+	}
+	t.Cleanup(func() { _ = service.Stop() })
+}
+
+// stepUntil advances the clock a scan at a time until done holds
+func stepUntil(t *testing.T, env *testharness.Env, what string, done func() bool) {
+	t.Helper()
+	for i := 0; i < 60; i++ {
+		if done() {
+			return
+		}
+		env.Clock.Advance(10 * time.Second)
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestStrategyAlertLoopLogsMatches(t *testing.T) {
+	env := testharness.New(t, testharness.WithPostgres(), testharness.WithFakeClock(loopStart))
+	user := env.SeedUser(t, "alerter")
+	env.SeedSecurity(t, "AAPL")
+	strategyID := env.SeedStrategy(t, testharness.Strategy{
+		UserID:        user,
+		Name:          "Gap up",
+		AlertActive:   true,
+		AlertUniverse: []string{"AAPL"},
+	})
+	worker := env.StartWorker(t)
+	var ran sync.Map // strategy ids the worker was asked to run
+	worker.Handle("alert", func(_ queue.TaskData, args map[string]interface{}) (map[string]interface{}, error) {
+		ran.Store(args["strategy_id"], true)
+		return map[string]interface{}{
+			"success":   true,
+			"instances": []map[string]interface{}{{"ticker": "AAPL", "timestamp": loopStart.UnixMilli()}},
+		}, nil
+	})
+	startAlertLoop(t, env)
+
+	ctx := context.Background()
+	var logged int
+	stepUntil(t, env, "the match to be logged", func() bool {
+		err := env.Conn.DB.QueryRow(ctx, `
+			SELECT COUNT(*) FROM alert_logs WHERE alert_type = 'strategy' AND related_id = $1`,
+			strategyID).Scan(&logged)
+		return err == nil && logged > 0
+	})
+
+	if _, ok := ran.Load(float64(strategyID)); !ok {
+		t.Fatalf("expected an alert task for strategy %d", strategyID)
+	}
+	var lastTrigger *time.Time
+	if err := env.Conn.DB.QueryRow(ctx, `SELECT alert_last_trigger_at FROM strategies WHERE strategyid = $1`,
+		strategyID).Scan(&lastTrigger); err != nil {
+		t.Fatalf("reading the strategy: %v", err)
+	}
+	if lastTrigger == nil || lastTrigger.Before(loopStart) {
+		t.Fatalf("trigger time not recorded on the fake clock: %v", lastTrigger)
+	}
+}
+
+func TestStrategyAlertLoopRecordsFailures(t *testing.T) {
+	env := testharness.New(t, testharness.WithPostgres(), testharness.WithFakeClock(loopStart))
+	user := env.SeedUser(t, "failing")
+	strategyID := env.SeedStrategy(t, testharness.Strategy{
+		UserID:        user,
+		Name:          "Broken",
+		AlertActive:   true,
+		AlertUniverse: []string{"MSFT"},
+	})
+	worker := env.StartWorker(t)
+	worker.Handle("alert", func(queue.TaskData, map[string]interface{}) (map[string]interface{}, error) {
+		return nil, errors.New("strategy raised KeyError")
+	})
+	startAlertLoop(t, env)
+
+	stepUntil(t, env, "the failed evaluation", func() bool {
+		evals, err := data.GetStrategyEvaluations(env.Conn, strategyID)
+		if err != nil {
+			return false
+		}
+		for _, eval := range evals {
+			if eval.Outcome == data.EvalFailed {
+				return true
+			}
+		}
+		return false
+	})
+
+	var logged int
+	if err := env.Conn.DB.QueryRow(context.Background(), `
+		SELECT COUNT(*) FROM alert_logs WHERE related_id = $1`, strategyID).Scan(&logged); err != nil {
+		t.Fatalf("counting alert logs: %v", err)
+	}
+	if logged != 0 {
+		t.Fatalf("a failed run logged %d alerts", logged)
+	}
+}
+
+func TestLegacyStrategyAlertLoopRunsOverScreenedUniverse(t *testing.T) {
+	env := testharness.New(t, testharness.WithPostgres(), testharness.WithFakeClock(loopStart))
+	user := env.SeedUser(t, "screened")
+	ctx := context.Background()
+	for _, row := range []struct{ ticker, sector string }{{"AAPL", "Technology"}, {"XOM", "Energy"}} {
+		if _, err := env.Conn.DB.Exec(ctx, `
+			INSERT INTO screener (ticker, calc_time, security_id, sector) VALUES ($1, now(), $2, $3)`,
+			row.ticker, env.SeedSecurity(t, row.ticker), row.sector); err != nil {
+			t.Fatalf("seeding the screener: %v", err)
+		}
+	}
+	env.SeedStrategy(t, testharness.Strategy{
+		UserID:          user,
+		Name:            "Tech only",
+		AlertActive:     true,
+		UniverseFilters: []screener.Filter{{Column: "sector", Operator: "=", Value: "Technology"}},
+	})
+
+	// The legacy mode runs alerts from the strategy row, without per-ticker throttling
+	if _, err := flags.Set(ctx, env.Conn, flags.Flag{Key: flags.PerTickerThrottle}, user); err != nil {
+		t.Fatalf("turning off per-ticker throttling: %v", err)
+	}
+	if err := flags.Reload(ctx, env.Conn); err != nil {
+		t.Fatalf("reloading flags: %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = env.Conn.DB.Exec(context.Background(), `DELETE FROM feature_flags`)
+		_ = flags.Reload(context.Background(), env.Conn)
+	})
+
+	worker := env.StartWorker(t)
+	symbols := make(chan interface{}, 1)
+	worker.Handle("alert", func(_ queue.TaskData, args map[string]interface{}) (map[string]interface{}, error) {
+		select {
+		case symbols <- args["symbols"]:
+		default:
+		}
+		return map[string]interface{}{"success": true}, nil
+	})
+	startAlertLoop(t, env)
+
+	var got interface{}
+	stepUntil(t, env, "the strategy to run", func() bool {
+		select {
+		case got = <-symbols:
+			return true
+		default:
+			return false
+		}
+	})
+	if want := []interface{}{"AAPL"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ran over %v, want the screen's %v", got, want)
+	}
+}
@@ -0,0 +1,104 @@
+package alerts
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Each alert loop times its iterations so the ops dashboard can show how
+// close a loop runs to its interval; the last loopSamples of a loop are kept.
+// Timings are this replica's.
+const loopSamples = 100
+
+type loopTiming struct {
+	interval time.Duration
+	runs     int64
+	overruns int64
+	lastRun  time.Time
+	last     time.Duration
+	samples  []time.Duration // ring of the most recent iterations
+	next     int
+}
+
+var (
+	loopTimingsMu sync.Mutex
+	loopTimings   = map[string]*loopTiming{}
+)
+
+// LoopLatency is how long a loop's recent iterations took. Percentiles are
+// over the last 100 iterations.
+type LoopLatency struct {
+	Loop       string    `json:"loop"`
+	IntervalMs int64     `json:"intervalMs"`
+	Runs       int64     `json:"runs"`
+	Overruns   int64     `json:"overruns"` // iterations that took longer than the interval
+	LastRunAt  time.Time `json:"lastRunAt"`
+	LastMs     int64     `json:"lastMs"`
+	P50Ms      int64     `json:"p50Ms"`
+	P95Ms      int64     `json:"p95Ms"`
+	MaxMs      int64     `json:"maxMs"`
+}
+
+// timeLoop runs one iteration of the named loop and records how long it took
+func timeLoop(name string, interval time.Duration, iteration func()) {
+	start := time.Now()
+	iteration()
+	took := time.Since(start)
+
+	loopTimingsMu.Lock()
+	defer loopTimingsMu.Unlock()
+	t := loopTimings[name]
+	if t == nil {
+		t = &loopTiming{interval: interval, samples: make([]time.Duration, 0, loopSamples)}
+		loopTimings[name] = t
+	}
+	t.runs++
+	if took > interval {
+		t.overruns++
+	}
+	t.lastRun = start
+	t.last = took
+	if len(t.samples) < loopSamples {
+		t.samples = append(t.samples, took)
+	} else {
+		t.samples[t.next] = took
+	}
+	t.next = (t.next + 1) % loopSamples
+}
+
+// LoopLatencies reports the timing of every alert loop that has run
+func LoopLatencies() []LoopLatency {
+	loopTimingsMu.Lock()
+	defer loopTimingsMu.Unlock()
+	out := make([]LoopLatency, 0, len(loopTimings))
+	for name, t := range loopTimings {
+		sorted := append([]time.Duration(nil), t.samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		out = append(out, LoopLatency{
+			Loop:       name,
+			IntervalMs: t.interval.Milliseconds(),
+			Runs:       t.runs,
+			Overruns:   t.overruns,
+			LastRunAt:  t.lastRun,
+			LastMs:     t.last.Milliseconds(),
+			P50Ms:      percentile(sorted, 0.50).Milliseconds(),
+			P95Ms:      percentile(sorted, 0.95).Milliseconds(),
+			MaxMs:      sorted[len(sorted)-1].Milliseconds(),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Loop < out[j].Loop })
+	return out
+}
+
+// percentile of durations sorted ascending, by nearest rank
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(p*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
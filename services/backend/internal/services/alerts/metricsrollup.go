@@ -0,0 +1,159 @@
+package alerts
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// The alert loop's counters (see data.GetDetailedAlertMetrics) are flushed
+// every metrics cycle into the hour's row of alert_metric_buckets and start
+// over, so they no longer grow for as long as the process lives and survive
+// restarts. A nightly job rolls finished days up into daily rows and ages
+// out old ones.
+const (
+	MetricsHourly = "hour"
+	MetricsDaily  = "day"
+
+	// alertMetricsHourlyRetention is how long hourly rows are kept; days are
+	// rolled up from them until then
+	alertMetricsHourlyRetention = 14 * 24 * time.Hour
+	alertMetricsDailyRetention  = 400 * 24 * time.Hour
+)
+
+// alertMetricGauges are readings rather than counts: an hour keeps its latest
+// reading and a day its highest
+var alertMetricGauges = []string{"total_ticker_updates"}
+
+// flushAlertMetrics adds the counts since the last flush to the current
+// hour, and records the gauges. Counts that can't be stored are put back to
+// be tried again next cycle.
+func (a *AlertService) flushAlertMetrics() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	hour := a.clock.Now().UTC().Truncate(time.Hour)
+
+	counts := data.TakeAlertCounters()
+	names := make([]string, 0, len(counts))
+	values := make([]int64, 0, len(counts))
+	for name, n := range counts {
+		if n == 0 {
+			continue
+		}
+		names = append(names, name)
+		values = append(values, n)
+	}
+	if len(names) > 0 {
+		_, err := a.conn.DB.Exec(ctx, `
+			INSERT INTO alert_metric_buckets (granularity, metric, bucket, value)
+			SELECT 'hour', m.metric, $1::timestamptz, m.value
+			FROM unnest($2::text[], $3::bigint[]) AS m(metric, value)
+			ON CONFLICT (granularity, metric, bucket)
+			DO UPDATE SET value = alert_metric_buckets.value + EXCLUDED.value`,
+			hour, names, values)
+		if err != nil {
+			data.RestoreAlertCounters(counts)
+			log.Printf("⚠️ Error flushing alert metrics: %v", err)
+			return
+		}
+	}
+
+	tracked, err := data.GetTickerUpdateCount(a.conn)
+	if err != nil {
+		return
+	}
+	if _, err := a.conn.DB.Exec(ctx, `
+		INSERT INTO alert_metric_buckets (granularity, metric, bucket, value)
+		VALUES ('hour', 'total_ticker_updates', $1, $2)
+		ON CONFLICT (granularity, metric, bucket) DO UPDATE SET value = EXCLUDED.value`,
+		hour, tracked); err != nil {
+		log.Printf("⚠️ Error recording alert metric gauges: %v", err)
+	}
+}
+
+// RollupAlertMetrics rolls the hourly alert metrics of every finished day up
+// into daily rows, then drops hourly and daily rows past their retention.
+// Days still covered by hourly rows are recomputed each run, so a missed or
+// repeated run changes nothing.
+func RollupAlertMetrics(conn *data.Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	now := time.Now().UTC()
+	today := now.Truncate(24 * time.Hour)
+
+	tag, err := conn.DB.Exec(ctx, `
+		INSERT INTO alert_metric_buckets (granularity, metric, bucket, value)
+		SELECT 'day', metric, date_trunc('day', bucket AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS day,
+		       CASE WHEN metric = ANY($2) THEN MAX(value) ELSE SUM(value) END
+		FROM alert_metric_buckets
+		WHERE granularity = 'hour' AND bucket < $1
+		GROUP BY metric, day
+		ON CONFLICT (granularity, metric, bucket) DO UPDATE SET value = EXCLUDED.value`,
+		today, alertMetricGauges)
+	if err != nil {
+		return fmt.Errorf("rolling up alert metrics: %w", err)
+	}
+	hourly, err := conn.DB.Exec(ctx, `
+		DELETE FROM alert_metric_buckets WHERE granularity = 'hour' AND bucket < $1`,
+		today.Add(-alertMetricsHourlyRetention))
+	if err != nil {
+		return fmt.Errorf("pruning hourly alert metrics: %w", err)
+	}
+	daily, err := conn.DB.Exec(ctx, `
+		DELETE FROM alert_metric_buckets WHERE granularity = 'day' AND bucket < $1`,
+		today.Add(-alertMetricsDailyRetention))
+	if err != nil {
+		return fmt.Errorf("pruning daily alert metrics: %w", err)
+	}
+	log.Printf("📊 Rolled up %d metric-days of alert metrics, pruned %d hourly and %d daily rows",
+		tag.RowsAffected(), hourly.RowsAffected(), daily.RowsAffected())
+	return nil
+}
+
+// MetricPoint is one bucket of a metric
+type MetricPoint struct {
+	Bucket time.Time `json:"bucket"`
+	Value  int64     `json:"value"`
+}
+
+// AlertMetricSeries returns the buckets of each metric since a time, oldest
+// first, optionally only of some metrics. Daily series end with today so far,
+// summed from its hourly rows.
+func AlertMetricSeries(ctx context.Context, conn *data.Conn, granularity string, since time.Time, metrics []string) (map[string][]MetricPoint, error) {
+	if granularity != MetricsHourly && granularity != MetricsDaily {
+		return nil, apperr.Validation("granularity must be %s or %s", MetricsHourly, MetricsDaily)
+	}
+	if metrics == nil {
+		metrics = []string{} // NULL would match nothing
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	rows, err := conn.DB.Query(ctx, `
+		SELECT metric, bucket, value FROM alert_metric_buckets
+		WHERE granularity = $1 AND bucket >= $2 AND (cardinality($3::text[]) = 0 OR metric = ANY($3))
+		UNION ALL
+		SELECT metric, $4, (CASE WHEN metric = ANY($5) THEN MAX(value) ELSE SUM(value) END)::bigint
+		FROM alert_metric_buckets
+		WHERE $1 = 'day' AND granularity = 'hour' AND bucket >= $4
+		  AND (cardinality($3::text[]) = 0 OR metric = ANY($3))
+		GROUP BY metric
+		ORDER BY 1, 2`,
+		granularity, since, metrics, today, alertMetricGauges)
+	if err != nil {
+		return nil, fmt.Errorf("loading alert metrics: %w", err)
+	}
+	defer rows.Close()
+
+	series := map[string][]MetricPoint{}
+	for rows.Next() {
+		var metric string
+		var p MetricPoint
+		if err := rows.Scan(&metric, &p.Bucket, &p.Value); err != nil {
+			return nil, fmt.Errorf("reading alert metrics: %w", err)
+		}
+		series[metric] = append(series[metric], p)
+	}
+	return series, rows.Err()
+}
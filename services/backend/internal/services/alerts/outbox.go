@@ -0,0 +1,285 @@
+package alerts
+
+import (
+	"backend/internal/data"
+	"backend/internal/dryrun"
+	"backend/internal/services/chartimage"
+	"backend/internal/services/socket"
+	"backend/internal/services/templates"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Alert notifications go through an outbox: a trigger is written to
+// notification_outbox before any channel is tried, delivered straight away off
+// the alert loop, then marked delivered. If the process dies in between, the
+// row's lease runs out and the outbox loop on whichever replica claims it
+// delivers it again; failed deliveries are retried with backoff the same way.
+// The WebSocket leg carries a delivery ID derived from the row, so the client
+// drops a repeat and the escalation it schedules is the same one, and the
+// fallback channels already sent are recorded on the row so a retry skips
+// them. A crash between a Telegram send and its recording can still repeat
+// that one message. A notification held back by a maintenance window goes
+// back to pending, due when the window ends, without using up an attempt.
+const (
+	outboxInterval    = 2 * time.Second
+	outboxBatch       = 50
+	outboxConcurrency = 8
+	outboxLease       = time.Minute
+	outboxMaxAttempts = 5
+	outboxRetryBase   = 5 * time.Second // doubled after each failed attempt
+	outboxRetention   = 7 * 24 * time.Hour
+)
+
+type outboxEntry struct {
+	ID       int64
+	UserID   int
+	Alert    socket.AlertMessage
+	Content  *templates.Message
+	Snapshot *chartimage.SnapshotArgs
+	Attempts int // including the one in progress
+	Sent     sentChannels
+}
+
+// outboxDeliveryID is the delivery ID every attempt at an outbox row sends
+func outboxDeliveryID(id int64) string {
+	return "outbox-" + strconv.FormatInt(id, 10)
+}
+
+// enqueueNotification persists an alert notification and delivers it in the
+// background; trace follows the first attempt only. If the outbox can't be
+// written the alert is still delivered once, without the retries. In a dry
+// run it is only logged.
+func enqueueNotification(conn *data.Conn, userID int, alert socket.AlertMessage, content *templates.Message, snap *chartimage.SnapshotArgs, trace *deliveryTrace) {
+	if dryrun.Notify(context.Background(), "alert", fmt.Sprintf("notified user %d of %s alert %d: %s", userID, alert.Type, alert.AlertID, alert.Message),
+		map[string]interface{}{"userId": userID, "alert": alert}) {
+		return
+	}
+	e := &outboxEntry{UserID: userID, Alert: alert, Content: content, Snapshot: snap, Attempts: 1, Sent: sentChannels{}}
+	id, err := insertOutboxEntry(conn, e)
+	if err != nil {
+		log.Printf("⚠️ Failed to write alert %d for user %d to the notification outbox, delivering directly: %v", alert.AlertID, userID, err)
+		go func() {
+			if err := notifyUser(conn, userID, alert, content, snap, trace, sentChannels{}); err != nil {
+				log.Printf("⚠️ Alert %d for user %d: %v", alert.AlertID, userID, err)
+			}
+		}()
+		return
+	}
+	e.ID = id
+	go deliverOutboxEntry(conn, e, trace)
+}
+
+// insertOutboxEntry writes the notification already claimed for its first
+// attempt, so the outbox loop leaves it alone unless the lease runs out
+func insertOutboxEntry(conn *data.Conn, e *outboxEntry) (int64, error) {
+	message, err := json.Marshal(e.Alert)
+	if err != nil {
+		return 0, err
+	}
+	var content, snapshot []byte
+	if e.Content != nil {
+		if content, err = json.Marshal(e.Content); err != nil {
+			return 0, err
+		}
+	}
+	if e.Snapshot != nil {
+		if snapshot, err = json.Marshal(e.Snapshot); err != nil {
+			return 0, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var id int64
+	err = conn.DB.QueryRow(ctx, `
+		INSERT INTO notification_outbox
+			(user_id, alert_type, log_id, message, content, snapshot, status, attempts, claimed_until)
+		VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, 'delivering', 1, now() + $7 * interval '1 second')
+		RETURNING outbox_id`,
+		e.UserID, e.Alert.Type, e.Alert.LogID, message, content, snapshot, int(outboxLease.Seconds())).Scan(&id)
+	return id, err
+}
+
+// deliverOutboxEntry makes one delivery attempt and records its outcome. The
+// update only applies while the row is still on this attempt, so an attempt
+// that outlived its lease can't overwrite the one that took over.
+func deliverOutboxEntry(conn *data.Conn, e *outboxEntry, trace *deliveryTrace) {
+	e.Alert.DeliveryID = outboxDeliveryID(e.ID)
+	deliveryErr := notifyUser(conn, e.UserID, e.Alert, e.Content, e.Snapshot, trace, e.Sent)
+
+	sent := make([]string, 0, len(e.Sent))
+	for channel := range e.Sent {
+		sent = append(sent, channel)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var err error
+	var held *heldError
+	if errors.As(deliveryErr, &held) {
+		_, err = conn.DB.Exec(ctx, `
+			UPDATE notification_outbox
+			SET status = 'pending', attempts = attempts - 1, next_attempt_at = $3, claimed_until = NULL,
+			    sent_channels = $4, last_error = NULL
+			WHERE outbox_id = $1 AND attempts = $2 AND status = 'delivering'`,
+			e.ID, e.Attempts, held.until, sent)
+	} else if deliveryErr == nil {
+		_, err = conn.DB.Exec(ctx, `
+			UPDATE notification_outbox
+			SET status = 'delivered', delivered_at = now(), claimed_until = NULL,
+			    sent_channels = $3, last_error = NULL
+			WHERE outbox_id = $1 AND attempts = $2 AND status = 'delivering'`,
+			e.ID, e.Attempts, sent)
+	} else {
+		status := "pending"
+		if e.Attempts >= outboxMaxAttempts {
+			status = "failed"
+			log.Printf("❌ Giving up on alert %d for user %d after %d attempts: %v", e.Alert.AlertID, e.UserID, e.Attempts, deliveryErr)
+		} else {
+			log.Printf("⚠️ Alert %d for user %d, attempt %d: %v; retrying", e.Alert.AlertID, e.UserID, e.Attempts, deliveryErr)
+		}
+		backoff := outboxRetryBase << (e.Attempts - 1)
+		_, err = conn.DB.Exec(ctx, `
+			UPDATE notification_outbox
+			SET status = $3, next_attempt_at = now() + $4 * interval '1 second', claimed_until = NULL,
+			    sent_channels = $5, last_error = $6
+			WHERE outbox_id = $1 AND attempts = $2 AND status = 'delivering'`,
+			e.ID, e.Attempts, status, int(backoff.Seconds()), sent, deliveryErr.Error())
+	}
+	if err != nil {
+		// The lease runs out and the loop tries again; the client drops the
+		// repeated WebSocket message
+		log.Printf("⚠️ Failed to record delivery of outbox entry %d: %v", e.ID, err)
+	}
+}
+
+// outboxLoop delivers notifications left undelivered by a failed attempt or
+// by a process that stopped mid-dispatch
+func (a *AlertService) outboxLoop() {
+	defer a.wg.Done()
+	ticker := a.clock.NewTicker(outboxInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.stopChan:
+			log.Printf("📡 Notification outbox loop stopped by stop signal")
+			return
+		case <-ticker.C:
+			timeLoop("outbox", outboxInterval, a.processOutbox)
+		}
+	}
+}
+
+// processOutbox claims the due notifications, retries whose backoff has
+// passed and deliveries whose lease ran out, and delivers them. SKIP LOCKED
+// keeps replicas from claiming the same rows. A row whose last attempt never
+// reported back is failed rather than tried forever, in case the
+// notification itself is what keeps taking the process down.
+func (a *AlertService) processOutbox() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := a.conn.DB.Exec(ctx, `
+		UPDATE notification_outbox
+		SET status = 'failed', claimed_until = NULL, last_error = 'lease expired on the last attempt'
+		WHERE status = 'delivering' AND claimed_until < now() AND attempts >= $1`,
+		outboxMaxAttempts); err != nil {
+		log.Printf("⚠️ Failed to expire notification outbox entries: %v", err)
+		return
+	}
+	rows, err := a.conn.DB.Query(ctx, `
+		UPDATE notification_outbox o
+		SET status = 'delivering', attempts = o.attempts + 1,
+		    claimed_until = now() + $2 * interval '1 second'
+		WHERE o.outbox_id IN (
+			SELECT outbox_id FROM notification_outbox
+			WHERE (status = 'pending' AND next_attempt_at <= now())
+			   OR (status = 'delivering' AND claimed_until < now())
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING o.outbox_id, o.user_id, o.message, o.content, o.snapshot, o.attempts, o.sent_channels`,
+		outboxBatch, int(outboxLease.Seconds()))
+	if err != nil {
+		log.Printf("⚠️ Failed to claim notification outbox entries: %v", err)
+		return
+	}
+	var entries []*outboxEntry
+	for rows.Next() {
+		e := &outboxEntry{Sent: sentChannels{}}
+		var message, content, snapshot []byte
+		var sent []string
+		if err := rows.Scan(&e.ID, &e.UserID, &message, &content, &snapshot, &e.Attempts, &sent); err != nil {
+			log.Printf("⚠️ Failed to read notification outbox entry: %v", err)
+			continue
+		}
+		if err := decodeOutboxEntry(e, message, content, snapshot); err != nil {
+			log.Printf("⚠️ Outbox entry %d: %v", e.ID, err)
+			continue
+		}
+		for _, channel := range sent {
+			e.Sent[channel] = true
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Printf("⚠️ Failed to read notification outbox entries: %v", err)
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	log.Printf("📬 Redelivering %d notification(s) from the outbox", len(entries))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, outboxConcurrency)
+	for _, e := range entries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(e *outboxEntry) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			deliverOutboxEntry(a.conn, e, nil)
+		}(e)
+	}
+	wg.Wait()
+}
+
+func decodeOutboxEntry(e *outboxEntry, message, content, snapshot []byte) error {
+	if err := json.Unmarshal(message, &e.Alert); err != nil {
+		return fmt.Errorf("decoding message: %w", err)
+	}
+	if len(content) > 0 {
+		e.Content = &templates.Message{}
+		if err := json.Unmarshal(content, e.Content); err != nil {
+			return fmt.Errorf("decoding content: %w", err)
+		}
+	}
+	if len(snapshot) > 0 {
+		e.Snapshot = &chartimage.SnapshotArgs{}
+		if err := json.Unmarshal(snapshot, e.Snapshot); err != nil {
+			return fmt.Errorf("decoding snapshot: %w", err)
+		}
+	}
+	return nil
+}
+
+// pruneOutbox drops finished notifications past the retention period
+func pruneOutbox(conn *data.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	tag, err := conn.DB.Exec(ctx, `
+		DELETE FROM notification_outbox
+		WHERE status IN ('delivered', 'failed') AND created_at < now() - $1 * interval '1 second'`,
+		int(outboxRetention.Seconds()))
+	if err != nil {
+		log.Printf("⚠️ Failed to prune the notification outbox: %v", err)
+		return
+	}
+	log.Printf("🧹 Pruned %d finished notification outbox entries", tag.RowsAffected())
+}
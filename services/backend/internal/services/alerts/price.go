@@ -4,35 +4,102 @@ package alerts
 
 import (
 	"backend/internal/data"
-	"backend/internal/services/socket"
+	"backend/internal/services/lastprice"
+	"backend/internal/services/marketdata"
+	"context"
 	"fmt"
+	"sync"
+	"time"
 )
 
-func processPriceAlert(conn *data.Conn, alert PriceAlert) error {
+// anchored VWAP levels only move once per 1m bar, so they are cached per alert
+const vwapLevelTTL = 30 * time.Second
+
+// priceAlertMaxPriceAge is how old a cached price can be before an alert asks
+// Polygon, which bounds Polygon calls to one per ticker per interval while the
+// feed is quiet
+const priceAlertMaxPriceAge = time.Minute
+
+type vwapLevel struct {
+	value      float64
+	computedAt time.Time
+}
+
+var vwapLevels sync.Map // key: alertID, value: vwapLevel
+
+// currentVWAPLevel returns the anchored VWAP an alert is tracking
+func currentVWAPLevel(conn *data.Conn, alert PriceAlert, now time.Time) (float64, error) {
+	if cached, ok := vwapLevels.Load(alert.AlertID); ok {
+		if level := cached.(vwapLevel); now.Sub(level.computedAt) < vwapLevelTTL {
+			return level.value, nil
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := marketdata.AnchoredVWAP(ctx, conn, *alert.Ticker, *alert.VWAPAnchor, now, false)
+	if err != nil {
+		return 0, fmt.Errorf("computing anchored vwap for alert %d: %v", alert.AlertID, err)
+	}
+	vwapLevels.Store(alert.AlertID, vwapLevel{value: res.VWAP, computedAt: now})
+	return res.VWAP, nil
+}
+
+func processPriceAlert(conn *data.Conn, alert PriceAlert, now time.Time) error {
+	evaluationStart := time.Now()
 	directionPtr := alert.Direction
+	if alert.VWAPAnchor != nil {
+		level, err := currentVWAPLevel(conn, alert, now)
+		if err != nil {
+			return err
+		}
+		alert.Price = &level
+	} else if alert.Trendline != nil {
+		line, err := currentTrendline(conn, alert, now)
+		if err != nil {
+			return err
+		}
+		if line == nil {
+			// Drawing deleted; its alert row went with it
+			trendlineRefreshedAt.Delete(alert.AlertID)
+			return RemovePriceAlert(conn, alert.AlertID)
+		}
+		level := line.ProjectedPrice(now)
+		alert.Price = &level
+	}
 	if directionPtr != nil {
-		// Get the latest price from the websocket price cache
-		price, exists := socket.GetLatestPrice(*alert.SecurityID)
-		if !exists {
-			return fmt.Errorf("no price data available for security ID %d", *alert.SecurityID)
+		// Read the price the feed last saw, asking Polygon only if it's old
+		last, exists := lastprice.BySecurityID(*alert.SecurityID)
+		if !exists || last.Age(time.Now()) > priceAlertMaxPriceAge {
+			if alert.Ticker == nil {
+				return fmt.Errorf("no price data available for security ID %d", *alert.SecurityID)
+			}
+			var err error
+			if last, err = lastprice.Lookup(context.Background(), conn, *alert.Ticker, priceAlertMaxPriceAge); err != nil {
+				return fmt.Errorf("no price data available for security ID %d: %w", *alert.SecurityID, err)
+			}
 		}
+		price := last.Price
 
 		// Skip alert processing if price is -1 (indicates skip OHLC condition)
 		if price < 0 {
 			return nil
 		}
 
+		triggered := price <= *alert.Price
 		if *directionPtr {
-			if price >= *alert.Price {
-				if err := dispatchPriceAlert(conn, alert); err != nil {
-					return fmt.Errorf("failed to dispatch alert: %v", err)
-				}
+			triggered = price >= *alert.Price
+		}
+		if triggered && alert.Canary {
+			priceCanaryFired(last)
+			return nil
+		}
+		if triggered {
+			trace := &deliveryTrace{AlertType: "price", EvaluationStart: evaluationStart}
+			if last.Source == lastprice.SourceStream {
+				trace.TickReceived = last.UpdatedAt
 			}
-		} else {
-			if price <= *alert.Price {
-				if err := dispatchPriceAlert(conn, alert); err != nil {
-					return fmt.Errorf("failed to dispatch alert: %v", err)
-				}
+			if err := dispatchPriceAlert(conn, alert, trace); err != nil {
+				return fmt.Errorf("failed to dispatch alert: %v", err)
 			}
 		}
 	} else {
@@ -0,0 +1,259 @@
+package alerts
+
+import (
+	"backend/internal/data"
+	email "backend/internal/services/email"
+	"backend/internal/services/notices"
+	"backend/internal/services/socket"
+	"backend/internal/services/templates"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4"
+)
+
+// Notifications are rate limited per user and channel so a burst of triggers
+// doesn't flood the user. Each channel allows a number of notifications per
+// fixed window, counted in Redis; past that they are held back, and when the
+// window ends whichever replica claims it from the due set sends one summary
+// with a few of the held messages and a link to the alert log. A Redis error
+// lets the notification through.
+const (
+	rateCountKey = "notify_rate:%d:%s:%d" // by user, channel and window
+	heldKey      = "notify_held:%d:%s"    // the first held messages
+	heldCountKey = "notify_held_count:%d:%s"
+	heldDueKey   = "notify_held:due" // "user:channel" scored by window end
+	heldExamples = 5
+	summaryBatch = 100
+
+	maxRateLimitNotifications = 1000
+	maxRateLimitWindowMinutes = 24 * 60
+)
+
+// NotificationRateLimit lets at most MaxNotifications alerts out over Channel
+// per window of WindowMinutes; MaxNotifications 0 means no limit
+type NotificationRateLimit struct {
+	Channel          string `json:"channel"`
+	MaxNotifications int    `json:"maxNotifications"`
+	WindowMinutes    int    `json:"windowMinutes"`
+}
+
+// DefaultNotificationRateLimits apply to channels the user hasn't configured
+var DefaultNotificationRateLimits = map[string]NotificationRateLimit{
+	ChannelWebSocket: {Channel: ChannelWebSocket, MaxNotifications: 30, WindowMinutes: 1},
+	ChannelTelegram:  {Channel: ChannelTelegram, MaxNotifications: 10, WindowMinutes: 10},
+	ChannelEmail:     {Channel: ChannelEmail, MaxNotifications: 5, WindowMinutes: 60},
+}
+
+// NotificationChannels are the channels a rate limit can be set on
+var NotificationChannels = []string{ChannelWebSocket, ChannelTelegram, ChannelEmail}
+
+// ValidateNotificationRateLimit checks a limit names a known channel and has
+// a usable size and window
+func ValidateNotificationRateLimit(l NotificationRateLimit) error {
+	if _, ok := DefaultNotificationRateLimits[l.Channel]; !ok {
+		return fmt.Errorf("unknown channel %q, expected one of %s", l.Channel, strings.Join(NotificationChannels, ", "))
+	}
+	if l.MaxNotifications < 0 || l.MaxNotifications > maxRateLimitNotifications {
+		return fmt.Errorf("maxNotifications must be between 0 and %d", maxRateLimitNotifications)
+	}
+	if l.WindowMinutes < 1 || l.WindowMinutes > maxRateLimitWindowMinutes {
+		return fmt.Errorf("windowMinutes must be between 1 and %d", maxRateLimitWindowMinutes)
+	}
+	return nil
+}
+
+// loadNotificationRateLimit returns the user's limit on channel, or the
+// default when they haven't set one or it can't be read
+func loadNotificationRateLimit(ctx context.Context, conn *data.Conn, userID int, channel string) NotificationRateLimit {
+	l := NotificationRateLimit{Channel: channel}
+	err := conn.DB.QueryRow(ctx, `
+		SELECT max_notifications, window_minutes FROM notification_rate_limits
+		WHERE user_id = $1 AND channel = $2`, userID, channel).Scan(&l.MaxNotifications, &l.WindowMinutes)
+	if err != nil {
+		if err != pgx.ErrNoRows {
+			log.Printf("⚠️ Failed to load %s rate limit for user %d: %v; using the default", channel, userID, err)
+		}
+		return DefaultNotificationRateLimits[channel]
+	}
+	return l
+}
+
+// admitNotification counts a notification against the user's limit on
+// channel. It returns false when the limit is reached, in which case msg is
+// held back for the summary sent at the end of the window.
+func admitNotification(conn *data.Conn, userID int, channel, msg string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	limit := loadNotificationRateLimit(ctx, conn, userID, channel)
+	if limit.MaxNotifications == 0 {
+		return true
+	}
+	window := time.Duration(limit.WindowMinutes) * time.Minute
+	index := GetAlertService().now().UnixMilli() / window.Milliseconds()
+	countKey := fmt.Sprintf(rateCountKey, userID, channel, index)
+	pipe := conn.Cache.TxPipeline()
+	count := pipe.Incr(ctx, countKey)
+	pipe.Expire(ctx, countKey, window+time.Minute)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ Failed to count %s notification for user %d: %v", channel, userID, err)
+		return true
+	}
+	if count.Val() <= int64(limit.MaxNotifications) {
+		return true
+	}
+
+	listKey := fmt.Sprintf(heldKey, userID, channel)
+	heldCount := fmt.Sprintf(heldCountKey, userID, channel)
+	windowEnd := (index + 1) * window.Milliseconds()
+	// The summary lists one line per example, without footers like a
+	// strategy's rule
+	example, _, _ := strings.Cut(msg, "\n")
+	pipe = conn.Cache.TxPipeline()
+	pipe.RPush(ctx, listKey, example)
+	pipe.LTrim(ctx, listKey, 0, heldExamples-1)
+	pipe.Incr(ctx, heldCount)
+	pipe.Expire(ctx, listKey, window+time.Hour)
+	pipe.Expire(ctx, heldCount, window+time.Hour)
+	pipe.ZAddNX(ctx, heldDueKey, &redis.Z{Score: float64(windowEnd), Member: heldMember(userID, channel)})
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ Failed to hold back %s notification for user %d: %v; sending it", channel, userID, err)
+		return true
+	}
+	if count.Val() == int64(limit.MaxNotifications)+1 {
+		log.Printf("🚦 User %d reached %d %s notifications in %d min; holding the rest for a summary",
+			userID, limit.MaxNotifications, channel, limit.WindowMinutes)
+	}
+	return false
+}
+
+func heldMember(userID int, channel string) string {
+	return strconv.Itoa(userID) + ":" + channel
+}
+
+// summaryLoop sends the summaries of held notifications as their windows end
+func (a *AlertService) summaryLoop() {
+	defer a.wg.Done()
+	ticker := a.clock.NewTicker(escalationInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.stopChan:
+			log.Printf("📡 Notification summary loop stopped by stop signal")
+			return
+		case <-ticker.C:
+			timeLoop("summary", escalationInterval, a.processDueSummaries)
+		}
+	}
+}
+
+// processDueSummaries claims and sends every summary due by now. Like
+// escalations they are held, not dropped, during a maintenance window.
+func (a *AlertService) processDueSummaries() {
+	if notices.InMaintenance(a.conn) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	members, err := a.conn.Cache.ZRangeByScore(ctx, heldDueKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(a.now().UnixMilli(), 10),
+		Count: summaryBatch,
+	}).Result()
+	if err != nil {
+		log.Printf("⚠️ Failed to read due notification summaries: %v", err)
+		return
+	}
+	for _, member := range members {
+		// Removing the entry claims the summary, as with escalations
+		claimed, err := a.conn.Cache.ZRem(ctx, heldDueKey, member).Result()
+		if err != nil || claimed == 0 {
+			continue
+		}
+		userPart, channel, ok := strings.Cut(member, ":")
+		userID, err := strconv.Atoi(userPart)
+		if !ok || err != nil {
+			continue
+		}
+		a.sendSummary(ctx, userID, channel)
+	}
+}
+
+// sendSummary takes the notifications held for the user on channel and sends
+// them as one message
+func (a *AlertService) sendSummary(ctx context.Context, userID int, channel string) {
+	listKey := fmt.Sprintf(heldKey, userID, channel)
+	countKey := fmt.Sprintf(heldCountKey, userID, channel)
+	pipe := a.conn.Cache.TxPipeline()
+	examples := pipe.LRange(ctx, listKey, 0, -1)
+	count := pipe.Get(ctx, countKey)
+	pipe.Del(ctx, listKey, countKey)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		log.Printf("⚠️ Failed to take held %s notifications for user %d: %v", channel, userID, err)
+		return
+	}
+	held, _ := count.Int()
+	if held == 0 {
+		return
+	}
+	limit := loadNotificationRateLimit(ctx, a.conn, userID, channel)
+	summary := templates.New(templates.AlertSummary, templates.Vars{
+		"Count":    held,
+		"Minutes":  limit.WindowMinutes,
+		"Examples": examples.Val(),
+		"More":     held - len(examples.Val()),
+		"LogURL":   alertLogURL(),
+	})
+	locale := templates.UserLocale(ctx, a.conn, userID)
+	log.Printf("📨 Sending summary of %d held %s notifications to user %d", held, channel, userID)
+
+	switch channel {
+	case ChannelWebSocket:
+		socket.SendAlertToUser(userID, socket.AlertMessage{
+			Timestamp: a.now().UnixMilli(),
+			Message:   templates.Render(locale, templates.VariantText, summary),
+			Channel:   "alert",
+			Type:      "summary",
+			Tickers:   []string{},
+		})
+	case ChannelTelegram:
+		userChat, err := UserTelegramChat(ctx, a.conn, userID)
+		if err != nil {
+			log.Printf("⚠️ Not sending Telegram summary to user %d: %v", userID, err)
+			return
+		}
+		msg := templates.Render(locale, templates.VariantTelegram, summary)
+		if err := SendTelegramMessage(msg, userChat); err != nil {
+			log.Printf("Warning: failed to send Telegram message: %v", err)
+		}
+	case ChannelEmail:
+		to, ok := alertEmailRecipient(ctx, a.conn, userID, false)
+		if !ok {
+			return
+		}
+		subject, body := templates.RenderEmail(locale, summary, nil)
+		if err := email.SendEmail(to, subject, body); err != nil {
+			log.Printf("⚠️ Failed to email alert summary to user %d: %v", userID, err)
+		}
+	}
+}
+
+// alertLogURL opens the app on the alert log
+func alertLogURL() string {
+	return frontendURL() + "/app?alerts=logs"
+}
+
+// frontendURL is the app's base URL, for links in notifications
+func frontendURL() string {
+	base := os.Getenv("FRONTEND_URL")
+	if base == "" {
+		base = "https://peripheral.io"
+	}
+	return strings.TrimRight(base, "/")
+}
@@ -0,0 +1,90 @@
+package alerts
+
+import (
+	"backend/internal/data"
+	"backend/internal/queue"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// strategyResultKey caches a successful alert evaluation by strategy, version,
+// bucket starts (unix seconds, one per timeframe, trigger first) and universe
+// hash. Replicas and retries that evaluate the same strategy over the same
+// symbols within the same buckets reuse it instead of queuing the same worker
+// task again.
+const strategyResultKey = "strategy_alert_result:%d:v%d:%s:%s"
+
+// strategyResultTTL only bounds how long entries linger; the bucket in the key
+// already keeps a result from being reused in a later bucket
+const strategyResultTTL = 24 * time.Hour
+
+// strategyResultCacheKey builds the cache key for evaluating strategy over
+// symbols (nil for the default universe) at now
+func strategyResultCacheKey(ctx context.Context, conn *data.Conn, strategy StrategyAlert, symbols []string, now time.Time) (string, error) {
+	var version int
+	err := conn.DB.QueryRow(ctx,
+		`SELECT COALESCE(version, 1) FROM strategies WHERE strategyid = $1`,
+		strategy.StrategyID).Scan(&version)
+	if err != nil {
+		return "", fmt.Errorf("failed to load strategy version: %w", err)
+	}
+	buckets, err := bucketSignature(strategy, now)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(strategyResultKey, strategy.StrategyID, version, buckets, universeHash(symbols)), nil
+}
+
+// universeHash is an order-independent hash of a symbol list
+func universeHash(symbols []string) string {
+	if len(symbols) == 0 {
+		return "all"
+	}
+	sorted := append([]string(nil), symbols...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, ",")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// getCachedStrategyResult returns the cached result under key, or nil on a
+// miss or any cache error
+func getCachedStrategyResult(ctx context.Context, conn *data.Conn, key string) *queue.AlertResult {
+	raw, err := conn.Cache.Get(ctx, key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("⚠️ Failed to read cached strategy alert result %s: %v", key, err)
+		}
+		return nil
+	}
+	var result queue.AlertResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		// Corrupt entry - drop it and evaluate again
+		conn.Cache.Del(ctx, key)
+		return nil
+	}
+	return &result
+}
+
+// setCachedStrategyResult stores a successful result; failures are never
+// cached so a retry gets a fresh evaluation
+func setCachedStrategyResult(ctx context.Context, conn *data.Conn, key string, result *queue.AlertResult) {
+	if result == nil || !result.Success {
+		return
+	}
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	if err := conn.Cache.Set(ctx, key, raw, strategyResultTTL).Err(); err != nil {
+		log.Printf("⚠️ Failed to cache strategy alert result %s: %v", key, err)
+	}
+}
@@ -0,0 +1,158 @@
+package alerts
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Broad-universe strategies can match dozens of names in one sector at once.
+// Before notifying, each match is ranked against the other matches in its
+// sector, and a strategy can ask to be told only about the top N per sector.
+const unknownSector = "Unknown"
+
+// AlertMatch is one instance of a strategy alert result, ranked within its
+// sector
+type AlertMatch struct {
+	Ticker string
+	Score  float64
+	Sector string
+	// SectorPercentile is the share of the sector's other matches scoring
+	// below this one, 0-100, with ties counting half
+	SectorPercentile float64
+	SectorRank       int // 1 is the sector's best score
+	SectorSize       int // matches in the sector
+	Instance         map[string]interface{}
+}
+
+// newAlertMatch reads the fields ranking needs from a worker instance
+func newAlertMatch(inst map[string]interface{}) AlertMatch {
+	m := AlertMatch{Instance: inst}
+	if sym, ok := inst["symbol"].(string); ok && sym != "" {
+		m.Ticker = sym
+	} else if sym, ok := inst["ticker"].(string); ok {
+		m.Ticker = sym
+	}
+	if score, ok := inst["score"].(float64); ok {
+		m.Score = score
+	}
+	if sector, ok := inst["sector"].(string); ok {
+		m.Sector = sector
+	}
+	return m
+}
+
+// rankBySector ranks a result's instances within their sectors, annotating
+// each with sector, sector_percentile, sector_rank and sector_size. With
+// topN > 0 only each sector's topN best scores are kept. It returns the kept
+// instances, in their original order, and how many were dropped.
+func rankBySector(ctx context.Context, conn *data.Conn, instances []map[string]interface{}, topN int) ([]map[string]interface{}, int) {
+	matches := make([]AlertMatch, len(instances))
+	var missing []string
+	for i, inst := range instances {
+		// Annotate a copy; the result may be shared through the result cache
+		annotated := make(map[string]interface{}, len(inst)+4)
+		for k, v := range inst {
+			annotated[k] = v
+		}
+		matches[i] = newAlertMatch(annotated)
+		if matches[i].Sector == "" && matches[i].Ticker != "" {
+			missing = append(missing, matches[i].Ticker)
+		}
+	}
+	if len(missing) > 0 {
+		sectors, err := lookupSectors(ctx, conn, missing)
+		if err != nil {
+			log.Printf("⚠️ Ranking alert matches without looked-up sectors: %v", err)
+		}
+		for i := range matches {
+			if matches[i].Sector == "" {
+				matches[i].Sector = sectors[matches[i].Ticker]
+			}
+		}
+	}
+
+	bySector := map[string][]*AlertMatch{}
+	for i := range matches {
+		if matches[i].Sector == "" {
+			matches[i].Sector = unknownSector
+		}
+		bySector[matches[i].Sector] = append(bySector[matches[i].Sector], &matches[i])
+	}
+	for _, peers := range bySector {
+		rankSectorPeers(peers)
+	}
+
+	kept := make([]map[string]interface{}, 0, len(matches))
+	for _, m := range matches {
+		m.Instance["sector"] = m.Sector
+		m.Instance["sector_percentile"] = m.SectorPercentile
+		m.Instance["sector_rank"] = m.SectorRank
+		m.Instance["sector_size"] = m.SectorSize
+		if topN > 0 && m.SectorRank > topN {
+			continue
+		}
+		kept = append(kept, m.Instance)
+	}
+	return kept, len(matches) - len(kept)
+}
+
+// rankSectorPeers sets the rank and percentile of one sector's matches
+func rankSectorPeers(peers []*AlertMatch) {
+	sorted := append([]*AlertMatch(nil), peers...)
+	// Stable so equal scores keep the worker's order for ranking
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Score > sorted[j].Score })
+	n := len(sorted)
+	for i, m := range sorted {
+		m.SectorRank = i + 1
+		m.SectorSize = n
+		if n == 1 {
+			m.SectorPercentile = 100
+			continue
+		}
+		var below, ties int
+		for _, other := range sorted {
+			switch {
+			case other == m:
+			case other.Score < m.Score:
+				below++
+			case other.Score == m.Score:
+				ties++
+			}
+		}
+		m.SectorPercentile = 100 * (float64(below) + float64(ties)/2) / float64(n-1)
+	}
+}
+
+// lookupSectors returns the current sector of each ticker that has one
+func lookupSectors(ctx context.Context, conn *data.Conn, tickers []string) (map[string]string, error) {
+	sectors := make(map[string]string, len(tickers))
+	upper := make([]string, len(tickers))
+	for i, t := range tickers {
+		upper[i] = strings.ToUpper(t)
+	}
+	rows, err := conn.DB.Query(ctx, `
+		SELECT ticker, sector FROM securities
+		WHERE ticker = ANY($1) AND maxDate IS NULL AND sector IS NOT NULL AND sector <> ''`, upper)
+	if err != nil {
+		return sectors, fmt.Errorf("looking up sectors: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ticker, sector string
+		if err := rows.Scan(&ticker, &sector); err != nil {
+			return sectors, fmt.Errorf("scanning sector: %w", err)
+		}
+		sectors[ticker] = sector
+	}
+	// Instances may carry tickers in any case
+	for _, t := range tickers {
+		if s, ok := sectors[strings.ToUpper(t)]; ok {
+			sectors[t] = s
+		}
+	}
+	return sectors, rows.Err()
+}
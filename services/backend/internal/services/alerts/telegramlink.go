@@ -0,0 +1,129 @@
+package alerts
+
+import (
+	"backend/internal/data"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4"
+	"gopkg.in/telebot.v3"
+)
+
+// A user's alerts and reports go to the Telegram chat they linked, never to a
+// chat ID they typed in. Linking hands the user a one-time deep link to the
+// bot; opening it sends the bot "/start <token>" from their chat, and the bot
+// records that chat as theirs. TELEGRAM_CHAT_ID stays the ops chat.
+const (
+	telegramLinkKey = "telegram_link:%s" // user ID, by token
+	telegramLinkTTL = 15 * time.Minute
+)
+
+// ErrNoTelegramChat is returned when the user has not linked a Telegram chat
+var ErrNoTelegramChat = errors.New("no Telegram chat linked")
+
+// TelegramLink is a one-time deep link that links the chat it's opened in
+type TelegramLink struct {
+	URL       string `json:"url"`
+	ExpiresAt int64  `json:"expiresAt"` // ms since epoch
+}
+
+// NewTelegramLink issues a deep link that links the chat it's opened in to
+// the user, replacing any chat linked before
+func NewTelegramLink(ctx context.Context, conn *data.Conn, userID int) (TelegramLink, error) {
+	if !telegramEnabled() || bot.Me == nil || bot.Me.Username == "" {
+		return TelegramLink{}, fmt.Errorf("telegram bot is not available")
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return TelegramLink{}, fmt.Errorf("generating Telegram link token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+	if err := conn.Cache.Set(ctx, fmt.Sprintf(telegramLinkKey, token), userID, telegramLinkTTL).Err(); err != nil {
+		return TelegramLink{}, fmt.Errorf("storing Telegram link token: %w", err)
+	}
+	return TelegramLink{
+		URL:       fmt.Sprintf("https://t.me/%s?start=%s", bot.Me.Username, token),
+		ExpiresAt: time.Now().Add(telegramLinkTTL).UnixMilli(),
+	}, nil
+}
+
+// UserTelegramChat returns the chat the user linked, or ErrNoTelegramChat
+func UserTelegramChat(ctx context.Context, conn *data.Conn, userID int) (int64, error) {
+	var chat *int64
+	err := conn.DB.QueryRow(ctx, `SELECT telegram_chat_id FROM users WHERE userId = $1`, userID).Scan(&chat)
+	if err == pgx.ErrNoRows || (err == nil && chat == nil) {
+		return 0, ErrNoTelegramChat
+	}
+	if err != nil {
+		return 0, fmt.Errorf("loading Telegram chat of user %d: %w", userID, err)
+	}
+	return *chat, nil
+}
+
+// UnlinkTelegramChat forgets the user's linked chat
+func UnlinkTelegramChat(ctx context.Context, conn *data.Conn, userID int) error {
+	_, err := conn.DB.Exec(ctx, `
+		UPDATE users SET telegram_chat_id = NULL, telegram_linked_at = NULL
+		WHERE userId = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("unlinking Telegram chat of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+var telegramUpdatesOnce sync.Once
+
+// startTelegramUpdates starts taking the bot's updates, for "/start <token>".
+// The poller runs for the life of the process, across alert service restarts.
+func startTelegramUpdates(conn *data.Conn) {
+	if !telegramEnabled() {
+		return
+	}
+	telegramUpdatesOnce.Do(func() {
+		bot.Handle("/start", func(c telebot.Context) error {
+			return linkTelegramChat(conn, c)
+		})
+		go bot.Start()
+		log.Printf("🤖 Taking Telegram updates for chat linking")
+	})
+}
+
+// linkTelegramChat links the chat a "/start <token>" came from to the
+// token's user. The token is used up either way.
+func linkTelegramChat(conn *data.Conn, c telebot.Context) error {
+	token := c.Message().Payload
+	if token == "" {
+		return c.Send("Open the link from your Peripheral settings to get alerts here.")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	key := fmt.Sprintf(telegramLinkKey, token)
+	pipe := conn.Cache.TxPipeline()
+	get := pipe.Get(ctx, key)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		log.Printf("⚠️ Failed to read Telegram link token: %v", err)
+		return c.Send("Linking failed, please try again.")
+	}
+	userID, err := strconv.Atoi(get.Val())
+	if err != nil {
+		return c.Send("This link has expired or was already used. Get a new one from your Peripheral settings.")
+	}
+	chat := c.Chat().ID
+	if _, err := conn.DB.Exec(ctx, `
+		UPDATE users SET telegram_chat_id = $2, telegram_linked_at = NOW()
+		WHERE userId = $1`, userID, chat); err != nil {
+		log.Printf("⚠️ Failed to link Telegram chat for user %d: %v", userID, err)
+		return c.Send("Linking failed, please try again.")
+	}
+	log.Printf("🔗 Linked Telegram chat for user %d", userID)
+	return c.Send("Linked. Your Peripheral alerts will come here.")
+}
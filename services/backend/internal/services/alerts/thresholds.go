@@ -0,0 +1,59 @@
+package alerts
+
+import (
+	"backend/internal/app/strategy"
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// AnalyzeStrategyAlertThresholds refreshes the threshold suggestion of every
+// active strategy alert using the default precision target and horizon.
+func AnalyzeStrategyAlertThresholds(conn *data.Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	rows, err := conn.DB.Query(ctx, `
+		SELECT strategyid, userid FROM strategies
+		WHERE alertactive = true AND userid IS NOT NULL`)
+	if err != nil {
+		return fmt.Errorf("error loading active strategy alerts: %w", err)
+	}
+	type strategyRef struct{ strategyID, userID int }
+	var refs []strategyRef
+	for rows.Next() {
+		var ref strategyRef
+		if err := rows.Scan(&ref.strategyID, &ref.userID); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning strategy alert: %w", err)
+		}
+		refs = append(refs, ref)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating strategy alerts: %w", err)
+	}
+
+	var failed int
+	for _, ref := range refs {
+		suggestion, err := strategy.AnalyzeAlertThreshold(ctx, conn, ref.userID, ref.strategyID,
+			strategy.DefaultTargetPrecision, strategy.DefaultThresholdHorizonDays)
+		if err != nil {
+			failed++
+			log.Printf("⚠️ Strategy %d: threshold analysis failed: %v", ref.strategyID, err)
+			continue
+		}
+		if suggestion.SuggestedThreshold != nil {
+			log.Printf("🔄 Strategy %d: suggested alert threshold %.3f (%d samples)",
+				ref.strategyID, *suggestion.SuggestedThreshold, suggestion.SampleSize)
+		}
+	}
+
+	log.Printf("✅ Analyzed alert thresholds for %d strategies (%d failed)", len(refs), failed)
+	if failed > 0 && failed == len(refs) {
+		return fmt.Errorf("threshold analysis failed for all %d strategies", failed)
+	}
+	return nil
+}
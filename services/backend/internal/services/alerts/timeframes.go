@@ -0,0 +1,148 @@
+package alerts
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A strategy alert may combine conditions on several timeframes, e.g. a daily
+// trend filter with a 15 minute trigger. Its finest timeframe is the trigger:
+// throttling and the once-per-bucket dedupe use its bucket, as they did when a
+// strategy had only a minimum timeframe. The coarser ones are filters, which
+// the worker evaluates on completed bars only so a filter doesn't flip while
+// its bar is still forming.
+const (
+	TimeframeTrigger = "trigger"
+	TimeframeFilter  = "filter"
+)
+
+var timeframeRe = regexp.MustCompile(`^(\d+)([mhdwqy]?)$`)
+
+// timeframeMinutes approximates a timeframe's length for ordering; keep in
+// line with _timeframe_minutes in services/worker/src/generator.py
+func timeframeMinutes(tf string) (int, error) {
+	matches := timeframeRe.FindStringSubmatch(strings.ToLower(tf))
+	if matches == nil {
+		return 0, fmt.Errorf("invalid timeframe format: %s", tf)
+	}
+	n, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid number in timeframe: %s", tf)
+	}
+	switch matches[2] {
+	case "h":
+		return n * 60, nil
+	case "d":
+		return n * 1440, nil
+	case "w":
+		return n * 10080, nil
+	case "q":
+		return n * 129600, nil
+	case "y":
+		return n * 525600, nil
+	default: // minutes (no unit means minutes)
+		return n, nil
+	}
+}
+
+// alertTimeframes returns a strategy's distinct valid timeframes, finest
+// first. The minimum timeframe is always among them, so strategies saved
+// before timeframes were recorded keep their single timeframe.
+func alertTimeframes(timeframes []string, minTimeframe string) []string {
+	minutes := map[string]int{}
+	for _, tf := range append([]string{minTimeframe}, timeframes...) {
+		tf = strings.ToLower(strings.TrimSpace(tf))
+		if _, seen := minutes[tf]; seen || tf == "" {
+			continue
+		}
+		m, err := timeframeMinutes(tf)
+		if err != nil {
+			continue
+		}
+		minutes[tf] = m
+	}
+	sorted := make([]string, 0, len(minutes))
+	for tf := range minutes {
+		sorted = append(sorted, tf)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if minutes[sorted[i]] != minutes[sorted[j]] {
+			return minutes[sorted[i]] < minutes[sorted[j]]
+		}
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
+
+// triggerTimeframe is the timeframe a strategy's alert is throttled on
+func (s StrategyAlert) triggerTimeframe() string {
+	if len(s.Timeframes) > 0 {
+		return s.Timeframes[0]
+	}
+	return s.MinTimeframe
+}
+
+// timeframeBuckets returns the bucket each of a strategy's timeframes is in
+// at now
+func timeframeBuckets(strategy StrategyAlert, now time.Time) (map[string]time.Time, error) {
+	timeframes := strategy.Timeframes
+	if len(timeframes) == 0 {
+		timeframes = []string{strategy.MinTimeframe}
+	}
+	buckets := make(map[string]time.Time, len(timeframes))
+	for _, tf := range timeframes {
+		start, err := bucketStart(now, tf)
+		if err != nil {
+			return nil, err
+		}
+		buckets[tf] = start
+	}
+	return buckets, nil
+}
+
+// timeframeTaskArgs describes a multi-timeframe strategy's timeframes to the
+// worker: each one's role and the start of its current bucket (unix
+// seconds). Single-timeframe strategies send nothing.
+func timeframeTaskArgs(strategy StrategyAlert, now time.Time) (map[string]interface{}, error) {
+	if len(strategy.Timeframes) < 2 {
+		return nil, nil
+	}
+	buckets, err := timeframeBuckets(strategy, now)
+	if err != nil {
+		return nil, err
+	}
+	args := make(map[string]interface{}, len(buckets))
+	for _, tf := range strategy.Timeframes {
+		role := TimeframeFilter
+		if tf == strategy.triggerTimeframe() {
+			role = TimeframeTrigger
+		}
+		args[tf] = map[string]interface{}{
+			"role":         role,
+			"bucket_start": buckets[tf].Unix(),
+		}
+	}
+	return args, nil
+}
+
+// bucketSignature joins the bucket starts of a strategy's timeframes, trigger
+// first, for keys that must change whenever any of them does
+func bucketSignature(strategy StrategyAlert, now time.Time) (string, error) {
+	buckets, err := timeframeBuckets(strategy, now)
+	if err != nil {
+		return "", err
+	}
+	timeframes := strategy.Timeframes
+	if len(timeframes) == 0 {
+		timeframes = []string{strategy.MinTimeframe}
+	}
+	parts := make([]string, 0, len(timeframes))
+	for _, tf := range timeframes {
+		parts = append(parts, strconv.FormatInt(buckets[tf].Unix(), 10))
+	}
+	return strings.Join(parts, "-"), nil
+}
@@ -0,0 +1,75 @@
+package alerts
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Trendline is the two-point line a trendline cross alert tracks
+type Trendline struct {
+	DrawingID int
+	T1, T2    int64 // ms
+	P1, P2    float64
+}
+
+// ParseTrendline builds a Trendline from a chart_drawings points payload
+func ParseTrendline(drawingID int, points []byte) (*Trendline, error) {
+	var pts []struct {
+		Timestamp int64   `json:"timestamp"`
+		Price     float64 `json:"price"`
+	}
+	if err := json.Unmarshal(points, &pts); err != nil {
+		return nil, fmt.Errorf("decoding trendline points: %w", err)
+	}
+	if len(pts) != 2 || pts[0].Timestamp == pts[1].Timestamp {
+		return nil, fmt.Errorf("trendline %d needs two points at different times", drawingID)
+	}
+	return &Trendline{DrawingID: drawingID, T1: pts[0].Timestamp, P1: pts[0].Price, T2: pts[1].Timestamp, P2: pts[1].Price}, nil
+}
+
+// ProjectedPrice extends the line to t
+func (l Trendline) ProjectedPrice(t time.Time) float64 {
+	slope := (l.P2 - l.P1) / float64(l.T2-l.T1)
+	return l.P1 + slope*float64(t.UnixMilli()-l.T1)
+}
+
+// trendline edits are picked up within trendlineRefreshTTL
+const trendlineRefreshTTL = 10 * time.Second
+
+var trendlineRefreshedAt sync.Map // key: alertID, value: time.Time
+
+// currentTrendline returns the alert's line, reloading the drawing when stale.
+// A nil line means the drawing (and with it the alert row) was deleted.
+func currentTrendline(conn *data.Conn, alert PriceAlert, now time.Time) (*Trendline, error) {
+	if refreshed, ok := trendlineRefreshedAt.Load(alert.AlertID); ok && now.Sub(refreshed.(time.Time)) < trendlineRefreshTTL {
+		return alert.Trendline, nil
+	}
+	var points []byte
+	err := conn.DB.QueryRow(context.Background(),
+		`SELECT points FROM chart_drawings WHERE id = $1`, alert.Trendline.DrawingID).Scan(&points)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading trendline %d: %w", alert.Trendline.DrawingID, err)
+	}
+	line, err := ParseTrendline(alert.Trendline.DrawingID, points)
+	if err != nil {
+		return nil, err
+	}
+	alert.Trendline = line
+	// Only write back alerts that were not removed while the drawing loaded
+	service := GetAlertService()
+	if _, ok := service.priceAlerts.Load(alert.AlertID); ok {
+		service.priceAlerts.Store(alert.AlertID, alert)
+		priceAlerts.Store(alert.AlertID, alert)
+	}
+	trendlineRefreshedAt.Store(alert.AlertID, now)
+	return line, nil
+}
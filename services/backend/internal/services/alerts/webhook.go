@@ -0,0 +1,539 @@
+package alerts
+
+import (
+	"backend/internal/data"
+	"backend/internal/dryrun"
+	"backend/internal/services/socket"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Alert webhooks carry every price and strategy alert trigger of a user into
+// their own automation (Zapier, Make, n8n, a script) as a JSON event, so they
+// don't have to scrape Telegram. Each webhook picks the schema its events are
+// written in:
+//
+//   - peripheral.alert.v1: the trigger as nested objects, with one entry per
+//     match carrying the strategy's output for it and a link to its chart
+//   - peripheral.alert.flat.v1: the same trigger as one flat object of
+//     snake_case fields, for tools that map fields one level deep; matches are
+//     joined into comma separated lists
+//
+// A schema is never changed incompatibly: new fields may be added, anything
+// else is a new version. Events are POSTed with Content-Type
+// application/json, the event type in X-Peripheral-Event and a signature in
+// X-Peripheral-Signature: "t=<unix seconds>,v1=<hex HMAC-SHA256 of
+// "<t>.<body>" keyed by the webhook's secret>". The event ID stays the same
+// when a failed delivery is retried, so receivers can drop repeats. Webhooks
+// are sent whether or not the user is online and are not rate limited, but
+// are held back during maintenance like the other fallbacks.
+const (
+	WebhookSchemaV1     = "peripheral.alert.v1"
+	WebhookSchemaFlatV1 = "peripheral.alert.flat.v1"
+
+	// Event types
+	WebhookEventTriggered = "alert.triggered"
+	WebhookEventTest      = "alert.test"
+
+	webhookEventHeader     = "X-Peripheral-Event"
+	webhookSignatureHeader = "X-Peripheral-Signature"
+	webhookChannelPrefix   = "webhook:" // + webhook ID, in sentChannels
+	webhookTimeout         = 10 * time.Second
+	webhookMaxResponse     = 64 << 10
+	webhookMaxURLLength    = 2048
+	// webhookMaxFailures failed deliveries in a row deactivate a webhook
+	webhookMaxFailures = 20
+	// webhookMaxMatches bounds the matches one event lists
+	webhookMaxMatches = 50
+)
+
+// WebhookSchemas are the schemas a webhook can be registered with
+var WebhookSchemas = []string{WebhookSchemaV1, WebhookSchemaFlatV1}
+
+// WebhookEvent is an alert trigger in the peripheral.alert.v1 schema
+type WebhookEvent struct {
+	Schema    string         `json:"schema"`
+	ID        string         `json:"id"` // the same on every retry of a trigger
+	Type      string         `json:"type"`
+	CreatedAt string         `json:"createdAt"` // RFC 3339
+	Alert     WebhookAlert   `json:"alert"`
+	Matches   []WebhookMatch `json:"matches"`
+	Links     WebhookLinks   `json:"links"`
+}
+
+// WebhookAlert is the alert that triggered
+type WebhookAlert struct {
+	Type        string `json:"type"` // "price" or "strategy"
+	ID          int    `json:"id"`   // the price alert's, or the strategy's
+	LogID       int    `json:"logId,omitempty"`
+	Name        string `json:"name,omitempty"` // the strategy's
+	Message     string `json:"message"`
+	TriggeredAt string `json:"triggeredAt"` // RFC 3339
+	// Price and Direction ("above" or "below") are a price alert's level
+	Price      *float64 `json:"price,omitempty"`
+	Direction  string   `json:"direction,omitempty"`
+	MatchCount int      `json:"matchCount"` // may exceed the matches listed
+}
+
+// WebhookMatch is a security the alert triggered on
+type WebhookMatch struct {
+	Ticker     string   `json:"ticker"`
+	SecurityID int      `json:"securityId,omitempty"`
+	Score      *float64 `json:"score,omitempty"`
+	ChartURL   string   `json:"chartUrl"`
+	// Data is the strategy's output for the match
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// WebhookLinks lead back to the app
+type WebhookLinks struct {
+	Chart    string `json:"chart,omitempty"` // of the first match
+	AlertLog string `json:"alertLog"`
+}
+
+// ValidateWebhookURL checks a webhook URL can be delivered to: an absolute
+// https URL without credentials. Where it resolves to is checked on every
+// delivery.
+func ValidateWebhookURL(raw string) error {
+	if len(raw) > webhookMaxURLLength {
+		return fmt.Errorf("url must be at most %d characters", webhookMaxURLLength)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("url must be an absolute https URL")
+	}
+	if u.Scheme != "https" && !(devEnv && u.Scheme == "http") {
+		return fmt.Errorf("url must use https")
+	}
+	if u.User != nil {
+		return fmt.Errorf("url must not contain credentials")
+	}
+	return nil
+}
+
+// webhookClient only connects to public addresses, so a webhook can't be
+// pointed at the backend's own network, and doesn't follow redirects
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: publicAddressOnly}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConnsPerHost: 2,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+func publicAddressOnly(_, address string, _ syscall.RawConn) error {
+	if devEnv {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("webhook address %s is not public", host)
+	}
+	return nil
+}
+
+// EncodeWebhookEvent writes an event in a schema
+func EncodeWebhookEvent(ev *WebhookEvent, schema string) ([]byte, error) {
+	var v interface{}
+	switch schema {
+	case WebhookSchemaV1:
+		v1 := *ev
+		v1.Schema = schema
+		v = v1
+	case WebhookSchemaFlatV1:
+		v = flattenWebhookEvent(ev)
+	default:
+		return nil, fmt.Errorf("unknown webhook schema %q", schema)
+	}
+	// Links stay readable in the tools that show the raw event
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// flattenWebhookEvent is the peripheral.alert.flat.v1 form of an event
+func flattenWebhookEvent(ev *WebhookEvent) map[string]interface{} {
+	tickers := make([]string, len(ev.Matches))
+	charts := make([]string, len(ev.Matches))
+	for i, m := range ev.Matches {
+		tickers[i], charts[i] = m.Ticker, m.ChartURL
+	}
+	flat := map[string]interface{}{
+		"schema":        WebhookSchemaFlatV1,
+		"id":            ev.ID,
+		"type":          ev.Type,
+		"created_at":    ev.CreatedAt,
+		"alert_type":    ev.Alert.Type,
+		"alert_id":      ev.Alert.ID,
+		"alert_name":    ev.Alert.Name,
+		"log_id":        ev.Alert.LogID,
+		"message":       ev.Alert.Message,
+		"triggered_at":  ev.Alert.TriggeredAt,
+		"match_count":   ev.Alert.MatchCount,
+		"tickers":       strings.Join(tickers, ","),
+		"chart_urls":    strings.Join(charts, ","),
+		"chart_url":     ev.Links.Chart,
+		"alert_log_url": ev.Links.AlertLog,
+		"ticker":        "",
+		"security_id":   0,
+		"score":         nil,
+		"price":         ev.Alert.Price,
+		"direction":     ev.Alert.Direction,
+	}
+	if len(ev.Matches) > 0 {
+		first := ev.Matches[0]
+		flat["ticker"], flat["security_id"], flat["score"] = first.Ticker, first.SecurityID, first.Score
+	}
+	return flat
+}
+
+// BuildWebhookEvent describes a triggered alert, reading the matches back
+// from its alert log entry
+func BuildWebhookEvent(ctx context.Context, conn *data.Conn, alert socket.AlertMessage) (*WebhookEvent, error) {
+	triggeredAt := time.UnixMilli(alert.Timestamp).UTC()
+	ev := &WebhookEvent{
+		ID:        webhookEventID(alert),
+		Type:      WebhookEventTriggered,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Alert: WebhookAlert{
+			Type:        alert.Type,
+			ID:          alert.AlertID,
+			LogID:       alert.LogID,
+			Message:     alert.Message,
+			TriggeredAt: triggeredAt.Format(time.RFC3339),
+		},
+		Matches: []WebhookMatch{},
+		Links:   WebhookLinks{AlertLog: alertLogURL()},
+	}
+
+	if alert.Type == "price" {
+		var price *float64
+		var above *bool
+		err := conn.DB.QueryRow(ctx, `SELECT price, direction FROM alerts WHERE alertId = $1`, alert.AlertID).Scan(&price, &above)
+		if err != nil {
+			return nil, fmt.Errorf("error loading price alert %d: %v", alert.AlertID, err)
+		}
+		ev.Alert.Price = price
+		if above != nil {
+			ev.Alert.Direction = "below"
+			if *above {
+				ev.Alert.Direction = "above"
+			}
+		}
+		for _, ticker := range alert.Tickers {
+			ev.Matches = append(ev.Matches, WebhookMatch{Ticker: ticker, SecurityID: alert.SecurityID})
+		}
+	} else {
+		matches, name, err := strategyWebhookMatches(ctx, conn, alert)
+		if err != nil {
+			return nil, err
+		}
+		ev.Matches, ev.Alert.Name = matches, name
+	}
+	ev.Alert.MatchCount = len(ev.Matches)
+	if len(alert.Tickers) > ev.Alert.MatchCount {
+		ev.Alert.MatchCount = len(alert.Tickers)
+	}
+	if len(ev.Matches) > webhookMaxMatches {
+		ev.Matches = ev.Matches[:webhookMaxMatches]
+	}
+
+	if err := resolveMatchSecurities(ctx, conn, ev.Matches); err != nil {
+		return nil, err
+	}
+	for i := range ev.Matches {
+		ev.Matches[i].ChartURL = chartURL(ev.Matches[i].Ticker, ev.Matches[i].SecurityID, triggeredAt)
+	}
+	if len(ev.Matches) > 0 {
+		ev.Links.Chart = ev.Matches[0].ChartURL
+	}
+	return ev, nil
+}
+
+// webhookEventID is the same for every delivery of one trigger
+func webhookEventID(alert socket.AlertMessage) string {
+	switch {
+	case alert.DeliveryID != "":
+		return "evt_" + alert.DeliveryID
+	case alert.LogID != 0:
+		return "evt_log-" + strconv.Itoa(alert.LogID)
+	}
+	return fmt.Sprintf("evt_%s-%d-%d", alert.Type, alert.AlertID, alert.Timestamp)
+}
+
+// strategyWebhookMatches reads a strategy alert's matches from its log entry,
+// which keeps the strategy's output when there were few enough; otherwise
+// only the tickers are known
+func strategyWebhookMatches(ctx context.Context, conn *data.Conn, alert socket.AlertMessage) ([]WebhookMatch, string, error) {
+	var payload struct {
+		StrategyName string                   `json:"strategyName"`
+		Instances    []map[string]interface{} `json:"instances"`
+	}
+	if alert.LogID != 0 {
+		var raw []byte
+		err := conn.DB.QueryRow(ctx, `SELECT payload FROM alert_logs WHERE log_id = $1`, alert.LogID).Scan(&raw)
+		if err != nil {
+			return nil, "", fmt.Errorf("error loading alert log %d: %v", alert.LogID, err)
+		}
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return nil, "", fmt.Errorf("error parsing alert log %d: %v", alert.LogID, err)
+		}
+	}
+
+	matches := []WebhookMatch{}
+	for _, inst := range payload.Instances {
+		m := WebhookMatch{Data: inst}
+		for _, key := range []string{"symbol", "ticker"} {
+			if t, ok := inst[key].(string); ok && t != "" {
+				m.Ticker = t
+				break
+			}
+		}
+		if m.Ticker == "" {
+			continue
+		}
+		if id, ok := inst["securityId"].(float64); ok {
+			m.SecurityID = int(id)
+		}
+		if score, ok := inst["score"].(float64); ok {
+			m.Score = &score
+		}
+		matches = append(matches, m)
+	}
+	if len(matches) == 0 {
+		for _, ticker := range alert.Tickers {
+			matches = append(matches, WebhookMatch{Ticker: ticker})
+		}
+	}
+	return matches, payload.StrategyName, nil
+}
+
+// resolveMatchSecurities fills in the security IDs the matches lack, for
+// their chart links
+func resolveMatchSecurities(ctx context.Context, conn *data.Conn, matches []WebhookMatch) error {
+	var tickers []string
+	for _, m := range matches {
+		if m.SecurityID == 0 {
+			tickers = append(tickers, m.Ticker)
+		}
+	}
+	if len(tickers) == 0 {
+		return nil
+	}
+	rows, err := conn.DB.Query(ctx, `
+		SELECT DISTINCT ON (ticker) ticker, securityid FROM securities
+		WHERE ticker = ANY($1)
+		ORDER BY ticker, maxdate DESC NULLS FIRST`, tickers)
+	if err != nil {
+		return fmt.Errorf("error looking up match securities: %v", err)
+	}
+	defer rows.Close()
+	ids := make(map[string]int, len(tickers))
+	for rows.Next() {
+		var ticker string
+		var id int
+		if err := rows.Scan(&ticker, &id); err != nil {
+			return fmt.Errorf("error scanning match security: %v", err)
+		}
+		ids[ticker] = id
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error looking up match securities: %v", err)
+	}
+	for i := range matches {
+		if matches[i].SecurityID == 0 {
+			matches[i].SecurityID = ids[matches[i].Ticker]
+		}
+	}
+	return nil
+}
+
+// chartURL opens the app on a security's chart at a time
+func chartURL(ticker string, securityID int, at time.Time) string {
+	q := url.Values{"ticker": {ticker}, "t": {strconv.FormatInt(at.UnixMilli(), 10)}}
+	if securityID != 0 {
+		q.Set("securityId", strconv.Itoa(securityID))
+	}
+	return frontendURL() + "/app?" + q.Encode()
+}
+
+// ExampleWebhookEvent is a strategy alert trigger, for documenting the
+// schemas and testing a webhook
+func ExampleWebhookEvent() *WebhookEvent {
+	at := time.Date(2024, 3, 8, 14, 35, 0, 0, time.UTC)
+	score := 0.87
+	link := chartURL("NVDA", 0, at)
+	return &WebhookEvent{
+		ID:        "evt_example",
+		Type:      WebhookEventTest,
+		CreatedAt: at.Add(2 * time.Second).Format(time.RFC3339),
+		Alert: WebhookAlert{
+			Type:        "strategy",
+			ID:          1,
+			Name:        "Gap up on volume",
+			Message:     "Strategy 'Gap up on volume' triggered for 1 match",
+			TriggeredAt: at.Format(time.RFC3339),
+			MatchCount:  1,
+		},
+		Matches: []WebhookMatch{{
+			Ticker:   "NVDA",
+			Score:    &score,
+			ChartURL: link,
+			Data:     map[string]interface{}{"ticker": "NVDA", "score": score, "gap_pct": 4.2, "rel_volume": 3.1},
+		}},
+		Links: WebhookLinks{Chart: link, AlertLog: alertLogURL()},
+	}
+}
+
+// PostWebhook sends an encoded event to a webhook, signed with its secret. It
+// returns the HTTP status, 0 when there was no response, and an error unless
+// the status is 2xx.
+func PostWebhook(ctx context.Context, webhookURL, secret, eventType string, body []byte) (int, error) {
+	if dryrun.Notify(ctx, "webhook", fmt.Sprintf("posted a %s event to %s", eventType, webhookURL),
+		map[string]interface{}{"url": webhookURL, "body": json.RawMessage(body)}) {
+		return http.StatusOK, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Peripheral-Webhooks/1")
+	req.Header.Set(webhookEventHeader, eventType)
+	req.Header.Set(webhookSignatureHeader, "t="+ts+",v1="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, webhookMaxResponse))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// RecordWebhookDelivery keeps the outcome of a delivery on the webhook,
+// deactivating it after too many failures in a row
+func RecordWebhookDelivery(ctx context.Context, conn *data.Conn, webhookID, status int, deliveryErr error) {
+	var err error
+	if deliveryErr == nil {
+		_, err = conn.DB.Exec(ctx, `
+			UPDATE alert_webhooks
+			SET failure_count = 0, last_status = $2, last_delivery_at = NOW()
+			WHERE webhook_id = $1`, webhookID, strconv.Itoa(status))
+	} else {
+		lastStatus := deliveryErr.Error()
+		if len(lastStatus) > 200 {
+			lastStatus = lastStatus[:200]
+		}
+		var active bool
+		err = conn.DB.QueryRow(ctx, `
+			UPDATE alert_webhooks
+			SET failure_count = failure_count + 1, last_status = $2, last_delivery_at = NOW(),
+			    active = active AND failure_count + 1 < $3
+			WHERE webhook_id = $1
+			RETURNING active`, webhookID, lastStatus, webhookMaxFailures).Scan(&active)
+		if err == nil && !active {
+			log.Printf("🔕 Alert webhook %d deactivated after %d failed deliveries in a row", webhookID, webhookMaxFailures)
+		}
+	}
+	if err != nil {
+		log.Printf("⚠️ Failed to record delivery of alert webhook %d: %v", webhookID, err)
+	}
+}
+
+type alertWebhook struct {
+	ID     int
+	URL    string
+	Schema string
+	Secret string
+}
+
+// deliverAlertWebhooks posts a trigger to each of the user's active webhooks
+// for its alert type that isn't in sent yet, adding those that took it. It
+// returns an error when any failed, so the outbox retries them.
+func deliverAlertWebhooks(conn *data.Conn, userID int, alert socket.AlertMessage, sent sentChannels) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	rows, err := conn.DB.Query(ctx, `
+		SELECT webhook_id, url, schema, secret FROM alert_webhooks
+		WHERE user_id = $1 AND active AND $2 = ANY(alert_types)
+		ORDER BY webhook_id`, userID, alert.Type)
+	if err != nil {
+		return fmt.Errorf("error loading alert webhooks: %v", err)
+	}
+	var hooks []alertWebhook
+	for rows.Next() {
+		var h alertWebhook
+		if err := rows.Scan(&h.ID, &h.URL, &h.Schema, &h.Secret); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning alert webhook: %v", err)
+		}
+		if !sent[webhookChannelPrefix+strconv.Itoa(h.ID)] {
+			hooks = append(hooks, h)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error loading alert webhooks: %v", err)
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	ev, err := BuildWebhookEvent(ctx, conn, alert)
+	if err != nil {
+		return err
+	}
+	var failed []error
+	for _, h := range hooks {
+		body, err := EncodeWebhookEvent(ev, h.Schema)
+		if err != nil {
+			failed = append(failed, fmt.Errorf("webhook %d: %w", h.ID, err))
+			continue
+		}
+		status, err := PostWebhook(ctx, h.URL, h.Secret, ev.Type, body)
+		RecordWebhookDelivery(ctx, conn, h.ID, status, err)
+		if err != nil {
+			failed = append(failed, fmt.Errorf("webhook %d: %w", h.ID, err))
+			continue
+		}
+		sent[webhookChannelPrefix+strconv.Itoa(h.ID)] = true
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to deliver alert webhooks: %w", errors.Join(failed...))
+	}
+	return nil
+}
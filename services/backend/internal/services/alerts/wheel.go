@@ -0,0 +1,163 @@
+package alerts
+
+import (
+	"backend/internal/app/limits"
+	"sync"
+	"time"
+)
+
+// Each strategy alert is evaluated on its own interval, from every scan tick
+// up to once a day. A hashed timing wheel with one slot per tick hands the
+// strategy loop only the strategies due on that tick, so daily strategies
+// don't cost a pass over every alert each tick: a strategy sits in the slot of
+// its next run, with the number of full turns of the wheel left before it.
+const (
+	// strategyWheelSlots covers an hour of ten second ticks
+	strategyWheelSlots = 360
+	// strategyAlertRefreshInterval is how often the loop re-reads active
+	// strategy alerts, picking up activations, deactivations and new intervals
+	strategyAlertRefreshInterval = time.Minute
+)
+
+type wheelEntry struct {
+	ticks  int // the strategy's interval in ticks
+	slot   int
+	rounds int // full turns left before it is due
+}
+
+// strategyWheel schedules strategy alerts by ID
+type strategyWheel struct {
+	mu      sync.Mutex
+	slots   []map[int]*wheelEntry
+	entries map[int]*wheelEntry
+	pos     int
+}
+
+func newStrategyWheel() *strategyWheel {
+	w := &strategyWheel{}
+	w.reset()
+	return w
+}
+
+// reset unschedules every strategy
+func (w *strategyWheel) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.slots = make([]map[int]*wheelEntry, strategyWheelSlots)
+	for i := range w.slots {
+		w.slots[i] = map[int]*wheelEntry{}
+	}
+	w.entries = map[int]*wheelEntry{}
+	w.pos = 0
+}
+
+// schedule runs a strategy on the next tick and every interval after it,
+// replacing any schedule it had
+func (w *strategyWheel) schedule(strategyID int, interval time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.unschedule(strategyID)
+	e := &wheelEntry{ticks: intervalTicks(interval)}
+	w.entries[strategyID] = e
+	w.place(strategyID, e, 1)
+}
+
+// interval returns a scheduled strategy's interval in ticks
+func (w *strategyWheel) interval(strategyID int) (int, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	e, ok := w.entries[strategyID]
+	if !ok {
+		return 0, false
+	}
+	return e.ticks, true
+}
+
+// remove unschedules a strategy
+func (w *strategyWheel) remove(strategyID int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.unschedule(strategyID)
+}
+
+// advance moves the wheel one tick and returns the strategies due on it, each
+// already rescheduled one interval later
+func (w *strategyWheel) advance() []int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pos = (w.pos + 1) % len(w.slots)
+	var due []int
+	for id, e := range w.slots[w.pos] {
+		if e.rounds > 0 {
+			e.rounds--
+			continue
+		}
+		delete(w.slots[w.pos], id)
+		due = append(due, id)
+	}
+	for _, id := range due {
+		e := w.entries[id]
+		w.place(id, e, e.ticks)
+	}
+	return due
+}
+
+// retry moves strategies whose run was skipped to the next tick, so one that
+// came due while the scan was skipped runs as soon as it resumes
+func (w *strategyWheel) retry(strategyIDs []int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, id := range strategyIDs {
+		e, ok := w.entries[id]
+		if !ok {
+			continue
+		}
+		delete(w.slots[e.slot], id)
+		w.place(id, e, 1)
+	}
+}
+
+// place puts a strategy in the slot after ticks more ticks; callers hold mu
+func (w *strategyWheel) place(strategyID int, e *wheelEntry, ticks int) {
+	e.slot = (w.pos + ticks) % len(w.slots)
+	e.rounds = (ticks - 1) / len(w.slots)
+	w.slots[e.slot][strategyID] = e
+}
+
+// unschedule drops a strategy from its slot; callers hold mu
+func (w *strategyWheel) unschedule(strategyID int) {
+	if e, ok := w.entries[strategyID]; ok {
+		delete(w.slots[e.slot], strategyID)
+		delete(w.entries, strategyID)
+	}
+}
+
+// intervalTicks rounds an interval up to whole scan ticks
+func intervalTicks(interval time.Duration) int {
+	ticks := int((interval + strategyAlertFrequency - 1) / strategyAlertFrequency)
+	if ticks < 1 {
+		ticks = 1
+	}
+	return ticks
+}
+
+// strategyAlertInterval is the interval a strategy is evaluated at: the one it
+// asked for, or the base tick, raised to its plan's minimum
+func strategyAlertInterval(requestedSeconds, planMinSeconds *int) time.Duration {
+	interval := strategyAlertFrequency
+	if requestedSeconds != nil {
+		interval = time.Duration(*requestedSeconds) * time.Second
+	}
+	if planMinSeconds != nil {
+		if planMin := time.Duration(*planMinSeconds) * time.Second; planMin > interval {
+			interval = planMin
+		}
+	}
+	if interval < limits.MinStrategyAlertInterval {
+		interval = limits.MinStrategyAlertInterval
+	}
+	if interval > limits.MaxStrategyAlertInterval {
+		interval = limits.MaxStrategyAlertInterval
+	}
+	return interval
+}
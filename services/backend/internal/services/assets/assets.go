@@ -0,0 +1,132 @@
+// Package assets stores images (security logos and icons) by the SHA-256 of
+// their content, replacing the base64 data URLs kept in securities. Stored
+// assets never change, so they are served with their hash as a strong ETag
+// and cached indefinitely.
+package assets
+
+import (
+	"backend/internal/data"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// PathPrefix is where the backend serves assets; URL(hash) is relative to it
+const PathPrefix = "/assets/"
+
+// maxSize bounds a single asset; Polygon branding images are a few KB
+const maxSize = 2 << 20
+
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ErrNotFound is returned by Load for an unknown hash
+var ErrNotFound = fmt.Errorf("asset not found")
+
+// Asset is an image as stored in the assets table
+type Asset struct {
+	Hash        string
+	ContentType string
+	Data        []byte
+	CreatedAt   time.Time
+}
+
+// DataURL returns the asset inlined as a data URL, for renderers that cannot
+// fetch from the backend
+func (a *Asset) DataURL() string {
+	return fmt.Sprintf("data:%s;base64,%s", a.ContentType, base64.StdEncoding.EncodeToString(a.Data))
+}
+
+// Hash returns the content hash an asset with these bytes is stored under
+func Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidHash reports whether s has the form of an asset hash
+func ValidHash(s string) bool {
+	return hashPattern.MatchString(s)
+}
+
+// URL is the path the asset with hash is served from
+func URL(hash string) string {
+	if hash == "" {
+		return ""
+	}
+	return PathPrefix + hash
+}
+
+// Store saves content and returns its hash; storing the same bytes twice is a no-op
+func Store(ctx context.Context, conn *data.Conn, contentType string, content []byte) (string, error) {
+	if len(content) == 0 {
+		return "", fmt.Errorf("empty asset")
+	}
+	if len(content) > maxSize {
+		return "", fmt.Errorf("asset of %d bytes exceeds the %d byte limit", len(content), maxSize)
+	}
+	if contentType == "" || !strings.HasPrefix(contentType, "image/") {
+		contentType = http.DetectContentType(content)
+	}
+	hash := Hash(content)
+	_, err := conn.DB.Exec(ctx, `
+		INSERT INTO assets (hash, content_type, data, size)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (hash) DO NOTHING`, hash, contentType, content, len(content))
+	if err != nil {
+		return "", fmt.Errorf("error storing asset: %v", err)
+	}
+	return hash, nil
+}
+
+// StoreDataURL stores the image of a data URL (or bare base64, as some older
+// rows hold) and returns its hash
+func StoreDataURL(ctx context.Context, conn *data.Conn, dataURL string) (string, error) {
+	contentType, content, err := DecodeDataURL(dataURL)
+	if err != nil {
+		return "", err
+	}
+	return Store(ctx, conn, contentType, content)
+}
+
+// DecodeDataURL splits a base64 data URL into its content type and bytes
+func DecodeDataURL(s string) (string, []byte, error) {
+	contentType := ""
+	payload := s
+	if strings.HasPrefix(s, "data:") {
+		header, rest, ok := strings.Cut(s[len("data:"):], ",")
+		if !ok || !strings.HasSuffix(header, ";base64") {
+			return "", nil, fmt.Errorf("not a base64 data URL")
+		}
+		contentType = strings.TrimSuffix(header, ";base64")
+		payload = rest
+	}
+	content, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", nil, fmt.Errorf("error decoding base64 image: %v", err)
+	}
+	return contentType, content, nil
+}
+
+// Load returns the asset stored under hash
+func Load(ctx context.Context, conn *data.Conn, hash string) (*Asset, error) {
+	if !ValidHash(hash) {
+		return nil, ErrNotFound
+	}
+	a := &Asset{Hash: hash}
+	err := conn.DB.QueryRow(ctx, `SELECT content_type, data, created_at FROM assets WHERE hash = $1`, hash).
+		Scan(&a.ContentType, &a.Data, &a.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading asset: %v", err)
+	}
+	return a, nil
+}
@@ -0,0 +1,149 @@
+package assets
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Legacy base64 logos and icons are moved into assets lazily: readers queue a
+// security when they come across one, and the nightly job works through the
+// rest in batches.
+const (
+	migrateBatchSize = 200
+	migrateRunLimit  = 20 * time.Minute
+)
+
+var migrating sync.Map // securityid -> struct{}, lazy migrations in flight
+
+// imageColumns maps each legacy column to the hash column that replaces it
+var imageColumns = []struct{ legacy, hash string }{
+	{"logo", "logo_hash"},
+	{"icon", "icon_hash"},
+}
+
+// IsLegacy reports whether an image value read from securities is still a
+// base64 value rather than an asset URL
+func IsLegacy(value string) bool {
+	return value != "" && !strings.HasPrefix(value, PathPrefix)
+}
+
+// QueueSecurityMigration moves the legacy images of a security into assets in
+// the background; repeated calls while one is running are dropped
+func QueueSecurityMigration(conn *data.Conn, securityID int) {
+	if _, busy := migrating.LoadOrStore(securityID, struct{}{}); busy {
+		return
+	}
+	go func() {
+		defer migrating.Delete(securityID)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, err := MigrateSecurity(ctx, conn, securityID); err != nil {
+			log.Printf("⚠️ Asset migration of security %d failed: %v", securityID, err)
+		}
+	}()
+}
+
+// MigrateSecurity moves the legacy images of every row of a security into
+// assets and returns how many values were moved
+func MigrateSecurity(ctx context.Context, conn *data.Conn, securityID int) (int, error) {
+	moved := 0
+	for _, col := range imageColumns {
+		rows, err := conn.DB.Query(ctx, fmt.Sprintf(`
+			SELECT DISTINCT %[1]s FROM securities
+			WHERE securityid = $1 AND %[1]s IS NOT NULL AND %[2]s IS NULL`, col.legacy, col.hash), securityID)
+		if err != nil {
+			return moved, fmt.Errorf("error loading legacy %s: %v", col.legacy, err)
+		}
+		var values []string
+		for rows.Next() {
+			var v string
+			if err := rows.Scan(&v); err != nil {
+				rows.Close()
+				return moved, fmt.Errorf("error scanning legacy %s: %v", col.legacy, err)
+			}
+			values = append(values, v)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return moved, err
+		}
+		for _, v := range values {
+			n, err := migrateValue(ctx, conn, securityID, col.legacy, col.hash, v)
+			if err != nil {
+				return moved, err
+			}
+			moved += n
+		}
+	}
+	return moved, nil
+}
+
+// migrateValue stores one legacy value and points the rows holding it at the
+// asset. Empty values are cleared; undecodable ones are left for inspection.
+func migrateValue(ctx context.Context, conn *data.Conn, securityID int, legacyCol, hashCol, value string) (int, error) {
+	var hash *string
+	if value != "" {
+		h, err := StoreDataURL(ctx, conn, value)
+		if err != nil {
+			log.Printf("⚠️ Security %d has an unreadable %s, leaving it: %v", securityID, legacyCol, err)
+			return 0, nil
+		}
+		hash = &h
+	}
+	tag, err := conn.DB.Exec(ctx, fmt.Sprintf(`
+		UPDATE securities SET %[2]s = $3, %[1]s = NULL
+		WHERE securityid = $1 AND %[1]s = $2 AND %[2]s IS NULL`, legacyCol, hashCol), securityID, value, hash)
+	if err != nil {
+		return 0, fmt.Errorf("error updating %s of security %d: %v", legacyCol, securityID, err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// MigrateSecurityImages moves legacy base64 logos and icons into assets in
+// batches, stopping after migrateRunLimit; the next run picks up the rest
+func MigrateSecurityImages(conn *data.Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), migrateRunLimit)
+	defer cancel()
+	lastID, moved := 0, 0
+	for ctx.Err() == nil {
+		rows, err := conn.DB.Query(ctx, `
+			SELECT DISTINCT securityid FROM securities
+			WHERE securityid > $1
+			  AND ((logo IS NOT NULL AND logo_hash IS NULL) OR (icon IS NOT NULL AND icon_hash IS NULL))
+			ORDER BY securityid
+			LIMIT $2`, lastID, migrateBatchSize)
+		if err != nil {
+			return fmt.Errorf("error listing securities with legacy images: %v", err)
+		}
+		var ids []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return fmt.Errorf("error scanning security id: %v", err)
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if len(ids) == 0 {
+			break
+		}
+		for _, id := range ids {
+			n, err := MigrateSecurity(ctx, conn, id)
+			if err != nil {
+				return err
+			}
+			moved += n
+		}
+		lastID = ids[len(ids)-1]
+	}
+	if moved > 0 {
+		log.Printf("✅ Moved %d legacy security images into assets", moved)
+	}
+	return nil
+}
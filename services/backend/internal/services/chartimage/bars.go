@@ -0,0 +1,153 @@
+package chartimage
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// ohlcvPriceScale is the fixed-point multiplier applied to prices stored in ohlcv tables
+const ohlcvPriceScale = 1000.0
+
+const maxBars = 500
+
+var easternLocation = func() *time.Location {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return time.FixedZone("EST", -5*60*60)
+	}
+	return loc
+}()
+
+// timeframes maps supported chart timeframes to their source table and bucket
+var timeframes = map[string]struct {
+	table  string
+	bucket string
+}{
+	"1m":  {"ohlcv_1m", ""},
+	"5m":  {"ohlcv_1m", "5 minutes"},
+	"15m": {"ohlcv_1m", "15 minutes"},
+	"1h":  {"ohlcv_1m", "1 hour"},
+	"1d":  {"ohlcv_1d", ""},
+	"1w":  {"ohlcv_1d", "7 days"},
+}
+
+// IsDaily reports whether a timeframe is built from daily bars
+func IsDaily(timeframe string) bool {
+	tf, ok := timeframes[timeframe]
+	return ok && tf.table == "ohlcv_1d"
+}
+
+// LoadBars returns the last count bars of ticker at or before end, oldest first
+func LoadBars(ctx context.Context, conn *data.Conn, ticker, timeframe string, end time.Time, count int) ([]Bar, error) {
+	tf, ok := timeframes[timeframe]
+	if !ok {
+		return nil, fmt.Errorf("unsupported timeframe %q", timeframe)
+	}
+	if count <= 0 || count > maxBars {
+		return nil, fmt.Errorf("bars must be between 1 and %d", maxBars)
+	}
+	ticker = strings.ToUpper(ticker)
+
+	var query string
+	if tf.bucket == "" {
+		query = fmt.Sprintf(`
+			SELECT "timestamp", open::float8, high::float8, low::float8, close::float8, volume::float8
+			FROM %s
+			WHERE ticker = $1 AND "timestamp" <= $2
+			ORDER BY "timestamp" DESC
+			LIMIT $3`, tf.table)
+	} else {
+		query = fmt.Sprintf(`
+			SELECT time_bucket('%s', "timestamp") AS bucket,
+			       first(open, "timestamp")::float8, max(high)::float8, min(low)::float8,
+			       last(close, "timestamp")::float8, sum(volume)::float8
+			FROM %s
+			WHERE ticker = $1 AND "timestamp" <= $2
+			GROUP BY bucket
+			ORDER BY bucket DESC
+			LIMIT $3`, tf.bucket, tf.table)
+	}
+	rows, err := conn.DB.Query(ctx, query, ticker, end, count)
+	if err != nil {
+		return nil, fmt.Errorf("error querying bars: %v", err)
+	}
+	defer rows.Close()
+
+	var bars []Bar
+	for rows.Next() {
+		var ts time.Time
+		var b Bar
+		if err := rows.Scan(&ts, &b.Open, &b.High, &b.Low, &b.Close, &b.Volume); err != nil {
+			return nil, fmt.Errorf("error scanning bar: %v", err)
+		}
+		b.Timestamp = ts.UnixMilli()
+		b.Open /= ohlcvPriceScale
+		b.High /= ohlcvPriceScale
+		b.Low /= ohlcvPriceScale
+		b.Close /= ohlcvPriceScale
+		bars = append(bars, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating bars: %v", err)
+	}
+	if len(bars) == 0 {
+		return nil, fmt.Errorf("no %s bars for %s", timeframe, ticker)
+	}
+	for i, j := 0, len(bars)-1; i < j; i, j = i+1, j-1 {
+		bars[i], bars[j] = bars[j], bars[i]
+	}
+	return bars, nil
+}
+
+// Indicator builds a named indicator line over bars. Supported specs are
+// "sma:<period>", "ema:<period>" and "vwap" (cumulative over the bars shown).
+func Indicator(bars []Bar, spec string) (Line, error) {
+	name, arg, _ := strings.Cut(strings.ToLower(strings.TrimSpace(spec)), ":")
+	values := make([]float64, len(bars))
+	switch name {
+	case "sma", "ema":
+		var period int
+		if _, err := fmt.Sscanf(arg, "%d", &period); err != nil || period < 1 || period > 400 {
+			return Line{}, fmt.Errorf("invalid %s period %q", name, arg)
+		}
+		if name == "sma" {
+			sum := 0.0
+			for i, b := range bars {
+				sum += b.Close
+				if i >= period {
+					sum -= bars[i-period].Close
+				}
+				values[i] = math.NaN()
+				if i >= period-1 {
+					values[i] = sum / float64(period)
+				}
+			}
+		} else {
+			k := 2 / float64(period+1)
+			for i, b := range bars {
+				if i == 0 {
+					values[i] = b.Close
+					continue
+				}
+				values[i] = b.Close*k + values[i-1]*(1-k)
+			}
+		}
+		return Line{Name: fmt.Sprintf("%s %d", strings.ToUpper(name), period), Values: values}, nil
+	case "vwap":
+		var pv, vol float64
+		for i, b := range bars {
+			pv += (b.High + b.Low + b.Close) / 3 * b.Volume
+			vol += b.Volume
+			values[i] = math.NaN()
+			if vol > 0 {
+				values[i] = pv / vol
+			}
+		}
+		return Line{Name: "VWAP", Values: values}, nil
+	}
+	return Line{}, fmt.Errorf("unsupported indicator %q (use sma:<n>, ema:<n> or vwap)", spec)
+}
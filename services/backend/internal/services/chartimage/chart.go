@@ -0,0 +1,277 @@
+// Package chartimage renders static candlestick charts (candles, indicator
+// lines, markers and price levels) to SVG, and to PNG via the headless
+// browser used for plot images.
+package chartimage
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+	"time"
+)
+
+// Bar is one OHLCV candle
+type Bar struct {
+	Timestamp int64 // ms
+	Open      float64
+	High      float64
+	Low       float64
+	Close     float64
+	Volume    float64
+}
+
+// Line is an indicator series aligned with Chart.Bars; NaN leaves a gap
+type Line struct {
+	Name   string
+	Color  string
+	Values []float64
+}
+
+// Marker annotates a bar, e.g. a strategy signal or alert trigger
+type Marker struct {
+	Timestamp int64   `json:"timestamp"` // ms; snapped to the bar containing it
+	Price     float64 `json:"price,omitempty"`
+	Label     string  `json:"label,omitempty"`
+	Color     string  `json:"color,omitempty"`
+}
+
+// Level is a horizontal price line, e.g. an alert price
+type Level struct {
+	Price float64 `json:"price"`
+	Label string  `json:"label,omitempty"`
+	Color string  `json:"color,omitempty"`
+}
+
+// Chart is everything drawn in one image
+type Chart struct {
+	Title   string
+	Bars    []Bar
+	Lines   []Line
+	Markers []Marker
+	Levels  []Level
+	Width   int
+	Height  int
+	Daily   bool // date-only axis labels
+}
+
+const (
+	colorBackground = "#121212"
+	colorGrid       = "#2a2a2a"
+	colorText       = "#d0d0d0"
+	colorUp         = "#66bb6a"
+	colorDown       = "#ef5350"
+	colorMarker     = "#ffd43b"
+	colorLevel      = "#9dc2ff"
+
+	marginLeft   = 12
+	marginRight  = 72 // price axis
+	marginTop    = 40 // title
+	marginBottom = 28 // time axis
+	volumeShare  = 0.18
+)
+
+// linePalette colors indicator lines without an explicit color
+var linePalette = []string{"#64C9CF", "#FC6B3F", "#A17BFE", "#F6BD60", "#FF99C8"}
+
+// SVG renders the chart as a standalone SVG document
+func (c *Chart) SVG() (string, error) {
+	if len(c.Bars) == 0 {
+		return "", fmt.Errorf("no bars to chart")
+	}
+	if c.Width <= 0 {
+		c.Width = 1200
+	}
+	if c.Height <= 0 {
+		c.Height = 675
+	}
+
+	plotW := float64(c.Width - marginLeft - marginRight)
+	plotH := float64(c.Height - marginTop - marginBottom)
+	priceH := plotH * (1 - volumeShare)
+	volTop := float64(marginTop) + priceH
+
+	lo, hi := c.priceRange()
+	maxVol := 0.0
+	for _, b := range c.Bars {
+		maxVol = math.Max(maxVol, b.Volume)
+	}
+	step := plotW / float64(len(c.Bars))
+	x := func(i int) float64 { return float64(marginLeft) + step*(float64(i)+0.5) }
+	y := func(p float64) float64 { return float64(marginTop) + (hi-p)/(hi-lo)*priceH }
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="Inter, system-ui, sans-serif">`,
+		c.Width, c.Height, c.Width, c.Height)
+	fmt.Fprintf(&sb, `<rect width="100%%" height="100%%" fill="%s"/>`, colorBackground)
+	if c.Title != "" {
+		fmt.Fprintf(&sb, `<text x="%d" y="26" fill="%s" font-size="18" font-weight="600">%s</text>`, marginLeft, colorText, html.EscapeString(c.Title))
+	}
+
+	// Price grid and axis
+	for _, p := range niceTicks(lo, hi, 6) {
+		fmt.Fprintf(&sb, `<line x1="%d" x2="%.1f" y1="%.1f" y2="%.1f" stroke="%s"/>`, marginLeft, float64(marginLeft)+plotW, y(p), y(p), colorGrid)
+		fmt.Fprintf(&sb, `<text x="%.1f" y="%.1f" fill="%s" font-size="12">%s</text>`, float64(marginLeft)+plotW+6, y(p)+4, colorText, formatPrice(p))
+	}
+	// Time axis
+	labelEvery := int(math.Ceil(float64(len(c.Bars)) / 8))
+	for i := 0; i < len(c.Bars); i += labelEvery {
+		fmt.Fprintf(&sb, `<text x="%.1f" y="%d" fill="%s" font-size="11" text-anchor="middle">%s</text>`,
+			x(i), c.Height-8, colorText, c.formatTime(c.Bars[i].Timestamp))
+	}
+
+	// Volume and candles
+	bodyW := math.Max(1, step*0.7)
+	for i, b := range c.Bars {
+		color := colorUp
+		if b.Close < b.Open {
+			color = colorDown
+		}
+		if maxVol > 0 {
+			vh := b.Volume / maxVol * (plotH * volumeShare)
+			fmt.Fprintf(&sb, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s" opacity="0.35"/>`,
+				x(i)-bodyW/2, volTop+plotH*volumeShare-vh, bodyW, vh, color)
+		}
+		fmt.Fprintf(&sb, `<line x1="%.1f" x2="%.1f" y1="%.1f" y2="%.1f" stroke="%s"/>`, x(i), x(i), y(b.High), y(b.Low), color)
+		top, bottom := y(math.Max(b.Open, b.Close)), y(math.Min(b.Open, b.Close))
+		fmt.Fprintf(&sb, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`,
+			x(i)-bodyW/2, top, bodyW, math.Max(1, bottom-top), color)
+	}
+
+	// Indicator lines
+	for li, line := range c.Lines {
+		color := line.Color
+		if color == "" {
+			color = linePalette[li%len(linePalette)]
+		}
+		var path strings.Builder
+		pen := false
+		for i, v := range line.Values {
+			if i >= len(c.Bars) || math.IsNaN(v) {
+				pen = false
+				continue
+			}
+			cmd := "L"
+			if !pen {
+				cmd = "M"
+			}
+			fmt.Fprintf(&path, "%s%.1f %.1f ", cmd, x(i), y(v))
+			pen = true
+		}
+		fmt.Fprintf(&sb, `<path d="%s" fill="none" stroke="%s" stroke-width="1.5"/>`, strings.TrimSpace(path.String()), color)
+		fmt.Fprintf(&sb, `<text x="%d" y="%d" fill="%s" font-size="12">%s</text>`, marginLeft+4+li*90, marginTop+14, color, html.EscapeString(line.Name))
+	}
+
+	// Price levels
+	for _, lvl := range c.Levels {
+		if lvl.Price < lo || lvl.Price > hi {
+			continue
+		}
+		color := lvl.Color
+		if color == "" {
+			color = colorLevel
+		}
+		fmt.Fprintf(&sb, `<line x1="%d" x2="%.1f" y1="%.1f" y2="%.1f" stroke="%s" stroke-dasharray="6 4"/>`, marginLeft, float64(marginLeft)+plotW, y(lvl.Price), y(lvl.Price), color)
+		label := formatPrice(lvl.Price)
+		if lvl.Label != "" {
+			label = lvl.Label + " " + label
+		}
+		fmt.Fprintf(&sb, `<text x="%d" y="%.1f" fill="%s" font-size="12">%s</text>`, marginLeft+4, y(lvl.Price)-4, color, html.EscapeString(label))
+	}
+
+	// Markers
+	for _, m := range c.Markers {
+		i := c.barIndex(m.Timestamp)
+		if i < 0 {
+			continue
+		}
+		color := m.Color
+		if color == "" {
+			color = colorMarker
+		}
+		price := m.Price
+		if price == 0 {
+			price = c.Bars[i].High
+		}
+		py := y(price)
+		fmt.Fprintf(&sb, `<path d="M%.1f %.1f l-6 -10 h12 z" fill="%s"/>`, x(i), py-4, color)
+		if m.Label != "" {
+			fmt.Fprintf(&sb, `<text x="%.1f" y="%.1f" fill="%s" font-size="12" text-anchor="middle">%s</text>`, x(i), py-18, color, html.EscapeString(m.Label))
+		}
+	}
+
+	sb.WriteString(`</svg>`)
+	return sb.String(), nil
+}
+
+// priceRange covers bars, lines and levels with a little padding
+func (c *Chart) priceRange() (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, b := range c.Bars {
+		lo, hi = math.Min(lo, b.Low), math.Max(hi, b.High)
+	}
+	for _, line := range c.Lines {
+		for _, v := range line.Values {
+			if !math.IsNaN(v) {
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+			}
+		}
+	}
+	for _, lvl := range c.Levels {
+		// Far-away levels would flatten the candles; only include nearby ones
+		if lvl.Price > lo*0.8 && lvl.Price < hi*1.2 {
+			lo, hi = math.Min(lo, lvl.Price), math.Max(hi, lvl.Price)
+		}
+	}
+	pad := (hi - lo) * 0.05
+	if pad == 0 {
+		pad = math.Max(hi*0.01, 0.01)
+	}
+	return lo - pad, hi + pad
+}
+
+// barIndex returns the bar containing ts, or -1 when it is off the chart
+func (c *Chart) barIndex(ts int64) int {
+	if len(c.Bars) == 0 || ts < c.Bars[0].Timestamp {
+		return -1
+	}
+	for i := len(c.Bars) - 1; i >= 0; i-- {
+		if c.Bars[i].Timestamp <= ts {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *Chart) formatTime(ts int64) string {
+	t := time.UnixMilli(ts).In(easternLocation)
+	if c.Daily {
+		return t.Format("Jan 2 '06")
+	}
+	return t.Format("Jan 2 15:04")
+}
+
+// niceTicks returns about n round price levels within [lo, hi]
+func niceTicks(lo, hi float64, n int) []float64 {
+	raw := (hi - lo) / float64(n)
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := mag
+	for _, m := range []float64{1, 2, 2.5, 5, 10} {
+		if m*mag >= raw {
+			step = m * mag
+			break
+		}
+	}
+	var ticks []float64
+	for p := math.Ceil(lo/step) * step; p <= hi; p += step {
+		ticks = append(ticks, p)
+	}
+	return ticks
+}
+
+func formatPrice(p float64) string {
+	if math.Abs(p) < 1 {
+		return fmt.Sprintf("%.4f", p)
+	}
+	return fmt.Sprintf("%.2f", p)
+}
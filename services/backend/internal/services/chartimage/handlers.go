@@ -0,0 +1,112 @@
+package chartimage
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// GenerateChartImageArgs contains arguments for the generateChartImage agent tool
+type GenerateChartImageArgs struct {
+	Ticker     string   `json:"ticker"`
+	Timeframe  string   `json:"timeframe,omitempty"` // 1m, 5m, 15m, 1h, 1d, 1w; default 1d
+	Bars       int      `json:"bars,omitempty"`      // default 120
+	End        int64    `json:"end,omitempty"`       // ms; defaults to now
+	Indicators []string `json:"indicators,omitempty"`
+	Markers    []Marker `json:"markers,omitempty"`
+	Levels     []Level  `json:"levels,omitempty"`
+	Title      string   `json:"title,omitempty"`
+	Format     string   `json:"format,omitempty"` // png (default) or svg
+}
+
+// GenerateChartImageResult is returned to the agent; the image itself is
+// referenced from a chart_image content chunk by ID
+type GenerateChartImageResult struct {
+	ImageID   string `json:"imageId"`
+	Format    string `json:"format"`
+	Ticker    string `json:"ticker"`
+	Timeframe string `json:"timeframe"`
+	Bars      int    `json:"bars"`
+	FirstBar  int64  `json:"firstBar"`
+	LastBar   int64  `json:"lastBar"`
+}
+
+// GenerateChartImage renders a candlestick chart with optional indicators,
+// markers and levels and stores it for use in a chart_image content chunk
+func GenerateChartImage(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GenerateChartImageArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("invalid args: %v", err)
+	}
+	if args.Ticker == "" {
+		return nil, fmt.Errorf("ticker is required")
+	}
+	if args.Format == "" {
+		args.Format = FormatPNG
+	}
+	if args.Format != FormatPNG && args.Format != FormatSVG {
+		return nil, fmt.Errorf("format must be png or svg")
+	}
+	snap := SnapshotArgs{
+		Ticker:     args.Ticker,
+		Timeframe:  args.Timeframe,
+		Bars:       args.Bars,
+		Indicators: args.Indicators,
+		Markers:    args.Markers,
+		Levels:     args.Levels,
+		Title:      args.Title,
+	}
+	if args.End > 0 {
+		snap.At = time.UnixMilli(args.End)
+	}
+
+	ctx := context.Background()
+	c, err := buildChart(ctx, conn, snap)
+	if err != nil {
+		return nil, err
+	}
+	img, err := Render(ctx, c, args.Format)
+	if err != nil {
+		return nil, err
+	}
+	saved, err := Save(ctx, conn, userID, args.Format, img, args)
+	if err != nil {
+		return nil, err
+	}
+	return GenerateChartImageResult{
+		ImageID:   saved.ImageID,
+		Format:    saved.Format,
+		Ticker:    args.Ticker,
+		Timeframe: snap.Timeframe,
+		Bars:      len(c.Bars),
+		FirstBar:  c.Bars[0].Timestamp,
+		LastBar:   c.Bars[len(c.Bars)-1].Timestamp,
+	}, nil
+}
+
+// GetChartImageArgs contains arguments for fetching a stored chart image
+type GetChartImageArgs struct {
+	ImageID string `json:"imageId"`
+}
+
+// GetChartImageResult carries a stored image to the frontend
+type GetChartImageResult struct {
+	ImageID  string `json:"imageId"`
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"` // base64
+}
+
+// GetChartImage returns a stored chart image as base64
+func GetChartImage(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetChartImageArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("invalid args: %v", err)
+	}
+	img, err := Load(context.Background(), conn, userID, args.ImageID)
+	if err != nil {
+		return nil, err
+	}
+	return GetChartImageResult{ImageID: img.ImageID, MimeType: img.MimeType, Data: img.Base64()}, nil
+}
@@ -0,0 +1,171 @@
+package chartimage
+
+import (
+	"backend/internal/data"
+	"backend/internal/services/plotly"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+
+	renderTimeout = 20 * time.Second
+)
+
+// Image is a rendered chart as stored in chart_images
+type Image struct {
+	ImageID   string          `json:"imageId"`
+	Format    string          `json:"format"`
+	MimeType  string          `json:"mimeType"`
+	Data      []byte          `json:"-"`
+	Spec      json.RawMessage `json:"spec,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// Base64 returns the image bytes base64 encoded for JSON transport
+func (img *Image) Base64() string {
+	return base64.StdEncoding.EncodeToString(img.Data)
+}
+
+// Render draws the chart in the requested format
+func Render(ctx context.Context, c *Chart, format string) ([]byte, error) {
+	svg, err := c.SVG()
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatSVG:
+		return []byte(svg), nil
+	case FormatPNG, "":
+		ctx, cancel := context.WithTimeout(ctx, renderTimeout)
+		defer cancel()
+		var png []byte
+		err := plotly.WithShared(ctx, func(renderer *plotly.Renderer) error {
+			var err error
+			png, err = renderer.RenderSVG(ctx, svg, c.Width, c.Height)
+			return err
+		})
+		return png, err
+	}
+	return nil, fmt.Errorf("unsupported image format %q", format)
+}
+
+func mimeType(format string) string {
+	if format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// Save stores a rendered image so chunks and notifications can refer to it by ID
+func Save(ctx context.Context, conn *data.Conn, userID int, format string, img []byte, spec interface{}) (*Image, error) {
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding chart spec: %v", err)
+	}
+	var uid *int
+	if userID > 0 {
+		uid = &userID
+	}
+	out := &Image{Format: format, MimeType: mimeType(format), Data: img, Spec: specJSON}
+	err = conn.DB.QueryRow(ctx, `
+		INSERT INTO chart_images (user_id, format, data, spec)
+		VALUES ($1, $2, $3, $4)
+		RETURNING image_id::text, created_at`, uid, format, img, specJSON).Scan(&out.ImageID, &out.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error saving chart image: %v", err)
+	}
+	return out, nil
+}
+
+// Load returns a stored image owned by userID (or unowned, e.g. alert snapshots)
+func Load(ctx context.Context, conn *data.Conn, userID int, imageID string) (*Image, error) {
+	// Parsed rather than compared as text, so the lookup uses the primary key
+	id, err := uuid.Parse(imageID)
+	if err != nil {
+		return nil, fmt.Errorf("chart image not found")
+	}
+	img := &Image{ImageID: id.String()}
+	err = conn.DB.QueryRow(ctx, `
+		SELECT format, data, spec, created_at
+		FROM chart_images
+		WHERE image_id = $1 AND (user_id = $2 OR user_id IS NULL)`, id.String(), userID).
+		Scan(&img.Format, &img.Data, &img.Spec, &img.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("chart image not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading chart image: %v", err)
+	}
+	img.MimeType = mimeType(img.Format)
+	return img, nil
+}
+
+// SnapshotArgs describes a chart around a moment of interest, e.g. an alert trigger
+type SnapshotArgs struct {
+	Ticker     string
+	Timeframe  string
+	At         time.Time
+	Bars       int
+	Indicators []string
+	Markers    []Marker
+	Levels     []Level
+	Title      string
+}
+
+// Snapshot loads bars ending at args.At and renders a PNG
+func Snapshot(ctx context.Context, conn *data.Conn, args SnapshotArgs) ([]byte, *Chart, error) {
+	c, err := buildChart(ctx, conn, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	png, err := Render(ctx, c, FormatPNG)
+	if err != nil {
+		return nil, nil, err
+	}
+	return png, c, nil
+}
+
+func buildChart(ctx context.Context, conn *data.Conn, args SnapshotArgs) (*Chart, error) {
+	if args.Timeframe == "" {
+		args.Timeframe = "1d"
+	}
+	if args.Bars == 0 {
+		args.Bars = 120
+	}
+	if args.At.IsZero() {
+		args.At = time.Now()
+	}
+	bars, err := LoadBars(ctx, conn, args.Ticker, args.Timeframe, args.At, args.Bars)
+	if err != nil {
+		return nil, err
+	}
+	title := args.Title
+	if title == "" {
+		title = fmt.Sprintf("%s · %s", strings.ToUpper(args.Ticker), args.Timeframe)
+	}
+	c := &Chart{
+		Title:   title,
+		Bars:    bars,
+		Markers: args.Markers,
+		Levels:  args.Levels,
+		Daily:   IsDaily(args.Timeframe),
+	}
+	for _, spec := range args.Indicators {
+		line, err := Indicator(bars, spec)
+		if err != nil {
+			return nil, err
+		}
+		c.Lines = append(c.Lines, line)
+	}
+	return c, nil
+}
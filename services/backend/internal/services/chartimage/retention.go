@@ -0,0 +1,60 @@
+package chartimage
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Saved conversations keep a chart image's ID, not the image, so an image
+// lives as long as a message refers to it. Images no message refers to (the
+// agent rendered them but the turn was never saved, or the conversation was
+// deleted since) are dropped once they are past chartImageUnusedAge.
+const (
+	chartImageUnusedAge    = 7 * 24 * time.Hour
+	chartImageRetainBatch  = 5000
+	chartImageRetainRounds = 20
+)
+
+// PruneChartImages is the retention job for chart_images
+func PruneChartImages(conn *data.Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	cutoff := time.Now().Add(-chartImageUnusedAge)
+	pruned := int64(0)
+	for round := 0; round < chartImageRetainRounds; round++ {
+		// A message can only refer to an image rendered before it, so only
+		// messages since the oldest candidate are searched
+		tag, err := conn.DB.Exec(ctx, `
+			WITH candidates AS (
+				SELECT image_id, created_at FROM chart_images
+				WHERE created_at < $1
+				ORDER BY created_at
+				LIMIT $2
+			), referenced AS (
+				SELECT DISTINCT c->'content'->>'imageId' AS image_id
+				FROM conversation_messages m
+				CROSS JOIN jsonb_array_elements(COALESCE(m.content_chunks, '[]'::jsonb)) AS c
+				WHERE m.created_at >= (SELECT MIN(created_at) FROM candidates)
+				  AND c->>'type' = 'chart_image'
+			)
+			DELETE FROM chart_images ci
+			USING candidates cand
+			WHERE ci.image_id = cand.image_id
+			  AND cand.image_id::text NOT IN (SELECT image_id FROM referenced WHERE image_id IS NOT NULL)`,
+			cutoff, chartImageRetainBatch)
+		if err != nil {
+			return fmt.Errorf("error pruning chart images: %v", err)
+		}
+		pruned += tag.RowsAffected()
+		if tag.RowsAffected() < chartImageRetainBatch {
+			break
+		}
+	}
+	if pruned > 0 {
+		log.Printf("🧹 Pruned %d unused chart images", pruned)
+	}
+	return nil
+}
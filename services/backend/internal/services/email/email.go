@@ -2,10 +2,15 @@
 package jobs
 
 import (
+	"backend/internal/dryrun"
+	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"fmt"
+	"mime/multipart"
 	"net/smtp"
+	"net/textproto"
 	"os"
 
 	"golang.org/x/oauth2"
@@ -66,6 +71,66 @@ func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
 // SendEmail sends an email with the given subject and body to the specified email address
 // using OAuth2 authentication over SSL (port 465)
 func SendEmail(to, subject, body string) error {
+	if dryrun.Notify(context.Background(), "email", fmt.Sprintf("emailed %q to %s", subject, to), nil) {
+		return nil
+	}
+	return send(to, func(from string) []byte {
+		// Create email message with HTML support
+		return []byte(fmt.Sprintf("From: %s\r\n"+
+			"To: %s\r\n"+
+			"Subject: %s\r\n"+
+			"Content-Type: text/html; charset=UTF-8\r\n"+
+			"\r\n"+
+			"%s\r\n", from, to, subject, body))
+	})
+}
+
+// Attachment is a file sent along with an email
+type Attachment struct {
+	Name     string
+	MimeType string
+	Data     []byte
+}
+
+// SendEmailWithAttachment sends an HTML email with one file attached
+func SendEmailWithAttachment(to, subject, body string, attachment Attachment) error {
+	if dryrun.Notify(context.Background(), "email", fmt.Sprintf("emailed %q with %s to %s", subject, attachment.Name, to), nil) {
+		return nil
+	}
+	return send(to, func(from string) []byte {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		fmt.Fprintf(&buf, "From: %s\r\n"+
+			"To: %s\r\n"+
+			"Subject: %s\r\n"+
+			"MIME-Version: 1.0\r\n"+
+			"Content-Type: multipart/mixed; boundary=%q\r\n"+
+			"\r\n", from, to, subject, w.Boundary())
+
+		part, _ := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"text/html; charset=UTF-8"},
+		})
+		_, _ = part.Write([]byte(body))
+
+		part, _ = w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {fmt.Sprintf("%s; name=%q", attachment.MimeType, attachment.Name)},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", attachment.Name)},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		// Base64 lines are wrapped at 76 characters as MIME requires
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		for len(encoded) > 76 {
+			_, _ = part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		_, _ = part.Write([]byte(encoded + "\r\n"))
+		_ = w.Close()
+		return buf.Bytes()
+	})
+}
+
+// send delivers the message built for the configured sender to one recipient
+func send(to string, message func(from string) []byte) error {
 	// Get email configuration
 	smtpHost := getEnvWithDefault("SMTP_HOST", "smtp.gmail.com")
 	smtpPort := getEnvWithDefault("SMTP_PORT", "465")
@@ -81,13 +146,7 @@ func SendEmail(to, subject, body string) error {
 		return fmt.Errorf("failed to get access token: %v", err)
 	}
 
-	// Create email message with HTML support
-	msg := fmt.Sprintf("From: %s\r\n"+
-		"To: %s\r\n"+
-		"Subject: %s\r\n"+
-		"Content-Type: text/html; charset=UTF-8\r\n"+
-		"\r\n"+
-		"%s\r\n", from, to, subject, body)
+	msg := message(from)
 
 	// Create SSL connection
 	conn, err := tls.Dial("tcp", smtpHost+":"+smtpPort, &tls.Config{
@@ -139,7 +198,7 @@ func SendEmail(to, subject, body string) error {
 		return fmt.Errorf("DATA command error: %v", err)
 	}
 
-	_, err = writer.Write([]byte(msg))
+	_, err = writer.Write(msg)
 	if err != nil {
 		return fmt.Errorf("error writing email body: %v", err)
 	}
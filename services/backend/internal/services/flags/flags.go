@@ -0,0 +1,323 @@
+// Package flags holds runtime feature flags. Flags are stored in Postgres,
+// kept in memory on every server and reloaded on a timer and whenever one is
+// changed, which is announced over Redis. A flag without a stored row falls
+// back to its default in Known, so code can check a flag before anyone has
+// configured it.
+package flags
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Keys of the known flags
+const (
+	PerTickerThrottle    = "per_ticker_throttle"
+	AgentRecordTraces    = "agent_record_traces"
+	AgentExperiments     = "agent_experiments"
+	ScreenerAsOf         = "screener_as_of"
+	ScreenerDebugLogging = "screener_debug_logging"
+	StrategyAlertBatch   = "strategy_alert_batch"
+	DryRun               = "dry_run"
+)
+
+// Definition describes a known flag and how it behaves until it is stored
+type Definition struct {
+	Description string
+	Default     bool
+}
+
+// Known lists the flags code checks. Only these can be set through the admin API.
+var Known = map[string]Definition{
+	PerTickerThrottle: {
+		Description: "Alerts run strategies only for tickers updated since their last run, instead of throttling per strategy",
+		Default:     true,
+	},
+	AgentRecordTraces: {
+		Description: "Record agent traces for replay (AGENT_RECORD_TRACES records them for everyone)",
+	},
+	AgentExperiments: {
+		Description: "Users can be enrolled in the running agent prompt/model experiment",
+		Default:     true,
+	},
+	ScreenerAsOf: {
+		Description: "Screener accepts asOf to screen against a past day's snapshot",
+		Default:     true,
+	},
+	ScreenerDebugLogging: {
+		Description: "Log full screener responses",
+	},
+	StrategyAlertBatch: {
+		Description: "Alerts send strategies sharing a timeframe and universe to one worker task per cycle",
+	},
+	DryRun: {
+		Description: "Worker tasks and notifications are logged instead of queued or sent, on every server (staging)",
+	},
+}
+
+const (
+	flagReloadChannel  = "feature_flag_reload"
+	flagReloadInterval = time.Minute
+	dbTimeout          = 5 * time.Second
+)
+
+// Flag is a stored flag
+type Flag struct {
+	Key            string    `json:"key"`
+	Description    string    `json:"description"`
+	Enabled        bool      `json:"enabled"`
+	RolloutPercent int       `json:"rolloutPercent"`
+	UserIDs        []int     `json:"userIds"`
+	UpdatedBy      *int      `json:"updatedBy,omitempty"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// Validate checks an admin-submitted flag
+func (f *Flag) Validate() error {
+	if _, ok := Known[f.Key]; !ok {
+		return fmt.Errorf("unknown flag %q", f.Key)
+	}
+	if f.RolloutPercent < 0 || f.RolloutPercent > 100 {
+		return fmt.Errorf("rolloutPercent must be between 0 and 100")
+	}
+	for _, id := range f.UserIDs {
+		if id <= 0 {
+			return fmt.Errorf("invalid user ID %d", id)
+		}
+	}
+	return nil
+}
+
+// on reports whether the flag is on for userID. User 0 stands for checks made
+// outside any user's request, which only a full rollout turns on.
+func (f *Flag) on(userID int) bool {
+	if !f.Enabled {
+		return false
+	}
+	for _, id := range f.UserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	if f.RolloutPercent >= 100 {
+		return true
+	}
+	if userID == 0 || f.RolloutPercent <= 0 {
+		return false
+	}
+	return Bucket(f.Key, userID, 100) < f.RolloutPercent
+}
+
+// Bucket places a user in 0..n-1 for a key. Hashing the key with the user
+// keeps a user's bucket stable as a rollout grows, without putting the same
+// users first in every rollout.
+func Bucket(key string, userID, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key + ":" + strconv.Itoa(userID)))
+	return int(h.Sum32() % uint32(n))
+}
+
+var (
+	stored      = map[string]Flag{}
+	storedMutex sync.RWMutex
+)
+
+type overridesKey struct{}
+
+// WithOverride returns a context in which IsEnabled reports on for key,
+// whatever is stored; replays and evals use it to pin a flag
+func WithOverride(ctx context.Context, key string, on bool) context.Context {
+	overrides := map[string]bool{key: on}
+	if existing, ok := ctx.Value(overridesKey{}).(map[string]bool); ok {
+		for k, v := range existing {
+			if k != key {
+				overrides[k] = v
+			}
+		}
+	}
+	return context.WithValue(ctx, overridesKey{}, overrides)
+}
+
+// IsEnabled reports whether a flag is on for a user (0 outside of a user's
+// request). Unknown flags are off.
+func IsEnabled(ctx context.Context, key string, userID int) bool {
+	if ctx != nil {
+		if overrides, ok := ctx.Value(overridesKey{}).(map[string]bool); ok {
+			if on, ok := overrides[key]; ok {
+				return on
+			}
+		}
+	}
+	storedMutex.RLock()
+	f, ok := stored[key]
+	storedMutex.RUnlock()
+	if ok {
+		return f.on(userID)
+	}
+	return Known[key].Default
+}
+
+// Reload replaces the in-memory flags with the stored ones
+func Reload(ctx context.Context, conn *data.Conn) error {
+	flags, err := loadFlags(ctx, conn)
+	if err != nil {
+		return err
+	}
+	next := make(map[string]Flag, len(flags))
+	for _, f := range flags {
+		next[f.Key] = f
+	}
+	storedMutex.Lock()
+	stored = next
+	storedMutex.Unlock()
+	return nil
+}
+
+func loadFlags(ctx context.Context, conn *data.Conn) ([]Flag, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT key, description, enabled, rollout_percent, user_ids, updated_by, updated_at
+		FROM feature_flags ORDER BY key`)
+	if err != nil {
+		return nil, fmt.Errorf("error loading feature flags: %v", err)
+	}
+	defer rows.Close()
+	var out []Flag
+	for rows.Next() {
+		var f Flag
+		var userIDs []int32
+		if err := rows.Scan(&f.Key, &f.Description, &f.Enabled, &f.RolloutPercent, &userIDs, &f.UpdatedBy, &f.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning feature flag: %v", err)
+		}
+		f.UserIDs = make([]int, len(userIDs))
+		for i, id := range userIDs {
+			f.UserIDs[i] = int(id)
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// StartReloader loads the flags and keeps them current, reloading on a timer
+// and immediately whenever one is changed on any server
+func StartReloader(conn *data.Conn) {
+	ctx := context.Background()
+	if err := reloadWithTimeout(conn); err != nil {
+		log.Printf("⚠️ Initial feature flag load: %v", err)
+	}
+	go func() {
+		pubsub := conn.Cache.Subscribe(ctx, flagReloadChannel)
+		defer pubsub.Close()
+		reload := pubsub.Channel()
+		ticker := time.NewTicker(flagReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-reload:
+			case <-ticker.C:
+			}
+			if err := reloadWithTimeout(conn); err != nil {
+				log.Printf("⚠️ Feature flag reload: %v", err)
+			}
+		}
+	}()
+}
+
+func reloadWithTimeout(conn *data.Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	return Reload(ctx, conn)
+}
+
+// Status is a known flag as the admin API lists it
+type Status struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"`
+	Stored      *Flag  `json:"stored"` // nil while the flag runs on its default
+}
+
+// List returns every known flag with its stored settings, if any
+func List(ctx context.Context, conn *data.Conn) ([]Status, error) {
+	flags, err := loadFlags(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]Flag, len(flags))
+	for _, f := range flags {
+		byKey[f.Key] = f
+	}
+	out := make([]Status, 0, len(Known))
+	for key, def := range Known {
+		s := Status{Key: key, Description: def.Description, Default: def.Default}
+		if f, ok := byKey[key]; ok {
+			s.Stored = &f
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// Set stores a flag and tells every server to reload
+func Set(ctx context.Context, conn *data.Conn, f Flag, adminID int) (*Flag, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	if f.Description == "" {
+		f.Description = Known[f.Key].Description
+	}
+	userIDs := f.UserIDs
+	if userIDs == nil {
+		userIDs = []int{}
+	}
+	err := conn.DB.QueryRow(ctx, `
+		INSERT INTO feature_flags (key, description, enabled, rollout_percent, user_ids, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (key) DO UPDATE SET
+			description = EXCLUDED.description,
+			enabled = EXCLUDED.enabled,
+			rollout_percent = EXCLUDED.rollout_percent,
+			user_ids = EXCLUDED.user_ids,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = NOW()
+		RETURNING updated_at`,
+		f.Key, f.Description, f.Enabled, f.RolloutPercent, userIDs, adminID).Scan(&f.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error storing feature flag: %v", err)
+	}
+	f.UserIDs = userIDs
+	f.UpdatedBy = &adminID
+	log.Printf("🚩 Feature flag %s set by user %d: enabled=%t rollout=%d%% users=%v",
+		f.Key, adminID, f.Enabled, f.RolloutPercent, f.UserIDs)
+	notifyReload(ctx, conn)
+	return &f, nil
+}
+
+// Delete removes a stored flag, returning it to its default, and tells every
+// server to reload
+func Delete(ctx context.Context, conn *data.Conn, key string, adminID int) error {
+	if _, err := conn.DB.Exec(ctx, `DELETE FROM feature_flags WHERE key = $1`, key); err != nil {
+		return fmt.Errorf("error deleting feature flag: %v", err)
+	}
+	log.Printf("🚩 Feature flag %s reset to its default by user %d", key, adminID)
+	notifyReload(ctx, conn)
+	return nil
+}
+
+// notifyReload reloads this server's flags and announces the change to the
+// others; a failed announcement only delays them until their next timed reload
+func notifyReload(ctx context.Context, conn *data.Conn) {
+	if err := Reload(ctx, conn); err != nil {
+		log.Printf("⚠️ Feature flag reload: %v", err)
+	}
+	if err := conn.Cache.Publish(ctx, flagReloadChannel, "").Err(); err != nil {
+		log.Printf("⚠️ Error announcing feature flag change: %v", err)
+	}
+}
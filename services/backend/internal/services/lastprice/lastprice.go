@@ -0,0 +1,190 @@
+// Package lastprice caches the last trade price of each ticker. The socket
+// feed writes every trade into memory and a flusher copies the changes to
+// Redis once a second, so processes without the feed can read them too.
+// Readers pass how old a price they accept; Lookup only asks Polygon when the
+// cached price is older than that.
+package lastprice
+
+import (
+	"backend/internal/breaker"
+	"backend/internal/data"
+	"backend/internal/data/polygon"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	redisKey      = "lastprice"
+	flushInterval = time.Second
+)
+
+// Sources of a cached price
+const (
+	SourceStream  = "stream"
+	SourcePolygon = "polygon"
+)
+
+// Price is a ticker's last trade price
+type Price struct {
+	Ticker     string    `json:"ticker"`
+	SecurityID int       `json:"securityId,omitempty"`
+	Price      float64   `json:"price"`
+	TradeAt    time.Time `json:"tradeAt"`   // when the trade happened
+	UpdatedAt  time.Time `json:"updatedAt"` // when the price was last confirmed current
+	Source     string    `json:"source"`
+	// Stale is set when the price is older than the caller asked for and
+	// Polygon couldn't be reached to refresh it
+	Stale bool `json:"stale,omitempty"`
+}
+
+// Age is how long ago the price was last confirmed current
+func (p Price) Age(now time.Time) time.Duration {
+	return now.Sub(p.UpdatedAt)
+}
+
+var (
+	mu         sync.RWMutex
+	byTicker   = map[string]Price{}
+	bySecurity = map[int]string{}
+	dirty      = map[string]struct{}{}
+	flushOnce  sync.Once
+)
+
+// Record stores a price seen on the feed or fetched from Polygon
+func Record(p Price) {
+	if p.Ticker == "" {
+		return
+	}
+	p.Ticker = strings.ToUpper(p.Ticker)
+	p.Stale = false
+	mu.Lock()
+	defer mu.Unlock()
+	if p.SecurityID == 0 {
+		p.SecurityID = byTicker[p.Ticker].SecurityID
+	}
+	byTicker[p.Ticker] = p
+	if p.SecurityID != 0 {
+		bySecurity[p.SecurityID] = p.Ticker
+	}
+	dirty[p.Ticker] = struct{}{}
+}
+
+// RecordTrade stores a trade from the socket feed
+func RecordTrade(securityID int, ticker string, price float64, tradeAt time.Time) {
+	Record(Price{Ticker: ticker, SecurityID: securityID, Price: price, TradeAt: tradeAt, UpdatedAt: time.Now(), Source: SourceStream})
+}
+
+// BySecurityID returns the in-memory price of a security, as the alert loop
+// running next to the feed reads it
+func BySecurityID(securityID int) (Price, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	ticker, ok := bySecurity[securityID]
+	if !ok {
+		return Price{}, false
+	}
+	p, ok := byTicker[ticker]
+	return p, ok
+}
+
+// Get returns the cached price of a ticker from memory, or Redis when this
+// process doesn't have it, whatever its age
+func Get(ctx context.Context, conn *data.Conn, ticker string) (Price, bool) {
+	ticker = strings.ToUpper(ticker)
+	mu.RLock()
+	p, ok := byTicker[ticker]
+	mu.RUnlock()
+	if ok {
+		return p, true
+	}
+	raw, err := conn.Cache.HGet(ctx, redisKey, ticker).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("⚠️ Reading cached last price of %s: %v", ticker, err)
+		}
+		return Price{}, false
+	}
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return Price{}, false
+	}
+	return p, true
+}
+
+// Lookup returns a ticker's price if it was confirmed within maxAge, and
+// otherwise fetches the last trade from Polygon and caches it. While Polygon
+// is unavailable an older cached price is returned marked stale.
+func Lookup(ctx context.Context, conn *data.Conn, ticker string, maxAge time.Duration) (Price, error) {
+	ticker = strings.ToUpper(ticker)
+	cached, ok := Get(ctx, conn, ticker)
+	if ok && cached.Age(time.Now()) <= maxAge {
+		return cached, nil
+	}
+	if !breaker.Polygon.Allow() {
+		if ok {
+			cached.Stale = true
+			return cached, nil
+		}
+		return Price{}, breaker.Polygon.Unavailable()
+	}
+	trade, err := polygon.GetLastTrade(conn.Polygon, ticker, true)
+	breaker.Polygon.Record(polygon.Outage(err))
+	if err != nil {
+		if ok && polygon.Outage(err) != nil {
+			cached.Stale = true
+			return cached, nil
+		}
+		return Price{}, fmt.Errorf("getting last trade of %s: %w", ticker, err)
+	}
+	p := Price{
+		Ticker:     ticker,
+		SecurityID: cached.SecurityID,
+		Price:      trade.Price,
+		TradeAt:    time.Time(trade.Timestamp),
+		UpdatedAt:  time.Now(),
+		Source:     SourcePolygon,
+	}
+	Record(p)
+	return p, nil
+}
+
+// StartFlusher copies changed prices to Redis until the process exits
+func StartFlusher(conn *data.Conn) {
+	flushOnce.Do(func() {
+		go func() {
+			t := time.NewTicker(flushInterval)
+			defer t.Stop()
+			for range t.C {
+				flush(conn)
+			}
+		}()
+	})
+}
+
+func flush(conn *data.Conn) {
+	mu.Lock()
+	if len(dirty) == 0 {
+		mu.Unlock()
+		return
+	}
+	fields := make(map[string]interface{}, len(dirty))
+	for ticker := range dirty {
+		if raw, err := json.Marshal(byTicker[ticker]); err == nil {
+			fields[ticker] = raw
+		}
+	}
+	dirty = map[string]struct{}{}
+	mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := conn.Cache.HSet(ctx, redisKey, fields).Err(); err != nil {
+		log.Printf("⚠️ Flushing %d last prices to Redis: %v", len(fields), err)
+	}
+}
@@ -0,0 +1,491 @@
+package marketdata
+
+import (
+	"backend/internal/data"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/polygon-io/client-go/rest/models"
+)
+
+// Managed OHLCV backfills. A backfill is one security, timeframe and date
+// range queued in ohlcv_backfills. The worker claims the highest-priority
+// queued backfill, fetches it from the Polygon aggregates API in chunks and
+// checkpoints next_start after every chunk, so pausing, a restart or a failure
+// only loses the chunk in flight. Polygon requests from every process share a
+// per-minute budget kept in Redis.
+const (
+	backfillPollInterval = 30 * time.Second
+	// a running backfill whose worker stopped updating it is claimed again
+	backfillStaleAfter  = 10 * time.Minute
+	backfillMaxAttempts = 5
+	backfillRetryDelay  = time.Minute
+	backfillRequestKey  = "backfill:polygon_requests:"
+	// one aggregates request returns at most 50000 bars; a month of extended
+	// hours minutes is about 30k
+	backfillMinuteChunkDays = 30
+	backfillDailyChunkDays  = 3650
+	backfillPageLimit       = 50000
+	defaultBackfillRPM      = 300
+)
+
+// Backfill statuses
+const (
+	BackfillQueued  = "queued"
+	BackfillRunning = "running"
+	BackfillPaused  = "paused"
+	BackfillDone    = "done"
+	BackfillFailed  = "failed"
+)
+
+// Backfill is one row of ohlcv_backfills
+type Backfill struct {
+	ID          int
+	SecurityID  *int
+	Ticker      string
+	Timeframe   string
+	RangeStart  time.Time
+	RangeEnd    time.Time
+	NextStart   time.Time
+	Priority    int
+	Status      string
+	BarsWritten int64
+	Requests    int
+	Attempts    int
+	LastError   *string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Progress returns the fraction of the range already fetched
+func (b Backfill) Progress() float64 {
+	total := b.RangeEnd.Sub(b.RangeStart).Hours()/24 + 1
+	done := b.NextStart.Sub(b.RangeStart).Hours() / 24
+	if b.Status == BackfillDone || total <= 0 {
+		return 1
+	}
+	if done < 0 {
+		return 0
+	}
+	return done / total
+}
+
+// EnqueueBackfill queues a ticker's range for backfill and returns its id. The
+// security is resolved from the currently listed ticker when there is one.
+func EnqueueBackfill(ctx context.Context, conn *data.Conn, ticker, timeframe string, from, to time.Time, priority int) (int, error) {
+	if timeframe != "1m" && timeframe != "1d" {
+		return 0, fmt.Errorf("unsupported timeframe %q, use 1m or 1d", timeframe)
+	}
+	if to.Before(from) {
+		return 0, fmt.Errorf("range end %s is before start %s", to.Format("2006-01-02"), from.Format("2006-01-02"))
+	}
+	var id int
+	err := conn.DB.QueryRow(ctx, `
+		INSERT INTO ohlcv_backfills (securityid, ticker, timeframe, range_start, range_end, next_start, priority)
+		VALUES ((SELECT securityid FROM securities WHERE ticker = $1 AND maxdate IS NULL LIMIT 1),
+		        $1, $2, $3::date, $4::date, $3::date, $5)
+		RETURNING id`, ticker, timeframe, from.Format("2006-01-02"), to.Format("2006-01-02"), priority).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error queueing backfill for %s: %v", ticker, err)
+	}
+	return id, nil
+}
+
+// ActiveTickers returns the tickers of every listed security
+func ActiveTickers(ctx context.Context, conn *data.Conn) ([]string, error) {
+	rows, err := conn.DB.Query(ctx, `SELECT DISTINCT ticker FROM securities WHERE maxdate IS NULL ORDER BY ticker`)
+	if err != nil {
+		return nil, fmt.Errorf("error loading active tickers: %v", err)
+	}
+	defer rows.Close()
+	var tickers []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, fmt.Errorf("error scanning ticker: %v", err)
+		}
+		tickers = append(tickers, t)
+	}
+	return tickers, rows.Err()
+}
+
+// ListBackfills returns backfills newest first; without all, finished ones are left out
+func ListBackfills(ctx context.Context, conn *data.Conn, all bool, limit int) ([]Backfill, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT id, securityid, ticker, timeframe, range_start, range_end, next_start, priority,
+		       status, bars_written, requests, attempts, last_error, created_at, updated_at
+		FROM ohlcv_backfills
+		WHERE $1 OR status NOT IN ('done')
+		ORDER BY (status = 'running') DESC, priority DESC, created_at DESC
+		LIMIT $2`, all, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing backfills: %v", err)
+	}
+	defer rows.Close()
+	var out []Backfill
+	for rows.Next() {
+		var b Backfill
+		if err := rows.Scan(&b.ID, &b.SecurityID, &b.Ticker, &b.Timeframe, &b.RangeStart, &b.RangeEnd, &b.NextStart,
+			&b.Priority, &b.Status, &b.BarsWritten, &b.Requests, &b.Attempts, &b.LastError, &b.CreatedAt, &b.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning backfill: %v", err)
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// BackfillCounts returns the number of backfills per status
+func BackfillCounts(ctx context.Context, conn *data.Conn) (map[string]int, error) {
+	rows, err := conn.DB.Query(ctx, `SELECT status, count(*) FROM ohlcv_backfills GROUP BY status`)
+	if err != nil {
+		return nil, fmt.Errorf("error counting backfills: %v", err)
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, fmt.Errorf("error scanning backfill count: %v", err)
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// SetBackfillsPaused pauses or resumes one backfill, or every unfinished one
+// when id is 0. A running backfill stops after its current chunk. Resuming
+// also requeues failed backfills with a fresh attempt count.
+func SetBackfillsPaused(ctx context.Context, conn *data.Conn, id int, paused bool) (int64, error) {
+	var query string
+	if paused {
+		query = `UPDATE ohlcv_backfills SET status = 'paused', updated_at = NOW()
+			WHERE status IN ('queued', 'running') AND ($1 = 0 OR id = $1)`
+	} else {
+		query = `UPDATE ohlcv_backfills SET status = 'queued', attempts = 0, updated_at = NOW()
+			WHERE status IN ('paused', 'failed') AND ($1 = 0 OR id = $1)`
+	}
+	tag, err := conn.DB.Exec(ctx, query, id)
+	if err != nil {
+		return 0, fmt.Errorf("error updating backfills: %v", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+var backfillWorkerOnce sync.Once
+
+// StartBackfillWorker starts processing the backfill queue in the background.
+// It only ever starts once per process, so it can be scheduled like any job.
+func StartBackfillWorker(conn *data.Conn) error {
+	backfillWorkerOnce.Do(func() {
+		go func() {
+			log.Printf("🚀 Backfill worker started (Polygon budget %d requests/min)", backfillRequestBudget())
+			for {
+				worked, err := RunNextBackfill(context.Background(), conn)
+				if err != nil {
+					log.Printf("⚠️ Backfill worker: %v", err)
+				}
+				if !worked {
+					time.Sleep(backfillPollInterval)
+				}
+			}
+		}()
+	})
+	return nil
+}
+
+// RunBackfills works through the queue until it's empty or ctx is done
+func RunBackfills(ctx context.Context, conn *data.Conn) error {
+	for ctx.Err() == nil {
+		worked, err := RunNextBackfill(ctx, conn)
+		if err != nil {
+			log.Printf("⚠️ Backfill: %v", err)
+		}
+		if !worked {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// RunNextBackfill claims the next backfill and runs it until it's done,
+// paused or fails. It reports false when there was nothing to claim.
+func RunNextBackfill(ctx context.Context, conn *data.Conn) (bool, error) {
+	b, err := claimBackfill(ctx, conn)
+	if err != nil || b == nil {
+		return false, err
+	}
+	if err := runClaimedBackfill(ctx, conn, b); err != nil {
+		if b.Attempts < backfillMaxAttempts {
+			// Let other backfills go first and give Polygon a moment
+			time.Sleep(backfillRetryDelay)
+		}
+		return true, err
+	}
+	return true, nil
+}
+
+// ErrBackfillNotQueued is returned by RunBackfill when the backfill was
+// already claimed, typically by the worker, or has finished
+var ErrBackfillNotQueued = errors.New("backfill is not queued")
+
+// RunBackfill runs one queued backfill now instead of waiting for the worker
+// to reach it, returning once it's done, paused or failed
+func RunBackfill(ctx context.Context, conn *data.Conn, id int) error {
+	var b Backfill
+	err := conn.DB.QueryRow(ctx, `
+		UPDATE ohlcv_backfills SET
+			status = 'running',
+			attempts = attempts + 1,
+			started_at = COALESCE(started_at, NOW()),
+			updated_at = NOW()
+		WHERE id = $1 AND status = 'queued'
+		RETURNING id, ticker, timeframe, range_start, range_end, next_start, priority, attempts`, id).Scan(
+		&b.ID, &b.Ticker, &b.Timeframe, &b.RangeStart, &b.RangeEnd, &b.NextStart, &b.Priority, &b.Attempts)
+	if err == pgx.ErrNoRows {
+		return fmt.Errorf("%w: %d", ErrBackfillNotQueued, id)
+	}
+	if err != nil {
+		return fmt.Errorf("error claiming backfill %d: %v", id, err)
+	}
+	b.Status = BackfillRunning
+	return runClaimedBackfill(ctx, conn, &b)
+}
+
+// runClaimedBackfill runs a claimed backfill and records a failure, queueing
+// it again until it runs out of attempts
+func runClaimedBackfill(ctx context.Context, conn *data.Conn, b *Backfill) error {
+	log.Printf("📥 Backfill %d: %s %s %s → %s (from %s)", b.ID, b.Ticker, b.Timeframe,
+		b.RangeStart.Format("2006-01-02"), b.RangeEnd.Format("2006-01-02"), b.NextStart.Format("2006-01-02"))
+
+	if err := runBackfill(ctx, conn, b); err != nil {
+		status := BackfillQueued
+		if b.Attempts >= backfillMaxAttempts {
+			status = BackfillFailed
+		}
+		if _, uerr := conn.DB.Exec(context.Background(), `
+			UPDATE ohlcv_backfills SET status = $2, last_error = $3, updated_at = NOW()
+			WHERE id = $1 AND status = 'running'`, b.ID, status, err.Error()); uerr != nil {
+			log.Printf("⚠️ Backfill %d: error recording failure: %v", b.ID, uerr)
+		}
+		return fmt.Errorf("backfill %d (%s %s) attempt %d: %v", b.ID, b.Ticker, b.Timeframe, b.Attempts, err)
+	}
+	return nil
+}
+
+// claimBackfill marks the highest-priority queued (or stale running) backfill
+// as running and returns it
+func claimBackfill(ctx context.Context, conn *data.Conn) (*Backfill, error) {
+	var b Backfill
+	err := conn.DB.QueryRow(ctx, `
+		UPDATE ohlcv_backfills SET
+			status = 'running',
+			attempts = attempts + 1,
+			started_at = COALESCE(started_at, NOW()),
+			updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM ohlcv_backfills
+			WHERE status = 'queued'
+			   OR (status = 'running' AND updated_at < NOW() - $1::interval)
+			ORDER BY priority DESC, created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, ticker, timeframe, range_start, range_end, next_start, priority, attempts`,
+		fmt.Sprintf("%d seconds", int(backfillStaleAfter.Seconds()))).Scan(
+		&b.ID, &b.Ticker, &b.Timeframe, &b.RangeStart, &b.RangeEnd, &b.NextStart, &b.Priority, &b.Attempts)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error claiming backfill: %v", err)
+	}
+	b.Status = BackfillRunning
+	return &b, nil
+}
+
+func runBackfill(ctx context.Context, conn *data.Conn, b *Backfill) error {
+	table, timespan, chunkDays := "ohlcv_1d", models.Day, backfillDailyChunkDays
+	if b.Timeframe == "1m" {
+		table, timespan, chunkDays = "ohlcv_1m", models.Minute, backfillMinuteChunkDays
+	}
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return fmt.Errorf("error loading timezone: %v", err)
+	}
+
+	cursor := b.NextStart
+	for !cursor.After(b.RangeEnd) {
+		// Stop between chunks when the backfill was paused
+		var status string
+		if err := conn.DB.QueryRow(ctx, `SELECT status FROM ohlcv_backfills WHERE id = $1`, b.ID).Scan(&status); err != nil {
+			return fmt.Errorf("error checking status: %v", err)
+		}
+		if status != BackfillRunning {
+			log.Printf("⏸️ Backfill %d: %s at %s", b.ID, status, cursor.Format("2006-01-02"))
+			return nil
+		}
+
+		chunkEnd := cursor.AddDate(0, 0, chunkDays-1)
+		if chunkEnd.After(b.RangeEnd) {
+			chunkEnd = b.RangeEnd
+		}
+		from := time.Date(cursor.Year(), cursor.Month(), cursor.Day(), 0, 0, 0, 0, loc)
+		to := time.Date(chunkEnd.Year(), chunkEnd.Month(), chunkEnd.Day(), 23, 59, 59, 0, loc)
+
+		if err := waitForNightlyJobs(ctx); err != nil {
+			return err
+		}
+		if err := waitForPolygonBudget(ctx, conn); err != nil {
+			return err
+		}
+		written, err := fetchBackfillChunk(ctx, conn, b.Ticker, table, timespan, from, to)
+		if err != nil {
+			return err
+		}
+
+		cursor = chunkEnd.AddDate(0, 0, 1)
+		if _, err := conn.DB.Exec(ctx, `
+			UPDATE ohlcv_backfills SET
+				next_start = $2::date,
+				bars_written = bars_written + $3,
+				requests = requests + 1,
+				updated_at = NOW()
+			WHERE id = $1`, b.ID, cursor.Format("2006-01-02"), written); err != nil {
+			return fmt.Errorf("error saving checkpoint: %v", err)
+		}
+	}
+
+	_, err = conn.DB.Exec(ctx, `
+		UPDATE ohlcv_backfills SET status = 'done', last_error = NULL, finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'running'`, b.ID)
+	if err != nil {
+		return fmt.Errorf("error marking done: %v", err)
+	}
+	log.Printf("✅ Backfill %d: %s %s done", b.ID, b.Ticker, b.Timeframe)
+
+	// History older than the aggregates' refresh policies is only picked up
+	// by refreshing it; the backfill itself has succeeded either way
+	from := time.Date(b.RangeStart.Year(), b.RangeStart.Month(), b.RangeStart.Day(), 0, 0, 0, 0, loc)
+	to := time.Date(b.RangeEnd.Year(), b.RangeEnd.Month(), b.RangeEnd.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+	if refreshed, err := RefreshChartAggregates(ctx, conn, table, b.Ticker, from, to); err != nil {
+		log.Printf("⚠️ Backfill %d: refreshing chart aggregates: %v", b.ID, err)
+	} else if len(refreshed) > 0 {
+		log.Printf("🔄 Backfill %d: refreshed %v", b.ID, refreshed)
+	}
+	return nil
+}
+
+// fetchBackfillChunk loads one chunk of unadjusted bars into the OHLCV table,
+// matching how the flat-file loader stores them (prices * 1000)
+func fetchBackfillChunk(ctx context.Context, conn *data.Conn, ticker, table string, timespan models.Timespan, from, to time.Time) (int64, error) {
+	params := models.ListAggsParams{
+		Ticker:     ticker,
+		Multiplier: 1,
+		Timespan:   timespan,
+		From:       models.Millis(from),
+		To:         models.Millis(to),
+	}.WithAdjusted(false).WithOrder(models.Asc).WithLimit(backfillPageLimit)
+
+	reqCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	iter := conn.Polygon.ListAggs(reqCtx, params)
+	batch := &pgx.Batch{}
+	for iter.Next() {
+		agg := iter.Item()
+		batch.Queue(fmt.Sprintf(`
+			INSERT INTO %s (ticker, volume, open, close, high, low, "timestamp", transactions)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (ticker, "timestamp") DO UPDATE SET
+				volume = EXCLUDED.volume,
+				open = EXCLUDED.open,
+				close = EXCLUDED.close,
+				high = EXCLUDED.high,
+				low = EXCLUDED.low,
+				transactions = EXCLUDED.transactions`, table),
+			ticker, agg.Volume, agg.Open*1000, agg.Close*1000, agg.High*1000, agg.Low*1000,
+			time.Time(agg.Timestamp), agg.Transactions)
+	}
+	if err := iter.Err(); err != nil {
+		return 0, fmt.Errorf("error fetching %s bars for %s: %v", timespan, ticker, err)
+	}
+	if batch.Len() == 0 {
+		return 0, nil
+	}
+	if err := conn.DB.SendBatch(ctx, batch).Close(); err != nil {
+		return 0, fmt.Errorf("error writing %d bars for %s: %v", batch.Len(), ticker, err)
+	}
+	return int64(batch.Len()), nil
+}
+
+// backfillRequestBudget is the number of Polygon requests backfills may make
+// per minute across all processes (BACKFILL_POLYGON_RPM)
+func backfillRequestBudget() int {
+	if v, err := strconv.Atoi(os.Getenv("BACKFILL_POLYGON_RPM")); err == nil && v > 0 {
+		return v
+	}
+	return defaultBackfillRPM
+}
+
+// backfillYield reports whether scheduled Polygon-heavy jobs are running or
+// waiting to; the scheduler sets it
+var backfillYield atomic.Value // func() bool
+
+// SetBackfillYield makes backfills pause between chunks while yield reports
+// true, so they don't compete with the nightly jobs for the rate limit
+func SetBackfillYield(yield func() bool) {
+	backfillYield.Store(yield)
+}
+
+// waitForNightlyJobs waits while the scheduler's Polygon-heavy jobs have the
+// rate limit
+func waitForNightlyJobs(ctx context.Context) error {
+	yield, _ := backfillYield.Load().(func() bool)
+	if yield == nil || !yield() {
+		return nil
+	}
+	log.Printf("⏸️ Backfills yielding to scheduled Polygon jobs")
+	for yield() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backfillPollInterval):
+		}
+	}
+	log.Printf("▶️ Backfills resuming")
+	return nil
+}
+
+// waitForPolygonBudget takes one request from the current minute's budget,
+// waiting for the next minute when it's used up
+func waitForPolygonBudget(ctx context.Context, conn *data.Conn) error {
+	budget := int64(backfillRequestBudget())
+	for {
+		now := time.Now()
+		key := backfillRequestKey + strconv.FormatInt(now.Unix()/60, 10)
+		n, err := conn.Cache.Incr(ctx, key).Result()
+		if err != nil {
+			return fmt.Errorf("error reserving Polygon budget: %v", err)
+		}
+		if n == 1 {
+			conn.Cache.Expire(ctx, key, 2*time.Minute)
+		}
+		if n <= budget {
+			return nil
+		}
+		wait := now.Truncate(time.Minute).Add(time.Minute).Sub(now)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
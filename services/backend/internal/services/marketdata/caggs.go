@@ -0,0 +1,260 @@
+package marketdata
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Continuous aggregates of the OHLCV tables for the chart timeframes that are
+// built from the stored 1m and 1d bars. Each is created on demand with a
+// refresh policy; TimescaleDB then keeps the recent window materialized and
+// serves newer rows in real time. Backfilled history older than the policy
+// window is only picked up by a manual refresh of its range, which the
+// backfill worker does when it finishes.
+const (
+	// how long after its policy should have run an aggregate counts as stale
+	aggregateStaleGrace = 10 * time.Minute
+	// chart requests reuse the freshness lookup this long
+	aggregateFreshnessTTL = time.Minute
+)
+
+// ChartAggregate is one managed continuous aggregate
+type ChartAggregate struct {
+	Name      string
+	Timeframe string        // as the chart requests it
+	Bucket    time.Duration // bar length
+	Source    string        // OHLCV table it is built from
+	// refresh policy
+	StartOffset      time.Duration
+	EndOffset        time.Duration
+	ScheduleInterval time.Duration
+}
+
+// ChartAggregates are the aggregates EnsureChartAggregates manages
+var ChartAggregates = []ChartAggregate{
+	{Name: "cagg_ohlcv_5m", Timeframe: "5", Bucket: 5 * time.Minute, Source: "ohlcv_1m",
+		StartOffset: 3 * 24 * time.Hour, ScheduleInterval: 5 * time.Minute},
+	{Name: "cagg_ohlcv_15m", Timeframe: "15", Bucket: 15 * time.Minute, Source: "ohlcv_1m",
+		StartOffset: 3 * 24 * time.Hour, ScheduleInterval: 5 * time.Minute},
+	{Name: "cagg_ohlcv_1h", Timeframe: "1h", Bucket: time.Hour, Source: "ohlcv_1m",
+		StartOffset: 7 * 24 * time.Hour, ScheduleInterval: 15 * time.Minute},
+	{Name: "cagg_ohlcv_1w", Timeframe: "1w", Bucket: 7 * 24 * time.Hour, Source: "ohlcv_1d",
+		StartOffset: 35 * 24 * time.Hour, ScheduleInterval: time.Hour},
+}
+
+// ChartAggregateFor returns the aggregate serving bars of length bucket
+func ChartAggregateFor(bucket time.Duration) (ChartAggregate, bool) {
+	for _, agg := range ChartAggregates {
+		if agg.Bucket == bucket {
+			return agg, true
+		}
+	}
+	return ChartAggregate{}, false
+}
+
+// interval renders a duration as a Postgres interval literal. Whole days stay
+// days so buckets in America/New_York follow the calendar across DST changes.
+func interval(d time.Duration) string {
+	if d%(24*time.Hour) == 0 && d > 0 {
+		return fmt.Sprintf("%d days", d/(24*time.Hour))
+	}
+	return fmt.Sprintf("%d seconds", int64(d.Seconds()))
+}
+
+// isAggregateSource reports whether any chart aggregate is built on table
+func isAggregateSource(table string) bool {
+	for _, agg := range ChartAggregates {
+		if agg.Source == table {
+			return true
+		}
+	}
+	return false
+}
+
+// EnsureChartAggregates creates the missing chart aggregates and their refresh
+// policies. New aggregates start empty; their policy fills the recent window
+// and RefreshChartAggregates the rest.
+func EnsureChartAggregates(conn *data.Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	for _, agg := range ChartAggregates {
+		// Identifiers and intervals come from ChartAggregates, not callers
+		_, err := conn.DB.Exec(ctx, fmt.Sprintf(`
+			CREATE MATERIALIZED VIEW IF NOT EXISTS %s
+			WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+			SELECT
+				ticker,
+				time_bucket(INTERVAL '%s', "timestamp", 'America/New_York') AS "timestamp",
+				first(open, "timestamp") AS open,
+				max(high) AS high,
+				min(low) AS low,
+				last(close, "timestamp") AS close,
+				sum(volume) AS volume,
+				sum(transactions) AS transactions
+			FROM %s
+			GROUP BY 1, 2
+			WITH NO DATA`, agg.Name, interval(agg.Bucket), agg.Source))
+		if err != nil {
+			return fmt.Errorf("error creating %s: %v", agg.Name, err)
+		}
+		_, err = conn.DB.Exec(ctx, `
+			SELECT add_continuous_aggregate_policy($1::regclass,
+				start_offset => $2::interval,
+				end_offset => $3::interval,
+				schedule_interval => $4::interval,
+				if_not_exists => true)`,
+			agg.Name, interval(agg.StartOffset), interval(agg.EndOffset), interval(agg.ScheduleInterval))
+		if err != nil {
+			return fmt.Errorf("error adding refresh policy to %s: %v", agg.Name, err)
+		}
+	}
+	log.Printf("✅ %d chart aggregates in place", len(ChartAggregates))
+	return nil
+}
+
+// RefreshChartAggregates materializes [from, to) of every chart aggregate built
+// on source (ohlcv_1m or ohlcv_1d), as after a backfill. Aggregates refresh by
+// time window for all tickers at once; with a ticker the window is narrowed to
+// the span of that ticker's bars in it. Returns the aggregates refreshed.
+func RefreshChartAggregates(ctx context.Context, conn *data.Conn, source, ticker string, from, to time.Time) ([]string, error) {
+	if !isAggregateSource(source) {
+		return nil, fmt.Errorf("no chart aggregates are built on %q", source)
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("refresh range end %s is not after start %s", to.Format(time.RFC3339), from.Format(time.RFC3339))
+	}
+	if ticker != "" {
+		var first, last *time.Time
+		// #nosec G201 -- source is one of the aggregate source tables
+		err := conn.DB.QueryRow(ctx, fmt.Sprintf(`
+			SELECT min("timestamp"), max("timestamp") FROM %s
+			WHERE ticker = $1 AND "timestamp" >= $2 AND "timestamp" < $3`, source),
+			ticker, from, to).Scan(&first, &last)
+		if err != nil {
+			return nil, fmt.Errorf("error finding %s bars for %s: %v", source, ticker, err)
+		}
+		if first == nil {
+			return nil, nil
+		}
+		from, to = *first, last.Add(time.Nanosecond)
+	}
+
+	var refreshed []string
+	for _, agg := range ChartAggregates {
+		if agg.Source != source {
+			continue
+		}
+		// TimescaleDB only refreshes the whole buckets inside the window, so
+		// pad it by a bucket on each side to cover partial ones at the ends
+		start, end := from.Add(-agg.Bucket), to.Add(agg.Bucket)
+		if _, err := conn.DB.Exec(ctx, `CALL refresh_continuous_aggregate($1::regclass, $2::timestamptz, $3::timestamptz)`,
+			agg.Name, start, end); err != nil {
+			return refreshed, fmt.Errorf("error refreshing %s: %v", agg.Name, err)
+		}
+		refreshed = append(refreshed, agg.Name)
+	}
+	return refreshed, nil
+}
+
+// AggregateFreshness is how up to date one chart aggregate is
+type AggregateFreshness struct {
+	Name          string     `json:"name"`
+	Timeframe     string     `json:"timeframe"`
+	Exists        bool       `json:"exists"`
+	LastRefreshed *time.Time `json:"lastRefreshed,omitempty"`
+	LastStatus    string     `json:"lastStatus,omitempty"`
+	Stale         bool       `json:"stale"`
+}
+
+// ChartAggregateFreshness reports when each chart aggregate's refresh policy
+// last succeeded. An aggregate is stale when it's missing, has never
+// refreshed, or its policy is overdue.
+func ChartAggregateFreshness(ctx context.Context, conn *data.Conn) ([]AggregateFreshness, error) {
+	names := make([]string, len(ChartAggregates))
+	for i, agg := range ChartAggregates {
+		names[i] = agg.Name
+	}
+	rows, err := conn.DB.Query(ctx, `
+		SELECT ca.view_name, max(js.last_successful_finish), max(js.last_run_status)
+		FROM timescaledb_information.continuous_aggregates ca
+		LEFT JOIN timescaledb_information.jobs j
+			ON j.hypertable_schema = ca.materialization_hypertable_schema
+			AND j.hypertable_name = ca.materialization_hypertable_name
+			AND j.proc_name = 'policy_refresh_continuous_aggregate'
+		LEFT JOIN timescaledb_information.job_stats js ON js.job_id = j.job_id
+		WHERE ca.view_name = ANY($1)
+		GROUP BY ca.view_name`, names)
+	if err != nil {
+		return nil, fmt.Errorf("error reading aggregate refresh stats: %v", err)
+	}
+	defer rows.Close()
+	type stats struct {
+		finished *time.Time
+		status   *string
+	}
+	found := make(map[string]stats)
+	for rows.Next() {
+		var name string
+		var s stats
+		if err := rows.Scan(&name, &s.finished, &s.status); err != nil {
+			return nil, fmt.Errorf("error scanning aggregate refresh stats: %v", err)
+		}
+		found[name] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	out := make([]AggregateFreshness, 0, len(ChartAggregates))
+	for _, agg := range ChartAggregates {
+		f := AggregateFreshness{Name: agg.Name, Timeframe: agg.Timeframe, Stale: true}
+		if s, ok := found[agg.Name]; ok {
+			f.Exists = true
+			f.LastRefreshed = s.finished
+			if s.status != nil {
+				f.LastStatus = *s.status
+			}
+			f.Stale = s.finished == nil || now.Sub(*s.finished) > agg.ScheduleInterval+aggregateStaleGrace
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+var aggregateFreshnessCache struct {
+	sync.Mutex
+	at     time.Time
+	byName map[string]AggregateFreshness
+}
+
+// CachedAggregateFreshness returns the freshness of the aggregate serving bars
+// of length bucket, looked up at most once a minute. ok is false when no
+// chart aggregate serves that bar length or the lookup failed.
+func CachedAggregateFreshness(ctx context.Context, conn *data.Conn, bucket time.Duration) (AggregateFreshness, bool) {
+	agg, ok := ChartAggregateFor(bucket)
+	if !ok {
+		return AggregateFreshness{}, false
+	}
+	c := &aggregateFreshnessCache
+	c.Lock()
+	defer c.Unlock()
+	if c.byName == nil || time.Since(c.at) > aggregateFreshnessTTL {
+		all, err := ChartAggregateFreshness(ctx, conn)
+		if err != nil {
+			log.Printf("⚠️ Chart aggregate freshness: %v", err)
+			return AggregateFreshness{}, false
+		}
+		c.byName = make(map[string]AggregateFreshness, len(all))
+		for _, f := range all {
+			c.byName[f.Name] = f
+		}
+		c.at = time.Now()
+	}
+	f, ok := c.byName[agg.Name]
+	return f, ok
+}
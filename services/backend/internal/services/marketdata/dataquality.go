@@ -0,0 +1,688 @@
+package marketdata
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/polygon-io/client-go/rest/models"
+)
+
+// Data-quality checks over recently ingested OHLCV. Every run re-evaluates the
+// lookback window: findings that are detected again keep their row in
+// ohlcv_quality_findings, findings that no longer show up are resolved. Only
+// securities that are still listed are checked.
+const (
+	qualityLookback = 21 * 24 * time.Hour
+	// a date counts as a trading day once this many tickers have a daily bar
+	qualityMinTickersPerDay = 1000
+	// gaps in thinly traded names are normal, they only print when they trade
+	qualityGapMinAvgVolume = 100_000
+	qualityStuckBars       = 5
+	// liquid names should have most regular-session minutes; 0.5 keeps half days quiet
+	qualityMinuteMinVolume = 1_000_000
+	qualityMinuteCoverage  = 0.5
+	qualitySessionMinutes  = 390
+	// how far a close-to-close ratio may be from a split ratio to count as one
+	qualitySplitTolerance = 0.05
+	// a split's execution date may be off by a day or two from the first bar
+	qualitySplitWindow = 3 * 24 * time.Hour
+)
+
+// Check types of ohlcv_quality_findings
+const (
+	QualityCheckGap           = "gap"
+	QualityCheckZeroVolume    = "zero_volume"
+	QualityCheckStuckPrice    = "stuck_price"
+	QualityCheckSplitMismatch = "split_mismatch"
+)
+
+var qualitySplitRatios = []float64{2, 3, 4, 5, 8, 10, 15, 20, 25, 30, 40, 50, 100}
+
+// trading days in the lookback window, as dates in ET
+const qualityTradingDaysCTE = `
+	days AS (
+		SELECT ("timestamp" AT TIME ZONE 'America/New_York')::date AS day
+		FROM ohlcv_1d
+		WHERE "timestamp" >= $1
+		GROUP BY 1
+		HAVING count(*) >= $2
+	)`
+
+// QualityFinding is one data problem found for a security
+type QualityFinding struct {
+	SecurityID  int                    `json:"securityId"`
+	Ticker      string                 `json:"ticker"`
+	Timeframe   string                 `json:"timeframe"`
+	Check       string                 `json:"check"`
+	Severity    string                 `json:"severity"` // warning or error
+	TradingDate string                 `json:"tradingDate"`
+	Details     map[string]interface{} `json:"details"`
+	Message     string                 `json:"message"`
+	FirstSeen   int64                  `json:"firstSeen,omitempty"`
+	LastSeen    int64                  `json:"lastSeen,omitempty"`
+}
+
+// describe returns the finding as one line of text
+func (f QualityFinding) describe() string {
+	switch f.Check {
+	case QualityCheckGap:
+		if f.Timeframe == "1m" {
+			return fmt.Sprintf("Missing intraday bars on %s", f.TradingDate)
+		}
+		return fmt.Sprintf("Missing daily bar on %s", f.TradingDate)
+	case QualityCheckZeroVolume:
+		return fmt.Sprintf("Zero-volume daily bar on %s", f.TradingDate)
+	case QualityCheckStuckPrice:
+		return fmt.Sprintf("Price unchanged for %d sessions through %s", qualityStuckBars, f.TradingDate)
+	case QualityCheckSplitMismatch:
+		if reason, ok := f.Details["reason"].(string); ok {
+			return fmt.Sprintf("Possible split adjustment issue on %s: %s", f.TradingDate, reason)
+		}
+		return fmt.Sprintf("Possible split adjustment issue on %s", f.TradingDate)
+	}
+	return fmt.Sprintf("%s on %s", f.Check, f.TradingDate)
+}
+
+// DataQualitySummary is the result of one run of the checks
+type DataQualitySummary struct {
+	Open map[string]int   // open findings per check type
+	New  []QualityFinding // findings first detected by this run
+}
+
+// AlertText summarises the new findings for an internal alert
+func (s *DataQualitySummary) AlertText() string {
+	counts := make(map[string]int)
+	for _, f := range s.New {
+		counts[f.Check]++
+	}
+	checks := make([]string, 0, len(counts))
+	for check, n := range counts {
+		checks = append(checks, fmt.Sprintf("%s %d", check, n))
+	}
+	sort.Strings(checks)
+	var b strings.Builder
+	fmt.Fprintf(&b, "OHLCV data quality: %d new findings (%s)", len(s.New), strings.Join(checks, ", "))
+	for i, f := range s.New {
+		if i == 10 {
+			fmt.Fprintf(&b, "\n…and %d more", len(s.New)-i)
+			break
+		}
+		fmt.Fprintf(&b, "\n%s [%s %s] %s", f.Ticker, f.Timeframe, f.Severity, f.describe())
+	}
+	return b.String()
+}
+
+type qualityCheck struct {
+	name      string
+	checkType string
+	run       func(ctx context.Context, conn *data.Conn, since time.Time) ([]QualityFinding, error)
+}
+
+// RunDataQualityChecks scans the recent OHLCV data, records the findings and
+// returns the ones that are new. A check that fails is logged and skipped, and
+// the open findings of its type are left as they are.
+func RunDataQualityChecks(conn *data.Conn) (*DataQualitySummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	since := time.Now().Add(-qualityLookback)
+	checks := []qualityCheck{
+		{"daily gaps", QualityCheckGap, checkDailyGaps},
+		{"minute coverage", QualityCheckGap, checkMinuteCoverage},
+		{"zero volume", QualityCheckZeroVolume, checkZeroVolume},
+		{"stuck prices", QualityCheckStuckPrice, checkStuckPrices},
+		{"split mismatches", QualityCheckSplitMismatch, checkSplitMismatches},
+	}
+	var findings []QualityFinding
+	failed := make(map[string]bool)
+	for _, c := range checks {
+		start := time.Now()
+		found, err := c.run(ctx, conn, since)
+		if err != nil {
+			log.Printf("⚠️ Data quality: %s check failed: %v", c.name, err)
+			failed[c.checkType] = true
+			continue
+		}
+		findings = append(findings, found...)
+		log.Printf("🔎 Data quality: %s check found %d issues in %v", c.name, len(found), time.Since(start).Round(time.Millisecond))
+	}
+
+	var resolvable []string
+	for _, c := range checks {
+		if !failed[c.checkType] && !containsString(resolvable, c.checkType) {
+			resolvable = append(resolvable, c.checkType)
+		}
+	}
+	if len(resolvable) == 0 {
+		return nil, fmt.Errorf("every data quality check failed")
+	}
+	newFindings, err := saveQualityFindings(ctx, conn, findings, resolvable)
+	if err != nil {
+		return nil, err
+	}
+	open, err := countOpenFindings(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	return &DataQualitySummary{Open: open, New: newFindings}, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDailyGaps finds trading days without a daily bar for active, liquid
+// securities that had bars earlier in the window
+func checkDailyGaps(ctx context.Context, conn *data.Conn, since time.Time) ([]QualityFinding, error) {
+	rows, err := conn.DB.Query(ctx, `
+		WITH `+qualityTradingDaysCTE+`,
+		spans AS (
+			SELECT ticker, min("timestamp") AS first_ts
+			FROM ohlcv_1d
+			WHERE "timestamp" >= $1
+			GROUP BY ticker
+			HAVING avg(volume) >= $3
+		)
+		SELECT s.securityid, sp.ticker, d.day
+		FROM spans sp
+		JOIN securities s ON s.ticker = sp.ticker AND s.maxdate IS NULL
+		JOIN days d ON d.day > (sp.first_ts AT TIME ZONE 'America/New_York')::date
+		WHERE NOT EXISTS (
+			SELECT 1 FROM ohlcv_1d o
+			WHERE o.ticker = sp.ticker
+			  AND o."timestamp" >= d.day::timestamp AT TIME ZONE 'America/New_York'
+			  AND o."timestamp" < (d.day + 1)::timestamp AT TIME ZONE 'America/New_York'
+		)`, since, qualityMinTickersPerDay, qualityGapMinAvgVolume)
+	if err != nil {
+		return nil, fmt.Errorf("error querying daily gaps: %v", err)
+	}
+	defer rows.Close()
+	var out []QualityFinding
+	for rows.Next() {
+		var f QualityFinding
+		var day time.Time
+		if err := rows.Scan(&f.SecurityID, &f.Ticker, &day); err != nil {
+			return nil, fmt.Errorf("error scanning daily gap: %v", err)
+		}
+		f.Timeframe, f.Check, f.Severity = "1d", QualityCheckGap, "warning"
+		f.TradingDate = day.Format("2006-01-02")
+		f.Details = map[string]interface{}{}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// GapRange is a run of consecutive trading days missing a security's bars
+type GapRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	Days int       `json:"days"`
+}
+
+// DailyGaps returns the runs of trading days since since (and since the
+// security listed) that have no daily bar for the listed security ticker.
+// Unlike the nightly check it looks at one security whatever its volume.
+func DailyGaps(ctx context.Context, conn *data.Conn, ticker string, since time.Time) ([]GapRange, error) {
+	rows, err := conn.DB.Query(ctx, `
+		WITH `+qualityTradingDaysCTE+`
+		SELECT d.day, EXISTS (
+			SELECT 1 FROM ohlcv_1d o
+			WHERE o.ticker = $3
+			  AND o."timestamp" >= d.day::timestamp AT TIME ZONE 'America/New_York'
+			  AND o."timestamp" < (d.day + 1)::timestamp AT TIME ZONE 'America/New_York'
+		)
+		FROM days d
+		JOIN securities s ON s.ticker = $3 AND s.maxdate IS NULL
+		WHERE s.mindate IS NULL OR d.day >= s.mindate::date
+		ORDER BY d.day`, since, qualityMinTickersPerDay, ticker)
+	if err != nil {
+		return nil, fmt.Errorf("error querying daily gaps of %s: %v", ticker, err)
+	}
+	defer rows.Close()
+	var gaps []GapRange
+	open := false
+	for rows.Next() {
+		var day time.Time
+		var hasBar bool
+		if err := rows.Scan(&day, &hasBar); err != nil {
+			return nil, fmt.Errorf("error scanning daily gap: %v", err)
+		}
+		switch {
+		case hasBar:
+			open = false
+		case open:
+			gaps[len(gaps)-1].To = day
+			gaps[len(gaps)-1].Days++
+		default:
+			gaps = append(gaps, GapRange{From: day, To: day, Days: 1})
+			open = true
+		}
+	}
+	return gaps, rows.Err()
+}
+
+// checkMinuteCoverage finds liquid securities whose 1-minute bars cover too
+// little of the latest regular session
+func checkMinuteCoverage(ctx context.Context, conn *data.Conn, since time.Time) ([]QualityFinding, error) {
+	var latest *time.Time
+	err := conn.DB.QueryRow(ctx, `WITH `+qualityTradingDaysCTE+` SELECT max(day) FROM days`,
+		since, qualityMinTickersPerDay).Scan(&latest)
+	if err != nil {
+		return nil, fmt.Errorf("error finding latest trading day: %v", err)
+	}
+	if latest == nil {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return nil, fmt.Errorf("error loading timezone: %v", err)
+	}
+	day := time.Date(latest.Year(), latest.Month(), latest.Day(), 0, 0, 0, 0, loc)
+	open, closeTime := day.Add(9*time.Hour+30*time.Minute), day.Add(16*time.Hour)
+
+	rows, err := conn.DB.Query(ctx, `
+		SELECT s.securityid, d.ticker, d.volume::float8, COALESCE(m.bars, 0)
+		FROM ohlcv_1d d
+		JOIN securities s ON s.ticker = d.ticker AND s.maxdate IS NULL
+		LEFT JOIN (
+			SELECT ticker, count(*) AS bars
+			FROM ohlcv_1m
+			WHERE "timestamp" >= $1 AND "timestamp" < $2
+			GROUP BY ticker
+		) m ON m.ticker = d.ticker
+		WHERE d."timestamp" >= $3 AND d."timestamp" < $4 AND d.volume >= $5`,
+		open, closeTime, day, day.AddDate(0, 0, 1), qualityMinuteMinVolume)
+	if err != nil {
+		return nil, fmt.Errorf("error querying minute coverage: %v", err)
+	}
+	defer rows.Close()
+	minBars := int64(qualityMinuteCoverage * qualitySessionMinutes)
+	var out []QualityFinding
+	for rows.Next() {
+		var f QualityFinding
+		var volume float64
+		var bars int64
+		if err := rows.Scan(&f.SecurityID, &f.Ticker, &volume, &bars); err != nil {
+			return nil, fmt.Errorf("error scanning minute coverage: %v", err)
+		}
+		if bars >= minBars {
+			continue
+		}
+		f.Timeframe, f.Check, f.Severity = "1m", QualityCheckGap, "warning"
+		if bars == 0 {
+			f.Severity = "error"
+		}
+		f.TradingDate = day.Format("2006-01-02")
+		f.Details = map[string]interface{}{"bars": bars, "expected": qualitySessionMinutes, "dailyVolume": volume}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// checkZeroVolume finds daily bars without volume
+func checkZeroVolume(ctx context.Context, conn *data.Conn, since time.Time) ([]QualityFinding, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT s.securityid, o.ticker, (o."timestamp" AT TIME ZONE 'America/New_York')::date,
+		       COALESCE(o.close, 0)::float8 / 1000
+		FROM ohlcv_1d o
+		JOIN securities s ON s.ticker = o.ticker AND s.maxdate IS NULL
+		WHERE o."timestamp" >= $1 AND COALESCE(o.volume, 0) = 0`, since)
+	if err != nil {
+		return nil, fmt.Errorf("error querying zero-volume bars: %v", err)
+	}
+	defer rows.Close()
+	var out []QualityFinding
+	for rows.Next() {
+		var f QualityFinding
+		var day time.Time
+		var closePrice float64
+		if err := rows.Scan(&f.SecurityID, &f.Ticker, &day, &closePrice); err != nil {
+			return nil, fmt.Errorf("error scanning zero-volume bar: %v", err)
+		}
+		f.Timeframe, f.Check, f.Severity = "1d", QualityCheckZeroVolume, "warning"
+		f.TradingDate = day.Format("2006-01-02")
+		f.Details = map[string]interface{}{"close": closePrice}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// checkStuckPrices finds securities whose last few daily bars are identical,
+// which usually means the feed repeated a stale bar
+func checkStuckPrices(ctx context.Context, conn *data.Conn, since time.Time) ([]QualityFinding, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT s.securityid, t.ticker, max(t.day), min(t.close)::float8 / 1000
+		FROM (
+			SELECT ticker, ("timestamp" AT TIME ZONE 'America/New_York')::date AS day,
+			       open, high, low, close,
+			       row_number() OVER (PARTITION BY ticker ORDER BY "timestamp" DESC) AS rn
+			FROM ohlcv_1d
+			WHERE "timestamp" >= $1
+		) t
+		JOIN securities s ON s.ticker = t.ticker AND s.maxdate IS NULL
+		WHERE t.rn <= $2
+		GROUP BY s.securityid, t.ticker
+		HAVING count(*) = $2
+		   AND min(t.low) = max(t.high)
+		   AND min(t.open) = max(t.open)
+		   AND min(t.close) = max(t.close)`, since, qualityStuckBars)
+	if err != nil {
+		return nil, fmt.Errorf("error querying stuck prices: %v", err)
+	}
+	defer rows.Close()
+	var out []QualityFinding
+	for rows.Next() {
+		var f QualityFinding
+		var day time.Time
+		var price float64
+		if err := rows.Scan(&f.SecurityID, &f.Ticker, &day, &price); err != nil {
+			return nil, fmt.Errorf("error scanning stuck price: %v", err)
+		}
+		f.Timeframe, f.Check, f.Severity = "1d", QualityCheckStuckPrice, "error"
+		f.TradingDate = day.Format("2006-01-02")
+		f.Details = map[string]interface{}{"price": price, "bars": qualityStuckBars}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// splitJump is a close-to-close move that looks like a split
+type splitJump struct {
+	securityID int
+	ticker     string
+	day        time.Time
+	ratio      float64
+}
+
+// checkSplitMismatches compares the daily bars with Polygon's split records:
+// a jump by a split ratio without a recorded split, or a recorded split that
+// the bars don't reflect, both point at bad or mis-adjusted data
+func checkSplitMismatches(ctx context.Context, conn *data.Conn, since time.Time) ([]QualityFinding, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT s.securityid, t.ticker, t.day, t.close::float8 / t.prev_close::float8
+		FROM (
+			SELECT ticker, ("timestamp" AT TIME ZONE 'America/New_York')::date AS day, close,
+			       lag(close) OVER (PARTITION BY ticker ORDER BY "timestamp") AS prev_close
+			FROM ohlcv_1d
+			WHERE "timestamp" >= $1
+		) t
+		JOIN securities s ON s.ticker = t.ticker AND s.maxdate IS NULL
+		WHERE t.prev_close > 0 AND t.close > 0
+		  AND (t.close / t.prev_close >= 1.8 OR t.close / t.prev_close <= 0.55)`, since)
+	if err != nil {
+		return nil, fmt.Errorf("error querying price jumps: %v", err)
+	}
+	var jumps []splitJump
+	for rows.Next() {
+		var j splitJump
+		if err := rows.Scan(&j.securityID, &j.ticker, &j.day, &j.ratio); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning price jump: %v", err)
+		}
+		if splitFactor(j.ratio) > 0 {
+			jumps = append(jumps, j)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating price jumps: %v", err)
+	}
+
+	splits, err := recentSplits(ctx, conn, since)
+	if err != nil {
+		return nil, err
+	}
+	splitsByTicker := make(map[string][]models.Split)
+	for _, sp := range splits {
+		splitsByTicker[sp.Ticker] = append(splitsByTicker[sp.Ticker], sp)
+	}
+
+	var out []QualityFinding
+	for _, j := range jumps {
+		if nearbySplit(splitsByTicker[j.ticker], j.day) != nil {
+			continue
+		}
+		out = append(out, QualityFinding{
+			SecurityID:  j.securityID,
+			Ticker:      j.ticker,
+			Timeframe:   "1d",
+			Check:       QualityCheckSplitMismatch,
+			Severity:    "warning",
+			TradingDate: j.day.Format("2006-01-02"),
+			Details: map[string]interface{}{
+				"reason": "price moved by a split ratio but no split is recorded",
+				"ratio":  math.Round(j.ratio*1000) / 1000,
+			},
+		})
+	}
+
+	for _, sp := range splits {
+		if sp.SplitFrom <= 0 || sp.SplitTo <= 0 {
+			continue
+		}
+		execDate := time.Time(sp.ExecutionDate)
+		if execDate.After(time.Now()) {
+			continue
+		}
+		f, err := checkSplitReflected(ctx, conn, sp, execDate)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			out = append(out, *f)
+		}
+	}
+	return out, nil
+}
+
+// checkSplitReflected compares the close before a split with the first close
+// on or after it; the ratio should match the split
+func checkSplitReflected(ctx context.Context, conn *data.Conn, sp models.Split, execDate time.Time) (*QualityFinding, error) {
+	var securityID int
+	var before, after *float64
+	err := conn.DB.QueryRow(ctx, `
+		SELECT s.securityid,
+		       (SELECT close::float8 FROM ohlcv_1d
+		        WHERE ticker = s.ticker AND "timestamp" < $2::date::timestamp AT TIME ZONE 'America/New_York'
+		        ORDER BY "timestamp" DESC LIMIT 1),
+		       (SELECT close::float8 FROM ohlcv_1d
+		        WHERE ticker = s.ticker AND "timestamp" >= $2::date::timestamp AT TIME ZONE 'America/New_York'
+		        ORDER BY "timestamp" LIMIT 1)
+		FROM securities s
+		WHERE s.ticker = $1 AND s.maxdate IS NULL`, sp.Ticker, execDate.Format("2006-01-02")).Scan(&securityID, &before, &after)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading closes around %s split: %v", sp.Ticker, err)
+	}
+	if before == nil || after == nil || *before <= 0 {
+		return nil, nil
+	}
+	expected := sp.SplitFrom / sp.SplitTo
+	actual := *after / *before
+	if math.Abs(actual/expected-1) <= 0.25 {
+		return nil, nil
+	}
+	return &QualityFinding{
+		SecurityID:  securityID,
+		Ticker:      sp.Ticker,
+		Timeframe:   "1d",
+		Check:       QualityCheckSplitMismatch,
+		Severity:    "error",
+		TradingDate: execDate.Format("2006-01-02"),
+		Details: map[string]interface{}{
+			"reason":   fmt.Sprintf("%g-for-%g split is not reflected in the bars", sp.SplitTo, sp.SplitFrom),
+			"expected": math.Round(expected*1000) / 1000,
+			"ratio":    math.Round(actual*1000) / 1000,
+		},
+	}, nil
+}
+
+// splitFactor returns the split ratio a price ratio matches, or 0
+func splitFactor(ratio float64) float64 {
+	for _, r := range qualitySplitRatios {
+		if math.Abs(ratio/r-1) <= qualitySplitTolerance || math.Abs(ratio*r-1) <= qualitySplitTolerance {
+			return r
+		}
+	}
+	return 0
+}
+
+func nearbySplit(splits []models.Split, day time.Time) *models.Split {
+	for i := range splits {
+		d := time.Time(splits[i].ExecutionDate).Sub(day)
+		if d >= -qualitySplitWindow && d <= qualitySplitWindow {
+			return &splits[i]
+		}
+	}
+	return nil
+}
+
+// recentSplits lists the splits Polygon has recorded since the given time
+func recentSplits(ctx context.Context, conn *data.Conn, since time.Time) ([]models.Split, error) {
+	params := models.ListSplitsParams{}.
+		WithExecutionDate(models.GTE, models.Date(since.Add(-qualitySplitWindow))).
+		WithLimit(1000)
+	iter := conn.Polygon.ListSplits(ctx, params)
+	var splits []models.Split
+	for iter.Next() {
+		splits = append(splits, iter.Item())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching recent splits: %v", err)
+	}
+	return splits, nil
+}
+
+// saveQualityFindings upserts the findings of a run, resolves open findings
+// of the checked types that weren't detected again, and returns the findings
+// that are new or came back after being resolved
+func saveQualityFindings(ctx context.Context, conn *data.Conn, findings []QualityFinding, checked []string) ([]QualityFinding, error) {
+	now := time.Now()
+	tx, err := conn.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var fresh []QualityFinding
+	for _, f := range findings {
+		details, err := json.Marshal(f.Details)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding finding details: %v", err)
+		}
+		var isNew bool
+		err = tx.QueryRow(ctx, `
+			INSERT INTO ohlcv_quality_findings
+				(securityid, ticker, timeframe, check_type, severity, trading_date, details, first_seen_at, last_seen_at)
+			VALUES ($1, $2, $3, $4, $5, $6::date, $7, $8, $8)
+			ON CONFLICT (ticker, timeframe, check_type, trading_date) DO UPDATE SET
+				securityid    = EXCLUDED.securityid,
+				severity      = EXCLUDED.severity,
+				details       = EXCLUDED.details,
+				last_seen_at  = EXCLUDED.last_seen_at,
+				first_seen_at = CASE WHEN ohlcv_quality_findings.resolved_at IS NULL
+				                     THEN ohlcv_quality_findings.first_seen_at
+				                     ELSE EXCLUDED.first_seen_at END,
+				resolved_at   = NULL
+			RETURNING first_seen_at = $8`,
+			f.SecurityID, f.Ticker, f.Timeframe, f.Check, f.Severity, f.TradingDate, details, now).Scan(&isNew)
+		if err != nil {
+			return nil, fmt.Errorf("error saving %s finding for %s: %v", f.Check, f.Ticker, err)
+		}
+		if isNew {
+			fresh = append(fresh, f)
+		}
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE ohlcv_quality_findings
+		SET resolved_at = $1
+		WHERE resolved_at IS NULL AND last_seen_at < $1 AND check_type = ANY($2)`, now, checked)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving findings: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing findings: %v", err)
+	}
+	log.Printf("✅ Data quality: %d findings (%d new), %d resolved", len(findings), len(fresh), tag.RowsAffected())
+	return fresh, nil
+}
+
+func countOpenFindings(ctx context.Context, conn *data.Conn) (map[string]int, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT check_type, count(*) FROM ohlcv_quality_findings
+		WHERE resolved_at IS NULL GROUP BY check_type`)
+	if err != nil {
+		return nil, fmt.Errorf("error counting open findings: %v", err)
+	}
+	defer rows.Close()
+	open := make(map[string]int)
+	for rows.Next() {
+		var check string
+		var n int
+		if err := rows.Scan(&check, &n); err != nil {
+			return nil, fmt.Errorf("error scanning open findings: %v", err)
+		}
+		open[check] = n
+	}
+	return open, rows.Err()
+}
+
+// DataHealth is the data-quality state of one security
+type DataHealth struct {
+	Status   string           `json:"status"` // ok, warning or error
+	Findings []QualityFinding `json:"findings"`
+}
+
+// GetDataHealth returns the open data-quality findings of a security, newest first
+func GetDataHealth(ctx context.Context, conn *data.Conn, securityID int) (*DataHealth, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT securityid, ticker, timeframe, check_type, severity, trading_date, details,
+		       first_seen_at, last_seen_at
+		FROM ohlcv_quality_findings
+		WHERE securityid = $1 AND resolved_at IS NULL
+		ORDER BY trading_date DESC, severity
+		LIMIT 50`, securityID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading data health: %v", err)
+	}
+	defer rows.Close()
+	health := &DataHealth{Status: "ok", Findings: []QualityFinding{}}
+	for rows.Next() {
+		var f QualityFinding
+		var day, firstSeen, lastSeen time.Time
+		var details []byte
+		if err := rows.Scan(&f.SecurityID, &f.Ticker, &f.Timeframe, &f.Check, &f.Severity, &day, &details, &firstSeen, &lastSeen); err != nil {
+			return nil, fmt.Errorf("error scanning data health: %v", err)
+		}
+		if err := json.Unmarshal(details, &f.Details); err != nil {
+			f.Details = map[string]interface{}{}
+		}
+		f.TradingDate = day.Format("2006-01-02")
+		f.Message = f.describe()
+		f.FirstSeen, f.LastSeen = firstSeen.UnixMilli(), lastSeen.UnixMilli()
+		switch {
+		case f.Severity == "error":
+			health.Status = "error"
+		case health.Status == "ok":
+			health.Status = "warning"
+		}
+		health.Findings = append(health.Findings, f)
+	}
+	return health, rows.Err()
+}
@@ -0,0 +1,102 @@
+package marketdata
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"time"
+)
+
+// ohlcvPriceScale is the fixed-point multiplier applied to prices stored in ohlcv_1m
+const ohlcvPriceScale = 1000.0
+
+// VWAPPoint is the cumulative VWAP as of the close of one minute bar
+type VWAPPoint struct {
+	Timestamp int64   `json:"timestamp"` // bar start, ms since epoch
+	VWAP      float64 `json:"vwap"`
+}
+
+// VWAPResult is a VWAP computed from an anchor over 1m bars
+type VWAPResult struct {
+	Ticker   string      `json:"ticker"`
+	AnchorMs int64       `json:"anchor"`
+	EndMs    int64       `json:"end"`
+	VWAP     float64     `json:"vwap"` // value at the last bar
+	Volume   float64     `json:"volume"`
+	Bars     int         `json:"bars"`
+	Series   []VWAPPoint `json:"series,omitempty"`
+}
+
+var easternLocation = func() *time.Location {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return time.FixedZone("EST", -5*60*60)
+	}
+	return loc
+}()
+
+// AnchoredVWAP computes the volume-weighted average of the typical price
+// ((high+low+close)/3) over 1m bars in [anchor, end). When withSeries is set
+// the running VWAP after every bar is returned as well.
+func AnchoredVWAP(ctx context.Context, conn *data.Conn, ticker string, anchor, end time.Time, withSeries bool) (*VWAPResult, error) {
+	if !end.After(anchor) {
+		return nil, fmt.Errorf("vwap end must be after anchor")
+	}
+	rows, err := conn.DB.Query(ctx, `
+		SELECT "timestamp", (high + low + close) / 3.0, volume
+		FROM ohlcv_1m
+		WHERE ticker = $1 AND "timestamp" >= $2 AND "timestamp" < $3 AND volume > 0
+		ORDER BY "timestamp"`, ticker, anchor, end)
+	if err != nil {
+		return nil, fmt.Errorf("error querying 1m bars: %v", err)
+	}
+	defer rows.Close()
+
+	result := &VWAPResult{Ticker: ticker, AnchorMs: anchor.UnixMilli(), EndMs: end.UnixMilli()}
+	var pv float64
+	for rows.Next() {
+		var ts time.Time
+		var typical, volume float64
+		if err := rows.Scan(&ts, &typical, &volume); err != nil {
+			return nil, fmt.Errorf("error scanning 1m bar: %v", err)
+		}
+		pv += typical / ohlcvPriceScale * volume
+		result.Volume += volume
+		result.Bars++
+		if withSeries {
+			result.Series = append(result.Series, VWAPPoint{Timestamp: ts.UnixMilli(), VWAP: pv / result.Volume})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating 1m bars: %v", err)
+	}
+	if result.Volume == 0 {
+		return nil, fmt.Errorf("no volume for %s since %s", ticker, anchor.In(easternLocation).Format(time.RFC3339))
+	}
+	result.VWAP = pv / result.Volume
+	return result, nil
+}
+
+// SessionBounds returns the start and end of the trading session on the ET
+// calendar day of t; extended sessions run 4:00-20:00, regular 9:30-16:00
+func SessionBounds(t time.Time, extended bool) (time.Time, time.Time) {
+	day := t.In(easternLocation)
+	y, m, d := day.Date()
+	if extended {
+		return time.Date(y, m, d, 4, 0, 0, 0, easternLocation), time.Date(y, m, d, 20, 0, 0, 0, easternLocation)
+	}
+	return time.Date(y, m, d, 9, 30, 0, 0, easternLocation), time.Date(y, m, d, 16, 0, 0, 0, easternLocation)
+}
+
+// SessionVWAP computes the VWAP of the session containing t, up to t when the
+// session is still in progress
+func SessionVWAP(ctx context.Context, conn *data.Conn, ticker string, t time.Time, extended bool, withSeries bool) (*VWAPResult, error) {
+	start, end := SessionBounds(t, extended)
+	if t.Before(end) {
+		end = t
+	}
+	if !end.After(start) {
+		return nil, fmt.Errorf("session has not started yet")
+	}
+	return AnchoredVWAP(ctx, conn, ticker, start, end, withSeries)
+}
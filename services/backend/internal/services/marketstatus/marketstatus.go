@@ -0,0 +1,260 @@
+// Package marketstatus reports the current US equity market session (pre-market,
+// open, after-hours, closed, holiday, early close) from Polygon, cached in Redis.
+package marketstatus
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Session values reported in Status.Session
+const (
+	SessionPreMarket  = "pre_market"
+	SessionOpen       = "open"
+	SessionAfterHours = "after_hours"
+	SessionClosed     = "closed"
+	SessionHoliday    = "holiday"
+)
+
+const (
+	statusCacheKey   = "market_status:current"
+	holidaysCacheKey = "market_status:holidays"
+	statusCacheTTL   = 30 * time.Second
+	holidaysCacheTTL = 12 * time.Hour
+	polygonTimeout   = 5 * time.Second
+)
+
+// Holiday is an upcoming full or partial market closure
+type Holiday struct {
+	Date     string     `json:"date"` // YYYY-MM-DD
+	Name     string     `json:"name"`
+	Status   string     `json:"status"` // "closed" or "early-close"
+	Exchange string     `json:"exchange"`
+	Close    *time.Time `json:"close,omitempty"`
+}
+
+// Status is the market status at a point in time
+type Status struct {
+	Session     string     `json:"session"`
+	IsOpen      bool       `json:"isOpen"`
+	EarlyClose  bool       `json:"earlyClose"`
+	CloseTime   *time.Time `json:"closeTime,omitempty"` // early close time, when EarlyClose is set
+	HolidayName string     `json:"holidayName,omitempty"`
+	Source      string     `json:"source"` // "polygon" or "clock" when Polygon was unavailable
+	ServerTime  time.Time  `json:"serverTime"`
+	Holidays    []Holiday  `json:"upcomingHolidays,omitempty"`
+}
+
+var easternLocation = func() *time.Location {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return time.FixedZone("EST", -5*60*60)
+	}
+	return loc
+}()
+
+// Get returns the current market status, served from cache when fresh
+func Get(conn *data.Conn) (*Status, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), polygonTimeout)
+	defer cancel()
+
+	if cached, err := conn.Cache.Get(ctx, statusCacheKey).Result(); err == nil {
+		var status Status
+		if err := json.Unmarshal([]byte(cached), &status); err == nil {
+			return &status, nil
+		}
+	} else if err != redis.Nil {
+		log.Printf("⚠️ market status cache read failed: %v", err)
+	}
+
+	holidays, err := getHolidays(ctx, conn)
+	if err != nil {
+		log.Printf("⚠️ market holidays unavailable: %v", err)
+	}
+
+	status := &Status{Source: "polygon", Holidays: holidays}
+	res, err := conn.Polygon.GetMarketStatus(ctx)
+	if err != nil {
+		log.Printf("⚠️ Polygon market status unavailable, falling back to clock: %v", err)
+		status.Source = "clock"
+		status.ServerTime = time.Now().In(easternLocation)
+		status.Session = clockSession(status.ServerTime)
+	} else {
+		status.ServerTime = time.Time(res.ServerTime).In(easternLocation)
+		switch {
+		case res.Market == "open":
+			status.Session = SessionOpen
+		case res.EarlyHours:
+			status.Session = SessionPreMarket
+		case res.AfterHours:
+			status.Session = SessionAfterHours
+		default:
+			status.Session = SessionClosed
+		}
+	}
+	applyHoliday(status, holidays)
+	status.IsOpen = status.Session == SessionOpen
+
+	if payload, err := json.Marshal(status); err == nil {
+		if err := conn.Cache.Set(ctx, statusCacheKey, payload, statusCacheTTL).Err(); err != nil {
+			log.Printf("⚠️ market status cache write failed: %v", err)
+		}
+	}
+	return status, nil
+}
+
+// IsHoliday reports whether the market is fully closed for a holiday on the
+// calendar day of t (in ET)
+func IsHoliday(conn *data.Conn, t time.Time) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), polygonTimeout)
+	defer cancel()
+
+	holidays, err := getHolidays(ctx, conn)
+	if err != nil {
+		log.Printf("⚠️ market holidays unavailable: %v", err)
+		return false
+	}
+	day := t.In(easternLocation).Format("2006-01-02")
+	for _, h := range holidays {
+		if h.Date == day && h.Status == "closed" {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceHours returns the part of t's ET calendar day that market-hour
+// services run in: from the 4:00 AM pre-market open to the end of after-hours
+// at 8:00 PM, or four hours after the bell on early-close days. ok is false on
+// weekends and full holidays
+func ServiceHours(conn *data.Conn, t time.Time) (start, end time.Time, ok bool) {
+	day := t.In(easternLocation)
+	if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+		return time.Time{}, time.Time{}, false
+	}
+	start = time.Date(day.Year(), day.Month(), day.Day(), 4, 0, 0, 0, easternLocation)
+	end = time.Date(day.Year(), day.Month(), day.Day(), 20, 0, 0, 0, easternLocation)
+
+	ctx, cancel := context.WithTimeout(context.Background(), polygonTimeout)
+	defer cancel()
+	holidays, err := getHolidays(ctx, conn)
+	if err != nil {
+		log.Printf("⚠️ market holidays unavailable: %v", err)
+		return start, end, true
+	}
+	date := day.Format("2006-01-02")
+	for _, h := range holidays {
+		if h.Date != date {
+			continue
+		}
+		if h.Status == "closed" {
+			return time.Time{}, time.Time{}, false
+		}
+		if h.Status == "early-close" && h.Close != nil {
+			end = h.Close.In(easternLocation).Add(4 * time.Hour)
+		}
+	}
+	return start, end, true
+}
+
+// InServiceHours reports whether t falls within the ServiceHours of its day
+func InServiceHours(conn *data.Conn, t time.Time) bool {
+	start, end, ok := ServiceHours(conn, t)
+	return ok && !t.Before(start) && t.Before(end)
+}
+
+// applyHoliday marks today's holiday or early close on the status
+func applyHoliday(status *Status, holidays []Holiday) {
+	today := status.ServerTime.Format("2006-01-02")
+	for _, h := range holidays {
+		if h.Date != today {
+			continue
+		}
+		status.HolidayName = h.Name
+		if h.Status == "closed" {
+			status.Session = SessionHoliday
+			return
+		}
+		if h.Status == "early-close" {
+			status.EarlyClose = true
+			status.CloseTime = h.Close
+		}
+	}
+}
+
+// clockSession derives the session from regular US equity hours; it does not
+// know about holidays, which applyHoliday layers on top
+func clockSession(now time.Time) string {
+	if now.Weekday() == time.Saturday || now.Weekday() == time.Sunday {
+		return SessionClosed
+	}
+	minutes := now.Hour()*60 + now.Minute()
+	switch {
+	case minutes >= 4*60 && minutes < 9*60+30:
+		return SessionPreMarket
+	case minutes >= 9*60+30 && minutes < 16*60:
+		return SessionOpen
+	case minutes >= 16*60 && minutes < 20*60:
+		return SessionAfterHours
+	default:
+		return SessionClosed
+	}
+}
+
+// getHolidays returns upcoming NYSE closures, cached for holidaysCacheTTL
+func getHolidays(ctx context.Context, conn *data.Conn) ([]Holiday, error) {
+	if cached, err := conn.Cache.Get(ctx, holidaysCacheKey).Result(); err == nil {
+		var holidays []Holiday
+		if err := json.Unmarshal([]byte(cached), &holidays); err == nil {
+			return holidays, nil
+		}
+	}
+
+	res, err := conn.Polygon.GetMarketHolidays(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching market holidays: %w", err)
+	}
+	holidays := []Holiday{}
+	if res != nil {
+		for _, h := range *res {
+			// NYSE and NASDAQ share a calendar; keep one entry per date
+			if h.Exchange != "NYSE" {
+				continue
+			}
+			holiday := Holiday{
+				Date:     time.Time(h.Date).Format("2006-01-02"),
+				Name:     h.Name,
+				Status:   h.Status,
+				Exchange: h.Exchange,
+			}
+			if closeTime := time.Time(h.Close); !closeTime.IsZero() {
+				closeTime = closeTime.In(easternLocation)
+				holiday.Close = &closeTime
+			}
+			holidays = append(holidays, holiday)
+		}
+	}
+
+	if payload, err := json.Marshal(holidays); err == nil {
+		if err := conn.Cache.Set(ctx, holidaysCacheKey, payload, holidaysCacheTTL).Err(); err != nil {
+			log.Printf("⚠️ market holidays cache write failed: %v", err)
+		}
+	}
+	return holidays, nil
+}
+
+// GetMarketStatus is the public API handler returning the current market status
+func GetMarketStatus(conn *data.Conn, _ json.RawMessage) (interface{}, error) {
+	return Get(conn)
+}
+
+// AgentGetMarketStatus is the agent tool variant of GetMarketStatus
+func AgentGetMarketStatus(conn *data.Conn, _ int, _ json.RawMessage) (interface{}, error) {
+	return Get(conn)
+}
@@ -0,0 +1,153 @@
+// Package notices holds the system notice admins broadcast to every user:
+// maintenance windows, data delays and the like. The current notice is kept
+// in Redis for the banner the frontend polls, and goes out as a service notice
+// to every open socket when it is set. A notice declared as maintenance also
+// pauses non-critical alert notifications until it ends or is cleared.
+package notices
+
+import (
+	"backend/internal/data"
+	"backend/internal/services/socket"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Kind values for Notice.Kind
+const (
+	KindInfo        = "info"
+	KindMaintenance = "maintenance"
+	KindDataDelay   = "data_delay"
+)
+
+const (
+	noticeKey       = "system:notice"
+	redisOpTimeout  = 2 * time.Second
+	maxMessageBytes = 500
+
+	// openMaintenanceRecheck is how long work held for a maintenance window
+	// without an end time waits before checking again
+	openMaintenanceRecheck = 5 * time.Minute
+)
+
+// Notice is the system-wide banner
+type Notice struct {
+	ID          string `json:"id"`
+	Kind        string `json:"kind"`
+	Message     string `json:"message"`
+	Maintenance bool   `json:"maintenance"`        // pause non-critical alert notifications
+	StartsAt    int64  `json:"startsAt,omitempty"` // ms since epoch; shown ahead of time
+	EndsAt      int64  `json:"endsAt,omitempty"`   // ms since epoch; the notice clears itself
+	CreatedAt   int64  `json:"createdAt"`
+	CreatedBy   int    `json:"createdBy"`
+}
+
+// Validate checks an admin-submitted notice
+func (n *Notice) Validate() error {
+	switch n.Kind {
+	case KindInfo, KindMaintenance, KindDataDelay:
+	default:
+		return fmt.Errorf("kind must be %q, %q or %q", KindInfo, KindMaintenance, KindDataDelay)
+	}
+	if n.Message == "" {
+		return fmt.Errorf("message is required")
+	}
+	if len(n.Message) > maxMessageBytes {
+		return fmt.Errorf("message is over %d bytes", maxMessageBytes)
+	}
+	if n.EndsAt != 0 && n.EndsAt <= time.Now().UnixMilli() {
+		return fmt.Errorf("endsAt is in the past")
+	}
+	if n.StartsAt != 0 && n.EndsAt != 0 && n.StartsAt >= n.EndsAt {
+		return fmt.Errorf("startsAt must be before endsAt")
+	}
+	return nil
+}
+
+// Broadcast replaces the current notice and sends it to every connected user
+// as a service notice, a warning unless it is only informational
+func Broadcast(ctx context.Context, conn *data.Conn, n Notice) error {
+	raw, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	var ttl time.Duration
+	if n.EndsAt != 0 {
+		ttl = time.Until(time.UnixMilli(n.EndsAt))
+	}
+	if err := conn.Cache.Set(ctx, noticeKey, raw, ttl).Err(); err != nil {
+		return fmt.Errorf("error storing system notice: %v", err)
+	}
+	noticeType := "warning"
+	if n.Kind == KindInfo {
+		noticeType = "info"
+	}
+	if err := socket.PublishServiceNotice(ctx, conn, noticeType, n.Message); err != nil {
+		return fmt.Errorf("error publishing system notice: %v", err)
+	}
+	log.Printf("📢 System notice %s (%s) set by user %d: %s", n.ID, n.Kind, n.CreatedBy, n.Message)
+	return nil
+}
+
+// Clear removes the current notice; the banner goes away on the next poll
+func Clear(ctx context.Context, conn *data.Conn) error {
+	if err := conn.Cache.Del(ctx, noticeKey).Err(); err != nil {
+		return fmt.Errorf("error clearing system notice: %v", err)
+	}
+	log.Printf("📢 System notice cleared")
+	return nil
+}
+
+// Current returns the current notice, or nil if there is none
+func Current(ctx context.Context, conn *data.Conn) (*Notice, error) {
+	raw, err := conn.Cache.Get(ctx, noticeKey).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading system notice: %v", err)
+	}
+	var n Notice
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return nil, fmt.Errorf("error parsing system notice: %v", err)
+	}
+	return &n, nil
+}
+
+// InMaintenance reports whether a declared maintenance window is in effect.
+// Redis errors count as no maintenance so alerts are never lost to them.
+func InMaintenance(conn *data.Conn) bool {
+	return !MaintenanceEnd(conn).IsZero()
+}
+
+// MaintenanceEnd returns when the maintenance window in effect ends, or the
+// zero time outside one. A window without an end time is treated as ending a
+// few minutes from now, so whatever waits for it checks again then.
+func MaintenanceEnd(conn *data.Conn) time.Time {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	n, err := Current(ctx, conn)
+	if err != nil {
+		log.Printf("⚠️ %v", err)
+		return time.Time{}
+	}
+	now := time.Now()
+	if n == nil || !n.Maintenance || (n.StartsAt != 0 && now.UnixMilli() < n.StartsAt) {
+		return time.Time{}
+	}
+	if n.EndsAt == 0 {
+		return now.Add(openMaintenanceRecheck)
+	}
+	return time.UnixMilli(n.EndsAt)
+}
+
+// GetSystemNotice returns the banner for the frontend to poll
+func GetSystemNotice(conn *data.Conn, _ json.RawMessage) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	return Current(ctx, conn)
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"sync"
 	"time"
@@ -662,6 +663,87 @@ func (r *Renderer) RenderPlotNoWatermark(ctx context.Context, plotSpec interface
 	return r.RenderPlot(ctx, plotSpec, &config)
 }
 
+// RenderSVG rasterizes a standalone SVG document to PNG bytes at the given size
+func (r *Renderer) RenderSVG(ctx context.Context, svg string, width, height int) ([]byte, error) {
+	r.mu.RLock()
+	if r.closed {
+		r.mu.RUnlock()
+		return nil, fmt.Errorf("renderer is closed")
+	}
+	r.mu.RUnlock()
+
+	// Errors rather than panics, since the browser may be shared (see shared.go)
+	page, err := r.browser.Context(ctx).Page(proto.TargetCreateTarget{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open page: %w", err)
+	}
+	defer page.Close()
+	if err := page.SetViewport(&proto.EmulationSetDeviceMetricsOverride{Width: width, Height: height, DeviceScaleFactor: 1}); err != nil {
+		return nil, fmt.Errorf("failed to set viewport: %w", err)
+	}
+
+	if err := page.Navigate("about:blank"); err != nil {
+		return nil, fmt.Errorf("failed to navigate to blank page: %w", err)
+	}
+	doc := `<html><body style="margin:0;background:#121212"><div id="chart" style="width:` +
+		fmt.Sprint(width) + `px;height:` + fmt.Sprint(height) + `px">` + svg + `</div></body></html>`
+	if err := page.SetDocumentContent(doc); err != nil {
+		return nil, fmt.Errorf("failed to set document content: %w", err)
+	}
+	if err := page.WaitLoad(); err != nil {
+		return nil, fmt.Errorf("failed to load document: %w", err)
+	}
+
+	el, err := page.Element("#chart")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find chart element: %w", err)
+	}
+	png, err := el.Screenshot(proto.PageCaptureScreenshotFormatPng, 100)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture screenshot: %w", err)
+	}
+	return png, nil
+}
+
+// RenderPDF prints a standalone HTML document to a letter-sized PDF
+func (r *Renderer) RenderPDF(ctx context.Context, html string) ([]byte, error) {
+	r.mu.RLock()
+	if r.closed {
+		r.mu.RUnlock()
+		return nil, fmt.Errorf("renderer is closed")
+	}
+	r.mu.RUnlock()
+
+	page := r.browser.Context(ctx).MustPage()
+	defer page.MustClose()
+
+	if err := page.Navigate("about:blank"); err != nil {
+		return nil, fmt.Errorf("failed to navigate to blank page: %w", err)
+	}
+	if err := page.SetDocumentContent(html); err != nil {
+		return nil, fmt.Errorf("failed to set document content: %w", err)
+	}
+	page.MustWaitLoad()
+
+	margin := 0.4
+	stream, err := page.PDF(&proto.PagePrintToPDF{
+		PrintBackground: true,
+		MarginTop:       &margin,
+		MarginBottom:    &margin,
+		MarginLeft:      &margin,
+		MarginRight:     &margin,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to print PDF: %w", err)
+	}
+	defer stream.Close()
+	pdf, err := io.ReadAll(stream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+	return pdf, nil
+}
+
 // Close shuts down the renderer and browser
 func (r *Renderer) Close() error {
 	r.mu.Lock()
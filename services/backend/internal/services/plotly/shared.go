@@ -0,0 +1,81 @@
+package plotly
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Renders that come often and one at a time, like alert snapshots, share one
+// headless browser for the process instead of each launching Chromium. Each
+// render opens its own page in it, at most sharedMaxPages at once; the rest
+// wait. The browser is launched on first use and again once it's found dead.
+const sharedMaxPages = 4
+
+var (
+	sharedMu       sync.Mutex
+	sharedRenderer *Renderer
+	sharedPages    = make(chan struct{}, sharedMaxPages)
+)
+
+// WithShared runs render with the shared renderer. The renderer must not be
+// closed or kept past render.
+func WithShared(ctx context.Context, render func(*Renderer) error) error {
+	select {
+	case sharedPages <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-sharedPages }()
+
+	r, err := shared()
+	if err != nil {
+		return err
+	}
+	if err := render(r); err != nil {
+		if !r.alive() {
+			log.Printf("⚠️ Shared renderer's browser died, relaunching on next use: %v", err)
+			discardShared(r)
+		}
+		return err
+	}
+	return nil
+}
+
+func shared() (*Renderer, error) {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if sharedRenderer != nil {
+		return sharedRenderer, nil
+	}
+	r, err := New()
+	if err != nil {
+		return nil, fmt.Errorf("error starting shared renderer: %v", err)
+	}
+	sharedRenderer = r
+	return r, nil
+}
+
+// discardShared closes a dead shared renderer, unless it was already replaced
+func discardShared(r *Renderer) {
+	sharedMu.Lock()
+	if sharedRenderer == r {
+		sharedRenderer = nil
+	}
+	sharedMu.Unlock()
+	if err := r.Close(); err != nil {
+		log.Printf("warning: failed to close shared renderer: %v", err)
+	}
+}
+
+// alive reports whether the renderer's browser still answers
+func (r *Renderer) alive() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return false
+	}
+	_, err := r.browser.Pages()
+	return err == nil
+}
@@ -0,0 +1,40 @@
+package screener
+
+import (
+	"backend/internal/data"
+	"context"
+	"os"
+	"testing"
+)
+
+// Benchmarks of the screener refresh queries. They need a live database and
+// rewrite its screener tables, so they only run with BENCH_LIVE=true, pointed
+// at a staging copy.
+
+func benchRefresh(b *testing.B, query string, args ...interface{}) {
+	if os.Getenv("BENCH_LIVE") != "true" {
+		b.Skip("set BENCH_LIVE=true to run against a staging database")
+	}
+	conn, cleanup := data.InitConn(os.Getenv("IN_CONTAINER") == "true")
+	b.Cleanup(cleanup)
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := conn.DB.Exec(ctx, query, args...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScreenerRefresh(b *testing.B) {
+	benchRefresh(b, refreshScreenerQuery, maxTickersPerBatch)
+}
+
+func BenchmarkStaticRefs1mRefresh(b *testing.B) {
+	benchRefresh(b, refreshStaticRefs1mQuery)
+}
+
+func BenchmarkLatestBarViewsRefresh(b *testing.B) {
+	benchRefresh(b, "SELECT refresh_latest_bar_views()")
+}
@@ -23,7 +23,10 @@ OPTIMIZATION LOG: -- baseline 3s for 1 ticker
 package screener
 
 import (
+	screenerapp "backend/internal/app/screener"
+	"backend/internal/breaker"
 	"backend/internal/data"
+	"backend/internal/services/marketstatus"
 	"context" // Added fmt import
 	"fmt"
 	"log"
@@ -192,6 +195,11 @@ func (s *UpdaterService) runUpdaterLoop() {
 			return
 
 		case <-screenerTicker.C:
+			// Refreshes are optional load; pause them while Postgres is degraded
+			if !breaker.Postgres.Healthy() {
+				log.Printf("⚠️ Skipping screener refresh: postgres is degraded")
+				continue
+			}
 			updateStart := time.Now()
 			updateStaleScreenerValues(s.conn)
 			updateDuration := time.Since(updateStart)
@@ -205,20 +213,20 @@ func (s *UpdaterService) runUpdaterLoop() {
 			}
 
 		case <-staticRefs1mTicker.C:
-			// Refresh static_refs_1m every minute during market hours (4am-8pm ET, weekdays)
-			if isMarketHours(time.Now(), s.loc) {
+			// Refresh static_refs_1m every minute during market service hours (4am-8pm ET on trading days)
+			if marketstatus.InServiceHours(s.conn, time.Now()) && breaker.Postgres.Healthy() {
 				go refreshStaticRefs1m(s.conn)
 			}
 
 		case <-staticRefsDailyTicker.C:
 			// Refresh static_refs every 5 minutes during regular market hours (9:30am-4pm ET, weekdays)
-			if isRegularMarketHours(time.Now(), s.loc) {
+			if isRegularMarketHours(time.Now(), s.loc) && breaker.Postgres.Healthy() {
 				go refreshStaticRefsDaily(s.conn)
 			}
 
 		case <-latestBarViewsTicker.C:
 			// Refresh latest bar materialized views every 30 seconds (CRITICAL for screener performance)
-			if isMarketHours(time.Now(), s.loc) {
+			if marketstatus.InServiceHours(s.conn, time.Now()) && breaker.Postgres.Healthy() {
 				go refreshLatestBarViews(s.conn)
 			}
 		}
@@ -356,8 +364,8 @@ func updateStaleScreenerValues(conn *data.Conn) {
 	//log.Printf("🔄 Updating screener values (timeout: %v)...", refreshTimeout)
 	start := time.Now()
 
-	// Execute the main query
-	_, err := conn.DB.Exec(ctx, refreshScreenerQuery, maxTickersPerBatch)
+	// Refresh the stale tickers shard by shard
+	run, err := refreshScreenerSharded(ctx, conn)
 
 	duration := time.Since(start)
 
@@ -365,10 +373,16 @@ func updateStaleScreenerValues(conn *data.Conn) {
 		log.Printf("❌ updateStaleScreenerValues: failed to refresh screener data: %v", err)
 		log.Printf("🔄 updateStaleScreenerValues: %v (failed)", duration)
 
-		return
+		if run == nil || run.Tickers == 0 {
+			return
+		}
+		// The shards that succeeded still refreshed their rows
+	} else {
+		log.Printf("✅ Screener refresh of %d tickers in %d shards completed successfully in %v", run.Tickers, run.Shards, duration)
 	}
 
-	log.Printf("✅ Screener refresh completed successfully in %v", duration)
+	// Recompute user-defined columns against the freshly refreshed rows
+	screenerapp.RefreshComputedColumns(conn)
 
 	// Only run detailed analysis if the operation took too long
 	/*if useAnalysis {
@@ -382,6 +396,27 @@ func updateStaleScreenerValues(conn *data.Conn) {
 	log.Printf("🔄 updateStaleScreenerValues: %v", duration)
 }
 
+// RefreshTicker recomputes one ticker's screener row now. The ticker is
+// marked stale as the oldest of them and a one-ticker refresh picks it up; it
+// reports false when a refresh already in progress held the ticker, which
+// then leaves it for the next cycle.
+func RefreshTicker(ctx context.Context, conn *data.Conn, ticker string) (bool, error) {
+	if _, err := conn.DB.Exec(ctx, `
+		INSERT INTO screener_stale (ticker, stale, last_update_time)
+		VALUES ($1, TRUE, '-infinity')
+		ON CONFLICT (ticker) DO UPDATE SET stale = TRUE, last_update_time = '-infinity'`, ticker); err != nil {
+		return false, fmt.Errorf("error marking %s stale: %v", ticker, err)
+	}
+	if _, err := conn.DB.Exec(ctx, `SELECT refresh_screener_shard(1, 0, 1)`); err != nil {
+		return false, fmt.Errorf("error refreshing screener row of %s: %v", ticker, err)
+	}
+	var stale bool
+	if err := conn.DB.QueryRow(ctx, `SELECT stale FROM screener_stale WHERE ticker = $1`, ticker).Scan(&stale); err != nil {
+		return false, fmt.Errorf("error checking screener row of %s: %v", ticker, err)
+	}
+	return !stale, nil
+}
+
 // refreshStaticRefs1m refreshes the static_refs_1m table
 func refreshStaticRefs1m(conn *data.Conn) {
 	if !oneMinStaticRefsMu.TryLock() {
@@ -510,21 +545,6 @@ func refreshExtendedHoursCagg(conn *data.Conn) {
 	log.Printf("✅ cagg_extended_hours refresh completed in %v", duration)
 }
 
-// isMarketHours checks if current time is within market hours (4am-8pm ET on weekdays)
-func isMarketHours(now time.Time, loc *time.Location) bool {
-	nowET := now.In(loc)
-	weekday := nowET.Weekday()
-
-	// Only weekdays (Monday-Friday)
-	if weekday == time.Saturday || weekday == time.Sunday {
-		return false
-	}
-
-	hour := nowET.Hour()
-	// 4am to 8pm ET
-	return hour >= 4 && hour < 20
-}
-
 // isRegularMarketHours checks if current time is within regular market hours (9:30am-4pm ET on weekdays)
 func isRegularMarketHours(now time.Time, loc *time.Location) bool {
 	nowET := now.In(loc)
@@ -0,0 +1,215 @@
+package screener
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Sharded screener refresh. The stale tickers are split by a hash of the
+// ticker into shards (refresh_screener_shard, migration 128) and every shard
+// is refreshed by its own task on its own connection. A coordinator runs the
+// shards of one refresh, retries the ones that fail while the others' work
+// stands, and records each shard's progress in Redis so a refresh can be
+// followed with jobctl screener-shards.
+const (
+	defaultScreenerShards = 4
+	maxScreenerShards     = 16 // each shard holds a pool connection for its whole refresh
+	shardMaxAttempts      = 3
+	shardRetryDelay       = 5 * time.Second
+	shardProgressKey      = "screener:refresh:shards"
+	shardProgressTTL      = 24 * time.Hour
+)
+
+// Shard and refresh statuses
+const (
+	ShardRunning = "running"
+	ShardDone    = "done"
+	ShardFailed  = "failed"
+)
+
+// ShardProgress is where one shard of a sharded refresh is
+type ShardProgress struct {
+	Shard      int        `json:"shard"`
+	Status     string     `json:"status"`
+	Attempts   int        `json:"attempts"`
+	Tickers    int        `json:"tickers"` // refreshed so far
+	Error      string     `json:"error,omitempty"`
+	Duration   string     `json:"duration,omitempty"` // of the last attempt
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// ShardedRefresh is one refresh of every shard
+type ShardedRefresh struct {
+	Shards     int             `json:"shards"`
+	Status     string          `json:"status"`
+	Tickers    int             `json:"tickers"`
+	StartedAt  time.Time       `json:"startedAt"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+	Progress   []ShardProgress `json:"progress"`
+}
+
+// screenerShardCount is the number of shards a refresh uses
+// (SCREENER_REFRESH_SHARDS, 1 refreshes everything in one stream)
+func screenerShardCount() int {
+	n, err := strconv.Atoi(os.Getenv("SCREENER_REFRESH_SHARDS"))
+	if err != nil || n < 1 {
+		return defaultScreenerShards
+	}
+	if n > maxScreenerShards {
+		return maxScreenerShards
+	}
+	return n
+}
+
+// shardCoordinator tracks one sharded refresh
+type shardCoordinator struct {
+	conn *data.Conn
+	mu   sync.Mutex
+	run  ShardedRefresh
+}
+
+// refreshScreenerSharded refreshes the stale screener tickers shard by shard
+// in parallel. Shards that fail are retried up to shardMaxAttempts times; the
+// error lists the shards that never succeeded, whose tickers stay stale for
+// the next refresh.
+func refreshScreenerSharded(ctx context.Context, conn *data.Conn) (*ShardedRefresh, error) {
+	shards := screenerShardCount()
+	c := &shardCoordinator{conn: conn, run: ShardedRefresh{
+		Shards:    shards,
+		Status:    ShardRunning,
+		StartedAt: time.Now(),
+		Progress:  make([]ShardProgress, shards),
+	}}
+	pending := make([]int, shards)
+	for i := range pending {
+		pending[i] = i
+		c.run.Progress[i] = ShardProgress{Shard: i, Status: ShardRunning}
+	}
+	c.publish(ctx)
+
+	for attempt := 1; attempt <= shardMaxAttempts && len(pending) > 0; attempt++ {
+		if attempt > 1 {
+			log.Printf("🔁 Retrying screener shards %v (attempt %d/%d)", pending, attempt, shardMaxAttempts)
+			select {
+			case <-ctx.Done():
+			case <-time.After(shardRetryDelay):
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		var wg sync.WaitGroup
+		for _, shard := range pending {
+			wg.Add(1)
+			go func(shard int) {
+				defer wg.Done()
+				c.refreshShard(ctx, shard)
+			}(shard)
+		}
+		wg.Wait()
+		pending = c.failedShards()
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	c.run.FinishedAt = &now
+	c.run.Status = ShardDone
+	if len(pending) > 0 {
+		c.run.Status = ShardFailed
+	}
+	run := c.run
+	c.mu.Unlock()
+	c.publish(ctx)
+	if len(pending) > 0 {
+		return &run, fmt.Errorf("screener shards %v of %d failed after %d attempts", pending, shards, shardMaxAttempts)
+	}
+	return &run, nil
+}
+
+// refreshShard runs one attempt at one shard
+func (c *shardCoordinator) refreshShard(ctx context.Context, shard int) {
+	c.mu.Lock()
+	p := &c.run.Progress[shard]
+	p.Status = ShardRunning
+	p.Attempts++
+	c.mu.Unlock()
+
+	start := time.Now()
+	var tickers int
+	err := c.conn.DB.QueryRow(ctx, `SELECT refresh_screener_shard($1, $2, $3)`,
+		maxTickersPerBatch, shard, c.run.Shards).Scan(&tickers)
+	now := time.Now()
+
+	c.mu.Lock()
+	p.Duration = now.Sub(start).Round(time.Millisecond).String()
+	if err != nil {
+		p.Status = ShardFailed
+		p.Error = err.Error()
+		log.Printf("❌ Screener shard %d/%d failed after %s: %v", shard, c.run.Shards, p.Duration, err)
+	} else {
+		p.Status = ShardDone
+		p.Error = ""
+		p.Tickers += tickers
+		p.FinishedAt = &now
+		c.run.Tickers += tickers
+	}
+	c.mu.Unlock()
+	c.publish(ctx)
+}
+
+func (c *shardCoordinator) failedShards() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var failed []int
+	for _, p := range c.run.Progress {
+		if p.Status == ShardFailed {
+			failed = append(failed, p.Shard)
+		}
+	}
+	return failed
+}
+
+// publish records the refresh's progress in Redis; it is only for watching,
+// so failures are logged and the refresh goes on
+func (c *shardCoordinator) publish(ctx context.Context) {
+	if c.conn.Cache == nil {
+		return
+	}
+	c.mu.Lock()
+	payload, err := json.Marshal(c.run)
+	c.mu.Unlock()
+	if err != nil {
+		return
+	}
+	if err := c.conn.Cache.Set(ctx, shardProgressKey, payload, shardProgressTTL).Err(); err != nil {
+		log.Printf("⚠️ Publishing screener shard progress: %v", err)
+	}
+}
+
+// LastShardedRefresh returns the current or most recent sharded refresh, or
+// nil when none ran in the last day
+func LastShardedRefresh(ctx context.Context, conn *data.Conn) (*ShardedRefresh, error) {
+	payload, err := conn.Cache.Get(ctx, shardProgressKey).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading screener shard progress: %v", err)
+	}
+	var run ShardedRefresh
+	if err := json.Unmarshal(payload, &run); err != nil {
+		return nil, fmt.Errorf("error decoding screener shard progress: %v", err)
+	}
+	sort.Slice(run.Progress, func(i, j int) bool { return run.Progress[i].Shard < run.Progress[j].Shard })
+	return &run, nil
+}
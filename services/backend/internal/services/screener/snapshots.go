@@ -0,0 +1,37 @@
+package screener
+
+import (
+	screenerapp "backend/internal/app/screener"
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const snapshotTimeout = 5 * time.Minute
+
+// TakeScreenerSnapshot copies the current screener table into
+// screener_snapshots under today's (ET) date. Re-running on the same day
+// overwrites that day's snapshot.
+func TakeScreenerSnapshot(conn *data.Conn) error {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return fmt.Errorf("loading ET timezone: %w", err)
+	}
+	now := time.Now().In(loc)
+	snapshotDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+
+	start := time.Now()
+	result, err := conn.DB.Exec(ctx, screenerapp.SnapshotInsertQuery(), snapshotDate)
+	if err != nil {
+		return fmt.Errorf("inserting screener snapshot: %w", err)
+	}
+
+	log.Printf("✅ Screener snapshot for %s stored (%d rows) in %v",
+		snapshotDate.Format("2006-01-02"), result.RowsAffected(), time.Since(start))
+	return nil
+}
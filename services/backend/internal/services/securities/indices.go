@@ -0,0 +1,356 @@
+package securities
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Index constituents are kept point in time in index_constituents: each sync
+// closes the rows of tickers that left an index and opens rows for tickers
+// that joined, dated the day the change was seen. History before the first
+// sync can be loaded from a file with `jobctl index-constituents import`.
+
+// IndexInfo describes a tracked index
+type IndexInfo struct {
+	Symbol string   `json:"symbol"`
+	Name   string   `json:"name"`
+	ETFs   []string `json:"etfs"` // ETFs tracking the index, accepted as aliases
+	// sourceEnv names the env var holding the URL of a constituents CSV
+	sourceEnv     string
+	defaultSource string
+}
+
+// TrackedIndices lists the indices whose constituents are ingested
+var TrackedIndices = []IndexInfo{
+	{
+		Symbol:        "SPX",
+		Name:          "S&P 500",
+		ETFs:          []string{"SPY", "IVV", "VOO"},
+		sourceEnv:     "INDEX_SOURCE_SPX",
+		defaultSource: "https://raw.githubusercontent.com/datasets/s-and-p-500-companies/main/data/constituents.csv",
+	},
+	{
+		Symbol:    "NDX",
+		Name:      "Nasdaq 100",
+		ETFs:      []string{"QQQ", "QQQM"},
+		sourceEnv: "INDEX_SOURCE_NDX",
+	},
+}
+
+// a sync that would drop more than this share of an index is assumed to be a
+// bad download and refused
+const maxIndexShrink = 0.2
+
+// Constituent is one ticker of a constituents file
+type Constituent struct {
+	Ticker string
+	Weight *float64
+}
+
+// NormalizeIndexSymbol maps an index symbol, name or tracking ETF (SPX, S&P 500,
+// SPY, NDX, QQQ...) to the tracked index symbol
+func NormalizeIndexSymbol(s string) (string, bool) {
+	key := strings.ToUpper(strings.NewReplacer(" ", "", "&", "", "-", "", "^", "").Replace(s))
+	for _, idx := range TrackedIndices {
+		name := strings.ToUpper(strings.NewReplacer(" ", "", "&", "").Replace(idx.Name))
+		if key == idx.Symbol || key == name {
+			return idx.Symbol, true
+		}
+		for _, etf := range idx.ETFs {
+			if key == etf {
+				return idx.Symbol, true
+			}
+		}
+	}
+	switch key {
+	case "SP500", "GSPC":
+		return "SPX", true
+	case "NASDAQ100", "NDX100":
+		return "NDX", true
+	}
+	return "", false
+}
+
+// UpdateIndexConstituents syncs every index that has a constituents source
+// configured. An index that fails is logged and the others still sync.
+func UpdateIndexConstituents(conn *data.Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	today := IndexDate()
+
+	var failed []string
+	for _, idx := range TrackedIndices {
+		source := os.Getenv(idx.sourceEnv)
+		if source == "" {
+			source = idx.defaultSource
+		}
+		if source == "" {
+			continue
+		}
+		constituents, err := fetchConstituents(ctx, source)
+		if err != nil {
+			log.Printf("⚠️ Index constituents: error fetching %s: %v", idx.Symbol, err)
+			failed = append(failed, idx.Symbol)
+			continue
+		}
+		added, removed, err := ApplyIndexConstituents(ctx, conn, idx.Symbol, constituents, today, source, false)
+		if err != nil {
+			log.Printf("⚠️ Index constituents: error applying %s: %v", idx.Symbol, err)
+			failed = append(failed, idx.Symbol)
+			continue
+		}
+		log.Printf("✅ Index constituents: %s has %d members (+%d, -%d)", idx.Symbol, len(constituents), added, removed)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("index constituent sync failed for %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// IndexDate returns today's date in ET, the date memberships are looked up for
+// when no date is given
+func IndexDate() time.Time {
+	now := time.Now().In(easternLocation())
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func easternLocation() *time.Location {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func fetchConstituents(ctx context.Context, url string) ([]Constituent, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := data.DoWithRetry(http.DefaultClient, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return ParseConstituentsCSV(resp.Body)
+}
+
+// ParseConstituentsCSV reads a constituents CSV. The ticker is taken from a
+// Symbol, Ticker or Holding Ticker column and the weight from an optional
+// Weight column; issuer files with preamble lines before the header work too.
+func ParseConstituentsCSV(r io.Reader) ([]Constituent, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	tickerCol, weightCol := -1, -1
+	seen := make(map[string]bool)
+	var out []Constituent
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading constituents: %v", err)
+		}
+		if tickerCol < 0 {
+			for i, h := range record {
+				switch strings.ToLower(strings.TrimSpace(h)) {
+				case "symbol", "ticker", "holding ticker":
+					tickerCol = i
+				case "weight", "weight (%)", "% weight":
+					weightCol = i
+				}
+			}
+			continue
+		}
+		if tickerCol >= len(record) {
+			continue
+		}
+		ticker := strings.ToUpper(strings.TrimSpace(record[tickerCol]))
+		// Share classes are written BRK-B or BRK/B by some sources
+		ticker = strings.NewReplacer("-", ".", "/", ".").Replace(ticker)
+		if ticker == "" || strings.ContainsAny(ticker, " $") || seen[ticker] {
+			continue
+		}
+		seen[ticker] = true
+		c := Constituent{Ticker: ticker}
+		if weightCol >= 0 && weightCol < len(record) {
+			if w, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(record[weightCol]), "%"), 64); err == nil {
+				c.Weight = &w
+			}
+		}
+		out = append(out, c)
+	}
+	if tickerCol < 0 {
+		return nil, fmt.Errorf("no Symbol or Ticker column found")
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no constituents found")
+	}
+	return out, nil
+}
+
+// ApplyIndexConstituents makes constituents the membership of index as of the
+// given date: members that aren't listed any more are closed on that date and
+// new ones are opened. The date can't be earlier than the index's latest
+// recorded change. Unless force is set, a list that would drop more than a
+// fifth of the current members is refused.
+func ApplyIndexConstituents(ctx context.Context, conn *data.Conn, index string, constituents []Constituent, asOf time.Time, source string, force bool) (added, removed int, err error) {
+	tx, err := conn.DB.Begin(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Serialise syncs of the same index
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('index_constituents:' || $1))`, index); err != nil {
+		return 0, 0, fmt.Errorf("error locking index %s: %v", index, err)
+	}
+
+	var latest *time.Time
+	if err := tx.QueryRow(ctx, `
+		SELECT max(GREATEST(effective_from, COALESCE(effective_to, effective_from)))
+		FROM index_constituents WHERE index_symbol = $1`, index).Scan(&latest); err != nil {
+		return 0, 0, fmt.Errorf("error loading latest change of %s: %v", index, err)
+	}
+	if latest != nil && asOf.Before(*latest) {
+		return 0, 0, fmt.Errorf("%s already has changes up to %s; constituents can't be applied as of %s",
+			index, latest.Format("2006-01-02"), asOf.Format("2006-01-02"))
+	}
+
+	rows, err := tx.Query(ctx, `SELECT ticker FROM index_constituents WHERE index_symbol = $1 AND effective_to IS NULL`, index)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error loading current members of %s: %v", index, err)
+	}
+	current := make(map[string]bool)
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("error scanning member: %v", err)
+		}
+		current[t] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	incoming := make(map[string]Constituent, len(constituents))
+	for _, c := range constituents {
+		incoming[c.Ticker] = c
+	}
+	var leaving []string
+	for t := range current {
+		if _, ok := incoming[t]; !ok {
+			leaving = append(leaving, t)
+		}
+	}
+	if !force && len(current) > 0 && float64(len(leaving)) > maxIndexShrink*float64(len(current)) {
+		return 0, 0, fmt.Errorf("%s would lose %d of %d members; refusing without force", index, len(leaving), len(current))
+	}
+
+	date := asOf.Format("2006-01-02")
+	if len(leaving) > 0 {
+		sort.Strings(leaving)
+		tag, err := tx.Exec(ctx, `
+			UPDATE index_constituents SET effective_to = $3::date
+			WHERE index_symbol = $1 AND effective_to IS NULL AND ticker = ANY($2)
+			  AND effective_from < $3::date`, index, leaving, date)
+		if err != nil {
+			return 0, 0, fmt.Errorf("error closing members of %s: %v", index, err)
+		}
+		removed = int(tag.RowsAffected())
+		// A member that joined on this same date never really was one
+		if _, err := tx.Exec(ctx, `
+			DELETE FROM index_constituents
+			WHERE index_symbol = $1 AND effective_to IS NULL AND ticker = ANY($2) AND effective_from = $3::date`,
+			index, leaving, date); err != nil {
+			return 0, 0, fmt.Errorf("error removing members of %s: %v", index, err)
+		}
+	}
+
+	for _, c := range constituents {
+		if current[c.Ticker] {
+			if c.Weight != nil {
+				if _, err := tx.Exec(ctx, `
+					UPDATE index_constituents SET weight = $3
+					WHERE index_symbol = $1 AND ticker = $2 AND effective_to IS NULL`, index, c.Ticker, *c.Weight); err != nil {
+					return 0, 0, fmt.Errorf("error updating weight of %s: %v", c.Ticker, err)
+				}
+			}
+			continue
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO index_constituents (index_symbol, ticker, securityid, weight, effective_from, source)
+			VALUES ($1, $2, (SELECT securityid FROM securities WHERE ticker = $2 AND maxdate IS NULL LIMIT 1), $3, $4::date, $5)
+			ON CONFLICT (index_symbol, ticker, effective_from) DO UPDATE SET effective_to = NULL, weight = EXCLUDED.weight`,
+			index, c.Ticker, c.Weight, date, source); err != nil {
+			return 0, 0, fmt.Errorf("error adding %s to %s: %v", c.Ticker, index, err)
+		}
+		added++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("error committing constituents of %s: %v", index, err)
+	}
+	return added, removed, nil
+}
+
+// IndexMembers returns the tickers in an index on the given date
+func IndexMembers(ctx context.Context, conn *data.Conn, index string, date time.Time) ([]string, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT ticker FROM index_constituents
+		WHERE index_symbol = $1 AND effective_from <= $2::date
+		  AND (effective_to IS NULL OR effective_to > $2::date)
+		ORDER BY ticker`, index, date.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("error loading members of %s: %v", index, err)
+	}
+	defer rows.Close()
+	var tickers []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, fmt.Errorf("error scanning member: %v", err)
+		}
+		tickers = append(tickers, t)
+	}
+	return tickers, rows.Err()
+}
+
+// IndexMemberships returns the indices a ticker belonged to on the given date
+func IndexMemberships(ctx context.Context, conn *data.Conn, ticker string, date time.Time) ([]string, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT DISTINCT index_symbol FROM index_constituents
+		WHERE ticker = $1 AND effective_from <= $2::date
+		  AND (effective_to IS NULL OR effective_to > $2::date)
+		ORDER BY index_symbol`, ticker, date.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("error loading index memberships of %s: %v", ticker, err)
+	}
+	defer rows.Close()
+	indices := []string{}
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, fmt.Errorf("error scanning membership: %v", err)
+		}
+		indices = append(indices, s)
+	}
+	return indices, rows.Err()
+}
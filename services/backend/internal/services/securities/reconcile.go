@@ -0,0 +1,417 @@
+package securities
+
+import (
+	"backend/internal/data"
+	"backend/internal/data/polygon"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/polygon-io/client-go/rest/models"
+)
+
+// The reconciliation compares the active rows of the securities table with
+// Polygon's reference data. Attribute drift on a matched ticker (exchange,
+// name, CIK, missing FIGI, share counts) is applied and logged to
+// security_changes; identity changes (new listings, ticker changes,
+// delistings, conflicting FIGIs) are only reported, since
+// SimpleUpdateSecuritiesV2 owns those and anything it left behind needs a look.
+const (
+	// share counts move a little every filing; smaller changes are ignored
+	reconcileShareChangeMin = 0.01
+	reconcileDetailsRate    = 100 * time.Millisecond
+)
+
+// Kinds of security_changes rows
+const (
+	ChangeNewListing   = "new_listing"
+	ChangeTickerChange = "ticker_change"
+	ChangeDelisting    = "delisting"
+	ChangeExchangeMove = "exchange_move"
+	ChangeName         = "name"
+	ChangeCIK          = "cik"
+	ChangeFIGI         = "figi"
+	ChangeShares       = "shares"
+)
+
+// ReconcileOptions controls a reconciliation run
+type ReconcileOptions struct {
+	DryRun bool // record what would change without updating securities
+	// SkipShares skips the per-ticker details requests share counts need
+	SkipShares bool
+}
+
+// SecurityChange is one difference found by a reconciliation
+type SecurityChange struct {
+	SecurityID int
+	Ticker     string
+	Kind       string
+	Old        string
+	New        string
+	Applied    bool
+}
+
+// ReconcileSummary is the result of a reconciliation run
+type ReconcileSummary struct {
+	RunID          int
+	PolygonTickers int
+	Active         int
+	Applied        []SecurityChange
+	Discrepancies  []SecurityChange
+}
+
+// AlertText summarises the discrepancies of a run for an internal alert
+func (s *ReconcileSummary) AlertText() string {
+	counts := make(map[string]int)
+	for _, c := range s.Discrepancies {
+		counts[c.Kind]++
+	}
+	kinds := make([]string, 0, len(counts))
+	for kind, n := range counts {
+		kinds = append(kinds, fmt.Sprintf("%s %d", kind, n))
+	}
+	sort.Strings(kinds)
+	var b strings.Builder
+	fmt.Fprintf(&b, "Security reconciliation run %d: %d updates applied, %d discrepancies (%s)",
+		s.RunID, len(s.Applied), len(s.Discrepancies), strings.Join(kinds, ", "))
+	for i, c := range s.Discrepancies {
+		if i == 10 {
+			fmt.Fprintf(&b, "\n…and %d more (jobctl securities-reconcile report %d)", len(s.Discrepancies)-i, s.RunID)
+			break
+		}
+		fmt.Fprintf(&b, "\n%s %s: %q → %q", c.Ticker, c.Kind, c.Old, c.New)
+	}
+	return b.String()
+}
+
+type dbSecurity struct {
+	securityID int
+	ticker     string
+	figi       string
+	name       string
+	exchange   string
+	cik        *int64
+	shareClass *int64
+	weighted   *int64
+}
+
+// RunSecurityReconciliation compares the securities table with Polygon and
+// records every difference under a new run
+func RunSecurityReconciliation(conn *data.Conn, opts ReconcileOptions) (*ReconcileSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Minute)
+	defer cancel()
+
+	var runID int
+	if err := conn.DB.QueryRow(ctx, `INSERT INTO security_reconciliation_runs (dry_run) VALUES ($1) RETURNING id`,
+		opts.DryRun).Scan(&runID); err != nil {
+		return nil, fmt.Errorf("error starting reconciliation run: %v", err)
+	}
+	summary, err := reconcile(ctx, conn, runID, opts)
+	finish := `UPDATE security_reconciliation_runs SET finished_at = NOW(), error = $2 WHERE id = $1`
+	if err != nil {
+		if _, uerr := conn.DB.Exec(context.Background(), finish, runID, err.Error()); uerr != nil {
+			log.Printf("⚠️ Reconciliation run %d: error recording failure: %v", runID, uerr)
+		}
+		return nil, err
+	}
+	if _, err := conn.DB.Exec(ctx, `
+		UPDATE security_reconciliation_runs
+		SET finished_at = NOW(), polygon_tickers = $2, active_securities = $3, applied = $4, discrepancies = $5
+		WHERE id = $1`, runID, summary.PolygonTickers, summary.Active, len(summary.Applied), len(summary.Discrepancies)); err != nil {
+		return nil, fmt.Errorf("error finishing reconciliation run: %v", err)
+	}
+	log.Printf("✅ Security reconciliation run %d: %d Polygon tickers, %d active securities, %d applied, %d discrepancies",
+		runID, summary.PolygonTickers, summary.Active, len(summary.Applied), len(summary.Discrepancies))
+	return summary, nil
+}
+
+func reconcile(ctx context.Context, conn *data.Conn, runID int, opts ReconcileOptions) (*ReconcileSummary, error) {
+	reference, err := polygonReference(conn)
+	if err != nil {
+		return nil, err
+	}
+	active, err := activeSecurities(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	// Polygon's list is paginated; a short read would make most of the table
+	// look delisted
+	if len(active) > 0 && len(reference) < len(active)/2 {
+		return nil, fmt.Errorf("polygon returned %d tickers for %d active securities, refusing to reconcile", len(reference), len(active))
+	}
+	summary := &ReconcileSummary{RunID: runID, PolygonTickers: len(reference), Active: len(active)}
+
+	byFIGI := make(map[string]*dbSecurity)
+	for _, s := range active {
+		if s.figi != "" {
+			byFIGI[s.figi] = s
+		}
+	}
+	var changes []SecurityChange
+	for ticker, ref := range reference {
+		sec, ok := active[ticker]
+		if !ok {
+			if other := byFIGI[ref.CompositeFIGI]; ref.CompositeFIGI != "" && other != nil {
+				changes = append(changes, SecurityChange{SecurityID: other.securityID, Ticker: other.ticker, Kind: ChangeTickerChange, Old: other.ticker, New: ticker})
+			} else {
+				changes = append(changes, SecurityChange{Ticker: ticker, Kind: ChangeNewListing, New: ref.Name})
+			}
+			continue
+		}
+		changes = append(changes, attributeChanges(sec, ref)...)
+	}
+	for ticker, sec := range active {
+		if _, ok := reference[ticker]; ok {
+			continue
+		}
+		if hasTickerChange(changes, sec.securityID) {
+			continue
+		}
+		changes = append(changes, SecurityChange{SecurityID: sec.securityID, Ticker: ticker, Kind: ChangeDelisting, Old: ticker})
+	}
+
+	if !opts.SkipShares {
+		shareChanges, err := shareCountChanges(ctx, conn, active, reference)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, shareChanges...)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Ticker != changes[j].Ticker {
+			return changes[i].Ticker < changes[j].Ticker
+		}
+		return changes[i].Kind < changes[j].Kind
+	})
+	for i := range changes {
+		c := &changes[i]
+		if autoApplied(*c) && !opts.DryRun {
+			if err := applySecurityChange(ctx, conn, *c); err != nil {
+				log.Printf("⚠️ Reconciliation: error applying %s change to %s: %v", c.Kind, c.Ticker, err)
+			} else {
+				c.Applied = true
+			}
+		}
+		if err := recordSecurityChange(ctx, conn, runID, *c); err != nil {
+			return nil, err
+		}
+		if c.Applied {
+			summary.Applied = append(summary.Applied, *c)
+		} else if !autoApplied(*c) {
+			summary.Discrepancies = append(summary.Discrepancies, *c)
+		}
+	}
+	return summary, nil
+}
+
+// polygonReference returns Polygon's active stock tickers keyed by ticker
+func polygonReference(conn *data.Conn) (map[string]models.Ticker, error) {
+	iter, err := polygon.ListTickers(conn.Polygon, "", time.Now().Format(time.DateOnly), models.GT, 1000, true)
+	if err != nil {
+		return nil, fmt.Errorf("error listing Polygon tickers: %v", err)
+	}
+	out := make(map[string]models.Ticker)
+	for iter.Next() {
+		t := iter.Item()
+		out[t.Ticker] = t
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("error listing Polygon tickers: %v", err)
+	}
+	return out, nil
+}
+
+func activeSecurities(ctx context.Context, conn *data.Conn) (map[string]*dbSecurity, error) {
+	rows, err := conn.DB.Query(ctx, `
+		SELECT securityid, ticker, COALESCE(figi, ''), COALESCE(name, ''), COALESCE(primary_exchange, ''),
+		       cik, share_class_shares_outstanding, weighted_shares_outstanding
+		FROM securities WHERE maxdate IS NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("error loading active securities: %v", err)
+	}
+	defer rows.Close()
+	out := make(map[string]*dbSecurity)
+	for rows.Next() {
+		s := &dbSecurity{}
+		if err := rows.Scan(&s.securityID, &s.ticker, &s.figi, &s.name, &s.exchange, &s.cik, &s.shareClass, &s.weighted); err != nil {
+			return nil, fmt.Errorf("error scanning security: %v", err)
+		}
+		out[s.ticker] = s
+	}
+	return out, rows.Err()
+}
+
+func attributeChanges(sec *dbSecurity, ref models.Ticker) []SecurityChange {
+	var out []SecurityChange
+	add := func(kind, oldValue, newValue string) {
+		out = append(out, SecurityChange{SecurityID: sec.securityID, Ticker: sec.ticker, Kind: kind, Old: oldValue, New: newValue})
+	}
+	if ref.PrimaryExchange != "" && ref.PrimaryExchange != sec.exchange {
+		add(ChangeExchangeMove, sec.exchange, ref.PrimaryExchange)
+	}
+	if ref.Name != "" && ref.Name != sec.name {
+		add(ChangeName, sec.name, ref.Name)
+	}
+	if ref.CIK != "" {
+		if cik, err := strconv.ParseInt(ref.CIK, 10, 64); err == nil && (sec.cik == nil || *sec.cik != cik) {
+			add(ChangeCIK, formatOptional(sec.cik), strconv.FormatInt(cik, 10))
+		}
+	}
+	if ref.CompositeFIGI != "" && ref.CompositeFIGI != sec.figi {
+		// Filling a missing FIGI is applied; a different one is reported
+		add(ChangeFIGI, sec.figi, ref.CompositeFIGI)
+	}
+	return out
+}
+
+// shareCountChanges fetches ticker details for every matched security and
+// returns the share counts that moved by more than reconcileShareChangeMin
+func shareCountChanges(ctx context.Context, conn *data.Conn, active map[string]*dbSecurity, reference map[string]models.Ticker) ([]SecurityChange, error) {
+	limiter := time.NewTicker(reconcileDetailsRate)
+	defer limiter.Stop()
+	var out []SecurityChange
+	failed := 0
+	for ticker, sec := range active {
+		if _, ok := reference[ticker]; !ok {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-limiter.C:
+		}
+		details, err := polygon.GetTickerDetails(conn.Polygon, ticker, "now")
+		if err != nil {
+			failed++
+			continue
+		}
+		if sharesMoved(sec.shareClass, details.ShareClassSharesOutstanding) || sharesMoved(sec.weighted, details.WeightedSharesOutstanding) {
+			out = append(out, SecurityChange{
+				SecurityID: sec.securityID,
+				Ticker:     ticker,
+				Kind:       ChangeShares,
+				Old:        formatOptional(sec.shareClass) + "/" + formatOptional(sec.weighted),
+				New:        strconv.FormatInt(details.ShareClassSharesOutstanding, 10) + "/" + strconv.FormatInt(details.WeightedSharesOutstanding, 10),
+			})
+		}
+	}
+	if failed > 0 {
+		log.Printf("⚠️ Reconciliation: ticker details failed for %d securities", failed)
+	}
+	return out, nil
+}
+
+func sharesMoved(current *int64, next int64) bool {
+	if next <= 0 {
+		return false
+	}
+	if current == nil || *current <= 0 {
+		return true
+	}
+	return math.Abs(float64(next-*current))/float64(*current) > reconcileShareChangeMin
+}
+
+func isAttributeChange(kind string) bool {
+	switch kind {
+	case ChangeExchangeMove, ChangeName, ChangeCIK, ChangeShares, ChangeFIGI:
+		return true
+	}
+	return false
+}
+
+// autoApplied reports whether a change is applied to securities rather than
+// left for review; a FIGI is only filled in, never replaced
+func autoApplied(c SecurityChange) bool {
+	return isAttributeChange(c.Kind) && !(c.Kind == ChangeFIGI && c.Old != "")
+}
+
+func applySecurityChange(ctx context.Context, conn *data.Conn, c SecurityChange) error {
+	var err error
+	switch c.Kind {
+	case ChangeExchangeMove:
+		_, err = conn.DB.Exec(ctx, `UPDATE securities SET primary_exchange = $2 WHERE securityid = $1 AND maxdate IS NULL`, c.SecurityID, truncateString(c.New, 50))
+	case ChangeName:
+		_, err = conn.DB.Exec(ctx, `UPDATE securities SET name = $2 WHERE securityid = $1 AND maxdate IS NULL`, c.SecurityID, truncateString(c.New, 200))
+	case ChangeCIK:
+		_, err = conn.DB.Exec(ctx, `UPDATE securities SET cik = $2::bigint WHERE securityid = $1 AND maxdate IS NULL`, c.SecurityID, c.New)
+	case ChangeFIGI:
+		_, err = conn.DB.Exec(ctx, `UPDATE securities SET figi = $2 WHERE securityid = $1 AND maxdate IS NULL AND COALESCE(figi, '') = ''`, c.SecurityID, c.New)
+	case ChangeShares:
+		parts := strings.SplitN(c.New, "/", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("malformed share counts %q", c.New)
+		}
+		_, err = conn.DB.Exec(ctx, `
+			UPDATE securities SET
+				share_class_shares_outstanding = COALESCE(NULLIF($2::bigint, 0), share_class_shares_outstanding),
+				weighted_shares_outstanding = COALESCE(NULLIF($3::bigint, 0), weighted_shares_outstanding)
+			WHERE securityid = $1 AND maxdate IS NULL`, c.SecurityID, parts[0], parts[1])
+	default:
+		return fmt.Errorf("%s changes are not applied automatically", c.Kind)
+	}
+	return err
+}
+
+func recordSecurityChange(ctx context.Context, conn *data.Conn, runID int, c SecurityChange) error {
+	var securityID *int
+	if c.SecurityID != 0 {
+		securityID = &c.SecurityID
+	}
+	_, err := conn.DB.Exec(ctx, `
+		INSERT INTO security_changes (run_id, securityid, ticker, kind, old_value, new_value, applied)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7)`,
+		runID, securityID, c.Ticker, c.Kind, c.Old, c.New, c.Applied)
+	if err != nil {
+		return fmt.Errorf("error recording %s change for %s: %v", c.Kind, c.Ticker, err)
+	}
+	return nil
+}
+
+func hasTickerChange(changes []SecurityChange, securityID int) bool {
+	for _, c := range changes {
+		if c.Kind == ChangeTickerChange && c.SecurityID == securityID {
+			return true
+		}
+	}
+	return false
+}
+
+func formatOptional(v *int64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatInt(*v, 10)
+}
+
+// ListSecurityChanges returns the changes recorded by a run; run 0 means the latest run
+func ListSecurityChanges(ctx context.Context, conn *data.Conn, runID int, unappliedOnly bool) (int, []SecurityChange, error) {
+	if runID == 0 {
+		if err := conn.DB.QueryRow(ctx, `SELECT COALESCE(max(id), 0) FROM security_reconciliation_runs`).Scan(&runID); err != nil {
+			return 0, nil, fmt.Errorf("error finding latest run: %v", err)
+		}
+	}
+	rows, err := conn.DB.Query(ctx, `
+		SELECT COALESCE(securityid, 0), ticker, kind, COALESCE(old_value, ''), COALESCE(new_value, ''), applied
+		FROM security_changes
+		WHERE run_id = $1 AND (NOT $2 OR NOT applied)
+		ORDER BY applied, kind, ticker`, runID, unappliedOnly)
+	if err != nil {
+		return runID, nil, fmt.Errorf("error loading changes of run %d: %v", runID, err)
+	}
+	defer rows.Close()
+	var out []SecurityChange
+	for rows.Next() {
+		var c SecurityChange
+		if err := rows.Scan(&c.SecurityID, &c.Ticker, &c.Kind, &c.Old, &c.New, &c.Applied); err != nil {
+			return runID, nil, fmt.Errorf("error scanning change: %v", err)
+		}
+		out = append(out, c)
+	}
+	return runID, out, rows.Err()
+}
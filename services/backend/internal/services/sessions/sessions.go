@@ -0,0 +1,347 @@
+// Package sessions tracks the login sessions behind issued tokens so users can
+// see which devices are signed in and sign them out. Every token carries its
+// session ID; the session's device details live in Redis until the token
+// expires. Revoking a session adds it to a revocation list that the auth
+// middleware checks on every HTTP request and WebSocket connect, and closes
+// its WebSockets on every instance, so it takes effect immediately.
+package sessions
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"backend/internal/services/socket"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	sessionKeyFmt       = "auth:session:%s"
+	revokedKeyFmt       = "auth:revoked:%s"
+	userSessionsKeyFmt  = "user:%d:auth_sessions"
+	revokedBeforeKeyFmt = "user:%d:auth_revoked_before" // unix seconds
+
+	// MaxTokenLifetime bounds how long a revocation has to be remembered
+	MaxTokenLifetime = 6 * time.Hour
+	touchInterval    = time.Minute
+	redisOpTimeout   = 2 * time.Second
+)
+
+// Session is one signed-in device
+type Session struct {
+	ID         string `json:"sessionId"`
+	CreatedAt  int64  `json:"createdAt"`  // ms since epoch
+	LastSeenAt int64  `json:"lastSeenAt"` // ms since epoch, updated at most once a minute
+	ExpiresAt  int64  `json:"expiresAt"`  // ms since epoch
+	IP         string `json:"ip"`
+	UserAgent  string `json:"userAgent"`
+	Current    bool   `json:"current"` // the session making the request
+}
+
+type ctxKey struct{}
+
+// WithID returns a context carrying the session ID of the request
+func WithID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, sessionID)
+}
+
+// IDFrom returns the session ID of the request, or "" for tokens issued
+// before sessions were tracked
+func IDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// lastTouch throttles Touch to one write per session per touchInterval.
+// Entries for sessions whose token has expired are swept every sweepEvery writes.
+var (
+	lastTouch   sync.Map // session ID -> time.Time
+	touchWrites atomic.Int64
+)
+
+const sweepEvery = 1000
+
+func sessionKey(id string) string       { return fmt.Sprintf(sessionKeyFmt, id) }
+func revokedKey(id string) string       { return fmt.Sprintf(revokedKeyFmt, id) }
+func userSessionsKey(userID int) string { return fmt.Sprintf(userSessionsKeyFmt, userID) }
+func revokedBeforeKey(userID int) string {
+	return fmt.Sprintf(revokedBeforeKeyFmt, userID)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Create starts a session for a token expiring at expiresAt and returns its ID.
+// Device details are filled in by the first request that uses the token.
+func Create(ctx context.Context, conn *data.Conn, userID int, expiresAt time.Time) (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", fmt.Errorf("error generating session ID: %v", err)
+	}
+	now := time.Now()
+	raw, err := json.Marshal(Session{
+		ID:         id,
+		CreatedAt:  now.UnixMilli(),
+		LastSeenAt: now.UnixMilli(),
+		ExpiresAt:  expiresAt.UnixMilli(),
+	})
+	if err != nil {
+		return "", err
+	}
+	ttl := time.Until(expiresAt)
+	pipe := conn.Cache.TxPipeline()
+	pipe.Set(ctx, sessionKey(id), raw, ttl)
+	pipe.SAdd(ctx, userSessionsKey(userID), id)
+	pipe.Expire(ctx, userSessionsKey(userID), MaxTokenLifetime)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", fmt.Errorf("error storing session: %v", err)
+	}
+	return id, nil
+}
+
+// IsRevoked reports whether a token of the user's, issued at issuedAt for
+// sessionID, has been revoked. Tokens issued before sessions were tracked
+// have no session ID and are only caught by RevokeAll, whose cutoff takes
+// tokens issued in earlier seconds; a token issued in the cutoff's own second
+// may be a login that came after it.
+func IsRevoked(ctx context.Context, conn *data.Conn, userID int, sessionID string, issuedAt time.Time) (bool, error) {
+	keys := []string{revokedBeforeKey(userID)}
+	if sessionID != "" {
+		keys = append(keys, revokedKey(sessionID))
+	}
+	vals, err := conn.Cache.MGet(ctx, keys...).Result()
+	if err != nil {
+		return false, fmt.Errorf("error checking session revocation: %v", err)
+	}
+	if before, ok := vals[0].(string); ok {
+		var cutoff int64
+		if _, err := fmt.Sscan(before, &cutoff); err == nil && issuedAt.Unix() < cutoff {
+			return true, nil
+		}
+	}
+	return len(vals) > 1 && vals[1] != nil, nil
+}
+
+// Touch records a request on the session: last seen time, IP and user agent.
+// It writes at most once a minute per session and never blocks the request.
+func Touch(conn *data.Conn, sessionID, ip, userAgent string) {
+	if sessionID == "" {
+		return
+	}
+	now := time.Now()
+	if last, ok := lastTouch.Load(sessionID); ok && now.Sub(last.(time.Time)) < touchInterval {
+		return
+	}
+	lastTouch.Store(sessionID, now)
+	if touchWrites.Add(1)%sweepEvery == 0 {
+		lastTouch.Range(func(k, v interface{}) bool {
+			if now.Sub(v.(time.Time)) > MaxTokenLifetime {
+				lastTouch.Delete(k)
+			}
+			return true
+		})
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+		defer cancel()
+		key := sessionKey(sessionID)
+		raw, err := conn.Cache.Get(ctx, key).Bytes()
+		if err != nil {
+			if err != redis.Nil {
+				log.Printf("⚠️ Error loading session %s: %v", sessionID, err)
+			}
+			return
+		}
+		var s Session
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return
+		}
+		s.LastSeenAt = now.UnixMilli()
+		s.IP = ip
+		s.UserAgent = userAgent
+		if raw, err = json.Marshal(s); err != nil {
+			return
+		}
+		// KeepTTL so the session still ends with its token
+		if err := conn.Cache.SetXX(ctx, key, raw, redis.KeepTTL).Err(); err != nil {
+			log.Printf("⚠️ Error touching session %s: %v", sessionID, err)
+		}
+	}()
+}
+
+// List returns the user's live sessions, most recently seen first, dropping
+// expired ones from the user's set
+func List(ctx context.Context, conn *data.Conn, userID int, currentID string) ([]Session, error) {
+	ids, err := conn.Cache.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions: %v", err)
+	}
+	out := []Session{}
+	if len(ids) == 0 {
+		return out, nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = sessionKey(id)
+	}
+	vals, err := conn.Cache.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error loading sessions: %v", err)
+	}
+	var expired []interface{}
+	for i, v := range vals {
+		raw, ok := v.(string)
+		if !ok {
+			expired = append(expired, ids[i])
+			continue
+		}
+		var s Session
+		if err := json.Unmarshal([]byte(raw), &s); err != nil {
+			continue
+		}
+		s.Current = s.ID == currentID
+		out = append(out, s)
+	}
+	if len(expired) > 0 {
+		conn.Cache.SRem(ctx, userSessionsKey(userID), expired...)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeenAt > out[j].LastSeenAt })
+	return out, nil
+}
+
+// Revoke signs one of the user's sessions out everywhere
+func Revoke(ctx context.Context, conn *data.Conn, userID int, sessionID string) error {
+	member, err := conn.Cache.SIsMember(ctx, userSessionsKey(userID), sessionID).Result()
+	if err != nil {
+		return fmt.Errorf("error looking up session: %v", err)
+	}
+	if !member {
+		return apperr.NotFound("session not found")
+	}
+	if err := revoke(ctx, conn, userID, sessionID); err != nil {
+		return err
+	}
+	socket.EndAuthSession(userID, sessionID)
+	log.Printf("🔒 Revoked session %s of user %d", sessionID, userID)
+	return nil
+}
+
+// RevokeAll signs out every session of the user except keepID (when set) and
+// returns how many were revoked. Without keepID tokens that predate session
+// tracking are revoked too. The cutoff is stamped before the sessions are
+// listed, so a session that a token issued before the cutoff's second belongs
+// to is revoked one way or the other.
+func RevokeAll(ctx context.Context, conn *data.Conn, userID int, keepID string) (int, error) {
+	if keepID == "" {
+		err := conn.Cache.Set(ctx, revokedBeforeKey(userID), time.Now().Unix(), MaxTokenLifetime).Err()
+		if err != nil {
+			return 0, fmt.Errorf("error revoking sessions: %v", err)
+		}
+	}
+	ids, err := conn.Cache.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("error listing sessions: %v", err)
+	}
+	revoked := 0
+	for _, id := range ids {
+		if id == keepID {
+			continue
+		}
+		if err := revoke(ctx, conn, userID, id); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	if keepID == "" {
+		socket.EndAuthSession(userID, "")
+	} else {
+		for _, id := range ids {
+			if id != keepID {
+				socket.EndAuthSession(userID, id)
+			}
+		}
+	}
+	log.Printf("🔒 Revoked %d sessions of user %d", revoked, userID)
+	return revoked, nil
+}
+
+// revoke lists the session as revoked for as long as its token stays valid
+// and forgets its device details
+func revoke(ctx context.Context, conn *data.Conn, userID int, sessionID string) error {
+	pipe := conn.Cache.TxPipeline()
+	pipe.Set(ctx, revokedKey(sessionID), 1, MaxTokenLifetime)
+	pipe.Del(ctx, sessionKey(sessionID))
+	pipe.SRem(ctx, userSessionsKey(userID), sessionID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("error revoking session: %v", err)
+	}
+	lastTouch.Delete(sessionID)
+	return nil
+}
+
+// GetSessions lists the calling user's signed-in devices
+func GetSessions(ctx context.Context, conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	return List(ctx, conn, userID, IDFrom(ctx))
+}
+
+// RevokeSessionArgs represents the arguments for RevokeSession
+type RevokeSessionArgs struct {
+	SessionID string `json:"sessionId"`
+}
+
+// RevokeSession signs one of the calling user's devices out
+func RevokeSession(ctx context.Context, conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args RevokeSessionArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	if args.SessionID == "" {
+		return nil, apperr.Validation("sessionId is required")
+	}
+	if err := Revoke(ctx, conn, userID, args.SessionID); err != nil {
+		return nil, err
+	}
+	return map[string]bool{"revoked": true}, nil
+}
+
+// RevokeAllSessionsArgs represents the arguments for RevokeAllSessions
+type RevokeAllSessionsArgs struct {
+	// KeepCurrent leaves the calling session signed in
+	KeepCurrent bool `json:"keepCurrent"`
+}
+
+// RevokeAllSessions signs the calling user out everywhere
+func RevokeAllSessions(ctx context.Context, conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args RevokeAllSessionsArgs
+	if len(rawArgs) > 0 {
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			return nil, apperr.InvalidArgs(err)
+		}
+	}
+	keep := ""
+	if args.KeepCurrent {
+		keep = IDFrom(ctx)
+		if keep == "" {
+			return nil, apperr.Validation("this session predates device tracking; sign in again to keep it")
+		}
+	}
+	n, err := RevokeAll(ctx, conn, userID, keep)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{"revoked": n}, nil
+}
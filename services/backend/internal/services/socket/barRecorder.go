@@ -0,0 +1,164 @@
+package socket
+
+import (
+	"backend/internal/data"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/polygon-io/client-go/websocket/models"
+)
+
+// The bar recorder keeps the 1-second aggregates of selected tickers in
+// ohlcv_1s so bar replay can play them back at full resolution. Tickers are
+// listed in replay_recorded_tickers, or REPLAY_RECORD_ALL=true records every
+// ticker. ohlcv_1s is retained for a couple of weeks; older replays use 1m bars.
+const (
+	barRecorderFlushInterval = 5 * time.Second
+	barRecorderFlushSize     = 5000
+	barRecorderRefresh       = time.Minute
+)
+
+type barRecorder struct {
+	conn      *data.Conn
+	recordAll bool
+
+	tickersMu sync.RWMutex
+	tickers   map[string]struct{}
+
+	mu      sync.Mutex
+	pending []OHLCVRecord
+	flushCh chan []OHLCVRecord
+}
+
+var (
+	recorder     *barRecorder
+	recorderOnce sync.Once
+)
+
+func startBarRecorder(conn *data.Conn) {
+	recorderOnce.Do(func() {
+		all := strings.ToLower(os.Getenv("REPLAY_RECORD_ALL"))
+		r := &barRecorder{
+			conn:      conn,
+			recordAll: all == "1" || all == "true" || all == "yes",
+			tickers:   make(map[string]struct{}),
+			flushCh:   make(chan []OHLCVRecord, 16),
+		}
+		r.refreshTickers()
+		recorder = r
+		go r.run()
+		go r.writer()
+		log.Printf("🎞️ Bar recorder started (record all: %v, tickers: %d)", r.recordAll, len(r.tickers))
+	})
+}
+
+// refreshTickers reloads the recorded ticker list
+func (r *barRecorder) refreshTickers() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rows, err := r.conn.DB.Query(ctx, `SELECT ticker FROM replay_recorded_tickers`)
+	if err != nil {
+		log.Printf("⚠️ Bar recorder: error loading tickers: %v", err)
+		return
+	}
+	defer rows.Close()
+	tickers := make(map[string]struct{})
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err == nil {
+			tickers[t] = struct{}{}
+		}
+	}
+	r.tickersMu.Lock()
+	r.tickers = tickers
+	r.tickersMu.Unlock()
+}
+
+func (r *barRecorder) wants(ticker string) bool {
+	if r.recordAll {
+		return true
+	}
+	r.tickersMu.RLock()
+	_, ok := r.tickers[ticker]
+	r.tickersMu.RUnlock()
+	return ok
+}
+
+// recordSecondAgg buffers a 1-second aggregate if its ticker is recorded
+func recordSecondAgg(ticker string, agg models.EquityAgg) {
+	r := recorder
+	if r == nil || !r.wants(ticker) {
+		return
+	}
+	r.mu.Lock()
+	r.pending = append(r.pending, OHLCVRecord{
+		Timestamp: agg.StartTimestamp,
+		Ticker:    ticker,
+		Open:      agg.Open,
+		High:      agg.High,
+		Low:       agg.Low,
+		Close:     agg.Close,
+		Volume:    int64(agg.Volume),
+	})
+	full := len(r.pending) >= barRecorderFlushSize
+	r.mu.Unlock()
+	if full {
+		r.flush()
+	}
+}
+
+func (r *barRecorder) flush() {
+	r.mu.Lock()
+	batch := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	select {
+	case r.flushCh <- batch:
+	default:
+		log.Printf("⚠️ Bar recorder: writer behind, dropping %d 1s bars", len(batch))
+	}
+}
+
+func (r *barRecorder) run() {
+	flushTicker := time.NewTicker(barRecorderFlushInterval)
+	refreshTicker := time.NewTicker(barRecorderRefresh)
+	defer flushTicker.Stop()
+	defer refreshTicker.Stop()
+	for {
+		select {
+		case <-flushTicker.C:
+			r.flush()
+		case <-refreshTicker.C:
+			r.refreshTickers()
+		}
+	}
+}
+
+func (r *barRecorder) writer() {
+	for batch := range r.flushCh {
+		b := &pgx.Batch{}
+		for _, rec := range batch {
+			b.Queue(`
+				INSERT INTO ohlcv_1s (ticker, volume, open, close, high, low, "timestamp")
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+				ON CONFLICT (ticker, "timestamp") DO NOTHING`,
+				rec.Ticker, rec.Volume,
+				int64(rec.Open*1000), int64(rec.Close*1000), int64(rec.High*1000), int64(rec.Low*1000),
+				time.UnixMilli(rec.Timestamp))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := r.conn.DB.SendBatch(ctx, b).Close()
+		cancel()
+		if err != nil {
+			log.Printf("⚠️ Bar recorder: error writing %d 1s bars: %v", len(batch), err)
+		}
+	}
+}
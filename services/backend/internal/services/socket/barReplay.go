@@ -0,0 +1,384 @@
+package socket
+
+import (
+	"backend/internal/data"
+	"backend/internal/data/postgres"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Bar replay streams a security's recorded bars from a starting timestamp,
+// paced by the time between bars divided by the replay speed. Unlike the
+// tick replay in replay.go it plays stored aggregates: 1-second bars from
+// ohlcv_1s where they were recorded, otherwise 1-minute bars from ohlcv_1m.
+const (
+	barReplayChannel  = "bar_replay"
+	maxBarReplayDelay = 2 * time.Second // gaps (lunch, overnight) don't stall the replay
+	minBarReplaySpeed = 0.1
+	maxBarReplaySpeed = 1000
+	// how far ahead to look for the next bar after an empty window
+	barReplayGapSearch = 7 * 24 * time.Hour
+)
+
+// ReplayBar is one OHLCV bar; Timestamp is the bar start in ms
+type ReplayBar struct {
+	Timestamp int64   `json:"t"`
+	Open      float64 `json:"o"`
+	High      float64 `json:"h"`
+	Low       float64 `json:"l"`
+	Close     float64 `json:"c"`
+	Volume    int64   `json:"v"`
+}
+
+type barReplayMessage struct {
+	Channel    string     `json:"channel"`
+	Type       string     `json:"type"` // bar or status
+	SecurityID int        `json:"securityId"`
+	Ticker     string     `json:"ticker"`
+	Resolution string     `json:"resolution,omitempty"`
+	Bar        *ReplayBar `json:"bar,omitempty"`
+	State      string     `json:"state,omitempty"` // playing, paused, ended or error
+	Cursor     int64      `json:"cursor,omitempty"`
+	Speed      float64    `json:"speed,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// replayTable returns the table and load window of a resolution
+func replayTable(resolution string) (string, time.Duration, error) {
+	switch resolution {
+	case "1s":
+		return "ohlcv_1s", 10 * time.Minute, nil
+	case "1m":
+		return "ohlcv_1m", 24 * time.Hour, nil
+	}
+	return "", 0, fmt.Errorf("unsupported replay resolution %q", resolution)
+}
+
+// LoadReplayBars returns a ticker's bars in [from, to). An empty resolution
+// uses 1-second bars when any were recorded in the range, else 1-minute bars;
+// the resolution used is returned.
+func LoadReplayBars(ctx context.Context, conn *data.Conn, ticker string, from, to time.Time, resolution string) ([]ReplayBar, string, error) {
+	if resolution == "" {
+		bars, _, err := LoadReplayBars(ctx, conn, ticker, from, to, "1s")
+		if err == nil && len(bars) > 0 {
+			return bars, "1s", nil
+		}
+		resolution = "1m"
+	}
+	table, _, err := replayTable(resolution)
+	if err != nil {
+		return nil, "", err
+	}
+	rows, err := conn.DB.Query(ctx, fmt.Sprintf(`
+		SELECT "timestamp", open, high, low, close, volume
+		FROM %s
+		WHERE ticker = $1 AND "timestamp" >= $2 AND "timestamp" < $3
+		ORDER BY "timestamp"`, table), ticker, from, to)
+	if err != nil {
+		return nil, "", fmt.Errorf("error querying %s bars: %v", resolution, err)
+	}
+	defer rows.Close()
+	var bars []ReplayBar
+	for rows.Next() {
+		var ts time.Time
+		var o, h, l, c, v int64
+		if err := rows.Scan(&ts, &o, &h, &l, &c, &v); err != nil {
+			return nil, "", fmt.Errorf("error scanning %s bar: %v", resolution, err)
+		}
+		bars = append(bars, ReplayBar{
+			Timestamp: ts.UnixMilli(),
+			Open:      float64(o) / 1000,
+			High:      float64(h) / 1000,
+			Low:       float64(l) / 1000,
+			Close:     float64(c) / 1000,
+			Volume:    v,
+		})
+	}
+	return bars, resolution, rows.Err()
+}
+
+// nextReplayBarTime returns the start of the first bar at or after from
+func nextReplayBarTime(ctx context.Context, conn *data.Conn, ticker string, from time.Time, resolution string) (time.Time, bool) {
+	table, _, err := replayTable(resolution)
+	if err != nil {
+		return time.Time{}, false
+	}
+	var next *time.Time
+	err = conn.DB.QueryRow(ctx, fmt.Sprintf(`
+		SELECT min("timestamp") FROM %s
+		WHERE ticker = $1 AND "timestamp" >= $2 AND "timestamp" < $3`, table),
+		ticker, from, from.Add(barReplayGapSearch)).Scan(&next)
+	if err != nil || next == nil {
+		return time.Time{}, false
+	}
+	return *next, true
+}
+
+type barReplaySession struct {
+	client     *Client
+	securityID int
+	ticker     string
+
+	mu         sync.Mutex
+	resolution string // "" until the first window picks 1s or 1m
+	speed      float64
+	paused     bool
+	cursor     time.Time
+
+	wake chan struct{}
+	stop chan struct{}
+	once sync.Once
+}
+
+func clampReplaySpeed(speed float64) float64 {
+	if speed < minBarReplaySpeed {
+		return minBarReplaySpeed
+	}
+	if speed > maxBarReplaySpeed {
+		return maxBarReplaySpeed
+	}
+	return speed
+}
+
+// startBarReplay replaces the client's bar replay with a new one
+func (c *Client) startBarReplay(securityID int, timestampMs int64, speed float64, resolution string) {
+	c.stopBarReplay()
+	start := time.UnixMilli(timestampMs)
+	s := &barReplaySession{
+		client:     c,
+		securityID: securityID,
+		resolution: resolution,
+		speed:      clampReplaySpeed(speed),
+		cursor:     start,
+		wake:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+	}
+	ticker, err := postgres.GetTicker(c.conn, securityID, start)
+	if err != nil {
+		s.sendStatus("error", fmt.Sprintf("no ticker for security %d at that time", securityID))
+		return
+	}
+	s.ticker = ticker
+
+	c.mu.Lock()
+	c.barReplay = s
+	c.mu.Unlock()
+	go s.run()
+}
+
+func (c *Client) withBarReplay(fn func(*barReplaySession)) {
+	c.mu.Lock()
+	s := c.barReplay
+	c.mu.Unlock()
+	if s != nil {
+		fn(s)
+	}
+}
+
+func (c *Client) stopBarReplay() {
+	c.mu.Lock()
+	s := c.barReplay
+	c.barReplay = nil
+	c.mu.Unlock()
+	if s != nil {
+		s.close()
+	}
+}
+
+func (s *barReplaySession) close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+func (s *barReplaySession) setPaused(paused bool) {
+	s.mu.Lock()
+	s.paused = paused
+	s.mu.Unlock()
+	s.nudge()
+	if paused {
+		s.sendStatus("paused", "")
+	} else {
+		s.sendStatus("playing", "")
+	}
+}
+
+func (s *barReplaySession) setSpeed(speed float64) {
+	s.mu.Lock()
+	s.speed = clampReplaySpeed(speed)
+	s.mu.Unlock()
+	s.nudge()
+	s.sendStatus("playing", "")
+}
+
+func (s *barReplaySession) nudge() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// wait sleeps for d unless stopped, and doesn't return while paused
+func (s *barReplaySession) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		paused := s.paused
+		s.mu.Unlock()
+		if paused {
+			select {
+			case <-s.stop:
+				return false
+			case <-s.client.done:
+				return false
+			case <-s.wake:
+				continue
+			}
+		}
+		select {
+		case <-s.stop:
+			return false
+		case <-s.client.done:
+			return false
+		case <-s.wake:
+		case <-timer.C:
+			return true
+		}
+	}
+}
+
+func (s *barReplaySession) send(msg barReplayMessage) bool {
+	msg.Channel = barReplayChannel
+	msg.SecurityID = s.securityID
+	msg.Ticker = s.ticker
+	s.mu.Lock()
+	msg.Resolution = s.resolution
+	s.mu.Unlock()
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return false
+	}
+	select {
+	case s.client.send <- b:
+		return true
+	case <-s.stop:
+		return false
+	case <-s.client.done:
+		return false
+	}
+}
+
+func (s *barReplaySession) sendStatus(state, errMsg string) {
+	s.mu.Lock()
+	cursor, speed := s.cursor.UnixMilli(), s.speed
+	s.mu.Unlock()
+	s.send(barReplayMessage{Type: "status", State: state, Cursor: cursor, Speed: speed, Error: errMsg})
+}
+
+func (s *barReplaySession) run() {
+	ctx := context.Background()
+	s.sendStatus("playing", "")
+	var prev int64
+	for {
+		s.mu.Lock()
+		cursor, requested := s.cursor, s.resolution
+		s.mu.Unlock()
+
+		_, window, _ := replayTable(requested)
+		if window == 0 {
+			window = 10 * time.Minute
+		}
+		bars, resolution, err := LoadReplayBars(ctx, s.client.conn, s.ticker, cursor, cursor.Add(window), requested)
+		if err != nil {
+			log.Printf("⚠️ Bar replay of %s: %v", s.ticker, err)
+			s.sendStatus("error", "failed to load bars")
+			return
+		}
+		// Keep the resolution picked for the first window for the rest of the replay
+		s.mu.Lock()
+		s.resolution = resolution
+		s.mu.Unlock()
+		if len(bars) == 0 {
+			next, ok := nextReplayBarTime(ctx, s.client.conn, s.ticker, cursor, resolution)
+			if !ok {
+				s.sendStatus("ended", "")
+				return
+			}
+			s.mu.Lock()
+			s.cursor = next
+			s.mu.Unlock()
+			continue
+		}
+		for i := range bars {
+			bar := bars[i]
+			if prev != 0 {
+				s.mu.Lock()
+				speed := s.speed
+				s.mu.Unlock()
+				delay := time.Duration(float64(bar.Timestamp-prev) / speed * float64(time.Millisecond))
+				if delay > maxBarReplayDelay {
+					delay = maxBarReplayDelay
+				}
+				if !s.wait(delay) {
+					return
+				}
+			}
+			if !s.send(barReplayMessage{Type: "bar", Bar: &bar}) {
+				return
+			}
+			prev = bar.Timestamp
+			s.mu.Lock()
+			s.cursor = time.UnixMilli(bar.Timestamp + 1)
+			s.mu.Unlock()
+		}
+	}
+}
+
+// GetReplayBarsArgs represents the arguments for GetReplayBars
+type GetReplayBarsArgs struct {
+	SecurityID int    `json:"securityId"`
+	From       int64  `json:"from"` // ms
+	To         int64  `json:"to"`   // ms
+	Resolution string `json:"resolution,omitempty"`
+}
+
+// GetReplayBarsResult is the response of GetReplayBars
+type GetReplayBarsResult struct {
+	Ticker     string      `json:"ticker"`
+	Resolution string      `json:"resolution"`
+	Bars       []ReplayBar `json:"bars"`
+}
+
+// GetReplayBars returns the stored bars of a security in a time range, for
+// drawing the history before a bar replay starts
+func GetReplayBars(conn *data.Conn, _ int, rawArgs json.RawMessage) (interface{}, error) {
+	var args GetReplayBarsArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("invalid args: %v", err)
+	}
+	from, to := time.UnixMilli(args.From), time.UnixMilli(args.To)
+	if !to.After(from) {
+		return nil, fmt.Errorf("to must be after from")
+	}
+	maxRange := 31 * 24 * time.Hour
+	if args.Resolution == "1s" {
+		maxRange = 24 * time.Hour
+	}
+	if to.Sub(from) > maxRange {
+		return nil, fmt.Errorf("range too large for %s bars", args.Resolution)
+	}
+	ticker, err := postgres.GetTicker(conn, args.SecurityID, to)
+	if err != nil {
+		return nil, fmt.Errorf("unknown security %d: %v", args.SecurityID, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	bars, resolution, err := LoadReplayBars(ctx, conn, ticker, from, to, args.Resolution)
+	if err != nil {
+		return nil, err
+	}
+	return GetReplayBarsResult{Ticker: ticker, Resolution: resolution, Bars: bars}, nil
+}
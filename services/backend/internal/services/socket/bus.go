@@ -0,0 +1,363 @@
+package socket
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Each server instance holds its own WebSocket connections. The bus lets any
+// instance reach a user connected to another one: instances heartbeat a key
+// in Redis, every session is registered in a per-user hash naming its
+// instance, and messages for a remote user are published on that instance's
+// channel. Until StartSocketBus runs (jobctl, single-instance dev) every send
+// stays local.
+//
+// When an instance dies its heartbeat key expires and its sessions are pruned
+// the next time they're looked up. Alerts for those users are then queued by
+// the sender and forwarded once the user reconnects anywhere; alerts that were
+// only held in the dead instance's memory are lost.
+const (
+	busInstanceTTL       = 30 * time.Second
+	busHeartbeatInterval = 10 * time.Second
+	busSessionTTL        = 24 * time.Hour
+	busAllChannel        = "socket:bus:all"
+	busOpTimeout         = 2 * time.Second
+)
+
+const (
+	busKindMessage    = "message"    // per-user message, dropped if not connected
+	busKindAlert      = "alert"      // per-user alert, queued if not connected
+	busKindAll        = "all"        // message for every connection
+	busKindConnected  = "connected"  // a user connected to the sending instance
+	busKindDisconnect = "disconnect" // end one of the receiver's sessions
+	busKindEndAuth    = "end_auth"   // end the connections of a revoked login session
+	// event of a security, for the connections watching it
+	busKindSecurityEvent = "security_event"
+)
+
+type busEnvelope struct {
+	Kind       string          `json:"kind"`
+	From       string          `json:"from"`
+	UserID     int             `json:"userId,omitempty"`
+	SessionID  string          `json:"sessionId,omitempty"`
+	DeliveryID string          `json:"deliveryId,omitempty"`
+	CreatedAt  int64           `json:"createdAt,omitempty"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+}
+
+// busSession is the value stored per session in the user's hash
+type busSession struct {
+	Instance string `json:"instance"`
+	ConnectionInfo
+}
+
+var (
+	busConn    atomic.Pointer[data.Conn]
+	instanceID string
+)
+
+func busInstanceKey(id string) string { return "socket:instance:" + id }
+func busChannel(id string) string     { return "socket:bus:" + id }
+func busUserKey(userID int) string    { return fmt.Sprintf("socket:user:%d", userID) }
+
+// StartSocketBus registers this instance and starts routing messages between
+// instances
+func StartSocketBus(conn *data.Conn) {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "socket"
+	}
+	instanceID = host + "-" + randomID()[:6]
+
+	ctx := context.Background()
+	if err := conn.Cache.Set(ctx, busInstanceKey(instanceID), time.Now().Unix(), busInstanceTTL).Err(); err != nil {
+		log.Printf("⚠️ Socket bus disabled, failed to register instance: %v", err)
+		return
+	}
+	pubsub := conn.Cache.Subscribe(ctx, busChannel(instanceID), busAllChannel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		log.Printf("⚠️ Socket bus disabled, failed to subscribe: %v", err)
+		_ = pubsub.Close()
+		return
+	}
+	busConn.Store(conn)
+
+	go func() {
+		ticker := time.NewTicker(busHeartbeatInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := conn.Cache.Set(ctx, busInstanceKey(instanceID), time.Now().Unix(), busInstanceTTL).Err(); err != nil {
+				log.Printf("⚠️ Socket bus heartbeat failed: %v", err)
+			}
+		}
+	}()
+	go func() {
+		defer pubsub.Close()
+		for msg := range pubsub.Channel() {
+			var env busEnvelope
+			if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+				log.Printf("⚠️ Ignoring malformed socket bus message: %v", err)
+				continue
+			}
+			if env.From == instanceID {
+				continue
+			}
+			handleBusMessage(env)
+		}
+	}()
+	log.Printf("✅ Socket bus started for instance %s", instanceID)
+}
+
+func handleBusMessage(env busEnvelope) {
+	switch env.Kind {
+	case busKindMessage:
+		sendLocal(env.UserID, env.Payload)
+	case busKindAlert:
+		d := &pendingDelivery{id: env.DeliveryID, payload: env.Payload, createdAt: time.UnixMilli(env.CreatedAt)}
+		if !deliverLocal(env.UserID, d) {
+			// The user left between lookup and delivery; hold it here until
+			// they reconnect
+			deliveryMu.Lock()
+			enqueueLocked(env.UserID, d)
+			deliveryMu.Unlock()
+			deliveryQueued.Add(1)
+		}
+	case busKindAll:
+		sendToAllLocal(env.Payload)
+	case busKindConnected:
+		forwardQueued(env.UserID, env.From)
+	case busKindDisconnect:
+		if err := disconnectLocalSession(env.UserID, env.SessionID); err != nil {
+			log.Printf("⚠️ Socket bus disconnect of session %s: %v", env.SessionID, err)
+		}
+	case busKindEndAuth:
+		endLocalAuthSession(env.UserID, env.SessionID)
+	case busKindSecurityEvent:
+		var ev SecurityEvent
+		if err := json.Unmarshal(env.Payload, &ev); err != nil {
+			log.Printf("⚠️ Ignoring malformed security event: %v", err)
+			return
+		}
+		deliverTickerEvent(ev)
+	}
+}
+
+func busPublish(conn *data.Conn, channel string, env busEnvelope) error {
+	env.From = instanceID
+	b, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), busOpTimeout)
+	defer cancel()
+	return conn.Cache.Publish(ctx, channel, b).Err()
+}
+
+// remoteSessions returns the user's live sessions on other instances, pruning
+// sessions whose instance stopped heartbeating
+func remoteSessions(conn *data.Conn, userID int) []busSession {
+	ctx, cancel := context.WithTimeout(context.Background(), busOpTimeout)
+	defer cancel()
+	entries, err := conn.Cache.HGetAll(ctx, busUserKey(userID)).Result()
+	if err != nil {
+		log.Printf("⚠️ Socket bus session lookup for user %d: %v", userID, err)
+		return nil
+	}
+	live := make(map[string]bool)
+	var out []busSession
+	for sessionID, raw := range entries {
+		var s busSession
+		if err := json.Unmarshal([]byte(raw), &s); err != nil || s.Instance == instanceID {
+			continue
+		}
+		alive, seen := live[s.Instance]
+		if !seen {
+			n, err := conn.Cache.Exists(ctx, busInstanceKey(s.Instance)).Result()
+			alive = err == nil && n > 0
+			live[s.Instance] = alive
+		}
+		if !alive {
+			conn.Cache.HDel(ctx, busUserKey(userID), sessionID)
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// remoteInstanceFor returns the instance holding the user's newest remote
+// session, or "" if the user isn't connected elsewhere
+func remoteInstanceFor(userID int) string {
+	conn := busConn.Load()
+	if conn == nil {
+		return ""
+	}
+	var newest *busSession
+	sessions := remoteSessions(conn, userID)
+	for i := range sessions {
+		if newest == nil || sessions[i].ConnectedAt > newest.ConnectedAt {
+			newest = &sessions[i]
+		}
+	}
+	if newest == nil {
+		return ""
+	}
+	return newest.Instance
+}
+
+// registerBusSession advertises a new local session and asks other instances
+// to forward alerts they queued for the user while they were offline
+func registerBusSession(c *Client) {
+	conn := busConn.Load()
+	if conn == nil {
+		return
+	}
+	b, err := json.Marshal(busSession{Instance: instanceID, ConnectionInfo: c.info()})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), busOpTimeout)
+	defer cancel()
+	key := busUserKey(c.userID)
+	if err := conn.Cache.HSet(ctx, key, c.sessionID, b).Err(); err != nil {
+		log.Printf("⚠️ Socket bus failed to register session for user %d: %v", c.userID, err)
+		return
+	}
+	conn.Cache.Expire(ctx, key, busSessionTTL)
+	if err := busPublish(conn, busAllChannel, busEnvelope{Kind: busKindConnected, UserID: c.userID}); err != nil {
+		log.Printf("⚠️ Socket bus failed to announce user %d: %v", c.userID, err)
+	}
+}
+
+func unregisterBusSession(c *Client) {
+	conn := busConn.Load()
+	if conn == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), busOpTimeout)
+	defer cancel()
+	conn.Cache.HDel(ctx, busUserKey(c.userID), c.sessionID)
+}
+
+// sendLocal writes to the user's connection on this instance without blocking
+func sendLocal(userID int, payload []byte) bool {
+	UserToClientMutex.RLock()
+	client, ok := UserToClient[userID]
+	UserToClientMutex.RUnlock()
+	if !ok {
+		return false
+	}
+	select {
+	case client.send <- payload:
+		return true
+	default:
+		return false
+	}
+}
+
+// sendToUser sends a message to the user wherever they're connected. It
+// reports false when the user isn't connected or the local buffer is full.
+func sendToUser(userID int, payload []byte) bool {
+	UserToClientMutex.RLock()
+	_, local := UserToClient[userID]
+	UserToClientMutex.RUnlock()
+	if local {
+		return sendLocal(userID, payload)
+	}
+	remote := remoteInstanceFor(userID)
+	if remote == "" {
+		return false
+	}
+	if err := busPublish(busConn.Load(), busChannel(remote), busEnvelope{Kind: busKindMessage, UserID: userID, Payload: payload}); err != nil {
+		log.Printf("⚠️ Socket bus failed to route message to user %d: %v", userID, err)
+		return false
+	}
+	return true
+}
+
+// sendAlertRemote hands an alert to the instance holding the user's
+// connection; false means the user isn't connected anywhere else
+func sendAlertRemote(userID int, d *pendingDelivery) bool {
+	remote := remoteInstanceFor(userID)
+	if remote == "" {
+		return false
+	}
+	err := busPublish(busConn.Load(), busChannel(remote), busEnvelope{
+		Kind:       busKindAlert,
+		UserID:     userID,
+		DeliveryID: d.id,
+		CreatedAt:  d.createdAt.UnixMilli(),
+		Payload:    d.payload,
+	})
+	if err != nil {
+		log.Printf("⚠️ Socket bus failed to route alert to user %d: %v", userID, err)
+		return false
+	}
+	return true
+}
+
+// forwardQueued moves alerts queued here for the user to the instance they
+// just connected to
+func forwardQueued(userID int, target string) {
+	conn := busConn.Load()
+	if conn == nil || target == "" {
+		return
+	}
+	deliveryMu.Lock()
+	q := queuedDeliveries[userID]
+	delete(queuedDeliveries, userID)
+	deliveryMu.Unlock()
+	for i, d := range q {
+		err := busPublish(conn, busChannel(target), busEnvelope{
+			Kind:       busKindAlert,
+			UserID:     userID,
+			DeliveryID: d.id,
+			CreatedAt:  d.createdAt.UnixMilli(),
+			Payload:    d.payload,
+		})
+		if err != nil {
+			log.Printf("⚠️ Socket bus failed to forward queued alerts for user %d: %v", userID, err)
+			deliveryMu.Lock()
+			for _, rest := range q[i:] {
+				enqueueLocked(userID, rest)
+			}
+			deliveryMu.Unlock()
+			return
+		}
+	}
+}
+
+// sendToAllLocal writes to every connection on this instance
+func sendToAllLocal(payload []byte) int {
+	UserToClientMutex.RLock()
+	defer UserToClientMutex.RUnlock()
+	sent := 0
+	for _, client := range UserToClient {
+		if client == nil {
+			continue
+		}
+		select {
+		case client.send <- payload:
+			sent++
+		default:
+		}
+	}
+	return sent
+}
+
+// publishToAll sends a message to the connections on every other instance
+func publishToAll(payload []byte) {
+	conn := busConn.Load()
+	if conn == nil {
+		return
+	}
+	if err := busPublish(conn, busAllChannel, busEnvelope{Kind: busKindAll, Payload: payload}); err != nil {
+		log.Printf("⚠️ Socket bus broadcast failed: %v", err)
+	}
+}
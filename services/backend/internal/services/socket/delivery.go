@@ -0,0 +1,281 @@
+package socket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Alerts sent to a user carry a delivery ID the client acknowledges. Alerts
+// for offline users, and alerts still unacknowledged when a connection drops,
+// are queued per user and replayed on the next connection.
+const (
+	maxQueuedAlertsPerUser = 100
+	maxUnackedPerConn      = 500
+	queuedAlertTTL         = 24 * time.Hour
+	deliveryStatsInterval  = 15 * time.Minute
+)
+
+type pendingDelivery struct {
+	id        string
+	payload   []byte
+	createdAt time.Time
+}
+
+var (
+	deliveryMu sync.Mutex
+	// unackedDeliveries holds alerts written to each connection awaiting its
+	// ack; they're per connection so one tab's acks and disconnect leave the
+	// alerts another tab of the same user is holding alone
+	unackedDeliveries = make(map[*Client]map[string]*pendingDelivery)
+	// queuedDeliveries holds alerts waiting for the user to reconnect, oldest first
+	queuedDeliveries = make(map[int][]*pendingDelivery)
+
+	deliverySent     atomic.Int64
+	deliveryAcked    atomic.Int64
+	deliveryQueued   atomic.Int64
+	deliveryReplayed atomic.Int64
+	deliveryDropped  atomic.Int64
+	deliveryExpired  atomic.Int64
+
+	deliveryStatsOnce sync.Once
+
+	ackCallback AckFunc
+)
+
+// AckFunc is called with every alert acknowledgement a client sends
+type AckFunc func(userID int, deliveryID string)
+
+// SetAckCallback sets the function told about acknowledgements; the alert
+// service uses it to cancel pending escalations
+func SetAckCallback(callback AckFunc) {
+	ackCallback = callback
+}
+
+// DeliveryStats counts alert deliveries since the server started. Dropped
+// (queue overflow) and Expired (past the TTL) alerts never reached a client.
+type DeliveryStats struct {
+	Sent     int64 `json:"sent"`
+	Acked    int64 `json:"acked"`
+	Queued   int64 `json:"queued"`
+	Replayed int64 `json:"replayed"`
+	Dropped  int64 `json:"dropped"`
+	Expired  int64 `json:"expired"`
+	// Current sizes
+	Unacked int `json:"unacked"`
+	Waiting int `json:"waiting"`
+}
+
+// GetDeliveryStats returns the alert delivery counters
+func GetDeliveryStats() DeliveryStats {
+	s := DeliveryStats{
+		Sent:     deliverySent.Load(),
+		Acked:    deliveryAcked.Load(),
+		Queued:   deliveryQueued.Load(),
+		Replayed: deliveryReplayed.Load(),
+		Dropped:  deliveryDropped.Load(),
+		Expired:  deliveryExpired.Load(),
+	}
+	deliveryMu.Lock()
+	for _, m := range unackedDeliveries {
+		s.Unacked += len(m)
+	}
+	for _, q := range queuedDeliveries {
+		s.Waiting += len(q)
+	}
+	deliveryMu.Unlock()
+	return s
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// deliverToUser sends payload to the user's connection on this or another
+// instance, or queues it if the user is offline or the connection's buffer is full
+func deliverToUser(userID int, d *pendingDelivery) {
+	startDeliveryStatsLogger()
+	if deliverLocal(userID, d) || sendAlertRemote(userID, d) {
+		return
+	}
+	deliveryMu.Lock()
+	enqueueLocked(userID, d)
+	deliveryMu.Unlock()
+	deliveryQueued.Add(1)
+}
+
+// deliverLocal sends to the user's connection on this instance
+func deliverLocal(userID int, d *pendingDelivery) bool {
+	UserToClientMutex.RLock()
+	client, ok := UserToClient[userID]
+	UserToClientMutex.RUnlock()
+	if ok && trySend(client, d) {
+		deliverySent.Add(1)
+		return true
+	}
+	return false
+}
+
+// trySend writes to the client without blocking and tracks the delivery until acked
+func trySend(client *Client, d *pendingDelivery) bool {
+	select {
+	case client.send <- d.payload:
+	default:
+		return false
+	}
+	deliveryMu.Lock()
+	defer deliveryMu.Unlock()
+	m := unackedDeliveries[client]
+	if m == nil {
+		m = make(map[string]*pendingDelivery)
+		unackedDeliveries[client] = m
+	}
+	if len(m) >= maxUnackedPerConn {
+		// A client that never acks shouldn't grow this without bound; forget
+		// the oldest, it was written to the socket at least once
+		var oldest *pendingDelivery
+		for _, p := range m {
+			if oldest == nil || p.createdAt.Before(oldest.createdAt) {
+				oldest = p
+			}
+		}
+		delete(m, oldest.id)
+	}
+	m[d.id] = d
+	return true
+}
+
+// enqueueLocked adds to the user's offline queue, dropping the oldest entries
+// past the cap; deliveryMu must be held
+func enqueueLocked(userID int, d *pendingDelivery) {
+	q := append(queuedDeliveries[userID], d)
+	if over := len(q) - maxQueuedAlertsPerUser; over > 0 {
+		q = q[over:]
+		deliveryDropped.Add(int64(over))
+	}
+	queuedDeliveries[userID] = q
+}
+
+// AckDelivery marks an alert as received by the client it was sent to
+func AckDelivery(client *Client, deliveryID string) {
+	if deliveryID == "" {
+		return
+	}
+	if ackCallback != nil {
+		go ackCallback(client.userID, deliveryID)
+	}
+	deliveryMu.Lock()
+	defer deliveryMu.Unlock()
+	if m := unackedDeliveries[client]; m != nil {
+		if _, ok := m[deliveryID]; ok {
+			delete(m, deliveryID)
+			deliveryAcked.Add(1)
+		}
+		if len(m) == 0 {
+			delete(unackedDeliveries, client)
+		}
+	}
+}
+
+// requeueUnacked moves alerts the client never acknowledged back onto its
+// user's offline queue, ahead of anything queued since
+func requeueUnacked(client *Client) {
+	deliveryMu.Lock()
+	defer deliveryMu.Unlock()
+	m := unackedDeliveries[client]
+	if len(m) == 0 {
+		return
+	}
+	delete(unackedDeliveries, client)
+	userID := client.userID
+	pending := make([]*pendingDelivery, 0, len(m)+len(queuedDeliveries[userID]))
+	for _, d := range m {
+		pending = append(pending, d)
+	}
+	pending = append(pending, queuedDeliveries[userID]...)
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].createdAt.Before(pending[j].createdAt) })
+	queuedDeliveries[userID] = nil
+	for _, d := range pending {
+		enqueueLocked(userID, d)
+	}
+}
+
+// replayQueued sends the user's queued alerts to a new connection
+func replayQueued(client *Client) {
+	deliveryMu.Lock()
+	q := queuedDeliveries[client.userID]
+	delete(queuedDeliveries, client.userID)
+	deliveryMu.Unlock()
+
+	cutoff := time.Now().Add(-queuedAlertTTL)
+	for i, d := range q {
+		if d.createdAt.Before(cutoff) {
+			deliveryExpired.Add(1)
+			continue
+		}
+		if !trySend(client, d) {
+			// Buffer full; put the rest back for the next connection
+			deliveryMu.Lock()
+			for _, rest := range q[i:] {
+				enqueueLocked(client.userID, rest)
+			}
+			deliveryMu.Unlock()
+			return
+		}
+		deliveryReplayed.Add(1)
+	}
+}
+
+// expireQueued drops queued and unacked alerts older than the TTL
+func expireQueued() {
+	cutoff := time.Now().Add(-queuedAlertTTL)
+	deliveryMu.Lock()
+	defer deliveryMu.Unlock()
+	for userID, q := range queuedDeliveries {
+		kept := q[:0]
+		for _, d := range q {
+			if d.createdAt.Before(cutoff) {
+				deliveryExpired.Add(1)
+				continue
+			}
+			kept = append(kept, d)
+		}
+		if len(kept) == 0 {
+			delete(queuedDeliveries, userID)
+		} else {
+			queuedDeliveries[userID] = kept
+		}
+	}
+	for client, m := range unackedDeliveries {
+		for id, d := range m {
+			if d.createdAt.Before(cutoff) {
+				delete(m, id)
+				deliveryExpired.Add(1)
+			}
+		}
+		if len(m) == 0 {
+			delete(unackedDeliveries, client)
+		}
+	}
+}
+
+func startDeliveryStatsLogger() {
+	deliveryStatsOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(deliveryStatsInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				expireQueued()
+				s := GetDeliveryStats()
+				log.Printf("📬 Alert delivery: sent=%d acked=%d queued=%d replayed=%d dropped=%d expired=%d unacked=%d waiting=%d",
+					s.Sent, s.Acked, s.Queued, s.Replayed, s.Dropped, s.Expired, s.Unacked, s.Waiting)
+			}
+		}()
+	})
+}
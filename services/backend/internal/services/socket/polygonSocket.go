@@ -2,6 +2,7 @@ package socket
 
 import (
 	"backend/internal/data"
+	"backend/internal/services/lastprice"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -65,6 +66,8 @@ func (p *PolygonSocketService) Start(conn *data.Conn, useAlerts bool) error {
 	if err := InitOHLCVBuffer(conn); err != nil {
 		return fmt.Errorf("init OHLCV buffer: %w", err)
 	}
+	// Record 1-second aggregates of selected tickers for bar replay
+	startBarRecorder(conn)
 
 	// Create new websocket client
 	var err error
@@ -153,12 +156,6 @@ var (
 	timestampMutex      sync.RWMutex
 )
 
-// Latest price cache for alerts
-var (
-	latestPrices      = make(map[int]float64) // securityID -> latest price
-	latestPricesMutex sync.RWMutex
-)
-
 // -- Stale ticker batching (1-second aggregates) --
 var (
 	staleTickers = struct {
@@ -248,21 +245,6 @@ func shouldSkipVolume(conditions []int32) bool {
 	return false
 }
 
-// GetLatestPrice returns the latest price for a given security ID
-func GetLatestPrice(securityID int) (float64, bool) {
-	latestPricesMutex.RLock()
-	defer latestPricesMutex.RUnlock()
-	price, exists := latestPrices[securityID]
-	return price, exists
-}
-
-// updateLatestPrice updates the latest price for a security ID
-func updateLatestPrice(securityID int, price float64) {
-	latestPricesMutex.Lock()
-	defer latestPricesMutex.Unlock()
-	latestPrices[securityID] = price
-}
-
 func broadcastTimestamp() {
 	timestampMutex.Lock()
 	now := time.Now()
@@ -297,6 +279,7 @@ func (p *PolygonSocketService) streamPolygonDataToRedis() {
 	// Start the batched stale-ticker flusher (only once per process)
 	fmt.Println("Starting stale flusher")
 	staleFlusherOnce.Do(func() { startStaleFlusher(p.conn) })
+	lastprice.StartFlusher(p.conn)
 
 	err := p.wsClient.Subscribe(polygonws.StocksQuotes)
 	if err != nil {
@@ -380,6 +363,7 @@ func (p *PolygonSocketService) streamPolygonDataToRedis() {
 					} else {
 						log.Printf("⚠️ ohlcvBuffer is nil, cannot add bar for %s", symbol)
 					}
+					recordSecondAgg(symbol, msg)
 
 					// Mark ticker as stale for screener refresh
 					flagTickerStale(symbol)
@@ -429,7 +413,7 @@ func (p *PolygonSocketService) streamPolygonDataToRedis() {
 
 				// Only update latest price cache if we're not skipping price updates
 				if !skipPriceUpdate {
-					updateLatestPrice(securityID, msg.Price)
+					lastprice.RecordTrade(securityID, symbol, msg.Price, time.UnixMilli(msg.Timestamp))
 				}
 
 				// COMMENTED OUT: appendTick call disabled - alerts will be processed directly from ticks
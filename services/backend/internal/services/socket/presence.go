@@ -0,0 +1,297 @@
+package socket
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Presence tracks every open connection per user. UserToClient only holds the
+// newest one on this instance, which is where per-user messages go; an older
+// tab stays in the session registry until its socket closes. Sessions on other
+// instances are found through the socket bus.
+const (
+	// sessionEndedCloseCode tells the frontend not to reconnect
+	sessionEndedCloseCode = 4001
+	serviceNoticeChannel  = "socket_service_notice"
+)
+
+var (
+	sessionsMu sync.RWMutex
+	sessions   = make(map[int]map[string]*Client)
+)
+
+// ConnectionInfo describes one open WebSocket connection of a user
+type ConnectionInfo struct {
+	SessionID   string `json:"sessionId"`
+	ConnectedAt int64  `json:"connectedAt"`
+	RemoteAddr  string `json:"remoteAddr"`
+	UserAgent   string `json:"userAgent"`
+	// Primary is the connection per-user messages (alerts, chat) are sent to
+	Primary bool `json:"primary"`
+}
+
+// ServiceNotice is a message shown to every connected user
+type ServiceNotice struct {
+	Channel   string `json:"channel"`
+	Type      string `json:"type"` // info or warning
+	Message   string `json:"message"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type sessionHello struct {
+	Channel   string `json:"channel"`
+	SessionID string `json:"sessionId"`
+}
+
+func registerSession(c *Client) {
+	sessionsMu.Lock()
+	m := sessions[c.userID]
+	if m == nil {
+		m = make(map[string]*Client)
+		sessions[c.userID] = m
+	}
+	m[c.sessionID] = c
+	sessionsMu.Unlock()
+	registerBusSession(c)
+
+	// Let the client know which session it is so it can tell itself apart
+	// in the connection list
+	if b, err := json.Marshal(sessionHello{Channel: "session", SessionID: c.sessionID}); err == nil {
+		select {
+		case c.send <- b:
+		default:
+		}
+	}
+}
+
+func unregisterSession(c *Client) {
+	sessionsMu.Lock()
+	if m := sessions[c.userID]; m != nil {
+		delete(m, c.sessionID)
+		if len(m) == 0 {
+			delete(sessions, c.userID)
+		}
+	}
+	sessionsMu.Unlock()
+	unregisterBusSession(c)
+}
+
+func (c *Client) info() ConnectionInfo {
+	return ConnectionInfo{
+		SessionID:   c.sessionID,
+		ConnectedAt: c.connectedAt.UnixMilli(),
+		RemoteAddr:  c.remoteAddr,
+		UserAgent:   c.userAgent,
+	}
+}
+
+// IsUserOnline reports whether the user has an open WebSocket connection on
+// any instance
+func IsUserOnline(userID int) bool {
+	UserToClientMutex.RLock()
+	_, ok := UserToClient[userID]
+	UserToClientMutex.RUnlock()
+	return ok || remoteInstanceFor(userID) != ""
+}
+
+// ListConnections returns the user's open connections on every instance,
+// newest first
+func ListConnections(userID int) []ConnectionInfo {
+	UserToClientMutex.RLock()
+	primary := UserToClient[userID]
+	UserToClientMutex.RUnlock()
+
+	sessionsMu.RLock()
+	conns := make([]ConnectionInfo, 0, len(sessions[userID]))
+	for _, c := range sessions[userID] {
+		info := c.info()
+		info.Primary = c == primary
+		conns = append(conns, info)
+	}
+	sessionsMu.RUnlock()
+
+	if conn := busConn.Load(); conn != nil {
+		remote := remoteSessions(conn, userID)
+		// Without a local connection, per-user messages go to the newest remote one
+		newest := -1
+		for i, s := range remote {
+			if newest < 0 || s.ConnectedAt > remote[newest].ConnectedAt {
+				newest = i
+			}
+		}
+		for i, s := range remote {
+			info := s.ConnectionInfo
+			info.Primary = primary == nil && i == newest
+			conns = append(conns, info)
+		}
+	}
+	sort.Slice(conns, func(i, j int) bool { return conns[i].ConnectedAt > conns[j].ConnectedAt })
+	return conns
+}
+
+// DisconnectSession closes one of the user's connections, on whichever
+// instance holds it. The close code tells the frontend the session was ended
+// on purpose so it doesn't reconnect.
+func DisconnectSession(userID int, sessionID string) error {
+	err := disconnectLocalSession(userID, sessionID)
+	if err == nil {
+		return nil
+	}
+	conn := busConn.Load()
+	if conn == nil {
+		return err
+	}
+	for _, s := range remoteSessions(conn, userID) {
+		if s.SessionID == sessionID {
+			return busPublish(conn, busChannel(s.Instance), busEnvelope{Kind: busKindDisconnect, UserID: userID, SessionID: sessionID})
+		}
+	}
+	return err
+}
+
+// EndAuthSession closes every connection opened with a token of the given
+// login session, or with any of the user's tokens when authSession is "", on
+// every instance. It is called when the session is revoked.
+func EndAuthSession(userID int, authSession string) {
+	endLocalAuthSession(userID, authSession)
+	conn := busConn.Load()
+	if conn == nil {
+		return
+	}
+	env := busEnvelope{Kind: busKindEndAuth, UserID: userID, SessionID: authSession}
+	if err := busPublish(conn, busAllChannel, env); err != nil {
+		log.Printf("⚠️ Socket bus end of login session failed: %v", err)
+	}
+}
+
+func endLocalAuthSession(userID int, authSession string) {
+	sessionsMu.RLock()
+	var ended []string
+	for id, c := range sessions[userID] {
+		if authSession == "" || c.authSession == authSession {
+			ended = append(ended, id)
+		}
+	}
+	sessionsMu.RUnlock()
+	for _, id := range ended {
+		if err := disconnectLocalSession(userID, id); err != nil {
+			log.Printf("⚠️ Error ending session %s of user %d: %v", id, userID, err)
+		}
+	}
+}
+
+func disconnectLocalSession(userID int, sessionID string) error {
+	sessionsMu.RLock()
+	c, ok := sessions[userID][sessionID]
+	sessionsMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("session not found")
+	}
+	msg := websocket.FormatCloseMessage(sessionEndedCloseCode, "session ended")
+	if err := c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second)); err != nil {
+		log.Printf("⚠️ Error sending close to session %s of user %d: %v", sessionID, userID, err)
+	}
+	// readPump sees the closed socket and runs the usual cleanup
+	return c.ws.Close()
+}
+
+// BroadcastNotice sends a service notice to every open connection on this server
+func BroadcastNotice(noticeType, message string) int {
+	b, err := json.Marshal(ServiceNotice{
+		Channel:   "notice",
+		Type:      noticeType,
+		Message:   message,
+		Timestamp: time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return 0
+	}
+	sessionsMu.RLock()
+	defer sessionsMu.RUnlock()
+	sent := 0
+	for _, m := range sessions {
+		for _, c := range m {
+			select {
+			case c.send <- b:
+				sent++
+			default:
+			}
+		}
+	}
+	return sent
+}
+
+// SendNoticeToUser sends a notice to one user's connections, wherever they
+// are connected; false means the user has no open connection
+func SendNoticeToUser(userID int, noticeType, message string) bool {
+	b, err := json.Marshal(ServiceNotice{
+		Channel:   "notice",
+		Type:      noticeType,
+		Message:   message,
+		Timestamp: time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return false
+	}
+	return sendToUser(userID, b)
+}
+
+// PublishServiceNotice asks every running server to broadcast a notice
+func PublishServiceNotice(ctx context.Context, conn *data.Conn, noticeType, message string) error {
+	b, err := json.Marshal(ServiceNotice{Type: noticeType, Message: message})
+	if err != nil {
+		return err
+	}
+	return conn.Cache.Publish(ctx, serviceNoticeChannel, b).Err()
+}
+
+// StartNoticeListener broadcasts notices published with PublishServiceNotice
+func StartNoticeListener(conn *data.Conn) {
+	go func() {
+		ctx := context.Background()
+		pubsub := conn.Cache.Subscribe(ctx, serviceNoticeChannel)
+		defer pubsub.Close()
+		for msg := range pubsub.Channel() {
+			var n ServiceNotice
+			if err := json.Unmarshal([]byte(msg.Payload), &n); err != nil || n.Message == "" {
+				log.Printf("⚠️ Ignoring malformed service notice: %v", err)
+				continue
+			}
+			sent := BroadcastNotice(n.Type, n.Message)
+			log.Printf("📢 Service notice sent to %d connections: %s", sent, n.Message)
+		}
+	}()
+}
+
+// GetConnections lists the calling user's open connections
+func GetConnections(_ *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	return ListConnections(userID), nil
+}
+
+// DisconnectConnectionArgs represents the arguments for DisconnectConnection
+type DisconnectConnectionArgs struct {
+	SessionID string `json:"sessionId"`
+}
+
+// DisconnectConnection ends one of the calling user's connections
+func DisconnectConnection(_ *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args DisconnectConnectionArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("invalid args: %v", err)
+	}
+	if args.SessionID == "" {
+		return nil, fmt.Errorf("sessionId is required")
+	}
+	if err := DisconnectSession(userID, args.SessionID); err != nil {
+		return nil, err
+	}
+	return map[string]bool{"disconnected": true}, nil
+}
@@ -0,0 +1,367 @@
+package socket
+
+import (
+	"backend/internal/breaker"
+	"backend/internal/data"
+	"backend/internal/data/edgar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/polygon-io/client-go/rest/models"
+)
+
+// Security event subscriptions. A chart subscribes to the security it shows
+// and, while it stays subscribed, receives its new SEC filings, dividends,
+// splits and news on the "security-events:<securityId>" channel. The
+// subscription is an ordinary channel subscription, so it ends with the
+// connection. Filings arrive from the EDGAR feed on whichever instance runs
+// the scheduler and reach every instance over the bus; dividends, splits and
+// news are polled from Polygon by each instance for the securities its own
+// connections watch, and only events newer than the start of the watch are
+// sent since the chart already loaded the history.
+const (
+	securityEventsPrefix      = "security-events:"
+	maxSecurityEventSubs      = 10 // per connection
+	securityNewsInterval      = 2 * time.Minute
+	securityActionsInterval   = 15 * time.Minute
+	securityEventPollTimeout  = 30 * time.Second
+	securityEventRecentLookup = 10 // most recent dividends and splits compared each poll
+)
+
+// Security event types
+const (
+	SecurityEventFiling   = "filing"
+	SecurityEventDividend = "dividend"
+	SecurityEventSplit    = "split"
+	SecurityEventNews     = "news"
+)
+
+// SecurityEvent is one new event of a watched security
+type SecurityEvent struct {
+	Type       string      `json:"type"`
+	ID         string      `json:"id"`
+	SecurityID int         `json:"securityId"`
+	Ticker     string      `json:"ticker"`
+	Timestamp  int64       `json:"timestamp"` // UTC milliseconds
+	Data       interface{} `json:"data"`
+}
+
+// watchedSecurity is a security some connection of this instance watches
+type watchedSecurity struct {
+	securityID  int
+	ticker      string
+	seen        map[string]bool // dividends and splits already known
+	lastNews    time.Time       // news before the watch started is history
+	lastActions time.Time
+}
+
+var (
+	watchedMu         sync.Mutex
+	watchedSecurities = make(map[int]*watchedSecurity)
+	watcherOnce       sync.Once
+)
+
+func securityEventsChannel(securityID int) string {
+	return securityEventsPrefix + strconv.Itoa(securityID)
+}
+
+// subscribeSecurityEvents starts sending the client the new events of a
+// security
+func (c *Client) subscribeSecurityEvents(conn *data.Conn, securityID int) {
+	channelName := securityEventsChannel(securityID)
+	if _, exists := c.subscribedChannels[channelName]; exists {
+		return
+	}
+	watching := 0
+	for name := range c.subscribedChannels {
+		if strings.HasPrefix(name, securityEventsPrefix) {
+			watching++
+		}
+	}
+	if watching >= maxSecurityEventSubs {
+		c.sendSecurityEventsError(securityID, fmt.Sprintf("at most %d securities can be watched at once", maxSecurityEventSubs))
+		return
+	}
+	if err := watchSecurity(conn, securityID); err != nil {
+		log.Printf("⚠️ Watching security %d for events: %v", securityID, err)
+		c.sendSecurityEventsError(securityID, "security not found")
+		return
+	}
+
+	channelsMutex.Lock()
+	if _, exists := channelSubscribers[channelName]; !exists {
+		channelSubscribers[channelName] = make(map[*Client]bool)
+	}
+	channelSubscribers[channelName][c] = true
+	incListeners(channelName)
+	c.addSubscribedChannel(channelName)
+	channelsMutex.Unlock()
+}
+
+// unsubscribeSecurityEvents stops sending the client a security's events
+func (c *Client) unsubscribeSecurityEvents(securityID int) {
+	channelName := securityEventsChannel(securityID)
+	if _, exists := c.subscribedChannels[channelName]; !exists {
+		return
+	}
+	c.unsubscribeRealtime(channelName)
+}
+
+func (c *Client) sendSecurityEventsError(securityID int, message string) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"channel": securityEventsChannel(securityID),
+		"error":   message,
+	})
+	if err != nil {
+		return
+	}
+	select {
+	case c.send <- payload:
+	default:
+	}
+}
+
+// watchSecurity starts watching a security for events unless this instance
+// already does, and starts the watcher on first use
+func watchSecurity(conn *data.Conn, securityID int) error {
+	watchedMu.Lock()
+	_, ok := watchedSecurities[securityID]
+	watchedMu.Unlock()
+	if ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var ticker string
+	if err := conn.DB.QueryRow(ctx, `
+		SELECT ticker FROM securities WHERE securityid = $1 ORDER BY maxdate DESC NULLS FIRST LIMIT 1`,
+		securityID).Scan(&ticker); err != nil {
+		return fmt.Errorf("error looking up security %d: %v", securityID, err)
+	}
+
+	now := time.Now()
+	watchedMu.Lock()
+	if _, ok := watchedSecurities[securityID]; !ok {
+		watchedSecurities[securityID] = &watchedSecurity{
+			securityID: securityID,
+			ticker:     ticker,
+			lastNews:   now,
+		}
+	}
+	watchedMu.Unlock()
+
+	watcherOnce.Do(func() { go runSecurityEventWatcher(conn) })
+	return nil
+}
+
+// runSecurityEventWatcher polls Polygon for the watched securities' events,
+// dropping the securities no connection watches anymore
+func runSecurityEventWatcher(conn *data.Conn) {
+	ticker := time.NewTicker(securityNewsInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		watchedMu.Lock()
+		var due []*watchedSecurity
+		for id, w := range watchedSecurities {
+			if !hasListeners(securityEventsChannel(id)) {
+				delete(watchedSecurities, id)
+				continue
+			}
+			due = append(due, w)
+		}
+		watchedMu.Unlock()
+
+		// Wait out Polygon outages and rate limiting rather than add to them
+		if len(due) == 0 || !breaker.Polygon.Healthy() {
+			continue
+		}
+		for _, w := range due {
+			pollSecurityEvents(conn, w)
+		}
+	}
+}
+
+// pollSecurityEvents sends the news, and every securityActionsInterval the
+// dividends and splits, that appeared since the last poll of a security
+func pollSecurityEvents(conn *data.Conn, w *watchedSecurity) {
+	ctx, cancel := context.WithTimeout(context.Background(), securityEventPollTimeout)
+	defer cancel()
+
+	var events []SecurityEvent
+	news, err := newSecurityNews(ctx, conn, w)
+	if err != nil {
+		log.Printf("⚠️ Polling news of %s: %v", w.ticker, err)
+	}
+	events = append(events, news...)
+
+	if time.Since(w.lastActions) >= securityActionsInterval {
+		actions, err := newCorporateActions(ctx, conn, w)
+		if err != nil {
+			log.Printf("⚠️ Polling dividends and splits of %s: %v", w.ticker, err)
+		} else {
+			w.lastActions = time.Now()
+			events = append(events, actions...)
+		}
+	}
+	for _, ev := range events {
+		sendSecurityEvent(ev)
+	}
+}
+
+func newSecurityNews(ctx context.Context, conn *data.Conn, w *watchedSecurity) ([]SecurityEvent, error) {
+	params := models.ListTickerNewsParams{}.
+		WithTicker(models.EQ, w.ticker).
+		WithSort(models.PublishedUTC).
+		WithOrder(models.Asc).
+		WithLimit(20).
+		WithPublishedUTC(models.GT, models.Millis(w.lastNews))
+	iter := conn.Polygon.ListTickerNews(ctx, params)
+	var events []SecurityEvent
+	for iter.Next() {
+		article := iter.Item()
+		published := time.Time(article.PublishedUTC)
+		if published.After(w.lastNews) {
+			w.lastNews = published
+		}
+		events = append(events, SecurityEvent{
+			Type:       SecurityEventNews,
+			ID:         "news_" + article.ID,
+			SecurityID: w.securityID,
+			Ticker:     w.ticker,
+			Timestamp:  published.UnixMilli(),
+			Data: map[string]interface{}{
+				"title":     article.Title,
+				"url":       article.ArticleURL,
+				"publisher": article.Publisher.Name,
+				"imageUrl":  article.ImageURL,
+			},
+		})
+	}
+	return events, iter.Err()
+}
+
+// newCorporateActions returns the dividends and splits not seen before. The
+// first poll of a watch only records what is already there.
+func newCorporateActions(ctx context.Context, conn *data.Conn, w *watchedSecurity) ([]SecurityEvent, error) {
+	var found []SecurityEvent
+
+	divIter := conn.Polygon.ListDividends(ctx, models.ListDividendsParams{}.
+		WithTicker(models.EQ, w.ticker).WithOrder(models.Desc).WithLimit(securityEventRecentLookup))
+	for n := 0; n < securityEventRecentLookup && divIter.Next(); n++ {
+		d := divIter.Item()
+		found = append(found, SecurityEvent{
+			Type:      SecurityEventDividend,
+			ID:        fmt.Sprintf("dividend_%s-%.4f", d.ExDividendDate, d.CashAmount),
+			Timestamp: time.Time(d.DeclarationDate).UnixMilli(),
+			Data: map[string]interface{}{
+				"amount":          d.CashAmount,
+				"exDate":          d.ExDividendDate,
+				"payDate":         time.Time(d.PayDate).Format("2006-01-02"),
+				"declarationDate": time.Time(d.DeclarationDate).Format("2006-01-02"),
+			},
+		})
+	}
+	if err := divIter.Err(); err != nil {
+		return nil, err
+	}
+
+	splitIter := conn.Polygon.ListSplits(ctx, models.ListSplitsParams{}.
+		WithTicker(models.EQ, w.ticker).WithOrder(models.Desc).WithLimit(securityEventRecentLookup))
+	for n := 0; n < securityEventRecentLookup && splitIter.Next(); n++ {
+		s := splitIter.Item()
+		date := time.Time(s.ExecutionDate)
+		ratio := fmt.Sprintf("%d:%d", int(math.Round(s.SplitTo)), int(math.Round(s.SplitFrom)))
+		found = append(found, SecurityEvent{
+			Type:      SecurityEventSplit,
+			ID:        fmt.Sprintf("split_%s-%s", date.Format("2006-01-02"), ratio),
+			Timestamp: date.UnixMilli(),
+			Data: map[string]interface{}{
+				"ratio": ratio,
+				"date":  date.Format("2006-01-02"),
+			},
+		})
+	}
+	if err := splitIter.Err(); err != nil {
+		return nil, err
+	}
+
+	first := w.seen == nil
+	if first {
+		w.seen = make(map[string]bool)
+	}
+	var events []SecurityEvent
+	for _, ev := range found {
+		if w.seen[ev.ID] {
+			continue
+		}
+		w.seen[ev.ID] = true
+		if !first {
+			ev.SecurityID, ev.Ticker = w.securityID, w.ticker
+			events = append(events, ev)
+		}
+	}
+	return events, nil
+}
+
+// BroadcastSecurityFiling sends a new SEC filing to the connections watching
+// its security, on every instance
+func BroadcastSecurityFiling(filing edgar.GlobalEDGARFiling) {
+	ev := SecurityEvent{
+		Type:      SecurityEventFiling,
+		ID:        "filing_" + filing.URL,
+		Ticker:    filing.Ticker,
+		Timestamp: filing.Timestamp,
+		Data: map[string]interface{}{
+			"type": filing.Type,
+			"date": filing.Date,
+			"url":  filing.URL,
+		},
+	}
+	deliverTickerEvent(ev)
+	if conn := busConn.Load(); conn != nil {
+		payload, err := json.Marshal(ev)
+		if err != nil {
+			return
+		}
+		if err := busPublish(conn, busAllChannel, busEnvelope{Kind: busKindSecurityEvent, Payload: payload}); err != nil {
+			log.Printf("⚠️ Socket bus publish of %s filing: %v", filing.Ticker, err)
+		}
+	}
+}
+
+// deliverTickerEvent sends an event known by ticker to the local connections
+// watching a security with that ticker
+func deliverTickerEvent(ev SecurityEvent) {
+	watchedMu.Lock()
+	var ids []int
+	for id, w := range watchedSecurities {
+		if w.ticker == ev.Ticker {
+			ids = append(ids, id)
+		}
+	}
+	watchedMu.Unlock()
+	for _, id := range ids {
+		ev.SecurityID = id
+		sendSecurityEvent(ev)
+	}
+}
+
+func sendSecurityEvent(ev SecurityEvent) {
+	channelName := securityEventsChannel(ev.SecurityID)
+	payload, err := json.Marshal(map[string]interface{}{
+		"channel": channelName,
+		"data":    ev,
+	})
+	if err != nil {
+		return
+	}
+	broadcastToChannel(channelName, string(payload))
+}
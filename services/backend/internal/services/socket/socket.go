@@ -115,6 +115,14 @@ type Client struct {
 	lastTickTime          time.Time
 	// userID associated with this client connection
 	userID int
+	// session details for the presence API
+	sessionID   string
+	authSession string // login session of the token the socket connected with
+	connectedAt time.Time
+	remoteAddr  string
+	userAgent   string
+	// barReplay is the client's active bar replay, if any
+	barReplay *barReplaySession
 }
 
 /*
@@ -147,22 +155,28 @@ type AlertMessage struct {
 	Channel    string   `json:"channel"`
 	Type       string   `json:"type"`
 	Tickers    []string `json:"tickers"`
+	// LogID is the alert_logs row, for "was this alert useful?" feedback
+	LogID int `json:"logId,omitempty"`
+	// DeliveryID is acked by the client and dedups repeats; set by
+	// SendAlertToUser unless the caller gives one
+	DeliveryID string `json:"deliveryId,omitempty"`
 }
 
-// SendAlertToUser performs operations related to SendAlertToUser functionality.
-func SendAlertToUser(userID int, alert AlertMessage) {
+// SendAlertToUser sends an alert to the user's connection, queueing it for
+// replay on reconnect if the user is offline or never acks it. It returns the
+// delivery ID the client will ack, or "" if the alert could not be encoded.
+// An alert resent with the same DeliveryID is shown once.
+func SendAlertToUser(userID int, alert AlertMessage) string {
+	if alert.DeliveryID == "" {
+		alert.DeliveryID = randomID()
+	}
 	jsonData, err := json.Marshal(alert)
-	if err == nil {
-		UserToClientMutex.RLock()
-		client, ok := UserToClient[userID]
-		UserToClientMutex.RUnlock()
-		if !ok {
-			////fmt.Println("client not found")
-			return
-		}
-		client.send <- jsonData
-		fmt.Println("Sent alert to user", alert.Message, userID)
+	if err != nil {
+		fmt.Println("Error marshaling alert:", err)
+		return ""
 	}
+	deliverToUser(userID, &pendingDelivery{id: alert.DeliveryID, payload: jsonData, createdAt: time.Now()})
+	return alert.DeliveryID
 }
 
 // SendAlertToAllUsers sends an alert to all connected users
@@ -173,21 +187,11 @@ func SendAlertToAllUsers(alert AlertMessage) {
 		return
 	}
 
-	UserToClientMutex.RLock()
-	defer UserToClientMutex.RUnlock()
+	userCount := sendToAllLocal(jsonData)
+	// Other instances send it to their own connections
+	publishToAll(jsonData)
 
-	userCount := 0
-	for _, client := range UserToClient {
-		if client != nil {
-			select {
-			case client.send <- jsonData:
-				userCount++
-			default:
-			}
-		}
-	}
-
-	fmt.Printf("Sent global alert to %d users: %s\n", userCount, alert.Message)
+	fmt.Printf("Sent global alert to %d local users: %s\n", userCount, alert.Message)
 }
 
 type ChatInitializationUpdate struct {
@@ -207,19 +211,11 @@ func SendChatInitializationUpdate(userID int, messageID string, conversationID s
 		////fmt.Printf("Error marshaling chat initialization update: %v\n", err)
 		return
 	}
-	UserToClientMutex.RLock()
-	client, ok := UserToClient[userID]
-	UserToClientMutex.RUnlock()
-	if !ok {
-		////fmt.Printf("SendChatInitializationUpdate: client not found for userID: %d\n", userID)
+	if !sendToUser(userID, jsonData) {
+		////fmt.Printf("SendChatInitializationUpdate: user not connected or send buffer full for userID: %d\n", userID)
 		return
 	}
-	select {
-	case client.send <- jsonData:
-		////fmt.Printf("Sent chat initialization update to user %d: '%s'\n", userID, messageID)
-	default:
-		////fmt.Printf("SendChatInitializationUpdate: send channel blocked or closed for userID: %d. Dropping chat initialization update.\n", userID)
-	}
+	////fmt.Printf("Sent chat initialization update to user %d: '%s'\n", userID, messageID)
 }
 
 // AgentStatusUpdate represents a status update message sent to the client
@@ -297,24 +293,11 @@ func SendAgentStatusUpdate(userID int, statusType string, value interface{}) {
 		return
 	}
 
-	UserToClientMutex.RLock()
-	client, ok := UserToClient[userID]
-	UserToClientMutex.RUnlock()
-
-	if !ok {
-		////fmt.Printf("SendAgentStatusUpdate: client not found for userID: %d\n", userID)
+	if !sendToUser(userID, jsonData) {
+		////fmt.Printf("SendAgentStatusUpdate: user not connected or send buffer full for userID: %d\n", userID)
 		return
 	}
-
-	// Send the update non-blockingly
-	select {
-	case client.send <- jsonData:
-		////fmt.Printf("Sent status message to user %d: '%s'\n", userID, messageToSend)
-	default:
-		// This might happen if the client's send buffer is full or the connection is closing.
-		// It's usually okay to just drop the status update in this case.
-		////fmt.Printf("SendAgentStatusUpdate: send channel blocked or closed for userID: %d. Dropping status update.\n", userID)
-	}
+	////fmt.Printf("Sent status message to user %d: '%s'\n", userID, messageToSend)
 }
 
 // TitleUpdate represents a conversation title update message sent to the client
@@ -339,23 +322,11 @@ func SendTitleUpdate(userID int, conversationID string, title string) {
 		return
 	}
 
-	UserToClientMutex.RLock()
-	client, ok := UserToClient[userID]
-	UserToClientMutex.RUnlock()
-
-	if !ok {
-		////fmt.Printf("SendTitleUpdate: client not found for userID: %d\n", userID)
+	if !sendToUser(userID, jsonData) {
+		////fmt.Printf("SendTitleUpdate: user not connected or send buffer full for userID: %d\n", userID)
 		return
 	}
-
-	// Send the update non-blockingly
-	select {
-	case client.send <- jsonData:
-		////fmt.Printf("Sent title update to user %d for conversation %s: '%s'\n", userID, conversationID, title)
-	default:
-		// Drop the title update if the channel is full - it's not critical
-		////fmt.Printf("SendTitleUpdate: send channel blocked for userID: %d. Dropping title update.\n", userID)
-	}
+	////fmt.Printf("Sent title update to user %d for conversation %s: '%s'\n", userID, conversationID, title)
 }
 
 // NEW: Dynamic update message types and broadcasting functions
@@ -378,6 +349,14 @@ type HorizontalLineUpdate struct {
 	Line       map[string]interface{} `json:"line"`
 }
 
+// ChartDrawingUpdate represents a chart drawing update message sent to the client
+type ChartDrawingUpdate struct {
+	Type       string      `json:"type"` // Will be "chart_drawing_update"
+	Action     string      `json:"action"`
+	SecurityID int         `json:"securityId"`
+	Drawing    interface{} `json:"drawing"`
+}
+
 // AlertUpdate represents an alert update message sent to the client
 type AlertUpdate struct {
 	Type   string                 `json:"type"` // Will be "alert_update"
@@ -411,22 +390,11 @@ func SendWatchlistUpdate(userID int, action string, watchlistID *int, watchlistN
 		return
 	}
 
-	UserToClientMutex.RLock()
-	client, ok := UserToClient[userID]
-	UserToClientMutex.RUnlock()
-
-	if !ok {
-		fmt.Printf("❌ SendWatchlistUpdate: client not found for userID: %d\n", userID)
+	if !sendToUser(userID, jsonData) {
+		fmt.Printf("❌ SendWatchlistUpdate: user not connected or send buffer full for userID: %d\n", userID)
 		return
 	}
-
-	// Send the update non-blockingly
-	select {
-	case client.send <- jsonData:
-		fmt.Printf("✅ Sent watchlist update to user %d: %s\n", userID, action)
-	default:
-		fmt.Printf("⚠️ SendWatchlistUpdate: send channel blocked for userID: %d. Dropping update.\n", userID)
-	}
+	fmt.Printf("✅ Sent watchlist update to user %d: %s\n", userID, action)
 }
 
 // SendHorizontalLineUpdate sends a horizontal line update to a specific user
@@ -446,22 +414,35 @@ func SendHorizontalLineUpdate(userID int, action string, securityID int, line ma
 		return
 	}
 
-	UserToClientMutex.RLock()
-	client, ok := UserToClient[userID]
-	UserToClientMutex.RUnlock()
+	if !sendToUser(userID, jsonData) {
+		fmt.Printf("❌ SendHorizontalLineUpdate: user not connected or send buffer full for userID: %d\n", userID)
+		return
+	}
+	fmt.Printf("✅ Sent horizontal line update to user %d: %s\n", userID, action)
+}
+
+// SendChartDrawingUpdate sends a chart drawing update to a specific user
+func SendChartDrawingUpdate(userID int, action string, securityID int, drawing interface{}) {
+	fmt.Printf("✏️ Sending chart drawing update to user %d: %s (securityID: %d)\n", userID, action, securityID)
+
+	update := ChartDrawingUpdate{
+		Type:       "chart_drawing_update",
+		Action:     action,
+		SecurityID: securityID,
+		Drawing:    drawing,
+	}
 
-	if !ok {
-		fmt.Printf("❌ SendHorizontalLineUpdate: client not found for userID: %d\n", userID)
+	jsonData, err := json.Marshal(update)
+	if err != nil {
+		fmt.Printf("❌ Error marshaling chart drawing update: %v\n", err)
 		return
 	}
 
-	// Send the update non-blockingly
-	select {
-	case client.send <- jsonData:
-		fmt.Printf("✅ Sent horizontal line update to user %d: %s\n", userID, action)
-	default:
-		fmt.Printf("⚠️ SendHorizontalLineUpdate: send channel blocked for userID: %d. Dropping update.\n", userID)
+	if !sendToUser(userID, jsonData) {
+		fmt.Printf("❌ SendChartDrawingUpdate: user not connected or send buffer full for userID: %d\n", userID)
+		return
 	}
+	fmt.Printf("✅ Sent chart drawing update to user %d: %s\n", userID, action)
 }
 
 // SendAlertUpdate sends an alert update to a specific user
@@ -480,22 +461,11 @@ func SendAlertUpdate(userID int, action string, alert map[string]interface{}) {
 		return
 	}
 
-	UserToClientMutex.RLock()
-	client, ok := UserToClient[userID]
-	UserToClientMutex.RUnlock()
-
-	if !ok {
-		fmt.Printf("❌ SendAlertUpdate: client not found for userID: %d\n", userID)
+	if !sendToUser(userID, jsonData) {
+		fmt.Printf("❌ SendAlertUpdate: user not connected or send buffer full for userID: %d\n", userID)
 		return
 	}
-
-	// Send the update non-blockingly
-	select {
-	case client.send <- jsonData:
-		fmt.Printf("✅ Sent alert update to user %d: %s\n", userID, action)
-	default:
-		fmt.Printf("⚠️ SendAlertUpdate: send channel blocked for userID: %d. Dropping update.\n", userID)
-	}
+	fmt.Printf("✅ Sent alert update to user %d: %s\n", userID, action)
 }
 
 // SendStrategyUpdate sends a strategy update to a specific user
@@ -514,22 +484,11 @@ func SendStrategyUpdate(userID int, action string, strategy map[string]interface
 		return
 	}
 
-	UserToClientMutex.RLock()
-	client, ok := UserToClient[userID]
-	UserToClientMutex.RUnlock()
-
-	if !ok {
-		fmt.Printf("❌ SendStrategyUpdate: client not found for userID: %d\n", userID)
+	if !sendToUser(userID, jsonData) {
+		fmt.Printf("❌ SendStrategyUpdate: user not connected or send buffer full for userID: %d\n", userID)
 		return
 	}
-
-	// Send the update non-blockingly
-	select {
-	case client.send <- jsonData:
-		fmt.Printf("✅ Sent strategy update to user %d: %s\n", userID, action)
-	default:
-		fmt.Printf("⚠️ SendStrategyUpdate: send channel blocked for userID: %d. Dropping update.\n", userID)
-	}
+	fmt.Printf("✅ Sent strategy update to user %d: %s\n", userID, action)
 }
 
 func (c *Client) writePump() {
@@ -605,6 +564,11 @@ func (c *Client) readPump(conn *data.Conn) {
 			Context            []map[string]interface{} `json:"context,omitempty"`
 			ActiveChartContext map[string]interface{}   `json:"activeChartContext,omitempty"`
 			ConversationID     string                   `json:"conversation_id,omitempty"`
+			// Alert acknowledgment
+			DeliveryID string `json:"deliveryId,omitempty"`
+			// Bar replay and security event fields
+			SecurityID *int   `json:"securityId,omitempty"`
+			Resolution string `json:"resolution,omitempty"`
 		}
 		if err := json.Unmarshal(message, &clientMsg); err != nil {
 			////fmt.Println("Invalid message format", err)
@@ -616,6 +580,14 @@ func (c *Client) readPump(conn *data.Conn) {
 			c.subscribeSECFilings(conn)
 		case "unsubscribe-sec-filings":
 			c.unsubscribeSECFilings()
+		case "subscribe-security-events":
+			if clientMsg.SecurityID != nil {
+				c.subscribeSecurityEvents(conn, *clientMsg.SecurityID)
+			}
+		case "unsubscribe-security-events":
+			if clientMsg.SecurityID != nil {
+				c.unsubscribeSecurityEvents(*clientMsg.SecurityID)
+			}
 		case "subscribe":
 			if c.replayActive {
 				c.subscribeReplay(clientMsg.ChannelName)
@@ -655,6 +627,26 @@ func (c *Client) readPump(conn *data.Conn) {
 			if c.replayActive {
 				c.replayExtendedHours = *(clientMsg.ExtendedHours)
 			}
+		case "ack":
+			AckDelivery(c, clientMsg.DeliveryID)
+		case "barReplayStart":
+			if clientMsg.SecurityID != nil && clientMsg.Timestamp != nil {
+				speed := 1.0
+				if clientMsg.Speed != nil {
+					speed = *clientMsg.Speed
+				}
+				c.startBarReplay(*clientMsg.SecurityID, *clientMsg.Timestamp, speed, clientMsg.Resolution)
+			}
+		case "barReplayPause":
+			c.withBarReplay(func(s *barReplaySession) { s.setPaused(true) })
+		case "barReplayResume":
+			c.withBarReplay(func(s *barReplaySession) { s.setPaused(false) })
+		case "barReplaySpeed":
+			if clientMsg.Speed != nil {
+				c.withBarReplay(func(s *barReplaySession) { s.setSpeed(*clientMsg.Speed) })
+			}
+		case "barReplayStop":
+			c.stopBarReplay()
 		case "chat_query":
 			c.HandleChatQuery(clientMsg.RequestID, clientMsg.Query, clientMsg.Context, clientMsg.ActiveChartContext, clientMsg.ConversationID)
 		default:
@@ -719,6 +711,7 @@ func (c *Client) close() {
 	if replayWasActive {
 		c.stopReplay() // Needs to happen after unlocking mu if stopReplay uses it
 	}
+	c.stopBarReplay()
 
 	// Re-lock for map/channel cleanup? Let's assume stopReplay and unsubscribe handle their own locking
 	c.mu.Lock()
@@ -742,15 +735,29 @@ func (c *Client) close() {
 		c.removeSubscribedChannel(channelName)
 	}
 
-	// Remove the client from the UserToClient map using the stored userID
+	unregisterSession(c)
+
+	// Remove the client from the UserToClient map using the stored userID,
+	// unless a newer connection for the user has already replaced it
 	UserToClientMutex.Lock()
-	delete(UserToClient, c.userID)
+	current, ok := UserToClient[c.userID]
+	if ok && current == c {
+		delete(UserToClient, c.userID)
+	}
 	UserToClientMutex.Unlock()
 
+	// Alerts this connection never acked go back on the queue; hand them to
+	// the user's newer connection if there is one, here or on another instance
+	requeueUnacked(c)
+	if ok && current != c {
+		replayQueued(current)
+	} else if remote := remoteInstanceFor(c.userID); remote != "" {
+		forwardQueued(c.userID, remote)
+	}
 }
 
 // HandleWebSocket performs operations related to HandleWebSocket functionality.
-func HandleWebSocket(conn *data.Conn, ws *websocket.Conn, userID int) {
+func HandleWebSocket(conn *data.Conn, ws *websocket.Conn, userID int, authSession, remoteAddr, userAgent string) {
 	client := &Client{
 		ws:                  ws,
 		send:                make(chan []byte, 10000), // Increase buffer for large chat responses
@@ -767,15 +774,22 @@ func HandleWebSocket(conn *data.Conn, ws *websocket.Conn, userID int) {
 		subscribedChannels:  make(map[string]struct{}),
 		lastTickTime:        time.Time{},
 		userID:              userID,
+		sessionID:           randomID(),
+		authSession:         authSession,
+		connectedAt:         time.Now(),
+		remoteAddr:          remoteAddr,
+		userAgent:           userAgent,
 	}
 
 	// Store the client in the userToClient map
 	UserToClientMutex.Lock()
 	UserToClient[userID] = client
 	UserToClientMutex.Unlock()
+	registerSession(client)
 
 	// Start the writePump and readPump goroutines
 	go client.writePump()
+	replayQueued(client)
 	client.readPump(conn)
 }
 
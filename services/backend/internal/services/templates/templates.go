@@ -0,0 +1,286 @@
+// Package templates renders the text of alert and system notifications from
+// named templates, in the user's language and in a variant per channel.
+//
+// Each supported locale has a catalog in locales/<locale>.json mapping a
+// template name to its variants: "text" is the plain message shown in the app
+// and stored in the alert log, and a channel may override it with its own
+// ("telegram" for a short message, "email_subject" and "email" for a rich
+// HTML email). Variants use text/template syntax; email bodies are parsed as
+// html/template so variables are escaped. A missing variant falls back to the
+// locale's text, then to English.
+package templates
+
+import (
+	"backend/internal/data"
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"log"
+	"math"
+	"path"
+	"strings"
+	texttemplate "text/template"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Name identifies a notification template
+type Name string
+
+// Alert and system notification templates; the comment lists each one's
+// variables
+const (
+	Literal        Name = "literal"         // Text: a message already written out
+	PriceAbove     Name = "price_above"     // Ticker, Price
+	PriceBelow     Name = "price_below"     // Ticker, Price
+	VWAPCross      Name = "vwap_cross"      // Ticker, Above, Price, Anchor
+	TrendlineCross Name = "trendline_cross" // Ticker, Above, Price
+	// Strategy, Count, and when only each sector's best were kept,
+	// TopPerSector and Total; Rule, the strategy's entry rule, when known
+	StrategyTriggered Name = "strategy_triggered"
+	// Count, Minutes, Examples, More, LogURL: alerts a rate limit held back
+	AlertSummary Name = "alert_summary"
+	// Used, Limit, Percent, Resource ("alert" or "strategy_alert"), Plan
+	QuotaWarning Name = "quota_warning"
+	// Message, Offline, LogURL: the email layout for notifications without
+	// email variants of their own
+	AlertEmail Name = "alert_email"
+)
+
+// Variants of a template
+const (
+	VariantText         = "text"
+	VariantTelegram     = "telegram"
+	VariantEmailSubject = "email_subject"
+	VariantEmail        = "email"
+)
+
+// DefaultLocale is used when the user's locale isn't supported, and for
+// templates a locale doesn't translate
+const DefaultLocale = "en"
+
+// Vars are the variables a template is rendered with
+type Vars map[string]interface{}
+
+// Message is a notification to render later: which template, and with what.
+// It is stored as JSON, so numbers come back as float64.
+type Message struct {
+	Template Name `json:"template"`
+	Vars     Vars `json:"vars,omitempty"`
+}
+
+// New returns a message rendering name with vars
+func New(name Name, vars Vars) Message {
+	return Message{Template: name, Vars: vars}
+}
+
+// Text wraps a message that was already written out
+func Text(text string) Message {
+	return Message{Template: Literal, Vars: Vars{"Text": text}}
+}
+
+type renderer interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+var (
+	// catalogs holds each locale's parsed variants by template and variant
+	catalogs = map[string]map[Name]map[string]renderer{}
+	locales  []string
+	matcher  language.Matcher
+)
+
+func init() {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	tags := []language.Tag{language.MustParse(DefaultLocale)}
+	locales = []string{DefaultLocale}
+	for _, e := range entries {
+		locale := strings.TrimSuffix(e.Name(), ".json")
+		raw, err := localeFiles.ReadFile(path.Join("locales", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		catalog, err := parseCatalog(locale, raw)
+		if err != nil {
+			panic(fmt.Sprintf("templates: locale %s: %v", locale, err))
+		}
+		catalogs[locale] = catalog
+		if locale != DefaultLocale {
+			tags = append(tags, language.MustParse(locale))
+			locales = append(locales, locale)
+		}
+	}
+	if catalogs[DefaultLocale] == nil {
+		panic("templates: no catalog for the default locale")
+	}
+	matcher = language.NewMatcher(tags)
+}
+
+func parseCatalog(locale string, raw []byte) (map[Name]map[string]renderer, error) {
+	var sources map[Name]map[string]string
+	if err := json.Unmarshal(raw, &sources); err != nil {
+		return nil, err
+	}
+	funcs := funcMap(locale)
+	catalog := make(map[Name]map[string]renderer, len(sources))
+	for name, variants := range sources {
+		catalog[name] = make(map[string]renderer, len(variants))
+		for variant, src := range variants {
+			id := string(name) + "." + variant
+			var r renderer
+			var err error
+			if variant == VariantEmail {
+				r, err = htmltemplate.New(id).Funcs(htmltemplate.FuncMap(funcs)).Parse(src)
+			} else {
+				r, err = texttemplate.New(id).Funcs(funcs).Parse(src)
+			}
+			if err != nil {
+				return nil, err
+			}
+			catalog[name][variant] = r
+		}
+	}
+	return catalog, nil
+}
+
+// funcMap formats numbers the locale's way. plural picks the singular for one
+// (and in French for zero too).
+func funcMap(locale string) texttemplate.FuncMap {
+	p := message.NewPrinter(language.MustParse(locale))
+	return texttemplate.FuncMap{
+		"price": func(v interface{}) string {
+			f := number(v)
+			if math.Abs(f) < 1 {
+				return p.Sprintf("%.4f", f)
+			}
+			return p.Sprintf("%.2f", f)
+		},
+		"num": func(v interface{}) string { return p.Sprintf("%d", int64(math.Round(number(v)))) },
+		"plural": func(v interface{}, one, other string) string {
+			n := math.Abs(number(v))
+			if n == 1 || (locale == "fr" && n < 2) {
+				return one
+			}
+			return other
+		},
+		"int": func(v interface{}) int { return int(math.Round(number(v))) },
+		"div": func(a, b int) int { return a / b },
+		"mod": func(a, b int) int { return a % b },
+	}
+}
+
+func number(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case float32:
+		return float64(n)
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case *float64:
+		if n != nil {
+			return *n
+		}
+	}
+	return 0
+}
+
+// Locales lists the supported locales, the default first
+func Locales() []string {
+	return append([]string(nil), locales...)
+}
+
+// NormalizeLocale returns the supported locale closest to a language tag such
+// as "es-MX", or the default
+func NormalizeLocale(tag string) string {
+	if tag == "" {
+		return DefaultLocale
+	}
+	_, i := language.MatchStrings(matcher, tag)
+	return locales[i]
+}
+
+// UserLocale returns the locale the user's notifications are written in, from
+// the locale in their settings
+func UserLocale(ctx context.Context, conn *data.Conn, userID int) string {
+	var tag string
+	err := conn.DB.QueryRow(ctx, `
+		SELECT COALESCE(settings->>'locale', '') FROM users WHERE userId = $1`, userID).Scan(&tag)
+	if err != nil {
+		log.Printf("⚠️ Failed to load the locale of user %d: %v; using %s", userID, err, DefaultLocale)
+		return DefaultLocale
+	}
+	return NormalizeLocale(tag)
+}
+
+// lookup finds the variant of a template, else its text, in the locale and
+// then in the default one
+func lookup(locale string, name Name, variant string) renderer {
+	for _, l := range []string{locale, DefaultLocale} {
+		if r := catalogs[l][name][variant]; r != nil {
+			return r
+		}
+		// Email bodies are HTML; text isn't escaped for them
+		if r := catalogs[l][name][VariantText]; r != nil && variant != VariantEmail {
+			return r
+		}
+	}
+	return nil
+}
+
+// has reports whether the template has variant; the default locale defines
+// every variant of every template
+func has(name Name, variant string) bool {
+	return catalogs[DefaultLocale][name][variant] != nil
+}
+
+// Render writes m in the locale, using its variant for the channel if it has
+// one and its text otherwise. A template that fails to render is logged and
+// rendered as its name, so a notification still goes out.
+func Render(locale, variant string, m Message) string {
+	locale = NormalizeLocale(locale)
+	r := lookup(locale, m.Template, variant)
+	if r == nil {
+		log.Printf("⚠️ Unknown notification template %q", m.Template)
+		return string(m.Template)
+	}
+	var buf bytes.Buffer
+	if err := r.Execute(&buf, map[string]interface{}(m.Vars)); err != nil {
+		log.Printf("⚠️ Rendering notification template %s.%s in %s failed: %v", m.Template, variant, locale, err)
+		return string(m.Template)
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// RenderEmail writes the subject and HTML body of an email for m. Messages
+// with no email variants of their own are laid out by the AlertEmail template,
+// which is given their text and layout's variables.
+func RenderEmail(locale string, m Message, layout Vars) (subject, body string) {
+	if has(m.Template, VariantEmailSubject) && has(m.Template, VariantEmail) {
+		return oneLine(Render(locale, VariantEmailSubject, m)), Render(locale, VariantEmail, m)
+	}
+	vars := Vars{"Message": Render(locale, VariantText, m)}
+	for k, v := range layout {
+		vars[k] = v
+	}
+	wrapped := New(AlertEmail, vars)
+	return oneLine(Render(locale, VariantEmailSubject, wrapped)), Render(locale, VariantEmail, wrapped)
+}
+
+// oneLine keeps a subject to a single header line
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,414 @@
+// Package twofactor implements TOTP two-factor authentication (RFC 6238):
+// enrollment from an authenticator app, verification of codes at login, and
+// step-up verification that destructive handlers require before they run.
+// Each enrolled user also gets single-use recovery codes for a lost device.
+package twofactor
+
+import (
+	"backend/internal/apperr"
+	"backend/internal/data"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	issuer      = "Peripheral"
+	period      = 30 // seconds per code
+	digits      = 6
+	skew        = 1 // codes one period either side are accepted for clock drift
+	secretBytes = 20
+
+	recoveryCodeCount = 8
+	maxFailures       = 5
+	failureWindow     = 5 * time.Minute
+
+	failuresKeyFmt = "user:%d:totp_failures"
+	lastStepKeyFmt = "user:%d:totp_last_step" // newest time step used, so a code works once
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Status describes a user's two-factor setup
+type Status struct {
+	Enabled           bool   `json:"enabled"`
+	EnabledAt         *int64 `json:"enabledAt,omitempty"` // ms since epoch
+	RecoveryCodesLeft int    `json:"recoveryCodesLeft"`
+}
+
+type userState struct {
+	secret        string
+	enabled       bool
+	enabledAt     *time.Time
+	recoveryCodes []string
+}
+
+func loadState(ctx context.Context, conn *data.Conn, userID int) (userState, error) {
+	var s userState
+	var secret *string
+	err := conn.DB.QueryRow(ctx, `
+		SELECT totp_secret, totp_enabled, totp_enabled_at, totp_recovery_codes
+		FROM users WHERE userId = $1`, userID).Scan(&secret, &s.enabled, &s.enabledAt, &s.recoveryCodes)
+	if err == pgx.ErrNoRows {
+		return s, apperr.NotFound("user not found")
+	}
+	if err != nil {
+		return s, fmt.Errorf("error loading two-factor settings: %v", err)
+	}
+	if secret != nil {
+		s.secret = *secret
+	}
+	return s, nil
+}
+
+// Enabled reports whether the user has confirmed two-factor enrollment
+func Enabled(ctx context.Context, conn *data.Conn, userID int) (bool, error) {
+	var enabled bool
+	err := conn.DB.QueryRow(ctx, `SELECT totp_enabled FROM users WHERE userId = $1`, userID).Scan(&enabled)
+	if err == pgx.ErrNoRows {
+		return false, apperr.NotFound("user not found")
+	}
+	if err != nil {
+		return false, fmt.Errorf("error loading two-factor settings: %v", err)
+	}
+	return enabled, nil
+}
+
+// RequireStepUp guards a destructive action. Users without two-factor pass;
+// enrolled users must supply a valid code with the request, otherwise the
+// caller gets a step_up_required error to prompt for one.
+func RequireStepUp(ctx context.Context, conn *data.Conn, userID int, code string) error {
+	enabled, err := Enabled(ctx, conn, userID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return nil
+	}
+	if strings.TrimSpace(code) == "" {
+		return apperr.StepUpRequired("enter a code from your authenticator app to confirm this action")
+	}
+	return Verify(ctx, conn, userID, code)
+}
+
+// Verify checks a TOTP or recovery code for an enrolled user. Recovery codes
+// are consumed; TOTP codes can't be replayed. Repeated failures lock
+// verification for failureWindow.
+func Verify(ctx context.Context, conn *data.Conn, userID int, code string) error {
+	if err := checkAttempts(ctx, conn, userID); err != nil {
+		return err
+	}
+
+	state, err := loadState(ctx, conn, userID)
+	if err != nil {
+		return err
+	}
+	if !state.enabled || state.secret == "" {
+		return apperr.Validation("two-factor authentication is not enabled")
+	}
+
+	ok, err := checkCode(ctx, conn, userID, state, normalize(code))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return recordFailure(ctx, conn, userID)
+	}
+	conn.Cache.Del(ctx, fmt.Sprintf(failuresKeyFmt, userID))
+	return nil
+}
+
+// checkAttempts refuses a code while the user is locked out by failures
+func checkAttempts(ctx context.Context, conn *data.Conn, userID int) error {
+	failures, err := conn.Cache.Get(ctx, fmt.Sprintf(failuresKeyFmt, userID)).Int()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("error checking two-factor attempts: %v", err)
+	}
+	if failures >= maxFailures {
+		return apperr.LimitExceeded("too many incorrect codes; try again in a few minutes")
+	}
+	return nil
+}
+
+// recordFailure counts an incorrect code towards the lockout and returns the
+// error to send back
+func recordFailure(ctx context.Context, conn *data.Conn, userID int) error {
+	failuresKey := fmt.Sprintf(failuresKeyFmt, userID)
+	pipe := conn.Cache.TxPipeline()
+	pipe.Incr(ctx, failuresKey)
+	pipe.Expire(ctx, failuresKey, failureWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ Error recording two-factor failure for user %d: %v", userID, err)
+	}
+	return apperr.Validation("incorrect verification code")
+}
+
+func checkCode(ctx context.Context, conn *data.Conn, userID int, state userState, code string) (bool, error) {
+	if len(code) == digits {
+		step, ok := matchStep(state.secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return claimStep(ctx, conn, userID, step)
+	}
+	return consumeRecoveryCode(ctx, conn, userID, code)
+}
+
+// advanceStep records ARGV[1] as the newest step used unless it isn't newer
+// than the one recorded, in one step so two requests can't both use a code
+var advanceStep = redis.NewScript(`
+local last = tonumber(redis.call('GET', KEYS[1]) or '0')
+if tonumber(ARGV[1]) <= last then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+return 1`)
+
+// claimStep reports whether the code for step hasn't been used yet, marking
+// it used. Only a step newer than the last one used is accepted.
+func claimStep(ctx context.Context, conn *data.Conn, userID int, step int64) (bool, error) {
+	claimed, err := advanceStep.Run(ctx, conn.Cache, []string{fmt.Sprintf(lastStepKeyFmt, userID)},
+		step, (2*skew+1)*period).Int()
+	if err != nil {
+		return false, fmt.Errorf("error recording two-factor code: %v", err)
+	}
+	return claimed == 1, nil
+}
+
+// consumeRecoveryCode removes the code in the same statement that checks it,
+// so concurrent requests can't both use it
+func consumeRecoveryCode(ctx context.Context, conn *data.Conn, userID int, code string) (bool, error) {
+	if code == "" {
+		return false, nil
+	}
+	tag, err := conn.DB.Exec(ctx, `
+		UPDATE users SET totp_recovery_codes = array_remove(totp_recovery_codes, $2)
+		WHERE userId = $1 AND $2 = ANY(totp_recovery_codes)`, userID, hashRecoveryCode(code))
+	if err != nil {
+		return false, fmt.Errorf("error checking recovery code: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+	log.Printf("🔐 User %d used a two-factor recovery code", userID)
+	return true, nil
+}
+
+// normalize drops the spaces and dashes users paste along with a code
+func normalize(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
+
+// matchStep returns the time step whose code matches, within skew of now
+func matchStep(secret, code string, now time.Time) (int64, bool) {
+	key, err := b32.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+	current := now.Unix() / period
+	for step := current - skew; step <= current+skew; step++ {
+		if hmac.Equal([]byte(totp(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totp is the RFC 4226 HOTP value of a time step
+func totp(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	return b, err
+}
+
+// newRecoveryCodes returns codes formatted for display ("xxxxx-xxxxx") and
+// their hashes for storage
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b, err := randomBytes(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		raw := hex.EncodeToString(b)
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = hashRecoveryCode(raw)
+	}
+	return codes, hashes, nil
+}
+
+// GetTwoFactorStatus reports whether the calling user has two-factor enabled
+func GetTwoFactorStatus(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	state, err := loadState(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	status := Status{Enabled: state.enabled}
+	if state.enabled {
+		status.RecoveryCodesLeft = len(state.recoveryCodes)
+		if state.enabledAt != nil {
+			ms := state.enabledAt.UnixMilli()
+			status.EnabledAt = &ms
+		}
+	}
+	return status, nil
+}
+
+// Enrollment is a new secret to add to an authenticator app
+type Enrollment struct {
+	Secret     string `json:"secret"`     // base32, for manual entry
+	OtpauthURL string `json:"otpauthUrl"` // for a QR code
+}
+
+// BeginTwoFactorEnrollment generates a secret for the calling user. It takes
+// effect once a code from it is confirmed with ConfirmTwoFactorEnrollment.
+func BeginTwoFactorEnrollment(conn *data.Conn, userID int, _ json.RawMessage) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var email string
+	var enabled bool
+	err := conn.DB.QueryRow(ctx, `SELECT email, totp_enabled FROM users WHERE userId = $1`, userID).Scan(&email, &enabled)
+	if err != nil {
+		return nil, fmt.Errorf("error loading user: %v", err)
+	}
+	if enabled {
+		return nil, apperr.Validation("two-factor authentication is already enabled")
+	}
+
+	key, err := randomBytes(secretBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error generating two-factor secret: %v", err)
+	}
+	secret := b32.EncodeToString(key)
+	if _, err := conn.DB.Exec(ctx, `UPDATE users SET totp_secret = $2 WHERE userId = $1`, userID, secret); err != nil {
+		return nil, fmt.Errorf("error saving two-factor secret: %v", err)
+	}
+
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("digits", strconv.Itoa(digits))
+	params.Set("period", strconv.Itoa(period))
+	label := url.PathEscape(issuer + ":" + email)
+	return Enrollment{
+		Secret:     secret,
+		OtpauthURL: "otpauth://totp/" + label + "?" + params.Encode(),
+	}, nil
+}
+
+// CodeArgs carries a verification code
+type CodeArgs struct {
+	Code string `json:"code"`
+}
+
+// ConfirmTwoFactorEnrollment enables two-factor once the user proves their
+// app produces codes for the pending secret, and returns the recovery codes.
+// They are shown this once. Incorrect codes count towards the same lockout as
+// Verify's.
+func ConfirmTwoFactorEnrollment(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args CodeArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := checkAttempts(ctx, conn, userID); err != nil {
+		return nil, err
+	}
+
+	state, err := loadState(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	if state.enabled {
+		return nil, apperr.Validation("two-factor authentication is already enabled")
+	}
+	if state.secret == "" {
+		return nil, apperr.Validation("start two-factor setup first")
+	}
+	// The confirming code can't be reused for the first step-up
+	step, ok := matchStep(state.secret, normalize(args.Code), time.Now())
+	if ok {
+		if ok, err = claimStep(ctx, conn, userID, step); err != nil {
+			return nil, err
+		}
+	}
+	if !ok {
+		return nil, recordFailure(ctx, conn, userID)
+	}
+	conn.Cache.Del(ctx, fmt.Sprintf(failuresKeyFmt, userID))
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("error generating recovery codes: %v", err)
+	}
+	_, err = conn.DB.Exec(ctx, `
+		UPDATE users SET totp_enabled = TRUE, totp_enabled_at = NOW(), totp_recovery_codes = $2
+		WHERE userId = $1`, userID, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("error enabling two-factor authentication: %v", err)
+	}
+	log.Printf("🔐 User %d enabled two-factor authentication", userID)
+	return map[string]interface{}{"enabled": true, "recoveryCodes": codes}, nil
+}
+
+// DisableTwoFactor turns two-factor off after checking a current code
+func DisableTwoFactor(conn *data.Conn, userID int, rawArgs json.RawMessage) (interface{}, error) {
+	var args CodeArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, apperr.InvalidArgs(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := Verify(ctx, conn, userID, args.Code); err != nil {
+		return nil, err
+	}
+	_, err := conn.DB.Exec(ctx, `
+		UPDATE users SET totp_enabled = FALSE, totp_enabled_at = NULL, totp_secret = NULL, totp_recovery_codes = '{}'
+		WHERE userId = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error disabling two-factor authentication: %v", err)
+	}
+	log.Printf("🔐 User %d disabled two-factor authentication", userID)
+	return map[string]bool{"enabled": false}, nil
+}
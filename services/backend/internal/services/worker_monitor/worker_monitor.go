@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -234,23 +235,10 @@ func (wm *WorkerMonitor) findDeadWorkers(activeWorkers map[string]WorkerHeartbea
 	now := time.Now()
 
 	for workerID, heartbeat := range activeWorkers {
-		// Parse heartbeat timestamp - try multiple formats
-		var heartbeatTime time.Time
-		var err error
-
-		// Try RFC3339 first (standard format)
-		heartbeatTime, err = time.Parse(time.RFC3339, heartbeat.Timestamp)
+		heartbeatTime, err := parseHeartbeatTime(heartbeat.Timestamp)
 		if err != nil {
-			// Try Python datetime format without timezone
-			heartbeatTime, err = time.Parse("2006-01-02T15:04:05.000000", heartbeat.Timestamp)
-			if err != nil {
-				// Try Python datetime format with microseconds
-				heartbeatTime, err = time.Parse("2006-01-02T15:04:05", heartbeat.Timestamp[:19])
-				if err != nil {
-					log.Printf("⚠️ Invalid timestamp for worker %s (%s): %v", workerID, heartbeat.Timestamp, err)
-					continue
-				}
-			}
+			log.Printf("⚠️ Invalid timestamp for worker %s (%s): %v", workerID, heartbeat.Timestamp, err)
+			continue
 		}
 
 		// Check if heartbeat is too old
@@ -266,6 +254,25 @@ func (wm *WorkerMonitor) findDeadWorkers(activeWorkers map[string]WorkerHeartbea
 	return deadWorkers
 }
 
+// parseHeartbeatTime reads a heartbeat timestamp, which Python workers may
+// write without a timezone
+func parseHeartbeatTime(ts string) (time.Time, error) {
+	// Try RFC3339 first (standard format)
+	t, err := time.Parse(time.RFC3339, ts)
+	if err == nil {
+		return t, nil
+	}
+	// Try Python datetime format without timezone
+	if t, err = time.Parse("2006-01-02T15:04:05.000000", ts); err == nil {
+		return t, nil
+	}
+	// Try Python datetime format truncated to seconds
+	if len(ts) < 19 {
+		return time.Time{}, err
+	}
+	return time.Parse("2006-01-02T15:04:05", ts[:19])
+}
+
 // findStuckTasks identifies tasks that have been running too long
 func (wm *WorkerMonitor) findStuckTasks(assignments map[string]TaskAssignment, activeWorkers map[string]WorkerHeartbeat) []TaskAssignment {
 	var stuckTasks []TaskAssignment
@@ -567,3 +574,55 @@ func (wm *WorkerMonitor) GetMonitoringStats(ctx context.Context) (map[string]int
 
 	return stats, nil
 }
+
+// WorkerHealth is one worker as of its last heartbeat
+type WorkerHealth struct {
+	WorkerID      string    `json:"workerId"`
+	Status        string    `json:"status"`
+	LastHeartbeat time.Time `json:"lastHeartbeat"`
+	// HeartbeatAge is how long ago the last heartbeat was, in seconds
+	HeartbeatAge  float64 `json:"heartbeatAgeSeconds"`
+	UptimeSeconds float64 `json:"uptimeSeconds"`
+	ActiveTask    string  `json:"activeTask,omitempty"`
+	// Healthy is unset once the worker has been silent past the heartbeat
+	// timeout
+	Healthy bool `json:"healthy"`
+}
+
+// FleetHealth summarizes the workers that have sent a heartbeat
+type FleetHealth struct {
+	Total   int            `json:"total"`
+	Healthy int            `json:"healthy"`
+	Busy    int            `json:"busy"`
+	Workers []WorkerHealth `json:"workers"`
+}
+
+// Fleet reports each worker's health from its heartbeat, without the task
+// recovery a health check does
+func (wm *WorkerMonitor) Fleet(ctx context.Context) (*FleetHealth, error) {
+	activeWorkers, err := wm.getActiveWorkers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	fleet := &FleetHealth{Workers: make([]WorkerHealth, 0, len(activeWorkers))}
+	for workerID, heartbeat := range activeWorkers {
+		w := WorkerHealth{WorkerID: workerID, Status: heartbeat.Status, UptimeSeconds: heartbeat.UptimeSeconds}
+		if t, err := parseHeartbeatTime(heartbeat.Timestamp); err == nil {
+			w.LastHeartbeat = t
+			w.HeartbeatAge = now.Sub(t).Seconds()
+			w.Healthy = now.Sub(t) <= wm.heartbeatTimeout
+		}
+		if heartbeat.ActiveTask != nil && *heartbeat.ActiveTask != "" {
+			w.ActiveTask = *heartbeat.ActiveTask
+			fleet.Busy++
+		}
+		if w.Healthy {
+			fleet.Healthy++
+		}
+		fleet.Workers = append(fleet.Workers, w)
+	}
+	fleet.Total = len(fleet.Workers)
+	sort.Slice(fleet.Workers, func(i, j int) bool { return fleet.Workers[i].WorkerID < fleet.Workers[j].WorkerID })
+	return fleet, nil
+}
@@ -0,0 +1,132 @@
+package testharness
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// FakeLLM is an OpenAI Responses API server that answers with scripted
+// replies, in order. When the script runs out the last reply is repeated.
+type FakeLLM struct {
+	t        testing.TB
+	srv      *httptest.Server
+	mu       sync.Mutex
+	replies  []string
+	next     int
+	outage   int
+	requests []json.RawMessage
+}
+
+func newFakeLLM(t testing.TB) *FakeLLM {
+	f := &FakeLLM{t: t}
+	f.srv = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+// client is an OpenAI client pointed at the fake, without retries
+func (f *FakeLLM) client() openai.Client {
+	return openai.NewClient(
+		option.WithBaseURL(f.srv.URL+"/"),
+		option.WithAPIKey(fakeAPIKey),
+		option.WithMaxRetries(0),
+	)
+}
+
+// Reply queues the output text of the next responses
+func (f *FakeLLM) Reply(texts ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replies = append(f.replies, texts...)
+}
+
+// ReplyJSON queues a response whose output text is v encoded as JSON, as
+// returned for structured outputs such as the planner's
+func (f *FakeLLM) ReplyJSON(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		f.t.Fatalf("encoding llm reply: %v", err)
+	}
+	f.Reply(string(b))
+}
+
+// Outage makes every call fail with status until Restore
+func (f *FakeLLM) Outage(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.outage = status
+}
+
+// Restore ends an outage
+func (f *FakeLLM) Restore() { f.Outage(0) }
+
+// Requests returns the bodies of the requests received so far
+func (f *FakeLLM) Requests() []json.RawMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]json.RawMessage(nil), f.requests...)
+}
+
+func (f *FakeLLM) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	f.requests = append(f.requests, body)
+	outage := f.outage
+	var text string
+	if len(f.replies) > 0 {
+		i := f.next
+		if i >= len(f.replies) {
+			i = len(f.replies) - 1
+		} else {
+			f.next++
+		}
+		text = f.replies[i]
+	}
+	n := len(f.requests)
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if outage != 0 {
+		w.WriteHeader(outage)
+		_, _ = w.Write([]byte(`{"error":{"message":"simulated outage","type":"server_error"}}`))
+		return
+	}
+	if r.Method != http.MethodPost || r.URL.Path != "/responses" {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprintf(w, `{"error":{"message":"fake llm does not serve %s %s","type":"invalid_request_error"}}`, r.Method, r.URL.Path)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":         fmt.Sprintf("resp_%d", n),
+		"object":     "response",
+		"created_at": 0,
+		"status":     "completed",
+		"model":      "fake",
+		"output": []interface{}{map[string]interface{}{
+			"type":   "message",
+			"id":     fmt.Sprintf("msg_%d", n),
+			"status": "completed",
+			"role":   "assistant",
+			"content": []interface{}{map[string]interface{}{
+				"type":        "output_text",
+				"text":        text,
+				"annotations": []interface{}{},
+			}},
+		}},
+		"usage": map[string]interface{}{
+			"input_tokens":          len(body) / 4,
+			"output_tokens":         len(text) / 4,
+			"total_tokens":          (len(body) + len(text)) / 4,
+			"input_tokens_details":  map[string]int{"cached_tokens": 0},
+			"output_tokens_details": map[string]int{"reasoning_tokens": 0},
+		},
+	})
+}
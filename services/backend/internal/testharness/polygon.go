@@ -0,0 +1,94 @@
+package testharness
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	polygon "github.com/polygon-io/client-go/rest"
+)
+
+// FakePolygon answers Polygon REST calls from canned responses keyed by URL
+// path. Unregistered paths get Polygon's 404 body.
+type FakePolygon struct {
+	t        testing.TB
+	mu       sync.Mutex
+	handlers map[string]http.HandlerFunc
+	calls    map[string]int
+	outage   int // status returned for every call while non-zero
+}
+
+func newFakePolygon(t testing.TB) *FakePolygon {
+	return &FakePolygon{t: t, handlers: map[string]http.HandlerFunc{}, calls: map[string]int{}}
+}
+
+// client is a Polygon client whose transport is the fake
+func (f *FakePolygon) client() *polygon.Client {
+	c := polygon.NewWithClient(fakeAPIKey, &http.Client{Transport: f})
+	c.HTTP.SetRetryCount(0)
+	return c
+}
+
+// Handle serves path with h
+func (f *FakePolygon) Handle(path string, h http.HandlerFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[path] = h
+}
+
+// JSON serves path with body encoded as JSON
+func (f *FakePolygon) JSON(path string, body interface{}) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		f.t.Fatalf("encoding polygon fixture for %s: %v", path, err)
+	}
+	f.Handle(path, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b)
+	})
+}
+
+// Outage makes every call fail with status until Restore
+func (f *FakePolygon) Outage(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.outage = status
+}
+
+// Restore ends an outage
+func (f *FakePolygon) Restore() { f.Outage(0) }
+
+// Calls returns how many requests were made for path
+func (f *FakePolygon) Calls(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[path]
+}
+
+// RoundTrip implements http.RoundTripper
+func (f *FakePolygon) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	f.calls[req.URL.Path]++
+	h, ok := f.handlers[req.URL.Path]
+	outage := f.outage
+	f.mu.Unlock()
+
+	rec := httptest.NewRecorder()
+	switch {
+	case outage != 0:
+		rec.Header().Set("Content-Type", "application/json")
+		rec.WriteHeader(outage)
+		_, _ = rec.WriteString(`{"status":"ERROR","error":"simulated outage"}`)
+	case ok:
+		h(rec, req)
+	default:
+		rec.Header().Set("Content-Type", "application/json")
+		rec.WriteHeader(http.StatusNotFound)
+		_, _ = rec.WriteString(`{"status":"NOT_FOUND","message":"no fixture for ` + req.URL.Path + `"}`)
+	}
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
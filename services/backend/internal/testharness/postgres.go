@@ -0,0 +1,153 @@
+package testharness
+
+import (
+	"backend/internal/app/screener"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// TemplateEnv names the connection URL of a database that has init.sql and
+// every migration applied. It is used only as a template and never written.
+const TemplateEnv = "TEST_DATABASE_URL"
+
+// newDatabase clones the template into a database private to the test and
+// drops it when the test ends. Cloning is used instead of rolling back a
+// transaction because the code under test takes connections from the pool
+// itself, and pgxpool discards connections released mid-transaction.
+func newDatabase(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv(TemplateEnv)
+	if url == "" {
+		t.Skipf("%s is not set", TemplateEnv)
+	}
+	cfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", TemplateEnv, err)
+	}
+	template := cfg.ConnConfig.Database
+	name := "test_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	// Postgres refuses to clone a database with open connections, so the
+	// clone is made from the maintenance database
+	admin := cfg.ConnConfig.Copy()
+	admin.Database = "postgres"
+	adminConn, err := pgx.ConnectConfig(ctx, admin)
+	if err != nil {
+		t.Fatalf("connecting to postgres: %v", err)
+	}
+	defer adminConn.Close(context.Background())
+	if _, err := adminConn.Exec(ctx, fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s",
+		pgx.Identifier{name}.Sanitize(), pgx.Identifier{template}.Sanitize())); err != nil {
+		t.Fatalf("cloning %s: %v", template, err)
+	}
+
+	cfg.ConnConfig.Database = name
+	cfg.MaxConns = 4
+	pool, err := pgxpool.ConnectConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("connecting to %s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		pool.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		conn, err := pgx.ConnectConfig(ctx, admin)
+		if err != nil {
+			t.Logf("dropping %s: %v", name, err)
+			return
+		}
+		defer conn.Close(context.Background())
+		if _, err := conn.Exec(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s WITH (FORCE)", pgx.Identifier{name}.Sanitize())); err != nil {
+			t.Logf("dropping %s: %v", name, err)
+		}
+	})
+	return pool
+}
+
+// Strategy is the seed of a strategies row
+type Strategy struct {
+	UserID         int
+	Name           string
+	PythonCode     string
+	AlertActive    bool
+	AlertThreshold float64
+	AlertUniverse  []string
+	MinTimeframe   string
+	// UniverseFilters, when set, is the screen the alert universe is resolved from
+	UniverseFilters []screener.Filter
+}
+
+// SeedUser inserts a user and returns its id
+func (e *Env) SeedUser(t testing.TB, username string) int {
+	t.Helper()
+	var id int
+	e.queryRow(t, &id, `
+		INSERT INTO users (username, password, email, auth_type)
+		VALUES ($1, 'x', $1 || '@example.com', 'password')
+		RETURNING userId`, username)
+	return id
+}
+
+// SeedSecurity inserts an active security listed since 2000 and returns its id
+func (e *Env) SeedSecurity(t testing.TB, ticker string) int {
+	t.Helper()
+	var id int
+	e.queryRow(t, &id, `
+		INSERT INTO securities (ticker, figi, name, active, minDate)
+		VALUES ($1, left('BBG' || $1 || '000000000', 12), $1 || ' Inc.', true, '2000-01-01')
+		RETURNING securityid`, ticker)
+	return id
+}
+
+// SeedStrategy inserts a strategy and returns its id. Zero fields take the
+// defaults the strategy worker would write.
+func (e *Env) SeedStrategy(t testing.TB, s Strategy) int {
+	t.Helper()
+	if s.PythonCode == "" {
+		s.PythonCode = "def strategy(data):\n    return []\n"
+	}
+	if s.MinTimeframe == "" {
+		s.MinTimeframe = "1d"
+	}
+	if s.AlertUniverse == nil {
+		s.AlertUniverse = []string{}
+	}
+	var filters []byte
+	if len(s.UniverseFilters) > 0 {
+		var err error
+		if filters, err = json.Marshal(s.UniverseFilters); err != nil {
+			t.Fatalf("seeding: %v", err)
+		}
+	}
+	var id int
+	e.queryRow(t, &id, `
+		INSERT INTO strategies (userid, name, description, prompt, pythoncode, version, createdat,
+		                        alertactive, alert_threshold, alert_universe, min_timeframe, alert_universe_filters)
+		VALUES ($1, $2, '', '', $3, 1, NOW(), $4, $5, $6, $7, $8)
+		RETURNING strategyid`,
+		s.UserID, s.Name, s.PythonCode, s.AlertActive, s.AlertThreshold, s.AlertUniverse, s.MinTimeframe, filters)
+	return id
+}
+
+func (e *Env) queryRow(t testing.TB, dest interface{}, sql string, args ...interface{}) {
+	t.Helper()
+	if e.Conn.DB == nil {
+		t.Fatalf("seeding needs WithPostgres")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := e.Conn.DB.QueryRow(ctx, sql, args...).Scan(dest); err != nil {
+		t.Fatalf("seeding: %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+package testharness
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newRedis starts a miniredis server for the test. Fail it with
+// Redis.SetError and restore it with Redis.SetError(""); expire keys with
+// Redis.FastForward.
+func newRedis(t testing.TB) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+	return mr, client
+}
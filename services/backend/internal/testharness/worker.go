@@ -0,0 +1,117 @@
+package testharness
+
+import (
+	"backend/internal/queue"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// WorkerFunc handles one task for a FakeWorker. A nil error publishes the
+// returned data as a completed result; an error publishes an error result.
+type WorkerFunc func(task queue.TaskData, args map[string]interface{}) (map[string]interface{}, error)
+
+// FakeWorker stands in for the Python worker. It pops tasks from the Redis
+// queues and answers on their status channels using the worker's protocol.
+type FakeWorker struct {
+	env      *Env
+	mu       sync.Mutex
+	handlers map[string]WorkerFunc
+	silent   bool
+	tasks    []queue.TaskData
+}
+
+// StartWorker runs a FakeWorker until the test ends
+func (e *Env) StartWorker(t testing.TB) *FakeWorker {
+	w := &FakeWorker{env: e, handlers: map[string]WorkerFunc{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return w
+}
+
+// Handle sets the handler of a task type
+func (w *FakeWorker) Handle(taskType string, fn WorkerFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handlers[taskType] = fn
+}
+
+// Silent makes the worker take tasks without ever answering, as a worker
+// that died mid-task would
+func (w *FakeWorker) Silent(silent bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.silent = silent
+}
+
+// Tasks returns the tasks taken so far, retries included
+func (w *FakeWorker) Tasks() []queue.TaskData {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]queue.TaskData(nil), w.tasks...)
+}
+
+func (w *FakeWorker) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		res, err := w.env.Conn.Cache.BLPop(ctx, time.Second, "priority_task_queue", "task_queue").Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				time.Sleep(50 * time.Millisecond)
+			}
+			continue
+		}
+		var task queue.TaskData
+		if json.Unmarshal([]byte(res[1]), &task) != nil {
+			continue
+		}
+		w.mu.Lock()
+		w.tasks = append(w.tasks, task)
+		fn, silent := w.handlers[task.TaskType], w.silent
+		w.mu.Unlock()
+		if !silent {
+			w.answer(ctx, task, fn)
+		}
+	}
+}
+
+func (w *FakeWorker) answer(ctx context.Context, task queue.TaskData, fn WorkerFunc) {
+	w.publish(ctx, task, queue.UnifiedMessage{
+		TaskID:          task.TaskID,
+		MessageType:     "progress",
+		Status:          "running",
+		Data:            map[string]interface{}{"started_at": time.Now().Format(time.RFC3339)},
+		ProtocolVersion: queue.ProtocolVersion,
+	})
+	var args map[string]interface{}
+	_ = json.Unmarshal([]byte(task.Kwargs), &args)
+	result := queue.UnifiedMessage{TaskID: task.TaskID, MessageType: "result", Status: "completed", ProtocolVersion: queue.ProtocolVersion}
+	if fn == nil {
+		result.Status = "error"
+		result.Error = fmt.Sprintf("fake worker has no handler for %s", task.TaskType)
+	} else if data, err := fn(task, args); err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+	} else {
+		result.Data = data
+	}
+	w.publish(ctx, task, result)
+}
+
+func (w *FakeWorker) publish(ctx context.Context, task queue.TaskData, msg queue.UnifiedMessage) {
+	b, _ := json.Marshal(msg)
+	w.env.Conn.Cache.Publish(ctx, "task_status:"+task.StatusID, string(b))
+}
@@ -0,0 +1,26 @@
+-- Migration: 100_strategy_threshold_suggestions
+-- Description: Suggested strategy alert thresholds derived from trigger history and subsequent returns
+
+BEGIN;
+
+-- Latest suggestion per strategy, overwritten by each analysis run
+CREATE TABLE IF NOT EXISTS strategy_threshold_suggestions (
+    strategy_id            INT PRIMARY KEY REFERENCES strategies(strategyId) ON DELETE CASCADE,
+    user_id                INT NOT NULL REFERENCES users(userId) ON DELETE CASCADE,
+    current_threshold      DOUBLE PRECISION,
+    suggested_threshold    DOUBLE PRECISION,
+    target_precision       DOUBLE PRECISION NOT NULL,
+    horizon_days           INT NOT NULL,
+    sample_size            INT NOT NULL,
+    stats                  JSONB NOT NULL DEFAULT '{}'::jsonb,
+    computed_at            TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_strategy_threshold_suggestions_user ON strategy_threshold_suggestions (user_id);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (100, 'Add strategy_threshold_suggestions for alert threshold auto-tuning')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
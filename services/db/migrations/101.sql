@@ -0,0 +1,15 @@
+-- Migration: 101_alert_vwap_anchor
+-- Description: Price alerts that trigger on crossing an anchored VWAP instead of a fixed price
+
+BEGIN;
+
+-- When set, the alert level is the VWAP of 1m bars since this anchor, recomputed while active;
+-- price holds the VWAP at creation for display
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS vwap_anchor TIMESTAMPTZ DEFAULT NULL;
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (101, 'Add vwap_anchor to alerts for anchored VWAP cross alerts')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,28 @@
+-- Migration: 102_chart_drawings
+-- Description: Persisted chart drawings (trendlines, rectangles/zones, fib retracements, text notes)
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS chart_drawings (
+    id            SERIAL PRIMARY KEY,
+    user_id       INT NOT NULL REFERENCES users(userId) ON DELETE CASCADE,
+    security_id   INT NOT NULL,
+    -- NULL shows the drawing on every timeframe of the security
+    timeframe     VARCHAR(10) DEFAULT NULL,
+    drawing_type  VARCHAR(20) NOT NULL CHECK (drawing_type IN ('trendline', 'rectangle', 'fib_retracement', 'text')),
+    -- Anchor points as [{"timestamp": ms, "price": n}, ...]
+    points        JSONB NOT NULL,
+    style         JSONB NOT NULL DEFAULT '{}'::jsonb,
+    text          TEXT DEFAULT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_chart_drawings_user_security ON chart_drawings (user_id, security_id);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (102, 'Add chart_drawings for trendline, rectangle, fib and text drawings')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,17 @@
+-- Migration: 103_alert_trendline
+-- Description: Price alerts that trigger on crossing a persisted trendline drawing
+
+BEGIN;
+
+-- When set, the alert level is the trendline projected to the current time; deleting the
+-- drawing deletes its alerts
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS drawing_id INT DEFAULT NULL REFERENCES chart_drawings(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_alerts_drawing_id ON alerts (drawing_id) WHERE drawing_id IS NOT NULL;
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (103, 'Add drawing_id to alerts for trendline cross alerts')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
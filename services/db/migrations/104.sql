@@ -0,0 +1,28 @@
+-- Migration: 104_strategy_share_links
+-- Description: Expiring, revocable public share links for strategy summaries and backtest reports
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS strategy_share_links (
+    share_id        SERIAL PRIMARY KEY,
+    user_id         INT NOT NULL REFERENCES users(userId) ON DELETE CASCADE,
+    strategy_id     INT NOT NULL REFERENCES strategies(strategyId) ON DELETE CASCADE,
+    version         INT NOT NULL,
+    kind            VARCHAR(20) NOT NULL CHECK (kind IN ('strategy', 'backtest')),
+    -- Report frozen at link creation with user-identifying fields removed
+    snapshot        JSONB NOT NULL,
+    expires_at      TIMESTAMPTZ NOT NULL,
+    revoked_at      TIMESTAMPTZ DEFAULT NULL,
+    view_count      INT NOT NULL DEFAULT 0,
+    last_viewed_at  TIMESTAMPTZ DEFAULT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_strategy_share_links_user_strategy ON strategy_share_links (user_id, strategy_id);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (104, 'Add strategy_share_links for public read-only strategy and backtest reports')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,23 @@
+-- Migration: 105_chart_images
+-- Description: Server-rendered chart images referenced by agent content chunks and alert notifications
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS chart_images (
+    image_id    UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    -- NULL for system renders such as alert snapshots
+    user_id     INT REFERENCES users(userId) ON DELETE CASCADE,
+    format      VARCHAR(8) NOT NULL CHECK (format IN ('png', 'svg')),
+    data        BYTEA NOT NULL,
+    spec        JSONB,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_chart_images_user_created ON chart_images (user_id, created_at DESC);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (105, 'Add chart_images for server-side rendered charts')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,30 @@
+-- Migration: 106_agent_prompts
+-- Description: Versioned agent prompt overrides and the prompt versions behind each agent response
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS agent_prompts (
+    id          SERIAL PRIMARY KEY,
+    name        VARCHAR(100) NOT NULL,
+    -- '' applies to every environment; otherwise dev, demo, prod, ...
+    environment VARCHAR(32) NOT NULL DEFAULT '',
+    version     INT NOT NULL,
+    content     TEXT NOT NULL,
+    active      BOOLEAN NOT NULL DEFAULT FALSE,
+    notes       TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (name, environment, version)
+);
+
+-- At most one active version per prompt and environment
+CREATE UNIQUE INDEX IF NOT EXISTS idx_agent_prompts_active
+    ON agent_prompts (name, environment) WHERE active;
+
+ALTER TABLE conversation_messages ADD COLUMN IF NOT EXISTS prompt_versions JSONB;
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (106, 'Add agent_prompts and conversation_messages.prompt_versions')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
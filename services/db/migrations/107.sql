@@ -0,0 +1,20 @@
+-- Migration: 107_agent_traces
+-- Description: Raw model calls and tool results per agent message for offline replay
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS agent_traces (
+    message_id  UUID PRIMARY KEY REFERENCES conversation_messages(message_id) ON DELETE CASCADE,
+    user_id     INT,
+    trace       JSONB NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_agent_traces_created ON agent_traces (created_at DESC);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (107, 'Add agent_traces for deterministic agent replay')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,46 @@
+-- Migration: 108_ohlcv_1s_replay
+-- Description: Recorded 1-second aggregates for bar replay, and the securities to record
+
+BEGIN;
+
+-- Same layout as ohlcv_1m: prices * 1000, timestamptz. Only kept for a couple
+-- of weeks; replay falls back to ohlcv_1m for anything older.
+CREATE TABLE IF NOT EXISTS ohlcv_1s (
+    "ticker"        text         NOT NULL,
+    "volume"        bigint,
+    "open"          bigint,
+    "close"         bigint,
+    "high"          bigint,
+    "low"           bigint,
+    "timestamp"     timestamptz  NOT NULL,
+    PRIMARY KEY ("ticker", "timestamp")
+);
+
+SELECT create_hypertable(
+    'ohlcv_1s',
+    'timestamp',
+    chunk_time_interval => INTERVAL '1 day',
+    if_not_exists => TRUE
+);
+
+ALTER TABLE ohlcv_1s SET (
+    timescaledb.compress,
+    timescaledb.compress_orderby = '"timestamp" DESC',
+    timescaledb.compress_segmentby = 'ticker'
+);
+
+SELECT add_compression_policy('ohlcv_1s', INTERVAL '2 days', if_not_exists => TRUE);
+SELECT add_retention_policy('ohlcv_1s', INTERVAL '14 days', if_not_exists => TRUE);
+
+-- Tickers whose 1-second aggregates are recorded (REPLAY_RECORD_ALL records every ticker)
+CREATE TABLE IF NOT EXISTS replay_recorded_tickers (
+    ticker      TEXT PRIMARY KEY,
+    added_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (108, 'Add ohlcv_1s and replay_recorded_tickers for bar replay')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,33 @@
+-- Migration: 109_ohlcv_data_quality
+-- Description: Findings of the nightly OHLCV data-quality checks
+
+BEGIN;
+
+-- One row per detected problem. A finding that is detected again on a later
+-- run keeps its row (last_seen_at moves forward); one that is no longer
+-- detected gets resolved_at set.
+CREATE TABLE IF NOT EXISTS ohlcv_quality_findings (
+    id              SERIAL PRIMARY KEY,
+    securityid      INTEGER,
+    ticker          TEXT NOT NULL,
+    timeframe       TEXT NOT NULL,          -- 1d or 1m
+    check_type      TEXT NOT NULL,          -- gap, zero_volume, stuck_price, split_mismatch
+    severity        TEXT NOT NULL,          -- warning or error
+    trading_date    DATE NOT NULL,
+    details         JSONB NOT NULL DEFAULT '{}'::jsonb,
+    first_seen_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at     TIMESTAMPTZ,
+    UNIQUE (ticker, timeframe, check_type, trading_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ohlcv_quality_findings_open
+    ON ohlcv_quality_findings (securityid, trading_date DESC)
+    WHERE resolved_at IS NULL;
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (109, 'Add ohlcv_quality_findings for OHLCV data-quality checks')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,40 @@
+-- Migration: 110_ohlcv_backfills
+-- Description: Queue of historical OHLCV backfills with per-range checkpoints
+
+BEGIN;
+
+-- One row per security/timeframe/date range to fetch from Polygon. Workers
+-- claim the highest-priority queued row, fetch it in chunks and move
+-- next_start forward after each chunk, so a paused or interrupted backfill
+-- resumes where it stopped.
+CREATE TABLE IF NOT EXISTS ohlcv_backfills (
+    id              SERIAL PRIMARY KEY,
+    securityid      INTEGER,
+    ticker          TEXT NOT NULL,
+    timeframe       TEXT NOT NULL CHECK (timeframe IN ('1m', '1d')),
+    range_start     DATE NOT NULL,
+    range_end       DATE NOT NULL,
+    next_start      DATE NOT NULL,
+    priority        INTEGER NOT NULL DEFAULT 0,
+    status          TEXT NOT NULL DEFAULT 'queued', -- queued, running, paused, done, failed
+    bars_written    BIGINT NOT NULL DEFAULT 0,
+    requests        INTEGER NOT NULL DEFAULT 0,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at      TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at     TIMESTAMPTZ,
+    CHECK (range_end >= range_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ohlcv_backfills_queue
+    ON ohlcv_backfills (priority DESC, created_at)
+    WHERE status IN ('queued', 'running');
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (110, 'Add ohlcv_backfills queue for managed OHLCV backfills')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
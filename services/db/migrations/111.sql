@@ -0,0 +1,34 @@
+-- Migration: 111_index_constituents
+-- Description: Point-in-time index/ETF constituent lists
+
+BEGIN;
+
+-- A ticker is a member of index_symbol from effective_from (inclusive) until
+-- effective_to (exclusive); effective_to is NULL while it is still a member.
+-- Membership as of a date is therefore
+--   effective_from <= date AND (effective_to IS NULL OR effective_to > date)
+CREATE TABLE IF NOT EXISTS index_constituents (
+    index_symbol    TEXT NOT NULL,          -- SPX, NDX
+    ticker          TEXT NOT NULL,
+    securityid      INTEGER,
+    weight          NUMERIC,
+    effective_from  DATE NOT NULL,
+    effective_to    DATE,
+    source          TEXT,
+    PRIMARY KEY (index_symbol, ticker, effective_from),
+    CHECK (effective_to IS NULL OR effective_to > effective_from)
+);
+
+CREATE INDEX IF NOT EXISTS idx_index_constituents_ticker
+    ON index_constituents (ticker, effective_from);
+
+CREATE INDEX IF NOT EXISTS idx_index_constituents_current
+    ON index_constituents (index_symbol)
+    WHERE effective_to IS NULL;
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (111, 'Add index_constituents for index membership filters')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,44 @@
+-- Migration: 112_security_reconciliation
+-- Description: Runs and change log of the nightly security master reconciliation
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS security_reconciliation_runs (
+    id                SERIAL PRIMARY KEY,
+    started_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at       TIMESTAMPTZ,
+    dry_run           BOOLEAN NOT NULL DEFAULT FALSE,
+    polygon_tickers   INTEGER,
+    active_securities INTEGER,
+    applied           INTEGER NOT NULL DEFAULT 0,
+    discrepancies     INTEGER NOT NULL DEFAULT 0,
+    error             TEXT
+);
+
+-- Every difference found between the securities table and Polygon reference
+-- data. applied = true rows are the audit trail of updates made to
+-- securities; the rest are discrepancies left for review (new listings,
+-- ticker changes and delistings are applied by the securities update job).
+CREATE TABLE IF NOT EXISTS security_changes (
+    id          SERIAL PRIMARY KEY,
+    run_id      INTEGER NOT NULL REFERENCES security_reconciliation_runs(id) ON DELETE CASCADE,
+    securityid  INTEGER,
+    ticker      TEXT NOT NULL,
+    kind        TEXT NOT NULL,  -- new_listing, ticker_change, delisting, exchange_move, name, cik, figi, shares
+    old_value   TEXT,
+    new_value   TEXT,
+    applied     BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_security_changes_security
+    ON security_changes (securityid, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_security_changes_run
+    ON security_changes (run_id);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (112, 'Add security reconciliation runs and change log')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
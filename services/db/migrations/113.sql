@@ -0,0 +1,30 @@
+-- Migration: 113_assets
+-- Description: Content-addressed image storage for security logos and icons
+
+BEGIN;
+
+-- Images keyed by the SHA-256 of their bytes, so a logo shared by several
+-- share classes is stored once and can be cached forever by its hash.
+CREATE TABLE IF NOT EXISTS assets (
+    hash          TEXT PRIMARY KEY,     -- hex SHA-256 of data
+    content_type  TEXT NOT NULL,
+    data          BYTEA NOT NULL,
+    size          INTEGER NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The base64 logo/icon columns are kept until every row has been migrated;
+-- readers prefer the hash and fall back to the legacy value.
+ALTER TABLE securities ADD COLUMN IF NOT EXISTS logo_hash TEXT REFERENCES assets(hash);
+ALTER TABLE securities ADD COLUMN IF NOT EXISTS icon_hash TEXT REFERENCES assets(hash);
+
+CREATE INDEX IF NOT EXISTS idx_securities_legacy_images
+    ON securities (securityid)
+    WHERE (logo IS NOT NULL AND logo_hash IS NULL) OR (icon IS NOT NULL AND icon_hash IS NULL);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (113, 'Add assets table and securities logo/icon hashes')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
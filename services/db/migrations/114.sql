@@ -0,0 +1,32 @@
+-- Migration: 114_alert_escalation_policies
+-- Description: Per-user and per-alert escalation of unacknowledged alert triggers
+
+BEGIN;
+
+-- steps is an ordered list of {"channel": "telegram"|"email", "afterMinutes": N}.
+-- A trigger goes out over the WebSocket first; each step fires N minutes after
+-- the trigger unless the client acknowledged it. A row with neither alert_id
+-- nor strategy_id is the user's default; an empty list disables escalation.
+CREATE TABLE IF NOT EXISTS alert_escalation_policies (
+    policy_id    SERIAL PRIMARY KEY,
+    user_id      INT NOT NULL REFERENCES users(userId) ON DELETE CASCADE,
+    alert_id     INT REFERENCES alerts(alertId) ON DELETE CASCADE,
+    strategy_id  INT REFERENCES strategies(strategyId) ON DELETE CASCADE,
+    steps        JSONB NOT NULL DEFAULT '[]'::jsonb,
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (alert_id IS NULL OR strategy_id IS NULL)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_alert_escalation_policies_user_default
+    ON alert_escalation_policies (user_id) WHERE alert_id IS NULL AND strategy_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_alert_escalation_policies_alert
+    ON alert_escalation_policies (alert_id) WHERE alert_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_alert_escalation_policies_strategy
+    ON alert_escalation_policies (strategy_id) WHERE strategy_id IS NOT NULL;
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (114, 'Add alert_escalation_policies for escalating unacknowledged alerts')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
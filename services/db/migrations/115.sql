@@ -0,0 +1,30 @@
+-- Migration: 115_user_exports
+-- Description: Asynchronous user data export archives
+
+BEGIN;
+
+-- One row per export request. The worker fills archive (a zip of one JSON file
+-- per table) and marks it ready; the archive is dropped once expires_at passes.
+CREATE TABLE IF NOT EXISTS user_exports (
+    export_id     SERIAL PRIMARY KEY,
+    user_id       INT NOT NULL REFERENCES users(userId) ON DELETE CASCADE,
+    status        VARCHAR(20) NOT NULL DEFAULT 'pending'
+                  CHECK (status IN ('pending', 'running', 'ready', 'failed', 'expired')),
+    error         TEXT DEFAULT NULL,
+    archive       BYTEA DEFAULT NULL,
+    size_bytes    INT DEFAULT NULL,
+    file_counts   JSONB DEFAULT NULL,   -- rows exported per file
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at  TIMESTAMPTZ DEFAULT NULL,
+    expires_at    TIMESTAMPTZ DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_exports_user ON user_exports (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_user_exports_expiry ON user_exports (expires_at) WHERE archive IS NOT NULL;
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (115, 'Add user_exports for asynchronous user data exports')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,20 @@
+-- Migration: 116_two_factor_auth
+-- Description: TOTP two-factor authentication for user accounts
+
+BEGIN;
+
+-- totp_secret is set when enrollment starts and only takes effect once a code
+-- from it is confirmed (totp_enabled). Recovery codes are stored as SHA-256
+-- hashes and removed as they are used.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS totp_secret         TEXT DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS totp_enabled        BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS totp_enabled_at     TIMESTAMPTZ DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS totp_recovery_codes TEXT[] NOT NULL DEFAULT '{}';
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (116, 'Add TOTP two-factor authentication columns to users')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
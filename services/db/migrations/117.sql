@@ -0,0 +1,15 @@
+-- Migration: 117_agent_scopes
+-- Description: Per-user consent for the agent's mutating tools
+
+BEGIN;
+
+-- Scopes the user lets the agent act in (manage_alerts, manage_strategies, ...).
+-- NULL means the user never changed them and the defaults apply.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS agent_scopes TEXT[] DEFAULT NULL;
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (117, 'Add agent_scopes to users for agent tool consent')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
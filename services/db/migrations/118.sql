@@ -0,0 +1,55 @@
+-- Migration: 118_scheduled_reports
+-- Description: Weekly performance reports delivered as PDFs, and their run history
+
+BEGIN;
+
+-- A report combines the selected strategies' alert and backtest performance,
+-- movers in the selected watchlists and, optionally, the user's trade stats.
+-- It is sent on day_of_week (0 = Sunday, ET) over each of its channels
+-- ('email', 'telegram'); telegram_chat_id is the chat the bot delivers to.
+CREATE TABLE IF NOT EXISTS scheduled_reports (
+    report_id         SERIAL PRIMARY KEY,
+    user_id           INT NOT NULL REFERENCES users(userId) ON DELETE CASCADE,
+    name              TEXT NOT NULL,
+    strategy_ids      INT[] NOT NULL DEFAULT '{}',
+    watchlist_ids     INT[] NOT NULL DEFAULT '{}',
+    include_trades    BOOLEAN NOT NULL DEFAULT TRUE,
+    channels          TEXT[] NOT NULL DEFAULT '{email}',
+    telegram_chat_id  BIGINT,
+    day_of_week       SMALLINT NOT NULL DEFAULT 5 CHECK (day_of_week BETWEEN 0 AND 6),
+    enabled           BOOLEAN NOT NULL DEFAULT TRUE,
+    last_run_at       TIMESTAMPTZ,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_reports_user ON scheduled_reports (user_id);
+CREATE INDEX IF NOT EXISTS idx_scheduled_reports_due ON scheduled_reports (day_of_week) WHERE enabled;
+
+-- One row per generated report. deliveries maps each channel to 'sent' or the
+-- error it failed with; pdf is kept for re-download.
+CREATE TABLE IF NOT EXISTS report_runs (
+    run_id        SERIAL PRIMARY KEY,
+    report_id     INT NOT NULL REFERENCES scheduled_reports(report_id) ON DELETE CASCADE,
+    user_id       INT NOT NULL REFERENCES users(userId) ON DELETE CASCADE,
+    status        VARCHAR(10) NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'sent', 'partial', 'failed')),
+    manual        BOOLEAN NOT NULL DEFAULT FALSE,
+    period_start  TIMESTAMPTZ NOT NULL,
+    period_end    TIMESTAMPTZ NOT NULL,
+    error         TEXT,
+    deliveries    JSONB NOT NULL DEFAULT '{}'::jsonb,
+    pdf           BYTEA,
+    size_bytes    INT,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_report_runs_report ON report_runs (report_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_report_runs_user ON report_runs (user_id, created_at DESC);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (118, 'Add scheduled_reports and report_runs for weekly PDF reports')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,25 @@
+-- Migration: 119_feature_flags
+-- Description: Runtime feature flags with per-user and percentage rollouts
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS feature_flags (
+    key             VARCHAR(64) PRIMARY KEY,
+    description     TEXT NOT NULL DEFAULT '',
+    -- Kill switch: a disabled flag is off for everyone
+    enabled         BOOLEAN NOT NULL DEFAULT FALSE,
+    -- Share of users, by a stable hash of key and user ID, the flag is on for
+    rollout_percent SMALLINT NOT NULL DEFAULT 100 CHECK (rollout_percent BETWEEN 0 AND 100),
+    -- Users the flag is always on for while enabled, whatever the rollout
+    user_ids        INT[] NOT NULL DEFAULT '{}',
+    updated_by      INT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (119, 'Add feature_flags')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,50 @@
+-- Migration: 120_agent_experiments
+-- Description: A/B experiments over agent prompt and model variants, their per-message outcomes, and message ratings
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS agent_experiments (
+    experiment_id SERIAL PRIMARY KEY,
+    key           VARCHAR(64) NOT NULL UNIQUE,
+    description   TEXT NOT NULL DEFAULT '',
+    status        VARCHAR(16) NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'stopped')),
+    -- [{"name", "weight", "plannerModel", "finalModel", "prompts": {"<prompt name>": <agent_prompts version>}}]
+    variants      JSONB NOT NULL,
+    created_by    INT,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ended_at      TIMESTAMPTZ
+);
+
+-- One experiment runs at a time so variants never overlap on the same prompt
+CREATE UNIQUE INDEX IF NOT EXISTS idx_agent_experiments_running
+    ON agent_experiments ((status)) WHERE status = 'running';
+
+-- One row per agent response given under an experiment
+CREATE TABLE IF NOT EXISTS agent_experiment_outcomes (
+    id              BIGSERIAL PRIMARY KEY,
+    experiment_id   INT NOT NULL REFERENCES agent_experiments(experiment_id) ON DELETE CASCADE,
+    variant         VARCHAR(64) NOT NULL,
+    user_id         INT NOT NULL,
+    conversation_id VARCHAR(36) NOT NULL,
+    message_id      UUID NOT NULL,
+    status          VARCHAR(16) NOT NULL CHECK (status IN ('completed', 'error', 'cancelled')),
+    latency_ms      INT NOT NULL,
+    retried         BOOLEAN NOT NULL DEFAULT FALSE,
+    rating          SMALLINT CHECK (rating IN (-1, 1)),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_agent_experiment_outcomes_experiment
+    ON agent_experiment_outcomes (experiment_id, variant);
+CREATE INDEX IF NOT EXISTS idx_agent_experiment_outcomes_message
+    ON agent_experiment_outcomes (message_id);
+
+-- Thumbs up (1) or down (-1) from the user on an agent response
+ALTER TABLE conversation_messages ADD COLUMN IF NOT EXISTS rating SMALLINT CHECK (rating IN (-1, 1));
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (120, 'Add agent_experiments, agent_experiment_outcomes and conversation_messages.rating')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,29 @@
+-- Migration: 121_user_feedback
+-- Description: Free-text feedback on agent response ratings and "was this alert useful?" feedback on alerts
+
+BEGIN;
+
+-- Optional comment left with a thumbs up/down on an agent response
+ALTER TABLE conversation_messages ADD COLUMN IF NOT EXISTS rating_comment TEXT;
+ALTER TABLE conversation_messages ADD COLUMN IF NOT EXISTS rated_at TIMESTAMPTZ;
+
+-- One answer per user per fired alert
+CREATE TABLE IF NOT EXISTS alert_feedback (
+    id         SERIAL PRIMARY KEY,
+    log_id     INT NOT NULL REFERENCES alert_logs(log_id) ON DELETE CASCADE,
+    user_id    INT NOT NULL REFERENCES users(userId) ON DELETE CASCADE,
+    useful     BOOLEAN NOT NULL,
+    comment    TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (log_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_feedback_user ON alert_feedback (user_id, created_at DESC);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (121, 'Add conversation_messages.rating_comment/rated_at and alert_feedback')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
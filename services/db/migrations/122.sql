@@ -0,0 +1,43 @@
+-- Migration: 122_strategy_templates
+-- Description: System-curated strategy templates and a record of each time a user creates a strategy from one
+
+BEGIN;
+
+-- Seeded and kept current by the backend at startup from its built-in catalog
+CREATE TABLE IF NOT EXISTS strategy_templates (
+    template_id       SERIAL PRIMARY KEY,
+    key               VARCHAR(64) NOT NULL UNIQUE,
+    category          VARCHAR(64) NOT NULL,
+    name              VARCHAR(100) NOT NULL,
+    description       TEXT NOT NULL,
+    -- Python strategy code with {{param}} and {{universe}} placeholders
+    python_code       TEXT NOT NULL,
+    -- [{"key", "label", "default", "min", "max", "integer"}]
+    params            JSONB NOT NULL DEFAULT '[]'::jsonb,
+    min_timeframe     VARCHAR(16) NOT NULL DEFAULT '1d',
+    -- min_bars in the code is min_bars_offset plus the value of min_bars_param, if set
+    min_bars_param    VARCHAR(64) NOT NULL DEFAULT '',
+    min_bars_offset   INT NOT NULL DEFAULT 1,
+    sort_order        INT NOT NULL DEFAULT 0,
+    active            BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_strategy_templates_category ON strategy_templates (category, sort_order);
+
+CREATE TABLE IF NOT EXISTS strategy_template_uses (
+    id          SERIAL PRIMARY KEY,
+    template_id INT NOT NULL REFERENCES strategy_templates(template_id) ON DELETE CASCADE,
+    user_id     INT NOT NULL REFERENCES users(userId) ON DELETE CASCADE,
+    strategy_id INT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_strategy_template_uses_template ON strategy_template_uses (template_id);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (122, 'Add strategy_templates and strategy_template_uses')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
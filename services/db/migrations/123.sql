@@ -0,0 +1,31 @@
+-- Migration: 123_user_onboarding
+-- Description: Provisioning queue for new accounts with per-step progress
+
+BEGIN;
+
+-- One row per account. Signup queues it; the backend worker claims queued (or
+-- stale running) rows and runs each provisioning step not yet in steps_done,
+-- so a failed or interrupted account is repaired by requeueing it.
+CREATE TABLE IF NOT EXISTS user_onboarding (
+    user_id      INT PRIMARY KEY REFERENCES users(userId) ON DELETE CASCADE,
+    status       TEXT NOT NULL DEFAULT 'queued', -- queued, running, done, failed
+    -- {"<step>": "<completed at>"}
+    steps_done   JSONB NOT NULL DEFAULT '{}'::jsonb,
+    attempts     INT NOT NULL DEFAULT 0,
+    last_error   TEXT,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at   TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_onboarding_queue
+    ON user_onboarding (created_at)
+    WHERE status IN ('queued', 'running');
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (123, 'Add user_onboarding provisioning queue')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
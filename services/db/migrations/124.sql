@@ -0,0 +1,51 @@
+-- Migration: 124_entity_dependencies
+-- Description: References between a user's entities for impact analysis before deletes and edits
+
+BEGIN;
+
+-- One row per reference from a source entity to the target it depends on,
+-- e.g. a report to a watchlist it covers or a strategy to the computed
+-- screener column its alert universe was screened on. Types are strategy,
+-- watchlist, screener_column, report, study and escalation_policy.
+CREATE TABLE IF NOT EXISTS entity_dependencies (
+    id           SERIAL PRIMARY KEY,
+    user_id      INT NOT NULL REFERENCES users(userId) ON DELETE CASCADE,
+    source_type  VARCHAR(32) NOT NULL,
+    source_id    INT NOT NULL,
+    target_type  VARCHAR(32) NOT NULL,
+    target_id    INT NOT NULL,
+    relation     VARCHAR(32) NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (source_type, source_id, target_type, target_id, relation)
+);
+
+CREATE INDEX IF NOT EXISTS idx_entity_dependencies_target
+    ON entity_dependencies (target_type, target_id);
+
+-- Backfill the references already stored elsewhere
+INSERT INTO entity_dependencies (user_id, source_type, source_id, target_type, target_id, relation)
+SELECT r.user_id, 'report', r.report_id, 'strategy', s.id, 'report'
+FROM scheduled_reports r CROSS JOIN LATERAL unnest(r.strategy_ids) AS s(id)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO entity_dependencies (user_id, source_type, source_id, target_type, target_id, relation)
+SELECT r.user_id, 'report', r.report_id, 'watchlist', w.id, 'report'
+FROM scheduled_reports r CROSS JOIN LATERAL unnest(r.watchlist_ids) AS w(id)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO entity_dependencies (user_id, source_type, source_id, target_type, target_id, relation)
+SELECT userId, 'study', studyId, 'strategy', strategyId, 'study'
+FROM studies WHERE strategyId IS NOT NULL AND userId IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+INSERT INTO entity_dependencies (user_id, source_type, source_id, target_type, target_id, relation)
+SELECT user_id, 'escalation_policy', policy_id, 'strategy', strategy_id, 'escalation'
+FROM alert_escalation_policies WHERE strategy_id IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (124, 'Add entity_dependencies for impact analysis')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,30 @@
+-- Migration: 125_strategy_alert_interval
+-- Description: Per-strategy alert evaluation interval, bounded by a per-plan minimum
+
+BEGIN;
+
+-- NULL evaluates the strategy at the alert service's base cadence
+ALTER TABLE strategies
+    ADD COLUMN IF NOT EXISTS alert_interval_seconds INTEGER
+        CHECK (alert_interval_seconds IS NULL OR alert_interval_seconds BETWEEN 10 AND 86400);
+
+-- How often a plan's strategy alerts may be evaluated at most
+ALTER TABLE subscription_products
+    ADD COLUMN IF NOT EXISTS min_strategy_alert_interval_seconds INTEGER NOT NULL DEFAULT 300;
+
+UPDATE subscription_products
+SET min_strategy_alert_interval_seconds = 60, updated_at = CURRENT_TIMESTAMP
+WHERE product_key = 'Plus';
+
+UPDATE subscription_products
+SET min_strategy_alert_interval_seconds = 10, updated_at = CURRENT_TIMESTAMP
+WHERE product_key NOT IN ('Free', 'Plus');
+
+-- Update schema version
+INSERT INTO schema_versions (version, description)
+VALUES (
+    125,
+    'Add strategies.alert_interval_seconds and subscription_products.min_strategy_alert_interval_seconds'
+) ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
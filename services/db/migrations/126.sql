@@ -0,0 +1,35 @@
+-- Migration: 126_strategy_alert_timeframes
+-- Description: Record every timeframe a strategy's alert conditions use
+
+BEGIN;
+
+-- The finest timeframe triggers the alert and the coarser ones filter it.
+-- NULL falls back to min_timeframe alone.
+ALTER TABLE strategies
+    ADD COLUMN IF NOT EXISTS alert_timeframes TEXT[];
+
+-- Backfill from the get_bar_data calls in existing strategy code, as the
+-- worker detects them for new strategies
+UPDATE strategies s
+SET alert_timeframes = detected.timeframes
+FROM (
+    SELECT strategyid, array_agg(DISTINCT lower(m[1])) AS timeframes
+    FROM strategies
+    CROSS JOIN LATERAL regexp_matches(
+        pythoncode,
+        'get_bar_data\s*\([^)]*?timeframe\s*=\s*[''"]([^''"]+)[''"]',
+        'g'
+    ) AS m
+    WHERE pythoncode IS NOT NULL
+    GROUP BY strategyid
+) detected
+WHERE s.strategyid = detected.strategyid;
+
+-- Update schema version
+INSERT INTO schema_versions (version, description)
+VALUES (
+    126,
+    'Add strategies.alert_timeframes for multi-timeframe strategy alerts'
+) ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
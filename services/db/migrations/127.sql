@@ -0,0 +1,18 @@
+-- Migration: 127_strategy_alert_sector_top_n
+-- Description: Notify only the best matches per sector of a strategy alert
+
+BEGIN;
+
+-- NULL notifies every match; otherwise only each sector's N best scores
+ALTER TABLE strategies
+    ADD COLUMN IF NOT EXISTS alert_sector_top_n INTEGER
+        CHECK (alert_sector_top_n IS NULL OR alert_sector_top_n > 0);
+
+-- Update schema version
+INSERT INTO schema_versions (version, description)
+VALUES (
+    127,
+    'Add strategies.alert_sector_top_n to limit strategy alert matches per sector'
+) ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
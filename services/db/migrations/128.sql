@@ -0,0 +1,431 @@
+-- Migration: 128_screener_refresh_shards
+-- Description: Refresh stale screener tickers in hash shards
+
+BEGIN;
+
+-- refresh_screener restricted to one shard of the stale tickers, by a hash of
+-- the ticker, so shards can be refreshed concurrently on separate
+-- connections without contending for the same rows. Returns the number of
+-- tickers it refreshed.
+CREATE OR REPLACE FUNCTION refresh_screener_shard(p_limit integer, p_shard integer, p_shards integer)
+RETURNS integer
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_now timestamptz := now();
+    stale_ticker_count integer;
+    inserted_rows_count integer;
+BEGIN
+    IF p_shards < 1 OR p_shard < 0 OR p_shard >= p_shards THEN
+        RAISE EXCEPTION 'refresh_screener_shard: shard % out of range for % shards', p_shard, p_shards;
+    END IF;
+
+    -- Bulk refresh in a single statement
+    WITH stale_tickers AS (
+        SELECT ticker
+        FROM screener_stale
+        WHERE stale = TRUE
+          AND mod(abs(hashtext(ticker)::bigint), p_shards) = p_shard
+        ORDER BY last_update_time ASC
+        LIMIT p_limit
+        FOR UPDATE SKIP LOCKED
+    ),
+    -- Store the tickers for later UPDATE
+    processed_tickers AS (
+        SELECT ticker FROM stale_tickers
+    ),
+    logged_stale_tickers AS (
+        SELECT t.*,
+               (SELECT count(*) FROM stale_tickers) as total_count
+        FROM stale_tickers t
+    ),
+    latest_daily AS (
+        SELECT
+            st.ticker,
+            cd.open,
+            cd.high,
+            cd.low,
+            cd.close,
+            cd.volume
+        FROM logged_stale_tickers st
+        LEFT JOIN mv_ohlcv_1d_latest cd ON cd.ticker = st.ticker
+    ),
+    latest_minute AS (
+        SELECT
+            st.ticker,
+            cm.open AS m_open,
+            cm.high AS m_high,
+            cm.low AS m_low,
+            cm.close AS m_close,
+            cm.volume AS m_volume
+        FROM logged_stale_tickers st
+        LEFT JOIN mv_ohlcv_1m_latest cm ON cm.ticker = st.ticker
+    ),
+    security_info AS (
+        SELECT DISTINCT ON (st.ticker)
+            st.ticker,
+            s.securityid,
+            s.market_cap,
+            s.sector,
+            s.industry
+        FROM logged_stale_tickers st
+        LEFT JOIN securities s ON s.ticker = st.ticker AND s.active = true
+        ORDER BY st.ticker, s.securityid DESC
+    ),
+    cagg_data AS (
+        SELECT
+            st.ticker,
+            cpm.pm_open AS pre_market_open,
+            cpm.pm_close AS pre_market_close,
+            cpm.pm_high AS pre_market_high,
+            cpm.pm_low AS pre_market_low,
+            cpm.pm_volume AS pre_market_volume,
+            cpm.pm_dollar_volume AS pre_market_dollar_volume,
+            ceh.eh_open AS extended_open,
+            ceh.eh_close AS extended_close,
+            ceh.eh_high AS extended_high,
+            ceh.eh_low AS extended_low,
+            ceh.eh_volume AS extended_volume,
+            ceh.eh_dollar_volume AS extended_dollar_volume,
+            -- From static_refs_1m
+            sr1m.range_15m_pct,
+            sr1m.range_1h_pct,
+            sr1m.price_4h AS c4h_close,
+            sr1m.avg_volume_1m_14,
+            sr1m.avg_dollar_volume_1m_14,
+            -- From static_refs_daily
+            srd.volatility_1w_pct,
+            srd.volatility_1m_pct,
+            srd.dma_50,
+            srd.dma_200,
+            srd.avg_volume_14d,
+            srd.avg_dollar_volume_14d
+        FROM logged_stale_tickers st
+        LEFT JOIN LATERAL (
+            SELECT *
+            FROM cagg_pre_market
+            WHERE ticker = st.ticker
+            ORDER BY trade_day DESC
+            LIMIT 1
+        ) cpm ON TRUE
+        LEFT JOIN LATERAL (
+            SELECT *
+            FROM cagg_extended_hours
+            WHERE ticker = st.ticker
+            ORDER BY trade_day DESC
+            LIMIT 1
+        ) ceh ON TRUE
+        LEFT JOIN static_refs_1m sr1m ON sr1m.ticker = st.ticker
+        LEFT JOIN static_refs_daily srd ON srd.ticker = st.ticker
+    ),
+    rsi_calc AS (
+        SELECT
+            st.ticker,
+            CASE
+                WHEN avg_gain IS NULL AND avg_loss IS NULL THEN NULL          -- not enough data
+                WHEN avg_loss = 0 THEN 100                                    -- all gains / flat up
+                WHEN avg_gain IS NULL THEN 0                                  -- all losses / flat down
+                ELSE 100 - (100 / (1 + safe_div(avg_gain, avg_loss)))        -- RSI formula (SMA seed)
+            END AS rsi_14
+        FROM logged_stale_tickers st
+        LEFT JOIN LATERAL (
+            WITH last15 AS (
+                SELECT close/1000.0 AS c, timestamp
+                FROM ohlcv_1d
+                WHERE ticker = st.ticker 
+                  AND "timestamp" >= (now() - INTERVAL '60 days')            -- Broader filter for RSI calculation
+                ORDER BY timestamp DESC      -- grab most recent 15 daily bars
+                LIMIT 15
+            ),
+            chron AS (
+                SELECT c, timestamp
+                FROM last15
+                ORDER BY timestamp            -- oldest→newest so LAG works chronologically
+            )
+            SELECT
+                avg(gain) AS avg_gain,
+                avg(loss) AS avg_loss
+            FROM (
+                SELECT
+                    COALESCE(GREATEST(c - LAG(c) OVER w, 0), 0) AS gain,
+                    COALESCE(GREATEST(LAG(c) OVER w - c, 0), 0) AS loss
+                FROM chron
+                WINDOW w AS (ORDER BY timestamp)
+            ) diffs
+        ) r ON TRUE
+    ),
+    historical_prices AS (
+        SELECT 
+            st.ticker,
+            srd.price_prev_close,
+            srd.price_1d,
+            srd.price_1w,
+            srd.price_1m,
+            srd.price_3m,
+            srd.price_6m,
+            srd.price_1y,
+            srd.price_5y,
+            srd.price_10y,
+            srd.price_ytd,
+            srd.price_all,
+            srd.price_52w_low,
+            srd.price_52w_high
+        FROM logged_stale_tickers st
+        LEFT JOIN static_refs_daily srd ON srd.ticker = st.ticker
+    ),
+    intraday_prices AS (
+        SELECT
+            st.ticker,
+            sr1m.price_1m AS price_1m_min,
+            sr1m.price_15m AS price_15m_min,
+            sr1m.price_1h AS price_1h_min,
+            sr1m.price_4h AS price_4h_min
+        FROM logged_stale_tickers st
+        LEFT JOIN static_refs_1m sr1m ON sr1m.ticker = st.ticker
+    ),
+    market_close_data AS (
+        SELECT
+            st.ticker,
+            mc.close AS market_close
+        FROM logged_stale_tickers st
+        LEFT JOIN LATERAL (
+            SELECT close / 1000.0 AS close
+            FROM ohlcv_1m
+            WHERE ticker = st.ticker
+            AND "timestamp" >= (v_now - INTERVAL '2 days')  -- Limit to recent data first
+            AND (timestamp AT TIME ZONE 'America/New_York')::time = '16:00'
+            AND timestamp::date = v_now::date
+            ORDER BY timestamp DESC LIMIT 1
+        ) mc ON TRUE
+    ),
+    avg_volumes AS (
+        SELECT
+            st.ticker,
+            avg(o.volume) AS avg_volume_1m,
+            avg(o.volume * o.close) AS avg_dollar_volume_1m
+        FROM logged_stale_tickers st
+        LEFT JOIN LATERAL (
+            SELECT volume, close / 1000.0 AS close
+            FROM ohlcv_1d
+            WHERE ticker = st.ticker
+            AND "timestamp" >= (v_now - INTERVAL '60 days')  -- Broad filter for volume calculations
+            ORDER BY timestamp DESC
+            LIMIT 30
+        ) o ON TRUE
+        GROUP BY st.ticker
+    ),
+    spy_metrics AS (
+        SELECT
+            o.close / 1000.0 AS spy_ld_close,
+            (SELECT close / 1000.0 FROM ohlcv_1d WHERE ticker = 'SPY' AND "timestamp" >= (v_now - INTERVAL '2 years') ORDER BY ABS(EXTRACT(EPOCH FROM ("timestamp" - (v_now - INTERVAL '1 month')))) ASC LIMIT 1) AS spy_price_1m,
+            (SELECT close / 1000.0 FROM ohlcv_1d WHERE ticker = 'SPY' AND "timestamp" >= (v_now - INTERVAL '2 years') ORDER BY ABS(EXTRACT(EPOCH FROM ("timestamp" - (v_now - INTERVAL '1 year')))) ASC LIMIT 1) AS spy_price_1y
+        FROM ohlcv_1d o
+        WHERE o.ticker = 'SPY'
+          AND o."timestamp" >= (v_now - INTERVAL '7 days')  -- Only need recent SPY close
+        ORDER BY o.timestamp DESC
+        LIMIT 1
+    ),
+    computed_metrics AS (
+        SELECT
+            si.ticker,
+            v_now AS calc_time,
+            si.securityid AS security_id,
+            ld.open,
+            ld.high,
+            ld.low,
+            ld.close,
+            hp.price_52w_low AS wk52_low,
+            hp.price_52w_high AS wk52_high,
+            cd.pre_market_open,
+            cd.pre_market_high,
+            cd.pre_market_low,
+            cd.pre_market_close,
+            si.market_cap,
+            si.sector,
+            si.industry,
+            (cd.pre_market_close - cd.pre_market_open) AS pre_market_change,
+            CASE WHEN cd.pre_market_open = 0 OR cd.pre_market_open IS NULL THEN NULL ELSE ((cd.pre_market_close - cd.pre_market_open) / cd.pre_market_open) * 100 END AS pre_market_change_pct,
+            CASE WHEN (v_now AT TIME ZONE 'America/New_York')::time BETWEEN '16:00' AND '20:00' THEN lm.m_close - mcd.market_close ELSE NULL END AS extended_hours_change,
+            CASE WHEN (v_now AT TIME ZONE 'America/New_York')::time BETWEEN '16:00' AND '20:00' AND mcd.market_close != 0 AND mcd.market_close IS NOT NULL THEN ((lm.m_close - mcd.market_close) / mcd.market_close) * 100 ELSE NULL END AS extended_hours_change_pct,
+            CASE WHEN ip.price_1m_min = 0 OR ip.price_1m_min IS NULL THEN NULL ELSE (lm.m_close - ip.price_1m_min) / ip.price_1m_min * 100 END AS change_1_pct,
+            CASE WHEN ip.price_15m_min = 0 OR ip.price_15m_min IS NULL THEN NULL ELSE (lm.m_close - ip.price_15m_min) / ip.price_15m_min * 100 END AS change_15_pct,
+            CASE WHEN ip.price_1h_min = 0 OR ip.price_1h_min IS NULL THEN NULL ELSE (lm.m_close - ip.price_1h_min) / ip.price_1h_min * 100 END AS change_1h_pct,
+            CASE WHEN ip.price_4h_min = 0 OR ip.price_4h_min IS NULL THEN NULL ELSE (lm.m_close - ip.price_4h_min) / ip.price_4h_min * 100 END AS change_4h_pct,
+            CASE WHEN hp.price_1d = 0 OR hp.price_1d IS NULL THEN NULL ELSE (ld.close - hp.price_1d) / hp.price_1d * 100 END AS change_1d_pct,
+            CASE WHEN hp.price_1w = 0 OR hp.price_1w IS NULL THEN NULL ELSE (ld.close - hp.price_1w) / hp.price_1w * 100 END AS change_1w_pct,
+            CASE WHEN hp.price_1m = 0 OR hp.price_1m IS NULL THEN NULL ELSE (ld.close - hp.price_1m) / hp.price_1m * 100 END AS change_1m_pct,
+            CASE WHEN hp.price_3m = 0 OR hp.price_3m IS NULL THEN NULL ELSE (ld.close - hp.price_3m) / hp.price_3m * 100 END AS change_3m_pct,
+            CASE WHEN hp.price_6m = 0 OR hp.price_6m IS NULL THEN NULL ELSE (ld.close - hp.price_6m) / hp.price_6m * 100 END AS change_6m_pct,
+            CASE WHEN hp.price_ytd = 0 OR hp.price_ytd IS NULL THEN NULL ELSE (ld.close - hp.price_ytd) / hp.price_ytd * 100 END AS change_ytd_pct,
+            CASE WHEN hp.price_1y = 0 OR hp.price_1y IS NULL THEN NULL ELSE (ld.close - hp.price_1y) / hp.price_1y * 100 END AS change_1y_pct,
+            CASE WHEN hp.price_5y = 0 OR hp.price_5y IS NULL THEN NULL ELSE (ld.close - hp.price_5y) / hp.price_5y * 100 END AS change_5y_pct,
+            CASE WHEN hp.price_10y = 0 OR hp.price_10y IS NULL THEN NULL ELSE (ld.close - hp.price_10y) / hp.price_10y * 100 END AS change_10y_pct,
+            CASE WHEN hp.price_all = 0 OR hp.price_all IS NULL THEN NULL ELSE (ld.close - hp.price_all) / hp.price_all * 100 END AS change_all_time_pct,
+            (ld.close - ld.open) AS change_from_open,
+            CASE WHEN ld.open = 0 OR ld.open IS NULL THEN NULL ELSE ((ld.close - ld.open) / ld.open) * 100 END AS change_from_open_pct,
+            CASE WHEN hp.price_52w_high = 0 OR hp.price_52w_high IS NULL THEN NULL ELSE ld.close / hp.price_52w_high * 100 END AS price_over_52wk_high,
+            CASE WHEN hp.price_52w_low = 0 OR hp.price_52w_low IS NULL THEN NULL ELSE ld.close / hp.price_52w_low * 100 END AS price_over_52wk_low,
+            rc.rsi_14 AS rsi,
+            cd.dma_200,
+            cd.dma_50,
+            CASE WHEN cd.dma_50 = 0 OR cd.dma_50 IS NULL THEN NULL ELSE ld.close / cd.dma_50 * 100 END AS price_over_50dma,
+            CASE WHEN cd.dma_200 = 0 OR cd.dma_200 IS NULL THEN NULL ELSE ld.close / cd.dma_200 * 100 END AS price_over_200dma,
+            CASE 
+                WHEN spy.spy_price_1y = 0 OR spy.spy_price_1y IS NULL OR hp.price_1y = 0 OR hp.price_1y IS NULL THEN NULL 
+                WHEN spy.spy_ld_close = 0 OR spy.spy_ld_close IS NULL THEN NULL
+                ELSE safe_div(safe_div(ld.close - hp.price_1y, hp.price_1y), safe_div(spy.spy_ld_close - spy.spy_price_1y, spy.spy_price_1y))
+            END AS beta_1y_vs_spy,
+            CASE 
+                WHEN spy.spy_price_1m = 0 OR spy.spy_price_1m IS NULL OR hp.price_1m = 0 OR hp.price_1m IS NULL THEN NULL 
+                WHEN spy.spy_ld_close = 0 OR spy.spy_ld_close IS NULL THEN NULL
+                ELSE safe_div(safe_div(ld.close - hp.price_1m, hp.price_1m), safe_div(spy.spy_ld_close - spy.spy_price_1m, spy.spy_price_1m))
+            END AS beta_1m_vs_spy,
+            ld.volume,
+            av.avg_volume_1m,
+            CASE WHEN ld.close IS NULL OR ld.volume IS NULL THEN NULL ELSE ld.close * ld.volume END AS dollar_volume,
+            av.avg_dollar_volume_1m,
+            cd.pre_market_volume,
+            cd.pre_market_dollar_volume,
+            CASE WHEN cd.avg_volume_1m_14 = 0 OR cd.avg_volume_1m_14 IS NULL THEN NULL ELSE lm.m_volume / cd.avg_volume_1m_14 END AS relative_volume_14,
+            CASE WHEN cd.avg_volume_14d = 0 OR cd.avg_volume_14d IS NULL THEN NULL ELSE cd.pre_market_volume / cd.avg_volume_14d END AS pre_market_vol_over_14d_vol,
+            CASE WHEN lm.m_low = 0 OR lm.m_low IS NULL THEN NULL ELSE (lm.m_high - lm.m_low) / lm.m_low * 100 END AS range_1m_pct,
+            cd.range_15m_pct,
+            cd.range_1h_pct,
+            CASE WHEN ld.low = 0 OR ld.low IS NULL THEN NULL ELSE (ld.high - ld.low) / ld.low * 100 END AS day_range_pct,
+            cd.volatility_1w_pct,
+            cd.volatility_1m_pct,
+            CASE WHEN cd.pre_market_low = 0 OR cd.pre_market_low IS NULL THEN NULL ELSE (cd.pre_market_high - cd.pre_market_low) / cd.pre_market_low * 100 END AS pre_market_range_pct
+        FROM security_info si
+        JOIN latest_daily ld ON ld.ticker = si.ticker
+        JOIN latest_minute lm ON lm.ticker = si.ticker
+        JOIN cagg_data cd ON cd.ticker = si.ticker
+        JOIN rsi_calc rc ON rc.ticker = si.ticker
+        JOIN historical_prices hp ON hp.ticker = si.ticker
+        JOIN intraday_prices ip ON ip.ticker = si.ticker
+        JOIN market_close_data mcd ON mcd.ticker = si.ticker
+        JOIN avg_volumes av ON av.ticker = si.ticker
+        CROSS JOIN spy_metrics spy
+        WHERE ld.close IS NOT NULL AND lm.m_close IS NOT NULL  -- Skip if no data
+    ),
+    inserted AS (
+        INSERT INTO screener (
+            ticker, calc_time, security_id, open, high, low, close, wk52_low, wk52_high,
+            pre_market_open, pre_market_high, pre_market_low, pre_market_close,
+            market_cap, sector, industry,
+            pre_market_change, pre_market_change_pct, extended_hours_change, extended_hours_change_pct,
+            change_1_pct, change_15_pct, change_1h_pct, change_4h_pct,
+            change_1d_pct, change_1w_pct, change_1m_pct, change_3m_pct, change_6m_pct,
+            change_ytd_pct, change_1y_pct, change_5y_pct, change_10y_pct, change_all_time_pct,
+            change_from_open, change_from_open_pct, price_over_52wk_high, price_over_52wk_low,
+            rsi, dma_200, dma_50, price_over_50dma, price_over_200dma,
+            beta_1y_vs_spy, beta_1m_vs_spy,
+            volume, avg_volume_1m, dollar_volume, avg_dollar_volume_1m,
+            pre_market_volume, pre_market_dollar_volume, relative_volume_14, pre_market_vol_over_14d_vol,
+            range_1m_pct, range_15m_pct, range_1h_pct, day_range_pct,
+            volatility_1w_pct, volatility_1m_pct, pre_market_range_pct
+        )
+        SELECT *
+        FROM computed_metrics
+        ON CONFLICT (ticker) DO UPDATE SET
+            calc_time = EXCLUDED.calc_time,
+            security_id = EXCLUDED.security_id,
+            open = EXCLUDED.open,
+            high = EXCLUDED.high,
+            low = EXCLUDED.low,
+            close = EXCLUDED.close,
+            wk52_low = EXCLUDED.wk52_low,
+            wk52_high = EXCLUDED.wk52_high,
+            pre_market_open = EXCLUDED.pre_market_open,
+            pre_market_high = EXCLUDED.pre_market_high,
+            pre_market_low = EXCLUDED.pre_market_low,
+            pre_market_close = EXCLUDED.pre_market_close,
+            market_cap = EXCLUDED.market_cap,
+            sector = EXCLUDED.sector,
+            industry = EXCLUDED.industry,
+            pre_market_change = EXCLUDED.pre_market_change,
+            pre_market_change_pct = EXCLUDED.pre_market_change_pct,
+            extended_hours_change = EXCLUDED.extended_hours_change,
+            extended_hours_change_pct = EXCLUDED.extended_hours_change_pct,
+            change_1_pct = EXCLUDED.change_1_pct,
+            change_15_pct = EXCLUDED.change_15_pct,
+            change_1h_pct = EXCLUDED.change_1h_pct,
+            change_4h_pct = EXCLUDED.change_4h_pct,
+            change_1d_pct = EXCLUDED.change_1d_pct,
+            change_1w_pct = EXCLUDED.change_1w_pct,
+            change_1m_pct = EXCLUDED.change_1m_pct,
+            change_3m_pct = EXCLUDED.change_3m_pct,
+            change_6m_pct = EXCLUDED.change_6m_pct,
+            change_ytd_pct = EXCLUDED.change_ytd_pct,
+            change_1y_pct = EXCLUDED.change_1y_pct,
+            change_5y_pct = EXCLUDED.change_5y_pct,
+            change_10y_pct = EXCLUDED.change_10y_pct,
+            change_all_time_pct = EXCLUDED.change_all_time_pct,
+            change_from_open = EXCLUDED.change_from_open,
+            change_from_open_pct = EXCLUDED.change_from_open_pct,
+            price_over_52wk_high = EXCLUDED.price_over_52wk_high,
+            price_over_52wk_low = EXCLUDED.price_over_52wk_low,
+            rsi = EXCLUDED.rsi,
+            dma_200 = EXCLUDED.dma_200,
+            dma_50 = EXCLUDED.dma_50,
+            price_over_50dma = EXCLUDED.price_over_50dma,
+            price_over_200dma = EXCLUDED.price_over_200dma,
+            beta_1y_vs_spy = EXCLUDED.beta_1y_vs_spy,
+            beta_1m_vs_spy = EXCLUDED.beta_1m_vs_spy,
+            volume = EXCLUDED.volume,
+            avg_volume_1m = EXCLUDED.avg_volume_1m,
+            dollar_volume = EXCLUDED.dollar_volume,
+            avg_dollar_volume_1m = EXCLUDED.avg_dollar_volume_1m,
+            pre_market_volume = EXCLUDED.pre_market_volume,
+            pre_market_dollar_volume = EXCLUDED.pre_market_dollar_volume,
+            relative_volume_14 = EXCLUDED.relative_volume_14,
+            pre_market_vol_over_14d_vol = EXCLUDED.pre_market_vol_over_14d_vol,
+            range_1m_pct = EXCLUDED.range_1m_pct,
+            range_15m_pct = EXCLUDED.range_15m_pct,
+            range_1h_pct = EXCLUDED.range_1h_pct,
+            day_range_pct = EXCLUDED.day_range_pct,
+            volatility_1w_pct = EXCLUDED.volatility_1w_pct,
+            volatility_1m_pct = EXCLUDED.volatility_1m_pct,
+            pre_market_range_pct = EXCLUDED.pre_market_range_pct
+        RETURNING 1
+    ),
+    counts AS (
+        SELECT 
+            (SELECT count(*) FROM logged_stale_tickers) as stale_count,
+            (SELECT count(*) FROM inserted) as inserted_count
+    ),
+    -- Mark the processed tickers as fresh within the same transaction
+    mark_fresh AS (
+        UPDATE screener_stale ss
+        SET stale = FALSE,
+            last_update_time = v_now
+        FROM processed_tickers pt
+        WHERE ss.ticker = pt.ticker
+        RETURNING 1
+    )
+    SELECT stale_count, inserted_count
+    INTO stale_ticker_count, inserted_rows_count
+    FROM counts;
+
+    RAISE NOTICE 'refresh_screener_shard %/%: Found % stale tickers, inserted % rows into screener.', p_shard, p_shards, stale_ticker_count, inserted_rows_count;
+
+    RETURN stale_ticker_count;
+
+END;
+$$;
+
+-- The unsharded refresh is the single-shard case
+CREATE OR REPLACE FUNCTION refresh_screener(p_limit integer)
+RETURNS VOID
+LANGUAGE plpgsql AS $$
+BEGIN
+    PERFORM refresh_screener_shard(p_limit, 0, 1);
+END;
+$$;
+
+-- Update schema version
+INSERT INTO schema_versions (version, description)
+VALUES (
+    128,
+    'Add refresh_screener_shard for sharded screener refreshes'
+) ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
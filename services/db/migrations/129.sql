@@ -0,0 +1,54 @@
+-- Migration: 129_ticker_search_index
+-- Description: Materialized ticker search index ranked by liquidity
+
+BEGIN;
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- One row per listed ticker with what the ticker search matches on and ranks
+-- by. popularity blends 14 day dollar volume with market cap so the liquid
+-- name wins among equally good matches. Refreshed by the
+-- RefreshTickerSearchIndex job.
+CREATE MATERIALIZED VIEW IF NOT EXISTS ticker_search_index AS
+SELECT DISTINCT ON (s.ticker_norm)
+    s.securityid,
+    s.ticker,
+    s.ticker_norm,
+    upper(COALESCE(s.name, '')) AS name_upper,
+    to_tsvector('simple', COALESCE(s.name, '')) AS name_tsv,
+    ln(1 + GREATEST(COALESCE(r.avg_dollar_volume_14d, 0), 0))
+        + 0.5 * ln(1 + GREATEST(COALESCE(s.market_cap, 0), 0)) AS popularity
+FROM securities s
+LEFT JOIN static_refs_daily r ON r.ticker = s.ticker
+WHERE s.maxDate IS NULL
+ORDER BY s.ticker_norm, s.securityid DESC;
+
+-- Unique so the index can be refreshed concurrently
+CREATE UNIQUE INDEX IF NOT EXISTS ticker_search_index_securityid
+    ON ticker_search_index (securityid);
+
+CREATE INDEX IF NOT EXISTS ticker_search_index_ticker_pattern
+    ON ticker_search_index (ticker_norm text_pattern_ops);
+
+CREATE INDEX IF NOT EXISTS ticker_search_index_name_pattern
+    ON ticker_search_index (name_upper text_pattern_ops);
+
+-- Typo tolerance: similarity on tickers, word similarity on names
+CREATE INDEX IF NOT EXISTS ticker_search_index_ticker_trgm
+    ON ticker_search_index USING gin (ticker_norm gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS ticker_search_index_name_trgm
+    ON ticker_search_index USING gin (name_upper gin_trgm_ops);
+
+-- Prefix matches on any word of the company name
+CREATE INDEX IF NOT EXISTS ticker_search_index_name_tsv
+    ON ticker_search_index USING gin (name_tsv);
+
+-- Update schema version
+INSERT INTO schema_versions (version, description)
+VALUES (
+    129,
+    'Add ticker_search_index materialized view for ranked fuzzy ticker search'
+) ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,28 @@
+-- Migration: 130_search_history
+-- Description: Per-user history of global search selections
+
+BEGIN;
+
+-- What each user picked from the global search, one row per entity. Recent and
+-- frequent entries are offered as shortcuts before anything is typed and lift
+-- matching results above equally good matches the user never opens.
+CREATE TABLE IF NOT EXISTS search_history (
+    user_id INT NOT NULL REFERENCES users(userId) ON DELETE CASCADE,
+    entity_type TEXT NOT NULL CHECK (entity_type IN ('security', 'strategy', 'watchlist', 'study')),
+    entity_id INT NOT NULL,
+    uses INT NOT NULL DEFAULT 1,
+    last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, entity_type, entity_id)
+);
+
+CREATE INDEX IF NOT EXISTS search_history_recent
+    ON search_history (user_id, last_used_at DESC);
+
+-- Update schema version
+INSERT INTO schema_versions (version, description)
+VALUES (
+    130,
+    'Add search_history for global search shortcuts'
+) ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,44 @@
+-- Migration: 131_notification_outbox
+-- Description: Persist alert notifications before dispatch so they survive restarts
+
+BEGIN;
+
+-- One row per alert notification, written before any channel is tried. The
+-- alert service delivers it and marks it delivered; rows left pending or
+-- delivering past their lease (the process died mid-dispatch) are picked up
+-- again by the outbox loop on any replica. sent_channels records the
+-- fallback channels already done so a retry doesn't repeat them.
+CREATE TABLE IF NOT EXISTS notification_outbox (
+    outbox_id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(userId) ON DELETE CASCADE,
+    alert_type TEXT NOT NULL,
+    log_id INTEGER,
+    message JSONB NOT NULL,
+    snapshot JSONB,
+    status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'delivering', 'delivered', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    sent_channels TEXT[] NOT NULL DEFAULT '{}',
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    claimed_until TIMESTAMPTZ,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    delivered_at TIMESTAMPTZ
+);
+
+-- The outbox loop's scan: undelivered rows by when they are next due
+CREATE INDEX IF NOT EXISTS notification_outbox_due
+    ON notification_outbox (next_attempt_at)
+    WHERE status IN ('pending', 'delivering');
+
+CREATE INDEX IF NOT EXISTS notification_outbox_created
+    ON notification_outbox (created_at);
+
+-- Update schema version
+INSERT INTO schema_versions (version, description)
+VALUES (
+    131,
+    'Add notification_outbox for crash-safe alert delivery'
+) ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
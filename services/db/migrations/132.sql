@@ -0,0 +1,24 @@
+-- Migration: 132_notification_rate_limits
+-- Description: Per-user, per-channel alert notification rate limits
+
+BEGIN;
+
+-- At most max_notifications alerts go out over a channel per window; the rest
+-- are held back and sent as one summary when the window ends. A channel
+-- without a row uses the service default; max_notifications = 0 turns the
+-- limit off.
+CREATE TABLE IF NOT EXISTS notification_rate_limits (
+    user_id           INT NOT NULL REFERENCES users(userId) ON DELETE CASCADE,
+    channel           TEXT NOT NULL CHECK (channel IN ('websocket', 'telegram', 'email')),
+    max_notifications INT NOT NULL CHECK (max_notifications >= 0),
+    window_minutes    INT NOT NULL CHECK (window_minutes BETWEEN 1 AND 1440),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, channel)
+);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (132, 'Add notification_rate_limits for collapsing alert bursts')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,15 @@
+-- Migration: 133_notification_outbox_content
+-- Description: Store the template behind each outbox notification
+
+BEGIN;
+
+-- The template and variables the notification is written from, so a retry
+-- renders each channel's variant in the user's language. Rows without it are
+-- sent with their message as is.
+ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS content JSONB;
+
+INSERT INTO schema_versions (version, description)
+VALUES (133, 'Store the template behind each outbox notification')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,24 @@
+-- Migration: 134_alert_metric_buckets
+-- Description: Keep alert and strategy metrics as hourly and daily buckets
+
+BEGIN;
+
+-- Counts of the alert loop's counters per hour, rolled up into days. Counters
+-- are summed across backends; gauges (e.g. total_ticker_updates) keep the
+-- latest reading of the hour and the day's highest.
+CREATE TABLE IF NOT EXISTS alert_metric_buckets (
+    granularity TEXT NOT NULL CHECK (granularity IN ('hour', 'day')),
+    metric TEXT NOT NULL,
+    bucket TIMESTAMPTZ NOT NULL,
+    value BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (granularity, metric, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_metric_buckets_bucket
+    ON alert_metric_buckets (granularity, bucket);
+
+INSERT INTO schema_versions (version, description)
+VALUES (134, 'Keep alert and strategy metrics as hourly and daily buckets')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
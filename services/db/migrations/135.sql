@@ -0,0 +1,45 @@
+-- Migration: 135_workspaces
+-- Description: Team workspaces that share strategies and watchlists between members
+
+BEGIN;
+
+-- A workspace is a small team. Strategies and watchlists stay owned by one
+-- user but can be placed in a workspace, where every member can use them
+-- with the access their role gives: viewer (read and run), editor (also
+-- change them and their alerts) or admin (also move, transfer and delete
+-- them, and manage members).
+CREATE TABLE IF NOT EXISTS workspaces (
+    workspace_id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_by INT REFERENCES users(userId) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+    workspace_id INT NOT NULL REFERENCES workspaces(workspace_id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(userId) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('viewer', 'editor', 'admin')),
+    added_by INT REFERENCES users(userId) ON DELETE SET NULL,
+    added_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_workspace_members_user
+    ON workspace_members (user_id);
+
+-- Deleting a workspace hands its entities back to their owners as private
+ALTER TABLE strategies
+    ADD COLUMN IF NOT EXISTS workspace_id INT REFERENCES workspaces(workspace_id) ON DELETE SET NULL;
+ALTER TABLE watchlists
+    ADD COLUMN IF NOT EXISTS workspace_id INT REFERENCES workspaces(workspace_id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_strategies_workspace
+    ON strategies (workspace_id) WHERE workspace_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_watchlists_workspace
+    ON watchlists (workspace_id) WHERE workspace_id IS NOT NULL;
+
+INSERT INTO schema_versions (version, description)
+VALUES (135, 'Team workspaces that share strategies and watchlists between members')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,28 @@
+-- Migration: 136_task_cost_thresholds
+-- Description: Per-plan thresholds on the estimated worker time of a backtest or strategy alert
+
+BEGIN;
+
+-- A backtest estimated to take longer than the confirm threshold, or a
+-- strategy alert estimated to take longer per trading day, only runs once the
+-- user confirms the estimate; past the limit it is refused
+ALTER TABLE subscription_products
+    ADD COLUMN IF NOT EXISTS task_cost_confirm_seconds INTEGER NOT NULL DEFAULT 60,
+    ADD COLUMN IF NOT EXISTS task_cost_limit_seconds INTEGER NOT NULL DEFAULT 600;
+
+UPDATE subscription_products
+SET task_cost_confirm_seconds = 300, task_cost_limit_seconds = 3600, updated_at = CURRENT_TIMESTAMP
+WHERE product_key = 'Plus';
+
+UPDATE subscription_products
+SET task_cost_confirm_seconds = 900, task_cost_limit_seconds = 14400, updated_at = CURRENT_TIMESTAMP
+WHERE product_key NOT IN ('Free', 'Plus');
+
+-- Update schema version
+INSERT INTO schema_versions (version, description)
+VALUES (
+    136,
+    'Add subscription_products.task_cost_confirm_seconds and task_cost_limit_seconds'
+) ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,32 @@
+-- Migration: 137_alert_webhooks
+-- Description: User webhooks that receive alert triggers as versioned JSON events
+
+BEGIN;
+
+-- Every price and strategy alert trigger of the user is POSTed to each active
+-- webhook whose alert_types include it, as a JSON event of the webhook's
+-- schema (see internal/services/alerts/webhook.go), signed with secret.
+-- A webhook that keeps failing is deactivated after too many failures in a row.
+CREATE TABLE IF NOT EXISTS alert_webhooks (
+    webhook_id       SERIAL PRIMARY KEY,
+    user_id          INT NOT NULL REFERENCES users(userId) ON DELETE CASCADE,
+    name             TEXT NOT NULL DEFAULT '',
+    url              TEXT NOT NULL,
+    schema           TEXT NOT NULL DEFAULT 'peripheral.alert.v1',
+    alert_types      TEXT[] NOT NULL DEFAULT ARRAY['price', 'strategy'],
+    secret           TEXT NOT NULL,
+    active           BOOLEAN NOT NULL DEFAULT TRUE,
+    failure_count    INT NOT NULL DEFAULT 0,
+    last_status      TEXT,
+    last_delivery_at TIMESTAMPTZ,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_webhooks_user ON alert_webhooks (user_id) WHERE active;
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (137, 'Add alert_webhooks for delivering alert triggers to user automation')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,23 @@
+-- Migration: 138_conversation_search
+-- Description: Full-text search over stored agent conversations
+
+BEGIN;
+
+-- The question weighs more than the answer, whose text lives in the "text"
+-- chunks of content_chunks (response_text is not written anymore)
+ALTER TABLE conversation_messages
+    ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', COALESCE(query, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(
+            jsonb_path_query_array(content_chunks, '$[*] ? (@.type == "text").content')::text, '')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_conversation_messages_search
+    ON conversation_messages USING GIN (search_vector);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (138, 'Add conversation_messages.search_vector for conversation search')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
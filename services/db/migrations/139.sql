@@ -0,0 +1,24 @@
+-- Migration: 139_strategy_tags
+-- Description: Category tags (momentum, mean-reversion, breakout, ...) on strategies and templates
+
+BEGIN;
+
+-- Written by the backend's tagging pass from each strategy's code and text.
+-- tags_version is the version of the rules that wrote them; rows behind the
+-- current rules, new versions from the worker among them, are retagged.
+ALTER TABLE strategies
+    ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS tags_version SMALLINT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_strategies_tags ON strategies USING GIN (tags);
+CREATE INDEX IF NOT EXISTS idx_strategies_tags_version ON strategies (tags_version);
+
+ALTER TABLE strategy_templates
+    ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (139, 'Add strategies.tags and strategy_templates.tags')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,13 @@
+-- Migration: 140_chart_images_created_index
+-- Description: Index chart_images by age for the retention sweep
+
+BEGIN;
+
+CREATE INDEX IF NOT EXISTS idx_chart_images_created ON chart_images (created_at);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (140, 'Index chart_images.created_at for retention')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
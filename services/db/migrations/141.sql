@@ -0,0 +1,14 @@
+-- Migration: 141_user_telegram_chat
+-- Description: The Telegram chat a user linked through the bot, for alerts and reports sent to them
+
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS telegram_chat_id BIGINT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS telegram_linked_at TIMESTAMPTZ;
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (141, 'Add users.telegram_chat_id for linked Telegram chats')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
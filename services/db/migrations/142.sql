@@ -0,0 +1,13 @@
+-- Migration: 142_reports_linked_telegram_chat
+-- Description: Reports go to the user's linked Telegram chat, not a chat ID set on the report
+
+BEGIN;
+
+ALTER TABLE scheduled_reports DROP COLUMN IF EXISTS telegram_chat_id;
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (142, 'Drop scheduled_reports.telegram_chat_id in favour of users.telegram_chat_id')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,13 @@
+-- Migration: 143_strategy_alert_universe_filters
+-- Description: Keep the screen a strategy alert's universe was defined by, so it is resolved at each evaluation
+
+BEGIN;
+
+ALTER TABLE strategies ADD COLUMN IF NOT EXISTS alert_universe_filters JSONB;
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (143, 'Add strategies.alert_universe_filters, the screen an alert universe is resolved from at each evaluation')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
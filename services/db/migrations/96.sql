@@ -0,0 +1,34 @@
+-- Migration: 096_screener_computed_columns
+-- Description: User-defined screener columns expressed as formulas over existing screener columns
+
+BEGIN;
+
+-- One row per user-defined column. The formula is stored as entered and
+-- recompiled (and re-validated) server-side every time it is used.
+CREATE TABLE IF NOT EXISTS screener_computed_columns (
+    column_id  SERIAL PRIMARY KEY,
+    user_id    INT NOT NULL REFERENCES users(userId) ON DELETE CASCADE,
+    name       TEXT NOT NULL,
+    formula    TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_screener_computed_columns_user ON screener_computed_columns (user_id);
+
+-- Values materialized during the screener refresh, one row per column and ticker
+CREATE TABLE IF NOT EXISTS screener_computed_values (
+    column_id INT NOT NULL REFERENCES screener_computed_columns(column_id) ON DELETE CASCADE,
+    ticker    TEXT NOT NULL,
+    value     DOUBLE PRECISION,
+    calc_time TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (column_id, ticker)
+);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (96, 'Add screener_computed_columns and screener_computed_values for user-defined screener formulas')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
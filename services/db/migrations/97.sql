@@ -0,0 +1,87 @@
+-- Migration: 097_screener_snapshots
+-- Description: Daily snapshots of a subset of screener columns for as-of screening and backtest universes
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS screener_snapshots (
+    snapshot_date          DATE NOT NULL,
+    ticker                 TEXT NOT NULL,
+    security_id            BIGINT,
+    open                   REAL,
+    high                   REAL,
+    low                    REAL,
+    close                  REAL,
+    wk52_low               REAL,
+    wk52_high              REAL,
+    market_cap             DOUBLE PRECISION,
+    sector                 TEXT,
+    industry               TEXT,
+    change_1d_pct          REAL,
+    change_1w_pct          REAL,
+    change_1m_pct          REAL,
+    change_3m_pct          REAL,
+    change_6m_pct          REAL,
+    change_ytd_pct         REAL,
+    change_1y_pct          REAL,
+    price_over_52wk_high   REAL,
+    price_over_52wk_low    REAL,
+    rsi                    REAL,
+    dma_50                 REAL,
+    dma_200                REAL,
+    price_over_50dma       REAL,
+    price_over_200dma      REAL,
+    beta_1y_vs_spy         REAL,
+    volume                 BIGINT,
+    avg_volume_1m          DOUBLE PRECISION,
+    dollar_volume          DOUBLE PRECISION,
+    avg_dollar_volume_1m   DOUBLE PRECISION,
+    relative_volume_14     REAL,
+    day_range_pct          REAL,
+    volatility_1w_pct      REAL,
+    volatility_1m_pct      REAL,
+    PRIMARY KEY (snapshot_date, ticker)
+);
+
+-- Convert to hypertable partitioned by month of snapshots
+DO $$ BEGIN
+IF NOT EXISTS (
+    SELECT 1
+    FROM timescaledb_information.hypertables
+    WHERE hypertable_name = 'screener_snapshots'
+) THEN PERFORM create_hypertable(
+    'screener_snapshots',
+    'snapshot_date',
+    chunk_time_interval => INTERVAL '1 month',
+    if_not_exists => TRUE
+);
+END IF;
+END $$;
+
+-- Compress older snapshots; they are only ever read
+DO $$ BEGIN
+BEGIN
+ALTER TABLE screener_snapshots
+SET (
+        timescaledb.compress,
+        timescaledb.compress_orderby = 'snapshot_date DESC',
+        timescaledb.compress_segmentby = 'ticker'
+    );
+EXCEPTION
+WHEN duplicate_object THEN NULL;
+WHEN others THEN RAISE NOTICE 'Could not enable compression on screener_snapshots: %',
+SQLERRM;
+END;
+PERFORM add_compression_policy('screener_snapshots', INTERVAL '30 days', if_not_exists => TRUE);
+EXCEPTION
+WHEN others THEN RAISE NOTICE 'Could not add compression policy on screener_snapshots: %',
+SQLERRM;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_screener_snapshots_ticker_date ON screener_snapshots (ticker, snapshot_date DESC);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (97, 'Add screener_snapshots hypertable for historical as-of screener queries')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,24 @@
+-- Migration: 098_study_labels
+-- Description: User labels on study instances for building labeled example datasets
+
+BEGIN;
+
+-- A study already references the instance (security, timestamp, strategy);
+-- labels attach to it so exports carry the full instance reference.
+CREATE TABLE IF NOT EXISTS study_labels (
+    label_id   SERIAL PRIMARY KEY,
+    user_id    INT NOT NULL REFERENCES users(userId) ON DELETE CASCADE,
+    study_id   INT NOT NULL REFERENCES studies(studyId) ON DELETE CASCADE,
+    label      TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (study_id, label)
+);
+
+CREATE INDEX IF NOT EXISTS idx_study_labels_user_label ON study_labels (user_id, label);
+
+-- Record schema version
+INSERT INTO schema_versions (version, description)
+VALUES (98, 'Add study_labels for labeling study instances')
+ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,24 @@
+-- Migration: 099_sweep_combinations_limit
+-- Description: Per-plan limit on the number of parameter combinations in a strategy optimization sweep
+
+BEGIN;
+
+ALTER TABLE subscription_products
+    ADD COLUMN IF NOT EXISTS sweep_combinations_limit INTEGER NOT NULL DEFAULT 10;
+
+UPDATE subscription_products
+SET sweep_combinations_limit = 50, updated_at = CURRENT_TIMESTAMP
+WHERE product_key = 'Plus';
+
+UPDATE subscription_products
+SET sweep_combinations_limit = 200, updated_at = CURRENT_TIMESTAMP
+WHERE product_key NOT IN ('Free', 'Plus');
+
+-- Update schema version
+INSERT INTO schema_versions (version, description)
+VALUES (
+    99,
+    'Add sweep_combinations_limit to subscription_products for strategy optimization sweeps'
+) ON CONFLICT (version) DO NOTHING;
+
+COMMIT;
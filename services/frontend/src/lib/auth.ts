@@ -19,11 +19,17 @@ export interface AuthLayoutData {
 export interface LoginResponse {
 	token: string;
 	profilePic: string;
+	// Set instead of token when the account has two-factor enabled; finish
+	// with verifyTwoFactorLogin
+	twoFactorRequired?: boolean;
+	twoFactorChallenge?: string;
 }
 
 export interface GoogleCallbackResponse {
 	token: string;
 	profilePic: string;
+	twoFactorRequired?: boolean;
+	twoFactorChallenge?: string;
 }
 
 // ============================================================================
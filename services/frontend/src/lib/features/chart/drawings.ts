@@ -0,0 +1,199 @@
+import { CanvasRenderingTarget2D } from 'fancy-canvas';
+import type {
+	ISeriesPrimitive,
+	ISeriesPrimitivePaneRenderer,
+	ISeriesPrimitivePaneView,
+	Logical,
+	SeriesPrimitivePaneViewZOrder,
+	Time
+} from 'lightweight-charts';
+import { PluginBase } from './plugin-base';
+import type { ChartDrawing } from '$lib/utils/stores/stores';
+import { UTCSecondstoESTSeconds } from '$lib/utils/helpers/timestamp';
+
+const defaultColor = '#2962FF';
+const defaultFibLevels = [0, 0.236, 0.382, 0.5, 0.618, 0.786, 1];
+
+interface DrawingPoint {
+	x: number | null;
+	y: number | null;
+}
+
+interface DrawingViewData {
+	drawing: ChartDrawing;
+	points: DrawingPoint[];
+}
+
+function styleString(drawing: ChartDrawing, key: string, fallback: string): string {
+	const v = drawing.style?.[key];
+	return typeof v === 'string' && v !== '' ? v : fallback;
+}
+
+function styleNumber(drawing: ChartDrawing, key: string, fallback: number): number {
+	const v = drawing.style?.[key];
+	return typeof v === 'number' && v > 0 ? v : fallback;
+}
+
+class ChartDrawingsPaneRenderer implements ISeriesPrimitivePaneRenderer {
+	_views: DrawingViewData[];
+	_priceToY: (price: number) => number | null;
+	constructor(views: DrawingViewData[], priceToY: (price: number) => number | null) {
+		this._views = views;
+		this._priceToY = priceToY;
+	}
+
+	draw(target: CanvasRenderingTarget2D) {
+		target.useMediaCoordinateSpace(({ context: ctx, mediaSize }) => {
+			for (const { drawing, points } of this._views) {
+				if (points.some((p) => p.x === null || p.y === null)) {
+					continue;
+				}
+				const [a, b] = points as { x: number; y: number }[];
+				const color = styleString(drawing, 'color', defaultColor);
+				ctx.strokeStyle = color;
+				ctx.fillStyle = color;
+				ctx.lineWidth = styleNumber(drawing, 'lineWidth', 1);
+
+				switch (drawing.drawingType) {
+					case 'trendline':
+						ctx.beginPath();
+						ctx.moveTo(a.x, a.y);
+						ctx.lineTo(b.x, b.y);
+						ctx.stroke();
+						break;
+					case 'rectangle':
+						ctx.globalAlpha = 0.2;
+						ctx.fillStyle = styleString(drawing, 'fill', color);
+						ctx.fillRect(a.x, a.y, b.x - a.x, b.y - a.y);
+						ctx.globalAlpha = 1;
+						ctx.strokeRect(a.x, a.y, b.x - a.x, b.y - a.y);
+						break;
+					case 'fib_retracement':
+						this._drawFib(ctx, drawing, a, b, mediaSize.width);
+						break;
+					case 'text':
+						ctx.font = '12px sans-serif';
+						ctx.textBaseline = 'bottom';
+						ctx.fillText(drawing.text ?? '', a.x, a.y);
+						break;
+				}
+			}
+		});
+	}
+
+	// Levels run from the first point's price (0) to the second's (1) and
+	// extend to the right edge of the pane
+	_drawFib(
+		ctx: CanvasRenderingContext2D,
+		drawing: ChartDrawing,
+		a: { x: number; y: number },
+		b: { x: number; y: number },
+		width: number
+	) {
+		const raw = drawing.style?.levels;
+		const levels = Array.isArray(raw)
+			? raw.filter((l): l is number => typeof l === 'number')
+			: defaultFibLevels;
+		const [from, to] = drawing.points;
+		const left = Math.min(a.x, b.x);
+		ctx.font = '10px sans-serif';
+		ctx.textBaseline = 'bottom';
+		for (const level of levels) {
+			const price = to.price + (from.price - to.price) * level;
+			const y = this._priceToY(price);
+			if (y === null) continue;
+			ctx.beginPath();
+			ctx.moveTo(left, y);
+			ctx.lineTo(width, y);
+			ctx.stroke();
+			ctx.fillText(`${level} (${price.toFixed(2)})`, left + 2, y - 1);
+		}
+	}
+}
+
+class ChartDrawingsPaneView implements ISeriesPrimitivePaneView {
+	_source: ChartDrawings;
+	_views: DrawingViewData[] = [];
+
+	constructor(source: ChartDrawings) {
+		this._source = source;
+	}
+
+	update() {
+		const series = this._source.series;
+		const timeScale = this._source.chart.timeScale();
+		const times = series.data().map((d) => d.time as number);
+		this._views = this._source._drawings.map((drawing) => ({
+			drawing,
+			points: drawing.points.map((p) => {
+				const logical = timeToLogical(times, UTCSecondstoESTSeconds(p.timestamp / 1000));
+				return {
+					x: logical === null ? null : timeScale.logicalToCoordinate(logical as Logical),
+					y: series.priceToCoordinate(p.price)
+				};
+			})
+		}));
+	}
+
+	renderer() {
+		return new ChartDrawingsPaneRenderer(this._views, (price) =>
+			this._source.series.priceToCoordinate(price)
+		);
+	}
+
+	zOrder(): SeriesPrimitivePaneViewZOrder {
+		return 'top';
+	}
+}
+
+// timeToLogical places a time between the bars around it, so a drawing
+// anchored between bars (or on another timeframe's bars) still lands where it
+// was drawn; times past the last bar are extrapolated at the last bar spacing
+function timeToLogical(times: number[], time: number): number | null {
+	const n = times.length;
+	if (n === 0) return null;
+	if (n === 1) return time === times[0] ? 0 : null;
+	if (time <= times[0]) {
+		return (time - times[0]) / (times[1] - times[0]);
+	}
+	if (time >= times[n - 1]) {
+		return n - 1 + (time - times[n - 1]) / (times[n - 1] - times[n - 2]);
+	}
+	let lo = 0;
+	let hi = n - 1;
+	while (hi - lo > 1) {
+		const mid = (lo + hi) >> 1;
+		if (times[mid] <= time) lo = mid;
+		else hi = mid;
+	}
+	return lo + (time - times[lo]) / (times[hi] - times[lo]);
+}
+
+// ChartDrawings paints the persisted trendlines, rectangles, fib retracements
+// and text labels of the chart's security
+export class ChartDrawings extends PluginBase implements ISeriesPrimitive<Time> {
+	_paneViews: ChartDrawingsPaneView[];
+	_drawings: ChartDrawing[] = [];
+
+	constructor() {
+		super();
+		this._paneViews = [new ChartDrawingsPaneView(this)];
+	}
+
+	setDrawings(drawings: ChartDrawing[]) {
+		this._drawings = drawings;
+		this.requestUpdate();
+	}
+
+	updateAllViews() {
+		this._paneViews.forEach((pw) => pw.update());
+	}
+
+	paneViews() {
+		return this._paneViews;
+	}
+
+	dataUpdated() {
+		this.requestUpdate();
+	}
+}
@@ -144,3 +144,19 @@ export interface SecurityDateBounds {
 	minDate: number;
 	maxDate: number;
 }
+
+export interface DataQualityFinding {
+	securityId: number;
+	ticker: string;
+	timeframe: string;
+	check: 'gap' | 'zero_volume' | 'stuck_price' | 'split_mismatch';
+	severity: 'warning' | 'error';
+	tradingDate: string;
+	message: string;
+	details: Record<string, unknown>;
+}
+
+export interface DataHealth {
+	status: 'ok' | 'warning' | 'error';
+	findings: DataQualityFinding[];
+}
@@ -77,11 +77,22 @@ export function openChatAndQuery(context: FilingContext | Instance, query: strin
 	requestChatOpen.set(true); // Signal the page to open the chat
 }
 
+// How a table column's values are read; percentages are in percentage points
+export type ColumnMeta = {
+	type?: 'number' | 'integer' | 'string' | 'boolean' | 'timestamp';
+	unit?: string;
+	precision?: number;
+	isPercentage?: boolean;
+	isCurrency?: boolean;
+};
+
 // Define the ContentChunk and TableData types to match the backend
 export type TableData = {
 	caption?: string;
 	headers: string[];
 	rows: unknown[][];
+	// One entry per header, when the backend knows the columns
+	columnMeta?: ColumnMeta[];
 	// Pagination state
 	currentPage?: number;
 	rowsPerPage?: number;
@@ -123,11 +134,122 @@ export type PlotAxis = {
 	[key: string]: unknown; // Allow additional Plotly axis properties
 };
 
+export type ChartImageData = {
+	imageId: string;
+	mimeType?: string;
+	data?: string; // base64
+};
+
+export type ChartChunkData = {
+	ticker: string;
+	timestamp?: number; // ms; 0 = latest
+	timeframe?: string;
+	caption?: string;
+};
+
+export type Metric = {
+	label: string;
+	value: string;
+	change?: string;
+	sentiment?: 'positive' | 'negative' | 'neutral';
+};
+
+export type MetricCardData = {
+	title?: string;
+	metrics: Metric[];
+};
+
+export type ListData = {
+	title?: string;
+	ordered?: boolean;
+	items: string[];
+};
+
+export type ChunkErrorData = {
+	code:
+		| 'unknown_type'
+		| 'invalid_content'
+		| 'unresolved_reference'
+		| 'unsupported_version'
+		| string;
+	message: string;
+	chunkType?: string;
+};
+
+export type ProvenanceEntry = {
+	fnId: number;
+	tool: string;
+	args?: Record<string, unknown>;
+	executedAt?: number; // ms
+	durationMs?: number;
+	asOf?: number; // ms
+	rowCount?: number;
+	error?: string;
+	discarded?: boolean;
+};
+
+export type ProvenanceData = {
+	generatedAt: number;
+	entries: ProvenanceEntry[];
+};
+
+// An action the assistant is waiting on the user to confirm
+export type PendingActionData = {
+	pendingActionId: string;
+	tool: string;
+	summary: string;
+	expiresAt: number; // ms
+};
+
+// The chunk version this renderer understands; must match ContentChunkVersion
+// in the backend chunk registry (chunks.go)
+export const CONTENT_CHUNK_VERSION = 2;
+
 export type ContentChunk = {
-	type: 'text' | 'table' | 'plot';
-	content: string | TableData | PlotData;
+	type:
+		| 'text'
+		| 'table'
+		| 'plot'
+		| 'chart_image'
+		| 'chart'
+		| 'metric_card'
+		| 'list'
+		| 'error'
+		| 'provenance'
+		| 'pending_action';
+	content:
+		| string
+		| TableData
+		| PlotData
+		| ChartImageData
+		| ChartChunkData
+		| MetricCardData
+		| ListData
+		| ChunkErrorData
+		| ProvenanceData
+		| PendingActionData;
+	version?: number;
 };
 
+// supportedChunks replaces chunks of a newer version than this renderer,
+// sent by a backend deployed ahead of the loaded app, with an error asking for
+// a reload instead of rendering them with the wrong shape
+export function supportedChunks(chunks: ContentChunk[] | undefined): ContentChunk[] {
+	return (chunks || []).map((chunk) =>
+		chunk.version && chunk.version > CONTENT_CHUNK_VERSION
+			? {
+					type: 'error',
+					content: {
+						code: 'unsupported_version',
+						message: 'This part of the answer needs a newer version of the app. Reload the page to see it.',
+						chunkType: chunk.type
+					},
+					version: CONTENT_CHUNK_VERSION
+				}
+			: chunk
+	);
+}
+
 export type QueryResponse = {
 	text?: string;
 	content_chunks?: ContentChunk[];
@@ -152,6 +274,8 @@ export type ConversationData = {
 		suggested_queries?: string[];
 		completed_at?: string | Date;
 		status?: string;
+		rating?: number; // 1 thumbs up, -1 thumbs down
+		rating_comment?: string;
 	}>;
 	timestamp: string | Date;
 };
@@ -177,6 +301,8 @@ export type Message = {
 	status?: string; // "pending", "completed", "error"
 	completedAt?: Date; // When the response was completed
 	isNewResponse?: boolean; // Flag to indicate this is a new response since last seen
+	rating?: number; // User's thumbs up (1) or down (-1) on an assistant response
+	ratingComment?: string; // Free text the user left with the rating
 };
 
 // Type for suggested queries response
@@ -192,6 +318,17 @@ export type ConversationInfo = {
 	last_message_query?: string;
 	is_public: boolean;
 };
+// A message matching a conversation search; the snippet marks matches with **
+export type ConversationSearchHit = {
+	message_id: string;
+	conversation_id: string;
+	conversation_title: string;
+	is_public: boolean;
+	query: string;
+	snippet: string;
+	created_at: string;
+	rank: number;
+};
 // State for table sorting
 export type SortState = {
 	columnIndex: number | null;
@@ -6,6 +6,7 @@ import { queryInstanceRightClick } from '$lib/components/rightClick.svelte';
 import { switchMobileTab } from '$lib/stores/mobileStore';
 import { isMobileDevice } from '$lib/utils/stores/device';
 import { get } from 'svelte/store';
+import type { ColumnMeta } from './interface';
 // eslint-disable-next-line @typescript-eslint/ban-ts-comment
 // @ts-ignore – types provided by the package at runtime; this line quiets TS until it is installed
 import DOMPurify from 'isomorphic-dompurify';
@@ -242,6 +243,47 @@ export function cleanContentChunk(chunk: unknown): unknown {
 	return result;
 }
 
+// Formats a table cell by its column metadata; cells without metadata, and
+// values that aren't numbers, are shown as they are
+export function formatTableCell(cell: unknown, meta?: ColumnMeta): string {
+	if (cell === null || cell === undefined) {
+		return meta ? '' : String(cell);
+	}
+	const value = typeof cell === 'number' ? cell : typeof cell === 'string' ? Number(cell) : NaN;
+	if (!meta || meta.type === 'string' || cell === '' || !Number.isFinite(value)) {
+		return typeof cell === 'string' ? cell : String(cell);
+	}
+	if (meta.type === 'timestamp') {
+		const ms = meta.unit === 'ms' ? value : value * 1000;
+		return new Date(ms).toLocaleString('en-US', { dateStyle: 'medium', timeStyle: 'short' });
+	}
+	const digits = meta.precision ?? (meta.type === 'integer' ? 0 : undefined);
+	const fixed = (v: number) =>
+		v.toLocaleString('en-US', {
+			minimumFractionDigits: digits ?? 0,
+			maximumFractionDigits: digits ?? 4
+		});
+	if (meta.isCurrency) {
+		const sign = value < 0 ? '-' : '';
+		const abs = Math.abs(value);
+		if (digits === 0 && abs >= 1e6) {
+			const compact = abs.toLocaleString('en-US', {
+				notation: 'compact',
+				maximumFractionDigits: 2
+			});
+			return `${sign}$${compact}`;
+		}
+		return `${sign}$${fixed(abs)}`;
+	}
+	if (meta.isPercentage) {
+		return `${fixed(value)}%`;
+	}
+	if (meta.unit === 'x') {
+		return `${fixed(value)}x`;
+	}
+	return fixed(value);
+}
+
 // Helper function to create text content for copying from a content chunk
 export function getContentChunkTextForCopy(
 	chunk: { type: string; content: unknown },
@@ -253,7 +295,12 @@ export function getContentChunkTextForCopy(
 		return cleanHtmlContent(content);
 	} else if (chunk.type === 'table' && isTableData(chunk.content)) {
 		// For tables, create a simple text representation
-		const tableData = chunk.content as { caption?: string; headers: unknown[]; rows: unknown[] };
+		const tableData = chunk.content as {
+			caption?: string;
+			headers: unknown[];
+			rows: unknown[];
+			columnMeta?: ColumnMeta[];
+		};
 		let tableText = '';
 		if (tableData.caption) {
 			const cleanCaption = cleanHtmlContent(tableData.caption);
@@ -266,7 +313,11 @@ export function getContentChunkTextForCopy(
 		tableText += tableData.rows
 			.map((row: unknown) => {
 				if (Array.isArray(row)) {
-					return row.map((cell: unknown) => cleanHtmlContent(String(cell))).join('\t');
+					return row
+						.map((cell: unknown, i: number) =>
+							cleanHtmlContent(formatTableCell(cell, tableData.columnMeta?.[i]))
+						)
+						.join('\t');
 				} else {
 					return cleanHtmlContent(String(row));
 				}
@@ -277,6 +328,21 @@ export function getContentChunkTextForCopy(
 		// For plots, clean ticker formatting and create a text representation
 		const cleanedChunk = cleanContentChunk(chunk);
 		return plotDataToText((cleanedChunk as { content: unknown }).content);
+	} else if (chunk.type === 'metric_card') {
+		const card = chunk.content as {
+			title?: string;
+			metrics?: { label: string; value: string; change?: string }[];
+		};
+		const lines = (card.metrics ?? []).map(
+			(m) => `${m.label}: ${m.value}${m.change ? ` (${m.change})` : ''}`
+		);
+		return (card.title ? card.title + '\n' : '') + lines.join('\n');
+	} else if (chunk.type === 'list') {
+		const list = chunk.content as { title?: string; ordered?: boolean; items?: string[] };
+		const lines = (list.items ?? []).map(
+			(item, i) => `${list.ordered ? `${i + 1}.` : '-'} ${cleanHtmlContent(item)}`
+		);
+		return (list.title ? list.title + '\n' : '') + lines.join('\n');
 	}
 	return '';
 }
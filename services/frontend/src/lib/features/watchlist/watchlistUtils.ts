@@ -1,6 +1,7 @@
 import { get, writable } from 'svelte/store';
-import type { Instance, Watchlist } from '$lib/utils/types/types';
-import { privateRequest, publicRequest } from '$lib/utils/helpers/backend';
+import type { Instance, Strategy, Watchlist } from '$lib/utils/types/types';
+import { privateRequest, publicRequest, withStepUp } from '$lib/utils/helpers/backend';
+import type { OnDependents } from '$lib/utils/helpers/dependencies';
 import { queryInstanceInput } from '$lib/components/input/input.svelte';
 //import { showAuthModal } from '$lib/stores/authModal';
 import {
@@ -8,6 +9,7 @@ import {
 	flagWatchlistId,
 	isPublicViewing,
 	currentWatchlistId as globalCurrentWatchlistId,
+	strategies,
 	watchlists
 } from '$lib/utils/stores/stores';
 // Extended Instance type to include watchlistItemId
@@ -149,12 +151,17 @@ export function createNewWatchlist(watchlistName: string): Promise<number> {
 }
 
 // Centralized watchlist deletion
-export function deleteWatchlist(watchlistId: number): Promise<void> {
+export function deleteWatchlist(
+	watchlistId: number,
+	onDependents: OnDependents = 'detach'
+): Promise<void> {
 	if (watchlistId === flagWatchlistId) {
 		throw new Error('The flag watchlist cannot be deleted.');
 	}
 
-	return privateRequest<void>('deleteWatchlist', { watchlistId }).then(() => {
+	return withStepUp((twoFactorCode) =>
+		privateRequest<void>('deleteWatchlist', { watchlistId, onDependents, twoFactorCode })
+	).then(() => {
 		watchlists.update((v: Watchlist[]) => {
 			const updatedWatchlists = v.filter(
 				(watchlist: Watchlist) => watchlist.watchlistId !== watchlistId
@@ -173,6 +180,13 @@ export function deleteWatchlist(watchlistId: number): Promise<void> {
 		visibleWatchlistIds.update((ids: number[]) =>
 			Array.isArray(ids) ? ids.filter((id: number) => id !== watchlistId) : []
 		);
+
+		// Cascading may have deleted strategies built on the watchlist
+		if (onDependents === 'cascade') {
+			privateRequest<Strategy[]>('getStrategies', {})
+				.then((list) => strategies.set(list || []))
+				.catch((err) => console.error('Error reloading strategies:', err));
+		}
 	});
 }
 
@@ -0,0 +1,67 @@
+import { writable } from 'svelte/store';
+import { publicRequest } from '$lib/utils/helpers/backend';
+
+export type MarketSession = 'pre_market' | 'open' | 'after_hours' | 'closed' | 'holiday';
+
+export interface MarketHoliday {
+	date: string;
+	name: string;
+	status: 'closed' | 'early-close';
+	exchange: string;
+	close?: string;
+}
+
+export interface MarketStatus {
+	session: MarketSession;
+	isOpen: boolean;
+	earlyClose: boolean;
+	closeTime?: string;
+	holidayName?: string;
+	source: 'polygon' | 'clock';
+	serverTime: string;
+	upcomingHolidays?: MarketHoliday[];
+}
+
+export const marketStatus = writable<MarketStatus | null>(null);
+
+const refreshIntervalMs = 60_000;
+let refreshTimer: ReturnType<typeof setInterval> | null = null;
+
+export async function refreshMarketStatus() {
+	try {
+		marketStatus.set(await publicRequest<MarketStatus>('getMarketStatus', {}));
+	} catch (error) {
+		console.error('Failed to fetch market status:', error);
+	}
+}
+
+// Helper functions to start/stop polling; returns the stop function for onMount
+export function startMarketStatusPolling() {
+	if (!refreshTimer) {
+		refreshMarketStatus();
+		refreshTimer = setInterval(refreshMarketStatus, refreshIntervalMs);
+	}
+	return stopMarketStatusPolling;
+}
+
+export function stopMarketStatusPolling() {
+	if (refreshTimer) {
+		clearInterval(refreshTimer);
+		refreshTimer = null;
+	}
+}
+
+export function marketSessionLabel(status: MarketStatus): string {
+	switch (status.session) {
+		case 'pre_market':
+			return 'Pre-Market';
+		case 'open':
+			return status.earlyClose ? 'Open (Early Close)' : 'Market Open';
+		case 'after_hours':
+			return 'After Hours';
+		case 'holiday':
+			return status.holidayName ? `Closed: ${status.holidayName}` : 'Holiday';
+		default:
+			return 'Market Closed';
+	}
+}
@@ -0,0 +1,44 @@
+import { writable } from 'svelte/store';
+import { publicRequest } from '$lib/utils/helpers/backend';
+
+export type SystemNoticeKind = 'info' | 'maintenance' | 'data_delay';
+
+// Set by admins; shown as a banner until it ends or is cleared
+export interface SystemNotice {
+	id: string;
+	kind: SystemNoticeKind;
+	message: string;
+	maintenance: boolean;
+	startsAt?: number; // ms since epoch
+	endsAt?: number; // ms since epoch
+	createdAt: number;
+}
+
+export const systemNotice = writable<SystemNotice | null>(null);
+
+const refreshIntervalMs = 60_000;
+let refreshTimer: ReturnType<typeof setInterval> | null = null;
+
+export async function refreshSystemNotice() {
+	try {
+		systemNotice.set(await publicRequest<SystemNotice | null>('getSystemNotice', {}));
+	} catch (error) {
+		console.error('Failed to fetch system notice:', error);
+	}
+}
+
+// Helper functions to start/stop polling; returns the stop function for onMount
+export function startSystemNoticePolling() {
+	if (!refreshTimer) {
+		refreshSystemNotice();
+		refreshTimer = setInterval(refreshSystemNotice, refreshIntervalMs);
+	}
+	return stopSystemNoticePolling;
+}
+
+export function stopSystemNoticePolling() {
+	if (refreshTimer) {
+		clearInterval(refreshTimer);
+		refreshTimer = null;
+	}
+}
@@ -29,21 +29,133 @@ if (typeof window !== 'undefined') {
 	}
 }
 
+// Error codes the backend sets in X-Error-Code (see internal/apperr)
+export type ErrorCode =
+	| 'validation'
+	| 'not_found'
+	| 'forbidden'
+	| 'limit_exceeded'
+	| 'upstream_timeout'
+	| 'step_up_required'
+	| 'confirm_required'
+	| 'unavailable'
+	| 'internal';
+
+// RequestError is what privateRequest rejects with when the backend answers
+// with an error. It stringifies to the backend's message, so code that
+// displays the rejection as text keeps working, and exposes the typed code.
+export class RequestError extends Error {
+	code?: ErrorCode;
+	status: number;
+
+	constructor(message: string, response: Response) {
+		super(message);
+		this.name = 'RequestError';
+		this.status = response.status;
+		this.code = (response.headers.get('X-Error-Code') as ErrorCode | null) ?? undefined;
+	}
+
+	toString(): string {
+		return this.message;
+	}
+}
+
+// withStepUp runs a destructive request that the backend may refuse until the
+// user confirms it with a two-factor code. On step_up_required it asks for a
+// code and repeats the request with it; cancelling rethrows the refusal.
+export async function withStepUp<T>(request: (twoFactorCode?: string) => Promise<T>): Promise<T> {
+	try {
+		return await request();
+	} catch (error) {
+		if (!(error instanceof RequestError) || error.code !== 'step_up_required') {
+			throw error;
+		}
+		const code = window.prompt(error.message);
+		if (!code || !code.trim()) {
+			throw error;
+		}
+		return request(code.trim());
+	}
+}
+
+// withCostConfirmation runs a backtest or strategy alert request that the
+// backend may refuse as too costly until the user confirms it. On
+// confirm_required it shows the estimate, and with strategyId what the
+// strategy does, and repeats the request confirmed; declining rethrows the
+// refusal.
+export async function withCostConfirmation<T>(
+	request: (confirmCost?: boolean) => Promise<T>,
+	strategyId?: number
+): Promise<T> {
+	try {
+		return await request();
+	} catch (error) {
+		if (!(error instanceof RequestError) || error.code !== 'confirm_required') {
+			throw error;
+		}
+		let message = error.message;
+		if (strategyId !== undefined) {
+			try {
+				const explanation = await privateRequest<{ text: string }>('explainStrategy', { strategyId });
+				message += `\n\n${explanation.text}`;
+			} catch {
+				// The estimate alone is enough to decide on
+			}
+		}
+		if (!window.confirm(message)) {
+			throw error;
+		}
+		return request(true);
+	}
+}
+
+// imageSrc turns a logo or icon returned by the backend into an <img> src.
+// Stored images come back as /assets/<hash> paths served by the backend;
+// securities not yet migrated still hold base64 data.
+export function imageSrc(raw: string | null | undefined): string {
+	if (!raw) return '';
+	if (raw.startsWith('/assets/')) return `${base_url}${raw}`;
+	if (raw.startsWith('data:') || raw.startsWith('http')) return raw;
+	return raw.startsWith('/9j/') ? `data:image/jpeg;base64,${raw}` : `data:image/png;base64,${raw}`;
+}
+
+// Public functions whose responses carry an ETag. The last response to each
+// request is kept, and a 304 from the backend means it is still current.
+const ETAG_FUNCS = new Set(['getTickerMenuDetails']);
+const ETAG_CACHE_SIZE = 200;
+const etagCache = new Map<string, { etag: string; body: unknown }>();
+
 export async function publicRequest<T>(func: string, args: Record<string, unknown>): Promise<T> {
 	const payload = JSON.stringify({
 		func: func,
 		args: args
 	});
+	const headers: Record<string, string> = { 'Content-Type': 'application/json' };
+	const cached = ETAG_FUNCS.has(func) ? etagCache.get(payload) : undefined;
+	if (cached) {
+		headers['If-None-Match'] = cached.etag;
+	}
 
 	try {
 		const response = await fetch(`${base_url}/public`, {
 			method: 'POST',
-			headers: { 'Content-Type': 'application/json' },
+			headers: headers,
 			body: payload
 		});
 
-		if (response.ok) {
+		if (response.status === 304 && cached) {
+			return cached.body as T;
+		} else if (response.ok) {
 			const result = (await response.json()) as T;
+			const etag = response.headers.get('ETag');
+			if (etag && ETAG_FUNCS.has(func)) {
+				// Oldest first, so the first key is the one to evict
+				etagCache.delete(payload);
+				etagCache.set(payload, { etag, body: result });
+				if (etagCache.size > ETAG_CACHE_SIZE) {
+					etagCache.delete(etagCache.keys().next().value as string);
+				}
+			}
 			return result;
 		} else {
 			const errorMessage = await response.text();
@@ -60,6 +172,35 @@ export async function publicRequest<T>(func: string, args: Record<string, unknow
 	}
 }
 
+// Functions the backend deduplicates by Idempotency-Key. Requests to them carry
+// a fresh key and are retried once with the same key if the connection drops,
+// so a retry can't create a second alert, strategy or upload.
+const IDEMPOTENT_FUNCS = new Set([
+	'newAlert',
+	'createChartAlert',
+	'setAlert',
+	'createStrategyFromPrompt',
+	'run_backtest',
+	'handle_trade_upload'
+]);
+
+async function fetchWithIdempotency(
+	func: string,
+	url: string,
+	init: RequestInit & { headers: Record<string, string> }
+): Promise<Response> {
+	if (!IDEMPOTENT_FUNCS.has(func)) {
+		return fetch(url, init);
+	}
+	init.headers['Idempotency-Key'] = crypto.randomUUID();
+	try {
+		return await fetch(url, init);
+	} catch (e) {
+		if (init.signal?.aborted) throw e;
+		return fetch(url, init);
+	}
+}
+
 export async function uploadRequest<T>(
 	func: string,
 	file: File,
@@ -77,12 +218,12 @@ export async function uploadRequest<T>(
 	formData.append('args', JSON.stringify(additionalArgs));
 
 	// Create headers object with optional authorization
-	const headers: HeadersInit = {};
+	const headers: Record<string, string> = {};
 	if (authToken) {
 		headers['Authorization'] = authToken;
 	}
 
-	const response = await fetch(`${base_url}/upload`, {
+	const response = await fetchWithIdempotency(func, `${base_url}/upload`, {
 		method: 'POST',
 		headers,
 		body: formData
@@ -153,7 +294,7 @@ export async function privateRequest<T>(
 	} catch {
 		throw new Error('Failed to get auth token');
 	}
-	const headers = {
+	const headers: Record<string, string> = {
 		'Content-Type': 'application/json',
 		...(authToken ? { Authorization: authToken } : {})
 	};
@@ -163,7 +304,7 @@ export async function privateRequest<T>(
 	};
 
 	//console.log(`Making request to ${base_url}/private with payload:`, payload);
-	const response = await fetch(`${base_url}/private`, {
+	const response = await fetchWithIdempotency(func, `${base_url}/private`, {
 		method: 'POST',
 		headers: headers,
 		body: JSON.stringify(payload),
@@ -207,7 +348,7 @@ export async function privateRequest<T>(
 			'error:',
 			errorMessage
 		);
-		return Promise.reject(errorMessage);
+		return Promise.reject(new RequestError(errorMessage.trim(), response));
 	}
 
 	// This should never be reached, but TypeScript requires a return
@@ -0,0 +1,54 @@
+import { privateRequest } from '$lib/utils/helpers/backend';
+
+export type DependencyTarget = 'strategy' | 'watchlist' | 'screener_column';
+export type OnDependents = 'detach' | 'cascade';
+
+export interface Dependent {
+	type: string;
+	id: number;
+	name: string;
+	relation: string;
+	alertActive?: boolean;
+	onDetach: string;
+}
+
+export interface DependencyImpact {
+	type: DependencyTarget;
+	id: number;
+	name: string;
+	dependents: Dependent[];
+	summary: string;
+	options?: OnDependents[];
+	cascadeNeedsTwoFactor?: boolean;
+}
+
+// confirmDelete asks the user to confirm deleting an entity, listing what
+// depends on it first. It resolves to what should happen to the dependents,
+// or null when the user cancelled.
+export async function confirmDelete(
+	type: DependencyTarget,
+	id: number,
+	name: string
+): Promise<OnDependents | null> {
+	let impact: DependencyImpact | null = null;
+	try {
+		impact = await privateRequest<DependencyImpact>('getDependencyImpact', { type, id });
+	} catch (error) {
+		// Not knowing the impact shouldn't stop a delete; the backend detaches by default
+		console.warn('Failed to load dependency impact:', error);
+	}
+	if (!impact || impact.dependents.length === 0) {
+		return confirm(`Delete "${name}"?`) ? 'detach' : null;
+	}
+
+	const list = impact.dependents.map((d) => `• ${d.name}: ${d.onDetach}`).join('\n');
+	if (!confirm(`${impact.summary}:\n${list}\n\nDelete "${name}" and unlink them?`)) {
+		return null;
+	}
+	const count = impact.dependents.length;
+	return confirm(
+		`Also delete the ${count === 1 ? 'item' : `${count} items`} that depend on "${name}"?\n\nOK deletes them too, Cancel keeps them.`
+	)
+		? 'cascade'
+		: 'detach';
+}
@@ -259,6 +259,8 @@ export const defaultSettings: Settings = {
 	divideTaS: false,
 	showFilings: true,
 	chatSuggestionsEnabled: true,
+	emailAlertsOffline: false,
+	locale: 'en',
 	colorScheme: 'default'
 };
 export const settings: Writable<Settings> = writable(defaultSettings);
@@ -555,6 +557,20 @@ export interface HorizontalLine {
 
 export const horizontalLines: Writable<HorizontalLine[]> = writable([]);
 
+// Persisted chart drawings other than horizontal lines
+export interface ChartDrawing {
+	id: number;
+	securityId: number;
+	timeframe?: string; // unset = shown on every timeframe
+	drawingType: 'trendline' | 'rectangle' | 'fib_retracement' | 'text';
+	points: { timestamp: number; price: number }[];
+	style?: Record<string, unknown>;
+	text?: string;
+	updatedAt: number;
+}
+
+export const chartDrawings: Writable<ChartDrawing[]> = writable([]);
+
 // NEW: Centralized synchronization for flag watchlist
 // This ensures that if the flag watchlist is being viewed, its contents
 // are always in sync with the main 'currentWatchlistItems' store.
@@ -3,6 +3,10 @@ import { activeAlerts, inactiveAlerts, alertLogs, alertPopup } from '$lib/utils/
 import { get } from 'svelte/store';
 export function handleAlert(data: AlertData) {
 	alertPopup.set(data);
+	// A summary of alerts held back by a rate limit; they are already in the log
+	if (data.type === 'summary') {
+		return;
+	}
 
 	if (get(activeAlerts) !== undefined) {
 		// Remove from active alerts
@@ -26,6 +30,7 @@ export function handleAlert(data: AlertData) {
 				// Create an AlertLog object from the AlertData
 				const alertLog: AlertLog = {
 					...data,
+					alertLogId: data.logId ?? 0,
 					alertType: 'triggered' // Add required property
 				};
 				return [...currentLogs, alertLog];
@@ -0,0 +1,113 @@
+// Bar replay: plays a security's stored bars from a timestamp at a chosen
+// speed. The server streams them on the 'bar_replay' channel.
+import { writable, type Writable } from 'svelte/store';
+import { socket } from './socket';
+
+export type ReplayResolution = '1s' | '1m';
+
+export interface ReplayBar {
+	t: number; // bar start, ms
+	o: number;
+	h: number;
+	l: number;
+	c: number;
+	v: number;
+}
+
+export interface BarReplayState {
+	securityId: number | null;
+	ticker: string;
+	resolution: ReplayResolution | '';
+	state: 'idle' | 'playing' | 'paused' | 'ended' | 'error';
+	cursor: number;
+	speed: number;
+	error?: string;
+}
+
+export interface BarReplayMessage {
+	channel: 'bar_replay';
+	type: 'bar' | 'status';
+	securityId: number;
+	ticker: string;
+	resolution?: ReplayResolution;
+	bar?: ReplayBar;
+	state?: BarReplayState['state'];
+	cursor?: number;
+	speed?: number;
+	error?: string;
+}
+
+const idleState: BarReplayState = {
+	securityId: null,
+	ticker: '',
+	resolution: '',
+	state: 'idle',
+	cursor: 0,
+	speed: 1
+};
+
+export const barReplayState: Writable<BarReplayState> = writable({ ...idleState });
+// Bars received in the current replay, oldest first
+export const barReplayBars: Writable<ReplayBar[]> = writable([]);
+
+function send(message: Record<string, unknown>) {
+	if (socket?.readyState === WebSocket.OPEN) {
+		socket.send(JSON.stringify(message));
+	}
+}
+
+// Resolution '' lets the server use 1s bars where they were recorded, else 1m
+export function startBarReplay(
+	securityId: number,
+	timestamp: number,
+	speed: number = 1,
+	resolution: ReplayResolution | '' = ''
+) {
+	barReplayBars.set([]);
+	barReplayState.set({ ...idleState, securityId, resolution, cursor: timestamp, speed });
+	send({ action: 'barReplayStart', securityId, timestamp, speed, resolution });
+}
+
+export function pauseBarReplay() {
+	send({ action: 'barReplayPause' });
+}
+
+export function resumeBarReplay() {
+	send({ action: 'barReplayResume' });
+}
+
+export function setBarReplaySpeed(speed: number) {
+	send({ action: 'barReplaySpeed', speed });
+}
+
+export function stopBarReplay() {
+	send({ action: 'barReplayStop' });
+	barReplayState.set({ ...idleState });
+}
+
+export function handleBarReplayMessage(msg: BarReplayMessage) {
+	if (msg.type === 'bar' && msg.bar) {
+		const bar = msg.bar;
+		barReplayBars.update((bars) => [...bars, bar]);
+		barReplayState.update((s) => ({
+			...s,
+			ticker: msg.ticker,
+			resolution: msg.resolution ?? s.resolution,
+			cursor: bar.t
+		}));
+		return;
+	}
+	if (msg.type === 'status' && msg.state) {
+		const state = msg.state;
+		barReplayState.update((s) => ({
+			...s,
+			securityId: msg.securityId,
+			ticker: msg.ticker,
+			resolution: msg.resolution ?? s.resolution,
+			state,
+			cursor: msg.cursor ?? s.cursor,
+			speed: msg.speed ?? s.speed,
+			error: msg.error
+		}));
+	}
+}
@@ -0,0 +1,42 @@
+import { writable } from 'svelte/store';
+
+// New filings, dividends, splits and news of the securities open on charts,
+// pushed on the "security-events:<securityId>" channels
+export interface SecurityEvent {
+	type: 'filing' | 'dividend' | 'split' | 'news';
+	id: string;
+	securityId: number;
+	ticker: string;
+	timestamp: number;
+	data: Record<string, unknown>;
+}
+
+const maxEventsPerSecurity = 50;
+
+// Most recent first, by securityId
+export const securityEvents = writable<Record<number, SecurityEvent[]>>({});
+
+export function handleSecurityEventMessage(message: { channel: string; data?: SecurityEvent; error?: string }): void {
+	if (message.error) {
+		console.warn(`Security events unavailable on ${message.channel}: ${message.error}`);
+		return;
+	}
+	const event = message.data;
+	if (!event) {
+		return;
+	}
+	securityEvents.update((all) => {
+		const current = all[event.securityId] ?? [];
+		if (current.some((e) => e.id === event.id)) {
+			return all;
+		}
+		return { ...all, [event.securityId]: [event, ...current].slice(0, maxEventsPerSecurity) };
+	});
+}
+
+export function clearSecurityEvents(securityId: number): void {
+	securityEvents.update((all) => {
+		const { [securityId]: _, ...rest } = all;
+		return rest;
+	});
+}
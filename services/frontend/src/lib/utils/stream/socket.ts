@@ -1,13 +1,16 @@
 // socket.ts
 import { get, writable, type Writable } from 'svelte/store';
-import { handleTimestampUpdate } from '$lib/utils/stores/stores';
+import { handleTimestampUpdate, alertPopup } from '$lib/utils/stores/stores';
 import type { TradeData, QuoteData, CloseData, Alert, Watchlist, Instance, Strategy } from '$lib/utils/types/types';
-import type { HorizontalLine } from '$lib/utils/stores/stores';
+import type { HorizontalLine, ChartDrawing } from '$lib/utils/stores/stores';
 import { base_url } from '$lib/utils/helpers/backend';
 import { browser } from '$app/environment';
 import { handleAlert } from './alert';
+import { handleBarReplayMessage, type BarReplayMessage } from './barReplay';
 import type { AlertData } from '$lib/utils/types/types';
 import { enqueueTick } from './streamHub';
+import { refreshSystemNotice } from '$lib/stores/systemNotice';
+import { handleSecurityEventMessage, clearSecurityEvents } from './securityEvents';
 
 
 // Type definitions for dynamic updates - moved to top
@@ -38,6 +41,13 @@ export type HorizontalLineUpdate = {
 	};
 };
 
+export type ChartDrawingUpdate = {
+	type: 'chart_drawing_update';
+	action: 'add' | 'remove' | 'update';
+	securityId: number;
+	drawing: ChartDrawing;
+};
+
 export type AlertUpdate = {
 	type: 'alert_update';
 	action: 'add' | 'remove' | 'update' | 'trigger';
@@ -329,6 +339,34 @@ async function handleWatchlistUpdate(update: WatchlistUpdate) {
 	}
 }
 
+// Handle chart drawing updates
+function handleChartDrawingUpdate(update: ChartDrawingUpdate) {
+	if (!browser) return;
+
+	// Import chartDrawings store dynamically to avoid circular dependencies
+	import('$lib/utils/stores/stores').then(({ chartDrawings }) => {
+		chartDrawings.update((drawings: ChartDrawing[]) => {
+			const current = Array.isArray(drawings) ? drawings : [];
+			switch (update.action) {
+				case 'add':
+					if (current.find((d) => d.id === update.drawing.id)) {
+						return current;
+					}
+					return [...current, update.drawing];
+				case 'remove':
+					return current.filter((d) => d.id !== update.drawing.id);
+				case 'update':
+					return current.map((d) => (d.id === update.drawing.id ? update.drawing : d));
+				default:
+					console.warn('Unknown chart drawing action:', update.action);
+					return current;
+			}
+		});
+	}).catch(error => {
+		console.warn('❌ Error updating chart drawing store:', error);
+	});
+}
+
 // Handle horizontal line updates
 function handleHorizontalLineUpdate(update: HorizontalLineUpdate) {
 	if (!browser) return;
@@ -572,6 +610,8 @@ export type StreamCallback = (v: TradeData | QuoteData | CloseData | number) =>
 export const activeChannels: Map<string, StreamCallback[]> = new Map();
 export const connectionStatus = writable<'connected' | 'disconnected' | 'connecting'>('connecting');
 export const pendingSubscriptions = new Set<string>();
+// Charts watching each security's events; the server is subscribed while any is
+const securityEventWatchers = new Map<number, number>();
 
 export type SubscriptionRequest = {
 	action: 'subscribe' | 'unsubscribe' | 'replay' | 'pause' | 'play' | 'realtime' | 'speed';
@@ -582,6 +622,10 @@ export type SubscriptionRequest = {
 };
 
 export let socket: WebSocket | null = null;
+// ID the server gave this connection, to mark it in the session list
+export const currentSessionId = writable<string | null>(null);
+// Delivery IDs of alerts already handled, to drop replays of alerts whose ack was lost
+const seenAlertDeliveries = new Set<string>();
 let reconnectInterval: number = 5000; //ms
 const maxReconnectInterval: number = 30000;
 let reconnectAttempts: number = 0;
@@ -608,9 +652,15 @@ export function connect() {
 		setTimeout(connect, 1000);
 		return;
 	}
-	socket.addEventListener('close', () => {
+	socket.addEventListener('close', (event) => {
 		connectionStatus.set('disconnected');
 		isConnecting = false;
+		currentSessionId.set(null);
+
+		// 4001: this session was ended from another device; stay disconnected
+		if (event.code === 4001) {
+			shouldReconnect = false;
+		}
 
 		// Reject all pending chat requests
 		pendingChatRequests.forEach((request) => {
@@ -641,6 +691,9 @@ export function connect() {
 			subscribe(channelName);
 		}
 		pendingSubscriptions.clear();
+		for (const securityId of securityEventWatchers.keys()) {
+			socket?.send(JSON.stringify({ action: 'subscribe-security-events', securityId }));
+		}
 
 		// Process pending chat request
 		processPendingChatRequest();
@@ -711,6 +764,12 @@ export function connect() {
 			return;
 		}
 
+		if (data && data.type === 'chart_drawing_update') {
+			console.log('✏️ Chart Drawing Update Received:', data);
+			handleChartDrawingUpdate(data as ChartDrawingUpdate);
+			return;
+		}
+
 		if (data && data.type === 'alert_update') {
 			console.log('🔔 Alert Update Received:', data);
 			handleAlertUpdate(data as AlertUpdate).catch(error => {
@@ -731,9 +790,43 @@ export function connect() {
 		const channelName = data.channel;
 		if (channelName) {
 			if (channelName === 'alert') {
-				handleAlert(data as AlertData);
+				const alert = data as AlertData;
+				if (alert.deliveryId) {
+					// Ack so the server stops holding it for replay; a replayed alert
+					// we already showed (its ack was lost) is acked again but not re-shown
+					socket?.send(JSON.stringify({ action: 'ack', deliveryId: alert.deliveryId }));
+					if (seenAlertDeliveries.has(alert.deliveryId)) {
+						return;
+					}
+					seenAlertDeliveries.add(alert.deliveryId);
+					if (seenAlertDeliveries.size > 500) {
+						seenAlertDeliveries.delete(seenAlertDeliveries.values().next().value as string);
+					}
+				}
+				handleAlert(alert);
+			} else if (channelName === 'bar_replay') {
+				handleBarReplayMessage(data as BarReplayMessage);
+			} else if (channelName === 'session') {
+				currentSessionId.set(data.sessionId);
+			} else if (channelName === 'notice') {
+				// Admin notices also set the banner; pick it up without waiting for the poll.
+				// Limit warnings are only for this user and never touch the banner.
+				if (data.type !== 'limit_warning') {
+					refreshSystemNotice();
+				}
+				alertPopup.set({
+					message: data.message,
+					alertId: 0,
+					timestamp: data.timestamp,
+					securityId: 0,
+					channel: 'notice',
+					type: data.type,
+					tickers: []
+				});
 			} else if (channelName === 'timestamp') {
 				handleTimestampUpdate(data.timestamp);
+			} else if (channelName.startsWith('security-events:')) {
+				handleSecurityEventMessage(data);
 			} else {
 				// Also feed data to the new streamHub system
 				if (
@@ -886,6 +979,30 @@ export function unsubscribeSECFilings() {
 	pendingSubscriptions.delete('sec-filings');
 }
 
+// subscribeSecurityEvents starts receiving the new filings, dividends, splits
+// and news of a security; every call needs a matching unsubscribeSecurityEvents
+export function subscribeSecurityEvents(securityId: number) {
+	const watchers = securityEventWatchers.get(securityId) ?? 0;
+	securityEventWatchers.set(securityId, watchers + 1);
+	if (watchers === 0 && socket?.readyState === WebSocket.OPEN) {
+		socket.send(JSON.stringify({ action: 'subscribe-security-events', securityId }));
+	}
+	// Otherwise sent on (re)connect
+}
+
+export function unsubscribeSecurityEvents(securityId: number) {
+	const watchers = securityEventWatchers.get(securityId) ?? 0;
+	if (watchers > 1) {
+		securityEventWatchers.set(securityId, watchers - 1);
+		return;
+	}
+	securityEventWatchers.delete(securityId);
+	clearSecurityEvents(securityId);
+	if (watchers === 1 && socket?.readyState === WebSocket.OPEN) {
+		socket.send(JSON.stringify({ action: 'unsubscribe-security-events', securityId }));
+	}
+}
+
 // Send chat query via WebSocket
 export function sendChatQuery(
 	query: string,
@@ -52,6 +52,7 @@ export interface Strategy {
 	isAlertActive?: boolean;
 	alertThreshold?: number;
 	alertUniverse?: string[];
+	tags?: string[]; // assigned by the backend from the strategy's code and text
 	activeScreen?: boolean; // Frontend-specific field
 }
 
@@ -89,6 +90,10 @@ export interface Settings {
 	filterTaS: boolean;
 	showFilings: boolean;
 	chatSuggestionsEnabled: boolean;
+	// Email alerts that fire while no session is open
+	emailAlertsOffline?: boolean;
+	// Language alert and system notifications are written in: en, es, fr or de
+	locale?: string;
 	// DEPRECATED: Screensaver properties
 	// enableScreensaver: boolean;
 	// screensaverTimeframes: string[];
@@ -112,6 +117,8 @@ export interface AlertData {
 	channel: string;
 	type: string;
 	tickers: string[];
+	logId?: number; // alert log entry, for "was this alert useful?" feedback
+	deliveryId?: string;
 }
 export interface AlertLog {
 	alertLogId: number;
@@ -122,6 +129,7 @@ export interface AlertLog {
 	ticker?: string; // Ticker symbol for the alert
 	alertPrice?: number; // Price for price alerts
 	strategyName?: string; // Strategy name for strategy alerts
+	useful?: boolean; // The user's "was this alert useful?" answer
 }
 
 // Generic Alert configuration used in frontend components.
@@ -136,6 +144,8 @@ export interface Alert {
 	price?: number; // Target price for price alerts
 	direction?: boolean; // Direction for price/strategy alerts
 	alertPrice?: number; // Ensure this field is present
+	vwapAnchor?: number; // ms; set when the alert tracks price crossing an anchored VWAP
+	drawingId?: number; // set when the alert tracks price crossing a trendline drawing
 	// Strategy alert specific fields
 	name?: string; // Strategy name for strategy alerts
 	alertThreshold?: number; // Threshold for strategy alerts
@@ -2,7 +2,8 @@ import logging
 from typing import Any, Dict, List, Optional
 
 from .engine import execute_strategy
-from .utils.context import Context
+from .utils.context import Context, NoSubscribersException
+from .utils.error_utils import capture_exception
 from .utils.strategy_crud import fetch_strategy_code
 
 logger = logging.getLogger(__name__)
@@ -12,8 +13,13 @@ def alert(
     user_id: Optional[int] = None,
     symbols: Optional[List[str]] = None,
     strategy_id: Optional[int] = None,
+    timeframes: Optional[Dict[str, Dict[str, Any]]] = None,
 ) -> Dict[str, Any]:
-    """Execute alert task using new accessor strategy engine"""
+    """Execute alert task using new accessor strategy engine.
+
+    timeframes is set for multi-timeframe strategies: each timeframe's role
+    (trigger or filter) and the start of its current bucket.
+    """
 
     if strategy_id is None:
         raise ValueError("strategy_id is required")
@@ -33,6 +39,7 @@ def alert(
         strategy_id=strategy_id,
         version=version,
         symbols=symbols,
+        timeframes=timeframes,
     )
 
     if error:
@@ -55,3 +62,45 @@ def alert(
             #'instances': [],
             #'error': error_obj,
         #}
+
+
+def alert_batch(
+    ctx: Context,
+    strategies: Optional[List[Dict[str, Any]]] = None,
+) -> Dict[str, Any]:
+    """Run several strategy alerts in one task.
+
+    Each entry takes the arguments of an alert task. Results are keyed by
+    strategy id; one strategy failing doesn't fail the others.
+    """
+    if not strategies:
+        raise ValueError("strategies is required")
+
+    results: Dict[str, Dict[str, Any]] = {}
+    for entry in strategies:
+        strategy_id = entry.get("strategy_id")
+        try:
+            results[str(strategy_id)] = alert(
+                ctx,
+                user_id=entry.get("user_id"),
+                symbols=entry.get("symbols"),
+                strategy_id=strategy_id,
+                timeframes=entry.get("timeframes"),
+            )
+        except NoSubscribersException:
+            raise
+        except Exception as exc:  # pylint: disable=broad-exception-caught
+            err = capture_exception(logger, exc)
+            results[str(strategy_id)] = {
+                'success': False,
+                'instances': [],
+                'error': {
+                    'type': str(err.get('type', 'Exception')),
+                    'message': str(err.get('message', 'unknown error')),
+                },
+            }
+
+    return {
+        'success': True,
+        'results': results,
+    }
@@ -16,6 +16,7 @@ def backtest(
     end_date: Optional[str] = None,
     strategy_id: Optional[int] = None,
     version: Optional[int] = None,
+    params: Optional[Dict[str, Any]] = None,
 ) -> Dict[str, Any]:
     """Execute backtest task using new accessor strategy engine"""
     if not strategy_id:
@@ -46,6 +47,7 @@ def backtest(
         strategy_id=strategy_id,
         version=version,
         symbols=symbols,
+        params=params,
         start_date=parsed_start_date,
         end_date=parsed_end_date,
     )
@@ -77,6 +79,8 @@ def backtest(
         "symbols_processed": len(symbols) if symbols else 0,
         "execution_type": "backtest",
     }
+    if params:
+        summary["params"] = params
 
     return {
         "success": True,
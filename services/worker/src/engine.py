@@ -94,14 +94,22 @@ def execute_strategy(
     start_date: datetime.datetime = datetime.datetime(2003, 1, 1),
     end_date: datetime.datetime = datetime.datetime.now(),
     symbols: Optional[List[str]] = None,
+    params: Optional[Dict[str, Any]] = None,
+    timeframes: Optional[Dict[str, Dict[str, Any]]] = None,
    # max_instances: int = 15000,
     #version: int = None # None means new strategy
 ) -> Tuple[List[Dict[str, Any]], str, List[Dict[str, Any]], List[Optional[str]], Optional[Dict[str, Any]]]:
-    """Execute the strategy function with data accessor context"""
+    """Execute the strategy function with data accessor context.
+
+    timeframes describes a multi-timeframe alert, keyed by timeframe with each
+    one's role ("trigger" or "filter") and current bucket_start (unix seconds).
+    """
 
     # Create safe execution environment with data accessor functions
     symbols_set: Optional[Set[str]] = set(symbols) if symbols else None
-    safe_globals: Dict[str, Any] = _create_safe_globals(ctx, start_date, end_date, symbols_set)
+    safe_globals: Dict[str, Any] = _create_safe_globals(ctx, start_date, end_date, symbols_set, timeframes)
+    # Sweep parameters; strategies read them with PARAMS.get(name, default)
+    safe_globals['PARAMS'] = dict(params or {})
     safe_locals: Dict[str, Any] = {}
     plots_collection: List[Dict[str, Any]] = []
     response_images: List[Optional[str]] = []
@@ -160,6 +168,7 @@ def _create_safe_globals(
     start_date: datetime.datetime,
     end_date: datetime.datetime,
     symbols_intersect: Optional[Set[str]],
+    timeframes: Optional[Dict[str, Dict[str, Any]]] = None,
 ) -> Dict[str, Any]:
     """Create safe execution environment with data accessor functions"""
 
@@ -214,6 +223,15 @@ def _create_safe_globals(
             normalized.pop('symbols', None)
         return normalized
 
+    def _bar_end_date(timeframe: str) -> datetime.datetime:
+        """Filter timeframes of a multi-timeframe alert only see completed bars,
+        so a filter doesn't flip while its bar is still forming"""
+        spec = (timeframes or {}).get(str(timeframe).lower())
+        if not spec or spec.get('role') != 'filter' or spec.get('bucket_start') is None:
+            return end_date
+        completed_end = dt.fromtimestamp(int(spec['bucket_start']) - 1)
+        return min(end_date, completed_end)
+
     def get_bar_data(
         timeframe: str,
         min_bars: int,
@@ -222,7 +240,7 @@ def _create_safe_globals(
         extended_hours: bool = False,
     ) -> Any:
         normalized_filters = _normalize_filters(filters)
-        return _get_bar_data(ctx, start_date, end_date, timeframe, columns, min_bars, normalized_filters, extended_hours)
+        return _get_bar_data(ctx, start_date, _bar_end_date(timeframe), timeframe, columns, min_bars, normalized_filters, extended_hours)
     def get_general_data(
         columns: Optional[List[str]] = None,
         filters: Optional[Dict[str, Any]] = None,
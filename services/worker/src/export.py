@@ -0,0 +1,118 @@
+import io
+import json
+import logging
+import zipfile
+from datetime import datetime, timedelta, timezone
+from typing import Any, Dict, List, Optional, Tuple
+
+from .utils.context import Context
+
+logger = logging.getLogger(__name__)
+
+# How long a finished archive stays downloadable
+EXPORT_RETENTION = timedelta(days=7)
+
+# One JSON file per entry; each query takes the user id as its only parameter
+# and returns a single json column. Keep in sync with PurgeUserData in the backend.
+EXPORT_QUERIES: List[Tuple[str, str]] = [
+    ("profile.json", "SELECT to_jsonb(u) - 'password' - 'totp_secret' - 'totp_recovery_codes' FROM users u WHERE u.userId = %s"),
+    ("strategies.json", "SELECT to_jsonb(s) FROM strategies s WHERE s.userId = %s ORDER BY s.strategyId"),
+    ("strategy_template_uses.json", "SELECT to_jsonb(u) FROM strategy_template_uses u WHERE u.user_id = %s ORDER BY u.created_at"),
+    ("alerts.json", "SELECT to_jsonb(a) FROM alerts a WHERE a.userId = %s ORDER BY a.alertId"),
+    ("alert_history.json", "SELECT to_jsonb(l) FROM alert_logs l WHERE l.user_id = %s ORDER BY l.timestamp"),
+    ("alert_feedback.json", "SELECT to_jsonb(f) FROM alert_feedback f WHERE f.user_id = %s ORDER BY f.created_at"),
+    ("alert_escalation_policies.json", "SELECT to_jsonb(p) FROM alert_escalation_policies p WHERE p.user_id = %s"),
+    ("notification_rate_limits.json", "SELECT to_jsonb(l) FROM notification_rate_limits l WHERE l.user_id = %s"),
+    ("trades.json", "SELECT to_jsonb(t) FROM trades t WHERE t.userId = %s"),
+    ("trade_executions.json", "SELECT to_jsonb(e) FROM trade_executions e WHERE e.userId = %s"),
+    ("studies.json", "SELECT to_jsonb(s) FROM studies s WHERE s.userId = %s"),
+    ("study_labels.json", "SELECT to_jsonb(l) FROM study_labels l WHERE l.user_id = %s"),
+    ("watchlists.json", """
+        SELECT to_jsonb(w) || jsonb_build_object('items', COALESCE(
+            (SELECT jsonb_agg(i.securityId) FROM watchlistItems i WHERE i.watchlistId = w.watchlistId),
+            '[]'::jsonb))
+        FROM watchlists w WHERE w.userId = %s"""),
+    ("horizontal_lines.json", "SELECT to_jsonb(h) FROM horizontal_lines h WHERE h.userId = %s"),
+    ("chart_drawings.json", "SELECT to_jsonb(d) FROM chart_drawings d WHERE d.user_id = %s"),
+    ("scheduled_reports.json", "SELECT to_jsonb(r) FROM scheduled_reports r WHERE r.user_id = %s ORDER BY r.report_id"),
+    ("report_runs.json", "SELECT to_jsonb(r) - 'pdf' FROM report_runs r WHERE r.user_id = %s ORDER BY r.created_at"),
+    ("workspace_memberships.json", """
+        SELECT to_jsonb(m) || jsonb_build_object('workspace_name', w.name)
+        FROM workspace_members m JOIN workspaces w ON w.workspace_id = m.workspace_id
+        WHERE m.user_id = %s ORDER BY m.workspace_id"""),
+    ("screener_columns.json", "SELECT to_jsonb(c) FROM screener_computed_columns c WHERE c.user_id = %s"),
+    ("conversations.json", """
+        SELECT to_jsonb(c) || jsonb_build_object('messages', COALESCE(
+            (SELECT jsonb_agg(to_jsonb(m) ORDER BY m.created_at)
+             FROM conversation_messages m WHERE m.conversation_id = c.conversation_id),
+            '[]'::jsonb))
+        FROM conversations c WHERE c.userId = %s ORDER BY c.created_at"""),
+]
+
+
+def export_user_data(ctx: Context, user_id: Optional[int] = None, export_id: Optional[int] = None) -> Dict[str, Any]:
+    """Compile everything stored for a user into a zip archive on their user_exports row"""
+    if not user_id:
+        raise ValueError("user_id is required")
+    if not export_id:
+        raise ValueError("export_id is required")
+
+    with ctx.conn.transaction() as cursor:
+        cursor.execute(
+            "UPDATE user_exports SET status = 'running' WHERE export_id = %s AND user_id = %s AND status = 'pending'",
+            (export_id, user_id),
+        )
+        if cursor.rowcount == 0:
+            raise ValueError(f"export {export_id} is not pending")
+
+    try:
+        archive, counts = _build_archive(ctx, user_id, export_id)
+    except Exception as e:
+        with ctx.conn.transaction() as cursor:
+            cursor.execute(
+                "UPDATE user_exports SET status = 'failed', error = %s, completed_at = NOW() WHERE export_id = %s",
+                (str(e)[:500], export_id),
+            )
+        raise
+
+    expires_at = datetime.now(timezone.utc) + EXPORT_RETENTION
+    with ctx.conn.transaction() as cursor:
+        cursor.execute(
+            """UPDATE user_exports
+               SET status = 'ready', archive = %s, size_bytes = %s, file_counts = %s,
+                   completed_at = NOW(), expires_at = %s
+               WHERE export_id = %s""",
+            (archive, len(archive), json.dumps(counts), expires_at, export_id),
+        )
+    logger.info("📦 Export %s for user %s ready: %d bytes", export_id, user_id, len(archive))
+
+    return {
+        "success": True,
+        "export_id": export_id,
+        "size_bytes": len(archive),
+        "files": counts,
+        "error": None,
+    }
+
+
+def _build_archive(ctx: Context, user_id: int, export_id: int) -> Tuple[bytes, Dict[str, int]]:
+    counts: Dict[str, int] = {}
+    buf = io.BytesIO()
+    with zipfile.ZipFile(buf, "w", zipfile.ZIP_DEFLATED) as zf:
+        for name, query in EXPORT_QUERIES:
+            ctx.check_for_cancellation()
+            with ctx.conn.transaction(cursor_factory=None) as cursor:
+                cursor.execute(query, (user_id,))
+                rows = [row[0] for row in cursor.fetchall()]
+            counts[name] = len(rows)
+            # The profile is a single object rather than a list
+            payload: Any = (rows[0] if rows else None) if name == "profile.json" else rows
+            zf.writestr(name, json.dumps(payload, indent=2, default=str))
+            ctx.publish_progress(f"Exported {name}", {"file": name, "rows": len(rows)})
+        zf.writestr("manifest.json", json.dumps({
+            "export_id": export_id,
+            "user_id": user_id,
+            "generated_at": datetime.now(timezone.utc).isoformat(),
+            "files": counts,
+        }, indent=2))
+    return buf.getvalue(), counts
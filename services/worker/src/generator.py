@@ -12,7 +12,7 @@ from typing import Dict, Any, Optional, List, cast
 from google.genai import types
 from .validator import validate_strategy
 from .utils.context import Context
-from .utils.strategy_crud import fetch_strategy_code, save_strategy
+from .utils.strategy_crud import fetch_strategy_code, save_strategy, fetch_labeled_examples
 from .utils.error_utils import capture_exception
 from .utils.errors import ModelGenerationError
 from .utils.data_accessors import get_available_filter_values, get_available_fundamental_fields
@@ -26,40 +26,53 @@ _TIMEFRAME_RE = re.compile(
     re.MULTILINE,
 )
 
+def _timeframe_minutes(tf: str) -> int:
+    """Convert timeframe string to minutes for comparison.
+
+    Keep in line with timeframeMinutes in services/backend/internal/services/alerts/timeframes.go.
+    """
+    # Parse using similar logic to data_accessors._parse_timeframe
+    pattern = r'^(\d+)([mhdwqy]?)$'
+    match = re.match(pattern, tf.lower())
+    if not match:
+        return 1440  # Default to 1 day in minutes
+
+    value, unit = match.groups()
+    value = int(value)
+
+    # Convert to minutes
+    if not unit or unit == 'm':  # minutes (no unit means minutes)
+        return value
+    if unit == 'h':  # hours
+        return value * 60
+    if unit == 'd':  # days
+        return value * 1440
+    if unit == 'w':  # weeks
+        return value * 10080
+    if unit == 'q':  # quarters (3 months = ~90 days)
+        return value * 129600
+    if unit == 'y':  # years (365 days)
+        return value * 525600
+    return 1440  # Default fallback
+
+
+def _detect_timeframes(code: str) -> List[str]:
+    """Extract every timeframe strategy code reads bars in, finest first.
+
+    A strategy alert spans all of them: the finest triggers it and the coarser
+    ones filter it.
+    """
+    matches: List[str] = cast(List[str], _TIMEFRAME_RE.findall(code))
+    return sorted({tf.lower() for tf in matches}, key=lambda tf: (_timeframe_minutes(tf), tf))
+
+
 def _detect_min_timeframe(code: str) -> str:
     """Extract the minimum timeframe from strategy code by parsing get_bar_data calls"""
-    matches: List[str] = cast(List[str], _TIMEFRAME_RE.findall(code))
-    if not matches:
+    timeframes = _detect_timeframes(code)
+    if not timeframes:
         return "1d"  # Default fallback
-    
-    def tf_as_minutes(tf: str) -> int:
-        """Convert timeframe string to minutes for comparison"""
-        # Parse using similar logic to data_accessors._parse_timeframe
-        pattern = r'^(\d+)([mhdwqy]?)$'
-        match = re.match(pattern, tf.lower())
-        if not match:
-            return 1440  # Default to 1 day in minutes
-        
-        value, unit = match.groups()
-        value = int(value)
-        
-        # Convert to minutes
-        if not unit or unit == 'm':  # minutes (no unit means minutes)
-            return value
-        if unit == 'h':  # hours
-            return value * 60
-        if unit == 'd':  # days
-            return value * 1440
-        if unit == 'w':  # weeks
-            return value * 10080
-        if unit == 'q':  # quarters (3 months = ~90 days)
-            return value * 129600
-        if unit == 'y':  # years (365 days)
-            return value * 525600
-        return 1440  # Default fallback
-    
     # Return the timeframe with the smallest duration
-    return min(matches, key=tf_as_minutes)
+    return timeframes[0]
 
 
 def _parse_filter_needs_response(response: Any) -> Dict[str, bool]:
@@ -513,9 +526,11 @@ def create_strategy(ctx: Context, user_id: int, prompt: str, strategy_id: int =
             "error": "Failed to generate valid strategy code after retries"
         }
 
-    # Detect minimum timeframe from the generated strategy code
+    # Detect the timeframes the generated strategy code uses; the minimum
+    # triggers its alert and the others filter it
     min_timeframe = _detect_min_timeframe(strategy_code)
-    logger.info("Detected minimum timeframe for strategy: %s", min_timeframe)
+    alert_timeframes = _detect_timeframes(strategy_code)
+    logger.info("Detected timeframes for strategy: %s (minimum %s)", alert_timeframes, min_timeframe)
 
     # Extract ticker universe from the generated strategy code
     ticker_extraction = extract_tickers(strategy_code)
@@ -541,7 +556,8 @@ def create_strategy(ctx: Context, user_id: int, prompt: str, strategy_id: int =
         python_code=strategy_code,
         strategy_id=strategy_id if is_edit else None,
         min_timeframe=min_timeframe,
-        alert_universe_full=alert_universe_full if not is_global_strategy else None
+        alert_universe_full=alert_universe_full if not is_global_strategy else None,
+        alert_timeframes=alert_timeframes or None,
     )
 
     return {
@@ -584,6 +600,22 @@ def _generate_and_validate_strategy(
     return ""
 
 
+def _format_labeled_examples(ctx: Context, user_id: int) -> str:
+    """Render the user's labeled study instances as prompt examples"""
+    try:
+        examples = fetch_labeled_examples(ctx, user_id)
+    except Exception as e:  # pylint: disable=broad-except
+        logger.warning("Failed to fetch labeled examples for user %s: %s", user_id, e)
+        return ""
+    if not examples:
+        return ""
+    lines = ["\n\nLABELED EXAMPLES (instances the user labeled; use labels that match the request as positive/negative examples):"]
+    for example in examples:
+        timestamp = example.get('timestamp')
+        when = timestamp.strftime('%Y-%m-%d %H:%M') if isinstance(timestamp, datetime) else str(timestamp)
+        lines.append(f"- {example.get('ticker')} @ {when}: {', '.join(example.get('labels') or [])}")
+    return "\n".join(lines)
+
 def _generate_strategy_code(
     ctx: Context,
     user_id: int,
@@ -611,6 +643,10 @@ def _generate_strategy_code(
 
             user_prompt = f"""CREATE STRATEGY: {prompt}"""
 
+        # Instances the user labeled in studies, as reference examples
+        labeled_examples = _format_labeled_examples(ctx, user_id)
+        if labeled_examples:
+            user_prompt += labeled_examples
 
         # Add retry-specific guidance with error context
         if last_error:
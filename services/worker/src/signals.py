@@ -0,0 +1,69 @@
+import logging
+from datetime import datetime
+from typing import List, Dict, Any, Optional
+from .engine import execute_strategy
+from .utils.strategy_crud import fetch_strategy_code
+from .utils.context import Context
+
+logger = logging.getLogger(__name__)
+
+def signals(
+    ctx: Context,
+    user_id: Optional[int] = None,
+    strategy_id: Optional[int] = None,
+    version: Optional[int] = None,
+    ticker: Optional[str] = None,
+    start_date: Optional[str] = None,
+    end_date: Optional[str] = None,
+) -> Dict[str, Any]:
+    """Return the timestamps where a strategy's conditions were met for a single ticker"""
+    if not strategy_id:
+        raise ValueError("strategy_id is required")
+    if user_id is None:
+        raise ValueError("user_id is required")
+    if not ticker:
+        raise ValueError("ticker is required")
+    if start_date is None or end_date is None:
+        raise ValueError("start_date and end_date are required for signals")
+
+    strategy_code, version = fetch_strategy_code(ctx, user_id, strategy_id, version)
+
+    parsed_start_date = datetime.strptime(start_date, '%Y-%m-%d')
+    parsed_end_date = datetime.strptime(end_date, '%Y-%m-%d')
+    if parsed_start_date > parsed_end_date:
+        raise ValueError("start_date must be before end_date")
+
+    instances, _, _, _, error = execute_strategy(
+        ctx,
+        strategy_code,
+        strategy_id=strategy_id,
+        version=version,
+        symbols=[ticker],
+        start_date=parsed_start_date,
+        end_date=parsed_end_date,
+    )
+    if error:
+        return {
+            "success": False,
+            "error": error,
+            "strategy_id": strategy_id,
+            "version": version,
+            "ticker": ticker,
+            "timestamps": [],
+        }
+
+    # Strategies may emit instances for referenced tickers (e.g. SPY); keep only the requested one
+    timestamps: List[int] = sorted({
+        int(instance['timestamp'])
+        for instance in instances
+        if instance.get('ticker') == ticker and isinstance(instance.get('timestamp'), (int, float))
+    })
+
+    return {
+        "success": True,
+        "strategy_id": strategy_id,
+        "version": version,
+        "ticker": ticker,
+        "timestamps": timestamps,
+        "error": None,
+    }
@@ -0,0 +1,175 @@
+import logging
+from datetime import datetime, timedelta
+from typing import Any, Dict, List, Optional, Tuple
+
+from .engine import execute_strategy
+from .utils.context import Context
+from .utils.strategy_crud import fetch_strategy_code
+
+logger = logging.getLogger(__name__)
+
+# Most triggers a simulation returns; the earliest are kept
+MAX_TRIGGERS = 500
+# ohlcv prices are stored as integers scaled by this
+PRICE_SCALE = 1000.0
+
+
+def simulate_alert(
+    ctx: Context,
+    user_id: Optional[int] = None,
+    alert_type: Optional[str] = None,
+    start_date: Optional[str] = None,
+    end_date: Optional[str] = None,
+    strategy_id: Optional[int] = None,
+    symbols: Optional[List[str]] = None,
+    threshold: Optional[float] = None,
+    ticker: Optional[str] = None,
+    price: Optional[float] = None,
+    direction: Optional[bool] = None,
+) -> Dict[str, Any]:
+    """Replay a price or strategy alert over past data and list where it would have triggered.
+
+    A price alert triggers when a 1m bar reaches its level and re-arms once a
+    bar closes back on the side it was waiting from. A strategy alert
+    triggers on every instance its strategy produces in the range, less those
+    scoring under threshold.
+    """
+    if user_id is None:
+        raise ValueError("user_id is required")
+    if start_date is None or end_date is None:
+        raise ValueError("start_date and end_date are required for alert simulation")
+    parsed_start_date = datetime.strptime(start_date, '%Y-%m-%d')
+    parsed_end_date = datetime.strptime(end_date, '%Y-%m-%d')
+    if parsed_start_date > parsed_end_date:
+        raise ValueError("start_date must be before end_date")
+
+    if alert_type == "price":
+        if not ticker or price is None:
+            raise ValueError("ticker and price are required for a price alert")
+        triggers = _simulate_price_alert(ctx, ticker, price, direction, parsed_start_date, parsed_end_date)
+        below_threshold = 0
+    elif alert_type == "strategy":
+        if not strategy_id:
+            raise ValueError("strategy_id is required for a strategy alert")
+        if symbols is not None and len(symbols) == 0:
+            raise ValueError("symbols length must be greater than 0")
+        strategy_code, version = fetch_strategy_code(ctx, user_id, strategy_id)
+        instances, _, _, _, error = execute_strategy(
+            ctx,
+            strategy_code,
+            strategy_id=strategy_id,
+            version=version,
+            symbols=symbols,
+            start_date=parsed_start_date,
+            end_date=parsed_end_date,
+        )
+        if error:
+            return {
+                "success": False,
+                "error": error,
+                "alert_type": alert_type,
+                "triggers": [],
+            }
+        triggers, below_threshold = _strategy_triggers(ctx, instances, threshold)
+    else:
+        raise ValueError(f"unknown alert_type {alert_type!r}, expected price or strategy")
+
+    total = len(triggers)
+    return {
+        "success": True,
+        "alert_type": alert_type,
+        "triggers": triggers[:MAX_TRIGGERS],
+        "total_triggers": total,
+        "below_threshold": below_threshold,
+        "truncated": total > MAX_TRIGGERS,
+        "error": None,
+    }
+
+
+def _simulate_price_alert(
+    ctx: Context,
+    ticker: str,
+    price: float,
+    direction: Optional[bool],
+    start: datetime,
+    end: datetime,
+) -> List[Dict[str, Any]]:
+    """Walk the 1m bars of [start, end] and record every time price was reached.
+
+    direction is True when the alert waits for the price to rise to its level.
+    Without one it is taken from the first bar, like a new alert takes it
+    from the last trade.
+    """
+    with ctx.conn.transaction(cursor_factory=None) as cursor:
+        cursor.execute(
+            """SELECT (extract(epoch FROM "timestamp") * 1000)::bigint,
+                      open / %s, high / %s, low / %s, close / %s
+               FROM ohlcv_1m
+               WHERE ticker = %s AND "timestamp" >= %s AND "timestamp" < %s
+               ORDER BY 1""",
+            (PRICE_SCALE, PRICE_SCALE, PRICE_SCALE, PRICE_SCALE, ticker, start, end + timedelta(days=1)),
+        )
+        bars = cursor.fetchall()
+
+    triggers: List[Dict[str, Any]] = []
+    armed = False
+    for i, (timestamp, bar_open, high, low, close) in enumerate(bars):
+        if i % 5000 == 0:
+            ctx.check_for_cancellation()
+        if bar_open is None or high is None or low is None or close is None:
+            continue
+        bar_open, high, low, close = float(bar_open), float(high), float(low), float(close)
+        if direction is None:
+            direction = price > bar_open
+        # An alert only arms once price is on the side it waits from
+        if not armed:
+            armed = bar_open < price if direction else bar_open > price
+        if armed and (high >= price if direction else low <= price):
+            # A bar gapping through the level fills at its open
+            fill = max(bar_open, price) if direction else min(bar_open, price)
+            triggers.append({"timestamp": int(timestamp), "ticker": ticker, "price": round(fill, 4)})
+            armed = False
+        if not armed:
+            armed = close < price if direction else close > price
+    return triggers
+
+
+def _strategy_triggers(
+    ctx: Context,
+    instances: List[Dict[str, Any]],
+    threshold: Optional[float],
+) -> Tuple[List[Dict[str, Any]], int]:
+    """Turn strategy instances into triggers ordered by time, priced at the
+    last 1m close at or before each one"""
+    triggers: List[Dict[str, Any]] = []
+    below_threshold = 0
+    for instance in instances:
+        ticker = instance.get('ticker')
+        timestamp = instance.get('timestamp')
+        if not ticker or not isinstance(timestamp, (int, float)):
+            continue
+        score = instance.get('score')
+        if threshold is not None and isinstance(score, (int, float)) and score < threshold:
+            below_threshold += 1
+            continue
+        triggers.append({
+            "timestamp": int(timestamp) * 1000,
+            "ticker": ticker,
+            "score": score if isinstance(score, (int, float)) else None,
+        })
+    triggers.sort(key=lambda t: (t["timestamp"], t["ticker"]))
+
+    priced = triggers[:MAX_TRIGGERS]
+    if priced:
+        with ctx.conn.transaction(cursor_factory=None) as cursor:
+            cursor.execute(
+                """SELECT (SELECT b.close / %s FROM ohlcv_1m b
+                           WHERE b.ticker = t.ticker AND b."timestamp" <= to_timestamp(t.ts / 1000.0)
+                           ORDER BY b."timestamp" DESC LIMIT 1)
+                   FROM unnest(%s::text[], %s::bigint[]) WITH ORDINALITY AS t(ticker, ts, n)
+                   ORDER BY t.n""",
+                (PRICE_SCALE, [t["ticker"] for t in priced], [t["timestamp"] for t in priced]),
+            )
+            for trigger, (close,) in zip(priced, cursor.fetchall()):
+                trigger["price"] = round(float(close), 4) if close is not None else None
+    return triggers, below_threshold
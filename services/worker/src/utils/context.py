@@ -5,6 +5,7 @@ import logging
 from typing import Dict, Any, Optional
 from datetime import datetime
 from .conn import Conn
+from .protocol import PROTOCOL_VERSION
 
 logger = logging.getLogger(__name__)
 
@@ -18,9 +19,11 @@ class Context():
     It is used to publish progress updates, results, and heartbeats to the Redis pubsub system.
     """
 
-    def __init__(self, conn: Conn, task_id: str, status_id: str, heartbeat_interval: int, queue_type: str, priority: str, worker_id: str, skip_heartbeat: bool = False):
+    def __init__(self, conn: Conn, task_id: str, status_id: str, heartbeat_interval: int, queue_type: str, priority: str, worker_id: str, skip_heartbeat: bool = False, deadline: Optional[float] = None):
         self.conn = conn
         self.start_time = time.time()
+        # Epoch seconds past which the backend no longer waits on the task, if it set one
+        self.deadline = deadline
         self.task_id = task_id
         self.status_id = status_id
         self.heartbeat_interval = heartbeat_interval
@@ -67,7 +70,8 @@ class Context():
             "status": status,
             "data": data,
             "elapsed_time": elapsed_time,
-            "error": error
+            "error": error,
+            "protocol_version": PROTOCOL_VERSION,
         }))
         if subscribers == 0:
             raise NoSubscribersException(f"No subscribers for task {self.task_id}")
@@ -113,7 +117,16 @@ class Context():
         self.conn.redis_client.delete(f"task_heartbeats:{self.task_id}")
         self.conn.redis_client.delete(f"task_progress:{self.task_id}")
 
+    def remaining_time(self) -> Optional[float]:
+        """Seconds left before the task's deadline, or None if it has none."""
+        if self.deadline is None:
+            return None
+        return self.deadline - time.time()
+
     def check_for_cancellation(self) -> None:
-        """Check if task cancellation has been requested."""
+        """Check if task cancellation has been requested or the task ran out of time."""
         if self._cancellation_event.is_set():
             raise NoSubscribersException("Task cancelled due to no subscribers.")
+        remaining = self.remaining_time()
+        if remaining is not None and remaining <= 0:
+            raise TimeoutError(f"Task {self.task_id} ran past its timeout")
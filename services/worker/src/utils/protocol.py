@@ -0,0 +1,38 @@
+"""
+Task protocol versioning shared with the backend.
+
+Tasks from the backend carry the protocol version it speaks and every message
+the worker publishes carries the version it writes. Versions are MAJOR.MINOR:
+a new minor only adds fields, a new major changes or removes them. The backend
+translates results from older majors and refuses newer ones; the worker refuses
+tasks whose major differs from its own. Keep in sync with ProtocolMajor and
+ProtocolMinor in services/backend/internal/queue/protocol.go.
+"""
+
+from typing import Optional
+
+PROTOCOL_MAJOR = 2
+PROTOCOL_MINOR = 3
+PROTOCOL_VERSION = f"{PROTOCOL_MAJOR}.{PROTOCOL_MINOR}"
+
+PROTOCOL_MISMATCH = "ProtocolMismatch"
+
+
+def task_protocol_error(version: Optional[str]) -> Optional[str]:
+    """Return why a task in the given protocol version can't be run, or None if it can.
+
+    Tasks without a version come from a backend that predates versioning and
+    are run as before.
+    """
+    if not version:
+        return None
+    try:
+        major = int(str(version).split(".", 1)[0])
+    except ValueError:
+        return f"invalid task protocol version {version!r}"
+    if major != PROTOCOL_MAJOR:
+        return (
+            f"backend sent task protocol {version} but this worker speaks {PROTOCOL_VERSION}; "
+            "deploy matching backend and worker versions"
+        )
+    return None
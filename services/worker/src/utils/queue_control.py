@@ -0,0 +1,53 @@
+"""
+Queue pause and drain controls shared with the backend.
+
+An operator can pause the task queue (workers stop pulling, queued tasks wait)
+or drain it (workers keep pulling until nothing is left, while the backend
+refuses new tasks). Workers also record the task they are running so a drain
+can tell when it is done. Keep in sync with
+services/backend/internal/queue/control.go.
+"""
+
+import json
+import socket
+import time
+from typing import Any
+
+CONTROL_KEY = "queue:control"
+IN_FLIGHT_KEY = "queue:inflight"
+
+QUEUE_PAUSED = "paused"
+
+
+def queue_paused(redis_client: Any) -> bool:
+    """Return whether workers should stop pulling tasks.
+
+    If the state can't be read the worker keeps pulling, as it did before
+    queue controls existed.
+    """
+    try:
+        state = redis_client.hget(CONTROL_KEY, "state")
+    except Exception:  # pylint: disable=broad-exception-caught
+        return False
+    if isinstance(state, bytes):
+        state = state.decode()
+    return state == QUEUE_PAUSED
+
+
+def _in_flight_field(worker_id: str) -> str:
+    # Worker ids come from thread idents, which repeat across containers
+    return f"{socket.gethostname()}/{worker_id}"
+
+
+def mark_in_flight(redis_client: Any, worker_id: str, task_id: str, task_type: str) -> None:
+    """Record the task this worker is running"""
+    redis_client.hset(IN_FLIGHT_KEY, _in_flight_field(worker_id), json.dumps({
+        "task_id": task_id,
+        "task_type": task_type,
+        "started_at": time.time(),
+    }))
+
+
+def clear_in_flight(redis_client: Any, worker_id: str) -> None:
+    """Forget the task this worker was running"""
+    redis_client.hdel(IN_FLIGHT_KEY, _in_flight_field(worker_id))
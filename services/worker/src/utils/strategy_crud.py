@@ -86,6 +86,7 @@ def save_strategy(
     strategy_id: Optional[int] = None,
     min_timeframe: Optional[str] = None,
     alert_universe_full: Optional[List[str]] = None,
+    alert_timeframes: Optional[List[str]] = None,
 ) -> Dict[str, Any]:
     """Save strategy to database with duplicate name handling"""
 
@@ -109,28 +110,35 @@ def save_strategy(
             strategy_name = version_result["name"]
             next_version = version_result["next_version"]
 
-            # Insert new row with incremented version (preserves old version)
+            # Insert new row with incremented version (preserves old version);
+            # it stays in the workspace the strategy is shared to
             cursor.execute(
                 """
                 INSERT INTO strategies (userid, name, description, prompt, pythoncode,
-                                        createdat, updated_at, alertactive, score, version, min_timeframe, alert_universe_full)
-                VALUES (%s, %s, %s, %s, %s, NOW(), NOW(), false, 0, %s, %s, %s)
+                                        createdat, updated_at, alertactive, score, version, min_timeframe, alert_universe_full,
+                                        alert_timeframes, workspace_id)
+                VALUES (%s, %s, %s, %s, %s, NOW(), NOW(), false, 0, %s, %s, %s, %s,
+                        (SELECT workspace_id FROM strategies WHERE strategyid = %s))
                 RETURNING strategyid, name, description, prompt, pythoncode,
-                            createdat, updated_at, alertactive, version, min_timeframe, alert_universe_full
+                            createdat, updated_at, alertactive, version, min_timeframe, alert_universe_full,
+                            alert_timeframes
                 """,
-                (user_id, strategy_name, description, prompt, python_code, next_version, min_timeframe, alert_universe_full),
+                (user_id, strategy_name, description, prompt, python_code, next_version, min_timeframe, alert_universe_full,
+                 alert_timeframes, strategy_id),
             )
         else:
             # Create new strategy - always start at version 1
             cursor.execute(
                 """
                 INSERT INTO strategies (userid, name, description, prompt, pythoncode,
-                                        createdat, updated_at, alertactive, score, version, min_timeframe, alert_universe_full)
-                VALUES (%s, %s, %s, %s, %s, NOW(), NOW(), false, 0, 1, %s, %s)
+                                        createdat, updated_at, alertactive, score, version, min_timeframe, alert_universe_full,
+                                        alert_timeframes)
+                VALUES (%s, %s, %s, %s, %s, NOW(), NOW(), false, 0, 1, %s, %s, %s)
                 RETURNING strategyid, name, description, prompt, pythoncode,
-                            createdat, updated_at, alertactive, version, min_timeframe, alert_universe_full
+                            createdat, updated_at, alertactive, version, min_timeframe, alert_universe_full,
+                            alert_timeframes
                 """,
-                (user_id, name, description, prompt, python_code, min_timeframe, alert_universe_full),
+                (user_id, name, description, prompt, python_code, min_timeframe, alert_universe_full, alert_timeframes),
             )
 
         result = cursor.fetchone()
@@ -149,5 +157,29 @@ def save_strategy(
             "isAlertActive": result["alertactive"],
             "minTimeframe": result["min_timeframe"],
             "alertUniverseFull": result["alert_universe_full"],
+            "alertTimeframes": result["alert_timeframes"],
         }
-    raise ValueError("Failed to save strategy - no result returned")
\ No newline at end of file
+    raise ValueError("Failed to save strategy - no result returned")
+
+def fetch_labeled_examples(ctx: Context, user_id: int, limit: int = 20) -> List[Dict[str, Any]]:
+    """Fetch the user's most recently labeled study instances for use as examples"""
+    with ctx.conn.transaction() as cursor:
+        cursor.execute(
+            """
+            SELECT sec.ticker, s.timestamp, ARRAY_AGG(l.label ORDER BY l.label) AS labels
+            FROM study_labels l
+            JOIN studies s ON s.studyId = l.study_id
+            JOIN LATERAL (
+                SELECT ticker FROM securities
+                WHERE securityId = s.securityId
+                ORDER BY maxDate IS NULL DESC, maxDate DESC
+                LIMIT 1
+            ) sec ON true
+            WHERE l.user_id = %s
+            GROUP BY s.studyId, sec.ticker, s.timestamp
+            ORDER BY MAX(l.created_at) DESC
+            LIMIT %s
+            """,
+            (user_id, limit)
+        )
+        return [dict(row) for row in cursor.fetchall()]
@@ -154,7 +154,7 @@ ALLOWED_ENTRYPOINTS = {"strategy", "code"}
 
 required_instance_fields = {"ticker", "timestamp"}
 reserved_global_names = {"pd", "pandas", "np", "numpy", "datetime", "timedelta", "math",
-                                     "get_bar_data", "get_general_data", "get_fundamentals_data"}
+                                     "get_bar_data", "get_general_data", "get_fundamentals_data", "PARAMS"}
 
         # Data accessor function names
 data_accessor_functions = {"get_bar_data", "get_general_data", "get_fundamentals_data"}
@@ -16,11 +16,16 @@ from typing import Any, Callable, Dict, Optional, Tuple, cast
 from src.agent import python_agent
 from src.backtest import backtest
 from src.screen import screen
-from src.alert import alert
+from src.alert import alert, alert_batch
+from src.signals import signals
+from src.simulate import simulate_alert
 from src.generator import create_strategy
+from src.export import export_user_data
 from src.utils.conn import Conn
 from src.utils.context import Context, NoSubscribersException
 from src.utils.error_utils import capture_exception
+from src.utils.protocol import PROTOCOL_MISMATCH, task_protocol_error
+from src.utils.queue_control import clear_in_flight, mark_in_flight, queue_paused
 
 # Configure logging
 logging.basicConfig(
@@ -30,6 +35,23 @@ logging.basicConfig(
 )
 logger = logging.getLogger(__name__)
 
+def task_deadline(task_data: Dict[str, Any]) -> Optional[float]:
+    """Epoch seconds by which a task must finish: one run timeout from now,
+    cut short by the deadline the backend stops waiting at. None for tasks
+    from backends that send neither."""
+    deadlines = []
+    timeout = task_data.get('timeout_seconds')
+    if timeout:
+        deadlines.append(time.time() + float(timeout))
+    backend_deadline = task_data.get('deadline')
+    if backend_deadline:
+        try:
+            deadlines.append(datetime.fromisoformat(str(backend_deadline).replace('Z', '+00:00')).timestamp())
+        except ValueError:
+            logger.warning("⚠️ Ignoring invalid task deadline %r", backend_deadline)
+    return min(deadlines) if deadlines else None
+
+
 class Worker:
     """Redis queue-based strategy execution worker"""
     
@@ -48,8 +70,12 @@ class Worker:
             'backtest': backtest,
             'screen': screen,
             'alert': alert,
+            'alert_batch': alert_batch,
+            'signals': signals,
+            'alert_simulation': simulate_alert,
             'create_strategy': create_strategy,
-            'python_agent': python_agent
+            'python_agent': python_agent,
+            'export_user_data': export_user_data
         }
         self._worker_start_time = time.time()
         logger.info("🎯 Strategy worker %s started at %s", self.worker_id, datetime.now().strftime('%Y-%m-%d %H:%M:%S'))
@@ -59,7 +85,18 @@ class Worker:
 
 
 
+        paused_logged = False
         while True:
+            if queue_paused(self.conn.redis_client):
+                if not paused_logged:
+                    logger.info("⏸️ Task queue paused, waiting for resume")
+                    paused_logged = True
+                time.sleep(5)
+                continue
+            if paused_logged:
+                logger.info("▶️ Task queue resumed")
+                paused_logged = False
+
             task: Optional[Tuple[str, str]] = cast(
                 Optional[Tuple[str, str]],
                 self.conn.redis_client.brpop(['priority_task_queue', 'task_queue'], timeout=30)
@@ -68,6 +105,11 @@ class Worker:
                 self.conn.check_connections()
                 continue
             queue_name, task_data_str = task
+            if queue_paused(self.conn.redis_client):
+                # Paused while this worker was blocked on the queue; put the
+                # task back where it was taken from
+                self.conn.redis_client.rpush(queue_name, task_data_str)
+                continue
             self.tasks_processed += 1
             # parsing of task data, this shouldnt fail unless the task data is malformed which is not task dependent
             # therefore this shouldnt send an error message back as this cannot happen
@@ -87,13 +129,32 @@ class Worker:
                 logger.error("❌ Missing required task data: %s", task_data)
                 continue
             heartbeat_interval: int = int(heartbeat_interval_val)
+            deadline = task_deadline(task_data)
 
             func = self.func_map.get(task_type, None)
             if func is None:
                 logger.error("❌ Unknown task type: %s.", task_type)
                 continue
 
-            execution_context = Context(self.conn, task_id, status_id, heartbeat_interval, queue_name, priority, self.worker_id) #new execution context for each task
+            protocol_error = task_protocol_error(task_data.get('protocol_version'))
+            if protocol_error:
+                # Answer without running, so the backend fails the task instead of retrying it
+                logger.error("❌ Refusing task %s: %s", task_id, protocol_error)
+                refusal = Context(self.conn, task_id, status_id, heartbeat_interval, queue_name, priority, self.worker_id, skip_heartbeat=True)
+                refusal.publish_result({}, {"type": PROTOCOL_MISMATCH, "message": protocol_error}, "error")
+                refusal.destroy()
+                continue
+
+            if deadline is not None and deadline <= time.time():
+                # Nobody is waiting on the result anymore
+                logger.warning("⏰ Dropping task %s: it expired in the queue", task_id)
+                expired = Context(self.conn, task_id, status_id, heartbeat_interval, queue_name, priority, self.worker_id, skip_heartbeat=True)
+                expired.publish_result({}, {"type": "TimeoutError", "message": "task expired before a worker picked it up"}, "error")
+                expired.destroy()
+                continue
+
+            execution_context = Context(self.conn, task_id, status_id, heartbeat_interval, queue_name, priority, self.worker_id, deadline=deadline) #new execution context for each task
+            mark_in_flight(self.conn.redis_client, self.worker_id, task_id, task_type)
             kwargs["ctx"] = execution_context
             logger.info("🔧 Executing %s with args: %s", task_type, kwargs)
 
@@ -131,6 +192,7 @@ class Worker:
                 logger.info("💓 Publishing result for task %s %s", task_id, status)
                 execution_context.publish_result(result, error_payload, status) #publish result and stop heartbeat
                 execution_context.destroy() #stop heartbeat and context
+                clear_in_flight(self.conn.redis_client, self.worker_id)
 
 if __name__ == "__main__":
     Worker().run()